@@ -1,7 +1,11 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/YubiApp/internal/config"
 	"github.com/YubiApp/internal/server"
@@ -16,7 +20,46 @@ func main() {
 
 	// Initialize and start the server
 	srv := server.New(cfg)
-	if err := srv.Start(); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Start()
+	}()
+
+	// Run until the server fails or SIGINT/SIGTERM asks it to stop
+	signals, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// SIGHUP reloads the runtime settings (log level, rate limits)
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+
+wait:
+	for {
+		select {
+		case err := <-serveErr:
+			if err != nil {
+				log.Fatalf("Failed to start server: %v", err)
+			}
+			return
+		case <-hangups:
+			if err := srv.Reload(); err != nil {
+				log.Printf("Configuration not reloaded: %v", err)
+			}
+		case <-signals.Done():
+			break wait
+		}
+	}
+	signal.Stop(hangups)
+	stop() // A second signal kills the process without waiting
+
+	log.Printf("Shutting down, waiting up to %s for in-flight work", cfg.Server.ShutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Fatalf("Shutdown did not complete: %v", err)
+	}
+	if err := <-serveErr; err != nil {
+		log.Fatalf("Server stopped with error: %v", err)
 	}
-} 
\ No newline at end of file
+	log.Printf("Server stopped")
+}
@@ -12,13 +12,20 @@ import (
 )
 
 var createActionCmd = &cobra.Command{
-	Use:   "create",
-	Short: "Create a new action",
+	Use:         "create",
+	Short:       "Create a new action",
+	Annotations: remoteCapable,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if Remote != nil {
+			return remoteCreateAction(cmd, args)
+		}
+
 		name, _ := cmd.Flags().GetString("name")
 		actionType, _ := cmd.Flags().GetString("type")
 		details, _ := cmd.Flags().GetString("details")
 		active, _ := cmd.Flags().GetBool("active")
+		allowSessionAuth, _ := cmd.Flags().GetBool("allow-session-auth")
+		sessionPermission, _ := cmd.Flags().GetString("session-permission")
 
 		// Parse details JSON if provided
 		var detailsJSON interface{}
@@ -57,21 +64,27 @@ var createActionCmd = &cobra.Command{
 			RequiredPermissions:  requiredPermissionsJSONB,
 			Details:              detailsJSONB,
 			Active:               active,
+			AllowSessionAuth:     allowSessionAuth,
+			SessionPermission:    sessionPermission,
 		}
 
 		if err := DB.Create(&action).Error; err != nil {
 			return fmt.Errorf("failed to create action: %w", err)
 		}
 
-		fmt.Printf("Action created: %s (%s)\n", action.Name, action.ID)
-		return nil
+		return printActionResult("created", newActionOutput(&action))
 	},
 }
 
 var listActionsCmd = &cobra.Command{
-	Use:   "list",
-	Short: "List all actions",
+	Use:         "list",
+	Short:       "List all actions",
+	Annotations: remoteCapable,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if Remote != nil {
+			return remoteListActions(cmd, args)
+		}
+
 		activeOnly, _ := cmd.Flags().GetBool("active-only")
 
 		var actions []database.Action
@@ -84,27 +97,24 @@ var listActionsCmd = &cobra.Command{
 			return fmt.Errorf("failed to fetch actions: %w", err)
 		}
 
-		fmt.Printf("Found %d actions:\n\n", len(actions))
-		for _, action := range actions {
-			detailsStr := "null"
-			if action.Details.Status == pgtype.Present {
-				if detailsBytes, err := json.Marshal(action.Details.Bytes); err == nil {
-					detailsStr = string(detailsBytes)
-				}
-			}
-
-			fmt.Printf("ID: %s\n  Name: %s\n  Type: %s\n  Active: %t\n  Details: %s\n  Created: %s\n  Updated: %s\n\n",
-				action.ID, action.Name, action.ActivityType, action.Active, detailsStr, action.CreatedAt.Format(time.RFC3339), action.UpdatedAt.Format(time.RFC3339))
+		items := make([]actionOutput, len(actions))
+		for i := range actions {
+			items[i] = newActionOutput(&actions[i])
 		}
-		return nil
+		return printActionList(items)
 	},
 }
 
 var updateActionCmd = &cobra.Command{
-	Use:   "update",
-	Short: "Update an action",
-	Args:  cobra.ExactArgs(1),
+	Use:         "update",
+	Short:       "Update an action",
+	Args:        cobra.ExactArgs(1),
+	Annotations: remoteCapable,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if Remote != nil {
+			return remoteUpdateAction(cmd, args)
+		}
+
 		identifier := args[0]
 		name, _ := cmd.Flags().GetString("name")
 		actionType, _ := cmd.Flags().GetString("type")
@@ -140,21 +150,31 @@ var updateActionCmd = &cobra.Command{
 		if cmd.Flags().Changed("active") {
 			action.Active = active
 		}
+		if cmd.Flags().Changed("allow-session-auth") {
+			action.AllowSessionAuth, _ = cmd.Flags().GetBool("allow-session-auth")
+		}
+		if cmd.Flags().Changed("session-permission") {
+			action.SessionPermission, _ = cmd.Flags().GetString("session-permission")
+		}
 
 		if err := DB.Save(&action).Error; err != nil {
 			return fmt.Errorf("failed to update action: %w", err)
 		}
 
-		fmt.Printf("Action updated: %s (%s)\n", action.Name, action.ID)
-		return nil
+		return printActionResult("updated", newActionOutput(&action))
 	},
 }
 
 var deleteActionCmd = &cobra.Command{
-	Use:   "delete",
-	Short: "Delete an action",
-	Args:  cobra.ExactArgs(1),
+	Use:         "delete",
+	Short:       "Delete an action",
+	Args:        cobra.ExactArgs(1),
+	Annotations: remoteCapable,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if Remote != nil {
+			return remoteDeleteAction(cmd, args)
+		}
+
 		identifier := args[0]
 		var action database.Action
 		if _, err := uuid.Parse(identifier); err == nil {
@@ -167,20 +187,28 @@ var deleteActionCmd = &cobra.Command{
 			}
 		}
 
+		if ok, err := confirmChange(cmd, fmt.Sprintf("delete action %s (%s)", action.Name, action.ID), newActionOutput(&action), action.ID.String()); !ok {
+			return err
+		}
+
 		if err := DB.Delete(&action).Error; err != nil {
 			return fmt.Errorf("failed to delete action: %w", err)
 		}
 
-		fmt.Printf("Action deleted: %s (%s)\n", action.Name, action.ID)
-		return nil
+		return printActionResult("deleted", newActionOutput(&action))
 	},
 }
 
 var executeActionCmd = &cobra.Command{
-	Use:   "execute",
-	Short: "Execute an action",
-	Args:  cobra.ExactArgs(1),
+	Use:         "execute",
+	Short:       "Execute an action",
+	Args:        cobra.ExactArgs(1),
+	Annotations: remoteCapable,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if Remote != nil {
+			return remoteExecuteAction(cmd, args)
+		}
+
 		identifier := args[0]
 		var action database.Action
 		if _, err := uuid.Parse(identifier); err == nil {
@@ -197,18 +225,42 @@ var executeActionCmd = &cobra.Command{
 			return fmt.Errorf("cannot execute inactive action: %s", action.Name)
 		}
 
-		fmt.Printf("Executing action: %s (%s)\n", action.Name, action.ID)
-		fmt.Printf("Type: %s\n", action.ActivityType)
-		if action.Details.Status == pgtype.Present {
-			if detailsBytes, err := json.MarshalIndent(action.Details.Bytes, "", "  "); err == nil {
-				fmt.Printf("Details: %s\n", string(detailsBytes))
-			}
+		// Here you would implement the actual action execution logic
+		return printActionExecuted(newActionOutput(&action))
+	},
+}
+
+// printActionResult prints an action a command created or changed
+func printActionResult(verb string, action actionOutput) error {
+	return printResult(action, []string{action.ID}, func() {
+		fmt.Printf("Action %s: %s (%s)\n", verb, action.Name, action.ID)
+	})
+}
+
+func printActionList(actions []actionOutput) error {
+	ids := make([]string, len(actions))
+	for i, action := range actions {
+		ids[i] = action.ID
+	}
+
+	return printResult(listOutput{Items: actions, Total: len(actions)}, ids, func() {
+		fmt.Printf("Found %d actions:\n\n", len(actions))
+		for _, action := range actions {
+			fmt.Printf("ID: %s\n  Name: %s\n  Type: %s\n  Active: %t\n  Session Auth: %t %s\n  Details: %s\n  Created: %s\n  Updated: %s\n\n",
+				action.ID, action.Name, action.Type, action.Active, action.AllowSessionAuth, action.SessionPermission, formatDetails(action.Details), action.CreatedAt.Format(time.RFC3339), action.UpdatedAt.Format(time.RFC3339))
 		}
+	})
+}
 
-		// Here you would implement the actual action execution logic
+func printActionExecuted(action actionOutput) error {
+	return printResult(action, []string{action.ID}, func() {
+		fmt.Printf("Executing action: %s (%s)\n", action.Name, action.ID)
+		fmt.Printf("Type: %s\n", action.Type)
+		if action.Details != nil {
+			fmt.Printf("Details: %s\n", formatDetails(action.Details))
+		}
 		fmt.Println("Action executed successfully!")
-		return nil
-	},
+	})
 }
 
 // ActionCmd represents the action command
@@ -230,18 +282,30 @@ func InitActionCommands() {
 	// Create action flags
 	createActionCmd.Flags().String("name", "", "Action name")
 	createActionCmd.Flags().String("description", "", "Action description")
-	createActionCmd.Flags().String("type", "user", "Action type (user, system, automated, other)")
+	createActionCmd.Flags().String("type", "user", "Action type (user, system, automated, door, other)")
 	createActionCmd.Flags().String("details", "", "Action details (JSON format)")
 	createActionCmd.Flags().Bool("active", true, "Whether the action is active")
+	createActionCmd.Flags().Bool("allow-session-auth", false, "Allow a session access token instead of a device OTP")
+	createActionCmd.Flags().String("session-permission", "", "Extra permission required when using a session access token")
 	createActionCmd.MarkFlagRequired("name")
 
 	// Update action flags
 	updateActionCmd.Flags().String("name", "", "Action name")
 	updateActionCmd.Flags().String("description", "", "Action description")
-	updateActionCmd.Flags().String("type", "", "Action type (user, system, automated, other)")
+	updateActionCmd.Flags().String("type", "", "Action type (user, system, automated, door, other)")
 	updateActionCmd.Flags().String("details", "", "Action details (JSON format)")
 	updateActionCmd.Flags().Bool("active", true, "Whether the action is active")
+	updateActionCmd.Flags().Bool("allow-session-auth", false, "Allow a session access token instead of a device OTP")
+	updateActionCmd.Flags().String("session-permission", "", "Extra permission required when using a session access token (empty to clear)")
 
 	// List actions flags
 	listActionsCmd.Flags().Bool("active-only", false, "Show only active actions")
+
+	// Delete action flags
+	addConfirmFlags(deleteActionCmd)
+
+	// Complete action names
+	for _, cmd := range []*cobra.Command{updateActionCmd, deleteActionCmd, executeActionCmd} {
+		cmd.ValidArgsFunction = completeArgs(actionNames)
+	}
 } 
\ No newline at end of file
@@ -0,0 +1,197 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/YubiApp/internal/services"
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+)
+
+// apiAction is an action as the API returns it
+type apiAction struct {
+	ID                  string                 `json:"id"`
+	Name                string                 `json:"name"`
+	ActivityType        string                 `json:"activity_type"`
+	RequiredPermissions []string               `json:"required_permissions"`
+	Details             map[string]interface{} `json:"details"`
+	Active              bool                   `json:"active"`
+	AllowSessionAuth    bool                   `json:"allow_session_auth"`
+	SessionPermission   string                 `json:"session_permission"`
+	CreatedAt           time.Time              `json:"created_at"`
+	UpdatedAt           time.Time              `json:"updated_at"`
+}
+
+func (a *apiAction) output() actionOutput {
+	var details interface{}
+	if a.Details != nil {
+		details = a.Details
+	}
+	return actionOutput{
+		ID:                a.ID,
+		Name:              a.Name,
+		Type:              a.ActivityType,
+		Active:            a.Active,
+		AllowSessionAuth:  a.AllowSessionAuth,
+		SessionPermission: a.SessionPermission,
+		Details:           details,
+		CreatedAt:         a.CreatedAt,
+		UpdatedAt:         a.UpdatedAt,
+	}
+}
+
+// remoteFindAction looks an action up through the API by ID or name
+func remoteFindAction(identifier string) (*apiAction, error) {
+	if _, err := uuid.Parse(identifier); err == nil {
+		var action apiAction
+		if err := Remote.get("/actions/"+identifier, nil, &action); err != nil {
+			return nil, err
+		}
+		return &action, nil
+	}
+
+	var resp struct {
+		Actions []apiAction `json:"actions"`
+	}
+	if err := Remote.get("/actions", nil, &resp); err != nil {
+		return nil, err
+	}
+	for i := range resp.Actions {
+		if resp.Actions[i].Name == identifier {
+			return &resp.Actions[i], nil
+		}
+	}
+	return nil, services.NewError(services.CodeNotFound, "action not found: %s", identifier)
+}
+
+// parseDetailsFlag reads --details, which the API needs to be a JSON object
+func parseDetailsFlag(cmd *cobra.Command) (map[string]interface{}, error) {
+	details, _ := cmd.Flags().GetString("details")
+	if details == "" {
+		return nil, nil
+	}
+	var detailsMap map[string]interface{}
+	if err := json.Unmarshal([]byte(details), &detailsMap); err != nil {
+		return nil, fmt.Errorf("invalid JSON object in details: %w", err)
+	}
+	return detailsMap, nil
+}
+
+func remoteCreateAction(cmd *cobra.Command, args []string) error {
+	details, err := parseDetailsFlag(cmd)
+	if err != nil {
+		return err
+	}
+
+	body := map[string]interface{}{
+		"required_permissions": []string{},
+		"details":              details,
+	}
+	body["name"], _ = cmd.Flags().GetString("name")
+	body["activity_type"], _ = cmd.Flags().GetString("type")
+	body["active"], _ = cmd.Flags().GetBool("active")
+	body["allow_session_auth"], _ = cmd.Flags().GetBool("allow-session-auth")
+	body["session_permission"], _ = cmd.Flags().GetString("session-permission")
+
+	var action apiAction
+	if err := Remote.write(http.MethodPost, "/actions", body, &action); err != nil {
+		return err
+	}
+	return printActionResult("created", action.output())
+}
+
+func remoteListActions(cmd *cobra.Command, args []string) error {
+	query := url.Values{}
+	if activeOnly, _ := cmd.Flags().GetBool("active-only"); activeOnly {
+		query.Set("active", "true")
+	}
+
+	var resp struct {
+		Actions []apiAction `json:"actions"`
+	}
+	if err := Remote.get("/actions", query, &resp); err != nil {
+		return err
+	}
+
+	actions := make([]actionOutput, len(resp.Actions))
+	for i := range resp.Actions {
+		actions[i] = resp.Actions[i].output()
+	}
+	return printActionList(actions)
+}
+
+func remoteUpdateAction(cmd *cobra.Command, args []string) error {
+	action, err := remoteFindAction(args[0])
+	if err != nil {
+		return err
+	}
+	details, err := parseDetailsFlag(cmd)
+	if err != nil {
+		return err
+	}
+
+	// The API replaces the name, required permissions and details, so unchanged
+	// values are sent back as they are
+	body := map[string]interface{}{
+		"name":                 action.Name,
+		"required_permissions": action.RequiredPermissions,
+		"details":              action.Details,
+	}
+	if name, _ := cmd.Flags().GetString("name"); name != "" {
+		body["name"] = name
+	}
+	if details != nil {
+		body["details"] = details
+	}
+	if actionType, _ := cmd.Flags().GetString("type"); actionType != "" {
+		body["activity_type"] = actionType
+	}
+	if cmd.Flags().Changed("active") {
+		body["active"], _ = cmd.Flags().GetBool("active")
+	}
+	if cmd.Flags().Changed("allow-session-auth") {
+		body["allow_session_auth"], _ = cmd.Flags().GetBool("allow-session-auth")
+	}
+	if cmd.Flags().Changed("session-permission") {
+		body["session_permission"], _ = cmd.Flags().GetString("session-permission")
+	}
+
+	var updated apiAction
+	if err := Remote.write(http.MethodPut, "/actions/"+action.ID, body, &updated); err != nil {
+		return err
+	}
+	return printActionResult("updated", updated.output())
+}
+
+func remoteDeleteAction(cmd *cobra.Command, args []string) error {
+	action, err := remoteFindAction(args[0])
+	if err != nil {
+		return err
+	}
+	if ok, err := confirmChange(cmd, fmt.Sprintf("delete action %s (%s)", action.Name, action.ID), action.output(), action.ID); !ok {
+		return err
+	}
+
+	if err := Remote.write(http.MethodDelete, "/actions/"+action.ID, nil, nil); err != nil {
+		return err
+	}
+	return printActionResult("deleted", action.output())
+}
+
+// remoteExecuteAction performs the action through POST /auth/action/{name}
+// with the operator's device OTP
+func remoteExecuteAction(cmd *cobra.Command, args []string) error {
+	action, err := remoteFindAction(args[0])
+	if err != nil {
+		return err
+	}
+
+	if err := Remote.write(http.MethodPost, "/auth/action/"+url.PathEscape(action.Name), map[string]interface{}{}, nil); err != nil {
+		return err
+	}
+	return printActionExecuted(action.output())
+}
@@ -0,0 +1,997 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// policyFile is the declarative description apply converges the database to.
+// Each section present in the file is authoritative: records of that kind it
+// does not list are deleted. Sections left out are not touched.
+type policyFile struct {
+	Resources    *[]policyResource   `yaml:"resources"`
+	Permissions  *[]policyPermission `yaml:"permissions"`
+	Roles        *[]policyRole       `yaml:"roles"`
+	Actions      *[]policyAction     `yaml:"actions"`
+	Locations    *[]policyLocation   `yaml:"locations"`
+	UserStatuses *[]policyUserStatus `yaml:"user_statuses"`
+}
+
+type policyResource struct {
+	Name       string `yaml:"name"`
+	Type       string `yaml:"type"`
+	Location   string `yaml:"location"`
+	Department string `yaml:"department"`
+	Active     *bool  `yaml:"active"` // Defaults to true, as for the other kinds
+}
+
+// policyPermission is "resource:action", or a mapping with a name and an effect
+type policyPermission struct {
+	Name   string `yaml:"name"`
+	Effect string `yaml:"effect"` // allow (default) or deny
+}
+
+func (p *policyPermission) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&p.Name)
+	}
+	type plain policyPermission
+	return node.Decode((*plain)(p))
+}
+
+type policyRole struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Active      *bool    `yaml:"active"`
+	Permissions []string `yaml:"permissions"` // "resource:action"
+}
+
+type policyAction struct {
+	Name                string                 `yaml:"name"`
+	ActivityType        string                 `yaml:"activity_type"`
+	RequiredPermissions []string               `yaml:"required_permissions"`
+	Details             map[string]interface{} `yaml:"details"`
+	Active              *bool                  `yaml:"active"`
+	AllowSessionAuth    bool                   `yaml:"allow_session_auth"`
+	SessionPermission   string                 `yaml:"session_permission"`
+}
+
+type policyLocation struct {
+	Name         string   `yaml:"name"`
+	Description  string   `yaml:"description"`
+	Address      string   `yaml:"address"`
+	Type         string   `yaml:"type"`
+	Active       *bool    `yaml:"active"`
+	Latitude     *float64 `yaml:"latitude"`
+	Longitude    *float64 `yaml:"longitude"`
+	RadiusMeters *float64 `yaml:"radius_meters"`
+	Networks     []string `yaml:"networks"`
+}
+
+type policyUserStatus struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Type        string `yaml:"type"`
+	Active      *bool  `yaml:"active"`
+}
+
+// loadPolicy reads and validates a policy file; "-" reads stdin
+func loadPolicy(path string) (*policyFile, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	var policy policyFile
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&policy); err != nil && !errors.Is(err, io.EOF) {
+		return nil, services.NewError(services.CodeValidationFailed, "failed to parse policy file: %v", err)
+	}
+	if err := policy.validate(); err != nil {
+		return nil, services.NewError(services.CodeValidationFailed, "invalid policy file: %v", err)
+	}
+	return &policy, nil
+}
+
+// validate checks the file on its own and fills in defaults, so that planning
+// only has to compare it with the database
+func (p *policyFile) validate() error {
+	if p.Resources != nil {
+		names := uniqueNames{kind: "resource"}
+		for _, r := range *p.Resources {
+			if err := names.add(r.Name); err != nil {
+				return err
+			}
+		}
+	}
+
+	if p.Permissions != nil {
+		names := uniqueNames{kind: "permission"}
+		for i := range *p.Permissions {
+			permission := &(*p.Permissions)[i]
+			if err := names.add(permission.Name); err != nil {
+				return err
+			}
+			if err := checkPermissionName(permission.Name); err != nil {
+				return err
+			}
+			if permission.Effect == "" {
+				permission.Effect = "allow"
+			}
+			if permission.Effect != "allow" && permission.Effect != "deny" {
+				return fmt.Errorf("permission %s: effect must be allow or deny", permission.Name)
+			}
+		}
+	}
+
+	if p.Roles != nil {
+		names := uniqueNames{kind: "role"}
+		for i := range *p.Roles {
+			role := &(*p.Roles)[i]
+			if err := names.add(role.Name); err != nil {
+				return err
+			}
+			for _, name := range role.Permissions {
+				if err := checkPermissionName(name); err != nil {
+					return fmt.Errorf("role %s: %w", role.Name, err)
+				}
+			}
+			role.Permissions = sortedUnique(role.Permissions)
+		}
+	}
+
+	if p.Actions != nil {
+		names := uniqueNames{kind: "action"}
+		for i := range *p.Actions {
+			action := &(*p.Actions)[i]
+			if err := names.add(action.Name); err != nil {
+				return err
+			}
+			if action.ActivityType == "" {
+				action.ActivityType = "other"
+			}
+			if err := checkOneOf("action "+action.Name+": activity_type", action.ActivityType, "user", "system", "automated", "door", "other"); err != nil {
+				return err
+			}
+			if action.RequiredPermissions == nil {
+				action.RequiredPermissions = []string{}
+			}
+			if action.Details == nil {
+				action.Details = map[string]interface{}{}
+			}
+		}
+	}
+
+	if p.Locations != nil {
+		names := uniqueNames{kind: "location"}
+		for i := range *p.Locations {
+			location := &(*p.Locations)[i]
+			if err := names.add(location.Name); err != nil {
+				return err
+			}
+			if location.Type == "" {
+				location.Type = "office"
+			}
+			if err := checkOneOf("location "+location.Name+": type", location.Type, "office", "home", "event", "other"); err != nil {
+				return err
+			}
+			set := 0
+			for _, value := range []*float64{location.Latitude, location.Longitude, location.RadiusMeters} {
+				if value != nil {
+					set++
+				}
+			}
+			if set != 0 && set != 3 {
+				return fmt.Errorf("location %s: latitude, longitude and radius_meters must be set together", location.Name)
+			}
+			networks := make([]string, 0, len(location.Networks))
+			for _, network := range location.Networks {
+				_, ipNet, err := net.ParseCIDR(strings.TrimSpace(network))
+				if err != nil {
+					return fmt.Errorf("location %s: invalid network range %q: must be CIDR notation like 10.0.0.0/24", location.Name, network)
+				}
+				networks = append(networks, ipNet.String())
+			}
+			location.Networks = networks
+		}
+	}
+
+	if p.UserStatuses != nil {
+		names := uniqueNames{kind: "user status"}
+		for i := range *p.UserStatuses {
+			status := &(*p.UserStatuses)[i]
+			if err := names.add(status.Name); err != nil {
+				return err
+			}
+			if status.Type == "" {
+				status.Type = "working"
+			}
+			if err := checkOneOf("user status "+status.Name+": type", status.Type, "working", "break", "leave", "travel", "other"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// uniqueNames rejects missing and repeated names within a section
+type uniqueNames struct {
+	kind string
+	seen map[string]bool
+}
+
+func (u *uniqueNames) add(name string) error {
+	if name == "" {
+		return fmt.Errorf("every %s needs a name", u.kind)
+	}
+	if u.seen == nil {
+		u.seen = make(map[string]bool)
+	}
+	if u.seen[name] {
+		return fmt.Errorf("%s %s is listed twice", u.kind, name)
+	}
+	u.seen[name] = true
+	return nil
+}
+
+func checkPermissionName(name string) error {
+	parts := strings.SplitN(name, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("invalid permission %q (expected resource:action)", name)
+	}
+	return nil
+}
+
+func checkOneOf(field, value string, allowed ...string) error {
+	for _, a := range allowed {
+		if value == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s must be one of: %s", field, strings.Join(allowed, ", "))
+}
+
+func sortedUnique(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+// applyChange is one create, update or delete in a plan
+type applyChange struct {
+	Op      string   `json:"op"` // create, update or delete
+	Kind    string   `json:"kind"`
+	Name    string   `json:"name"`
+	Changes []string `json:"changes,omitempty"`
+
+	run func(tx *gorm.DB) error
+}
+
+// deleteOrder is the order deletions run in, dependents first
+var deleteOrder = []string{"role", "permission", "resource", "action", "location", "user status"}
+
+// applyPlan is the difference between a policy file and the database.
+// Creates and updates run in the order they are planned, resources first, and
+// deletions after them in deleteOrder.
+type applyPlan struct {
+	db      *gorm.DB
+	policy  *policyFile
+	upserts []*applyChange
+	deletes map[string][]*applyChange
+}
+
+func newApplyPlan(db *gorm.DB, policy *policyFile) (*applyPlan, error) {
+	plan := &applyPlan{db: db, policy: policy, deletes: make(map[string][]*applyChange)}
+	for _, step := range []func() error{plan.planResources, plan.planPermissions, plan.planRoles, plan.planActions, plan.planLocations, plan.planUserStatuses} {
+		if err := step(); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// changes returns the plan's changes in the order they run
+func (p *applyPlan) changes() []*applyChange {
+	changes := append([]*applyChange{}, p.upserts...)
+	for _, kind := range deleteOrder {
+		changes = append(changes, p.deletes[kind]...)
+	}
+	return changes
+}
+
+func (p *applyPlan) add(op, kind, name string, diff []string, run func(tx *gorm.DB) error) {
+	change := &applyChange{Op: op, Kind: kind, Name: name, Changes: diff, run: run}
+	if op == "delete" {
+		p.deletes[kind] = append(p.deletes[kind], change)
+	} else {
+		p.upserts = append(p.upserts, change)
+	}
+}
+
+// update plans an update of model to the values in updates when diff is not empty
+func (p *applyPlan) update(kind, name string, diff fieldDiff, model interface{}, updates map[string]interface{}) {
+	if len(diff) == 0 {
+		return
+	}
+	p.add("update", kind, name, diff, func(tx *gorm.DB) error {
+		return tx.Model(model).Updates(updates).Error
+	})
+}
+
+// fieldDiff lists the fields an update changes, as "field: old -> new"
+type fieldDiff []string
+
+func (d *fieldDiff) compare(field string, current, desired interface{}) {
+	currentJSON, _ := json.Marshal(current)
+	desiredJSON, _ := json.Marshal(desired)
+	if !bytes.Equal(currentJSON, desiredJSON) {
+		*d = append(*d, fmt.Sprintf("%s: %s -> %s", field, currentJSON, desiredJSON))
+	}
+}
+
+// isActive reads an optional active flag, which defaults to true
+func isActive(active *bool) bool {
+	return active == nil || *active
+}
+
+// createRecord inserts record and then sets active explicitly, since the
+// column defaults to true and GORM leaves false out of the insert
+func createRecord(tx *gorm.DB, record interface{}, active bool) error {
+	if err := tx.Create(record).Error; err != nil {
+		return err
+	}
+	if !active {
+		return tx.Model(record).Update("active", false).Error
+	}
+	return nil
+}
+
+func jsonbOf(value interface{}) (pgtype.JSONB, error) {
+	var jsonb pgtype.JSONB
+	if err := jsonb.Set(value); err != nil {
+		return jsonb, fmt.Errorf("failed to convert to JSONB: %w", err)
+	}
+	return jsonb, nil
+}
+
+func (p *applyPlan) planResources() error {
+	if p.policy.Resources == nil {
+		return nil
+	}
+	var existing []database.Resource
+	if err := p.db.Order("name").Find(&existing).Error; err != nil {
+		return fmt.Errorf("failed to load resources: %w", err)
+	}
+	byName := make(map[string]database.Resource, len(existing))
+	for _, resource := range existing {
+		byName[resource.Name] = resource
+	}
+
+	listed := make(map[string]bool)
+	for _, r := range *p.policy.Resources {
+		r := r
+		listed[r.Name] = true
+		active := isActive(r.Active)
+		current, ok := byName[r.Name]
+		if !ok {
+			p.add("create", "resource", r.Name, nil, func(tx *gorm.DB) error {
+				resource := database.Resource{ID: uuid.New(), Name: r.Name, Type: r.Type, Location: r.Location, Department: r.Department, Active: active}
+				return createRecord(tx, &resource, active)
+			})
+			continue
+		}
+
+		var diff fieldDiff
+		diff.compare("type", current.Type, r.Type)
+		diff.compare("location", current.Location, r.Location)
+		diff.compare("department", current.Department, r.Department)
+		diff.compare("active", current.Active, active)
+		p.update("resource", r.Name, diff, &current, map[string]interface{}{
+			"type": r.Type, "location": r.Location, "department": r.Department, "active": active,
+		})
+	}
+
+	for i := range existing {
+		resource := existing[i]
+		if listed[resource.Name] {
+			continue
+		}
+		// Without a permissions section the resource's permissions stay, and
+		// they cannot outlive it
+		if p.policy.Permissions == nil {
+			var count int64
+			if err := p.db.Model(&database.Permission{}).Where("resource_id = ?", resource.ID).Count(&count).Error; err != nil {
+				return fmt.Errorf("failed to check permissions of resource %s: %w", resource.Name, err)
+			}
+			if count > 0 {
+				return services.NewError(services.CodeConflict, "resource %s is not in the policy but still has %d permissions; list the permissions section too", resource.Name, count)
+			}
+		}
+		p.add("delete", "resource", resource.Name, nil, func(tx *gorm.DB) error {
+			return tx.Delete(&resource).Error
+		})
+	}
+	return nil
+}
+
+func (p *applyPlan) planPermissions() error {
+	if p.policy.Permissions == nil {
+		return nil
+	}
+	var existing []database.Permission
+	if err := p.db.Preload("Resource").Find(&existing).Error; err != nil {
+		return fmt.Errorf("failed to load permissions: %w", err)
+	}
+	sort.Slice(existing, func(i, j int) bool { return permissionName(existing[i]) < permissionName(existing[j]) })
+	byName := make(map[string]database.Permission, len(existing))
+	for _, permission := range existing {
+		byName[permissionName(permission)] = permission
+	}
+
+	// Resources that will exist once the plan has run
+	resources := make(map[string]bool)
+	if p.policy.Resources != nil {
+		for _, r := range *p.policy.Resources {
+			resources[r.Name] = true
+		}
+	} else {
+		var names []string
+		if err := p.db.Model(&database.Resource{}).Pluck("name", &names).Error; err != nil {
+			return fmt.Errorf("failed to load resources: %w", err)
+		}
+		for _, name := range names {
+			resources[name] = true
+		}
+	}
+
+	listed := make(map[string]bool)
+	for _, perm := range *p.policy.Permissions {
+		perm := perm
+		listed[perm.Name] = true
+		parts := strings.SplitN(perm.Name, ":", 2)
+		if !resources[parts[0]] {
+			return services.NewError(services.CodeValidationFailed, "permission %s: resource %s does not exist and is not in the policy", perm.Name, parts[0])
+		}
+
+		current, ok := byName[perm.Name]
+		if !ok {
+			p.add("create", "permission", perm.Name, nil, func(tx *gorm.DB) error {
+				var resource database.Resource
+				if err := tx.Where("name = ?", parts[0]).First(&resource).Error; err != nil {
+					return fmt.Errorf("resource %s not found: %w", parts[0], err)
+				}
+				return tx.Create(&database.Permission{ID: uuid.New(), ResourceID: resource.ID, Action: parts[1], Effect: perm.Effect}).Error
+			})
+			continue
+		}
+
+		var diff fieldDiff
+		diff.compare("effect", current.Effect, perm.Effect)
+		p.update("permission", perm.Name, diff, &current, map[string]interface{}{"effect": perm.Effect})
+	}
+
+	for i := range existing {
+		permission := existing[i]
+		if listed[permissionName(permission)] {
+			continue
+		}
+		p.add("delete", "permission", permissionName(permission), nil, func(tx *gorm.DB) error {
+			if err := tx.Where("permission_id = ?", permission.ID).Delete(&database.RolePermission{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&permission).Error
+		})
+	}
+	return nil
+}
+
+func permissionName(permission database.Permission) string {
+	return permission.Resource.Name + ":" + permission.Action
+}
+
+// findPermissions looks permissions up by "resource:action"
+func findPermissions(tx *gorm.DB, names []string) ([]database.Permission, error) {
+	permissions := make([]database.Permission, 0, len(names))
+	for _, name := range names {
+		parts := strings.SplitN(name, ":", 2)
+		var permission database.Permission
+		if err := tx.Joins("JOIN resources ON resources.id = permissions.resource_id").
+			Where("resources.name = ? AND permissions.action = ?", parts[0], parts[1]).
+			First(&permission).Error; err != nil {
+			return nil, fmt.Errorf("permission %s not found: %w", name, err)
+		}
+		permissions = append(permissions, permission)
+	}
+	return permissions, nil
+}
+
+// grantPermissions makes the permissions role grants exactly names
+func grantPermissions(tx *gorm.DB, role *database.Role, names []string) error {
+	permissions, err := findPermissions(tx, names)
+	if err != nil {
+		return err
+	}
+	if len(permissions) == 0 {
+		return tx.Model(role).Association("Permissions").Clear()
+	}
+	return tx.Model(role).Association("Permissions").Replace(permissions)
+}
+
+func (p *applyPlan) planRoles() error {
+	if p.policy.Roles == nil {
+		return nil
+	}
+	var existing []database.Role
+	if err := p.db.Preload("Permissions.Resource").Order("name").Find(&existing).Error; err != nil {
+		return fmt.Errorf("failed to load roles: %w", err)
+	}
+	byName := make(map[string]database.Role, len(existing))
+	for _, role := range existing {
+		byName[role.Name] = role
+	}
+
+	// Permissions that will exist once the plan has run
+	permissions := make(map[string]bool)
+	if p.policy.Permissions != nil {
+		for _, permission := range *p.policy.Permissions {
+			permissions[permission.Name] = true
+		}
+	} else {
+		var all []database.Permission
+		if err := p.db.Preload("Resource").Find(&all).Error; err != nil {
+			return fmt.Errorf("failed to load permissions: %w", err)
+		}
+		for _, permission := range all {
+			permissions[permissionName(permission)] = true
+		}
+	}
+
+	listed := make(map[string]bool)
+	for _, r := range *p.policy.Roles {
+		r := r
+		listed[r.Name] = true
+		for _, name := range r.Permissions {
+			if !permissions[name] {
+				return services.NewError(services.CodeValidationFailed, "role %s: permission %s does not exist and is not in the policy", r.Name, name)
+			}
+		}
+		active := isActive(r.Active)
+
+		current, ok := byName[r.Name]
+		if !ok {
+			p.add("create", "role", r.Name, nil, func(tx *gorm.DB) error {
+				role := database.Role{ID: uuid.New(), Name: r.Name, Description: r.Description, Active: active}
+				if err := createRecord(tx, &role, active); err != nil {
+					return err
+				}
+				return grantPermissions(tx, &role, r.Permissions)
+			})
+			continue
+		}
+
+		var diff fieldDiff
+		diff.compare("description", current.Description, r.Description)
+		diff.compare("active", current.Active, active)
+		granted := make([]string, len(current.Permissions))
+		for i, permission := range current.Permissions {
+			granted[i] = permissionName(permission)
+		}
+		added, removed := setDifference(granted, r.Permissions)
+		for _, name := range added {
+			diff = append(diff, "permissions: +"+name)
+		}
+		for _, name := range removed {
+			diff = append(diff, "permissions: -"+name)
+		}
+		if len(diff) == 0 {
+			continue
+		}
+		p.add("update", "role", r.Name, diff, func(tx *gorm.DB) error {
+			if err := tx.Model(&current).Updates(map[string]interface{}{"description": r.Description, "active": active}).Error; err != nil {
+				return err
+			}
+			return grantPermissions(tx, &current, r.Permissions)
+		})
+	}
+
+	for i := range existing {
+		role := existing[i]
+		if listed[role.Name] {
+			continue
+		}
+		var users int64
+		if err := p.db.Model(&database.UserRole{}).Where("role_id = ?", role.ID).Count(&users).Error; err != nil {
+			return fmt.Errorf("failed to check users of role %s: %w", role.Name, err)
+		}
+		if users > 0 {
+			return services.NewError(services.CodeConflict, "role %s is not in the policy but is assigned to %d users; unassign it first or keep it", role.Name, users)
+		}
+		p.add("delete", "role", role.Name, nil, func(tx *gorm.DB) error {
+			if err := tx.Model(&role).Association("Permissions").Clear(); err != nil {
+				return err
+			}
+			return tx.Delete(&role).Error
+		})
+	}
+	return nil
+}
+
+// setDifference returns what desired adds to current and what it removes
+func setDifference(current, desired []string) (added, removed []string) {
+	have := make(map[string]bool, len(current))
+	for _, value := range current {
+		have[value] = true
+	}
+	want := make(map[string]bool, len(desired))
+	for _, value := range desired {
+		want[value] = true
+		if !have[value] {
+			added = append(added, value)
+		}
+	}
+	for _, value := range sortedUnique(current) {
+		if !want[value] {
+			removed = append(removed, value)
+		}
+	}
+	return added, removed
+}
+
+func (p *applyPlan) planActions() error {
+	if p.policy.Actions == nil {
+		return nil
+	}
+	var existing []database.Action
+	if err := p.db.Order("name").Find(&existing).Error; err != nil {
+		return fmt.Errorf("failed to load actions: %w", err)
+	}
+	byName := make(map[string]database.Action, len(existing))
+	for _, action := range existing {
+		byName[action.Name] = action
+	}
+
+	listed := make(map[string]bool)
+	for _, a := range *p.policy.Actions {
+		a := a
+		listed[a.Name] = true
+		active := isActive(a.Active)
+		requiredPermissions, err := jsonbOf(a.RequiredPermissions)
+		if err != nil {
+			return err
+		}
+		details, err := jsonbOf(a.Details)
+		if err != nil {
+			return err
+		}
+
+		current, ok := byName[a.Name]
+		if !ok {
+			p.add("create", "action", a.Name, nil, func(tx *gorm.DB) error {
+				action := database.Action{
+					ID:                  uuid.New(),
+					Name:                a.Name,
+					ActivityType:        a.ActivityType,
+					RequiredPermissions: requiredPermissions,
+					Details:             details,
+					Active:              active,
+					AllowSessionAuth:    a.AllowSessionAuth,
+					SessionPermission:   a.SessionPermission,
+				}
+				return createRecord(tx, &action, active)
+			})
+			continue
+		}
+
+		currentRequired := jsonbValue(current.RequiredPermissions)
+		if currentRequired == nil {
+			currentRequired = []string{}
+		}
+		currentDetails := jsonbValue(current.Details)
+		if currentDetails == nil {
+			currentDetails = map[string]interface{}{}
+		}
+
+		var diff fieldDiff
+		diff.compare("activity_type", current.ActivityType, a.ActivityType)
+		diff.compare("required_permissions", currentRequired, a.RequiredPermissions)
+		diff.compare("details", currentDetails, a.Details)
+		diff.compare("active", current.Active, active)
+		diff.compare("allow_session_auth", current.AllowSessionAuth, a.AllowSessionAuth)
+		diff.compare("session_permission", current.SessionPermission, a.SessionPermission)
+		p.update("action", a.Name, diff, &current, map[string]interface{}{
+			"activity_type":        a.ActivityType,
+			"required_permissions": requiredPermissions,
+			"details":              details,
+			"active":               active,
+			"allow_session_auth":   a.AllowSessionAuth,
+			"session_permission":   a.SessionPermission,
+		})
+	}
+
+	for i := range existing {
+		action := existing[i]
+		if listed[action.Name] {
+			continue
+		}
+		p.add("delete", "action", action.Name, nil, func(tx *gorm.DB) error {
+			return tx.Delete(&action).Error
+		})
+	}
+	return nil
+}
+
+func (p *applyPlan) planLocations() error {
+	if p.policy.Locations == nil {
+		return nil
+	}
+	// Deleted locations keep their name, so listing one again restores it
+	var existing []database.Location
+	if err := p.db.Unscoped().Order("name").Find(&existing).Error; err != nil {
+		return fmt.Errorf("failed to load locations: %w", err)
+	}
+	byName := make(map[string]database.Location, len(existing))
+	for _, location := range existing {
+		byName[location.Name] = location
+	}
+
+	listed := make(map[string]bool)
+	for _, l := range *p.policy.Locations {
+		l := l
+		listed[l.Name] = true
+		active := isActive(l.Active)
+		networks, err := jsonbOf(l.Networks)
+		if err != nil {
+			return err
+		}
+		updates := map[string]interface{}{
+			"description":   l.Description,
+			"address":       l.Address,
+			"type":          l.Type,
+			"active":        active,
+			"latitude":      l.Latitude,
+			"longitude":     l.Longitude,
+			"radius_meters": l.RadiusMeters,
+			"networks":      networks,
+		}
+
+		current, ok := byName[l.Name]
+		if !ok {
+			p.add("create", "location", l.Name, nil, func(tx *gorm.DB) error {
+				location := database.Location{
+					ID:           uuid.New(),
+					Name:         l.Name,
+					Description:  l.Description,
+					Address:      l.Address,
+					Type:         l.Type,
+					Active:       active,
+					Latitude:     l.Latitude,
+					Longitude:    l.Longitude,
+					RadiusMeters: l.RadiusMeters,
+					Networks:     networks,
+				}
+				return createRecord(tx, &location, active)
+			})
+			continue
+		}
+		if current.DeletedAt.Valid {
+			p.add("create", "location", l.Name, []string{"restores the deleted location"}, func(tx *gorm.DB) error {
+				if err := tx.Unscoped().Model(&current).Update("deleted_at", nil).Error; err != nil {
+					return err
+				}
+				return tx.Model(&current).Updates(updates).Error
+			})
+			continue
+		}
+
+		var diff fieldDiff
+		diff.compare("description", current.Description, l.Description)
+		diff.compare("address", current.Address, l.Address)
+		diff.compare("type", current.Type, l.Type)
+		diff.compare("active", current.Active, active)
+		diff.compare("latitude", current.Latitude, l.Latitude)
+		diff.compare("longitude", current.Longitude, l.Longitude)
+		diff.compare("radius_meters", current.RadiusMeters, l.RadiusMeters)
+		currentNetworks := services.LocationNetworks(&current)
+		if currentNetworks == nil {
+			currentNetworks = []string{}
+		}
+		diff.compare("networks", currentNetworks, l.Networks)
+		p.update("location", l.Name, diff, &current, updates)
+	}
+
+	for i := range existing {
+		location := existing[i]
+		if listed[location.Name] || location.DeletedAt.Valid {
+			continue
+		}
+		p.add("delete", "location", location.Name, nil, func(tx *gorm.DB) error {
+			return tx.Delete(&location).Error
+		})
+	}
+	return nil
+}
+
+func (p *applyPlan) planUserStatuses() error {
+	if p.policy.UserStatuses == nil {
+		return nil
+	}
+	// Deleted statuses keep their name, so listing one again restores it
+	var existing []database.UserStatus
+	if err := p.db.Unscoped().Order("name").Find(&existing).Error; err != nil {
+		return fmt.Errorf("failed to load user statuses: %w", err)
+	}
+	byName := make(map[string]database.UserStatus, len(existing))
+	for _, status := range existing {
+		byName[status.Name] = status
+	}
+
+	listed := make(map[string]bool)
+	for _, s := range *p.policy.UserStatuses {
+		s := s
+		listed[s.Name] = true
+		active := isActive(s.Active)
+		updates := map[string]interface{}{"description": s.Description, "type": s.Type, "active": active}
+
+		current, ok := byName[s.Name]
+		if !ok {
+			p.add("create", "user status", s.Name, nil, func(tx *gorm.DB) error {
+				status := database.UserStatus{ID: uuid.New(), Name: s.Name, Description: s.Description, Type: s.Type, Active: active}
+				return createRecord(tx, &status, active)
+			})
+			continue
+		}
+		if current.DeletedAt.Valid {
+			p.add("create", "user status", s.Name, []string{"restores the deleted user status"}, func(tx *gorm.DB) error {
+				if err := tx.Unscoped().Model(&current).Update("deleted_at", nil).Error; err != nil {
+					return err
+				}
+				return tx.Model(&current).Updates(updates).Error
+			})
+			continue
+		}
+
+		var diff fieldDiff
+		diff.compare("description", current.Description, s.Description)
+		diff.compare("type", current.Type, s.Type)
+		diff.compare("active", current.Active, active)
+		p.update("user status", s.Name, diff, &current, updates)
+	}
+
+	for i := range existing {
+		status := existing[i]
+		if listed[status.Name] || status.DeletedAt.Valid {
+			continue
+		}
+		p.add("delete", "user status", status.Name, nil, func(tx *gorm.DB) error {
+			return tx.Delete(&status).Error
+		})
+	}
+	return nil
+}
+
+// applyOutput is what apply prints
+type applyOutput struct {
+	File    string         `json:"file"`
+	Applied bool           `json:"applied"`
+	Changes []*applyChange `json:"changes"`
+}
+
+// writePlan prints changes one per line, prefixed +, ~ or - like a diff
+func writePlan(w io.Writer, changes []*applyChange) {
+	counts := make(map[string]int)
+	for _, change := range changes {
+		counts[change.Op]++
+	}
+	fmt.Fprintf(w, "%d to create, %d to update, %d to delete\n", counts["create"], counts["update"], counts["delete"])
+	for _, change := range changes {
+		symbol := map[string]string{"create": "+", "update": "~", "delete": "-"}[change.Op]
+		fmt.Fprintf(w, "  %s %s %s\n", symbol, change.Kind, change.Name)
+		for _, detail := range change.Changes {
+			fmt.Fprintf(w, "      %s\n", detail)
+		}
+	}
+}
+
+// ApplyCmd converges the database to a policy file
+var ApplyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Converge resources, permissions, roles, actions, locations and user statuses to a policy file",
+	Long: `Read a YAML policy file describing resources, permissions, roles, actions,
+locations and user statuses, compare it with the database, and create, update
+and delete records until they match. This keeps RBAC policy in version control.
+
+Each section present in the file is authoritative: records of that kind it does
+not list are deleted, so an empty list deletes them all. Sections left out are
+not touched. Everything is applied in one transaction. Use --plan to see the
+changes without making them; deletions ask for confirmation unless --yes is given.`,
+	Example: `  yubiapp-cli apply -f policy.yaml --plan
+  yubiapp-cli apply -f policy.yaml --yes`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file, _ := cmd.Flags().GetString("file")
+		policy, err := loadPolicy(file)
+		if err != nil {
+			return err
+		}
+		plan, err := newApplyPlan(DB, policy)
+		if err != nil {
+			return err
+		}
+		changes := plan.changes()
+
+		output := applyOutput{File: file, Changes: changes}
+		planOnly, _ := cmd.Flags().GetBool("plan")
+		if !planOnly && len(changes) > 0 {
+			if deletes := len(changes) - len(plan.upserts); deletes > 0 {
+				if yes, _ := cmd.Flags().GetBool("yes"); !yes {
+					writePlan(os.Stderr, changes)
+				}
+				if ok, err := confirmChange(cmd, fmt.Sprintf("apply %d changes, including %d deletions", len(changes), deletes), output); !ok {
+					return err
+				}
+			}
+
+			err := DB.Transaction(func(tx *gorm.DB) error {
+				for _, change := range changes {
+					if err := change.run(tx); err != nil {
+						return fmt.Errorf("failed to %s %s %s: %w", change.Op, change.Kind, change.Name, err)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			output.Applied = true
+		}
+
+		return printResult(output, nil, func() {
+			if len(changes) == 0 {
+				fmt.Printf("No changes: the database matches %s\n", file)
+				return
+			}
+			writePlan(os.Stdout, changes)
+			if output.Applied {
+				fmt.Println("Applied.")
+			} else {
+				fmt.Println("Run without --plan to apply these changes.")
+			}
+		})
+	},
+}
+
+// InitApplyCommands initializes the apply command's flags
+func InitApplyCommands() {
+	ApplyCmd.Flags().StringP("file", "f", "", "Policy file (YAML), or - for stdin")
+	ApplyCmd.Flags().Bool("plan", false, "Show the changes without making them")
+	ApplyCmd.Flags().BoolP("yes", "y", false, "Apply deletions without asking for confirmation")
+	ApplyCmd.MarkFlagRequired("file")
+}
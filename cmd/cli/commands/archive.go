@@ -0,0 +1,114 @@
+package commands
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/YubiApp/internal/services"
+	"github.com/spf13/cobra"
+)
+
+var listArchivesCmd = &cobra.Command{
+	Use:       "list <table>",
+	Short:     "List the archive files of a table",
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: services.ArchiveTables,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		from, to, err := archiveRange(cmd)
+		if err != nil {
+			return err
+		}
+
+		files, err := services.NewRetentionService(DB, Cfg).ListArchives(cmd.Context(), args[0], from, to)
+		if err != nil {
+			return err
+		}
+
+		ids := make([]string, len(files))
+		for i, file := range files {
+			ids[i] = file.Key
+		}
+		return printResult(listOutput{Items: files, Total: len(files)}, ids, func() {
+			fmt.Printf("Found %d %s archives:\n", len(files), args[0])
+			for _, file := range files {
+				fmt.Printf("  %s  %s to %s\n", file.Key, file.From.Format(time.RFC3339), file.To.Format(time.RFC3339))
+			}
+		})
+	},
+}
+
+var restoreArchiveCmd = &cobra.Command{
+	Use:   "restore <table>",
+	Short: "Restore archived rows of a table for an investigation",
+	Long: `Insert the rows of <table> archived by retention archival back into the
+database: authentication logs created, or activities ended, between --from and
+--to (whole days, UTC). Rows still in the database are left alone, so a range
+can be restored again. Archival removes restored rows again on its next run
+unless a legal hold covers them:
+
+  yubiapp-cli archive restore authentication_logs --from 2024-01-01 --to 2024-01-31`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: services.ArchiveTables,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		from, to, err := archiveRange(cmd)
+		if err != nil {
+			return err
+		}
+
+		result, err := services.NewRetentionService(DB, Cfg).RestoreArchive(cmd.Context(), args[0], from, to)
+		if err != nil {
+			return err
+		}
+
+		return printResult(result, nil, func() {
+			fmt.Printf("Restored %d %s rows from %d archives\n", result.Restored, result.Table, result.Files)
+			if result.Failed > 0 {
+				fmt.Printf("%d rows failed:\n", result.Failed)
+				for _, message := range result.Errors {
+					fmt.Printf("  %s\n", message)
+				}
+			}
+		})
+	},
+}
+
+// archiveRange reads --from and --to, whole UTC days; either may be empty
+func archiveRange(cmd *cobra.Command) (time.Time, time.Time, error) {
+	var from, to time.Time
+	if fromDate, _ := cmd.Flags().GetString("from"); fromDate != "" {
+		parsed, err := time.Parse("2006-01-02", fromDate)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid from date format (use YYYY-MM-DD): %w", err)
+		}
+		from = parsed
+	}
+	if toDate, _ := cmd.Flags().GetString("to"); toDate != "" {
+		parsed, err := time.Parse("2006-01-02", toDate)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid to date format (use YYYY-MM-DD): %w", err)
+		}
+		// Add one day to include the entire day
+		to = parsed.Add(24 * time.Hour)
+	}
+	return from, to, nil
+}
+
+// ArchiveCmd represents the archive command
+var ArchiveCmd = &cobra.Command{
+	Use:   "archive",
+	Short: "Inspect and restore retention archives",
+	Long:  "List and restore the authentication log and activity rows retention archival exported to retention.archive",
+}
+
+// InitArchiveCommands initializes the archive commands and their flags
+func InitArchiveCommands() {
+	ArchiveCmd.AddCommand(listArchivesCmd)
+	ArchiveCmd.AddCommand(restoreArchiveCmd)
+
+	for _, cmd := range []*cobra.Command{listArchivesCmd, restoreArchiveCmd} {
+		cmd.Flags().String("from", "", "First day (YYYY-MM-DD)")
+		cmd.Flags().String("to", "", "Last day (YYYY-MM-DD)")
+	}
+	restoreArchiveCmd.MarkFlagRequired("from")
+	restoreArchiveCmd.MarkFlagRequired("to")
+}
@@ -89,6 +89,11 @@ var unassignRoleCmd = &cobra.Command{
 			return fmt.Errorf("user %s does not have role %s", user.Email, role.Name)
 		}
 
+		item := map[string]interface{}{"user_id": user.ID, "user": user.Email, "role_id": role.ID, "role": role.Name}
+		if ok, err := confirmChange(cmd, fmt.Sprintf("remove role %s from user %s", role.Name, user.Email), item); !ok {
+			return err
+		}
+
 		if err := DB.Delete(&assignment).Error; err != nil {
 			return fmt.Errorf("failed to remove role: %w", err)
 		}
@@ -177,6 +182,11 @@ var unassignPermissionCmd = &cobra.Command{
 			return fmt.Errorf("role %s does not have permission %s:%s", role.Name, permission.Resource.Name, permission.Action)
 		}
 
+		item := map[string]interface{}{"role_id": role.ID, "role": role.Name, "permission_id": permission.ID, "permission": permission.Resource.Name + ":" + permission.Action}
+		if ok, err := confirmChange(cmd, fmt.Sprintf("remove permission %s:%s from role %s", permission.Resource.Name, permission.Action, role.Name), item); !ok {
+			return err
+		}
+
 		if err := DB.Delete(&assignment).Error; err != nil {
 			return fmt.Errorf("failed to remove permission: %w", err)
 		}
@@ -262,4 +272,16 @@ func InitAssignmentCommands() {
 	AssignmentCmd.AddCommand(unassignPermissionCmd)
 	AssignmentCmd.AddCommand(listUserRolesCmd)
 	AssignmentCmd.AddCommand(listRolePermissionsCmd)
+
+	// Unassign flags
+	addConfirmFlags(unassignRoleCmd)
+	addConfirmFlags(unassignPermissionCmd)
+
+	// Complete user emails and role names
+	assignRoleCmd.ValidArgsFunction = completeArgs(userEmails, roleNames)
+	unassignRoleCmd.ValidArgsFunction = completeArgs(userEmails, roleNames)
+	assignPermissionCmd.ValidArgsFunction = completeArgs(roleNames)
+	unassignPermissionCmd.ValidArgsFunction = completeArgs(roleNames)
+	listUserRolesCmd.ValidArgsFunction = completeArgs(userEmails)
+	listRolePermissionsCmd.ValidArgsFunction = completeArgs(roleNames)
 } 
\ No newline at end of file
@@ -0,0 +1,381 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// bootstrapSeed describes what bootstrap creates. Sections present in a seed
+// file replace the defaults; admin fields given as flags override the file.
+type bootstrapSeed struct {
+	Resources    []seedResource   `yaml:"resources"`
+	Permissions  []string         `yaml:"permissions"` // "resource:action", always allow
+	Roles        []seedRole       `yaml:"roles"`
+	Actions      []seedAction     `yaml:"actions"`
+	UserStatuses []seedUserStatus `yaml:"user_statuses"`
+	Admin        seedAdmin        `yaml:"admin"`
+}
+
+type seedResource struct {
+	Name       string `yaml:"name"`
+	Type       string `yaml:"type"`
+	Location   string `yaml:"location"`
+	Department string `yaml:"department"`
+}
+
+type seedRole struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Permissions []string `yaml:"permissions"` // "resource:action"
+}
+
+type seedAction struct {
+	Name                string                 `yaml:"name"`
+	ActivityType        string                 `yaml:"activity_type"`
+	RequiredPermissions []string               `yaml:"required_permissions"`
+	Details             map[string]interface{} `yaml:"details"`
+}
+
+type seedUserStatus struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Type        string `yaml:"type"`
+}
+
+type seedAdmin struct {
+	Username  string     `yaml:"username"`
+	Email     string     `yaml:"email"`
+	Password  string     `yaml:"password"`
+	FirstName string     `yaml:"first_name"`
+	LastName  string     `yaml:"last_name"`
+	Role      string     `yaml:"role"`
+	Device    seedDevice `yaml:"device"`
+}
+
+type seedDevice struct {
+	Type       string `yaml:"type"`
+	Identifier string `yaml:"identifier"` // YubiKey public ID; a full OTP is accepted too
+	Name       string `yaml:"name"`
+	Secret     string `yaml:"secret"`
+}
+
+// defaultBootstrapSeed is what a fresh installation needs to be administered
+func defaultBootstrapSeed() bootstrapSeed {
+	return bootstrapSeed{
+		Resources: []seedResource{
+			{Name: "yubiapp", Type: "application", Location: "internal", Department: "IT"},
+		},
+		Permissions: []string{"yubiapp:read", "yubiapp:write", "yubiapp:register-other", "yubiapp:deregister-other"},
+		Roles: []seedRole{
+			{
+				Name:        "admin",
+				Description: "Administrator with full access",
+				Permissions: []string{"yubiapp:read", "yubiapp:write", "yubiapp:register-other", "yubiapp:deregister-other"},
+			},
+		},
+		Actions: []seedAction{
+			{Name: "user-signin", ActivityType: "user"},
+			{Name: "user-signout", ActivityType: "user"},
+			{Name: "break-start", ActivityType: "system"},
+			{Name: "break-end", ActivityType: "system"},
+			{Name: "work-start", ActivityType: "system"},
+			{Name: "work-end", ActivityType: "system"},
+			{Name: "meeting-start", ActivityType: "system"},
+			{Name: "meeting-end", ActivityType: "system"},
+			{Name: "status-change", ActivityType: "system"},
+			{Name: "location-change", ActivityType: "system"},
+		},
+		UserStatuses: []seedUserStatus{
+			{Name: "Signed In", Description: "User is signed in and available", Type: "working"},
+			{Name: "On Break", Description: "User is taking a break", Type: "break"},
+			{Name: "In Meeting", Description: "User is in a meeting", Type: "working"},
+			{Name: "Out of Office", Description: "User is out of office", Type: "leave"},
+			{Name: "Traveling", Description: "User is traveling for work", Type: "travel"},
+			{Name: "Lunch Break", Description: "User is on lunch break", Type: "break"},
+			{Name: "Training", Description: "User is in training", Type: "working"},
+			{Name: "Sick Leave", Description: "User is on sick leave", Type: "leave"},
+			{Name: "Vacation", Description: "User is on vacation", Type: "leave"},
+		},
+		Admin: seedAdmin{
+			Role:   "admin",
+			Device: seedDevice{Type: "yubikey"},
+		},
+	}
+}
+
+// BootstrapCmd seeds a fresh installation
+var BootstrapCmd = &cobra.Command{
+	Use:   "bootstrap",
+	Short: "Create the default roles, permissions, actions, statuses and an admin",
+	Long: `Create what a fresh installation needs: the yubiapp resource and its
+permissions, an admin role, the standard actions and user statuses, and
+optionally an initial admin user with a device.
+
+Existing records are left as they are, so bootstrap can be re-run safely. A
+YAML seed file (--seed-file) can replace any of the default sections
+(resources, permissions, roles, actions, user_statuses) and describe the admin;
+admin flags override the file. Run 'migrate up' first.`,
+	Example: `  yubiapp-cli bootstrap --admin-username admin --admin-email admin@example.com \
+    --admin-password '...' --admin-device-identifier cccccbcdefgh
+  yubiapp-cli bootstrap --seed-file seed.yaml`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		seed := defaultBootstrapSeed()
+		if seedFile, _ := cmd.Flags().GetString("seed-file"); seedFile != "" {
+			data, err := os.ReadFile(seedFile)
+			if err != nil {
+				return fmt.Errorf("failed to read seed file: %w", err)
+			}
+			if err := yaml.Unmarshal(data, &seed); err != nil {
+				return fmt.Errorf("failed to parse seed file: %w", err)
+			}
+		}
+		for flag, field := range map[string]*string{
+			"admin-username":          &seed.Admin.Username,
+			"admin-email":             &seed.Admin.Email,
+			"admin-password":          &seed.Admin.Password,
+			"admin-first-name":        &seed.Admin.FirstName,
+			"admin-last-name":         &seed.Admin.LastName,
+			"admin-role":              &seed.Admin.Role,
+			"admin-device-type":       &seed.Admin.Device.Type,
+			"admin-device-identifier": &seed.Admin.Device.Identifier,
+			"admin-device-name":       &seed.Admin.Device.Name,
+		} {
+			if cmd.Flags().Changed(flag) {
+				*field, _ = cmd.Flags().GetString(flag)
+			}
+		}
+
+		return DB.Transaction(func(tx *gorm.DB) error {
+			return runBootstrap(tx, seed)
+		})
+	},
+}
+
+// runBootstrap creates everything in seed that does not exist yet
+func runBootstrap(db *gorm.DB, seed bootstrapSeed) error {
+	resources := make(map[string]database.Resource)
+	for _, r := range seed.Resources {
+		resource := database.Resource{}
+		result := db.Where(database.Resource{Name: r.Name}).
+			Attrs(database.Resource{ID: uuid.New(), Type: r.Type, Location: r.Location, Department: r.Department, Active: true}).
+			FirstOrCreate(&resource)
+		if result.Error != nil {
+			return fmt.Errorf("failed to create resource %s: %w", r.Name, result.Error)
+		}
+		reportSeeded("resource", r.Name, result.RowsAffected)
+		resources[r.Name] = resource
+	}
+
+	permissions := make(map[string]database.Permission)
+	findPermission := func(name string) (database.Permission, error) {
+		if permission, ok := permissions[name]; ok {
+			return permission, nil
+		}
+		parts := strings.SplitN(name, ":", 2)
+		if len(parts) != 2 {
+			return database.Permission{}, fmt.Errorf("invalid permission %q (expected resource:action)", name)
+		}
+		resource, ok := resources[parts[0]]
+		if !ok {
+			if err := db.Where("name = ?", parts[0]).First(&resource).Error; err != nil {
+				return database.Permission{}, fmt.Errorf("permission %s: resource %s not found", name, parts[0])
+			}
+			resources[parts[0]] = resource
+		}
+
+		permission := database.Permission{}
+		result := db.Where(database.Permission{ResourceID: resource.ID, Action: parts[1]}).
+			Attrs(database.Permission{ID: uuid.New(), Effect: "allow"}).
+			FirstOrCreate(&permission)
+		if result.Error != nil {
+			return database.Permission{}, fmt.Errorf("failed to create permission %s: %w", name, result.Error)
+		}
+		reportSeeded("permission", name, result.RowsAffected)
+		permissions[name] = permission
+		return permission, nil
+	}
+	for _, name := range seed.Permissions {
+		if _, err := findPermission(name); err != nil {
+			return err
+		}
+	}
+
+	roles := make(map[string]database.Role)
+	for _, r := range seed.Roles {
+		role := database.Role{}
+		result := db.Where(database.Role{Name: r.Name}).
+			Attrs(database.Role{ID: uuid.New(), Description: r.Description, Active: true}).
+			FirstOrCreate(&role)
+		if result.Error != nil {
+			return fmt.Errorf("failed to create role %s: %w", r.Name, result.Error)
+		}
+		reportSeeded("role", r.Name, result.RowsAffected)
+		for _, name := range r.Permissions {
+			permission, err := findPermission(name)
+			if err != nil {
+				return err
+			}
+			if err := db.Model(&role).Association("Permissions").Append(&permission); err != nil {
+				return fmt.Errorf("failed to grant %s to role %s: %w", name, r.Name, err)
+			}
+		}
+		roles[r.Name] = role
+	}
+
+	for _, a := range seed.Actions {
+		requiredPermissions := pgtype.JSONB{}
+		if err := requiredPermissions.Set(append([]string{}, a.RequiredPermissions...)); err != nil {
+			return err
+		}
+		details := pgtype.JSONB{}
+		if a.Details == nil {
+			a.Details = map[string]interface{}{}
+		}
+		if err := details.Set(a.Details); err != nil {
+			return err
+		}
+		action := database.Action{}
+		result := db.Where(database.Action{Name: a.Name}).
+			Attrs(database.Action{ID: uuid.New(), ActivityType: a.ActivityType, RequiredPermissions: requiredPermissions, Details: details, Active: true}).
+			FirstOrCreate(&action)
+		if result.Error != nil {
+			return fmt.Errorf("failed to create action %s: %w", a.Name, result.Error)
+		}
+		reportSeeded("action", a.Name, result.RowsAffected)
+	}
+
+	for _, s := range seed.UserStatuses {
+		status := database.UserStatus{}
+		result := db.Where(database.UserStatus{Name: s.Name}).
+			Attrs(database.UserStatus{ID: uuid.New(), Description: s.Description, Type: s.Type, Active: true}).
+			FirstOrCreate(&status)
+		if result.Error != nil {
+			return fmt.Errorf("failed to create user status %s: %w", s.Name, result.Error)
+		}
+		reportSeeded("user status", s.Name, result.RowsAffected)
+	}
+
+	if seed.Admin.Username == "" {
+		fmt.Println("No admin user requested (--admin-username); skipping")
+		return nil
+	}
+	return bootstrapAdmin(db, seed.Admin, roles)
+}
+
+// bootstrapAdmin creates the admin user if missing, gives them the admin role
+// and registers their device
+func bootstrapAdmin(db *gorm.DB, admin seedAdmin, roles map[string]database.Role) error {
+	user := database.User{}
+	err := db.Where("username = ?", admin.Username).First(&user).Error
+	switch {
+	case err == gorm.ErrRecordNotFound:
+		if admin.Email == "" || admin.Password == "" {
+			return fmt.Errorf("admin user %s does not exist; --admin-email and --admin-password are required to create it", admin.Username)
+		}
+
+		// Hash the password, enforcing the password policy
+		passwordService := services.NewPasswordService(db, Cfg)
+		hashedPassword, err := passwordService.HashPassword(admin.Password)
+		if err != nil {
+			return err
+		}
+		user = database.User{
+			ID:        uuid.New(),
+			Email:     admin.Email,
+			Username:  admin.Username,
+			Password:  hashedPassword,
+			FirstName: admin.FirstName,
+			LastName:  admin.LastName,
+			Active:    true,
+			State:     services.UserStateActive,
+		}
+		if err := db.Create(&user).Error; err != nil {
+			return fmt.Errorf("failed to create admin user: %w", err)
+		}
+		if err := passwordService.RecordNewPassword(user.ID, hashedPassword); err != nil {
+			return err
+		}
+		reportSeeded("user", user.Username, 1)
+	case err != nil:
+		return fmt.Errorf("failed to look up admin user: %w", err)
+	default:
+		reportSeeded("user", user.Username, 0)
+	}
+
+	if admin.Role != "" {
+		role, ok := roles[admin.Role]
+		if !ok {
+			if err := db.Where("name = ?", admin.Role).First(&role).Error; err != nil {
+				return fmt.Errorf("admin role %s not found", admin.Role)
+			}
+		}
+		if err := db.Model(&user).Association("Roles").Append(&role); err != nil {
+			return fmt.Errorf("failed to assign role %s to %s: %w", role.Name, user.Username, err)
+		}
+	}
+
+	if admin.Device.Identifier == "" {
+		fmt.Println("No admin device requested (--admin-device-identifier); skipping")
+		return nil
+	}
+	identifier := admin.Device.Identifier
+	if admin.Device.Type == "yubikey" && len(identifier) > 12 {
+		identifier = identifier[:12] // Public ID of a full OTP
+	}
+	name := admin.Device.Name
+	if name == "" {
+		name = user.Username + "'s " + admin.Device.Type
+	}
+
+	device := database.Device{}
+	result := db.Where(database.Device{Type: admin.Device.Type, Identifier: identifier}).
+		Attrs(database.Device{
+			ID:         uuid.New(),
+			UserID:     &user.ID,
+			Name:       name,
+			Secret:     admin.Device.Secret,
+			VerifiedAt: time.Now(),
+			Active:     true,
+		}).FirstOrCreate(&device)
+	if result.Error != nil {
+		return fmt.Errorf("failed to create admin device: %w", result.Error)
+	}
+	if device.UserID == nil || *device.UserID != user.ID {
+		return fmt.Errorf("%s device %s is already registered to another user", device.Type, identifier)
+	}
+	reportSeeded("device", admin.Device.Type+" "+identifier, result.RowsAffected)
+	return nil
+}
+
+// reportSeeded prints whether a record was created or already present
+func reportSeeded(kind, name string, created int64) {
+	if created > 0 {
+		fmt.Printf("  created %s %s\n", kind, name)
+	} else {
+		fmt.Printf("  exists  %s %s\n", kind, name)
+	}
+}
+
+// InitBootstrapCommands initializes the bootstrap command's flags
+func InitBootstrapCommands() {
+	BootstrapCmd.Flags().String("seed-file", "", "YAML seed file replacing the default sections and describing the admin")
+	BootstrapCmd.Flags().String("admin-username", "", "Username of the initial admin (no admin is created when empty)")
+	BootstrapCmd.Flags().String("admin-email", "", "Email of the initial admin")
+	BootstrapCmd.Flags().String("admin-password", "", "Password of the initial admin (must meet the password policy)")
+	BootstrapCmd.Flags().String("admin-first-name", "", "First name of the initial admin")
+	BootstrapCmd.Flags().String("admin-last-name", "", "Last name of the initial admin")
+	BootstrapCmd.Flags().String("admin-role", "admin", "Role given to the initial admin")
+	BootstrapCmd.Flags().String("admin-device-type", "yubikey", "Type of the admin's device")
+	BootstrapCmd.Flags().String("admin-device-identifier", "", "Identifier of the admin's device (YubiKey public ID or an OTP from it)")
+	BootstrapCmd.Flags().String("admin-device-name", "", "Name of the admin's device")
+}
@@ -0,0 +1,173 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/spf13/cobra"
+)
+
+var completionCmd = &cobra.Command{
+	Use:   "completion [bash|zsh|fish]",
+	Short: "Generate a shell completion script",
+	Long: `Generate a completion script for bash, zsh or fish. Besides commands and
+flags it completes user emails, role names and action names, read from the
+database or, in remote mode, from the API with the stored login session.
+
+  bash: source <(yubiapp-cli completion bash)
+        or save it to /etc/bash_completion.d/yubiapp-cli
+  zsh:  yubiapp-cli completion zsh > "${fpath[1]}/_yubiapp-cli"
+  fish: yubiapp-cli completion fish > ~/.config/fish/completions/yubiapp-cli.fish`,
+	Args:                  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	ValidArgs:             []string{"bash", "zsh", "fish"},
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root := cmd.Root()
+		switch args[0] {
+		case "bash":
+			return root.GenBashCompletionV2(os.Stdout, true)
+		case "zsh":
+			return root.GenZshCompletion(os.Stdout)
+		case "fish":
+			return root.GenFishCompletion(os.Stdout, true)
+		}
+		return fmt.Errorf("unsupported shell %q", args[0])
+	},
+}
+
+// completionNames lists names starting with a prefix for dynamic completion
+type completionNames func(prefix string) ([]string, error)
+
+// completeArgs completes each positional argument from the matching source; a
+// nil source leaves that argument to the user
+func completeArgs(sources ...completionNames) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) >= len(sources) || sources[len(args)] == nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return completeFrom(sources[len(args)], toComplete)
+	}
+}
+
+// completeFlag completes a flag's value from source
+func completeFlag(source completionNames) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return completeFrom(source, toComplete)
+	}
+}
+
+// completeFrom runs a completion source. Completion never prompts and never
+// fails loudly: without a database or a login session there are simply no
+// suggestions.
+func completeFrom(source completionNames, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if !connectForCompletion() {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	names, err := source(toComplete)
+	if err != nil {
+		cobra.CompDebugln(err.Error(), false)
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// connectForCompletion connects like a command would, except that remote mode
+// requires a stored session since there is no one to enter an OTP
+func connectForCompletion() bool {
+	if DB != nil || Remote != nil {
+		return true
+	}
+	if serverURL != "" {
+		client, err := newAPIClient(serverURL, Cfg.CLI)
+		if err != nil || client.session == nil {
+			return false
+		}
+		Remote = client
+		return true
+	}
+	if err := Cfg.Validate(); err != nil {
+		return false
+	}
+	db, err := connectDB()
+	if err != nil {
+		return false
+	}
+	DB = db
+	return true
+}
+
+func userEmails(prefix string) ([]string, error) {
+	var emails []string
+	if Remote != nil {
+		var resp struct {
+			Items []apiUser `json:"items"`
+		}
+		if err := Remote.get("/users", nil, &resp); err != nil {
+			return nil, err
+		}
+		for _, user := range resp.Items {
+			emails = append(emails, user.Email)
+		}
+		return withPrefix(emails, prefix), nil
+	}
+
+	err := DB.Model(&database.User{}).Where("email LIKE ?", prefix+"%").Order("email").Pluck("email", &emails).Error
+	return emails, err
+}
+
+func roleNames(prefix string) ([]string, error) {
+	var names []string
+	if Remote != nil {
+		var resp struct {
+			Items []apiRole `json:"items"`
+		}
+		if err := Remote.get("/roles", nil, &resp); err != nil {
+			return nil, err
+		}
+		for _, role := range resp.Items {
+			names = append(names, role.Name)
+		}
+		return withPrefix(names, prefix), nil
+	}
+
+	err := DB.Model(&database.Role{}).Where("name LIKE ?", prefix+"%").Order("name").Pluck("name", &names).Error
+	return names, err
+}
+
+func actionNames(prefix string) ([]string, error) {
+	var names []string
+	if Remote != nil {
+		var resp struct {
+			Actions []apiAction `json:"actions"`
+		}
+		if err := Remote.get("/actions", nil, &resp); err != nil {
+			return nil, err
+		}
+		for _, action := range resp.Actions {
+			names = append(names, action.Name)
+		}
+		return withPrefix(names, prefix), nil
+	}
+
+	err := DB.Model(&database.Action{}).Where("name LIKE ?", prefix+"%").Order("name").Pluck("name", &names).Error
+	return names, err
+}
+
+func withPrefix(names []string, prefix string) []string {
+	matching := names[:0]
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			matching = append(matching, name)
+		}
+	}
+	return matching
+}
+
+// InitCompletionCommands replaces cobra's default completion command with one
+// for the shells the CLI supports
+func InitCompletionCommands(root *cobra.Command) {
+	root.CompletionOptions.DisableDefaultCmd = true
+	root.AddCommand(completionCmd)
+}
@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/YubiApp/internal/services"
+	"github.com/spf13/cobra"
+)
+
+// dryRunOutput is what --dry-run prints in place of making a change
+type dryRunOutput struct {
+	DryRun bool        `json:"dry_run"`
+	Change string      `json:"change"`
+	Item   interface{} `json:"item"`
+}
+
+// addConfirmFlags adds --yes and --dry-run to a command that deletes or
+// removes something
+func addConfirmFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolP("yes", "y", false, "Do not ask for confirmation")
+	cmd.Flags().Bool("dry-run", false, "Print what would change without changing it")
+}
+
+// confirmChange asks before a destructive change, described like "delete role
+// admin (<id>)". It returns false when the change must not be made: with
+// --dry-run, after printing item, or when the user declines. Without a
+// terminal to ask on, --yes is required.
+func confirmChange(cmd *cobra.Command, change string, item interface{}, ids ...string) (bool, error) {
+	if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+		return false, printResult(dryRunOutput{DryRun: true, Change: change, Item: item}, ids, func() {
+			fmt.Printf("Would %s\n", change)
+		})
+	}
+	if yes, _ := cmd.Flags().GetBool("yes"); yes {
+		return true, nil
+	}
+
+	if stat, err := os.Stdin.Stat(); err != nil || stat.Mode()&os.ModeCharDevice == 0 {
+		return false, services.NewError(services.CodeValidationFailed, "refusing to %s without --yes", change)
+	}
+
+	fmt.Fprintf(os.Stderr, "%s%s? [y/N] ", strings.ToUpper(change[:1]), change[1:])
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && strings.TrimSpace(line) == "" {
+		fmt.Fprintln(os.Stderr)
+		return false, services.NewError(services.CodeValidationFailed, "refusing to %s without --yes", change)
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, services.NewError(services.CodeValidationFailed, "cancelled: did not %s", change)
+}
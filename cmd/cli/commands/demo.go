@@ -0,0 +1,407 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/YubiApp/cmd/cli/utils"
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/server"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// demoUser describes a seeded demo user and the public ID of their YubiKey
+type demoUser struct {
+	Username  string
+	FirstName string
+	LastName  string
+	Role      string
+	KeyID     string
+}
+
+var demoUsers = []demoUser{
+	{Username: "alice", FirstName: "Alice", LastName: "Admin", Role: "demo-admin", KeyID: "ccccccdddddb"},
+	{Username: "bob", FirstName: "Bob", LastName: "Builder", Role: "demo-staff", KeyID: "ccccccdddddc"},
+	{Username: "carol", FirstName: "Carol", LastName: "Clerk", Role: "demo-staff", KeyID: "ccccccdddddd"},
+}
+
+const (
+	demoEmailDomain = "demo.yubiapp.local"
+	demoPassword    = "demo-password"
+	modhexAlphabet  = "cbdefghijklnrtuv"
+)
+
+var demoUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Start the API with a mock Yubico server and demo data",
+	Long: `Start a self-contained demo: an embedded mock Yubico validation server, a
+seeded demo dataset (users, YubiKeys, roles, actions and a month of activity
+history) and the API server, then print ready-to-run curl examples.
+
+PostgreSQL and Redis from config.yaml are still required. Seeding is idempotent,
+so 'demo up' can be run repeatedly against the same database.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		port, _ := cmd.Flags().GetInt("port")
+		days, _ := cmd.Flags().GetInt("days")
+		skipSeed, _ := cmd.Flags().GetBool("skip-seed")
+
+		// Start the mock Yubico server and point the API at it
+		mock, mockURL, err := startMockYubico()
+		if err != nil {
+			return err
+		}
+		defer mock.Close()
+		Cfg.Yubikey.APIURL = mockURL
+		if Cfg.Yubikey.ClientID == "" {
+			Cfg.Yubikey.ClientID = "demo"
+		}
+		if port > 0 {
+			Cfg.Server.Port = port
+		}
+		fmt.Printf("Mock Yubico server listening on %s\n", mockURL)
+
+		if err := utils.RunMigrations(DB); err != nil {
+			return err
+		}
+
+		if !skipSeed {
+			if err := seedDemoData(DB, days); err != nil {
+				return fmt.Errorf("failed to seed demo data: %w", err)
+			}
+		}
+
+		srv := server.New(Cfg)
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- srv.Start()
+		}()
+
+		printDemoExamples(fmt.Sprintf("http://%s:%d", Cfg.Server.Host, Cfg.Server.Port))
+
+		// Run until interrupted or the server fails
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+		select {
+		case err := <-errCh:
+			if err != nil && err != http.ErrServerClosed {
+				return fmt.Errorf("server failed: %w", err)
+			}
+		case <-sigCh:
+			fmt.Println("\nShutting down demo...")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return srv.Shutdown(ctx)
+	},
+}
+
+// startMockYubico starts a local Yubico OTP validation server that accepts any
+// well-formed 44 character modhex OTP once and reports REPLAYED_OTP on reuse.
+func startMockYubico() (*http.Server, string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to start mock Yubico server: %w", err)
+	}
+
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/wsapi/2.0/verify", func(w http.ResponseWriter, r *http.Request) {
+		otp := r.URL.Query().Get("otp")
+		nonce := r.URL.Query().Get("nonce")
+
+		status := "OK"
+		mu.Lock()
+		switch {
+		case otp == "" || nonce == "":
+			status = "MISSING_PARAMETER"
+		case len(otp) != 44 || strings.Trim(otp, modhexAlphabet) != "":
+			status = "BAD_OTP"
+		case seen[otp]:
+			status = "REPLAYED_OTP"
+		default:
+			seen[otp] = true
+		}
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "t=%s\r\notp=%s\r\nnonce=%s\r\nstatus=%s\r\n",
+			time.Now().UTC().Format("2006-01-02T15:04:05Z0000"), otp, nonce, status)
+	})
+
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(listener)
+
+	return srv, fmt.Sprintf("http://%s/wsapi/2.0/verify", listener.Addr().String()), nil
+}
+
+// seedDemoData creates the demo roles, users, keys, actions and activity history.
+// Existing records are reused, so it is safe to run more than once.
+func seedDemoData(db *gorm.DB, days int) error {
+	fmt.Println("Seeding demo data...")
+
+	// Resource and permissions used by the API's read/write middleware
+	resource := database.Resource{}
+	if err := db.Where(database.Resource{Name: "yubiapp"}).
+		Attrs(database.Resource{ID: uuid.New(), Type: "application", Location: "internal", Department: "IT", Active: true}).
+		FirstOrCreate(&resource).Error; err != nil {
+		return err
+	}
+	permissions := make(map[string]database.Permission)
+	for _, action := range []string{"read", "write"} {
+		permission := database.Permission{}
+		if err := db.Where(database.Permission{ResourceID: resource.ID, Action: action}).
+			Attrs(database.Permission{ID: uuid.New(), Effect: "allow"}).
+			FirstOrCreate(&permission).Error; err != nil {
+			return err
+		}
+		permissions[action] = permission
+	}
+
+	// Roles: admins can read and write, staff can only read
+	roles := make(map[string]database.Role)
+	rolePermissions := map[string][]string{
+		"demo-admin": {"read", "write"},
+		"demo-staff": {"read"},
+	}
+	for name, actions := range rolePermissions {
+		role := database.Role{}
+		if err := db.Where(database.Role{Name: name}).
+			Attrs(database.Role{ID: uuid.New(), Description: "Demo role"}).
+			FirstOrCreate(&role).Error; err != nil {
+			return err
+		}
+		for _, action := range actions {
+			permission := permissions[action]
+			if err := db.Model(&role).Association("Permissions").Append(&permission); err != nil {
+				return err
+			}
+		}
+		roles[name] = role
+	}
+
+	// Locations and statuses referenced by the activity history
+	office, err := firstOrCreateDemoLocation(db, "Demo HQ", "office")
+	if err != nil {
+		return err
+	}
+	home, err := firstOrCreateDemoLocation(db, "Demo Home", "home")
+	if err != nil {
+		return err
+	}
+	working, err := firstOrCreateDemoStatus(db, "Signed In", "working")
+	if err != nil {
+		return err
+	}
+	onBreak, err := firstOrCreateDemoStatus(db, "Lunch Break", "break")
+	if err != nil {
+		return err
+	}
+
+	actions := make(map[string]database.Action)
+	for _, name := range []string{"user-signin", "user-signout", "break-start", "break-end"} {
+		permissionsJSONB := pgtype.JSONB{}
+		if err := permissionsJSONB.Set([]string{}); err != nil {
+			return err
+		}
+		action := database.Action{}
+		if err := db.Where(database.Action{Name: name}).
+			Attrs(database.Action{ID: uuid.New(), ActivityType: "user", RequiredPermissions: permissionsJSONB, Active: true}).
+			FirstOrCreate(&action).Error; err != nil {
+			return err
+		}
+		actions[name] = action
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(demoPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	// Seeded randomness keeps the generated history the same on every run
+	rng := rand.New(rand.NewSource(42))
+	for _, du := range demoUsers {
+		user := database.User{}
+		if err := db.Where(database.User{Username: du.Username}).
+			Attrs(database.User{
+				ID:        uuid.New(),
+				Email:     du.Username + "@" + demoEmailDomain,
+				Password:  string(hashedPassword),
+				FirstName: du.FirstName,
+				LastName:  du.LastName,
+				Active:    true,
+			}).FirstOrCreate(&user).Error; err != nil {
+			return err
+		}
+
+		role := roles[du.Role]
+		if err := db.Model(&user).Association("Roles").Append(&role); err != nil {
+			return err
+		}
+
+		device := database.Device{}
+		if err := db.Where(database.Device{Type: "yubikey", Identifier: du.KeyID}).
+			Attrs(database.Device{
+				ID:         uuid.New(),
+				UserID:     &user.ID,
+				Name:       du.FirstName + "'s YubiKey",
+				VerifiedAt: time.Now(),
+				LastUsedAt: time.Now(),
+				Active:     true,
+			}).FirstOrCreate(&device).Error; err != nil {
+			return err
+		}
+
+		var historyCount int64
+		db.Model(&database.UserActivityHistory{}).Where("user_id = ?", user.ID).Count(&historyCount)
+		if historyCount > 0 {
+			fmt.Printf("  %s: activity history already present, skipping\n", du.Username)
+			continue
+		}
+
+		entries := demoActivityHistory(rng, user.ID, days, actions, office.ID, home.ID, working.ID, onBreak.ID)
+		if err := db.CreateInBatches(entries, 100).Error; err != nil {
+			return fmt.Errorf("failed to create activity history: %w", err)
+		}
+		fmt.Printf("  %s: %d activity entries\n", du.Username, len(entries))
+	}
+
+	fmt.Println("Demo data ready.")
+	return nil
+}
+
+// demoActivityHistory generates a working day (morning, lunch break, afternoon)
+// for every weekday in the last n days, mostly at the office with some home days
+func demoActivityHistory(rng *rand.Rand, userID uuid.UUID, days int, actions map[string]database.Action, officeID, homeID, workingID, breakID uuid.UUID) []database.UserActivityHistory {
+	var entries []database.UserActivityHistory
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	add := func(action string, from, to time.Time, locationID, statusID uuid.UUID) {
+		location := locationID
+		status := statusID
+		end := to
+		entries = append(entries, database.UserActivityHistory{
+			ID:           uuid.New(),
+			UserID:       userID,
+			ActionID:     actions[action].ID,
+			FromDateTime: from,
+			ToDateTime:   &end,
+			LocationID:   &location,
+			StatusID:     &status,
+			Details:      pgtype.JSONB{Bytes: []byte(`{"source":"demo"}`), Status: pgtype.Present},
+		})
+	}
+
+	for d := days; d >= 1; d-- {
+		day := today.AddDate(0, 0, -d)
+		if day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+			continue
+		}
+
+		location := officeID
+		if rng.Intn(5) == 0 {
+			location = homeID
+		}
+
+		signIn := day.Add(8*time.Hour + time.Duration(30+rng.Intn(60))*time.Minute)
+		breakStart := day.Add(12*time.Hour + time.Duration(rng.Intn(45))*time.Minute)
+		breakEnd := breakStart.Add(time.Duration(30+rng.Intn(30)) * time.Minute)
+		signOut := day.Add(16*time.Hour + time.Duration(30+rng.Intn(120))*time.Minute)
+
+		add("user-signin", signIn, breakStart, location, workingID)
+		add("break-start", breakStart, breakEnd, location, breakID)
+		add("break-end", breakEnd, signOut, location, workingID)
+	}
+
+	return entries
+}
+
+func firstOrCreateDemoLocation(db *gorm.DB, name, locationType string) (*database.Location, error) {
+	location := database.Location{}
+	err := db.Where(database.Location{Name: name}).
+		Attrs(database.Location{ID: uuid.New(), Description: "Demo location", Type: locationType, Active: true}).
+		FirstOrCreate(&location).Error
+	return &location, err
+}
+
+func firstOrCreateDemoStatus(db *gorm.DB, name, statusType string) (*database.UserStatus, error) {
+	status := database.UserStatus{}
+	err := db.Where(database.UserStatus{Name: name}).
+		Attrs(database.UserStatus{ID: uuid.New(), Description: "Demo status", Type: statusType, Active: true}).
+		FirstOrCreate(&status).Error
+	return &status, err
+}
+
+// printDemoExamples prints curl commands that work against the demo dataset
+func printDemoExamples(baseURL string) {
+	alice := demoUsers[0].KeyID
+	bob := demoUsers[1].KeyID
+	to := time.Now().UTC().Format("2006-01-02")
+	from := time.Now().UTC().AddDate(0, 0, -30).Format("2006-01-02")
+
+	fmt.Printf(`
+YubiApp demo is running at %[1]s (Ctrl+C to stop)
+
+Demo users (password %[2]q): alice (demo-admin), bob and carol (demo-staff).
+The mock Yubico server accepts any fresh 44-character modhex OTP, so define a
+helper that appends 32 random modhex characters to a key's public ID:
+
+  otp() { printf '%%s%%s' "$1" "$(head -c 16 /dev/urandom | od -An -tx1 | tr -d ' \n' | tr '0123456789abcdef' '%[3]s')"; }
+
+# Authenticate a device and check a permission
+curl -s -X POST %[1]s/api/v1/auth/device \
+  -H 'Content-Type: application/json' \
+  -d "{\"device_type\":\"yubikey\",\"auth_code\":\"$(otp %[4]s)\",\"permission\":\"yubiapp:read\"}"
+
+# Create a session and keep the access token
+TOKEN=$(curl -s -X POST %[1]s/api/v1/auth/session \
+  -H 'Content-Type: application/json' \
+  -d "{\"device_type\":\"yubikey\",\"auth_code\":\"$(otp %[4]s)\"}" | sed -n 's/.*"access_token":"\([^"]*\)".*/\1/p')
+
+# Read with the session token
+curl -s %[1]s/api/v1/users -H "Authorization: Bearer $TOKEN"
+curl -s "%[1]s/api/v1/user-activity/summary?from_datetime=%[6]sT00:00:00Z&to_datetime=%[7]sT00:00:00Z" -H "Authorization: Bearer $TOKEN"
+curl -s "%[1]s/api/v1/reports/timesheet?from=%[6]s&to=%[7]s&format=csv" -H "Authorization: Bearer $TOKEN"
+
+# Write operations require device authentication
+curl -s -X POST %[1]s/api/v1/locations \
+  -H "Authorization: yubikey:$(otp %[4]s)" -H 'Content-Type: application/json' \
+  -d '{"name":"Demo Annex","type":"office"}'
+
+# Perform an action as bob
+curl -s -X POST %[1]s/api/v1/auth/action/user-signin \
+  -H "Authorization: yubikey:$(otp %[5]s)" -H 'Content-Type: application/json' -d '{}'
+
+`, baseURL, demoPassword, modhexAlphabet, alice, bob, from, to)
+}
+
+// DemoCmd represents the demo command
+var DemoCmd = &cobra.Command{
+	Use:   "demo",
+	Short: "Run a self-contained demo environment",
+	Long:  "Start the API with a mock Yubico server and a seeded demo dataset",
+}
+
+// InitDemoCommands initializes the demo commands and their flags
+func InitDemoCommands() {
+	DemoCmd.AddCommand(demoUpCmd)
+
+	demoUpCmd.Flags().Int("port", 0, "API port (defaults to server.port from config)")
+	demoUpCmd.Flags().Int("days", 30, "Days of activity history to generate")
+	demoUpCmd.Flags().Bool("skip-seed", false, "Start without seeding demo data")
+}
@@ -1,34 +1,23 @@
 package commands
 
 import (
-	"github.com/YubiApp/cmd/cli/utils"
 	"github.com/YubiApp/internal/config"
-	"github.com/spf13/cobra"
 	"gorm.io/gorm"
 )
 
 // Global dependencies
 var (
-	DB *gorm.DB
+	DB  *gorm.DB
 	Cfg *config.Config
+
+	// connectDB opens the database for commands run without --server
+	connectDB func() (*gorm.DB, error)
 )
 
-// SetDependencies sets the global dependencies for all command packages
-func SetDependencies(db *gorm.DB, cfg *config.Config) {
-	DB = db
+// SetDependencies sets the global dependencies for all command packages. The
+// database is only opened once a command that needs it runs, so remote mode
+// works without database credentials.
+func SetDependencies(connect func() (*gorm.DB, error), cfg *config.Config) {
+	connectDB = connect
 	Cfg = cfg
 }
-
-// InitMigrationCommand initializes the migration command
-func InitMigrationCommand() *cobra.Command {
-	migrateCmd := &cobra.Command{
-		Use:   "migrate",
-		Short: "Run database migrations",
-		Long:  "Run database migrations to ensure the database schema is up to date",
-		RunE: func(cmd *cobra.Command, args []string) error {
-			return utils.RunMigrations(DB)
-		},
-	}
-	
-	return migrateCmd
-} 
\ No newline at end of file
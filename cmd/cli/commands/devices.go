@@ -1,75 +1,129 @@
 package commands
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"os"
+	"slices"
 	"time"
 
 	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
 	"github.com/google/uuid"
 	"github.com/spf13/cobra"
 )
 
 var createDeviceCmd = &cobra.Command{
-	Use:   "create",
-	Short: "Create a new device",
+	Use:         "create",
+	Short:       "Create a new device",
+	Annotations: remoteCapable,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if Remote != nil {
+			return remoteCreateDevice(cmd, args)
+		}
+
 		name, _ := cmd.Flags().GetString("name")
 		deviceType, _ := cmd.Flags().GetString("type")
 		serialNumber, _ := cmd.Flags().GetString("serial-number")
+		identifier, _ := cmd.Flags().GetString("identifier")
+		userIdentifier, _ := cmd.Flags().GetString("user")
 		active, _ := cmd.Flags().GetBool("active")
+		role, _ := cmd.Flags().GetString("role")
+		if name == "" {
+			return services.NewError(services.CodeValidationFailed, "--name is required")
+		}
+		if err := checkDeviceRoleFlag(role); err != nil {
+			return err
+		}
 
 		device := database.Device{
 			ID:           uuid.New(),
 			Name:         name,
 			Type:         deviceType,
 			SerialNumber: serialNumber,
+			Identifier:   identifier,
 			Active:       active,
+			Role:         role,
+		}
+		if userIdentifier != "" {
+			user, err := findUserByIdentifier(userIdentifier)
+			if err != nil {
+				return err
+			}
+			device.UserID = &user.ID
 		}
 
 		if err := DB.Create(&device).Error; err != nil {
 			return fmt.Errorf("failed to create device: %w", err)
 		}
 
-		fmt.Printf("Device created: %s (%s)\n", device.Name, device.ID)
-		return nil
+		return printDeviceResult("created", newDeviceOutput(&device))
 	},
 }
 
 var listDevicesCmd = &cobra.Command{
-	Use:   "list",
-	Short: "List all devices",
+	Use:         "list",
+	Short:       "List all devices",
+	Annotations: remoteCapable,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if Remote != nil {
+			return remoteListDevices(cmd, args)
+		}
+
 		activeOnly, _ := cmd.Flags().GetBool("active-only")
+		state, _ := cmd.Flags().GetString("state")
+		role, _ := cmd.Flags().GetString("role")
 
 		var devices []database.Device
 		query := DB
 		if activeOnly {
 			query = query.Where("active = ?", true)
 		}
+		if state != "" {
+			if _, ok := services.DeviceStateTransitions[state]; !ok {
+				return fmt.Errorf("invalid state '%s'. Must be one of: %v", state, services.DeviceStates())
+			}
+			query = query.Where("state = ?", state)
+		}
+		if role != "" {
+			if err := checkDeviceRoleFlag(role); err != nil {
+				return err
+			}
+			query = query.Where("role = ?", role)
+		}
 
 		if err := query.Find(&devices).Error; err != nil {
 			return fmt.Errorf("failed to fetch devices: %w", err)
 		}
 
-		fmt.Printf("Found %d devices:\n\n", len(devices))
-		for _, device := range devices {
-			fmt.Printf("ID: %s\n  Name: %s\n  Type: %s\n  Serial Number: %s\n  Active: %t\n  Created: %s\n  Updated: %s\n\n",
-				device.ID, device.Name, device.Type, device.SerialNumber, device.Active, device.CreatedAt.Format(time.RFC3339), device.UpdatedAt.Format(time.RFC3339))
+		items := make([]deviceOutput, len(devices))
+		for i := range devices {
+			items[i] = newDeviceOutput(&devices[i])
 		}
-		return nil
+		return printDeviceList(items)
 	},
 }
 
 var updateDeviceCmd = &cobra.Command{
-	Use:   "update",
-	Short: "Update a device",
-	Args:  cobra.ExactArgs(1),
+	Use:         "update",
+	Short:       "Update a device",
+	Args:        cobra.ExactArgs(1),
+	Annotations: remoteCapable,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if Remote != nil {
+			return remoteUpdateDevice(cmd, args)
+		}
+
 		identifier := args[0]
 		name, _ := cmd.Flags().GetString("name")
 		deviceType, _ := cmd.Flags().GetString("type")
 		serialNumber, _ := cmd.Flags().GetString("serial-number")
 		active, _ := cmd.Flags().GetBool("active")
+		role, _ := cmd.Flags().GetString("role")
+		if err := checkDeviceRoleFlag(role); err != nil {
+			return err
+		}
 
 		var device database.Device
 		if _, err := uuid.Parse(identifier); err == nil {
@@ -94,21 +148,28 @@ var updateDeviceCmd = &cobra.Command{
 		if cmd.Flags().Changed("active") {
 			device.Active = active
 		}
+		if role != "" {
+			device.Role = role
+		}
 
 		if err := DB.Save(&device).Error; err != nil {
 			return fmt.Errorf("failed to update device: %w", err)
 		}
 
-		fmt.Printf("Device updated: %s (%s)\n", device.Name, device.ID)
-		return nil
+		return printDeviceResult("updated", newDeviceOutput(&device))
 	},
 }
 
 var deleteDeviceCmd = &cobra.Command{
-	Use:   "delete",
-	Short: "Delete a device",
-	Args:  cobra.ExactArgs(1),
+	Use:         "delete",
+	Short:       "Delete a device",
+	Args:        cobra.ExactArgs(1),
+	Annotations: remoteCapable,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if Remote != nil {
+			return remoteDeleteDevice(cmd, args)
+		}
+
 		identifier := args[0]
 		var device database.Device
 		if _, err := uuid.Parse(identifier); err == nil {
@@ -121,15 +182,146 @@ var deleteDeviceCmd = &cobra.Command{
 			}
 		}
 
+		output := newDeviceOutput(&device)
+		if ok, err := confirmChange(cmd, fmt.Sprintf("delete device %s (%s)", deviceLabel(output), device.ID), output, output.ID); !ok {
+			return err
+		}
+
 		if err := DB.Delete(&device).Error; err != nil {
 			return fmt.Errorf("failed to delete device: %w", err)
 		}
 
-		fmt.Printf("Device deleted: %s (%s)\n", device.Name, device.ID)
-		return nil
+		return printDeviceResult("deleted", newDeviceOutput(&device))
 	},
 }
 
+var importDevicesCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Import YubiKeys from an inventory CSV",
+	Long: `Import YubiKeys from an inventory CSV such as the ones Yubico ships (- reads
+stdin). Each row becomes an unassigned, inactive yubikey device in stock, ready
+to be registered to a user. The header must name a public ID column (public_id
+or "Public ID"); serial, firmware, form_factor, asset_tag and purchase_order
+columns are optional. Rows that repeat an existing device or an earlier row are
+reported as duplicates and skipped.`,
+	Args:        cobra.ExactArgs(1),
+	Annotations: remoteCapable,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := readInventory(args[0])
+		if err != nil {
+			return err
+		}
+		options, err := deviceImportOptions(cmd)
+		if err != nil {
+			return err
+		}
+
+		var report *services.DeviceImportReport
+		if Remote != nil {
+			report, err = remoteImportDevices(data, options)
+		} else {
+			var rows []services.DeviceImportRow
+			if rows, err = services.ParseDeviceInventory(bytes.NewReader(data)); err == nil {
+				report, err = services.NewDeviceService(DB, Cfg, nil).ImportDevices(rows, options)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		return printImportReport(args[0], report)
+	},
+}
+
+func readInventory(path string) ([]byte, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read inventory file: %w", err)
+	}
+	return data, nil
+}
+
+func deviceImportOptions(cmd *cobra.Command) (services.DeviceImportOptions, error) {
+	var options services.DeviceImportOptions
+	options.PurchaseOrder, _ = cmd.Flags().GetString("purchase-order")
+	options.DryRun, _ = cmd.Flags().GetBool("dry-run")
+	if purchased, _ := cmd.Flags().GetString("purchased-at"); purchased != "" {
+		purchasedAt, err := time.Parse("2006-01-02", purchased)
+		if err != nil {
+			return options, services.NewError(services.CodeValidationFailed, "invalid --purchased-at: use YYYY-MM-DD")
+		}
+		options.PurchasedAt = &purchasedAt
+	}
+	return options, nil
+}
+
+// printImportReport prints the totals of an import and the rows that were skipped
+func printImportReport(path string, report *services.DeviceImportReport) error {
+	var ids []string
+	for _, row := range report.Rows {
+		if row.DeviceID != nil {
+			ids = append(ids, row.DeviceID.String())
+		}
+	}
+
+	return printResult(report, ids, func() {
+		verb := "Imported"
+		if report.DryRun {
+			verb = "Would import"
+		}
+		fmt.Printf("%s %d of %d devices from %s (%d duplicates, %d invalid)\n",
+			verb, report.Created, report.Total, path, report.Duplicates, report.Invalid)
+		for _, row := range report.Rows {
+			if row.Status != services.DeviceImportCreated {
+				fmt.Printf("  line %d: %s %s: %s\n", row.Line, row.Identifier, row.Status, row.Message)
+			}
+		}
+	})
+}
+
+// printDeviceResult prints a device a command created or changed
+func printDeviceResult(verb string, device deviceOutput) error {
+	return printResult(device, []string{device.ID}, func() {
+		fmt.Printf("Device %s: %s (%s)\n", verb, deviceLabel(device), device.ID)
+	})
+}
+
+func printDeviceList(devices []deviceOutput) error {
+	ids := make([]string, len(devices))
+	for i, device := range devices {
+		ids[i] = device.ID
+	}
+
+	return printResult(listOutput{Items: devices, Total: len(devices)}, ids, func() {
+		fmt.Printf("Found %d devices:\n\n", len(devices))
+		for _, device := range devices {
+			fmt.Printf("ID: %s\n  Name: %s\n  Type: %s\n  Identifier: %s\n  Serial Number: %s\n  User: %s\n  Active: %t\n  Role: %s\n  State: %s\n  Created: %s\n  Updated: %s\n\n",
+				device.ID, device.Name, device.Type, device.Identifier, device.SerialNumber, device.UserID, device.Active, device.Role, device.State, device.CreatedAt.Format(time.RFC3339), device.UpdatedAt.Format(time.RFC3339))
+		}
+	})
+}
+
+// checkDeviceRoleFlag validates a --role value; empty means not given
+func checkDeviceRoleFlag(role string) error {
+	if role != "" && !slices.Contains(services.DeviceRoles, role) {
+		return services.NewError(services.CodeValidationFailed, "invalid role '%s'. Must be one of: %v", role, services.DeviceRoles)
+	}
+	return nil
+}
+
+// deviceLabel names a device by its name, or its identifier when it has none
+func deviceLabel(device deviceOutput) string {
+	if device.Name != "" {
+		return device.Name
+	}
+	return device.Identifier
+}
+
 // DeviceCmd represents the device command
 var DeviceCmd = &cobra.Command{
 	Use:   "device",
@@ -144,20 +336,35 @@ func InitDeviceCommands() {
 	DeviceCmd.AddCommand(listDevicesCmd)
 	DeviceCmd.AddCommand(updateDeviceCmd)
 	DeviceCmd.AddCommand(deleteDeviceCmd)
+	DeviceCmd.AddCommand(importDevicesCmd)
 
 	// Create device flags
 	createDeviceCmd.Flags().String("name", "", "Device name")
 	createDeviceCmd.Flags().String("type", "", "Device type")
 	createDeviceCmd.Flags().String("serial-number", "", "Device serial number")
+	createDeviceCmd.Flags().String("identifier", "", "Device identifier, e.g. YubiKey public ID or phone number (required in remote mode)")
+	createDeviceCmd.Flags().String("user", "", "Owning user's ID, email or username (required in remote mode)")
 	createDeviceCmd.Flags().Bool("active", true, "Whether the device is active")
-	createDeviceCmd.MarkFlagRequired("name")
+	createDeviceCmd.Flags().String("role", "", "Device role (primary or backup)")
+	createDeviceCmd.RegisterFlagCompletionFunc("user", completeFlag(userEmails))
 
 	// Update device flags
 	updateDeviceCmd.Flags().String("name", "", "Device name")
 	updateDeviceCmd.Flags().String("type", "", "Device type")
 	updateDeviceCmd.Flags().String("serial-number", "", "Device serial number")
 	updateDeviceCmd.Flags().Bool("active", true, "Whether the device is active")
+	updateDeviceCmd.Flags().String("role", "", "Device role (primary or backup)")
 
 	// List devices flags
 	listDevicesCmd.Flags().Bool("active-only", false, "Show only active devices")
+	listDevicesCmd.Flags().String("state", "", "Show only devices in a lifecycle state (in_stock, assigned, lost, retired)")
+	listDevicesCmd.Flags().String("role", "", "Show only devices with a role (primary or backup)")
+
+	// Delete device flags
+	addConfirmFlags(deleteDeviceCmd)
+
+	// Import devices flags
+	importDevicesCmd.Flags().String("purchase-order", "", "Purchase order for rows that do not name one")
+	importDevicesCmd.Flags().String("purchased-at", "", "Purchase date (YYYY-MM-DD)")
+	importDevicesCmd.Flags().Bool("dry-run", false, "Report what would be imported without creating devices")
 } 
\ No newline at end of file
@@ -0,0 +1,197 @@
+package commands
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/YubiApp/internal/services"
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+)
+
+// apiDevice is a device as the API returns it. The API has no device names or
+// serial numbers; devices are known by their identifier.
+type apiDevice struct {
+	ID     string `json:"id"`
+	UserID string `json:"user_id"` // Set in create responses
+	User   struct {
+		ID string `json:"id"`
+	} `json:"user"` // Set everywhere else
+	Type       string    `json:"type"`
+	Identifier string    `json:"identifier"`
+	Active     bool      `json:"active"`
+	Role       string    `json:"role"`
+	State      string    `json:"state"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func (d *apiDevice) output() deviceOutput {
+	userID := d.UserID
+	if userID == "" {
+		userID = d.User.ID
+	}
+	return deviceOutput{
+		ID:         d.ID,
+		UserID:     userID,
+		Type:       d.Type,
+		Identifier: d.Identifier,
+		Active:     d.Active,
+		Role:       d.Role,
+		State:      d.State,
+		CreatedAt:  d.CreatedAt,
+		UpdatedAt:  d.UpdatedAt,
+	}
+}
+
+// remoteFindDevice looks a device up through the API by ID or identifier
+func remoteFindDevice(identifier string) (*apiDevice, error) {
+	if _, err := uuid.Parse(identifier); err == nil {
+		var resp struct {
+			Item apiDevice `json:"item"`
+		}
+		if err := Remote.get("/devices/"+identifier, nil, &resp); err != nil {
+			return nil, err
+		}
+		return &resp.Item, nil
+	}
+
+	var resp struct {
+		Items []apiDevice `json:"items"`
+	}
+	if err := Remote.get("/devices", nil, &resp); err != nil {
+		return nil, err
+	}
+	for i := range resp.Items {
+		if resp.Items[i].Identifier == identifier {
+			return &resp.Items[i], nil
+		}
+	}
+	return nil, services.NewError(services.CodeNotFound, "device not found: %s", identifier)
+}
+
+func remoteCreateDevice(cmd *cobra.Command, args []string) error {
+	if err := remoteUnsupported(cmd, "name", "serial-number"); err != nil {
+		return err
+	}
+	deviceType, _ := cmd.Flags().GetString("type")
+	identifier, _ := cmd.Flags().GetString("identifier")
+	userIdentifier, _ := cmd.Flags().GetString("user")
+	if deviceType == "" || identifier == "" || userIdentifier == "" {
+		return services.NewError(services.CodeValidationFailed, "--type, --identifier and --user are required in remote mode")
+	}
+
+	user, err := remoteFindUser(userIdentifier)
+	if err != nil {
+		return err
+	}
+
+	body := map[string]interface{}{
+		"user_id":    user.ID,
+		"type":       deviceType,
+		"identifier": identifier,
+	}
+	body["active"], _ = cmd.Flags().GetBool("active")
+	if role, _ := cmd.Flags().GetString("role"); role != "" {
+		body["role"] = role
+	}
+
+	var resp struct {
+		Item apiDevice `json:"item"`
+	}
+	if err := Remote.write(http.MethodPost, "/devices", body, &resp); err != nil {
+		return err
+	}
+	return printDeviceResult("created", resp.Item.output())
+}
+
+func remoteListDevices(cmd *cobra.Command, args []string) error {
+	query := url.Values{}
+	if activeOnly, _ := cmd.Flags().GetBool("active-only"); activeOnly {
+		query.Set("active", "true")
+	}
+	if state, _ := cmd.Flags().GetString("state"); state != "" {
+		query.Set("state", state)
+	}
+	if role, _ := cmd.Flags().GetString("role"); role != "" {
+		query.Set("role", role)
+	}
+
+	var resp struct {
+		Items []apiDevice `json:"items"`
+	}
+	if err := Remote.get("/devices", query, &resp); err != nil {
+		return err
+	}
+
+	devices := make([]deviceOutput, len(resp.Items))
+	for i := range resp.Items {
+		devices[i] = resp.Items[i].output()
+	}
+	return printDeviceList(devices)
+}
+
+func remoteUpdateDevice(cmd *cobra.Command, args []string) error {
+	if err := remoteUnsupported(cmd, "name", "serial-number"); err != nil {
+		return err
+	}
+	device, err := remoteFindDevice(args[0])
+	if err != nil {
+		return err
+	}
+
+	body := map[string]interface{}{}
+	if deviceType, _ := cmd.Flags().GetString("type"); deviceType != "" {
+		body["type"] = deviceType
+	}
+	if cmd.Flags().Changed("active") {
+		body["active"], _ = cmd.Flags().GetBool("active")
+	}
+	if role, _ := cmd.Flags().GetString("role"); role != "" {
+		body["role"] = role
+	}
+
+	var resp struct {
+		Item apiDevice `json:"item"`
+	}
+	if err := Remote.write(http.MethodPut, "/devices/"+device.ID, body, &resp); err != nil {
+		return err
+	}
+	return printDeviceResult("updated", resp.Item.output())
+}
+
+func remoteDeleteDevice(cmd *cobra.Command, args []string) error {
+	device, err := remoteFindDevice(args[0])
+	if err != nil {
+		return err
+	}
+	if ok, err := confirmChange(cmd, fmt.Sprintf("delete device %s (%s)", device.Identifier, device.ID), device.output(), device.ID); !ok {
+		return err
+	}
+
+	if err := Remote.write(http.MethodDelete, "/devices/"+device.ID, nil, nil); err != nil {
+		return err
+	}
+	return printDeviceResult("deleted", device.output())
+}
+
+func remoteImportDevices(data []byte, options services.DeviceImportOptions) (*services.DeviceImportReport, error) {
+	body := map[string]interface{}{
+		"csv":            string(data),
+		"purchase_order": options.PurchaseOrder,
+		"dry_run":        options.DryRun,
+	}
+	if options.PurchasedAt != nil {
+		body["purchased_at"] = options.PurchasedAt.Format("2006-01-02")
+	}
+
+	var resp struct {
+		Item services.DeviceImportReport `json:"item"`
+	}
+	if err := Remote.write(http.MethodPost, "/devices/import", body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Item, nil
+}
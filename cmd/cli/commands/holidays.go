@@ -0,0 +1,277 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+)
+
+var createHolidayCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Add a public holiday to a country or location",
+	Long: `Add a public holiday to a country, or to a single location:
+
+  yubiapp-cli holiday create --date 2024-12-25 --name "Christmas Day" --country GB
+  yubiapp-cli holiday create --date 2024-06-14 --name "Office closure" --location "Main Office"`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		date, _ := cmd.Flags().GetString("date")
+		name, _ := cmd.Flags().GetString("name")
+
+		scope, err := holidayScopeFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		holiday, err := services.NewHolidayService(DB, Cfg).CreateHoliday(services.HolidayInput{
+			HolidayScope: scope,
+			Date:         date,
+			Name:         name,
+		})
+		if err != nil {
+			return err
+		}
+		return printHolidayResult("created", holiday)
+	},
+}
+
+var listHolidaysCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List public holidays",
+	Long:  "List public holidays by date. With --location, the holidays that apply there: its own and those of its country.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		from, _ := cmd.Flags().GetString("from")
+		to, _ := cmd.Flags().GetString("to")
+		country, _ := cmd.Flags().GetString("country")
+		locationIdentifier, _ := cmd.Flags().GetString("location")
+
+		holidayService := services.NewHolidayService(DB, Cfg)
+		var holidays []database.Holiday
+		if locationIdentifier != "" {
+			location, err := findLocationByIdentifier(locationIdentifier)
+			if err != nil {
+				return err
+			}
+			if holidays, err = holidayService.ListLocationHolidays(location.ID, from, to); err != nil {
+				return err
+			}
+		} else {
+			country, err := services.NormalizeCountry(country)
+			if err != nil {
+				return err
+			}
+			if holidays, _, err = holidayService.ListHolidays(services.HolidayFilter{From: from, To: to, Country: country}); err != nil {
+				return err
+			}
+		}
+
+		outputs := make([]holidayOutput, len(holidays))
+		ids := make([]string, len(holidays))
+		for i := range holidays {
+			outputs[i] = newHolidayOutput(&holidays[i])
+			ids[i] = outputs[i].ID
+		}
+		return printResult(listOutput{Items: outputs, Total: len(outputs)}, ids, func() {
+			fmt.Printf("Found %d holidays:\n\n", len(outputs))
+			for _, holiday := range outputs {
+				where := holiday.Country
+				if holiday.LocationName != "" {
+					where = holiday.LocationName
+				}
+				fmt.Printf("%s  %-20s %s (%s)\n", holiday.Date, where, holiday.Name, holiday.ID)
+			}
+		})
+	},
+}
+
+var updateHolidayCmd = &cobra.Command{
+	Use:   "update <id>",
+	Short: "Rename a public holiday or move it to another date",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := uuid.Parse(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid holiday ID: %w", err)
+		}
+
+		var update services.HolidayUpdate
+		if cmd.Flags().Changed("date") {
+			date, _ := cmd.Flags().GetString("date")
+			update.Date = &date
+		}
+		if cmd.Flags().Changed("name") {
+			name, _ := cmd.Flags().GetString("name")
+			update.Name = &name
+		}
+
+		holiday, err := services.NewHolidayService(DB, Cfg).UpdateHoliday(id, update)
+		if err != nil {
+			return err
+		}
+		return printHolidayResult("updated", holiday)
+	},
+}
+
+var deleteHolidayCmd = &cobra.Command{
+	Use:   "delete <id>",
+	Short: "Delete a public holiday",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := uuid.Parse(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid holiday ID: %w", err)
+		}
+
+		holidayService := services.NewHolidayService(DB, Cfg)
+		holiday, err := holidayService.GetHoliday(id)
+		if err != nil {
+			return err
+		}
+
+		item := newHolidayOutput(holiday)
+		if ok, err := confirmChange(cmd, fmt.Sprintf("delete holiday %s on %s", holiday.Name, holiday.Date), item, holiday.ID.String()); !ok {
+			return err
+		}
+
+		if err := holidayService.DeleteHoliday(id); err != nil {
+			return err
+		}
+		return printHolidayResult("deleted", holiday)
+	},
+}
+
+var importHolidaysCmd = &cobra.Command{
+	Use:   "import <file or URL>",
+	Short: "Import public holidays from a CSV, Nager.Date JSON or iCalendar file",
+	Long: `Import public holidays, renaming those already on their date. Formats:
+
+  csv    rows of date,name[,country], with an optional header
+  nager  JSON of the Nager.Date API; its regional holidays are skipped
+  ics    iCalendar events, for --country or --location
+
+  yubiapp-cli holiday import --format nager https://date.nager.at/api/v3/PublicHolidays/2025/GB
+  yubiapp-cli holiday import --format csv --country FR holidays-fr.csv
+  yubiapp-cli holiday import --format ics --location "Main Office" closures.ics`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, _ := cmd.Flags().GetString("format")
+
+		var scope services.HolidayScope
+		if cmd.Flags().Changed("country") || cmd.Flags().Changed("location") {
+			var err error
+			if scope, err = holidayScopeFlags(cmd); err != nil {
+				return err
+			}
+		}
+
+		data, err := openHolidaySource(args[0])
+		if err != nil {
+			return err
+		}
+		defer data.Close()
+
+		result, err := services.NewHolidayService(DB, Cfg).ImportHolidays(data, format, scope)
+		if err != nil {
+			return err
+		}
+		return printResult(result, nil, func() {
+			fmt.Printf("Holidays imported: %d created, %d renamed, %d unchanged, %d regional skipped\n",
+				result.Created, result.Updated, result.Unchanged, result.Skipped)
+		})
+	},
+}
+
+// holidayScopeFlags reads the --country or --location a holiday applies to
+func holidayScopeFlags(cmd *cobra.Command) (services.HolidayScope, error) {
+	country, _ := cmd.Flags().GetString("country")
+	locationIdentifier, _ := cmd.Flags().GetString("location")
+
+	scope := services.HolidayScope{Country: country}
+	if locationIdentifier != "" {
+		location, err := findLocationByIdentifier(locationIdentifier)
+		if err != nil {
+			return scope, err
+		}
+		scope.LocationID = &location.ID
+	}
+	return scope, nil
+}
+
+// openHolidaySource opens a holiday file, or downloads it from an http(s) URL
+func openHolidaySource(source string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		file, err := os.Open(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open holiday file: %w", err)
+		}
+		return file, nil
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download holidays: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to download holidays: %s", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// printHolidayResult prints a holiday a command created, changed or deleted
+func printHolidayResult(verb string, holiday *database.Holiday) error {
+	return printResult(newHolidayOutput(holiday), []string{holiday.ID.String()}, func() {
+		fmt.Printf("Holiday %s: %s on %s (%s)\n", verb, holiday.Name, holiday.Date, holiday.ID)
+	})
+}
+
+// HolidayCmd represents the holiday command
+var HolidayCmd = &cobra.Command{
+	Use:   "holiday",
+	Short: "Manage public holidays",
+	Long:  "Add, import, update, delete, and list the public holidays of countries and locations, on which attendance expects no hours",
+}
+
+// InitHolidayCommands initializes the holiday commands and their flags
+func InitHolidayCommands() {
+	HolidayCmd.AddCommand(createHolidayCmd)
+	HolidayCmd.AddCommand(listHolidaysCmd)
+	HolidayCmd.AddCommand(updateHolidayCmd)
+	HolidayCmd.AddCommand(deleteHolidayCmd)
+	HolidayCmd.AddCommand(importHolidaysCmd)
+
+	// Create holiday flags
+	createHolidayCmd.Flags().String("date", "", "Date of the holiday (YYYY-MM-DD)")
+	createHolidayCmd.Flags().String("name", "", "Name of the holiday")
+	createHolidayCmd.Flags().String("country", "", "ISO 3166-1 alpha-2 code of the country the holiday is in")
+	createHolidayCmd.Flags().String("location", "", "Location ID or name, for a holiday of one location only")
+	createHolidayCmd.MarkFlagRequired("date")
+	createHolidayCmd.MarkFlagRequired("name")
+
+	// List holidays flags
+	listHolidaysCmd.Flags().String("from", "", "First date (YYYY-MM-DD)")
+	listHolidaysCmd.Flags().String("to", "", "Last date (YYYY-MM-DD)")
+	listHolidaysCmd.Flags().String("country", "", "Only this country's holidays")
+	listHolidaysCmd.Flags().String("location", "", "The holidays that apply at this location (ID or name)")
+
+	// Update holiday flags
+	updateHolidayCmd.Flags().String("date", "", "New date (YYYY-MM-DD)")
+	updateHolidayCmd.Flags().String("name", "", "New name")
+
+	// Delete holiday flags
+	addConfirmFlags(deleteHolidayCmd)
+
+	// Import holidays flags
+	importHolidaysCmd.Flags().String("format", "", "File format: csv, nager or ics")
+	importHolidaysCmd.Flags().String("country", "", "Country of every holiday, overriding the file's")
+	importHolidaysCmd.Flags().String("location", "", "Import the holidays for this location only (ID or name)")
+	importHolidaysCmd.MarkFlagRequired("format")
+}
@@ -0,0 +1,98 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// keychainService is the name refresh tokens are stored under in the OS keychain
+const keychainService = "yubiapp-cli"
+
+// errNoKeychain is returned when the platform has no keychain the CLI can use
+var errNoKeychain = errors.New("no OS keychain available")
+
+// keychain stores secrets in the OS credential store: the login keychain on
+// macOS (through security) and the Secret Service on Linux (through
+// secret-tool, part of libsecret). Other platforms report errNoKeychain.
+type keychain struct{}
+
+func (k keychain) available() bool {
+	if k.tool() == "" {
+		return false
+	}
+	_, err := exec.LookPath(k.tool())
+	return err == nil
+}
+
+func (keychain) tool() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "security"
+	case "linux", "freebsd", "openbsd", "netbsd":
+		return "secret-tool"
+	}
+	return ""
+}
+
+// set stores secret for account, replacing any earlier value
+func (k keychain) set(account, secret string) error {
+	switch k.tool() {
+	case "security":
+		return k.run("", "security", "add-generic-password", "-U", "-s", keychainService, "-a", account, "-w", secret)
+	case "secret-tool":
+		// secret-tool reads the secret from stdin, keeping it off the command line
+		return k.run(secret, "secret-tool", "store", "--label=YubiApp CLI session", "service", keychainService, "account", account)
+	}
+	return errNoKeychain
+}
+
+// get returns the secret stored for account
+func (k keychain) get(account string) (string, error) {
+	var args []string
+	switch k.tool() {
+	case "security":
+		args = []string{"security", "find-generic-password", "-s", keychainService, "-a", account, "-w"}
+	case "secret-tool":
+		args = []string{"secret-tool", "lookup", "service", keychainService, "account", account}
+	default:
+		return "", errNoKeychain
+	}
+
+	out, err := exec.Command(args[0], args[1:]...).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read the keychain: %w", err)
+	}
+	secret := strings.TrimRight(string(out), "\r\n")
+	if secret == "" {
+		return "", fmt.Errorf("no keychain entry for %s", account)
+	}
+	return secret, nil
+}
+
+// remove deletes the secret stored for account
+func (k keychain) remove(account string) error {
+	switch k.tool() {
+	case "security":
+		return k.run("", "security", "delete-generic-password", "-s", keychainService, "-a", account)
+	case "secret-tool":
+		return k.run("", "secret-tool", "clear", "service", keychainService, "account", account)
+	}
+	return errNoKeychain
+}
+
+func (keychain) run(stdin, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
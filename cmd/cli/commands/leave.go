@@ -0,0 +1,153 @@
+package commands
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/YubiApp/internal/services"
+	"github.com/spf13/cobra"
+)
+
+var leaveBalanceCmd = &cobra.Command{
+	Use:   "balance <user>",
+	Short: "Show a user's leave balances",
+	Long:  "Show a user's balance of every configured leave type for a year (the current one by default). The user is an ID, email or username.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		year, _ := cmd.Flags().GetInt("year")
+
+		user, err := findUserByIdentifier(args[0])
+		if err != nil {
+			return err
+		}
+
+		balances, err := services.NewLeaveService(DB, Cfg).GetBalances(user.ID, year, time.Now())
+		if err != nil {
+			return err
+		}
+
+		ids := make([]string, len(balances))
+		for i, balance := range balances {
+			ids[i] = balance.Type
+		}
+		return printResult(listOutput{Items: balances, Total: len(balances)}, ids, func() {
+			fmt.Printf("Leave balances of %s:\n\n", user.Email)
+			for _, balance := range balances {
+				fmt.Printf("%s (%d)\n  Accrued: %g of %g (%s)\n  Adjusted: %g\n  Taken: %g\n  Remaining: %g\n\n",
+					balance.Type, balance.Year, balance.Accrued, balance.AnnualDays, balance.Accrual, balance.Adjusted, balance.Taken, balance.Remaining)
+			}
+		})
+	},
+}
+
+var leaveEntriesCmd = &cobra.Command{
+	Use:   "entries <user>",
+	Short: "List the changes to a user's leave balances",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		leaveType, _ := cmd.Flags().GetString("type")
+		year, _ := cmd.Flags().GetInt("year")
+
+		user, err := findUserByIdentifier(args[0])
+		if err != nil {
+			return err
+		}
+
+		entries, _, err := services.NewLeaveService(DB, Cfg).ListEntries(services.LeaveEntryFilter{
+			UserID: user.ID,
+			Type:   leaveType,
+			Year:   year,
+		})
+		if err != nil {
+			return err
+		}
+
+		outputs := make([]leaveEntryOutput, len(entries))
+		ids := make([]string, len(entries))
+		for i := range entries {
+			outputs[i] = newLeaveEntryOutput(&entries[i])
+			ids[i] = outputs[i].ID
+		}
+		return printResult(listOutput{Items: outputs, Total: len(outputs)}, ids, func() {
+			fmt.Printf("Found %d leave entries:\n\n", len(outputs))
+			for _, entry := range outputs {
+				fmt.Printf("%s  %s %d  %s %g\n", entry.CreatedAt.Format(time.RFC3339), entry.Type, entry.Year, entry.Kind, entry.Days)
+				if entry.Reason != "" {
+					fmt.Printf("  Reason: %s\n", entry.Reason)
+				}
+				if entry.AdjustedBy != "" {
+					fmt.Printf("  By: %s\n", entry.AdjustedBy)
+				}
+			}
+		})
+	},
+}
+
+var leaveAdjustCmd = &cobra.Command{
+	Use:   "adjust <user>",
+	Short: "Add days to, or remove them from, a user's leave balance",
+	Long: `Add days to a user's leave balance of a type, or remove them with negative
+days. The adjustment is kept as a leave entry with its reason:
+
+  yubiapp-cli leave adjust jdoe --type vacation --days 2 --reason "Carried over from 2023"
+  yubiapp-cli leave adjust jdoe --type vacation --days=-1 --reason "Unrecorded day off"`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		leaveType, _ := cmd.Flags().GetString("type")
+		days, _ := cmd.Flags().GetFloat64("days")
+		year, _ := cmd.Flags().GetInt("year")
+		reason, _ := cmd.Flags().GetString("reason")
+		if year == 0 {
+			year = time.Now().Year()
+		}
+
+		user, err := findUserByIdentifier(args[0])
+		if err != nil {
+			return err
+		}
+
+		entry, err := services.NewLeaveService(DB, Cfg).AdjustBalance(user.ID, services.LeaveAdjustment{
+			Type:   leaveType,
+			Year:   year,
+			Days:   days,
+			Reason: reason,
+		}, nil)
+		if err != nil {
+			return err
+		}
+
+		return printResult(newLeaveEntryOutput(entry), []string{entry.ID.String()}, func() {
+			fmt.Printf("Adjusted %s balance of %s for %d by %g days (%s)\n", entry.LeaveType, user.Email, entry.Year, entry.Days, entry.ID)
+		})
+	},
+}
+
+// LeaveCmd represents the leave command
+var LeaveCmd = &cobra.Command{
+	Use:   "leave",
+	Short: "Manage leave balances",
+	Long:  "Show users' leave balances and the entries that changed them, and adjust balances",
+}
+
+// InitLeaveCommands initializes the leave commands and their flags
+func InitLeaveCommands() {
+	LeaveCmd.AddCommand(leaveBalanceCmd)
+	LeaveCmd.AddCommand(leaveEntriesCmd)
+	LeaveCmd.AddCommand(leaveAdjustCmd)
+
+	// Balance flags
+	leaveBalanceCmd.Flags().Int("year", 0, "Year (default current year)")
+
+	// Entries flags
+	leaveEntriesCmd.Flags().String("type", "", "Only entries of this leave type")
+	leaveEntriesCmd.Flags().Int("year", 0, "Only entries of this year")
+
+	// Adjust flags
+	leaveAdjustCmd.Flags().String("type", "", "Leave type, as configured in leave.types")
+	leaveAdjustCmd.Flags().Float64("days", 0, "Days to add; negative removes days")
+	leaveAdjustCmd.Flags().Int("year", 0, "Year (default current year)")
+	leaveAdjustCmd.Flags().String("reason", "", "Why the balance is adjusted")
+	leaveAdjustCmd.MarkFlagRequired("type")
+	leaveAdjustCmd.MarkFlagRequired("days")
+	leaveAdjustCmd.MarkFlagRequired("reason")
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
 	"github.com/google/uuid"
 	"github.com/spf13/cobra"
 )
@@ -17,6 +18,15 @@ var createLocationCmd = &cobra.Command{
 		description, _ := cmd.Flags().GetString("description")
 		address, _ := cmd.Flags().GetString("address")
 		active, _ := cmd.Flags().GetBool("active")
+		timezone, _ := cmd.Flags().GetString("timezone")
+		if err := services.CheckTimezone(timezone); err != nil {
+			return err
+		}
+		country, _ := cmd.Flags().GetString("country")
+		country, err := services.NormalizeCountry(country)
+		if err != nil {
+			return err
+		}
 
 		location := database.Location{
 			ID:          uuid.New(),
@@ -24,6 +34,8 @@ var createLocationCmd = &cobra.Command{
 			Description: description,
 			Address:     address,
 			Active:      active,
+			Timezone:    timezone,
+			Country:     country,
 		}
 
 		if err := DB.Create(&location).Error; err != nil {
@@ -53,8 +65,15 @@ var listLocationsCmd = &cobra.Command{
 
 		fmt.Printf("Found %d locations:\n\n", len(locations))
 		for _, location := range locations {
-			fmt.Printf("ID: %s\n  Name: %s\n  Description: %s\n  Address: %s\n  Active: %t\n  Created: %s\n  Updated: %s\n\n",
+			fmt.Printf("ID: %s\n  Name: %s\n  Description: %s\n  Address: %s\n  Active: %t\n  Created: %s\n  Updated: %s\n",
 				location.ID, location.Name, location.Description, location.Address, location.Active, location.CreatedAt.Format(time.RFC3339), location.UpdatedAt.Format(time.RFC3339))
+			if location.Timezone != "" {
+				fmt.Printf("  Timezone: %s\n", location.Timezone)
+			}
+			if location.Country != "" {
+				fmt.Printf("  Country: %s\n", location.Country)
+			}
+			fmt.Println()
 		}
 		return nil
 	},
@@ -94,6 +113,19 @@ var updateLocationCmd = &cobra.Command{
 		if cmd.Flags().Changed("active") {
 			location.Active = active
 		}
+		if cmd.Flags().Changed("timezone") {
+			location.Timezone, _ = cmd.Flags().GetString("timezone")
+			if err := services.CheckTimezone(location.Timezone); err != nil {
+				return err
+			}
+		}
+		if cmd.Flags().Changed("country") {
+			country, _ := cmd.Flags().GetString("country")
+			var err error
+			if location.Country, err = services.NormalizeCountry(country); err != nil {
+				return err
+			}
+		}
 
 		if err := DB.Save(&location).Error; err != nil {
 			return fmt.Errorf("failed to update location: %w", err)
@@ -121,6 +153,11 @@ var deleteLocationCmd = &cobra.Command{
 			}
 		}
 
+		item := map[string]interface{}{"id": location.ID, "name": location.Name}
+		if ok, err := confirmChange(cmd, fmt.Sprintf("delete location %s (%s)", location.Name, location.ID), item, location.ID.String()); !ok {
+			return err
+		}
+
 		if err := DB.Delete(&location).Error; err != nil {
 			return fmt.Errorf("failed to delete location: %w", err)
 		}
@@ -150,6 +187,8 @@ func InitLocationCommands() {
 	createLocationCmd.Flags().String("description", "", "Location description")
 	createLocationCmd.Flags().String("address", "", "Location address")
 	createLocationCmd.Flags().Bool("active", true, "Whether the location is active")
+	createLocationCmd.Flags().String("timezone", "", "IANA timezone activity here is shown in, e.g. Europe/Paris (default: each user's)")
+	createLocationCmd.Flags().String("country", "", "ISO 3166-1 alpha-2 code whose public holidays apply here, e.g. GB (default: holidays.default_country)")
 	createLocationCmd.MarkFlagRequired("name")
 
 	// Update location flags
@@ -157,7 +196,12 @@ func InitLocationCommands() {
 	updateLocationCmd.Flags().String("description", "", "Location description")
 	updateLocationCmd.Flags().String("address", "", "Location address")
 	updateLocationCmd.Flags().Bool("active", true, "Whether the location is active")
+	updateLocationCmd.Flags().String("timezone", "", "IANA timezone activity here is shown in, e.g. Europe/Paris; empty uses each user's")
+	updateLocationCmd.Flags().String("country", "", "ISO 3166-1 alpha-2 code whose public holidays apply here, e.g. GB; empty uses holidays.default_country")
 
 	// List locations flags
 	listLocationsCmd.Flags().Bool("active-only", false, "Show only active locations")
+
+	// Delete location flags
+	addConfirmFlags(deleteLocationCmd)
 } 
\ No newline at end of file
@@ -0,0 +1,130 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/YubiApp/cmd/cli/utils"
+	"github.com/spf13/cobra"
+)
+
+var migrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Apply all pending migrations",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return utils.RunMigrations(DB)
+	},
+}
+
+var migrateDownCmd = &cobra.Command{
+	Use:   "down",
+	Short: "Revert the most recently applied migrations",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		steps, _ := cmd.Flags().GetInt("steps")
+		if steps < 1 {
+			return fmt.Errorf("--steps must be at least 1")
+		}
+
+		migrator, err := utils.NewMigrator(DB)
+		if err != nil {
+			return err
+		}
+		reverted, err := migrator.Down(cmd.Context(), steps)
+		for _, migration := range reverted {
+			fmt.Printf("Reverted %d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(reverted) == 0 {
+			fmt.Println("No applied migrations to revert")
+		}
+		return nil
+	},
+}
+
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "List migrations and whether each has been applied",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		migrator, err := utils.NewMigrator(DB)
+		if err != nil {
+			return err
+		}
+		statuses, err := migrator.Status(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, status := range statuses {
+			state := "pending"
+			switch {
+			case status.Unknown:
+				state = "applied (unknown to this build)"
+			case status.Modified:
+				state = "applied (modified since)"
+			case status.Applied:
+				state = "applied"
+			}
+			appliedAt := ""
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt)
+		}
+		return w.Flush()
+	},
+}
+
+var migrateBaselineCmd = &cobra.Command{
+	Use:   "baseline <version>",
+	Short: "Mark migrations up to a version as applied without running them",
+	Long: `Record migrations up to and including <version> as applied without running
+them. Use this once on databases created from database/schema.sql, whose
+schema already matches 0002_default_data:
+
+  yubiapp-cli migrate baseline 2
+
+Databases created by the old AutoMigrate start-up do not match it (for
+example, user_activity_history has from_date_time rather than from_datetime)
+and are refused. Run the migrations on a new database and copy their data
+across instead.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		version, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version %q: %w", args[0], err)
+		}
+
+		migrator, err := utils.NewMigrator(DB)
+		if err != nil {
+			return err
+		}
+		recorded, err := migrator.Baseline(cmd.Context(), version)
+		for _, migration := range recorded {
+			fmt.Printf("Marked %d_%s as applied\n", migration.Version, migration.Name)
+		}
+		return err
+	},
+}
+
+var MigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Manage database migrations",
+	Long:  "Apply, revert and inspect the versioned SQL migrations in database/migrations",
+}
+
+// InitMigrateCommands initializes the migration commands and their flags
+func InitMigrateCommands() {
+	MigrateCmd.AddCommand(migrateUpCmd)
+	MigrateCmd.AddCommand(migrateDownCmd)
+	MigrateCmd.AddCommand(migrateStatusCmd)
+	MigrateCmd.AddCommand(migrateBaselineCmd)
+
+	migrateDownCmd.Flags().Int("steps", 1, "Number of migrations to revert")
+}
@@ -0,0 +1,493 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/jackc/pgtype"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// Output formats accepted by --output
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+	OutputYAML  = "yaml"
+)
+
+// Exit codes returned by Execute
+const (
+	ExitOK       = 0
+	ExitError    = 1 // The command failed
+	ExitUsage    = 2 // Unknown command, bad flags or arguments
+	ExitNotFound = 3 // A record named on the command line does not exist
+)
+
+var (
+	outputFormat string
+	quiet        bool
+
+	// commandStarted is set once flags and arguments have been validated, so
+	// errors returned before that are reported as usage errors
+	commandStarted bool
+)
+
+// InitOutputFlags registers the global --output and --quiet flags on the root command
+func InitOutputFlags(root *cobra.Command) {
+	root.PersistentFlags().StringVarP(&outputFormat, "output", "o", OutputTable, "Output format (table, json, yaml)")
+	root.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Print only the IDs of affected or listed records")
+
+	root.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		switch outputFormat {
+		case OutputTable, OutputJSON, OutputYAML:
+		default:
+			return fmt.Errorf("invalid output format %q (use table, json or yaml)", outputFormat)
+		}
+		commandStarted = true
+		return connect(cmd)
+	}
+
+	// Errors are printed by Execute in the selected format
+	root.SilenceErrors = true
+	root.SilenceUsage = true
+}
+
+// Execute runs the root command and returns the process exit code. Errors are
+// written to stderr, as {"error": {"code", "message"}} with --output json or yaml.
+func Execute(root *cobra.Command) int {
+	err := root.Execute()
+	if err == nil {
+		return ExitOK
+	}
+
+	exitCode := ExitError
+	code := services.ErrorCodeOf(err)
+	switch {
+	case !commandStarted:
+		exitCode = ExitUsage
+		code = services.CodeValidationFailed
+	case errors.Is(err, gorm.ErrRecordNotFound) || code == services.CodeNotFound:
+		exitCode = ExitNotFound
+		code = services.CodeNotFound
+	case code == "":
+		code = services.CodeInternal
+	}
+
+	body := map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": err.Error(),
+		},
+	}
+	switch outputFormat {
+	case OutputJSON:
+		writeJSON(os.Stderr, body)
+	case OutputYAML:
+		writeYAML(os.Stderr, body)
+	default:
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if exitCode == ExitUsage {
+			fmt.Fprintf(os.Stderr, "Run '%s --help' for usage.\n", root.Name())
+		}
+	}
+	return exitCode
+}
+
+// printResult writes a command's result. JSON and YAML print v; table output
+// calls table; --quiet prints only ids, one per line.
+func printResult(v interface{}, ids []string, table func()) error {
+	if quiet {
+		for _, id := range ids {
+			fmt.Println(id)
+		}
+		return nil
+	}
+	switch outputFormat {
+	case OutputJSON:
+		return writeJSON(os.Stdout, v)
+	case OutputYAML:
+		return writeYAML(os.Stdout, v)
+	}
+	table()
+	return nil
+}
+
+// listOutput is the structure list commands print, matching the API's list responses
+type listOutput struct {
+	Items interface{} `json:"items" yaml:"items"`
+	Total int         `json:"total" yaml:"total"`
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func writeYAML(w io.Writer, v interface{}) error {
+	// Round-trip through JSON so YAML keys and values match the JSON output
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return err
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(generic); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// jsonbValue decodes a JSONB column for output, or returns nil when it is NULL
+func jsonbValue(value pgtype.JSONB) interface{} {
+	if value.Status != pgtype.Present {
+		return nil
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(value.Bytes, &decoded); err != nil {
+		return nil
+	}
+	return decoded
+}
+
+// formatDetails formats decoded JSON details for table output
+func formatDetails(details interface{}) string {
+	data, err := json.Marshal(details)
+	if err != nil {
+		return "null"
+	}
+	return string(data)
+}
+
+type userOutput struct {
+	ID        string    `json:"id"`
+	Email     string    `json:"email"`
+	Username  string    `json:"username"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Active    bool      `json:"active"`
+	State     string    `json:"state"`
+	Roles     []string  `json:"roles"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Attributes map[string]interface{} `json:"attributes"`
+	ManagerID  string                 `json:"manager_id,omitempty"`
+	Locale     string                 `json:"locale,omitempty"`
+	Timezone   string                 `json:"timezone,omitempty"`
+}
+
+func newUserOutput(user *database.User) userOutput {
+	roles := make([]string, len(user.Roles))
+	for i, role := range user.Roles {
+		roles[i] = role.Name
+	}
+	output := userOutput{
+		ID:        user.ID.String(),
+		Email:     user.Email,
+		Username:  user.Username,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Active:    user.Active,
+		State:     user.State,
+		Roles:     roles,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+
+		Attributes: services.UserAttributes(user.Attributes),
+		Locale:     user.Locale,
+		Timezone:   user.Timezone,
+	}
+	if user.ManagerID != nil {
+		output.ManagerID = user.ManagerID.String()
+	}
+	return output
+}
+
+type transitionOutput struct {
+	ID          string     `json:"id"`
+	UserID      string     `json:"user_id"`
+	FromState   string     `json:"from_state"`
+	ToState     string     `json:"to_state"`
+	Status      string     `json:"status"`
+	Reason      string     `json:"reason"`
+	Note        string     `json:"note"`
+	EffectiveAt time.Time  `json:"effective_at"`
+	AppliedAt   *time.Time `json:"applied_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func newTransitionOutput(transition *database.UserStateTransition) transitionOutput {
+	return transitionOutput{
+		ID:          transition.ID.String(),
+		UserID:      transition.UserID.String(),
+		FromState:   transition.FromState,
+		ToState:     transition.ToState,
+		Status:      transition.Status,
+		Reason:      transition.Reason,
+		Note:        transition.Note,
+		EffectiveAt: transition.EffectiveAt,
+		AppliedAt:   transition.AppliedAt,
+		CreatedAt:   transition.CreatedAt,
+	}
+}
+
+type roleOutput struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Active      bool      `json:"active"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func newRoleOutput(role *database.Role) roleOutput {
+	permissions := make([]string, len(role.Permissions))
+	for i, perm := range role.Permissions {
+		permissions[i] = fmt.Sprintf("%s:%s", perm.Resource.Name, perm.Action)
+	}
+	return roleOutput{
+		ID:          role.ID.String(),
+		Name:        role.Name,
+		Description: role.Description,
+		Active:      role.Active,
+		Permissions: permissions,
+		CreatedAt:   role.CreatedAt,
+		UpdatedAt:   role.UpdatedAt,
+	}
+}
+
+type deviceOutput struct {
+	ID           string    `json:"id"`
+	UserID       string    `json:"user_id"`
+	Name         string    `json:"name"`
+	Type         string    `json:"type"`
+	Identifier   string    `json:"identifier"`
+	SerialNumber string    `json:"serial_number"`
+	Active       bool      `json:"active"`
+	Role         string    `json:"role"`
+	State        string    `json:"state"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+func newDeviceOutput(device *database.Device) deviceOutput {
+	state := device.State
+	if state == "" {
+		state = services.DeviceStateAssigned
+	}
+	userID := ""
+	if device.UserID != nil {
+		userID = device.UserID.String()
+	}
+	return deviceOutput{
+		ID:           device.ID.String(),
+		UserID:       userID,
+		Name:         device.Name,
+		Type:         device.Type,
+		Identifier:   device.Identifier,
+		SerialNumber: device.SerialNumber,
+		Active:       device.Active,
+		Role:         device.Role,
+		State:        state,
+		CreatedAt:    device.CreatedAt,
+		UpdatedAt:    device.UpdatedAt,
+	}
+}
+
+type actionOutput struct {
+	ID                string      `json:"id"`
+	Name              string      `json:"name"`
+	Type              string      `json:"type"`
+	Active            bool        `json:"active"`
+	AllowSessionAuth  bool        `json:"allow_session_auth"`
+	SessionPermission string      `json:"session_permission"`
+	Details           interface{} `json:"details"`
+	CreatedAt         time.Time   `json:"created_at"`
+	UpdatedAt         time.Time   `json:"updated_at"`
+}
+
+func newActionOutput(action *database.Action) actionOutput {
+	return actionOutput{
+		ID:                action.ID.String(),
+		Name:              action.Name,
+		Type:              action.ActivityType,
+		Active:            action.Active,
+		AllowSessionAuth:  action.AllowSessionAuth,
+		SessionPermission: action.SessionPermission,
+		Details:           jsonbValue(action.Details),
+		CreatedAt:         action.CreatedAt,
+		UpdatedAt:         action.UpdatedAt,
+	}
+}
+
+type activityOutput struct {
+	ID           string      `json:"id"`
+	UserID       string      `json:"user_id"`
+	UserEmail    string      `json:"user_email"`
+	ActionID     string      `json:"action_id"`
+	ActionName   string      `json:"action_name"`
+	StatusID     *string     `json:"status_id"`
+	StatusName   string      `json:"status_name"`
+	LocationID   *string     `json:"location_id"`
+	LocationName string      `json:"location_name"`
+	From         time.Time   `json:"from"`
+	To           *time.Time  `json:"to"`
+	Details      interface{} `json:"details"`
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+}
+
+func newActivityOutput(activity *database.UserActivityHistory) activityOutput {
+	output := activityOutput{
+		ID:         activity.ID.String(),
+		UserID:     activity.UserID.String(),
+		UserEmail:  activity.User.Email,
+		ActionID:   activity.ActionID.String(),
+		ActionName: activity.Action.Name,
+		From:       activity.FromDateTime,
+		To:         activity.ToDateTime,
+		Details:    jsonbValue(activity.Details),
+		CreatedAt:  activity.CreatedAt,
+		UpdatedAt:  activity.UpdatedAt,
+	}
+	if activity.StatusID != nil {
+		id := activity.StatusID.String()
+		output.StatusID = &id
+	}
+	if activity.Status != nil {
+		output.StatusName = activity.Status.Name
+	}
+	if activity.LocationID != nil {
+		id := activity.LocationID.String()
+		output.LocationID = &id
+	}
+	if activity.Location != nil {
+		output.LocationName = activity.Location.Name
+	}
+	return output
+}
+
+type shiftOutput struct {
+	ID           string    `json:"id"`
+	UserID       string    `json:"user_id"`
+	UserEmail    string    `json:"user_email"`
+	LocationID   *string   `json:"location_id"`
+	LocationName string    `json:"location_name"`
+	StartsAt     time.Time `json:"starts_at"`
+	EndsAt       time.Time `json:"ends_at"`
+	Recurrence   string    `json:"recurrence"`
+	RecurUntil   string    `json:"recur_until"`
+	Notes        string    `json:"notes"`
+	Version      int       `json:"version"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+func newShiftOutput(shift *database.Shift) shiftOutput {
+	output := shiftOutput{
+		ID:         shift.ID.String(),
+		UserID:     shift.UserID.String(),
+		UserEmail:  shift.User.Email,
+		StartsAt:   shift.StartsAt,
+		EndsAt:     shift.EndsAt,
+		Recurrence: shift.Recurrence,
+		RecurUntil: shift.RecurUntil,
+		Notes:      shift.Notes,
+		Version:    shift.Version,
+		CreatedAt:  shift.CreatedAt,
+		UpdatedAt:  shift.UpdatedAt,
+	}
+	if shift.LocationID != nil {
+		id := shift.LocationID.String()
+		output.LocationID = &id
+	}
+	if shift.Location != nil {
+		output.LocationName = shift.Location.Name
+	}
+	return output
+}
+
+type holidayOutput struct {
+	ID           string    `json:"id"`
+	Date         string    `json:"date"`
+	Name         string    `json:"name"`
+	Country      string    `json:"country"`
+	LocationID   *string   `json:"location_id"`
+	LocationName string    `json:"location_name"`
+	Source       string    `json:"source"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+func newHolidayOutput(holiday *database.Holiday) holidayOutput {
+	output := holidayOutput{
+		ID:        holiday.ID.String(),
+		Date:      holiday.Date,
+		Name:      holiday.Name,
+		Country:   holiday.Country,
+		Source:    holiday.Source,
+		CreatedAt: holiday.CreatedAt,
+		UpdatedAt: holiday.UpdatedAt,
+	}
+	if holiday.LocationID != nil {
+		id := holiday.LocationID.String()
+		output.LocationID = &id
+	}
+	if holiday.Location != nil {
+		output.LocationName = holiday.Location.Name
+	}
+	return output
+}
+
+type leaveEntryOutput struct {
+	ID           string    `json:"id"`
+	UserID       string    `json:"user_id"`
+	Type         string    `json:"type"`
+	Year         int       `json:"year"`
+	Kind         string    `json:"kind"`
+	Days         float64   `json:"days"`
+	ActionID     *string   `json:"action_id"`
+	Reason       string    `json:"reason"`
+	AdjustedByID *string   `json:"adjusted_by_id"`
+	AdjustedBy   string    `json:"adjusted_by"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func newLeaveEntryOutput(entry *database.LeaveEntry) leaveEntryOutput {
+	output := leaveEntryOutput{
+		ID:        entry.ID.String(),
+		UserID:    entry.UserID.String(),
+		Type:      entry.LeaveType,
+		Year:      entry.Year,
+		Kind:      entry.Kind,
+		Days:      entry.Days,
+		Reason:    entry.Reason,
+		CreatedAt: entry.CreatedAt,
+	}
+	if entry.ActionID != nil {
+		id := entry.ActionID.String()
+		output.ActionID = &id
+	}
+	if entry.AdjustedByID != nil {
+		id := entry.AdjustedByID.String()
+		output.AdjustedByID = &id
+	}
+	if entry.AdjustedBy != nil {
+		output.AdjustedBy = entry.AdjustedBy.Username
+	}
+	return output
+}
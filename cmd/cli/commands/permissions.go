@@ -85,6 +85,11 @@ var deletePermissionCmd = &cobra.Command{
 			}
 		}
 
+		item := map[string]interface{}{"id": permission.ID, "resource": permission.Resource.Name, "action": permission.Action}
+		if ok, err := confirmChange(cmd, fmt.Sprintf("delete permission %s:%s (%s)", permission.Resource.Name, permission.Action, permission.ID), item, permission.ID.String()); !ok {
+			return err
+		}
+
 		if err := DB.Delete(&permission).Error; err != nil {
 			return fmt.Errorf("failed to delete permission: %w", err)
 		}
@@ -113,4 +118,7 @@ func InitPermissionCommands() {
 	createPermissionCmd.Flags().String("resource-id", "", "Resource ID")
 	createPermissionCmd.Flags().String("resource-name", "", "Resource name")
 	createPermissionCmd.MarkFlagRequired("action")
+
+	// Delete permission flags
+	addConfirmFlags(deletePermissionCmd)
 } 
\ No newline at end of file
@@ -0,0 +1,507 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/services"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/spf13/cobra"
+)
+
+// remoteAnnotation marks commands that can run against the API. The others
+// need the database and fail in remote mode.
+const remoteAnnotation = "remote"
+
+// remoteCapable are the annotations of commands supported in remote mode
+var remoteCapable = map[string]string{remoteAnnotation: "true"}
+
+var (
+	serverURL string
+	otpFlag   string
+
+	// Remote is the API client commands use in remote mode; nil when they use the database
+	Remote *apiClient
+)
+
+// InitRemoteFlags registers the global --server and --otp flags on the root command
+func InitRemoteFlags(root *cobra.Command) {
+	root.PersistentFlags().StringVar(&serverURL, "server", Cfg.CLI.ServerURL, "Call the API at this URL instead of using the database (cli.server_url)")
+	root.PersistentFlags().StringVar(&otpFlag, "otp", "", "Device OTP for the first request that needs one; later ones are prompted for")
+}
+
+// connect sets up what cmd runs against: the API client in remote mode,
+// otherwise the database
+func connect(cmd *cobra.Command) error {
+	switch cmd.Name() {
+	case "help", "completion", cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd:
+		// Completion connects itself, only when it needs to
+		return nil
+	}
+	if !cmd.Runnable() {
+		return nil
+	}
+
+	if serverURL == "" {
+		if cmd.Annotations["login"] != "" {
+			return fmt.Errorf("%s needs a server: pass --server or set cli.server_url", cmd.CommandPath())
+		}
+		if err := Cfg.Validate(); err != nil {
+			return err
+		}
+		db, err := connectDB()
+		if err != nil {
+			return err
+		}
+		DB = db
+		return nil
+	}
+
+	if cmd.Annotations[remoteAnnotation] == "" {
+		return fmt.Errorf("%s needs database access and is not available in remote mode", cmd.CommandPath())
+	}
+	client, err := newAPIClient(serverURL, Cfg.CLI)
+	if err != nil {
+		return err
+	}
+	Remote = client
+	return nil
+}
+
+// accessTokenLeeway is how close to its expiry an access token is refreshed
+// before use
+const accessTokenLeeway = 30 * time.Second
+
+// storedSession is the session `login` saves for later commands. The refresh
+// token is kept in the OS keychain when there is one, and only written to the
+// session file otherwise.
+type storedSession struct {
+	ServerURL       string    `json:"server_url"`
+	SessionID       string    `json:"session_id"`
+	AccessToken     string    `json:"access_token"`
+	AccessExpiresAt time.Time `json:"access_expires_at"`
+	RefreshToken    string    `json:"refresh_token,omitempty"`
+	Keychain        bool      `json:"keychain,omitempty"`
+	ExpiresAt       time.Time `json:"expires_at"`
+	Username        string    `json:"username"`
+}
+
+// apiClient calls the YubiApp API. Reads use the stored session when there is
+// one; writes, which the API only accepts with device authentication, prompt
+// for an OTP.
+type apiClient struct {
+	baseURL     string
+	deviceType  string
+	sessionFile string
+	http        *http.Client
+	keychain    keychain
+	session     *storedSession
+}
+
+func newAPIClient(server string, cfg config.CLIConfig) (*apiClient, error) {
+	parsed, err := url.Parse(server)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid server URL %q (expected e.g. https://yubiapp.example.com)", server)
+	}
+
+	sessionFile := cfg.SessionFile
+	if sessionFile == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to find the session file location (set cli.session_file): %w", err)
+		}
+		sessionFile = filepath.Join(dir, "yubiapp", "session.json")
+	}
+
+	client := &apiClient{
+		baseURL:     strings.TrimRight(server, "/") + "/api/v1",
+		deviceType:  cfg.DeviceType,
+		sessionFile: sessionFile,
+		http:        &http.Client{Timeout: cfg.Timeout},
+	}
+
+	// Sessions are only ever sent to the server that issued them
+	if session, err := client.loadSession(); err == nil && session.ServerURL == client.baseURL {
+		client.session = session
+	}
+	return client, nil
+}
+
+func (c *apiClient) loadSession() (*storedSession, error) {
+	data, err := os.ReadFile(c.sessionFile)
+	if err != nil {
+		return nil, err
+	}
+	var session storedSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// saveSession stores session, with its refresh token in the keychain when
+// session.Keychain is set
+func (c *apiClient) saveSession(session *storedSession) error {
+	if err := os.MkdirAll(filepath.Dir(c.sessionFile), 0700); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+
+	stored := *session
+	if session.Keychain {
+		if err := c.keychain.set(session.ServerURL, session.RefreshToken); err != nil {
+			return fmt.Errorf("failed to save session: %w", err)
+		}
+		stored.RefreshToken = ""
+	}
+	data, err := json.MarshalIndent(&stored, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	if err := os.WriteFile(c.sessionFile, data, 0600); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	c.session = session
+	return nil
+}
+
+// refreshToken returns the session's refresh token, reading it from the
+// keychain the first time it is needed
+func (c *apiClient) refreshToken(session *storedSession) (string, error) {
+	if session.RefreshToken == "" && session.Keychain {
+		token, err := c.keychain.get(session.ServerURL)
+		if err != nil {
+			return "", err
+		}
+		session.RefreshToken = token
+	}
+	return session.RefreshToken, nil
+}
+
+// clearSession removes the stored session and its keychain entry
+func (c *apiClient) clearSession(session *storedSession) error {
+	if session != nil && session.Keychain {
+		if err := c.keychain.remove(session.ServerURL); err != nil {
+			return fmt.Errorf("failed to remove session: %w", err)
+		}
+	}
+	if err := os.Remove(c.sessionFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove session: %w", err)
+	}
+	c.session = nil
+	return nil
+}
+
+// get performs a read, with the stored session (refreshed once if it has
+// expired) or else a device OTP
+func (c *apiClient) get(path string, query url.Values, out interface{}) error {
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	if c.session != nil {
+		// Access tokens are short-lived, so one about to expire is refreshed
+		// up front rather than failing the request
+		if !c.session.AccessExpiresAt.IsZero() && time.Now().Add(accessTokenLeeway).After(c.session.AccessExpiresAt) {
+			if err := c.refreshSession(); err != nil {
+				return fmt.Errorf("session expired, run login again: %w", err)
+			}
+		}
+
+		err := c.do(http.MethodGet, path, nil, "Bearer "+c.session.AccessToken, out)
+		if services.ErrorCodeOf(err) != services.CodeSessionInvalid && services.ErrorCodeOf(err) != services.CodeAuthFailed {
+			return err
+		}
+		if refreshErr := c.refreshSession(); refreshErr != nil {
+			return fmt.Errorf("session expired, run login again: %w", refreshErr)
+		}
+		return c.do(http.MethodGet, path, nil, "Bearer "+c.session.AccessToken, out)
+	}
+
+	authorization, err := c.deviceAuthorization()
+	if err != nil {
+		return err
+	}
+	return c.do(http.MethodGet, path, nil, authorization, out)
+}
+
+// write performs a create, update or delete with a device OTP
+func (c *apiClient) write(method, path string, body, out interface{}) error {
+	authorization, err := c.deviceAuthorization()
+	if err != nil {
+		return err
+	}
+	return c.do(method, path, body, authorization, out)
+}
+
+// login creates a session with a device OTP and stores it for later commands
+func (c *apiClient) login() (*storedSession, error) {
+	otp, err := readOTP(c.deviceType)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		SessionID    string    `json:"session_id"`
+		AccessToken  string    `json:"access_token"`
+		RefreshToken string    `json:"refresh_token"`
+		ExpiresAt    time.Time `json:"expires_at"`
+		User         struct {
+			Username string `json:"username"`
+		} `json:"user"`
+	}
+	body := map[string]string{"device_type": c.deviceType, "auth_code": otp}
+	if err := c.do(http.MethodPost, "/auth/session", body, "", &resp); err != nil {
+		return nil, err
+	}
+
+	session := &storedSession{
+		ServerURL:       c.baseURL,
+		SessionID:       resp.SessionID,
+		AccessToken:     resp.AccessToken,
+		AccessExpiresAt: tokenExpiry(resp.AccessToken),
+		RefreshToken:    resp.RefreshToken,
+		Keychain:        c.keychain.available(),
+		ExpiresAt:       resp.ExpiresAt,
+		Username:        resp.User.Username,
+	}
+	if err := c.saveSession(session); err != nil {
+		if !session.Keychain {
+			return nil, err
+		}
+		// No usable keychain, e.g. secret-tool without a desktop session
+		fmt.Fprintf(os.Stderr, "Warning: %v; storing the refresh token in %s instead\n", err, c.sessionFile)
+		session.Keychain = false
+		if err := c.saveSession(session); err != nil {
+			return nil, err
+		}
+	}
+	return session, nil
+}
+
+// logout invalidates the stored session on the server and forgets it. It
+// reports whether the server revoked the session; one that had already expired
+// or been invalidated is only removed locally.
+func (c *apiClient) logout() (bool, error) {
+	session, err := c.loadSession()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, c.clearSession(nil)
+	}
+
+	revoked := false
+	if session.ServerURL == c.baseURL {
+		refreshToken, err := c.refreshToken(session)
+		if err == nil {
+			body := map[string]string{"refresh_token": refreshToken}
+			err = c.do(http.MethodPost, "/auth/session/logout/"+url.PathEscape(session.SessionID), body, "", nil)
+		}
+		switch {
+		case err == nil:
+			revoked = true
+		case services.ErrorCodeOf(err) == services.CodeSessionInvalid, services.ErrorCodeOf(err) == services.CodeAuthFailed:
+		default:
+			return false, fmt.Errorf("failed to log out of the server, the session was kept: %w", err)
+		}
+	}
+
+	return revoked, c.clearSession(session)
+}
+
+func (c *apiClient) refreshSession() error {
+	var resp struct {
+		AccessToken  string    `json:"access_token"`
+		RefreshToken string    `json:"refresh_token"`
+		ExpiresAt    time.Time `json:"expires_at"`
+	}
+	refreshToken, err := c.refreshToken(c.session)
+	if err != nil {
+		return err
+	}
+	body := map[string]string{"refresh_token": refreshToken}
+	if err := c.do(http.MethodPost, "/auth/session/refresh/"+url.PathEscape(c.session.SessionID), body, "", &resp); err != nil {
+		return err
+	}
+
+	session := *c.session
+	session.AccessToken = resp.AccessToken
+	session.AccessExpiresAt = tokenExpiry(resp.AccessToken)
+	session.RefreshToken = resp.RefreshToken
+	session.ExpiresAt = resp.ExpiresAt
+	return c.saveSession(&session)
+}
+
+// tokenExpiry reads the expiry of an access token. The CLI cannot verify the
+// signature and does not need to; the zero time means it is unknown.
+func tokenExpiry(token string) time.Time {
+	var claims jwt.RegisteredClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(token, &claims); err != nil || claims.ExpiresAt == nil {
+		return time.Time{}
+	}
+	return claims.ExpiresAt.Time
+}
+
+func (c *apiClient) deviceAuthorization() (string, error) {
+	otp, err := readOTP(c.deviceType)
+	if err != nil {
+		return "", err
+	}
+	return c.deviceType + ":" + otp, nil
+}
+
+// do sends a request and decodes a successful response into out. API errors
+// are returned with the code the API reported.
+func (c *apiClient) do(method, path string, body interface{}, authorization string, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	req.Header.Set("User-Agent", "yubiapp-cli")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return services.WrapError(services.CodeUpstreamFailed, "failed to reach "+c.baseURL, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error     string `json:"error"`
+			Code      string `json:"code"`
+			RequestID string `json:"request_id"`
+		}
+		if err := json.Unmarshal(data, &apiErr); err != nil || apiErr.Error == "" {
+			return services.NewError(services.CodeUpstreamFailed, "%s %s: HTTP %d", method, path, resp.StatusCode)
+		}
+		message := apiErr.Error
+		if apiErr.RequestID != "" {
+			message += " (request " + apiErr.RequestID + ")"
+		}
+		return services.NewError(services.ErrorCode(apiErr.Code), "%s", message)
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent || len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// readOTP takes the OTP from --otp the first time and prompts on the terminal
+// after that, since each OTP can only be used once
+func readOTP(deviceType string) (string, error) {
+	if otpFlag != "" {
+		otp := otpFlag
+		otpFlag = ""
+		return otp, nil
+	}
+
+	fmt.Fprintf(os.Stderr, "%s OTP: ", deviceType)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("failed to read OTP: %w", err)
+	}
+	otp := strings.TrimSpace(line)
+	if otp == "" {
+		return "", services.NewError(services.CodeAuthFailed, "an OTP is required")
+	}
+	return otp, nil
+}
+
+// remoteUnsupported rejects flags the API has no equivalent for
+func remoteUnsupported(cmd *cobra.Command, flags ...string) error {
+	for _, flag := range flags {
+		if cmd.Flags().Changed(flag) {
+			return services.NewError(services.CodeValidationFailed, "--%s is not supported in remote mode", flag)
+		}
+	}
+	return nil
+}
+
+var loginCmd = &cobra.Command{
+	Use:         "login",
+	Short:       "Create an API session for remote mode",
+	Long:        "Authenticate to the API with a device OTP and store the session, so read commands need no OTP until it expires",
+	Annotations: map[string]string{remoteAnnotation: "true", "login": "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		session, err := Remote.login()
+		if err != nil {
+			return err
+		}
+
+		return printResult(session.summary(), []string{session.SessionID}, func() {
+			fmt.Printf("Logged in as %s; session expires %s\n", session.Username, session.ExpiresAt.Format(time.RFC3339))
+		})
+	},
+}
+
+var logoutCmd = &cobra.Command{
+	Use:         "logout",
+	Short:       "Log out of the stored API session",
+	Long:        "Invalidate the stored session on the server and remove it and its refresh token from this machine",
+	Annotations: map[string]string{remoteAnnotation: "true", "login": "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		revoked, err := Remote.logout()
+		if err != nil {
+			return err
+		}
+
+		return printResult(map[string]interface{}{"logged_out": true, "revoked": revoked}, nil, func() {
+			if revoked {
+				fmt.Println("Logged out")
+			} else {
+				fmt.Println("Logged out (the session had already ended on the server)")
+			}
+		})
+	},
+}
+
+// summary is the stored session without its tokens, for output
+func (s *storedSession) summary() map[string]interface{} {
+	return map[string]interface{}{
+		"server_url": s.ServerURL,
+		"session_id": s.SessionID,
+		"username":   s.Username,
+		"expires_at": s.ExpiresAt,
+	}
+}
+
+// InitRemoteCommands initializes the login and logout commands
+func InitRemoteCommands(root *cobra.Command) {
+	root.AddCommand(loginCmd)
+	root.AddCommand(logoutCmd)
+}
@@ -119,6 +119,11 @@ var deleteResourceCmd = &cobra.Command{
 			}
 		}
 
+		item := map[string]interface{}{"id": resource.ID, "name": resource.Name}
+		if ok, err := confirmChange(cmd, fmt.Sprintf("delete resource %s (%s)", resource.Name, resource.ID), item, resource.ID.String()); !ok {
+			return err
+		}
+
 		if err := DB.Delete(&resource).Error; err != nil {
 			return fmt.Errorf("failed to delete resource: %w", err)
 		}
@@ -154,4 +159,7 @@ func InitResourceCommands() {
 
 	// List resources flags
 	listResourcesCmd.Flags().Bool("active-only", false, "Show only active resources")
+
+	// Delete resource flags
+	addConfirmFlags(deleteResourceCmd)
 } 
\ No newline at end of file
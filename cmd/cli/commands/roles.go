@@ -10,9 +10,14 @@ import (
 )
 
 var createRoleCmd = &cobra.Command{
-	Use:   "create",
-	Short: "Create a new role",
+	Use:         "create",
+	Short:       "Create a new role",
+	Annotations: remoteCapable,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if Remote != nil {
+			return remoteCreateRole(cmd, args)
+		}
+
 		name, _ := cmd.Flags().GetString("name")
 		description, _ := cmd.Flags().GetString("description")
 		active, _ := cmd.Flags().GetBool("active")
@@ -28,15 +33,19 @@ var createRoleCmd = &cobra.Command{
 			return fmt.Errorf("failed to create role: %w", err)
 		}
 
-		fmt.Printf("Role created: %s (%s)\n", role.Name, role.ID)
-		return nil
+		return printRoleResult("created", newRoleOutput(&role))
 	},
 }
 
 var listRolesCmd = &cobra.Command{
-	Use:   "list",
-	Short: "List all roles",
+	Use:         "list",
+	Short:       "List all roles",
+	Annotations: remoteCapable,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if Remote != nil {
+			return remoteListRoles(cmd, args)
+		}
+
 		activeOnly, _ := cmd.Flags().GetBool("active-only")
 
 		var roles []database.Role
@@ -49,25 +58,24 @@ var listRolesCmd = &cobra.Command{
 			return fmt.Errorf("failed to fetch roles: %w", err)
 		}
 
-		fmt.Printf("Found %d roles:\n\n", len(roles))
-		for _, role := range roles {
-			permissions := make([]string, len(role.Permissions))
-			for i, perm := range role.Permissions {
-				permissions[i] = fmt.Sprintf("%s:%s", perm.Resource.Name, perm.Action)
-			}
-
-			fmt.Printf("ID: %s\n  Name: %s\n  Description: %s\n  Active: %t\n  Permissions: %v\n  Created: %s\n  Updated: %s\n\n",
-				role.ID, role.Name, role.Description, role.Active, permissions, role.CreatedAt.Format(time.RFC3339), role.UpdatedAt.Format(time.RFC3339))
+		items := make([]roleOutput, len(roles))
+		for i := range roles {
+			items[i] = newRoleOutput(&roles[i])
 		}
-		return nil
+		return printRoleList(items)
 	},
 }
 
 var updateRoleCmd = &cobra.Command{
-	Use:   "update",
-	Short: "Update a role",
-	Args:  cobra.ExactArgs(1),
+	Use:         "update",
+	Short:       "Update a role",
+	Args:        cobra.ExactArgs(1),
+	Annotations: remoteCapable,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if Remote != nil {
+			return remoteUpdateRole(cmd, args)
+		}
+
 		identifier := args[0]
 		name, _ := cmd.Flags().GetString("name")
 		description, _ := cmd.Flags().GetString("description")
@@ -98,16 +106,20 @@ var updateRoleCmd = &cobra.Command{
 			return fmt.Errorf("failed to update role: %w", err)
 		}
 
-		fmt.Printf("Role updated: %s (%s)\n", role.Name, role.ID)
-		return nil
+		return printRoleResult("updated", newRoleOutput(&role))
 	},
 }
 
 var deleteRoleCmd = &cobra.Command{
-	Use:   "delete",
-	Short: "Delete a role",
-	Args:  cobra.ExactArgs(1),
+	Use:         "delete",
+	Short:       "Delete a role",
+	Args:        cobra.ExactArgs(1),
+	Annotations: remoteCapable,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if Remote != nil {
+			return remoteDeleteRole(cmd, args)
+		}
+
 		identifier := args[0]
 		var role database.Role
 		if _, err := uuid.Parse(identifier); err == nil {
@@ -120,15 +132,40 @@ var deleteRoleCmd = &cobra.Command{
 			}
 		}
 
+		if ok, err := confirmChange(cmd, fmt.Sprintf("delete role %s (%s)", role.Name, role.ID), newRoleOutput(&role), role.ID.String()); !ok {
+			return err
+		}
+
 		if err := DB.Delete(&role).Error; err != nil {
 			return fmt.Errorf("failed to delete role: %w", err)
 		}
 
-		fmt.Printf("Role deleted: %s (%s)\n", role.Name, role.ID)
-		return nil
+		return printRoleResult("deleted", newRoleOutput(&role))
 	},
 }
 
+// printRoleResult prints a role a command created or changed
+func printRoleResult(verb string, role roleOutput) error {
+	return printResult(role, []string{role.ID}, func() {
+		fmt.Printf("Role %s: %s (%s)\n", verb, role.Name, role.ID)
+	})
+}
+
+func printRoleList(roles []roleOutput) error {
+	ids := make([]string, len(roles))
+	for i, role := range roles {
+		ids[i] = role.ID
+	}
+
+	return printResult(listOutput{Items: roles, Total: len(roles)}, ids, func() {
+		fmt.Printf("Found %d roles:\n\n", len(roles))
+		for _, role := range roles {
+			fmt.Printf("ID: %s\n  Name: %s\n  Description: %s\n  Active: %t\n  Permissions: %v\n  Created: %s\n  Updated: %s\n\n",
+				role.ID, role.Name, role.Description, role.Active, role.Permissions, role.CreatedAt.Format(time.RFC3339), role.UpdatedAt.Format(time.RFC3339))
+		}
+	})
+}
+
 // RoleCmd represents the role command
 var RoleCmd = &cobra.Command{
 	Use:   "role",
@@ -157,4 +194,11 @@ func InitRoleCommands() {
 
 	// List roles flags
 	listRolesCmd.Flags().Bool("active-only", false, "Show only active roles")
+
+	// Delete role flags
+	addConfirmFlags(deleteRoleCmd)
+
+	// Complete role names
+	updateRoleCmd.ValidArgsFunction = completeArgs(roleNames)
+	deleteRoleCmd.ValidArgsFunction = completeArgs(roleNames)
 } 
\ No newline at end of file
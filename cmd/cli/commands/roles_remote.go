@@ -0,0 +1,144 @@
+package commands
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/YubiApp/internal/services"
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+)
+
+// apiRole is a role as the API returns it
+type apiRole struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Permissions []struct {
+		Resource string `json:"resource"`
+		Action   string `json:"action"`
+	} `json:"permissions"`
+}
+
+func (r *apiRole) output() roleOutput {
+	permissions := make([]string, len(r.Permissions))
+	for i, perm := range r.Permissions {
+		permissions[i] = fmt.Sprintf("%s:%s", perm.Resource, perm.Action)
+	}
+	return roleOutput{
+		ID:          r.ID,
+		Name:        r.Name,
+		Description: r.Description,
+		Active:      r.Active,
+		Permissions: permissions,
+		CreatedAt:   r.CreatedAt,
+		UpdatedAt:   r.UpdatedAt,
+	}
+}
+
+// remoteFindRole looks a role up through the API by ID or name
+func remoteFindRole(identifier string) (*apiRole, error) {
+	if _, err := uuid.Parse(identifier); err == nil {
+		var resp struct {
+			Item apiRole `json:"item"`
+		}
+		if err := Remote.get("/roles/"+identifier, nil, &resp); err != nil {
+			return nil, err
+		}
+		return &resp.Item, nil
+	}
+
+	var resp struct {
+		Items []apiRole `json:"items"`
+	}
+	if err := Remote.get("/roles", nil, &resp); err != nil {
+		return nil, err
+	}
+	for i := range resp.Items {
+		if resp.Items[i].Name == identifier {
+			return &resp.Items[i], nil
+		}
+	}
+	return nil, services.NewError(services.CodeNotFound, "role not found: %s", identifier)
+}
+
+func remoteCreateRole(cmd *cobra.Command, args []string) error {
+	if err := remoteUnsupported(cmd, "active"); err != nil {
+		return err
+	}
+
+	body := map[string]interface{}{}
+	body["name"], _ = cmd.Flags().GetString("name")
+	body["description"], _ = cmd.Flags().GetString("description")
+
+	var resp struct {
+		Item apiRole `json:"item"`
+	}
+	if err := Remote.write(http.MethodPost, "/roles", body, &resp); err != nil {
+		return err
+	}
+	return printRoleResult("created", resp.Item.output())
+}
+
+func remoteListRoles(cmd *cobra.Command, args []string) error {
+	var resp struct {
+		Items []apiRole `json:"items"`
+	}
+	if err := Remote.get("/roles", nil, &resp); err != nil {
+		return err
+	}
+
+	activeOnly, _ := cmd.Flags().GetBool("active-only")
+	roles := make([]roleOutput, 0, len(resp.Items))
+	for i := range resp.Items {
+		if !activeOnly || resp.Items[i].Active {
+			roles = append(roles, resp.Items[i].output())
+		}
+	}
+	return printRoleList(roles)
+}
+
+func remoteUpdateRole(cmd *cobra.Command, args []string) error {
+	if err := remoteUnsupported(cmd, "active"); err != nil {
+		return err
+	}
+	role, err := remoteFindRole(args[0])
+	if err != nil {
+		return err
+	}
+
+	body := map[string]interface{}{}
+	if name, _ := cmd.Flags().GetString("name"); name != "" {
+		body["name"] = name
+	}
+	if description, _ := cmd.Flags().GetString("description"); description != "" {
+		body["description"] = description
+	}
+
+	var resp struct {
+		Item apiRole `json:"item"`
+	}
+	if err := Remote.write(http.MethodPut, "/roles/"+role.ID, body, &resp); err != nil {
+		return err
+	}
+	return printRoleResult("updated", resp.Item.output())
+}
+
+func remoteDeleteRole(cmd *cobra.Command, args []string) error {
+	role, err := remoteFindRole(args[0])
+	if err != nil {
+		return err
+	}
+	if ok, err := confirmChange(cmd, fmt.Sprintf("delete role %s (%s)", role.Name, role.ID), role.output(), role.ID); !ok {
+		return err
+	}
+
+	if err := Remote.write(http.MethodDelete, "/roles/"+role.ID, nil, nil); err != nil {
+		return err
+	}
+	return printRoleResult("deleted", role.output())
+}
@@ -0,0 +1,276 @@
+package commands
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+)
+
+var createShiftCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Plan a shift for a user",
+	Long: `Plan a shift for a user, once or repeating. Times are RFC3339; repeats keep
+the first shift's wall-clock time in the location's timezone, else the user's:
+
+  yubiapp-cli shift create --user jdoe --location "Main Office" \
+    --start 2024-06-03T09:00:00+02:00 --end 2024-06-03T17:00:00+02:00 --recurrence weekdays`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		userIdentifier, _ := cmd.Flags().GetString("user")
+		locationIdentifier, _ := cmd.Flags().GetString("location")
+		recurrence, _ := cmd.Flags().GetString("recurrence")
+		until, _ := cmd.Flags().GetString("until")
+		notes, _ := cmd.Flags().GetString("notes")
+
+		user, err := findUserByIdentifier(userIdentifier)
+		if err != nil {
+			return err
+		}
+		input := services.ShiftInput{
+			UserID:     user.ID,
+			Recurrence: recurrence,
+			RecurUntil: until,
+			Notes:      notes,
+		}
+		if locationIdentifier != "" {
+			location, err := findLocationByIdentifier(locationIdentifier)
+			if err != nil {
+				return err
+			}
+			input.LocationID = &location.ID
+		}
+		if input.StartsAt, err = shiftTimeFlag(cmd, "start"); err != nil {
+			return err
+		}
+		if input.EndsAt, err = shiftTimeFlag(cmd, "end"); err != nil {
+			return err
+		}
+
+		shift, err := services.NewShiftService(DB, Cfg, nil, nil).CreateShift(input)
+		if err != nil {
+			return err
+		}
+		return printShiftResult("created", shift)
+	},
+}
+
+var listShiftsCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List planned shifts",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		userIdentifier, _ := cmd.Flags().GetString("user")
+		locationIdentifier, _ := cmd.Flags().GetString("location")
+
+		var filter services.ShiftFilter
+		if userIdentifier != "" {
+			user, err := findUserByIdentifier(userIdentifier)
+			if err != nil {
+				return err
+			}
+			filter.UserIDs = []uuid.UUID{user.ID}
+		}
+		if locationIdentifier != "" {
+			location, err := findLocationByIdentifier(locationIdentifier)
+			if err != nil {
+				return err
+			}
+			filter.LocationIDs = []uuid.UUID{location.ID}
+		}
+
+		shifts, _, err := services.NewShiftService(DB, Cfg, nil, nil).ListShifts(filter)
+		if err != nil {
+			return err
+		}
+
+		outputs := make([]shiftOutput, len(shifts))
+		ids := make([]string, len(shifts))
+		for i := range shifts {
+			outputs[i] = newShiftOutput(&shifts[i])
+			ids[i] = outputs[i].ID
+		}
+		return printResult(listOutput{Items: outputs, Total: len(outputs)}, ids, func() {
+			fmt.Printf("Found %d shifts:\n\n", len(outputs))
+			for _, shift := range outputs {
+				fmt.Printf("ID: %s\n  User: %s\n  Start: %s\n  End: %s\n",
+					shift.ID, shift.UserEmail, shift.StartsAt.Format(time.RFC3339), shift.EndsAt.Format(time.RFC3339))
+				if shift.LocationName != "" {
+					fmt.Printf("  Location: %s\n", shift.LocationName)
+				}
+				if shift.Recurrence != "" {
+					fmt.Printf("  Repeats: %s", shift.Recurrence)
+					if shift.RecurUntil != "" {
+						fmt.Printf(" until %s", shift.RecurUntil)
+					}
+					fmt.Println()
+				}
+				if shift.Notes != "" {
+					fmt.Printf("  Notes: %s\n", shift.Notes)
+				}
+				fmt.Println()
+			}
+		})
+	},
+}
+
+var updateShiftCmd = &cobra.Command{
+	Use:   "update <id>",
+	Short: "Update a shift",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := uuid.Parse(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid shift ID: %w", err)
+		}
+
+		var update services.ShiftUpdate
+		if cmd.Flags().Changed("location") {
+			locationIdentifier, _ := cmd.Flags().GetString("location")
+			if locationIdentifier == "" {
+				update.ClearLocation = true
+			} else {
+				location, err := findLocationByIdentifier(locationIdentifier)
+				if err != nil {
+					return err
+				}
+				update.LocationID = &location.ID
+			}
+		}
+		if cmd.Flags().Changed("start") {
+			start, err := shiftTimeFlag(cmd, "start")
+			if err != nil {
+				return err
+			}
+			update.StartsAt = &start
+		}
+		if cmd.Flags().Changed("end") {
+			end, err := shiftTimeFlag(cmd, "end")
+			if err != nil {
+				return err
+			}
+			update.EndsAt = &end
+		}
+		if cmd.Flags().Changed("recurrence") {
+			recurrence, _ := cmd.Flags().GetString("recurrence")
+			update.Recurrence = &recurrence
+		}
+		if cmd.Flags().Changed("until") {
+			until, _ := cmd.Flags().GetString("until")
+			update.RecurUntil = &until
+		}
+		if cmd.Flags().Changed("notes") {
+			notes, _ := cmd.Flags().GetString("notes")
+			update.Notes = &notes
+		}
+
+		shift, err := services.NewShiftService(DB, Cfg, nil, nil).UpdateShift(id, update, nil)
+		if err != nil {
+			return err
+		}
+		return printShiftResult("updated", shift)
+	},
+}
+
+var deleteShiftCmd = &cobra.Command{
+	Use:   "delete <id>",
+	Short: "Delete a shift",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := uuid.Parse(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid shift ID: %w", err)
+		}
+
+		shiftService := services.NewShiftService(DB, Cfg, nil, nil)
+		shift, err := shiftService.GetShift(id)
+		if err != nil {
+			return err
+		}
+
+		item := newShiftOutput(shift)
+		if ok, err := confirmChange(cmd, fmt.Sprintf("delete shift %s of %s", shift.ID, shift.User.Email), item, shift.ID.String()); !ok {
+			return err
+		}
+
+		if err := shiftService.DeleteShift(id); err != nil {
+			return err
+		}
+		return printShiftResult("deleted", shift)
+	},
+}
+
+// findLocationByIdentifier looks a location up by ID or name
+func findLocationByIdentifier(identifier string) (*database.Location, error) {
+	var location database.Location
+	if _, err := uuid.Parse(identifier); err == nil {
+		if err := DB.First(&location, "id = ?", identifier).Error; err != nil {
+			return nil, fmt.Errorf("location not found: %w", err)
+		}
+	} else {
+		if err := DB.First(&location, "name = ?", identifier).Error; err != nil {
+			return nil, fmt.Errorf("location not found: %w", err)
+		}
+	}
+	return &location, nil
+}
+
+// shiftTimeFlag reads an RFC3339 time flag
+func shiftTimeFlag(cmd *cobra.Command, name string) (time.Time, error) {
+	value, _ := cmd.Flags().GetString(name)
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --%s (use RFC3339, e.g. 2024-06-03T09:00:00+02:00): %w", name, err)
+	}
+	return parsed, nil
+}
+
+// printShiftResult prints a shift a command created, changed or deleted
+func printShiftResult(verb string, shift *database.Shift) error {
+	return printResult(newShiftOutput(shift), []string{shift.ID.String()}, func() {
+		fmt.Printf("Shift %s: %s for %s (%s)\n", verb, shift.StartsAt.Format(time.RFC3339), shift.User.Email, shift.ID)
+	})
+}
+
+// ShiftCmd represents the shift command
+var ShiftCmd = &cobra.Command{
+	Use:   "shift",
+	Short: "Manage planned shifts",
+	Long:  "Create, update, delete, and list the shifts users are planned to work, which /reports/shifts compares with their sign-ins",
+}
+
+// InitShiftCommands initializes the shift commands and their flags
+func InitShiftCommands() {
+	ShiftCmd.AddCommand(createShiftCmd)
+	ShiftCmd.AddCommand(listShiftsCmd)
+	ShiftCmd.AddCommand(updateShiftCmd)
+	ShiftCmd.AddCommand(deleteShiftCmd)
+
+	// Create shift flags
+	createShiftCmd.Flags().String("user", "", "User ID, email or username")
+	createShiftCmd.Flags().String("location", "", "Location ID or name")
+	createShiftCmd.Flags().String("start", "", "Start of the first shift (RFC3339)")
+	createShiftCmd.Flags().String("end", "", "End of the first shift (RFC3339)")
+	createShiftCmd.Flags().String("recurrence", "", "Repeat the shift: daily, weekdays or weekly")
+	createShiftCmd.Flags().String("until", "", "Last day of repeats (YYYY-MM-DD)")
+	createShiftCmd.Flags().String("notes", "", "Notes")
+	createShiftCmd.MarkFlagRequired("user")
+	createShiftCmd.MarkFlagRequired("start")
+	createShiftCmd.MarkFlagRequired("end")
+
+	// Update shift flags
+	updateShiftCmd.Flags().String("location", "", "Location ID or name; empty removes the location")
+	updateShiftCmd.Flags().String("start", "", "Start of the first shift (RFC3339)")
+	updateShiftCmd.Flags().String("end", "", "End of the first shift (RFC3339)")
+	updateShiftCmd.Flags().String("recurrence", "", "Repeat the shift: daily, weekdays or weekly; empty for a one-off shift")
+	updateShiftCmd.Flags().String("until", "", "Last day of repeats (YYYY-MM-DD); empty repeats indefinitely")
+	updateShiftCmd.Flags().String("notes", "", "Notes")
+
+	// List shifts flags
+	listShiftsCmd.Flags().String("user", "", "Only shifts of this user (ID, email or username)")
+	listShiftsCmd.Flags().String("location", "", "Only shifts at this location (ID or name)")
+
+	// Delete shift flags
+	addConfirmFlags(deleteShiftCmd)
+}
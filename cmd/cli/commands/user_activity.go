@@ -1,20 +1,24 @@
 package commands
 
 import (
-	"encoding/json"
 	"fmt"
 	"time"
 
 	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
 	"github.com/google/uuid"
 	"github.com/spf13/cobra"
-	"github.com/jackc/pgtype"
 )
 
 var listUserActivityCmd = &cobra.Command{
-	Use:   "list",
-	Short: "List user activity history",
+	Use:         "list",
+	Short:       "List user activity history",
+	Annotations: remoteCapable,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if Remote != nil {
+			return remoteListUserActivity(cmd, args)
+		}
+
 		userID, _ := cmd.Flags().GetString("user-id")
 		userEmail, _ := cmd.Flags().GetString("user-email")
 		actionID, _ := cmd.Flags().GetString("action-id")
@@ -24,7 +28,7 @@ var listUserActivityCmd = &cobra.Command{
 		toDate, _ := cmd.Flags().GetString("to-date")
 		limit, _ := cmd.Flags().GetInt("limit")
 
-		query := DB.Preload("User").Preload("Action").Preload("Location").Preload("UserStatus")
+		query := DB.Preload("User").Preload("Action").Preload("Location").Preload("Status")
 
 		// Apply filters
 		if userID != "" {
@@ -52,14 +56,14 @@ var listUserActivityCmd = &cobra.Command{
 			if _, err := uuid.Parse(userStatusID); err != nil {
 				return fmt.Errorf("invalid user status ID: %w", err)
 			}
-			query = query.Where("user_status_id = ?", userStatusID)
+			query = query.Where("status_id = ?", userStatusID)
 		}
 		if fromDate != "" {
 			fromTime, err := time.Parse("2006-01-02", fromDate)
 			if err != nil {
 				return fmt.Errorf("invalid from date format (use YYYY-MM-DD): %w", err)
 			}
-			query = query.Where("from_date_time >= ?", fromTime)
+			query = query.Where("from_datetime >= ?", fromTime)
 		}
 		if toDate != "" {
 			toTime, err := time.Parse("2006-01-02", toDate)
@@ -68,7 +72,7 @@ var listUserActivityCmd = &cobra.Command{
 			}
 			// Add one day to include the entire day
 			toTime = toTime.Add(24 * time.Hour)
-			query = query.Where("from_date_time < ?", toTime)
+			query = query.Where("from_datetime < ?", toTime)
 		}
 
 		// Apply limit
@@ -77,74 +81,124 @@ var listUserActivityCmd = &cobra.Command{
 		}
 
 		// Order by most recent first
-		query = query.Order("from_date_time DESC")
+		query = query.Order("from_datetime DESC")
 
 		var activities []database.UserActivityHistory
 		if err := query.Find(&activities).Error; err != nil {
 			return fmt.Errorf("failed to fetch user activity: %w", err)
 		}
 
-		fmt.Printf("Found %d activity records:\n\n", len(activities))
-		for _, activity := range activities {
-			detailsStr := "null"
-			if activity.Details.Status == pgtype.Present {
-				if detailsBytes, err := json.Marshal(activity.Details.Bytes); err == nil {
-					detailsStr = string(detailsBytes)
-				}
-			}
-
-			fmt.Printf("ID: %s\n  User: %s (%s)\n  Action: %s (%s)\n  User Status: %s (%s)\n  Location: %s (%s)\n  From: %s\n  To: %s\n  Details: %s\n  Created: %s\n\n",
-				activity.ID,
-				activity.User.Email, activity.UserID,
-				activity.Action.Name, activity.ActionID,
-				activity.Status.Name, activity.StatusID,
-				activity.Location.Name, activity.LocationID,
-				activity.FromDateTime.Format(time.RFC3339),
-				formatTime(activity.ToDateTime),
-				detailsStr,
-				activity.CreatedAt.Format(time.RFC3339))
-		}
-		return nil
+		return printActivityList(activities)
 	},
 }
 
 var getUserActivityCmd = &cobra.Command{
-	Use:   "get",
-	Short: "Get a specific user activity record",
-	Args:  cobra.ExactArgs(1),
+	Use:         "get",
+	Short:       "Get a specific user activity record",
+	Args:        cobra.ExactArgs(1),
+	Annotations: remoteCapable,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if Remote != nil {
+			return remoteGetUserActivity(cmd, args)
+		}
+
 		activityID := args[0]
 		if _, err := uuid.Parse(activityID); err != nil {
 			return fmt.Errorf("invalid activity ID: %w", err)
 		}
 
 		var activity database.UserActivityHistory
-		if err := DB.Preload("User").Preload("Action").Preload("Location").Preload("UserStatus").First(&activity, "id = ?", activityID).Error; err != nil {
+		if err := DB.Preload("User").Preload("Action").Preload("Location").Preload("Status").First(&activity, "id = ?", activityID).Error; err != nil {
 			return fmt.Errorf("activity not found: %w", err)
 		}
 
-		detailsStr := "null"
-		if activity.Details.Status == pgtype.Present {
-			if detailsBytes, err := json.MarshalIndent(activity.Details.Bytes, "", "  "); err == nil {
-				detailsStr = string(detailsBytes)
-			}
-		}
+		return printActivity(&activity)
+	},
+}
 
-		fmt.Printf("Activity ID: %s\n", activity.ID)
-		fmt.Printf("User: %s (%s)\n", activity.User.Email, activity.UserID)
-		fmt.Printf("Action: %s (%s)\n", activity.Action.Name, activity.ActionID)
-		fmt.Printf("User Status: %s (%s)\n", activity.Status.Name, activity.StatusID)
-		fmt.Printf("Location: %s (%s)\n", activity.Location.Name, activity.LocationID)
-		fmt.Printf("From: %s\n", activity.FromDateTime.Format(time.RFC3339))
-		fmt.Printf("To: %s\n", formatTime(activity.ToDateTime))
-		fmt.Printf("Details: %s\n", detailsStr)
-		fmt.Printf("Created: %s\n", activity.CreatedAt.Format(time.RFC3339))
-		fmt.Printf("Updated: %s\n", activity.UpdatedAt.Format(time.RFC3339))
+var repairOpenActivitiesCmd = &cobra.Command{
+	Use:   "repair-open",
+	Short: "Repair users left with more than one open activity",
+	Long: `Leave each user that has more than one open activity with only the latest.
+Going through a user's open activities oldest first, one that repeats the one
+before it (same action, status and location, e.g. a double tap) is merged into
+it and deleted; any other is closed when the next one started. --dry-run
+reports the repairs without making them.`,
+	Annotations: remoteCapable,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		var repairs []services.OpenActivityRepair
+		var err error
+		if Remote != nil {
+			repairs, err = remoteRepairOpenActivities(dryRun)
+		} else {
+			repairs, err = services.NewUserActivityService(DB, Cfg, nil).RepairOpenActivities(dryRun)
+		}
+		if err != nil {
+			return err
+		}
 
-		return nil
+		ids := make([]string, len(repairs))
+		for i, repair := range repairs {
+			ids[i] = repair.UserID.String()
+		}
+		return printResult(listOutput{Items: repairs, Total: len(repairs)}, ids, func() {
+			verb := "Repaired"
+			if dryRun {
+				verb = "Would repair"
+			}
+			fmt.Printf("%s open activities of %d users\n", verb, len(repairs))
+			for _, repair := range repairs {
+				fmt.Printf("  %s: kept %s open, closed %d, merged %d\n",
+					repair.UserID, repair.KeptID, len(repair.ClosedIDs), len(repair.MergedIDs))
+			}
+		})
 	},
 }
 
+// printActivityList prints activity records the database or the API returned
+func printActivityList(activities []database.UserActivityHistory) error {
+	items := make([]activityOutput, len(activities))
+	ids := make([]string, len(activities))
+	for i := range activities {
+		items[i] = newActivityOutput(&activities[i])
+		ids[i] = items[i].ID
+	}
+
+	return printResult(listOutput{Items: items, Total: len(items)}, ids, func() {
+		fmt.Printf("Found %d activity records:\n\n", len(items))
+		for _, activity := range items {
+			fmt.Printf("ID: %s\n  User: %s (%s)\n  Action: %s (%s)\n  User Status: %s (%s)\n  Location: %s (%s)\n  From: %s\n  To: %s\n  Details: %s\n  Created: %s\n\n",
+				activity.ID,
+				activity.UserEmail, activity.UserID,
+				activity.ActionName, activity.ActionID,
+				activity.StatusName, formatID(activity.StatusID),
+				activity.LocationName, formatID(activity.LocationID),
+				activity.From.Format(time.RFC3339),
+				formatTime(activity.To),
+				formatDetails(activity.Details),
+				activity.CreatedAt.Format(time.RFC3339))
+		}
+	})
+}
+
+func printActivity(activity *database.UserActivityHistory) error {
+	output := newActivityOutput(activity)
+	return printResult(output, []string{output.ID}, func() {
+		fmt.Printf("Activity ID: %s\n", output.ID)
+		fmt.Printf("User: %s (%s)\n", output.UserEmail, output.UserID)
+		fmt.Printf("Action: %s (%s)\n", output.ActionName, output.ActionID)
+		fmt.Printf("User Status: %s (%s)\n", output.StatusName, formatID(output.StatusID))
+		fmt.Printf("Location: %s (%s)\n", output.LocationName, formatID(output.LocationID))
+		fmt.Printf("From: %s\n", output.From.Format(time.RFC3339))
+		fmt.Printf("To: %s\n", formatTime(output.To))
+		fmt.Printf("Details: %s\n", formatDetails(output.Details))
+		fmt.Printf("Created: %s\n", output.CreatedAt.Format(time.RFC3339))
+		fmt.Printf("Updated: %s\n", output.UpdatedAt.Format(time.RFC3339))
+	})
+}
+
 // Helper function to format time, handling nil values
 func formatTime(t *time.Time) string {
 	if t == nil {
@@ -153,11 +207,19 @@ func formatTime(t *time.Time) string {
 	return t.Format(time.RFC3339)
 }
 
+// formatID formats an optional ID, handling nil values
+func formatID(id *string) string {
+	if id == nil {
+		return "null"
+	}
+	return *id
+}
+
 // UserActivityCmd represents the user activity command
 var UserActivityCmd = &cobra.Command{
 	Use:   "user-activity",
 	Short: "Query user activity history",
-	Long:  "List and get user activity history records",
+	Long:  "List and get user activity history records, and repair duplicate open activities",
 }
 
 // InitUserActivityCommands initializes the user activity commands and their flags
@@ -165,6 +227,7 @@ func InitUserActivityCommands() {
 	// Add subcommands
 	UserActivityCmd.AddCommand(listUserActivityCmd)
 	UserActivityCmd.AddCommand(getUserActivityCmd)
+	UserActivityCmd.AddCommand(repairOpenActivitiesCmd)
 
 	// List user activity flags
 	listUserActivityCmd.Flags().String("user-id", "", "Filter by user ID")
@@ -175,4 +238,7 @@ func InitUserActivityCommands() {
 	listUserActivityCmd.Flags().String("from-date", "", "Filter from date (YYYY-MM-DD)")
 	listUserActivityCmd.Flags().String("to-date", "", "Filter to date (YYYY-MM-DD)")
 	listUserActivityCmd.Flags().Int("limit", 0, "Limit number of results")
+	listUserActivityCmd.RegisterFlagCompletionFunc("user-email", completeFlag(userEmails))
+
+	repairOpenActivitiesCmd.Flags().Bool("dry-run", false, "Report the repairs without making them")
 } 
\ No newline at end of file
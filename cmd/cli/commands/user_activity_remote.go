@@ -0,0 +1,88 @@
+package commands
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+)
+
+func remoteListUserActivity(cmd *cobra.Command, args []string) error {
+	query := url.Values{}
+
+	for flag, param := range map[string]string{"user-id": "user_ids", "action-id": "action_ids", "location-id": "location_ids", "user-status-id": "status_ids"} {
+		value, _ := cmd.Flags().GetString(flag)
+		if value == "" {
+			continue
+		}
+		if _, err := uuid.Parse(value); err != nil {
+			return fmt.Errorf("invalid %s: %w", flag, err)
+		}
+		query.Set(param, value)
+	}
+	if userEmail, _ := cmd.Flags().GetString("user-email"); userEmail != "" {
+		user, err := remoteFindUser(userEmail)
+		if err != nil {
+			return err
+		}
+		query.Set("user_ids", user.ID)
+	}
+	if fromDate, _ := cmd.Flags().GetString("from-date"); fromDate != "" {
+		fromTime, err := time.Parse("2006-01-02", fromDate)
+		if err != nil {
+			return fmt.Errorf("invalid from date format (use YYYY-MM-DD): %w", err)
+		}
+		query.Set("from_datetime", fromTime.Format(time.RFC3339))
+	}
+	if toDate, _ := cmd.Flags().GetString("to-date"); toDate != "" {
+		toTime, err := time.Parse("2006-01-02", toDate)
+		if err != nil {
+			return fmt.Errorf("invalid to date format (use YYYY-MM-DD): %w", err)
+		}
+		// Add one day to include the entire day
+		query.Set("to_datetime", toTime.Add(24*time.Hour).Format(time.RFC3339))
+	}
+	if limit, _ := cmd.Flags().GetInt("limit"); limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	// The API returns activity records with their model field names
+	var resp struct {
+		Data []database.UserActivityHistory `json:"data"`
+	}
+	if err := Remote.get("/user-activity", query, &resp); err != nil {
+		return err
+	}
+	return printActivityList(resp.Data)
+}
+
+func remoteGetUserActivity(cmd *cobra.Command, args []string) error {
+	if _, err := uuid.Parse(args[0]); err != nil {
+		return fmt.Errorf("invalid activity ID: %w", err)
+	}
+
+	var resp struct {
+		Data database.UserActivityHistory `json:"data"`
+	}
+	if err := Remote.get("/user-activity/activity/"+args[0], nil, &resp); err != nil {
+		return err
+	}
+	return printActivity(&resp.Data)
+}
+
+func remoteRepairOpenActivities(dryRun bool) ([]services.OpenActivityRepair, error) {
+	var resp struct {
+		Items []services.OpenActivityRepair `json:"items"`
+	}
+	path := "/user-activity/repair-open?dry_run=" + strconv.FormatBool(dryRun)
+	if err := Remote.write(http.MethodPost, path, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Items, nil
+}
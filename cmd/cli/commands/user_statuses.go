@@ -115,6 +115,11 @@ var deleteUserStatusCmd = &cobra.Command{
 			}
 		}
 
+		item := map[string]interface{}{"id": userStatus.ID, "name": userStatus.Name}
+		if ok, err := confirmChange(cmd, fmt.Sprintf("delete user status %s (%s)", userStatus.Name, userStatus.ID), item, userStatus.ID.String()); !ok {
+			return err
+		}
+
 		if err := DB.Delete(&userStatus).Error; err != nil {
 			return fmt.Errorf("failed to delete user status: %w", err)
 		}
@@ -152,4 +157,7 @@ func InitUserStatusCommands() {
 
 	// List user statuses flags
 	listUserStatusesCmd.Flags().Bool("active-only", false, "Show only active user statuses")
+
+	// Delete user status flags
+	addConfirmFlags(deleteUserStatusCmd)
 } 
\ No newline at end of file
@@ -2,12 +2,15 @@ package commands
 
 import (
 	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
 	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
 	"github.com/spf13/cobra"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // UserCmd represents the user command
@@ -18,9 +21,14 @@ var UserCmd = &cobra.Command{
 }
 
 var createUserCmd = &cobra.Command{
-	Use:   "create",
-	Short: "Create a new user",
+	Use:         "create",
+	Short:       "Create a new user",
+	Annotations: remoteCapable,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if Remote != nil {
+			return remoteCreateUser(cmd, args)
+		}
+
 		email, _ := cmd.Flags().GetString("email")
 		username, _ := cmd.Flags().GetString("username")
 		password, _ := cmd.Flags().GetString("password")
@@ -28,35 +36,70 @@ var createUserCmd = &cobra.Command{
 		lastName, _ := cmd.Flags().GetString("last-name")
 		active, _ := cmd.Flags().GetBool("active")
 
-		// Hash the password
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		// Hash the password, enforcing the password policy
+		passwordService := services.NewPasswordService(DB, Cfg)
+		hashedPassword, err := passwordService.HashPassword(password)
+		if err != nil {
+			return err
+		}
+
+		attributes, err := attributeFlags(cmd)
 		if err != nil {
-			return fmt.Errorf("failed to hash password: %w", err)
+			return err
+		}
+		storedAttributes, err := services.NewUserAttributeSchema(Cfg.Users.Attributes).Apply(DB, pgtype.JSONB{}, attributeChanges(attributes))
+		if err != nil {
+			return err
 		}
 
 		user := database.User{
 			ID:        uuid.New(),
 			Email:     email,
 			Username:  username,
-			Password:  string(hashedPassword),
+			Password:  hashedPassword,
 			FirstName: firstName,
 			LastName:  lastName,
 			Active:    active,
+			State:     services.UserStateActive,
+
+			Attributes: storedAttributes,
+		}
+		if !active {
+			user.State = services.UserStateInvited
+		}
+		if user.ManagerID, err = managerFlag(cmd, user.ID); err != nil {
+			return err
+		}
+		locale, _ := cmd.Flags().GetString("locale")
+		if user.Locale, err = services.CheckLocale(locale); err != nil {
+			return err
+		}
+		user.Timezone, _ = cmd.Flags().GetString("timezone")
+		if err := services.CheckTimezone(user.Timezone); err != nil {
+			return err
 		}
 
 		if err := DB.Create(&user).Error; err != nil {
 			return fmt.Errorf("failed to create user: %w", err)
 		}
 
-		fmt.Printf("User created: %s (%s)\n", user.Email, user.ID)
-		return nil
+		if err := passwordService.RecordNewPassword(user.ID, hashedPassword); err != nil {
+			return err
+		}
+
+		return printUserResult("created", newUserOutput(&user))
 	},
 }
 
 var listUsersCmd = &cobra.Command{
-	Use:   "list",
-	Short: "List all users",
+	Use:         "list",
+	Short:       "List all users",
+	Annotations: remoteCapable,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if Remote != nil {
+			return remoteListUsers(cmd, args)
+		}
+
 		activeOnly, _ := cmd.Flags().GetBool("active-only")
 
 		var users []database.User
@@ -64,30 +107,40 @@ var listUsersCmd = &cobra.Command{
 		if activeOnly {
 			query = query.Where("active = ?", true)
 		}
+		filters, err := attributeFlags(cmd)
+		if err != nil {
+			return err
+		}
+		if len(filters) > 0 {
+			contains, err := services.NewUserAttributeSchema(Cfg.Users.Attributes).Filter(filters)
+			if err != nil {
+				return err
+			}
+			query = query.Where("attributes @> ?::jsonb", contains)
+		}
 
 		if err := query.Find(&users).Error; err != nil {
 			return fmt.Errorf("failed to fetch users: %w", err)
 		}
 
-		fmt.Printf("Found %d users:\n\n", len(users))
-		for _, user := range users {
-			roles := make([]string, len(user.Roles))
-			for i, role := range user.Roles {
-				roles[i] = role.Name
-			}
-
-			fmt.Printf("ID: %s\n  Email: %s\n  Username: %s\n  Name: %s %s\n  Active: %t\n  Roles: %v\n  Created: %s\n  Updated: %s\n\n",
-				user.ID, user.Email, user.Username, user.FirstName, user.LastName, user.Active, roles, user.CreatedAt.Format(time.RFC3339), user.UpdatedAt.Format(time.RFC3339))
+		items := make([]userOutput, len(users))
+		for i := range users {
+			items[i] = newUserOutput(&users[i])
 		}
-		return nil
+		return printUserList(items)
 	},
 }
 
 var updateUserCmd = &cobra.Command{
-	Use:   "update",
-	Short: "Update a user",
-	Args:  cobra.ExactArgs(1),
+	Use:         "update",
+	Short:       "Update a user",
+	Args:        cobra.ExactArgs(1),
+	Annotations: remoteCapable,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if Remote != nil {
+			return remoteUpdateUser(cmd, args)
+		}
+
 		identifier := args[0]
 		email, _ := cmd.Flags().GetString("email")
 		username, _ := cmd.Flags().GetString("username")
@@ -113,13 +166,6 @@ var updateUserCmd = &cobra.Command{
 		if username != "" {
 			user.Username = username
 		}
-		if password != "" {
-			hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-			if err != nil {
-				return fmt.Errorf("failed to hash password: %w", err)
-			}
-			user.Password = string(hashedPassword)
-		}
 		if firstName != "" {
 			user.FirstName = firstName
 		}
@@ -129,21 +175,58 @@ var updateUserCmd = &cobra.Command{
 		if cmd.Flags().Changed("active") {
 			user.Active = active
 		}
+		attributes, err := attributeFlags(cmd)
+		if err != nil {
+			return err
+		}
+		if len(attributes) > 0 {
+			if user.Attributes, err = services.NewUserAttributeSchema(Cfg.Users.Attributes).Apply(DB, user.Attributes, attributeChanges(attributes)); err != nil {
+				return err
+			}
+		}
+		if cmd.Flags().Changed("manager") {
+			if user.ManagerID, err = managerFlag(cmd, user.ID); err != nil {
+				return err
+			}
+		}
+		if cmd.Flags().Changed("locale") {
+			locale, _ := cmd.Flags().GetString("locale")
+			if user.Locale, err = services.CheckLocale(locale); err != nil {
+				return err
+			}
+		}
+		if cmd.Flags().Changed("timezone") {
+			user.Timezone, _ = cmd.Flags().GetString("timezone")
+			if err := services.CheckTimezone(user.Timezone); err != nil {
+				return err
+			}
+		}
 
 		if err := DB.Save(&user).Error; err != nil {
 			return fmt.Errorf("failed to update user: %w", err)
 		}
 
-		fmt.Printf("User updated: %s (%s)\n", user.Email, user.ID)
-		return nil
+		// Password changes go through the password policy and history
+		if password != "" {
+			if err := services.NewPasswordService(DB, Cfg).SetPassword(user.ID, password); err != nil {
+				return err
+			}
+		}
+
+		return printUserResult("updated", newUserOutput(&user))
 	},
 }
 
 var deleteUserCmd = &cobra.Command{
-	Use:   "delete",
-	Short: "Delete a user",
-	Args:  cobra.ExactArgs(1),
+	Use:         "delete",
+	Short:       "Delete a user",
+	Args:        cobra.ExactArgs(1),
+	Annotations: remoteCapable,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if Remote != nil {
+			return remoteDeleteUser(cmd, args)
+		}
+
 		identifier := args[0]
 		var user database.User
 		if _, err := uuid.Parse(identifier); err == nil {
@@ -156,15 +239,282 @@ var deleteUserCmd = &cobra.Command{
 			}
 		}
 
+		if ok, err := confirmChange(cmd, fmt.Sprintf("delete user %s (%s)", user.Email, user.ID), newUserOutput(&user), user.ID.String()); !ok {
+			return err
+		}
+
 		if err := DB.Delete(&user).Error; err != nil {
 			return fmt.Errorf("failed to delete user: %w", err)
 		}
 
-		fmt.Printf("User deleted: %s (%s)\n", user.Email, user.ID)
+		return printUserResult("deleted", newUserOutput(&user))
+	},
+}
+
+var userStateCmd = &cobra.Command{
+	Use:         "state [user]",
+	Short:       "Move a user to another lifecycle state",
+	Long:        "Move a user to another lifecycle state (invited, active, suspended, leave, offboarded), now or from an effective date",
+	Args:        cobra.ExactArgs(1),
+	Annotations: remoteCapable,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if Remote != nil {
+			return remoteTransitionUser(cmd, args)
+		}
+
+		toState, _ := cmd.Flags().GetString("to")
+		reason, _ := cmd.Flags().GetString("reason")
+		effective, _ := cmd.Flags().GetString("effective")
+
+		user, err := findUserByIdentifier(args[0])
+		if err != nil {
+			return err
+		}
+
+		var effectiveAt *time.Time
+		if effective != "" {
+			t, err := time.Parse(time.RFC3339, effective)
+			if err != nil {
+				return fmt.Errorf("invalid effective date (use RFC3339): %w", err)
+			}
+			effectiveAt = &t
+		}
+
+		lifecycleService := services.NewUserLifecycleService(DB, nil, lifecycleSessionService())
+		transition, err := lifecycleService.TransitionUser(user.ID, toState, reason, effectiveAt, nil)
+		if err != nil {
+			return err
+		}
+
+		return printTransitionResult(user.Username, newTransitionOutput(transition))
+	},
+}
+
+// lifecycleSessionService returns the session service whose sessions a
+// transition out of the active state invalidates, or nil when sessions are
+// kept in the API server's memory
+func lifecycleSessionService() *services.SessionService {
+	switch Cfg.Auth.SessionStore {
+	case "memory":
+		return nil
+	case "postgres":
+		return services.NewSessionService(Cfg, services.NewPostgresSessionStore(DB, Cfg))
+	}
+	redisClient, err := services.NewRedisClient(Cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: sessions will not be invalidated: %v\n", err)
 		return nil
+	}
+	return services.NewSessionService(Cfg, services.NewRedisSessionStore(redisClient))
+}
+
+var userTransitionsCmd = &cobra.Command{
+	Use:         "transitions [user]",
+	Short:       "List a user's lifecycle state transitions",
+	Args:        cobra.ExactArgs(1),
+	Annotations: remoteCapable,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if Remote != nil {
+			return remoteListUserTransitions(cmd, args)
+		}
+
+		user, err := findUserByIdentifier(args[0])
+		if err != nil {
+			return err
+		}
+
+		lifecycleService := services.NewUserLifecycleService(DB, nil, nil)
+		transitions, err := lifecycleService.ListTransitions(user.ID)
+		if err != nil {
+			return err
+		}
+
+		items := make([]transitionOutput, len(transitions))
+		for i := range transitions {
+			items[i] = newTransitionOutput(&transitions[i])
+		}
+		return printTransitionList(user.Username, user.State, items)
 	},
 }
 
+var cancelUserTransitionCmd = &cobra.Command{
+	Use:         "cancel-transition [transition-id]",
+	Short:       "Cancel a pending lifecycle state transition",
+	Args:        cobra.ExactArgs(1),
+	Annotations: remoteCapable,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if Remote != nil {
+			return remoteCancelUserTransition(cmd, args)
+		}
+
+		transitionID, err := uuid.Parse(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid transition ID: %w", err)
+		}
+		note, _ := cmd.Flags().GetString("note")
+
+		lifecycleService := services.NewUserLifecycleService(DB, nil, nil)
+		transition, err := lifecycleService.CancelTransition(transitionID, note)
+		if err != nil {
+			return err
+		}
+
+		return printResult(newTransitionOutput(transition), []string{transition.ID.String()}, func() {
+			fmt.Printf("Transition cancelled: %s\n", transition.ID)
+		})
+	},
+}
+
+var unlockUserCmd = &cobra.Command{
+	Use:         "unlock [user]",
+	Short:       "Clear a password lockout",
+	Args:        cobra.ExactArgs(1),
+	Annotations: remoteCapable,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if Remote != nil {
+			return remoteUnlockUser(cmd, args)
+		}
+
+		user, err := findUserByIdentifier(args[0])
+		if err != nil {
+			return err
+		}
+
+		if err := services.NewPasswordService(DB, Cfg).UnlockUser(user.ID); err != nil {
+			return err
+		}
+
+		return printUserResult("unlocked", newUserOutput(user))
+	},
+}
+
+// attributeFlags reads the --attr name=value flags
+func attributeFlags(cmd *cobra.Command) (map[string]string, error) {
+	flags, _ := cmd.Flags().GetStringArray("attr")
+	attributes := map[string]string{}
+	for _, flag := range flags {
+		name, value, ok := strings.Cut(flag, "=")
+		if !ok || name == "" {
+			return nil, services.NewError(services.CodeValidationFailed, "invalid --attr %q: use name=value", flag)
+		}
+		attributes[name] = value
+	}
+	return attributes, nil
+}
+
+// attributeChanges turns --attr flags into attribute changes; an empty value
+// removes the attribute
+func attributeChanges(attributes map[string]string) map[string]interface{} {
+	changes := make(map[string]interface{}, len(attributes))
+	for name, value := range attributes {
+		if value == "" {
+			changes[name] = nil
+		} else {
+			changes[name] = value
+		}
+	}
+	return changes
+}
+
+// managerFlag resolves --manager to the ID of userID's manager, checked with
+// services.CheckManager; an empty value is no manager
+func managerFlag(cmd *cobra.Command, userID uuid.UUID) (*uuid.UUID, error) {
+	identifier, _ := cmd.Flags().GetString("manager")
+	if identifier == "" {
+		return nil, nil
+	}
+	manager, err := findUserByIdentifier(identifier)
+	if err != nil {
+		return nil, fmt.Errorf("manager: %w", err)
+	}
+	if err := services.CheckManager(DB, userID, manager.ID); err != nil {
+		return nil, err
+	}
+	return &manager.ID, nil
+}
+
+// findUserByIdentifier looks a user up by ID, email or username
+func findUserByIdentifier(identifier string) (*database.User, error) {
+	var user database.User
+	if _, err := uuid.Parse(identifier); err == nil {
+		if err := DB.First(&user, "id = ?", identifier).Error; err != nil {
+			return nil, fmt.Errorf("user not found: %w", err)
+		}
+	} else {
+		if err := DB.First(&user, "email = ? OR username = ?", identifier, identifier).Error; err != nil {
+			return nil, fmt.Errorf("user not found: %w", err)
+		}
+	}
+	return &user, nil
+}
+
+// printUserResult prints a user a command created or changed
+func printUserResult(verb string, user userOutput) error {
+	return printResult(user, []string{user.ID}, func() {
+		fmt.Printf("User %s: %s (%s)\n", verb, user.Email, user.ID)
+	})
+}
+
+func printUserList(users []userOutput) error {
+	ids := make([]string, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+
+	return printResult(listOutput{Items: users, Total: len(users)}, ids, func() {
+		fmt.Printf("Found %d users:\n\n", len(users))
+		for _, user := range users {
+			fmt.Printf("ID: %s\n  Email: %s\n  Username: %s\n  Name: %s %s\n  Active: %t\n  State: %s\n  Roles: %v\n  Created: %s\n  Updated: %s\n",
+				user.ID, user.Email, user.Username, user.FirstName, user.LastName, user.Active, user.State, user.Roles, user.CreatedAt.Format(time.RFC3339), user.UpdatedAt.Format(time.RFC3339))
+			if len(user.Attributes) > 0 {
+				fmt.Printf("  Attributes: %v\n", user.Attributes)
+			}
+			if user.ManagerID != "" {
+				fmt.Printf("  Manager: %s\n", user.ManagerID)
+			}
+			if user.Locale != "" {
+				fmt.Printf("  Locale: %s\n", user.Locale)
+			}
+			if user.Timezone != "" {
+				fmt.Printf("  Timezone: %s\n", user.Timezone)
+			}
+			fmt.Println()
+		}
+	})
+}
+
+// printTransitionResult prints a state transition that was applied or scheduled
+func printTransitionResult(username string, transition transitionOutput) error {
+	return printResult(transition, []string{transition.ID}, func() {
+		if transition.Status == "applied" {
+			fmt.Printf("User %s moved from %s to %s\n", username, transition.FromState, transition.ToState)
+		} else {
+			fmt.Printf("User %s scheduled to move from %s to %s at %s (transition %s)\n",
+				username, transition.FromState, transition.ToState, transition.EffectiveAt.Format(time.RFC3339), transition.ID)
+		}
+	})
+}
+
+func printTransitionList(username, state string, transitions []transitionOutput) error {
+	ids := make([]string, len(transitions))
+	for i, transition := range transitions {
+		ids[i] = transition.ID
+	}
+
+	return printResult(listOutput{Items: transitions, Total: len(transitions)}, ids, func() {
+		fmt.Printf("User %s is %s. Found %d transitions:\n\n", username, state, len(transitions))
+		for _, transition := range transitions {
+			fmt.Printf("ID: %s\n  %s -> %s (%s)\n  Effective: %s\n  Reason: %s\n",
+				transition.ID, transition.FromState, transition.ToState, transition.Status,
+				transition.EffectiveAt.Format(time.RFC3339), transition.Reason)
+			if transition.Note != "" {
+				fmt.Printf("  Note: %s\n", transition.Note)
+			}
+			fmt.Println()
+		}
+	})
+}
+
 // InitUserCommands initializes the user commands and their flags
 func InitUserCommands() {
 	// Add subcommands
@@ -172,6 +522,10 @@ func InitUserCommands() {
 	UserCmd.AddCommand(listUsersCmd)
 	UserCmd.AddCommand(updateUserCmd)
 	UserCmd.AddCommand(deleteUserCmd)
+	UserCmd.AddCommand(userStateCmd)
+	UserCmd.AddCommand(userTransitionsCmd)
+	UserCmd.AddCommand(cancelUserTransitionCmd)
+	UserCmd.AddCommand(unlockUserCmd)
 
 	// Create user flags
 	createUserCmd.Flags().String("email", "", "User email address")
@@ -180,6 +534,10 @@ func InitUserCommands() {
 	createUserCmd.Flags().String("first-name", "", "First name")
 	createUserCmd.Flags().String("last-name", "", "Last name")
 	createUserCmd.Flags().Bool("active", true, "Whether the user is active")
+	createUserCmd.Flags().StringArray("attr", nil, "Custom attribute as name=value (repeatable)")
+	createUserCmd.Flags().String("manager", "", "Manager's ID, email or username")
+	createUserCmd.Flags().String("locale", "", "Preferred language for messages and emails, e.g. fr or pt-BR")
+	createUserCmd.Flags().String("timezone", "", "IANA timezone days are counted in, e.g. Europe/Paris (default UTC)")
 	createUserCmd.MarkFlagRequired("email")
 	createUserCmd.MarkFlagRequired("username")
 	createUserCmd.MarkFlagRequired("password")
@@ -191,7 +549,34 @@ func InitUserCommands() {
 	updateUserCmd.Flags().String("first-name", "", "First name")
 	updateUserCmd.Flags().String("last-name", "", "Last name")
 	updateUserCmd.Flags().Bool("active", true, "Whether the user is active")
+	updateUserCmd.Flags().StringArray("attr", nil, "Set a custom attribute as name=value, or remove it with name= (repeatable)")
+	updateUserCmd.Flags().String("manager", "", "Manager's ID, email or username; empty removes the manager")
+	updateUserCmd.Flags().String("locale", "", "Preferred language for messages and emails, e.g. fr or pt-BR; empty follows the client's")
+	updateUserCmd.Flags().String("timezone", "", "IANA timezone days are counted in, e.g. Europe/Paris; empty is UTC")
 
 	// List users flags
 	listUsersCmd.Flags().Bool("active-only", false, "Show only active users")
+	listUsersCmd.Flags().StringArray("attr", nil, "Show only users with this custom attribute value, as name=value (repeatable)")
+
+	// User state flags
+	userStateCmd.Flags().String("to", "", "Target state (invited, active, suspended, leave, offboarded)")
+	userStateCmd.Flags().String("reason", "", "Reason for the change")
+	userStateCmd.Flags().String("effective", "", "Effective date (RFC3339); defaults to now")
+	userStateCmd.MarkFlagRequired("to")
+	userStateCmd.MarkFlagRequired("reason")
+
+	// Cancel transition flags
+	cancelUserTransitionCmd.Flags().String("note", "", "Why the transition was cancelled")
+	cancelUserTransitionCmd.Flags().String("user", "", "User the transition belongs to (required in remote mode)")
+	cancelUserTransitionCmd.RegisterFlagCompletionFunc("user", completeFlag(userEmails))
+
+	// Delete user flags
+	addConfirmFlags(deleteUserCmd)
+
+	// Complete user emails
+	createUserCmd.RegisterFlagCompletionFunc("manager", completeFlag(userEmails))
+	updateUserCmd.RegisterFlagCompletionFunc("manager", completeFlag(userEmails))
+	for _, cmd := range []*cobra.Command{updateUserCmd, deleteUserCmd, userStateCmd, userTransitionsCmd, unlockUserCmd} {
+		cmd.ValidArgsFunction = completeArgs(userEmails)
+	}
 } 
\ No newline at end of file
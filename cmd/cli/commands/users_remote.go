@@ -0,0 +1,292 @@
+package commands
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/YubiApp/internal/services"
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+)
+
+// apiUser is a user as the API returns it
+type apiUser struct {
+	ID        string    `json:"id"`
+	Email     string    `json:"email"`
+	Username  string    `json:"username"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Active    bool      `json:"active"`
+	State     string    `json:"state"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Roles     []struct {
+		Name string `json:"name"`
+	} `json:"roles"`
+	Attributes map[string]interface{} `json:"attributes"`
+	ManagerID  *string                `json:"manager_id"`
+	Locale     string                 `json:"locale"`
+	Timezone   string                 `json:"timezone"`
+}
+
+func (u *apiUser) output() userOutput {
+	roles := make([]string, len(u.Roles))
+	for i, role := range u.Roles {
+		roles[i] = role.Name
+	}
+	output := userOutput{
+		ID:        u.ID,
+		Email:     u.Email,
+		Username:  u.Username,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		Active:    u.Active,
+		State:     u.State,
+		Roles:     roles,
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: u.UpdatedAt,
+
+		Attributes: u.Attributes,
+		Locale:     u.Locale,
+		Timezone:   u.Timezone,
+	}
+	if u.ManagerID != nil {
+		output.ManagerID = *u.ManagerID
+	}
+	return output
+}
+
+// remoteFindUser looks a user up through the API by ID, email or username
+func remoteFindUser(identifier string) (*apiUser, error) {
+	if _, err := uuid.Parse(identifier); err == nil {
+		var resp struct {
+			Item apiUser `json:"item"`
+		}
+		if err := Remote.get("/users/"+identifier, nil, &resp); err != nil {
+			return nil, err
+		}
+		return &resp.Item, nil
+	}
+
+	var resp struct {
+		Items []apiUser `json:"items"`
+	}
+	if err := Remote.get("/users", nil, &resp); err != nil {
+		return nil, err
+	}
+	for i := range resp.Items {
+		if resp.Items[i].Email == identifier || resp.Items[i].Username == identifier {
+			return &resp.Items[i], nil
+		}
+	}
+	return nil, services.NewError(services.CodeNotFound, "user not found: %s", identifier)
+}
+
+func remoteCreateUser(cmd *cobra.Command, args []string) error {
+	body := map[string]interface{}{}
+	for flag, field := range map[string]string{"email": "email", "username": "username", "password": "password", "first-name": "first_name", "last-name": "last_name"} {
+		body[field], _ = cmd.Flags().GetString(flag)
+	}
+	body["active"], _ = cmd.Flags().GetBool("active")
+	attributes, err := attributeFlags(cmd)
+	if err != nil {
+		return err
+	}
+	if len(attributes) > 0 {
+		body["attributes"] = attributeChanges(attributes)
+	}
+	if identifier, _ := cmd.Flags().GetString("manager"); identifier != "" {
+		manager, err := remoteFindUser(identifier)
+		if err != nil {
+			return fmt.Errorf("manager: %w", err)
+		}
+		body["manager_id"] = manager.ID
+	}
+	if locale, _ := cmd.Flags().GetString("locale"); locale != "" {
+		body["locale"] = locale
+	}
+	if timezone, _ := cmd.Flags().GetString("timezone"); timezone != "" {
+		body["timezone"] = timezone
+	}
+
+	var resp struct {
+		Item apiUser `json:"item"`
+	}
+	if err := Remote.write(http.MethodPost, "/users", body, &resp); err != nil {
+		return err
+	}
+	return printUserResult("created", resp.Item.output())
+}
+
+func remoteListUsers(cmd *cobra.Command, args []string) error {
+	query := url.Values{}
+	if activeOnly, _ := cmd.Flags().GetBool("active-only"); activeOnly {
+		query.Set("active", "true")
+	}
+	filters, err := attributeFlags(cmd)
+	if err != nil {
+		return err
+	}
+	for name, value := range filters {
+		query.Set("attr."+name, value)
+	}
+
+	var resp struct {
+		Items []apiUser `json:"items"`
+	}
+	if err := Remote.get("/users", query, &resp); err != nil {
+		return err
+	}
+
+	users := make([]userOutput, len(resp.Items))
+	for i := range resp.Items {
+		users[i] = resp.Items[i].output()
+	}
+	return printUserList(users)
+}
+
+func remoteUpdateUser(cmd *cobra.Command, args []string) error {
+	user, err := remoteFindUser(args[0])
+	if err != nil {
+		return err
+	}
+
+	body := map[string]interface{}{}
+	for flag, field := range map[string]string{"email": "email", "username": "username", "password": "password", "first-name": "first_name", "last-name": "last_name"} {
+		if value, _ := cmd.Flags().GetString(flag); value != "" {
+			body[field] = value
+		}
+	}
+	if cmd.Flags().Changed("active") {
+		body["active"], _ = cmd.Flags().GetBool("active")
+	}
+	attributes, err := attributeFlags(cmd)
+	if err != nil {
+		return err
+	}
+	if len(attributes) > 0 {
+		body["attributes"] = attributeChanges(attributes)
+	}
+	if cmd.Flags().Changed("manager") {
+		body["manager_id"] = ""
+		if identifier, _ := cmd.Flags().GetString("manager"); identifier != "" {
+			manager, err := remoteFindUser(identifier)
+			if err != nil {
+				return fmt.Errorf("manager: %w", err)
+			}
+			body["manager_id"] = manager.ID
+		}
+	}
+	if cmd.Flags().Changed("locale") {
+		body["locale"], _ = cmd.Flags().GetString("locale")
+	}
+	if cmd.Flags().Changed("timezone") {
+		body["timezone"], _ = cmd.Flags().GetString("timezone")
+	}
+
+	var resp struct {
+		Item apiUser `json:"item"`
+	}
+	if err := Remote.write(http.MethodPut, "/users/"+user.ID, body, &resp); err != nil {
+		return err
+	}
+	return printUserResult("updated", resp.Item.output())
+}
+
+func remoteDeleteUser(cmd *cobra.Command, args []string) error {
+	user, err := remoteFindUser(args[0])
+	if err != nil {
+		return err
+	}
+	if ok, err := confirmChange(cmd, fmt.Sprintf("delete user %s (%s)", user.Email, user.ID), user.output(), user.ID); !ok {
+		return err
+	}
+
+	if err := Remote.write(http.MethodDelete, "/users/"+user.ID, nil, nil); err != nil {
+		return err
+	}
+	return printUserResult("deleted", user.output())
+}
+
+func remoteTransitionUser(cmd *cobra.Command, args []string) error {
+	user, err := remoteFindUser(args[0])
+	if err != nil {
+		return err
+	}
+
+	body := map[string]interface{}{}
+	body["state"], _ = cmd.Flags().GetString("to")
+	body["reason"], _ = cmd.Flags().GetString("reason")
+	if effective, _ := cmd.Flags().GetString("effective"); effective != "" {
+		if _, err := time.Parse(time.RFC3339, effective); err != nil {
+			return fmt.Errorf("invalid effective date (use RFC3339): %w", err)
+		}
+		body["effective_at"] = effective
+	}
+
+	var resp struct {
+		Item transitionOutput `json:"item"`
+	}
+	if err := Remote.write(http.MethodPost, "/users/"+user.ID+"/state", body, &resp); err != nil {
+		return err
+	}
+	return printTransitionResult(user.Username, resp.Item)
+}
+
+func remoteListUserTransitions(cmd *cobra.Command, args []string) error {
+	user, err := remoteFindUser(args[0])
+	if err != nil {
+		return err
+	}
+
+	var resp struct {
+		Items []transitionOutput `json:"items"`
+	}
+	if err := Remote.get("/users/"+user.ID+"/state-transitions", nil, &resp); err != nil {
+		return err
+	}
+	return printTransitionList(user.Username, user.State, resp.Items)
+}
+
+func remoteCancelUserTransition(cmd *cobra.Command, args []string) error {
+	transitionID, err := uuid.Parse(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid transition ID: %w", err)
+	}
+	identifier, _ := cmd.Flags().GetString("user")
+	if identifier == "" {
+		return services.NewError(services.CodeValidationFailed, "--user is required in remote mode")
+	}
+	user, err := remoteFindUser(identifier)
+	if err != nil {
+		return err
+	}
+
+	body := map[string]interface{}{}
+	body["note"], _ = cmd.Flags().GetString("note")
+
+	var resp struct {
+		Item transitionOutput `json:"item"`
+	}
+	path := "/users/" + user.ID + "/state-transitions/" + transitionID.String() + "/cancel"
+	if err := Remote.write(http.MethodPost, path, body, &resp); err != nil {
+		return err
+	}
+	return printResult(resp.Item, []string{resp.Item.ID}, func() {
+		fmt.Printf("Transition cancelled: %s\n", resp.Item.ID)
+	})
+}
+
+func remoteUnlockUser(cmd *cobra.Command, args []string) error {
+	user, err := remoteFindUser(args[0])
+	if err != nil {
+		return err
+	}
+
+	if err := Remote.write(http.MethodPost, "/users/"+user.ID+"/unlock", nil, nil); err != nil {
+		return err
+	}
+	return printUserResult("unlocked", user.output())
+}
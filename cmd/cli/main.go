@@ -8,23 +8,21 @@ import (
 	"github.com/YubiApp/cmd/cli/utils"
 	"github.com/YubiApp/internal/config"
 	"github.com/spf13/cobra"
+	"gorm.io/gorm"
 )
 
 func main() {
-	// Load configuration
-	cfg, err := config.Load()
+	// Load configuration; it is validated before the database is used, since
+	// remote mode only needs the cli section
+	cfg, err := config.LoadUnvalidated()
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	// Initialize database
-	db, err := utils.InitDatabase(cfg.Database)
-	if err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
-	}
-
-	// Set dependencies for all command packages
-	commands.SetDependencies(db, cfg)
+	// Set dependencies for all command packages; the database is opened on demand
+	commands.SetDependencies(func() (*gorm.DB, error) {
+		return utils.InitDatabase(cfg.Database)
+	}, cfg)
 
 	// Initialize all command groups
 	commands.InitUserCommands()
@@ -38,6 +36,14 @@ func main() {
 	commands.InitUserActivityCommands()
 	commands.InitAssignmentCommands()
 	commands.InitAuthenticationCommands()
+	commands.InitShiftCommands()
+	commands.InitLeaveCommands()
+	commands.InitHolidayCommands()
+	commands.InitDemoCommands()
+	commands.InitMigrateCommands()
+	commands.InitArchiveCommands()
+	commands.InitBootstrapCommands()
+	commands.InitApplyCommands()
 
 	// Create root command
 	rootCmd := &cobra.Command{
@@ -50,8 +56,17 @@ The CLI supports YubiKey OTP authentication and provides comprehensive managemen
 capabilities for the YubiApp system.`,
 	}
 
-	// Add migration command
-	rootCmd.AddCommand(commands.InitMigrationCommand())
+	// Global --output, --quiet, --server and --otp flags
+	commands.InitOutputFlags(rootCmd)
+	commands.InitRemoteFlags(rootCmd)
+	commands.InitRemoteCommands(rootCmd)
+	commands.InitCompletionCommands(rootCmd)
+
+	// Add migration commands
+	rootCmd.AddCommand(commands.MigrateCmd)
+	rootCmd.AddCommand(commands.ArchiveCmd)
+	rootCmd.AddCommand(commands.BootstrapCmd)
+	rootCmd.AddCommand(commands.ApplyCmd)
 
 	// Add all command groups to root
 	rootCmd.AddCommand(commands.UserCmd)
@@ -65,9 +80,11 @@ capabilities for the YubiApp system.`,
 	rootCmd.AddCommand(commands.UserActivityCmd)
 	rootCmd.AddCommand(commands.AssignmentCmd)
 	rootCmd.AddCommand(commands.AuthenticationCmd)
+	rootCmd.AddCommand(commands.ShiftCmd)
+	rootCmd.AddCommand(commands.LeaveCmd)
+	rootCmd.AddCommand(commands.HolidayCmd)
+	rootCmd.AddCommand(commands.DemoCmd)
 
-	// Execute the root command
-	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
-	}
+	// Execute the root command; errors and exit codes follow --output
+	os.Exit(commands.Execute(rootCmd))
 } 
\ No newline at end of file
@@ -1,11 +1,13 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 	"log"
 
+	yubiapp "github.com/YubiApp"
 	"github.com/YubiApp/internal/config"
-	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/migrate"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -20,7 +22,8 @@ func InitDatabase(cfg config.DatabaseConfig) (*gorm.DB, error) {
 		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Name, cfg.SSLMode)
 
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Warn), // Reduce logging verbosity
+		Logger:         logger.Default.LogMode(logger.Warn), // Reduce logging verbosity
+		TranslateError: true,                                // Unique violations become gorm.ErrDuplicatedKey
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
@@ -31,27 +34,32 @@ func InitDatabase(cfg config.DatabaseConfig) (*gorm.DB, error) {
 	return db, nil
 }
 
-// RunMigrations runs database migrations
+// NewMigrator returns a migrator for the embedded migrations
+func NewMigrator(db *gorm.DB) (*migrate.Migrator, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	return migrate.New(sqlDB, yubiapp.Migrations, yubiapp.MigrationsDir)
+}
+
+// RunMigrations applies all pending database migrations
 func RunMigrations(db *gorm.DB) error {
 	log.Println("Running database migrations...")
-	
-	if err := DB.AutoMigrate(
-		&database.User{},
-		&database.Role{},
-		&database.Permission{},
-		&database.Resource{},
-		&database.Device{},
-		&database.Action{},
-		&database.AuthenticationLog{},
-		&database.DeviceRegistration{},
-		&database.Location{},
-		&database.UserStatus{},
-		&database.UserActivityHistory{},
-	); err != nil {
-		return fmt.Errorf("failed to auto-migrate database: %w", err)
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		return err
+	}
+	applied, err := migrator.Up(context.Background())
+	for _, migration := range applied {
+		log.Printf("Applied migration %d_%s", migration.Version, migration.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
 	}
 
-	log.Println("Database migrations completed successfully")
+	log.Printf("Database migrations completed successfully (%d applied)", len(applied))
 	return nil
 }
 
@@ -0,0 +1,249 @@
+// Command openapi checks openapi.yaml against the routes the API server
+// registers and the response types schemas are generated from, and fails when
+// they drift apart. With -write it appends stub operations for undocumented
+// routes, to be filled in by hand; with -print it writes the spec as served,
+// generated schemas included, as JSON.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/YubiApp/internal/server"
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// apiPrefix is the spec's server URL; routes outside it are not described
+const apiPrefix = "/api/v1"
+
+var httpMethods = map[string]bool{
+	"get": true, "put": true, "post": true, "delete": true,
+	"options": true, "head": true, "patch": true, "trace": true,
+}
+
+// operation is one method on one path, in OpenAPI path form
+type operation struct {
+	method  string
+	path    string
+	handler string
+}
+
+func (o operation) String() string {
+	return strings.ToUpper(o.method) + " " + o.path
+}
+
+func main() {
+	specPath := flag.String("spec", "openapi.yaml", "OpenAPI spec to check")
+	write := flag.Bool("write", false, "Append stub operations for undocumented routes")
+	printSpec := flag.Bool("print", false, "Print the spec as served, with generated schemas, as JSON")
+	flag.Parse()
+
+	gin.SetMode(gin.ReleaseMode)
+
+	data, err := os.ReadFile(*specPath)
+	if err != nil {
+		log.Fatalf("Failed to read spec: %v", err)
+	}
+
+	// Schemas generated from response types must not be written by hand, and
+	// every schema referenced must exist
+	document, err := server.OpenAPIDocument(data)
+	if err != nil {
+		fmt.Printf("schemas: %v\n", err)
+		os.Exit(1)
+	}
+	if *printSpec {
+		out, err := json.MarshalIndent(document, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to encode spec: %v", err)
+		}
+		fmt.Println(string(out))
+		return
+	}
+
+	var spec struct {
+		Paths map[string]map[string]yaml.Node `yaml:"paths"`
+	}
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		log.Fatalf("Failed to parse spec: %v", err)
+	}
+
+	documented := map[string]bool{}
+	for path, methods := range spec.Paths {
+		for method := range methods {
+			if httpMethods[method] {
+				documented[matchKey(method, path)] = true
+			}
+		}
+	}
+
+	var missing []operation
+	registered := map[string]bool{}
+	for _, route := range server.Routes() {
+		if !strings.HasPrefix(route.Path, apiPrefix+"/") {
+			continue
+		}
+		op := operation{
+			method:  strings.ToLower(route.Method),
+			path:    openAPIPath(strings.TrimPrefix(route.Path, apiPrefix)),
+			handler: route.Handler,
+		}
+		registered[matchKey(op.method, op.path)] = true
+		if !documented[matchKey(op.method, op.path)] {
+			missing = append(missing, op)
+		}
+	}
+
+	var stale []string
+	for path, methods := range spec.Paths {
+		for method := range methods {
+			if httpMethods[method] && !registered[matchKey(method, path)] {
+				stale = append(stale, strings.ToUpper(method)+" "+path)
+			}
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i].path+missing[i].method < missing[j].path+missing[j].method })
+	sort.Strings(stale)
+
+	for _, s := range stale {
+		fmt.Printf("documented but not routed: %s\n", s)
+	}
+
+	if *write && len(missing) > 0 {
+		if err := os.WriteFile(*specPath, appendStubs(data, missing), 0644); err != nil {
+			log.Fatalf("Failed to write spec: %v", err)
+		}
+		fmt.Printf("Added %d stub operations to %s\n", len(missing), *specPath)
+		missing = nil
+	}
+	for _, op := range missing {
+		fmt.Printf("routed but not documented: %s\n", op)
+	}
+
+	if len(missing) > 0 || len(stale) > 0 {
+		os.Exit(1)
+	}
+}
+
+var ginParam = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+var specParam = regexp.MustCompile(`\{[^}]*\}`)
+
+// openAPIPath converts gin path parameters (":id", "*path") to OpenAPI form
+func openAPIPath(path string) string {
+	return ginParam.ReplaceAllString(path, "{$1}")
+}
+
+// matchKey identifies an operation regardless of path parameter names
+func matchKey(method, path string) string {
+	return strings.ToLower(method) + " " + specParam.ReplaceAllString(path, "{}")
+}
+
+var pathLine = regexp.MustCompile(`^  (/\S*):\s*$`)
+
+// appendStubs adds a stub for each operation to the spec text. Methods on
+// documented paths go at the end of the path's block; new paths go at the end
+// of the file, which is the paths section. Existing formatting is kept.
+func appendStubs(data []byte, ops []operation) []byte {
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+
+	// Where each documented path's block ends, keyed without parameter names
+	pathEnds := map[string]int{}
+	current := ""
+	for i, line := range lines {
+		if m := pathLine.FindStringSubmatch(line); m != nil {
+			current = matchKey("", m[1])
+		} else if current != "" && strings.TrimSpace(line) != "" && !strings.HasPrefix(line, "   ") {
+			current = ""
+		}
+		if current != "" && strings.TrimSpace(line) != "" {
+			pathEnds[current] = i
+		}
+	}
+
+	inserts := map[int][]string{}
+	var newPaths []string
+	lastPath := ""
+	for _, op := range ops {
+		stub := operationStub(op)
+		if end, ok := pathEnds[matchKey("", op.path)]; ok {
+			inserts[end] = append(inserts[end], stub...)
+			continue
+		}
+		if op.path != lastPath {
+			newPaths = append(newPaths, "", "  "+op.path+":")
+			lastPath = op.path
+		}
+		newPaths = append(newPaths, stub...)
+	}
+
+	var out []string
+	for i, line := range lines {
+		out = append(out, line)
+		out = append(out, inserts[i]...)
+	}
+	out = append(out, newPaths...)
+	return []byte(strings.Join(out, "\n") + "\n")
+}
+
+// operationStub renders a minimal operation for a route, indented for a path
+func operationStub(op operation) []string {
+	tag := strings.SplitN(strings.TrimPrefix(op.path, "/"), "/", 2)[0]
+	stub := []string{
+		"    " + op.method + ":",
+		"      summary: " + summarize(op),
+		"      tags: [" + tag + "]",
+	}
+	if params := specParam.FindAllString(op.path, -1); len(params) > 0 {
+		stub = append(stub, "      parameters:")
+		for _, param := range params {
+			stub = append(stub,
+				"        - name: "+strings.Trim(param, "{}"),
+				"          in: path",
+				"          required: true",
+				"          schema: { type: string }",
+			)
+		}
+	}
+	return append(stub,
+		"      responses:",
+		"        '200':",
+		"          description: Success",
+	)
+}
+
+var handlerName = regexp.MustCompile(`\.handle([A-Za-z0-9]+)(\.func\d+)?$`)
+
+// summarize turns the route's handler name ("handleListUsers") into a summary
+// ("List users")
+func summarize(op operation) string {
+	m := handlerName.FindStringSubmatch(op.handler)
+	if m == nil {
+		return op.String()
+	}
+
+	var words []string
+	runes := []rune(m[1])
+	start := 0
+	for i := 1; i <= len(runes); i++ {
+		// Split before an upper-case letter that follows a lower-case one, or
+		// that starts a word after an acronym ("APISpec" -> "API", "Spec")
+		if i == len(runes) || (unicode.IsUpper(runes[i]) &&
+			(unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1])))) {
+			word := string(runes[start:i])
+			if len(words) > 0 && strings.ToUpper(word) != word {
+				word = strings.ToLower(word)
+			}
+			words = append(words, word)
+			start = i
+		}
+	}
+	return strings.Join(words, " ")
+}
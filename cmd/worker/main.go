@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os/signal"
+	"syscall"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/server"
+)
+
+func main() {
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	// Initialize and start the worker
+	worker := server.NewWorker(cfg)
+	workerErr := make(chan error, 1)
+	go func() {
+		workerErr <- worker.Start()
+	}()
+
+	// Run until SIGINT/SIGTERM asks the worker to stop
+	signals, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	select {
+	case err := <-workerErr:
+		if err != nil {
+			log.Fatalf("Failed to start worker: %v", err)
+		}
+		// No health endpoints; keep running jobs until signalled
+		<-signals.Done()
+	case <-signals.Done():
+	}
+	stop() // A second signal kills the process without waiting
+
+	log.Printf("Shutting down, waiting up to %s for running jobs", cfg.Server.ShutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := worker.Shutdown(ctx); err != nil {
+		log.Fatalf("Shutdown did not complete: %v", err)
+	}
+	log.Printf("Worker stopped")
+}
@@ -0,0 +1,29 @@
+-- Drops every table created by 0001_initial_schema, children first
+
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS user_roles;
+DROP TABLE IF EXISTS impersonations;
+DROP TABLE IF EXISTS password_reset_logs;
+DROP TABLE IF EXISTS password_histories;
+DROP TABLE IF EXISTS user_state_transitions;
+DROP TABLE IF EXISTS privacy_requests;
+DROP TABLE IF EXISTS kiosks;
+DROP TABLE IF EXISTS door_events;
+DROP TABLE IF EXISTS webhooks;
+DROP TABLE IF EXISTS attendance_notifications;
+DROP TABLE IF EXISTS attendance_policies;
+DROP TABLE IF EXISTS legal_holds;
+DROP TABLE IF EXISTS report_jobs;
+DROP TABLE IF EXISTS user_activity_history;
+DROP TABLE IF EXISTS user_statuses;
+DROP TABLE IF EXISTS locations;
+DROP TABLE IF EXISTS device_registrations;
+DROP TABLE IF EXISTS authentication_logs;
+DROP TABLE IF EXISTS devices;
+DROP TABLE IF EXISTS actions;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS resources;
+DROP TABLE IF EXISTS roles;
+DROP TABLE IF EXISTS users;
+
+DROP FUNCTION IF EXISTS update_updated_at_column();
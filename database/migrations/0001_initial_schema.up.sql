@@ -0,0 +1,455 @@
+-- Initial YubiApp schema, as previously kept in database/schema.sql
+
+-- Enable UUID extension
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+
+-- Users table
+CREATE TABLE users (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP WITH TIME ZONE,
+    email VARCHAR(255) UNIQUE NOT NULL,
+    username VARCHAR(255) UNIQUE NOT NULL,
+    password VARCHAR(255) NOT NULL,
+    first_name VARCHAR(255),
+    last_name VARCHAR(255),
+    active BOOLEAN DEFAULT TRUE,
+    unix_username VARCHAR(32),
+    state VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (state IN ('invited', 'active', 'suspended', 'leave', 'offboarded')),
+    state_changed_at TIMESTAMP WITH TIME ZONE,
+    password_changed_at TIMESTAMP WITH TIME ZONE,
+    failed_password_attempts INTEGER NOT NULL DEFAULT 0,
+    locked_until TIMESTAMP WITH TIME ZONE
+);
+
+-- Roles table
+CREATE TABLE roles (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    name VARCHAR(255) UNIQUE NOT NULL,
+    description TEXT,
+    active BOOLEAN DEFAULT TRUE
+);
+
+-- Resources table
+CREATE TABLE resources (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    name VARCHAR(255) UNIQUE NOT NULL CHECK (name NOT LIKE '%:%'),
+    type VARCHAR(50) NOT NULL CHECK (type IN ('server', 'service', 'database', 'application', 'door')),
+    location VARCHAR(255),
+    department VARCHAR(255),
+    active BOOLEAN DEFAULT TRUE
+);
+
+-- Permissions table
+CREATE TABLE permissions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    resource_id UUID NOT NULL REFERENCES resources(id) ON DELETE CASCADE,
+    action VARCHAR(255) NOT NULL,
+    effect VARCHAR(50) NOT NULL CHECK (effect IN ('allow', 'deny'))
+);
+
+-- Actions table
+CREATE TABLE actions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    name VARCHAR(255) UNIQUE NOT NULL,
+    activity_type VARCHAR(20) DEFAULT 'other' CHECK (activity_type IN ('user', 'system', 'automated', 'door', 'other')),
+    required_permissions JSONB DEFAULT '[]'::jsonb,
+    details JSONB DEFAULT '{}'::jsonb,
+    active BOOLEAN DEFAULT true,
+    allow_session_auth BOOLEAN DEFAULT false,
+    session_permission VARCHAR(255)
+);
+
+-- Devices table
+CREATE TABLE devices (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP WITH TIME ZONE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255),
+    type VARCHAR(50) NOT NULL CHECK (type IN ('yubikey', 'totp', 'sms', 'email')),
+    serial_number VARCHAR(255),
+    identifier VARCHAR(255) NOT NULL,
+    secret TEXT,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    verified_at TIMESTAMP WITH TIME ZONE,
+    active BOOLEAN DEFAULT TRUE,
+    properties JSONB,
+    last_otp_counter BIGINT DEFAULT 0
+);
+
+-- Authentication logs table
+CREATE TABLE authentication_logs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    user_id UUID REFERENCES users(id), -- NULL once anonymized by the retention purge
+    device_id UUID REFERENCES devices(id), -- NULL once the device has been purged
+    action_id UUID REFERENCES actions(id) ON DELETE SET NULL,
+    type VARCHAR(50) NOT NULL CHECK (type IN ('login', 'logout', 'refresh', 'mfa', 'action')),
+    success BOOLEAN NOT NULL,
+    ip_address VARCHAR(45),
+    user_agent TEXT,
+    otp VARCHAR(64),
+    timestamp TIMESTAMP WITH TIME ZONE,
+    details JSONB DEFAULT '{}'::jsonb,
+    request_id VARCHAR(128) -- X-Request-ID of the API request that logged it
+);
+
+-- Device registrations table
+CREATE TABLE device_registrations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    
+    registrar_user_id UUID NOT NULL REFERENCES users(id),
+    device_id UUID REFERENCES devices(id), -- NULL once the device has been purged
+    target_user_id UUID REFERENCES users(id),
+    
+    action_type VARCHAR(20) NOT NULL CHECK (action_type IN ('register', 'deregister')),
+    reason TEXT,
+    ip_address VARCHAR(45),
+    user_agent TEXT,
+    notes TEXT
+);
+
+-- Locations table
+CREATE TABLE locations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP WITH TIME ZONE,
+    name VARCHAR(255) UNIQUE NOT NULL,
+    description TEXT,
+    address TEXT,
+    type VARCHAR(20) DEFAULT 'office' CHECK (type IN ('office', 'home', 'event', 'other')),
+    active BOOLEAN DEFAULT TRUE,
+    latitude DOUBLE PRECISION CHECK (latitude BETWEEN -90 AND 90),
+    longitude DOUBLE PRECISION CHECK (longitude BETWEEN -180 AND 180),
+    radius_meters DOUBLE PRECISION CHECK (radius_meters > 0),
+    networks JSONB DEFAULT '[]'::jsonb
+);
+
+-- User statuses table
+CREATE TABLE user_statuses (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP WITH TIME ZONE,
+    name VARCHAR(255) UNIQUE NOT NULL,
+    description TEXT,
+    type VARCHAR(30) DEFAULT 'working' CHECK (type IN ('working', 'break', 'leave', 'travel', 'other')),
+    active BOOLEAN DEFAULT TRUE
+);
+
+-- User activity history table
+CREATE TABLE user_activity_history (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    action_id UUID NOT NULL REFERENCES actions(id) ON DELETE CASCADE,
+    from_datetime TIMESTAMP WITH TIME ZONE NOT NULL,
+    to_datetime TIMESTAMP WITH TIME ZONE,
+    location_id UUID REFERENCES locations(id) ON DELETE SET NULL,
+    status_id UUID REFERENCES user_statuses(id) ON DELETE SET NULL,
+    details JSONB DEFAULT '{}'::jsonb
+);
+
+-- Report jobs table (asynchronously generated reports)
+CREATE TABLE report_jobs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    requested_by_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    report_type VARCHAR(30) NOT NULL,
+    format VARCHAR(10) NOT NULL,
+    parameters JSONB DEFAULT '{}'::jsonb,
+    status VARCHAR(20) DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'completed', 'failed')),
+    error TEXT,
+    result BYTEA,
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Legal holds table (exempts a user and/or date range from retention purges and anonymization)
+CREATE TABLE legal_holds (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    user_id UUID REFERENCES users(id) ON DELETE RESTRICT, -- NULL applies to all users within the date range
+    from_datetime TIMESTAMP WITH TIME ZONE,
+    to_datetime TIMESTAMP WITH TIME ZONE,
+    reason TEXT NOT NULL,
+    placed_by_id UUID NOT NULL REFERENCES users(id),
+    released_at TIMESTAMP WITH TIME ZONE,
+    released_by_id UUID REFERENCES users(id),
+    release_reason TEXT
+);
+
+-- Attendance policies table (expected working hours per role and/or location)
+CREATE TABLE attendance_policies (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    name VARCHAR(255) UNIQUE NOT NULL,
+    description TEXT,
+    role_id UUID REFERENCES roles(id) ON DELETE CASCADE,
+    location_id UUID REFERENCES locations(id) ON DELETE CASCADE,
+    expected_daily_hours NUMERIC(5,2) NOT NULL,
+    work_days VARCHAR(50) DEFAULT 'mon,tue,wed,thu,fri',
+    start_time VARCHAR(5),
+    grace_minutes INTEGER DEFAULT 0,
+    timezone VARCHAR(64) DEFAULT 'UTC',
+    overtime_threshold_hours NUMERIC(5,2) DEFAULT 0,
+    undertime_threshold_hours NUMERIC(5,2) DEFAULT 0,
+    notify_webhook_url TEXT,
+    notify_emails TEXT,
+    active BOOLEAN DEFAULT true
+);
+
+-- Attendance notifications table (breaches that have already been notified)
+CREATE TABLE attendance_notifications (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    policy_id UUID NOT NULL REFERENCES attendance_policies(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    date VARCHAR(10) NOT NULL,
+    type VARCHAR(20) NOT NULL CHECK (type IN ('overtime', 'undertime', 'late')),
+    error TEXT,
+    UNIQUE(policy_id, user_id, date, type)
+);
+
+-- Webhooks table (external subscribers to published events)
+CREATE TABLE webhooks (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    name VARCHAR(255) UNIQUE NOT NULL,
+    url TEXT NOT NULL,
+    event_types JSONB DEFAULT '[]'::jsonb,
+    secret VARCHAR(255),
+    active BOOLEAN DEFAULT true,
+    last_delivery_at TIMESTAMP WITH TIME ZONE,
+    last_error TEXT
+);
+
+-- Door events table (unlock attempts on door resources)
+CREATE TABLE door_events (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    resource_id UUID NOT NULL REFERENCES resources(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    action_id UUID REFERENCES actions(id) ON DELETE SET NULL,
+    authentication_log_id UUID,
+    result VARCHAR(20) NOT NULL CHECK (result IN ('unlocked', 'failed')),
+    driver VARCHAR(20),
+    controller_ref VARCHAR(255),
+    error TEXT
+);
+
+-- Kiosks table (shared badge-in terminals bound to a location)
+CREATE TABLE kiosks (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    name VARCHAR(255) UNIQUE NOT NULL,
+    location_id UUID NOT NULL REFERENCES locations(id) ON DELETE CASCADE,
+    client_id VARCHAR(64) UNIQUE NOT NULL,
+    secret_hash VARCHAR(64) NOT NULL,
+    allowed_actions JSONB DEFAULT '[]'::jsonb,
+    active BOOLEAN DEFAULT true,
+    last_seen_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Privacy requests table (audit of GDPR exports and erasures)
+CREATE TABLE privacy_requests (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    type VARCHAR(20) NOT NULL CHECK (type IN ('export', 'erase')),
+    subject_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    requested_by_id UUID NOT NULL REFERENCES users(id),
+    reason TEXT,
+    status VARCHAR(20) NOT NULL CHECK (status IN ('completed', 'rejected', 'failed')),
+    error TEXT,
+    summary JSONB DEFAULT '{}'::jsonb,
+    ip_address VARCHAR(45),
+    user_agent TEXT
+);
+
+-- User state transitions table (account lifecycle history and scheduled changes)
+CREATE TABLE user_state_transitions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    from_state VARCHAR(20),
+    to_state VARCHAR(20) NOT NULL CHECK (to_state IN ('invited', 'active', 'suspended', 'leave', 'offboarded')),
+    reason TEXT NOT NULL,
+    effective_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'applied', 'cancelled')),
+    applied_at TIMESTAMP WITH TIME ZONE,
+    note TEXT,
+    requested_by_id UUID REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- Password history table (previous hashes, checked against password reuse)
+CREATE TABLE password_histories (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    hash VARCHAR(255) NOT NULL
+);
+
+-- Password reset log table (audit of self-service password resets)
+CREATE TABLE password_reset_logs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    identifier VARCHAR(255),
+    event VARCHAR(20) NOT NULL CHECK (event IN ('requested', 'rate_limited', 'completed', 'failed')),
+    reason TEXT,
+    ip_address VARCHAR(45),
+    user_agent TEXT,
+    request_id VARCHAR(128)
+);
+
+-- Impersonations table (audit of admin sessions acting as another user)
+CREATE TABLE impersonations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    session_id VARCHAR(255) UNIQUE NOT NULL,
+    actor_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    actor_device_id UUID,
+    subject_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason TEXT NOT NULL,
+    read_only BOOLEAN DEFAULT TRUE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    ended_at TIMESTAMP WITH TIME ZONE,
+    ended_by_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    ip_address VARCHAR(45),
+    user_agent TEXT
+);
+
+-- Junction tables for many-to-many relationships
+
+-- User-Role relationship
+CREATE TABLE user_roles (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role_id UUID NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, role_id)
+);
+
+-- Role-Permission relationship
+CREATE TABLE role_permissions (
+    role_id UUID NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    permission_id UUID NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+-- Create indexes for better performance
+CREATE INDEX idx_users_deleted_at ON users(deleted_at);
+CREATE INDEX idx_users_email ON users(email);
+CREATE INDEX idx_users_username ON users(username);
+CREATE INDEX idx_users_active ON users(active);
+
+CREATE INDEX idx_devices_deleted_at ON devices(deleted_at);
+CREATE INDEX idx_devices_user_id ON devices(user_id);
+CREATE INDEX idx_devices_type ON devices(type);
+CREATE INDEX idx_devices_identifier ON devices(identifier);
+CREATE INDEX idx_devices_active ON devices(active);
+
+CREATE INDEX idx_authentication_logs_user_id ON authentication_logs(user_id);
+CREATE INDEX idx_authentication_logs_device_id ON authentication_logs(device_id);
+CREATE INDEX idx_authentication_logs_action_id ON authentication_logs(action_id);
+CREATE INDEX idx_authentication_logs_created_at ON authentication_logs(created_at);
+CREATE INDEX idx_authentication_logs_type ON authentication_logs(type);
+CREATE INDEX idx_authentication_logs_success ON authentication_logs(success);
+CREATE INDEX idx_authentication_logs_request_id ON authentication_logs(request_id);
+
+CREATE INDEX idx_locations_deleted_at ON locations(deleted_at);
+CREATE INDEX idx_locations_name ON locations(name);
+CREATE INDEX idx_locations_type ON locations(type);
+CREATE INDEX idx_locations_active ON locations(active);
+
+CREATE INDEX idx_user_statuses_deleted_at ON user_statuses(deleted_at);
+CREATE INDEX idx_user_statuses_name ON user_statuses(name);
+CREATE INDEX idx_user_statuses_type ON user_statuses(type);
+CREATE INDEX idx_user_statuses_active ON user_statuses(active);
+
+CREATE INDEX idx_user_activity_history_user_id ON user_activity_history(user_id);
+CREATE INDEX idx_user_activity_history_action_id ON user_activity_history(action_id);
+CREATE INDEX idx_user_activity_history_from_datetime ON user_activity_history(from_datetime);
+CREATE INDEX idx_user_activity_history_to_datetime ON user_activity_history(to_datetime);
+CREATE INDEX idx_user_activity_history_location_id ON user_activity_history(location_id);
+CREATE INDEX idx_user_activity_history_status_id ON user_activity_history(status_id);
+CREATE INDEX idx_user_activity_history_user_from_datetime ON user_activity_history(user_id, from_datetime);
+
+CREATE INDEX idx_actions_name ON actions(name);
+
+CREATE INDEX idx_report_jobs_status ON report_jobs(status);
+
+CREATE INDEX idx_legal_holds_user_id ON legal_holds(user_id);
+CREATE INDEX idx_legal_holds_released_at ON legal_holds(released_at);
+
+CREATE INDEX idx_attendance_policies_role_id ON attendance_policies(role_id);
+CREATE INDEX idx_attendance_policies_location_id ON attendance_policies(location_id);
+CREATE INDEX idx_door_events_resource_id ON door_events(resource_id);
+CREATE INDEX idx_door_events_user_id ON door_events(user_id);
+CREATE INDEX idx_door_events_authentication_log_id ON door_events(authentication_log_id);
+
+CREATE INDEX idx_kiosks_location_id ON kiosks(location_id);
+
+CREATE INDEX idx_privacy_requests_subject_user_id ON privacy_requests(subject_user_id);
+
+CREATE INDEX idx_user_state_transitions_user_id ON user_state_transitions(user_id);
+CREATE INDEX idx_user_state_transitions_pending ON user_state_transitions(effective_at) WHERE status = 'pending';
+
+CREATE INDEX idx_password_histories_user_id ON password_histories(user_id);
+
+CREATE INDEX idx_password_reset_logs_user_id ON password_reset_logs(user_id);
+CREATE INDEX idx_password_reset_logs_created_at ON password_reset_logs(created_at);
+CREATE INDEX idx_password_reset_logs_request_id ON password_reset_logs(request_id);
+
+CREATE INDEX idx_impersonations_actor_id ON impersonations(actor_id);
+CREATE INDEX idx_impersonations_subject_user_id ON impersonations(subject_user_id);
+
+CREATE INDEX idx_user_roles_user_id ON user_roles(user_id);
+CREATE INDEX idx_user_roles_role_id ON user_roles(role_id);
+
+CREATE INDEX idx_role_permissions_role_id ON role_permissions(role_id);
+CREATE INDEX idx_role_permissions_permission_id ON role_permissions(permission_id);
+
+-- Create updated_at trigger function
+CREATE OR REPLACE FUNCTION update_updated_at_column()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = CURRENT_TIMESTAMP;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+-- Create triggers for updated_at
+CREATE TRIGGER update_users_updated_at BEFORE UPDATE ON users FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+CREATE TRIGGER update_roles_updated_at BEFORE UPDATE ON roles FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+CREATE TRIGGER update_permissions_updated_at BEFORE UPDATE ON permissions FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+CREATE TRIGGER update_actions_updated_at BEFORE UPDATE ON actions FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+CREATE TRIGGER update_devices_updated_at BEFORE UPDATE ON devices FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+CREATE TRIGGER update_locations_updated_at BEFORE UPDATE ON locations FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+CREATE TRIGGER update_user_statuses_updated_at BEFORE UPDATE ON user_statuses FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+CREATE TRIGGER update_user_activity_history_updated_at BEFORE UPDATE ON user_activity_history FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+CREATE TRIGGER update_report_jobs_updated_at BEFORE UPDATE ON report_jobs FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+CREATE TRIGGER update_legal_holds_updated_at BEFORE UPDATE ON legal_holds FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+CREATE TRIGGER update_attendance_policies_updated_at BEFORE UPDATE ON attendance_policies FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+CREATE TRIGGER update_webhooks_updated_at BEFORE UPDATE ON webhooks FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+CREATE TRIGGER update_kiosks_updated_at BEFORE UPDATE ON kiosks FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+CREATE TRIGGER update_user_state_transitions_updated_at BEFORE UPDATE ON user_state_transitions FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
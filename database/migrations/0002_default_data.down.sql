@@ -0,0 +1,29 @@
+-- Removes the rows added by 0002_default_data. Rows that have since been
+-- referenced elsewhere (e.g. actions with activity history) are removed with
+-- their dependents by the cascading foreign keys.
+
+DELETE FROM role_permissions
+WHERE role_id IN (SELECT id FROM roles WHERE name IN ('admin', 'user'));
+
+DELETE FROM permissions
+WHERE resource_id IN (SELECT id FROM resources WHERE name IN ('user', 'device', 'admin', 'yubiapp'));
+
+DELETE FROM resources WHERE name IN ('user', 'device', 'admin', 'yubiapp');
+
+DELETE FROM roles WHERE name IN ('admin', 'user');
+
+DELETE FROM actions WHERE name IN (
+    'ssh-login', 'app-install', 'app-uninstall', 'permission-grant', 'permission-revoke',
+    'user-signin', 'user-signout', 'status-change', 'location-change',
+    'break-start', 'break-end', 'work-start', 'work-end', 'meeting-start', 'meeting-end'
+);
+
+DELETE FROM user_statuses WHERE name IN (
+    'Signed In', 'On Break', 'In Meeting', 'Out of Office', 'Traveling',
+    'Lunch Break', 'Training', 'Sick Leave', 'Vacation'
+);
+
+DELETE FROM locations WHERE name IN (
+    'Main Office', 'Home Office', 'Client Site', 'Conference Center', 'Airport Lounge',
+    'Hotel Room', 'Coffee Shop', 'Co-working Space'
+);
@@ -0,0 +1,83 @@
+-- Default roles, resources, permissions, actions, user statuses and locations
+-- Default admin role
+INSERT INTO roles (id, name, description) VALUES 
+    (uuid_generate_v4(), 'admin', 'Administrator with full access'),
+    (uuid_generate_v4(), 'user', 'Standard user');
+
+-- Default resources
+INSERT INTO resources (id, name, type, location, department) VALUES 
+    (uuid_generate_v4(), 'user', 'application', 'internal', 'IT'),
+    (uuid_generate_v4(), 'device', 'application', 'internal', 'IT'),
+    (uuid_generate_v4(), 'admin', 'application', 'internal', 'IT'),
+    (uuid_generate_v4(), 'yubiapp', 'application', 'internal', 'IT');
+
+-- Default permissions
+INSERT INTO permissions (id, resource_id, action, effect) 
+SELECT uuid_generate_v4(), r.id, p.action, p.effect
+FROM resources r
+CROSS JOIN (VALUES ('read', 'allow'), ('write', 'allow')) AS p(action, effect)
+WHERE r.name IN ('user', 'device', 'admin');
+
+-- Add yubiapp-specific permissions
+INSERT INTO permissions (id, resource_id, action, effect)
+SELECT uuid_generate_v4(), r.id, p.action, p.effect
+FROM resources r
+CROSS JOIN (VALUES ('register-other', 'allow'), ('deregister-other', 'allow')) AS p(action, effect)
+WHERE r.name = 'yubiapp';
+
+-- Default actions
+INSERT INTO actions (id, name, activity_type, required_permissions, details) VALUES 
+    (uuid_generate_v4(), 'ssh-login', 'user', '["ssh:login"]', '{}'),
+    (uuid_generate_v4(), 'app-install', 'system', '["app:install"]', '{}'),
+    (uuid_generate_v4(), 'app-uninstall', 'system', '["app:uninstall"]', '{}'),
+    (uuid_generate_v4(), 'permission-grant', 'system', '["permission:grant"]', '{}'),
+    (uuid_generate_v4(), 'permission-revoke', 'system', '["permission:revoke"]', '{}'),
+    (uuid_generate_v4(), 'user-signin', 'user', '[]', '{}'),
+    (uuid_generate_v4(), 'user-signout', 'user', '[]', '{}'),
+    (uuid_generate_v4(), 'status-change', 'system', '[]', '{}'),
+    (uuid_generate_v4(), 'location-change', 'system', '[]', '{}'),
+    (uuid_generate_v4(), 'break-start', 'system', '[]', '{}'),
+    (uuid_generate_v4(), 'break-end', 'system', '[]', '{}'),
+    (uuid_generate_v4(), 'work-start', 'system', '[]', '{}'),
+    (uuid_generate_v4(), 'work-end', 'system', '[]', '{}'),
+    (uuid_generate_v4(), 'meeting-start', 'system', '[]', '{}'),
+    (uuid_generate_v4(), 'meeting-end', 'system', '[]', '{}');
+
+-- Default user statuses
+INSERT INTO user_statuses (id, name, description, type, active) VALUES 
+    (uuid_generate_v4(), 'Signed In', 'User is signed in and available', 'working', true),
+    (uuid_generate_v4(), 'On Break', 'User is taking a break', 'break', true),
+    (uuid_generate_v4(), 'In Meeting', 'User is in a meeting', 'working', true),
+    (uuid_generate_v4(), 'Out of Office', 'User is out of office', 'leave', true),
+    (uuid_generate_v4(), 'Traveling', 'User is traveling for work', 'travel', true),
+    (uuid_generate_v4(), 'Lunch Break', 'User is on lunch break', 'break', true),
+    (uuid_generate_v4(), 'Training', 'User is in training', 'working', true),
+    (uuid_generate_v4(), 'Sick Leave', 'User is on sick leave', 'leave', true),
+    (uuid_generate_v4(), 'Vacation', 'User is on vacation', 'leave', true);
+
+-- Default locations
+INSERT INTO locations (id, name, description, address, type, active) VALUES 
+    (uuid_generate_v4(), 'Main Office', 'Primary office location', '123 Main Street, City, State 12345', 'office', true),
+    (uuid_generate_v4(), 'Home Office', 'Working from home', 'Various home locations', 'home', true),
+    (uuid_generate_v4(), 'Client Site', 'Working at client location', 'Client office locations', 'other', true),
+    (uuid_generate_v4(), 'Conference Center', 'Conference and event location', '456 Conference Ave, City, State 12345', 'event', true),
+    (uuid_generate_v4(), 'Airport Lounge', 'Working from airport', 'Various airport lounges', 'other', true),
+    (uuid_generate_v4(), 'Hotel Room', 'Working from hotel', 'Various hotel locations', 'other', true),
+    (uuid_generate_v4(), 'Coffee Shop', 'Working from coffee shop', 'Various coffee shops', 'other', true),
+    (uuid_generate_v4(), 'Co-working Space', 'Shared office space', '789 Co-working Blvd, City, State 12345', 'office', true);
+
+-- Assign permissions to roles
+-- Admin gets all permissions
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id 
+FROM roles r, permissions p 
+WHERE r.name = 'admin';
+
+-- User gets basic permissions
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id 
+FROM roles r, permissions p, resources res
+WHERE r.name = 'user' 
+AND p.resource_id = res.id
+AND res.name IN ('user', 'device') 
+AND p.action = 'read';
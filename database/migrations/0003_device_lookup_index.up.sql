@@ -0,0 +1,4 @@
+-- Every device authentication looks its device up by type and identifier;
+-- one composite index serves that instead of intersecting the two single-column ones.
+
+CREATE INDEX idx_devices_type_identifier ON devices(type, identifier) WHERE deleted_at IS NULL;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_authentication_logs_failed_created_at;
+DROP TABLE IF EXISTS alerts;
+DROP TABLE IF EXISTS alert_rule_channels;
+DROP TABLE IF EXISTS alert_rules;
+DROP TABLE IF EXISTS alert_channels;
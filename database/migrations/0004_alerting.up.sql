@@ -0,0 +1,66 @@
+-- Failed-authentication alerting: delivery channels, rules evaluated over
+-- authentication_logs by the API server, and the alerts they raise
+
+CREATE TABLE alert_channels (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    name VARCHAR(255) UNIQUE NOT NULL,
+    type VARCHAR(20) NOT NULL CHECK (type IN ('email', 'webhook', 'slack')),
+    target TEXT NOT NULL,
+    secret VARCHAR(255),
+    active BOOLEAN DEFAULT true,
+    last_delivery_at TIMESTAMP WITH TIME ZONE,
+    last_error TEXT
+);
+
+CREATE TABLE alert_rules (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    name VARCHAR(255) UNIQUE NOT NULL,
+    description TEXT,
+    condition VARCHAR(30) NOT NULL CHECK (condition IN ('failed_auth', 'replayed_otp')),
+    log_type VARCHAR(20),
+    group_by VARCHAR(20) DEFAULT 'user' CHECK (group_by IN ('user', 'device', 'ip_address')),
+    threshold INTEGER DEFAULT 0 CHECK (threshold >= 0),
+    window_minutes INTEGER DEFAULT 10 CHECK (window_minutes > 0),
+    severity VARCHAR(20) DEFAULT 'warning' CHECK (severity IN ('info', 'warning', 'critical')),
+    active BOOLEAN DEFAULT true
+);
+
+-- Alert rule-channel relationship
+CREATE TABLE alert_rule_channels (
+    alert_rule_id UUID NOT NULL REFERENCES alert_rules(id) ON DELETE CASCADE,
+    alert_channel_id UUID NOT NULL REFERENCES alert_channels(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (alert_rule_id, alert_channel_id)
+);
+
+CREATE TABLE alerts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    rule_id UUID NOT NULL REFERENCES alert_rules(id) ON DELETE CASCADE,
+    subject TEXT NOT NULL,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    device_id UUID,
+    ip_address VARCHAR(45),
+    severity VARCHAR(20) NOT NULL,
+    count INTEGER DEFAULT 0,
+    first_seen_at TIMESTAMP WITH TIME ZONE,
+    last_seen_at TIMESTAMP WITH TIME ZONE,
+    status VARCHAR(20) DEFAULT 'open' CHECK (status IN ('open', 'acknowledged', 'resolved')),
+    acknowledged_at TIMESTAMP WITH TIME ZONE,
+    acknowledged_by_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    resolved_by_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    resolution_note TEXT,
+    delivery_error TEXT
+);
+
+CREATE INDEX idx_alerts_rule_subject ON alerts(rule_id, subject, created_at);
+CREATE INDEX idx_alerts_status ON alerts(status);
+
+-- Rules only ever look at recent failures
+CREATE INDEX idx_authentication_logs_failed_created_at ON authentication_logs(created_at) WHERE success = false;
@@ -0,0 +1,16 @@
+DELETE FROM device_registrations WHERE action_type = 'state_change';
+ALTER TABLE device_registrations DROP COLUMN IF EXISTS state;
+ALTER TABLE device_registrations DROP CONSTRAINT device_registrations_action_type_check;
+ALTER TABLE device_registrations
+    ADD CONSTRAINT device_registrations_action_type_check CHECK (action_type IN ('register', 'deregister'));
+
+DROP INDEX IF EXISTS idx_devices_state;
+DROP INDEX IF EXISTS idx_devices_asset_tag;
+ALTER TABLE devices
+    DROP COLUMN IF EXISTS state_changed_at,
+    DROP COLUMN IF EXISTS state,
+    DROP COLUMN IF EXISTS purchased_at,
+    DROP COLUMN IF EXISTS purchase_order,
+    DROP COLUMN IF EXISTS asset_tag,
+    DROP COLUMN IF EXISTS form_factor,
+    DROP COLUMN IF EXISTS firmware_version;
@@ -0,0 +1,20 @@
+-- Device inventory: hardware details and a lifecycle state, so tokens can be
+-- tracked from stock through issue to loss or retirement
+
+ALTER TABLE devices
+    ADD COLUMN firmware_version VARCHAR(50),
+    ADD COLUMN form_factor VARCHAR(50),
+    ADD COLUMN asset_tag VARCHAR(100),
+    ADD COLUMN purchase_order VARCHAR(100),
+    ADD COLUMN purchased_at DATE,
+    ADD COLUMN state VARCHAR(20) DEFAULT 'assigned' CHECK (state IN ('in_stock', 'assigned', 'lost', 'retired')),
+    ADD COLUMN state_changed_at TIMESTAMP WITH TIME ZONE;
+
+CREATE UNIQUE INDEX idx_devices_asset_tag ON devices(asset_tag) WHERE asset_tag <> '' AND deleted_at IS NULL;
+CREATE INDEX idx_devices_state ON devices(state) WHERE deleted_at IS NULL;
+
+-- State changes are recorded in the device history next to registrations
+ALTER TABLE device_registrations DROP CONSTRAINT device_registrations_action_type_check;
+ALTER TABLE device_registrations
+    ADD CONSTRAINT device_registrations_action_type_check CHECK (action_type IN ('register', 'deregister', 'state_change')),
+    ADD COLUMN state VARCHAR(20);
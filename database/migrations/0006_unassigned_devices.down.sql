@@ -0,0 +1,4 @@
+UPDATE device_registrations SET device_id = NULL
+    WHERE device_id IN (SELECT id FROM devices WHERE user_id IS NULL);
+DELETE FROM devices WHERE user_id IS NULL;
+ALTER TABLE devices ALTER COLUMN user_id SET NOT NULL;
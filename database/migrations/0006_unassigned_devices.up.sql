@@ -0,0 +1,4 @@
+-- Devices imported from an inventory file wait in stock before they are
+-- registered to anyone, so a device no longer needs an owner
+
+ALTER TABLE devices ALTER COLUMN user_id DROP NOT NULL;
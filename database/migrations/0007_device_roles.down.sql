@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_devices_user_role;
+ALTER TABLE devices DROP COLUMN IF EXISTS role;
@@ -0,0 +1,14 @@
+-- Devices are a user's primary device or a backup. Each user's oldest active
+-- device becomes primary and the rest backups.
+
+ALTER TABLE devices ADD COLUMN role VARCHAR(20) DEFAULT 'primary' CHECK (role IN ('primary', 'backup'));
+
+UPDATE devices SET role = 'backup'
+FROM (
+    SELECT id, row_number() OVER (PARTITION BY user_id ORDER BY created_at, id) AS position
+    FROM devices
+    WHERE user_id IS NOT NULL AND active AND deleted_at IS NULL
+) ranked
+WHERE devices.id = ranked.id AND ranked.position > 1;
+
+CREATE INDEX idx_devices_user_role ON devices(user_id, role) WHERE active AND deleted_at IS NULL;
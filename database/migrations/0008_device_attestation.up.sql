@@ -0,0 +1,4 @@
+-- YubiKey attestation: when a key's serial number, firmware version and form
+-- factor were last taken from a verified attestation certificate
+
+ALTER TABLE devices ADD COLUMN attested_at TIMESTAMP WITH TIME ZONE;
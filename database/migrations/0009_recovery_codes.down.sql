@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS security_incidents;
+DROP TABLE IF EXISTS recovery_codes;
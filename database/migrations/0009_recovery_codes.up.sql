@@ -0,0 +1,33 @@
+-- Single-use recovery codes for users who lost their device, and the security
+-- incidents their use opens for an admin to resolve
+
+CREATE TABLE recovery_codes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL UNIQUE,
+    used_at TIMESTAMP WITH TIME ZONE,
+    used_ip VARCHAR(45)
+);
+
+CREATE INDEX idx_recovery_codes_user_id ON recovery_codes(user_id);
+
+CREATE TABLE security_incidents (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(50) NOT NULL,
+    details TEXT,
+    session_id VARCHAR(64),
+    ip_address VARCHAR(45),
+    user_agent TEXT,
+    status VARCHAR(20) DEFAULT 'open' CHECK (status IN ('open', 'resolved')),
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    resolved_by_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    replacement_device_id UUID REFERENCES devices(id) ON DELETE SET NULL,
+    resolution_note TEXT
+);
+
+CREATE INDEX idx_security_incidents_user_id ON security_incidents(user_id);
+CREATE INDEX idx_security_incidents_status ON security_incidents(status);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS hr_notification_opt_outs;
+DROP TABLE IF EXISTS hr_notifications;
+DROP TABLE IF EXISTS hr_notification_rules;
@@ -0,0 +1,49 @@
+-- HR notification rules, the log of notifications they send and users'
+-- opt-outs from them
+
+CREATE TABLE hr_notification_rules (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    name VARCHAR(255) UNIQUE NOT NULL,
+    description TEXT,
+    trigger_type VARCHAR(20) NOT NULL CHECK (trigger_type IN ('action', 'status')),
+    trigger_name VARCHAR(255) NOT NULL,
+    channel VARCHAR(20) NOT NULL CHECK (channel IN ('email', 'webhook')),
+    target TEXT NOT NULL,
+    secret VARCHAR(255),
+    subject_template TEXT,
+    body_template TEXT,
+    allow_opt_out BOOLEAN DEFAULT false,
+    active BOOLEAN DEFAULT true
+);
+
+CREATE TABLE hr_notifications (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    rule_id UUID NOT NULL REFERENCES hr_notification_rules(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    trigger_type VARCHAR(20),
+    trigger_name VARCHAR(255),
+    channel VARCHAR(20),
+    target TEXT,
+    subject TEXT,
+    body TEXT,
+    status VARCHAR(20) DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'failed', 'opted_out')),
+    attempts INTEGER DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMP WITH TIME ZONE,
+    sent_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_hr_notifications_rule_id ON hr_notifications(rule_id);
+CREATE INDEX idx_hr_notifications_user_id ON hr_notifications(user_id);
+CREATE INDEX idx_hr_notifications_status ON hr_notifications(status);
+
+CREATE TABLE hr_notification_opt_outs (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    rule_id UUID NOT NULL REFERENCES hr_notification_rules(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, rule_id)
+);
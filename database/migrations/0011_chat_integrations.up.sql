@@ -0,0 +1,31 @@
+-- Slack workspaces and Teams tenants that action statuses are pushed to, and
+-- the links between users and their chat accounts
+
+CREATE TABLE chat_workspaces (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    name VARCHAR(255) UNIQUE NOT NULL,
+    provider VARCHAR(10) NOT NULL CHECK (provider IN ('slack', 'teams')),
+    external_id VARCHAR(100) UNIQUE NOT NULL,
+    client_id VARCHAR(255),
+    client_secret VARCHAR(255),
+    signing_secret VARCHAR(255),
+    status_mappings JSONB DEFAULT '{}'::jsonb,
+    active BOOLEAN DEFAULT true
+);
+
+CREATE TABLE chat_user_links (
+    workspace_id UUID NOT NULL REFERENCES chat_workspaces(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    external_user_id VARCHAR(100) NOT NULL,
+    access_token TEXT,
+    last_status_at TIMESTAMP WITH TIME ZONE,
+    last_error TEXT,
+    PRIMARY KEY (workspace_id, user_id),
+    UNIQUE (workspace_id, external_user_id)
+);
+
+CREATE INDEX idx_chat_user_links_user_id ON chat_user_links(user_id);
@@ -0,0 +1,25 @@
+-- Performances of co-signed actions waiting for a second user's approval
+
+CREATE TABLE action_approvals (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    action_id UUID NOT NULL REFERENCES actions(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_id UUID,
+    request_body JSONB DEFAULT '{}'::jsonb,
+    details JSONB DEFAULT '{}'::jsonb,
+    ip_address VARCHAR(45),
+    user_agent TEXT,
+    request_id VARCHAR(128),
+    status VARCHAR(20) DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected', 'expired')),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    approver_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    approver_device_id UUID REFERENCES devices(id) ON DELETE SET NULL,
+    decided_at TIMESTAMP WITH TIME ZONE,
+    note TEXT
+);
+
+CREATE INDEX idx_action_approvals_action_id ON action_approvals(action_id);
+CREATE INDEX idx_action_approvals_user_id ON action_approvals(user_id);
+CREATE INDEX idx_action_approvals_status ON action_approvals(status);
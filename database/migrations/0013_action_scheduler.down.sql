@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS activity_rollups;
+DROP TABLE IF EXISTS action_runs;
@@ -0,0 +1,37 @@
+-- Run history of automated actions run on their cron schedules or by hand,
+-- and the daily activity rollups the activity_rollup task writes
+
+CREATE TABLE action_runs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    action_id UUID NOT NULL REFERENCES actions(id) ON DELETE CASCADE,
+    trigger VARCHAR(20) NOT NULL CHECK (trigger IN ('schedule', 'manual')),
+    triggered_by_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    scheduled_for TIMESTAMP WITH TIME ZONE,
+    status VARCHAR(20) DEFAULT 'running' CHECK (status IN ('running', 'succeeded', 'failed', 'skipped')),
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    finished_at TIMESTAMP WITH TIME ZONE,
+    result TEXT,
+    error TEXT,
+    side_effects JSONB DEFAULT '[]'::jsonb,
+    -- Each scheduled time runs once, however many servers check the schedule
+    UNIQUE (action_id, scheduled_for)
+);
+
+CREATE INDEX idx_action_runs_action_id ON action_runs(action_id);
+CREATE INDEX idx_action_runs_status ON action_runs(status);
+-- At most one run of an action at a time
+CREATE UNIQUE INDEX idx_action_runs_one_running ON action_runs(action_id) WHERE status = 'running';
+
+CREATE TABLE activity_rollups (
+    day DATE NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    total_hours DOUBLE PRECISION DEFAULT 0,
+    hours JSONB DEFAULT '{}'::jsonb,
+    sign_ins INTEGER DEFAULT 0,
+    sign_outs INTEGER DEFAULT 0,
+    PRIMARY KEY (day, user_id)
+);
+
+CREATE INDEX idx_activity_rollups_user_id ON activity_rollups(user_id);
@@ -0,0 +1,11 @@
+-- Sessions for the postgres session store (auth.session_store: postgres).
+-- Expired rows are deleted by the session cleanup job.
+
+CREATE TABLE session_records (
+    id VARCHAR(64) PRIMARY KEY,
+    data JSONB NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_session_records_expires_at ON session_records(expires_at);
@@ -0,0 +1,6 @@
+ALTER TABLE user_statuses DROP COLUMN IF EXISTS version;
+ALTER TABLE locations DROP COLUMN IF EXISTS version;
+ALTER TABLE devices DROP COLUMN IF EXISTS version;
+ALTER TABLE actions DROP COLUMN IF EXISTS version;
+ALTER TABLE roles DROP COLUMN IF EXISTS version;
+ALTER TABLE users DROP COLUMN IF EXISTS version;
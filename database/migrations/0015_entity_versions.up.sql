@@ -0,0 +1,9 @@
+-- Optimistic locking: every update through the API bumps the version, and
+-- updates that name an older version are rejected with 409
+
+ALTER TABLE users ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE roles ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE actions ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE devices ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE locations ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE user_statuses ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,4 @@
+-- Duplicates soft-deleted by the up migration stay deleted, and unassigned
+-- devices keep a NULL user_id
+DROP INDEX IF EXISTS idx_devices_type_identifier;
+CREATE INDEX idx_devices_type_identifier ON devices(type, identifier) WHERE deleted_at IS NULL;
@@ -0,0 +1,29 @@
+-- Devices are unique by type and identifier, so registering the same device
+-- twice at once cannot create two rows, and an unassigned device has a NULL
+-- user_id rather than the nil UUID.
+
+UPDATE devices SET user_id = NULL WHERE user_id = '00000000-0000-0000-0000-000000000000';
+
+-- Owners that no longer exist leave their devices unassigned and inactive
+UPDATE devices SET user_id = NULL, active = FALSE
+WHERE user_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM users WHERE users.id = devices.user_id);
+
+ALTER TABLE devices DROP CONSTRAINT IF EXISTS devices_user_id_fkey;
+ALTER TABLE devices
+    ADD CONSTRAINT devices_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+-- Of duplicate devices, keep the one that is registered, then active, then
+-- most recently used, and soft-delete the rest
+UPDATE devices SET deleted_at = CURRENT_TIMESTAMP, active = FALSE
+FROM (
+    SELECT id, row_number() OVER (
+        PARTITION BY type, identifier
+        ORDER BY user_id IS NULL, active DESC, last_used_at DESC NULLS LAST, created_at, id
+    ) AS position
+    FROM devices
+    WHERE deleted_at IS NULL
+) ranked
+WHERE devices.id = ranked.id AND ranked.position > 1;
+
+DROP INDEX IF EXISTS idx_devices_type_identifier;
+CREATE UNIQUE INDEX idx_devices_type_identifier ON devices(type, identifier) WHERE deleted_at IS NULL;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_users_attributes;
+ALTER TABLE users DROP COLUMN IF EXISTS attributes;
@@ -0,0 +1,5 @@
+-- Custom profile attributes, declared in the users.attributes config
+ALTER TABLE users ADD COLUMN attributes JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+-- GET /users?attr.<name>=<value> filters with attributes @> '{"<name>": <value>}'
+CREATE INDEX idx_users_attributes ON users USING GIN (attributes jsonb_path_ops);
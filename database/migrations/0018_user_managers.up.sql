@@ -0,0 +1,5 @@
+-- Each user may report to one manager; a manager's deletion leaves their reports unassigned
+ALTER TABLE users ADD COLUMN manager_id UUID REFERENCES users(id) ON DELETE SET NULL;
+
+-- GET /users/:id/reports and manager access checks look users up by manager
+CREATE INDEX idx_users_manager_id ON users (manager_id);
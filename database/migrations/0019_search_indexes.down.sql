@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_actions_name_trgm;
+DROP INDEX IF EXISTS idx_roles_name_trgm;
+DROP INDEX IF EXISTS idx_devices_serial_number_trgm;
+DROP INDEX IF EXISTS idx_devices_identifier_trgm;
+DROP INDEX IF EXISTS idx_users_full_name_tsv;
+DROP INDEX IF EXISTS idx_users_full_name_trgm;
+DROP INDEX IF EXISTS idx_users_email_trgm;
+DROP INDEX IF EXISTS idx_users_username_trgm;
+-- pg_trgm is left installed; other objects may depend on it
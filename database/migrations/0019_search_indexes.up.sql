@@ -0,0 +1,14 @@
+-- GET /search matches substrings with ILIKE and ranks by similarity, both
+-- served by trigram indexes; full names also match word by word
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX idx_users_username_trgm ON users USING GIN (username gin_trgm_ops);
+CREATE INDEX idx_users_email_trgm ON users USING GIN (email gin_trgm_ops);
+CREATE INDEX idx_users_full_name_trgm ON users USING GIN ((first_name || ' ' || last_name) gin_trgm_ops);
+CREATE INDEX idx_users_full_name_tsv ON users USING GIN (to_tsvector('simple', first_name || ' ' || last_name));
+
+CREATE INDEX idx_devices_identifier_trgm ON devices USING GIN (identifier gin_trgm_ops);
+CREATE INDEX idx_devices_serial_number_trgm ON devices USING GIN (serial_number gin_trgm_ops);
+
+CREATE INDEX idx_roles_name_trgm ON roles USING GIN (name gin_trgm_ops);
+CREATE INDEX idx_actions_name_trgm ON actions USING GIN (name gin_trgm_ops);
@@ -0,0 +1,2 @@
+-- Preferred language for error messages and emails; empty follows Accept-Language
+ALTER TABLE users ADD COLUMN locale VARCHAR(35) NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+ALTER TABLE locations DROP COLUMN IF EXISTS timezone;
+ALTER TABLE users DROP COLUMN IF EXISTS timezone;
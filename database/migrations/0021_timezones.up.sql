@@ -0,0 +1,4 @@
+-- IANA timezones; summaries and timesheets count a user's days in theirs, and
+-- activity at a location is shown in the location's. Empty is UTC.
+ALTER TABLE users ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE locations ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT '';
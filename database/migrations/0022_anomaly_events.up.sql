@@ -0,0 +1,24 @@
+-- Anomalies the background analyzer flags in sign-ins and activity: logins at
+-- unusual hours, forgotten sign-outs and logins from distant networks
+CREATE TABLE anomaly_events (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    type VARCHAR(30) NOT NULL CHECK (type IN ('unusual_hour', 'open_activity', 'distant_ips')),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    ip_address VARCHAR(45),
+    details TEXT,
+    auth_log_id UUID,
+    activity_id UUID,
+    occurred_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    dedupe_key VARCHAR(255) NOT NULL UNIQUE,
+    status VARCHAR(20) DEFAULT 'open' CHECK (status IN ('open', 'acknowledged', 'resolved')),
+    acknowledged_at TIMESTAMP WITH TIME ZONE,
+    acknowledged_by_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    resolved_by_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    resolution_note TEXT
+);
+
+CREATE INDEX idx_anomaly_events_status ON anomaly_events(status);
+CREATE INDEX idx_anomaly_events_user_type ON anomaly_events(user_id, type, occurred_at);
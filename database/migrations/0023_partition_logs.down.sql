@@ -0,0 +1,50 @@
+-- Rebuild authentication_logs and user_activity_history as plain tables
+ALTER TABLE authentication_logs RENAME TO authentication_logs_partitioned;
+ALTER TABLE user_activity_history RENAME TO user_activity_history_partitioned;
+
+CREATE TABLE authentication_logs (
+    LIKE authentication_logs_partitioned INCLUDING DEFAULTS INCLUDING CONSTRAINTS
+);
+ALTER TABLE authentication_logs ALTER COLUMN created_at DROP NOT NULL;
+
+CREATE TABLE user_activity_history (
+    LIKE user_activity_history_partitioned INCLUDING DEFAULTS INCLUDING CONSTRAINTS
+);
+
+INSERT INTO authentication_logs SELECT * FROM authentication_logs_partitioned;
+INSERT INTO user_activity_history SELECT * FROM user_activity_history_partitioned;
+
+-- Drops the partitions with their parents
+DROP TABLE authentication_logs_partitioned;
+DROP TABLE user_activity_history_partitioned;
+
+ALTER TABLE authentication_logs ADD PRIMARY KEY (id);
+ALTER TABLE user_activity_history ADD PRIMARY KEY (id);
+
+ALTER TABLE authentication_logs ADD FOREIGN KEY (user_id) REFERENCES users(id);
+ALTER TABLE authentication_logs ADD FOREIGN KEY (device_id) REFERENCES devices(id);
+ALTER TABLE authentication_logs ADD FOREIGN KEY (action_id) REFERENCES actions(id) ON DELETE SET NULL;
+
+ALTER TABLE user_activity_history ADD FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE user_activity_history ADD FOREIGN KEY (action_id) REFERENCES actions(id) ON DELETE CASCADE;
+ALTER TABLE user_activity_history ADD FOREIGN KEY (location_id) REFERENCES locations(id) ON DELETE SET NULL;
+ALTER TABLE user_activity_history ADD FOREIGN KEY (status_id) REFERENCES user_statuses(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_authentication_logs_user_id ON authentication_logs(user_id);
+CREATE INDEX idx_authentication_logs_device_id ON authentication_logs(device_id);
+CREATE INDEX idx_authentication_logs_action_id ON authentication_logs(action_id);
+CREATE INDEX idx_authentication_logs_created_at ON authentication_logs(created_at);
+CREATE INDEX idx_authentication_logs_type ON authentication_logs(type);
+CREATE INDEX idx_authentication_logs_success ON authentication_logs(success);
+CREATE INDEX idx_authentication_logs_request_id ON authentication_logs(request_id);
+CREATE INDEX idx_authentication_logs_failed_created_at ON authentication_logs(created_at) WHERE success = false;
+
+CREATE INDEX idx_user_activity_history_user_id ON user_activity_history(user_id);
+CREATE INDEX idx_user_activity_history_action_id ON user_activity_history(action_id);
+CREATE INDEX idx_user_activity_history_from_datetime ON user_activity_history(from_datetime);
+CREATE INDEX idx_user_activity_history_to_datetime ON user_activity_history(to_datetime);
+CREATE INDEX idx_user_activity_history_location_id ON user_activity_history(location_id);
+CREATE INDEX idx_user_activity_history_status_id ON user_activity_history(status_id);
+CREATE INDEX idx_user_activity_history_user_from_datetime ON user_activity_history(user_id, from_datetime);
+
+CREATE TRIGGER update_user_activity_history_updated_at BEFORE UPDATE ON user_activity_history FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
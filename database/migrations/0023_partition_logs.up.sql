@@ -0,0 +1,87 @@
+-- Partition authentication_logs by created_at and user_activity_history by
+-- from_datetime into monthly ranges (PostgreSQL 13 or later). Each table is
+-- rebuilt as a partitioned table with partitions from its oldest month to
+-- three months ahead; the partition maintenance job keeps creating the months
+-- after that. Rows outside every partition land in the _default partition.
+--
+-- The primary keys include the partition column, as PostgreSQL requires, so
+-- ids are no longer unique on their own; updates should name the partition
+-- column next to the id so they only touch one partition.
+
+-- Rows logged before created_at was set by the application
+UPDATE authentication_logs SET created_at = COALESCE(timestamp, CURRENT_TIMESTAMP) WHERE created_at IS NULL;
+
+ALTER TABLE authentication_logs RENAME TO authentication_logs_unpartitioned;
+ALTER TABLE user_activity_history RENAME TO user_activity_history_unpartitioned;
+
+CREATE TABLE authentication_logs (
+    LIKE authentication_logs_unpartitioned INCLUDING DEFAULTS INCLUDING CONSTRAINTS
+) PARTITION BY RANGE (created_at);
+ALTER TABLE authentication_logs ALTER COLUMN created_at SET NOT NULL;
+
+CREATE TABLE user_activity_history (
+    LIKE user_activity_history_unpartitioned INCLUDING DEFAULTS INCLUDING CONSTRAINTS
+) PARTITION BY RANGE (from_datetime);
+
+-- Monthly partitions, UTC month boundaries, named <table>_yYYYYmMM
+DO $$
+DECLARE
+    spec RECORD;
+    first_month DATE;
+    last_month DATE;
+    partition_month DATE;
+BEGIN
+    FOR spec IN SELECT * FROM (VALUES
+        ('authentication_logs', 'created_at'),
+        ('user_activity_history', 'from_datetime')
+    ) AS t(name, key) LOOP
+        EXECUTE format('SELECT date_trunc(''month'', MIN(%I) AT TIME ZONE ''UTC'')::date FROM %I', spec.key, spec.name || '_unpartitioned')
+            INTO first_month;
+        last_month := (date_trunc('month', CURRENT_TIMESTAMP AT TIME ZONE 'UTC') + INTERVAL '3 months')::date;
+        partition_month := COALESCE(LEAST(first_month, last_month), date_trunc('month', CURRENT_TIMESTAMP AT TIME ZONE 'UTC')::date);
+        WHILE partition_month <= last_month LOOP
+            EXECUTE format('CREATE TABLE %I PARTITION OF %I FOR VALUES FROM (%L) TO (%L)',
+                spec.name || '_' || to_char(partition_month, '"y"YYYY"m"MM'), spec.name,
+                partition_month::timestamp AT TIME ZONE 'UTC', (partition_month + INTERVAL '1 month')::timestamp AT TIME ZONE 'UTC');
+            partition_month := (partition_month + INTERVAL '1 month')::date;
+        END LOOP;
+        EXECUTE format('CREATE TABLE %I PARTITION OF %I DEFAULT', spec.name || '_default', spec.name);
+    END LOOP;
+END $$;
+
+INSERT INTO authentication_logs SELECT * FROM authentication_logs_unpartitioned;
+INSERT INTO user_activity_history SELECT * FROM user_activity_history_unpartitioned;
+
+DROP TABLE authentication_logs_unpartitioned;
+DROP TABLE user_activity_history_unpartitioned;
+
+ALTER TABLE authentication_logs ADD PRIMARY KEY (id, created_at);
+ALTER TABLE user_activity_history ADD PRIMARY KEY (id, from_datetime);
+
+ALTER TABLE authentication_logs ADD FOREIGN KEY (user_id) REFERENCES users(id);
+ALTER TABLE authentication_logs ADD FOREIGN KEY (device_id) REFERENCES devices(id);
+ALTER TABLE authentication_logs ADD FOREIGN KEY (action_id) REFERENCES actions(id) ON DELETE SET NULL;
+
+ALTER TABLE user_activity_history ADD FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE user_activity_history ADD FOREIGN KEY (action_id) REFERENCES actions(id) ON DELETE CASCADE;
+ALTER TABLE user_activity_history ADD FOREIGN KEY (location_id) REFERENCES locations(id) ON DELETE SET NULL;
+ALTER TABLE user_activity_history ADD FOREIGN KEY (status_id) REFERENCES user_statuses(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_authentication_logs_user_id ON authentication_logs(user_id);
+CREATE INDEX idx_authentication_logs_device_id ON authentication_logs(device_id);
+CREATE INDEX idx_authentication_logs_action_id ON authentication_logs(action_id);
+CREATE INDEX idx_authentication_logs_created_at ON authentication_logs(created_at);
+CREATE INDEX idx_authentication_logs_type ON authentication_logs(type);
+CREATE INDEX idx_authentication_logs_success ON authentication_logs(success);
+CREATE INDEX idx_authentication_logs_request_id ON authentication_logs(request_id);
+CREATE INDEX idx_authentication_logs_failed_created_at ON authentication_logs(created_at) WHERE success = false;
+
+CREATE INDEX idx_user_activity_history_user_id ON user_activity_history(user_id);
+CREATE INDEX idx_user_activity_history_action_id ON user_activity_history(action_id);
+CREATE INDEX idx_user_activity_history_from_datetime ON user_activity_history(from_datetime);
+CREATE INDEX idx_user_activity_history_to_datetime ON user_activity_history(to_datetime);
+CREATE INDEX idx_user_activity_history_location_id ON user_activity_history(location_id);
+CREATE INDEX idx_user_activity_history_status_id ON user_activity_history(status_id);
+CREATE INDEX idx_user_activity_history_user_from_datetime ON user_activity_history(user_id, from_datetime);
+
+CREATE TRIGGER update_user_activity_history_updated_at BEFORE UPDATE ON user_activity_history FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,2 @@
+CREATE INDEX idx_user_activity_history_from_datetime ON user_activity_history(from_datetime);
+DROP INDEX IF EXISTS idx_user_activity_history_from_datetime_id;
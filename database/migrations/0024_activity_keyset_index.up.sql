@@ -0,0 +1,4 @@
+-- Activity listings page by (from_datetime, id) cursors, newest first; this
+-- index serves them without sorting and supersedes the from_datetime one
+CREATE INDEX idx_user_activity_history_from_datetime_id ON user_activity_history(from_datetime, id);
+DROP INDEX IF EXISTS idx_user_activity_history_from_datetime;
@@ -0,0 +1,11 @@
+DROP TRIGGER IF EXISTS queue_users_timezone_rollup ON users;
+DROP TRIGGER IF EXISTS queue_user_activity_history_rollup ON user_activity_history;
+DROP FUNCTION IF EXISTS queue_user_rollups();
+DROP FUNCTION IF EXISTS queue_activity_rollup();
+DROP TABLE IF EXISTS activity_rollup_queue;
+
+-- Local-day rollups do not fit the UTC days of the activity_rollup task
+DELETE FROM activity_rollups;
+ALTER TABLE activity_rollups DROP COLUMN IF EXISTS location_ids;
+ALTER TABLE activity_rollups DROP COLUMN IF EXISTS status_hours;
+ALTER TABLE activity_rollups DROP COLUMN IF EXISTS timezone;
@@ -0,0 +1,59 @@
+-- activity_rollups become the per-user, per-local-day aggregates summaries and
+-- timesheets read: days are in the user's timezone and hours are kept by user
+-- status, so either can categorise them. Triggers queue every change to a
+-- user's activities (or timezone) in activity_rollup_queue, and the rollup
+-- job recomputes the days each queued change touches.
+
+-- Earlier rollups were of UTC days; the seeded queue below rebuilds them
+DELETE FROM activity_rollups;
+
+ALTER TABLE activity_rollups ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE activity_rollups ADD COLUMN status_hours JSONB NOT NULL DEFAULT '{}'::jsonb;
+ALTER TABLE activity_rollups ADD COLUMN location_ids JSONB NOT NULL DEFAULT '[]'::jsonb;
+
+CREATE TABLE activity_rollup_queue (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL,
+    from_datetime TIMESTAMP WITH TIME ZONE NOT NULL,
+    to_datetime TIMESTAMP WITH TIME ZONE -- NULL for an open activity
+);
+
+CREATE INDEX idx_activity_rollup_queue_user_id ON activity_rollup_queue(user_id);
+
+CREATE OR REPLACE FUNCTION queue_activity_rollup()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        INSERT INTO activity_rollup_queue (user_id, from_datetime, to_datetime)
+        VALUES (OLD.user_id, OLD.from_datetime, OLD.to_datetime);
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        INSERT INTO activity_rollup_queue (user_id, from_datetime, to_datetime)
+        VALUES (NEW.user_id, NEW.from_datetime, NEW.to_datetime);
+    END IF;
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+-- A new timezone moves all of the user's day boundaries
+CREATE OR REPLACE FUNCTION queue_user_rollups()
+RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO activity_rollup_queue (user_id, from_datetime, to_datetime)
+    SELECT NEW.id, MIN(from_datetime), MAX(COALESCE(to_datetime, from_datetime))
+    FROM user_activity_history WHERE user_id = NEW.id
+    HAVING COUNT(*) > 0;
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER queue_user_activity_history_rollup
+    AFTER INSERT OR DELETE OR UPDATE OF user_id, action_id, from_datetime, to_datetime, location_id, status_id
+    ON user_activity_history FOR EACH ROW EXECUTE FUNCTION queue_activity_rollup();
+CREATE TRIGGER queue_users_timezone_rollup
+    AFTER UPDATE OF timezone ON users FOR EACH ROW
+    WHEN (OLD.timezone IS DISTINCT FROM NEW.timezone) EXECUTE FUNCTION queue_user_rollups();
+
+INSERT INTO activity_rollup_queue (user_id, from_datetime, to_datetime)
+SELECT user_id, MIN(from_datetime), MAX(COALESCE(to_datetime, from_datetime))
+FROM user_activity_history GROUP BY user_id;
@@ -0,0 +1,13 @@
+-- When each role's grant of a permission was last exercised: the latest
+-- successful authentication whose permission_checked the permission satisfies,
+-- by a user holding the role. Kept by the permission usage tracker, so it
+-- outlives the authentication logs retention removes.
+CREATE TABLE permission_usage (
+    role_id UUID NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    permission_id UUID NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+    last_used_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE INDEX idx_permission_usage_permission_id ON permission_usage(permission_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS access_review_items;
+DROP TABLE IF EXISTS access_review_campaigns;
+ALTER TABLE roles DROP COLUMN IF EXISTS owner_id;
@@ -0,0 +1,39 @@
+-- Access review campaigns: a snapshot of users' role assignments, each
+-- assigned to a reviewer (the user's manager or the role's owner) who approves
+-- or revokes it. Revoked assignments are removed from user_roles.
+
+-- The user who answers for who holds the role, in role_owner campaigns
+ALTER TABLE roles ADD COLUMN owner_id UUID REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE TABLE access_review_campaigns (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    name VARCHAR(255) NOT NULL,
+    reviewer_type VARCHAR(20) NOT NULL CHECK (reviewer_type IN ('manager', 'role_owner')),
+    role_id UUID REFERENCES roles(id) ON DELETE SET NULL, -- NULL reviews every role
+    due_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'completed', 'expired')),
+    created_by_id UUID REFERENCES users(id) ON DELETE SET NULL, -- NULL when scheduled
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_access_review_campaigns_status ON access_review_campaigns(status);
+
+CREATE TABLE access_review_items (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    campaign_id UUID NOT NULL REFERENCES access_review_campaigns(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role_id UUID NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    reviewer_id UUID REFERENCES users(id) ON DELETE SET NULL, -- NULL leaves the decision to access review admins
+    decision VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (decision IN ('pending', 'approved', 'revoked')),
+    decided_at TIMESTAMP WITH TIME ZONE,
+    decided_by_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    note TEXT,
+    UNIQUE (campaign_id, user_id, role_id)
+);
+
+CREATE INDEX idx_access_review_items_reviewer_id ON access_review_items(reviewer_id, decision);
+CREATE INDEX idx_access_review_items_user_id ON access_review_items(user_id);
@@ -0,0 +1,20 @@
+-- Sealed emergency credentials. Each use opens a break_glass_used security
+-- incident, and the credential stays locked until that incident is resolved
+-- as the post-incident review.
+
+CREATE TABLE break_glass_credentials (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    description TEXT,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    secret_hash VARCHAR(64) NOT NULL UNIQUE,
+    sealed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    sealed_by_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    last_used_ip VARCHAR(45),
+    incident_id UUID REFERENCES security_incidents(id) ON DELETE SET NULL -- The use under review, if any
+);
+
+CREATE INDEX idx_break_glass_credentials_user_id ON break_glass_credentials(user_id);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_session_records_user_id;
+ALTER TABLE session_records DROP COLUMN IF EXISTS user_id;
@@ -0,0 +1,8 @@
+-- Index postgres-stored sessions by user, for users listing and ending their
+-- own sessions at /auth/sessions
+
+ALTER TABLE session_records ADD COLUMN user_id VARCHAR(64);
+
+UPDATE session_records SET user_id = data->>'user_id';
+
+CREATE INDEX idx_session_records_user_id ON session_records(user_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS login_notifications;
+DROP TABLE IF EXISTS login_sources;
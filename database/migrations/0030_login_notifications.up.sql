@@ -0,0 +1,30 @@
+-- Devices and IP addresses each user has signed in from, and the security
+-- emails sent for sign-ins from new ones.
+
+CREATE TABLE login_sources (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind VARCHAR(10) NOT NULL CHECK (kind IN ('device', 'ip')),
+    value VARCHAR(64) NOT NULL, -- Device ID or IP address
+    first_seen_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_seen_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (user_id, kind, value)
+);
+
+CREATE TABLE login_notifications (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_id UUID,
+    ip_address VARCHAR(45),
+    user_agent TEXT,
+    new_device BOOLEAN NOT NULL DEFAULT false,
+    new_ip BOOLEAN NOT NULL DEFAULT false,
+    email VARCHAR(255),
+    status VARCHAR(20) NOT NULL CHECK (status IN ('sent', 'failed', 'skipped')),
+    reason TEXT,
+    request_id VARCHAR(128)
+);
+
+CREATE INDEX idx_login_notifications_user_id ON login_notifications(user_id);
+CREATE INDEX idx_login_notifications_created_at ON login_notifications(created_at);
+CREATE INDEX idx_login_notifications_request_id ON login_notifications(request_id);
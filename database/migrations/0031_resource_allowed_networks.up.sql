@@ -0,0 +1,4 @@
+-- CIDR ranges clients must connect from to use a resource's permissions; an
+-- empty list allows any network.
+
+ALTER TABLE resources ADD COLUMN allowed_networks JSONB NOT NULL DEFAULT '[]'::jsonb;
@@ -0,0 +1,3 @@
+ALTER TABLE devices DROP COLUMN IF EXISTS clone_suspected_at;
+ALTER TABLE devices DROP COLUMN IF EXISTS otp_session_counter;
+ALTER TABLE devices DROP COLUMN IF EXISTS otp_use_counter;
@@ -0,0 +1,10 @@
+-- The use and session counters of the last YubiKey OTP accepted from each
+-- device; last_otp_counter combines them into the high-water mark. An OTP
+-- counting below the mark suggests a cloned key: the device is deactivated
+-- with clone_suspected_at set until an admin re-activates it.
+
+ALTER TABLE devices ADD COLUMN otp_use_counter INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE devices ADD COLUMN otp_session_counter INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE devices ADD COLUMN clone_suspected_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE devices SET otp_use_counter = last_otp_counter >> 8, otp_session_counter = last_otp_counter & 255;
@@ -0,0 +1,7 @@
+ALTER TABLE devices DROP COLUMN IF EXISTS push_token;
+ALTER TABLE devices DROP COLUMN IF EXISTS push_platform;
+
+DELETE FROM devices WHERE type = 'push';
+ALTER TABLE devices DROP CONSTRAINT devices_type_check;
+ALTER TABLE devices
+    ADD CONSTRAINT devices_type_check CHECK (type IN ('yubikey', 'totp', 'sms', 'email'));
@@ -0,0 +1,10 @@
+-- Push approval devices: the mobile app's FCM or APNs registration token, to
+-- which sign-in challenges are sent for the user to approve or deny.
+
+ALTER TABLE devices DROP CONSTRAINT devices_type_check;
+ALTER TABLE devices
+    ADD CONSTRAINT devices_type_check CHECK (type IN ('yubikey', 'totp', 'sms', 'email', 'push'));
+
+ALTER TABLE devices ADD COLUMN push_platform VARCHAR(10) NOT NULL DEFAULT ''
+    CHECK (push_platform IN ('', 'fcm', 'apns'));
+ALTER TABLE devices ADD COLUMN push_token TEXT NOT NULL DEFAULT '';
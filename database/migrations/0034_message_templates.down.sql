@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS message_template_versions;
+DROP TABLE IF EXISTS message_templates;
@@ -0,0 +1,27 @@
+-- Email and notification messages edited through /templates, replacing the
+-- built-in catalog's message of their key in their locale, with every version
+-- of their text.
+
+CREATE TABLE message_templates (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    key VARCHAR(100) NOT NULL,
+    locale VARCHAR(35) NOT NULL,
+    text TEXT NOT NULL,
+    version INTEGER NOT NULL DEFAULT 1,
+    updated_by_id UUID REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE UNIQUE INDEX idx_message_templates_key_locale ON message_templates(key, locale);
+
+CREATE TABLE message_template_versions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    template_id UUID NOT NULL REFERENCES message_templates(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    text TEXT NOT NULL,
+    created_by_id UUID REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE UNIQUE INDEX idx_message_template_versions_template_version ON message_template_versions(template_id, version);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_report_jobs_definition_id;
+ALTER TABLE report_jobs DROP COLUMN IF EXISTS definition_id;
+DROP TABLE IF EXISTS report_definitions;
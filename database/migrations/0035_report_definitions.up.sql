@@ -0,0 +1,24 @@
+-- Custom activity reports saved through /reports/definitions, run by hand or
+-- on their cron schedule, and the link from each report job to the
+-- definition it ran.
+
+CREATE TABLE report_definitions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    name VARCHAR(100) NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    definition JSONB NOT NULL,
+    schedule VARCHAR(100) NOT NULL DEFAULT '',
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    version INTEGER NOT NULL DEFAULT 1,
+    next_run_at TIMESTAMP WITH TIME ZONE,
+    last_run_at TIMESTAMP WITH TIME ZONE,
+    created_by_id UUID REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_report_definitions_next_run_at ON report_definitions(next_run_at) WHERE active;
+
+ALTER TABLE report_jobs ADD COLUMN definition_id UUID REFERENCES report_definitions(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_report_jobs_definition_id ON report_jobs(definition_id);
@@ -0,0 +1,2 @@
+ALTER TABLE locations DROP COLUMN IF EXISTS capacity_mode;
+ALTER TABLE locations DROP COLUMN IF EXISTS capacity;
@@ -0,0 +1,7 @@
+-- How many people a location holds, and whether signing in to it when full
+-- is refused or only warned about. Locations without a capacity are
+-- unlimited.
+
+ALTER TABLE locations ADD COLUMN capacity INTEGER CHECK (capacity > 0);
+ALTER TABLE locations ADD COLUMN capacity_mode VARCHAR(10) NOT NULL DEFAULT 'warn'
+    CHECK (capacity_mode IN ('warn', 'block'));
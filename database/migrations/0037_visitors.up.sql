@@ -0,0 +1,30 @@
+-- Visitors expected at a location, checked in and out by reception. A badge
+-- number is held by one checked-in visitor at a time.
+
+CREATE TABLE visitors (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    version INTEGER NOT NULL DEFAULT 1,
+    name VARCHAR(200) NOT NULL,
+    company VARCHAR(200) NOT NULL DEFAULT '',
+    email VARCHAR(255) NOT NULL DEFAULT '',
+    notes TEXT NOT NULL DEFAULT '',
+    host_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    location_id UUID NOT NULL REFERENCES locations(id) ON DELETE CASCADE,
+    scheduled_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'expected'
+        CHECK (status IN ('expected', 'checked_in', 'checked_out', 'cancelled')),
+    badge_number VARCHAR(50) NOT NULL DEFAULT '',
+    checked_in_at TIMESTAMP WITH TIME ZONE,
+    checked_in_by_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    checked_in_device_id UUID REFERENCES devices(id) ON DELETE SET NULL,
+    checked_out_at TIMESTAMP WITH TIME ZONE,
+    checked_out_by_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    checked_out_device_id UUID REFERENCES devices(id) ON DELETE SET NULL,
+    host_notified_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_visitors_location_scheduled_at ON visitors(location_id, scheduled_at);
+CREATE INDEX idx_visitors_host_user_id ON visitors(host_user_id);
+CREATE UNIQUE INDEX idx_visitors_badge_number ON visitors(badge_number) WHERE status = 'checked_in' AND badge_number <> '';
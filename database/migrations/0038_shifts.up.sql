@@ -0,0 +1,33 @@
+-- Planned shifts, one-off or recurring, that sign-ins and sign-outs are
+-- compared with, and the late and missed shifts managers were notified of.
+
+CREATE TABLE shifts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    version INTEGER NOT NULL DEFAULT 1,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    location_id UUID REFERENCES locations(id) ON DELETE SET NULL,
+    starts_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    ends_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    recurrence VARCHAR(10) NOT NULL DEFAULT ''
+        CHECK (recurrence IN ('', 'daily', 'weekdays', 'weekly')),
+    recur_until VARCHAR(10) NOT NULL DEFAULT '',
+    notes TEXT NOT NULL DEFAULT '',
+    CHECK (ends_at > starts_at)
+);
+
+CREATE INDEX idx_shifts_user_id ON shifts(user_id);
+CREATE INDEX idx_shifts_location_id ON shifts(location_id);
+
+CREATE TABLE shift_notifications (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    shift_id UUID NOT NULL REFERENCES shifts(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    date VARCHAR(10) NOT NULL,
+    type VARCHAR(20) NOT NULL CHECK (type IN ('late', 'missed')),
+    manager_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    error TEXT,
+    UNIQUE(shift_id, date, type)
+);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS leave_entries;
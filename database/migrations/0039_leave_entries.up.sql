@@ -0,0 +1,19 @@
+-- Changes to users' leave balances per leave type and calendar year: days
+-- taken by leave actions and adjustments made by HR. With the configured
+-- accrual they make up each balance, and they are its audit trail.
+
+CREATE TABLE leave_entries (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    leave_type VARCHAR(50) NOT NULL,
+    year INTEGER NOT NULL,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('taken', 'adjustment')),
+    days NUMERIC(6, 2) NOT NULL,
+    action_id UUID REFERENCES actions(id) ON DELETE SET NULL,
+    auth_log_id UUID,
+    reason TEXT NOT NULL DEFAULT '',
+    adjusted_by_id UUID REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_leave_entries_user_year ON leave_entries(user_id, year, leave_type);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS holidays;
+ALTER TABLE locations DROP COLUMN IF EXISTS country;
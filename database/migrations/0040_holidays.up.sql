@@ -0,0 +1,22 @@
+-- Public holidays, of a country (ISO 3166-1 alpha-2) or of a single
+-- location. A location's holidays are its own and those of its country;
+-- attendance expects no hours on them and summaries report the hours worked
+-- on them under their own category.
+
+ALTER TABLE locations ADD COLUMN country VARCHAR(2) NOT NULL DEFAULT '';
+
+CREATE TABLE holidays (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    date VARCHAR(10) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    country VARCHAR(2) NOT NULL DEFAULT '',
+    location_id UUID REFERENCES locations(id) ON DELETE CASCADE,
+    source VARCHAR(20) NOT NULL DEFAULT 'manual',
+    CHECK ((country = '') <> (location_id IS NULL))
+);
+
+CREATE UNIQUE INDEX idx_holidays_country_date ON holidays(country, date) WHERE location_id IS NULL;
+CREATE UNIQUE INDEX idx_holidays_location_date ON holidays(location_id, date) WHERE location_id IS NOT NULL;
+CREATE INDEX idx_holidays_date ON holidays(date);
@@ -24,9 +24,9 @@ sudo -u postgres psql -c "CREATE DATABASE $DB_NAME OWNER $DB_USER;" || echo "Dat
 echo "Granting privileges..."
 sudo -u postgres psql -c "GRANT ALL PRIVILEGES ON DATABASE $DB_NAME TO $DB_USER;"
 
-# Run the schema
-echo "Running database schema..."
-PGPASSWORD=$DB_PASSWORD psql -h localhost -U $DB_USER -d $DB_NAME -f schema.sql
+# The schema itself is created by the versioned migrations in database/migrations
+echo "uuid-ossp is needed by the migrations; creating it as superuser..."
+sudo -u postgres psql -d $DB_NAME -c 'CREATE EXTENSION IF NOT EXISTS "uuid-ossp";'
 
 echo "Database setup complete!"
 echo ""
@@ -37,4 +37,5 @@ echo "  Database: $DB_NAME"
 echo "  User: $DB_USER"
 echo "  Password: $DB_PASSWORD"
 echo ""
-echo "Update your config.yaml file with these details." 
+echo "Update your config.yaml file with these details, then create the schema with:"
+echo "  go run ./cmd/cli migrate up" 
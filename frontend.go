@@ -0,0 +1,21 @@
+//go:build frontend
+
+package yubiapp
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed all:frontend/dist
+var frontendDist embed.FS
+
+// Frontend is the built React app (frontend/dist), served by cmd/api when
+// web.serve_frontend is set. Build it with `make bundle`.
+var Frontend = func() fs.FS {
+	dist, err := fs.Sub(frontendDist, "frontend/dist")
+	if err != nil {
+		panic(err)
+	}
+	return dist
+}()
@@ -1,10 +1,10 @@
 import { useMutation, useQuery, useQueryClient } from '@tanstack/react-query';
-import { apiService, type DeviceRegistrationRequest } from '../services/api';
+import { apiService, type DeviceImportOptions, type DeviceRegistrationRequest, type DeviceState } from '../services/api';
 
-export const useDevices = (userId?: string) => {
+export const useDevices = (userId?: string, state?: DeviceState) => {
   return useQuery({
-    queryKey: ['devices', userId],
-    queryFn: () => apiService.getDevices(userId),
+    queryKey: ['devices', userId, state],
+    queryFn: () => apiService.getDevices(userId, state),
     enabled: apiService.isAuthenticated(),
   });
 };
@@ -39,4 +39,31 @@ export const useDeregisterDevice = () => {
       queryClient.invalidateQueries({ queryKey: ['devices'] });
     },
   });
+};
+
+export const useTransitionDevice = () => {
+  const queryClient = useQueryClient();
+
+  return useMutation({
+    mutationFn: ({ deviceId, state, reason }: { deviceId: string; state: DeviceState; reason: string }) =>
+      apiService.transitionDevice(deviceId, state, reason),
+    onSuccess: () => {
+      // Invalidate devices queries
+      queryClient.invalidateQueries({ queryKey: ['devices'] });
+    },
+  });
+};
+
+export const useImportDevices = () => {
+  const queryClient = useQueryClient();
+
+  return useMutation({
+    mutationFn: ({ file, options }: { file: File; options?: DeviceImportOptions }) =>
+      apiService.importDevices(file, options),
+    onSuccess: (report) => {
+      if (!report.dry_run) {
+        queryClient.invalidateQueries({ queryKey: ['devices'] });
+      }
+    },
+  });
 }; 
\ No newline at end of file
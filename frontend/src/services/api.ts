@@ -44,16 +44,51 @@ export interface Permission {
 
 export interface Device {
   id: string;
-  user: User;
+  user: User | null;
   type: string;
   identifier: string;
   active: boolean;
   verified_at?: string;
   last_used_at?: string;
+  firmware_version?: string;
+  form_factor?: string;
+  asset_tag?: string;
+  purchase_order?: string;
+  purchased_at?: string | null;
+  attested_at?: string | null;
+  state: DeviceState;
+  state_changed_at?: string | null;
+  role: DeviceRole;
   created_at: string;
   updated_at: string;
 }
 
+export type DeviceState = 'in_stock' | 'assigned' | 'lost' | 'retired';
+
+export type DeviceRole = 'primary' | 'backup';
+
+export interface DeviceImportOptions {
+  purchase_order?: string;
+  purchased_at?: string;
+  dry_run?: boolean;
+}
+
+export interface DeviceImportReport {
+  dry_run: boolean;
+  total: number;
+  created: number;
+  duplicates: number;
+  invalid: number;
+  rows: {
+    line: number;
+    identifier: string;
+    serial_number?: string;
+    status: 'created' | 'duplicate' | 'invalid';
+    device_id?: string;
+    message?: string;
+  }[];
+}
+
 export interface AuthResponse {
   authenticated: boolean;
   user: User;
@@ -69,7 +104,10 @@ export interface DeviceRegistrationRequest {
   target_user_id: string;
   device_identifier: string;
   device_type: 'yubikey' | 'totp' | 'sms' | 'email';
+  role?: DeviceRole;
   notes?: string;
+  attestation?: string;
+  attestation_intermediate?: string;
 }
 
 export interface ActionRequest {
@@ -91,7 +129,7 @@ class ApiService {
 
   constructor() {
     this.api = axios.create({
-      baseURL: 'http://localhost:8080/api/v1',
+      baseURL: '/api/v1', // Same origin: proxied by vite in development, served by cmd/api in production
       headers: {
         'Content-Type': 'application/json',
       },
@@ -148,12 +186,30 @@ class ApiService {
     await this.api.post(`/devices/${deviceId}/deregister`);
   }
 
-  async getDevices(userId?: string): Promise<Device[]> {
-    const params = userId ? { user_id: userId } : {};
+  async getDevices(userId?: string, state?: DeviceState): Promise<Device[]> {
+    const params = {
+      ...(userId ? { user_id: userId } : {}),
+      ...(state ? { state } : {}),
+    };
     const response: AxiosResponse<Device[]> = await this.api.get('/devices', { params });
     return response.data;
   }
 
+  async importDevices(file: File, options: DeviceImportOptions = {}): Promise<DeviceImportReport> {
+    const form = new FormData();
+    form.append('file', file);
+    if (options.purchase_order) form.append('purchase_order', options.purchase_order);
+    if (options.purchased_at) form.append('purchased_at', options.purchased_at);
+    if (options.dry_run) form.append('dry_run', 'true');
+    const response: AxiosResponse<{ item: DeviceImportReport }> = await this.api.post('/devices/import', form);
+    return response.data.item;
+  }
+
+  async transitionDevice(deviceId: string, state: DeviceState, reason: string): Promise<Device> {
+    const response: AxiosResponse<Device> = await this.api.post(`/devices/${deviceId}/state`, { state, reason });
+    return response.data;
+  }
+
   async getDevice(deviceId: string): Promise<Device> {
     const response: AxiosResponse<Device> = await this.api.get(`/devices/${deviceId}`);
     return response.data;
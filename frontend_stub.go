@@ -0,0 +1,9 @@
+//go:build !frontend
+
+package yubiapp
+
+import "io/fs"
+
+// Frontend is nil unless built with `-tags frontend`, which embeds the built
+// React app (frontend/dist); see `make bundle`.
+var Frontend fs.FS
@@ -1,7 +1,9 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"reflect"
 	"time"
 
 	"github.com/spf13/viper"
@@ -15,14 +17,107 @@ type Config struct {
 	Yubikey  YubikeyConfig  `mapstructure:"yubikey"`
 	SMS      SMSConfig      `mapstructure:"sms"`
 	Email    EmailConfig    `mapstructure:"email"`
+	Push     PushConfig     `mapstructure:"push"`
+	QRLogin  QRLoginConfig  `mapstructure:"qr_login"`
 	Web      WebConfig      `mapstructure:"web"`
+	Reports  ReportsConfig  `mapstructure:"reports"`
+	Activity ActivityConfig `mapstructure:"activity"`
+	Attendance AttendanceConfig `mapstructure:"attendance"`
+	Shifts   ShiftsConfig   `mapstructure:"shifts"`
+	Leave    LeaveConfig    `mapstructure:"leave"`
+	Holidays HolidaysConfig `mapstructure:"holidays"`
+	Doors    DoorsConfig    `mapstructure:"doors"`
+	MachineAuth MachineAuthConfig `mapstructure:"machine_auth"`
+	Radius   RadiusConfig   `mapstructure:"radius"`
+	GRPC     GRPCConfig     `mapstructure:"grpc"`
+	Retention RetentionConfig `mapstructure:"retention"`
+	Partitions PartitionsConfig `mapstructure:"partitions"`
+	Lifecycle LifecycleConfig `mapstructure:"lifecycle"`
+	AccessReviews AccessReviewsConfig `mapstructure:"access_reviews"`
+	Scheduler SchedulerConfig `mapstructure:"scheduler"`
+	Jobs     JobsConfig     `mapstructure:"jobs"`
+	Worker   WorkerConfig   `mapstructure:"worker"`
+	Password PasswordConfig `mapstructure:"password"`
+	Authorization AuthorizationConfig `mapstructure:"authorization"`
+	ResponseSigning ResponseSigningConfig `mapstructure:"response_signing"`
+	Logging  LoggingConfig  `mapstructure:"logging"`
+	Tracing  TracingConfig  `mapstructure:"tracing"`
+	Health   HealthConfig   `mapstructure:"health"`
+	AuthLog  AuthLogConfig  `mapstructure:"auth_log"`
+	Alerting AlertingConfig `mapstructure:"alerting"`
+	Anomalies AnomaliesConfig `mapstructure:"anomalies"`
+	Devices  DevicesConfig  `mapstructure:"devices"`
+	PermissionUsage PermissionUsageConfig `mapstructure:"permission_usage"`
+	Users    UsersConfig    `mapstructure:"users"`
+	Recovery RecoveryConfig `mapstructure:"recovery"`
+	BreakGlass BreakGlassConfig `mapstructure:"break_glass"`
+	LoginNotifications LoginNotificationsConfig `mapstructure:"login_notifications"`
+	HRNotifications HRNotificationsConfig `mapstructure:"hr_notifications"`
+	Calendar CalendarConfig `mapstructure:"calendar"`
+	Chat     ChatConfig     `mapstructure:"chat"`
+	I18n     I18nConfig     `mapstructure:"i18n"`
+	CLI      CLIConfig      `mapstructure:"cli"`
 }
 
 type ServerConfig struct {
-	Host    string        `mapstructure:"host"`
-	Port    int           `mapstructure:"port"`
-	Timeout time.Duration `mapstructure:"timeout"`
-	Debug   bool          `mapstructure:"debug"`
+	Host            string                `mapstructure:"host"`
+	Port            int                   `mapstructure:"port"`
+	Timeout         time.Duration         `mapstructure:"timeout"`
+	Debug           bool                  `mapstructure:"debug"`
+	ShutdownTimeout time.Duration         `mapstructure:"shutdown_timeout"` // How long SIGINT/SIGTERM waits for in-flight requests and queued work
+	SecurityHeaders SecurityHeadersConfig `mapstructure:"security_headers"`
+	CSRF            CSRFConfig            `mapstructure:"csrf"`
+	TLS             TLSConfig             `mapstructure:"tls"`
+	// Reverse proxies (IPs or CIDRs) whose X-Forwarded-For and X-Real-IP headers
+	// give the client IP; when empty the connection's remote address is used
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+}
+
+// TLSConfig serves HTTPS directly, without a reverse proxy, optionally
+// authenticating clients by certificate
+type TLSConfig struct {
+	Enabled        bool          `mapstructure:"enabled"`
+	CertFile       string        `mapstructure:"cert_file"`
+	KeyFile        string        `mapstructure:"key_file"`
+	ReloadInterval time.Duration `mapstructure:"reload_interval"` // How often the files are checked for a rotated certificate (0 disables)
+	MinVersion     string        `mapstructure:"min_version"`     // 1.2 or 1.3
+	ClientAuth     string        `mapstructure:"client_auth"`     // none, optional or require
+	ClientCAFile   string        `mapstructure:"client_ca_file"`  // CAs client certificates must chain to
+	// Service identities client certificates authenticate as, keyed by name
+	ClientIdentities map[string]ClientIdentityConfig `mapstructure:"client_identities"`
+}
+
+// ClientIdentityConfig maps client certificates to a service identity. A
+// certificate must match every matcher that is set.
+type ClientIdentityConfig struct {
+	CommonName  string   `mapstructure:"common_name"`
+	DNSName     string   `mapstructure:"dns_name"`
+	URI         string   `mapstructure:"uri"`         // e.g. a SPIFFE ID
+	Fingerprint string   `mapstructure:"fingerprint"` // Hex SHA-256 of the DER certificate
+	User        string   `mapstructure:"user"`        // Username requests are made as, for attribution
+	Permissions []string `mapstructure:"permissions"` // "resource:action", "resource:*" or "*"
+}
+
+// SecurityHeadersConfig sets the browser security headers sent with every response
+type SecurityHeadersConfig struct {
+	Enabled               bool          `mapstructure:"enabled"`
+	HSTSMaxAge            time.Duration `mapstructure:"hsts_max_age"` // Sent over HTTPS only; 0 omits Strict-Transport-Security
+	HSTSIncludeSubdomains bool          `mapstructure:"hsts_include_subdomains"`
+	HSTSPreload           bool          `mapstructure:"hsts_preload"`
+	FrameOptions          string        `mapstructure:"frame_options"`           // DENY or SAMEORIGIN
+	ContentSecurityPolicy string        `mapstructure:"content_security_policy"` // For API responses; the frontend has web.content_security_policy
+	ReferrerPolicy        string        `mapstructure:"referrer_policy"`
+}
+
+// CSRFConfig enables double-submit CSRF tokens for browser requests
+// authenticated by a session cookie. Requests without that cookie, such as
+// those sending a bearer token, are not checked.
+type CSRFConfig struct {
+	Enabled       bool   `mapstructure:"enabled"`
+	CookieName    string `mapstructure:"cookie_name"`    // Cookie holding the token, readable by the frontend
+	HeaderName    string `mapstructure:"header_name"`    // Header unsafe requests echo the token in
+	SessionCookie string `mapstructure:"session_cookie"` // Unsafe requests carrying this cookie are checked
+	Secure        bool   `mapstructure:"secure"`         // Send the token cookie over HTTPS only
 }
 
 type DatabaseConfig struct {
@@ -32,14 +127,38 @@ type DatabaseConfig struct {
 	User     string `mapstructure:"user"`
 	Password string `mapstructure:"password"`
 	SSLMode  string `mapstructure:"ssl_mode"`
+	// Optional read replica (a libpq DSN or postgres:// URL) serving activity
+	// history, reports and list endpoints; everything else uses the primary
+	ReplicaDSN      string        `mapstructure:"replica_dsn"`
+	MaxOpenConns    int           `mapstructure:"max_open_conns"`     // Per pool (primary and replica); 0 is unlimited
+	MaxIdleConns    int           `mapstructure:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`  // Connections are recycled after this long; 0 keeps them
+	ConnMaxIdleTime time.Duration `mapstructure:"conn_max_idle_time"` // Idle connections are closed after this long; 0 keeps them
 }
 
 type RedisConfig struct {
-	Host     string `mapstructure:"host"`
-	Port     int    `mapstructure:"port"`
-	Password string `mapstructure:"password"`
-	DB       int    `mapstructure:"db"`
-	PoolSize int    `mapstructure:"pool_size"`
+	Mode             string         `mapstructure:"mode"` // single, sentinel or cluster
+	Host             string         `mapstructure:"host"`
+	Port             int            `mapstructure:"port"`
+	Addrs            []string       `mapstructure:"addrs"`       // host:port of the sentinels (sentinel) or seed nodes (cluster)
+	MasterName       string         `mapstructure:"master_name"` // Sentinel master set name
+	Username         string         `mapstructure:"username"`    // ACL user (Redis 6+)
+	Password         string         `mapstructure:"password"`
+	SentinelUsername string         `mapstructure:"sentinel_username"`
+	SentinelPassword string         `mapstructure:"sentinel_password"`
+	DB               int            `mapstructure:"db"` // Not supported in cluster mode
+	PoolSize         int            `mapstructure:"pool_size"`
+	TLS              RedisTLSConfig `mapstructure:"tls"`
+}
+
+// RedisTLSConfig enables TLS to Redis, optionally with a private CA and a client certificate
+type RedisTLSConfig struct {
+	Enabled            bool   `mapstructure:"enabled"`
+	CAFile             string `mapstructure:"ca_file"`   // PEM CA bundle; the system roots when empty
+	CertFile           string `mapstructure:"cert_file"` // Client certificate for mutual TLS
+	KeyFile            string `mapstructure:"key_file"`
+	ServerName         string `mapstructure:"server_name"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"` // Testing only
 }
 
 type AuthConfig struct {
@@ -48,12 +167,74 @@ type AuthConfig struct {
 	RefreshTokenExpiry  time.Duration `mapstructure:"refresh_token_expiry"`
 	AccessTokenExpiry   time.Duration `mapstructure:"access_token_expiry"`
 	SessionExpiry       time.Duration `mapstructure:"session_expiry"`
+	ImpersonationExpiry time.Duration `mapstructure:"impersonation_expiry"` // Lifetime of sessions minted by /auth/impersonate
+	SessionBinding      string        `mapstructure:"session_binding"`      // off, lenient or strict
+	SessionStore        string        `mapstructure:"session_store"`        // redis, memory or postgres
+	SessionIdleTimeout  time.Duration `mapstructure:"session_idle_timeout"` // Sessions unused this long expire (0 disables)
+	// How often expired sessions are deleted from the postgres session store (0 disables)
+	SessionCleanupInterval time.Duration `mapstructure:"session_cleanup_interval"`
+	// Per-role authentication policies, keyed by role name. A user holding several
+	// roles with a policy gets the strictest: the shortest timeouts, only device
+	// types every policy accepts, and no sessions if any policy forbids them.
+	// Read from role_session_policies when unset, its name before it covered devices.
+	RolePolicies map[string]AuthPolicyConfig `mapstructure:"role_policies"`
+}
+
+type AuthPolicyConfig struct {
+	IdleTimeout time.Duration `mapstructure:"idle_timeout"` // Overrides session_idle_timeout
+	MaxLifetime time.Duration `mapstructure:"max_lifetime"` // Overrides session_expiry
+	DeviceTypes []string      `mapstructure:"device_types"` // Device types the role may authenticate with; empty allows all
+	NoSessions  bool          `mapstructure:"no_sessions"`  // Refuse session authentication to the role
 }
 
 type YubikeyConfig struct {
 	ClientID  string `mapstructure:"client_id"`
 	SecretKey string `mapstructure:"secret_key"`
 	APIURL    string `mapstructure:"api_url"`
+	// Validation hosts tried after api_url when it does not answer
+	FallbackURLs []string      `mapstructure:"fallback_urls"`
+	Timeout      time.Duration `mapstructure:"timeout"`       // Per verification attempt
+	Retries      int           `mapstructure:"retries"`       // Further attempts, each on the next host
+	RetryBackoff time.Duration `mapstructure:"retry_backoff"` // Wait before the first retry; doubles, with jitter
+	ProxyURL     string        `mapstructure:"proxy_url"`     // Outbound proxy; HTTPS_PROXY and friends when empty
+	// Stop calling YubiCloud for a while after verifications keep failing
+	CircuitBreaker CircuitBreakerConfig `mapstructure:"circuit_breaker"`
+	// What YubiKey sign-ins may still do while YubiCloud is unavailable
+	DegradedMode DegradedModeConfig `mapstructure:"degraded_mode"`
+	// Validate OTPs locally for devices whose secret holds the YubiKey's AES key
+	LocalValidation bool `mapstructure:"local_validation"`
+	// How long hashes of seen OTPs are kept in Redis to refuse replays before
+	// verification (0 disables)
+	ReplayCacheTTL time.Duration `mapstructure:"replay_cache_ttl"`
+	// Verification of the attestation certificates sent when a YubiKey is registered
+	Attestation YubikeyAttestationConfig `mapstructure:"attestation"`
+}
+
+// CircuitBreakerConfig fails calls fast for Cooldown once Failures in a row
+// found no one answering; 0 failures disables it
+type CircuitBreakerConfig struct {
+	Failures int           `mapstructure:"failures"`
+	Cooldown time.Duration `mapstructure:"cooldown"`
+}
+
+// DegradedModeConfig picks a policy per permission or action for YubiKey OTPs
+// that cannot be verified: deny, allow (unverified, marked in the log) or totp
+// (fall back to the user's TOTP device)
+type DegradedModeConfig struct {
+	Default     string            `mapstructure:"default"`
+	Permissions map[string]string `mapstructure:"permissions"` // By "resource:action", or resource name for all its actions
+	Actions     map[string]string `mapstructure:"actions"`     // By action name, for /auth/action and kiosks
+}
+
+type YubikeyAttestationConfig struct {
+	// PEM file of the Yubico attestation root CAs, from https://developers.yubico.com/PKI/
+	CAFile string `mapstructure:"ca_file"`
+	// Refuse to register YubiKeys that come without an attestation
+	Required bool `mapstructure:"required"`
+	// Lowest firmware version accepted from an attested key, e.g. "5.4.3"
+	MinFirmware string `mapstructure:"min_firmware"`
+	// Attested form factors that cannot be registered, e.g. usb-a-nano
+	BlockedFormFactors []string `mapstructure:"blocked_form_factors"`
 }
 
 type SMSConfig struct {
@@ -63,6 +244,46 @@ type SMSConfig struct {
 	FromNumber  string `mapstructure:"from_number"`
 }
 
+// PushConfig configures push approval: sign-ins send a challenge to the user's
+// mobile app through FCM or APNs, to be approved or denied there
+type PushConfig struct {
+	ChallengeTTL time.Duration `mapstructure:"challenge_ttl"` // How long a challenge can be answered and redeemed
+	MaxWait      time.Duration `mapstructure:"max_wait"`      // Longest a client may long-poll for the answer; below server.timeout
+	// Require the number shown at sign-in to be entered in the app, so a user
+	// cannot approve a sign-in they did not start
+	NumberMatching bool       `mapstructure:"number_matching"`
+	FCM            FCMConfig  `mapstructure:"fcm"`
+	APNs           APNsConfig `mapstructure:"apns"`
+}
+
+// FCMConfig sends to Android devices through the FCM HTTP v1 API
+type FCMConfig struct {
+	CredentialsFile string `mapstructure:"credentials_file"` // Firebase service account key (JSON)
+	ProjectID       string `mapstructure:"project_id"`       // Defaults to the service account's project
+}
+
+// APNsConfig sends to iOS devices with APNs token-based authentication
+type APNsConfig struct {
+	KeyFile string `mapstructure:"key_file"` // Token signing key (.p8)
+	KeyID   string `mapstructure:"key_id"`
+	TeamID  string `mapstructure:"team_id"`
+	Topic   string `mapstructure:"topic"`   // The app's bundle ID
+	Sandbox bool   `mapstructure:"sandbox"` // Development builds of the app
+}
+
+// QRLoginConfig configures cross-device login: a shared terminal shows a QR
+// code, which a user approves from a phone already signed in, and the terminal
+// gets a limited session
+type QRLoginConfig struct {
+	ChallengeTTL  time.Duration `mapstructure:"challenge_ttl"`  // How long a QR code can be approved and redeemed
+	SessionExpiry time.Duration `mapstructure:"session_expiry"` // Lifetime of the terminal's session; refreshing does not extend it
+	MaxWait       time.Duration `mapstructure:"max_wait"`       // Longest a terminal may long-poll; below server.timeout
+	ReadOnly      bool          `mapstructure:"read_only"`      // Terminal sessions cannot write
+	// Base URL the QR code points the phone to, with ?challenge=<id>; without
+	// it the QR code holds yubiapp-qr:<id>
+	ApprovalURL string `mapstructure:"approval_url"`
+}
+
 type EmailConfig struct {
 	SMTPHost   string `mapstructure:"smtp_host"`
 	SMTPPort   int    `mapstructure:"smtp_port"`
@@ -72,12 +293,405 @@ type EmailConfig struct {
 }
 
 type WebConfig struct {
-	SessionSecret string   `mapstructure:"session_secret"`
-	CORSOrigins   []string `mapstructure:"cors_origins"`
+	SessionSecret         string   `mapstructure:"session_secret"`
+	CORSOrigins           []string `mapstructure:"cors_origins"`
+	ServeFrontend         bool     `mapstructure:"serve_frontend"`          // Serve the embedded frontend (built with -tags frontend)
+	ContentSecurityPolicy string   `mapstructure:"content_security_policy"` // Sent with the frontend's pages and assets
+}
+
+type ReportsConfig struct {
+	MaxSyncDays int `mapstructure:"max_sync_days"` // Larger ranges are generated as async jobs
+}
+
+type ActivityConfig struct {
+	// Categories maps a summary category name to the user status types and/or
+	// status names it covers, e.g. work: [working, travel]. When empty, each
+	// status type is its own category.
+	Categories map[string][]string `mapstructure:"categories"`
+	// ClockSkew is how far the start_time and end_time clients report with an
+	// action may be from the server clock; times outside are clamped. 0 keeps
+	// them as reported.
+	ClockSkew time.Duration `mapstructure:"clock_skew"`
+	// MaxOffset is the largest offset activity listings accept; deeper pages
+	// are reached with their cursor. 0 allows any offset.
+	MaxOffset int `mapstructure:"max_offset"`
+	// RollupInterval is how often daily rollups are refreshed for changed
+	// activities. 0 disables the refresh, and summaries and timesheets read
+	// the activity history instead.
+	RollupInterval time.Duration `mapstructure:"rollup_interval"`
+	// OccupancyStatusTypes are the user status types of open activities that
+	// count a user as present at the activity's location, for occupancy and
+	// location capacity.
+	OccupancyStatusTypes []string `mapstructure:"occupancy_status_types"`
+}
+
+type AttendanceConfig struct {
+	NotifyInterval time.Duration `mapstructure:"notify_interval"` // How often policy breaches are checked; 0 disables notifications
+}
+
+type ShiftsConfig struct {
+	GraceMinutes   int           `mapstructure:"grace_minutes"`   // Minutes after a shift starts that a sign-in is still on time
+	AbsentAfter    time.Duration `mapstructure:"absent_after"`    // How long after a shift starts without a sign-in it counts as missed
+	EarlyWindow    time.Duration `mapstructure:"early_window"`    // How long before a shift starts a sign-in counts towards it
+	NotifyInterval time.Duration `mapstructure:"notify_interval"` // How often late and missed shifts are checked and managers notified; 0 disables
+}
+
+type LeaveConfig struct {
+	// Leave types whose balances are tracked, keyed by the name leave actions
+	// declare, e.g. "vacation" or "sick"
+	Types map[string]LeaveTypeConfig `mapstructure:"types"`
+}
+
+type LeaveTypeConfig struct {
+	AnnualDays   float64 `mapstructure:"annual_days"`  // Days a user is entitled to per calendar year
+	Accrual      string  `mapstructure:"accrual"`      // "yearly" (default) credits annual_days on January 1st, "monthly" a twelfth at the start of each month
+	Insufficient string  `mapstructure:"insufficient"` // "block" (default) refuses leave beyond the balance, "warn" allows it with a warning
+}
+
+type HolidaysConfig struct {
+	// DefaultCountry is the ISO 3166-1 alpha-2 code of the country whose
+	// public holidays apply to locations without a country, and to days
+	// without a location. Empty applies only locations' own holidays there.
+	DefaultCountry string `mapstructure:"default_country"`
+	// Category is the summary category hours of working statuses on a
+	// holiday are reported under. Empty keeps them in their usual category.
+	Category string `mapstructure:"category"`
+}
+
+type DoorsConfig struct {
+	Driver        string        `mapstructure:"driver"`         // "http" or "mock"
+	ControllerURL string        `mapstructure:"controller_url"` // Base URL of the door controller API (http driver)
+	APIKey        string        `mapstructure:"api_key"`        // Sent as a bearer token to the controller
+	Timeout       time.Duration `mapstructure:"timeout"`
+	UnlockSeconds int           `mapstructure:"unlock_seconds"` // How long a door stays unlocked
+}
+
+type MachineAuthConfig struct {
+	DecisionCacheTTL time.Duration `mapstructure:"decision_cache_ttl"` // How long /auth/validate permission decisions are cached; 0 disables caching
+}
+
+// GRPCConfig serves the gRPC API (proto/yubiapp/v1) for internal services,
+// with the TLS settings of server.tls when enabled
+type GRPCConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Listen  string `mapstructure:"listen"`
+}
+
+type RadiusConfig struct {
+	Enabled                     bool              `mapstructure:"enabled"`
+	Listen                      string            `mapstructure:"listen"`
+	Secret                      string            `mapstructure:"secret"`                        // Shared secret for all NAS clients
+	Action                      string            `mapstructure:"action"`                        // Permission action checked on the NAS's resource
+	NASResources                map[string]string `mapstructure:"nas_resources"`                 // NAS-Identifier (or NAS-IP-Address) to resource name
+	RequireMessageAuthenticator bool              `mapstructure:"require_message_authenticator"` // Drop requests without a Message-Authenticator
+}
+
+type RetentionConfig struct {
+	PurgeAfter    time.Duration `mapstructure:"purge_after"`    // How long soft-deleted users and devices are kept before being purged; 0 disables purging
+	PurgeInterval time.Duration `mapstructure:"purge_interval"` // How often the purge job runs
+
+	Tables          map[string]int `mapstructure:"tables"`           // Days rows of authentication_logs and user_activity_history are kept before being archived and deleted; 0 or unset keeps them
+	ArchiveInterval time.Duration  `mapstructure:"archive_interval"` // How often expired rows are archived; 0 disables archival
+	ArchiveBatch    int            `mapstructure:"archive_batch"`    // Rows per archive file
+	Archive         ArchiveConfig  `mapstructure:"archive"`
+}
+
+// ArchiveConfig is where archival writes its compressed NDJSON files: the S3
+// bucket when one is set, else the local directory
+type ArchiveConfig struct {
+	Dir string   `mapstructure:"dir"`
+	S3  S3Config `mapstructure:"s3"`
+}
+
+// S3Config locates an S3 bucket, or a bucket on an S3-compatible store such as
+// MinIO when Endpoint is set
+type S3Config struct {
+	Bucket          string `mapstructure:"bucket"`
+	Prefix          string `mapstructure:"prefix"`   // Key prefix archives are written under
+	Region          string `mapstructure:"region"`
+	Endpoint        string `mapstructure:"endpoint"` // e.g. https://minio.example.com; AWS when empty
+	AccessKeyID     string `mapstructure:"access_key_id"`
+	SecretAccessKey string `mapstructure:"secret_access_key"`
+	SessionToken    string `mapstructure:"session_token"` // For temporary credentials
+}
+
+// PartitionsConfig configures the maintenance job that creates the monthly
+// partitions of authentication_logs and user_activity_history ahead of time
+type PartitionsConfig struct {
+	MaintenanceInterval time.Duration `mapstructure:"maintenance_interval"` // How often missing partitions are created; 0 disables the job
+	PremakeMonths       int           `mapstructure:"premake_months"`       // Months after the current one that always have a partition
+}
+
+// PermissionUsageConfig configures the tracker that records when permissions
+// are exercised and GET /permissions/usage
+type PermissionUsageConfig struct {
+	TrackInterval time.Duration `mapstructure:"track_interval"` // How often new authentication logs are tracked; 0 disables the tracker
+	UnusedDays    int           `mapstructure:"unused_days"`    // Grants unused this many days are listed as revocation candidates
+}
+
+type LifecycleConfig struct {
+	ApplyInterval time.Duration `mapstructure:"apply_interval"` // How often scheduled user state transitions are applied; 0 disables the scheduler
+}
+
+// AccessReviewsConfig configures access review campaigns and the scheduler
+// that opens them periodically and expires them when due
+type AccessReviewsConfig struct {
+	CheckInterval time.Duration `mapstructure:"check_interval"` // How often campaigns are opened and expired; 0 disables the scheduler
+	Interval      time.Duration `mapstructure:"interval"`       // How often a campaign over every role is opened; 0 opens them only through the API
+	Duration      time.Duration `mapstructure:"duration"`       // How long campaigns stay open unless given a due date
+	Reviewer      string        `mapstructure:"reviewer"`       // Who reviews scheduled campaigns: "manager" or "role_owner"
+}
+
+// SchedulerConfig configures the scheduler that runs automated actions and saved
+// report definitions on their cron schedules
+type SchedulerConfig struct {
+	CheckInterval time.Duration `mapstructure:"check_interval"` // How often schedules are checked for due runs; 0 disables scheduled runs
+	RunTimeout    time.Duration `mapstructure:"run_timeout"`    // Runs are cancelled after this, and a run left running longer no longer blocks the next
+}
+
+// JobsConfig configures the Redis-backed background job queue and its workers
+type JobsConfig struct {
+	Workers           int           `mapstructure:"workers"`            // Jobs run concurrently in the API process; 0 leaves them to cmd/worker
+	WorkerConcurrency int           `mapstructure:"worker_concurrency"` // Jobs run concurrently by each cmd/worker process
+	MaxAttempts       int           `mapstructure:"max_attempts"`       // Attempts before a job moves to the dead-letter list
+	BackoffBase       time.Duration `mapstructure:"backoff_base"`       // Delay before the first retry; doubles with each attempt
+	BackoffMax        time.Duration `mapstructure:"backoff_max"`        // Longest delay between retries
+	Lease             time.Duration `mapstructure:"lease"`              // How long a job may run before it is cancelled and handed to another worker
+	PollInterval      time.Duration `mapstructure:"poll_interval"`      // How often idle workers check for jobs
+	KeyPrefix         string        `mapstructure:"key_prefix"`         // Prefix of the queue's Redis keys
+}
+
+// WorkerConfig configures cmd/worker, which runs background work apart from the API
+type WorkerConfig struct {
+	SchedulersInAPI bool   `mapstructure:"schedulers_in_api"` // The API process runs the schedulers too; turn off when cmd/worker runs them
+	HealthListen    string `mapstructure:"health_listen"`     // Address of the worker's /healthz and /readyz; empty disables them
+}
+
+type PasswordConfig struct {
+	MinLength        int           `mapstructure:"min_length"`
+	RequireUppercase bool          `mapstructure:"require_uppercase"`
+	RequireLowercase bool          `mapstructure:"require_lowercase"`
+	RequireDigit     bool          `mapstructure:"require_digit"`
+	RequireSymbol    bool          `mapstructure:"require_symbol"`
+	History          int           `mapstructure:"history"`          // Number of previous passwords that cannot be reused
+	BcryptCost       int           `mapstructure:"bcrypt_cost"`
+	MaxAge           time.Duration `mapstructure:"max_age"`          // Passwords older than this must be changed; 0 disables expiry
+	MaxFailures      int           `mapstructure:"max_failures"`     // Failed attempts before the account is locked; 0 disables lockout
+	LockoutDuration  time.Duration `mapstructure:"lockout_duration"`
+	ResetTokenTTL    time.Duration `mapstructure:"reset_token_ttl"`   // How long an emailed reset token stays valid
+	ResetURL         string        `mapstructure:"reset_url"`         // Page the reset email links to, with ?token=<token>; the bare token is sent when empty
+	ResetRateLimit   int           `mapstructure:"reset_rate_limit"`  // Reset requests allowed per account and per client IP within reset_rate_window
+	ResetRateWindow  time.Duration `mapstructure:"reset_rate_window"`
+}
+
+// AuthorizationConfig binds API route groups and HTTP methods to the permission they require
+type AuthorizationConfig struct {
+	DefaultRead  string                       `mapstructure:"default_read"`  // Permission for GET requests to groups without an entry
+	DefaultWrite string                       `mapstructure:"default_write"` // Permission for other methods to groups without an entry
+	Routes       map[string]map[string]string `mapstructure:"routes"`        // Route group -> HTTP method (or "*") -> "resource:action"
+	// Holders of this permission may use resources from outside their
+	// allowed_networks, for emergency access; empty lets no one
+	NetworkOverridePermission string `mapstructure:"network_override_permission"`
+}
+
+type ResponseSigningConfig struct {
+	Enabled    bool   `mapstructure:"enabled"`     // Sign responses to requests that carry a nonce
+	PrivateKey string `mapstructure:"private_key"` // Base64 Ed25519 seed; derived from auth.jwt_secret when empty
+}
+
+type LoggingConfig struct {
+	Format string `mapstructure:"format"` // json or text
+	Level  string `mapstructure:"level"`  // debug, info, warn or error
+}
+
+type TracingConfig struct {
+	Enabled     bool    `mapstructure:"enabled"`
+	Exporter    string  `mapstructure:"exporter"`     // otlp, jaeger or stdout
+	Endpoint    string  `mapstructure:"endpoint"`     // Collector host:port for otlp and jaeger (OTLP over HTTP)
+	Insecure    bool    `mapstructure:"insecure"`     // Send to the collector over plain HTTP
+	ServiceName string  `mapstructure:"service_name"`
+	SampleRatio float64 `mapstructure:"sample_ratio"` // Fraction of new traces recorded; incoming sampled parents are always followed
+}
+
+type HealthConfig struct {
+	Timeout        time.Duration `mapstructure:"timeout"`         // Per-dependency limit for /readyz checks
+	CheckYubicloud bool          `mapstructure:"check_yubicloud"` // Include YubiCloud in /readyz (reported, never fails readiness)
+}
+
+type AuthLogConfig struct {
+	BufferSize    int           `mapstructure:"buffer_size"`    // Entries queued for the background writer; 0 writes every entry inline
+	BatchSize     int           `mapstructure:"batch_size"`     // Queued entries are inserted as soon as this many are waiting
+	FlushInterval time.Duration `mapstructure:"flush_interval"` // ...and at least this often
+}
+
+type AlertingConfig struct {
+	EvaluateInterval time.Duration `mapstructure:"evaluate_interval"` // How often alert rules are evaluated; 0 disables alerting
+}
+
+// AnomaliesConfig configures the analyzer that flags unusual sign-ins and
+// activity for security review. Hours are in each user's timezone; the
+// unusual hours run from UnusualHoursStart up to UnusualHoursEnd, across
+// midnight when the end is earlier, and equal hours disable that check.
+type AnomaliesConfig struct {
+	AnalyzeInterval   time.Duration `mapstructure:"analyze_interval"`    // How often the analyzer runs; 0 disables it
+	Lookback          time.Duration `mapstructure:"lookback"`            // Sign-ins this recent are checked on each run
+	UnusualHoursStart int           `mapstructure:"unusual_hours_start"` // First unusual hour of the day, 0-23
+	UnusualHoursEnd   int           `mapstructure:"unusual_hours_end"`   // First usual hour after them, 0-23
+	OpenActivityMax   time.Duration `mapstructure:"open_activity_max"`   // Activities open longer are forgotten sign-outs
+	IPWindow          time.Duration `mapstructure:"ip_window"`           // Window in which sign-ins from distant networks are flagged
+	IPNetworks        int           `mapstructure:"ip_networks"`         // Distinct networks within ip_window that are flagged
+}
+
+// DevicesConfig limits the active devices a user holds in each device role.
+// Going over a maximum is refused; falling short of a minimum only warns, e.g.
+// that a user has no backup device. Analytics configures the device usage
+// report.
+type DevicesConfig struct {
+	Primary   DeviceRoleLimits      `mapstructure:"primary"`
+	Backup    DeviceRoleLimits      `mapstructure:"backup"`
+	Analytics DeviceAnalyticsConfig `mapstructure:"analytics"`
+}
+
+// UsersConfig declares the custom profile attributes users carry, such as an
+// employee ID, department or manager
+type UsersConfig struct {
+	Attributes []UserAttributeConfig `mapstructure:"attributes"`
+}
+
+// UserAttributeConfig is one custom user attribute. Values are checked against
+// it whenever a user is created or updated.
+type UserAttributeConfig struct {
+	Name     string   `mapstructure:"name"`     // Lower case letters, digits and underscores, e.g. cost_center
+	Type     string   `mapstructure:"type"`     // "string", "number", "boolean", "date" (YYYY-MM-DD) or "user" (a user ID, e.g. a manager)
+	Required bool     `mapstructure:"required"` // Every user must have a value
+	Enum     []string `mapstructure:"enum"`     // Allowed values of a string attribute; empty allows any
+}
+
+type DeviceRoleLimits struct {
+	Min int `mapstructure:"min"`
+	Max int `mapstructure:"max"` // 0 is unlimited
+}
+
+// DeviceAnalyticsConfig configures GET /devices/analytics and the device
+// report emailed to security admins
+type DeviceAnalyticsConfig struct {
+	UnusedDays     int           `mapstructure:"unused_days"`     // Active devices unused this many days are listed as deregistration candidates
+	ReportInterval time.Duration `mapstructure:"report_interval"` // How often the report is emailed, covering the interval before it; 0 disables the report
+	ReportEmails   []string      `mapstructure:"report_emails"`   // Security admins the report is sent to
+}
+
+// RoleLimits returns the limits for a device role, primary or backup
+func (c DevicesConfig) RoleLimits(role string) DeviceRoleLimits {
+	if role == "backup" {
+		return c.Backup
+	}
+	return c.Primary
+}
+
+// RecoveryConfig configures the single-use recovery codes that stand in for a
+// lost device at /auth/recovery
+type RecoveryConfig struct {
+	CodeCount     int           `mapstructure:"code_count"`     // Codes in each generated set
+	SessionExpiry time.Duration `mapstructure:"session_expiry"` // Lifetime of the read-only session a code opens
+	Permissions   []string      `mapstructure:"permissions"`    // The only permissions a recovery session can use
+}
+
+// BreakGlassConfig configures the sealed emergency credentials redeemed at
+// /auth/break-glass. Each use alerts the admins and must be reviewed, by
+// resolving the incident it opens, before the credential works again.
+type BreakGlassConfig struct {
+	SessionExpiry time.Duration `mapstructure:"session_expiry"` // Lifetime of the session a credential opens; refreshing does not extend it
+	AlertChannels []string      `mapstructure:"alert_channels"` // Alert channels told of each use by name; empty uses every active channel
+	AdminRole     string        `mapstructure:"admin_role"`     // Users with this role are emailed of each use; empty emails no one
 }
 
-// Load reads the configuration from config.yaml file
+// LoginNotificationsConfig configures the security emails sent when a user
+// signs in from a device or IP address not seen for them before. Their text is
+// the email.login_notification.* messages of the i18n catalogs.
+type LoginNotificationsConfig struct {
+	Enabled     bool     `mapstructure:"enabled"`      // Off opts the whole deployment out; new devices and IPs are still remembered
+	NewIPs      bool     `mapstructure:"new_ips"`      // Also notify of known devices used from a new IP address
+	ExemptRoles []string `mapstructure:"exempt_roles"` // Users with any of these roles, e.g. service accounts, are not emailed
+}
+
+// HRNotificationsConfig configures delivery of the HR notifications sent by
+// /hr-notification-rules. Failed deliveries are retried with a backoff that
+// doubles after each attempt.
+type HRNotificationsConfig struct {
+	MaxAttempts   int           `mapstructure:"max_attempts"`   // Deliveries tried before a notification is marked failed
+	RetryBackoff  time.Duration `mapstructure:"retry_backoff"`  // Wait before the first retry
+	RetryInterval time.Duration `mapstructure:"retry_interval"` // How often due retries are sent; 0 disables retries
+}
+
+// CalendarConfig configures the iCal activity feeds. Feed links are signed with
+// auth.jwt_secret, so rotating it revokes every link handed out.
+type CalendarConfig struct {
+	FeedURL  string        `mapstructure:"feed_url"`  // Public base URL of the API for feed links, e.g. https://yubiapp.example.com; links are relative when empty
+	FeedTTL  time.Duration `mapstructure:"feed_ttl"`  // Signed feed links expire after this; 0 never expires
+	PastDays int           `mapstructure:"past_days"` // How far back feeds go when no from is given
+}
+
+// ChatConfig configures the Slack and Microsoft Teams integration. Workspaces
+// and their OAuth app credentials are managed at /chat-workspaces.
+type ChatConfig struct {
+	SlackURL         string        `mapstructure:"slack_url"`          // Slack web and Web API base URL
+	GraphURL         string        `mapstructure:"graph_url"`          // Microsoft Graph API base URL
+	LoginURL         string        `mapstructure:"login_url"`          // Microsoft identity platform base URL that issues Teams app tokens
+	OAuthRedirectURL string        `mapstructure:"oauth_redirect_url"` // Public URL of /api/v1/integrations/slack/oauth/callback, as registered with the Slack app
+	RequestMaxAge    time.Duration `mapstructure:"request_max_age"`    // Slack requests signed longer ago than this are rejected as replays
+}
+
+// I18nConfig configures the languages error messages and emails are written
+// in. English, French and German catalogs are built in; <locale>.json files in
+// CatalogDir override their messages or add locales, e.g. es.json. Email and
+// notification messages can also be edited through /templates, which override
+// both.
+type I18nConfig struct {
+	DefaultLocale   string         `mapstructure:"default_locale"`   // Used when neither the user's locale nor Accept-Language matches a catalog
+	CatalogDir      string         `mapstructure:"catalog_dir"`      // Directory of custom <locale>.json catalogs, read at startup
+	TemplateRefresh time.Duration  `mapstructure:"template_refresh"` // How soon edits through /templates reach other API instances and the worker
+	Branding        BrandingConfig `mapstructure:"branding"`
+}
+
+// BrandingConfig is what messages show of the organization sending them,
+// through {{brand.ProductName}} and the like
+type BrandingConfig struct {
+	ProductName  string `mapstructure:"product_name"`
+	SupportEmail string `mapstructure:"support_email"` // Where users are told to turn for help
+	URL          string `mapstructure:"url"`           // The organization's or product's home page
+}
+
+// CLIConfig configures yubiapp-cli's remote mode, in which commands call the
+// API at ServerURL instead of using the database
+type CLIConfig struct {
+	ServerURL   string        `mapstructure:"server_url"`   // e.g. https://yubiapp.example.com; empty uses the database
+	DeviceType  string        `mapstructure:"device_type"`  // Device whose OTP is prompted for
+	SessionFile string        `mapstructure:"session_file"` // Where `login` stores the session; defaults to the user config directory
+	Timeout     time.Duration `mapstructure:"timeout"`      // Per API request
+}
+
+// Load reads the configuration from config.yaml, environment variables and
+// secret files, in increasing order of precedence, and validates it.
+//
+// Every setting can be given as YUBIAPP_<SECTION>_<KEY>, e.g.
+// YUBIAPP_AUTH_JWT_SECRET or YUBIAPP_SERVER_PORT; lists are comma-separated.
+// Appending _FILE (YUBIAPP_AUTH_JWT_SECRET_FILE=/run/secrets/jwt_secret) reads
+// the value from that file instead, for Docker and Kubernetes secrets. The
+// config file is optional when everything needed comes from the environment.
 func Load() (*Config, error) {
+	config, err := LoadUnvalidated()
+	if err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// LoadUnvalidated reads the configuration like Load but leaves validation to the
+// caller, for tools such as the remote CLI that only need some sections
+func LoadUnvalidated() (*Config, error) {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
 	viper.AddConfigPath(".")
@@ -85,30 +699,102 @@ func Load() (*Config, error) {
 
 	// Set defaults
 	setDefaults()
+	bindEnv()
 
+	return read()
+}
+
+// read (re)reads the config file and secret files and decodes the result
+func read() (*Config, error) {
 	if err := viper.ReadInConfig(); err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		var notFound viper.ConfigFileNotFoundError
+		if !errors.As(err, &notFound) {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+	}
+	if err := readSecretFiles(); err != nil {
+		return nil, err
 	}
 
 	var config Config
 	if err := viper.Unmarshal(&config); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
-
+	if len(config.Auth.RolePolicies) == 0 && viper.IsSet("auth.role_session_policies") {
+		if err := viper.UnmarshalKey("auth.role_session_policies", &config.Auth.RolePolicies); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal auth.role_session_policies: %w", err)
+		}
+	}
 	return &config, nil
 }
 
+// Reload re-reads the configuration and copies the settings that are safe to
+// change at runtime into current, returning the keys that changed. The other
+// settings need a restart; restartNeeded reports whether any of them differ.
+// Nothing is applied when the new configuration is invalid.
+func Reload(current *Config) (changed []string, restartNeeded bool, err error) {
+	next, err := read()
+	if err != nil {
+		return nil, false, err
+	}
+	if err := next.Validate(); err != nil {
+		return nil, false, err
+	}
+
+	reloadable := []struct {
+		key      string
+		from, to interface{}
+	}{
+		{"logging.level", &next.Logging.Level, &current.Logging.Level},
+		{"password.reset_rate_limit", &next.Password.ResetRateLimit, &current.Password.ResetRateLimit},
+		{"password.reset_rate_window", &next.Password.ResetRateWindow, &current.Password.ResetRateWindow},
+		{"machine_auth.decision_cache_ttl", &next.MachineAuth.DecisionCacheTTL, &current.MachineAuth.DecisionCacheTTL},
+		{"reports.max_sync_days", &next.Reports.MaxSyncDays, &current.Reports.MaxSyncDays},
+	}
+	for _, setting := range reloadable {
+		from, to := reflect.ValueOf(setting.from).Elem(), reflect.ValueOf(setting.to).Elem()
+		if reflect.DeepEqual(from.Interface(), to.Interface()) {
+			continue
+		}
+		to.Set(from)
+		changed = append(changed, setting.key)
+	}
+
+	// With the reloadable settings now equal, any remaining difference needs a restart
+	return changed, !reflect.DeepEqual(*next, *current), nil
+}
+
 // setDefaults sets default values for configuration
 func setDefaults() {
 	viper.SetDefault("server.host", "localhost")
 	viper.SetDefault("server.port", 8080)
 	viper.SetDefault("server.timeout", "30s")
 	viper.SetDefault("server.debug", false)
+	viper.SetDefault("server.shutdown_timeout", "30s")
+	viper.SetDefault("server.security_headers.enabled", true)
+	viper.SetDefault("server.security_headers.hsts_max_age", "8760h")
+	viper.SetDefault("server.security_headers.frame_options", "DENY")
+	viper.SetDefault("server.security_headers.content_security_policy", "default-src 'none'; frame-ancestors 'none'")
+	viper.SetDefault("server.security_headers.referrer_policy", "no-referrer")
+	viper.SetDefault("server.csrf.cookie_name", "yubiapp_csrf")
+	viper.SetDefault("server.csrf.header_name", "X-CSRF-Token")
+	viper.SetDefault("server.csrf.session_cookie", "yubiapp_session")
+	viper.SetDefault("server.csrf.secure", true)
+	viper.SetDefault("server.tls.reload_interval", "1m")
+	viper.SetDefault("server.tls.min_version", "1.2")
+	viper.SetDefault("server.tls.client_auth", "none")
+
+	viper.SetDefault("grpc.listen", ":9090")
 
 	viper.SetDefault("database.host", "localhost")
 	viper.SetDefault("database.port", 5432)
 	viper.SetDefault("database.ssl_mode", "disable")
+	viper.SetDefault("database.max_open_conns", 25)
+	viper.SetDefault("database.max_idle_conns", 10)
+	viper.SetDefault("database.conn_max_lifetime", "30m")
+	viper.SetDefault("database.conn_max_idle_time", "5m")
 
+	viper.SetDefault("redis.mode", "single")
 	viper.SetDefault("redis.host", "localhost")
 	viper.SetDefault("redis.port", 6379)
 	viper.SetDefault("redis.password", "")
@@ -119,8 +805,194 @@ func setDefaults() {
 	viper.SetDefault("auth.refresh_token_expiry", "720h")
 	viper.SetDefault("auth.access_token_expiry", "15m")
 	viper.SetDefault("auth.session_expiry", "24h")
+	viper.SetDefault("auth.impersonation_expiry", "1h")
+	viper.SetDefault("auth.session_binding", "lenient")
+	viper.SetDefault("auth.session_store", "redis")
+	viper.SetDefault("auth.session_cleanup_interval", "15m")
+	viper.SetDefault("auth.session_idle_timeout", "0s")
 
 	viper.SetDefault("yubikey.api_url", "https://api.yubico.com/wsapi/2.0/verify")
+	viper.SetDefault("yubikey.replay_cache_ttl", "24h")
+	viper.SetDefault("yubikey.fallback_urls", []string{})
+	viper.SetDefault("yubikey.timeout", "5s")
+	viper.SetDefault("yubikey.retries", 2)
+	viper.SetDefault("yubikey.retry_backoff", "200ms")
+	viper.SetDefault("yubikey.circuit_breaker.failures", 5)
+	viper.SetDefault("yubikey.circuit_breaker.cooldown", "30s")
+	viper.SetDefault("yubikey.degraded_mode.default", "deny")
+	viper.SetDefault("push.challenge_ttl", "60s")
+	viper.SetDefault("push.max_wait", "25s")
+	viper.SetDefault("push.number_matching", true)
+	viper.SetDefault("qr_login.challenge_ttl", "2m")
+	viper.SetDefault("qr_login.session_expiry", "15m")
+	viper.SetDefault("qr_login.max_wait", "25s")
+	viper.SetDefault("qr_login.read_only", true)
 
 	viper.SetDefault("email.smtp_port", 587)
+
+	viper.SetDefault("web.content_security_policy", "default-src 'self'; script-src 'self'; style-src 'self' 'unsafe-inline'; img-src 'self' data:; connect-src 'self'; object-src 'none'; base-uri 'self'; frame-ancestors 'none'")
+
+	viper.SetDefault("reports.max_sync_days", 31)
+
+	viper.SetDefault("activity.clock_skew", "5m")
+	viper.SetDefault("activity.max_offset", 10000)
+	viper.SetDefault("activity.rollup_interval", "1m")
+	viper.SetDefault("activity.occupancy_status_types", []string{"working", "break"})
+
+	viper.SetDefault("attendance.notify_interval", "15m")
+
+	viper.SetDefault("shifts.grace_minutes", 5)
+	viper.SetDefault("shifts.absent_after", "30m")
+	viper.SetDefault("shifts.early_window", "2h")
+	viper.SetDefault("shifts.notify_interval", "15m")
+	viper.SetDefault("holidays.category", "holiday")
+
+	// Door defaults
+	viper.SetDefault("doors.driver", "mock")
+	viper.SetDefault("doors.timeout", "5s")
+	viper.SetDefault("doors.unlock_seconds", 5)
+
+	// Machine auth defaults
+	viper.SetDefault("machine_auth.decision_cache_ttl", "60s")
+
+	// RADIUS defaults
+	viper.SetDefault("radius.enabled", false)
+	viper.SetDefault("radius.listen", ":1812")
+	viper.SetDefault("radius.action", "access")
+	viper.SetDefault("radius.require_message_authenticator", true)
+
+	// Retention defaults
+	viper.SetDefault("retention.purge_after", "0s")
+	viper.SetDefault("retention.purge_interval", "24h")
+	viper.SetDefault("retention.archive_interval", "24h")
+	viper.SetDefault("retention.archive_batch", 10000)
+	viper.SetDefault("retention.archive.s3.region", "us-east-1")
+	viper.SetDefault("partitions.maintenance_interval", "24h")
+	viper.SetDefault("partitions.premake_months", 3)
+
+	// Lifecycle defaults
+	viper.SetDefault("lifecycle.apply_interval", "1m")
+
+	viper.SetDefault("access_reviews.check_interval", "1h")
+	viper.SetDefault("access_reviews.interval", "0s")
+	viper.SetDefault("access_reviews.duration", "336h")
+	viper.SetDefault("access_reviews.reviewer", "manager")
+
+	// Scheduler defaults
+	viper.SetDefault("scheduler.check_interval", "30s")
+	viper.SetDefault("scheduler.run_timeout", "1h")
+
+	// Job queue defaults
+	viper.SetDefault("jobs.workers", 4)
+	viper.SetDefault("jobs.worker_concurrency", 8)
+	viper.SetDefault("jobs.max_attempts", 5)
+	viper.SetDefault("jobs.backoff_base", "10s")
+	viper.SetDefault("jobs.backoff_max", "1h")
+	viper.SetDefault("jobs.lease", "5m")
+	viper.SetDefault("jobs.poll_interval", "1s")
+	viper.SetDefault("jobs.key_prefix", "yubiapp:{jobs}:")
+
+	// Worker defaults
+	viper.SetDefault("worker.schedulers_in_api", true)
+	viper.SetDefault("worker.health_listen", ":8081")
+
+	// Authorization defaults
+	viper.SetDefault("authorization.default_read", "yubiapp:read")
+	viper.SetDefault("authorization.default_write", "yubiapp:write")
+	viper.SetDefault("authorization.network_override_permission", "yubiapp:network-override")
+
+	// Response signing defaults
+	viper.SetDefault("response_signing.enabled", true)
+
+	// Logging defaults
+	viper.SetDefault("logging.format", "json")
+	viper.SetDefault("logging.level", "info")
+
+	// Tracing defaults
+	viper.SetDefault("tracing.enabled", false)
+	viper.SetDefault("tracing.exporter", "otlp")
+	viper.SetDefault("tracing.endpoint", "localhost:4318")
+	viper.SetDefault("tracing.insecure", true)
+	viper.SetDefault("tracing.service_name", "yubiapp")
+	viper.SetDefault("tracing.sample_ratio", 1.0)
+
+	// Health check defaults
+	viper.SetDefault("health.timeout", "2s")
+	viper.SetDefault("health.check_yubicloud", false)
+
+	// Authentication log writer defaults
+	viper.SetDefault("auth_log.buffer_size", 4096)
+	viper.SetDefault("auth_log.batch_size", 200)
+	viper.SetDefault("auth_log.flush_interval", "500ms")
+	viper.SetDefault("alerting.evaluate_interval", "1m")
+
+	// Anomaly analyzer defaults: logins between 22:00 and 06:00, activities
+	// open for 16 hours, two networks within an hour
+	viper.SetDefault("anomalies.analyze_interval", "5m")
+	viper.SetDefault("anomalies.lookback", "1h")
+	viper.SetDefault("anomalies.unusual_hours_start", 22)
+	viper.SetDefault("anomalies.unusual_hours_end", 6)
+	viper.SetDefault("anomalies.open_activity_max", "16h")
+	viper.SetDefault("anomalies.ip_window", "1h")
+	viper.SetDefault("anomalies.ip_networks", 2)
+
+	// Device role limits: one primary device and at least one backup
+	viper.SetDefault("devices.primary.min", 1)
+	viper.SetDefault("devices.primary.max", 1)
+	viper.SetDefault("devices.backup.min", 1)
+	viper.SetDefault("devices.backup.max", 0)
+	viper.SetDefault("devices.analytics.unused_days", 90)
+	viper.SetDefault("permission_usage.track_interval", "5m")
+	viper.SetDefault("permission_usage.unused_days", 90)
+	viper.SetDefault("devices.analytics.report_interval", "0s")
+
+	// Recovery code defaults: recovery sessions can only read
+	viper.SetDefault("recovery.code_count", 10)
+	viper.SetDefault("recovery.session_expiry", "1h")
+	viper.SetDefault("recovery.permissions", []string{"yubiapp:read"})
+
+	// Break-glass defaults: an hour of admin access, announced everywhere
+	viper.SetDefault("break_glass.session_expiry", "1h")
+	viper.SetDefault("break_glass.alert_channels", []string{})
+	viper.SetDefault("break_glass.admin_role", "admin")
+
+	// Login notification defaults: email users of sign-ins from new devices and IPs
+	viper.SetDefault("login_notifications.enabled", true)
+	viper.SetDefault("login_notifications.new_ips", true)
+	viper.SetDefault("login_notifications.exempt_roles", []string{})
+
+	// HR notification delivery defaults
+	viper.SetDefault("hr_notifications.max_attempts", 5)
+	viper.SetDefault("hr_notifications.retry_backoff", "1m")
+	viper.SetDefault("hr_notifications.retry_interval", "1m")
+
+	// Calendar feed defaults: links never expire
+	viper.SetDefault("calendar.feed_ttl", "0s")
+	viper.SetDefault("calendar.past_days", 90)
+
+	// Chat integration defaults
+	viper.SetDefault("chat.slack_url", "https://slack.com")
+	viper.SetDefault("chat.graph_url", "https://graph.microsoft.com/v1.0")
+	viper.SetDefault("chat.login_url", "https://login.microsoftonline.com")
+	viper.SetDefault("chat.request_max_age", "5m")
+
+	// Messages are in English unless the user or request asks otherwise
+	viper.SetDefault("i18n.default_locale", "en")
+	viper.SetDefault("i18n.template_refresh", "1m")
+	viper.SetDefault("i18n.branding.product_name", "YubiApp")
+
+	// CLI remote mode defaults
+	viper.SetDefault("cli.device_type", "yubikey")
+	viper.SetDefault("cli.timeout", "30s")
+
+	// Password defaults
+	viper.SetDefault("password.min_length", 8)
+	viper.SetDefault("password.history", 5)
+	viper.SetDefault("password.bcrypt_cost", 10)
+	viper.SetDefault("password.max_age", "0s")
+	viper.SetDefault("password.max_failures", 5)
+	viper.SetDefault("password.lockout_duration", "15m")
+	viper.SetDefault("password.reset_token_ttl", "30m")
+	viper.SetDefault("password.reset_rate_limit", 3)
+	viper.SetDefault("password.reset_rate_window", "1h")
 } 
\ No newline at end of file
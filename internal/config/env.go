@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// EnvPrefix prefixes the environment variable of every setting
+const EnvPrefix = "YUBIAPP"
+
+// envKeys holds every setting bound to an environment variable, set by bindEnv
+var envKeys []string
+
+// bindEnv binds every setting of Config to YUBIAPP_<SECTION>_<KEY>. Viper only
+// consults the environment for keys it already knows, so keys without a
+// default or a config file entry have to be bound explicitly.
+func bindEnv() {
+	viper.SetEnvPrefix(EnvPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
+
+	envKeys = settingKeys(reflect.TypeOf(Config{}), "")
+	for _, key := range envKeys {
+		viper.BindEnv(key)
+	}
+}
+
+// settingKeys lists the dotted keys of t's fields, descending into nested
+// sections. Maps are left to the config file: their keys are data, not settings.
+func settingKeys(t reflect.Type, prefix string) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("mapstructure")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		key := prefix + tag
+		switch field.Type.Kind() {
+		case reflect.Struct:
+			keys = append(keys, settingKeys(field.Type, key+".")...)
+		case reflect.Map:
+		default:
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// envName returns the environment variable for a dotted key
+func envName(key string) string {
+	return EnvPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// readSecretFiles sets each key whose <VARIABLE>_FILE names a file to that
+// file's contents, minus the trailing newline editors and `echo` leave behind
+func readSecretFiles() error {
+	for _, key := range envKeys {
+		name := envName(key) + "_FILE"
+		path := os.Getenv(name)
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		viper.Set(key, strings.TrimRight(string(data), "\r\n"))
+	}
+	return nil
+}
@@ -0,0 +1,470 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// attributeNamePattern is what custom user attribute names look like; they
+// are used as JSON keys and in ?attr.<name>= list filters
+var attributeNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// countryCodePattern is an ISO 3166-1 alpha-2 country code
+var countryCodePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// ValidationError lists every problem found in a configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate checks the settings the server cannot run without or would
+// misbehave with, reporting them all at once with the key (and environment
+// variable) to fix
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	v.require("database.host", c.Database.Host)
+	v.require("database.name", c.Database.Name)
+	v.require("database.user", c.Database.User)
+	v.port("database.port", c.Database.Port)
+	if c.Database.MaxOpenConns < 0 || c.Database.MaxIdleConns < 0 {
+		v.add("database.max_open_conns", "pool sizes cannot be negative")
+	} else if c.Database.MaxOpenConns > 0 && c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		v.add("database.max_idle_conns", "cannot exceed database.max_open_conns (%d), got %d", c.Database.MaxOpenConns, c.Database.MaxIdleConns)
+	}
+	v.oneOf("redis.mode", c.Redis.Mode, "single", "sentinel", "cluster")
+	switch c.Redis.Mode {
+	case "single":
+		v.require("redis.host", c.Redis.Host)
+		v.port("redis.port", c.Redis.Port)
+	case "sentinel":
+		v.require("redis.master_name", c.Redis.MasterName)
+		if len(c.Redis.Addrs) == 0 {
+			v.add("redis.addrs", "must list the sentinels in sentinel mode")
+		}
+	case "cluster":
+		if len(c.Redis.Addrs) == 0 {
+			v.add("redis.addrs", "must list at least one node in cluster mode")
+		}
+		if c.Redis.DB != 0 {
+			v.add("redis.db", "must be 0 in cluster mode, got %d", c.Redis.DB)
+		}
+	}
+	if (c.Redis.TLS.CertFile == "") != (c.Redis.TLS.KeyFile == "") {
+		v.add("redis.tls.cert_file", "redis.tls.cert_file and redis.tls.key_file must be set together")
+	}
+	v.port("server.port", c.Server.Port)
+	v.positive("server.timeout", c.Server.Timeout)
+	if c.Server.SecurityHeaders.Enabled {
+		v.oneOf("server.security_headers.frame_options", c.Server.SecurityHeaders.FrameOptions, "DENY", "SAMEORIGIN")
+		if c.Server.SecurityHeaders.HSTSMaxAge < 0 {
+			v.add("server.security_headers.hsts_max_age", "cannot be negative, got %s", c.Server.SecurityHeaders.HSTSMaxAge)
+		}
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				v.add("server.trusted_proxies", "%q is not an IP address or CIDR", proxy)
+			}
+		}
+	}
+	if c.Server.CSRF.Enabled {
+		v.require("server.csrf.cookie_name", c.Server.CSRF.CookieName)
+		v.require("server.csrf.header_name", c.Server.CSRF.HeaderName)
+		v.require("server.csrf.session_cookie", c.Server.CSRF.SessionCookie)
+	}
+	if tls := c.Server.TLS; tls.Enabled {
+		v.require("server.tls.cert_file", tls.CertFile)
+		v.require("server.tls.key_file", tls.KeyFile)
+		if tls.ReloadInterval < 0 {
+			v.add("server.tls.reload_interval", "cannot be negative, got %s", tls.ReloadInterval)
+		}
+		v.oneOf("server.tls.min_version", tls.MinVersion, "1.2", "1.3")
+		v.oneOf("server.tls.client_auth", tls.ClientAuth, "none", "optional", "require")
+		if tls.ClientAuth != "none" {
+			v.require("server.tls.client_ca_file", tls.ClientCAFile)
+		}
+		for name, identity := range tls.ClientIdentities {
+			key := "server.tls.client_identities." + name
+			if identity.CommonName == "" && identity.DNSName == "" && identity.URI == "" && identity.Fingerprint == "" {
+				v.add(key, "needs at least one of common_name, dns_name, uri or fingerprint")
+			}
+			v.require(key+".user", identity.User)
+			if len(identity.Permissions) == 0 {
+				v.add(key+".permissions", "must list at least one permission")
+			}
+		}
+	}
+
+	v.require("auth.jwt_secret", c.Auth.JWTSecret)
+	v.positive("auth.token_expiry", c.Auth.TokenExpiry)
+	v.positive("auth.refresh_token_expiry", c.Auth.RefreshTokenExpiry)
+	v.positive("auth.access_token_expiry", c.Auth.AccessTokenExpiry)
+	v.positive("auth.session_expiry", c.Auth.SessionExpiry)
+	v.positive("auth.impersonation_expiry", c.Auth.ImpersonationExpiry)
+	v.oneOf("auth.session_binding", c.Auth.SessionBinding, "off", "lenient", "strict")
+	v.oneOf("auth.session_store", c.Auth.SessionStore, "redis", "memory", "postgres")
+	if c.Auth.SessionCleanupInterval < 0 {
+		v.add("auth.session_cleanup_interval", "cannot be negative, got %s", c.Auth.SessionCleanupInterval)
+	}
+	for role, policy := range c.Auth.RolePolicies {
+		key := "auth.role_policies." + role
+		if policy.IdleTimeout < 0 || policy.MaxLifetime < 0 {
+			v.add(key, "idle_timeout and max_lifetime cannot be negative")
+		}
+		for _, deviceType := range policy.DeviceTypes {
+			v.oneOf(key+".device_types", deviceType, "yubikey", "totp", "sms", "email", "push")
+		}
+	}
+
+	v.require("yubikey.api_url", c.Yubikey.APIURL)
+	v.positive("yubikey.timeout", c.Yubikey.Timeout)
+	if c.Yubikey.Retries < 0 || c.Yubikey.RetryBackoff < 0 {
+		v.add("yubikey.retries", "yubikey.retries and yubikey.retry_backoff cannot be negative")
+	}
+	if secretKey := c.Yubikey.SecretKey; secretKey != "" {
+		if _, err := base64.StdEncoding.DecodeString(secretKey); err != nil {
+			v.add("yubikey.secret_key", "must be the base64 API key issued with yubikey.client_id")
+		}
+	}
+	if proxyURL := c.Yubikey.ProxyURL; proxyURL != "" {
+		if parsed, err := url.Parse(proxyURL); err != nil || parsed.Host == "" {
+			v.add("yubikey.proxy_url", "must be a URL such as http://proxy:3128, got %q", proxyURL)
+		}
+	}
+	degradedPolicies := []string{"deny", "allow", "totp"}
+	v.oneOf("yubikey.degraded_mode.default", c.Yubikey.DegradedMode.Default, degradedPolicies...)
+	for permission, policy := range c.Yubikey.DegradedMode.Permissions {
+		v.oneOf("yubikey.degraded_mode.permissions."+permission, policy, degradedPolicies...)
+	}
+	for action, policy := range c.Yubikey.DegradedMode.Actions {
+		v.oneOf("yubikey.degraded_mode.actions."+action, policy, degradedPolicies...)
+	}
+	// Unverified OTPs are only kept from being used twice by the replay cache
+	if c.Yubikey.ReplayCacheTTL == 0 {
+		if c.Yubikey.DegradedMode.Default == "allow" {
+			v.add("yubikey.degraded_mode.default", "cannot be allow while yubikey.replay_cache_ttl is 0")
+		}
+		for permission, policy := range c.Yubikey.DegradedMode.Permissions {
+			if policy == "allow" {
+				v.add("yubikey.degraded_mode.permissions."+permission, "cannot be allow while yubikey.replay_cache_ttl is 0")
+			}
+		}
+		for action, policy := range c.Yubikey.DegradedMode.Actions {
+			if policy == "allow" {
+				v.add("yubikey.degraded_mode.actions."+action, "cannot be allow while yubikey.replay_cache_ttl is 0")
+			}
+		}
+	}
+	if breaker := c.Yubikey.CircuitBreaker; breaker.Failures < 0 {
+		v.add("yubikey.circuit_breaker.failures", "cannot be negative, got %d", breaker.Failures)
+	} else if breaker.Failures > 0 {
+		v.positive("yubikey.circuit_breaker.cooldown", breaker.Cooldown)
+	}
+	if c.Yubikey.ReplayCacheTTL < 0 {
+		v.add("yubikey.replay_cache_ttl", "cannot be negative, got %s", c.Yubikey.ReplayCacheTTL)
+	}
+	if c.Yubikey.Attestation.Required {
+		v.require("yubikey.attestation.ca_file", c.Yubikey.Attestation.CAFile)
+	}
+	if minFirmware := c.Yubikey.Attestation.MinFirmware; minFirmware != "" {
+		var major, minor, patch int
+		if n, _ := fmt.Sscanf(minFirmware, "%d.%d.%d", &major, &minor, &patch); n != 3 {
+			v.add("yubikey.attestation.min_firmware", "must be a version such as 5.4.3, got %q", minFirmware)
+		}
+	}
+	v.positive("push.challenge_ttl", c.Push.ChallengeTTL)
+	v.positive("push.max_wait", c.Push.MaxWait)
+	if c.Push.MaxWait >= c.Server.Timeout {
+		v.add("push.max_wait", "must be shorter than server.timeout (%s), which would cut long-polls off", c.Server.Timeout)
+	}
+	if apns := c.Push.APNs; apns.KeyFile != "" {
+		v.require("push.apns.key_id", apns.KeyID)
+		v.require("push.apns.team_id", apns.TeamID)
+		v.require("push.apns.topic", apns.Topic)
+	}
+	v.positive("qr_login.challenge_ttl", c.QRLogin.ChallengeTTL)
+	v.positive("qr_login.session_expiry", c.QRLogin.SessionExpiry)
+	v.positive("qr_login.max_wait", c.QRLogin.MaxWait)
+	if c.QRLogin.MaxWait >= c.Server.Timeout {
+		v.add("qr_login.max_wait", "must be shorter than server.timeout (%s), which would cut long-polls off", c.Server.Timeout)
+	}
+	if approvalURL := c.QRLogin.ApprovalURL; approvalURL != "" {
+		if parsed, err := url.Parse(approvalURL); err != nil || parsed.Host == "" {
+			v.add("qr_login.approval_url", "must be a URL such as https://app.example.com/qr-login, got %q", approvalURL)
+		}
+	}
+	if c.Activity.MaxOffset < 0 {
+		v.add("activity.max_offset", "cannot be negative, got %d", c.Activity.MaxOffset)
+	}
+	if c.Activity.RollupInterval < 0 {
+		v.add("activity.rollup_interval", "cannot be negative, got %s", c.Activity.RollupInterval)
+	}
+	if len(c.Activity.OccupancyStatusTypes) == 0 {
+		v.add("activity.occupancy_status_types", "must list at least one status type")
+	}
+	for _, statusType := range c.Activity.OccupancyStatusTypes {
+		v.oneOf("activity.occupancy_status_types", statusType, "working", "break", "leave", "travel", "other")
+	}
+	if c.Shifts.GraceMinutes < 0 {
+		v.add("shifts.grace_minutes", "cannot be negative, got %d", c.Shifts.GraceMinutes)
+	}
+	if c.Shifts.AbsentAfter <= 0 {
+		v.add("shifts.absent_after", "must be positive, got %s", c.Shifts.AbsentAfter)
+	}
+	if c.Shifts.EarlyWindow < 0 {
+		v.add("shifts.early_window", "cannot be negative, got %s", c.Shifts.EarlyWindow)
+	}
+	if c.Shifts.NotifyInterval < 0 {
+		v.add("shifts.notify_interval", "cannot be negative, got %s", c.Shifts.NotifyInterval)
+	}
+	for name, leaveType := range c.Leave.Types {
+		key := "leave.types." + name
+		if leaveType.AnnualDays < 0 {
+			v.add(key+".annual_days", "cannot be negative, got %g", leaveType.AnnualDays)
+		}
+		if leaveType.Accrual != "" {
+			v.oneOf(key+".accrual", leaveType.Accrual, "yearly", "monthly")
+		}
+		if leaveType.Insufficient != "" {
+			v.oneOf(key+".insufficient", leaveType.Insufficient, "block", "warn")
+		}
+	}
+	if country := c.Holidays.DefaultCountry; country != "" && !countryCodePattern.MatchString(country) {
+		v.add("holidays.default_country", "must be an ISO 3166-1 alpha-2 code like GB, got %q", country)
+	}
+	v.oneOf("doors.driver", c.Doors.Driver, "http", "mock")
+	if c.Doors.Driver == "http" {
+		v.require("doors.controller_url", c.Doors.ControllerURL)
+	}
+	if c.GRPC.Enabled {
+		v.require("grpc.listen", c.GRPC.Listen)
+	}
+	if c.Radius.Enabled {
+		v.require("radius.secret", c.Radius.Secret)
+		v.require("radius.listen", c.Radius.Listen)
+	}
+
+	if c.Password.MinLength < 1 {
+		v.add("password.min_length", "must be at least 1")
+	}
+	if c.Password.BcryptCost < 4 || c.Password.BcryptCost > 31 {
+		v.add("password.bcrypt_cost", "must be between 4 and 31, got %d", c.Password.BcryptCost)
+	}
+	if c.Password.ResetRateLimit > 0 {
+		v.positive("password.reset_rate_window", c.Password.ResetRateWindow)
+	}
+
+	v.oneOf("logging.format", strings.ToLower(c.Logging.Format), "json", "text")
+	v.oneOf("logging.level", strings.ToLower(c.Logging.Level), "debug", "info", "warn", "warning", "error")
+	if c.Tracing.Enabled {
+		v.oneOf("tracing.exporter", strings.ToLower(c.Tracing.Exporter), "otlp", "jaeger", "stdout")
+		if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+			v.add("tracing.sample_ratio", "must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+		}
+	}
+	v.positive("health.timeout", c.Health.Timeout)
+	if c.AuthLog.BufferSize > 0 {
+		if c.AuthLog.BatchSize < 1 {
+			v.add("auth_log.batch_size", "must be at least 1 when auth_log.buffer_size is set, got %d", c.AuthLog.BatchSize)
+		}
+		v.positive("auth_log.flush_interval", c.AuthLog.FlushInterval)
+	}
+
+	for _, role := range []string{"primary", "backup"} {
+		limits := c.Devices.RoleLimits(role)
+		if limits.Min < 0 || limits.Max < 0 {
+			v.add("devices."+role, "limits cannot be negative")
+		} else if limits.Max > 0 && limits.Min > limits.Max {
+			v.add("devices."+role+".min", "cannot exceed devices.%s.max (%d), got %d", role, limits.Max, limits.Min)
+		}
+	}
+
+	if c.Devices.Analytics.UnusedDays < 1 {
+		v.add("devices.analytics.unused_days", "must be at least 1, got %d", c.Devices.Analytics.UnusedDays)
+	}
+	if c.Devices.Analytics.ReportInterval > 0 {
+		if len(c.Devices.Analytics.ReportEmails) == 0 {
+			v.add("devices.analytics.report_emails", "is required when devices.analytics.report_interval is set")
+		}
+		v.require("email.smtp_host", c.Email.SMTPHost)
+	}
+
+	if c.PermissionUsage.TrackInterval < 0 {
+		v.add("permission_usage.track_interval", "cannot be negative, got %s", c.PermissionUsage.TrackInterval)
+	}
+	if c.PermissionUsage.UnusedDays < 1 {
+		v.add("permission_usage.unused_days", "must be at least 1, got %d", c.PermissionUsage.UnusedDays)
+	}
+
+	attributeNames := map[string]bool{}
+	for i, attribute := range c.Users.Attributes {
+		key := fmt.Sprintf("users.attributes.%d", i)
+		if !attributeNamePattern.MatchString(attribute.Name) {
+			v.add(key+".name", "must be lower case letters, digits and underscores starting with a letter, got %q", attribute.Name)
+		} else if attributeNames[attribute.Name] {
+			v.add(key+".name", "%q is declared twice", attribute.Name)
+		}
+		attributeNames[attribute.Name] = true
+		v.oneOf(key+".type", attribute.Type, "string", "number", "boolean", "date", "user")
+		if len(attribute.Enum) > 0 && attribute.Type != "string" {
+			v.add(key+".enum", "only string attributes can list allowed values")
+		}
+	}
+
+	if c.Retention.ArchiveInterval < 0 {
+		v.add("retention.archive_interval", "cannot be negative, got %s", c.Retention.ArchiveInterval)
+	}
+	archiving := false
+	for table, days := range c.Retention.Tables {
+		v.oneOf("retention.tables."+table, table, "authentication_logs", "user_activity_history")
+		if days < 0 {
+			v.add("retention.tables."+table, "cannot be negative, got %d", days)
+		}
+		archiving = archiving || days > 0
+	}
+	if archiving && c.Retention.ArchiveInterval > 0 {
+		if c.Retention.ArchiveBatch < 1 || c.Retention.ArchiveBatch > 50000 {
+			v.add("retention.archive_batch", "must be between 1 and 50000, got %d", c.Retention.ArchiveBatch)
+		}
+		if s3 := c.Retention.Archive.S3; s3.Bucket != "" {
+			v.require("retention.archive.s3.region", s3.Region)
+			v.require("retention.archive.s3.access_key_id", s3.AccessKeyID)
+			v.require("retention.archive.s3.secret_access_key", s3.SecretAccessKey)
+		} else {
+			v.require("retention.archive.dir", c.Retention.Archive.Dir)
+		}
+	}
+
+	if c.Partitions.MaintenanceInterval < 0 {
+		v.add("partitions.maintenance_interval", "cannot be negative, got %s", c.Partitions.MaintenanceInterval)
+	}
+	if c.Partitions.PremakeMonths < 1 || c.Partitions.PremakeMonths > 24 {
+		v.add("partitions.premake_months", "must be between 1 and 24, got %d", c.Partitions.PremakeMonths)
+	}
+
+	if c.AccessReviews.CheckInterval < 0 {
+		v.add("access_reviews.check_interval", "cannot be negative, got %s", c.AccessReviews.CheckInterval)
+	}
+	if c.AccessReviews.Interval < 0 {
+		v.add("access_reviews.interval", "cannot be negative, got %s", c.AccessReviews.Interval)
+	}
+	v.positive("access_reviews.duration", c.AccessReviews.Duration)
+	v.oneOf("access_reviews.reviewer", c.AccessReviews.Reviewer, "manager", "role_owner")
+
+	if c.Anomalies.AnalyzeInterval < 0 {
+		v.add("anomalies.analyze_interval", "cannot be negative, got %s", c.Anomalies.AnalyzeInterval)
+	}
+	v.positive("anomalies.lookback", c.Anomalies.Lookback)
+	if c.Anomalies.UnusualHoursStart < 0 || c.Anomalies.UnusualHoursStart > 23 {
+		v.add("anomalies.unusual_hours_start", "must be an hour between 0 and 23, got %d", c.Anomalies.UnusualHoursStart)
+	}
+	if c.Anomalies.UnusualHoursEnd < 0 || c.Anomalies.UnusualHoursEnd > 23 {
+		v.add("anomalies.unusual_hours_end", "must be an hour between 0 and 23, got %d", c.Anomalies.UnusualHoursEnd)
+	}
+	v.positive("anomalies.open_activity_max", c.Anomalies.OpenActivityMax)
+	v.positive("anomalies.ip_window", c.Anomalies.IPWindow)
+	if c.Anomalies.IPNetworks < 2 {
+		v.add("anomalies.ip_networks", "must be at least 2, got %d", c.Anomalies.IPNetworks)
+	}
+
+	if c.Recovery.CodeCount < 1 || c.Recovery.CodeCount > 100 {
+		v.add("recovery.code_count", "must be between 1 and 100, got %d", c.Recovery.CodeCount)
+	}
+	v.positive("recovery.session_expiry", c.Recovery.SessionExpiry)
+	v.positive("break_glass.session_expiry", c.BreakGlass.SessionExpiry)
+
+	if c.HRNotifications.MaxAttempts < 1 {
+		v.add("hr_notifications.max_attempts", "must be at least 1, got %d", c.HRNotifications.MaxAttempts)
+	}
+	v.positive("hr_notifications.retry_backoff", c.HRNotifications.RetryBackoff)
+
+	if c.Calendar.FeedTTL < 0 {
+		v.add("calendar.feed_ttl", "cannot be negative, got %s", c.Calendar.FeedTTL)
+	}
+	if c.Calendar.PastDays < 1 {
+		v.add("calendar.past_days", "must be at least 1, got %d", c.Calendar.PastDays)
+	}
+
+	v.positive("chat.request_max_age", c.Chat.RequestMaxAge)
+
+	v.require("i18n.default_locale", c.I18n.DefaultLocale)
+	v.positive("i18n.template_refresh", c.I18n.TemplateRefresh)
+	if brandURL := c.I18n.Branding.URL; brandURL != "" {
+		if parsed, err := url.Parse(brandURL); err != nil || parsed.Host == "" {
+			v.add("i18n.branding.url", "must be a URL such as https://example.com, got %q", brandURL)
+		}
+	}
+
+	if c.Scheduler.CheckInterval < 0 {
+		v.add("scheduler.check_interval", "cannot be negative, got %s", c.Scheduler.CheckInterval)
+	}
+	v.positive("scheduler.run_timeout", c.Scheduler.RunTimeout)
+
+	if c.Jobs.Workers < 0 {
+		v.add("jobs.workers", "cannot be negative, got %d", c.Jobs.Workers)
+	}
+	if c.Jobs.WorkerConcurrency < 1 {
+		v.add("jobs.worker_concurrency", "must be at least 1, got %d", c.Jobs.WorkerConcurrency)
+	}
+	if c.Jobs.MaxAttempts < 1 {
+		v.add("jobs.max_attempts", "must be at least 1, got %d", c.Jobs.MaxAttempts)
+	}
+	v.positive("jobs.backoff_base", c.Jobs.BackoffBase)
+	v.positive("jobs.backoff_max", c.Jobs.BackoffMax)
+	v.positive("jobs.lease", c.Jobs.Lease)
+	v.positive("jobs.poll_interval", c.Jobs.PollInterval)
+	if c.Jobs.KeyPrefix == "" {
+		v.add("jobs.key_prefix", "is required")
+	}
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
+
+// validator accumulates problems so they can all be reported together
+type validator struct {
+	problems []string
+}
+
+func (v *validator) add(key, format string, args ...interface{}) {
+	v.problems = append(v.problems, fmt.Sprintf("%s (%s): %s", key, envName(key), fmt.Sprintf(format, args...)))
+}
+
+func (v *validator) require(key, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.add(key, "is required")
+	}
+}
+
+func (v *validator) positive(key string, value time.Duration) {
+	if value <= 0 {
+		v.add(key, "must be a positive duration such as 30s or 15m, got %s", value)
+	}
+}
+
+func (v *validator) port(key string, value int) {
+	if value < 1 || value > 65535 {
+		v.add(key, "must be a port between 1 and 65535, got %d", value)
+	}
+}
+
+func (v *validator) oneOf(key, value string, allowed ...string) {
+	for _, option := range allowed {
+		if value == option {
+			return
+		}
+	}
+	v.add(key, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+}
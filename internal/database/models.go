@@ -14,6 +14,7 @@ type User struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	DeletedAt gorm.DeletedAt `gorm:"index"`
+	Version   int            `gorm:"not null;default:1"` // Bumped by every update; updates naming an older version are rejected
 
 	Email     string `gorm:"uniqueIndex"`
 	Username  string `gorm:"uniqueIndex"`
@@ -22,18 +23,47 @@ type User struct {
 	LastName  string
 	Active    bool `gorm:"default:true"`
 
-	Roles    []Role    `gorm:"many2many:user_roles;"`
-	Devices  []Device  `gorm:"foreignKey:UserID"`
+	// Lifecycle state; only active users can authenticate. See UserStateTransition.
+	State          string `gorm:"type:varchar(20);default:'active';check:state IN ('invited', 'active', 'suspended', 'leave', 'offboarded')"`
+	StateChangedAt *time.Time
+
+	UnixUsername string // Login name on machines; defaults to Username when empty
+
+	// Custom profile attributes (employee ID, department, ...) as declared in
+	// users.attributes; see UserAttributeSchema
+	Attributes pgtype.JSONB `gorm:"type:jsonb;default:'{}'::jsonb"`
+
+	// The user this user reports to. Managers can read their direct reports'
+	// activity and perform actions on their behalf.
+	ManagerID *uuid.UUID `gorm:"type:uuid;index"`
+
+	// Preferred language for error messages and emails, a BCP 47 tag such as
+	// fr or pt-BR; empty follows Accept-Language
+	Locale string `gorm:"type:varchar(35);not null;default:''"`
+
+	// IANA timezone, e.g. Europe/Paris, that summaries and timesheets count
+	// the user's days in; empty is UTC
+	Timezone string `gorm:"type:varchar(64);not null;default:''"`
+
+	// Password authentication; see PasswordHistory
+	PasswordChangedAt      *time.Time
+	FailedPasswordAttempts int `gorm:"default:0"`
+	LockedUntil            *time.Time
+
+	Roles   []Role   `gorm:"many2many:user_roles;"`
+	Devices []Device `gorm:"foreignKey:UserID"`
 }
 
 type Role struct {
 	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
+	Version   int `gorm:"not null;default:1"` // Bumped by every update; updates naming an older version are rejected
 
 	Name        string `gorm:"uniqueIndex"`
 	Description string
-	Active      bool `gorm:"default:true"`
+	Active      bool         `gorm:"default:true"`
+	OwnerID     *uuid.UUID   `gorm:"type:uuid"` // Reviews who holds the role in role_owner access reviews
 	Permissions []Permission `gorm:"many2many:role_permissions;"`
 }
 
@@ -43,10 +73,14 @@ type Resource struct {
 	UpdatedAt time.Time
 
 	Name       string `gorm:"uniqueIndex"`
-	Type       string // "server", "service", "database", "application"
+	Type       string // "server", "service", "database", "application", "door"
 	Location   string
 	Department string
 	Active     bool `gorm:"default:true"`
+
+	// CIDR ranges clients must connect from to use the resource's permissions;
+	// empty allows any network
+	AllowedNetworks pgtype.JSONB `gorm:"type:jsonb;default:'[]'::jsonb"`
 }
 
 type Permission struct {
@@ -61,14 +95,17 @@ type Permission struct {
 }
 
 type Action struct {
-	ID                  uuid.UUID     `gorm:"type:uuid;primary_key;"`
+	ID                  uuid.UUID `gorm:"type:uuid;primary_key;"`
 	CreatedAt           time.Time
 	UpdatedAt           time.Time
-	Name                string        `gorm:"uniqueIndex"`
-	ActivityType        string        `gorm:"type:varchar(20);default:'other';check:activity_type IN ('user', 'system', 'automated', 'other')"`
-	RequiredPermissions pgtype.JSONB  `gorm:"type:jsonb"`
-	Details             pgtype.JSONB  `gorm:"type:jsonb;default:'{}'::jsonb"`
-	Active              bool          `gorm:"default:true"`
+	Version             int          `gorm:"not null;default:1"` // Bumped by every update; updates naming an older version are rejected
+	Name                string       `gorm:"uniqueIndex"`
+	ActivityType        string       `gorm:"type:varchar(20);default:'other';check:activity_type IN ('user', 'system', 'automated', 'door', 'other')"`
+	RequiredPermissions pgtype.JSONB `gorm:"type:jsonb"`
+	Details             pgtype.JSONB `gorm:"type:jsonb;default:'{}'::jsonb"`
+	Active              bool         `gorm:"default:true"`
+	AllowSessionAuth    bool         `gorm:"default:false"` // Whether a session access token may perform the action instead of a device OTP
+	SessionPermission   string       // Extra permission required when performed with a session access token
 }
 
 type Device struct {
@@ -76,18 +113,40 @@ type Device struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	DeletedAt gorm.DeletedAt `gorm:"index"`
+	Version   int            `gorm:"not null;default:1"` // Bumped by every update; updates naming an older version are rejected
+
+	UserID            *uuid.UUID `gorm:"type:uuid"` // nil while the device is unassigned, e.g. in stock
+	User              User       `gorm:"foreignKey:UserID"`
+	Name              string     // Device name
+	Type              string     // "yubikey", "totp", "sms", "email", "push"
+	SerialNumber      string     // Device serial number
+	Identifier        string     // Device identifier (e.g., Yubikey public ID, phone number); unique per type among devices that are not deleted
+	Secret            string     // For TOTP/device-specific secrets
+	LastUsedAt        time.Time
+	VerifiedAt        time.Time
+	Active            bool
+	Properties        map[string]interface{} `gorm:"type:jsonb"`
+	LastOTPCounter    int64                  `gorm:"column:last_otp_counter;default:0"`    // Highest OTP counter seen: use counter << 8 | session counter
+	OTPUseCounter     int                    `gorm:"column:otp_use_counter;default:0"`     // Use counter of the last accepted OTP
+	OTPSessionCounter int                    `gorm:"column:otp_session_counter;default:0"` // Session counter of the last accepted OTP
+	CloneSuspectedAt  *time.Time             // Set when an OTP counted below LastOTPCounter; cleared by re-activation
+	PushPlatform      string                 // "fcm" or "apns", for push devices
+	PushToken         string                 // The app's FCM or APNs registration token
 
-	UserID      uuid.UUID `gorm:"type:uuid"`
-	User        User      `gorm:"foreignKey:UserID"`
-	Name        string    // Device name
-	Type        string    // "yubikey", "totp", "sms", "email"
-	SerialNumber string   // Device serial number
-	Identifier  string    // Device identifier (e.g., Yubikey public ID, phone number)
-	Secret      string    // For TOTP/device-specific secrets
-	LastUsedAt  time.Time
-	VerifiedAt  time.Time
-	Active      bool
-	Properties  map[string]interface{} `gorm:"type:jsonb"`
+	// Inventory details
+	FirmwareVersion string
+	FormFactor      string // e.g. "usb-a", "usb-c", "nano", "nfc"
+	AssetTag        string // Unique among devices that are not deleted
+	PurchaseOrder   string
+	PurchasedAt     *time.Time `gorm:"type:date"`
+	AttestedAt      *time.Time // Set when the serial, firmware and form factor come from a verified YubiKey attestation
+
+	// A user's primary device or a backup; config devices.<role> limits how many active devices of each a user holds
+	Role string `gorm:"type:varchar(20);default:'primary';check:role IN ('primary', 'backup')"`
+
+	// Lifecycle state; lost and retired devices are inactive. See DeviceService.TransitionDevice.
+	State          string `gorm:"type:varchar(20);default:'assigned';check:state IN ('in_stock', 'assigned', 'lost', 'retired')"`
+	StateChangedAt *time.Time
 }
 
 // Session represents a user session stored in Redis (not in PostgreSQL)
@@ -100,24 +159,53 @@ type Session struct {
 	CreatedAt    time.Time `json:"created_at"`
 	ExpiresAt    time.Time `json:"expires_at"`
 	IsValid      bool      `json:"is_valid"`
+
+	// Sliding expiry: the session lapses IdleTimeout after LastUsedAt (0 disables)
+	LastUsedAt    time.Time     `json:"last_used_at,omitempty"`
+	IdleTimeout   time.Duration `json:"idle_timeout,omitempty"`
+	LastIPAddress string        `json:"last_ip_address,omitempty"` // Client address of the latest use
+
+	// Set when an admin is acting as UserID; see Impersonation
+	ImpersonatorID *uuid.UUID `json:"impersonator_id,omitempty"`
+	ReadOnly       bool       `json:"read_only,omitempty"`
+
+	// Set when opened with a recovery code instead of a device; limited to recovery.permissions
+	Recovery bool `json:"recovery,omitempty"`
+
+	// Set when opened with a break-glass credential; may write without a
+	// device, and every request is written to the authentication log
+	BreakGlass bool `json:"break_glass,omitempty"`
+
+	// Set when opened on a shared terminal by approving its QR code from
+	// ApprovedBySession; lasts qr_login.session_expiry
+	CrossDevice       bool   `json:"cross_device,omitempty"`
+	ApprovedBySession string `json:"approved_by_session,omitempty"`
+
+	// Client the session was created from; see auth.session_binding
+	UserAgent   string `json:"user_agent,omitempty"`
+	IPAddress   string `json:"ip_address,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"` // SHA-256 of the client-supplied fingerprint
 }
 
 // SessionToken represents JWT token claims for sessions
 type SessionToken struct {
-	SessionID    string `json:"session_id"`
-	UserID       string `json:"user_id"`
-	DeviceID     string `json:"device_id"`
-	AccessCount  int    `json:"access_count"`
-	RefreshCount int    `json:"refresh_count"`
+	SessionID      string `json:"session_id"`
+	UserID         string `json:"user_id"`
+	DeviceID       string `json:"device_id"`
+	AccessCount    int    `json:"access_count"`
+	RefreshCount   int    `json:"refresh_count"`
+	ImpersonatorID string `json:"impersonator_id,omitempty"` // Actor when the session impersonates UserID
+	ReadOnly       bool   `json:"read_only,omitempty"`
 	jwt.RegisteredClaims
 }
 
 // RefreshToken represents JWT token claims for refresh tokens
 type RefreshToken struct {
-	SessionID    string `json:"session_id"`
-	UserID       string `json:"user_id"`
-	DeviceID     string `json:"device_id"`
-	RefreshCount int    `json:"refresh_count"`
+	SessionID      string `json:"session_id"`
+	UserID         string `json:"user_id"`
+	DeviceID       string `json:"device_id"`
+	RefreshCount   int    `json:"refresh_count"`
+	ImpersonatorID string `json:"impersonator_id,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -125,38 +213,40 @@ type AuthenticationLog struct {
 	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
 	CreatedAt time.Time
 
-	UserID     *uuid.UUID `gorm:"type:uuid"`
-	User       *User      `gorm:"foreignKey:UserID"`
-	DeviceID   uuid.UUID  `gorm:"type:uuid"`
-	Device     Device     `gorm:"foreignKey:DeviceID"`
-	ActionID   *uuid.UUID `gorm:"type:uuid"`
-	Type       string     // "login", "logout", "refresh", "mfa", "action"
-	Success    bool
-	IPAddress  string
-	UserAgent  string
-	OTP        string     // YubiKey OTP
-	Timestamp  time.Time  // Authentication timestamp
-	Details    pgtype.JSONB `gorm:"type:jsonb;default:'{}'::jsonb"`
+	UserID    *uuid.UUID `gorm:"type:uuid"`
+	User      *User      `gorm:"foreignKey:UserID"`
+	DeviceID  uuid.UUID  `gorm:"type:uuid"`
+	Device    Device     `gorm:"foreignKey:DeviceID"`
+	ActionID  *uuid.UUID `gorm:"type:uuid"`
+	Type      string     // "login", "logout", "refresh", "mfa", "action", "break_glass"
+	Success   bool
+	IPAddress string
+	UserAgent string
+	OTP       string       // YubiKey OTP
+	Timestamp time.Time    // Authentication timestamp
+	Details   pgtype.JSONB `gorm:"type:jsonb;default:'{}'::jsonb"`
+	RequestID string       `gorm:"type:varchar(128);index"` // X-Request-ID of the API request that logged it
 }
 
 type DeviceRegistration struct {
-	ID              uuid.UUID `gorm:"type:uuid;primary_key;"`
-	CreatedAt       time.Time
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
 
 	RegistrarUserID uuid.UUID `gorm:"type:uuid"`
 	RegistrarUser   User      `gorm:"foreignKey:RegistrarUserID"`
 
-	DeviceID        uuid.UUID `gorm:"type:uuid"`
-	Device          Device    `gorm:"foreignKey:DeviceID"`
+	DeviceID uuid.UUID `gorm:"type:uuid"`
+	Device   Device    `gorm:"foreignKey:DeviceID"`
 
-	TargetUserID    *uuid.UUID `gorm:"type:uuid"` // NULL for deregistration
-	TargetUser      *User      `gorm:"foreignKey:TargetUserID"`
+	TargetUserID *uuid.UUID `gorm:"type:uuid"` // NULL for deregistration
+	TargetUser   *User      `gorm:"foreignKey:TargetUserID"`
 
-	ActionType      string `gorm:"type:varchar(20);check:action_type IN ('register', 'deregister')"`
-	Reason          string
-	IPAddress       string
-	UserAgent       string
-	Notes           string
+	ActionType string `gorm:"type:varchar(20);check:action_type IN ('register', 'deregister', 'state_change')"`
+	State      string `gorm:"type:varchar(20)"` // New lifecycle state, for state_change
+	Reason     string
+	IPAddress  string
+	UserAgent  string
+	Notes      string
 }
 
 type Location struct {
@@ -164,12 +254,34 @@ type Location struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	DeletedAt gorm.DeletedAt `gorm:"index"`
+	Version   int            `gorm:"not null;default:1"` // Bumped by every update; updates naming an older version are rejected
 
 	Name        string `gorm:"uniqueIndex"`
 	Description string
 	Address     string
 	Type        string `gorm:"type:varchar(20);default:'office';check:type IN ('office', 'home', 'event', 'other')"`
 	Active      bool   `gorm:"default:true"`
+
+	// Optional geofence: a circle of RadiusMeters around Latitude/Longitude
+	Latitude     *float64
+	Longitude    *float64
+	RadiusMeters *float64
+
+	// CIDR ranges (e.g. office networks) used to place users at this location by client IP
+	Networks pgtype.JSONB `gorm:"type:jsonb;default:'[]'::jsonb"`
+
+	// IANA timezone of the location; activity here is shown in it rather
+	// than the user's. Empty uses the user's.
+	Timezone string `gorm:"type:varchar(64);not null;default:''"`
+
+	// ISO 3166-1 alpha-2 code of the country whose public holidays apply
+	// here, besides the location's own. Empty uses holidays.default_country.
+	Country string `gorm:"type:varchar(2);not null;default:''"`
+
+	// Optional number of people the location holds. Signing in to a full
+	// location is refused ("block") or answered with a warning ("warn").
+	Capacity     *int   `gorm:"check:capacity > 0"`
+	CapacityMode string `gorm:"type:varchar(10);not null;default:'warn';check:capacity_mode IN ('warn', 'block')"`
 }
 
 type UserStatus struct {
@@ -177,6 +289,7 @@ type UserStatus struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	DeletedAt gorm.DeletedAt `gorm:"index"`
+	Version   int            `gorm:"not null;default:1"` // Bumped by every update; updates naming an older version are rejected
 
 	Name        string `gorm:"uniqueIndex"`
 	Description string
@@ -189,17 +302,25 @@ type UserActivityHistory struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 
-	UserID       uuid.UUID `gorm:"type:uuid;not null"`
-	User         User      `gorm:"foreignKey:UserID"`
-	ActionID     uuid.UUID `gorm:"type:uuid;not null"`
-	Action       Action    `gorm:"foreignKey:ActionID"`
-	FromDateTime time.Time `gorm:"not null"`
-	ToDateTime   *time.Time `gorm:"type:timestamp"`
-	LocationID   *uuid.UUID `gorm:"type:uuid"`
-	Location     *Location `gorm:"foreignKey:LocationID"`
-	StatusID     *uuid.UUID `gorm:"type:uuid"`
-	Status       *UserStatus `gorm:"foreignKey:StatusID"`
+	UserID       uuid.UUID    `gorm:"type:uuid;not null"`
+	User         User         `gorm:"foreignKey:UserID"`
+	ActionID     uuid.UUID    `gorm:"type:uuid;not null"`
+	Action       Action       `gorm:"foreignKey:ActionID"`
+	FromDateTime time.Time    `gorm:"column:from_datetime;not null"`
+	ToDateTime   *time.Time   `gorm:"column:to_datetime;type:timestamp"`
+	LocationID   *uuid.UUID   `gorm:"type:uuid"`
+	Location     *Location    `gorm:"foreignKey:LocationID"`
+	StatusID     *uuid.UUID   `gorm:"type:uuid"`
+	Status       *UserStatus  `gorm:"foreignKey:StatusID"`
 	Details      pgtype.JSONB `gorm:"type:jsonb;default:'{}'::jsonb"`
+
+	// Zone the times are expressed in when read: the location's, else the user's
+	Timezone string `gorm:"-"`
+}
+
+// TableName keeps the singular table name the migrations and report queries use
+func (UserActivityHistory) TableName() string {
+	return "user_activity_history"
 }
 
 // UserRole represents the many-to-many relationship between users and roles
@@ -212,8 +333,771 @@ type UserRole struct {
 
 // RolePermission represents the many-to-many relationship between roles and permissions
 type RolePermission struct {
-	RoleID       uuid.UUID `gorm:"type:uuid;primaryKey"`
-	PermissionID uuid.UUID `gorm:"type:uuid;primaryKey"`
-	Role         Role      `gorm:"foreignKey:RoleID"`
+	RoleID       uuid.UUID  `gorm:"type:uuid;primaryKey"`
+	PermissionID uuid.UUID  `gorm:"type:uuid;primaryKey"`
+	Role         Role       `gorm:"foreignKey:RoleID"`
 	Permission   Permission `gorm:"foreignKey:PermissionID"`
-} 
\ No newline at end of file
+}
+
+// ReportJob tracks a report that is generated asynchronously. The rendered
+// output is stored in Result once the job completes.
+type ReportJob struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	RequestedByID *uuid.UUID   `gorm:"type:uuid"`
+	RequestedBy   *User        `gorm:"foreignKey:RequestedByID"`
+	ReportType    string       `gorm:"type:varchar(30);not null"` // "timesheet" or "custom"
+	Format        string       `gorm:"type:varchar(10);not null"` // "csv", "pdf", "json"
+	DefinitionID  *uuid.UUID   `gorm:"type:uuid;index"`           // Saved report definition the job ran, if any
+	Parameters    pgtype.JSONB `gorm:"type:jsonb;default:'{}'::jsonb"`
+	Status        string       `gorm:"type:varchar(20);default:'pending';check:status IN ('pending', 'running', 'completed', 'failed')"`
+	Error         string
+	Result        []byte `gorm:"type:bytea"`
+	CompletedAt   *time.Time
+}
+
+// ReportDefinition is a custom activity report saved to be run again, by hand
+// or on its cron schedule. Definition holds the report's dimensions, measures,
+// filters and format.
+type ReportDefinition struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	Name        string       `gorm:"type:varchar(100);not null;uniqueIndex"`
+	Description string       `gorm:"not null;default:''"`
+	Definition  pgtype.JSONB `gorm:"type:jsonb;not null"`
+	Schedule    string       `gorm:"type:varchar(100);not null;default:''"` // Cron expression; empty runs only by hand
+	Active      bool         `gorm:"default:true"`
+	Version     int          `gorm:"not null;default:1"` // Bumped by every update; updates naming an older version are rejected
+	NextRunAt   *time.Time   // Next scheduled run; NULL when unscheduled or inactive
+	LastRunAt   *time.Time
+	CreatedByID *uuid.UUID `gorm:"type:uuid"` // NULL once the user has been deleted
+	CreatedBy   *User      `gorm:"foreignKey:CreatedByID;constraint:OnDelete:SET NULL"`
+}
+
+// LegalHold exempts a user's records and/or a date range from retention purges
+// and anonymization until it is released.
+type LegalHold struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	UserID       *uuid.UUID `gorm:"type:uuid;index"` // NULL applies to all users within the date range
+	User         *User      `gorm:"foreignKey:UserID"`
+	FromDateTime *time.Time `gorm:"column:from_datetime"` // NULL means no lower bound
+	ToDateTime   *time.Time `gorm:"column:to_datetime"`   // NULL means no upper bound
+	Reason       string     `gorm:"not null"`
+
+	PlacedByID uuid.UUID `gorm:"type:uuid;not null"`
+	PlacedBy   User      `gorm:"foreignKey:PlacedByID"`
+
+	ReleasedAt    *time.Time `gorm:"index"`
+	ReleasedByID  *uuid.UUID `gorm:"type:uuid"`
+	ReleasedBy    *User      `gorm:"foreignKey:ReleasedByID"`
+	ReleaseReason string
+}
+
+// AttendancePolicy defines the expected working pattern for users with a role
+// and/or at a location. Policies without a role or location apply to everyone.
+type AttendancePolicy struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	Name        string `gorm:"uniqueIndex"`
+	Description string
+
+	RoleID     *uuid.UUID `gorm:"type:uuid"` // NULL applies to all roles
+	Role       *Role      `gorm:"foreignKey:RoleID"`
+	LocationID *uuid.UUID `gorm:"type:uuid"` // NULL applies to all locations
+	Location   *Location  `gorm:"foreignKey:LocationID"`
+
+	ExpectedDailyHours float64 `gorm:"not null"`
+	WorkDays           string  `gorm:"default:'mon,tue,wed,thu,fri'"` // Comma-separated weekday abbreviations
+	StartTime          string  `gorm:"type:varchar(5)"`               // "HH:MM"; empty disables late sign-in checks
+	GraceMinutes       int     `gorm:"default:0"`
+	Timezone           string  `gorm:"default:'UTC'"`
+
+	// Notifications are sent when a day's overtime or undertime exceeds these thresholds, or on a late sign-in
+	OvertimeThresholdHours  float64 `gorm:"default:0"`
+	UndertimeThresholdHours float64 `gorm:"default:0"`
+	NotifyWebhookURL        string
+	NotifyEmails            string // Comma-separated recipients
+
+	Active bool `gorm:"default:true"`
+}
+
+// AttendanceNotification records a policy breach that has been notified, so
+// each breach is only sent once.
+type AttendanceNotification struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+
+	PolicyID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_attendance_notification"`
+	UserID   uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_attendance_notification"`
+	Date     string    `gorm:"type:varchar(10);not null;uniqueIndex:idx_attendance_notification"` // YYYY-MM-DD
+	Type     string    `gorm:"type:varchar(20);not null;uniqueIndex:idx_attendance_notification;check:type IN ('overtime', 'undertime', 'late')"`
+	Error    string
+}
+
+// Webhook subscribes an external URL to event bus events such as
+// permissions.invalidated.
+type Webhook struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	Name       string       `gorm:"uniqueIndex"`
+	URL        string       `gorm:"not null"`
+	EventTypes pgtype.JSONB `gorm:"type:jsonb;default:'[]'::jsonb"` // Event types to deliver; "*" for all
+	Secret     string       // HMAC-SHA256 signing secret; empty disables signing
+	Active     bool         `gorm:"default:true"`
+
+	LastDeliveryAt *time.Time
+	LastError      string
+}
+
+// DoorEvent records an unlock attempt on a door resource, linked to the
+// authentication log entry of the action that triggered it
+type DoorEvent struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+
+	ResourceID          uuid.UUID  `gorm:"type:uuid;index"`
+	Resource            Resource   `gorm:"foreignKey:ResourceID"`
+	UserID              *uuid.UUID `gorm:"type:uuid;index"`
+	User                *User      `gorm:"foreignKey:UserID"`
+	ActionID            *uuid.UUID `gorm:"type:uuid"`
+	AuthenticationLogID *uuid.UUID `gorm:"type:uuid;index"`
+	Result              string     `gorm:"type:varchar(20);check:result IN ('unlocked', 'failed')"`
+	Driver              string     `gorm:"type:varchar(20)"`
+	ControllerRef       string
+	Error               string
+}
+
+// Kiosk is a shared badge-in terminal bound to a location. It authenticates with
+// client credentials and may only perform its whitelisted actions.
+type Kiosk struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	Name           string       `gorm:"uniqueIndex"`
+	LocationID     uuid.UUID    `gorm:"type:uuid;not null;index"`
+	Location       Location     `gorm:"foreignKey:LocationID"`
+	ClientID       string       `gorm:"type:varchar(64);uniqueIndex;not null"`
+	SecretHash     string       `gorm:"type:varchar(64);not null"`      // SHA-256 of the client secret, hex encoded
+	AllowedActions pgtype.JSONB `gorm:"type:jsonb;default:'[]'::jsonb"` // Action names the kiosk may perform
+	Active         bool         `gorm:"default:true"`
+
+	LastSeenAt *time.Time
+}
+
+// PrivacyRequest is the audit record of a GDPR data export or erasure of a user
+type PrivacyRequest struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+
+	Type          string     `gorm:"type:varchar(20);not null;check:type IN ('export', 'erase')"`
+	SubjectUserID *uuid.UUID `gorm:"type:uuid;index"` // NULL once the user has been purged
+	SubjectUser   *User      `gorm:"foreignKey:SubjectUserID;constraint:OnDelete:SET NULL"`
+	RequestedByID uuid.UUID  `gorm:"type:uuid;not null"`
+	RequestedBy   User       `gorm:"foreignKey:RequestedByID"`
+	Reason        string
+	Status        string `gorm:"type:varchar(20);not null;check:status IN ('completed', 'rejected', 'failed')"`
+	Error         string
+	Summary       pgtype.JSONB `gorm:"type:jsonb;default:'{}'::jsonb"` // Record counts exported or anonymized
+	IPAddress     string
+	UserAgent     string
+}
+
+// UserStateTransition moves a user between lifecycle states. Transitions with a
+// future EffectiveAt stay pending until they are due.
+type UserStateTransition struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	UserID        uuid.UUID `gorm:"type:uuid;not null;index"`
+	User          User      `gorm:"foreignKey:UserID"`
+	FromState     string    `gorm:"type:varchar(20)"` // State when applied (or expected, while pending)
+	ToState       string    `gorm:"type:varchar(20);not null"`
+	Reason        string    `gorm:"not null"`
+	EffectiveAt   time.Time `gorm:"not null;index"`
+	Status        string    `gorm:"type:varchar(20);not null;default:'pending';check:status IN ('pending', 'applied', 'cancelled')"`
+	AppliedAt     *time.Time
+	Note          string     // Why a transition was cancelled
+	RequestedByID *uuid.UUID `gorm:"type:uuid"` // NULL when made from the CLI
+	RequestedBy   *User      `gorm:"foreignKey:RequestedByID"`
+}
+
+// PasswordHistory keeps a user's previous password hashes so they cannot be reused
+type PasswordHistory struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+
+	UserID uuid.UUID `gorm:"type:uuid;not null;index"`
+	User   User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	Hash   string    `gorm:"not null"`
+}
+
+// RecoveryCode is one of a user's single-use codes for signing in without their
+// device. Only the SHA-256 hash of the code is kept.
+type RecoveryCode struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+
+	UserID   uuid.UUID  `gorm:"type:uuid;not null;index"`
+	User     User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	CodeHash string     `gorm:"uniqueIndex;not null"`
+	UsedAt   *time.Time // Set once the code has been redeemed
+	UsedIP   string
+}
+
+// SecurityIncident records an event an admin has to follow up, such as a user
+// signing in with a recovery code because their device is lost
+type SecurityIncident struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	User      User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	Type      string    `gorm:"type:varchar(50);not null"`
+	Details   string
+	SessionID string // Session opened by the event, if any
+	IPAddress string
+	UserAgent string
+
+	Status              string `gorm:"type:varchar(20);default:'open';index;check:status IN ('open', 'resolved')"`
+	ResolvedAt          *time.Time
+	ResolvedByID        *uuid.UUID `gorm:"type:uuid"`
+	ReplacementDeviceID *uuid.UUID `gorm:"type:uuid"` // Device issued to the user before the incident could be resolved
+	ResolutionNote      string
+}
+
+// BreakGlassCredential is a sealed emergency credential that signs in as
+// UserID, a pre-provisioned admin account, without a device. Only the SHA-256
+// hash of the secret is kept. Each use opens a security incident, and the
+// credential cannot be used again until that incident is resolved.
+type BreakGlassCredential struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	Name        string `gorm:"uniqueIndex;not null"`
+	Description string
+	UserID      uuid.UUID  `gorm:"type:uuid;not null;index"`
+	User        User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	SecretHash  string     `gorm:"uniqueIndex;not null"`
+	SealedAt    time.Time  `gorm:"not null"`
+	SealedByID  *uuid.UUID `gorm:"type:uuid"`
+
+	LastUsedAt *time.Time
+	LastUsedIP string
+	IncidentID *uuid.UUID        `gorm:"type:uuid"` // Incident opened by the last use
+	Incident   *SecurityIncident `gorm:"foreignKey:IncidentID"`
+}
+
+// HRNotificationRule notifies HR by email or webhook when a user performs an
+// action, or starts an activity with a user status, that it matches
+type HRNotificationRule struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	Name            string `gorm:"uniqueIndex"`
+	Description     string
+	TriggerType     string `gorm:"type:varchar(20);not null;check:trigger_type IN ('action', 'status')"`
+	TriggerName     string `gorm:"not null"` // Action name, or user status name or type
+	Channel         string `gorm:"type:varchar(20);not null;check:channel IN ('email', 'webhook')"`
+	Target          string `gorm:"not null"` // Comma-separated recipients (email) or URL (webhook)
+	Secret          string // HMAC-SHA256 signing secret for webhooks; empty disables signing
+	SubjectTemplate string // text/template; a default is used when empty
+	BodyTemplate    string // text/template; a default is used when empty
+	AllowOptOut     bool   `gorm:"default:false"` // Whether users may opt out of this rule
+	Active          bool   `gorm:"default:true"`
+}
+
+// HRNotification is the log of one notification sent, or to be retried, for a rule
+type HRNotification struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	RuleID      uuid.UUID          `gorm:"type:uuid;not null;index"`
+	Rule        HRNotificationRule `gorm:"foreignKey:RuleID;constraint:OnDelete:CASCADE"`
+	UserID      uuid.UUID          `gorm:"type:uuid;not null;index"`
+	User        User               `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	TriggerType string             // action or status
+	TriggerName string             // The action or user status that fired the rule
+	Channel     string
+	Target      string
+	Subject     string
+	Body        string // Email text, or the JSON webhook payload
+
+	Status        string `gorm:"type:varchar(20);default:'pending';index;check:status IN ('pending', 'sent', 'failed', 'opted_out')"`
+	Attempts      int    `gorm:"default:0"`
+	LastError     string
+	NextAttemptAt *time.Time // When a pending notification is retried
+	SentAt        *time.Time
+}
+
+// HRNotificationOptOut opts a user out of a rule that allows it
+type HRNotificationOptOut struct {
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey"`
+	RuleID    uuid.UUID `gorm:"type:uuid;primaryKey"`
+	CreatedAt time.Time
+}
+
+// ChatWorkspace is a Slack workspace or Microsoft Teams tenant whose users'
+// statuses follow the actions they perform, and which can query presence with
+// the /yubiapp command
+type ChatWorkspace struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	Name           string       `gorm:"uniqueIndex"`
+	Provider       string       `gorm:"type:varchar(10);not null;check:provider IN ('slack', 'teams')"`
+	ExternalID     string       `gorm:"type:varchar(100);not null;uniqueIndex"` // Slack team ID or Teams (Azure AD) tenant ID
+	ClientID       string       // OAuth app client ID
+	ClientSecret   string       // OAuth app client secret
+	SigningSecret  string       // Slack signing secret, or the Teams outgoing webhook security token
+	StatusMappings pgtype.JSONB `gorm:"type:jsonb;default:'{}'::jsonb"` // Action name -> status to set
+	Active         bool         `gorm:"default:true"`
+}
+
+// ChatUserLink links a user to their account in a chat workspace
+type ChatUserLink struct {
+	WorkspaceID    uuid.UUID     `gorm:"type:uuid;primaryKey"`
+	Workspace      ChatWorkspace `gorm:"foreignKey:WorkspaceID;constraint:OnDelete:CASCADE"`
+	UserID         uuid.UUID     `gorm:"type:uuid;primaryKey"`
+	User           User          `gorm:"foreignKey:UserID"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	ExternalUserID string `gorm:"type:varchar(100);not null"` // Slack user ID or Teams (Azure AD) object ID
+	AccessToken    string // Slack user token from the OAuth flow; Teams uses the app's credentials
+
+	LastStatusAt *time.Time // Last status update, successful or not
+	LastError    string
+}
+
+// ActionApproval is a performance of a co-signed action held until a second
+// user with the action's co-sign permission approves it with their own device
+type ActionApproval struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	ActionID    uuid.UUID    `gorm:"type:uuid;not null;index"`
+	Action      Action       `gorm:"foreignKey:ActionID;constraint:OnDelete:CASCADE"`
+	UserID      uuid.UUID    `gorm:"type:uuid;not null;index"`
+	User        User         `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	DeviceID    uuid.UUID    `gorm:"type:uuid"`
+	RequestBody pgtype.JSONB `gorm:"type:jsonb;default:'{}'::jsonb"` // Request body the action was performed with
+	Details     pgtype.JSONB `gorm:"type:jsonb;default:'{}'::jsonb"` // Checked details the action is logged with once approved
+	IPAddress   string
+	UserAgent   string
+	RequestID   string `gorm:"type:varchar(128)"`
+
+	Status           string     `gorm:"type:varchar(20);default:'pending';index;check:status IN ('pending', 'approved', 'rejected', 'expired')"`
+	ExpiresAt        time.Time  // Pending approvals expire at this time
+	ApproverID       *uuid.UUID `gorm:"type:uuid"`
+	Approver         *User      `gorm:"foreignKey:ApproverID"`
+	ApproverDeviceID *uuid.UUID `gorm:"type:uuid"`
+	DecidedAt        *time.Time
+	Note             string // Reason given for a rejection
+}
+
+// ActionRun records one run of an automated action, by its schedule or by hand
+type ActionRun struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+
+	ActionID      uuid.UUID  `gorm:"type:uuid;not null;index"`
+	Action        Action     `gorm:"foreignKey:ActionID;constraint:OnDelete:CASCADE"`
+	Trigger       string     `gorm:"type:varchar(20);not null;check:trigger IN ('schedule', 'manual')"`
+	TriggeredByID *uuid.UUID `gorm:"type:uuid"` // User who started a manual run
+	ScheduledFor  *time.Time // Cron time a scheduled run was due
+	Status        string     `gorm:"type:varchar(20);default:'running';index;check:status IN ('running', 'succeeded', 'failed', 'skipped')"`
+	StartedAt     time.Time
+	FinishedAt    *time.Time
+	Result        string // Outcome reported by the action's system task
+	Error         string
+	SideEffects   pgtype.JSONB `gorm:"type:jsonb;default:'[]'::jsonb"`
+}
+
+// ActivityRollup is a user's closed activity hours and sign-ins for one day
+// in the user's timezone, kept up to date from activity_rollup_queue by the
+// rollup job. Summaries and timesheets read whole days from rollups.
+type ActivityRollup struct {
+	Day       time.Time `gorm:"type:date;primaryKey"`
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey"`
+	User      User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	UpdatedAt time.Time
+	Timezone  string `gorm:"type:varchar(64)"` // The user's when rolled up
+
+	TotalHours  float64
+	Hours       pgtype.JSONB `gorm:"type:jsonb;default:'{}'::jsonb"` // Hours by category
+	StatusHours pgtype.JSONB `gorm:"type:jsonb;default:'{}'::jsonb"` // Hours by user status ID, "" for none
+	SignIns     int
+	SignOuts    int
+	LocationIDs pgtype.JSONB `gorm:"type:jsonb;default:'[]'::jsonb"` // Locations of the day's activities
+}
+
+// SessionRecord is a serialized Session kept by the postgres session store
+// (auth.session_store), for deployments without Redis
+type SessionRecord struct {
+	ID        string       `gorm:"primaryKey"`
+	UserID    string       `gorm:"index"`
+	Data      pgtype.JSONB `gorm:"type:jsonb;not null"`
+	ExpiresAt time.Time    `gorm:"not null;index"`
+	UpdatedAt time.Time
+}
+
+// PasswordResetLog audits self-service password reset requests and their use
+type PasswordResetLog struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+
+	UserID     *uuid.UUID `gorm:"type:uuid;index"` // NULL when the identifier matched no user
+	User       *User      `gorm:"foreignKey:UserID;constraint:OnDelete:SET NULL"`
+	Identifier string     // Username or email given in the request
+	Event      string     `gorm:"type:varchar(20);not null;check:event IN ('requested', 'rate_limited', 'completed', 'failed')"`
+	Reason     string     // Why a request sent nothing or a reset failed
+	IPAddress  string
+	UserAgent  string
+	RequestID  string `gorm:"type:varchar(128);index"` // X-Request-ID of the API request that logged it
+}
+
+// Impersonation records an admin minting a session that acts as another user
+type Impersonation struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+
+	SessionID     string     `gorm:"uniqueIndex;not null"`
+	ActorID       uuid.UUID  `gorm:"type:uuid;not null;index"`
+	Actor         User       `gorm:"foreignKey:ActorID;constraint:OnDelete:CASCADE"`
+	ActorDeviceID uuid.UUID  `gorm:"type:uuid"`
+	SubjectUserID uuid.UUID  `gorm:"type:uuid;not null;index"`
+	SubjectUser   User       `gorm:"foreignKey:SubjectUserID;constraint:OnDelete:CASCADE"`
+	Reason        string     `gorm:"not null"`
+	ReadOnly      bool       `gorm:"default:true"`
+	ExpiresAt     time.Time  `gorm:"not null"`
+	EndedAt       *time.Time // Set when ended early; otherwise the session ran until ExpiresAt
+	EndedByID     *uuid.UUID `gorm:"type:uuid"`
+	IPAddress     string
+	UserAgent     string
+}
+
+// AlertChannel is a destination alerts are delivered to
+type AlertChannel struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	Name   string `gorm:"uniqueIndex"`
+	Type   string `gorm:"type:varchar(20);not null;check:type IN ('email', 'webhook', 'slack')"`
+	Target string `gorm:"not null"` // Comma-separated recipients (email) or URL (webhook, slack)
+	Secret string // HMAC-SHA256 signing secret for webhook channels; empty disables signing
+	Active bool   `gorm:"default:true"`
+
+	LastDeliveryAt *time.Time
+	LastError      string
+}
+
+// AlertRule raises an alert when more than Threshold failed authentications
+// matching its condition, grouped by user, device or IP address, fall within
+// the last WindowMinutes
+type AlertRule struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	Name          string `gorm:"uniqueIndex"`
+	Description   string
+	Condition     string `gorm:"type:varchar(30);not null;check:condition IN ('failed_auth', 'replayed_otp')"`
+	LogType       string `gorm:"type:varchar(20)"`                // Only count log entries of this type; empty counts every type
+	GroupBy       string `gorm:"type:varchar(20);default:'user'"` // "user", "device" or "ip_address"
+	Threshold     int    `gorm:"default:0"`
+	WindowMinutes int    `gorm:"default:10"`
+	Severity      string `gorm:"type:varchar(20);default:'warning'"` // "info", "warning" or "critical"
+	Active        bool   `gorm:"default:true"`
+
+	Channels []AlertChannel `gorm:"many2many:alert_rule_channels;"`
+}
+
+// Alert is a rule firing for one user, device or IP address. While it is open
+// or acknowledged, further matches update it instead of raising a new alert.
+type Alert struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	RuleID    uuid.UUID  `gorm:"type:uuid;not null;index"`
+	Rule      AlertRule  `gorm:"foreignKey:RuleID;constraint:OnDelete:CASCADE"`
+	Subject   string     `gorm:"not null"` // The grouped value: user ID, device ID or IP address
+	UserID    *uuid.UUID `gorm:"type:uuid"`
+	User      *User      `gorm:"foreignKey:UserID;constraint:OnDelete:SET NULL"`
+	DeviceID  *uuid.UUID `gorm:"type:uuid"`
+	IPAddress string
+	Severity  string `gorm:"type:varchar(20);not null"`
+	Count     int    // Matching log entries since FirstSeenAt
+
+	FirstSeenAt time.Time
+	LastSeenAt  time.Time
+
+	Status           string `gorm:"type:varchar(20);default:'open';index;check:status IN ('open', 'acknowledged', 'resolved')"`
+	AcknowledgedAt   *time.Time
+	AcknowledgedByID *uuid.UUID `gorm:"type:uuid"`
+	ResolvedAt       *time.Time
+	ResolvedByID     *uuid.UUID `gorm:"type:uuid"`
+	ResolutionNote   string
+
+	DeliveryError string // Channels that could not be notified, and why
+}
+
+// AnomalyEvent is an unusual pattern the anomaly analyzer found in a user's
+// sign-ins or activity, kept for security review. DedupeKey identifies what
+// was flagged, so later runs do not flag it again.
+type AnomalyEvent struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	Type       string    `gorm:"type:varchar(30);not null;check:type IN ('unusual_hour', 'open_activity', 'distant_ips')"`
+	UserID     uuid.UUID `gorm:"type:uuid;not null;index"`
+	User       User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	IPAddress  string
+	Details    string
+	AuthLogID  *uuid.UUID `gorm:"type:uuid"` // Sign-in flagged, for unusual_hour and distant_ips
+	ActivityID *uuid.UUID `gorm:"type:uuid"` // Activity left open, for open_activity
+	OccurredAt time.Time  `gorm:"not null"`
+	DedupeKey  string     `gorm:"type:varchar(255);not null;uniqueIndex"`
+
+	Status           string `gorm:"type:varchar(20);default:'open';index;check:status IN ('open', 'acknowledged', 'resolved')"`
+	AcknowledgedAt   *time.Time
+	AcknowledgedByID *uuid.UUID `gorm:"type:uuid"`
+	ResolvedAt       *time.Time
+	ResolvedByID     *uuid.UUID `gorm:"type:uuid"`
+	ResolutionNote   string
+}
+
+// PermissionUsage is when a role's grant of a permission was last exercised,
+// as tracked from the permission_checked of successful authentications
+type PermissionUsage struct {
+	RoleID       uuid.UUID  `gorm:"type:uuid;primaryKey"`
+	PermissionID uuid.UUID  `gorm:"type:uuid;primaryKey"`
+	LastUsedAt   time.Time  `gorm:"not null"`
+	LastUserID   *uuid.UUID `gorm:"type:uuid"` // The user who last exercised it
+}
+
+// TableName keeps the singular table name the migrations use
+func (PermissionUsage) TableName() string {
+	return "permission_usage"
+}
+
+// AccessReviewCampaign is a review of users' role assignments, of one role or
+// all, snapshotted into AccessReviewItems when it opens. It completes when
+// every item is decided, and expires at DueAt otherwise.
+type AccessReviewCampaign struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	Name         string     `gorm:"type:varchar(255);not null"`
+	ReviewerType string     `gorm:"type:varchar(20);not null;check:reviewer_type IN ('manager', 'role_owner')"`
+	RoleID       *uuid.UUID `gorm:"type:uuid"` // nil reviews every role
+	Role         *Role      `gorm:"foreignKey:RoleID"`
+	DueAt        time.Time  `gorm:"not null"`
+	Status       string     `gorm:"type:varchar(20);default:'open';index;check:status IN ('open', 'completed', 'expired')"`
+	CreatedByID  *uuid.UUID `gorm:"type:uuid"` // nil when opened by the scheduler
+	CompletedAt  *time.Time
+}
+
+// AccessReviewItem is one user's assignment to one role under review, and its
+// reviewer's decision. Revoking removes the assignment.
+type AccessReviewItem struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	CampaignID uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_access_review_items_assignment"`
+	UserID     uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_access_review_items_assignment"`
+	User       User       `gorm:"foreignKey:UserID"`
+	RoleID     uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_access_review_items_assignment"`
+	Role       Role       `gorm:"foreignKey:RoleID"`
+	ReviewerID *uuid.UUID `gorm:"type:uuid;index"` // The user's manager or the role's owner; nil leaves it to admins
+	Reviewer   *User      `gorm:"foreignKey:ReviewerID"`
+
+	Decision    string `gorm:"type:varchar(20);default:'pending';check:decision IN ('pending', 'approved', 'revoked')"`
+	DecidedAt   *time.Time
+	DecidedByID *uuid.UUID `gorm:"type:uuid"`
+	Note        string
+}
+
+// LoginSource is a device or IP address a user has signed in from, so sign-ins
+// from new ones can be notified
+type LoginSource struct {
+	UserID      uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Kind        string    `gorm:"type:varchar(10);primaryKey;check:kind IN ('device', 'ip')"`
+	Value       string    `gorm:"type:varchar(64);primaryKey"` // Device ID or IP address
+	FirstSeenAt time.Time `gorm:"not null"`
+	LastSeenAt  time.Time `gorm:"not null"`
+}
+
+// LoginNotification audits the security email for a sign-in from a new device
+// or IP address, whether it was sent or not
+type LoginNotification struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index"`
+	User      User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	DeviceID  *uuid.UUID `gorm:"type:uuid"`
+	IPAddress string
+	UserAgent string
+	NewDevice bool
+	NewIP     bool
+	Email     string // Where it was sent
+	Status    string `gorm:"type:varchar(20);not null;check:status IN ('sent', 'failed', 'skipped')"`
+	Reason    string // Why it was skipped or failed
+	RequestID string `gorm:"type:varchar(128);index"` // X-Request-ID of the sign-in
+}
+
+// MessageTemplate is an email or notification message edited through the API,
+// which replaces the built-in catalog's message of its key in its locale
+type MessageTemplate struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	Key         string     `gorm:"type:varchar(100);not null;uniqueIndex:idx_message_templates_key_locale"` // Catalog key, e.g. email.password_reset.body
+	Locale      string     `gorm:"type:varchar(35);not null;uniqueIndex:idx_message_templates_key_locale"`
+	Text        string     `gorm:"not null"`           // text/template
+	Version     int        `gorm:"not null;default:1"` // Bumped by every update; updates naming an older version are rejected
+	UpdatedByID *uuid.UUID `gorm:"type:uuid"`          // NULL once the user has been deleted
+	UpdatedBy   *User      `gorm:"foreignKey:UpdatedByID;constraint:OnDelete:SET NULL"`
+}
+
+// MessageTemplateVersion is the text a message template had at one version,
+// kept so earlier versions can be reviewed and restored
+type MessageTemplateVersion struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+
+	TemplateID  uuid.UUID       `gorm:"type:uuid;not null;uniqueIndex:idx_message_template_versions_template_version"`
+	Template    MessageTemplate `gorm:"foreignKey:TemplateID;constraint:OnDelete:CASCADE"`
+	Version     int             `gorm:"not null;uniqueIndex:idx_message_template_versions_template_version"`
+	Text        string          `gorm:"not null"`
+	CreatedByID *uuid.UUID      `gorm:"type:uuid"`
+	CreatedBy   *User           `gorm:"foreignKey:CreatedByID;constraint:OnDelete:SET NULL"`
+}
+
+// Visitor is a guest expected at a location, checked in and out by reception
+// with their device. The host is emailed when the visitor checks in.
+type Visitor struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Version   int `gorm:"not null;default:1"` // Bumped by every update; updates naming an older version are rejected
+
+	Name        string    `gorm:"type:varchar(200);not null"`
+	Company     string    `gorm:"type:varchar(200);not null;default:''"`
+	Email       string    `gorm:"type:varchar(255);not null;default:''"`
+	Notes       string    `gorm:"not null;default:''"`
+	HostUserID  uuid.UUID `gorm:"type:uuid;not null;index"`
+	HostUser    User      `gorm:"foreignKey:HostUserID;constraint:OnDelete:CASCADE"`
+	LocationID  uuid.UUID `gorm:"type:uuid;not null"`
+	Location    Location  `gorm:"foreignKey:LocationID;constraint:OnDelete:CASCADE"`
+	ScheduledAt time.Time `gorm:"not null"`
+	Status      string    `gorm:"type:varchar(20);not null;default:'expected';check:status IN ('expected', 'checked_in', 'checked_out', 'cancelled')"`
+	BadgeNumber string    `gorm:"type:varchar(50);not null;default:''"` // Held by one checked-in visitor at a time
+
+	CheckedInAt        *time.Time
+	CheckedInByID      *uuid.UUID `gorm:"type:uuid"` // Receptionist; NULL once the user has been deleted
+	CheckedInDeviceID  *uuid.UUID `gorm:"type:uuid"`
+	CheckedOutAt       *time.Time
+	CheckedOutByID     *uuid.UUID `gorm:"type:uuid"`
+	CheckedOutDeviceID *uuid.UUID `gorm:"type:uuid"`
+	HostNotifiedAt     *time.Time // When the arrival email was sent; NULL when it was skipped or failed
+}
+
+// Shift is a user's planned working time, once or repeating, which their
+// sign-ins and sign-outs are compared with. Repeats keep the wall-clock time
+// of the first shift in the location's timezone, else the user's, else UTC.
+type Shift struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Version   int `gorm:"not null;default:1"` // Bumped by every update; updates naming an older version are rejected
+
+	UserID     uuid.UUID  `gorm:"type:uuid;not null;index"`
+	User       User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	LocationID *uuid.UUID `gorm:"type:uuid;index"`
+	Location   *Location  `gorm:"foreignKey:LocationID;constraint:OnDelete:SET NULL"`
+	StartsAt   time.Time  `gorm:"not null"` // Start of the first shift
+	EndsAt     time.Time  `gorm:"not null"` // End of the first shift
+	Notes      string     `gorm:"not null;default:''"`
+
+	// How the shift repeats: "daily", "weekdays" (Monday to Friday) or
+	// "weekly"; empty for a one-off shift. Repeats run up to and including
+	// RecurUntil, YYYY-MM-DD, or indefinitely when it is empty.
+	Recurrence string `gorm:"type:varchar(10);not null;default:'';check:recurrence IN ('', 'daily', 'weekdays', 'weekly')"`
+	RecurUntil string `gorm:"type:varchar(10);not null;default:''"`
+}
+
+// ShiftNotification records that a user's manager was notified of a late or
+// missed shift, so each is notified once
+type ShiftNotification struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+
+	ShiftID   uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_shift_notification"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null"`
+	Date      string     `gorm:"type:varchar(10);not null;uniqueIndex:idx_shift_notification"` // YYYY-MM-DD of the shift's start
+	Type      string     `gorm:"type:varchar(20);not null;uniqueIndex:idx_shift_notification;check:type IN ('late', 'missed')"`
+	ManagerID *uuid.UUID `gorm:"type:uuid"`
+	Error     string
+}
+
+// LeaveEntry changes a user's leave balance of a type and calendar year: days
+// taken by a leave action, or days added or removed by an HR adjustment.
+// With the configured accrual the entries make up the balance and are its
+// audit trail.
+type LeaveEntry struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+
+	UserID       uuid.UUID  `gorm:"type:uuid;not null;index:idx_leave_entries_user_year"`
+	User         User       `gorm:"foreignKey:UserID"`
+	LeaveType    string     `gorm:"type:varchar(50);not null;index:idx_leave_entries_user_year"`
+	Year         int        `gorm:"not null;index:idx_leave_entries_user_year"`
+	Kind         string     `gorm:"type:varchar(20);not null;check:kind IN ('taken', 'adjustment')"`
+	Days         float64    `gorm:"type:numeric(6,2);not null"` // Days taken, or added (removed when negative) by an adjustment
+	ActionID     *uuid.UUID `gorm:"type:uuid"`                  // Leave action that took the days
+	AuthLogID    *uuid.UUID `gorm:"type:uuid"`                  // The action's authentication log entry
+	Reason       string     // Why an adjustment was made
+	AdjustedByID *uuid.UUID `gorm:"type:uuid"` // NULL when adjusted from the CLI
+	AdjustedBy   *User      `gorm:"foreignKey:AdjustedByID"`
+}
+
+// Holiday is a public holiday of a country, or of a single location when
+// LocationID is set. Attendance expects no hours on it and summaries report
+// the hours worked on it under holidays.category.
+type Holiday struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	Date       string     `gorm:"type:varchar(10);not null;index"` // YYYY-MM-DD
+	Name       string     `gorm:"type:varchar(255);not null"`
+	Country    string     `gorm:"type:varchar(2);not null;default:''"` // ISO 3166-1 alpha-2; empty for a location's holiday
+	LocationID *uuid.UUID `gorm:"type:uuid"`
+	Location   *Location  `gorm:"foreignKey:LocationID;constraint:OnDelete:CASCADE"`
+	Source     string     `gorm:"type:varchar(20);not null;default:'manual'"` // "manual", or the format it was imported from
+}
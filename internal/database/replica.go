@@ -0,0 +1,17 @@
+package database
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// ReplicaResolver names the dbresolver policy that sends reads to the read replica
+const ReplicaResolver = "read-replica"
+
+// ReadReplica returns db with its queries routed to the read replica, for
+// read-heavy endpoints (activity history, reports, list endpoints) that can
+// tolerate replication lag. Writes and transactions still go to the primary,
+// and without a configured replica this is the primary too.
+func ReadReplica(db *gorm.DB) *gorm.DB {
+	return db.Clauses(dbresolver.Use(ReplicaResolver))
+}
@@ -0,0 +1,407 @@
+// Package jobs is a Redis-backed queue for background work. Subsystems enqueue
+// typed jobs with a JSON payload; a Worker pool, in the API process or the
+// separate cmd/worker binary, runs them with the handler registered for their
+// type. Failed jobs are retried with exponential backoff and, once out of
+// attempts, kept on a dead-letter list until they are retried or deleted.
+//
+// Delivery is at least once: a job whose worker dies is handed to another
+// worker when its lease expires, so handlers must tolerate running twice.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrNotFound is returned for a dead job that does not exist
+var ErrNotFound = errors.New("job not found")
+
+// Job is one unit of queued work
+type Job struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	EnqueuedAt  time.Time       `json:"enqueued_at"`
+	LastError   string          `json:"last_error,omitempty"`
+	DiedAt      *time.Time      `json:"died_at,omitempty"` // When the job moved to the dead-letter list
+}
+
+// Decode unmarshals the job's payload into v
+func (j *Job) Decode(v interface{}) error {
+	if err := json.Unmarshal(j.Payload, v); err != nil {
+		return fmt.Errorf("invalid %s job payload: %w", j.Type, err)
+	}
+	return nil
+}
+
+// Stats are the queue's current depths and, per job type, its outcome
+// counters since the queue was created
+type Stats struct {
+	Ready     int64                `json:"ready"`
+	Scheduled int64                `json:"scheduled"` // Waiting for a delay or retry backoff
+	Running   int64                `json:"running"`
+	Dead      int64                `json:"dead"`
+	Types     map[string]TypeStats `json:"types"`
+}
+
+// TypeStats counts what happened to the jobs of one type
+type TypeStats struct {
+	Enqueued  int64 `json:"enqueued"`
+	Succeeded int64 `json:"succeeded"`
+	Retried   int64 `json:"retried"`
+	Dead      int64 `json:"dead"`
+}
+
+// Queue stores jobs in Redis. A job's JSON lives under job:<id>; its ID moves
+// between the ready list and the scheduled, leases and dead sorted sets.
+type Queue struct {
+	client redis.UniversalClient
+	config config.JobsConfig
+}
+
+// NewQueue creates a queue on client with the given settings
+func NewQueue(client redis.UniversalClient, cfg config.JobsConfig) *Queue {
+	return &Queue{client: client, config: cfg}
+}
+
+// reserveScript pops the next ready job and leases it until ARGV[1]
+var reserveScript = redis.NewScript(`
+local id = redis.call('RPOP', KEYS[1])
+if not id then return false end
+redis.call('ZADD', KEYS[2], ARGV[1], id)
+return id
+`)
+
+// promoteScript moves jobs whose delay has passed, or whose lease expired with
+// their worker, back onto the ready list
+var promoteScript = redis.NewScript(`
+local moved = 0
+for _, key in ipairs({KEYS[1], KEYS[2]}) do
+  local ids = redis.call('ZRANGEBYSCORE', key, '-inf', ARGV[1], 'LIMIT', 0, 100)
+  for _, id in ipairs(ids) do
+    redis.call('ZREM', key, id)
+    redis.call('LPUSH', KEYS[3], id)
+    moved = moved + 1
+  end
+end
+return moved
+`)
+
+// Enqueue queues a job of jobType to run as soon as a worker is free
+func (q *Queue) Enqueue(ctx context.Context, jobType string, payload interface{}) (*Job, error) {
+	return q.EnqueueIn(ctx, jobType, payload, 0)
+}
+
+// EnqueueIn queues a job of jobType to run once delay has passed
+func (q *Queue) EnqueueIn(ctx context.Context, jobType string, payload interface{}, delay time.Duration) (*Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s job payload: %w", jobType, err)
+	}
+	job := &Job{
+		ID:          uuid.New().String(),
+		Type:        jobType,
+		Payload:     data,
+		MaxAttempts: q.config.MaxAttempts,
+		EnqueuedAt:  time.Now(),
+	}
+	encoded, err := json.Marshal(job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode job: %w", err)
+	}
+
+	_, err = q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, q.jobKey(job.ID), encoded, 0)
+		if delay > 0 {
+			pipe.ZAdd(ctx, q.key("scheduled"), redis.Z{Score: score(job.EnqueuedAt.Add(delay)), Member: job.ID})
+		} else {
+			pipe.LPush(ctx, q.key("ready"), job.ID)
+		}
+		pipe.HIncrBy(ctx, q.key("stats"), jobType+":enqueued", 1)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to enqueue %s job: %w", jobType, err)
+	}
+	return job, nil
+}
+
+// Stats returns the queue depths and per-type counters
+func (q *Queue) Stats(ctx context.Context) (*Stats, error) {
+	pipe := q.client.Pipeline()
+	ready := pipe.LLen(ctx, q.key("ready"))
+	scheduled := pipe.ZCard(ctx, q.key("scheduled"))
+	running := pipe.ZCard(ctx, q.key("leases"))
+	dead := pipe.ZCard(ctx, q.key("dead"))
+	counters := pipe.HGetAll(ctx, q.key("stats"))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to read job queue stats: %w", err)
+	}
+
+	stats := &Stats{
+		Ready:     ready.Val(),
+		Scheduled: scheduled.Val(),
+		Running:   running.Val(),
+		Dead:      dead.Val(),
+		Types:     map[string]TypeStats{},
+	}
+	for field, value := range counters.Val() {
+		i := strings.LastIndex(field, ":")
+		if i < 0 {
+			continue
+		}
+		n, _ := strconv.ParseInt(value, 10, 64)
+		jobType, counter := field[:i], field[i+1:]
+		typeStats := stats.Types[jobType]
+		switch counter {
+		case "enqueued":
+			typeStats.Enqueued = n
+		case "succeeded":
+			typeStats.Succeeded = n
+		case "retried":
+			typeStats.Retried = n
+		case "dead":
+			typeStats.Dead = n
+		}
+		stats.Types[jobType] = typeStats
+	}
+	return stats, nil
+}
+
+// DeadJobs lists dead jobs, most recently failed first, with their total
+func (q *Queue) DeadJobs(ctx context.Context, offset, limit int) ([]Job, int64, error) {
+	total, err := q.client.ZCard(ctx, q.key("dead")).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count dead jobs: %w", err)
+	}
+	ids, err := q.client.ZRevRange(ctx, q.key("dead"), int64(offset), int64(offset+limit-1)).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list dead jobs: %w", err)
+	}
+
+	jobs := make([]Job, 0, len(ids))
+	for _, id := range ids {
+		job, err := q.load(ctx, id)
+		if err != nil {
+			continue // Deleted while listing
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, total, nil
+}
+
+// RetryDead moves a dead job back onto the ready list with fresh attempts
+func (q *Queue) RetryDead(ctx context.Context, id string) (*Job, error) {
+	job, err := q.deadJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	job.Attempts = 0
+	job.DiedAt = nil
+	encoded, err := json.Marshal(job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode job: %w", err)
+	}
+
+	_, err = q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, q.key("dead"), id)
+		pipe.Set(ctx, q.jobKey(id), encoded, 0)
+		pipe.LPush(ctx, q.key("ready"), id)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retry job: %w", err)
+	}
+	return job, nil
+}
+
+// DeleteDead discards a dead job
+func (q *Queue) DeleteDead(ctx context.Context, id string) error {
+	if _, err := q.deadJob(ctx, id); err != nil {
+		return err
+	}
+	_, err := q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, q.key("dead"), id)
+		pipe.Del(ctx, q.jobKey(id))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete job: %w", err)
+	}
+	return nil
+}
+
+// reserve leases the next ready job to the caller, or returns nil when none
+// is ready. The attempt is counted up front so a job that keeps killing its
+// worker still runs out of attempts.
+func (q *Queue) reserve(ctx context.Context, now time.Time) (*Job, error) {
+	id, err := reserveScript.Run(ctx, q.client, []string{q.key("ready"), q.key("leases")}, score(now.Add(q.config.Lease))).Text()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve job: %w", err)
+	}
+
+	job, err := q.load(ctx, id)
+	if err != nil {
+		q.client.ZRem(ctx, q.key("leases"), id)
+		return nil, err
+	}
+	job.Attempts++
+	if job.Attempts > job.MaxAttempts {
+		if job.LastError == "" {
+			job.LastError = "job did not finish within its lease"
+		}
+		return nil, q.bury(ctx, job, now)
+	}
+	if err := q.save(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// complete removes a finished job. A job whose lease already expired belongs
+// to whichever worker picked it up again.
+func (q *Queue) complete(ctx context.Context, job *Job) error {
+	if leased, err := q.release(ctx, job); err != nil || !leased {
+		return err
+	}
+	_, err := q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, q.jobKey(job.ID))
+		pipe.HIncrBy(ctx, q.key("stats"), job.Type+":succeeded", 1)
+		return nil
+	})
+	return err
+}
+
+// fail schedules a retry of a failed job after its backoff, or moves it to
+// the dead-letter list once it is out of attempts
+func (q *Queue) fail(ctx context.Context, job *Job, jobErr error, now time.Time) error {
+	if leased, err := q.release(ctx, job); err != nil || !leased {
+		return err
+	}
+	job.LastError = jobErr.Error()
+	if job.Attempts >= job.MaxAttempts {
+		return q.bury(ctx, job, now)
+	}
+
+	encoded, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %w", err)
+	}
+	_, err = q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, q.jobKey(job.ID), encoded, 0)
+		pipe.ZAdd(ctx, q.key("scheduled"), redis.Z{Score: score(now.Add(q.backoff(job.Attempts))), Member: job.ID})
+		pipe.HIncrBy(ctx, q.key("stats"), job.Type+":retried", 1)
+		return nil
+	})
+	return err
+}
+
+// promote moves due delayed jobs and jobs with expired leases to the ready list
+func (q *Queue) promote(ctx context.Context, now time.Time) (int, error) {
+	moved, err := promoteScript.Run(ctx, q.client, []string{q.key("scheduled"), q.key("leases"), q.key("ready")}, score(now)).Int()
+	if err != nil {
+		return 0, fmt.Errorf("failed to promote jobs: %w", err)
+	}
+	return moved, nil
+}
+
+// backoff is the delay before the retry that follows attempt
+func (q *Queue) backoff(attempt int) time.Duration {
+	delay := q.config.BackoffBase
+	for i := 1; i < attempt && delay < q.config.BackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > q.config.BackoffMax {
+		delay = q.config.BackoffMax
+	}
+	return delay
+}
+
+// release ends the caller's lease, reporting whether it still held it
+func (q *Queue) release(ctx context.Context, job *Job) (bool, error) {
+	removed, err := q.client.ZRem(ctx, q.key("leases"), job.ID).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to release job: %w", err)
+	}
+	return removed > 0, nil
+}
+
+// bury moves a job to the dead-letter list
+func (q *Queue) bury(ctx context.Context, job *Job, now time.Time) error {
+	job.DiedAt = &now
+	encoded, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %w", err)
+	}
+	_, err = q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, q.key("leases"), job.ID)
+		pipe.Set(ctx, q.jobKey(job.ID), encoded, 0)
+		pipe.ZAdd(ctx, q.key("dead"), redis.Z{Score: score(now), Member: job.ID})
+		pipe.HIncrBy(ctx, q.key("stats"), job.Type+":dead", 1)
+		return nil
+	})
+	return err
+}
+
+func (q *Queue) deadJob(ctx context.Context, id string) (*Job, error) {
+	if _, err := q.client.ZScore(ctx, q.key("dead"), id).Result(); err != nil {
+		if err == redis.Nil {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to look up job: %w", err)
+	}
+	return q.load(ctx, id)
+}
+
+func (q *Queue) load(ctx context.Context, id string) (*Job, error) {
+	data, err := q.client.Get(ctx, q.jobKey(id)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load job: %w", err)
+	}
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("failed to decode job %s: %w", id, err)
+	}
+	return &job, nil
+}
+
+func (q *Queue) save(ctx context.Context, job *Job) error {
+	encoded, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %w", err)
+	}
+	if err := q.client.Set(ctx, q.jobKey(job.ID), encoded, 0).Err(); err != nil {
+		return fmt.Errorf("failed to save job: %w", err)
+	}
+	return nil
+}
+
+func (q *Queue) key(name string) string {
+	return q.config.KeyPrefix + name
+}
+
+func (q *Queue) jobKey(id string) string {
+	return q.config.KeyPrefix + "job:" + id
+}
+
+// score orders sorted set members by time
+func score(t time.Time) float64 {
+	return float64(t.UnixMilli())
+}
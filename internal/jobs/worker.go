@@ -0,0 +1,149 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Handler runs one job. Returning an error retries the job after a backoff.
+// ctx is cancelled when the job's lease expires.
+type Handler func(ctx context.Context, job *Job) error
+
+// Worker runs queued jobs with the handlers registered for their types
+type Worker struct {
+	queue    *Queue
+	handlers map[string]Handler
+	stop     chan struct{}
+	running  sync.WaitGroup
+}
+
+// NewWorker creates a worker for queue. Register handlers before Start.
+func NewWorker(queue *Queue) *Worker {
+	return &Worker{queue: queue, handlers: make(map[string]Handler)}
+}
+
+// Handle registers the handler for jobs of jobType
+func (w *Worker) Handle(jobType string, handler Handler) {
+	w.handlers[jobType] = handler
+}
+
+// Start runs concurrency jobs at a time until Stop. It does nothing when
+// concurrency is zero, leaving the queue to workers in other processes.
+func (w *Worker) Start(concurrency int) {
+	if concurrency <= 0 || w.stop != nil {
+		return
+	}
+
+	w.stop = make(chan struct{})
+	w.running.Add(concurrency + 1)
+	go w.promoter()
+	for i := 0; i < concurrency; i++ {
+		go w.loop()
+	}
+}
+
+// Stop stops taking new jobs and waits for those running to finish. Jobs
+// still running when ctx is done are retried by another worker once their
+// lease expires.
+func (w *Worker) Stop(ctx context.Context) error {
+	if w.stop == nil {
+		return nil
+	}
+	close(w.stop)
+	w.stop = nil
+
+	done := make(chan struct{})
+	go func() {
+		w.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// loop reserves and runs jobs, sleeping for the poll interval when none is ready
+func (w *Worker) loop() {
+	defer w.running.Done()
+	stop := w.stop
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		job, err := w.queue.reserve(context.Background(), time.Now())
+		if err != nil {
+			log.Printf("Job queue: %v", err)
+		}
+		if job == nil {
+			select {
+			case <-stop:
+				return
+			case <-time.After(w.queue.config.PollInterval):
+			}
+			continue
+		}
+		w.run(job)
+	}
+}
+
+// run runs one job and records the outcome
+func (w *Worker) run(job *Job) {
+	ctx, cancel := context.WithTimeout(context.Background(), w.queue.config.Lease)
+	defer cancel()
+
+	err := w.call(ctx, job)
+	if err == nil {
+		err = w.queue.complete(context.Background(), job)
+		if err != nil {
+			log.Printf("Job queue: failed to complete %s job %s: %v", job.Type, job.ID, err)
+		}
+		return
+	}
+
+	log.Printf("Job queue: %s job %s failed (attempt %d of %d): %v", job.Type, job.ID, job.Attempts, job.MaxAttempts, err)
+	if err := w.queue.fail(context.Background(), job, err, time.Now()); err != nil {
+		log.Printf("Job queue: failed to record failure of %s job %s: %v", job.Type, job.ID, err)
+	}
+}
+
+// call runs the job's handler, turning a panic into an error
+func (w *Worker) call(ctx context.Context, job *Job) (err error) {
+	handler, ok := w.handlers[job.Type]
+	if !ok {
+		return fmt.Errorf("no handler registered for job type '%s'", job.Type)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+// promoter moves due retries and jobs abandoned by dead workers back to the
+// ready list
+func (w *Worker) promoter() {
+	defer w.running.Done()
+	stop := w.stop
+	ticker := time.NewTicker(w.queue.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := w.queue.promote(context.Background(), time.Now()); err != nil {
+				log.Printf("Job queue: %v", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
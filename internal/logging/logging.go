@@ -0,0 +1,68 @@
+// Package logging configures structured logging and carries request IDs through
+// contexts so HTTP logs and audit rows for one request can be correlated.
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/YubiApp/internal/config"
+)
+
+type requestIDKey struct{}
+
+// level is the minimum level logged, adjustable at runtime by SetLevel
+var level = new(slog.LevelVar)
+
+// Setup installs the default slog logger described by cfg. The standard log
+// package writes through it too, so existing log.Printf calls become structured.
+func Setup(cfg config.LoggingConfig) {
+	SetLevel(cfg.Level)
+
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	if strings.ToLower(cfg.Format) == "text" {
+		handler = slog.NewTextHandler(os.Stderr, options)
+	} else {
+		handler = slog.NewJSONHandler(os.Stderr, options)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+// SetLevel changes the minimum level logged: debug, info, warn or error
+func SetLevel(name string) {
+	switch strings.ToLower(name) {
+	case "debug":
+		level.Set(slog.LevelDebug)
+	case "warn", "warning":
+		level.Set(slog.LevelWarn)
+	case "error":
+		level.Set(slog.LevelError)
+	default:
+		level.Set(slog.LevelInfo)
+	}
+}
+
+// WithRequestID returns a copy of ctx carrying requestID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the request ID carried by ctx, or "" if there is none
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// FromContext returns the default logger, tagged with ctx's request ID if any
+func FromContext(ctx context.Context) *slog.Logger {
+	if requestID := RequestID(ctx); requestID != "" {
+		return slog.Default().With("request_id", requestID)
+	}
+	return slog.Default()
+}
@@ -0,0 +1,378 @@
+// Package migrate applies the versioned SQL migrations in database/migrations.
+//
+// Files are named <version>_<name>.up.sql and <version>_<name>.down.sql (the
+// golang-migrate convention). Applied versions are recorded in
+// schema_migrations with a checksum of their up file, so a migration edited
+// after it was applied is reported instead of silently diverging.
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// lockID keys the advisory lock that keeps two migrators from running at once
+const lockID = 7279158431
+
+const createTableSQL = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    checksum VARCHAR(64) NOT NULL,
+    applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`
+
+// ErrSchemaOutOfDate is returned by Check when migrations are pending, were
+// edited after being applied, or the database is newer than this build
+var ErrSchemaOutOfDate = errors.New("database schema is out of date")
+
+var fileName = regexp.MustCompile(`^(\d+)_([A-Za-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is one versioned schema change
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // SHA-256 of Up
+}
+
+// Status is a migration and whether it has been applied
+type Status struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+	Modified  bool       `json:"modified"` // Applied from an up file that has since changed
+	Unknown   bool       `json:"unknown"`  // Applied, but not among this build's migrations
+}
+
+// Migrator applies migrations to a database
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New loads the migrations in dir of fsys
+func New(db *sql.DB, fsys fs.FS, dir string) (*Migrator, error) {
+	migrations, err := Load(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Load reads the migrations in dir of fsys, ordered by version. Every version
+// needs an up file; a missing down file makes the migration irreversible.
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		m := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || m == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", entry.Name(), err)
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = migration
+		} else if migration.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has files with different names: %s and %s", version, migration.Name, m[2])
+		}
+		if m[3] == "up" {
+			migration.Up = string(data)
+			sum := sha256.Sum256(data)
+			migration.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// appliedMigration is a schema_migrations row
+type appliedMigration struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// Status lists every known migration and every applied one, by version
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []Status
+	for _, migration := range m.migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if row, ok := applied[migration.Version]; ok {
+			appliedAt := row.appliedAt
+			status.Applied = true
+			status.AppliedAt = &appliedAt
+			status.Modified = row.checksum != migration.Checksum
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for version, row := range applied {
+		appliedAt := row.appliedAt
+		statuses = append(statuses, Status{Version: version, Name: row.name, Applied: true, AppliedAt: &appliedAt, Unknown: true})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// Check returns ErrSchemaOutOfDate, with the reason, unless every migration has
+// been applied unmodified and the database has none this build doesn't know
+func (m *Migrator) Check(ctx context.Context) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		switch {
+		case status.Unknown:
+			return fmt.Errorf("%w: migration %d_%s was applied by a newer version", ErrSchemaOutOfDate, status.Version, status.Name)
+		case status.Modified:
+			return fmt.Errorf("%w: migration %d_%s changed after it was applied", ErrSchemaOutOfDate, status.Version, status.Name)
+		case !status.Applied:
+			return fmt.Errorf("%w: migration %d_%s is pending; run `yubiapp-cli migrate up`", ErrSchemaOutOfDate, status.Version, status.Name)
+		}
+	}
+	return nil
+}
+
+// Up applies every pending migration in order, each in its own transaction, and
+// returns those applied. It refuses to run when an applied migration was modified.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verify(applied); err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := m.apply(ctx, conn, migration, migration.Up, true); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the latest steps applied migrations, newest first, and returns
+// those reverted
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verify(applied); err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("migration %d_%s has no down file", migration.Version, migration.Name)
+			}
+			if err := m.apply(ctx, conn, migration, migration.Down, false); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Baseline records migrations up to and including version as applied without
+// running them, for databases created from database/schema.sql before
+// migrations existed. Databases created by the old AutoMigrate start-up are
+// refused: their schema differs from the migrations' (user_activity_history
+// has from_date_time and to_date_time rather than from_datetime and
+// to_datetime, and the updated_at triggers are missing), so later migrations
+// would fail on them.
+func (m *Migrator) Baseline(ctx context.Context, version int64) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		if err := checkNotAutoMigrated(ctx, conn); err != nil {
+			return err
+		}
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if migration.Version > version {
+				break
+			}
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if _, err := conn.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`,
+				migration.Version, migration.Name, migration.Checksum); err != nil {
+				return fmt.Errorf("failed to record migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// checkNotAutoMigrated fails when user_activity_history has the columns
+// AutoMigrate named after the model's fields
+func checkNotAutoMigrated(ctx context.Context, conn *sql.Conn) error {
+	var found bool
+	err := conn.QueryRowContext(ctx, `SELECT EXISTS (
+    SELECT 1 FROM information_schema.columns
+    WHERE table_schema = current_schema() AND table_name = 'user_activity_history' AND column_name = 'from_date_time'
+)`).Scan(&found)
+	if err != nil {
+		return fmt.Errorf("failed to inspect user_activity_history: %w", err)
+	}
+	if found {
+		return fmt.Errorf("user_activity_history has the from_date_time column of the old AutoMigrate start-up, " +
+			"so the database does not match the migrations and cannot be baselined; " +
+			"run the migrations on a new database and copy the data across")
+	}
+	return nil
+}
+
+// verify fails when an applied migration's up file has changed since
+func (m *Migrator) verify(applied map[int64]appliedMigration) error {
+	for _, migration := range m.migrations {
+		if row, ok := applied[migration.Version]; ok && row.checksum != migration.Checksum {
+			return fmt.Errorf("migration %d_%s changed after it was applied (checksum %s, now %s)",
+				migration.Version, migration.Name, row.checksum, migration.Checksum)
+		}
+	}
+	return nil
+}
+
+// apply runs one migration's SQL and records (up) or forgets (down) it in the
+// same transaction
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration Migration, script string, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+	}
+	if up {
+		_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`,
+			migration.Version, migration.Name, migration.Checksum)
+	} else {
+		_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+	return tx.Commit()
+}
+
+// locked runs fn on one connection holding the migration advisory lock, after
+// making sure schema_migrations exists
+func (m *Migrator) locked(ctx context.Context, fn func(*sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+		return fmt.Errorf("failed to take migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID)
+
+	if _, err := conn.ExecContext(ctx, createTableSQL); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return fn(conn)
+}
+
+// queryer is satisfied by *sql.DB and *sql.Conn
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// applied reads schema_migrations; a missing table means nothing is applied
+func (m *Migrator) applied(ctx context.Context, db queryer) (map[int64]appliedMigration, error) {
+	applied := map[int64]appliedMigration{}
+
+	exists, err := db.QueryContext(ctx, `SELECT 1 FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = 'schema_migrations'`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	found := exists.Next()
+	exists.Close()
+	if !found {
+		return applied, nil
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int64
+		var row appliedMigration
+		if err := rows.Scan(&version, &row.name, &row.checksum, &row.appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+		}
+		applied[version] = row
+	}
+	return applied, rows.Err()
+}
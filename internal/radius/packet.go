@@ -0,0 +1,186 @@
+package radius
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+)
+
+// Packet codes
+const (
+	CodeAccessRequest = 1
+	CodeAccessAccept  = 2
+	CodeAccessReject  = 3
+)
+
+// Attribute types
+const (
+	AttrUserName             = 1
+	AttrUserPassword         = 2
+	AttrNASIPAddress         = 4
+	AttrReplyMessage         = 18
+	AttrCallingStationID     = 31
+	AttrNASIdentifier        = 32
+	AttrMessageAuthenticator = 80
+)
+
+const (
+	headerLength = 20
+	maxLength    = 4096
+)
+
+// Attribute is a single RADIUS attribute
+type Attribute struct {
+	Type  byte
+	Value []byte
+}
+
+// Packet is a decoded RADIUS packet (RFC 2865)
+type Packet struct {
+	Code          byte
+	Identifier    byte
+	Authenticator [16]byte
+	Attributes    []Attribute
+	raw           []byte
+}
+
+// Parse decodes a RADIUS packet
+func Parse(data []byte) (*Packet, error) {
+	if len(data) < headerLength {
+		return nil, fmt.Errorf("packet too short")
+	}
+	length := int(binary.BigEndian.Uint16(data[2:4]))
+	if length < headerLength || length > maxLength || length > len(data) {
+		return nil, fmt.Errorf("invalid packet length %d", length)
+	}
+
+	p := &Packet{Code: data[0], Identifier: data[1], raw: data[:length]}
+	copy(p.Authenticator[:], data[4:20])
+
+	for offset := headerLength; offset < length; {
+		if offset+2 > length {
+			return nil, fmt.Errorf("truncated attribute")
+		}
+		attrLength := int(data[offset+1])
+		if attrLength < 2 || offset+attrLength > length {
+			return nil, fmt.Errorf("invalid attribute length")
+		}
+		p.Attributes = append(p.Attributes, Attribute{
+			Type:  data[offset],
+			Value: data[offset+2 : offset+attrLength],
+		})
+		offset += attrLength
+	}
+	return p, nil
+}
+
+// Get returns the first attribute of a type
+func (p *Packet) Get(attrType byte) ([]byte, bool) {
+	for _, attr := range p.Attributes {
+		if attr.Type == attrType {
+			return attr.Value, true
+		}
+	}
+	return nil, false
+}
+
+// String returns the first attribute of a type as a string
+func (p *Packet) String(attrType byte) string {
+	value, _ := p.Get(attrType)
+	return string(value)
+}
+
+// DecryptPassword recovers the User-Password attribute using the shared secret
+func (p *Packet) DecryptPassword(secret []byte) (string, error) {
+	encrypted, ok := p.Get(AttrUserPassword)
+	if !ok {
+		return "", fmt.Errorf("missing User-Password")
+	}
+	if len(encrypted) == 0 || len(encrypted)%16 != 0 || len(encrypted) > 128 {
+		return "", fmt.Errorf("invalid User-Password length")
+	}
+
+	plain := make([]byte, len(encrypted))
+	previous := p.Authenticator[:]
+	for i := 0; i < len(encrypted); i += 16 {
+		hash := md5.New()
+		hash.Write(secret)
+		hash.Write(previous)
+		b := hash.Sum(nil)
+		for j := 0; j < 16; j++ {
+			plain[i+j] = encrypted[i+j] ^ b[j]
+		}
+		previous = encrypted[i : i+16]
+	}
+	return string(bytes.TrimRight(plain, "\x00")), nil
+}
+
+// VerifyMessageAuthenticator checks the request's Message-Authenticator. present is
+// false if the request does not carry one.
+func (p *Packet) VerifyMessageAuthenticator(secret []byte) (present, valid bool) {
+	offset := p.messageAuthenticatorOffset()
+	if offset < 0 {
+		return false, false
+	}
+
+	zeroed := make([]byte, len(p.raw))
+	copy(zeroed, p.raw)
+	received := make([]byte, 16)
+	copy(received, zeroed[offset:offset+16])
+	for i := 0; i < 16; i++ {
+		zeroed[offset+i] = 0
+	}
+
+	mac := hmac.New(md5.New, secret)
+	mac.Write(zeroed)
+	return true, hmac.Equal(received, mac.Sum(nil))
+}
+
+func (p *Packet) messageAuthenticatorOffset() int {
+	for offset := headerLength; offset+2 <= len(p.raw); offset += int(p.raw[offset+1]) {
+		if p.raw[offset+1] < 2 {
+			return -1
+		}
+		if p.raw[offset] == AttrMessageAuthenticator && p.raw[offset+1] == 18 {
+			return offset + 2
+		}
+	}
+	return -1
+}
+
+// Response builds a signed reply to a request. A Message-Authenticator is always
+// included, followed by the Response Authenticator.
+func Response(request *Packet, code byte, secret []byte, attributes ...Attribute) []byte {
+	attributes = append(attributes, Attribute{Type: AttrMessageAuthenticator, Value: make([]byte, 16)})
+
+	var body bytes.Buffer
+	for _, attr := range attributes {
+		value := attr.Value
+		if len(value) > 253 {
+			value = value[:253]
+		}
+		body.WriteByte(attr.Type)
+		body.WriteByte(byte(len(value) + 2))
+		body.Write(value)
+	}
+
+	packet := make([]byte, headerLength+body.Len())
+	packet[0] = code
+	packet[1] = request.Identifier
+	binary.BigEndian.PutUint16(packet[2:4], uint16(len(packet)))
+	copy(packet[4:20], request.Authenticator[:])
+	copy(packet[headerLength:], body.Bytes())
+
+	// Message-Authenticator is computed with the request authenticator in place
+	mac := hmac.New(md5.New, secret)
+	mac.Write(packet)
+	copy(packet[len(packet)-16:], mac.Sum(nil))
+
+	hash := md5.New()
+	hash.Write(packet)
+	hash.Write(secret)
+	copy(packet[4:20], hash.Sum(nil))
+	return packet
+}
@@ -0,0 +1,231 @@
+package radius
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+)
+
+// duplicateWindow is how long replies are kept to answer NAS retransmissions,
+// which would otherwise be rejected as replayed OTPs
+const duplicateWindow = 30 * time.Second
+
+// Server is a RADIUS front-end that authenticates Access-Requests carrying a
+// YubiKey OTP as the password. The NAS-Identifier selects the Resource to
+// authorize against, using the existing permission engine.
+type Server struct {
+	config      config.RadiusConfig
+	authService authenticator
+	conn        net.PacketConn
+
+	mu      sync.Mutex
+	replies map[string]*cachedReply
+}
+
+// authenticator verifies an OTP and the permission it is used for, as
+// *services.AuthService does
+type authenticator interface {
+	AuthenticateDeviceContext(ctx context.Context, deviceType, authCode, requiredPermission string) (*database.User, *database.Device, error)
+}
+
+// cachedReply is the reply to a request, keyed by source address, identifier
+// and authenticator. It is added when the first copy of the request arrives,
+// so retransmissions received while that is still being processed wait for
+// its reply rather than authenticating the OTP again.
+type cachedReply struct {
+	done    chan struct{} // Closed once data is set
+	data    []byte
+	expires time.Time
+}
+
+func NewServer(cfg config.RadiusConfig, authService *services.AuthService) *Server {
+	return &Server{
+		config:      cfg,
+		authService: authService,
+		replies:     make(map[string]*cachedReply),
+	}
+}
+
+// Start opens the UDP listener and serves requests in the background
+func (s *Server) Start() error {
+	if s.config.Secret == "" {
+		return fmt.Errorf("radius secret is not configured")
+	}
+	conn, err := net.ListenPacket("udp", s.config.Listen)
+	if err != nil {
+		return fmt.Errorf("failed to start RADIUS listener: %w", err)
+	}
+	s.conn = conn
+	log.Printf("RADIUS listener on %s", conn.LocalAddr())
+
+	go s.serve()
+	return nil
+}
+
+// Shutdown closes the listener
+func (s *Server) Shutdown() {
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+func (s *Server) serve() {
+	buf := make([]byte, maxLength)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			if strings.Contains(err.Error(), "use of closed network connection") {
+				return
+			}
+			log.Printf("RADIUS read error: %v", err)
+			continue
+		}
+		data := make([]byte, n)
+		copy(data, buf[:n])
+		go s.handle(data, addr)
+	}
+}
+
+func (s *Server) handle(data []byte, addr net.Addr) {
+	secret := []byte(s.config.Secret)
+
+	request, err := Parse(data)
+	if err != nil {
+		log.Printf("RADIUS: dropping malformed packet from %s: %v", addr, err)
+		return
+	}
+	if request.Code != CodeAccessRequest {
+		return
+	}
+
+	present, valid := request.VerifyMessageAuthenticator(secret)
+	if present && !valid {
+		log.Printf("RADIUS: dropping request from %s with invalid Message-Authenticator", addr)
+		return
+	}
+	if !present && s.config.RequireMessageAuthenticator {
+		log.Printf("RADIUS: dropping request from %s without Message-Authenticator", addr)
+		return
+	}
+
+	key := fmt.Sprintf("%s|%d|%x", addr, request.Identifier, request.Authenticator)
+	cached, first := s.claimReply(key)
+	if !first {
+		<-cached.done
+		s.conn.WriteTo(cached.data, addr)
+		return
+	}
+
+	code, message := s.authorize(request, secret, addr)
+	reply := Response(request, code, secret, Attribute{Type: AttrReplyMessage, Value: []byte(message)})
+	s.finishReply(cached, reply)
+
+	if _, err := s.conn.WriteTo(reply, addr); err != nil {
+		log.Printf("RADIUS: failed to reply to %s: %v", addr, err)
+	}
+}
+
+// authorize checks the OTP belongs to the named user and that the user holds the
+// configured permission on the NAS's resource, from the network the user is on
+func (s *Server) authorize(request *Packet, secret []byte, addr net.Addr) (byte, string) {
+	username := request.String(AttrUserName)
+	nasID := request.String(AttrNASIdentifier)
+	if nasID == "" {
+		if ip, ok := request.Get(AttrNASIPAddress); ok && len(ip) == 4 {
+			nasID = net.IP(ip).String()
+		}
+	}
+
+	// Viper lower-cases map keys, so also try the lower-cased identifier
+	resource, ok := s.config.NASResources[nasID]
+	if !ok {
+		resource, ok = s.config.NASResources[strings.ToLower(nasID)]
+	}
+	if !ok {
+		log.Printf("RADIUS: rejecting %s: unknown NAS %q", username, nasID)
+		return CodeAccessReject, "Unknown NAS"
+	}
+
+	otp, err := request.DecryptPassword(secret)
+	if err != nil {
+		return CodeAccessReject, "Invalid password"
+	}
+
+	ctx := services.WithClientIP(context.Background(), clientIP(request, addr))
+	user, _, err := s.authService.AuthenticateDeviceContext(ctx, "yubikey", otp, resource+":"+s.config.Action)
+	if err != nil {
+		log.Printf("RADIUS: rejecting %s on %s: %v", username, nasID, err)
+		return CodeAccessReject, "Access denied"
+	}
+	if !strings.EqualFold(user.Username, username) && !strings.EqualFold(user.Email, username) {
+		log.Printf("RADIUS: rejecting %s on %s: YubiKey belongs to %s", username, nasID, user.Username)
+		return CodeAccessReject, "Access denied"
+	}
+
+	return CodeAccessAccept, "Welcome " + user.Username
+}
+
+// clientIP returns the IP address resource network allowlists are checked
+// against: the Calling-Station-Id when the NAS reports the user's IP address
+// there, otherwise the NAS's own address
+func clientIP(request *Packet, addr net.Addr) string {
+	if ip := net.ParseIP(request.String(AttrCallingStationID)); ip != nil {
+		return ip.String()
+	}
+	if ip, ok := request.Get(AttrNASIPAddress); ok && len(ip) == 4 {
+		return net.IP(ip).String()
+	}
+	if udpAddr, ok := addr.(*net.UDPAddr); ok {
+		return udpAddr.IP.String()
+	}
+	host, _, _ := net.SplitHostPort(addr.String())
+	return host
+}
+
+// claimReply returns the reply for key, reporting true when there was none and
+// the caller must produce it and pass it to finishReply. Otherwise the reply is
+// ready once its done channel is closed.
+func (s *Server) claimReply(key string) (*cachedReply, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if reply, ok := s.replies[key]; ok && (!reply.finished() || now.Before(reply.expires)) {
+		return reply, false
+	}
+	for k, reply := range s.replies {
+		if reply.finished() && now.After(reply.expires) {
+			delete(s.replies, k)
+		}
+	}
+	reply := &cachedReply{done: make(chan struct{})}
+	s.replies[key] = reply
+	return reply, true
+}
+
+// finishReply stores the reply claimed with claimReply and releases the
+// retransmissions waiting for it
+func (s *Server) finishReply(reply *cachedReply, data []byte) {
+	s.mu.Lock()
+	reply.data = data
+	reply.expires = time.Now().Add(duplicateWindow)
+	s.mu.Unlock()
+	close(reply.done)
+}
+
+// finished reports whether the reply has been stored
+func (r *cachedReply) finished() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
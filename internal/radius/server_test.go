@@ -0,0 +1,125 @@
+package radius
+
+import (
+	"context"
+	"crypto/md5"
+	"net"
+	"testing"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+)
+
+// networkAuthenticator accepts any OTP for its user, but like the resource
+// network allowlist only from a client IP inside network
+type networkAuthenticator struct {
+	network    *net.IPNet
+	clientIPs  []string
+	permission string
+}
+
+func (a *networkAuthenticator) AuthenticateDeviceContext(ctx context.Context, deviceType, authCode, requiredPermission string) (*database.User, *database.Device, error) {
+	ip := services.ClientIP(ctx)
+	a.clientIPs = append(a.clientIPs, ip)
+	a.permission = requiredPermission
+	if parsed := net.ParseIP(ip); parsed == nil || !a.network.Contains(parsed) {
+		return nil, nil, services.NewError(services.CodePermissionDenied, "permission denied: %s cannot be used from %s", requiredPermission, ip)
+	}
+	return &database.User{Username: "alice"}, &database.Device{}, nil
+}
+
+// accessRequest builds an Access-Request from alice carrying otp as her
+// User-Password
+func accessRequest(secret []byte, otp string, attributes ...Attribute) *Packet {
+	request := &Packet{Code: CodeAccessRequest, Identifier: 1}
+	copy(request.Authenticator[:], "0123456789abcdef")
+
+	plain := make([]byte, (len(otp)+15)/16*16)
+	copy(plain, otp)
+	encrypted := make([]byte, len(plain))
+	previous := request.Authenticator[:]
+	for i := 0; i < len(plain); i += 16 {
+		hash := md5.New()
+		hash.Write(secret)
+		hash.Write(previous)
+		b := hash.Sum(nil)
+		for j := 0; j < 16; j++ {
+			encrypted[i+j] = plain[i+j] ^ b[j]
+		}
+		previous = encrypted[i : i+16]
+	}
+
+	request.Attributes = append([]Attribute{
+		{Type: AttrUserName, Value: []byte("alice")},
+		{Type: AttrUserPassword, Value: encrypted},
+		{Type: AttrNASIdentifier, Value: []byte("vpn")},
+	}, attributes...)
+	return request
+}
+
+func TestAuthorizeChecksResourceNetworks(t *testing.T) {
+	_, network, _ := net.ParseCIDR("10.0.0.0/8")
+	secret := []byte("testing123")
+	nasAddr := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1812}
+
+	tests := []struct {
+		name       string
+		attributes []Attribute
+		wantIP     string
+		wantCode   byte
+	}{
+		{
+			name:       "caller outside the range",
+			attributes: []Attribute{{Type: AttrCallingStationID, Value: []byte("203.0.113.7")}},
+			wantIP:     "203.0.113.7",
+			wantCode:   CodeAccessReject,
+		},
+		{
+			name:       "caller inside the range",
+			attributes: []Attribute{{Type: AttrCallingStationID, Value: []byte("10.1.2.3")}},
+			wantIP:     "10.1.2.3",
+			wantCode:   CodeAccessAccept,
+		},
+		{
+			name: "MAC calling station falls back to the NAS-IP-Address",
+			attributes: []Attribute{
+				{Type: AttrCallingStationID, Value: []byte("00-11-22-33-44-55")},
+				{Type: AttrNASIPAddress, Value: net.ParseIP("10.9.9.9").To4()},
+			},
+			wantIP:   "10.9.9.9",
+			wantCode: CodeAccessAccept,
+		},
+		{
+			name:     "no calling station falls back to the NAS's source address",
+			wantIP:   "192.0.2.1",
+			wantCode: CodeAccessReject,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := &networkAuthenticator{network: network}
+			s := &Server{
+				config: config.RadiusConfig{
+					Secret:       string(secret),
+					Action:       "access",
+					NASResources: map[string]string{"vpn": "corp-vpn"},
+				},
+				authService: auth,
+				replies:     make(map[string]*cachedReply),
+			}
+
+			code, _ := s.authorize(accessRequest(secret, "cccccckdvvuljbkhvnrncgfrttrjgujbbtbdkfchkdjt", tt.attributes...), secret, nasAddr)
+			if code != tt.wantCode {
+				t.Fatalf("got code %d, want %d", code, tt.wantCode)
+			}
+			if len(auth.clientIPs) != 1 || auth.clientIPs[0] != tt.wantIP {
+				t.Fatalf("authenticated from %v, want %s", auth.clientIPs, tt.wantIP)
+			}
+			if auth.permission != "corp-vpn:access" {
+				t.Fatalf("checked permission %q, want corp-vpn:access", auth.permission)
+			}
+		})
+	}
+}
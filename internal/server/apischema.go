@@ -0,0 +1,429 @@
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/services"
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+// Handlers respond with declared types and bind request bodies to declared
+// types, and the OpenAPI schemas of both are generated from those types, so the
+// served spec cannot drift from what handlers accept and send. Field
+// descriptions come from `doc` tags, `format` and `enum` tags refine the
+// generated types, and fields bound with `binding:"required"` are required.
+// openapi.yaml describes the operations and refers to the schemas by name; it
+// defines no schemas of its own.
+
+// apiSchemas names the request and response types whose component schemas are
+// generated. A struct field of one of these types is a reference to its schema.
+var apiSchemas = map[string]interface{}{
+	"Error":                            errorBody{},
+	"AccessReviewCampaign":             accessReviewCampaignBody{},
+	"AccessReviewCounts":               services.AccessReviewCounts{},
+	"AccessReviewItem":                 accessReviewItemBody{},
+	"AccessReviewReport":               accessReviewReportBody{},
+	"AccessReviewerProgress":           services.AccessReviewerProgress{},
+	"AcknowledgeAlertRequest":          acknowledgeAlertRequest{},
+	"AcknowledgeAnomalyRequest":        acknowledgeAnomalyRequest{},
+	"Action":                           actionBody{},
+	"ActionApproval":                   actionApprovalBody{},
+	"ActionList":                       actionListBody{},
+	"ActionPending":                    actionPendingBody{},
+	"ActionResult":                     actionResultBody{},
+	"ActionRun":                        actionRunBody{},
+	"ActivityRollup":                   activityRollupBody{},
+	"AdjustLeaveBalanceRequest":        adjustLeaveBalanceRequest{},
+	"Alert":                            alertBody{},
+	"AlertChannel":                     alertChannelBody{},
+	"AlertRule":                        alertRuleBody{},
+	"AnomalyEvent":                     anomalyBody{},
+	"AnswerPushChallengeRequest":       answerPushChallengeRequest{},
+	"AttendancePolicy":                 attendancePolicyBody{},
+	"AttendanceReport":                 attendanceReportBody{},
+	"AuthLog":                          authLogBody{},
+	"AuthLogSummary":                   authLogSummaryBody{},
+	"AuthenticatedDevice":              authenticatedDeviceBody{},
+	"AuthenticatedUser":                authenticatedUserBody{},
+	"BreakGlassCredential":             breakGlassCredentialBody{},
+	"BreakGlassRequest":                breakGlassRequest{},
+	"BreakGlassSession":                breakGlassSessionBody{},
+	"CancelUserStateTransitionRequest": cancelUserStateTransitionRequest{},
+	"ChangePasswordRequest":            changePasswordRequest{},
+	"ChatStatus":                       services.ChatStatus{},
+	"ChatUserLink":                     chatUserLinkBody{},
+	"ChatWorkspace":                    chatWorkspaceBody{},
+	"CheckInVisitorRequest":            checkInVisitorRequest{},
+	"CheckOutVisitorRequest":           checkOutVisitorRequest{},
+	"CreateAccessReviewRequest":        createAccessReviewRequest{},
+	"CreateActionRequest":              createActionRequest{},
+	"CreateAlertChannelRequest":        createAlertChannelRequest{},
+	"CreateAlertRuleRequest":           createAlertRuleRequest{},
+	"CreateAttendancePolicyRequest":    createAttendancePolicyRequest{},
+	"CreateBreakGlassRequest":          createBreakGlassRequest{},
+	"CreateChatWorkspaceRequest":       createChatWorkspaceRequest{},
+	"CreateCustomReportRequest":        createCustomReportRequest{},
+	"CreateDeviceRequest":              createDeviceRequest{},
+	"CreateHRNotificationRuleRequest":  createHRNotificationRuleRequest{},
+	"CreateHolidayRequest":             createHolidayRequest{},
+	"CreateKioskRequest":               createKioskRequest{},
+	"CreateLegalHoldRequest":           createLegalHoldRequest{},
+	"CreateLocationRequest":            createLocationRequest{},
+	"CreatePermissionRequest":          createPermissionRequest{},
+	"CreateReportDefinitionRequest":    createReportDefinitionRequest{},
+	"CreateResourceRequest":            createResourceRequest{},
+	"CreateRoleRequest":                createRoleRequest{},
+	"CreateShiftRequest":               createShiftRequest{},
+	"CreateUserRequest":                createUserRequest{},
+	"CreateUserStatusRequest":          createUserStatusRequest{},
+	"CreateVisitorRequest":             createVisitorRequest{},
+	"CreateWebhookRequest":             createWebhookRequest{},
+	"CustomReport":                     services.CustomReport{},
+	"DecideAccessReviewRequest":        decideAccessReviewRequest{},
+	"DecideActionApprovalRequest":      decideActionApprovalRequest{},
+	"DegradedModeReport":               degradedModeReportBody{},
+	"DeregisterDeviceRequest":          deregisterDeviceRequest{},
+	"Device":                           deviceBody{},
+	"DeviceAttestation":                deviceAttestationBody{},
+	"DeviceAuthRequest":                deviceAuthRequest{},
+	"DeviceAuthResponse":               deviceAuthBody{},
+	"DeviceDeregistered":               deviceDeregisteredBody{},
+	"DeviceHistory":                    deviceHistoryBody{},
+	"DeviceImport":                     services.DeviceImportReport{},
+	"DeviceRegistered":                 deviceRegisteredBody{},
+	"DeviceRegistration":               deviceRegistrationBody{},
+	"DeviceRegistrationSummary":        deviceRegistrationSummaryBody{},
+	"DeviceTransferred":                deviceTransferredBody{},
+	"Door":                             doorBody{},
+	"DoorEvent":                        doorEventBody{},
+	"EraseUserDataRequest":             eraseUserDataRequest{},
+	"ExportUserDataRequest":            exportUserDataRequest{},
+	"GenerateOwnRecoveryCodesRequest":  generateOwnRecoveryCodesRequest{},
+	"HRNotification":                   hrNotificationBody{},
+	"HRNotificationOptOut":             hrNotificationOptOutBody{},
+	"HRNotificationRule":               hrNotificationRuleBody{},
+	"Holiday":                          holidayBody{},
+	"HolidayImport":                    services.HolidayImport{},
+	"Impersonation":                    impersonationBody{},
+	"ImpersonationSession":             impersonationSessionBody{},
+	"ImportDevicesRequest":             importDevicesRequest{},
+	"ImportHolidaysRequest":            importHolidaysRequest{},
+	"Kiosk":                            kioskBody{},
+	"KioskActionRequest":               kioskActionRequest{},
+	"KioskWithSecret":                  kioskSecretBody{},
+	"LeaveBalance":                     services.LeaveBalance{},
+	"LeaveEntry":                       leaveEntryBody{},
+	"LegalHold":                        legalHoldBody{},
+	"LinkChatUserRequest":              linkChatUserRequest{},
+	"Locales":                          localesBody{},
+	"Location":                         locationBody{},
+	"LocationOccupancy":                services.LocationOccupancy{},
+	"LoginNotification":                loginNotificationBody{},
+	"LogoutSessionRequest":             logoutSessionRequest{},
+	"MachineAuthDecision":              machineAuthBody{},
+	"Message":                          messageBody{},
+	"MessageTemplate":                  messageTemplateBody{},
+	"MessageTemplateInfo":              messageTemplateInfoBody{},
+	"MessageTemplateVersion":           messageTemplateVersionBody{},
+	"OccupancyReport":                  occupancyReportBody{},
+	"OpenActivityRepair":               services.OpenActivityRepair{},
+	"OrgChartUser":                     orgChartUserBody{},
+	"OwnSession":                       ownSessionBody{},
+	"PasswordAuthRequest":              passwordAuthRequest{},
+	"PasswordResetLog":                 passwordResetLogBody{},
+	"PerformActionRequest":             performActionRequest{},
+	"Permission":                       permissionBody{},
+	"PreviewTemplateRequest":           previewTemplateRequest{},
+	"PrivacyRequest":                   privacyRequestBody{},
+	"PushAnswer":                       pushAnswerBody{},
+	"PushChallengeStart":               pushChallengeStartBody{},
+	"PushChallengeStatus":              pushChallengeStatusBody{},
+	"QRLogin":                          qrLoginBody{},
+	"QRLoginSession":                   qrLoginSessionBody{},
+	"QRLoginStart":                     qrLoginStartBody{},
+	"QRLoginStatus":                    qrLoginStatusBody{},
+	"RecoveryCodes":                    recoveryCodesBody{},
+	"RecoveryCodesRemaining":           recoveryCodesRemainingBody{},
+	"RecoveryRequest":                  recoveryRequest{},
+	"RecoverySession":                  recoverySessionBody{},
+	"RefreshResponse":                  refreshSessionBody{},
+	"RefreshSessionRequest":            refreshSessionRequest{},
+	"RegisterDeviceRequest":            registerDeviceRequest{},
+	"ReleaseLegalHoldRequest":          releaseLegalHoldRequest{},
+	"ReportDefinition":                 reportDefinitionBody{},
+	"ReportJob":                        reportJobBody{},
+	"ReportJobAccepted":                reportJobAcceptedBody{},
+	"RequestPasswordResetRequest":      requestPasswordResetRequest{},
+	"ResetPasswordRequest":             resetPasswordRequest{},
+	"ResolveAlertRequest":              resolveAlertRequest{},
+	"ResolveAnomalyRequest":            resolveAnomalyRequest{},
+	"ResolveSecurityIncidentRequest":   resolveSecurityIncidentRequest{},
+	"Resource":                         resourceBody{},
+	"RestoreTemplateVersionRequest":    restoreTemplateVersionRequest{},
+	"Role":                             roleBody{},
+	"RoleSummary":                      roleSummaryBody{},
+	"SaveTemplateRequest":              saveTemplateRequest{},
+	"ScheduledAction":                  scheduledActionBody{},
+	"SealedBreakGlassCredential":       breakGlassSecretBody{},
+	"SecurityIncident":                 securityIncidentBody{},
+	"ServerTime":                       serverTimeBody{},
+	"Session":                          sessionDetailsBody{},
+	"SessionResponse":                  sessionBody{},
+	"SessionUser":                      sessionUserBody{},
+	"Shift":                            shiftBody{},
+	"ShiftReport":                      shiftReportBody{},
+	"SlackAuthorizeURL":                slackAuthorizeURLBody{},
+	"SlackCommandReply":                slackCommandReplyBody{},
+	"StartImpersonationRequest":        startImpersonationRequest{},
+	"StartPushChallengeRequest":        startPushChallengeRequest{},
+	"StartQRLoginRequest":              startQRLoginRequest{},
+	"TeamsCommandReply":                teamsCommandReplyBody{},
+	"TemplatePreview":                  templatePreviewBody{},
+	"Timesheet":                        timesheetBody{},
+	"TransferDeviceRequest":            transferDeviceRequest{},
+	"TransitionDeviceStateRequest":     transitionDeviceStateRequest{},
+	"TransitionUserStateRequest":       transitionUserStateRequest{},
+	"UpdateActionRequest":              updateActionRequest{},
+	"UpdateAlertChannelRequest":        updateAlertChannelRequest{},
+	"UpdateAlertRuleRequest":           updateAlertRuleRequest{},
+	"UpdateAttendancePolicyRequest":    updateAttendancePolicyRequest{},
+	"UpdateChatWorkspaceRequest":       updateChatWorkspaceRequest{},
+	"UpdateDeviceRequest":              updateDeviceRequest{},
+	"UpdateHRNotificationRuleRequest":  updateHRNotificationRuleRequest{},
+	"UpdateHolidayRequest":             updateHolidayRequest{},
+	"UpdateKioskRequest":               updateKioskRequest{},
+	"UpdateLocationRequest":            updateLocationRequest{},
+	"UpdateReportDefinitionRequest":    updateReportDefinitionRequest{},
+	"UpdateResourceRequest":            updateResourceRequest{},
+	"UpdateRoleRequest":                updateRoleRequest{},
+	"UpdateShiftRequest":               updateShiftRequest{},
+	"UpdateUserRequest":                updateUserRequest{},
+	"UpdateUserStatusRequest":          updateUserStatusRequest{},
+	"UpdateVisitorRequest":             updateVisitorRequest{},
+	"UpdateWebhookRequest":             updateWebhookRequest{},
+	"User":                             userBody{},
+	"UserActivityHistory":              activityBody{},
+	"UserActivityItem":                 activityItemBody{},
+	"UserActivityList":                 activityListBody{},
+	"UserActivityPeriodSummary":        services.ActivityPeriodSummary{},
+	"UserActivitySummary":              services.ActivitySummary{},
+	"UserActivitySummaryList":          activitySummaryListBody{},
+	"UserAttribute":                    userAttributeBody{},
+	"UserDevices":                      userDevicesBody{},
+	"UserMessage":                      userMessageBody{},
+	"UserState":                        userStateBody{},
+	"UserStateTransition":              userStateTransitionBody{},
+	"UserStatus":                       userStatusBody{},
+	"ValidateMachineAuthRequest":       validateMachineAuthRequest{},
+	"Visitor":                          visitorBody{},
+	"VisitorLog":                       visitorLogBody{},
+	"Webhook":                          webhookBody{},
+}
+
+// OpenAPIDocument returns the spec in base with the generated component
+// schemas added. A schema both generated and written in base is an error, as
+// is a reference to a schema that is neither.
+func OpenAPIDocument(base []byte) (map[string]interface{}, error) {
+	var spec map[string]interface{}
+	if err := yaml.Unmarshal(base, &spec); err != nil {
+		return nil, fmt.Errorf("failed to parse spec: %w", err)
+	}
+
+	components, _ := spec["components"].(map[string]interface{})
+	if components == nil {
+		components = map[string]interface{}{}
+		spec["components"] = components
+	}
+	schemas, _ := components["schemas"].(map[string]interface{})
+	if schemas == nil {
+		schemas = map[string]interface{}{}
+		components["schemas"] = schemas
+	}
+
+	var problems []string
+	for name, schema := range generatedSchemas() {
+		if _, ok := schemas[name]; ok {
+			problems = append(problems, fmt.Sprintf("schema %s is generated from its Go type; remove it from the spec", name))
+			continue
+		}
+		schemas[name] = schema
+	}
+	for _, ref := range schemaRefs(spec) {
+		if _, ok := schemas[strings.TrimPrefix(ref, "#/components/schemas/")]; !ok {
+			problems = append(problems, fmt.Sprintf("%s is referenced but not defined", ref))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return spec, nil
+}
+
+// generatedSchemas returns the component schemas of apiSchemas, by name
+func generatedSchemas() map[string]interface{} {
+	names := make(map[reflect.Type]string, len(apiSchemas))
+	for name, value := range apiSchemas {
+		names[reflect.TypeOf(value)] = name
+	}
+
+	schemas := make(map[string]interface{}, len(apiSchemas))
+	for name, value := range apiSchemas {
+		schema := structSchema(reflect.TypeOf(value), names)
+		if described, ok := value.(describedSchema); ok {
+			schema["description"] = described.schemaDescription()
+		}
+		schemas[name] = schema
+	}
+	return schemas
+}
+
+// describedSchema is implemented by types whose schema has a description of
+// its own, rather than only its fields'
+type describedSchema interface {
+	schemaDescription() string
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	uuidType      = reflect.TypeOf(uuid.UUID{})
+	errorCodeType = reflect.TypeOf(services.ErrorCode(""))
+)
+
+// typeSchema returns the schema of values of t. Named schemas are referenced
+// rather than inlined.
+func typeSchema(t reflect.Type, names map[reflect.Type]string) map[string]interface{} {
+	if name, ok := names[t]; ok {
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case uuidType:
+		return map[string]interface{}{"type": "string", "format": "uuid"}
+	case errorCodeType:
+		// Every code has a status, so errorStatuses lists them all
+		var codes []string
+		for code := range errorStatuses {
+			codes = append(codes, string(code))
+		}
+		sort.Strings(codes)
+		values := make([]interface{}, len(codes))
+		for i, code := range codes {
+			values[i] = code
+		}
+		return map[string]interface{}{"type": "string", "enum": values}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := typeSchema(t.Elem(), names)
+		if _, ok := schema["$ref"]; ok {
+			// Siblings of $ref are ignored, so a nullable reference is wrapped
+			schema = map[string]interface{}{"allOf": []interface{}{schema}}
+		}
+		schema["nullable"] = true
+		return schema
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), names)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem(), names)}
+	case reflect.Struct:
+		return structSchema(t, names)
+	}
+	return map[string]interface{}{}
+}
+
+// structSchema returns the object schema of a struct, with a property for
+// each field encoding/json reads and writes, including those of embedded
+// structs
+func structSchema(t reflect.Type, names map[reflect.Type]string) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	addStructProperties(t, names, properties, &required)
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		values := make([]interface{}, len(required))
+		for i, name := range required {
+			values[i] = name
+		}
+		schema["required"] = values
+	}
+	return schema
+}
+
+// addStructProperties adds the properties of t's fields to properties, and the
+// names of those bound as required to required
+func addStructProperties(t reflect.Type, names map[reflect.Type]string, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			addStructProperties(field.Type, names, properties, required)
+			continue
+		}
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if slices.Contains(strings.Split(field.Tag.Get("binding"), ","), "required") {
+			*required = append(*required, name)
+		}
+
+		schema := typeSchema(field.Type, names)
+		if format := field.Tag.Get("format"); format != "" {
+			schema["format"] = format
+		}
+		if enum, ok := field.Tag.Lookup("enum"); ok {
+			var values []interface{}
+			for _, value := range strings.Split(enum, ",") {
+				values = append(values, value)
+			}
+			schema["enum"] = values
+		}
+		if doc := field.Tag.Get("doc"); doc != "" {
+			schema["description"] = doc
+		}
+		properties[name] = schema
+	}
+}
+
+// schemaRefs returns the component schema references anywhere in node
+func schemaRefs(node interface{}) []string {
+	var refs []string
+	switch value := node.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if ref, ok := child.(string); ok && key == "$ref" && strings.HasPrefix(ref, "#/components/schemas/") {
+				refs = append(refs, ref)
+				continue
+			}
+			refs = append(refs, schemaRefs(child)...)
+		}
+	case []interface{}:
+		for _, child := range value {
+			refs = append(refs, schemaRefs(child)...)
+		}
+	}
+	return refs
+}
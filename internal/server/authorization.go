@@ -0,0 +1,189 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// builtinRoutePermissions are the groups whose permissions differ from the
+// read/write defaults unless overridden in authorization.routes
+var builtinRoutePermissions = map[string]map[string]string{
+	"privacy":       {"*": services.PrivacyPermission},
+	"impersonation": {"*": services.ImpersonatePermission},
+	"templates":     {"*": services.TemplatesPermission},
+}
+
+// routeAuthorizer resolves the permission each route group and HTTP method
+// requires from the authorization config and enforces it
+type routeAuthorizer struct {
+	authService    *services.AuthService
+	sessionService *services.SessionService
+	identities     *services.ServiceIdentities
+	defaultRead    string
+	defaultWrite   string
+	routes         map[string]map[string]string
+	used           map[string]bool
+}
+
+func newRouteAuthorizer(authService *services.AuthService, sessionService *services.SessionService, identities *services.ServiceIdentities, cfg config.AuthorizationConfig) *routeAuthorizer {
+	a := &routeAuthorizer{
+		authService:    authService,
+		sessionService: sessionService,
+		identities:     identities,
+		defaultRead:    cfg.DefaultRead,
+		defaultWrite:   cfg.DefaultWrite,
+		routes:         map[string]map[string]string{},
+		used:           map[string]bool{},
+	}
+	if a.defaultRead == "" {
+		a.defaultRead = "yubiapp:read"
+	}
+	if a.defaultWrite == "" {
+		a.defaultWrite = "yubiapp:write"
+	}
+
+	// Config keys are case-insensitive; methods are matched in upper case
+	for group, methods := range cfg.Routes {
+		group = strings.ToLower(group)
+		a.routes[group] = map[string]string{}
+		for method, permission := range methods {
+			if !validPermission(permission) {
+				log.Printf("authorization.routes.%s.%s: ignoring %q (expected 'resource:action' or a permission UUID)", group, method, permission)
+				continue
+			}
+			a.routes[group][strings.ToUpper(method)] = permission
+		}
+	}
+	return a
+}
+
+// permission returns the permission required for method on a route group
+func (a *routeAuthorizer) permission(group, method string) string {
+	for _, methods := range []map[string]string{a.routes[group], builtinRoutePermissions[group]} {
+		if permission, ok := methods[method]; ok {
+			return permission
+		}
+		if permission, ok := methods["*"]; ok {
+			return permission
+		}
+	}
+	if isReadMethod(method) {
+		return a.defaultRead
+	}
+	return a.defaultWrite
+}
+
+// require authenticates a request and checks the permission its group and method
+// need. Reads accept device or session auth; other methods need device auth.
+// Requests without an Authorization header may authenticate with a verified
+// TLS client certificate instead.
+func (a *routeAuthorizer) require(group string) gin.HandlerFunc {
+	return a.requireOr(group, nil)
+}
+
+// authenticated authenticates a request by device or session without
+// requiring a permission, for routes acting only on the caller's own account.
+// Sessions are accepted for every method.
+func (a *routeAuthorizer) authenticated() gin.HandlerFunc {
+	return authMiddlewareRead(a.authService, a.sessionService, "", nil)
+}
+
+// requireOrManager is require for routes about the user named by the param
+// route parameter, which that user's manager may also read without the
+// group's permission
+func (a *routeAuthorizer) requireOrManager(group, param string) gin.HandlerFunc {
+	return a.requireOr(group, func(c *gin.Context, user *database.User) bool {
+		reportID, err := uuid.Parse(c.Param(param))
+		if err != nil {
+			return false
+		}
+		_, err = a.authService.DirectReport(user.ID, reportID)
+		return err == nil
+	})
+}
+
+// requireOrSelfOrManager is requireOrManager that also lets the user named
+// by the param route parameter read their own records
+func (a *routeAuthorizer) requireOrSelfOrManager(group, param string) gin.HandlerFunc {
+	return a.requireOr(group, func(c *gin.Context, user *database.User) bool {
+		userID, err := uuid.Parse(c.Param(param))
+		if err != nil {
+			return false
+		}
+		if userID == user.ID {
+			return true
+		}
+		_, err = a.authService.DirectReport(user.ID, userID)
+		return err == nil
+	})
+}
+
+// requireOr is require with a grant that lets users without the permission
+// read anyway
+func (a *routeAuthorizer) requireOr(group string, grant readGrant) gin.HandlerFunc {
+	a.used[group] = true
+	return func(c *gin.Context) {
+		permission := a.permission(group, c.Request.Method)
+		if c.GetHeader("Authorization") == "" && clientCertificate(c) != nil {
+			authMiddlewareClientCert(a.authService, a.identities, permission)(c)
+			return
+		}
+		if isReadMethod(c.Request.Method) {
+			authMiddlewareRead(a.authService, a.sessionService, permission, grant)(c)
+			return
+		}
+		authMiddlewareWrite(a.authService, a.sessionService, permission)(c)
+	}
+}
+
+// allows reports whether the caller a request authenticated as may read a
+// route group, for handlers that return records of several groups
+func (a *routeAuthorizer) allows(c *gin.Context, group string) bool {
+	permission := a.permission(group, http.MethodGet)
+	if _, ok := c.Get("service_identity"); ok {
+		identity := a.identities.Match(clientCertificate(c))
+		return identity != nil && identity.Allows(permission)
+	}
+	user, ok := c.Get("user")
+	if !ok {
+		return false
+	}
+	return a.authService.UserHasPermission(user.(*database.User), permission)
+}
+
+// warnUnusedGroups logs configured route groups that no route uses, which are
+// most likely typos
+func (a *routeAuthorizer) warnUnusedGroups() {
+	var unused []string
+	for group := range a.routes {
+		if !a.used[group] {
+			unused = append(unused, group)
+		}
+	}
+	sort.Strings(unused)
+	for _, group := range unused {
+		log.Printf("authorization.routes.%s does not match any route group", group)
+	}
+}
+
+// isReadMethod reports whether an HTTP method only reads
+func isReadMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead
+}
+
+// validPermission checks a permission is a UUID or in "resource:action" format
+func validPermission(permission string) bool {
+	if _, err := uuid.Parse(permission); err == nil {
+		return true
+	}
+	parts := strings.Split(permission, ":")
+	return len(parts) == 2 && parts[0] != "" && parts[1] != ""
+}
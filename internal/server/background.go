@@ -0,0 +1,73 @@
+package server
+
+import (
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/jobs"
+	"github.com/YubiApp/internal/services"
+)
+
+// backgroundTasks are the schedulers that run apart from request handling: in
+// cmd/worker, and in the API process unless worker.schedulers_in_api is off
+type backgroundTasks struct {
+	attendance *services.AttendanceService
+	alerts     *services.AlertService
+	anomalies  *services.AnomalyService
+	analytics  *services.DeviceAnalyticsService
+	usage      *services.PermissionUsageService
+	reviews    *services.AccessReviewService
+	hr         *services.HRNotificationService
+	retention  *services.RetentionService
+	partitions *services.PartitionService
+	rollups    *services.UserActivityService
+	lifecycle  *services.UserLifecycleService
+	actions    *services.ActionSchedulerService
+	reports    *services.ReportService
+	shifts     *services.ShiftService
+	sessions   *services.PostgresSessionStore
+}
+
+func (b *backgroundTasks) start(cfg *config.Config) {
+	b.attendance.StartNotifier()
+	b.alerts.StartEvaluator()
+	b.anomalies.StartAnalyzer()
+	b.analytics.StartReporter()
+	b.usage.StartTracker()
+	b.reviews.StartScheduler()
+	b.hr.StartRetrier()
+	b.retention.StartPurger()
+	b.retention.StartArchiver()
+	b.partitions.StartMaintenance()
+	b.rollups.StartRollups()
+	b.lifecycle.StartScheduler(cfg.Lifecycle.ApplyInterval)
+	b.actions.StartScheduler()
+	b.reports.StartScheduler()
+	b.shifts.StartNotifier()
+	b.sessions.StartCleanup()
+}
+
+// stop stops the schedulers; those never started are left alone
+func (b *backgroundTasks) stop() {
+	b.attendance.StopNotifier()
+	b.alerts.StopEvaluator()
+	b.anomalies.StopAnalyzer()
+	b.analytics.StopReporter()
+	b.usage.StopTracker()
+	b.reviews.StopScheduler()
+	b.hr.StopRetrier()
+	b.retention.StopPurger()
+	b.retention.StopArchiver()
+	b.partitions.StopMaintenance()
+	b.rollups.StopRollups()
+	b.lifecycle.StopScheduler()
+	b.actions.StopScheduler()
+	b.reports.StopScheduler()
+	b.shifts.StopNotifier()
+	b.sessions.StopCleanup()
+}
+
+// registerJobHandlers registers the handlers of every queued job type, so the
+// API process and cmd/worker can run the same jobs
+func registerJobHandlers(worker *jobs.Worker, webhookService *services.WebhookService, reportService *services.ReportService) {
+	webhookService.RegisterJobs(worker)
+	reportService.RegisterJobs(worker)
+}
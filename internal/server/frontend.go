@@ -0,0 +1,61 @@
+package server
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serveFrontend serves the built React app for requests no route matched.
+// Files in dist are served as they are; other GET paths outside /api get
+// index.html so the app's client-side routes survive a reload. Vite names
+// everything under assets/ by content hash, so those are cached for good while
+// index.html and the other files are revalidated.
+func serveFrontend(router *gin.Engine, dist fs.FS, contentSecurityPolicy string) error {
+	if dist == nil {
+		return errors.New("this binary was built without the frontend; build it with `make bundle`")
+	}
+	index, err := fs.ReadFile(dist, "index.html")
+	if err != nil {
+		return errors.New("the embedded frontend has no index.html; run `npm run build` in frontend/ before `make bundle`")
+	}
+	files := http.FS(dist)
+
+	router.NoRoute(func(c *gin.Context) {
+		requestPath := c.Request.URL.Path
+		if (c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead) ||
+			requestPath == "/api" || strings.HasPrefix(requestPath, "/api/") {
+			errorResponse(c, http.StatusNotFound, "Not found")
+			return
+		}
+
+		c.Header("X-Content-Type-Options", "nosniff")
+		if contentSecurityPolicy != "" {
+			c.Header("Content-Security-Policy", contentSecurityPolicy)
+		}
+
+		name := strings.TrimPrefix(path.Clean(requestPath), "/")
+		if info, err := fs.Stat(dist, name); err == nil && !info.IsDir() && name != "index.html" {
+			if strings.HasPrefix(name, "assets/") {
+				c.Header("Cache-Control", "public, max-age=31536000, immutable")
+			} else {
+				c.Header("Cache-Control", "no-cache")
+			}
+			c.FileFromFS(name, files)
+			return
+		}
+		if strings.HasPrefix(name, "assets/") {
+			// A stale page asking for assets of an older build
+			c.Status(http.StatusNotFound)
+			return
+		}
+
+		c.Header("Cache-Control", "no-cache")
+		c.Data(http.StatusOK, "text/html; charset=utf-8", index)
+	})
+	return nil
+}
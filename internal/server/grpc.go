@@ -0,0 +1,451 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/logging"
+	"github.com/YubiApp/internal/services"
+	"github.com/YubiApp/pkg/yubiapppb"
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcErrorDomain is the ErrorInfo domain of the service error codes attached
+// to gRPC errors
+const grpcErrorDomain = "yubiapp"
+
+// grpcCodes maps the HTTP status an error is reported with to its gRPC code
+var grpcCodes = map[int]codes.Code{
+	http.StatusBadRequest:          codes.InvalidArgument,
+	http.StatusUnauthorized:        codes.Unauthenticated,
+	http.StatusForbidden:           codes.PermissionDenied,
+	http.StatusNotFound:            codes.NotFound,
+	http.StatusConflict:            codes.Aborted,
+	http.StatusLocked:              codes.FailedPrecondition,
+	http.StatusTooManyRequests:     codes.ResourceExhausted,
+	http.StatusBadGateway:          codes.Unavailable,
+	http.StatusInternalServerError: codes.Internal,
+}
+
+// grpcAPI serves the gRPC API (pkg/yubiapppb) for internal services.
+// PerformAction runs through the HTTP router in process, so actions behave
+// exactly as they do over HTTP.
+type grpcAPI struct {
+	yubiapppb.UnimplementedYubiAppServer
+	authService *services.AuthService
+	userService *services.UserService
+	authz       *routeAuthorizer
+	router      http.Handler
+}
+
+// grpcCall is what the interceptors learn about a call, for its log line
+type grpcCall struct {
+	userID          uuid.UUID
+	authMethod      string
+	serviceIdentity string
+}
+
+type grpcCallKey struct{}
+
+// newGRPCServer creates the gRPC server, with TLS (and client certificates)
+// when tlsConfig is set
+func newGRPCServer(api *grpcAPI, tlsConfig *tls.Config) *grpc.Server {
+	options := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(grpcLogger(), grpcRecovery(), api.authenticate),
+	}
+	if tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	server := grpc.NewServer(options...)
+	yubiapppb.RegisterYubiAppServer(server, api)
+
+	// For gRPC health probes from the orchestrator
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", grpc_health_v1.HealthCheckResponse_SERVING)
+	grpc_health_v1.RegisterHealthServer(server, healthServer)
+	return server
+}
+
+// grpcLogger gives each call a request ID, reusing a well-formed incoming
+// x-request-id, carries it and the peer's IP in the call context, and writes
+// one structured log line per call like requestLogger
+func grpcLogger() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		md, _ := metadata.FromIncomingContext(ctx)
+		requestID := firstMetadata(md, "x-request-id")
+		if !validRequestID(requestID) {
+			requestID = uuid.New().String()
+		}
+		grpc.SetHeader(ctx, metadata.Pairs("x-request-id", requestID))
+		call := &grpcCall{}
+		ctx = context.WithValue(logging.WithRequestID(ctx, requestID), grpcCallKey{}, call)
+		if p, ok := peer.FromContext(ctx); ok {
+			if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+				ctx = services.WithClientIP(ctx, host)
+			}
+		}
+
+		resp, err := handler(ctx, req)
+
+		code := status.Code(err)
+		attrs := []any{
+			"method", info.FullMethod,
+			"code", code.String(),
+			"latency_ms", time.Since(start).Milliseconds(),
+		}
+		if p, ok := peer.FromContext(ctx); ok {
+			attrs = append(attrs, "peer", p.Addr.String())
+		}
+		if call.userID != uuid.Nil {
+			attrs = append(attrs, "user_id", call.userID)
+		}
+		if call.authMethod != "" {
+			attrs = append(attrs, "auth_method", call.authMethod)
+		}
+		if call.serviceIdentity != "" {
+			attrs = append(attrs, "service_identity", call.serviceIdentity)
+		}
+		if err != nil {
+			attrs = append(attrs, "errors", status.Convert(err).Message())
+		}
+
+		level := slog.LevelInfo
+		switch code {
+		case codes.OK:
+		case codes.Internal, codes.Unknown, codes.DataLoss:
+			level = slog.LevelError
+		default:
+			level = slog.LevelWarn
+		}
+		logging.FromContext(ctx).Log(ctx, level, "grpc", attrs...)
+		return resp, err
+	}
+}
+
+// grpcRecovery turns a panicking handler into an Internal error
+func grpcRecovery() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("gRPC %s panicked: %v", info.FullMethod, r)
+				err = status.Error(codes.Internal, "internal error")
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// authenticate authenticates calls that need it, with the permission the
+// users route group requires for reads. AuthenticateDevice and PerformAction
+// carry the user's own credentials and are checked by the call itself.
+func (g *grpcAPI) authenticate(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	switch info.FullMethod {
+	case yubiapppb.YubiApp_AuthenticateDevice_FullMethodName, yubiapppb.YubiApp_PerformAction_FullMethodName:
+		return handler(ctx, req)
+	case yubiapppb.YubiApp_GetUser_FullMethodName, yubiapppb.YubiApp_CheckPermission_FullMethodName:
+	default:
+		// Not part of the API (e.g. health checks)
+		if !strings.HasPrefix(info.FullMethod, "/"+yubiapppb.YubiApp_ServiceDesc.ServiceName+"/") {
+			return handler(ctx, req)
+		}
+		return nil, status.Errorf(codes.Unimplemented, "method %s is not available", info.FullMethod)
+	}
+	permission := g.authz.permission("users", http.MethodGet)
+	call, _ := ctx.Value(grpcCallKey{}).(*grpcCall)
+	if call == nil {
+		call = &grpcCall{}
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	if authorization := firstMetadata(md, "authorization"); authorization != "" {
+		if strings.HasPrefix(authorization, "Bearer ") {
+			return nil, grpcStatus(http.StatusUnauthorized, services.CodeAuthFailed, "session tokens are not accepted over gRPC; use a device code or a client certificate")
+		}
+		deviceType, authCode, ok := strings.Cut(authorization, ":")
+		deviceType, authCode = strings.TrimSpace(deviceType), strings.TrimSpace(authCode)
+		if !ok || deviceType == "" || authCode == "" {
+			return nil, grpcStatus(http.StatusUnauthorized, services.CodeAuthFailed, "invalid authorization metadata. Expected: 'device_type:auth_code'")
+		}
+		user, _, err := g.authService.AuthenticateDeviceContext(ctx, deviceType, authCode, permission)
+		if err != nil {
+			return nil, grpcError(http.StatusUnauthorized, fmt.Errorf("Authentication failed: %w", err))
+		}
+		call.userID, call.authMethod = user.ID, "device"
+		return handler(ctx, req)
+	}
+
+	cert := grpcClientCertificate(ctx)
+	if cert == nil {
+		return nil, grpcStatus(http.StatusUnauthorized, services.CodeAuthFailed, "authorization metadata or a client certificate is required")
+	}
+	identity := g.authz.identities.Match(cert)
+	if identity == nil {
+		return nil, grpcStatus(http.StatusUnauthorized, services.CodeAuthFailed, "client certificate is not mapped to a service identity")
+	}
+	user, err := g.authService.AuthenticateServiceIdentity(ctx, identity, permission)
+	if err != nil {
+		return nil, grpcError(http.StatusUnauthorized, fmt.Errorf("Authentication failed: %w", err))
+	}
+	call.userID, call.authMethod, call.serviceIdentity = user.ID, "client_certificate", identity.Name
+	return handler(ctx, req)
+}
+
+// AuthenticateDevice verifies a user's device code
+func (g *grpcAPI) AuthenticateDevice(ctx context.Context, req *yubiapppb.AuthenticateDeviceRequest) (*yubiapppb.AuthenticateDeviceResponse, error) {
+	if req.DeviceType == "" || req.AuthCode == "" {
+		return nil, grpcStatus(http.StatusBadRequest, services.CodeValidationFailed, "device_type and auth_code are required")
+	}
+	user, device, err := g.authService.AuthenticateDeviceContext(ctx, req.DeviceType, req.AuthCode, req.Permission)
+	if err != nil {
+		return nil, grpcError(http.StatusUnauthorized, fmt.Errorf("Authentication failed: %w", err))
+	}
+	if call, ok := ctx.Value(grpcCallKey{}).(*grpcCall); ok {
+		call.userID, call.authMethod = user.ID, "device"
+	}
+	return &yubiapppb.AuthenticateDeviceResponse{User: userMessage(user), Device: deviceMessage(device)}, nil
+}
+
+// CheckPermission reports whether a user holds a permission
+func (g *grpcAPI) CheckPermission(ctx context.Context, req *yubiapppb.CheckPermissionRequest) (*yubiapppb.CheckPermissionResponse, error) {
+	userID, err := uuid.Parse(req.UserId)
+	if err != nil {
+		return nil, grpcStatus(http.StatusBadRequest, services.CodeValidationFailed, "invalid user_id")
+	}
+	allowed, err := g.authService.CheckUserPermission(ctx, userID, req.Permission)
+	if err != nil {
+		return nil, grpcError(http.StatusInternalServerError, err)
+	}
+	return &yubiapppb.CheckPermissionResponse{Allowed: allowed}, nil
+}
+
+// GetUser looks a user up by ID, username or email
+func (g *grpcAPI) GetUser(ctx context.Context, req *yubiapppb.GetUserRequest) (*yubiapppb.GetUserResponse, error) {
+	var user *database.User
+	var err error
+	switch lookup := req.Lookup.(type) {
+	case *yubiapppb.GetUserRequest_Id:
+		userID, parseErr := uuid.Parse(lookup.Id)
+		if parseErr != nil {
+			return nil, grpcStatus(http.StatusBadRequest, services.CodeValidationFailed, "invalid id")
+		}
+		user, err = g.userService.GetUserByID(userID)
+	case *yubiapppb.GetUserRequest_Username:
+		user, err = g.userService.GetUserByUsername(lookup.Username)
+	case *yubiapppb.GetUserRequest_Email:
+		user, err = g.userService.GetUserByEmail(lookup.Email)
+	default:
+		return nil, grpcStatus(http.StatusBadRequest, services.CodeValidationFailed, "one of id, username or email is required")
+	}
+	if err != nil {
+		return nil, grpcError(http.StatusInternalServerError, err)
+	}
+	return &yubiapppb.GetUserResponse{User: userMessage(user)}, nil
+}
+
+// PerformAction performs an action by POSTing to /api/v1/auth/action/{action}
+// in process, with the request's authorization and parameters
+func (g *grpcAPI) PerformAction(ctx context.Context, req *yubiapppb.PerformActionRequest) (*yubiapppb.PerformActionResponse, error) {
+	if req.Action == "" {
+		return nil, grpcStatus(http.StatusBadRequest, services.CodeValidationFailed, "action is required")
+	}
+	body := []byte("{}")
+	if req.Parameters != nil {
+		var err error
+		if body, err = req.Parameters.MarshalJSON(); err != nil {
+			return nil, grpcStatus(http.StatusBadRequest, services.CodeValidationFailed, "invalid parameters: "+err.Error())
+		}
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, "/api/v1/auth/action/"+url.PathEscape(req.Action), bytes.NewReader(body))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to build action request: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", req.Authorization)
+	httpReq.Header.Set("X-Request-ID", logging.RequestID(ctx))
+	md, _ := metadata.FromIncomingContext(ctx)
+	if userAgent := firstMetadata(md, "user-agent"); userAgent != "" {
+		httpReq.Header.Set("User-Agent", userAgent)
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		httpReq.RemoteAddr = p.Addr.String()
+	}
+
+	recorder := newResponseBuffer()
+	g.router.ServeHTTP(recorder, httpReq)
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(recorder.body.Bytes(), &result); err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected action response (HTTP %d)", recorder.status)
+	}
+	if recorder.status >= 300 {
+		message, _ := result["error"].(string)
+		code, _ := result["code"].(string)
+		return nil, grpcStatus(recorder.status, services.ErrorCode(code), message)
+	}
+
+	resp := &yubiapppb.PerformActionResponse{PendingApproval: recorder.status == http.StatusAccepted}
+	resp.Success, _ = result["success"].(bool)
+	resp.Message, _ = result["message"].(string)
+	if resp.Result, err = structpb.NewStruct(result); err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected action response: %v", err)
+	}
+	return resp, nil
+}
+
+// grpcError reports a service error with the gRPC code of the status its error
+// code maps to, or of fallbackStatus for errors without a code
+func grpcError(fallbackStatus int, err error) error {
+	code := services.ErrorCodeOf(err)
+	statusCode, ok := errorStatuses[code]
+	if !ok {
+		statusCode = fallbackStatus
+		code = defaultErrorCode(fallbackStatus)
+	}
+	return grpcStatus(statusCode, code, err.Error())
+}
+
+// grpcStatus builds a gRPC error carrying the service error code as an
+// ErrorInfo reason, as clients match on it
+func grpcStatus(statusCode int, code services.ErrorCode, message string) error {
+	grpcCode, ok := grpcCodes[statusCode]
+	if !ok {
+		grpcCode = codes.Unknown
+	}
+	st := status.New(grpcCode, message)
+	if code == "" {
+		return st.Err()
+	}
+	if detailed, err := st.WithDetails(&errdetails.ErrorInfo{Reason: string(code), Domain: grpcErrorDomain}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// grpcClientCertificate returns the call's TLS client certificate once
+// verified against server.tls.client_ca_file, or nil
+func grpcClientCertificate(ctx context.Context) *x509.Certificate {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return tlsInfo.State.VerifiedChains[0][0]
+}
+
+// firstMetadata returns the first value of a metadata key, or ""
+func firstMetadata(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// userMessage converts a user for the gRPC API
+func userMessage(user *database.User) *yubiapppb.User {
+	message := &yubiapppb.User{
+		Id:        user.ID.String(),
+		Username:  user.Username,
+		Email:     user.Email,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Active:    user.Active,
+		State:     user.State,
+		CreatedAt: timestamppb.New(user.CreatedAt),
+	}
+	for _, role := range user.Roles {
+		message.Roles = append(message.Roles, role.Name)
+	}
+	return message
+}
+
+// deviceMessage converts a device for the gRPC API
+func deviceMessage(device *database.Device) *yubiapppb.Device {
+	return &yubiapppb.Device{
+		Id:         device.ID.String(),
+		Type:       device.Type,
+		Name:       device.Name,
+		Identifier: device.Identifier,
+		Active:     device.Active,
+	}
+}
+
+// responseBuffer is an http.ResponseWriter collecting an in-process response
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseBuffer() *responseBuffer {
+	return &responseBuffer{header: http.Header{}, status: http.StatusOK}
+}
+
+func (r *responseBuffer) Header() http.Header {
+	return r.header
+}
+
+func (r *responseBuffer) Write(data []byte) (int, error) {
+	return r.body.Write(data)
+}
+
+func (r *responseBuffer) WriteHeader(statusCode int) {
+	r.status = statusCode
+}
+
+// serveGRPC serves gRPC on listen until the server is stopped
+func serveGRPC(server *grpc.Server, listen string) error {
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen for gRPC on %s: %w", listen, err)
+	}
+	log.Printf("Serving gRPC on %s", listener.Addr())
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			log.Printf("gRPC server stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// stopGRPC stops the gRPC server, waiting for running calls until ctx is done
+func stopGRPC(ctx context.Context, server *grpc.Server) {
+	done := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		server.Stop()
+	}
+}
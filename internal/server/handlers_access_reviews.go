@@ -0,0 +1,354 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Access review handlers
+
+// handleListAccessReviews handles GET /access-reviews
+func handleListAccessReviews(reviewService *services.AccessReviewService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := services.AccessReviewCampaignFilter{
+			Status: c.Query("status"),
+			Limit:  50,
+		}
+		if limitStr := c.Query("limit"); limitStr != "" {
+			if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+				filter.Limit = l
+			}
+		}
+		if offsetStr := c.Query("offset"); offsetStr != "" {
+			if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+				filter.Offset = o
+			}
+		}
+
+		campaigns, total, err := reviewService.ListCampaigns(filter)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+		ids := make([]uuid.UUID, len(campaigns))
+		for i := range campaigns {
+			ids[i] = campaigns[i].ID
+		}
+		counts, err := reviewService.CampaignCounts(ids...)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		campaignList := make([]accessReviewCampaignBody, len(campaigns))
+		for i := range campaigns {
+			campaignList[i] = accessReviewCampaignResponse(&campaigns[i], counts[campaigns[i].ID])
+		}
+
+		listResponse(c, campaignList, total)
+	}
+}
+
+// createAccessReviewRequest is the body of POST /access-reviews
+type createAccessReviewRequest struct {
+	Name         string `json:"name"`
+	ReviewerType string `json:"reviewer_type" binding:"required" enum:"manager,role_owner"`
+	RoleID       string `json:"role_id" format:"uuid" doc:"Empty reviews every role"`
+	DueAt        string `json:"due_at" doc:"RFC 3339 time or YYYY-MM-DD; defaults to access_reviews.duration from now"`
+	Nonce        string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleCreateAccessReview handles POST /access-reviews
+func handleCreateAccessReview(reviewService *services.AccessReviewService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req createAccessReviewRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		roleID, err := parseOptionalUUID(req.RoleID)
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid role_id")
+			return
+		}
+		var dueAt *time.Time
+		if req.DueAt != "" {
+			t, err := parseReportTime(req.DueAt, true)
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Invalid due_at: "+err.Error())
+				return
+			}
+			dueAt = &t
+		}
+
+		createdByID := c.MustGet("user_id").(uuid.UUID)
+		campaign, err := reviewService.CreateCampaign(req.Name, req.ReviewerType, roleID, dueAt, &createdByID, time.Now())
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+		counts, err := reviewService.CampaignCounts(campaign.ID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		createdResponse(c, accessReviewCampaignResponse(campaign, counts[campaign.ID]))
+	}
+}
+
+// handleGetAccessReview handles GET /access-reviews/:id
+func handleGetAccessReview(reviewService *services.AccessReviewService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		campaignID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid access review ID")
+			return
+		}
+
+		campaign, err := reviewService.GetCampaign(campaignID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+		counts, err := reviewService.CampaignCounts(campaign.ID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, accessReviewCampaignResponse(campaign, counts[campaign.ID]))
+	}
+}
+
+// accessReviewReportBody is a campaign's completion, overall and by reviewer
+type accessReviewReportBody struct {
+	Campaign        accessReviewCampaignBody          `json:"campaign"`
+	GeneratedAt     time.Time                         `json:"generated_at"`
+	Overdue         bool                              `json:"overdue" doc:"Still open past its due date"`
+	PercentComplete float64                           `json:"percent_complete"`
+	Counts          services.AccessReviewCounts       `json:"counts"`
+	Reviewers       []services.AccessReviewerProgress `json:"reviewers" doc:"Progress by reviewer, most pending first"`
+}
+
+// handleAccessReviewReport handles GET /access-reviews/:id/report
+func handleAccessReviewReport(reviewService *services.AccessReviewService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		campaignID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid access review ID")
+			return
+		}
+
+		report, err := reviewService.GetReport(campaignID, time.Now())
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, accessReviewReportBody{
+			Campaign:        accessReviewCampaignResponse(&report.Campaign, report.AccessReviewCounts),
+			GeneratedAt:     report.GeneratedAt,
+			Overdue:         report.Overdue,
+			PercentComplete: report.PercentComplete,
+			Counts:          report.AccessReviewCounts,
+			Reviewers:       report.Reviewers,
+		})
+	}
+}
+
+// handleListAccessReviewItems handles GET /access-reviews/items
+func handleListAccessReviewItems(reviewService *services.AccessReviewService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := services.AccessReviewItemFilter{
+			Decision: c.Query("decision"),
+			Limit:    50,
+		}
+
+		var err error
+		if filter.CampaignID, err = parseOptionalUUID(c.Query("campaign_id")); err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid campaign_id")
+			return
+		}
+		if filter.ReviewerID, err = parseOptionalUUID(c.Query("reviewer_id")); err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid reviewer_id")
+			return
+		}
+		if filter.UserID, err = parseOptionalUUID(c.Query("user_id")); err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid user_id")
+			return
+		}
+		if limitStr := c.Query("limit"); limitStr != "" {
+			if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+				filter.Limit = l
+			}
+		}
+		if offsetStr := c.Query("offset"); offsetStr != "" {
+			if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+				filter.Offset = o
+			}
+		}
+
+		items, total, err := reviewService.ListItems(filter)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemList := make([]accessReviewItemBody, len(items))
+		for i := range items {
+			itemList[i] = accessReviewItemResponse(&items[i])
+		}
+
+		listResponse(c, itemList, total)
+	}
+}
+
+// ownAccessReviewItems lets reviewers list the items assigned to them, with
+// reviewer_id set to their own ID
+func ownAccessReviewItems(c *gin.Context, user *database.User) bool {
+	return c.Query("reviewer_id") == user.ID.String()
+}
+
+// decideAccessReviewRequest is the optional body of POST
+// /auth/access-reviews/items/:id/approve and /revoke
+type decideAccessReviewRequest struct {
+	Note  string `json:"note" doc:"Reason for the decision"`
+	Nonce string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleDecideAccessReview handles POST /auth/access-reviews/items/:id/approve
+// and /revoke. The reviewer confirms with their own device OTP; holders of
+// the access-reviews write permission may decide any assignment.
+func handleDecideAccessReview(authService *services.AuthService, reviewService *services.AccessReviewService, authz *routeAuthorizer, approve bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		itemID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid access review item ID")
+			return
+		}
+
+		// Decisions are confirmed with a device, never a session
+		authHeader := c.GetHeader("Authorization")
+		if !strings.HasPrefix(authHeader, "yubikey:") || len(authHeader) == len("yubikey:") {
+			errorResponse(c, http.StatusUnauthorized, "Invalid authorization format. Expected: yubikey:<device_code>")
+			return
+		}
+		reviewer, _, err := authService.AuthenticateDeviceContext(c.Request.Context(), "yubikey", strings.TrimPrefix(authHeader, "yubikey:"), "")
+		if err != nil {
+			serviceErrorResponse(c, http.StatusUnauthorized, err)
+			return
+		}
+
+		var req decideAccessReviewRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				bindErrorResponse(c, err)
+				return
+			}
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		admin := authService.UserHasPermission(reviewer, authz.permission("access-reviews", http.MethodPost))
+		item, err := reviewService.Decide(itemID, reviewer.ID, admin, approve, req.Note, time.Now())
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, accessReviewItemResponse(item))
+	}
+}
+
+// accessReviewCampaignBody is the API representation of an access review campaign
+type accessReviewCampaignBody struct {
+	ID           uuid.UUID                   `json:"id"`
+	Name         string                      `json:"name"`
+	ReviewerType string                      `json:"reviewer_type" enum:"manager,role_owner"`
+	RoleID       *uuid.UUID                  `json:"role_id" doc:"Null when every role is reviewed"`
+	Role         string                      `json:"role" doc:"The role's name"`
+	DueAt        time.Time                   `json:"due_at"`
+	Status       string                      `json:"status" enum:"open,completed,expired"`
+	CreatedByID  *uuid.UUID                  `json:"created_by_id" doc:"Null when opened by the scheduler"`
+	CompletedAt  *time.Time                  `json:"completed_at"`
+	Counts       services.AccessReviewCounts `json:"counts"`
+	CreatedAt    time.Time                   `json:"created_at"`
+	UpdatedAt    time.Time                   `json:"updated_at"`
+}
+
+// accessReviewCampaignResponse formats a campaign and its decision counts for API responses
+func accessReviewCampaignResponse(campaign *database.AccessReviewCampaign, counts services.AccessReviewCounts) accessReviewCampaignBody {
+	var roleName string
+	if campaign.Role != nil {
+		roleName = campaign.Role.Name
+	}
+	return accessReviewCampaignBody{
+		ID:           campaign.ID,
+		Name:         campaign.Name,
+		ReviewerType: campaign.ReviewerType,
+		RoleID:       campaign.RoleID,
+		Role:         roleName,
+		DueAt:        campaign.DueAt,
+		Status:       campaign.Status,
+		CreatedByID:  campaign.CreatedByID,
+		CompletedAt:  campaign.CompletedAt,
+		Counts:       counts,
+		CreatedAt:    campaign.CreatedAt,
+		UpdatedAt:    campaign.UpdatedAt,
+	}
+}
+
+// accessReviewItemBody is the API representation of an assignment under review
+type accessReviewItemBody struct {
+	ID          uuid.UUID  `json:"id"`
+	CampaignID  uuid.UUID  `json:"campaign_id"`
+	UserID      uuid.UUID  `json:"user_id"`
+	Username    string     `json:"username"`
+	RoleID      uuid.UUID  `json:"role_id"`
+	Role        string     `json:"role" doc:"The role's name"`
+	ReviewerID  *uuid.UUID `json:"reviewer_id" doc:"The user's manager or the role's owner; null when there is neither, which leaves it to admins"`
+	Reviewer    string     `json:"reviewer" doc:"The reviewer's username"`
+	Decision    string     `json:"decision" enum:"pending,approved,revoked"`
+	DecidedAt   *time.Time `json:"decided_at"`
+	DecidedByID *uuid.UUID `json:"decided_by_id"`
+	Note        string     `json:"note"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// accessReviewItemResponse formats an assignment under review for API responses
+func accessReviewItemResponse(item *database.AccessReviewItem) accessReviewItemBody {
+	var reviewer string
+	if item.Reviewer != nil {
+		reviewer = item.Reviewer.Username
+	}
+	return accessReviewItemBody{
+		ID:          item.ID,
+		CampaignID:  item.CampaignID,
+		UserID:      item.UserID,
+		Username:    item.User.Username,
+		RoleID:      item.RoleID,
+		Role:        item.Role.Name,
+		ReviewerID:  item.ReviewerID,
+		Reviewer:    reviewer,
+		Decision:    item.Decision,
+		DecidedAt:   item.DecidedAt,
+		DecidedByID: item.DecidedByID,
+		Note:        item.Note,
+		CreatedAt:   item.CreatedAt,
+		UpdatedAt:   item.UpdatedAt,
+	}
+}
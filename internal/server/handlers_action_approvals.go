@@ -0,0 +1,239 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Action approval handlers
+
+// handleListActionApprovals handles GET /action-approvals
+func handleListActionApprovals(actionService *services.ActionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := services.ActionApprovalFilter{
+			Status: c.Query("status"),
+			Limit:  50,
+		}
+
+		var err error
+		if filter.ActionID, err = parseOptionalUUID(c.Query("action_id")); err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid action_id")
+			return
+		}
+		if filter.UserID, err = parseOptionalUUID(c.Query("user_id")); err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid user_id")
+			return
+		}
+		if limitStr := c.Query("limit"); limitStr != "" {
+			if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+				filter.Limit = l
+			}
+		}
+		if offsetStr := c.Query("offset"); offsetStr != "" {
+			if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+				filter.Offset = o
+			}
+		}
+
+		approvals, total, err := actionService.ListApprovals(filter, time.Now())
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		approvalList := make([]actionApprovalBody, len(approvals))
+		for i := range approvals {
+			approvalList[i] = actionApprovalResponse(&approvals[i])
+		}
+
+		listResponse(c, approvalList, total)
+	}
+}
+
+// handleGetActionApproval handles GET /action-approvals/:id
+func handleGetActionApproval(actionService *services.ActionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		approvalID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid action approval ID")
+			return
+		}
+
+		approval, err := actionService.GetApprovalByID(approvalID, time.Now())
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, actionApprovalResponse(approval))
+	}
+}
+
+// decideActionApprovalRequest is the body of POST
+// /auth/action-approvals/:id/approve and /reject
+type decideActionApprovalRequest struct {
+	Note  string `json:"note" doc:"Reason for a rejection"`
+	Nonce string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleDecideActionApproval handles POST /auth/action-approvals/:id/approve
+// and /reject. The co-signer authenticates with their own device OTP and must
+// hold the action's co-sign permission; approving runs the held action as its
+// performer.
+func handleDecideActionApproval(authService *services.AuthService, actionService *services.ActionService, actionExecutionService *services.ActionExecutionService, approve bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		approvalID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid action approval ID")
+			return
+		}
+
+		// Co-signers confirm with a device, never a session
+		authHeader := c.GetHeader("Authorization")
+		if !strings.HasPrefix(authHeader, "yubikey:") || len(authHeader) == len("yubikey:") {
+			errorResponse(c, http.StatusUnauthorized, "Invalid authorization format. Expected: yubikey:<device_code>")
+			return
+		}
+		approver, approverDevice, err := authService.AuthenticateDeviceContext(c.Request.Context(), "yubikey", strings.TrimPrefix(authHeader, "yubikey:"), "")
+		if err != nil {
+			serviceErrorResponse(c, http.StatusUnauthorized, err)
+			return
+		}
+
+		var req decideActionApprovalRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				bindErrorResponse(c, err)
+				return
+			}
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		now := time.Now()
+		approval, err := actionService.GetApprovalByID(approvalID, now)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+		coSign, err := services.ParseActionCoSign(&approval.Action)
+		if err != nil {
+			errorResponse(c, http.StatusInternalServerError, "Action '"+approval.Action.Name+"' is misconfigured: "+err.Error())
+			return
+		}
+		if coSign == nil {
+			errorResponse(c, http.StatusConflict, "Action '"+approval.Action.Name+"' no longer requires a co-signer; perform it again")
+			return
+		}
+		if !authService.UserHasPermission(approver, coSign.Permission) {
+			errorResponse(c, http.StatusForbidden, "Permission denied: "+coSign.Permission)
+			return
+		}
+
+		// The held action must still be one its performer may run
+		if approve {
+			if !approval.Action.Active {
+				errorResponse(c, http.StatusForbidden, "Action '"+approval.Action.Name+"' is inactive and cannot be executed")
+				return
+			}
+			hasPermission, err := actionService.CheckUserPermissionsForAction(approval.UserID, approval.Action.Name)
+			if err != nil {
+				errorResponse(c, http.StatusInternalServerError, "Error checking permissions: "+err.Error())
+				return
+			}
+			if !hasPermission || !approval.User.Active {
+				errorResponse(c, http.StatusForbidden, "User no longer has the required permissions for action '"+approval.Action.Name+"'")
+				return
+			}
+		}
+
+		approval, err = actionService.DecideApproval(approvalID, approver, approverDevice.ID, approve, req.Note, now)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusBadRequest, err)
+			return
+		}
+		if !approve {
+			itemResponse(c, actionApprovalResponse(approval))
+			return
+		}
+
+		requestBody, details := services.ApprovalRequest(approval)
+		details["approval"] = actionCoSignBody{
+			ID:               approval.ID,
+			ApproverID:       approver.ID,
+			ApproverUsername: approver.Username,
+			ApproverDeviceID: approverDevice.ID,
+			RequestedAt:      approval.CreatedAt,
+		}
+		runAction(c, actionExecutionService, services.ActionExecution{
+			User:        &approval.User,
+			DeviceID:    approval.DeviceID,
+			Action:      &approval.Action,
+			RequestBody: requestBody,
+			Details:     details,
+			IPAddress:   approval.IPAddress,
+			UserAgent:   approval.UserAgent,
+			RequestID:   approval.RequestID,
+		})
+	}
+}
+
+// actionCoSignBody records the co-signer of an action, in its log and response
+type actionCoSignBody struct {
+	ID               uuid.UUID `json:"id" doc:"The approval"`
+	ApproverID       uuid.UUID `json:"approver_id"`
+	ApproverUsername string    `json:"approver_username"`
+	ApproverDeviceID uuid.UUID `json:"approver_device_id"`
+	RequestedAt      time.Time `json:"requested_at"`
+}
+
+// actionApprovalBody is the API representation of an action approval
+type actionApprovalBody struct {
+	ID               uuid.UUID  `json:"id"`
+	ActionID         uuid.UUID  `json:"action_id"`
+	ActionName       string     `json:"action_name"`
+	UserID           uuid.UUID  `json:"user_id"`
+	Username         string     `json:"username"`
+	DeviceID         uuid.UUID  `json:"device_id"`
+	Status           string     `json:"status" enum:"pending,approved,rejected,expired"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	ApproverID       *uuid.UUID `json:"approver_id"`
+	ApproverUsername string     `json:"approver_username,omitempty"`
+	ApproverDeviceID *uuid.UUID `json:"approver_device_id"`
+	DecidedAt        *time.Time `json:"decided_at"`
+	Note             string     `json:"note"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// actionApprovalResponse formats an action approval for API responses
+func actionApprovalResponse(approval *database.ActionApproval) actionApprovalBody {
+	response := actionApprovalBody{
+		ID:               approval.ID,
+		ActionID:         approval.ActionID,
+		ActionName:       approval.Action.Name,
+		UserID:           approval.UserID,
+		Username:         approval.User.Username,
+		DeviceID:         approval.DeviceID,
+		Status:           approval.Status,
+		ExpiresAt:        approval.ExpiresAt,
+		ApproverID:       approval.ApproverID,
+		ApproverDeviceID: approval.ApproverDeviceID,
+		DecidedAt:        approval.DecidedAt,
+		Note:             approval.Note,
+		CreatedAt:        approval.CreatedAt,
+		UpdatedAt:        approval.UpdatedAt,
+	}
+	if approval.Approver != nil {
+		response.ApproverUsername = approval.Approver.Username
+	}
+	return response
+}
@@ -0,0 +1,252 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+)
+
+// Action scheduler handlers
+
+// scheduledActionBody is an action with a schedule and when it next runs
+type scheduledActionBody struct {
+	ActionID   uuid.UUID              `json:"action_id"`
+	ActionName string                 `json:"action_name"`
+	Cron       string                 `json:"cron"`
+	Timezone   string                 `json:"timezone"`
+	Task       string                 `json:"task" doc:"The system task run, if any"`
+	Config     map[string]interface{} `json:"config"`
+	NextRun    *time.Time             `json:"next_run"`
+	LastRun    *actionRunBody         `json:"last_run"`
+}
+
+// handleListScheduledActions handles GET /actions/scheduled
+func handleListScheduledActions(schedulerService *services.ActionSchedulerService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scheduled, err := schedulerService.ScheduledActions(time.Now())
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		scheduledList := make([]scheduledActionBody, len(scheduled))
+		for i, s := range scheduled {
+			item := scheduledActionBody{
+				ActionID:   s.Action.ID,
+				ActionName: s.Action.Name,
+				Cron:       s.Schedule.Cron,
+				Timezone:   s.Schedule.Timezone,
+				Task:       s.Schedule.Task,
+				Config:     s.Schedule.Config,
+			}
+			if !s.NextRun.IsZero() {
+				nextRun := s.NextRun
+				item.NextRun = &nextRun
+			}
+			if s.LastRun != nil {
+				lastRun := actionRunResponse(s.LastRun)
+				item.LastRun = &lastRun
+			}
+			scheduledList[i] = item
+		}
+
+		listResponse(c, scheduledList, int64(len(scheduledList)))
+	}
+}
+
+// handleListSystemTasks handles GET /actions/system-tasks
+func handleListSystemTasks(actionService *services.ActionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tasks := actionService.SystemTasks()
+		listResponse(c, tasks, int64(len(tasks)))
+	}
+}
+
+// handleListActionRuns handles GET /action-runs and GET /actions/:id/runs
+func handleListActionRuns(schedulerService *services.ActionSchedulerService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := services.ActionRunFilter{
+			Status:  c.Query("status"),
+			Trigger: c.Query("trigger"),
+			Limit:   50,
+		}
+
+		var err error
+		if id := c.Param("id"); id != "" {
+			actionID, err := uuid.Parse(id)
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Invalid action ID")
+				return
+			}
+			filter.ActionID = &actionID
+		} else if filter.ActionID, err = parseOptionalUUID(c.Query("action_id")); err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid action_id")
+			return
+		}
+		if limitStr := c.Query("limit"); limitStr != "" {
+			if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+				filter.Limit = l
+			}
+		}
+		if offsetStr := c.Query("offset"); offsetStr != "" {
+			if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+				filter.Offset = o
+			}
+		}
+
+		runs, total, err := schedulerService.ListRuns(filter)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		runList := make([]actionRunBody, len(runs))
+		for i := range runs {
+			runList[i] = actionRunResponse(&runs[i])
+		}
+
+		listResponse(c, runList, total)
+	}
+}
+
+// handleTriggerActionRun handles POST /actions/:id/run, running a scheduled
+// action immediately and responding once the run has finished
+func handleTriggerActionRun(schedulerService *services.ActionSchedulerService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actionID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid action ID")
+			return
+		}
+
+		run, err := schedulerService.TriggerRun(actionID, c.MustGet("user_id").(uuid.UUID), time.Now())
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		createdResponse(c, actionRunResponse(run))
+	}
+}
+
+// activityRollupBody is a user's activity on one day
+type activityRollupBody struct {
+	Day         string             `json:"day" format:"date"`
+	UserID      uuid.UUID          `json:"user_id"`
+	Username    string             `json:"username"`
+	Timezone    string             `json:"timezone" doc:"The user's timezone the day was rolled up in"`
+	TotalHours  float64            `json:"total_hours"`
+	Hours       map[string]float64 `json:"hours" doc:"Closed hours by summary category"`
+	StatusHours map[string]float64 `json:"status_hours" doc:"Closed hours by user status ID, \"\" for activities without one"`
+	LocationIDs []uuid.UUID        `json:"location_ids"`
+	SignIns     int                `json:"sign_ins"`
+	SignOuts    int                `json:"sign_outs"`
+	UpdatedAt   time.Time          `json:"updated_at"`
+}
+
+// handleListActivityRollups handles GET /user-activity/rollups
+func handleListActivityRollups(userActivityService *services.UserActivityService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fromDay, err := time.Parse("2006-01-02", c.Query("from"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "from is required in YYYY-MM-DD format")
+			return
+		}
+		toDay, err := time.Parse("2006-01-02", c.Query("to"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "to is required in YYYY-MM-DD format")
+			return
+		}
+		if toDay.Before(fromDay) {
+			errorResponse(c, http.StatusBadRequest, "to must not be before from")
+			return
+		}
+		userID, err := parseOptionalUUID(c.Query("user_id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid user_id")
+			return
+		}
+
+		rollups, err := userActivityService.ListActivityRollups(userID, fromDay, toDay)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		rollupList := make([]activityRollupBody, len(rollups))
+		for i, rollup := range rollups {
+			hours := map[string]float64{}
+			if rollup.Hours.Status == pgtype.Present {
+				_ = json.Unmarshal(rollup.Hours.Bytes, &hours)
+			}
+			statusHours := map[string]float64{}
+			if rollup.StatusHours.Status == pgtype.Present {
+				_ = json.Unmarshal(rollup.StatusHours.Bytes, &statusHours)
+			}
+			locationIDs := []uuid.UUID{}
+			if rollup.LocationIDs.Status == pgtype.Present {
+				_ = json.Unmarshal(rollup.LocationIDs.Bytes, &locationIDs)
+			}
+			rollupList[i] = activityRollupBody{
+				Day:         rollup.Day.Format("2006-01-02"),
+				UserID:      rollup.UserID,
+				Username:    rollup.User.Username,
+				Timezone:    rollup.Timezone,
+				TotalHours:  rollup.TotalHours,
+				Hours:       hours,
+				StatusHours: statusHours,
+				LocationIDs: locationIDs,
+				SignIns:     rollup.SignIns,
+				SignOuts:    rollup.SignOuts,
+				UpdatedAt:   rollup.UpdatedAt,
+			}
+		}
+
+		listResponse(c, rollupList, int64(len(rollupList)))
+	}
+}
+
+// actionRunBody is the API representation of an action run
+type actionRunBody struct {
+	ID            uuid.UUID                   `json:"id"`
+	ActionID      uuid.UUID                   `json:"action_id"`
+	ActionName    string                      `json:"action_name"`
+	Trigger       string                      `json:"trigger" enum:"schedule,manual"`
+	TriggeredByID *uuid.UUID                  `json:"triggered_by_id"`
+	ScheduledFor  *time.Time                  `json:"scheduled_for"`
+	Status        string                      `json:"status" enum:"running,succeeded,failed,skipped"`
+	StartedAt     time.Time                   `json:"started_at"`
+	FinishedAt    *time.Time                  `json:"finished_at"`
+	Result        string                      `json:"result"`
+	Error         string                      `json:"error"`
+	SideEffects   []services.SideEffectResult `json:"side_effects"`
+}
+
+// actionRunResponse formats an action run for API responses
+func actionRunResponse(run *database.ActionRun) actionRunBody {
+	sideEffects := []services.SideEffectResult{}
+	if run.SideEffects.Status == pgtype.Present {
+		_ = json.Unmarshal(run.SideEffects.Bytes, &sideEffects)
+	}
+	return actionRunBody{
+		ID:            run.ID,
+		ActionID:      run.ActionID,
+		ActionName:    run.Action.Name,
+		Trigger:       run.Trigger,
+		TriggeredByID: run.TriggeredByID,
+		ScheduledFor:  run.ScheduledFor,
+		Status:        run.Status,
+		StartedAt:     run.StartedAt,
+		FinishedAt:    run.FinishedAt,
+		Result:        run.Result,
+		Error:         run.Error,
+		SideEffects:   sideEffects,
+	}
+}
@@ -1,15 +1,42 @@
 package server
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/YubiApp/internal/database"
 	"github.com/YubiApp/internal/services"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
 )
 
-// handlePerformAction handles POST /auth/action/${action_name}
-func handlePerformAction(authService *services.AuthService, actionService *services.ActionService) gin.HandlerFunc {
+// performActionRequest is the body of POST /auth/action/:action_name. It is
+// read as a map, since actions define fields of their own and every field is
+// logged with the action; these are the fields read for every action.
+type performActionRequest struct {
+	Location   string     `json:"location" doc:"Name of the location the user claims to be at"`
+	LocationID *uuid.UUID `json:"location_id" doc:"The location the user claims to be at; takes precedence over location"`
+	Latitude   *float64   `json:"latitude" doc:"Reported position, checked against the location's geofence; sent with longitude"`
+	Longitude  *float64   `json:"longitude" doc:"Sent with latitude"`
+	StartTime  *time.Time `json:"start_time"`
+	EndTime    *time.Time `json:"end_time"`
+	OnBehalfOf *uuid.UUID `json:"on_behalf_of" doc:"A direct report of the authenticated user"`
+	LeaveDays  *float64   `json:"leave_days" doc:"Days a leave action with variable_days takes, instead of the days it declares; ignored by other actions"`
+}
+
+func (performActionRequest) schemaDescription() string {
+	return "Action-specific data (structure varies by action). start_time and end_time, when sent, must be RFC 3339 times; they are logged under client_times with the server time and clamped to within activity.clock_skew of it (see /time). A manager sets on_behalf_of to perform the action for a direct report: it is checked against and logged for the report, with the manager as proxied_by. Actions declaring \"leave\" in their details take days off the user's balance of that leave type (see /users/{id}/leave-balance)."
+}
+
+// handlePerformAction handles POST /auth/action/${action_name}. Actions need a
+// fresh device OTP unless they allow session auth, in which case a Bearer access
+// token is accepted as well.
+func handlePerformAction(authService *services.AuthService, sessionService *services.SessionService, actionService *services.ActionService, locationService *services.LocationService, actionExecutionService *services.ActionExecutionService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		actionName := c.Param("action_name")
 		if actionName == "" {
@@ -24,93 +51,479 @@ func handlePerformAction(authService *services.AuthService, actionService *servi
 			return
 		}
 
-		// Extract device code from Authorization header
-		// Expected format: "yubikey:cccccbvjbvdbijlrttlkfugllrrutgighrlnuibkbllj"
-		var deviceCode string
-		if len(authHeader) > 8 && authHeader[:8] == "yubikey:" {
-			deviceCode = authHeader[8:]
+		var user *database.User
+		var device *database.Device
+		if strings.HasPrefix(authHeader, "Bearer ") {
+			var ok bool
+			user, device, ok = authenticateActionSession(c, authService, sessionService, actionService, actionName, strings.TrimPrefix(authHeader, "Bearer "))
+			if !ok {
+				return
+			}
 		} else {
-			errorResponse(c, http.StatusUnauthorized, "Invalid authorization format. Expected: yubikey:<device_code>")
+			// Extract device code from Authorization header
+			// Expected format: "yubikey:cccccbvjbvdbijlrttlkfugllrrutgighrlnuibkbllj"
+			var deviceCode string
+			if len(authHeader) > 8 && authHeader[:8] == "yubikey:" {
+				deviceCode = authHeader[8:]
+			} else {
+				errorResponse(c, http.StatusUnauthorized, "Invalid authorization format. Expected: yubikey:<device_code> or Bearer <access_token>")
+				return
+			}
+
+			// Authenticate the user using the device code
+			var err error
+			user, device, err = authService.AuthenticateDeviceContext(services.WithActionName(c.Request.Context(), actionName), "yubikey", deviceCode, "")
+			if err != nil {
+				serviceErrorResponse(c, http.StatusUnauthorized, fmt.Errorf("Authentication failed: %w", err))
+				return
+			}
+		}
+
+		// Get the request body as JSON for json_detail
+		var requestBody map[string]interface{}
+		if err := c.ShouldBindJSON(&requestBody); err != nil {
+			bindErrorResponse(c, err)
 			return
 		}
 
-		// Authenticate the user using the device code
-		user, device, err := authService.AuthenticateDevice("yubikey", deviceCode, "")
+		performAction(c, authService, actionService, locationService, actionExecutionService, user, device, actionName, requestBody, nil)
+	}
+}
+
+// authenticateActionSession authenticates a Bearer access token for an action. The
+// action must allow session auth, the session must not be read-only, and the user
+// must hold the action's session permission if it sets one. It writes the error
+// response itself on failure.
+func authenticateActionSession(c *gin.Context, authService *services.AuthService, sessionService *services.SessionService, actionService *services.ActionService, actionName, tokenString string) (*database.User, *database.Device, bool) {
+	action, err := actionService.GetActionByName(actionName)
+	if err != nil {
+		errorResponse(c, http.StatusNotFound, "Action '"+actionName+"' not found")
+		return nil, nil, false
+	}
+	if !action.AllowSessionAuth {
+		errorResponse(c, http.StatusForbidden, "Action '"+actionName+"' requires device authentication")
+		return nil, nil, false
+	}
+
+	session, _, user, ok := authenticateSession(c, authService, sessionService, tokenString)
+	if !ok {
+		return nil, nil, false
+	}
+
+	if session.Recovery {
+		errorResponse(c, http.StatusForbidden, "Recovery sessions cannot perform actions")
+		return nil, nil, false
+	}
+	if session.ReadOnly {
+		errorResponse(c, http.StatusForbidden, "Session is read-only")
+		return nil, nil, false
+	}
+	if action.SessionPermission != "" && !authService.UserHasPermission(user, action.SessionPermission) {
+		errorResponse(c, http.StatusForbidden, fmt.Sprintf("Permission denied: %s", action.SessionPermission))
+		return nil, nil, false
+	}
+
+	// The action is logged against the device the session was opened with
+	var device database.Device
+	if err := authService.GetDB().Where("id = ?", session.DeviceID).First(&device).Error; err != nil {
+		errorResponse(c, http.StatusUnauthorized, "Session device not found")
+		return nil, nil, false
+	}
+	if !device.Active {
+		errorResponse(c, http.StatusUnauthorized, "Session device is inactive")
+		return nil, nil, false
+	}
+
+	c.Set("auth_method", "session")
+	if session.ImpersonatorID != nil {
+		c.Set("impersonator_id", *session.ImpersonatorID)
+	}
+	return user, &device, true
+}
+
+// performAction runs an authenticated user's action: permission, constraint and
+// location checks, door unlock, pipeline and side effects, then the action log.
+// A kiosk, when given, fixes the location to the kiosk's own.
+func performAction(c *gin.Context, authService *services.AuthService, actionService *services.ActionService, locationService *services.LocationService, actionExecutionService *services.ActionExecutionService, user *database.User, device *database.Device, actionName string, requestBody map[string]interface{}, kiosk *database.Kiosk) {
+	// Check if the action exists
+	action, err := actionService.GetActionByName(actionName)
+	if err != nil {
+		errorResponse(c, http.StatusNotFound, "Action '"+actionName+"' not found")
+		return
+	}
+
+	// Check if the action is active
+	if !action.Active {
+		errorResponse(c, http.StatusForbidden, "Action '"+actionName+"' is inactive and cannot be executed")
+		return
+	}
+
+	// A manager may act on behalf of a direct report: the action is the
+	// report's, checked against their permissions, with the manager recorded
+	var proxiedBy *database.User
+	if onBehalfOf, ok := requestBody["on_behalf_of"].(string); ok && onBehalfOf != "" {
+		reportID, err := uuid.Parse(onBehalfOf)
 		if err != nil {
-			errorResponse(c, http.StatusUnauthorized, "Authentication failed: "+err.Error())
+			errorResponse(c, http.StatusBadRequest, "Invalid on_behalf_of")
 			return
 		}
-
-		// Check if the action exists
-		action, err := actionService.GetActionByName(actionName)
+		report, err := authService.DirectReport(user.ID, reportID)
 		if err != nil {
-			errorResponse(c, http.StatusNotFound, "Action '"+actionName+"' not found")
+			serviceErrorResponse(c, http.StatusForbidden, err)
 			return
 		}
+		if !report.Active || !services.UserStateAllowsAuthentication(report.State) {
+			errorResponse(c, http.StatusForbidden, "User "+report.Username+" is not active")
+			return
+		}
+		proxiedBy, user = user, report
+	}
+
+	// Check if user has required permissions for the action
+	hasPermission, err := actionService.CheckUserPermissionsForAction(user.ID, actionName)
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, "Error checking permissions: "+err.Error())
+		return
+	}
+
+	if !hasPermission {
+		errorResponse(c, http.StatusForbidden, "User does not have required permissions for action '"+actionName+"'")
+		return
+	}
 
-		// Check if the action is active
-		if !action.Active {
-			errorResponse(c, http.StatusForbidden, "Action '"+actionName+"' is inactive and cannot be executed")
+	// The resources the action needs may only be usable from some networks
+	requiredPermissions, err := services.ActionRequiredPermissions(action)
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, "Error checking permissions: "+err.Error())
+		return
+	}
+	if err := authService.CheckResourceNetwork(c.Request.Context(), user, requiredPermissions...); err != nil {
+		serviceErrorResponse(c, http.StatusForbidden, err)
+		return
+	}
+
+	// Enforce schedule, frequency and ordering constraints declared on the action
+	if err := actionService.CheckActionConstraints(user.ID, action, time.Now()); err != nil {
+		var constraintErr *services.ActionConstraintError
+		if errors.As(err, &constraintErr) {
+			errorResponse(c, http.StatusForbidden, "Action '"+actionName+"' not allowed: "+constraintErr.Message)
 			return
 		}
+		errorResponse(c, http.StatusInternalServerError, "Error checking action constraints: "+err.Error())
+		return
+	}
 
-		// Check if user has required permissions for the action
-		hasPermission, err := actionService.CheckUserPermissionsForAction(user.ID, actionName)
+	// Resolve the claimed location and client coordinates, if any
+	var location *database.Location
+	if kiosk != nil {
+		location = &kiosk.Location
+	} else if locationID, ok := requestBody["location_id"].(string); ok && locationID != "" {
+		id, err := uuid.Parse(locationID)
 		if err != nil {
-			errorResponse(c, http.StatusInternalServerError, "Error checking permissions: "+err.Error())
+			errorResponse(c, http.StatusBadRequest, "Invalid location_id")
 			return
 		}
-
-		if !hasPermission {
-			errorResponse(c, http.StatusForbidden, "User does not have required permissions for action '"+actionName+"'")
+		if location, err = locationService.GetLocationByID(id); err != nil {
+			errorResponse(c, http.StatusBadRequest, "Location not found")
+			return
+		}
+	} else if locationName, ok := requestBody["location"].(string); ok && locationName != "" {
+		if location, err = locationService.GetLocationByName(locationName); err != nil {
+			errorResponse(c, http.StatusBadRequest, "Location '"+locationName+"' not found")
 			return
 		}
+	}
 
-		// Get the request body as JSON for json_detail
-		var requestBody map[string]interface{}
-		if err := c.ShouldBindJSON(&requestBody); err != nil {
-			errorResponse(c, http.StatusBadRequest, "Invalid JSON in request body: "+err.Error())
+	// Without an explicit location, place the user by client IP; when they claim an
+	// office, flag it if the IP is outside every office network range
+	clientIP := c.ClientIP()
+	locationResolution := locationResolutionBody{IP: clientIP}
+	if kiosk != nil {
+		locationResolution.Source = "kiosk"
+		locationResolution.LocationID = location.ID
+		locationResolution.KioskID = &kiosk.ID
+	} else if location == nil {
+		if location, err = locationService.ResolveLocationByIP(clientIP); err != nil {
+			errorResponse(c, http.StatusInternalServerError, "Error resolving location: "+err.Error())
 			return
 		}
+		if location != nil {
+			locationResolution.Source = "ip"
+			locationResolution.LocationID = location.ID
+		}
+	} else {
+		locationResolution.Source = "claimed"
+		locationResolution.LocationID = location.ID
+		if location.Type == "office" {
+			inOffice, configured, err := locationService.IsOfficeIP(clientIP)
+			if err != nil {
+				errorResponse(c, http.StatusInternalServerError, "Error checking office networks: "+err.Error())
+				return
+			}
+			if configured && !inOffice {
+				locationResolution.Mismatch = true
+			}
+		}
+	}
 
-		// Get device ID from the authentication
-		deviceID := device.ID
+	var coords *services.Coordinates
+	latitude, hasLatitude := requestBody["latitude"].(float64)
+	longitude, hasLongitude := requestBody["longitude"].(float64)
+	if hasLatitude && hasLongitude {
+		coords = &services.Coordinates{Latitude: latitude, Longitude: longitude}
+	} else if hasLatitude || hasLongitude {
+		errorResponse(c, http.StatusBadRequest, "latitude and longitude must be provided together")
+		return
+	}
 
-		// Log the action in AuthenticationLog
-		details := map[string]interface{}{
-			"action": actionName,
-		}
-		// Merge request body into details
-		for key, value := range requestBody {
-			details[key] = value
+	// Verify the reported position against the location's geofence
+	var geofence *services.GeofenceResult
+	enforceGeofence := services.ActionEnforcesGeofence(action)
+	if enforceGeofence && location == nil {
+		errorResponse(c, http.StatusBadRequest, "Action '"+actionName+"' requires a location")
+		return
+	}
+	if location != nil {
+		// A kiosk is fixed at its location, so it is not asked for a position
+		if enforceGeofence && coords == nil && services.HasGeofence(location) && kiosk == nil {
+			errorResponse(c, http.StatusBadRequest, "Action '"+actionName+"' requires latitude and longitude")
+			return
 		}
-		
-		logEntry := map[string]interface{}{
-			"user_id":     user.ID,
-			"device_id":   deviceID,
-			"action_id":   action.ID,
-			"type":        "action",
-			"success":     true,
-			"ip_address":  c.ClientIP(),
-			"user_agent":  c.GetHeader("User-Agent"),
-			"details":     details,
+		result := services.VerifyGeofence(location, coords)
+		geofence = &result
+		if enforceGeofence && result.Checked && !result.Within {
+			errorResponse(c, http.StatusForbidden, fmt.Sprintf("Reported position is %.0fm from location '%s', outside its %.0fm geofence", result.DistanceMeters, location.Name, result.RadiusMeters))
+			return
 		}
+	}
 
-		// Create authentication log entry
-		if err := authService.LogAuthentication(logEntry); err != nil {
-			// Log the error but don't fail the request
-			// In a production system, you might want to handle this differently
-			c.Error(err)
+	// A full location refuses, or warns, users who are not already there
+	var capacity *services.CapacityCheck
+	if location != nil {
+		if capacity, err = locationService.CheckCapacity(location, user.ID); err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+		if capacity != nil && capacity.Blocked {
+			errorResponse(c, http.StatusConflict, capacity.Message)
+			return
 		}
+	}
+
+	// Leave actions take days off the user's balance, which refuses or warns
+	// about leave it does not cover
+	leave, err := actionExecutionService.CheckLeave(user, action, requestBody)
+	if err != nil {
+		serviceErrorResponse(c, http.StatusInternalServerError, err)
+		return
+	}
+	if leave != nil && leave.Blocked {
+		errorResponse(c, http.StatusConflict, leave.Message)
+		return
+	}
+
+	// Clients report start and end times by their own clock; both the reported
+	// and server times are kept, with the times clamped to the skew window
+	clientTimes, err := actionExecutionService.ClientTimes(requestBody)
+	if err != nil {
+		serviceErrorResponse(c, http.StatusBadRequest, err)
+		return
+	}
+
+	// Log details worked out for the request; runAction adds the results of
+	// the door, pipeline and side effects
+	details := map[string]interface{}{
+		"action": actionName,
+	}
+	// Merge request body into details
+	for key, value := range requestBody {
+		details[key] = value
+	}
+	if geofence != nil {
+		details["geofence"] = geofence
+	}
+	if len(clientTimes) > 0 {
+		details["client_times"] = clientTimes
+	}
+	if location != nil {
+		details["location_resolution"] = locationResolution
+	}
+	if capacity != nil {
+		details["capacity"] = capacity
+	}
+	if leave != nil {
+		details["leave"] = leave
+	}
+	if kiosk != nil {
+		details["kiosk"] = map[string]interface{}{"id": kiosk.ID, "name": kiosk.Name}
+	}
+	if authMethod, ok := c.Get("auth_method"); ok {
+		details["auth_method"] = authMethod
+	}
+	// Record the admin behind an impersonation session
+	if impersonatorID, ok := c.Get("impersonator_id"); ok {
+		details["impersonator_id"] = impersonatorID
+	}
+	if proxiedBy != nil {
+		details["proxied_by"] = proxiedBy.ID
+	}
 
-		// Return success response
-		successResponse(c, gin.H{
-			"action": actionName,
-			"user_id": user.ID,
-			"success": true,
-			"message": "Action performed successfully",
+	// Co-signed actions wait for a second user's approval before they run
+	coSign, err := services.ParseActionCoSign(action)
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, "Action '"+actionName+"' is misconfigured: "+err.Error())
+		return
+	}
+	if coSign != nil {
+		approval, err := actionService.RequestApproval(action, coSign, user, device.ID, requestBody, details, clientIP, c.GetHeader("User-Agent"), c.GetString("request_id"), time.Now())
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+		responseWithNonce(c, http.StatusAccepted, actionPendingBody{
+			Action:   actionName,
+			UserID:   user.ID,
+			Success:  false,
+			Message:  "Action '" + actionName + "' is waiting for a co-signer with permission " + coSign.Permission,
+			Approval: actionApprovalResponse(approval),
 		})
+		return
 	}
+
+	runAction(c, actionExecutionService, services.ActionExecution{
+		User:        user,
+		DeviceID:    device.ID,
+		Action:      action,
+		RequestBody: requestBody,
+		Details:     details,
+		IPAddress:   clientIP,
+		UserAgent:   c.GetHeader("User-Agent"),
+		RequestID:   c.GetString("request_id"),
+	})
+}
+
+// locationResolutionBody records how an action's location was worked out
+type locationResolutionBody struct {
+	IP         string     `json:"ip"`
+	Source     string     `json:"source" enum:"kiosk,ip,claimed"`
+	LocationID uuid.UUID  `json:"location_id"`
+	KioskID    *uuid.UUID `json:"kiosk_id,omitempty"`
+	Mismatch   bool       `json:"mismatch,omitempty" doc:"The claimed office is not on any office network range"`
+}
+
+// actionResultBody is the outcome of a performed action
+type actionResultBody struct {
+	Action             string                      `json:"action"`
+	UserID             uuid.UUID                   `json:"user_id"`
+	Success            bool                        `json:"success"`
+	Message            string                      `json:"message"`
+	Geofence           *services.GeofenceResult    `json:"geofence,omitempty"`
+	LocationResolution *locationResolutionBody     `json:"location_resolution,omitempty"`
+	Capacity           *services.CapacityCheck     `json:"capacity,omitempty" doc:"Set when the location is full and its capacity_mode is warn"`
+	Leave              *services.LeaveCheck        `json:"leave,omitempty" doc:"Set for leave actions"`
+	Approval           *actionCoSignBody           `json:"approval,omitempty" doc:"Set for co-signed actions"`
+	ProxiedBy          *uuid.UUID                  `json:"proxied_by,omitempty" doc:"The manager who performed the action on behalf of user_id"`
+	SideEffects        []services.SideEffectResult `json:"side_effects,omitempty"`
+	Door               *services.DoorUnlock        `json:"door,omitempty" doc:"Set for door actions"`
+	Pipeline           *services.PipelineResult    `json:"pipeline,omitempty"`
+}
+
+// actionPendingBody is a co-signed action waiting for its co-signer
+type actionPendingBody struct {
+	Action   string             `json:"action"`
+	UserID   uuid.UUID          `json:"user_id"`
+	Success  bool               `json:"success" doc:"Always false"`
+	Message  string             `json:"message"`
+	Approval actionApprovalBody `json:"approval"`
+}
+
+// runAction runs a checked action and writes the response
+func runAction(c *gin.Context, actionExecutionService *services.ActionExecutionService, run services.ActionExecution) {
+	result, err := actionExecutionService.Execute(run)
+	if err != nil {
+		serviceErrorResponse(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Return success response
+	response := actionResultBody{
+		Action:      run.Action.Name,
+		UserID:      run.User.ID,
+		Success:     true,
+		Message:     "Action performed successfully",
+		SideEffects: result.SideEffects,
+		Door:        result.Door,
+	}
+	// Details of a co-signed action were stored while it waited, and come
+	// back decoded as JSON
+	for key, target := range map[string]interface{}{
+		"geofence":            &response.Geofence,
+		"location_resolution": &response.LocationResolution,
+		"capacity":            &response.Capacity,
+		"leave":               &response.Leave,
+		"approval":            &response.Approval,
+		"proxied_by":          &response.ProxiedBy,
+	} {
+		if value, ok := run.Details[key]; ok {
+			if encoded, err := json.Marshal(value); err == nil {
+				_ = json.Unmarshal(encoded, target)
+			}
+		}
+	}
+	if pipeline := result.Pipeline; pipeline != nil {
+		response.Pipeline = pipeline
+		if pipeline.Status != services.PipelineCompleted {
+			response.Success = false
+			response.Message = "Action performed but its pipeline did not complete (" + pipeline.Status + ")"
+		}
+	}
+	successResponse(c, response)
+}
+
+// actionBody is the API representation of an action
+type actionBody struct {
+	ID                  uuid.UUID              `json:"id"`
+	Name                string                 `json:"name"`
+	ActivityType        string                 `json:"activity_type" enum:"user,system,automated,door,other" doc:"Type of activity this action represents"`
+	RequiredPermissions []string               `json:"required_permissions" doc:"Permission strings in format \"resource:action\""`
+	Details             map[string]interface{} `json:"details" doc:"Additional details about the action"`
+	Active              bool                   `json:"active" doc:"Whether the action is active and can be executed"`
+	Version             int                    `json:"version" doc:"Incremented by every update; send it back with updates to reject them if someone else changed the record"`
+	AllowSessionAuth    bool                   `json:"allow_session_auth" doc:"Whether a session access token may perform the action instead of a device OTP"`
+	SessionPermission   string                 `json:"session_permission" doc:"Extra permission required when performed with a session access token"`
+	CreatedAt           time.Time              `json:"created_at"`
+	UpdatedAt           time.Time              `json:"updated_at"`
+}
+
+// actionResponse formats an action for API responses
+func actionResponse(action *database.Action) actionBody {
+	var requiredPermissions []string
+	if action.RequiredPermissions.Status == pgtype.Present {
+		action.RequiredPermissions.AssignTo(&requiredPermissions)
+	}
+	var details map[string]interface{}
+	if action.Details.Status == pgtype.Present {
+		action.Details.AssignTo(&details)
+	}
+
+	return actionBody{
+		ID:                  action.ID,
+		Name:                action.Name,
+		ActivityType:        action.ActivityType,
+		RequiredPermissions: requiredPermissions,
+		Details:             details,
+		Active:              action.Active,
+		Version:             action.Version,
+		AllowSessionAuth:    action.AllowSessionAuth,
+		SessionPermission:   action.SessionPermission,
+		CreatedAt:           action.CreatedAt,
+		UpdatedAt:           action.UpdatedAt,
+	}
+}
+
+// actionListBody is the body of GET /actions
+type actionListBody struct {
+	Actions []actionBody `json:"actions"`
 }
 
 // handleListActions handles GET /actions
@@ -130,28 +543,17 @@ func handleListActions(actionService *services.ActionService) gin.HandlerFunc {
 
 		actions, err := actionService.ListActionsWithFilter(activeOnly)
 		if err != nil {
-			errorResponse(c, http.StatusInternalServerError, "Failed to list actions: "+err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, fmt.Errorf("Failed to list actions: %w", err))
 			return
 		}
 
 		// Convert to response format
-		actionList := make([]gin.H, len(actions))
-		for i, action := range actions {
-			actionList[i] = gin.H{
-				"id":                   action.ID,
-				"name":                 action.Name,
-				"activity_type":        action.ActivityType,
-				"required_permissions": action.RequiredPermissions,
-				"details":              action.Details,
-				"active":               action.Active,
-				"created_at":           action.CreatedAt,
-				"updated_at":           action.UpdatedAt,
-			}
+		actionList := make([]actionBody, len(actions))
+		for i := range actions {
+			actionList[i] = actionResponse(&actions[i])
 		}
 
-		successResponse(c, gin.H{
-			"actions": actionList,
-		})
+		successResponse(c, actionListBody{Actions: actionList})
 	}
 }
 
@@ -167,58 +569,57 @@ func handleGetAction(actionService *services.ActionService) gin.HandlerFunc {
 
 		action, err := actionService.GetActionByID(id)
 		if err != nil {
-			errorResponse(c, http.StatusNotFound, "Action not found: "+err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		successResponse(c, gin.H{
-			"id":                   action.ID,
-			"name":                 action.Name,
-			"activity_type":        action.ActivityType,
-			"required_permissions": action.RequiredPermissions,
-			"details":              action.Details,
-			"active":               action.Active,
-			"created_at":           action.CreatedAt,
-			"updated_at":           action.UpdatedAt,
-		})
+		successResponse(c, actionResponse(action))
 	}
 }
 
+// createActionRequest is the body of POST /actions
+type createActionRequest struct {
+	Name                string                 `json:"name" binding:"required"`
+	ActivityType        string                 `json:"activity_type" binding:"required" enum:"user,system,automated,door,other" doc:"Type of activity this action represents"`
+	RequiredPermissions []string               `json:"required_permissions" doc:"Array of permission strings in format \"resource:action\""`
+	Details             map[string]interface{} `json:"details" doc:"JSON object containing additional details about the action"`
+	Active              bool                   `json:"active" doc:"Whether the action is active and can be executed"`
+	AllowSessionAuth    bool                   `json:"allow_session_auth" doc:"Whether a session access token may perform the action instead of a device OTP"`
+	SessionPermission   string                 `json:"session_permission" doc:"Extra permission required when performed with a session access token"`
+}
+
 // handleCreateAction handles POST /actions
 func handleCreateAction(actionService *services.ActionService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var req struct {
-			Name                string                 `json:"name" binding:"required"`
-			ActivityType        string                 `json:"activity_type" binding:"required"`
-			RequiredPermissions []string               `json:"required_permissions"`
-			Details             map[string]interface{} `json:"details"`
-			Active              bool                   `json:"active"`
-		}
+		var req createActionRequest
 
 		if err := c.ShouldBindJSON(&req); err != nil {
-			errorResponse(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			bindErrorResponse(c, err)
 			return
 		}
 
-		action, err := actionService.CreateAction(req.Name, req.ActivityType, req.RequiredPermissions, req.Details, req.Active)
+		action, err := actionService.CreateAction(req.Name, req.ActivityType, req.RequiredPermissions, req.Details, req.Active, req.AllowSessionAuth, req.SessionPermission)
 		if err != nil {
-			errorResponse(c, http.StatusInternalServerError, "Failed to create action: "+err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, fmt.Errorf("Failed to create action: %w", err))
 			return
 		}
 
-		successResponse(c, gin.H{
-			"id":                   action.ID,
-			"name":                 action.Name,
-			"activity_type":        action.ActivityType,
-			"required_permissions": action.RequiredPermissions,
-			"details":              action.Details,
-			"active":               action.Active,
-			"created_at":           action.CreatedAt,
-			"updated_at":           action.UpdatedAt,
-		})
+		successResponse(c, actionResponse(action))
 	}
 }
 
+// updateActionRequest is the body of PUT /actions/:id
+type updateActionRequest struct {
+	Name                string                 `json:"name" binding:"required"`
+	ActivityType        string                 `json:"activity_type" enum:"user,system,automated,door,other" doc:"Type of activity this action represents"`
+	RequiredPermissions []string               `json:"required_permissions" doc:"Array of permission strings in format \"resource:action\""`
+	Details             map[string]interface{} `json:"details" doc:"JSON object containing additional details about the action"`
+	Active              *bool                  `json:"active" doc:"Whether the action is active and can be executed"`
+	AllowSessionAuth    *bool                  `json:"allow_session_auth" doc:"Whether a session access token may perform the action instead of a device OTP"`
+	SessionPermission   *string                `json:"session_permission" doc:"Extra permission required when performed with a session access token"`
+	Version             *int                   `json:"version" doc:"Optional: the version the update is based on; a different current version is rejected with 409"`
+}
+
 // handleUpdateAction handles PUT /actions/:id
 func handleUpdateAction(actionService *services.ActionService) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -229,35 +630,20 @@ func handleUpdateAction(actionService *services.ActionService) gin.HandlerFunc {
 			return
 		}
 
-		var req struct {
-			Name                string                 `json:"name" binding:"required"`
-			ActivityType        string                 `json:"activity_type"`
-			RequiredPermissions []string               `json:"required_permissions"`
-			Details             map[string]interface{} `json:"details"`
-			Active              *bool                  `json:"active"`
-		}
+		var req updateActionRequest
 
 		if err := c.ShouldBindJSON(&req); err != nil {
-			errorResponse(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			bindErrorResponse(c, err)
 			return
 		}
 
-		action, err := actionService.UpdateAction(id, req.Name, req.ActivityType, req.RequiredPermissions, req.Details, req.Active)
+		action, err := actionService.UpdateAction(id, req.Version, req.Name, req.ActivityType, req.RequiredPermissions, req.Details, req.Active, req.AllowSessionAuth, req.SessionPermission)
 		if err != nil {
-			errorResponse(c, http.StatusInternalServerError, "Failed to update action: "+err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, fmt.Errorf("Failed to update action: %w", err))
 			return
 		}
 
-		successResponse(c, gin.H{
-			"id":                   action.ID,
-			"name":                 action.Name,
-			"activity_type":        action.ActivityType,
-			"required_permissions": action.RequiredPermissions,
-			"details":              action.Details,
-			"active":               action.Active,
-			"created_at":           action.CreatedAt,
-			"updated_at":           action.UpdatedAt,
-		})
+		successResponse(c, actionResponse(action))
 	}
 }
 
@@ -272,12 +658,18 @@ func handleDeleteAction(actionService *services.ActionService) gin.HandlerFunc {
 		}
 
 		if err := actionService.DeleteAction(id); err != nil {
-			errorResponse(c, http.StatusInternalServerError, "Failed to delete action: "+err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, fmt.Errorf("Failed to delete action: %w", err))
 			return
 		}
 
-		successResponse(c, gin.H{
-			"message": "Action deleted successfully",
-		})
+		successResponse(c, messageBody{Message: "Action deleted successfully"})
+	}
+}
+
+// handleListSideEffectHandlers handles GET /actions/side-effect-handlers
+func handleListSideEffectHandlers(actionService *services.ActionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		handlers := actionService.SideEffectHandlers()
+		listResponse(c, handlers, int64(len(handlers)))
 	}
-} 
\ No newline at end of file
+}
@@ -0,0 +1,641 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Alerting API handlers
+
+// handleListAlertChannels handles GET /alert-channels
+func handleListAlertChannels(alertService *services.AlertService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		channels, err := alertService.ListChannels()
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		channelList := make([]alertChannelBody, len(channels))
+		for i := range channels {
+			channelList[i] = alertChannelResponse(&channels[i])
+		}
+
+		listResponse(c, channelList, int64(len(channelList)))
+	}
+}
+
+// createAlertChannelRequest is the body of POST /alert-channels
+type createAlertChannelRequest struct {
+	Name   string `json:"name" binding:"required"`
+	Type   string `json:"type" binding:"required" enum:"email,webhook,slack"`
+	Target string `json:"target" binding:"required" doc:"Comma-separated recipients (email) or URL (webhook, slack)"`
+	Secret string `json:"secret" doc:"Signing secret for webhook channels; empty disables signing"`
+	Active *bool  `json:"active"`
+	Nonce  string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleCreateAlertChannel handles POST /alert-channels
+func handleCreateAlertChannel(alertService *services.AlertService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req createAlertChannelRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		channel := &database.AlertChannel{
+			Name:   req.Name,
+			Type:   req.Type,
+			Target: req.Target,
+			Secret: req.Secret,
+			Active: true,
+		}
+		if req.Active != nil {
+			channel.Active = *req.Active
+		}
+
+		channel, err := alertService.CreateChannel(channel)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		createdResponse(c, alertChannelResponse(channel))
+	}
+}
+
+// handleGetAlertChannel handles GET /alert-channels/:id
+func handleGetAlertChannel(alertService *services.AlertService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		channelID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid alert channel ID")
+			return
+		}
+
+		channel, err := alertService.GetChannelByID(channelID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, alertChannelResponse(channel))
+	}
+}
+
+// updateAlertChannelRequest is the body of PUT /alert-channels/:id
+type updateAlertChannelRequest struct {
+	Name   *string `json:"name"`
+	Type   *string `json:"type" enum:"email,webhook,slack"`
+	Target *string `json:"target"`
+	Secret *string `json:"secret"`
+	Active *bool   `json:"active"`
+	Nonce  string  `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleUpdateAlertChannel handles PUT /alert-channels/:id
+func handleUpdateAlertChannel(alertService *services.AlertService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		channelID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid alert channel ID")
+			return
+		}
+
+		var req updateAlertChannelRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		// Build updates map
+		updates := make(map[string]interface{})
+		if req.Name != nil {
+			updates["name"] = *req.Name
+		}
+		if req.Type != nil {
+			updates["type"] = *req.Type
+		}
+		if req.Target != nil {
+			updates["target"] = *req.Target
+		}
+		if req.Secret != nil {
+			updates["secret"] = *req.Secret
+		}
+		if req.Active != nil {
+			updates["active"] = *req.Active
+		}
+
+		channel, err := alertService.UpdateChannel(channelID, updates)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, alertChannelResponse(channel))
+	}
+}
+
+// handleDeleteAlertChannel handles DELETE /alert-channels/:id
+func handleDeleteAlertChannel(alertService *services.AlertService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		channelID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid alert channel ID")
+			return
+		}
+
+		if err := alertService.DeleteChannel(channelID); err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		deletedResponse(c)
+	}
+}
+
+// handleListAlertRules handles GET /alert-rules
+func handleListAlertRules(alertService *services.AlertService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rules, err := alertService.ListRules(c.Query("active") == "true")
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		ruleList := make([]alertRuleBody, len(rules))
+		for i := range rules {
+			ruleList[i] = alertRuleResponse(&rules[i])
+		}
+
+		listResponse(c, ruleList, int64(len(ruleList)))
+	}
+}
+
+// createAlertRuleRequest is the body of POST /alert-rules
+type createAlertRuleRequest struct {
+	Name          string   `json:"name" binding:"required"`
+	Description   string   `json:"description"`
+	Condition     string   `json:"condition" binding:"required" enum:"failed_auth,replayed_otp"`
+	LogType       string   `json:"log_type" doc:"Only count log entries of this type; empty counts every type"`
+	GroupBy       string   `json:"group_by" enum:"user,device,ip_address"`
+	Threshold     int      `json:"threshold"`
+	WindowMinutes int      `json:"window_minutes"`
+	Severity      string   `json:"severity" enum:"info,warning,critical"`
+	ChannelIDs    []string `json:"channel_ids"`
+	Active        *bool    `json:"active"`
+	Nonce         string   `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleCreateAlertRule handles POST /alert-rules
+func handleCreateAlertRule(alertService *services.AlertService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req createAlertRuleRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		channelIDs, err := parseUUIDs(req.ChannelIDs)
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid channel_ids")
+			return
+		}
+
+		rule := &database.AlertRule{
+			Name:          req.Name,
+			Description:   req.Description,
+			Condition:     req.Condition,
+			LogType:       req.LogType,
+			GroupBy:       req.GroupBy,
+			Threshold:     req.Threshold,
+			WindowMinutes: req.WindowMinutes,
+			Severity:      req.Severity,
+			Active:        true,
+		}
+		if req.Active != nil {
+			rule.Active = *req.Active
+		}
+
+		rule, err = alertService.CreateRule(rule, channelIDs)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		createdResponse(c, alertRuleResponse(rule))
+	}
+}
+
+// handleGetAlertRule handles GET /alert-rules/:id
+func handleGetAlertRule(alertService *services.AlertService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ruleID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid alert rule ID")
+			return
+		}
+
+		rule, err := alertService.GetRuleByID(ruleID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, alertRuleResponse(rule))
+	}
+}
+
+// updateAlertRuleRequest is the body of PUT /alert-rules/:id
+type updateAlertRuleRequest struct {
+	Name          *string  `json:"name"`
+	Description   *string  `json:"description"`
+	Condition     *string  `json:"condition" enum:"failed_auth,replayed_otp"`
+	LogType       *string  `json:"log_type"`
+	GroupBy       *string  `json:"group_by" enum:"user,device,ip_address"`
+	Threshold     *int     `json:"threshold"`
+	WindowMinutes *int     `json:"window_minutes"`
+	Severity      *string  `json:"severity" enum:"info,warning,critical"`
+	ChannelIDs    []string `json:"channel_ids" doc:"Replaces the rule's channels when present"`
+	Active        *bool    `json:"active"`
+	Nonce         string   `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleUpdateAlertRule handles PUT /alert-rules/:id
+func handleUpdateAlertRule(alertService *services.AlertService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ruleID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid alert rule ID")
+			return
+		}
+
+		var req updateAlertRuleRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		// Build updates map
+		updates := make(map[string]interface{})
+		if req.Name != nil {
+			updates["name"] = *req.Name
+		}
+		if req.Description != nil {
+			updates["description"] = *req.Description
+		}
+		if req.Condition != nil {
+			updates["condition"] = *req.Condition
+		}
+		if req.LogType != nil {
+			updates["log_type"] = *req.LogType
+		}
+		if req.GroupBy != nil {
+			updates["group_by"] = *req.GroupBy
+		}
+		if req.Threshold != nil {
+			updates["threshold"] = *req.Threshold
+		}
+		if req.WindowMinutes != nil {
+			updates["window_minutes"] = *req.WindowMinutes
+		}
+		if req.Severity != nil {
+			updates["severity"] = *req.Severity
+		}
+		if req.Active != nil {
+			updates["active"] = *req.Active
+		}
+
+		var channelIDs []uuid.UUID
+		if req.ChannelIDs != nil {
+			if channelIDs, err = parseUUIDs(req.ChannelIDs); err != nil {
+				errorResponse(c, http.StatusBadRequest, "Invalid channel_ids")
+				return
+			}
+		}
+
+		rule, err := alertService.UpdateRule(ruleID, updates, channelIDs)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, alertRuleResponse(rule))
+	}
+}
+
+// handleDeleteAlertRule handles DELETE /alert-rules/:id
+func handleDeleteAlertRule(alertService *services.AlertService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ruleID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid alert rule ID")
+			return
+		}
+
+		if err := alertService.DeleteRule(ruleID); err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		deletedResponse(c)
+	}
+}
+
+// handleListAlerts handles GET /alerts
+func handleListAlerts(alertService *services.AlertService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := services.AlertFilter{
+			Status:   c.Query("status"),
+			Severity: c.Query("severity"),
+			Limit:    50,
+		}
+
+		var err error
+		if filter.RuleID, err = parseOptionalUUID(c.Query("rule_id")); err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid rule_id")
+			return
+		}
+		if limitStr := c.Query("limit"); limitStr != "" {
+			if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+				filter.Limit = l
+			}
+		}
+		if offsetStr := c.Query("offset"); offsetStr != "" {
+			if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+				filter.Offset = o
+			}
+		}
+
+		alerts, total, err := alertService.ListAlerts(filter)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		alertList := make([]alertBody, len(alerts))
+		for i := range alerts {
+			alertList[i] = alertResponse(&alerts[i])
+		}
+
+		listResponse(c, alertList, total)
+	}
+}
+
+// handleGetAlert handles GET /alerts/:id
+func handleGetAlert(alertService *services.AlertService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		alertID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid alert ID")
+			return
+		}
+
+		alert, err := alertService.GetAlertByID(alertID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, alertResponse(alert))
+	}
+}
+
+// acknowledgeAlertRequest is the optional body of POST /alerts/:id/acknowledge
+type acknowledgeAlertRequest struct {
+	Nonce string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleAcknowledgeAlert handles POST /alerts/:id/acknowledge
+func handleAcknowledgeAlert(alertService *services.AlertService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		alertID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid alert ID")
+			return
+		}
+
+		var req acknowledgeAlertRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				bindErrorResponse(c, err)
+				return
+			}
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		alert, err := alertService.AcknowledgeAlert(alertID, c.MustGet("user_id").(uuid.UUID))
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, alertResponse(alert))
+	}
+}
+
+// resolveAlertRequest is the optional body of POST /alerts/:id/resolve
+type resolveAlertRequest struct {
+	Note  string `json:"note"`
+	Nonce string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleResolveAlert handles POST /alerts/:id/resolve
+func handleResolveAlert(alertService *services.AlertService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		alertID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid alert ID")
+			return
+		}
+
+		var req resolveAlertRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				bindErrorResponse(c, err)
+				return
+			}
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		alert, err := alertService.ResolveAlert(alertID, c.MustGet("user_id").(uuid.UUID), req.Note)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, alertResponse(alert))
+	}
+}
+
+// parseUUIDs parses a list of UUID strings
+func parseUUIDs(values []string) ([]uuid.UUID, error) {
+	ids := make([]uuid.UUID, 0, len(values))
+	for _, value := range values {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// alertChannelBody is the API representation of an alert channel
+type alertChannelBody struct {
+	ID             uuid.UUID  `json:"id"`
+	Name           string     `json:"name"`
+	Type           string     `json:"type" enum:"email,webhook,slack"`
+	Target         string     `json:"target" doc:"Comma-separated recipients (email) or URL (webhook, slack)"`
+	Signed         bool       `json:"signed" doc:"Webhook deliveries are signed with the channel's secret"`
+	Active         bool       `json:"active"`
+	LastDeliveryAt *time.Time `json:"last_delivery_at"`
+	LastError      string     `json:"last_error"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// alertChannelResponse formats an alert channel for API responses; the secret is never returned
+func alertChannelResponse(channel *database.AlertChannel) alertChannelBody {
+	return alertChannelBody{
+		ID:             channel.ID,
+		Name:           channel.Name,
+		Type:           channel.Type,
+		Target:         channel.Target,
+		Signed:         channel.Secret != "",
+		Active:         channel.Active,
+		LastDeliveryAt: channel.LastDeliveryAt,
+		LastError:      channel.LastError,
+		CreatedAt:      channel.CreatedAt,
+		UpdatedAt:      channel.UpdatedAt,
+	}
+}
+
+// alertRuleChannelBody is a channel an alert rule notifies
+type alertRuleChannelBody struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+	Type string    `json:"type" enum:"email,webhook,slack"`
+}
+
+// alertRuleBody is the API representation of an alert rule
+type alertRuleBody struct {
+	ID            uuid.UUID              `json:"id"`
+	Name          string                 `json:"name"`
+	Description   string                 `json:"description"`
+	Condition     string                 `json:"condition" enum:"failed_auth,replayed_otp"`
+	LogType       string                 `json:"log_type" doc:"Only log entries of this type are counted; empty counts every type"`
+	GroupBy       string                 `json:"group_by" enum:"user,device,ip_address"`
+	Threshold     int                    `json:"threshold"`
+	WindowMinutes int                    `json:"window_minutes"`
+	Severity      string                 `json:"severity" enum:"info,warning,critical"`
+	Channels      []alertRuleChannelBody `json:"channels"`
+	Active        bool                   `json:"active"`
+	CreatedAt     time.Time              `json:"created_at"`
+	UpdatedAt     time.Time              `json:"updated_at"`
+}
+
+// alertRuleResponse formats an alert rule for API responses
+func alertRuleResponse(rule *database.AlertRule) alertRuleBody {
+	channels := make([]alertRuleChannelBody, len(rule.Channels))
+	for i, channel := range rule.Channels {
+		channels[i] = alertRuleChannelBody{ID: channel.ID, Name: channel.Name, Type: channel.Type}
+	}
+	return alertRuleBody{
+		ID:            rule.ID,
+		Name:          rule.Name,
+		Description:   rule.Description,
+		Condition:     rule.Condition,
+		LogType:       rule.LogType,
+		GroupBy:       rule.GroupBy,
+		Threshold:     rule.Threshold,
+		WindowMinutes: rule.WindowMinutes,
+		Severity:      rule.Severity,
+		Channels:      channels,
+		Active:        rule.Active,
+		CreatedAt:     rule.CreatedAt,
+		UpdatedAt:     rule.UpdatedAt,
+	}
+}
+
+// alertBody is the API representation of an alert
+type alertBody struct {
+	ID               uuid.UUID  `json:"id"`
+	RuleID           uuid.UUID  `json:"rule_id"`
+	Rule             string     `json:"rule" doc:"The rule's name"`
+	Subject          string     `json:"subject" doc:"The grouped value: user ID, device ID or IP address"`
+	UserID           *uuid.UUID `json:"user_id"`
+	Username         string     `json:"username,omitempty"`
+	DeviceID         *uuid.UUID `json:"device_id"`
+	IPAddress        string     `json:"ip_address"`
+	Severity         string     `json:"severity" enum:"info,warning,critical"`
+	Count            int        `json:"count" doc:"Matching log entries since first_seen_at"`
+	FirstSeenAt      time.Time  `json:"first_seen_at"`
+	LastSeenAt       time.Time  `json:"last_seen_at"`
+	Status           string     `json:"status" enum:"open,acknowledged,resolved"`
+	AcknowledgedAt   *time.Time `json:"acknowledged_at"`
+	AcknowledgedByID *uuid.UUID `json:"acknowledged_by_id"`
+	ResolvedAt       *time.Time `json:"resolved_at"`
+	ResolvedByID     *uuid.UUID `json:"resolved_by_id"`
+	ResolutionNote   string     `json:"resolution_note"`
+	DeliveryError    string     `json:"delivery_error" doc:"Channels that could not be notified, and why"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// alertResponse formats an alert for API responses
+func alertResponse(alert *database.Alert) alertBody {
+	response := alertBody{
+		ID:               alert.ID,
+		RuleID:           alert.RuleID,
+		Rule:             alert.Rule.Name,
+		Subject:          alert.Subject,
+		UserID:           alert.UserID,
+		DeviceID:         alert.DeviceID,
+		IPAddress:        alert.IPAddress,
+		Severity:         alert.Severity,
+		Count:            alert.Count,
+		FirstSeenAt:      alert.FirstSeenAt,
+		LastSeenAt:       alert.LastSeenAt,
+		Status:           alert.Status,
+		AcknowledgedAt:   alert.AcknowledgedAt,
+		AcknowledgedByID: alert.AcknowledgedByID,
+		ResolvedAt:       alert.ResolvedAt,
+		ResolvedByID:     alert.ResolvedByID,
+		ResolutionNote:   alert.ResolutionNote,
+		DeliveryError:    alert.DeliveryError,
+		CreatedAt:        alert.CreatedAt,
+		UpdatedAt:        alert.UpdatedAt,
+	}
+	if alert.User != nil {
+		response.Username = alert.User.Username
+	}
+	return response
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Anomaly handlers
+
+// handleListAnomalies handles GET /anomalies
+func handleListAnomalies(anomalyService *services.AnomalyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := services.AnomalyFilter{
+			Status: c.Query("status"),
+			Type:   c.Query("type"),
+			Limit:  50,
+		}
+
+		var err error
+		if filter.UserID, err = parseOptionalUUID(c.Query("user_id")); err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid user_id")
+			return
+		}
+		if limitStr := c.Query("limit"); limitStr != "" {
+			if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+				filter.Limit = l
+			}
+		}
+		if offsetStr := c.Query("offset"); offsetStr != "" {
+			if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+				filter.Offset = o
+			}
+		}
+
+		anomalies, total, err := anomalyService.ListAnomalies(filter)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		anomalyList := make([]anomalyBody, len(anomalies))
+		for i := range anomalies {
+			anomalyList[i] = anomalyResponse(&anomalies[i])
+		}
+
+		listResponse(c, anomalyList, total)
+	}
+}
+
+// handleGetAnomaly handles GET /anomalies/:id
+func handleGetAnomaly(anomalyService *services.AnomalyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		anomalyID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid anomaly ID")
+			return
+		}
+
+		anomaly, err := anomalyService.GetAnomalyByID(anomalyID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, anomalyResponse(anomaly))
+	}
+}
+
+// acknowledgeAnomalyRequest is the body of POST /anomalies/:id/acknowledge
+type acknowledgeAnomalyRequest struct {
+	Nonce string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleAcknowledgeAnomaly handles POST /anomalies/:id/acknowledge
+func handleAcknowledgeAnomaly(anomalyService *services.AnomalyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		anomalyID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid anomaly ID")
+			return
+		}
+
+		var req acknowledgeAnomalyRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				bindErrorResponse(c, err)
+				return
+			}
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		anomaly, err := anomalyService.AcknowledgeAnomaly(anomalyID, c.MustGet("user_id").(uuid.UUID))
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, anomalyResponse(anomaly))
+	}
+}
+
+// resolveAnomalyRequest is the body of POST /anomalies/:id/resolve
+type resolveAnomalyRequest struct {
+	Note  string `json:"note"`
+	Nonce string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleResolveAnomaly handles POST /anomalies/:id/resolve
+func handleResolveAnomaly(anomalyService *services.AnomalyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		anomalyID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid anomaly ID")
+			return
+		}
+
+		var req resolveAnomalyRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				bindErrorResponse(c, err)
+				return
+			}
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		anomaly, err := anomalyService.ResolveAnomaly(anomalyID, c.MustGet("user_id").(uuid.UUID), req.Note)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, anomalyResponse(anomaly))
+	}
+}
+
+// anomalyBody is the API representation of an anomaly
+type anomalyBody struct {
+	ID               uuid.UUID  `json:"id"`
+	Type             string     `json:"type" enum:"unusual_hour,open_activity,distant_ips"`
+	UserID           uuid.UUID  `json:"user_id"`
+	Username         string     `json:"username"`
+	IPAddress        string     `json:"ip_address"`
+	Details          string     `json:"details"`
+	AuthLogID        *uuid.UUID `json:"auth_log_id" doc:"The login flagged, for unusual_hour and distant_ips"`
+	ActivityID       *uuid.UUID `json:"activity_id" doc:"The activity left open, for open_activity"`
+	OccurredAt       time.Time  `json:"occurred_at"`
+	Status           string     `json:"status" enum:"open,acknowledged,resolved"`
+	AcknowledgedAt   *time.Time `json:"acknowledged_at"`
+	AcknowledgedByID *uuid.UUID `json:"acknowledged_by_id"`
+	ResolvedAt       *time.Time `json:"resolved_at"`
+	ResolvedByID     *uuid.UUID `json:"resolved_by_id"`
+	ResolutionNote   string     `json:"resolution_note"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// anomalyResponse formats an anomaly for API responses
+func anomalyResponse(anomaly *database.AnomalyEvent) anomalyBody {
+	return anomalyBody{
+		ID:               anomaly.ID,
+		Type:             anomaly.Type,
+		UserID:           anomaly.UserID,
+		Username:         anomaly.User.Username,
+		IPAddress:        anomaly.IPAddress,
+		Details:          anomaly.Details,
+		AuthLogID:        anomaly.AuthLogID,
+		ActivityID:       anomaly.ActivityID,
+		OccurredAt:       anomaly.OccurredAt,
+		Status:           anomaly.Status,
+		AcknowledgedAt:   anomaly.AcknowledgedAt,
+		AcknowledgedByID: anomaly.AcknowledgedByID,
+		ResolvedAt:       anomaly.ResolvedAt,
+		ResolvedByID:     anomaly.ResolvedByID,
+		ResolutionNote:   anomaly.ResolutionNote,
+		CreatedAt:        anomaly.CreatedAt,
+		UpdatedAt:        anomaly.UpdatedAt,
+	}
+}
@@ -0,0 +1,368 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Attendance policy API handlers
+
+// createAttendancePolicyRequest is the body of POST /attendance-policies
+type createAttendancePolicyRequest struct {
+	Name                    string   `json:"name" binding:"required"`
+	Description             string   `json:"description"`
+	RoleID                  string   `json:"role_id"`
+	LocationID              string   `json:"location_id"`
+	ExpectedDailyHours      *float64 `json:"expected_daily_hours"`
+	WorkDays                string   `json:"work_days"`
+	StartTime               string   `json:"start_time"`
+	GraceMinutes            int      `json:"grace_minutes"`
+	Timezone                string   `json:"timezone"`
+	OvertimeThresholdHours  float64  `json:"overtime_threshold_hours"`
+	UndertimeThresholdHours float64  `json:"undertime_threshold_hours"`
+	NotifyWebhookURL        string   `json:"notify_webhook_url"`
+	NotifyEmails            string   `json:"notify_emails"`
+	Active                  *bool    `json:"active"`
+	Nonce                   string   `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+func handleCreateAttendancePolicy(attendanceService *services.AttendanceService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req createAttendancePolicyRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		policy := &database.AttendancePolicy{
+			Name:                    req.Name,
+			Description:             req.Description,
+			ExpectedDailyHours:      8,
+			WorkDays:                req.WorkDays,
+			StartTime:               req.StartTime,
+			GraceMinutes:            req.GraceMinutes,
+			Timezone:                req.Timezone,
+			OvertimeThresholdHours:  req.OvertimeThresholdHours,
+			UndertimeThresholdHours: req.UndertimeThresholdHours,
+			NotifyWebhookURL:        req.NotifyWebhookURL,
+			NotifyEmails:            req.NotifyEmails,
+			Active:                  true,
+		}
+		if req.ExpectedDailyHours != nil {
+			policy.ExpectedDailyHours = *req.ExpectedDailyHours
+		}
+		if req.Active != nil {
+			policy.Active = *req.Active
+		}
+
+		var err error
+		if policy.RoleID, err = parseOptionalUUID(req.RoleID); err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid role_id")
+			return
+		}
+		if policy.LocationID, err = parseOptionalUUID(req.LocationID); err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid location_id")
+			return
+		}
+
+		policy, err = attendanceService.CreatePolicy(policy)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		createdResponse(c, attendancePolicyResponse(policy))
+	}
+}
+
+func handleGetAttendancePolicy(attendanceService *services.AttendanceService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policyID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid attendance policy ID")
+			return
+		}
+
+		policy, err := attendanceService.GetPolicyByID(policyID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, attendancePolicyResponse(policy))
+	}
+}
+
+func handleListAttendancePolicies(attendanceService *services.AttendanceService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policies, err := attendanceService.ListPolicies(c.Query("active") == "true")
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		policyList := make([]attendancePolicyBody, len(policies))
+		for i := range policies {
+			policyList[i] = attendancePolicyResponse(&policies[i])
+		}
+
+		listResponse(c, policyList, int64(len(policyList)))
+	}
+}
+
+// updateAttendancePolicyRequest is the body of PUT /attendance-policies/:id
+type updateAttendancePolicyRequest struct {
+	Name                    *string  `json:"name"`
+	Description             *string  `json:"description"`
+	RoleID                  *string  `json:"role_id" doc:"Empty string clears the role"`
+	LocationID              *string  `json:"location_id" doc:"Empty string clears the location"`
+	ExpectedDailyHours      *float64 `json:"expected_daily_hours"`
+	WorkDays                *string  `json:"work_days"`
+	StartTime               *string  `json:"start_time"`
+	GraceMinutes            *int     `json:"grace_minutes"`
+	Timezone                *string  `json:"timezone"`
+	OvertimeThresholdHours  *float64 `json:"overtime_threshold_hours"`
+	UndertimeThresholdHours *float64 `json:"undertime_threshold_hours"`
+	NotifyWebhookURL        *string  `json:"notify_webhook_url"`
+	NotifyEmails            *string  `json:"notify_emails"`
+	Active                  *bool    `json:"active"`
+	Nonce                   string   `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+func handleUpdateAttendancePolicy(attendanceService *services.AttendanceService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policyID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid attendance policy ID")
+			return
+		}
+
+		var req updateAttendancePolicyRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		// Build updates map
+		updates := make(map[string]interface{})
+		if req.Name != nil {
+			updates["name"] = *req.Name
+		}
+		if req.Description != nil {
+			updates["description"] = *req.Description
+		}
+		if req.RoleID != nil {
+			roleID, err := parseOptionalUUID(*req.RoleID)
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Invalid role_id")
+				return
+			}
+			updates["role_id"] = roleID
+		}
+		if req.LocationID != nil {
+			locationID, err := parseOptionalUUID(*req.LocationID)
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Invalid location_id")
+				return
+			}
+			updates["location_id"] = locationID
+		}
+		if req.ExpectedDailyHours != nil {
+			updates["expected_daily_hours"] = *req.ExpectedDailyHours
+		}
+		if req.WorkDays != nil {
+			updates["work_days"] = *req.WorkDays
+		}
+		if req.StartTime != nil {
+			updates["start_time"] = *req.StartTime
+		}
+		if req.GraceMinutes != nil {
+			updates["grace_minutes"] = *req.GraceMinutes
+		}
+		if req.Timezone != nil {
+			updates["timezone"] = *req.Timezone
+		}
+		if req.OvertimeThresholdHours != nil {
+			updates["overtime_threshold_hours"] = *req.OvertimeThresholdHours
+		}
+		if req.UndertimeThresholdHours != nil {
+			updates["undertime_threshold_hours"] = *req.UndertimeThresholdHours
+		}
+		if req.NotifyWebhookURL != nil {
+			updates["notify_webhook_url"] = *req.NotifyWebhookURL
+		}
+		if req.NotifyEmails != nil {
+			updates["notify_emails"] = *req.NotifyEmails
+		}
+		if req.Active != nil {
+			updates["active"] = *req.Active
+		}
+
+		policy, err := attendanceService.UpdatePolicy(policyID, updates)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, attendancePolicyResponse(policy))
+	}
+}
+
+func handleDeleteAttendancePolicy(attendanceService *services.AttendanceService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policyID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid attendance policy ID")
+			return
+		}
+
+		if err := attendanceService.DeletePolicy(policyID); err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		deletedResponse(c)
+	}
+}
+
+// handleGetAttendanceReport handles GET /reports/attendance
+func handleGetAttendanceReport(attendanceService *services.AttendanceService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := services.AttendanceFilter{}
+
+		if userIDsStr := c.Query("user_ids"); userIDsStr != "" {
+			userIDs, err := parseUUIDArray(userIDsStr)
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Invalid user_ids format")
+				return
+			}
+			filter.UserIDs = userIDs
+		}
+
+		from, err := parseReportTime(c.Query("from"), false)
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid or missing 'from': "+err.Error())
+			return
+		}
+		to, err := parseReportTime(c.Query("to"), true)
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid or missing 'to': "+err.Error())
+			return
+		}
+		if !to.After(from) {
+			errorResponse(c, http.StatusBadRequest, "'to' must be after 'from'")
+			return
+		}
+		filter.From = from
+		filter.To = to
+
+		report, err := attendanceService.GenerateAttendance(filter)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, fmt.Errorf("Failed to generate attendance report: %w", err))
+			return
+		}
+
+		successResponse(c, attendanceReportBody{
+			Data:   report.Days,
+			Totals: report.Totals,
+			Meta: attendanceReportMeta{
+				From:    filter.From,
+				To:      filter.To,
+				UserIDs: filter.UserIDs,
+			},
+		})
+	}
+}
+
+// attendanceReportBody is the JSON form of the attendance report
+type attendanceReportBody struct {
+	Data   []services.AttendanceDay    `json:"data"`
+	Totals []services.AttendanceTotals `json:"totals"`
+	Meta   attendanceReportMeta        `json:"meta"`
+}
+
+// attendanceReportMeta is the selection an attendance report covers
+type attendanceReportMeta struct {
+	From    time.Time   `json:"from"`
+	To      time.Time   `json:"to"`
+	UserIDs []uuid.UUID `json:"user_ids"`
+}
+
+// attendancePolicyBody is the API representation of an attendance policy
+type attendancePolicyBody struct {
+	ID                      uuid.UUID  `json:"id"`
+	Name                    string     `json:"name"`
+	Description             string     `json:"description"`
+	RoleID                  *uuid.UUID `json:"role_id" doc:"Empty applies to all roles"`
+	LocationID              *uuid.UUID `json:"location_id" doc:"Empty applies to all locations"`
+	ExpectedDailyHours      float64    `json:"expected_daily_hours"`
+	WorkDays                string     `json:"work_days" doc:"Comma-separated weekday abbreviations, e.g. mon,tue,wed,thu,fri"`
+	StartTime               string     `json:"start_time" doc:"HH:MM; empty disables late sign-in checks"`
+	GraceMinutes            int        `json:"grace_minutes"`
+	Timezone                string     `json:"timezone"`
+	OvertimeThresholdHours  float64    `json:"overtime_threshold_hours"`
+	UndertimeThresholdHours float64    `json:"undertime_threshold_hours"`
+	NotifyWebhookURL        string     `json:"notify_webhook_url"`
+	NotifyEmails            string     `json:"notify_emails" doc:"Comma-separated recipients"`
+	Active                  bool       `json:"active"`
+	CreatedAt               time.Time  `json:"created_at"`
+	UpdatedAt               time.Time  `json:"updated_at"`
+	Role                    string     `json:"role,omitempty" doc:"The role's name"`
+	Location                string     `json:"location,omitempty" doc:"The location's name"`
+}
+
+// attendancePolicyResponse formats an attendance policy for API responses
+func attendancePolicyResponse(policy *database.AttendancePolicy) attendancePolicyBody {
+	response := attendancePolicyBody{
+		ID:                      policy.ID,
+		Name:                    policy.Name,
+		Description:             policy.Description,
+		RoleID:                  policy.RoleID,
+		LocationID:              policy.LocationID,
+		ExpectedDailyHours:      policy.ExpectedDailyHours,
+		WorkDays:                policy.WorkDays,
+		StartTime:               policy.StartTime,
+		GraceMinutes:            policy.GraceMinutes,
+		Timezone:                policy.Timezone,
+		OvertimeThresholdHours:  policy.OvertimeThresholdHours,
+		UndertimeThresholdHours: policy.UndertimeThresholdHours,
+		NotifyWebhookURL:        policy.NotifyWebhookURL,
+		NotifyEmails:            policy.NotifyEmails,
+		Active:                  policy.Active,
+		CreatedAt:               policy.CreatedAt,
+		UpdatedAt:               policy.UpdatedAt,
+	}
+	if policy.Role != nil {
+		response.Role = policy.Role.Name
+	}
+	if policy.Location != nil {
+		response.Location = policy.Location.Name
+	}
+	return response
+}
+
+// parseOptionalUUID parses a UUID, treating an empty string as unset
+func parseOptionalUUID(value string) (*uuid.UUID, error) {
+	if value == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
@@ -0,0 +1,226 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+)
+
+const (
+	authLogDefaultLimit   = 50
+	authLogMaxLimit       = 500
+	authLogSummaryDefault = 30 * 24 * time.Hour // Summary range when no from is given
+)
+
+// handleListAuthLogs handles GET /auth-logs
+func handleListAuthLogs(authLogService *services.AuthLogService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, err := parseAuthLogFilter(c)
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		filter.Limit = authLogDefaultLimit
+		if limitStr := c.Query("limit"); limitStr != "" {
+			if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+				filter.Limit = min(l, authLogMaxLimit)
+			}
+		}
+		if offsetStr := c.Query("offset"); offsetStr != "" {
+			if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+				filter.Offset = o
+			}
+		}
+
+		logs, total, err := authLogService.ListAuthLogs(filter)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		logList := make([]authLogBody, len(logs))
+		for i := range logs {
+			logList[i] = authLogResponse(&logs[i])
+		}
+
+		listResponse(c, logList, total)
+	}
+}
+
+// authLogSummaryBody counts authentications per day
+type authLogSummaryBody struct {
+	From time.Time                    `json:"from"`
+	To   time.Time                    `json:"to"`
+	Days []services.AuthLogDaySummary `json:"days"`
+}
+
+// handleAuthLogSummary handles GET /auth-logs/summary. The range defaults to
+// the 30 days up to now.
+func handleAuthLogSummary(authLogService *services.AuthLogService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, err := parseAuthLogFilter(c)
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		if filter.To == nil {
+			now := time.Now()
+			filter.To = &now
+		}
+		if filter.From == nil {
+			from := filter.To.Add(-authLogSummaryDefault)
+			filter.From = &from
+		}
+
+		days, err := authLogService.SummarizeAuthLogs(filter)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, authLogSummaryBody{From: *filter.From, To: *filter.To, Days: days})
+	}
+}
+
+// degradedModeReportBody is the degraded mode report over a range
+type degradedModeReportBody struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	services.DegradedModeReport
+}
+
+// handleDegradedModeReport handles GET /auth-logs/degraded: the recovery report
+// of authentications decided by yubikey.degraded_mode. The range defaults to
+// the 30 days up to now.
+func handleDegradedModeReport(authLogService *services.AuthLogService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, err := parseAuthLogFilter(c)
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		if filter.To == nil {
+			now := time.Now()
+			filter.To = &now
+		}
+		if filter.From == nil {
+			from := filter.To.Add(-authLogSummaryDefault)
+			filter.From = &from
+		}
+
+		report, err := authLogService.DegradedModeReport(filter)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, degradedModeReportBody{From: *filter.From, To: *filter.To, DegradedModeReport: *report})
+	}
+}
+
+// parseAuthLogFilter reads the filters shared by the list and summary endpoints
+func parseAuthLogFilter(c *gin.Context) (services.AuthLogFilter, error) {
+	filter := services.AuthLogFilter{
+		Type:      c.Query("type"),
+		IPAddress: c.Query("ip_address"),
+	}
+
+	var err error
+	if filter.UserID, err = parseOptionalUUID(c.Query("user_id")); err != nil {
+		return filter, fmt.Errorf("Invalid user_id")
+	}
+	if filter.DeviceID, err = parseOptionalUUID(c.Query("device_id")); err != nil {
+		return filter, fmt.Errorf("Invalid device_id")
+	}
+	if filter.ActionID, err = parseOptionalUUID(c.Query("action_id")); err != nil {
+		return filter, fmt.Errorf("Invalid action_id")
+	}
+	if degradedStr := c.Query("degraded"); degradedStr != "" {
+		degraded, err := strconv.ParseBool(degradedStr)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid degraded: use true or false")
+		}
+		filter.Degraded = degraded
+	}
+	if successStr := c.Query("success"); successStr != "" {
+		success, err := strconv.ParseBool(successStr)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid success: use true or false")
+		}
+		filter.Success = &success
+	}
+	if fromStr := c.Query("from"); fromStr != "" {
+		from, err := parseReportTime(fromStr, false)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid from: %v", err)
+		}
+		filter.From = &from
+	}
+	if toStr := c.Query("to"); toStr != "" {
+		to, err := parseReportTime(toStr, true)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid to: %v", err)
+		}
+		filter.To = &to
+	}
+	if filter.From != nil && filter.To != nil && !filter.To.After(*filter.From) {
+		return filter, fmt.Errorf("'to' must be after 'from'")
+	}
+	return filter, nil
+}
+
+// authLogBody is the API representation of an authentication log entry
+type authLogBody struct {
+	ID         uuid.UUID              `json:"id"`
+	UserID     *uuid.UUID             `json:"user_id"`
+	DeviceID   uuid.UUID              `json:"device_id"`
+	ActionID   *uuid.UUID             `json:"action_id"`
+	Type       string                 `json:"type" enum:"login,logout,refresh,mfa,action,break_glass"`
+	Success    bool                   `json:"success"`
+	IPAddress  string                 `json:"ip_address"`
+	UserAgent  string                 `json:"user_agent"`
+	RequestID  string                 `json:"request_id" doc:"X-Request-ID of the API request that logged it"`
+	Details    map[string]interface{} `json:"details"`
+	CreatedAt  time.Time              `json:"created_at"`
+	Username   string                 `json:"username,omitempty"`
+	DeviceType string                 `json:"device_type,omitempty"`
+	DeviceName string                 `json:"device_name,omitempty"`
+}
+
+// authLogResponse formats an authentication log entry for API responses
+func authLogResponse(entry *database.AuthenticationLog) authLogBody {
+	var details map[string]interface{}
+	if entry.Details.Status == pgtype.Present {
+		entry.Details.AssignTo(&details)
+	}
+
+	response := authLogBody{
+		ID:        entry.ID,
+		UserID:    entry.UserID,
+		DeviceID:  entry.DeviceID,
+		ActionID:  entry.ActionID,
+		Type:      entry.Type,
+		Success:   entry.Success,
+		IPAddress: entry.IPAddress,
+		UserAgent: entry.UserAgent,
+		RequestID: entry.RequestID,
+		Details:   details,
+		CreatedAt: entry.CreatedAt,
+	}
+	if entry.User != nil {
+		response.Username = entry.User.Username
+	}
+	if entry.Device.ID != uuid.Nil {
+		response.DeviceType = entry.Device.Type
+		response.DeviceName = entry.Device.Name
+	}
+	return response
+}
@@ -0,0 +1,245 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Break-glass handlers
+
+// breakGlassRequest is the body of POST /auth/break-glass
+type breakGlassRequest struct {
+	Credential string `json:"credential" binding:"required" doc:"The sealed secret"`
+	Nonce      string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// breakGlassSessionBody is the response of a break-glass sign-in
+type breakGlassSessionBody struct {
+	Authenticated bool            `json:"authenticated"`
+	SessionID     string          `json:"session_id" format:"uuid"`
+	AccessToken   string          `json:"access_token"`
+	RefreshToken  string          `json:"refresh_token"`
+	ExpiresAt     time.Time       `json:"expires_at"`
+	BreakGlass    bool            `json:"break_glass"`
+	CredentialID  uuid.UUID       `json:"credential_id"`
+	IncidentID    uuid.UUID       `json:"incident_id" doc:"The break_glass_used incident opened for this use"`
+	User          sessionUserBody `json:"user"`
+}
+
+// handleBreakGlass handles POST /auth/break-glass. The holder of a sealed
+// emergency credential signs in as its admin account without a device; the
+// session can write, lasts break_glass.session_expiry, and every request is
+// logged. The other admins are alerted and an incident is opened for review.
+func handleBreakGlass(breakGlassService *services.BreakGlassService, sessionService *services.SessionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req breakGlassRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		result, err := breakGlassService.Use(req.Credential, sessionClient(c), c.GetString("request_id"))
+		if err != nil {
+			serviceErrorResponse(c, http.StatusUnauthorized, err)
+			return
+		}
+
+		accessToken, err := sessionService.GenerateAccessToken(result.Session)
+		if err != nil {
+			errorResponse(c, http.StatusInternalServerError, "Failed to generate access token: "+err.Error())
+			return
+		}
+		refreshToken, err := sessionService.GenerateRefreshToken(result.Session)
+		if err != nil {
+			errorResponse(c, http.StatusInternalServerError, "Failed to generate refresh token: "+err.Error())
+			return
+		}
+
+		successResponse(c, breakGlassSessionBody{
+			Authenticated: true,
+			SessionID:     result.Session.ID,
+			AccessToken:   accessToken,
+			RefreshToken:  refreshToken,
+			ExpiresAt:     result.Session.ExpiresAt,
+			BreakGlass:    true,
+			CredentialID:  result.Credential.ID,
+			IncidentID:    result.Incident.ID,
+			User:          sessionUserResponse(result.User),
+		})
+	}
+}
+
+// handleListBreakGlass handles GET /break-glass
+func handleListBreakGlass(breakGlassService *services.BreakGlassService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		credentials, err := breakGlassService.ListCredentials()
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		credentialList := make([]breakGlassCredentialBody, len(credentials))
+		for i := range credentials {
+			credentialList[i] = breakGlassCredentialResponse(&credentials[i])
+		}
+
+		listResponse(c, credentialList, int64(len(credentialList)))
+	}
+}
+
+// createBreakGlassRequest is the body of POST /break-glass
+type createBreakGlassRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	UserID      string `json:"user_id" binding:"required" format:"uuid" doc:"The account the credential signs in as"`
+	Nonce       string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleCreateBreakGlass handles POST /break-glass, sealing a new credential
+// for a pre-provisioned admin account
+func handleCreateBreakGlass(breakGlassService *services.BreakGlassService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req createBreakGlassRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		userID, err := uuid.Parse(req.UserID)
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid user_id")
+			return
+		}
+
+		credential, secret, err := breakGlassService.CreateCredential(req.Name, req.Description, userID, c.MustGet("user_id").(uuid.UUID))
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		createdResponse(c, breakGlassSecretResponse(credential, secret))
+	}
+}
+
+// handleGetBreakGlass handles GET /break-glass/:id
+func handleGetBreakGlass(breakGlassService *services.BreakGlassService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		credentialID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid break-glass credential ID")
+			return
+		}
+
+		credential, err := breakGlassService.GetCredential(credentialID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, breakGlassCredentialResponse(credential))
+	}
+}
+
+// handleResealBreakGlass handles POST /break-glass/:id/reseal, replacing the
+// secret of a credential whose envelope has been opened
+func handleResealBreakGlass(breakGlassService *services.BreakGlassService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		credentialID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid break-glass credential ID")
+			return
+		}
+
+		credential, secret, err := breakGlassService.ResealCredential(credentialID, c.MustGet("user_id").(uuid.UUID))
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, breakGlassSecretResponse(credential, secret))
+	}
+}
+
+// handleDeleteBreakGlass handles DELETE /break-glass/:id
+func handleDeleteBreakGlass(breakGlassService *services.BreakGlassService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		credentialID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid break-glass credential ID")
+			return
+		}
+
+		if err := breakGlassService.DeleteCredential(credentialID); err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		successResponse(c, messageBody{Message: "Break-glass credential deleted successfully"})
+	}
+}
+
+// breakGlassSecretBody is a credential with its new secret
+type breakGlassSecretBody struct {
+	breakGlassCredentialBody
+	Credential string `json:"credential" doc:"The secret to seal away; it is not shown again"`
+	Message    string `json:"message"`
+}
+
+// breakGlassSecretResponse returns a credential with its new secret; it is not
+// shown again
+func breakGlassSecretResponse(credential *database.BreakGlassCredential, secret string) breakGlassSecretBody {
+	return breakGlassSecretBody{
+		breakGlassCredentialBody: breakGlassCredentialResponse(credential),
+		Credential:               secret,
+		Message:                  "Seal this credential away; it will not be shown again",
+	}
+}
+
+// breakGlassCredentialBody is the API representation of a sealed emergency
+// credential
+type breakGlassCredentialBody struct {
+	ID          uuid.UUID  `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	UserID      uuid.UUID  `json:"user_id" doc:"The pre-provisioned admin account it signs in as"`
+	Username    string     `json:"username"`
+	SealedAt    time.Time  `json:"sealed_at"`
+	SealedByID  *uuid.UUID `json:"sealed_by_id"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	LastUsedIP  string     `json:"last_used_ip"`
+	IncidentID  *uuid.UUID `json:"incident_id" doc:"The break_glass_used incident of the last use"`
+	UnderReview bool       `json:"under_review" doc:"The last use's incident is open; the credential cannot be used until it is resolved"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// breakGlassCredentialResponse formats a break-glass credential for API responses
+func breakGlassCredentialResponse(credential *database.BreakGlassCredential) breakGlassCredentialBody {
+	return breakGlassCredentialBody{
+		ID:          credential.ID,
+		Name:        credential.Name,
+		Description: credential.Description,
+		UserID:      credential.UserID,
+		Username:    credential.User.Username,
+		SealedAt:    credential.SealedAt,
+		SealedByID:  credential.SealedByID,
+		LastUsedAt:  credential.LastUsedAt,
+		LastUsedIP:  credential.LastUsedIP,
+		IncidentID:  credential.IncidentID,
+		UnderReview: services.BreakGlassUnderReview(credential),
+		CreatedAt:   credential.CreatedAt,
+		UpdatedAt:   credential.UpdatedAt,
+	}
+}
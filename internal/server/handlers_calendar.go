@@ -0,0 +1,127 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// calendarFeedAuth lets feed requests carrying a valid signed token through
+// without other authentication, so calendar clients can subscribe; requests
+// without a token go through authorize
+func calendarFeedAuth(calendarService *services.CalendarService, kind string, authorize gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Query("token")
+		if token == "" {
+			authorize(c)
+			return
+		}
+
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil || calendarService.VerifyFeedToken(kind, id, token, time.Now()) != nil {
+			serviceErrorResponse(c, http.StatusUnauthorized, services.ErrInvalidFeedToken)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// handleUserCalendar handles GET /users/:id/activity.ics
+func handleUserCalendar(calendarService *services.CalendarService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+
+		calendarResponse(c, calendarService, "activity-"+userID.String(), func(from, to, now time.Time) (string, error) {
+			return calendarService.UserCalendar(userID, from, to, now)
+		})
+	}
+}
+
+// handleRoleCalendar handles GET /roles/:id/activity.ics, the feed of every
+// member of a role
+func handleRoleCalendar(calendarService *services.CalendarService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roleID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid role ID")
+			return
+		}
+
+		calendarResponse(c, calendarService, "team-activity-"+roleID.String(), func(from, to, now time.Time) (string, error) {
+			return calendarService.RoleCalendar(roleID, from, to, now)
+		})
+	}
+}
+
+// calendarResponse renders a feed for the request's from and to, by default
+// the service's default feed range
+func calendarResponse(c *gin.Context, calendarService *services.CalendarService, filename string, render func(from, to, now time.Time) (string, error)) {
+	now := time.Now()
+	from, to := calendarService.DefaultRange(now)
+	if toStr := c.Query("to"); toStr != "" {
+		t, err := parseReportTime(toStr, true)
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid to: "+err.Error())
+			return
+		}
+		to = t
+	}
+	if fromStr := c.Query("from"); fromStr != "" {
+		f, err := parseReportTime(fromStr, false)
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid from: "+err.Error())
+			return
+		}
+		from = f
+	}
+	if !to.After(from) {
+		errorResponse(c, http.StatusBadRequest, "'to' must be after 'from'")
+		return
+	}
+
+	feed, err := render(from, to, now)
+	if err != nil {
+		serviceErrorResponse(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.Header("Content-Disposition", "inline; filename="+filename+".ics")
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(feed))
+}
+
+// handleCreateUserCalendarFeed handles POST /users/:id/calendar-feed
+func handleCreateUserCalendarFeed(calendarService *services.CalendarService) gin.HandlerFunc {
+	return calendarFeedLinkHandler(calendarService, services.CalendarFeedUser, "Invalid user ID")
+}
+
+// handleCreateRoleCalendarFeed handles POST /roles/:id/calendar-feed
+func handleCreateRoleCalendarFeed(calendarService *services.CalendarService) gin.HandlerFunc {
+	return calendarFeedLinkHandler(calendarService, services.CalendarFeedRole, "Invalid role ID")
+}
+
+// calendarFeedLinkHandler returns a signed subscription link to a feed
+func calendarFeedLinkHandler(calendarService *services.CalendarService, kind, invalidID string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, invalidID)
+			return
+		}
+
+		link, err := calendarService.FeedLink(kind, id, time.Now())
+		if err != nil {
+			serviceErrorResponse(c, http.StatusBadRequest, err)
+			return
+		}
+
+		createdResponse(c, link)
+	}
+}
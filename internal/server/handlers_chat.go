@@ -0,0 +1,455 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Chat integration handlers
+
+// handleListChatWorkspaces handles GET /chat-workspaces
+func handleListChatWorkspaces(chatService *services.ChatIntegrationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		workspaces, err := chatService.ListWorkspaces()
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		workspaceList := make([]chatWorkspaceBody, len(workspaces))
+		for i := range workspaces {
+			workspaceList[i] = chatWorkspaceResponse(&workspaces[i])
+		}
+
+		listResponse(c, workspaceList, int64(len(workspaceList)))
+	}
+}
+
+// createChatWorkspaceRequest is the body of POST /chat-workspaces
+type createChatWorkspaceRequest struct {
+	Name           string                         `json:"name" binding:"required"`
+	Provider       string                         `json:"provider" binding:"required" enum:"slack,teams"`
+	ExternalID     string                         `json:"external_id" binding:"required" doc:"Slack team ID or Teams (Azure AD) tenant ID"`
+	ClientID       string                         `json:"client_id" doc:"OAuth app client ID"`
+	ClientSecret   string                         `json:"client_secret" doc:"OAuth app client secret"`
+	SigningSecret  string                         `json:"signing_secret" doc:"Slack signing secret, or the Teams outgoing webhook security token"`
+	StatusMappings map[string]services.ChatStatus `json:"status_mappings" doc:"Status to set by action name"`
+	Active         *bool                          `json:"active"`
+	Nonce          string                         `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleCreateChatWorkspace handles POST /chat-workspaces
+func handleCreateChatWorkspace(chatService *services.ChatIntegrationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req createChatWorkspaceRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		workspace := &database.ChatWorkspace{
+			Name:          req.Name,
+			Provider:      req.Provider,
+			ExternalID:    req.ExternalID,
+			ClientID:      req.ClientID,
+			ClientSecret:  req.ClientSecret,
+			SigningSecret: req.SigningSecret,
+			Active:        true,
+		}
+		if req.Active != nil {
+			workspace.Active = *req.Active
+		}
+
+		workspace, err := chatService.CreateWorkspace(workspace, req.StatusMappings)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusBadRequest, err)
+			return
+		}
+
+		createdResponse(c, chatWorkspaceResponse(workspace))
+	}
+}
+
+// handleGetChatWorkspace handles GET /chat-workspaces/:id
+func handleGetChatWorkspace(chatService *services.ChatIntegrationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		workspaceID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid chat workspace ID")
+			return
+		}
+
+		workspace, err := chatService.GetWorkspaceByID(workspaceID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, chatWorkspaceResponse(workspace))
+	}
+}
+
+// updateChatWorkspaceRequest is the body of PUT /chat-workspaces/:id
+type updateChatWorkspaceRequest struct {
+	Name           *string                        `json:"name"`
+	Provider       *string                        `json:"provider" enum:"slack,teams"`
+	ExternalID     *string                        `json:"external_id"`
+	ClientID       *string                        `json:"client_id"`
+	ClientSecret   *string                        `json:"client_secret"`
+	SigningSecret  *string                        `json:"signing_secret"`
+	StatusMappings map[string]services.ChatStatus `json:"status_mappings" doc:"Replaces the status mappings when present"`
+	Active         *bool                          `json:"active"`
+	Nonce          string                         `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleUpdateChatWorkspace handles PUT /chat-workspaces/:id
+func handleUpdateChatWorkspace(chatService *services.ChatIntegrationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		workspaceID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid chat workspace ID")
+			return
+		}
+
+		var req updateChatWorkspaceRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		// Build updates map
+		updates := make(map[string]interface{})
+		if req.Name != nil {
+			updates["name"] = *req.Name
+		}
+		if req.Provider != nil {
+			updates["provider"] = *req.Provider
+		}
+		if req.ExternalID != nil {
+			updates["external_id"] = *req.ExternalID
+		}
+		if req.ClientID != nil {
+			updates["client_id"] = *req.ClientID
+		}
+		if req.ClientSecret != nil {
+			updates["client_secret"] = *req.ClientSecret
+		}
+		if req.SigningSecret != nil {
+			updates["signing_secret"] = *req.SigningSecret
+		}
+		if req.Active != nil {
+			updates["active"] = *req.Active
+		}
+
+		workspace, err := chatService.UpdateWorkspace(workspaceID, updates, req.StatusMappings)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusBadRequest, err)
+			return
+		}
+
+		itemResponse(c, chatWorkspaceResponse(workspace))
+	}
+}
+
+// handleDeleteChatWorkspace handles DELETE /chat-workspaces/:id
+func handleDeleteChatWorkspace(chatService *services.ChatIntegrationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		workspaceID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid chat workspace ID")
+			return
+		}
+
+		if err := chatService.DeleteWorkspace(workspaceID); err != nil {
+			serviceErrorResponse(c, http.StatusBadRequest, err)
+			return
+		}
+
+		deletedResponse(c)
+	}
+}
+
+// handleListChatUserLinks handles GET /chat-workspaces/:id/users
+func handleListChatUserLinks(chatService *services.ChatIntegrationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		workspaceID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid chat workspace ID")
+			return
+		}
+
+		links, err := chatService.ListLinks(workspaceID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		linkList := make([]chatUserLinkBody, len(links))
+		for i := range links {
+			linkList[i] = chatUserLinkResponse(&links[i])
+		}
+
+		listResponse(c, linkList, int64(len(linkList)))
+	}
+}
+
+// linkChatUserRequest is the body of PUT /chat-workspaces/:id/users/:user_id
+type linkChatUserRequest struct {
+	ExternalUserID string `json:"external_user_id" binding:"required" doc:"Slack user ID or Teams (Azure AD) object ID"`
+	AccessToken    string `json:"access_token" doc:"Slack user token; Teams uses the app's credentials"`
+	Nonce          string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleLinkChatUser handles PUT /chat-workspaces/:id/users/:user_id. Slack
+// users are usually linked through /slack/authorize instead, which also
+// obtains the token needed to set their status.
+func handleLinkChatUser(chatService *services.ChatIntegrationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		workspaceID, userID, ok := parseChatUserLinkParams(c)
+		if !ok {
+			return
+		}
+
+		var req linkChatUserRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		link, err := chatService.LinkUser(workspaceID, userID, req.ExternalUserID, req.AccessToken)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusBadRequest, err)
+			return
+		}
+
+		itemResponse(c, chatUserLinkResponse(link))
+	}
+}
+
+// handleUnlinkChatUser handles DELETE /chat-workspaces/:id/users/:user_id
+func handleUnlinkChatUser(chatService *services.ChatIntegrationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		workspaceID, userID, ok := parseChatUserLinkParams(c)
+		if !ok {
+			return
+		}
+
+		if err := chatService.UnlinkUser(workspaceID, userID); err != nil {
+			serviceErrorResponse(c, http.StatusBadRequest, err)
+			return
+		}
+
+		deletedResponse(c)
+	}
+}
+
+// slackAuthorizeURLBody is the link a user opens to connect their Slack account
+type slackAuthorizeURLBody struct {
+	URL string `json:"url"`
+}
+
+// handleSlackAuthorizeURL handles GET /chat-workspaces/:id/slack/authorize,
+// the link a user opens to connect their Slack account
+func handleSlackAuthorizeURL(chatService *services.ChatIntegrationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		workspaceID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid chat workspace ID")
+			return
+		}
+		userID, err := uuid.Parse(c.Query("user_id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid user_id")
+			return
+		}
+
+		authorizeURL, err := chatService.SlackAuthorizeURL(workspaceID, userID, time.Now())
+		if err != nil {
+			serviceErrorResponse(c, http.StatusBadRequest, err)
+			return
+		}
+
+		itemResponse(c, slackAuthorizeURLBody{URL: authorizeURL})
+	}
+}
+
+// handleSlackOAuthCallback handles GET /integrations/slack/oauth/callback,
+// where Slack sends users back after they authorize YubiApp
+func handleSlackOAuthCallback(chatService *services.ChatIntegrationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if denied := c.Query("error"); denied != "" {
+			errorResponse(c, http.StatusBadRequest, "Slack authorization was not granted: "+denied)
+			return
+		}
+
+		link, err := chatService.CompleteSlackOAuth(c.Query("code"), c.Query("state"), time.Now())
+		if err != nil {
+			serviceErrorResponse(c, http.StatusBadRequest, err)
+			return
+		}
+
+		successResponse(c, chatUserLinkResponse(link))
+	}
+}
+
+// slackCommandReplyBody is the reply to a Slack slash command
+type slackCommandReplyBody struct {
+	ResponseType string `json:"response_type" enum:"ephemeral"`
+	Text         string `json:"text"`
+}
+
+// handleSlackCommand handles POST /integrations/slack/commands, the /yubiapp
+// slash command. Slack signs the raw form body, so it is read before parsing.
+func handleSlackCommand(chatService *services.ChatIntegrationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := c.GetRawData()
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Failed to read request body")
+			return
+		}
+
+		reply, err := chatService.HandleSlackCommand(body, c.GetHeader("X-Slack-Request-Timestamp"), c.GetHeader("X-Slack-Signature"), time.Now())
+		if err != nil {
+			chatCommandErrorResponse(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, slackCommandReplyBody{ResponseType: "ephemeral", Text: reply})
+	}
+}
+
+// teamsCommandReplyBody is the reply to a Teams outgoing webhook
+type teamsCommandReplyBody struct {
+	Type string `json:"type" enum:"message"`
+	Text string `json:"text"`
+}
+
+// handleTeamsCommand handles POST /integrations/teams/commands/:workspace_id,
+// the Teams outgoing webhook of a workspace
+func handleTeamsCommand(chatService *services.ChatIntegrationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		workspaceID, err := uuid.Parse(c.Param("workspace_id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid chat workspace ID")
+			return
+		}
+		body, err := c.GetRawData()
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Failed to read request body")
+			return
+		}
+
+		reply, err := chatService.HandleTeamsCommand(workspaceID, body, c.GetHeader("Authorization"), time.Now())
+		if err != nil {
+			chatCommandErrorResponse(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, teamsCommandReplyBody{Type: "message", Text: reply})
+	}
+}
+
+// chatCommandErrorResponse responds 401 to requests that fail signature
+// verification and with the error's own status otherwise
+func chatCommandErrorResponse(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrInvalidChatRequest) {
+		errorResponse(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+	serviceErrorResponse(c, http.StatusInternalServerError, err)
+}
+
+// parseChatUserLinkParams parses the workspace and user IDs of a link route,
+// responding with an error when either is invalid
+func parseChatUserLinkParams(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	workspaceID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, "Invalid chat workspace ID")
+		return uuid.Nil, uuid.Nil, false
+	}
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, "Invalid user ID")
+		return uuid.Nil, uuid.Nil, false
+	}
+	return workspaceID, userID, true
+}
+
+// chatWorkspaceBody is the API representation of a chat workspace
+type chatWorkspaceBody struct {
+	ID             uuid.UUID                      `json:"id"`
+	Name           string                         `json:"name"`
+	Provider       string                         `json:"provider" enum:"slack,teams"`
+	ExternalID     string                         `json:"external_id" doc:"The Slack team ID or the Teams tenant ID"`
+	ClientID       string                         `json:"client_id"`
+	HasSecret      bool                           `json:"has_secret" doc:"The OAuth client secret is set"`
+	Signed         bool                           `json:"signed" doc:"The Slack signing secret or Teams outgoing webhook security token is set"`
+	StatusMappings map[string]services.ChatStatus `json:"status_mappings" doc:"Statuses by the name of the action that sets them"`
+	Active         bool                           `json:"active"`
+	CreatedAt      time.Time                      `json:"created_at"`
+	UpdatedAt      time.Time                      `json:"updated_at"`
+}
+
+// chatWorkspaceResponse formats a chat workspace for API responses; secrets are
+// reported only as being set
+func chatWorkspaceResponse(workspace *database.ChatWorkspace) chatWorkspaceBody {
+	return chatWorkspaceBody{
+		ID:             workspace.ID,
+		Name:           workspace.Name,
+		Provider:       workspace.Provider,
+		ExternalID:     workspace.ExternalID,
+		ClientID:       workspace.ClientID,
+		HasSecret:      workspace.ClientSecret != "",
+		Signed:         workspace.SigningSecret != "",
+		StatusMappings: services.ChatStatusMappings(workspace),
+		Active:         workspace.Active,
+		CreatedAt:      workspace.CreatedAt,
+		UpdatedAt:      workspace.UpdatedAt,
+	}
+}
+
+// chatUserLinkBody is the API representation of a user's chat account link
+type chatUserLinkBody struct {
+	WorkspaceID    uuid.UUID  `json:"workspace_id"`
+	UserID         uuid.UUID  `json:"user_id"`
+	Username       string     `json:"username"`
+	ExternalUserID string     `json:"external_user_id" doc:"The Slack user ID or the user's Entra ID object ID"`
+	Authorized     bool       `json:"authorized" doc:"A Slack user token is stored"`
+	LastStatusAt   *time.Time `json:"last_status_at" doc:"Last status update, successful or not"`
+	LastError      string     `json:"last_error" doc:"Error of the last status update, if it failed"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// chatUserLinkResponse formats a user's chat account link for API responses
+func chatUserLinkResponse(link *database.ChatUserLink) chatUserLinkBody {
+	return chatUserLinkBody{
+		WorkspaceID:    link.WorkspaceID,
+		UserID:         link.UserID,
+		Username:       link.User.Username,
+		ExternalUserID: link.ExternalUserID,
+		Authorized:     link.AccessToken != "",
+		LastStatusAt:   link.LastStatusAt,
+		LastError:      link.LastError,
+		CreatedAt:      link.CreatedAt,
+		UpdatedAt:      link.UpdatedAt,
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// deviceAnalyticsDefault is the usage range when no from is given
+const deviceAnalyticsDefault = 30 * 24 * time.Hour
+
+// handleDeviceAnalytics handles GET /devices/analytics. Usage counts and
+// failure rates cover from to to, by default the 30 days up to now; last use
+// and unused devices are as of now.
+func handleDeviceAnalytics(analyticsService *services.DeviceAnalyticsService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		now := time.Now()
+		filter := services.DeviceAnalyticsFilter{
+			Type: c.Query("type"),
+			To:   now,
+		}
+
+		if toStr := c.Query("to"); toStr != "" {
+			to, err := parseReportTime(toStr, true)
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Invalid to: "+err.Error())
+				return
+			}
+			filter.To = to
+		}
+		filter.From = filter.To.Add(-deviceAnalyticsDefault)
+		if fromStr := c.Query("from"); fromStr != "" {
+			from, err := parseReportTime(fromStr, false)
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Invalid from: "+err.Error())
+				return
+			}
+			filter.From = from
+		}
+		if !filter.To.After(filter.From) {
+			errorResponse(c, http.StatusBadRequest, "'to' must be after 'from'")
+			return
+		}
+		if daysStr := c.Query("unused_days"); daysStr != "" {
+			days, err := strconv.Atoi(daysStr)
+			if err != nil || days < 1 {
+				errorResponse(c, http.StatusBadRequest, "Invalid unused_days: must be a positive number of days")
+				return
+			}
+			filter.UnusedDays = days
+		}
+
+		report, err := analyticsService.GetAnalytics(filter, now)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, report)
+	}
+}
+
+// handleOTPReplayCounts handles GET /devices/otp-replays: the replayed OTPs
+// the replay cache has caught per device, most first
+func handleOTPReplayCounts(replayCache *services.OTPReplayCache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		counts, err := replayCache.ReplayCounts(c.Request.Context())
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		listResponse(c, counts, int64(len(counts)))
+	}
+}
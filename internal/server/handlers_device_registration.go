@@ -1,7 +1,9 @@
 package server
 
 import (
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/YubiApp/internal/database"
 	"github.com/YubiApp/internal/services"
@@ -9,6 +11,21 @@ import (
 	"github.com/google/uuid"
 )
 
+// registerDeviceRequest is the body of POST /devices/register
+type registerDeviceRequest struct {
+	TargetUserID     string `json:"target_user_id" binding:"required" doc:"UUID or email of the target user"`
+	DeviceIdentifier string `json:"device_identifier" binding:"required" doc:"Device identifier, e.g. the YubiKey public ID"`
+	DeviceType       string `json:"device_type" binding:"required" enum:"yubikey,totp,sms,email,push"`
+	Role             string `json:"role" enum:"primary,backup" doc:"Defaults to primary when the user has no active primary device, otherwise backup"`
+	Notes            string `json:"notes"`
+
+	Attestation             string `json:"attestation" doc:"PEM attestation certificate of a PIV key generated on the YubiKey (ykman piv keys attest). It is verified against the Yubico roots in yubikey.attestation.ca_file, and the attested serial number, firmware version and form factor are recorded on the device. Required for yubikeys when yubikey.attestation.required is set."`
+	AttestationIntermediate string `json:"attestation_intermediate" doc:"PEM attestation certificate from slot f9 that signed it (ykman piv certificates export f9)"`
+
+	PushPlatform string `json:"push_platform" enum:"fcm,apns" doc:"The mobile app's push platform; required for push devices"`
+	PushToken    string `json:"push_token" doc:"The app's FCM or APNs registration token; required for push devices"`
+}
+
 // handleRegisterDevice handles POST /devices/register
 func handleRegisterDevice(authService *services.AuthService, deviceRegService *services.DeviceRegistrationService) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -29,27 +46,22 @@ func handleRegisterDevice(authService *services.AuthService, deviceRegService *s
 		}
 
 		// Authenticate the registrar using the device code
-		registrarUser, _, err := authService.AuthenticateDevice("yubikey", deviceCode, "yubiapp:register-other")
+		registrarUser, _, err := authService.AuthenticateDeviceContext(c.Request.Context(), "yubikey", deviceCode, "yubiapp:register-other")
 		if err != nil {
-			errorResponse(c, http.StatusUnauthorized, "Authentication failed: "+err.Error())
+			serviceErrorResponse(c, http.StatusUnauthorized, fmt.Errorf("Authentication failed: %w", err))
 			return
 		}
 
 		// Parse request body
-		var req struct {
-			TargetUserID     string `json:"target_user_id" binding:"required"`
-			DeviceIdentifier string `json:"device_identifier" binding:"required"`
-			DeviceType       string `json:"device_type" binding:"required"`
-			Notes            string `json:"notes"`
-		}
+		var req registerDeviceRequest
 
 		if err := c.ShouldBindJSON(&req); err != nil {
-			errorResponse(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			bindErrorResponse(c, err)
 			return
 		}
 
 		// Validate device type
-		validTypes := []string{"yubikey", "totp", "sms", "email"}
+		validTypes := []string{"yubikey", "totp", "sms", "email", "push"}
 		validType := false
 		for _, t := range validTypes {
 			if req.DeviceType == t {
@@ -58,7 +70,7 @@ func handleRegisterDevice(authService *services.AuthService, deviceRegService *s
 			}
 		}
 		if !validType {
-			errorResponse(c, http.StatusBadRequest, "Invalid device type. Must be one of: yubikey, totp, sms, email")
+			errorResponse(c, http.StatusBadRequest, "Invalid device type. Must be one of: yubikey, totp, sms, email, push")
 			return
 		}
 
@@ -74,40 +86,59 @@ func handleRegisterDevice(authService *services.AuthService, deviceRegService *s
 			targetUserID = targetUser.ID
 		}
 
+		var attestation *services.DeviceAttestation
+		if req.Attestation != "" {
+			attestation = &services.DeviceAttestation{
+				Certificate:  req.Attestation,
+				Intermediate: req.AttestationIntermediate,
+			}
+		}
+		var push *services.PushRegistration
+		if req.PushPlatform != "" || req.PushToken != "" {
+			push = &services.PushRegistration{Platform: req.PushPlatform, Token: req.PushToken}
+		}
+
 		// Register device
 		registration, err := deviceRegService.RegisterDevice(
 			registrarUser.ID,
 			targetUserID,
 			req.DeviceIdentifier,
 			req.DeviceType,
+			req.Role,
+			attestation,
+			push,
 			req.Notes,
 			c.ClientIP(),
 			c.GetHeader("User-Agent"),
 		)
 		if err != nil {
-			errorResponse(c, http.StatusBadRequest, "Failed to register device: "+err.Error())
+			serviceErrorResponse(c, http.StatusBadRequest, fmt.Errorf("Failed to register device: %w", err))
 			return
 		}
 
 		// Return success response
-		successResponse(c, gin.H{
-			"success": true,
-			"message": "Device registered successfully",
-			"registration": gin.H{
-				"id":        registration.ID,
-				"device_id": registration.DeviceID,
-				"registrar": gin.H{
-					"id":    registrarUser.ID,
-					"email": registrarUser.Email,
-				},
-				"target_user_id": targetUserID,
-				"action_type":    registration.ActionType,
-				"created_at":     registration.CreatedAt,
+		successResponse(c, deviceRegisteredBody{
+			Success: true,
+			Message: "Device registered successfully",
+			Registration: deviceRegistrationSummaryBody{
+				ID:           registration.ID,
+				DeviceID:     registration.DeviceID,
+				Registrar:    userRefBody{ID: registrarUser.ID, Email: registrarUser.Email},
+				TargetUserID: &targetUserID,
+				ActionType:   registration.ActionType,
+				CreatedAt:    registration.CreatedAt,
 			},
+			Attestation: attestationResponse(&registration.Device),
 		})
 	}
 }
 
+// deregisterDeviceRequest is the body of POST /devices/deregister/:device_id
+type deregisterDeviceRequest struct {
+	Reason string `json:"reason" binding:"required" enum:"user_left,device_lost,device_transfer,administrative"`
+	Notes  string `json:"notes"`
+}
+
 // handleDeregisterDevice handles DELETE /devices/{device_id}/deregister
 func handleDeregisterDevice(authService *services.AuthService, deviceRegService *services.DeviceRegistrationService) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -136,20 +167,17 @@ func handleDeregisterDevice(authService *services.AuthService, deviceRegService
 		}
 
 		// Authenticate the deregistrar using the device code
-		registrarUser, _, err := authService.AuthenticateDevice("yubikey", deviceCode, "yubiapp:deregister-other")
+		registrarUser, _, err := authService.AuthenticateDeviceContext(c.Request.Context(), "yubikey", deviceCode, "yubiapp:deregister-other")
 		if err != nil {
-			errorResponse(c, http.StatusUnauthorized, "Authentication failed: "+err.Error())
+			serviceErrorResponse(c, http.StatusUnauthorized, fmt.Errorf("Authentication failed: %w", err))
 			return
 		}
 
 		// Parse request body
-		var req struct {
-			Reason string `json:"reason" binding:"required"`
-			Notes  string `json:"notes"`
-		}
+		var req deregisterDeviceRequest
 
 		if err := c.ShouldBindJSON(&req); err != nil {
-			errorResponse(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			bindErrorResponse(c, err)
 			return
 		}
 
@@ -177,29 +205,32 @@ func handleDeregisterDevice(authService *services.AuthService, deviceRegService
 			c.GetHeader("User-Agent"),
 		)
 		if err != nil {
-			errorResponse(c, http.StatusBadRequest, "Failed to deregister device: "+err.Error())
+			serviceErrorResponse(c, http.StatusBadRequest, fmt.Errorf("Failed to deregister device: %w", err))
 			return
 		}
 
 		// Return success response
-		successResponse(c, gin.H{
-			"success": true,
-			"message": "Device deregistered successfully",
-			"deregistration": gin.H{
-				"id":        registration.ID,
-				"device_id": registration.DeviceID,
-				"registrar": gin.H{
-					"id":    registrarUser.ID,
-					"email": registrarUser.Email,
-				},
-				"action_type": registration.ActionType,
-				"reason":      registration.Reason,
-				"created_at":  registration.CreatedAt,
+		successResponse(c, deviceDeregisteredBody{
+			Success: true,
+			Message: "Device deregistered successfully",
+			Deregistration: deviceRegistrationSummaryBody{
+				ID:         registration.ID,
+				DeviceID:   registration.DeviceID,
+				Registrar:  userRefBody{ID: registrarUser.ID, Email: registrarUser.Email},
+				ActionType: registration.ActionType,
+				Reason:     registration.Reason,
+				CreatedAt:  registration.CreatedAt,
 			},
 		})
 	}
 }
 
+// transferDeviceRequest is the body of POST /devices/transfer/:device_id
+type transferDeviceRequest struct {
+	TargetUserID string `json:"target_user_id" binding:"required" doc:"UUID or email of the target user"`
+	Notes        string `json:"notes"`
+}
+
 // handleTransferDevice handles POST /devices/{device_id}/transfer
 func handleTransferDevice(authService *services.AuthService, deviceRegService *services.DeviceRegistrationService) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -229,9 +260,9 @@ func handleTransferDevice(authService *services.AuthService, deviceRegService *s
 
 		// Authenticate the transferrer using the device code
 		// Note: Transfer requires both register-other and deregister-other permissions
-		registrarUser, _, err := authService.AuthenticateDevice("yubikey", deviceCode, "yubiapp:register-other")
+		registrarUser, _, err := authService.AuthenticateDeviceContext(c.Request.Context(), "yubikey", deviceCode, "yubiapp:register-other")
 		if err != nil {
-			errorResponse(c, http.StatusUnauthorized, "Authentication failed: "+err.Error())
+			serviceErrorResponse(c, http.StatusUnauthorized, fmt.Errorf("Authentication failed: %w", err))
 			return
 		}
 
@@ -247,13 +278,10 @@ func handleTransferDevice(authService *services.AuthService, deviceRegService *s
 		}
 
 		// Parse request body
-		var req struct {
-			TargetUserID string `json:"target_user_id" binding:"required"`
-			Notes        string `json:"notes"`
-		}
+		var req transferDeviceRequest
 
 		if err := c.ShouldBindJSON(&req); err != nil {
-			errorResponse(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			bindErrorResponse(c, err)
 			return
 		}
 
@@ -279,24 +307,21 @@ func handleTransferDevice(authService *services.AuthService, deviceRegService *s
 			c.GetHeader("User-Agent"),
 		)
 		if err != nil {
-			errorResponse(c, http.StatusBadRequest, "Failed to transfer device: "+err.Error())
+			serviceErrorResponse(c, http.StatusBadRequest, fmt.Errorf("Failed to transfer device: %w", err))
 			return
 		}
 
 		// Return success response
-		successResponse(c, gin.H{
-			"success": true,
-			"message": "Device transferred successfully",
-			"transfer": gin.H{
-				"id":        registration.ID,
-				"device_id": registration.DeviceID,
-				"registrar": gin.H{
-					"id":    registrarUser.ID,
-					"email": registrarUser.Email,
-				},
-				"target_user_id": targetUserID,
-				"action_type":    registration.ActionType,
-				"created_at":     registration.CreatedAt,
+		successResponse(c, deviceTransferredBody{
+			Success: true,
+			Message: "Device transferred successfully",
+			Transfer: deviceRegistrationSummaryBody{
+				ID:           registration.ID,
+				DeviceID:     registration.DeviceID,
+				Registrar:    userRefBody{ID: registrarUser.ID, Email: registrarUser.Email},
+				TargetUserID: &targetUserID,
+				ActionType:   registration.ActionType,
+				CreatedAt:    registration.CreatedAt,
 			},
 		})
 	}
@@ -330,9 +355,9 @@ func handleGetDeviceHistory(authService *services.AuthService, deviceRegService
 		}
 
 		// Authenticate the user (any authenticated user can view device history)
-		_, _, err = authService.AuthenticateDevice("yubikey", deviceCode, "")
+		_, _, err = authService.AuthenticateDeviceContext(c.Request.Context(), "yubikey", deviceCode, "")
 		if err != nil {
-			errorResponse(c, http.StatusUnauthorized, "Authentication failed: "+err.Error())
+			serviceErrorResponse(c, http.StatusUnauthorized, fmt.Errorf("Authentication failed: %w", err))
 			return
 		}
 
@@ -344,35 +369,121 @@ func handleGetDeviceHistory(authService *services.AuthService, deviceRegService
 		}
 
 		// Convert to response format
-		historyList := make([]gin.H, len(history))
-		for i, reg := range history {
-			historyList[i] = gin.H{
-				"id":          reg.ID,
-				"action_type": reg.ActionType,
-				"registrar": gin.H{
-					"id":    reg.RegistrarUser.ID,
-					"email": reg.RegistrarUser.Email,
-				},
-				"target_user": func() gin.H {
-					if reg.TargetUserID != nil && reg.TargetUser != nil {
-						return gin.H{
-							"id":    reg.TargetUser.ID,
-							"email": reg.TargetUser.Email,
-						}
-					}
-					return gin.H{"id": nil, "email": nil}
-				}(),
-				"reason":     reg.Reason,
-				"notes":      reg.Notes,
-				"ip_address": reg.IPAddress,
-				"created_at": reg.CreatedAt,
-			}
+		historyList := make([]deviceRegistrationBody, len(history))
+		for i := range history {
+			historyList[i] = deviceRegistrationResponse(&history[i])
 		}
 
 		// Return success response
-		successResponse(c, gin.H{
-			"device_id": deviceID,
-			"history":   historyList,
-		})
+		successResponse(c, deviceHistoryBody{DeviceID: deviceID, History: historyList})
+	}
+}
+
+// userRefBody identifies a user in device registration records
+type userRefBody struct {
+	ID    uuid.UUID `json:"id"`
+	Email string    `json:"email"`
+}
+
+// deviceRegistrationSummaryBody is the registration record a registration,
+// deregistration or transfer wrote
+type deviceRegistrationSummaryBody struct {
+	ID           uuid.UUID   `json:"id"`
+	DeviceID     uuid.UUID   `json:"device_id"`
+	Registrar    userRefBody `json:"registrar"`
+	TargetUserID *uuid.UUID  `json:"target_user_id,omitempty"`
+	ActionType   string      `json:"action_type" enum:"register,deregister,state_change"`
+	Reason       string      `json:"reason,omitempty"`
+	CreatedAt    time.Time   `json:"created_at"`
+}
+
+// deviceRegisteredBody is the body of POST /devices/register
+type deviceRegisteredBody struct {
+	Success      bool                          `json:"success"`
+	Message      string                        `json:"message"`
+	Registration deviceRegistrationSummaryBody `json:"registration"`
+	Attestation  *deviceAttestationBody        `json:"attestation" doc:"What the attestation recorded on the device; null without one"`
+}
+
+// deviceDeregisteredBody is the body of POST /devices/deregister/:device_id
+type deviceDeregisteredBody struct {
+	Success        bool                          `json:"success"`
+	Message        string                        `json:"message"`
+	Deregistration deviceRegistrationSummaryBody `json:"deregistration"`
+}
+
+// deviceTransferredBody is the body of POST /devices/transfer/:device_id
+type deviceTransferredBody struct {
+	Success  bool                          `json:"success"`
+	Message  string                        `json:"message"`
+	Transfer deviceRegistrationSummaryBody `json:"transfer"`
+}
+
+// deviceHistoryBody is the body of GET /devices/history/:device_id
+type deviceHistoryBody struct {
+	DeviceID uuid.UUID                `json:"device_id"`
+	History  []deviceRegistrationBody `json:"history"`
+}
+
+// targetUserBody is the user a device was registered or transferred to; its
+// fields are null for deregistrations and state changes
+type targetUserBody struct {
+	ID    *uuid.UUID `json:"id"`
+	Email *string    `json:"email"`
+}
+
+// deviceRegistrationBody is the API representation of a device history record
+type deviceRegistrationBody struct {
+	ID         uuid.UUID      `json:"id"`
+	DeviceID   uuid.UUID      `json:"device_id"`
+	ActionType string         `json:"action_type" enum:"register,deregister,state_change"`
+	Registrar  userRefBody    `json:"registrar"`
+	TargetUser targetUserBody `json:"target_user"`
+	State      string         `json:"state" doc:"New lifecycle state, for state_change"`
+	Reason     string         `json:"reason"`
+	Notes      string         `json:"notes"`
+	IPAddress  string         `json:"ip_address"`
+	CreatedAt  time.Time      `json:"created_at"`
+}
+
+// deviceRegistrationResponse is the API representation of a device history record
+func deviceRegistrationResponse(reg *database.DeviceRegistration) deviceRegistrationBody {
+	var targetUser targetUserBody
+	if reg.TargetUserID != nil && reg.TargetUser != nil {
+		targetUser = targetUserBody{ID: &reg.TargetUser.ID, Email: &reg.TargetUser.Email}
+	}
+	return deviceRegistrationBody{
+		ID:         reg.ID,
+		DeviceID:   reg.DeviceID,
+		ActionType: reg.ActionType,
+		Registrar:  userRefBody{ID: reg.RegistrarUser.ID, Email: reg.RegistrarUser.Email},
+		TargetUser: targetUser,
+		State:      reg.State,
+		Reason:     reg.Reason,
+		Notes:      reg.Notes,
+		IPAddress:  reg.IPAddress,
+		CreatedAt:  reg.CreatedAt,
+	}
+}
+
+// deviceAttestationBody is what a verified attestation recorded on a device
+type deviceAttestationBody struct {
+	SerialNumber    string     `json:"serial_number"`
+	FirmwareVersion string     `json:"firmware_version"`
+	FormFactor      string     `json:"form_factor"`
+	AttestedAt      *time.Time `json:"attested_at"`
+}
+
+// attestationResponse describes what a verified attestation recorded on a
+// device, or is nil when the device was not attested
+func attestationResponse(device *database.Device) *deviceAttestationBody {
+	if device.AttestedAt == nil {
+		return nil
+	}
+	return &deviceAttestationBody{
+		SerialNumber:    device.SerialNumber,
+		FirmwareVersion: device.FirmwareVersion,
+		FormFactor:      device.FormFactor,
+		AttestedAt:      device.AttestedAt,
 	}
 }
@@ -1,7 +1,10 @@
 package server
 
 import (
+	"io"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/YubiApp/internal/services"
 	"github.com/YubiApp/internal/database"
@@ -11,19 +14,31 @@ import (
 
 // Device API handlers
 
+// createDeviceRequest is the body of POST /devices
+type createDeviceRequest struct {
+	UserID     string `json:"user_id" binding:"required" format:"uuid"`
+	Type       string `json:"type" binding:"required"`
+	Identifier string `json:"identifier" binding:"required"`
+	Secret     string `json:"secret"`
+	Active     bool   `json:"active"`
+
+	FirmwareVersion string `json:"firmware_version"`
+	FormFactor      string `json:"form_factor"`
+	AssetTag        string `json:"asset_tag"`
+	PurchaseOrder   string `json:"purchase_order"`
+	PurchasedAt     string `json:"purchased_at" format:"date"`
+	State           string `json:"state" enum:"in_stock,assigned" doc:"Defaults to assigned"`
+	Role            string `json:"role" enum:"primary,backup" doc:"Defaults to primary when the user has no active primary device, otherwise backup"`
+
+	Nonce string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
 func handleCreateDevice(deviceService *services.DeviceService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var req struct {
-			UserID     string `json:"user_id" binding:"required"`
-			Type       string `json:"type" binding:"required"`
-			Identifier string `json:"identifier" binding:"required"`
-			Secret     string `json:"secret"`
-			Active     bool   `json:"active"`
-			Nonce      string `json:"nonce"` // Optional nonce for response signing
-		}
+		var req createDeviceRequest
 
 		if err := c.ShouldBindJSON(&req); err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			bindErrorResponse(c, err)
 			return
 		}
 
@@ -36,21 +51,30 @@ func handleCreateDevice(deviceService *services.DeviceService) gin.HandlerFunc {
 			return
 		}
 
-		device, err := deviceService.CreateDevice(userID, req.Type, req.Identifier, req.Secret, req.Active)
+		inventory := services.DeviceInventory{
+			FirmwareVersion: req.FirmwareVersion,
+			FormFactor:      req.FormFactor,
+			AssetTag:        req.AssetTag,
+			PurchaseOrder:   req.PurchaseOrder,
+			State:           req.State,
+			Role:            req.Role,
+		}
+		if req.PurchasedAt != "" {
+			purchasedAt, err := time.Parse("2006-01-02", req.PurchasedAt)
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Invalid purchased_at: use YYYY-MM-DD")
+				return
+			}
+			inventory.PurchasedAt = &purchasedAt
+		}
+
+		device, err := deviceService.CreateDevice(userID, req.Type, req.Identifier, req.Secret, req.Active, inventory)
 		if err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		createdResponse(c, gin.H{
-			"id":         device.ID,
-			"user_id":    device.UserID,
-			"type":       device.Type,
-			"identifier": device.Identifier,
-			"active":     device.Active,
-			"verified_at": device.VerifiedAt,
-			"created_at": device.CreatedAt,
-		})
+		createdResponse(c, deviceResponse(device))
 	}
 }
 
@@ -64,25 +88,11 @@ func handleGetDevice(deviceService *services.DeviceService) gin.HandlerFunc {
 
 		device, err := deviceService.GetDeviceByID(deviceID)
 		if err != nil {
-			errorResponse(c, http.StatusNotFound, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		itemResponse(c, gin.H{
-			"id":         device.ID,
-			"user": gin.H{
-				"id":    device.User.ID,
-				"email": device.User.Email,
-				"username": device.User.Username,
-			},
-			"type":        device.Type,
-			"identifier":  device.Identifier,
-			"active":      device.Active,
-			"verified_at": device.VerifiedAt,
-			"last_used_at": device.LastUsedAt,
-			"created_at":  device.CreatedAt,
-			"updated_at":  device.UpdatedAt,
-		})
+		itemResponse(c, deviceResponse(device))
 	}
 }
 
@@ -91,6 +101,7 @@ func handleListDevices(deviceService *services.DeviceService) gin.HandlerFunc {
 		// Check if filtering by user ID
 		userIDParam := c.Query("user_id")
 		activeOnly := c.Query("active") == "true"
+		includeDeleted := c.Query("include_deleted") == "true"
 		var userID *uuid.UUID
 		if userIDParam != "" {
 			parsedUserID, err := uuid.Parse(userIDParam)
@@ -101,35 +112,24 @@ func handleListDevices(deviceService *services.DeviceService) gin.HandlerFunc {
 			userID = &parsedUserID
 		}
 
-		var devices []database.Device
-		var err error
-		if activeOnly {
-			devices, err = deviceService.ListActiveDevices(userID)
-		} else {
-			devices, err = deviceService.ListDevices(userID)
-		}
+		devices, err := deviceService.ListDevices(services.DeviceFilter{
+			UserID:         userID,
+			Role:           c.Query("role"),
+			State:          c.Query("state"),
+			ActiveOnly:     activeOnly,
+			IncludeDeleted: includeDeleted,
+		})
 		if err != nil {
-			errorResponse(c, http.StatusInternalServerError, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
 		// Build response
-		deviceList := make([]gin.H, len(devices))
-		for i, device := range devices {
-			deviceList[i] = gin.H{
-				"id":         device.ID,
-				"user": gin.H{
-					"id":    device.User.ID,
-					"email": device.User.Email,
-					"username": device.User.Username,
-				},
-				"type":        device.Type,
-				"identifier":  device.Identifier,
-				"active":      device.Active,
-				"verified_at": device.VerifiedAt,
-				"last_used_at": device.LastUsedAt,
-				"created_at":  device.CreatedAt,
-				"updated_at":  device.UpdatedAt,
+		deviceList := make([]deviceBody, len(devices))
+		for i := range devices {
+			deviceList[i] = deviceResponse(&devices[i])
+			if includeDeleted && devices[i].DeletedAt.Valid {
+				deviceList[i].DeletedAt = &devices[i].DeletedAt.Time
 			}
 		}
 
@@ -137,6 +137,24 @@ func handleListDevices(deviceService *services.DeviceService) gin.HandlerFunc {
 	}
 }
 
+// updateDeviceRequest is the body of PUT /devices/:id
+type updateDeviceRequest struct {
+	Type       *string `json:"type"`
+	Identifier *string `json:"identifier"`
+	Secret     *string `json:"secret"`
+	Active     *bool   `json:"active" doc:"Lost and retired devices cannot be activated"`
+
+	FirmwareVersion *string `json:"firmware_version"`
+	FormFactor      *string `json:"form_factor"`
+	AssetTag        *string `json:"asset_tag"`
+	PurchaseOrder   *string `json:"purchase_order"`
+	PurchasedAt     *string `json:"purchased_at" format:"date" doc:"An empty string clears it"`
+	Role            *string `json:"role" enum:"primary,backup"`
+
+	Version *int   `json:"version" doc:"Optional: the version the update is based on; a different current version is rejected with 409"`
+	Nonce   string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
 func handleUpdateDevice(deviceService *services.DeviceService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		deviceID, err := uuid.Parse(c.Param("id"))
@@ -145,16 +163,10 @@ func handleUpdateDevice(deviceService *services.DeviceService) gin.HandlerFunc {
 			return
 		}
 
-		var req struct {
-			Type       *string `json:"type"`
-			Identifier *string `json:"identifier"`
-			Secret     *string `json:"secret"`
-			Active     *bool   `json:"active"`
-			Nonce      string  `json:"nonce"` // Optional nonce for response signing
-		}
+		var req updateDeviceRequest
 
 		if err := c.ShouldBindJSON(&req); err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			bindErrorResponse(c, err)
 			return
 		}
 
@@ -175,28 +187,41 @@ func handleUpdateDevice(deviceService *services.DeviceService) gin.HandlerFunc {
 		if req.Active != nil {
 			updates["active"] = *req.Active
 		}
+		if req.FirmwareVersion != nil {
+			updates["firmware_version"] = *req.FirmwareVersion
+		}
+		if req.FormFactor != nil {
+			updates["form_factor"] = *req.FormFactor
+		}
+		if req.AssetTag != nil {
+			updates["asset_tag"] = *req.AssetTag
+		}
+		if req.PurchaseOrder != nil {
+			updates["purchase_order"] = *req.PurchaseOrder
+		}
+		if req.Role != nil {
+			updates["role"] = *req.Role
+		}
+		if req.PurchasedAt != nil {
+			if *req.PurchasedAt == "" {
+				updates["purchased_at"] = nil
+			} else {
+				purchasedAt, err := time.Parse("2006-01-02", *req.PurchasedAt)
+				if err != nil {
+					errorResponse(c, http.StatusBadRequest, "Invalid purchased_at: use YYYY-MM-DD")
+					return
+				}
+				updates["purchased_at"] = purchasedAt
+			}
+		}
 
-		device, err := deviceService.UpdateDevice(deviceID, updates)
+		device, err := deviceService.UpdateDevice(deviceID, req.Version, updates)
 		if err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		itemResponse(c, gin.H{
-			"id":         device.ID,
-			"user": gin.H{
-				"id":    device.User.ID,
-				"email": device.User.Email,
-				"username": device.User.Username,
-			},
-			"type":        device.Type,
-			"identifier":  device.Identifier,
-			"active":      device.Active,
-			"verified_at": device.VerifiedAt,
-			"last_used_at": device.LastUsedAt,
-			"created_at":  device.CreatedAt,
-			"updated_at":  device.UpdatedAt,
-		})
+		itemResponse(c, deviceResponse(device))
 	}
 }
 
@@ -210,10 +235,275 @@ func handleDeleteDevice(deviceService *services.DeviceService) gin.HandlerFunc {
 
 		err = deviceService.DeleteDevice(deviceID)
 		if err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
 		deletedResponse(c)
 	}
-} 
\ No newline at end of file
+} 
+
+// handleRestoreDevice handles POST /devices/:id/restore
+func handleRestoreDevice(deviceService *services.DeviceService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deviceID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid device ID")
+			return
+		}
+
+		device, err := deviceService.RestoreDevice(deviceID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, deviceResponse(device))
+	}
+}
+
+// transitionDeviceStateRequest is the body of POST /devices/:id/state
+type transitionDeviceStateRequest struct {
+	State  string `json:"state" binding:"required" enum:"in_stock,assigned,lost,retired"`
+	Reason string `json:"reason" binding:"required"`
+	Nonce  string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleTransitionDeviceState handles POST /devices/:id/state
+func handleTransitionDeviceState(deviceService *services.DeviceService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deviceID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid device ID")
+			return
+		}
+
+		var req transitionDeviceStateRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		requestedByID := c.MustGet("user_id").(uuid.UUID)
+		device, err := deviceService.TransitionDevice(deviceID, req.State, req.Reason, requestedByID, c.ClientIP(), c.GetHeader("User-Agent"))
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, deviceResponse(device))
+	}
+}
+
+// handleListUserDevices handles GET /users/:id/devices: the user's devices, the
+// registration history of their devices and warnings where they fall outside
+// the device role limits
+func handleListUserDevices(deviceService *services.DeviceService, deviceRegService *services.DeviceRegistrationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+
+		devices, err := deviceService.ListDevices(services.DeviceFilter{UserID: &userID})
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+		warnings, err := deviceService.DeviceWarnings(userID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		deviceList := make([]deviceBody, len(devices))
+		deviceIDs := make([]uuid.UUID, len(devices))
+		for i := range devices {
+			deviceList[i] = deviceResponse(&devices[i])
+			deviceIDs[i] = devices[i].ID
+		}
+
+		history, err := deviceRegService.GetUserDeviceHistory(userID, deviceIDs)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+		historyList := make([]deviceRegistrationBody, len(history))
+		for i := range history {
+			historyList[i] = deviceRegistrationResponse(&history[i])
+		}
+
+		successResponse(c, userDevicesBody{
+			Items:    deviceList,
+			Total:    len(deviceList),
+			History:  historyList,
+			Warnings: warnings,
+		})
+	}
+}
+
+// maxDeviceImportSize bounds an uploaded inventory file; a few thousand keys fit in well under 1 MB
+const maxDeviceImportSize = 5 << 20
+
+// importDevicesRequest is the body of POST /devices/import
+type importDevicesRequest struct {
+	CSV           string `json:"csv" form:"-" doc:"The inventory file"`
+	PurchaseOrder string `json:"purchase_order" form:"purchase_order" doc:"Used for rows without one"`
+	PurchasedAt   string `json:"purchased_at" form:"purchased_at" format:"date"`
+	DryRun        bool   `json:"dry_run" form:"dry_run"`
+	Nonce         string `json:"nonce" form:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleImportDevices handles POST /devices/import. The inventory CSV is
+// uploaded as the multipart field "file", or sent in a JSON body as "csv".
+func handleImportDevices(deviceService *services.DeviceService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxDeviceImportSize)
+
+		var req importDevicesRequest
+
+		var inventory io.Reader
+		if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+			if err := c.ShouldBind(&req); err != nil {
+				bindErrorResponse(c, err)
+				return
+			}
+			fileHeader, err := c.FormFile("file")
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Inventory file is required in the \"file\" field")
+				return
+			}
+			file, err := fileHeader.Open()
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Failed to read inventory file: "+err.Error())
+				return
+			}
+			defer file.Close()
+			inventory = file
+		} else {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				bindErrorResponse(c, err)
+				return
+			}
+			inventory = strings.NewReader(req.CSV)
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		options := services.DeviceImportOptions{PurchaseOrder: req.PurchaseOrder, DryRun: req.DryRun}
+		if req.PurchasedAt != "" {
+			purchasedAt, err := time.Parse("2006-01-02", req.PurchasedAt)
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Invalid purchased_at: use YYYY-MM-DD")
+				return
+			}
+			options.PurchasedAt = &purchasedAt
+		}
+
+		rows, err := services.ParseDeviceInventory(inventory)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		report, err := deviceService.ImportDevices(rows, options)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, report)
+	}
+}
+
+// deviceOwnerBody is the user a device is registered to
+type deviceOwnerBody struct {
+	ID       uuid.UUID `json:"id"`
+	Email    string    `json:"email"`
+	Username string    `json:"username"`
+}
+
+// deviceBody is the API representation of a device with its owner
+type deviceBody struct {
+	ID               uuid.UUID        `json:"id"`
+	User             *deviceOwnerBody `json:"user" doc:"Null for devices that are not registered to a user, e.g. devices in stock"`
+	Type             string           `json:"type"`
+	Identifier       string           `json:"identifier"`
+	PushPlatform     string           `json:"push_platform" enum:",fcm,apns" doc:"The mobile app's push platform, for push devices"`
+	Active           bool             `json:"active"`
+	Version          int              `json:"version" doc:"Incremented by every update; send it back with updates to reject them if someone else changed the record"`
+	VerifiedAt       time.Time        `json:"verified_at"`
+	LastUsedAt       time.Time        `json:"last_used_at"`
+	FirmwareVersion  string           `json:"firmware_version"`
+	FormFactor       string           `json:"form_factor" doc:"e.g. usb-a, usb-c, nano, nfc"`
+	AssetTag         string           `json:"asset_tag" doc:"Unique among devices that are not deleted"`
+	PurchaseOrder    string           `json:"purchase_order"`
+	PurchasedAt      *string          `json:"purchased_at" format:"date"`
+	AttestedAt       *time.Time       `json:"attested_at" doc:"When firmware_version and form_factor were last taken from a verified YubiKey attestation"`
+	CloneSuspectedAt *time.Time       `json:"clone_suspected_at" doc:"When an OTP counted below the device's last one, which deactivated it as possibly cloned; re-activating it clears this"`
+	Role             string           `json:"role" enum:"primary,backup" doc:"Active devices per role are limited by devices.primary and devices.backup in the config"`
+	State            string           `json:"state" enum:"in_stock,assigned,lost,retired" doc:"Lifecycle state; lost and retired devices are inactive"`
+	StateChangedAt   *time.Time       `json:"state_changed_at"`
+	CreatedAt        time.Time        `json:"created_at"`
+	UpdatedAt        time.Time        `json:"updated_at"`
+	DeletedAt        *time.Time       `json:"deleted_at,omitempty" doc:"Set on deleted devices, which are listed with include_deleted"`
+}
+
+// deviceResponse is the API representation of a device with its owner
+func deviceResponse(device *database.Device) deviceBody {
+	// Devices in stock have no user until they are registered
+	var user *deviceOwnerBody
+	if device.UserID != nil {
+		user = &deviceOwnerBody{
+			ID:       device.User.ID,
+			Email:    device.User.Email,
+			Username: device.User.Username,
+		}
+	}
+	state := device.State
+	if state == "" {
+		state = services.DeviceStateAssigned
+	}
+	var purchasedAt *string
+	if device.PurchasedAt != nil {
+		date := device.PurchasedAt.Format("2006-01-02")
+		purchasedAt = &date
+	}
+	return deviceBody{
+		ID:               device.ID,
+		User:             user,
+		Type:             device.Type,
+		Identifier:       device.Identifier,
+		PushPlatform:     device.PushPlatform,
+		Active:           device.Active,
+		Version:          device.Version,
+		VerifiedAt:       device.VerifiedAt,
+		LastUsedAt:       device.LastUsedAt,
+		FirmwareVersion:  device.FirmwareVersion,
+		FormFactor:       device.FormFactor,
+		AssetTag:         device.AssetTag,
+		PurchaseOrder:    device.PurchaseOrder,
+		PurchasedAt:      purchasedAt,
+		AttestedAt:       device.AttestedAt,
+		CloneSuspectedAt: device.CloneSuspectedAt,
+		Role:             device.Role,
+		State:            state,
+		StateChangedAt:   device.StateChangedAt,
+		CreatedAt:        device.CreatedAt,
+		UpdatedAt:        device.UpdatedAt,
+	}
+}
+
+// userDevicesBody is the body of GET /users/:id/devices
+type userDevicesBody struct {
+	Items    []deviceBody             `json:"items"`
+	Total    int                      `json:"total"`
+	History  []deviceRegistrationBody `json:"history" doc:"Registration history of the devices, newest first"`
+	Warnings []string                 `json:"warnings" doc:"Where the user's active devices fall outside the devices.primary and devices.backup limits, e.g. \"no active backup device\""`
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Door API handlers
+
+// doorBody is a resource of type door
+type doorBody struct {
+	ID         uuid.UUID `json:"id"`
+	Name       string    `json:"name"`
+	Location   string    `json:"location"`
+	Department string    `json:"department"`
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// handleListDoors handles GET /doors
+func handleListDoors(doorService *services.DoorService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		doors, err := doorService.ListDoors()
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		doorList := make([]doorBody, len(doors))
+		for i, door := range doors {
+			doorList[i] = doorBody{
+				ID:         door.ID,
+				Name:       door.Name,
+				Location:   door.Location,
+				Department: door.Department,
+				Active:     door.Active,
+				CreatedAt:  door.CreatedAt,
+				UpdatedAt:  door.UpdatedAt,
+			}
+		}
+
+		listResponse(c, doorList, int64(len(doorList)))
+	}
+}
+
+// handleListDoorEvents handles GET /doors/events and GET /doors/:id/events
+func handleListDoorEvents(doorService *services.DoorService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var doorID *uuid.UUID
+		if idStr := c.Param("id"); idStr != "" {
+			id, err := uuid.Parse(idStr)
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Invalid door ID")
+				return
+			}
+			if _, err := doorService.GetDoorByID(id); err != nil {
+				serviceErrorResponse(c, http.StatusInternalServerError, err)
+				return
+			}
+			doorID = &id
+		}
+
+		limit := 50
+		if limitStr := c.Query("limit"); limitStr != "" {
+			if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+				limit = l
+			}
+		}
+		offset := 0
+		if offsetStr := c.Query("offset"); offsetStr != "" {
+			if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+				offset = o
+			}
+		}
+
+		events, total, err := doorService.ListDoorEvents(doorID, limit, offset)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		eventList := make([]doorEventBody, len(events))
+		for i := range events {
+			eventList[i] = doorEventResponse(&events[i])
+		}
+
+		listResponse(c, eventList, total)
+	}
+}
+
+// doorEventBody is the API representation of a door access log entry
+type doorEventBody struct {
+	ID                  uuid.UUID  `json:"id"`
+	DoorID              uuid.UUID  `json:"door_id"`
+	Door                string     `json:"door" doc:"The door's name"`
+	UserID              *uuid.UUID `json:"user_id"`
+	Username            string     `json:"username"`
+	ActionID            *uuid.UUID `json:"action_id"`
+	AuthenticationLogID *uuid.UUID `json:"authentication_log_id"`
+	Result              string     `json:"result" enum:"unlocked,failed"`
+	Driver              string     `json:"driver"`
+	ControllerRef       string     `json:"controller_ref"`
+	Error               string     `json:"error"`
+	CreatedAt           time.Time  `json:"created_at"`
+}
+
+// doorEventResponse formats a door access log entry for API responses
+func doorEventResponse(event *database.DoorEvent) doorEventBody {
+	var username string
+	if event.User != nil {
+		username = event.User.Username
+	}
+	return doorEventBody{
+		ID:                  event.ID,
+		DoorID:              event.ResourceID,
+		Door:                event.Resource.Name,
+		UserID:              event.UserID,
+		Username:            username,
+		ActionID:            event.ActionID,
+		AuthenticationLogID: event.AuthenticationLogID,
+		Result:              event.Result,
+		Driver:              event.Driver,
+		ControllerRef:       event.ControllerRef,
+		Error:               event.Error,
+		CreatedAt:           event.CreatedAt,
+	}
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// livenessBody shows the process is serving requests
+type livenessBody struct {
+	Status string `json:"status"`
+}
+
+// handleLiveness handles GET /healthz. It only shows the process is serving
+// requests, so a dependency outage does not get the server restarted.
+func handleLiveness() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, livenessBody{Status: services.HealthStatusOK})
+	}
+}
+
+// handleReadiness handles GET /readyz, reporting each dependency's status. It
+// returns 503 when a required dependency is unreachable.
+func handleReadiness(healthService *services.HealthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := healthService.Check(c.Request.Context())
+		status := http.StatusOK
+		if !report.Ready() {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, report)
+	}
+}
+
+// serverTimeBody is the server's clock
+type serverTimeBody struct {
+	Time                string `json:"time" format:"date-time"`
+	UnixMS              int64  `json:"unix_ms" format:"int64"`
+	MaxClockSkewSeconds int    `json:"max_clock_skew_seconds" doc:"0 when client times are kept as reported"`
+}
+
+// handleServerTime handles GET /time, so clients can measure how far their
+// clock is off. max_clock_skew_seconds is how far the times they report with an
+// action may be off before they are clamped (0 when they never are).
+func handleServerTime(actionExecutionService *services.ActionExecutionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		now := time.Now().UTC()
+		c.JSON(http.StatusOK, serverTimeBody{
+			Time:                now.Format(time.RFC3339Nano),
+			UnixMS:              now.UnixMilli(),
+			MaxClockSkewSeconds: int(actionExecutionService.ClockSkew().Seconds()),
+		})
+	}
+}
@@ -0,0 +1,299 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Holiday handlers
+
+// handleListHolidays handles GET /holidays
+func handleListHolidays(holidayService *services.HolidayService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := services.HolidayFilter{
+			From:  c.Query("from"),
+			To:    c.Query("to"),
+			Limit: 100,
+		}
+
+		var err error
+		if filter.Country, err = services.NormalizeCountry(c.Query("country")); err != nil {
+			serviceErrorResponse(c, http.StatusBadRequest, err)
+			return
+		}
+		if locationIDStr := c.Query("location_id"); locationIDStr != "" {
+			locationID, err := uuid.Parse(locationIDStr)
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Invalid location_id")
+				return
+			}
+			filter.LocationID = &locationID
+		}
+		if limitStr := c.Query("limit"); limitStr != "" {
+			if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+				filter.Limit = l
+			}
+		}
+		if offsetStr := c.Query("offset"); offsetStr != "" {
+			if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+				filter.Offset = o
+			}
+		}
+
+		holidays, total, err := holidayService.ListHolidays(filter)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		holidayList := make([]holidayBody, len(holidays))
+		for i := range holidays {
+			holidayList[i] = holidayResponse(&holidays[i])
+		}
+
+		listResponse(c, holidayList, total)
+	}
+}
+
+// createHolidayRequest is the body of POST /holidays
+type createHolidayRequest struct {
+	Date       string     `json:"date" binding:"required" format:"date" doc:"YYYY-MM-DD"`
+	Name       string     `json:"name" binding:"required"`
+	Country    string     `json:"country" doc:"ISO 3166-1 alpha-2 code; set either this or location_id"`
+	LocationID *uuid.UUID `json:"location_id" doc:"For a holiday of one location only"`
+	Nonce      string     `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleCreateHoliday handles POST /holidays
+func handleCreateHoliday(holidayService *services.HolidayService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req createHolidayRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		holiday, err := holidayService.CreateHoliday(services.HolidayInput{
+			HolidayScope: services.HolidayScope{Country: req.Country, LocationID: req.LocationID},
+			Date:         req.Date,
+			Name:         req.Name,
+		})
+		if err != nil {
+			serviceErrorResponse(c, http.StatusBadRequest, err)
+			return
+		}
+
+		createdResponse(c, holidayResponse(holiday))
+	}
+}
+
+// handleGetHoliday handles GET /holidays/:id
+func handleGetHoliday(holidayService *services.HolidayService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid holiday ID")
+			return
+		}
+
+		holiday, err := holidayService.GetHoliday(id)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, holidayResponse(holiday))
+	}
+}
+
+// updateHolidayRequest is the body of PUT /holidays/:id
+type updateHolidayRequest struct {
+	Date  *string `json:"date" format:"date" doc:"YYYY-MM-DD"`
+	Name  *string `json:"name"`
+	Nonce string  `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleUpdateHoliday handles PUT /holidays/:id
+func handleUpdateHoliday(holidayService *services.HolidayService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid holiday ID")
+			return
+		}
+
+		var req updateHolidayRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		holiday, err := holidayService.UpdateHoliday(id, services.HolidayUpdate{Date: req.Date, Name: req.Name})
+		if err != nil {
+			serviceErrorResponse(c, http.StatusBadRequest, err)
+			return
+		}
+
+		itemResponse(c, holidayResponse(holiday))
+	}
+}
+
+// handleDeleteHoliday handles DELETE /holidays/:id
+func handleDeleteHoliday(holidayService *services.HolidayService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid holiday ID")
+			return
+		}
+
+		if err := holidayService.DeleteHoliday(id); err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		deletedResponse(c)
+	}
+}
+
+// maxHolidayImportSize bounds an uploaded holiday file; a country's holidays
+// for several years take a few KB
+const maxHolidayImportSize = 5 << 20
+
+// importHolidaysRequest is the body of POST /holidays/import
+type importHolidaysRequest struct {
+	Data       string `json:"data" form:"-" doc:"The file's contents"`
+	Format     string `json:"format" form:"format" binding:"required" enum:"csv,nager,ics"`
+	Country    string `json:"country" form:"country" doc:"Overrides the countries in the file"`
+	LocationID string `json:"location_id" form:"location_id" format:"uuid" doc:"Imports the holidays for this location only"`
+	Nonce      string `json:"nonce" form:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleImportHolidays handles POST /holidays/import. The file is uploaded as
+// the multipart field "file", or sent in a JSON body as "data".
+func handleImportHolidays(holidayService *services.HolidayService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxHolidayImportSize)
+
+		var req importHolidaysRequest
+
+		var data io.Reader
+		if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+			if err := c.ShouldBind(&req); err != nil {
+				bindErrorResponse(c, err)
+				return
+			}
+			fileHeader, err := c.FormFile("file")
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Holiday file is required in the \"file\" field")
+				return
+			}
+			file, err := fileHeader.Open()
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Failed to read holiday file: "+err.Error())
+				return
+			}
+			defer file.Close()
+			data = file
+		} else {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				bindErrorResponse(c, err)
+				return
+			}
+			data = strings.NewReader(req.Data)
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		scope := services.HolidayScope{Country: req.Country}
+		if req.LocationID != "" {
+			locationID, err := uuid.Parse(req.LocationID)
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Invalid location_id")
+				return
+			}
+			scope.LocationID = &locationID
+		}
+
+		result, err := holidayService.ImportHolidays(data, req.Format, scope)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusBadRequest, err)
+			return
+		}
+
+		itemResponse(c, result)
+	}
+}
+
+// handleListLocationHolidays handles GET /locations/:id/holidays, the
+// holidays that apply at a location
+func handleListLocationHolidays(holidayService *services.HolidayService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		locationID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid location ID")
+			return
+		}
+
+		holidays, err := holidayService.ListLocationHolidays(locationID, c.Query("from"), c.Query("to"))
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		holidayList := make([]holidayBody, len(holidays))
+		for i := range holidays {
+			holidayList[i] = holidayResponse(&holidays[i])
+		}
+
+		listResponse(c, holidayList, int64(len(holidayList)))
+	}
+}
+
+// holidayBody is the API representation of a holiday
+type holidayBody struct {
+	ID           uuid.UUID  `json:"id"`
+	Date         string     `json:"date" format:"date"`
+	Name         string     `json:"name"`
+	Country      string     `json:"country" doc:"ISO 3166-1 alpha-2 code; empty for a location's holiday"`
+	LocationID   *uuid.UUID `json:"location_id" doc:"Set for a holiday of one location only"`
+	LocationName string     `json:"location_name,omitempty"`
+	Source       string     `json:"source" enum:"manual,csv,nager,ics" doc:"Created by hand or imported from this format"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// holidayResponse is the API representation of a holiday
+func holidayResponse(holiday *database.Holiday) holidayBody {
+	response := holidayBody{
+		ID:         holiday.ID,
+		Date:       holiday.Date,
+		Name:       holiday.Name,
+		Country:    holiday.Country,
+		LocationID: holiday.LocationID,
+		Source:     holiday.Source,
+		CreatedAt:  holiday.CreatedAt,
+		UpdatedAt:  holiday.UpdatedAt,
+	}
+	if holiday.Location != nil {
+		response.LocationName = holiday.Location.Name
+	}
+	return response
+}
@@ -0,0 +1,453 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// HR notification handlers
+
+// handleListHRNotificationRules handles GET /hr-notification-rules
+func handleListHRNotificationRules(hrService *services.HRNotificationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rules, err := hrService.ListRules(c.Query("active") == "true")
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		ruleList := make([]hrNotificationRuleBody, len(rules))
+		for i := range rules {
+			ruleList[i] = hrNotificationRuleResponse(&rules[i])
+		}
+
+		listResponse(c, ruleList, int64(len(ruleList)))
+	}
+}
+
+// createHRNotificationRuleRequest is the body of POST /hr-notification-rules
+type createHRNotificationRuleRequest struct {
+	Name            string `json:"name" binding:"required"`
+	Description     string `json:"description"`
+	TriggerType     string `json:"trigger_type" binding:"required" enum:"action,status"`
+	TriggerName     string `json:"trigger_name" binding:"required" doc:"Action name, or user status name or type"`
+	Channel         string `json:"channel" binding:"required" enum:"email,webhook"`
+	Target          string `json:"target" binding:"required" doc:"Comma-separated recipients (email) or URL (webhook)"`
+	Secret          string `json:"secret" doc:"Signing secret for webhooks; empty disables signing"`
+	SubjectTemplate string `json:"subject_template" doc:"text/template; a default is used when empty"`
+	BodyTemplate    string `json:"body_template" doc:"text/template; a default is used when empty"`
+	AllowOptOut     bool   `json:"allow_opt_out"`
+	Active          *bool  `json:"active"`
+	Nonce           string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleCreateHRNotificationRule handles POST /hr-notification-rules
+func handleCreateHRNotificationRule(hrService *services.HRNotificationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req createHRNotificationRuleRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		rule := &database.HRNotificationRule{
+			Name:            req.Name,
+			Description:     req.Description,
+			TriggerType:     req.TriggerType,
+			TriggerName:     req.TriggerName,
+			Channel:         req.Channel,
+			Target:          req.Target,
+			Secret:          req.Secret,
+			SubjectTemplate: req.SubjectTemplate,
+			BodyTemplate:    req.BodyTemplate,
+			AllowOptOut:     req.AllowOptOut,
+			Active:          true,
+		}
+		if req.Active != nil {
+			rule.Active = *req.Active
+		}
+
+		rule, err := hrService.CreateRule(rule)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		createdResponse(c, hrNotificationRuleResponse(rule))
+	}
+}
+
+// handleGetHRNotificationRule handles GET /hr-notification-rules/:id
+func handleGetHRNotificationRule(hrService *services.HRNotificationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ruleID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid HR notification rule ID")
+			return
+		}
+
+		rule, err := hrService.GetRuleByID(ruleID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, hrNotificationRuleResponse(rule))
+	}
+}
+
+// updateHRNotificationRuleRequest is the body of PUT /hr-notification-rules/:id
+type updateHRNotificationRuleRequest struct {
+	Name            *string `json:"name"`
+	Description     *string `json:"description"`
+	TriggerType     *string `json:"trigger_type" enum:"action,status"`
+	TriggerName     *string `json:"trigger_name"`
+	Channel         *string `json:"channel" enum:"email,webhook"`
+	Target          *string `json:"target"`
+	Secret          *string `json:"secret"`
+	SubjectTemplate *string `json:"subject_template"`
+	BodyTemplate    *string `json:"body_template"`
+	AllowOptOut     *bool   `json:"allow_opt_out"`
+	Active          *bool   `json:"active"`
+	Nonce           string  `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleUpdateHRNotificationRule handles PUT /hr-notification-rules/:id
+func handleUpdateHRNotificationRule(hrService *services.HRNotificationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ruleID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid HR notification rule ID")
+			return
+		}
+
+		var req updateHRNotificationRuleRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		// Build updates map
+		updates := make(map[string]interface{})
+		if req.Name != nil {
+			updates["name"] = *req.Name
+		}
+		if req.Description != nil {
+			updates["description"] = *req.Description
+		}
+		if req.TriggerType != nil {
+			updates["trigger_type"] = *req.TriggerType
+		}
+		if req.TriggerName != nil {
+			updates["trigger_name"] = *req.TriggerName
+		}
+		if req.Channel != nil {
+			updates["channel"] = *req.Channel
+		}
+		if req.Target != nil {
+			updates["target"] = *req.Target
+		}
+		if req.Secret != nil {
+			updates["secret"] = *req.Secret
+		}
+		if req.SubjectTemplate != nil {
+			updates["subject_template"] = *req.SubjectTemplate
+		}
+		if req.BodyTemplate != nil {
+			updates["body_template"] = *req.BodyTemplate
+		}
+		if req.AllowOptOut != nil {
+			updates["allow_opt_out"] = *req.AllowOptOut
+		}
+		if req.Active != nil {
+			updates["active"] = *req.Active
+		}
+
+		rule, err := hrService.UpdateRule(ruleID, updates)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, hrNotificationRuleResponse(rule))
+	}
+}
+
+// handleDeleteHRNotificationRule handles DELETE /hr-notification-rules/:id
+func handleDeleteHRNotificationRule(hrService *services.HRNotificationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ruleID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid HR notification rule ID")
+			return
+		}
+
+		if err := hrService.DeleteRule(ruleID); err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		deletedResponse(c)
+	}
+}
+
+// handleListHRNotifications handles GET /hr-notifications, the notification log
+func handleListHRNotifications(hrService *services.HRNotificationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := services.HRNotificationFilter{
+			Status: c.Query("status"),
+			Limit:  50,
+		}
+
+		var err error
+		if filter.RuleID, err = parseOptionalUUID(c.Query("rule_id")); err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid rule_id")
+			return
+		}
+		if filter.UserID, err = parseOptionalUUID(c.Query("user_id")); err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid user_id")
+			return
+		}
+		if limitStr := c.Query("limit"); limitStr != "" {
+			if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+				filter.Limit = l
+			}
+		}
+		if offsetStr := c.Query("offset"); offsetStr != "" {
+			if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+				filter.Offset = o
+			}
+		}
+
+		notifications, total, err := hrService.ListNotifications(filter)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		notificationList := make([]hrNotificationBody, len(notifications))
+		for i := range notifications {
+			notificationList[i] = hrNotificationResponse(&notifications[i])
+		}
+
+		listResponse(c, notificationList, total)
+	}
+}
+
+// handleGetHRNotification handles GET /hr-notifications/:id
+func handleGetHRNotification(hrService *services.HRNotificationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		notificationID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid HR notification ID")
+			return
+		}
+
+		notification, err := hrService.GetNotificationByID(notificationID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, hrNotificationResponse(notification))
+	}
+}
+
+// handleRetryHRNotification handles POST /hr-notifications/:id/retry, one more
+// delivery attempt of a pending or failed notification
+func handleRetryHRNotification(hrService *services.HRNotificationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		notificationID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid HR notification ID")
+			return
+		}
+
+		notification, err := hrService.RetryNotification(notificationID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, hrNotificationResponse(notification))
+	}
+}
+
+// handleListHRNotificationOptOuts handles GET /users/:id/hr-notification-opt-outs
+func handleListHRNotificationOptOuts(hrService *services.HRNotificationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+
+		rules, err := hrService.ListOptOuts(userID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		ruleList := make([]hrNotificationRuleBody, len(rules))
+		for i := range rules {
+			ruleList[i] = hrNotificationRuleResponse(&rules[i])
+		}
+
+		listResponse(c, ruleList, int64(len(ruleList)))
+	}
+}
+
+// hrNotificationOptOutBody confirms a user's opt-out of a rule
+type hrNotificationOptOutBody struct {
+	UserID   uuid.UUID `json:"user_id"`
+	RuleID   uuid.UUID `json:"rule_id"`
+	OptedOut bool      `json:"opted_out"`
+}
+
+// handleHRNotificationOptOut handles PUT /users/:id/hr-notification-opt-outs/:rule_id
+func handleHRNotificationOptOut(hrService *services.HRNotificationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ruleID, ok := parseHRNotificationOptOutParams(c)
+		if !ok {
+			return
+		}
+
+		if err := hrService.OptOut(userID, ruleID); err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		successResponse(c, hrNotificationOptOutBody{UserID: userID, RuleID: ruleID, OptedOut: true})
+	}
+}
+
+// handleHRNotificationOptIn handles DELETE /users/:id/hr-notification-opt-outs/:rule_id
+func handleHRNotificationOptIn(hrService *services.HRNotificationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ruleID, ok := parseHRNotificationOptOutParams(c)
+		if !ok {
+			return
+		}
+
+		if err := hrService.OptIn(userID, ruleID); err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		deletedResponse(c)
+	}
+}
+
+// parseHRNotificationOptOutParams parses the user and rule IDs of an opt-out
+// route, responding with an error when either is invalid
+func parseHRNotificationOptOutParams(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, "Invalid user ID")
+		return uuid.Nil, uuid.Nil, false
+	}
+	ruleID, err := uuid.Parse(c.Param("rule_id"))
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, "Invalid HR notification rule ID")
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, ruleID, true
+}
+
+// hrNotificationRuleBody is the API representation of an HR notification rule
+type hrNotificationRuleBody struct {
+	ID              uuid.UUID `json:"id"`
+	Name            string    `json:"name"`
+	Description     string    `json:"description"`
+	TriggerType     string    `json:"trigger_type" enum:"action,status"`
+	TriggerName     string    `json:"trigger_name" doc:"The action name, or the user status name or type (e.g. leave)"`
+	Channel         string    `json:"channel" enum:"email,webhook"`
+	Target          string    `json:"target" doc:"Comma-separated email recipients, or the webhook URL"`
+	Signed          bool      `json:"signed" doc:"Webhook deliveries are signed with the rule's secret"`
+	SubjectTemplate string    `json:"subject_template" doc:"Go template over .Rule, .TriggerType, .TriggerName, .User (.Name, .Email, ...), .OccurredAt and .Details; empty uses the default"`
+	BodyTemplate    string    `json:"body_template" doc:"Like subject_template; empty uses the default"`
+	AllowOptOut     bool      `json:"allow_opt_out"`
+	Active          bool      `json:"active"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// hrNotificationRuleResponse formats an HR notification rule for API responses
+func hrNotificationRuleResponse(rule *database.HRNotificationRule) hrNotificationRuleBody {
+	return hrNotificationRuleBody{
+		ID:              rule.ID,
+		Name:            rule.Name,
+		Description:     rule.Description,
+		TriggerType:     rule.TriggerType,
+		TriggerName:     rule.TriggerName,
+		Channel:         rule.Channel,
+		Target:          rule.Target,
+		Signed:          rule.Secret != "",
+		SubjectTemplate: rule.SubjectTemplate,
+		BodyTemplate:    rule.BodyTemplate,
+		AllowOptOut:     rule.AllowOptOut,
+		Active:          rule.Active,
+		CreatedAt:       rule.CreatedAt,
+		UpdatedAt:       rule.UpdatedAt,
+	}
+}
+
+// hrNotificationBody is the API representation of a logged HR notification
+type hrNotificationBody struct {
+	ID            uuid.UUID  `json:"id"`
+	RuleID        uuid.UUID  `json:"rule_id"`
+	RuleName      string     `json:"rule_name"`
+	UserID        uuid.UUID  `json:"user_id"`
+	Username      string     `json:"username"`
+	TriggerType   string     `json:"trigger_type" enum:"action,status"`
+	TriggerName   string     `json:"trigger_name" doc:"The action or user status that fired the rule"`
+	Channel       string     `json:"channel" enum:"email,webhook"`
+	Target        string     `json:"target"`
+	Subject       string     `json:"subject"`
+	Body          string     `json:"body" doc:"The email body, or the JSON webhook payload"`
+	Status        string     `json:"status" enum:"pending,sent,failed,opted_out"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"last_error"`
+	NextAttemptAt *time.Time `json:"next_attempt_at" doc:"When a pending notification is retried"`
+	SentAt        *time.Time `json:"sent_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// hrNotificationResponse formats a logged HR notification for API responses
+func hrNotificationResponse(notification *database.HRNotification) hrNotificationBody {
+	return hrNotificationBody{
+		ID:            notification.ID,
+		RuleID:        notification.RuleID,
+		RuleName:      notification.Rule.Name,
+		UserID:        notification.UserID,
+		Username:      notification.User.Username,
+		TriggerType:   notification.TriggerType,
+		TriggerName:   notification.TriggerName,
+		Channel:       notification.Channel,
+		Target:        notification.Target,
+		Subject:       notification.Subject,
+		Body:          notification.Body,
+		Status:        notification.Status,
+		Attempts:      notification.Attempts,
+		LastError:     notification.LastError,
+		NextAttemptAt: notification.NextAttemptAt,
+		SentAt:        notification.SentAt,
+		CreatedAt:     notification.CreatedAt,
+		UpdatedAt:     notification.UpdatedAt,
+	}
+}
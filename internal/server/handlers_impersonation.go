@@ -0,0 +1,168 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Impersonation handlers
+
+// startImpersonationRequest is the body of POST /auth/impersonate
+type startImpersonationRequest struct {
+	UserID   string `json:"user_id" binding:"required"`
+	Reason   string `json:"reason" binding:"required"`
+	ReadOnly *bool  `json:"read_only" doc:"Defaults to true"`
+	Nonce    string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleStartImpersonation handles POST /auth/impersonate
+func handleStartImpersonation(impersonationService *services.ImpersonationService, sessionService *services.SessionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req startImpersonationRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		subjectID, err := uuid.Parse(req.UserID)
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+
+		// Impersonation is started by an admin with their device, never by a service identity
+		device, ok := c.Get("device")
+		if !ok {
+			errorResponse(c, http.StatusForbidden, "Impersonation requires device authentication")
+			return
+		}
+
+		readOnly := true
+		if req.ReadOnly != nil {
+			readOnly = *req.ReadOnly
+		}
+
+		impersonation, session, err := impersonationService.StartImpersonation(subjectID, services.ImpersonationContext{
+			Actor:       c.MustGet("user").(*database.User),
+			Device:      device.(*database.Device),
+			Reason:      req.Reason,
+			ReadOnly:    readOnly,
+			IPAddress:   c.ClientIP(),
+			UserAgent:   c.GetHeader("User-Agent"),
+			Fingerprint: c.GetHeader(clientFingerprintHeader),
+			RequestID:   c.GetString("request_id"),
+		})
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		accessToken, err := sessionService.GenerateAccessToken(session)
+		if err != nil {
+			errorResponse(c, http.StatusInternalServerError, "Failed to generate access token: "+err.Error())
+			return
+		}
+
+		refreshToken, err := sessionService.GenerateRefreshToken(session)
+		if err != nil {
+			errorResponse(c, http.StatusInternalServerError, "Failed to generate refresh token: "+err.Error())
+			return
+		}
+
+		createdResponse(c, impersonationSessionBody{
+			impersonationBody: impersonationResponse(impersonation),
+			AccessToken:       accessToken,
+			RefreshToken:      refreshToken,
+		})
+	}
+}
+
+// handleListImpersonations handles GET /auth/impersonations
+func handleListImpersonations(impersonationService *services.ImpersonationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		impersonations, err := impersonationService.ListActiveImpersonations()
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		impersonationList := make([]impersonationBody, len(impersonations))
+		for i := range impersonations {
+			impersonationList[i] = impersonationResponse(&impersonations[i])
+		}
+
+		listResponse(c, impersonationList, int64(len(impersonationList)))
+	}
+}
+
+// handleEndImpersonation handles DELETE /auth/impersonations/:session_id
+func handleEndImpersonation(impersonationService *services.ImpersonationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		impersonation, err := impersonationService.EndImpersonation(c.Param("session_id"), c.MustGet("user_id").(uuid.UUID))
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, impersonationResponse(impersonation))
+	}
+}
+
+// impersonationBody is the API representation of an impersonation
+type impersonationBody struct {
+	ID            uuid.UUID  `json:"id"`
+	SessionID     string     `json:"session_id" format:"uuid" doc:"The impersonation session"`
+	ActorID       uuid.UUID  `json:"actor_id" doc:"The admin impersonating"`
+	ActorDeviceID uuid.UUID  `json:"actor_device_id"`
+	SubjectUserID uuid.UUID  `json:"subject_user_id" doc:"The user impersonated"`
+	Reason        string     `json:"reason"`
+	ReadOnly      bool       `json:"read_only"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	EndedAt       *time.Time `json:"ended_at" doc:"Set when ended early; otherwise the session ran until expires_at"`
+	EndedByID     *uuid.UUID `json:"ended_by_id"`
+	IPAddress     string     `json:"ip_address"`
+	CreatedAt     time.Time  `json:"created_at"`
+	Actor         string     `json:"actor,omitempty" doc:"The actor's username"`
+	Subject       string     `json:"subject,omitempty" doc:"The subject's username"`
+}
+
+// impersonationSessionBody is a new impersonation with the tokens of its session
+type impersonationSessionBody struct {
+	impersonationBody
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// impersonationResponse formats an impersonation for API responses
+func impersonationResponse(impersonation *database.Impersonation) impersonationBody {
+	response := impersonationBody{
+		ID:            impersonation.ID,
+		SessionID:     impersonation.SessionID,
+		ActorID:       impersonation.ActorID,
+		ActorDeviceID: impersonation.ActorDeviceID,
+		SubjectUserID: impersonation.SubjectUserID,
+		Reason:        impersonation.Reason,
+		ReadOnly:      impersonation.ReadOnly,
+		ExpiresAt:     impersonation.ExpiresAt,
+		EndedAt:       impersonation.EndedAt,
+		EndedByID:     impersonation.EndedByID,
+		IPAddress:     impersonation.IPAddress,
+		CreatedAt:     impersonation.CreatedAt,
+	}
+	if impersonation.Actor.ID != uuid.Nil {
+		response.Actor = impersonation.Actor.Username
+	}
+	if impersonation.SubjectUser.ID != uuid.Nil {
+		response.Subject = impersonation.SubjectUser.Username
+	}
+	return response
+}
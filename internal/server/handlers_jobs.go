@@ -0,0 +1,84 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/YubiApp/internal/jobs"
+	"github.com/gin-gonic/gin"
+)
+
+// Job queue handlers
+
+// handleGetJobStats handles GET /jobs/stats
+func handleGetJobStats(jobQueue *jobs.Queue) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		stats, err := jobQueue.Stats(c.Request.Context())
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, stats)
+	}
+}
+
+// handleListDeadJobs handles GET /jobs/dead
+func handleListDeadJobs(jobQueue *jobs.Queue) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, offset := 50, 0
+		if limitStr := c.Query("limit"); limitStr != "" {
+			if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+				limit = l
+			}
+		}
+		if offsetStr := c.Query("offset"); offsetStr != "" {
+			if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+				offset = o
+			}
+		}
+
+		deadJobs, total, err := jobQueue.DeadJobs(c.Request.Context(), offset, limit)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		listResponse(c, deadJobs, total)
+	}
+}
+
+// handleRetryDeadJob handles POST /jobs/dead/:id/retry
+func handleRetryDeadJob(jobQueue *jobs.Queue) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		job, err := jobQueue.RetryDead(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			jobErrorResponse(c, err)
+			return
+		}
+
+		itemResponse(c, job)
+	}
+}
+
+// handleDeleteDeadJob handles DELETE /jobs/dead/:id
+func handleDeleteDeadJob(jobQueue *jobs.Queue) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := jobQueue.DeleteDead(c.Request.Context(), c.Param("id")); err != nil {
+			jobErrorResponse(c, err)
+			return
+		}
+
+		deletedResponse(c)
+	}
+}
+
+// jobErrorResponse responds 404 for unknown dead jobs and 500 otherwise
+func jobErrorResponse(c *gin.Context, err error) {
+	if errors.Is(err, jobs.ErrNotFound) {
+		errorResponse(c, http.StatusNotFound, "Dead job not found")
+		return
+	}
+	serviceErrorResponse(c, http.StatusInternalServerError, err)
+}
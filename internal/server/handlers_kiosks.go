@@ -0,0 +1,278 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Kiosk API handlers
+
+// createKioskRequest is the body of POST /kiosks
+type createKioskRequest struct {
+	Name           string   `json:"name" binding:"required"`
+	LocationID     string   `json:"location_id" binding:"required"`
+	AllowedActions []string `json:"allowed_actions"`
+	Active         *bool    `json:"active"`
+	Nonce          string   `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+func handleCreateKiosk(kioskService *services.KioskService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req createKioskRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		locationID, err := uuid.Parse(req.LocationID)
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid location ID")
+			return
+		}
+
+		active := true
+		if req.Active != nil {
+			active = *req.Active
+		}
+
+		kiosk, secret, err := kioskService.CreateKiosk(req.Name, locationID, req.AllowedActions, active)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		// The client secret is only returned here and on rotation
+		createdResponse(c, kioskSecretBody{kioskBody: kioskResponse(kiosk), ClientSecret: secret})
+	}
+}
+
+func handleGetKiosk(kioskService *services.KioskService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kioskID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid kiosk ID")
+			return
+		}
+
+		kiosk, err := kioskService.GetKioskByID(kioskID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, kioskResponse(kiosk))
+	}
+}
+
+func handleListKiosks(kioskService *services.KioskService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kiosks, err := kioskService.ListKiosks()
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		kioskList := make([]kioskBody, len(kiosks))
+		for i := range kiosks {
+			kioskList[i] = kioskResponse(&kiosks[i])
+		}
+
+		listResponse(c, kioskList, int64(len(kioskList)))
+	}
+}
+
+// updateKioskRequest is the body of PUT /kiosks/:id
+type updateKioskRequest struct {
+	Name           *string  `json:"name"`
+	LocationID     *string  `json:"location_id"`
+	AllowedActions []string `json:"allowed_actions"`
+	Active         *bool    `json:"active"`
+	Nonce          string   `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+func handleUpdateKiosk(kioskService *services.KioskService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kioskID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid kiosk ID")
+			return
+		}
+
+		var req updateKioskRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		// Build updates map
+		updates := make(map[string]interface{})
+		if req.Name != nil {
+			updates["name"] = *req.Name
+		}
+		if req.LocationID != nil {
+			locationID, err := uuid.Parse(*req.LocationID)
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Invalid location ID")
+				return
+			}
+			updates["location_id"] = locationID
+		}
+		if req.Active != nil {
+			updates["active"] = *req.Active
+		}
+
+		kiosk, err := kioskService.UpdateKiosk(kioskID, updates, req.AllowedActions)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, kioskResponse(kiosk))
+	}
+}
+
+// handleRotateKioskSecret handles POST /kiosks/:id/rotate-secret
+func handleRotateKioskSecret(kioskService *services.KioskService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kioskID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid kiosk ID")
+			return
+		}
+
+		kiosk, secret, err := kioskService.RotateKioskSecret(kioskID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, kioskSecretBody{kioskBody: kioskResponse(kiosk), ClientSecret: secret})
+	}
+}
+
+func handleDeleteKiosk(kioskService *services.KioskService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kioskID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid kiosk ID")
+			return
+		}
+
+		if err := kioskService.DeleteKiosk(kioskID); err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		deletedResponse(c)
+	}
+}
+
+// kioskActionRequest is the body of POST /kiosk/action
+type kioskActionRequest struct {
+	Action  string                 `json:"action" binding:"required"`
+	OTP     string                 `json:"otp" binding:"required"`
+	Details map[string]interface{} `json:"details"`
+}
+
+// handleKioskAction handles POST /kiosk/action. The kiosk authenticates with its
+// client credentials in X-Kiosk-Credentials and the user with their YubiKey OTP;
+// only the kiosk's whitelisted actions are performed, always at the kiosk's location.
+func handleKioskAction(kioskService *services.KioskService, authService *services.AuthService, actionService *services.ActionService, locationService *services.LocationService, actionExecutionService *services.ActionExecutionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Expected format: "<client_id>:<client_secret>"
+		clientID, secret, ok := services.ParseKioskCredentials(c.GetHeader("X-Kiosk-Credentials"))
+		if !ok {
+			errorResponse(c, http.StatusUnauthorized, "X-Kiosk-Credentials header is required. Expected: <client_id>:<client_secret>")
+			return
+		}
+
+		kiosk, err := kioskService.AuthenticateKiosk(clientID, secret)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, fmt.Errorf("Kiosk authentication failed: %w", err))
+			return
+		}
+
+		var req kioskActionRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Reject anything off the whitelist before the OTP is used, so a badge tap at a
+		// kiosk can never be spent on another operation
+		if !services.KioskAllowsAction(kiosk, req.Action) {
+			errorResponse(c, http.StatusForbidden, "Action '"+req.Action+"' is not allowed at kiosk '"+kiosk.Name+"'")
+			return
+		}
+
+		user, device, err := authService.AuthenticateDeviceContext(services.WithActionName(c.Request.Context(), req.Action), "yubikey", strings.TrimSpace(req.OTP), "")
+		if err != nil {
+			serviceErrorResponse(c, http.StatusUnauthorized, fmt.Errorf("Authentication failed: %w", err))
+			return
+		}
+
+		// The kiosk decides the location; clients cannot claim another one
+		requestBody := make(map[string]interface{})
+		for key, value := range req.Details {
+			switch key {
+			case "location", "location_id", "latitude", "longitude":
+				continue
+			}
+			requestBody[key] = value
+		}
+
+		performAction(c, authService, actionService, locationService, actionExecutionService, user, device, req.Action, requestBody, kiosk)
+	}
+}
+
+// kioskBody is the API representation of a kiosk
+type kioskBody struct {
+	ID             uuid.UUID  `json:"id"`
+	Name           string     `json:"name"`
+	LocationID     uuid.UUID  `json:"location_id"`
+	Location       string     `json:"location" doc:"The location's name"`
+	ClientID       string     `json:"client_id" doc:"Sent with the client secret in X-Kiosk-Credentials"`
+	AllowedActions []string   `json:"allowed_actions" doc:"Action names the kiosk may perform"`
+	Active         bool       `json:"active"`
+	LastSeenAt     *time.Time `json:"last_seen_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// kioskSecretBody is a kiosk with its new client secret
+type kioskSecretBody struct {
+	kioskBody
+	ClientSecret string `json:"client_secret" doc:"Only returned when the kiosk is created and when its secret is rotated"`
+}
+
+// kioskResponse formats a kiosk for API responses; the client secret is never returned
+func kioskResponse(kiosk *database.Kiosk) kioskBody {
+	return kioskBody{
+		ID:             kiosk.ID,
+		Name:           kiosk.Name,
+		LocationID:     kiosk.LocationID,
+		Location:       kiosk.Location.Name,
+		ClientID:       kiosk.ClientID,
+		AllowedActions: services.KioskAllowedActions(kiosk),
+		Active:         kiosk.Active,
+		LastSeenAt:     kiosk.LastSeenAt,
+		CreatedAt:      kiosk.CreatedAt,
+		UpdatedAt:      kiosk.UpdatedAt,
+	}
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Leave balance handlers
+
+// handleGetLeaveBalance handles GET /users/:id/leave-balance
+func handleGetLeaveBalance(leaveService *services.LeaveService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+
+		year, ok := leaveYearQuery(c)
+		if !ok {
+			return
+		}
+
+		balances, err := leaveService.GetBalances(userID, year, time.Now())
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		listResponse(c, balances, int64(len(balances)))
+	}
+}
+
+// handleListLeaveEntries handles GET /users/:id/leave-entries
+func handleListLeaveEntries(leaveService *services.LeaveService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+
+		filter := services.LeaveEntryFilter{
+			UserID: userID,
+			Type:   c.Query("type"),
+			Limit:  50,
+		}
+		var ok bool
+		if filter.Year, ok = leaveYearQuery(c); !ok {
+			return
+		}
+		if limitStr := c.Query("limit"); limitStr != "" {
+			if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+				filter.Limit = l
+			}
+		}
+		if offsetStr := c.Query("offset"); offsetStr != "" {
+			if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+				filter.Offset = o
+			}
+		}
+
+		entries, total, err := leaveService.ListEntries(filter)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		entryList := make([]leaveEntryBody, len(entries))
+		for i := range entries {
+			entryList[i] = leaveEntryResponse(&entries[i])
+		}
+
+		listResponse(c, entryList, total)
+	}
+}
+
+// adjustLeaveBalanceRequest is the body of POST /users/:id/leave-adjustments
+type adjustLeaveBalanceRequest struct {
+	Type   string  `json:"type" binding:"required" doc:"A leave type in leave.types"`
+	Year   int     `json:"year" doc:"Defaults to the current year"`
+	Days   float64 `json:"days" binding:"required" doc:"Negative removes days"`
+	Reason string  `json:"reason" binding:"required"`
+	Nonce  string  `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleAdjustLeaveBalance handles POST /users/:id/leave-adjustments
+func handleAdjustLeaveBalance(leaveService *services.LeaveService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+
+		var req adjustLeaveBalanceRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		if req.Year == 0 {
+			req.Year = time.Now().Year()
+		}
+
+		adjustedByID := c.MustGet("user_id").(uuid.UUID)
+		entry, err := leaveService.AdjustBalance(userID, services.LeaveAdjustment{
+			Type:   req.Type,
+			Year:   req.Year,
+			Days:   req.Days,
+			Reason: req.Reason,
+		}, &adjustedByID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusBadRequest, err)
+			return
+		}
+
+		createdResponse(c, leaveEntryResponse(entry))
+	}
+}
+
+// leaveYearQuery reads the optional year query parameter, 0 when absent. It
+// writes the error response itself when the year is invalid.
+func leaveYearQuery(c *gin.Context) (int, bool) {
+	yearStr := c.Query("year")
+	if yearStr == "" {
+		return 0, true
+	}
+	year, err := strconv.Atoi(yearStr)
+	if err != nil || year < 1000 || year > 9999 {
+		errorResponse(c, http.StatusBadRequest, "Invalid year")
+		return 0, false
+	}
+	return year, true
+}
+
+// leaveEntryBody is the API representation of a leave entry
+type leaveEntryBody struct {
+	ID           uuid.UUID  `json:"id"`
+	UserID       uuid.UUID  `json:"user_id"`
+	Type         string     `json:"type"`
+	Year         int        `json:"year"`
+	Kind         string     `json:"kind" enum:"taken,adjustment"`
+	Days         float64    `json:"days" doc:"Days taken, or added (removed when negative) by an adjustment"`
+	ActionID     *uuid.UUID `json:"action_id" doc:"Leave action that took the days"`
+	AuthLogID    *uuid.UUID `json:"auth_log_id" doc:"The action's authentication log entry"`
+	Reason       string     `json:"reason"`
+	AdjustedByID *uuid.UUID `json:"adjusted_by_id" doc:"Null for adjustments made from the CLI"`
+	AdjustedBy   string     `json:"adjusted_by,omitempty" doc:"Username of the adjuster"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// leaveEntryResponse is the API representation of a leave entry
+func leaveEntryResponse(entry *database.LeaveEntry) leaveEntryBody {
+	response := leaveEntryBody{
+		ID:           entry.ID,
+		UserID:       entry.UserID,
+		Type:         entry.LeaveType,
+		Year:         entry.Year,
+		Kind:         entry.Kind,
+		Days:         entry.Days,
+		ActionID:     entry.ActionID,
+		AuthLogID:    entry.AuthLogID,
+		Reason:       entry.Reason,
+		AdjustedByID: entry.AdjustedByID,
+		CreatedAt:    entry.CreatedAt,
+	}
+	if entry.AdjustedBy != nil {
+		response.AdjustedBy = entry.AdjustedBy.Username
+	}
+	return response
+}
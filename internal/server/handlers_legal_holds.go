@@ -0,0 +1,230 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Legal hold API handlers
+
+// handleListLegalHolds handles GET /legal-holds
+func handleListLegalHolds(legalHoldService *services.LegalHoldService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		includeReleased := c.Query("include_released") == "true"
+
+		holds, err := legalHoldService.ListLegalHolds(includeReleased)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		holdList := make([]legalHoldBody, len(holds))
+		for i := range holds {
+			holdList[i] = legalHoldResponse(&holds[i])
+		}
+
+		listResponse(c, holdList, int64(len(holdList)))
+	}
+}
+
+// createLegalHoldRequest is the body of POST /legal-holds
+type createLegalHoldRequest struct {
+	UserID       *string `json:"user_id"`
+	FromDateTime *string `json:"from_datetime"`
+	ToDateTime   *string `json:"to_datetime"`
+	Reason       string  `json:"reason" binding:"required"`
+	Nonce        string  `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleCreateLegalHold handles POST /legal-holds
+func handleCreateLegalHold(legalHoldService *services.LegalHoldService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req createLegalHoldRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		var userID *uuid.UUID
+		if req.UserID != nil && *req.UserID != "" {
+			parsed, err := uuid.Parse(*req.UserID)
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Invalid user_id")
+				return
+			}
+			userID = &parsed
+		}
+
+		var from, to *time.Time
+		if req.FromDateTime != nil && *req.FromDateTime != "" {
+			t, err := parseReportTime(*req.FromDateTime, false)
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Invalid from_datetime: "+err.Error())
+				return
+			}
+			from = &t
+		}
+		if req.ToDateTime != nil && *req.ToDateTime != "" {
+			t, err := parseReportTime(*req.ToDateTime, true)
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Invalid to_datetime: "+err.Error())
+				return
+			}
+			to = &t
+		}
+
+		hold, err := legalHoldService.CreateLegalHold(c.MustGet("user_id").(uuid.UUID), userID, from, to, req.Reason)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		createdResponse(c, legalHoldResponse(hold))
+	}
+}
+
+// handleGetLegalHold handles GET /legal-holds/:id
+func handleGetLegalHold(legalHoldService *services.LegalHoldService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		holdID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid legal hold ID")
+			return
+		}
+
+		hold, err := legalHoldService.GetLegalHoldByID(holdID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, legalHoldResponse(hold))
+	}
+}
+
+// releaseLegalHoldRequest is the body of POST /legal-holds/:id/release
+type releaseLegalHoldRequest struct {
+	Reason string `json:"reason" binding:"required"`
+	Nonce  string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleReleaseLegalHold handles POST /legal-holds/:id/release
+func handleReleaseLegalHold(legalHoldService *services.LegalHoldService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		holdID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid legal hold ID")
+			return
+		}
+
+		var req releaseLegalHoldRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		hold, err := legalHoldService.ReleaseLegalHold(holdID, c.MustGet("user_id").(uuid.UUID), req.Reason)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, legalHoldResponse(hold))
+	}
+}
+
+// legalHoldExportBody is the records a legal hold covers
+type legalHoldExportBody struct {
+	Hold                legalHoldBody                  `json:"hold"`
+	ExportedAt          time.Time                      `json:"exported_at"`
+	AuthenticationLogs  []database.AuthenticationLog   `json:"authentication_logs"`
+	Activities          []database.UserActivityHistory `json:"activities"`
+	DeviceRegistrations []database.DeviceRegistration  `json:"device_registrations"`
+}
+
+// handleExportLegalHold handles GET /legal-holds/:id/export
+func handleExportLegalHold(legalHoldService *services.LegalHoldService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		holdID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid legal hold ID")
+			return
+		}
+
+		export, err := legalHoldService.ExportLegalHold(holdID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if c.Query("download") == "true" {
+			c.Header("Content-Disposition", "attachment; filename=legal-hold-"+holdID.String()+".json")
+		}
+
+		successResponse(c, legalHoldExportBody{
+			Hold:                legalHoldResponse(&export.Hold),
+			ExportedAt:          export.ExportedAt,
+			AuthenticationLogs:  export.AuthenticationLogs,
+			Activities:          export.Activities,
+			DeviceRegistrations: export.DeviceRegistrations,
+		})
+	}
+}
+
+// legalHoldBody is the API representation of a legal hold
+type legalHoldBody struct {
+	ID            uuid.UUID  `json:"id"`
+	UserID        *uuid.UUID `json:"user_id" doc:"Empty when the hold applies to all users within the date range"`
+	FromDateTime  *time.Time `json:"from_datetime" doc:"Empty means no lower bound"`
+	ToDateTime    *time.Time `json:"to_datetime" doc:"Empty means no upper bound"`
+	Reason        string     `json:"reason"`
+	PlacedByID    uuid.UUID  `json:"placed_by_id"`
+	PlacedBy      string     `json:"placed_by"`
+	Active        bool       `json:"active"`
+	ReleasedAt    *time.Time `json:"released_at"`
+	ReleasedByID  *uuid.UUID `json:"released_by_id"`
+	ReleaseReason string     `json:"release_reason"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	User          string     `json:"user,omitempty" doc:"The held user's username"`
+	ReleasedBy    string     `json:"released_by,omitempty"`
+}
+
+// legalHoldResponse formats a legal hold without exposing user credentials
+func legalHoldResponse(hold *database.LegalHold) legalHoldBody {
+	response := legalHoldBody{
+		ID:            hold.ID,
+		UserID:        hold.UserID,
+		FromDateTime:  hold.FromDateTime,
+		ToDateTime:    hold.ToDateTime,
+		Reason:        hold.Reason,
+		PlacedByID:    hold.PlacedByID,
+		PlacedBy:      hold.PlacedBy.Username,
+		Active:        hold.ReleasedAt == nil,
+		ReleasedAt:    hold.ReleasedAt,
+		ReleasedByID:  hold.ReleasedByID,
+		ReleaseReason: hold.ReleaseReason,
+		CreatedAt:     hold.CreatedAt,
+		UpdatedAt:     hold.UpdatedAt,
+	}
+	if hold.User != nil {
+		response.User = hold.User.Username
+	}
+	if hold.ReleasedBy != nil {
+		response.ReleasedBy = hold.ReleasedBy.Username
+	}
+	return response
+}
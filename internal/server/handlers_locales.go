@@ -0,0 +1,24 @@
+package server
+
+import (
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// localesBody lists the languages messages can be written in
+type localesBody struct {
+	Locales       []string `json:"locales" doc:"Default locale first"`
+	DefaultLocale string   `json:"default_locale"`
+}
+
+// handleListLocales handles GET /locales, the languages error messages and
+// emails can be written in. Users choose one with their locale setting, or
+// per request with Accept-Language.
+func handleListLocales(translator *services.Translator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		successResponse(c, localesBody{
+			Locales:       translator.Locales(),
+			DefaultLocale: translator.DefaultLocale(),
+		})
+	}
+}
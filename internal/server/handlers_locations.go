@@ -2,6 +2,7 @@ package server
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/YubiApp/internal/database"
 	"github.com/YubiApp/internal/services"
@@ -11,19 +12,30 @@ import (
 
 // Location API handlers
 
+// createLocationRequest is the body of POST /locations
+type createLocationRequest struct {
+	Name         string   `json:"name" binding:"required"`
+	Description  string   `json:"description"`
+	Address      string   `json:"address"`
+	Type         string   `json:"type" enum:"office,home,event,other"`
+	Active       bool     `json:"active"`
+	Latitude     *float64 `json:"latitude"`
+	Longitude    *float64 `json:"longitude"`
+	RadiusMeters *float64 `json:"radius_meters"`
+	Networks     []string `json:"networks"`
+	Timezone     string   `json:"timezone" doc:"IANA timezone, e.g. Europe/Paris"`
+	Country      string   `json:"country" doc:"ISO 3166-1 alpha-2 code whose public holidays apply, e.g. GB"`
+	Capacity     *int     `json:"capacity" doc:"Omit for no limit"`
+	CapacityMode string   `json:"capacity_mode" doc:"\"warn\" (default) or \"block\" sign-ins when full"`
+	Nonce        string   `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
 func handleCreateLocation(locationService *services.LocationService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var req struct {
-			Name        string `json:"name" binding:"required"`
-			Description string `json:"description"`
-			Address     string `json:"address"`
-			Type        string `json:"type"`
-			Active      bool   `json:"active"`
-			Nonce       string `json:"nonce"` // Optional nonce for response signing
-		}
+		var req createLocationRequest
 
 		if err := c.ShouldBindJSON(&req); err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			bindErrorResponse(c, err)
 			return
 		}
 
@@ -35,21 +47,22 @@ func handleCreateLocation(locationService *services.LocationService) gin.Handler
 			req.Type = "office"
 		}
 
-		location, err := locationService.CreateLocation(req.Name, req.Description, req.Address, req.Type, req.Active)
+		location, err := locationService.CreateLocationWithBounds(req.Name, req.Description, req.Address, req.Type, req.Active, services.LocationBounds{
+			Latitude:     req.Latitude,
+			Longitude:    req.Longitude,
+			RadiusMeters: req.RadiusMeters,
+			Networks:     req.Networks,
+			Timezone:     req.Timezone,
+			Country:      req.Country,
+			Capacity:     req.Capacity,
+			CapacityMode: req.CapacityMode,
+		})
 		if err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		createdResponse(c, gin.H{
-			"id":          location.ID,
-			"name":        location.Name,
-			"description": location.Description,
-			"address":     location.Address,
-			"type":        location.Type,
-			"active":      location.Active,
-			"created_at":  location.CreatedAt,
-		})
+		createdResponse(c, locationResponse(location))
 	}
 }
 
@@ -63,20 +76,11 @@ func handleGetLocation(locationService *services.LocationService) gin.HandlerFun
 
 		location, err := locationService.GetLocationByID(locationID)
 		if err != nil {
-			errorResponse(c, http.StatusNotFound, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		itemResponse(c, gin.H{
-			"id":          location.ID,
-			"name":        location.Name,
-			"description": location.Description,
-			"address":     location.Address,
-			"type":        location.Type,
-			"active":      location.Active,
-			"created_at":  location.CreatedAt,
-			"updated_at":  location.UpdatedAt,
-		})
+		itemResponse(c, locationResponse(location))
 	}
 }
 
@@ -98,29 +102,40 @@ func handleListLocations(locationService *services.LocationService) gin.HandlerF
 		}
 
 		if err != nil {
-			errorResponse(c, http.StatusInternalServerError, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		// Build response
-		locationList := make([]gin.H, len(locations))
-		for i, location := range locations {
-			locationList[i] = gin.H{
-				"id":          location.ID,
-				"name":        location.Name,
-				"description": location.Description,
-				"address":     location.Address,
-				"type":        location.Type,
-				"active":      location.Active,
-				"created_at":  location.CreatedAt,
-				"updated_at":  location.UpdatedAt,
-			}
+		locationList := make([]locationBody, len(locations))
+		for i := range locations {
+			locationList[i] = locationResponse(&locations[i])
 		}
 
 		listResponse(c, locationList, int64(len(locationList)))
 	}
 }
 
+// updateLocationRequest is the body of PUT /locations/:id
+type updateLocationRequest struct {
+	Name          *string  `json:"name"`
+	Description   *string  `json:"description"`
+	Address       *string  `json:"address"`
+	Type          *string  `json:"type" enum:"office,home,event,other"`
+	Active        *bool    `json:"active"`
+	Latitude      *float64 `json:"latitude"`
+	Longitude     *float64 `json:"longitude"`
+	RadiusMeters  *float64 `json:"radius_meters"`
+	ClearGeofence bool     `json:"clear_geofence"`
+	Networks      []string `json:"networks"`
+	Timezone      *string  `json:"timezone" doc:"IANA timezone, e.g. Europe/Paris, or empty to use each user's"`
+	Country       *string  `json:"country" doc:"ISO 3166-1 alpha-2 code, or empty to use holidays.default_country"`
+	Capacity      *int     `json:"capacity"`
+	ClearCapacity bool     `json:"clear_capacity" doc:"Removes the capacity limit"`
+	CapacityMode  *string  `json:"capacity_mode" enum:"warn,block"`
+	Version       *int     `json:"version" doc:"Optional: the version the update is based on; a different current version is rejected with 409"`
+	Nonce         string   `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
 func handleUpdateLocation(locationService *services.LocationService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		locationID, err := uuid.Parse(c.Param("id"))
@@ -129,17 +144,10 @@ func handleUpdateLocation(locationService *services.LocationService) gin.Handler
 			return
 		}
 
-		var req struct {
-			Name        *string `json:"name"`
-			Description *string `json:"description"`
-			Address     *string `json:"address"`
-			Type        *string `json:"type"`
-			Active      *bool   `json:"active"`
-			Nonce       string  `json:"nonce"` // Optional nonce for response signing
-		}
+		var req updateLocationRequest
 
 		if err := c.ShouldBindJSON(&req); err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			bindErrorResponse(c, err)
 			return
 		}
 
@@ -163,23 +171,46 @@ func handleUpdateLocation(locationService *services.LocationService) gin.Handler
 		if req.Active != nil {
 			updates["active"] = *req.Active
 		}
+		if req.Networks != nil {
+			updates["networks"] = req.Networks
+		}
+		if req.Timezone != nil {
+			updates["timezone"] = *req.Timezone
+		}
+		if req.Country != nil {
+			updates["country"] = *req.Country
+		}
+		if req.ClearCapacity {
+			updates["capacity"] = nil
+		} else if req.Capacity != nil {
+			updates["capacity"] = req.Capacity
+		}
+		if req.CapacityMode != nil {
+			updates["capacity_mode"] = *req.CapacityMode
+		}
+		if req.ClearGeofence {
+			updates["latitude"] = nil
+			updates["longitude"] = nil
+			updates["radius_meters"] = nil
+		} else {
+			if req.Latitude != nil {
+				updates["latitude"] = *req.Latitude
+			}
+			if req.Longitude != nil {
+				updates["longitude"] = *req.Longitude
+			}
+			if req.RadiusMeters != nil {
+				updates["radius_meters"] = *req.RadiusMeters
+			}
+		}
 
-		location, err := locationService.UpdateLocation(locationID, updates)
+		location, err := locationService.UpdateLocation(locationID, req.Version, updates)
 		if err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		itemResponse(c, gin.H{
-			"id":          location.ID,
-			"name":        location.Name,
-			"description": location.Description,
-			"address":     location.Address,
-			"type":        location.Type,
-			"active":      location.Active,
-			"created_at":  location.CreatedAt,
-			"updated_at":  location.UpdatedAt,
-		})
+		itemResponse(c, locationResponse(location))
 	}
 }
 
@@ -193,10 +224,73 @@ func handleDeleteLocation(locationService *services.LocationService) gin.Handler
 
 		err = locationService.DeleteLocation(locationID)
 		if err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
 		deletedResponse(c)
 	}
-} 
\ No newline at end of file
+}
+
+// handleGetLocationOccupancy handles GET /locations/:id/occupancy
+func handleGetLocationOccupancy(locationService *services.LocationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		locationID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid location ID")
+			return
+		}
+
+		occupancy, err := locationService.GetOccupancy(locationID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, occupancy)
+	}
+}
+
+// locationBody is the API representation of a location
+type locationBody struct {
+	ID           uuid.UUID `json:"id"`
+	Name         string    `json:"name"`
+	Description  string    `json:"description"`
+	Address      string    `json:"address"`
+	Type         string    `json:"type" enum:"office,home,event,other"`
+	Active       bool      `json:"active"`
+	Version      int       `json:"version" doc:"Incremented by every update; send it back with updates to reject them if someone else changed the record"`
+	Latitude     *float64  `json:"latitude" doc:"Centre of the optional geofence"`
+	Longitude    *float64  `json:"longitude"`
+	RadiusMeters *float64  `json:"radius_meters"`
+	Networks     []string  `json:"networks" doc:"CIDR ranges that place users at the location by client IP"`
+	Timezone     string    `json:"timezone" doc:"IANA timezone activity at the location is shown in; empty uses each user's"`
+	Country      string    `json:"country" doc:"ISO 3166-1 alpha-2 code whose public holidays apply at the location, besides its own; empty uses holidays.default_country"`
+	Capacity     *int      `json:"capacity" doc:"How many people the location holds; null for no limit"`
+	CapacityMode string    `json:"capacity_mode" enum:"warn,block" doc:"Whether actions performed at the location while it is full are refused or answered with a capacity warning"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// locationResponse formats a location for API responses
+func locationResponse(location *database.Location) locationBody {
+	return locationBody{
+		ID:           location.ID,
+		Name:         location.Name,
+		Description:  location.Description,
+		Address:      location.Address,
+		Type:         location.Type,
+		Active:       location.Active,
+		Version:      location.Version,
+		Latitude:     location.Latitude,
+		Longitude:    location.Longitude,
+		RadiusMeters: location.RadiusMeters,
+		Networks:     services.LocationNetworks(location),
+		Timezone:     location.Timezone,
+		Country:      location.Country,
+		Capacity:     location.Capacity,
+		CapacityMode: location.CapacityMode,
+		CreatedAt:    location.CreatedAt,
+		UpdatedAt:    location.UpdatedAt,
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// validateMachineAuthRequest is the body of POST /auth/validate
+type validateMachineAuthRequest struct {
+	DeviceType string `json:"device_type" binding:"required"`
+	Code       string `json:"code" binding:"required"`
+	Resource   string `json:"resource" binding:"required"`
+	Action     string `json:"action"`
+	Nonce      string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// machineAuthBody is the decision on a machine login
+type machineAuthBody struct {
+	Allow        bool       `json:"allow"`
+	UnixUsername string     `json:"unix_username" doc:"The account to log in as; empty when denied"`
+	UserID       *uuid.UUID `json:"user_id"`
+	Reason       string     `json:"reason" doc:"Why the login was denied"`
+	Cached       bool       `json:"cached" doc:"The permission decision came from the cache"`
+}
+
+// handleValidateMachineAuth handles POST /auth/validate for PAM/SSH modules. The
+// device code is the only credential; denials are returned as allow=false with a
+// reason so the module can fail closed without parsing error bodies.
+func handleValidateMachineAuth(machineAuthService *services.MachineAuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req validateMachineAuthRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		if req.Action == "" {
+			req.Action = "login"
+		}
+
+		decision, err := machineAuthService.Validate(c.Request.Context(), req.DeviceType, req.Code, req.Resource, req.Action, c.ClientIP())
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		successResponse(c, machineAuthBody{
+			Allow:        decision.Allow,
+			UnixUsername: decision.UnixUsername,
+			UserID:       decision.UserID,
+			Reason:       decision.Reason,
+			Cached:       decision.Cached,
+		})
+	}
+}
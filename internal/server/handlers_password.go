@@ -0,0 +1,359 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Password authentication handlers
+
+// passwordAuthRequest is the body of POST /auth/password
+type passwordAuthRequest struct {
+	Username   string `json:"username" binding:"required" doc:"Username or email"`
+	Password   string `json:"password" binding:"required"`
+	DeviceType string `json:"device_type" binding:"required"`
+	AuthCode   string `json:"auth_code" binding:"required"`
+	Permission string `json:"permission" doc:"Optional permission to check"`
+	Nonce      string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handlePasswordAuth handles POST /auth/password. The password is only a first
+// factor: the request must also carry an OTP from one of the same user's devices,
+// and a session is issued only when both check out.
+func handlePasswordAuth(authService *services.AuthService, passwordService *services.PasswordService, sessionService *services.SessionService, loginNotifications *services.LoginNotificationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req passwordAuthRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		user, device, ok := authenticatePasswordAndDevice(c, authService, passwordService, req.Username, req.Password, req.DeviceType, req.AuthCode, req.Permission)
+		if !ok {
+			return
+		}
+
+		if passwordService.PasswordExpired(user) {
+			serviceErrorResponse(c, http.StatusForbidden, fmt.Errorf("%w; use /auth/password/change", services.ErrPasswordExpired))
+			return
+		}
+
+		response, ok := issueSession(c, sessionService, loginNotifications, user, device)
+		if !ok {
+			return
+		}
+		response.PasswordExpiresAt = passwordService.PasswordExpiresAt(user)
+		successResponse(c, response)
+	}
+}
+
+// changePasswordRequest is the body of POST /auth/password/change
+type changePasswordRequest struct {
+	Username        string `json:"username" binding:"required" doc:"Username or email"`
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+	DeviceType      string `json:"device_type" binding:"required"`
+	AuthCode        string `json:"auth_code" binding:"required"`
+	Nonce           string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleChangePassword handles POST /auth/password/change. It needs the same two
+// factors as /auth/password and also works once the password has expired. The
+// user's other sessions are invalidated; a session whose token accompanies the
+// request is kept.
+func handleChangePassword(authService *services.AuthService, passwordService *services.PasswordService, sessionService *services.SessionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req changePasswordRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		user, _, ok := authenticatePasswordAndDevice(c, authService, passwordService, req.Username, req.CurrentPassword, req.DeviceType, req.AuthCode, "")
+		if !ok {
+			return
+		}
+
+		if err := passwordService.SetPassword(user.ID, req.NewPassword); err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if _, err := sessionService.InvalidateOtherUserSessions(c.Request.Context(), user.ID, requestSessionID(c, sessionService, user.ID)); err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, fmt.Errorf("Password changed but other sessions could not be invalidated: %w", err))
+			return
+		}
+
+		successResponse(c, userMessageBody{Message: "Password changed", UserID: user.ID})
+	}
+}
+
+// userMessageBody confirms a change to a user's credentials
+type userMessageBody struct {
+	Message string    `json:"message"`
+	UserID  uuid.UUID `json:"user_id"`
+}
+
+// handleUnlockUser handles POST /users/:id/unlock
+func handleUnlockUser(passwordService *services.PasswordService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+
+		if err := passwordService.UnlockUser(userID); err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		successResponse(c, userMessageBody{Message: "User unlocked", UserID: userID})
+	}
+}
+
+// requestSessionID returns the ID of the session whose access token is in the
+// request's Authorization header, or "" when there is none or it is not userID's
+func requestSessionID(c *gin.Context, sessionService *services.SessionService, userID uuid.UUID) string {
+	tokenString, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	claims, err := sessionService.ValidateAccessToken(tokenString)
+	if err != nil || claims.UserID != userID.String() {
+		return ""
+	}
+	return claims.SessionID
+}
+
+// authenticatePasswordAndDevice checks a password and then a device OTP, which
+// must belong to the same user. It writes the error response itself on failure.
+func authenticatePasswordAndDevice(c *gin.Context, authService *services.AuthService, passwordService *services.PasswordService, username, password, deviceType, authCode, permission string) (*database.User, *database.Device, bool) {
+	passwordUser, err := passwordService.VerifyPassword(username, password)
+	if err != nil {
+		serviceErrorResponse(c, http.StatusUnauthorized, err)
+		return nil, nil, false
+	}
+
+	user, device, err := authService.AuthenticateDeviceContext(c.Request.Context(), deviceType, authCode, permission)
+	if err != nil {
+		serviceErrorResponse(c, http.StatusUnauthorized, err)
+		return nil, nil, false
+	}
+	if user.ID != passwordUser.ID {
+		errorResponse(c, http.StatusUnauthorized, "device does not belong to this user")
+		return nil, nil, false
+	}
+
+	authService.LogAuthentication(map[string]interface{}{
+		"user_id":    user.ID,
+		"device_id":  device.ID,
+		"type":       "login",
+		"success":    true,
+		"ip_address": c.ClientIP(),
+		"user_agent": c.GetHeader("User-Agent"),
+		"request_id": c.GetString("request_id"),
+		"details": map[string]interface{}{
+			"method":      "password",
+			"device_type": device.Type,
+		},
+	})
+
+	return user, device, true
+}
+
+// requestPasswordResetRequest is the body of POST /auth/password/reset-request
+type requestPasswordResetRequest struct {
+	Username string `json:"username" binding:"required" doc:"Username or email"`
+	Nonce    string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handlePasswordResetRequest handles POST /auth/password/reset-request. The
+// response is the same whether or not the account exists.
+func handlePasswordResetRequest(resetService *services.PasswordResetService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req requestPasswordResetRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		if err := resetService.RequestReset(req.Username, passwordResetContext(c)); err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		successResponse(c, messageBody{Message: "If the account has a verified email device, a password reset link has been sent to it"})
+	}
+}
+
+// resetPasswordRequest is the body of POST /auth/password/reset
+type resetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+	Nonce       string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handlePasswordReset handles POST /auth/password/reset
+func handlePasswordReset(resetService *services.PasswordResetService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req resetPasswordRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		if err := resetService.ResetPassword(req.Token, req.NewPassword, passwordResetContext(c)); err != nil {
+			serviceErrorResponse(c, http.StatusBadRequest, err)
+			return
+		}
+
+		successResponse(c, messageBody{Message: "Password has been reset"})
+	}
+}
+
+// passwordResetLogBody is an entry in the password reset log
+type passwordResetLogBody struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     *uuid.UUID `json:"user_id" doc:"Empty when the identifier matched no account"`
+	Identifier string     `json:"identifier" doc:"Username or email the reset was requested for"`
+	Event      string     `json:"event" enum:"requested,rate_limited,completed,failed"`
+	Reason     string     `json:"reason"`
+	IPAddress  string     `json:"ip_address"`
+	UserAgent  string     `json:"user_agent"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// handleListPasswordResetLogs handles GET /password-resets
+func handleListPasswordResetLogs(resetService *services.PasswordResetService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var userID *uuid.UUID
+		if userIDParam := c.Query("user_id"); userIDParam != "" {
+			parsed, err := uuid.Parse(userIDParam)
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Invalid user ID")
+				return
+			}
+			userID = &parsed
+		}
+
+		entries, err := resetService.ListResetLogs(userID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		entryList := make([]passwordResetLogBody, len(entries))
+		for i, entry := range entries {
+			entryList[i] = passwordResetLogBody{
+				ID:         entry.ID,
+				UserID:     entry.UserID,
+				Identifier: entry.Identifier,
+				Event:      entry.Event,
+				Reason:     entry.Reason,
+				IPAddress:  entry.IPAddress,
+				UserAgent:  entry.UserAgent,
+				CreatedAt:  entry.CreatedAt,
+			}
+		}
+
+		listResponse(c, entryList, int64(len(entryList)))
+	}
+}
+
+// loginNotificationBody is a security email for a sign-in from a new device
+// or IP address
+type loginNotificationBody struct {
+	ID        uuid.UUID  `json:"id"`
+	UserID    uuid.UUID  `json:"user_id"`
+	DeviceID  *uuid.UUID `json:"device_id"`
+	IPAddress string     `json:"ip_address"`
+	UserAgent string     `json:"user_agent"`
+	NewDevice bool       `json:"new_device"`
+	NewIP     bool       `json:"new_ip"`
+	Email     string     `json:"email"`
+	Status    string     `json:"status" enum:"sent,failed,skipped"`
+	Reason    string     `json:"reason"`
+	RequestID string     `json:"request_id"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// handleListLoginNotifications handles GET /login-notifications
+func handleListLoginNotifications(loginNotifications *services.LoginNotificationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var userID *uuid.UUID
+		if userIDParam := c.Query("user_id"); userIDParam != "" {
+			parsed, err := uuid.Parse(userIDParam)
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Invalid user ID")
+				return
+			}
+			userID = &parsed
+		}
+
+		entries, err := loginNotifications.ListNotifications(userID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		entryList := make([]loginNotificationBody, len(entries))
+		for i, entry := range entries {
+			entryList[i] = loginNotificationBody{
+				ID:        entry.ID,
+				UserID:    entry.UserID,
+				DeviceID:  entry.DeviceID,
+				IPAddress: entry.IPAddress,
+				UserAgent: entry.UserAgent,
+				NewDevice: entry.NewDevice,
+				NewIP:     entry.NewIP,
+				Email:     entry.Email,
+				Status:    entry.Status,
+				Reason:    entry.Reason,
+				RequestID: entry.RequestID,
+				CreatedAt: entry.CreatedAt,
+			}
+		}
+
+		listResponse(c, entryList, int64(len(entryList)))
+	}
+}
+
+// ownLoginNotifications lets users list the login notifications sent to them,
+// with user_id set to their own ID
+func ownLoginNotifications(c *gin.Context, user *database.User) bool {
+	return c.Query("user_id") == user.ID.String()
+}
+
+// passwordResetContext captures the client behind a password reset request
+func passwordResetContext(c *gin.Context) services.PasswordResetContext {
+	return services.PasswordResetContext{
+		IPAddress:      c.ClientIP(),
+		UserAgent:      c.GetHeader("User-Agent"),
+		RequestID:      c.GetString("request_id"),
+		AcceptLanguage: c.GetHeader("Accept-Language"),
+	}
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// handlePermissionUsage handles GET /permissions/usage: when each role's
+// allow grants were last exercised, and the grants unused for unused_days
+func handlePermissionUsage(usageService *services.PermissionUsageService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var filter services.PermissionUsageFilter
+
+		roleID, err := parseOptionalUUID(c.Query("role_id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid role_id")
+			return
+		}
+		filter.RoleID = roleID
+		if daysStr := c.Query("unused_days"); daysStr != "" {
+			days, err := strconv.Atoi(daysStr)
+			if err != nil || days < 1 {
+				errorResponse(c, http.StatusBadRequest, "Invalid unused_days: must be a positive number of days")
+				return
+			}
+			filter.UnusedDays = days
+		}
+
+		report, err := usageService.GetUsage(filter, time.Now())
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, report)
+	}
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+)
+
+// GDPR export and erasure handlers
+
+// exportUserDataRequest is the body of POST /users/:id/export
+type exportUserDataRequest struct {
+	Reason string `json:"reason"`
+	Nonce  string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleExportUserData handles POST /users/:id/export
+func handleExportUserData(privacyService *services.PrivacyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+
+		var req exportUserDataRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				bindErrorResponse(c, err)
+				return
+			}
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		export, err := privacyService.ExportUserData(userID, privacyRequestContext(c, req.Reason))
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if c.Query("download") == "true" {
+			c.Header("Content-Disposition", "attachment; filename=user-export-"+userID.String()+".json")
+		}
+
+		successResponse(c, export)
+	}
+}
+
+// eraseUserDataRequest is the body of POST /users/:id/erase
+type eraseUserDataRequest struct {
+	Reason string `json:"reason" binding:"required"`
+	Nonce  string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleEraseUserData handles POST /users/:id/erase
+func handleEraseUserData(privacyService *services.PrivacyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+
+		var req eraseUserDataRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		request, err := privacyService.EraseUserData(userID, privacyRequestContext(c, req.Reason))
+		if err != nil {
+			if services.IsPrivacyRejected(err) {
+				errorResponse(c, http.StatusConflict, "Erasure refused: "+err.Error())
+				return
+			}
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, privacyRequestResponse(request))
+	}
+}
+
+// handleListPrivacyRequests handles GET /privacy-requests
+func handleListPrivacyRequests(privacyService *services.PrivacyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var userID *uuid.UUID
+		if userIDParam := c.Query("user_id"); userIDParam != "" {
+			parsed, err := uuid.Parse(userIDParam)
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Invalid user ID")
+				return
+			}
+			userID = &parsed
+		}
+
+		requests, err := privacyService.ListPrivacyRequests(userID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		requestList := make([]privacyRequestBody, len(requests))
+		for i := range requests {
+			requestList[i] = privacyRequestResponse(&requests[i])
+		}
+
+		listResponse(c, requestList, int64(len(requestList)))
+	}
+}
+
+// privacyRequestContext captures the requester of a privacy request from the authenticated context
+func privacyRequestContext(c *gin.Context, reason string) services.PrivacyRequestContext {
+	return services.PrivacyRequestContext{
+		RequestedByID: c.MustGet("user_id").(uuid.UUID),
+		Reason:        reason,
+		IPAddress:     c.ClientIP(),
+		UserAgent:     c.GetHeader("User-Agent"),
+	}
+}
+
+// privacyRequestBody is the API representation of a privacy request audit entry
+type privacyRequestBody struct {
+	ID            uuid.UUID              `json:"id"`
+	Type          string                 `json:"type" enum:"export,erase"`
+	SubjectUserID *uuid.UUID             `json:"subject_user_id" doc:"Empty once the user has been purged"`
+	RequestedByID uuid.UUID              `json:"requested_by_id"`
+	Reason        string                 `json:"reason"`
+	Status        string                 `json:"status" enum:"completed,rejected,failed"`
+	Error         string                 `json:"error"`
+	Summary       map[string]interface{} `json:"summary" doc:"Record counts exported or anonymized"`
+	IPAddress     string                 `json:"ip_address"`
+	CreatedAt     time.Time              `json:"created_at"`
+	RequestedBy   string                 `json:"requested_by,omitempty"`
+}
+
+// privacyRequestResponse formats a privacy request audit entry for API responses
+func privacyRequestResponse(request *database.PrivacyRequest) privacyRequestBody {
+	var summary map[string]interface{}
+	if request.Summary.Status == pgtype.Present {
+		request.Summary.AssignTo(&summary)
+	}
+
+	response := privacyRequestBody{
+		ID:            request.ID,
+		Type:          request.Type,
+		SubjectUserID: request.SubjectUserID,
+		RequestedByID: request.RequestedByID,
+		Reason:        request.Reason,
+		Status:        request.Status,
+		Error:         request.Error,
+		Summary:       summary,
+		IPAddress:     request.IPAddress,
+		CreatedAt:     request.CreatedAt,
+	}
+	if request.RequestedBy.ID != uuid.Nil {
+		response.RequestedBy = request.RequestedBy.Username
+	}
+	return response
+}
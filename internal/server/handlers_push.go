@@ -0,0 +1,147 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Push approval handlers
+
+// startPushChallengeRequest is the body of POST /auth/push
+type startPushChallengeRequest struct {
+	Username   string `json:"username" binding:"required" doc:"Username or email"`
+	Permission string `json:"permission" doc:"Permission the challenge will be redeemed for, shown in the app"`
+}
+
+// pushChallengeStartBody is a push challenge just sent to the user's devices
+type pushChallengeStartBody struct {
+	ChallengeID string    `json:"challenge_id"`
+	Status      string    `json:"status" enum:"pending,approved,denied,redeemed"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	Number      int       `json:"number,omitempty" doc:"Show to the user to enter in the app; only with push.number_matching"`
+}
+
+// handleStartPushChallenge handles POST /auth/push. It sends a challenge to
+// the user's push devices and returns its ID, with the number the user must
+// enter in the app when push.number_matching is on; the client shows the
+// number and waits on GET /auth/push/{id}.
+func handleStartPushChallenge(pushService *services.PushService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req startPushChallengeRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		challenge, err := pushService.Challenge(c.Request.Context(), services.PushChallengeRequest{
+			Login:      req.Username,
+			Permission: req.Permission,
+			IPAddress:  c.ClientIP(),
+			UserAgent:  c.GetHeader("User-Agent"),
+		})
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, pushChallengeStartBody{
+			ChallengeID: challenge.ID,
+			Status:      challenge.Status,
+			ExpiresAt:   challenge.ExpiresAt,
+			Number:      challenge.Number,
+		})
+	}
+}
+
+// pushChallengeStatusBody is where a push challenge stands
+type pushChallengeStatusBody struct {
+	ChallengeID string    `json:"challenge_id"`
+	Status      string    `json:"status" enum:"pending,approved,denied,redeemed"`
+	Reason      string    `json:"reason" doc:"Why the challenge was denied: denied or number_mismatch"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// handleWaitPushChallenge handles GET /auth/push/{id}. With ?wait=30s it holds
+// the request until the challenge is answered, for at most push.max_wait.
+func handleWaitPushChallenge(pushService *services.PushService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var wait time.Duration
+		if waitStr := c.Query("wait"); waitStr != "" {
+			var err error
+			if wait, err = time.ParseDuration(waitStr); err != nil || wait < 0 {
+				errorResponse(c, http.StatusBadRequest, "Invalid wait: use a duration such as 30s")
+				return
+			}
+		}
+
+		challenge, err := pushService.Wait(c.Request.Context(), c.Param("id"), wait)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, pushChallengeStatusBody{
+			ChallengeID: challenge.ID,
+			Status:      challenge.Status,
+			Reason:      challenge.Reason,
+			ExpiresAt:   challenge.ExpiresAt,
+		})
+	}
+}
+
+// answerPushChallengeRequest is the body of POST /push/challenges/{id}/answer
+type answerPushChallengeRequest struct {
+	DeviceID      string `json:"device_id" binding:"required" format:"uuid"`
+	ResponseToken string `json:"response_token" binding:"required"`
+	Approve       bool   `json:"approve"`
+	Number        int    `json:"number" doc:"The number shown at sign-in"`
+	PushToken     string `json:"push_token" doc:"The app's current FCM or APNs token, when it has changed"`
+}
+
+// pushAnswerBody is a push challenge as the app's answer left it
+type pushAnswerBody struct {
+	ChallengeID string `json:"challenge_id"`
+	Status      string `json:"status" enum:"pending,approved,denied,redeemed"`
+	Reason      string `json:"reason" doc:"Why the challenge was denied: denied or number_mismatch"`
+}
+
+// handleAnswerPushChallenge handles POST /push/challenges/{id}/answer, called
+// by the mobile app with the device ID and response token the push carried
+func handleAnswerPushChallenge(pushService *services.PushService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req answerPushChallengeRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+		deviceID, err := uuid.Parse(req.DeviceID)
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid device_id")
+			return
+		}
+
+		challenge, err := pushService.Answer(c.Request.Context(), c.Param("id"), services.PushAnswer{
+			DeviceID:  deviceID,
+			Token:     req.ResponseToken,
+			Approve:   req.Approve,
+			Number:    req.Number,
+			PushToken: req.PushToken,
+		})
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, pushAnswerBody{
+			ChallengeID: challenge.ID,
+			Status:      challenge.Status,
+			Reason:      challenge.Reason,
+		})
+	}
+}
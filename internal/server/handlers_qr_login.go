@@ -0,0 +1,199 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// QR login handlers
+
+// qrPollTokenHeader carries the poll token a terminal was given with its challenge
+const qrPollTokenHeader = "X-QR-Poll-Token"
+
+// startQRLoginRequest is the body of POST /auth/qr
+type startQRLoginRequest struct {
+	Terminal string `json:"terminal" binding:"max=100" doc:"Name shown on the phone when approving"`
+}
+
+// qrLoginStartBody is a new QR login challenge, with what only the terminal
+// is given
+type qrLoginStartBody struct {
+	ChallengeID string    `json:"challenge_id"`
+	PollToken   string    `json:"poll_token" doc:"Send in the X-QR-Poll-Token header when polling"`
+	QRPayload   string    `json:"qr_payload" doc:"Show as a QR code for a signed-in phone to scan"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// handleStartQRLogin handles POST /auth/qr. A shared terminal gets a challenge
+// to show as a QR code and the poll token it alone waits on the answer with.
+func handleStartQRLogin(qrLoginService *services.QRLoginService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req startQRLoginRequest
+
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				bindErrorResponse(c, err)
+				return
+			}
+		}
+
+		start, err := qrLoginService.Start(c.Request.Context(), req.Terminal, sessionClient(c))
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, qrLoginStartBody{
+			ChallengeID: start.Challenge.ID,
+			PollToken:   start.PollToken,
+			QRPayload:   start.QRPayload,
+			ExpiresAt:   start.Challenge.ExpiresAt,
+		})
+	}
+}
+
+// qrLoginStatusBody is a QR login challenge that has not yet given the
+// terminal a session
+type qrLoginStatusBody struct {
+	ChallengeID string    `json:"challenge_id"`
+	Status      string    `json:"status" enum:"pending,approved,rejected,redeemed"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// qrLoginSessionBody is the terminal's session from an approved QR login
+type qrLoginSessionBody struct {
+	qrLoginStatusBody
+	SessionID    string          `json:"session_id" format:"uuid"`
+	AccessToken  string          `json:"access_token"`
+	RefreshToken string          `json:"refresh_token"`
+	ReadOnly     bool            `json:"read_only"`
+	CrossDevice  bool            `json:"cross_device"`
+	User         sessionUserBody `json:"user"`
+}
+
+// handlePollQRLogin handles GET /auth/qr/{id}, with the poll token in the
+// X-QR-Poll-Token header. With ?wait=25s it holds the request until the
+// challenge is decided, for at most qr_login.max_wait. Once approved, the
+// first poll gets the terminal's session.
+func handlePollQRLogin(qrLoginService *services.QRLoginService, sessionService *services.SessionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var wait time.Duration
+		if waitStr := c.Query("wait"); waitStr != "" {
+			var err error
+			if wait, err = time.ParseDuration(waitStr); err != nil || wait < 0 {
+				errorResponse(c, http.StatusBadRequest, "Invalid wait: use a duration such as 25s")
+				return
+			}
+		}
+		pollToken := c.GetHeader(qrPollTokenHeader)
+		if pollToken == "" {
+			errorResponse(c, http.StatusUnauthorized, qrPollTokenHeader+" header is required")
+			return
+		}
+
+		challenge, session, user, err := qrLoginService.Poll(c.Request.Context(), c.Param("id"), pollToken, wait, sessionClient(c))
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+		if session == nil {
+			itemResponse(c, qrLoginStatusBody{
+				ChallengeID: challenge.ID,
+				Status:      challenge.Status,
+				ExpiresAt:   challenge.ExpiresAt,
+			})
+			return
+		}
+
+		accessToken, err := sessionService.GenerateAccessToken(session)
+		if err != nil {
+			errorResponse(c, http.StatusInternalServerError, "Failed to generate access token: "+err.Error())
+			return
+		}
+		refreshToken, err := sessionService.GenerateRefreshToken(session)
+		if err != nil {
+			errorResponse(c, http.StatusInternalServerError, "Failed to generate refresh token: "+err.Error())
+			return
+		}
+
+		itemResponse(c, qrLoginSessionBody{
+			qrLoginStatusBody: qrLoginStatusBody{
+				ChallengeID: challenge.ID,
+				Status:      challenge.Status,
+				ExpiresAt:   session.ExpiresAt,
+			},
+			SessionID:    session.ID,
+			AccessToken:  accessToken,
+			RefreshToken: refreshToken,
+			ReadOnly:     session.ReadOnly,
+			CrossDevice:  session.CrossDevice,
+			User:         sessionUserResponse(user),
+		})
+	}
+}
+
+// handleGetQRLogin handles GET /auth/qr/{id}/details, for the phone to show
+// which terminal is asking before the user approves
+func handleGetQRLogin(qrLoginService *services.QRLoginService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		challenge, err := qrLoginService.Get(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, qrLoginResponse(challenge))
+	}
+}
+
+// handleDecideQRLogin handles POST /auth/qr/{id}/approve and /reject, from
+// the phone of a signed-in user
+func handleDecideQRLogin(qrLoginService *services.QRLoginService, approve bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet("user").(*database.User)
+		var session *database.Session
+		var deviceID uuid.UUID
+		if current, ok := c.Get("session"); ok {
+			session = current.(*database.Session)
+			deviceID = session.DeviceID
+		} else if device, ok := c.Get("device"); ok {
+			deviceID = device.(*database.Device).ID
+		}
+
+		challenge, err := qrLoginService.Decide(c.Request.Context(), c.Param("id"), user, deviceID, session, approve)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, qrLoginResponse(challenge))
+	}
+}
+
+// qrLoginBody is a QR login challenge as the approving phone sees it
+type qrLoginBody struct {
+	ChallengeID string    `json:"challenge_id"`
+	Status      string    `json:"status" enum:"pending,approved,rejected,redeemed"`
+	Terminal    string    `json:"terminal" doc:"Name the terminal gave itself"`
+	IPAddress   string    `json:"ip_address"`
+	UserAgent   string    `json:"user_agent"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// qrLoginResponse is the API representation of a QR login challenge, without
+// its poll token
+func qrLoginResponse(challenge *services.QRLoginChallenge) qrLoginBody {
+	return qrLoginBody{
+		ChallengeID: challenge.ID,
+		Status:      challenge.Status,
+		Terminal:    challenge.Terminal,
+		IPAddress:   challenge.IPAddress,
+		UserAgent:   challenge.UserAgent,
+		ExpiresAt:   challenge.ExpiresAt,
+	}
+}
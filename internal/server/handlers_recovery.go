@@ -0,0 +1,177 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Recovery code handlers
+
+// recoveryRequest is the body of POST /auth/recovery
+type recoveryRequest struct {
+	Username     string `json:"username" binding:"required" doc:"Username or email"`
+	Password     string `json:"password" binding:"required"`
+	RecoveryCode string `json:"recovery_code" binding:"required"`
+	Nonce        string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// recoverySessionBody is the response of a recovery sign-in
+type recoverySessionBody struct {
+	Authenticated  bool            `json:"authenticated"`
+	SessionID      string          `json:"session_id" format:"uuid"`
+	AccessToken    string          `json:"access_token"`
+	RefreshToken   string          `json:"refresh_token"`
+	ExpiresAt      time.Time       `json:"expires_at"`
+	ReadOnly       bool            `json:"read_only"`
+	Recovery       bool            `json:"recovery"`
+	CodesRemaining int64           `json:"codes_remaining" doc:"Unused recovery codes left"`
+	IncidentID     uuid.UUID       `json:"incident_id" doc:"The incident opened for an admin to issue a replacement device"`
+	User           sessionUserBody `json:"user"`
+}
+
+// handleRecovery handles POST /auth/recovery. A user whose device is lost signs
+// in with their password and a recovery code instead of an OTP; the session is
+// read-only and limited to recovery.permissions, and an incident is opened for
+// an admin to issue a replacement device.
+func handleRecovery(recoveryService *services.RecoveryService, sessionService *services.SessionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req recoveryRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		result, err := recoveryService.Recover(req.Username, req.Password, req.RecoveryCode, sessionClient(c))
+		if err != nil {
+			serviceErrorResponse(c, http.StatusUnauthorized, err)
+			return
+		}
+
+		accessToken, err := sessionService.GenerateAccessToken(result.Session)
+		if err != nil {
+			errorResponse(c, http.StatusInternalServerError, "Failed to generate access token: "+err.Error())
+			return
+		}
+		refreshToken, err := sessionService.GenerateRefreshToken(result.Session)
+		if err != nil {
+			errorResponse(c, http.StatusInternalServerError, "Failed to generate refresh token: "+err.Error())
+			return
+		}
+
+		successResponse(c, recoverySessionBody{
+			Authenticated:  true,
+			SessionID:      result.Session.ID,
+			AccessToken:    accessToken,
+			RefreshToken:   refreshToken,
+			ExpiresAt:      result.Session.ExpiresAt,
+			ReadOnly:       true,
+			Recovery:       true,
+			CodesRemaining: result.CodesRemaining,
+			IncidentID:     result.Incident.ID,
+			User:           sessionUserResponse(result.User),
+		})
+	}
+}
+
+// generateOwnRecoveryCodesRequest is the body of POST /auth/recovery-codes
+type generateOwnRecoveryCodesRequest struct {
+	DeviceType string `json:"device_type" binding:"required"`
+	AuthCode   string `json:"auth_code" binding:"required"`
+	Nonce      string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleGenerateOwnRecoveryCodes handles POST /auth/recovery-codes: users
+// authenticate with one of their devices, typically when enrolling it, and get
+// a new set of recovery codes to print
+func handleGenerateOwnRecoveryCodes(authService *services.AuthService, recoveryService *services.RecoveryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req generateOwnRecoveryCodesRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		user, _, err := authService.AuthenticateDeviceContext(c.Request.Context(), req.DeviceType, req.AuthCode, "")
+		if err != nil {
+			serviceErrorResponse(c, http.StatusUnauthorized, err)
+			return
+		}
+
+		recoveryCodesResponse(c, recoveryService, user.ID)
+	}
+}
+
+// handleGenerateRecoveryCodes handles POST /users/:id/recovery-codes, an admin
+// issuing a user a new set of recovery codes
+func handleGenerateRecoveryCodes(recoveryService *services.RecoveryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+
+		recoveryCodesResponse(c, recoveryService, userID)
+	}
+}
+
+// recoveryCodesRemainingBody counts a user's unused recovery codes
+type recoveryCodesRemainingBody struct {
+	UserID         uuid.UUID `json:"user_id"`
+	CodesRemaining int64     `json:"codes_remaining"`
+}
+
+// handleGetRecoveryCodes handles GET /users/:id/recovery-codes. The codes
+// themselves cannot be read back, only how many are left.
+func handleGetRecoveryCodes(recoveryService *services.RecoveryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+
+		remaining, err := recoveryService.RecoveryCodesRemaining(userID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		successResponse(c, recoveryCodesRemainingBody{UserID: userID, CodesRemaining: remaining})
+	}
+}
+
+// recoveryCodesBody is a new set of recovery codes
+type recoveryCodesBody struct {
+	UserID  uuid.UUID `json:"user_id"`
+	Codes   []string  `json:"codes" doc:"Single-use codes, e.g. k7m2p-x9qrt"`
+	Message string    `json:"message"`
+}
+
+// recoveryCodesResponse replaces a user's recovery codes and returns the new
+// ones; they are not shown again
+func recoveryCodesResponse(c *gin.Context, recoveryService *services.RecoveryService, userID uuid.UUID) {
+	codes, err := recoveryService.GenerateRecoveryCodes(userID)
+	if err != nil {
+		serviceErrorResponse(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	createdResponse(c, recoveryCodesBody{
+		UserID:  userID,
+		Codes:   codes,
+		Message: "Store these codes somewhere safe; each works once and they will not be shown again",
+	})
+}
@@ -0,0 +1,351 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+)
+
+// Report builder handlers
+
+// createCustomReportRequest is the body of POST /reports
+type createCustomReportRequest struct {
+	services.CustomReport
+	Nonce string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleCreateCustomReport handles POST /reports. The report is generated by
+// the job queue; the response points at the job's status and result.
+func handleCreateCustomReport(reportService *services.ReportService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req createCustomReportRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		userID := c.MustGet("user_id").(uuid.UUID)
+		job, err := reportService.CreateCustomReportJob(&userID, req.CustomReport, nil)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		responseWithNonce(c, http.StatusAccepted, reportJobAcceptedResponse(job))
+	}
+}
+
+// handleListReportJobs handles GET /reports
+func handleListReportJobs(reportService *services.ReportService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := services.ReportJobFilter{
+			ReportType: c.Query("report_type"),
+			Status:     c.Query("status"),
+			Limit:      50,
+		}
+
+		var err error
+		if filter.DefinitionID, err = parseOptionalUUID(c.Query("definition_id")); err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid definition_id")
+			return
+		}
+		if limitStr := c.Query("limit"); limitStr != "" {
+			if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+				filter.Limit = l
+			}
+		}
+		if offsetStr := c.Query("offset"); offsetStr != "" {
+			if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+				filter.Offset = o
+			}
+		}
+
+		reportJobs, total, err := reportService.ListReportJobs(filter)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		jobList := make([]reportJobBody, len(reportJobs))
+		for i := range reportJobs {
+			jobList[i] = reportJobResponse(&reportJobs[i])
+		}
+
+		listResponse(c, jobList, total)
+	}
+}
+
+// handleListReportDefinitions handles GET /reports/definitions
+func handleListReportDefinitions(reportService *services.ReportService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, offset := 50, 0
+		if limitStr := c.Query("limit"); limitStr != "" {
+			if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+				limit = l
+			}
+		}
+		if offsetStr := c.Query("offset"); offsetStr != "" {
+			if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+				offset = o
+			}
+		}
+
+		definitions, total, err := reportService.ListReportDefinitions(limit, offset)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		definitionList := make([]reportDefinitionBody, len(definitions))
+		for i := range definitions {
+			definitionList[i] = reportDefinitionResponse(&definitions[i])
+		}
+
+		listResponse(c, definitionList, total)
+	}
+}
+
+// createReportDefinitionRequest is the body of POST /reports/definitions
+type createReportDefinitionRequest struct {
+	Name        string                 `json:"name" binding:"required"`
+	Description string                 `json:"description"`
+	Definition  *services.CustomReport `json:"definition" binding:"required"`
+	Schedule    string                 `json:"schedule" doc:"Cron expression in the definition's timezone; empty runs only by hand"`
+	Active      *bool                  `json:"active"`
+	Nonce       string                 `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleCreateReportDefinition handles POST /reports/definitions
+func handleCreateReportDefinition(reportService *services.ReportService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req createReportDefinitionRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		active := true
+		if req.Active != nil {
+			active = *req.Active
+		}
+
+		definition, err := reportService.CreateReportDefinition(req.Name, req.Description, *req.Definition, req.Schedule, active, c.MustGet("user_id").(uuid.UUID))
+		if err != nil {
+			serviceErrorResponse(c, http.StatusBadRequest, err)
+			return
+		}
+
+		createdResponse(c, reportDefinitionResponse(definition))
+	}
+}
+
+// handleGetReportDefinition handles GET /reports/definitions/:id
+func handleGetReportDefinition(reportService *services.ReportService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid report definition ID")
+			return
+		}
+
+		definition, err := reportService.GetReportDefinition(id)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, reportDefinitionResponse(definition))
+	}
+}
+
+// updateReportDefinitionRequest is the body of PUT /reports/definitions/:id
+type updateReportDefinitionRequest struct {
+	Name        *string                `json:"name"`
+	Description *string                `json:"description"`
+	Definition  *services.CustomReport `json:"definition"`
+	Schedule    *string                `json:"schedule" doc:"Empty stops scheduled runs"`
+	Active      *bool                  `json:"active"`
+	Version     *int                   `json:"version" doc:"Version the update is based on; updates based on an older version are rejected"`
+	Nonce       string                 `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleUpdateReportDefinition handles PUT /reports/definitions/:id
+func handleUpdateReportDefinition(reportService *services.ReportService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid report definition ID")
+			return
+		}
+
+		var req updateReportDefinitionRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		update := services.ReportDefinitionUpdate{
+			Name:        req.Name,
+			Description: req.Description,
+			Report:      req.Definition,
+			Schedule:    req.Schedule,
+			Active:      req.Active,
+		}
+		definition, err := reportService.UpdateReportDefinition(id, update, req.Version)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusBadRequest, err)
+			return
+		}
+
+		itemResponse(c, reportDefinitionResponse(definition))
+	}
+}
+
+// handleDeleteReportDefinition handles DELETE /reports/definitions/:id
+func handleDeleteReportDefinition(reportService *services.ReportService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid report definition ID")
+			return
+		}
+
+		if err := reportService.DeleteReportDefinition(id); err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		deletedResponse(c)
+	}
+}
+
+// handleRunReportDefinition handles POST /reports/definitions/:id/run
+func handleRunReportDefinition(reportService *services.ReportService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid report definition ID")
+			return
+		}
+
+		job, err := reportService.RunReportDefinition(id, c.MustGet("user_id").(uuid.UUID))
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		responseWithNonce(c, http.StatusAccepted, reportJobAcceptedResponse(job))
+	}
+}
+
+// reportJobBody is the API representation of a report job, without its result
+type reportJobBody struct {
+	ID            uuid.UUID              `json:"id"`
+	ReportType    string                 `json:"report_type" enum:"timesheet,custom"`
+	Format        string                 `json:"format"`
+	Parameters    map[string]interface{} `json:"parameters"`
+	DefinitionID  *uuid.UUID             `json:"definition_id" doc:"The saved definition the job ran"`
+	RequestedByID *uuid.UUID             `json:"requested_by_id" doc:"Empty for scheduled runs"`
+	Status        string                 `json:"status" enum:"pending,running,completed,failed"`
+	Error         string                 `json:"error"`
+	CreatedAt     time.Time              `json:"created_at"`
+	CompletedAt   *time.Time             `json:"completed_at"`
+	DownloadURL   string                 `json:"download_url,omitempty" doc:"Set once completed"`
+}
+
+// reportJobResponse is the API representation of a report job, without its result
+func reportJobResponse(job *database.ReportJob) reportJobBody {
+	var parameters map[string]interface{}
+	if job.Parameters.Status == pgtype.Present {
+		job.Parameters.AssignTo(&parameters)
+	}
+
+	response := reportJobBody{
+		ID:            job.ID,
+		ReportType:    job.ReportType,
+		Format:        job.Format,
+		Parameters:    parameters,
+		DefinitionID:  job.DefinitionID,
+		RequestedByID: job.RequestedByID,
+		Status:        job.Status,
+		Error:         job.Error,
+		CreatedAt:     job.CreatedAt,
+		CompletedAt:   job.CompletedAt,
+	}
+	if job.Status == "completed" {
+		response.DownloadURL = fmt.Sprintf("/api/v1/reports/jobs/%s/download", job.ID)
+	}
+	return response
+}
+
+// reportJobAcceptedBody is the response to a report queued as a job
+type reportJobAcceptedBody struct {
+	Job       reportJobBody `json:"job"`
+	StatusURL string        `json:"status_url" doc:"Where the job's status can be polled"`
+}
+
+// reportJobAcceptedResponse formats a queued report job for API responses
+func reportJobAcceptedResponse(job *database.ReportJob) reportJobAcceptedBody {
+	return reportJobAcceptedBody{
+		Job:       reportJobResponse(job),
+		StatusURL: fmt.Sprintf("/api/v1/reports/jobs/%s", job.ID),
+	}
+}
+
+// reportDefinitionBody is the API representation of a saved report definition
+type reportDefinitionBody struct {
+	ID          uuid.UUID              `json:"id"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Definition  *services.CustomReport `json:"definition"`
+	Schedule    string                 `json:"schedule" doc:"Cron expression, e.g. 0 6 * * 1; empty runs only by hand"`
+	Active      bool                   `json:"active"`
+	Version     int                    `json:"version" doc:"Bumped by every update"`
+	NextRunAt   *time.Time             `json:"next_run_at" doc:"Null when unscheduled or inactive"`
+	LastRunAt   *time.Time             `json:"last_run_at"`
+	CreatedByID *uuid.UUID             `json:"created_by_id" doc:"Null once the user has been deleted"`
+	CreatedAt   time.Time              `json:"created_at"`
+	UpdatedAt   time.Time              `json:"updated_at"`
+}
+
+func (reportDefinitionBody) schemaDescription() string {
+	return "A custom report saved to be run by hand or on its schedule"
+}
+
+// reportDefinitionResponse is the API representation of a saved report definition
+func reportDefinitionResponse(definition *database.ReportDefinition) reportDefinitionBody {
+	report, _ := services.ParseReportDefinition(definition)
+	return reportDefinitionBody{
+		ID:          definition.ID,
+		Name:        definition.Name,
+		Description: definition.Description,
+		Definition:  report,
+		Schedule:    definition.Schedule,
+		Active:      definition.Active,
+		Version:     definition.Version,
+		NextRunAt:   definition.NextRunAt,
+		LastRunAt:   definition.LastRunAt,
+		CreatedByID: definition.CreatedByID,
+		CreatedAt:   definition.CreatedAt,
+		UpdatedAt:   definition.UpdatedAt,
+	}
+}
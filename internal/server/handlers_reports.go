@@ -0,0 +1,352 @@
+package server
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Report API handlers
+
+// handleGetTimesheet handles GET /reports/timesheet
+func handleGetTimesheet(reportService *services.ReportService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := services.TimesheetFilter{}
+
+		if userIDsStr := c.Query("user_ids"); userIDsStr != "" {
+			userIDs, err := parseUUIDArray(userIDsStr)
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Invalid user_ids format")
+				return
+			}
+			filter.UserIDs = userIDs
+		}
+
+		from, err := parseReportTime(c.Query("from"), false)
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid or missing 'from': "+err.Error())
+			return
+		}
+		to, err := parseReportTime(c.Query("to"), true)
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid or missing 'to': "+err.Error())
+			return
+		}
+		if !to.After(from) {
+			errorResponse(c, http.StatusBadRequest, "'to' must be after 'from'")
+			return
+		}
+		filter.From = from
+		filter.To = to
+
+		format := c.DefaultQuery("format", "json")
+		validFormat := false
+		for _, f := range services.ValidTimesheetFormats {
+			if format == f {
+				validFormat = true
+				break
+			}
+		}
+		if !validFormat {
+			errorResponse(c, http.StatusBadRequest, fmt.Sprintf("Invalid format. Must be one of: %v", services.ValidTimesheetFormats))
+			return
+		}
+
+		// Large ranges (or explicit async requests) are generated in the background
+		if c.Query("async") == "true" || reportService.IsLargeTimesheetRange(filter) {
+			job, err := reportService.CreateTimesheetJob(c.MustGet("user_id").(uuid.UUID), filter, format)
+			if err != nil {
+				serviceErrorResponse(c, http.StatusInternalServerError, fmt.Errorf("Failed to create report job: %w", err))
+				return
+			}
+
+			responseWithNonce(c, http.StatusAccepted, reportJobAcceptedResponse(job))
+			return
+		}
+
+		switch format {
+		case "json":
+			days, err := reportService.GenerateTimesheet(filter)
+			if err != nil {
+				serviceErrorResponse(c, http.StatusInternalServerError, fmt.Errorf("Failed to generate timesheet: %w", err))
+				return
+			}
+			successResponse(c, timesheetBody{
+				Data: days,
+				Meta: timesheetMeta{From: filter.From, To: filter.To, UserIDs: filter.UserIDs},
+			})
+		default:
+			c.Header("Content-Type", services.TimesheetContentType(format))
+			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=timesheet-%s-%s.%s",
+				filter.From.Format("20060102"), filter.To.Format("20060102"), format))
+			c.Status(http.StatusOK)
+
+			// Headers are already sent, so errors can only be recorded at this point
+			if err := reportService.WriteTimesheet(c.Writer, filter, format); err != nil {
+				c.Error(err)
+			}
+		}
+	}
+}
+
+// timesheetBody is the JSON form of the timesheet report
+type timesheetBody struct {
+	Data []services.TimesheetDay `json:"data"`
+	Meta timesheetMeta           `json:"meta"`
+}
+
+// timesheetMeta is the selection a timesheet covers
+type timesheetMeta struct {
+	From    time.Time   `json:"from"`
+	To      time.Time   `json:"to"`
+	UserIDs []uuid.UUID `json:"user_ids"`
+}
+
+// handleGetReportJob handles GET /reports/jobs/:id
+func handleGetReportJob(reportService *services.ReportService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		jobID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid report job ID")
+			return
+		}
+
+		job, err := reportService.GetReportJob(jobID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, reportJobResponse(job))
+	}
+}
+
+// handleDownloadReportJob handles GET /reports/jobs/:id/download
+func handleDownloadReportJob(reportService *services.ReportService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		jobID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid report job ID")
+			return
+		}
+
+		job, err := reportService.GetReportJob(jobID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if job.Status != "completed" {
+			errorResponse(c, http.StatusConflict, fmt.Sprintf("Report job is %s", job.Status))
+			return
+		}
+
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s-%s.%s", job.ReportType, job.ID, job.Format))
+		c.Data(http.StatusOK, services.TimesheetContentType(job.Format), job.Result)
+	}
+}
+
+// handleGetOccupancyReport handles GET /reports/occupancy
+func handleGetOccupancyReport(locationService *services.LocationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := services.OccupancyFilter{Interval: c.DefaultQuery("interval", "hour")}
+
+		if locationIDsStr := c.Query("location_ids"); locationIDsStr != "" {
+			locationIDs, err := parseUUIDArray(locationIDsStr)
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Invalid location_ids format")
+				return
+			}
+			filter.LocationIDs = locationIDs
+		}
+
+		var err error
+		if filter.From, err = parseReportTime(c.Query("from"), false); err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid or missing 'from': "+err.Error())
+			return
+		}
+		if filter.To, err = parseReportTime(c.Query("to"), true); err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid or missing 'to': "+err.Error())
+			return
+		}
+
+		format := c.DefaultQuery("format", "json")
+		if format != "json" && format != "csv" {
+			errorResponse(c, http.StatusBadRequest, "Invalid format. Must be one of: [json csv]")
+			return
+		}
+
+		periods, err := locationService.GetOccupancyHistory(filter)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if format == "json" {
+			successResponse(c, occupancyReportBody{
+				Data: periods,
+				Meta: occupancyReportMeta{
+					From:        filter.From,
+					To:          filter.To,
+					Interval:    filter.Interval,
+					LocationIDs: filter.LocationIDs,
+				},
+			})
+			return
+		}
+
+		c.Header("Content-Type", "text/csv")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=occupancy-%s-%s.csv",
+			filter.From.Format("20060102"), filter.To.Format("20060102")))
+		c.Status(http.StatusOK)
+
+		writer := csv.NewWriter(c.Writer)
+		writer.Write([]string{"location_id", "location_name", "period_start", "peak", "average", "capacity", "peak_utilization"})
+		for _, period := range periods {
+			capacity, utilization := "", ""
+			if period.Capacity != nil {
+				capacity = strconv.Itoa(*period.Capacity)
+			}
+			if period.PeakUtilization != nil {
+				utilization = strconv.FormatFloat(*period.PeakUtilization, 'f', 1, 64)
+			}
+			writer.Write([]string{
+				period.LocationID.String(),
+				period.LocationName,
+				period.PeriodStart.Format(time.RFC3339),
+				strconv.Itoa(period.Peak),
+				strconv.FormatFloat(period.Average, 'f', 2, 64),
+				capacity,
+				utilization,
+			})
+		}
+		writer.Flush()
+
+		// Headers are already sent, so errors can only be recorded at this point
+		if err := writer.Error(); err != nil {
+			c.Error(err)
+		}
+	}
+}
+
+// occupancyReportBody is the JSON form of the occupancy report
+type occupancyReportBody struct {
+	Data []services.OccupancyPeriod `json:"data"`
+	Meta occupancyReportMeta        `json:"meta"`
+}
+
+// occupancyReportMeta is the selection an occupancy report covers
+type occupancyReportMeta struct {
+	From        time.Time   `json:"from"`
+	To          time.Time   `json:"to"`
+	Interval    string      `json:"interval" enum:"hour,day"`
+	LocationIDs []uuid.UUID `json:"location_ids"`
+}
+
+// handleGetVisitorLog handles GET /reports/visitors, the visits of a day at
+// one location or at every active location
+func handleGetVisitorLog(visitorService *services.VisitorService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		date := c.DefaultQuery("date", time.Now().Format("2006-01-02"))
+
+		locationID, err := parseOptionalUUID(c.Query("location_id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid location_id")
+			return
+		}
+
+		format := c.DefaultQuery("format", "json")
+		if format != "json" && format != "csv" {
+			errorResponse(c, http.StatusBadRequest, "Invalid format. Must be one of: [json csv]")
+			return
+		}
+
+		entries, err := visitorService.DailyLog(date, locationID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if format == "json" {
+			successResponse(c, visitorLogBody{
+				Data: entries,
+				Meta: visitorLogMeta{Date: date, LocationID: locationID},
+			})
+			return
+		}
+
+		c.Header("Content-Type", "text/csv")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=visitors-%s.csv", date))
+		c.Status(http.StatusOK)
+
+		writer := csv.NewWriter(c.Writer)
+		writer.Write([]string{"location_id", "location_name", "date", "visitor_id", "name", "company", "host_user_id", "host_name", "scheduled_at", "status", "badge_number", "checked_in_at", "checked_out_at"})
+		for _, entry := range entries {
+			checkedIn, checkedOut := "", ""
+			if entry.CheckedInAt != nil {
+				checkedIn = entry.CheckedInAt.Format(time.RFC3339)
+			}
+			if entry.CheckedOutAt != nil {
+				checkedOut = entry.CheckedOutAt.Format(time.RFC3339)
+			}
+			writer.Write([]string{
+				entry.LocationID.String(),
+				entry.LocationName,
+				entry.Date,
+				entry.VisitorID.String(),
+				entry.Name,
+				entry.Company,
+				entry.HostUserID.String(),
+				entry.HostName,
+				entry.ScheduledAt.Format(time.RFC3339),
+				entry.Status,
+				entry.BadgeNumber,
+				checkedIn,
+				checkedOut,
+			})
+		}
+		writer.Flush()
+
+		// Headers are already sent, so errors can only be recorded at this point
+		if err := writer.Error(); err != nil {
+			c.Error(err)
+		}
+	}
+}
+
+// parseReportTime parses an RFC3339 timestamp or a YYYY-MM-DD date.
+// A bare date used as the end of a range covers the whole day.
+func parseReportTime(value string, endOfRange bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, fmt.Errorf("value is required")
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("use RFC3339 (e.g., 2023-01-01T00:00:00Z) or YYYY-MM-DD")
+	}
+	if endOfRange {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// visitorLogBody is the JSON form of the daily visitor log
+type visitorLogBody struct {
+	Data []services.VisitorLogEntry `json:"data"`
+	Meta visitorLogMeta             `json:"meta"`
+}
+
+// visitorLogMeta is the day and location a visitor log covers
+type visitorLogMeta struct {
+	Date       string     `json:"date" format:"date"`
+	LocationID *uuid.UUID `json:"location_id"`
+}
@@ -2,49 +2,46 @@ package server
 
 import (
 	"net/http"
+	"time"
 
-	"github.com/YubiApp/internal/services"
 	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
 // Resource API handlers
 
+// createResourceRequest is the body of POST /resources
+type createResourceRequest struct {
+	Name            string   `json:"name" binding:"required"`
+	Type            string   `json:"type" binding:"required"`
+	Location        string   `json:"location"`
+	Department      string   `json:"department"`
+	Active          bool     `json:"active"`
+	AllowedNetworks []string `json:"allowed_networks" doc:"CIDR ranges the resource's permissions may be used from; empty allows any network"`
+	Nonce           string   `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
 func handleCreateResource(resourceService *services.ResourceService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var req struct {
-			Name       string `json:"name" binding:"required"`
-			Type       string `json:"type" binding:"required"`
-			Location   string `json:"location"`
-			Department string `json:"department"`
-			Active     bool   `json:"active"`
-			Nonce      string `json:"nonce"` // Optional nonce for response signing
-		}
+		var req createResourceRequest
 
 		if err := c.ShouldBindJSON(&req); err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			bindErrorResponse(c, err)
 			return
 		}
 
 		// Store nonce in context for response functions to use
 		setRequestNonce(c, req.Nonce)
 
-		resource, err := resourceService.CreateResource(req.Name, req.Type, req.Location, req.Department, req.Active)
+		resource, err := resourceService.CreateResource(req.Name, req.Type, req.Location, req.Department, req.Active, req.AllowedNetworks)
 		if err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		createdResponse(c, gin.H{
-			"id":         resource.ID,
-			"name":       resource.Name,
-			"type":       resource.Type,
-			"location":   resource.Location,
-			"department": resource.Department,
-			"active":     resource.Active,
-			"created_at": resource.CreatedAt,
-		})
+		createdResponse(c, resourceResponse(resource))
 	}
 }
 
@@ -58,20 +55,11 @@ func handleGetResource(resourceService *services.ResourceService) gin.HandlerFun
 
 		resource, err := resourceService.GetResourceByID(resourceID)
 		if err != nil {
-			errorResponse(c, http.StatusNotFound, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		itemResponse(c, gin.H{
-			"id":         resource.ID,
-			"name":       resource.Name,
-			"type":       resource.Type,
-			"location":   resource.Location,
-			"department": resource.Department,
-			"active":     resource.Active,
-			"created_at": resource.CreatedAt,
-			"updated_at": resource.UpdatedAt,
-		})
+		itemResponse(c, resourceResponse(resource))
 	}
 }
 
@@ -86,29 +74,31 @@ func handleListResources(resourceService *services.ResourceService) gin.HandlerF
 			resources, err = resourceService.ListResources()
 		}
 		if err != nil {
-			errorResponse(c, http.StatusInternalServerError, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
 		// Build response
-		resourceList := make([]gin.H, len(resources))
-		for i, resource := range resources {
-			resourceList[i] = gin.H{
-				"id":         resource.ID,
-				"name":       resource.Name,
-				"type":       resource.Type,
-				"location":   resource.Location,
-				"department": resource.Department,
-				"active":     resource.Active,
-				"created_at": resource.CreatedAt,
-				"updated_at": resource.UpdatedAt,
-			}
+		resourceList := make([]resourceBody, len(resources))
+		for i := range resources {
+			resourceList[i] = resourceResponse(&resources[i])
 		}
 
 		listResponse(c, resourceList, int64(len(resourceList)))
 	}
 }
 
+// updateResourceRequest is the body of PUT /resources/:id
+type updateResourceRequest struct {
+	Name            *string  `json:"name"`
+	Type            *string  `json:"type"`
+	Location        *string  `json:"location"`
+	Department      *string  `json:"department"`
+	Active          *bool    `json:"active"`
+	AllowedNetworks []string `json:"allowed_networks" doc:"Replaces the allowed networks; an empty list allows any network"`
+	Nonce           string   `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
 func handleUpdateResource(resourceService *services.ResourceService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		resourceID, err := uuid.Parse(c.Param("id"))
@@ -117,17 +107,10 @@ func handleUpdateResource(resourceService *services.ResourceService) gin.Handler
 			return
 		}
 
-		var req struct {
-			Name       *string `json:"name"`
-			Type       *string `json:"type"`
-			Location   *string `json:"location"`
-			Department *string `json:"department"`
-			Active     *bool   `json:"active"`
-			Nonce      string  `json:"nonce"` // Optional nonce for response signing
-		}
+		var req updateResourceRequest
 
 		if err := c.ShouldBindJSON(&req); err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			bindErrorResponse(c, err)
 			return
 		}
 
@@ -151,23 +134,17 @@ func handleUpdateResource(resourceService *services.ResourceService) gin.Handler
 		if req.Active != nil {
 			updates["active"] = *req.Active
 		}
+		if req.AllowedNetworks != nil {
+			updates["allowed_networks"] = req.AllowedNetworks
+		}
 
 		resource, err := resourceService.UpdateResource(resourceID, updates)
 		if err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		itemResponse(c, gin.H{
-			"id":         resource.ID,
-			"name":       resource.Name,
-			"type":       resource.Type,
-			"location":   resource.Location,
-			"department": resource.Department,
-			"active":     resource.Active,
-			"created_at": resource.CreatedAt,
-			"updated_at": resource.UpdatedAt,
-		})
+		itemResponse(c, resourceResponse(resource))
 	}
 }
 
@@ -181,7 +158,7 @@ func handleDeleteResource(resourceService *services.ResourceService) gin.Handler
 
 		err = resourceService.DeleteResource(resourceID)
 		if err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
@@ -189,19 +166,50 @@ func handleDeleteResource(resourceService *services.ResourceService) gin.Handler
 	}
 }
 
+// resourceBody is the API representation of a resource
+type resourceBody struct {
+	ID              uuid.UUID `json:"id"`
+	Name            string    `json:"name"`
+	Type            string    `json:"type" doc:"e.g. server, service, database, application or door"`
+	Location        string    `json:"location"`
+	Department      string    `json:"department"`
+	Active          bool      `json:"active"`
+	AllowedNetworks []string  `json:"allowed_networks" doc:"CIDR ranges clients must connect from to use the resource's permissions, unless they hold authorization.network_override_permission. Empty allows any network."`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// resourceResponse formats a resource for API responses
+func resourceResponse(resource *database.Resource) resourceBody {
+	return resourceBody{
+		ID:              resource.ID,
+		Name:            resource.Name,
+		Type:            resource.Type,
+		Location:        resource.Location,
+		Department:      resource.Department,
+		Active:          resource.Active,
+		AllowedNetworks: services.ResourceNetworks(resource),
+		CreatedAt:       resource.CreatedAt,
+		UpdatedAt:       resource.UpdatedAt,
+	}
+}
+
 // Permission API handlers
 
+// createPermissionRequest is the body of POST /permissions
+type createPermissionRequest struct {
+	ResourceID string `json:"resource_id" binding:"required" format:"uuid"`
+	Action     string `json:"action" binding:"required"`
+	Effect     string `json:"effect" binding:"required"`
+	Nonce      string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
 func handleCreatePermission(permissionService *services.PermissionService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var req struct {
-			ResourceID string `json:"resource_id" binding:"required"`
-			Action     string `json:"action" binding:"required"`
-			Effect     string `json:"effect" binding:"required"`
-			Nonce      string `json:"nonce"` // Optional nonce for response signing
-		}
+		var req createPermissionRequest
 
 		if err := c.ShouldBindJSON(&req); err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			bindErrorResponse(c, err)
 			return
 		}
 
@@ -216,17 +224,11 @@ func handleCreatePermission(permissionService *services.PermissionService) gin.H
 
 		permission, err := permissionService.CreatePermission(resourceID, req.Action, req.Effect)
 		if err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		createdResponse(c, gin.H{
-			"id":         permission.ID,
-			"resource":   permission.Resource.Name,
-			"action":     permission.Action,
-			"effect":     permission.Effect,
-			"created_at": permission.CreatedAt,
-		})
+		createdResponse(c, permissionResponse(permission))
 	}
 }
 
@@ -240,18 +242,11 @@ func handleGetPermission(permissionService *services.PermissionService) gin.Hand
 
 		permission, err := permissionService.GetPermissionByID(permissionID)
 		if err != nil {
-			errorResponse(c, http.StatusNotFound, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		itemResponse(c, gin.H{
-			"id":         permission.ID,
-			"resource":   permission.Resource.Name,
-			"action":     permission.Action,
-			"effect":     permission.Effect,
-			"created_at": permission.CreatedAt,
-			"updated_at": permission.UpdatedAt,
-		})
+		itemResponse(c, permissionResponse(permission))
 	}
 }
 
@@ -259,21 +254,14 @@ func handleListPermissions(permissionService *services.PermissionService) gin.Ha
 	return func(c *gin.Context) {
 		permissions, err := permissionService.ListPermissions()
 		if err != nil {
-			errorResponse(c, http.StatusInternalServerError, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
 		// Build response
-		permissionList := make([]gin.H, len(permissions))
-		for i, permission := range permissions {
-			permissionList[i] = gin.H{
-				"id":         permission.ID,
-				"resource":   permission.Resource.Name,
-				"action":     permission.Action,
-				"effect":     permission.Effect,
-				"created_at": permission.CreatedAt,
-				"updated_at": permission.UpdatedAt,
-			}
+		permissionList := make([]permissionBody, len(permissions))
+		for i := range permissions {
+			permissionList[i] = permissionResponse(&permissions[i])
 		}
 
 		listResponse(c, permissionList, int64(len(permissionList)))
@@ -290,10 +278,32 @@ func handleDeletePermission(permissionService *services.PermissionService) gin.H
 
 		err = permissionService.DeletePermission(permissionID)
 		if err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
 		deletedResponse(c)
 	}
-} 
\ No newline at end of file
+}
+
+// permissionBody is the API representation of a permission
+type permissionBody struct {
+	ID        uuid.UUID `json:"id"`
+	Resource  string    `json:"resource" doc:"Name of the resource"`
+	Action    string    `json:"action"`
+	Effect    string    `json:"effect" enum:"allow,deny"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// permissionResponse formats a permission for API responses
+func permissionResponse(permission *database.Permission) permissionBody {
+	return permissionBody{
+		ID:        permission.ID,
+		Resource:  permission.Resource.Name,
+		Action:    permission.Action,
+		Effect:    permission.Effect,
+		CreatedAt: permission.CreatedAt,
+		UpdatedAt: permission.UpdatedAt,
+	}
+}
@@ -2,7 +2,9 @@ package server
 
 import (
 	"net/http"
+	"time"
 
+	"github.com/YubiApp/internal/database"
 	"github.com/YubiApp/internal/services"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -10,16 +12,19 @@ import (
 
 // Role API handlers
 
+// createRoleRequest is the body of POST /roles
+type createRoleRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	Nonce       string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
 func handleCreateRole(roleService *services.RoleService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var req struct {
-			Name        string `json:"name" binding:"required"`
-			Description string `json:"description"`
-			Nonce       string `json:"nonce"` // Optional nonce for response signing
-		}
+		var req createRoleRequest
 
 		if err := c.ShouldBindJSON(&req); err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			bindErrorResponse(c, err)
 			return
 		}
 
@@ -28,16 +33,11 @@ func handleCreateRole(roleService *services.RoleService) gin.HandlerFunc {
 
 		role, err := roleService.CreateRole(req.Name, req.Description)
 		if err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		createdResponse(c, gin.H{
-			"id":          role.ID,
-			"name":        role.Name,
-			"description": role.Description,
-			"created_at":  role.CreatedAt,
-		})
+		createdResponse(c, roleResponse(role))
 	}
 }
 
@@ -51,30 +51,11 @@ func handleGetRole(roleService *services.RoleService) gin.HandlerFunc {
 
 		role, err := roleService.GetRoleByID(roleID)
 		if err != nil {
-			errorResponse(c, http.StatusNotFound, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		// Build permissions list
-		permissions := make([]gin.H, len(role.Permissions))
-		for i, perm := range role.Permissions {
-			permissions[i] = gin.H{
-				"id":         perm.ID,
-				"resource":   perm.Resource.Name,
-				"action":     perm.Action,
-				"effect":     perm.Effect,
-				"created_at": perm.CreatedAt,
-			}
-		}
-
-		itemResponse(c, gin.H{
-			"id":          role.ID,
-			"name":        role.Name,
-			"description": role.Description,
-			"created_at":  role.CreatedAt,
-			"updated_at":  role.UpdatedAt,
-			"permissions": permissions,
-		})
+		itemResponse(c, roleResponse(role))
 	}
 }
 
@@ -82,39 +63,29 @@ func handleListRoles(roleService *services.RoleService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		roles, err := roleService.ListRoles()
 		if err != nil {
-			errorResponse(c, http.StatusInternalServerError, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
 		// Build response
-		roleList := make([]gin.H, len(roles))
-		for i, role := range roles {
-			// Build permissions list for each role
-			permissions := make([]gin.H, len(role.Permissions))
-			for j, perm := range role.Permissions {
-				permissions[j] = gin.H{
-					"id":         perm.ID,
-					"resource":   perm.Resource.Name,
-					"action":     perm.Action,
-					"effect":     perm.Effect,
-					"created_at": perm.CreatedAt,
-				}
-			}
-
-			roleList[i] = gin.H{
-				"id":          role.ID,
-				"name":        role.Name,
-				"description": role.Description,
-				"created_at":  role.CreatedAt,
-				"updated_at":  role.UpdatedAt,
-				"permissions": permissions,
-			}
+		roleList := make([]roleBody, len(roles))
+		for i := range roles {
+			roleList[i] = roleResponse(&roles[i])
 		}
 
 		listResponse(c, roleList, int64(len(roleList)))
 	}
 }
 
+// updateRoleRequest is the body of PUT /roles/:id
+type updateRoleRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	OwnerID     *string `json:"owner_id" format:"uuid" doc:"Reviewer in role_owner access reviews; empty clears the owner"`
+	Version     *int    `json:"version" doc:"Optional: the version the update is based on; a different current version is rejected with 409"`
+	Nonce       string  `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
 func handleUpdateRole(roleService *services.RoleService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		roleID, err := uuid.Parse(c.Param("id"))
@@ -123,14 +94,10 @@ func handleUpdateRole(roleService *services.RoleService) gin.HandlerFunc {
 			return
 		}
 
-		var req struct {
-			Name        *string `json:"name"`
-			Description *string `json:"description"`
-			Nonce       string  `json:"nonce"` // Optional nonce for response signing
-		}
+		var req updateRoleRequest
 
 		if err := c.ShouldBindJSON(&req); err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			bindErrorResponse(c, err)
 			return
 		}
 
@@ -145,33 +112,22 @@ func handleUpdateRole(roleService *services.RoleService) gin.HandlerFunc {
 		if req.Description != nil {
 			updates["description"] = *req.Description
 		}
+		if req.OwnerID != nil {
+			ownerID, err := parseOptionalUUID(*req.OwnerID)
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Invalid owner_id")
+				return
+			}
+			updates["owner_id"] = ownerID
+		}
 
-		role, err := roleService.UpdateRole(roleID, updates)
+		role, err := roleService.UpdateRole(roleID, req.Version, updates)
 		if err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		// Build permissions list
-		permissions := make([]gin.H, len(role.Permissions))
-		for i, perm := range role.Permissions {
-			permissions[i] = gin.H{
-				"id":         perm.ID,
-				"resource":   perm.Resource.Name,
-				"action":     perm.Action,
-				"effect":     perm.Effect,
-				"created_at": perm.CreatedAt,
-			}
-		}
-
-		itemResponse(c, gin.H{
-			"id":          role.ID,
-			"name":        role.Name,
-			"description": role.Description,
-			"created_at":  role.CreatedAt,
-			"updated_at":  role.UpdatedAt,
-			"permissions": permissions,
-		})
+		itemResponse(c, roleResponse(role))
 	}
 }
 
@@ -185,7 +141,7 @@ func handleDeleteRole(roleService *services.RoleService) gin.HandlerFunc {
 
 		err = roleService.DeleteRole(roleID)
 		if err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
@@ -209,13 +165,11 @@ func handleAssignPermissionToRole(roleService *services.RoleService) gin.Handler
 
 		err = roleService.AssignPermissionToRole(roleID, permissionID)
 		if err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		successResponse(c, gin.H{
-			"message": "Permission assigned to role successfully",
-		})
+		successResponse(c, messageBody{Message: "Permission assigned to role successfully"})
 	}
 }
 
@@ -235,12 +189,43 @@ func handleRemovePermissionFromRole(roleService *services.RoleService) gin.Handl
 
 		err = roleService.RemovePermissionFromRole(roleID, permissionID)
 		if err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		successResponse(c, gin.H{
-			"message": "Permission removed from role successfully",
-		})
+		successResponse(c, messageBody{Message: "Permission removed from role successfully"})
+	}
+}
+
+// roleBody is the API representation of a role
+type roleBody struct {
+	ID          uuid.UUID        `json:"id"`
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Active      bool             `json:"active"`
+	OwnerID     *uuid.UUID       `json:"owner_id" doc:"Reviews who holds the role in role_owner access reviews"`
+	Version     int              `json:"version" doc:"Incremented by every update; send it back with updates to reject them if someone else changed the record"`
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+	Permissions []permissionBody `json:"permissions"`
+}
+
+// roleResponse formats a role and its permissions for API responses
+func roleResponse(role *database.Role) roleBody {
+	permissions := make([]permissionBody, len(role.Permissions))
+	for i := range role.Permissions {
+		permissions[i] = permissionResponse(&role.Permissions[i])
 	}
-} 
\ No newline at end of file
+
+	return roleBody{
+		ID:          role.ID,
+		Name:        role.Name,
+		Description: role.Description,
+		Active:      role.Active,
+		OwnerID:     role.OwnerID,
+		Version:     role.Version,
+		CreatedAt:   role.CreatedAt,
+		UpdatedAt:   role.UpdatedAt,
+		Permissions: permissions,
+	}
+}
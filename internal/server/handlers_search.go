@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// searchGroups are the route groups whose read permission each search result
+// type needs
+var searchGroups = map[string]string{
+	services.SearchUser:   "users",
+	services.SearchDevice: "devices",
+	services.SearchRole:   "roles",
+	services.SearchAction: "actions",
+}
+
+// handleSearch handles GET /search?q=, the global search over users, devices,
+// roles and actions. ?types= narrows it to some types and ?limit= caps the
+// results of each. Types the caller cannot read are left out.
+func handleSearch(searchService *services.SearchService, authz *routeAuthorizer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requested := services.SearchTypes
+		if types := c.Query("types"); types != "" {
+			requested = strings.Split(types, ",")
+		}
+		var types []string
+		for _, kind := range requested {
+			kind = strings.TrimSpace(kind)
+			// Unknown types are kept for the search to reject
+			if group, ok := searchGroups[kind]; ok && !authz.allows(c, group) {
+				continue
+			}
+			types = append(types, kind)
+		}
+
+		limit := 0
+		if limitStr := c.Query("limit"); limitStr != "" {
+			var err error
+			if limit, err = strconv.Atoi(limitStr); err != nil {
+				errorResponse(c, http.StatusBadRequest, "Invalid limit")
+				return
+			}
+		}
+
+		results, err := searchService.Search(c.Query("q"), types, limit)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+		listResponse(c, results, int64(len(results)))
+	}
+}
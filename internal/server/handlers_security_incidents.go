@@ -0,0 +1,162 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Security incident handlers
+
+// handleListSecurityIncidents handles GET /security-incidents
+func handleListSecurityIncidents(incidentService *services.SecurityIncidentService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := services.SecurityIncidentFilter{
+			Status: c.Query("status"),
+			Type:   c.Query("type"),
+			Limit:  50,
+		}
+
+		var err error
+		if filter.UserID, err = parseOptionalUUID(c.Query("user_id")); err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid user_id")
+			return
+		}
+		if limitStr := c.Query("limit"); limitStr != "" {
+			if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+				filter.Limit = l
+			}
+		}
+		if offsetStr := c.Query("offset"); offsetStr != "" {
+			if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+				filter.Offset = o
+			}
+		}
+
+		incidents, total, err := incidentService.ListIncidents(filter)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		incidentList := make([]securityIncidentBody, len(incidents))
+		for i := range incidents {
+			incidentList[i] = securityIncidentResponse(&incidents[i])
+		}
+
+		listResponse(c, incidentList, total)
+	}
+}
+
+// handleGetSecurityIncident handles GET /security-incidents/:id
+func handleGetSecurityIncident(incidentService *services.SecurityIncidentService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		incidentID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid incident ID")
+			return
+		}
+
+		incident, err := incidentService.GetIncidentByID(incidentID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, securityIncidentResponse(incident))
+	}
+}
+
+// resolveSecurityIncidentRequest is the body of POST /security-incidents/:id/resolve
+type resolveSecurityIncidentRequest struct {
+	ReplacementDeviceID string `json:"replacement_device_id" format:"uuid" doc:"Required for recovery_code_used incidents"`
+	Note                string `json:"note"`
+	Nonce               string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleResolveSecurityIncident handles POST /security-incidents/:id/resolve
+func handleResolveSecurityIncident(incidentService *services.SecurityIncidentService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		incidentID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid incident ID")
+			return
+		}
+
+		var req resolveSecurityIncidentRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				bindErrorResponse(c, err)
+				return
+			}
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		// Break-glass uses are reviewed from outside break-glass sessions
+		if c.GetBool("break_glass") {
+			errorResponse(c, http.StatusForbidden, "Break-glass sessions cannot resolve security incidents")
+			return
+		}
+
+		replacementDeviceID, err := parseOptionalUUID(req.ReplacementDeviceID)
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid replacement_device_id")
+			return
+		}
+
+		incident, err := incidentService.ResolveIncident(incidentID, c.MustGet("user_id").(uuid.UUID), replacementDeviceID, req.Note)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, securityIncidentResponse(incident))
+	}
+}
+
+// securityIncidentBody is the API representation of a security incident
+type securityIncidentBody struct {
+	ID                  uuid.UUID  `json:"id"`
+	UserID              uuid.UUID  `json:"user_id"`
+	Username            string     `json:"username"`
+	Type                string     `json:"type" enum:"recovery_code_used,break_glass_used,device_clone_suspected"`
+	Details             string     `json:"details"`
+	SessionID           string     `json:"session_id"`
+	IPAddress           string     `json:"ip_address"`
+	UserAgent           string     `json:"user_agent"`
+	Status              string     `json:"status" enum:"open,resolved"`
+	ResolvedAt          *time.Time `json:"resolved_at"`
+	ResolvedByID        *uuid.UUID `json:"resolved_by_id"`
+	ReplacementDeviceID *uuid.UUID `json:"replacement_device_id"`
+	ResolutionNote      string     `json:"resolution_note"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
+
+// securityIncidentResponse formats a security incident for API responses
+func securityIncidentResponse(incident *database.SecurityIncident) securityIncidentBody {
+	return securityIncidentBody{
+		ID:                  incident.ID,
+		UserID:              incident.UserID,
+		Username:            incident.User.Username,
+		Type:                incident.Type,
+		Details:             incident.Details,
+		SessionID:           incident.SessionID,
+		IPAddress:           incident.IPAddress,
+		UserAgent:           incident.UserAgent,
+		Status:              incident.Status,
+		ResolvedAt:          incident.ResolvedAt,
+		ResolvedByID:        incident.ResolvedByID,
+		ReplacementDeviceID: incident.ReplacementDeviceID,
+		ResolutionNote:      incident.ResolutionNote,
+		CreatedAt:           incident.CreatedAt,
+		UpdatedAt:           incident.UpdatedAt,
+	}
+}
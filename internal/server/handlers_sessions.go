@@ -1,26 +1,30 @@
 package server
 
 import (
+	"fmt"
+	"log"
 	"net/http"
+	"time"
 
+	"github.com/YubiApp/internal/database"
 	"github.com/YubiApp/internal/services"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 // Session API handlers
 
+// clientFingerprintHeader carries an optional client-generated fingerprint that
+// sessions are bound to when created and checked against on every use
+const clientFingerprintHeader = "X-Client-Fingerprint"
+
 // handleCreateSession handles session creation after device authentication
-func handleCreateSession(authService *services.AuthService, sessionService *services.SessionService) gin.HandlerFunc {
+func handleCreateSession(authService *services.AuthService, sessionService *services.SessionService, loginNotifications *services.LoginNotificationService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var req struct {
-			DeviceType string `json:"device_type" binding:"required"`
-			AuthCode   string `json:"auth_code" binding:"required"`
-			Permission string `json:"permission"` // Optional permission to check
-			Nonce      string `json:"nonce"`      // Optional nonce for response signing
-		}
+		var req deviceAuthRequest
 
 		if err := c.ShouldBindJSON(&req); err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			bindErrorResponse(c, err)
 			return
 		}
 
@@ -28,67 +32,77 @@ func handleCreateSession(authService *services.AuthService, sessionService *serv
 		setRequestNonce(c, req.Nonce)
 
 		// Authenticate the device first
-		user, device, err := authService.AuthenticateDevice(req.DeviceType, req.AuthCode, req.Permission)
+		user, device, err := authService.AuthenticateDeviceContext(c.Request.Context(), req.DeviceType, req.AuthCode, req.Permission)
 		if err != nil {
-			errorResponse(c, http.StatusUnauthorized, err.Error())
+			serviceErrorResponse(c, http.StatusUnauthorized, err)
 			return
 		}
 
-		// Create a new session
-		session, err := sessionService.CreateSession(user.ID, device.ID)
-		if err != nil {
-			errorResponse(c, http.StatusInternalServerError, "Failed to create session: "+err.Error())
+		response, ok := issueSession(c, sessionService, loginNotifications, user, device)
+		if !ok {
 			return
 		}
+		successResponse(c, response)
+	}
+}
 
-		// Generate access and refresh tokens
-		accessToken, err := sessionService.GenerateAccessToken(session)
-		if err != nil {
-			errorResponse(c, http.StatusInternalServerError, "Failed to generate access token: "+err.Error())
-			return
-		}
+// issueSession creates a session for an authenticated user and device and
+// builds the token response. Sign-ins from a device or IP new for the user are
+// notified. It writes the error response itself on failure.
+func issueSession(c *gin.Context, sessionService *services.SessionService, loginNotifications *services.LoginNotificationService, user *database.User, device *database.Device) (*sessionBody, bool) {
+	roleNames := make([]string, len(user.Roles))
+	for i, role := range user.Roles {
+		roleNames[i] = role.Name
+	}
 
-		refreshToken, err := sessionService.GenerateRefreshToken(session)
-		if err != nil {
-			errorResponse(c, http.StatusInternalServerError, "Failed to generate refresh token: "+err.Error())
-			return
-		}
+	// Create a new session
+	session, err := sessionService.CreateSession(user.ID, device.ID, roleNames, sessionClient(c))
+	if err != nil {
+		serviceErrorResponse(c, http.StatusInternalServerError, fmt.Errorf("failed to create session: %w", err))
+		return nil, false
+	}
 
-		// Build roles list
-		roles := make([]gin.H, len(user.Roles))
-		for i, role := range user.Roles {
-			roles[i] = gin.H{
-				"id":          role.ID,
-				"name":        role.Name,
-				"description": role.Description,
-			}
-		}
+	// Generate access and refresh tokens
+	accessToken, err := sessionService.GenerateAccessToken(session)
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, "Failed to generate access token: "+err.Error())
+		return nil, false
+	}
 
-		successResponse(c, gin.H{
-			"authenticated": true,
-			"session_id":    session.ID,
-			"access_token":  accessToken,
-			"refresh_token": refreshToken,
-			"user": gin.H{
-				"id":         user.ID,
-				"email":      user.Email,
-				"username":   user.Username,
-				"first_name": user.FirstName,
-				"last_name":  user.LastName,
-				"active":     user.Active,
-				"roles":      roles,
-			},
-			"device": gin.H{
-				"id":         device.ID,
-				"type":       device.Type,
-				"identifier": device.Identifier,
-			},
-		})
+	refreshToken, err := sessionService.GenerateRefreshToken(session)
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, "Failed to generate refresh token: "+err.Error())
+		return nil, false
 	}
+
+	loginNotifications.SignedIn(user, device, services.LoginContext{
+		IPAddress:      c.ClientIP(),
+		UserAgent:      c.GetHeader("User-Agent"),
+		RequestID:      c.GetString("request_id"),
+		AcceptLanguage: c.GetHeader("Accept-Language"),
+	})
+
+	return &sessionBody{
+		Authenticated: true,
+		SessionID:     session.ID,
+		AccessToken:   accessToken,
+		RefreshToken:  refreshToken,
+		ExpiresAt:     session.ExpiresAt,
+		IdleTimeout:   int(session.IdleTimeout.Seconds()),
+		IdleExpiresAt: services.SessionIdleExpiresAt(session),
+		User:          authenticatedUserResponse(user),
+		Device:        authenticatedDeviceResponse(device),
+	}, true
+}
+
+// refreshSessionRequest is the body of POST /auth/session/refresh/:session_id
+type refreshSessionRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+	Nonce        string `json:"nonce" doc:"Optional nonce for response signing"`
 }
 
 // handleRefreshSession handles session token refresh
-func handleRefreshSession(sessionService *services.SessionService) gin.HandlerFunc {
+func handleRefreshSession(sessionService *services.SessionService, authService *services.AuthService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		sessionID := c.Param("session_id")
 		if sessionID == "" {
@@ -96,21 +110,31 @@ func handleRefreshSession(sessionService *services.SessionService) gin.HandlerFu
 			return
 		}
 
-		var req struct {
-			RefreshToken string `json:"refresh_token" binding:"required"`
-			Nonce        string `json:"nonce"` // Optional nonce for response signing
-		}
+		var req refreshSessionRequest
 
 		if err := c.ShouldBindJSON(&req); err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			bindErrorResponse(c, err)
 			return
 		}
 
 		// Store nonce in context for response functions to use
 		setRequestNonce(c, req.Nonce)
 
+		// Users who may no longer authenticate cannot extend their sessions
+		if claims, err := sessionService.ValidateRefreshToken(req.RefreshToken); err == nil {
+			if userID, err := uuid.Parse(claims.UserID); err == nil {
+				if err := authService.CheckUserCanAuthenticate(c.Request.Context(), userID); err != nil {
+					if err := sessionService.InvalidateSession(claims.SessionID); err != nil {
+						log.Printf("Failed to invalidate session %s of inactive user %s: %v", claims.SessionID, userID, err)
+					}
+					serviceErrorResponse(c, http.StatusUnauthorized, err)
+					return
+				}
+			}
+		}
+
 		// Refresh the session and get new tokens
-		session, accessToken, refreshToken, err := sessionService.RefreshSession(req.RefreshToken)
+		session, accessToken, refreshToken, err := sessionService.RefreshSession(req.RefreshToken, sessionClient(c))
 		if err != nil {
 			errorResponse(c, http.StatusUnauthorized, "Failed to refresh session: "+err.Error())
 			return
@@ -122,10 +146,292 @@ func handleRefreshSession(sessionService *services.SessionService) gin.HandlerFu
 			return
 		}
 
-		successResponse(c, gin.H{
-			"session_id":    session.ID,
-			"access_token":  accessToken,
-			"refresh_token": refreshToken,
+		successResponse(c, refreshSessionBody{
+			SessionID:     session.ID,
+			AccessToken:   accessToken,
+			RefreshToken:  refreshToken,
+			ExpiresAt:     session.ExpiresAt,
+			IdleTimeout:   int(session.IdleTimeout.Seconds()),
+			IdleExpiresAt: services.SessionIdleExpiresAt(session),
 		})
 	}
-} 
\ No newline at end of file
+}
+
+// logoutSessionRequest is the body of POST /auth/session/logout/:session_id
+type logoutSessionRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// handleLogoutSession handles POST /auth/session/logout/:session_id. The
+// refresh token proves the caller holds the session.
+func handleLogoutSession(sessionService *services.SessionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req logoutSessionRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		if err := sessionService.RevokeSession(c.Param("session_id"), req.RefreshToken); err != nil {
+			serviceErrorResponse(c, http.StatusUnauthorized, err)
+			return
+		}
+
+		deletedResponse(c)
+	}
+}
+
+// handleGetSession handles GET /auth/session/:id
+func handleGetSession(sessionService *services.SessionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session, err := sessionService.GetSession(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusNotFound, "Session not found: "+err.Error())
+			return
+		}
+
+		successResponse(c, sessionDetailsBody{
+			ID:             session.ID,
+			UserID:         session.UserID,
+			DeviceID:       session.DeviceID,
+			RefreshCount:   session.RefreshCount,
+			CreatedAt:      session.CreatedAt,
+			ExpiresAt:      session.ExpiresAt,
+			LastUsedAt:     session.LastUsedAt,
+			IdleTimeout:    int(session.IdleTimeout.Seconds()),
+			IdleExpiresAt:  services.SessionIdleExpiresAt(session),
+			ImpersonatorID: session.ImpersonatorID,
+			ReadOnly:       session.ReadOnly,
+			Recovery:       session.Recovery,
+			BreakGlass:     session.BreakGlass,
+			CrossDevice:    session.CrossDevice,
+			Binding: sessionBindingBody{
+				Mode:             sessionService.SessionBindingMode(),
+				UserAgent:        session.UserAgent,
+				IPAddress:        session.IPAddress,
+				FingerprintBound: session.Fingerprint != "",
+			},
+		})
+	}
+}
+
+// handleListOwnSessions handles GET /auth/sessions: the caller's active
+// sessions, most recently used first, for an "active sessions" screen
+func handleListOwnSessions(sessionService *services.SessionService, deviceService *services.DeviceService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+
+		sessions, err := sessionService.ListUserSessions(c.Request.Context(), userID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+		devices, err := deviceService.ListDevices(services.DeviceFilter{UserID: &userID, IncludeDeleted: true})
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+		devicesByID := make(map[uuid.UUID]*database.Device, len(devices))
+		for i := range devices {
+			devicesByID[devices[i].ID] = &devices[i]
+		}
+
+		var currentID string
+		if current, ok := c.Get("session"); ok {
+			currentID = current.(*database.Session).ID
+		}
+
+		sessionList := make([]ownSessionBody, len(sessions))
+		for i := range sessions {
+			sessionList[i] = ownSessionResponse(&sessions[i], devicesByID[sessions[i].DeviceID], sessions[i].ID == currentID)
+		}
+
+		listResponse(c, sessionList, int64(len(sessionList)))
+	}
+}
+
+// handleRevokeOwnSession handles DELETE /auth/sessions/:id, the caller ending
+// one of their sessions, e.g. one they do not recognise
+func handleRevokeOwnSession(sessionService *services.SessionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := sessionService.RevokeUserSession(c.Request.Context(), c.MustGet("user_id").(uuid.UUID), c.Param("id")); err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		deletedResponse(c)
+	}
+}
+
+// sessionBody is the response of a sign-in: the new session, its tokens, and
+// the user and device it was opened for
+type sessionBody struct {
+	Authenticated     bool                    `json:"authenticated"`
+	SessionID         string                  `json:"session_id" format:"uuid"`
+	AccessToken       string                  `json:"access_token"`
+	RefreshToken      string                  `json:"refresh_token"`
+	ExpiresAt         time.Time               `json:"expires_at"`
+	IdleTimeout       int                     `json:"idle_timeout" doc:"Seconds without use after which the session ends; 0 when sessions do not idle out"`
+	IdleExpiresAt     *time.Time              `json:"idle_expires_at" doc:"When the session ends unless it is used first"`
+	PasswordExpiresAt *time.Time              `json:"password_expires_at,omitempty" doc:"When the user's password expires; password sign-ins only"`
+	User              authenticatedUserBody   `json:"user"`
+	Device            authenticatedDeviceBody `json:"device"`
+}
+
+// authenticatedUserBody is the user a device authenticated
+type authenticatedUserBody struct {
+	ID        uuid.UUID         `json:"id"`
+	Email     string            `json:"email"`
+	Username  string            `json:"username"`
+	FirstName string            `json:"first_name"`
+	LastName  string            `json:"last_name"`
+	Active    bool              `json:"active"`
+	Roles     []roleSummaryBody `json:"roles"`
+}
+
+// authenticatedUserResponse is the API representation of the user a device
+// authenticated
+func authenticatedUserResponse(user *database.User) authenticatedUserBody {
+	return authenticatedUserBody{
+		ID:        user.ID,
+		Email:     user.Email,
+		Username:  user.Username,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Active:    user.Active,
+		Roles:     roleSummaries(user.Roles),
+	}
+}
+
+// authenticatedDeviceBody is the device a user authenticated with
+type authenticatedDeviceBody struct {
+	ID         uuid.UUID `json:"id"`
+	Type       string    `json:"type"`
+	Identifier string    `json:"identifier"`
+}
+
+// authenticatedDeviceResponse is the API representation of the device a user
+// authenticated with
+func authenticatedDeviceResponse(device *database.Device) authenticatedDeviceBody {
+	return authenticatedDeviceBody{ID: device.ID, Type: device.Type, Identifier: device.Identifier}
+}
+
+// sessionUserBody identifies the user a session was opened for
+type sessionUserBody struct {
+	ID       uuid.UUID `json:"id"`
+	Email    string    `json:"email"`
+	Username string    `json:"username"`
+}
+
+// sessionUserResponse identifies the user a session was opened for
+func sessionUserResponse(user *database.User) sessionUserBody {
+	return sessionUserBody{ID: user.ID, Email: user.Email, Username: user.Username}
+}
+
+// refreshSessionBody is the response of a session refresh
+type refreshSessionBody struct {
+	SessionID     string     `json:"session_id" format:"uuid"`
+	AccessToken   string     `json:"access_token"`
+	RefreshToken  string     `json:"refresh_token"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	IdleTimeout   int        `json:"idle_timeout" doc:"Seconds without use after which the session ends; 0 when sessions do not idle out"`
+	IdleExpiresAt *time.Time `json:"idle_expires_at"`
+}
+
+// sessionDetailsBody is a session as looked up by ID
+type sessionDetailsBody struct {
+	ID             string             `json:"id" format:"uuid"`
+	UserID         uuid.UUID          `json:"user_id"`
+	DeviceID       uuid.UUID          `json:"device_id"`
+	RefreshCount   int                `json:"refresh_count"`
+	CreatedAt      time.Time          `json:"created_at"`
+	ExpiresAt      time.Time          `json:"expires_at"`
+	LastUsedAt     time.Time          `json:"last_used_at"`
+	IdleTimeout    int                `json:"idle_timeout" doc:"Seconds without use after which the session ends; 0 when sessions do not idle out"`
+	IdleExpiresAt  *time.Time         `json:"idle_expires_at"`
+	ImpersonatorID *uuid.UUID         `json:"impersonator_id" doc:"The administrator using the session, when it impersonates the user"`
+	ReadOnly       bool               `json:"read_only"`
+	Recovery       bool               `json:"recovery"`
+	BreakGlass     bool               `json:"break_glass"`
+	CrossDevice    bool               `json:"cross_device" doc:"Opened on a shared terminal through QR login"`
+	Binding        sessionBindingBody `json:"binding"`
+}
+
+// sessionBindingBody is what a session is bound to
+type sessionBindingBody struct {
+	Mode             string `json:"mode" enum:"off,lenient,strict" doc:"The auth.session_binding setting uses of the session are checked with"`
+	UserAgent        string `json:"user_agent"`
+	IPAddress        string `json:"ip_address"`
+	FingerprintBound bool   `json:"fingerprint_bound" doc:"Whether the session is bound to an X-Client-Fingerprint"`
+}
+
+// ownSessionBody is one of the caller's sessions, as listed for an "active
+// sessions" screen
+type ownSessionBody struct {
+	ID            string                `json:"id"`
+	Current       bool                  `json:"current"`
+	Device        *ownSessionDeviceBody `json:"device"`
+	IPAddress     string                `json:"ip_address"`
+	LastIPAddress string                `json:"last_ip_address"`
+	UserAgent     string                `json:"user_agent"`
+	CreatedAt     time.Time             `json:"created_at"`
+	LastUsedAt    time.Time             `json:"last_used_at"`
+	ExpiresAt     time.Time             `json:"expires_at"`
+	IdleExpiresAt *time.Time            `json:"idle_expires_at"`
+	Impersonated  bool                  `json:"impersonated"`
+	ReadOnly      bool                  `json:"read_only"`
+	Recovery      bool                  `json:"recovery"`
+	BreakGlass    bool                  `json:"break_glass"`
+	CrossDevice   bool                  `json:"cross_device" doc:"Opened on a shared terminal through QR login"`
+}
+
+// ownSessionDeviceBody is the device a session was opened with
+type ownSessionDeviceBody struct {
+	ID   uuid.UUID `json:"id"`
+	Type string    `json:"type"`
+	Name string    `json:"name"`
+}
+
+// ownSessionResponse formats one of the caller's sessions and the device it
+// was opened with, if any
+func ownSessionResponse(session *database.Session, device *database.Device, current bool) ownSessionBody {
+	var deviceInfo *ownSessionDeviceBody
+	if device != nil {
+		deviceInfo = &ownSessionDeviceBody{
+			ID:   device.ID,
+			Type: device.Type,
+			Name: device.Name,
+		}
+	}
+	lastIPAddress := session.LastIPAddress
+	if lastIPAddress == "" {
+		lastIPAddress = session.IPAddress
+	}
+	return ownSessionBody{
+		ID:            session.ID,
+		Current:       current,
+		Device:        deviceInfo,
+		IPAddress:     session.IPAddress,
+		LastIPAddress: lastIPAddress,
+		UserAgent:     session.UserAgent,
+		CreatedAt:     session.CreatedAt,
+		LastUsedAt:    session.LastUsedAt,
+		ExpiresAt:     session.ExpiresAt,
+		IdleExpiresAt: services.SessionIdleExpiresAt(session),
+		Impersonated:  session.ImpersonatorID != nil,
+		ReadOnly:      session.ReadOnly,
+		Recovery:      session.Recovery,
+		BreakGlass:    session.BreakGlass,
+		CrossDevice:   session.CrossDevice,
+	}
+}
+
+// sessionClient describes the client making a session request
+func sessionClient(c *gin.Context) services.SessionClient {
+	return services.SessionClient{
+		UserAgent:   c.GetHeader("User-Agent"),
+		IPAddress:   c.ClientIP(),
+		Fingerprint: c.GetHeader(clientFingerprintHeader),
+	}
+}
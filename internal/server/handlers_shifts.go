@@ -0,0 +1,347 @@
+package server
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Shift handlers
+
+// handleListShifts handles GET /shifts
+func handleListShifts(shiftService *services.ShiftService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := services.ShiftFilter{Limit: 50}
+
+		if userIDsStr := c.Query("user_ids"); userIDsStr != "" {
+			userIDs, err := parseUUIDArray(userIDsStr)
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Invalid user_ids format")
+				return
+			}
+			filter.UserIDs = userIDs
+		}
+		if locationIDsStr := c.Query("location_ids"); locationIDsStr != "" {
+			locationIDs, err := parseUUIDArray(locationIDsStr)
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Invalid location_ids format")
+				return
+			}
+			filter.LocationIDs = locationIDs
+		}
+		if limitStr := c.Query("limit"); limitStr != "" {
+			if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+				filter.Limit = l
+			}
+		}
+		if offsetStr := c.Query("offset"); offsetStr != "" {
+			if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+				filter.Offset = o
+			}
+		}
+
+		shifts, total, err := shiftService.ListShifts(filter)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		shiftList := make([]shiftBody, len(shifts))
+		for i := range shifts {
+			shiftList[i] = shiftResponse(&shifts[i])
+		}
+
+		listResponse(c, shiftList, total)
+	}
+}
+
+// createShiftRequest is the body of POST /shifts
+type createShiftRequest struct {
+	UserID     uuid.UUID  `json:"user_id" binding:"required"`
+	LocationID *uuid.UUID `json:"location_id"`
+	StartsAt   time.Time  `json:"starts_at" binding:"required" doc:"Start of the first shift"`
+	EndsAt     time.Time  `json:"ends_at" binding:"required" doc:"At most 24 hours after starts_at"`
+	Recurrence string     `json:"recurrence" enum:"daily,weekdays,weekly" doc:"Omit for a one-off shift"`
+	RecurUntil string     `json:"recur_until" format:"date" doc:"Last day of repeats"`
+	Notes      string     `json:"notes"`
+	Nonce      string     `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleCreateShift handles POST /shifts
+func handleCreateShift(shiftService *services.ShiftService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req createShiftRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		shift, err := shiftService.CreateShift(services.ShiftInput{
+			UserID:     req.UserID,
+			LocationID: req.LocationID,
+			StartsAt:   req.StartsAt,
+			EndsAt:     req.EndsAt,
+			Recurrence: req.Recurrence,
+			RecurUntil: req.RecurUntil,
+			Notes:      req.Notes,
+		})
+		if err != nil {
+			serviceErrorResponse(c, http.StatusBadRequest, err)
+			return
+		}
+
+		createdResponse(c, shiftResponse(shift))
+	}
+}
+
+// handleGetShift handles GET /shifts/:id
+func handleGetShift(shiftService *services.ShiftService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid shift ID")
+			return
+		}
+
+		shift, err := shiftService.GetShift(id)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, shiftResponse(shift))
+	}
+}
+
+// updateShiftRequest is the body of PUT /shifts/:id
+type updateShiftRequest struct {
+	LocationID    *uuid.UUID `json:"location_id"`
+	ClearLocation bool       `json:"clear_location" doc:"Removes the location"`
+	StartsAt      *time.Time `json:"starts_at"`
+	EndsAt        *time.Time `json:"ends_at"`
+	Recurrence    *string    `json:"recurrence" enum:",daily,weekdays,weekly" doc:"Empty makes it a one-off shift"`
+	RecurUntil    *string    `json:"recur_until" doc:"YYYY-MM-DD; empty repeats indefinitely"`
+	Notes         *string    `json:"notes"`
+	Version       *int       `json:"version" doc:"Version the update is based on"`
+	Nonce         string     `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleUpdateShift handles PUT /shifts/:id
+func handleUpdateShift(shiftService *services.ShiftService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid shift ID")
+			return
+		}
+
+		var req updateShiftRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		shift, err := shiftService.UpdateShift(id, services.ShiftUpdate{
+			LocationID:    req.LocationID,
+			ClearLocation: req.ClearLocation,
+			StartsAt:      req.StartsAt,
+			EndsAt:        req.EndsAt,
+			Recurrence:    req.Recurrence,
+			RecurUntil:    req.RecurUntil,
+			Notes:         req.Notes,
+		}, req.Version)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusBadRequest, err)
+			return
+		}
+
+		itemResponse(c, shiftResponse(shift))
+	}
+}
+
+// handleDeleteShift handles DELETE /shifts/:id
+func handleDeleteShift(shiftService *services.ShiftService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid shift ID")
+			return
+		}
+
+		if err := shiftService.DeleteShift(id); err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		deletedResponse(c)
+	}
+}
+
+// handleGetShiftReport handles GET /reports/shifts, comparing the shifts
+// starting in a period with the sign-ins and sign-outs recorded
+func handleGetShiftReport(shiftService *services.ShiftService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := services.ShiftReportFilter{}
+
+		if userIDsStr := c.Query("user_ids"); userIDsStr != "" {
+			userIDs, err := parseUUIDArray(userIDsStr)
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Invalid user_ids format")
+				return
+			}
+			filter.UserIDs = userIDs
+		}
+		if locationIDsStr := c.Query("location_ids"); locationIDsStr != "" {
+			locationIDs, err := parseUUIDArray(locationIDsStr)
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Invalid location_ids format")
+				return
+			}
+			filter.LocationIDs = locationIDs
+		}
+
+		var err error
+		if filter.From, err = parseReportTime(c.Query("from"), false); err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid or missing 'from': "+err.Error())
+			return
+		}
+		if filter.To, err = parseReportTime(c.Query("to"), true); err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid or missing 'to': "+err.Error())
+			return
+		}
+
+		format := c.DefaultQuery("format", "json")
+		if format != "json" && format != "csv" {
+			errorResponse(c, http.StatusBadRequest, "Invalid format. Must be one of: [json csv]")
+			return
+		}
+
+		report, err := shiftService.CompareShifts(filter)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if format == "json" {
+			successResponse(c, shiftReportBody{
+				Data:   report.Shifts,
+				Totals: report.Totals,
+				Meta: shiftReportMeta{
+					From:        filter.From,
+					To:          filter.To,
+					UserIDs:     filter.UserIDs,
+					LocationIDs: filter.LocationIDs,
+				},
+			})
+			return
+		}
+
+		c.Header("Content-Type", "text/csv")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=shifts-%s-%s.csv",
+			filter.From.Format("20060102"), filter.To.Format("20060102")))
+		c.Status(http.StatusOK)
+
+		writer := csv.NewWriter(c.Writer)
+		writer.Write([]string{"shift_id", "user_id", "user_name", "location_name", "date", "planned_start", "planned_end", "planned_hours", "first_sign_in", "last_sign_out", "worked_hours", "status", "late_minutes", "left_early_minutes"})
+		for _, row := range report.Shifts {
+			signIn, signOut := "", ""
+			if row.FirstSignIn != nil {
+				signIn = row.FirstSignIn.Format(time.RFC3339)
+			}
+			if row.LastSignOut != nil {
+				signOut = row.LastSignOut.Format(time.RFC3339)
+			}
+			writer.Write([]string{
+				row.ShiftID.String(),
+				row.UserID.String(),
+				row.UserName,
+				row.LocationName,
+				row.Date,
+				row.PlannedStart.Format(time.RFC3339),
+				row.PlannedEnd.Format(time.RFC3339),
+				strconv.FormatFloat(row.PlannedHours, 'f', 2, 64),
+				signIn,
+				signOut,
+				strconv.FormatFloat(row.WorkedHours, 'f', 2, 64),
+				row.Status,
+				strconv.FormatFloat(row.LateMinutes, 'f', 0, 64),
+				strconv.FormatFloat(row.LeftEarlyMinutes, 'f', 0, 64),
+			})
+		}
+		writer.Flush()
+
+		// Headers are already sent, so errors can only be recorded at this point
+		if err := writer.Error(); err != nil {
+			c.Error(err)
+		}
+	}
+}
+
+// shiftBody is the API representation of a shift
+type shiftBody struct {
+	ID           uuid.UUID  `json:"id"`
+	UserID       uuid.UUID  `json:"user_id"`
+	Username     string     `json:"username"`
+	LocationID   *uuid.UUID `json:"location_id"`
+	LocationName *string    `json:"location_name"`
+	StartsAt     time.Time  `json:"starts_at" doc:"Start of the first shift"`
+	EndsAt       time.Time  `json:"ends_at" doc:"End of the first shift"`
+	Recurrence   string     `json:"recurrence" enum:",daily,weekdays,weekly" doc:"How the shift repeats at the first shift's wall-clock time, in the location's timezone, else the user's; empty for a one-off shift"`
+	RecurUntil   string     `json:"recur_until" doc:"Last day of repeats (YYYY-MM-DD); empty repeats indefinitely"`
+	Notes        string     `json:"notes"`
+	Version      int        `json:"version" doc:"Incremented by every update; send it back with updates to reject them if someone else changed the record"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// shiftResponse is the API representation of a shift
+func shiftResponse(shift *database.Shift) shiftBody {
+	response := shiftBody{
+		ID:         shift.ID,
+		UserID:     shift.UserID,
+		Username:   shift.User.Username,
+		LocationID: shift.LocationID,
+		StartsAt:   shift.StartsAt,
+		EndsAt:     shift.EndsAt,
+		Recurrence: shift.Recurrence,
+		RecurUntil: shift.RecurUntil,
+		Notes:      shift.Notes,
+		Version:    shift.Version,
+		CreatedAt:  shift.CreatedAt,
+		UpdatedAt:  shift.UpdatedAt,
+	}
+	if shift.Location != nil {
+		response.LocationName = &shift.Location.Name
+	}
+	return response
+}
+
+// shiftReportBody is the JSON form of the shift report
+type shiftReportBody struct {
+	Data   []services.ShiftComparison `json:"data"`
+	Totals []services.ShiftTotals     `json:"totals"`
+	Meta   shiftReportMeta            `json:"meta"`
+}
+
+// shiftReportMeta is the selection a shift report covers
+type shiftReportMeta struct {
+	From        time.Time   `json:"from"`
+	To          time.Time   `json:"to"`
+	UserIDs     []uuid.UUID `json:"user_ids"`
+	LocationIDs []uuid.UUID `json:"location_ids"`
+}
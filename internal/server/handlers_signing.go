@@ -0,0 +1,25 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// jwkSetBody is a JSON Web Key set
+type jwkSetBody struct {
+	Keys []map[string]interface{} `json:"keys"`
+}
+
+// handleResponseSigningKeys handles GET /.well-known/response-signing-keys. Keys
+// are published as a JWK set; it is empty when response signing is disabled.
+func handleResponseSigningKeys(responseSigner *services.ResponseSigner) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keys := []map[string]interface{}{}
+		if responseSigner != nil {
+			keys = append(keys, responseSigner.PublicJWK())
+		}
+		c.JSON(http.StatusOK, jwkSetBody{Keys: keys})
+	}
+}
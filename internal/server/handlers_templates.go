@@ -0,0 +1,232 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Message template handlers
+
+// handleListTemplates handles GET /templates
+func handleListTemplates(templateService *services.MessageTemplateService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		infos, err := templateService.ListTemplates()
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		templateList := make([]messageTemplateInfoBody, len(infos))
+		for i := range infos {
+			templateList[i] = messageTemplateInfoResponse(&infos[i])
+		}
+
+		listResponse(c, templateList, int64(len(templateList)))
+	}
+}
+
+// handleGetTemplate handles GET /templates/:key
+func handleGetTemplate(templateService *services.MessageTemplateService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		info, err := templateService.GetTemplate(c.Param("key"))
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, messageTemplateInfoResponse(info))
+	}
+}
+
+// saveTemplateRequest is the body of PUT /templates/:key/:locale
+type saveTemplateRequest struct {
+	Text    string `json:"text" binding:"required"`
+	Version *int   `json:"version" doc:"Version the edit is based on, 0 for a new template"`
+	Nonce   string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleSaveTemplate handles PUT /templates/:key/:locale
+func handleSaveTemplate(templateService *services.MessageTemplateService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req saveTemplateRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		tmpl, err := templateService.SaveTemplate(c.Param("key"), c.Param("locale"), req.Text, req.Version, c.MustGet("user_id").(uuid.UUID))
+		if err != nil {
+			serviceErrorResponse(c, http.StatusBadRequest, err)
+			return
+		}
+
+		itemResponse(c, messageTemplateResponse(tmpl))
+	}
+}
+
+// handleDeleteTemplate handles DELETE /templates/:key/:locale
+func handleDeleteTemplate(templateService *services.MessageTemplateService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := templateService.DeleteTemplate(c.Param("key"), c.Param("locale")); err != nil {
+			serviceErrorResponse(c, http.StatusBadRequest, err)
+			return
+		}
+
+		deletedResponse(c)
+	}
+}
+
+// messageTemplateVersionBody is the text a message template had at one version
+type messageTemplateVersionBody struct {
+	Version     int        `json:"version"`
+	Text        string     `json:"text"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CreatedByID *uuid.UUID `json:"created_by_id"`
+}
+
+// handleListTemplateVersions handles GET /templates/:key/:locale/versions
+func handleListTemplateVersions(templateService *services.MessageTemplateService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		versions, err := templateService.ListVersions(c.Param("key"), c.Param("locale"))
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		versionList := make([]messageTemplateVersionBody, len(versions))
+		for i, version := range versions {
+			versionList[i] = messageTemplateVersionBody{
+				Version:     version.Version,
+				Text:        version.Text,
+				CreatedAt:   version.CreatedAt,
+				CreatedByID: version.CreatedByID,
+			}
+		}
+
+		listResponse(c, versionList, int64(len(versionList)))
+	}
+}
+
+// restoreTemplateVersionRequest is the body of POST /templates/:key/:locale/restore
+type restoreTemplateVersionRequest struct {
+	Version         int    `json:"version" binding:"required,min=1" doc:"The version to restore"`
+	ExpectedVersion *int   `json:"expected_version" doc:"Version the restore is based on"`
+	Nonce           string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleRestoreTemplateVersion handles POST /templates/:key/:locale/restore,
+// which saves an earlier version's text as the template's new version
+func handleRestoreTemplateVersion(templateService *services.MessageTemplateService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req restoreTemplateVersionRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		tmpl, err := templateService.RestoreVersion(c.Param("key"), c.Param("locale"), req.Version, req.ExpectedVersion, c.MustGet("user_id").(uuid.UUID))
+		if err != nil {
+			serviceErrorResponse(c, http.StatusBadRequest, err)
+			return
+		}
+
+		itemResponse(c, messageTemplateResponse(tmpl))
+	}
+}
+
+// previewTemplateRequest is the body of POST /templates/:key/preview
+type previewTemplateRequest struct {
+	Locale string                 `json:"locale" doc:"Renders the message as it is now in this locale when text is empty"`
+	Text   string                 `json:"text" doc:"Text to render instead of the saved message"`
+	Data   map[string]interface{} `json:"data" doc:"Template data; the message's sample data when empty"`
+}
+
+// templatePreviewBody is a message rendered by POST /templates/:key/preview
+type templatePreviewBody struct {
+	Key      string `json:"key"`
+	Rendered string `json:"rendered"`
+}
+
+// handlePreviewTemplate handles POST /templates/:key/preview. It renders text,
+// or the message as it is now in locale, with data or the message's sample data.
+func handlePreviewTemplate(templateService *services.MessageTemplateService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req previewTemplateRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		rendered, err := templateService.Preview(c.Param("key"), req.Locale, req.Text, req.Data)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusBadRequest, err)
+			return
+		}
+
+		itemResponse(c, templatePreviewBody{Key: c.Param("key"), Rendered: rendered})
+	}
+}
+
+// messageTemplateInfoBody is the API representation of an editable message
+type messageTemplateInfoBody struct {
+	Key       string                `json:"key" doc:"Catalog key, e.g. email.password_reset.body"`
+	Variables []string              `json:"variables" doc:"What the message is rendered with, e.g. Username for {{.Username}}"`
+	Catalog   map[string]string     `json:"catalog" doc:"Built-in text by locale"`
+	Templates []messageTemplateBody `json:"templates" doc:"Its edited versions, one per locale"`
+}
+
+// messageTemplateInfoResponse is the API representation of an editable message
+func messageTemplateInfoResponse(info *services.MessageTemplateInfo) messageTemplateInfoBody {
+	templates := make([]messageTemplateBody, len(info.Templates))
+	for i := range info.Templates {
+		templates[i] = messageTemplateResponse(&info.Templates[i])
+	}
+	return messageTemplateInfoBody{
+		Key:       info.Key,
+		Variables: info.Variables,
+		Catalog:   info.Catalog,
+		Templates: templates,
+	}
+}
+
+// messageTemplateBody is the API representation of an edited message
+type messageTemplateBody struct {
+	ID          uuid.UUID  `json:"id"`
+	Key         string     `json:"key" doc:"Catalog key, e.g. email.password_reset.body"`
+	Locale      string     `json:"locale" doc:"e.g. en"`
+	Text        string     `json:"text" doc:"text/template"`
+	Version     int        `json:"version" doc:"Bumped by every update"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	UpdatedByID *uuid.UUID `json:"updated_by_id"`
+}
+
+func (messageTemplateBody) schemaDescription() string {
+	return "An edited message, replacing the catalog's in its locale"
+}
+
+// messageTemplateResponse is the API representation of an edited message
+func messageTemplateResponse(tmpl *database.MessageTemplate) messageTemplateBody {
+	return messageTemplateBody{
+		ID:          tmpl.ID,
+		Key:         tmpl.Key,
+		Locale:      tmpl.Locale,
+		Text:        tmpl.Text,
+		Version:     tmpl.Version,
+		UpdatedAt:   tmpl.UpdatedAt,
+		UpdatedByID: tmpl.UpdatedByID,
+	}
+}
@@ -1,15 +1,18 @@
 package server
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/YubiApp/internal/database"
 	"github.com/YubiApp/internal/services"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
 )
 
 type Handler struct {
@@ -78,40 +81,11 @@ func (h *Handler) GetUserActivity(c *gin.Context) {
 	}
 
 	// Parse pagination
-	if limitStr := c.Query("limit"); limitStr != "" {
-		if limit, err := strconv.Atoi(limitStr); err == nil && limit > 0 {
-			filter.Limit = limit
-		} else {
-			filter.Limit = 50 // default limit
-		}
-	} else {
-		filter.Limit = 50 // default limit
-	}
-
-	if offsetStr := c.Query("offset"); offsetStr != "" {
-		if offset, err := strconv.Atoi(offsetStr); err == nil && offset >= 0 {
-			filter.Offset = offset
-		}
-	}
-
-	// Get activities
-	activities, total, err := h.userActivityService.GetUserActivity(filter)
-	if err != nil {
-		errorResponse(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get user activity: %v", err))
+	if !parseActivityPaging(c, &filter) {
 		return
 	}
 
-	// Build response
-	response := gin.H{
-		"data": activities,
-		"meta": gin.H{
-			"total":  total,
-			"limit":  filter.Limit,
-			"offset": filter.Offset,
-		},
-	}
-
-	c.JSON(http.StatusOK, response)
+	h.writeActivityList(c, filter)
 }
 
 // GetUserActivitySummary handles GET /api/v1/user-activity/summary
@@ -159,7 +133,14 @@ func (h *Handler) GetUserActivitySummary(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": summaries})
+	c.JSON(http.StatusOK, activitySummaryListBody{
+		Data: summaries,
+		Meta: activitySummaryMeta{
+			FromDateTime: fromTime,
+			ToDateTime:   toTime,
+			Categories:   h.userActivityService.Categories(),
+		},
+	})
 }
 
 // GetUserActivityByUser handles GET /api/v1/user-activity/{user_id}
@@ -195,13 +176,51 @@ func (h *Handler) GetUserActivityByUser(c *gin.Context) {
 	}
 
 	// Parse pagination
+	if !parseActivityPaging(c, &filter) {
+		return
+	}
+
+	// Get activities for specific user
+	filter.UserIDs = []uuid.UUID{userID}
+	h.writeActivityList(c, filter)
+}
+
+// GetActivityByID handles GET /api/v1/user-activity/activity/{id}
+func (h *Handler) GetActivityByID(c *gin.Context) {
+	// Parse activity ID
+	activityIDStr := c.Param("id")
+	activityID, err := uuid.Parse(activityIDStr)
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, "Invalid activity ID")
+		return
+	}
+
+	// Get activity
+	activity, err := h.userActivityService.GetActivityByID(activityID)
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get activity: %v", err))
+		return
+	}
+
+	if activity == nil {
+		errorResponse(c, http.StatusNotFound, "Activity not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, activityItemBody{Data: activityResponse(activity)})
+}
+
+// parseActivityPaging reads limit, offset and cursor into filter. Pages hold
+// 50 activities unless limit says otherwise; NDJSON exports stream every
+// activity unless limited. Answers 400 and returns false on a bad cursor.
+func parseActivityPaging(c *gin.Context, filter *services.ActivityFilter) bool {
 	if limitStr := c.Query("limit"); limitStr != "" {
 		if limit, err := strconv.Atoi(limitStr); err == nil && limit > 0 {
 			filter.Limit = limit
 		} else {
 			filter.Limit = 50 // default limit
 		}
-	} else {
+	} else if c.Query("format") != "ndjson" {
 		filter.Limit = 50 // default limit
 	}
 
@@ -211,49 +230,145 @@ func (h *Handler) GetUserActivityByUser(c *gin.Context) {
 		}
 	}
 
-	// Get activities for specific user
-	activities, total, err := h.userActivityService.GetActivityByUser(userID, filter)
+	if token := c.Query("cursor"); token != "" {
+		cursor, err := services.ParseActivityCursor(token)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusBadRequest, err)
+			return false
+		}
+		filter.Cursor = cursor
+	}
+	return true
+}
+
+// writeActivityList answers with a page of the activities filter matches, or
+// with format=ndjson streams them all, one JSON activity per line
+func (h *Handler) writeActivityList(c *gin.Context, filter services.ActivityFilter) {
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+	case "ndjson":
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Status(http.StatusOK)
+
+		// Headers are already sent, so errors can only be recorded at this point
+		encoder := json.NewEncoder(c.Writer)
+		err := h.userActivityService.StreamUserActivity(c.Request.Context(), filter, func(activity *database.UserActivityHistory) error {
+			return encoder.Encode(activityResponse(activity))
+		})
+		if err != nil {
+			c.Error(err)
+		}
+		return
+	default:
+		errorResponse(c, http.StatusBadRequest, "Invalid format. Must be one of: [json ndjson]")
+		return
+	}
+
+	activities, total, err := h.userActivityService.GetUserActivity(filter)
 	if err != nil {
-		errorResponse(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get user activity: %v", err))
+		serviceErrorResponse(c, http.StatusInternalServerError, fmt.Errorf("Failed to get user activity: %w", err))
 		return
 	}
 
+	// next_cursor continues after this page, and stays fast where deep offsets do not
+	var nextCursor *string
+	if cursor := services.NextActivityCursor(activities, filter.Limit); cursor != nil {
+		token := cursor.String()
+		nextCursor = &token
+	}
+
 	// Build response
-	response := gin.H{
-		"data": activities,
-		"meta": gin.H{
-			"total":  total,
-			"limit":  filter.Limit,
-			"offset": filter.Offset,
+	activityList := make([]activityBody, len(activities))
+	for i := range activities {
+		activityList[i] = activityResponse(&activities[i])
+	}
+	response := activityListBody{
+		Data: activityList,
+		Meta: activityListMeta{
+			Total:      total,
+			Limit:      filter.Limit,
+			Offset:     filter.Offset,
+			NextCursor: nextCursor,
 		},
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
-// GetActivityByID handles GET /api/v1/user-activity/activity/{id}
-func (h *Handler) GetActivityByID(c *gin.Context) {
-	// Parse activity ID
-	activityIDStr := c.Param("id")
-	activityID, err := uuid.Parse(activityIDStr)
-	if err != nil {
-		errorResponse(c, http.StatusBadRequest, "Invalid activity ID")
-		return
-	}
+// activityBody is the API representation of a user activity
+type activityBody struct {
+	ID           uuid.UUID              `json:"id"`
+	User         userBody               `json:"user"`
+	Action       actionBody             `json:"action"`
+	FromDateTime time.Time              `json:"from_datetime" doc:"With the offset of timezone"`
+	ToDateTime   *time.Time             `json:"to_datetime" doc:"With the offset of timezone"`
+	Timezone     string                 `json:"timezone" doc:"The location's timezone, else the user's, else UTC"`
+	Location     *locationBody          `json:"location"`
+	Status       *userStatusBody        `json:"status"`
+	Details      map[string]interface{} `json:"details"`
+	CreatedAt    time.Time              `json:"created_at"`
+	UpdatedAt    time.Time              `json:"updated_at"`
+}
 
-	// Get activity
-	activity, err := h.userActivityService.GetActivityByID(activityID)
-	if err != nil {
-		errorResponse(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get activity: %v", err))
-		return
+// activityResponse formats a user activity for API responses
+func activityResponse(activity *database.UserActivityHistory) activityBody {
+	var details map[string]interface{}
+	if activity.Details.Status == pgtype.Present {
+		activity.Details.AssignTo(&details)
 	}
 
-	if activity == nil {
-		errorResponse(c, http.StatusNotFound, "Activity not found")
-		return
+	response := activityBody{
+		ID:           activity.ID,
+		User:         userResponse(&activity.User),
+		Action:       actionResponse(&activity.Action),
+		FromDateTime: activity.FromDateTime,
+		ToDateTime:   activity.ToDateTime,
+		Timezone:     activity.Timezone,
+		Details:      details,
+		CreatedAt:    activity.CreatedAt,
+		UpdatedAt:    activity.UpdatedAt,
 	}
+	if activity.Location != nil {
+		location := locationResponse(activity.Location)
+		response.Location = &location
+	}
+	if activity.Status != nil {
+		status := userStatusResponse(activity.Status)
+		response.Status = &status
+	}
+	return response
+}
+
+// activityListBody is a page of user activities
+type activityListBody struct {
+	Data []activityBody   `json:"data"`
+	Meta activityListMeta `json:"meta"`
+}
+
+// activityListMeta describes a page of user activities
+type activityListMeta struct {
+	Total      int64   `json:"total"`
+	Limit      int     `json:"limit"`
+	Offset     int     `json:"offset"`
+	NextCursor *string `json:"next_cursor" doc:"Cursor of the next page; null on the last page"`
+}
+
+// activityItemBody is the body of GET /user-activity/activity/:id
+type activityItemBody struct {
+	Data activityBody `json:"data"`
+}
 
-	c.JSON(http.StatusOK, gin.H{"data": activity})
+// activitySummaryListBody is the body of GET /user-activity/summary
+type activitySummaryListBody struct {
+	Data []services.ActivitySummary `json:"data"`
+	Meta activitySummaryMeta        `json:"meta"`
+}
+
+// activitySummaryMeta describes the period activity summaries cover
+type activitySummaryMeta struct {
+	FromDateTime time.Time `json:"from_datetime"`
+	ToDateTime   time.Time `json:"to_datetime"`
+	Categories   []string  `json:"categories"`
 }
 
 // parseUUIDArray parses a comma-separated string of UUIDs
@@ -304,4 +419,19 @@ func handleGetActivityByID(userActivityService *services.UserActivityService) gi
 		handler := &Handler{userActivityService: userActivityService}
 		handler.GetActivityByID(c)
 	}
-} 
\ No newline at end of file
+}
+
+// handleRepairOpenActivities handles POST /user-activity/repair-open. Users
+// left with more than one open activity keep only their latest; dry_run=true
+// reports what would change without changing it.
+func handleRepairOpenActivities(userActivityService *services.UserActivityService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dryRun, _ := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+		repairs, err := userActivityService.RepairOpenActivities(dryRun)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+		listResponse(c, repairs, int64(len(repairs)))
+	}
+}
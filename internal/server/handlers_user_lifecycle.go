@@ -0,0 +1,180 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// User lifecycle handlers
+
+// transitionUserStateRequest is the body of POST /users/:id/state
+type transitionUserStateRequest struct {
+	State       string  `json:"state" binding:"required"`
+	Reason      string  `json:"reason" binding:"required"`
+	EffectiveAt *string `json:"effective_at" doc:"Optional; defaults to now"`
+	Nonce       string  `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleTransitionUserState handles POST /users/:id/state
+func handleTransitionUserState(lifecycleService *services.UserLifecycleService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+
+		var req transitionUserStateRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		var effectiveAt *time.Time
+		if req.EffectiveAt != nil && *req.EffectiveAt != "" {
+			t, err := parseReportTime(*req.EffectiveAt, false)
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Invalid effective_at: "+err.Error())
+				return
+			}
+			effectiveAt = &t
+		}
+
+		requestedByID := c.MustGet("user_id").(uuid.UUID)
+		transition, err := lifecycleService.TransitionUser(userID, req.State, req.Reason, effectiveAt, &requestedByID)
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		createdResponse(c, userStateTransitionResponse(transition))
+	}
+}
+
+// handleListUserStateTransitions handles GET /users/:id/state-transitions
+func handleListUserStateTransitions(lifecycleService *services.UserLifecycleService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+
+		transitions, err := lifecycleService.ListTransitions(userID)
+		if err != nil {
+			errorResponse(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		transitionList := make([]userStateTransitionBody, len(transitions))
+		for i := range transitions {
+			transitionList[i] = userStateTransitionResponse(&transitions[i])
+		}
+
+		listResponse(c, transitionList, int64(len(transitionList)))
+	}
+}
+
+// cancelUserStateTransitionRequest is the body of POST /users/:id/state-transitions/:transition_id/cancel
+type cancelUserStateTransitionRequest struct {
+	Note  string `json:"note"`
+	Nonce string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleCancelUserStateTransition handles POST /users/:id/state-transitions/:transition_id/cancel
+func handleCancelUserStateTransition(lifecycleService *services.UserLifecycleService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		transitionID, err := uuid.Parse(c.Param("transition_id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid transition ID")
+			return
+		}
+
+		var req cancelUserStateTransitionRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				bindErrorResponse(c, err)
+				return
+			}
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		transition, err := lifecycleService.CancelTransition(transitionID, req.Note)
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		itemResponse(c, userStateTransitionResponse(transition))
+	}
+}
+
+// userStateBody describes a lifecycle state and the states it may move to
+type userStateBody struct {
+	State           string   `json:"state"`
+	Transitions     []string `json:"transitions"`
+	CanAuthenticate bool     `json:"can_authenticate"`
+}
+
+// handleListUserStates handles GET /users/states
+func handleListUserStates() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		states := make([]userStateBody, 0, len(services.UserStateTransitions))
+		for _, state := range services.UserStates() {
+			states = append(states, userStateBody{
+				State:           state,
+				Transitions:     services.UserStateTransitions[state],
+				CanAuthenticate: services.UserStateAllowsAuthentication(state),
+			})
+		}
+		listResponse(c, states, int64(len(states)))
+	}
+}
+
+// userStateTransitionBody is a scheduled or applied lifecycle state change
+type userStateTransitionBody struct {
+	ID            uuid.UUID  `json:"id"`
+	UserID        uuid.UUID  `json:"user_id"`
+	FromState     string     `json:"from_state" doc:"State when applied, or expected while pending"`
+	ToState       string     `json:"to_state"`
+	Reason        string     `json:"reason"`
+	EffectiveAt   time.Time  `json:"effective_at"`
+	Status        string     `json:"status" enum:"pending,applied,cancelled"`
+	AppliedAt     *time.Time `json:"applied_at"`
+	Note          string     `json:"note" doc:"Why the transition was cancelled"`
+	RequestedByID *uuid.UUID `json:"requested_by_id" doc:"Null when made from the CLI"`
+	RequestedBy   string     `json:"requested_by,omitempty" doc:"Username of the requester"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// userStateTransitionResponse formats a state transition for API responses
+func userStateTransitionResponse(transition *database.UserStateTransition) userStateTransitionBody {
+	response := userStateTransitionBody{
+		ID:            transition.ID,
+		UserID:        transition.UserID,
+		FromState:     transition.FromState,
+		ToState:       transition.ToState,
+		Reason:        transition.Reason,
+		EffectiveAt:   transition.EffectiveAt,
+		Status:        transition.Status,
+		AppliedAt:     transition.AppliedAt,
+		Note:          transition.Note,
+		RequestedByID: transition.RequestedByID,
+		CreatedAt:     transition.CreatedAt,
+	}
+	if transition.RequestedBy != nil {
+		response.RequestedBy = transition.RequestedBy.Username
+	}
+	return response
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -22,43 +23,35 @@ func handleListUserStatuses(userStatusService *services.UserStatusService) gin.H
 			userStatuses, err = userStatusService.ListUserStatuses()
 		}
 		if err != nil {
-			errorResponse(c, http.StatusInternalServerError, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
 		// Build response
-		userStatusList := make([]gin.H, len(userStatuses))
-		for i, userStatus := range userStatuses {
-			userStatusList[i] = gin.H{
-				"id":          userStatus.ID,
-				"name":        userStatus.Name,
-				"description": userStatus.Description,
-				"type":        userStatus.Type,
-				"active":      userStatus.Active,
-				"created_at":  userStatus.CreatedAt,
-				"updated_at":  userStatus.UpdatedAt,
-			}
+		userStatusList := make([]userStatusBody, len(userStatuses))
+		for i := range userStatuses {
+			userStatusList[i] = userStatusResponse(&userStatuses[i])
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"items": userStatusList,
-			"total": len(userStatusList),
-		})
+		c.JSON(http.StatusOK, listBody{Items: userStatusList, Total: int64(len(userStatusList))})
 	}
 }
 
+// createUserStatusRequest is the body of POST /user-statuses
+type createUserStatusRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	Type        string `json:"type" enum:"working,break,leave,travel,other"`
+	Active      bool   `json:"active"`
+}
+
 // handleCreateUserStatus handles POST /user-statuses
 func handleCreateUserStatus(userStatusService *services.UserStatusService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var req struct {
-			Name        string `json:"name" binding:"required"`
-			Description string `json:"description"`
-			Type        string `json:"type"`
-			Active      bool   `json:"active"`
-		}
+		var req createUserStatusRequest
 
 		if err := c.ShouldBindJSON(&req); err != nil {
-			errorResponse(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			bindErrorResponse(c, err)
 			return
 		}
 
@@ -69,19 +62,11 @@ func handleCreateUserStatus(userStatusService *services.UserStatusService) gin.H
 
 		userStatus, err := userStatusService.CreateUserStatus(req.Name, req.Description, req.Type, req.Active)
 		if err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		c.JSON(http.StatusCreated, gin.H{
-			"id":          userStatus.ID,
-			"name":        userStatus.Name,
-			"description": userStatus.Description,
-			"type":        userStatus.Type,
-			"active":      userStatus.Active,
-			"created_at":  userStatus.CreatedAt,
-			"updated_at":  userStatus.UpdatedAt,
-		})
+		c.JSON(http.StatusCreated, userStatusResponse(userStatus))
 	}
 }
 
@@ -97,22 +82,23 @@ func handleGetUserStatus(userStatusService *services.UserStatusService) gin.Hand
 
 		userStatus, err := userStatusService.GetUserStatusByID(id)
 		if err != nil {
-			errorResponse(c, http.StatusNotFound, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"id":          userStatus.ID,
-			"name":        userStatus.Name,
-			"description": userStatus.Description,
-			"type":        userStatus.Type,
-			"active":      userStatus.Active,
-			"created_at":  userStatus.CreatedAt,
-			"updated_at":  userStatus.UpdatedAt,
-		})
+		c.JSON(http.StatusOK, userStatusResponse(userStatus))
 	}
 }
 
+// updateUserStatusRequest is the body of PUT /user-statuses/{id}
+type updateUserStatusRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	Type        *string `json:"type" enum:"working,break,leave,travel,other"`
+	Active      *bool   `json:"active"`
+	Version     *int    `json:"version" doc:"Optional: the version the update is based on; a different current version is rejected with 409"`
+}
+
 // handleUpdateUserStatus handles PUT /user-statuses/{id}
 func handleUpdateUserStatus(userStatusService *services.UserStatusService) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -123,33 +109,20 @@ func handleUpdateUserStatus(userStatusService *services.UserStatusService) gin.H
 			return
 		}
 
-		var req struct {
-			Name        *string `json:"name"`
-			Description *string `json:"description"`
-			Type        *string `json:"type"`
-			Active      *bool   `json:"active"`
-		}
+		var req updateUserStatusRequest
 
 		if err := c.ShouldBindJSON(&req); err != nil {
-			errorResponse(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			bindErrorResponse(c, err)
 			return
 		}
 
-		userStatus, err := userStatusService.UpdateUserStatus(id, req.Name, req.Description, req.Type, req.Active)
+		userStatus, err := userStatusService.UpdateUserStatus(id, req.Version, req.Name, req.Description, req.Type, req.Active)
 		if err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"id":          userStatus.ID,
-			"name":        userStatus.Name,
-			"description": userStatus.Description,
-			"type":        userStatus.Type,
-			"active":      userStatus.Active,
-			"created_at":  userStatus.CreatedAt,
-			"updated_at":  userStatus.UpdatedAt,
-		})
+		c.JSON(http.StatusOK, userStatusResponse(userStatus))
 	}
 }
 
@@ -164,10 +137,36 @@ func handleDeleteUserStatus(userStatusService *services.UserStatusService) gin.H
 		}
 
 		if err := userStatusService.DeleteUserStatus(id); err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
 		c.Status(http.StatusNoContent)
 	}
-} 
\ No newline at end of file
+}
+
+// userStatusBody is the API representation of a user status
+type userStatusBody struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Type        string    `json:"type" enum:"working,break,leave,travel,other"`
+	Active      bool      `json:"active"`
+	Version     int       `json:"version" doc:"Incremented by every update; send it back with updates to reject them if someone else changed the record"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// userStatusResponse formats a user status for API responses
+func userStatusResponse(userStatus *database.UserStatus) userStatusBody {
+	return userStatusBody{
+		ID:          userStatus.ID,
+		Name:        userStatus.Name,
+		Description: userStatus.Description,
+		Type:        userStatus.Type,
+		Active:      userStatus.Active,
+		Version:     userStatus.Version,
+		CreatedAt:   userStatus.CreatedAt,
+		UpdatedAt:   userStatus.UpdatedAt,
+	}
+}
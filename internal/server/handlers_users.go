@@ -2,54 +2,75 @@ package server
 
 import (
 	"net/http"
+	"strings"
+	"time"
 
-	"github.com/YubiApp/internal/services"
 	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
 // User API handlers
 
+// createUserRequest is the body of POST /users
+type createUserRequest struct {
+	Email      string                 `json:"email" binding:"required,email"`
+	Username   string                 `json:"username" binding:"required"`
+	Password   string                 `json:"password" binding:"required"`
+	FirstName  string                 `json:"first_name"`
+	LastName   string                 `json:"last_name"`
+	Active     bool                   `json:"active"`
+	Attributes map[string]interface{} `json:"attributes" doc:"Custom attributes; each must be declared in users.attributes and required ones must be given"`
+	ManagerID  *uuid.UUID             `json:"manager_id" doc:"The user this user reports to"`
+	Locale     string                 `json:"locale" doc:"Preferred language as a BCP 47 tag, e.g. fr or pt-BR"`
+	Timezone   string                 `json:"timezone" doc:"IANA timezone, e.g. Europe/Paris"`
+	Nonce      string                 `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
 func handleCreateUser(userService *services.UserService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var req struct {
-			Email     string `json:"email" binding:"required,email"`
-			Username  string `json:"username" binding:"required"`
-			Password  string `json:"password" binding:"required,min=8"`
-			FirstName string `json:"first_name"`
-			LastName  string `json:"last_name"`
-			Active    bool   `json:"active"`
-			Nonce     string `json:"nonce"` // Optional nonce for response signing
-		}
+		var req createUserRequest
 
 		if err := c.ShouldBindJSON(&req); err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			bindErrorResponse(c, err)
 			return
 		}
 
 		// Store nonce in context for response functions to use
 		setRequestNonce(c, req.Nonce)
 
-		user, err := userService.CreateUser(req.Email, req.Username, req.Password, req.FirstName, req.LastName, req.Active)
+		user, err := userService.CreateUser(req.Email, req.Username, req.Password, req.FirstName, req.LastName, req.Active, req.Attributes, req.ManagerID, req.Locale, req.Timezone)
 		if err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		createdResponse(c, gin.H{
-			"id":         user.ID,
-			"email":      user.Email,
-			"username":   user.Username,
-			"first_name": user.FirstName,
-			"last_name":  user.LastName,
-			"active":     user.Active,
-			"created_at": user.CreatedAt,
-		})
+		createdResponse(c, userResponse(user))
 	}
 }
 
-func handleGetUser(userService *services.UserService) gin.HandlerFunc {
+// handleListUserAttributes handles GET /users/attributes, the custom attributes
+// users carry as configured in users.attributes
+func handleListUserAttributes(userService *services.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		declared := userService.AttributeSchema().Attributes()
+		attributes := make([]userAttributeBody, len(declared))
+		for i, attribute := range declared {
+			attributes[i] = userAttributeBody{
+				Name:     attribute.Name,
+				Type:     attribute.Type,
+				Required: attribute.Required,
+				Enum:     attribute.Enum,
+			}
+		}
+		listResponse(c, attributes, int64(len(attributes)))
+	}
+}
+
+// handleListUserReports handles GET /users/:id/reports, the users who report
+// directly to a user
+func handleListUserReports(userService *services.UserService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, err := uuid.Parse(c.Param("id"))
 		if err != nil {
@@ -57,74 +78,98 @@ func handleGetUser(userService *services.UserService) gin.HandlerFunc {
 			return
 		}
 
-		user, err := userService.GetUserByID(userID)
+		reports, err := userService.DirectReports(userID)
 		if err != nil {
-			errorResponse(c, http.StatusNotFound, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		// Build roles list
-		roles := make([]gin.H, len(user.Roles))
-		for i, role := range user.Roles {
-			roles[i] = gin.H{
-				"id":          role.ID,
-				"name":        role.Name,
-				"description": role.Description,
-			}
+		listResponse(c, orgChartUsers(reports), int64(len(reports)))
+	}
+}
+
+// handleGetManagersChain handles GET /users/:id/managers-chain, a user's
+// manager, their manager and so on, nearest first
+func handleGetManagersChain(userService *services.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid user ID")
+			return
 		}
 
-		itemResponse(c, gin.H{
-			"id":         user.ID,
-			"email":      user.Email,
-			"username":   user.Username,
-			"first_name": user.FirstName,
-			"last_name":  user.LastName,
-			"active":     user.Active,
-			"created_at": user.CreatedAt,
-			"updated_at": user.UpdatedAt,
-			"roles":      roles,
-		})
+		managers, err := userService.ManagersChain(userID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		listResponse(c, orgChartUsers(managers), int64(len(managers)))
 	}
 }
 
-func handleListUsers(userService *services.UserService) gin.HandlerFunc {
+// orgChartUsers builds the responses for users listed in an org chart
+func orgChartUsers(users []database.User) []orgChartUserBody {
+	items := make([]orgChartUserBody, len(users))
+	for i, user := range users {
+		items[i] = orgChartUserBody{
+			ID:        user.ID,
+			Email:     user.Email,
+			Username:  user.Username,
+			FirstName: user.FirstName,
+			LastName:  user.LastName,
+			Active:    user.Active,
+			State:     user.State,
+			ManagerID: user.ManagerID,
+		}
+	}
+	return items
+}
+
+func handleGetUser(userService *services.UserService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		activeOnly := c.Query("active") == "true"
-		var users []database.User
-		var err error
-		if activeOnly {
-			users, err = userService.ListActiveUsers()
-		} else {
-			users, err = userService.ListUsers()
+		userID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid user ID")
+			return
 		}
+
+		user, err := userService.GetUserByID(userID)
 		if err != nil {
-			errorResponse(c, http.StatusInternalServerError, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		// Build response
-		userList := make([]gin.H, len(users))
-		for i, user := range users {
-			// Build roles list for each user
-			roles := make([]gin.H, len(user.Roles))
-			for j, role := range user.Roles {
-				roles[j] = gin.H{
-					"id":          role.ID,
-					"name":        role.Name,
-					"description": role.Description,
-				}
+		itemResponse(c, userResponse(user))
+	}
+}
+
+func handleListUsers(userService *services.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		includeDeleted := c.Query("include_deleted") == "true"
+		filter := services.UserListFilter{
+			ActiveOnly:     c.Query("active") == "true",
+			IncludeDeleted: includeDeleted,
+			Attributes:     map[string]string{},
+		}
+		// ?attr.department=Engineering matches users whose department attribute is Engineering
+		for key, values := range c.Request.URL.Query() {
+			if name, ok := strings.CutPrefix(key, "attr."); ok && len(values) > 0 {
+				filter.Attributes[name] = values[0]
 			}
+		}
+
+		users, err := userService.ListUsersFiltered(filter)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
 
-			userList[i] = gin.H{
-				"id":         user.ID,
-				"email":      user.Email,
-				"username":   user.Username,
-				"first_name": user.FirstName,
-				"last_name":  user.LastName,
-				"active":     user.Active,
-				"created_at": user.CreatedAt,
-				"updated_at": user.UpdatedAt,
-				"roles":      roles,
+		userList := make([]userBody, len(users))
+		for i := range users {
+			userList[i] = userResponse(&users[i])
+			if includeDeleted && users[i].DeletedAt.Valid {
+				userList[i].DeletedAt = &users[i].DeletedAt.Time
 			}
 		}
 
@@ -132,6 +177,23 @@ func handleListUsers(userService *services.UserService) gin.HandlerFunc {
 	}
 }
 
+// updateUserRequest is the body of PUT /users/:id
+type updateUserRequest struct {
+	Email        *string                `json:"email"`
+	Username     *string                `json:"username"`
+	Password     *string                `json:"password"`
+	FirstName    *string                `json:"first_name"`
+	LastName     *string                `json:"last_name"`
+	Active       *bool                  `json:"active"`
+	UnixUsername *string                `json:"unix_username"`
+	Attributes   map[string]interface{} `json:"attributes" doc:"Attribute changes merged into the user's attributes; null removes an attribute"`
+	ManagerID    *string                `json:"manager_id" doc:"The new manager's ID, or empty to remove the manager. The manager cannot be one of the user's own reports."`
+	Locale       *string                `json:"locale" doc:"Preferred language as a BCP 47 tag, e.g. fr or pt-BR, or empty to follow Accept-Language"`
+	Timezone     *string                `json:"timezone" doc:"IANA timezone, e.g. Europe/Paris, or empty for UTC"`
+	Version      *int                   `json:"version" doc:"Optional: the version the update is based on; a different current version is rejected with 409"`
+	Nonce        string                 `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
 func handleUpdateUser(userService *services.UserService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, err := uuid.Parse(c.Param("id"))
@@ -140,18 +202,10 @@ func handleUpdateUser(userService *services.UserService) gin.HandlerFunc {
 			return
 		}
 
-		var req struct {
-			Email     *string `json:"email"`
-			Username  *string `json:"username"`
-			Password  *string `json:"password"`
-			FirstName *string `json:"first_name"`
-			LastName  *string `json:"last_name"`
-			Active    *bool   `json:"active"`
-			Nonce     string  `json:"nonce"` // Optional nonce for response signing
-		}
+		var req updateUserRequest
 
 		if err := c.ShouldBindJSON(&req); err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			bindErrorResponse(c, err)
 			return
 		}
 
@@ -178,34 +232,38 @@ func handleUpdateUser(userService *services.UserService) gin.HandlerFunc {
 		if req.Active != nil {
 			updates["active"] = *req.Active
 		}
+		if req.UnixUsername != nil {
+			updates["unix_username"] = *req.UnixUsername
+		}
+		if req.Attributes != nil {
+			updates["attributes"] = req.Attributes
+		}
+		if req.ManagerID != nil {
+			var managerID *uuid.UUID
+			if *req.ManagerID != "" {
+				id, err := uuid.Parse(*req.ManagerID)
+				if err != nil {
+					errorResponse(c, http.StatusBadRequest, "Invalid manager_id")
+					return
+				}
+				managerID = &id
+			}
+			updates["manager_id"] = managerID
+		}
+		if req.Locale != nil {
+			updates["locale"] = *req.Locale
+		}
+		if req.Timezone != nil {
+			updates["timezone"] = *req.Timezone
+		}
 
-		user, err := userService.UpdateUser(userID, updates)
+		user, err := userService.UpdateUser(userID, req.Version, updates)
 		if err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		// Build roles list
-		roles := make([]gin.H, len(user.Roles))
-		for i, role := range user.Roles {
-			roles[i] = gin.H{
-				"id":          role.ID,
-				"name":        role.Name,
-				"description": role.Description,
-			}
-		}
-
-		itemResponse(c, gin.H{
-			"id":         user.ID,
-			"email":      user.Email,
-			"username":   user.Username,
-			"first_name": user.FirstName,
-			"last_name":  user.LastName,
-			"active":     user.Active,
-			"created_at": user.CreatedAt,
-			"updated_at": user.UpdatedAt,
-			"roles":      roles,
-		})
+		itemResponse(c, userResponse(user))
 	}
 }
 
@@ -219,7 +277,7 @@ func handleDeleteUser(userService *services.UserService) gin.HandlerFunc {
 
 		err = userService.DeleteUser(userID)
 		if err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
@@ -227,6 +285,25 @@ func handleDeleteUser(userService *services.UserService) gin.HandlerFunc {
 	}
 }
 
+// handleRestoreUser handles POST /users/:id/restore
+func handleRestoreUser(userService *services.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+
+		user, err := userService.RestoreUser(userID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, userResponse(user))
+	}
+}
+
 func handleAssignUserToRole(userService *services.UserService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, err := uuid.Parse(c.Param("user_id"))
@@ -243,13 +320,11 @@ func handleAssignUserToRole(userService *services.UserService) gin.HandlerFunc {
 
 		err = userService.AssignUserToRole(userID, roleID)
 		if err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		successResponse(c, gin.H{
-			"message": "User assigned to role successfully",
-		})
+		successResponse(c, messageBody{Message: "User assigned to role successfully"})
 	}
 }
 
@@ -269,12 +344,89 @@ func handleRemoveUserFromRole(userService *services.UserService) gin.HandlerFunc
 
 		err = userService.RemoveUserFromRole(userID, roleID)
 		if err != nil {
-			errorResponse(c, http.StatusBadRequest, err.Error())
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		successResponse(c, gin.H{
-			"message": "User removed from role successfully",
-		})
+		successResponse(c, messageBody{Message: "User removed from role successfully"})
+	}
+} 
+
+// userBody is the API representation of a user
+type userBody struct {
+	ID           uuid.UUID              `json:"id"`
+	Email        string                 `json:"email"`
+	Username     string                 `json:"username"`
+	FirstName    string                 `json:"first_name"`
+	LastName     string                 `json:"last_name"`
+	UnixUsername string                 `json:"unix_username" doc:"Login name on machines; defaults to username when empty"`
+	Attributes   map[string]interface{} `json:"attributes" doc:"Custom profile attributes declared in users.attributes (see /users/attributes)"`
+	ManagerID    *uuid.UUID             `json:"manager_id" doc:"The user this user reports to"`
+	Locale       string                 `json:"locale" doc:"Preferred language for error messages and emails, e.g. fr or pt-BR; empty follows Accept-Language"`
+	Timezone     string                 `json:"timezone" doc:"IANA timezone, e.g. Europe/Paris, that activity summaries and timesheets count the user's days in; empty is UTC"`
+	Active       bool                   `json:"active"`
+	State        string                 `json:"state" enum:"invited,active,suspended,leave,offboarded"`
+	Version      int                    `json:"version" doc:"Incremented by every update; send it back with updates to reject them if someone else changed the record"`
+	CreatedAt    time.Time              `json:"created_at"`
+	UpdatedAt    time.Time              `json:"updated_at"`
+	DeletedAt    *time.Time             `json:"deleted_at,omitempty" doc:"Set on deleted users, which are listed with include_deleted=true only"`
+	Roles        []roleSummaryBody      `json:"roles"`
+}
+
+// userResponse is the API representation of a user
+func userResponse(user *database.User) userBody {
+	return userBody{
+		ID:           user.ID,
+		Email:        user.Email,
+		Username:     user.Username,
+		FirstName:    user.FirstName,
+		LastName:     user.LastName,
+		UnixUsername: user.UnixUsername,
+		Attributes:   services.UserAttributes(user.Attributes),
+		ManagerID:    user.ManagerID,
+		Locale:       user.Locale,
+		Timezone:     user.Timezone,
+		Active:       user.Active,
+		State:        user.State,
+		Version:      user.Version,
+		CreatedAt:    user.CreatedAt,
+		UpdatedAt:    user.UpdatedAt,
+		Roles:        roleSummaries(user.Roles),
+	}
+}
+
+// roleSummaryBody identifies a role a user holds
+type roleSummaryBody struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+}
+
+// roleSummaries identifies the roles a user holds
+func roleSummaries(roles []database.Role) []roleSummaryBody {
+	summaries := make([]roleSummaryBody, len(roles))
+	for i, role := range roles {
+		summaries[i] = roleSummaryBody{ID: role.ID, Name: role.Name, Description: role.Description}
 	}
-} 
\ No newline at end of file
+	return summaries
+}
+
+// orgChartUserBody is a user as listed in an org chart
+type orgChartUserBody struct {
+	ID        uuid.UUID  `json:"id"`
+	Email     string     `json:"email"`
+	Username  string     `json:"username"`
+	FirstName string     `json:"first_name"`
+	LastName  string     `json:"last_name"`
+	Active    bool       `json:"active"`
+	State     string     `json:"state" enum:"invited,active,suspended,leave,offboarded"`
+	ManagerID *uuid.UUID `json:"manager_id"`
+}
+
+// userAttributeBody is a custom attribute declared in users.attributes
+type userAttributeBody struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type" enum:"string,number,boolean,date,user"`
+	Required bool     `json:"required"`
+	Enum     []string `json:"enum"`
+}
@@ -0,0 +1,355 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Visitor handlers
+
+// handleListVisitors handles GET /visitors
+func handleListVisitors(visitorService *services.VisitorService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := services.VisitorFilter{
+			Status: c.Query("status"),
+			Limit:  50,
+		}
+
+		var err error
+		if filter.LocationID, err = parseOptionalUUID(c.Query("location_id")); err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid location_id")
+			return
+		}
+		if filter.HostUserID, err = parseOptionalUUID(c.Query("host_user_id")); err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid host_user_id")
+			return
+		}
+		if fromStr := c.Query("from"); fromStr != "" {
+			from, err := parseReportTime(fromStr, false)
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Invalid 'from': "+err.Error())
+				return
+			}
+			filter.From = &from
+		}
+		if toStr := c.Query("to"); toStr != "" {
+			to, err := parseReportTime(toStr, true)
+			if err != nil {
+				errorResponse(c, http.StatusBadRequest, "Invalid 'to': "+err.Error())
+				return
+			}
+			filter.To = &to
+		}
+		if limitStr := c.Query("limit"); limitStr != "" {
+			if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+				filter.Limit = l
+			}
+		}
+		if offsetStr := c.Query("offset"); offsetStr != "" {
+			if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+				filter.Offset = o
+			}
+		}
+
+		visitors, total, err := visitorService.ListVisitors(filter)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		visitorList := make([]visitorBody, len(visitors))
+		for i := range visitors {
+			visitorList[i] = visitorResponse(&visitors[i])
+		}
+
+		listResponse(c, visitorList, total)
+	}
+}
+
+// createVisitorRequest is the body of POST /visitors
+type createVisitorRequest struct {
+	Name        string    `json:"name" binding:"required"`
+	Company     string    `json:"company"`
+	Email       string    `json:"email"`
+	Notes       string    `json:"notes"`
+	HostUserID  uuid.UUID `json:"host_user_id" binding:"required" doc:"Active user the visitor is meeting"`
+	LocationID  uuid.UUID `json:"location_id" binding:"required"`
+	ScheduledAt time.Time `json:"scheduled_at" binding:"required"`
+	Nonce       string    `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleCreateVisitor handles POST /visitors
+func handleCreateVisitor(visitorService *services.VisitorService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req createVisitorRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		visitor, err := visitorService.CreateVisitor(services.VisitorInput{
+			Name:        req.Name,
+			Company:     req.Company,
+			Email:       req.Email,
+			Notes:       req.Notes,
+			HostUserID:  req.HostUserID,
+			LocationID:  req.LocationID,
+			ScheduledAt: req.ScheduledAt,
+		})
+		if err != nil {
+			serviceErrorResponse(c, http.StatusBadRequest, err)
+			return
+		}
+
+		createdResponse(c, visitorResponse(visitor))
+	}
+}
+
+// handleGetVisitor handles GET /visitors/:id
+func handleGetVisitor(visitorService *services.VisitorService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid visitor ID")
+			return
+		}
+
+		visitor, err := visitorService.GetVisitor(id)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, visitorResponse(visitor))
+	}
+}
+
+// updateVisitorRequest is the body of PUT /visitors/:id
+type updateVisitorRequest struct {
+	Name        *string    `json:"name"`
+	Company     *string    `json:"company"`
+	Email       *string    `json:"email"`
+	Notes       *string    `json:"notes"`
+	HostUserID  *uuid.UUID `json:"host_user_id"`
+	LocationID  *uuid.UUID `json:"location_id"`
+	ScheduledAt *time.Time `json:"scheduled_at"`
+	Status      *string    `json:"status" enum:"expected,cancelled" doc:"Cancels an expected visit or reinstates a cancelled one"`
+	Version     *int       `json:"version" doc:"Version the update is based on"`
+	Nonce       string     `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleUpdateVisitor handles PUT /visitors/:id
+func handleUpdateVisitor(visitorService *services.VisitorService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid visitor ID")
+			return
+		}
+
+		var req updateVisitorRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		visitor, err := visitorService.UpdateVisitor(id, services.VisitorUpdate{
+			Name:        req.Name,
+			Company:     req.Company,
+			Email:       req.Email,
+			Notes:       req.Notes,
+			HostUserID:  req.HostUserID,
+			LocationID:  req.LocationID,
+			ScheduledAt: req.ScheduledAt,
+			Status:      req.Status,
+		}, req.Version)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusBadRequest, err)
+			return
+		}
+
+		itemResponse(c, visitorResponse(visitor))
+	}
+}
+
+// handleDeleteVisitor handles DELETE /visitors/:id
+func handleDeleteVisitor(visitorService *services.VisitorService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid visitor ID")
+			return
+		}
+
+		if err := visitorService.DeleteVisitor(id); err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		deletedResponse(c)
+	}
+}
+
+// checkInVisitorRequest is the body of POST /visitors/:id/check-in
+type checkInVisitorRequest struct {
+	BadgeNumber string `json:"badge_number" doc:"Badge handed to the visitor, if any"`
+	Nonce       string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleCheckInVisitor handles POST /visitors/:id/check-in
+func handleCheckInVisitor(visitorService *services.VisitorService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid visitor ID")
+			return
+		}
+
+		var req checkInVisitorRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				bindErrorResponse(c, err)
+				return
+			}
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		desk, ok := visitorDesk(c)
+		if !ok {
+			return
+		}
+
+		visitor, err := visitorService.CheckIn(id, req.BadgeNumber, desk)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, visitorResponse(visitor))
+	}
+}
+
+// checkOutVisitorRequest is the body of POST /visitors/:id/check-out
+type checkOutVisitorRequest struct {
+	Nonce string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+// handleCheckOutVisitor handles POST /visitors/:id/check-out
+func handleCheckOutVisitor(visitorService *services.VisitorService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid visitor ID")
+			return
+		}
+
+		var req checkOutVisitorRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				bindErrorResponse(c, err)
+				return
+			}
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		desk, ok := visitorDesk(c)
+		if !ok {
+			return
+		}
+
+		visitor, err := visitorService.CheckOut(id, desk)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, visitorResponse(visitor))
+	}
+}
+
+// visitorDesk is the receptionist and device a check-in or check-out is
+// performed with. Visitors are checked in and out by reception with their
+// device, never by a service identity.
+func visitorDesk(c *gin.Context) (services.VisitorDesk, bool) {
+	device, ok := c.Get("device")
+	if !ok {
+		errorResponse(c, http.StatusForbidden, "Visitor check-in and check-out require device authentication")
+		return services.VisitorDesk{}, false
+	}
+	return services.VisitorDesk{
+		UserID:   c.MustGet("user_id").(uuid.UUID),
+		DeviceID: device.(*database.Device).ID,
+	}, true
+}
+
+// visitorBody is the API representation of a visitor
+type visitorBody struct {
+	ID                 uuid.UUID  `json:"id"`
+	Name               string     `json:"name"`
+	Company            string     `json:"company"`
+	Email              string     `json:"email"`
+	Notes              string     `json:"notes"`
+	HostUserID         uuid.UUID  `json:"host_user_id"`
+	HostUsername       string     `json:"host_username"`
+	LocationID         uuid.UUID  `json:"location_id"`
+	LocationName       string     `json:"location_name"`
+	ScheduledAt        time.Time  `json:"scheduled_at"`
+	Status             string     `json:"status" enum:"expected,checked_in,checked_out,cancelled"`
+	BadgeNumber        string     `json:"badge_number" doc:"Badge handed out at check-in; held by one checked-in visitor at a time"`
+	CheckedInAt        *time.Time `json:"checked_in_at"`
+	CheckedInByID      *uuid.UUID `json:"checked_in_by_id" doc:"Receptionist who checked the visitor in"`
+	CheckedInDeviceID  *uuid.UUID `json:"checked_in_device_id"`
+	CheckedOutAt       *time.Time `json:"checked_out_at"`
+	CheckedOutByID     *uuid.UUID `json:"checked_out_by_id"`
+	CheckedOutDeviceID *uuid.UUID `json:"checked_out_device_id"`
+	HostNotifiedAt     *time.Time `json:"host_notified_at" doc:"When the host was emailed of the arrival; null when skipped or failed"`
+	Version            int        `json:"version" doc:"Incremented by every update; send it back with updates to reject them if someone else changed the record"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+// visitorResponse is the API representation of a visitor
+func visitorResponse(visitor *database.Visitor) visitorBody {
+	return visitorBody{
+		ID:                 visitor.ID,
+		Name:               visitor.Name,
+		Company:            visitor.Company,
+		Email:              visitor.Email,
+		Notes:              visitor.Notes,
+		HostUserID:         visitor.HostUserID,
+		HostUsername:       visitor.HostUser.Username,
+		LocationID:         visitor.LocationID,
+		LocationName:       visitor.Location.Name,
+		ScheduledAt:        visitor.ScheduledAt,
+		Status:             visitor.Status,
+		BadgeNumber:        visitor.BadgeNumber,
+		CheckedInAt:        visitor.CheckedInAt,
+		CheckedInByID:      visitor.CheckedInByID,
+		CheckedInDeviceID:  visitor.CheckedInDeviceID,
+		CheckedOutAt:       visitor.CheckedOutAt,
+		CheckedOutByID:     visitor.CheckedOutByID,
+		CheckedOutDeviceID: visitor.CheckedOutDeviceID,
+		HostNotifiedAt:     visitor.HostNotifiedAt,
+		Version:            visitor.Version,
+		CreatedAt:          visitor.CreatedAt,
+		UpdatedAt:          visitor.UpdatedAt,
+	}
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Webhook API handlers
+
+// createWebhookRequest is the body of POST /webhooks
+type createWebhookRequest struct {
+	Name       string   `json:"name" binding:"required"`
+	URL        string   `json:"url" binding:"required"`
+	EventTypes []string `json:"event_types" binding:"required"`
+	Secret     string   `json:"secret"`
+	Active     *bool    `json:"active"`
+	Nonce      string   `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+func handleCreateWebhook(webhookService *services.WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req createWebhookRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		active := true
+		if req.Active != nil {
+			active = *req.Active
+		}
+
+		webhook, err := webhookService.CreateWebhook(req.Name, req.URL, req.EventTypes, req.Secret, active)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		createdResponse(c, webhookResponse(webhook))
+	}
+}
+
+func handleGetWebhook(webhookService *services.WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		webhookID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid webhook ID")
+			return
+		}
+
+		webhook, err := webhookService.GetWebhookByID(webhookID)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, webhookResponse(webhook))
+	}
+}
+
+func handleListWebhooks(webhookService *services.WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		webhooks, err := webhookService.ListWebhooks()
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		webhookList := make([]webhookBody, len(webhooks))
+		for i := range webhooks {
+			webhookList[i] = webhookResponse(&webhooks[i])
+		}
+
+		listResponse(c, webhookList, int64(len(webhookList)))
+	}
+}
+
+// updateWebhookRequest is the body of PUT /webhooks/:id
+type updateWebhookRequest struct {
+	Name       *string  `json:"name"`
+	URL        *string  `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Secret     *string  `json:"secret"`
+	Active     *bool    `json:"active"`
+	Nonce      string   `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
+func handleUpdateWebhook(webhookService *services.WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		webhookID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid webhook ID")
+			return
+		}
+
+		var req updateWebhookRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			bindErrorResponse(c, err)
+			return
+		}
+
+		// Store nonce in context for response functions to use
+		setRequestNonce(c, req.Nonce)
+
+		// Build updates map
+		updates := make(map[string]interface{})
+		if req.Name != nil {
+			updates["name"] = *req.Name
+		}
+		if req.URL != nil {
+			updates["url"] = *req.URL
+		}
+		if req.Secret != nil {
+			updates["secret"] = *req.Secret
+		}
+		if req.Active != nil {
+			updates["active"] = *req.Active
+		}
+
+		webhook, err := webhookService.UpdateWebhook(webhookID, updates, req.EventTypes)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		itemResponse(c, webhookResponse(webhook))
+	}
+}
+
+func handleDeleteWebhook(webhookService *services.WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		webhookID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid webhook ID")
+			return
+		}
+
+		if err := webhookService.DeleteWebhook(webhookID); err != nil {
+			serviceErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		deletedResponse(c)
+	}
+}
+
+// handleListWebhookEventTypes handles GET /webhooks/event-types
+func handleListWebhookEventTypes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listResponse(c, services.EventTypes, int64(len(services.EventTypes)))
+	}
+}
+
+// webhookBody is the API representation of a webhook
+type webhookBody struct {
+	ID             uuid.UUID  `json:"id"`
+	Name           string     `json:"name"`
+	URL            string     `json:"url"`
+	EventTypes     []string   `json:"event_types"`
+	Signed         bool       `json:"signed" doc:"Deliveries are signed with the webhook's secret"`
+	Active         bool       `json:"active"`
+	LastDeliveryAt *time.Time `json:"last_delivery_at"`
+	LastError      string     `json:"last_error"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// webhookResponse formats a webhook for API responses; the signing secret is never returned
+func webhookResponse(webhook *database.Webhook) webhookBody {
+	return webhookBody{
+		ID:             webhook.ID,
+		Name:           webhook.Name,
+		URL:            webhook.URL,
+		EventTypes:     services.WebhookEventTypes(webhook),
+		Signed:         webhook.Secret != "",
+		Active:         webhook.Active,
+		LastDeliveryAt: webhook.LastDeliveryAt,
+		LastError:      webhook.LastError,
+		CreatedAt:      webhook.CreatedAt,
+		UpdatedAt:      webhook.UpdatedAt,
+	}
+}
@@ -1,18 +1,105 @@
 package server
 
 import (
+	"crypto/x509"
 	"fmt"
+	"log"
+	"log/slog"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/logging"
 	"github.com/YubiApp/internal/services"
+	"github.com/YubiApp/internal/tracing"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
+// requestIDMiddleware gives each request an ID, reusing a well-formed incoming
+// X-Request-ID, and returns it in the X-Request-ID response header. The ID and
+// client IP are carried in the request context for the services.
+func requestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader("X-Request-ID")
+		if !validRequestID(requestID) {
+			requestID = uuid.New().String()
+		}
+		c.Set("request_id", requestID)
+		c.Header("X-Request-ID", requestID)
+		ctx := logging.WithRequestID(c.Request.Context(), requestID)
+		c.Request = c.Request.WithContext(services.WithClientIP(ctx, c.ClientIP()))
+		c.Next()
+	}
+}
+
+// requestLogger writes one structured log line per request, tagged with its
+// request ID, trace ID when traced and, once authenticated, the user
+func requestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		attrs := []any{
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"route", c.FullPath(),
+			"status", c.Writer.Status(),
+			"latency_ms", time.Since(start).Milliseconds(),
+			"client_ip", c.ClientIP(),
+			"user_agent", c.Request.UserAgent(),
+		}
+		if userID, ok := c.Get("user_id"); ok {
+			attrs = append(attrs, "user_id", userID)
+		}
+		if authMethod, ok := c.Get("auth_method"); ok {
+			attrs = append(attrs, "auth_method", authMethod)
+		}
+		if identity, ok := c.Get("service_identity"); ok {
+			attrs = append(attrs, "service_identity", identity)
+		}
+		if c.GetBool("break_glass") {
+			attrs = append(attrs, "break_glass", true)
+		}
+		if traceID := tracing.TraceID(c.Request.Context()); traceID != "" {
+			attrs = append(attrs, "trace_id", traceID)
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, "errors", c.Errors.String())
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case c.Writer.Status() >= 500:
+			level = slog.LevelError
+		case c.Writer.Status() >= 400:
+			level = slog.LevelWarn
+		}
+		logging.FromContext(c.Request.Context()).Log(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+// validRequestID accepts short IDs of letters, digits and '-', '_', '.', ':'
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > 128 {
+		return false
+	}
+	for _, r := range requestID {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_.:", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// readGrant reports whether an authenticated user lacking a route's permission
+// may read it anyway, e.g. as the manager of the user it is about
+type readGrant func(c *gin.Context, user *database.User) bool
+
 // authMiddlewareRead handles authentication for read operations (GET methods)
 // Accepts both device-based and session-based authentication
-func authMiddlewareRead(authService *services.AuthService, sessionService *services.SessionService, requiredPermission string) gin.HandlerFunc {
+func authMiddlewareRead(authService *services.AuthService, sessionService *services.SessionService, requiredPermission string, grant readGrant) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get Authorization header
 		authHeader := c.GetHeader("Authorization")
@@ -27,50 +114,49 @@ func authMiddlewareRead(authService *services.AuthService, sessionService *servi
 			// Session-based authentication
 			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 			
-			// Validate the access token
-			claims, err := sessionService.ValidateAccessToken(tokenString)
-			if err != nil {
-				errorResponse(c, http.StatusUnauthorized, fmt.Sprintf("Invalid access token: %v", err))
+			session, claims, user, ok := authenticateSession(c, authService, sessionService, tokenString)
+			if !ok {
 				c.Abort()
 				return
 			}
 
-			// Get the session from Redis
-			session, err := sessionService.GetSession(claims.SessionID)
-			if err != nil {
-				errorResponse(c, http.StatusUnauthorized, fmt.Sprintf("Session not found: %v", err))
+			// Sessions carry no permission of their own, so check the user's
+			hasPermission := requiredPermission == "" || authService.UserHasPermission(user, requiredPermission)
+			if !hasPermission && (grant == nil || !grant(c, user)) {
+				errorResponse(c, http.StatusForbidden, fmt.Sprintf("Permission denied: %s", requiredPermission))
 				c.Abort()
 				return
 			}
-
-			// Check if session is still valid (not invalidated by logout, etc.)
-			if !session.IsValid {
-				errorResponse(c, http.StatusUnauthorized, "Session has been invalidated")
-				c.Abort()
+			if !checkResourceNetwork(c, authService, user, requiredPermission) {
 				return
 			}
 
-			// Verify refresh count matches (prevents use of access tokens from before a refresh)
-			if session.RefreshCount != claims.RefreshCount {
-				errorResponse(c, http.StatusUnauthorized, "Access token is invalid (refresh count mismatch)")
+			// Impersonation and cross-device sessions are read-only unless minted otherwise
+			if session.ReadOnly && c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+				errorResponse(c, http.StatusForbidden, "Session is read-only")
 				c.Abort()
 				return
 			}
 
-			// Get user from database
-			var user database.User
-			if err := authService.GetDB().Preload("Roles.Permissions.Resource").Where("id = ?", claims.UserID).First(&user).Error; err != nil {
-				errorResponse(c, http.StatusUnauthorized, "User not found")
+			// Recovery code sessions only reach what recovery.permissions allows
+			if session.Recovery && requiredPermission != "" && !sessionService.RecoveryAllows(requiredPermission) {
+				errorResponse(c, http.StatusForbidden, fmt.Sprintf("Permission denied: %s is not available to recovery sessions", requiredPermission))
 				c.Abort()
 				return
 			}
 
 			// Store session info in context
 			c.Set("session", session)
-			c.Set("user", &user)
+			c.Set("user", user)
 			c.Set("user_id", user.ID)
 			c.Set("device_id", claims.DeviceID)
 			c.Set("auth_method", "session")
+			if session.ImpersonatorID != nil {
+				c.Set("impersonator_id", *session.ImpersonatorID)
+			}
+			if session.BreakGlass {
+				c.Set("break_glass", true)
+			}
 
 		} else {
 			// Device-based authentication
@@ -91,13 +177,29 @@ func authMiddlewareRead(authService *services.AuthService, sessionService *servi
 				return
 			}
 
-			// Authenticate user and check permissions
-			user, device, err := authService.AuthenticateDevice(deviceType, authCode, requiredPermission)
+			// Authenticate user and check permissions; with a grant, the
+			// permission is checked here so the grant can stand in for it
+			devicePermission := requiredPermission
+			if grant != nil {
+				devicePermission = ""
+			}
+			user, device, err := authService.AuthenticateDeviceContext(c.Request.Context(), deviceType, authCode, devicePermission)
 			if err != nil {
-				errorResponse(c, http.StatusUnauthorized, fmt.Sprintf("Authentication failed: %v", err))
+				serviceErrorResponse(c, http.StatusUnauthorized, fmt.Errorf("Authentication failed: %w", err))
 				c.Abort()
 				return
 			}
+			if grant != nil && requiredPermission != "" {
+				hasPermission := authService.UserHasPermission(user, requiredPermission)
+				if !hasPermission && !grant(c, user) {
+					errorResponse(c, http.StatusForbidden, fmt.Sprintf("Permission denied: %s", requiredPermission))
+					c.Abort()
+					return
+				}
+				if !checkResourceNetwork(c, authService, user, requiredPermission) {
+					return
+				}
+			}
 
 			// Store user and device in context
 			c.Set("user", user)
@@ -112,12 +214,13 @@ func authMiddlewareRead(authService *services.AuthService, sessionService *servi
 		c.Set("user_agent", c.GetHeader("User-Agent"))
 
 		c.Next()
+		logBreakGlassRequest(c, authService)
 	}
 }
 
 // authMiddlewareWrite handles authentication for write operations (POST, PUT, DELETE methods)
-// Only accepts device-based authentication
-func authMiddlewareWrite(authService *services.AuthService, requiredPermission string) gin.HandlerFunc {
+// Only accepts device-based authentication, or a break-glass session
+func authMiddlewareWrite(authService *services.AuthService, sessionService *services.SessionService, requiredPermission string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get Authorization header
 		authHeader := c.GetHeader("Authorization")
@@ -127,8 +230,14 @@ func authMiddlewareWrite(authService *services.AuthService, requiredPermission s
 			return
 		}
 
-		// Check if it's a Bearer token (session auth) - not allowed for write operations
+		// Check if it's a Bearer token (session auth) - not allowed for write
+		// operations, except in break-glass sessions opened without a device
 		if strings.HasPrefix(authHeader, "Bearer ") {
+			if sessionService != nil {
+				if authMiddlewareBreakGlassWrite(c, authService, sessionService, strings.TrimPrefix(authHeader, "Bearer "), requiredPermission) {
+					return
+				}
+			}
 			errorResponse(c, http.StatusForbidden, "Session-based authentication not allowed for write operations. Use device authentication.")
 			c.Abort()
 			return
@@ -152,9 +261,9 @@ func authMiddlewareWrite(authService *services.AuthService, requiredPermission s
 		}
 
 		// Authenticate user and check permissions
-		user, device, err := authService.AuthenticateDevice(deviceType, authCode, requiredPermission)
+		user, device, err := authService.AuthenticateDeviceContext(c.Request.Context(), deviceType, authCode, requiredPermission)
 		if err != nil {
-			errorResponse(c, http.StatusUnauthorized, fmt.Sprintf("Authentication failed: %v", err))
+			serviceErrorResponse(c, http.StatusUnauthorized, fmt.Errorf("Authentication failed: %w", err))
 			c.Abort()
 			return
 		}
@@ -174,9 +283,131 @@ func authMiddlewareWrite(authService *services.AuthService, requiredPermission s
 	}
 }
 
+// authMiddlewareClientCert authenticates a request by its verified TLS client
+// certificate, as the service identity the certificate maps to
+func authMiddlewareClientCert(authService *services.AuthService, identities *services.ServiceIdentities, requiredPermission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity := identities.Match(clientCertificate(c))
+		if identity == nil {
+			errorResponse(c, http.StatusUnauthorized, "Client certificate is not mapped to a service identity")
+			c.Abort()
+			return
+		}
+
+		user, err := authService.AuthenticateServiceIdentity(c.Request.Context(), identity, requiredPermission)
+		if err != nil {
+			serviceErrorResponse(c, http.StatusUnauthorized, fmt.Errorf("Authentication failed: %w", err))
+			c.Abort()
+			return
+		}
+
+		c.Set("user", user)
+		c.Set("user_id", user.ID)
+		c.Set("service_identity", identity.Name)
+		c.Set("auth_method", "client_certificate")
+
+		// Set IP address and user agent for logging
+		c.Set("client_ip", c.ClientIP())
+		c.Set("user_agent", c.GetHeader("User-Agent"))
+
+		c.Next()
+	}
+}
+
+// clientCertificate returns the request's TLS client certificate once verified
+// against server.tls.client_ca_file, or nil
+func clientCertificate(c *gin.Context) *x509.Certificate {
+	if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 || len(c.Request.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return c.Request.TLS.VerifiedChains[0][0]
+}
+
+// checkResourceNetwork rejects a request from outside the allowed networks of
+// requiredPermission's resource. It writes the error response itself and
+// reports false on rejection.
+func checkResourceNetwork(c *gin.Context, authService *services.AuthService, user *database.User, requiredPermission string) bool {
+	if err := authService.CheckResourceNetwork(c.Request.Context(), user, requiredPermission); err != nil {
+		serviceErrorResponse(c, http.StatusForbidden, err)
+		c.Abort()
+		return false
+	}
+	return true
+}
+
+// authMiddlewareBreakGlassWrite authenticates a write made in a break-glass
+// session, reporting false without responding when the token is not of one so
+// the caller rejects it as any other session
+func authMiddlewareBreakGlassWrite(c *gin.Context, authService *services.AuthService, sessionService *services.SessionService, tokenString, requiredPermission string) bool {
+	claims, err := sessionService.ValidateAccessToken(tokenString)
+	if err != nil {
+		return false
+	}
+	if session, err := sessionService.GetSessionContext(c.Request.Context(), claims.SessionID); err != nil || !session.BreakGlass {
+		return false
+	}
+
+	session, claims, user, ok := authenticateSession(c, authService, sessionService, tokenString)
+	if !ok {
+		c.Abort()
+		return true
+	}
+	if requiredPermission != "" && !authService.UserHasPermission(user, requiredPermission) {
+		errorResponse(c, http.StatusForbidden, fmt.Sprintf("Permission denied: %s", requiredPermission))
+		c.Abort()
+		return true
+	}
+	if !checkResourceNetwork(c, authService, user, requiredPermission) {
+		return true
+	}
+
+	c.Set("session", session)
+	c.Set("user", user)
+	c.Set("user_id", user.ID)
+	c.Set("device_id", claims.DeviceID)
+	c.Set("auth_method", "session")
+	c.Set("break_glass", true)
+	c.Set("client_ip", c.ClientIP())
+	c.Set("user_agent", c.GetHeader("User-Agent"))
+
+	c.Next()
+	logBreakGlassRequest(c, authService)
+	return true
+}
+
+// logBreakGlassRequest writes every request of a break-glass session to the
+// authentication log once handled, for the post-incident review
+func logBreakGlassRequest(c *gin.Context, authService *services.AuthService) {
+	if !c.GetBool("break_glass") {
+		return
+	}
+	session := c.MustGet("session").(*database.Session)
+	err := authService.LogAuthentication(map[string]interface{}{
+		"user_id":    session.UserID,
+		"type":       "break_glass",
+		"success":    c.Writer.Status() < http.StatusBadRequest,
+		"ip_address": c.ClientIP(),
+		"user_agent": c.GetHeader("User-Agent"),
+		"request_id": c.GetString("request_id"),
+		"details": map[string]interface{}{
+			"session_id":    session.ID,
+			"method":        c.Request.Method,
+			"path":          c.Request.URL.Path,
+			"query":         c.Request.URL.RawQuery,
+			"route":         c.FullPath(),
+			"status":        c.Writer.Status(),
+			"request_bytes": c.Request.ContentLength,
+			"response_size": c.Writer.Size(),
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to log break-glass request of session %s: %v", session.ID, err)
+	}
+}
+
 // Legacy authMiddleware for backward compatibility (device-only auth)
 func authMiddleware(authService *services.AuthService, requiredPermission string) gin.HandlerFunc {
-	return authMiddlewareWrite(authService, requiredPermission)
+	return authMiddlewareWrite(authService, nil, requiredPermission)
 }
 
 // adminMiddleware handles admin role validation
@@ -214,4 +445,60 @@ func adminMiddleware() gin.HandlerFunc {
 
 		c.Next()
 	}
-} 
\ No newline at end of file
+} 
+// authenticateSession validates a session access token against its live session
+// and loads the session's user. It writes the error response itself on failure.
+func authenticateSession(c *gin.Context, authService *services.AuthService, sessionService *services.SessionService, tokenString string) (*database.Session, *database.SessionToken, *database.User, bool) {
+	// Validate the access token
+	claims, err := sessionService.ValidateAccessToken(tokenString)
+	if err != nil {
+		writeError(c, http.StatusUnauthorized, services.CodeSessionInvalid, fmt.Sprintf("Invalid access token: %v", err), nil)
+		return nil, nil, nil, false
+	}
+
+	// Get the session from Redis
+	session, err := sessionService.GetSessionContext(c.Request.Context(), claims.SessionID)
+	if err != nil {
+		writeError(c, http.StatusUnauthorized, services.CodeSessionInvalid, fmt.Sprintf("Session not found: %v", err), nil)
+		return nil, nil, nil, false
+	}
+
+	// Check if session is still valid (not invalidated by logout, etc.)
+	if !session.IsValid {
+		writeError(c, http.StatusUnauthorized, services.CodeSessionInvalid, "Session has been invalidated", nil)
+		return nil, nil, nil, false
+	}
+
+	// Verify refresh count matches (prevents use of access tokens from before a refresh)
+	if session.RefreshCount != claims.RefreshCount {
+		writeError(c, http.StatusUnauthorized, services.CodeSessionInvalid, "Access token is invalid (refresh count mismatch)", nil)
+		return nil, nil, nil, false
+	}
+
+	// Reject tokens presented from a different client than the session's
+	if err := sessionService.CheckBinding(session, sessionClient(c)); err != nil {
+		log.Printf("Rejected session %s from %s: %v", session.ID, c.ClientIP(), err)
+		serviceErrorResponse(c, http.StatusUnauthorized, err)
+		return nil, nil, nil, false
+	}
+
+	// Get user from database
+	var user database.User
+	if err := authService.GetDB().WithContext(c.Request.Context()).Preload("Roles.Permissions.Resource").Where("id = ?", claims.UserID).First(&user).Error; err != nil {
+		errorResponse(c, http.StatusUnauthorized, "User not found")
+		return nil, nil, nil, false
+	}
+
+	// Suspended, offboarded and deactivated users lose their sessions at once
+	if err := services.UserCanAuthenticate(&user); err != nil {
+		serviceErrorResponse(c, http.StatusUnauthorized, err)
+		return nil, nil, nil, false
+	}
+
+	// Push back the idle expiry now the session has been used
+	if err := sessionService.TouchSession(session, c.ClientIP()); err != nil {
+		log.Printf("Failed to record use of session %s: %v", session.ID, err)
+	}
+
+	return session, claims, &user, true
+}
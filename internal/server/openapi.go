@@ -0,0 +1,62 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	yubiapp "github.com/YubiApp"
+	"github.com/gin-gonic/gin"
+)
+
+// Routes returns every route the API server registers, for tooling that checks
+// the OpenAPI spec against the router. No services are needed to list them.
+func Routes() gin.RoutesInfo {
+	return setupRouter(routerDeps{}).Routes()
+}
+
+// handleOpenAPISpec handles GET /openapi.json, serving the embedded openapi.yaml
+// as JSON with the schemas generated from response types
+func handleOpenAPISpec() gin.HandlerFunc {
+	spec, err := OpenAPIDocument(yubiapp.OpenAPISpec)
+	var body []byte
+	if err == nil {
+		body, err = json.Marshal(spec)
+	}
+
+	return func(c *gin.Context) {
+		if err != nil {
+			errorResponse(c, http.StatusInternalServerError, "Failed to load OpenAPI spec: "+err.Error())
+			return
+		}
+		c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+	}
+}
+
+// handleSwaggerUI handles GET /docs
+func handleSwaggerUI() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Security-Policy", swaggerUIPolicy)
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUIPage))
+	}
+}
+
+// swaggerUIPolicy lets the docs page load Swagger UI and run its inline setup
+const swaggerUIPolicy = "default-src 'none'; script-src 'unsafe-inline' https://unpkg.com; style-src https://unpkg.com; img-src data: https:; connect-src 'self'; frame-ancestors 'none'"
+
+// swaggerUIPage renders /api/v1/openapi.json with Swagger UI from a CDN
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>YubiApp API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: "/api/v1/openapi.json", dom_id: "#swagger-ui" });
+  </script>
+</body>
+</html>
+`
@@ -2,34 +2,102 @@ package server
 
 import (
 	"fmt"
+	"log"
+	"net/http"
 	"strings"
 
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/jobs"
 	"github.com/YubiApp/internal/services"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
-func setupRouter(
-	authService *services.AuthService,
-	userService *services.UserService,
-	roleService *services.RoleService,
-	resourceService *services.ResourceService,
-	permissionService *services.PermissionService,
-	deviceService *services.DeviceService,
-	actionService *services.ActionService,
-	deviceRegService *services.DeviceRegistrationService,
-	sessionService *services.SessionService,
-	locationService *services.LocationService,
-	userStatusService *services.UserStatusService,
-	userActivityService *services.UserActivityService,
-) *gin.Engine {
-	router := gin.Default()
+// routerDeps are the services and settings the API routes are built from. A
+// zero routerDeps is enough to list the routes.
+type routerDeps struct {
+	authService              *services.AuthService
+	userService              *services.UserService
+	roleService              *services.RoleService
+	resourceService          *services.ResourceService
+	permissionService        *services.PermissionService
+	deviceService            *services.DeviceService
+	actionService            *services.ActionService
+	deviceRegService         *services.DeviceRegistrationService
+	sessionService           *services.SessionService
+	locationService          *services.LocationService
+	userStatusService        *services.UserStatusService
+	userActivityService      *services.UserActivityService
+	reportService            *services.ReportService
+	authLogService           *services.AuthLogService
+	alertService             *services.AlertService
+	legalHoldService         *services.LegalHoldService
+	attendanceService        *services.AttendanceService
+	webhookService           *services.WebhookService
+	doorService              *services.DoorService
+	actionExecutionService   *services.ActionExecutionService
+	machineAuthService       *services.MachineAuthService
+	kioskService             *services.KioskService
+	privacyService           *services.PrivacyService
+	lifecycleService         *services.UserLifecycleService
+	passwordService          *services.PasswordService
+	resetService             *services.PasswordResetService
+	loginNotificationService *services.LoginNotificationService
+	impersonationService     *services.ImpersonationService
+	deviceAnalyticsService   *services.DeviceAnalyticsService
+	otpReplayCache           *services.OTPReplayCache
+	permissionUsageService   *services.PermissionUsageService
+	accessReviewService      *services.AccessReviewService
+	recoveryService          *services.RecoveryService
+	breakGlassService        *services.BreakGlassService
+	pushService              *services.PushService
+	qrLoginService           *services.QRLoginService
+	securityIncidentService  *services.SecurityIncidentService
+	anomalyService           *services.AnomalyService
+	hrNotificationService    *services.HRNotificationService
+	templateService          *services.MessageTemplateService
+	calendarService          *services.CalendarService
+	chatService              *services.ChatIntegrationService
+	schedulerService         *services.ActionSchedulerService
+	searchService            *services.SearchService
+	visitorService           *services.VisitorService
+	shiftService             *services.ShiftService
+	leaveService             *services.LeaveService
+	holidayService           *services.HolidayService
+	jobQueue                 *jobs.Queue
+	healthService            *services.HealthService
+	responseSigner           *services.ResponseSigner
+	translator               *services.Translator
+	authorization            config.AuthorizationConfig
+	tracingConfig            config.TracingConfig
+	serverConfig             config.ServerConfig
+}
+
+func setupRouter(deps routerDeps) *gin.Engine {
+	router := gin.New()
+	// Client IPs feed network allowlists, session binding and audit logs, so
+	// forwarding headers are only believed from configured proxies
+	if err := router.SetTrustedProxies(deps.serverConfig.TrustedProxies); err != nil {
+		log.Printf("Ignoring server.trusted_proxies: %v", err)
+		router.SetTrustedProxies(nil)
+	}
+	if deps.tracingConfig.Enabled {
+		// Before the logger so request logs carry the trace ID
+		router.Use(otelgin.Middleware(deps.tracingConfig.ServiceName))
+	}
+	router.Use(requestIDMiddleware(), requestLogger(), gin.Recovery())
+	if deps.serverConfig.SecurityHeaders.Enabled {
+		router.Use(securityHeadersMiddleware(deps.serverConfig.SecurityHeaders, deps.serverConfig.TrustedProxies))
+	}
+	registerValidationFieldNames()
+	authz := newRouteAuthorizer(deps.authService, deps.sessionService, services.NewServiceIdentities(deps.serverConfig.TLS.ClientIdentities), deps.authorization)
 
 	// Add CORS middleware
 	router.Use(func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
-		c.Header("Access-Control-Expose-Headers", "Content-Length")
+		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-Kiosk-Credentials, X-Client-Fingerprint, X-Request-ID")
+		c.Header("Access-Control-Expose-Headers", "Content-Length, X-Signature, X-Signature-Key-Id, X-Request-ID")
 		c.Header("Access-Control-Allow-Credentials", "true")
 
 		if c.Request.Method == "OPTIONS" {
@@ -40,145 +108,535 @@ func setupRouter(
 		c.Next()
 	})
 
+	// Browser sessions authenticated by cookie must echo the CSRF token
+	if deps.serverConfig.CSRF.Enabled {
+		router.Use(csrfMiddleware(deps.serverConfig.CSRF))
+	}
+
+	// Make the signer available to the response helpers
+	if deps.responseSigner != nil {
+		router.Use(func(c *gin.Context) {
+			c.Set("response_signer", deps.responseSigner)
+			c.Next()
+		})
+	}
+
+	// Make the deps.translator available to the error responses
+	if deps.translator != nil {
+		router.Use(func(c *gin.Context) {
+			c.Set("deps.translator", deps.translator)
+			c.Next()
+		})
+	}
+
+	// Kubernetes probes - unauthenticated, outside the API
+	router.GET("/healthz", handleLiveness())
+	router.GET("/readyz", handleReadiness(deps.healthService))
+
+	// Verification keys for signed responses
+	router.GET("/.well-known/response-signing-keys", handleResponseSigningKeys(deps.responseSigner))
+
 	// API v1 routes
 	api := router.Group("/api/v1")
 	{
+		// API description and browsable docs
+		api.GET("/openapi.json", handleOpenAPISpec())
+		api.GET("/docs", handleSwaggerUI())
+
+		// Server clock, for clients to correct theirs against
+		api.GET("/time", handleServerTime(deps.actionExecutionService))
+
+		// Languages error messages and emails can be written in
+		api.GET("/locales", handleListLocales(deps.translator))
+
 		// Authentication endpoints
-		api.POST("/auth/device", handleDeviceAuth(authService))
-		api.POST("/auth/session", handleCreateSession(authService, sessionService))
-		api.POST("/auth/session/refresh/:session_id", handleRefreshSession(sessionService))
+		api.POST("/auth/device", handleDeviceAuth(deps.authService))
+		api.POST("/auth/session", handleCreateSession(deps.authService, deps.sessionService, deps.loginNotificationService))
+		api.POST("/auth/session/refresh/:session_id", handleRefreshSession(deps.sessionService, deps.authService))
+		api.POST("/auth/session/logout/:session_id", handleLogoutSession(deps.sessionService))
+		api.GET("/auth/session/:id", authz.require("sessions"), handleGetSession(deps.sessionService))
+
+		// Own sessions - users list and end their active sessions, e.g. ones they do not recognise
+		api.GET("/auth/sessions", authz.authenticated(), handleListOwnSessions(deps.sessionService, deps.deviceService))
+		api.DELETE("/auth/sessions/:id", authz.authenticated(), handleRevokeOwnSession(deps.sessionService))
+		api.POST("/auth/password", handlePasswordAuth(deps.authService, deps.passwordService, deps.sessionService, deps.loginNotificationService))
+		api.POST("/auth/password/change", handleChangePassword(deps.authService, deps.passwordService, deps.sessionService))
+		api.POST("/auth/password/reset-request", handlePasswordResetRequest(deps.resetService))
+		api.POST("/auth/password/reset", handlePasswordReset(deps.resetService))
+
+		// Chat integrations - Slack signs slash commands with the workspace signing
+		// secret and Teams outgoing webhooks with their security token, so these
+		// need no other authentication
+		api.GET("/integrations/slack/oauth/callback", handleSlackOAuthCallback(deps.chatService))
+		api.POST("/integrations/slack/commands", handleSlackCommand(deps.chatService))
+		api.POST("/integrations/teams/commands/:workspace_id", handleTeamsCommand(deps.chatService))
+
+		// Recovery codes - a lost device can be stood in for by a password and a
+		// single-use code, giving a read-only session and a security incident
+		api.POST("/auth/recovery", handleRecovery(deps.recoveryService, deps.sessionService))
+		api.POST("/auth/recovery-codes", handleGenerateOwnRecoveryCodes(deps.authService, deps.recoveryService))
+
+		// Break-glass - a sealed emergency credential opens a time-limited admin
+		// session that can write without a device, alerts the other admins and is
+		// locked until an incident review closes
+		api.POST("/auth/break-glass", handleBreakGlass(deps.breakGlassService, deps.sessionService))
+
+		// Push approval - start a challenge, wait for the mobile app's answer, then
+		// authenticate with device_type "push" and the challenge ID as auth_code
+		api.POST("/auth/push", handleStartPushChallenge(deps.pushService))
+		api.GET("/auth/push/:id", handleWaitPushChallenge(deps.pushService))
+		api.POST("/push/challenges/:id/answer", handleAnswerPushChallenge(deps.pushService))
+
+		// QR login - a shared terminal shows a QR code, a signed-in phone approves
+		// it, and the terminal's poll returns a session limited by qr_login
+		api.POST("/auth/qr", handleStartQRLogin(deps.qrLoginService))
+		api.GET("/auth/qr/:id", handlePollQRLogin(deps.qrLoginService, deps.sessionService))
+		api.GET("/auth/qr/:id/details", authz.authenticated(), handleGetQRLogin(deps.qrLoginService))
+		api.POST("/auth/qr/:id/approve", authz.authenticated(), handleDecideQRLogin(deps.qrLoginService, true))
+		api.POST("/auth/qr/:id/reject", authz.authenticated(), handleDecideQRLogin(deps.qrLoginService, false))
+
+		// Admin impersonation - sessions acting as another user, read-only by default
+		api.POST("/auth/impersonate", authz.require("impersonation"), handleStartImpersonation(deps.impersonationService, deps.sessionService))
+		api.GET("/auth/impersonations", authz.require("impersonation"), handleListImpersonations(deps.impersonationService))
+		api.DELETE("/auth/impersonations/:session_id", authz.require("impersonation"), handleEndImpersonation(deps.impersonationService))
+
+		// Machine login validation for PAM/SSH modules - the device code is the credential
+		api.POST("/auth/validate", handleValidateMachineAuth(deps.machineAuthService))
 
 		// Action endpoint - POST /auth/action/${action_name}
-		api.POST("/auth/action/:action_name", handlePerformAction(authService, actionService))
+		api.POST("/auth/action/:action_name", handlePerformAction(deps.authService, deps.sessionService, deps.actionService, deps.locationService, deps.actionExecutionService))
+
+		// Co-signing - a second user approves or rejects a held co-signed action with their own device
+		api.POST("/auth/action-approvals/:id/approve", handleDecideActionApproval(deps.authService, deps.actionService, deps.actionExecutionService, true))
+		api.POST("/auth/action-approvals/:id/reject", handleDecideActionApproval(deps.authService, deps.actionService, deps.actionExecutionService, false))
+
+		// Access reviews - the reviewer keeps or revokes a role assignment with their own device
+		api.POST("/auth/access-reviews/items/:id/approve", handleDecideAccessReview(deps.authService, deps.accessReviewService, authz, true))
+		api.POST("/auth/access-reviews/items/:id/revoke", handleDecideAccessReview(deps.authService, deps.accessReviewService, authz, false))
+
+		// Kiosk badge-in - kiosk client credentials plus the user's OTP, whitelisted actions only
+		api.POST("/kiosk/action", handleKioskAction(deps.kioskService, deps.authService, deps.actionService, deps.locationService, deps.actionExecutionService))
 
 		// User management - GET methods accept both device and session auth, write methods require device auth
 		users := api.Group("/users")
 		{
-			users.GET("", authMiddlewareRead(authService, sessionService, "yubiapp:read"), handleListUsers(userService))
-			users.POST("", authMiddlewareWrite(authService, "yubiapp:write"), handleCreateUser(userService))
-			users.GET("/:id", authMiddlewareRead(authService, sessionService, "yubiapp:read"), handleGetUser(userService))
-			users.PUT("/:id", authMiddlewareWrite(authService, "yubiapp:write"), handleUpdateUser(userService))
-			users.DELETE("/:id", authMiddlewareWrite(authService, "yubiapp:write"), handleDeleteUser(userService))
+			users.GET("", authz.require("users"), handleListUsers(deps.userService))
+			users.POST("", authz.require("users"), handleCreateUser(deps.userService))
+			users.GET("/:id", authz.require("users"), handleGetUser(deps.userService))
+			users.PUT("/:id", authz.require("users"), handleUpdateUser(deps.userService))
+			users.DELETE("/:id", authz.require("users"), handleDeleteUser(deps.userService))
+			users.POST("/:id/restore", authz.require("users"), handleRestoreUser(deps.userService))
+			users.POST("/:id/unlock", authz.require("users"), handleUnlockUser(deps.passwordService))
+			users.POST("/:id/export", authz.require("privacy"), handleExportUserData(deps.privacyService))
+			users.POST("/:id/erase", authz.require("privacy"), handleEraseUserData(deps.privacyService))
+			users.GET("/states", authz.require("users"), handleListUserStates())
+			users.GET("/attributes", authz.require("users"), handleListUserAttributes(deps.userService))
+			users.GET("/:id/reports", authz.require("users"), handleListUserReports(deps.userService))
+			users.GET("/:id/managers-chain", authz.require("users"), handleGetManagersChain(deps.userService))
+			users.POST("/:id/state", authz.require("users"), handleTransitionUserState(deps.lifecycleService))
+			users.GET("/:id/state-transitions", authz.require("users"), handleListUserStateTransitions(deps.lifecycleService))
+			users.GET("/:id/devices", authz.require("devices"), handleListUserDevices(deps.deviceService, deps.deviceRegService))
+			users.GET("/:id/recovery-codes", authz.require("recovery-codes"), handleGetRecoveryCodes(deps.recoveryService))
+			users.POST("/:id/recovery-codes", authz.require("recovery-codes"), handleGenerateRecoveryCodes(deps.recoveryService))
+			users.GET("/:id/hr-notification-opt-outs", authz.require("hr-notifications"), handleListHRNotificationOptOuts(deps.hrNotificationService))
+			users.PUT("/:id/hr-notification-opt-outs/:rule_id", authz.require("hr-notifications"), handleHRNotificationOptOut(deps.hrNotificationService))
+			users.DELETE("/:id/hr-notification-opt-outs/:rule_id", authz.require("hr-notifications"), handleHRNotificationOptIn(deps.hrNotificationService))
+			users.GET("/:id/activity.ics", calendarFeedAuth(deps.calendarService, services.CalendarFeedUser, authz.requireOrManager("user-activity", "id")), handleUserCalendar(deps.calendarService))
+			users.POST("/:id/calendar-feed", authz.require("user-activity"), handleCreateUserCalendarFeed(deps.calendarService))
+			users.POST("/:id/state-transitions/:transition_id/cancel", authz.require("users"), handleCancelUserStateTransition(deps.lifecycleService))
+			users.GET("/:id/leave-balance", authz.requireOrSelfOrManager("leave", "id"), handleGetLeaveBalance(deps.leaveService))
+			users.GET("/:id/leave-entries", authz.requireOrSelfOrManager("leave", "id"), handleListLeaveEntries(deps.leaveService))
+			users.POST("/:id/leave-adjustments", authz.require("leave"), handleAdjustLeaveBalance(deps.leaveService))
 		}
 
 		// User-role assignments (separate group to avoid conflicts) - write operations only
 		userRoles := api.Group("/user-roles")
-		userRoles.Use(authMiddlewareWrite(authService, "yubiapp:write"))
+		userRoles.Use(authz.require("user-roles"))
 		{
-			userRoles.POST("/:user_id/:role_id", handleAssignUserToRole(userService))
-			userRoles.DELETE("/:user_id/:role_id", handleRemoveUserFromRole(userService))
+			userRoles.POST("/:user_id/:role_id", handleAssignUserToRole(deps.userService))
+			userRoles.DELETE("/:user_id/:role_id", handleRemoveUserFromRole(deps.userService))
 		}
 
 		// Role management - GET methods accept both device and session auth, write methods require device auth
 		roles := api.Group("/roles")
 		{
-			roles.GET("", authMiddlewareRead(authService, sessionService, "yubiapp:read"), handleListRoles(roleService))
-			roles.POST("", authMiddlewareWrite(authService, "yubiapp:write"), handleCreateRole(roleService))
-			roles.GET("/:id", authMiddlewareRead(authService, sessionService, "yubiapp:read"), handleGetRole(roleService))
-			roles.PUT("/:id", authMiddlewareWrite(authService, "yubiapp:write"), handleUpdateRole(roleService))
-			roles.DELETE("/:id", authMiddlewareWrite(authService, "yubiapp:write"), handleDeleteRole(roleService))
+			roles.GET("", authz.require("roles"), handleListRoles(deps.roleService))
+			roles.POST("", authz.require("roles"), handleCreateRole(deps.roleService))
+			roles.GET("/:id", authz.require("roles"), handleGetRole(deps.roleService))
+			roles.PUT("/:id", authz.require("roles"), handleUpdateRole(deps.roleService))
+			roles.DELETE("/:id", authz.require("roles"), handleDeleteRole(deps.roleService))
+			roles.GET("/:id/activity.ics", calendarFeedAuth(deps.calendarService, services.CalendarFeedRole, authz.require("user-activity")), handleRoleCalendar(deps.calendarService))
+			roles.POST("/:id/calendar-feed", authz.require("user-activity"), handleCreateRoleCalendarFeed(deps.calendarService))
 		}
 
 		// Role-permission assignments (separate group to avoid conflicts) - write operations only
 		rolePermissions := api.Group("/role-permissions")
-		rolePermissions.Use(authMiddlewareWrite(authService, "yubiapp:write"))
+		rolePermissions.Use(authz.require("role-permissions"))
 		{
-			rolePermissions.POST("/:role_id/:permission_id", handleAssignPermissionToRole(roleService))
-			rolePermissions.DELETE("/:role_id/:permission_id", handleRemovePermissionFromRole(roleService))
+			rolePermissions.POST("/:role_id/:permission_id", handleAssignPermissionToRole(deps.roleService))
+			rolePermissions.DELETE("/:role_id/:permission_id", handleRemovePermissionFromRole(deps.roleService))
 		}
 
 		// Resource management - GET methods accept both device and session auth, write methods require device auth
 		resources := api.Group("/resources")
 		{
-			resources.GET("", authMiddlewareRead(authService, sessionService, "yubiapp:read"), handleListResources(resourceService))
-			resources.POST("", authMiddlewareWrite(authService, "yubiapp:write"), handleCreateResource(resourceService))
-			resources.GET("/:id", authMiddlewareRead(authService, sessionService, "yubiapp:read"), handleGetResource(resourceService))
-			resources.PUT("/:id", authMiddlewareWrite(authService, "yubiapp:write"), handleUpdateResource(resourceService))
-			resources.DELETE("/:id", authMiddlewareWrite(authService, "yubiapp:write"), handleDeleteResource(resourceService))
+			resources.GET("", authz.require("resources"), handleListResources(deps.resourceService))
+			resources.POST("", authz.require("resources"), handleCreateResource(deps.resourceService))
+			resources.GET("/:id", authz.require("resources"), handleGetResource(deps.resourceService))
+			resources.PUT("/:id", authz.require("resources"), handleUpdateResource(deps.resourceService))
+			resources.DELETE("/:id", authz.require("resources"), handleDeleteResource(deps.resourceService))
 		}
 
 		// Permission management - GET methods accept both device and session auth, write methods require device auth
 		permissions := api.Group("/permissions")
 		{
-			permissions.GET("", authMiddlewareRead(authService, sessionService, "yubiapp:read"), handleListPermissions(permissionService))
-			permissions.POST("", authMiddlewareWrite(authService, "yubiapp:write"), handleCreatePermission(permissionService))
-			permissions.GET("/:id", authMiddlewareRead(authService, sessionService, "yubiapp:read"), handleGetPermission(permissionService))
-			permissions.DELETE("/:id", authMiddlewareWrite(authService, "yubiapp:write"), handleDeletePermission(permissionService))
+			permissions.GET("", authz.require("permissions"), handleListPermissions(deps.permissionService))
+			permissions.POST("", authz.require("permissions"), handleCreatePermission(deps.permissionService))
+			permissions.GET("/usage", authz.require("permissions"), handlePermissionUsage(deps.permissionUsageService))
+			permissions.GET("/:id", authz.require("permissions"), handleGetPermission(deps.permissionService))
+			permissions.DELETE("/:id", authz.require("permissions"), handleDeletePermission(deps.permissionService))
 		}
 
 		// Device management - GET methods accept both device and session auth, write methods require device auth
 		devices := api.Group("/devices")
 		{
-			devices.GET("", authMiddlewareRead(authService, sessionService, "yubiapp:read"), handleListDevices(deviceService))
-			devices.POST("", authMiddlewareWrite(authService, "yubiapp:write"), handleCreateDevice(deviceService))
+			devices.GET("", authz.require("devices"), handleListDevices(deps.deviceService))
+			devices.POST("", authz.require("devices"), handleCreateDevice(deps.deviceService))
+			devices.POST("/import", authz.require("devices"), handleImportDevices(deps.deviceService))
+			devices.GET("/analytics", authz.require("devices"), handleDeviceAnalytics(deps.deviceAnalyticsService))
+			devices.GET("/otp-replays", authz.require("devices"), handleOTPReplayCounts(deps.otpReplayCache))
 
 			// Device registration endpoints (action first, then ID) - write operations only
-			devices.POST("/register", handleRegisterDevice(authService, deviceRegService))
-			devices.POST("/deregister/:device_id", handleDeregisterDevice(authService, deviceRegService))
-			devices.POST("/transfer/:device_id", handleTransferDevice(authService, deviceRegService))
-			devices.GET("/history/:device_id", authMiddlewareRead(authService, sessionService, "yubiapp:read"), handleGetDeviceHistory(authService, deviceRegService))
+			devices.POST("/register", handleRegisterDevice(deps.authService, deps.deviceRegService))
+			devices.POST("/deregister/:device_id", handleDeregisterDevice(deps.authService, deps.deviceRegService))
+			devices.POST("/transfer/:device_id", handleTransferDevice(deps.authService, deps.deviceRegService))
+			devices.GET("/history/:device_id", authz.require("devices"), handleGetDeviceHistory(deps.authService, deps.deviceRegService))
 
 			// Generic :id routes
-			devices.GET("/:id", authMiddlewareRead(authService, sessionService, "yubiapp:read"), handleGetDevice(deviceService))
-			devices.PUT("/:id", authMiddlewareWrite(authService, "yubiapp:write"), handleUpdateDevice(deviceService))
-			devices.DELETE("/:id", authMiddlewareWrite(authService, "yubiapp:write"), handleDeleteDevice(deviceService))
+			devices.GET("/:id", authz.require("devices"), handleGetDevice(deps.deviceService))
+			devices.PUT("/:id", authz.require("devices"), handleUpdateDevice(deps.deviceService))
+			devices.DELETE("/:id", authz.require("devices"), handleDeleteDevice(deps.deviceService))
+			devices.POST("/:id/restore", authz.require("devices"), handleRestoreDevice(deps.deviceService))
+			devices.POST("/:id/state", authz.require("devices"), handleTransitionDeviceState(deps.deviceService))
 		}
 
 		// Action management - GET methods accept both device and session auth, write methods require device auth
 		actions := api.Group("/actions")
 		{
-			actions.GET("", authMiddlewareRead(authService, sessionService, "yubiapp:read"), handleListActions(actionService))
-			actions.POST("", authMiddlewareWrite(authService, "yubiapp:write"), handleCreateAction(actionService))
-			actions.GET("/:id", authMiddlewareRead(authService, sessionService, "yubiapp:read"), handleGetAction(actionService))
-			actions.PUT("/:id", authMiddlewareWrite(authService, "yubiapp:write"), handleUpdateAction(actionService))
-			actions.DELETE("/:id", authMiddlewareWrite(authService, "yubiapp:write"), handleDeleteAction(actionService))
+			actions.GET("", authz.require("actions"), handleListActions(deps.actionService))
+			actions.POST("", authz.require("actions"), handleCreateAction(deps.actionService))
+			actions.GET("/side-effect-handlers", authz.require("actions"), handleListSideEffectHandlers(deps.actionService))
+			actions.GET("/system-tasks", authz.require("actions"), handleListSystemTasks(deps.actionService))
+			actions.GET("/scheduled", authz.require("actions"), handleListScheduledActions(deps.schedulerService))
+			actions.GET("/:id", authz.require("actions"), handleGetAction(deps.actionService))
+			actions.PUT("/:id", authz.require("actions"), handleUpdateAction(deps.actionService))
+			actions.DELETE("/:id", authz.require("actions"), handleDeleteAction(deps.actionService))
+			actions.GET("/:id/runs", authz.require("actions"), handleListActionRuns(deps.schedulerService))
+			actions.POST("/:id/run", authz.require("actions"), handleTriggerActionRun(deps.schedulerService))
+		}
+
+		// Action runs - history of scheduled and manual runs of automated actions
+		actionRuns := api.Group("/action-runs")
+		{
+			actionRuns.GET("", authz.require("actions"), handleListActionRuns(deps.schedulerService))
 		}
 
 		// Location management - GET methods accept both device and session auth, write methods require device auth
 		locations := api.Group("/locations")
 		{
-			locations.GET("", authMiddlewareRead(authService, sessionService, "yubiapp:read"), handleListLocations(locationService))
-			locations.POST("", authMiddlewareWrite(authService, "yubiapp:write"), handleCreateLocation(locationService))
-			locations.GET("/:id", authMiddlewareRead(authService, sessionService, "yubiapp:read"), handleGetLocation(locationService))
-			locations.PUT("/:id", authMiddlewareWrite(authService, "yubiapp:write"), handleUpdateLocation(locationService))
-			locations.DELETE("/:id", authMiddlewareWrite(authService, "yubiapp:write"), handleDeleteLocation(locationService))
+			locations.GET("", authz.require("locations"), handleListLocations(deps.locationService))
+			locations.POST("", authz.require("locations"), handleCreateLocation(deps.locationService))
+			locations.GET("/:id", authz.require("locations"), handleGetLocation(deps.locationService))
+			locations.PUT("/:id", authz.require("locations"), handleUpdateLocation(deps.locationService))
+			locations.DELETE("/:id", authz.require("locations"), handleDeleteLocation(deps.locationService))
+			locations.GET("/:id/occupancy", authz.require("locations"), handleGetLocationOccupancy(deps.locationService))
+			locations.GET("/:id/holidays", authz.require("locations"), handleListLocationHolidays(deps.holidayService))
+		}
+
+		// Shifts - planned working time, compared with sign-ins by /reports/shifts
+		shifts := api.Group("/shifts")
+		{
+			shifts.GET("", authz.require("shifts"), handleListShifts(deps.shiftService))
+			shifts.POST("", authz.require("shifts"), handleCreateShift(deps.shiftService))
+			shifts.GET("/:id", authz.require("shifts"), handleGetShift(deps.shiftService))
+			shifts.PUT("/:id", authz.require("shifts"), handleUpdateShift(deps.shiftService))
+			shifts.DELETE("/:id", authz.require("shifts"), handleDeleteShift(deps.shiftService))
+		}
+
+		// Holidays - public holidays of countries and locations, on which attendance expects no hours
+		holidays := api.Group("/holidays")
+		{
+			holidays.GET("", authz.require("holidays"), handleListHolidays(deps.holidayService))
+			holidays.POST("", authz.require("holidays"), handleCreateHoliday(deps.holidayService))
+			holidays.POST("/import", authz.require("holidays"), handleImportHolidays(deps.holidayService))
+			holidays.GET("/:id", authz.require("holidays"), handleGetHoliday(deps.holidayService))
+			holidays.PUT("/:id", authz.require("holidays"), handleUpdateHoliday(deps.holidayService))
+			holidays.DELETE("/:id", authz.require("holidays"), handleDeleteHoliday(deps.holidayService))
+		}
+
+		// Visitors - expected guests, checked in and out by reception with their device
+		visitors := api.Group("/visitors")
+		{
+			visitors.GET("", authz.require("visitors"), handleListVisitors(deps.visitorService))
+			visitors.POST("", authz.require("visitors"), handleCreateVisitor(deps.visitorService))
+			visitors.GET("/:id", authz.require("visitors"), handleGetVisitor(deps.visitorService))
+			visitors.PUT("/:id", authz.require("visitors"), handleUpdateVisitor(deps.visitorService))
+			visitors.DELETE("/:id", authz.require("visitors"), handleDeleteVisitor(deps.visitorService))
+			visitors.POST("/:id/check-in", authz.require("visitors"), handleCheckInVisitor(deps.visitorService))
+			visitors.POST("/:id/check-out", authz.require("visitors"), handleCheckOutVisitor(deps.visitorService))
 		}
 
 		// User status management - GET methods accept both device and session auth, write methods require device auth
 		userStatuses := api.Group("/user-statuses")
 		{
-			userStatuses.GET("", authMiddlewareRead(authService, sessionService, "yubiapp:read"), handleListUserStatuses(userStatusService))
-			userStatuses.POST("", authMiddlewareWrite(authService, "yubiapp:write"), handleCreateUserStatus(userStatusService))
-			userStatuses.GET("/:id", authMiddlewareRead(authService, sessionService, "yubiapp:read"), handleGetUserStatus(userStatusService))
-			userStatuses.PUT("/:id", authMiddlewareWrite(authService, "yubiapp:write"), handleUpdateUserStatus(userStatusService))
-			userStatuses.DELETE("/:id", authMiddlewareWrite(authService, "yubiapp:write"), handleDeleteUserStatus(userStatusService))
+			userStatuses.GET("", authz.require("user-statuses"), handleListUserStatuses(deps.userStatusService))
+			userStatuses.POST("", authz.require("user-statuses"), handleCreateUserStatus(deps.userStatusService))
+			userStatuses.GET("/:id", authz.require("user-statuses"), handleGetUserStatus(deps.userStatusService))
+			userStatuses.PUT("/:id", authz.require("user-statuses"), handleUpdateUserStatus(deps.userStatusService))
+			userStatuses.DELETE("/:id", authz.require("user-statuses"), handleDeleteUserStatus(deps.userStatusService))
 		}
 
 		// User activity history - read-only operations, accept both device and session auth
 		userActivity := api.Group("/user-activity")
 		{
-			userActivity.GET("", authMiddlewareRead(authService, sessionService, "yubiapp:read"), handleGetUserActivity(userActivityService))
-			userActivity.GET("/summary", authMiddlewareRead(authService, sessionService, "yubiapp:read"), handleGetUserActivitySummary(userActivityService))
-			userActivity.GET("/:user_id", authMiddlewareRead(authService, sessionService, "yubiapp:read"), handleGetUserActivityByUser(userActivityService))
-			userActivity.GET("/activity/:id", authMiddlewareRead(authService, sessionService, "yubiapp:read"), handleGetActivityByID(userActivityService))
+			userActivity.GET("", authz.require("user-activity"), handleGetUserActivity(deps.userActivityService))
+			userActivity.GET("/summary", authz.require("user-activity"), handleGetUserActivitySummary(deps.userActivityService))
+			userActivity.GET("/rollups", authz.require("user-activity"), handleListActivityRollups(deps.userActivityService))
+			userActivity.GET("/:user_id", authz.requireOrManager("user-activity", "user_id"), handleGetUserActivityByUser(deps.userActivityService))
+			userActivity.GET("/activity/:id", authz.require("user-activity"), handleGetActivityByID(deps.userActivityService))
+			userActivity.POST("/repair-open", authz.require("user-activity"), handleRepairOpenActivities(deps.userActivityService))
+		}
+
+		// Reports - accept both device and session auth
+		reports := api.Group("/reports")
+		{
+			reports.GET("/timesheet", authz.require("reports"), handleGetTimesheet(deps.reportService))
+			reports.GET("/jobs/:id", authz.require("reports"), handleGetReportJob(deps.reportService))
+			reports.GET("/jobs/:id/download", authz.require("reports"), handleDownloadReportJob(deps.reportService))
+			reports.GET("/attendance", authz.require("reports"), handleGetAttendanceReport(deps.attendanceService))
+			reports.GET("/occupancy", authz.require("reports"), handleGetOccupancyReport(deps.locationService))
+			reports.GET("/visitors", authz.require("reports"), handleGetVisitorLog(deps.visitorService))
+			reports.GET("/shifts", authz.require("reports"), handleGetShiftReport(deps.shiftService))
+			reports.POST("", authz.require("reports"), handleCreateCustomReport(deps.reportService))
+			reports.GET("", authz.require("reports"), handleListReportJobs(deps.reportService))
+			reports.GET("/definitions", authz.require("reports"), handleListReportDefinitions(deps.reportService))
+			reports.POST("/definitions", authz.require("reports"), handleCreateReportDefinition(deps.reportService))
+			reports.GET("/definitions/:id", authz.require("reports"), handleGetReportDefinition(deps.reportService))
+			reports.PUT("/definitions/:id", authz.require("reports"), handleUpdateReportDefinition(deps.reportService))
+			reports.DELETE("/definitions/:id", authz.require("reports"), handleDeleteReportDefinition(deps.reportService))
+			reports.POST("/definitions/:id/run", authz.require("reports"), handleRunReportDefinition(deps.reportService))
+		}
+
+		// Authentication logs - read-only operations, accept both device and session auth
+		authLogs := api.Group("/auth-logs")
+		{
+			authLogs.GET("", authz.require("auth-logs"), handleListAuthLogs(deps.authLogService))
+			authLogs.GET("/summary", authz.require("auth-logs"), handleAuthLogSummary(deps.authLogService))
+			authLogs.GET("/degraded", authz.require("auth-logs"), handleDegradedModeReport(deps.authLogService))
+		}
+
+		// Failed-authentication alerting - GET methods accept both device and session auth, write methods require device auth
+		alertChannels := api.Group("/alert-channels")
+		{
+			alertChannels.GET("", authz.require("alert-channels"), handleListAlertChannels(deps.alertService))
+			alertChannels.POST("", authz.require("alert-channels"), handleCreateAlertChannel(deps.alertService))
+			alertChannels.GET("/:id", authz.require("alert-channels"), handleGetAlertChannel(deps.alertService))
+			alertChannels.PUT("/:id", authz.require("alert-channels"), handleUpdateAlertChannel(deps.alertService))
+			alertChannels.DELETE("/:id", authz.require("alert-channels"), handleDeleteAlertChannel(deps.alertService))
+		}
+		alertRules := api.Group("/alert-rules")
+		{
+			alertRules.GET("", authz.require("alert-rules"), handleListAlertRules(deps.alertService))
+			alertRules.POST("", authz.require("alert-rules"), handleCreateAlertRule(deps.alertService))
+			alertRules.GET("/:id", authz.require("alert-rules"), handleGetAlertRule(deps.alertService))
+			alertRules.PUT("/:id", authz.require("alert-rules"), handleUpdateAlertRule(deps.alertService))
+			alertRules.DELETE("/:id", authz.require("alert-rules"), handleDeleteAlertRule(deps.alertService))
+		}
+		alerts := api.Group("/alerts")
+		{
+			alerts.GET("", authz.require("alerts"), handleListAlerts(deps.alertService))
+			alerts.GET("/:id", authz.require("alerts"), handleGetAlert(deps.alertService))
+			alerts.POST("/:id/acknowledge", authz.require("alerts"), handleAcknowledgeAlert(deps.alertService))
+			alerts.POST("/:id/resolve", authz.require("alerts"), handleResolveAlert(deps.alertService))
+		}
+
+		// Security incidents - opened by recovery sign-ins, resolved by an admin
+		securityIncidents := api.Group("/security-incidents")
+		{
+			securityIncidents.GET("", authz.require("security-incidents"), handleListSecurityIncidents(deps.securityIncidentService))
+			securityIncidents.GET("/:id", authz.require("security-incidents"), handleGetSecurityIncident(deps.securityIncidentService))
+			securityIncidents.POST("/:id/resolve", authz.require("security-incidents"), handleResolveSecurityIncident(deps.securityIncidentService))
+		}
+
+		// Break-glass credentials - sealed for pre-provisioned admin accounts; secrets are shown once
+		breakGlass := api.Group("/break-glass")
+		{
+			breakGlass.GET("", authz.require("break-glass"), handleListBreakGlass(deps.breakGlassService))
+			breakGlass.POST("", authz.require("break-glass"), handleCreateBreakGlass(deps.breakGlassService))
+			breakGlass.GET("/:id", authz.require("break-glass"), handleGetBreakGlass(deps.breakGlassService))
+			breakGlass.DELETE("/:id", authz.require("break-glass"), handleDeleteBreakGlass(deps.breakGlassService))
+			breakGlass.POST("/:id/reseal", authz.require("break-glass"), handleResealBreakGlass(deps.breakGlassService))
+		}
+
+		// Anomalies - unusual sign-ins and activity flagged by the analyzer, for security review
+		anomalies := api.Group("/anomalies")
+		{
+			anomalies.GET("", authz.require("anomalies"), handleListAnomalies(deps.anomalyService))
+			anomalies.GET("/:id", authz.require("anomalies"), handleGetAnomaly(deps.anomalyService))
+			anomalies.POST("/:id/acknowledge", authz.require("anomalies"), handleAcknowledgeAnomaly(deps.anomalyService))
+			anomalies.POST("/:id/resolve", authz.require("anomalies"), handleResolveAnomaly(deps.anomalyService))
+		}
+
+		// HR notifications - actions and user statuses mapped to emails or webhooks, with a delivery log
+		hrNotificationRules := api.Group("/hr-notification-rules")
+		{
+			hrNotificationRules.GET("", authz.require("hr-notifications"), handleListHRNotificationRules(deps.hrNotificationService))
+			hrNotificationRules.POST("", authz.require("hr-notifications"), handleCreateHRNotificationRule(deps.hrNotificationService))
+			hrNotificationRules.GET("/:id", authz.require("hr-notifications"), handleGetHRNotificationRule(deps.hrNotificationService))
+			hrNotificationRules.PUT("/:id", authz.require("hr-notifications"), handleUpdateHRNotificationRule(deps.hrNotificationService))
+			hrNotificationRules.DELETE("/:id", authz.require("hr-notifications"), handleDeleteHRNotificationRule(deps.hrNotificationService))
+		}
+		hrNotifications := api.Group("/hr-notifications")
+		{
+			hrNotifications.GET("", authz.require("hr-notifications"), handleListHRNotifications(deps.hrNotificationService))
+			hrNotifications.GET("/:id", authz.require("hr-notifications"), handleGetHRNotification(deps.hrNotificationService))
+			hrNotifications.POST("/:id/retry", authz.require("hr-notifications"), handleRetryHRNotification(deps.hrNotificationService))
+		}
+
+		// Message templates - email and notification messages edited over the built-in catalogs, with their versions
+		templates := api.Group("/templates")
+		{
+			templates.GET("", authz.require("templates"), handleListTemplates(deps.templateService))
+			templates.GET("/:key", authz.require("templates"), handleGetTemplate(deps.templateService))
+			templates.POST("/:key/preview", authz.require("templates"), handlePreviewTemplate(deps.templateService))
+			templates.PUT("/:key/:locale", authz.require("templates"), handleSaveTemplate(deps.templateService))
+			templates.DELETE("/:key/:locale", authz.require("templates"), handleDeleteTemplate(deps.templateService))
+			templates.GET("/:key/:locale/versions", authz.require("templates"), handleListTemplateVersions(deps.templateService))
+			templates.POST("/:key/:locale/restore", authz.require("templates"), handleRestoreTemplateVersion(deps.templateService))
+		}
+
+		// Chat workspaces - Slack workspaces and Teams tenants whose statuses actions update
+		chatWorkspaces := api.Group("/chat-workspaces")
+		{
+			chatWorkspaces.GET("", authz.require("chat-integrations"), handleListChatWorkspaces(deps.chatService))
+			chatWorkspaces.POST("", authz.require("chat-integrations"), handleCreateChatWorkspace(deps.chatService))
+			chatWorkspaces.GET("/:id", authz.require("chat-integrations"), handleGetChatWorkspace(deps.chatService))
+			chatWorkspaces.PUT("/:id", authz.require("chat-integrations"), handleUpdateChatWorkspace(deps.chatService))
+			chatWorkspaces.DELETE("/:id", authz.require("chat-integrations"), handleDeleteChatWorkspace(deps.chatService))
+			chatWorkspaces.GET("/:id/users", authz.require("chat-integrations"), handleListChatUserLinks(deps.chatService))
+			chatWorkspaces.PUT("/:id/users/:user_id", authz.require("chat-integrations"), handleLinkChatUser(deps.chatService))
+			chatWorkspaces.DELETE("/:id/users/:user_id", authz.require("chat-integrations"), handleUnlinkChatUser(deps.chatService))
+			chatWorkspaces.GET("/:id/slack/authorize", authz.require("chat-integrations"), handleSlackAuthorizeURL(deps.chatService))
+		}
+
+		// Action approvals - co-signed actions held for, or decided by, a second user
+		actionApprovals := api.Group("/action-approvals")
+		{
+			actionApprovals.GET("", authz.require("action-approvals"), handleListActionApprovals(deps.actionService))
+			actionApprovals.GET("/:id", authz.require("action-approvals"), handleGetActionApproval(deps.actionService))
+		}
+
+		// Access reviews - periodic certification of role assignments by managers or role owners.
+		// Reviewers may list their own items without the group's permission.
+		accessReviews := api.Group("/access-reviews")
+		{
+			accessReviews.GET("", authz.require("access-reviews"), handleListAccessReviews(deps.accessReviewService))
+			accessReviews.POST("", authz.require("access-reviews"), handleCreateAccessReview(deps.accessReviewService))
+			accessReviews.GET("/items", authz.requireOr("access-reviews", ownAccessReviewItems), handleListAccessReviewItems(deps.accessReviewService))
+			accessReviews.GET("/:id", authz.require("access-reviews"), handleGetAccessReview(deps.accessReviewService))
+			accessReviews.GET("/:id/report", authz.require("access-reviews"), handleAccessReviewReport(deps.accessReviewService))
+		}
+
+		// Attendance policy management - GET methods accept both device and session auth, write methods require device auth
+		attendancePolicies := api.Group("/attendance-policies")
+		{
+			attendancePolicies.GET("", authz.require("attendance-policies"), handleListAttendancePolicies(deps.attendanceService))
+			attendancePolicies.POST("", authz.require("attendance-policies"), handleCreateAttendancePolicy(deps.attendanceService))
+			attendancePolicies.GET("/:id", authz.require("attendance-policies"), handleGetAttendancePolicy(deps.attendanceService))
+			attendancePolicies.PUT("/:id", authz.require("attendance-policies"), handleUpdateAttendancePolicy(deps.attendanceService))
+			attendancePolicies.DELETE("/:id", authz.require("attendance-policies"), handleDeleteAttendancePolicy(deps.attendanceService))
+		}
+
+		// Webhook management - GET methods accept both device and session auth, write methods require device auth
+		webhooks := api.Group("/webhooks")
+		{
+			webhooks.GET("", authz.require("webhooks"), handleListWebhooks(deps.webhookService))
+			webhooks.POST("", authz.require("webhooks"), handleCreateWebhook(deps.webhookService))
+			webhooks.GET("/event-types", authz.require("webhooks"), handleListWebhookEventTypes())
+			webhooks.GET("/:id", authz.require("webhooks"), handleGetWebhook(deps.webhookService))
+			webhooks.PUT("/:id", authz.require("webhooks"), handleUpdateWebhook(deps.webhookService))
+			webhooks.DELETE("/:id", authz.require("webhooks"), handleDeleteWebhook(deps.webhookService))
+		}
+
+		// Background job queue - depths, counters and the dead-letter list
+		queuedJobs := api.Group("/jobs")
+		{
+			queuedJobs.GET("/stats", authz.require("jobs"), handleGetJobStats(deps.jobQueue))
+			queuedJobs.GET("/dead", authz.require("jobs"), handleListDeadJobs(deps.jobQueue))
+			queuedJobs.POST("/dead/:id/retry", authz.require("jobs"), handleRetryDeadJob(deps.jobQueue))
+			queuedJobs.DELETE("/dead/:id", authz.require("jobs"), handleDeleteDeadJob(deps.jobQueue))
+		}
+
+		// Global search - results are limited to the types the caller can read
+		api.GET("/search", authz.require("search"), handleSearch(deps.searchService, authz))
+
+		// GDPR audit trail - exports and erasures, gated by the dedicated privacy permission
+		api.GET("/privacy-requests", authz.require("privacy"), handleListPrivacyRequests(deps.privacyService))
+		api.GET("/password-resets", authz.require("password-resets"), handleListPasswordResetLogs(deps.resetService))
+
+		// Login notification log - security emails for sign-ins from new devices and IPs; users may list their own
+		api.GET("/login-notifications", authz.requireOr("login-notifications", ownLoginNotifications), handleListLoginNotifications(deps.loginNotificationService))
+
+		// Kiosk management
+		kiosks := api.Group("/kiosks")
+		{
+			kiosks.GET("", authz.require("kiosks"), handleListKiosks(deps.kioskService))
+			kiosks.POST("", authz.require("kiosks"), handleCreateKiosk(deps.kioskService))
+			kiosks.GET("/:id", authz.require("kiosks"), handleGetKiosk(deps.kioskService))
+			kiosks.PUT("/:id", authz.require("kiosks"), handleUpdateKiosk(deps.kioskService))
+			kiosks.DELETE("/:id", authz.require("kiosks"), handleDeleteKiosk(deps.kioskService))
+			kiosks.POST("/:id/rotate-secret", authz.require("kiosks"), handleRotateKioskSecret(deps.kioskService))
+		}
+
+		// Doors (door resources and their access log) - read only; doors are unlocked by performing door actions
+		doors := api.Group("/doors")
+		{
+			doors.GET("", authz.require("doors"), handleListDoors(deps.doorService))
+			doors.GET("/events", authz.require("doors"), handleListDoorEvents(deps.doorService))
+			doors.GET("/:id/events", authz.require("doors"), handleListDoorEvents(deps.doorService))
+		}
+
+		// Legal holds - GET methods accept both device and session auth, write methods require device auth
+		legalHolds := api.Group("/legal-holds")
+		{
+			legalHolds.GET("", authz.require("legal-holds"), handleListLegalHolds(deps.legalHoldService))
+			legalHolds.POST("", authz.require("legal-holds"), handleCreateLegalHold(deps.legalHoldService))
+			legalHolds.GET("/:id", authz.require("legal-holds"), handleGetLegalHold(deps.legalHoldService))
+			legalHolds.POST("/:id/release", authz.require("legal-holds"), handleReleaseLegalHold(deps.legalHoldService))
+			legalHolds.GET("/:id/export", authz.require("legal-holds"), handleExportLegalHold(deps.legalHoldService))
 		}
 	}
 
+	authz.warnUnusedGroups()
+
 	return router
 }
 
+// deviceAuthRequest is the body of POST /auth/device and POST /auth/session
+type deviceAuthRequest struct {
+	DeviceType string `json:"device_type" binding:"required" enum:"yubikey,totp,sms,email,push"`
+	AuthCode   string `json:"auth_code" binding:"required" doc:"The OTP; <identifier>:<code> for totp; the approved challenge ID for push"`
+	Permission string `json:"permission" doc:"Optional permission to check, as resource:action (e.g. yubiapp:read) or a permission UUID"`
+	Nonce      string `json:"nonce" doc:"Optional nonce for response signing"`
+}
+
 // handleDeviceAuth handles device-based authentication
 func handleDeviceAuth(authService *services.AuthService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var req struct {
-			DeviceType string `json:"device_type" binding:"required"`
-			AuthCode   string `json:"auth_code" binding:"required"`
-			Permission string `json:"permission"` // Optional permission to check
-			Nonce      string `json:"nonce"`      // Optional nonce for response signing
-		}
+		var req deviceAuthRequest
 
 		if err := c.ShouldBindJSON(&req); err != nil {
-			errorResponse(c, 400, err.Error())
+			bindErrorResponse(c, err)
 			return
 		}
 
@@ -202,42 +660,27 @@ func handleDeviceAuth(authService *services.AuthService) gin.HandlerFunc {
 		// Store nonce in context for response functions to use
 		setRequestNonce(c, req.Nonce)
 
-		user, device, err := authService.AuthenticateDevice(req.DeviceType, req.AuthCode, req.Permission)
+		user, device, err := authService.AuthenticateDeviceContext(c.Request.Context(), req.DeviceType, req.AuthCode, req.Permission)
 		if err != nil {
-			errorResponse(c, 401, err.Error())
+			serviceErrorResponse(c, http.StatusUnauthorized, err)
 			return
 		}
 
-		// Build roles list
-		roles := make([]gin.H, len(user.Roles))
-		for i, role := range user.Roles {
-			roles[i] = gin.H{
-				"id":          role.ID,
-				"name":        role.Name,
-				"description": role.Description,
-			}
-		}
-
-		successResponse(c, gin.H{
-			"authenticated": true,
-			"user": gin.H{
-				"id":         user.ID,
-				"email":      user.Email,
-				"username":   user.Username,
-				"first_name": user.FirstName,
-				"last_name":  user.LastName,
-				"active":     user.Active,
-				"roles":      roles,
-			},
-			"device": gin.H{
-				"id":         device.ID,
-				"type":       device.Type,
-				"identifier": device.Identifier,
-			},
+		successResponse(c, deviceAuthBody{
+			Authenticated: true,
+			User:          authenticatedUserResponse(user),
+			Device:        authenticatedDeviceResponse(device),
 		})
 	}
 }
 
+// deviceAuthBody is the response of a device authentication
+type deviceAuthBody struct {
+	Authenticated bool                    `json:"authenticated"`
+	User          authenticatedUserBody   `json:"user"`
+	Device        authenticatedDeviceBody `json:"device"`
+}
+
 // Middleware and handlers will be implemented in separate files:
 // - middleware.go
 // - handlers.go
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// securityHeadersMiddleware sets the browser security headers of
+// server.security_headers on every response. Handlers serving HTML, such as
+// the frontend and the API docs, replace the Content-Security-Policy with
+// their own. X-Forwarded-Proto is only believed from trustedProxies, as for
+// the client IP.
+func securityHeadersMiddleware(cfg config.SecurityHeadersConfig, trustedProxies []string) gin.HandlerFunc {
+	proxies := parseTrustedProxies(trustedProxies)
+	var hsts string
+	if cfg.HSTSMaxAge > 0 {
+		hsts = fmt.Sprintf("max-age=%d", int64(cfg.HSTSMaxAge.Seconds()))
+		if cfg.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if cfg.HSTSPreload {
+			hsts += "; preload"
+		}
+	}
+
+	return func(c *gin.Context) {
+		c.Header("X-Content-Type-Options", "nosniff")
+		if cfg.FrameOptions != "" {
+			c.Header("X-Frame-Options", cfg.FrameOptions)
+		}
+		if cfg.ContentSecurityPolicy != "" {
+			c.Header("Content-Security-Policy", cfg.ContentSecurityPolicy)
+		}
+		if cfg.ReferrerPolicy != "" {
+			c.Header("Referrer-Policy", cfg.ReferrerPolicy)
+		}
+		// Browsers ignore HSTS received over plain HTTP
+		if hsts != "" && (c.Request.TLS != nil || fromTrustedProxy(c, proxies) && strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https")) {
+			c.Header("Strict-Transport-Security", hsts)
+		}
+		c.Next()
+	}
+}
+
+// parseTrustedProxies parses server.trusted_proxies, IP addresses or CIDR
+// ranges, the way gin does. An invalid list trusts no proxy, as the router
+// falls back to then.
+func parseTrustedProxies(trustedProxies []string) []*net.IPNet {
+	proxies := make([]*net.IPNet, 0, len(trustedProxies))
+	for _, proxy := range trustedProxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil
+			}
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			proxy = fmt.Sprintf("%s/%d", proxy, bits)
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies
+}
+
+// fromTrustedProxy reports whether the request's peer is one of proxies
+func fromTrustedProxy(c *gin.Context, proxies []*net.IPNet) bool {
+	ip := net.ParseIP(c.RemoteIP())
+	if ip == nil {
+		return false
+	}
+	for _, proxy := range proxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// csrfMiddleware implements double-submit CSRF tokens. Every response lacking
+// the token cookie sets a new random token, which the frontend reads and
+// echoes in the CSRF header. Unsafe requests carrying the session cookie are
+// rejected unless the header matches the cookie; a cross-site page can make
+// the browser send both cookies but cannot read the token to set the header.
+func csrfMiddleware(cfg config.CSRFConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, err := c.Cookie(cfg.CookieName)
+		if err != nil || token == "" {
+			token = newCSRFToken()
+			http.SetCookie(c.Writer, &http.Cookie{
+				Name:     cfg.CookieName,
+				Value:    token,
+				Path:     "/",
+				Secure:   cfg.Secure,
+				SameSite: http.SameSiteStrictMode,
+			})
+		}
+
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		if _, err := c.Cookie(cfg.SessionCookie); err != nil {
+			// Not authenticated by cookie, so not forgeable by another site
+			c.Next()
+			return
+		}
+
+		header := c.GetHeader(cfg.HeaderName)
+		if header == "" || subtle.ConstantTimeCompare([]byte(header), []byte(token)) != 1 {
+			writeError(c, http.StatusForbidden, services.CodeCSRFFailed, fmt.Sprintf("missing or invalid %s header", cfg.HeaderName), nil)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// newCSRFToken returns a random, URL-safe CSRF token
+func newCSRFToken() string {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		panic(fmt.Sprintf("failed to generate CSRF token: %v", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(token)
+}
@@ -2,22 +2,39 @@ package server
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 
+	yubiapp "github.com/YubiApp"
 	"github.com/YubiApp/internal/config"
 	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/jobs"
+	"github.com/YubiApp/internal/migrate"
+	"github.com/YubiApp/internal/logging"
+	"github.com/YubiApp/internal/radius"
 	"github.com/YubiApp/internal/services"
+	"github.com/YubiApp/internal/tracing"
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+	gormtracing "gorm.io/plugin/opentelemetry/tracing"
 )
 
 type Server struct {
 	config                *config.Config
 	db                    *gorm.DB
+	replicaDB             *sql.DB
+	redisClient           redis.UniversalClient
+	eventBus              *services.EventBus
 	authService           *services.AuthService
+	authLogWriter         *services.AuthLogWriter
 	userService           *services.UserService
 	roleService           *services.RoleService
 	resourceService       *services.ResourceService
@@ -29,30 +46,152 @@ type Server struct {
 	locationService       *services.LocationService
 	userStatusService     *services.UserStatusService
 	userActivityService   *services.UserActivityService
+	reportService         *services.ReportService
+	legalHoldService      *services.LegalHoldService
+	webhookService        *services.WebhookService
+	doorService           *services.DoorService
+	machineAuthService    *services.MachineAuthService
+	kioskService          *services.KioskService
+	privacyService        *services.PrivacyService
+	background            *backgroundTasks
+	jobWorker             *jobs.Worker
+	passwordService       *services.PasswordService
+	resetService          *services.PasswordResetService
+	impersonationService  *services.ImpersonationService
+	healthService         *services.HealthService
+	radiusServer          *radius.Server
+	grpcServer            *grpc.Server
 	httpServer            *http.Server
+	shutdownTracing       func(context.Context) error
 }
 
 // New creates a new server instance
 func New(cfg *config.Config) *Server {
+	// Structured logs; log.Printf output goes through the same handler
+	logging.Setup(cfg.Logging)
+
+	// Spans for HTTP requests, database queries, Redis commands and YubiCloud calls
+	shutdownTracing, err := tracing.Setup(cfg.Tracing)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+
 	// Initialize database
-	db, err := initDatabase(cfg.Database)
+	db, replicaDB, err := initDatabase(cfg.Database, cfg.Tracing.Enabled)
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
+	// Initialize Redis, used for sessions unless auth.session_store says otherwise
+	redisClient, err := services.NewRedisClient(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize Redis: %v", err)
+	}
+	postgresSessions := services.NewPostgresSessionStore(db, cfg)
+	sessionStore := newSessionStore(cfg, postgresSessions, redisClient)
+
+	// Message catalogs for error responses and emails, with the messages edited
+	// through /templates
+	translator, err := services.NewTranslator(cfg.I18n)
+	if err != nil {
+		log.Fatalf("Failed to load message catalogs: %v", err)
+	}
+	templateService := services.NewMessageTemplateService(db, translator, cfg.I18n)
+
+	// Initialize the event bus shared by services that publish events
+	eventBus := services.NewEventBus()
+	permissionEvents := services.NewPermissionEvents(db, eventBus)
+
 	// Initialize services
-	authService := services.NewAuthService(db, cfg)
-	userService := services.NewUserService(db)
-	roleService := services.NewRoleService(db)
-	resourceService := services.NewResourceService(db)
-	permissionService := services.NewPermissionService(db)
-	deviceService := services.NewDeviceService(db)
-	actionService := services.NewActionService(db)
-	deviceRegService := services.NewDeviceRegistrationService(db)
-	sessionService := services.NewSessionService(cfg)
-	locationService := services.NewLocationService(db)
+	authLogWriter := services.NewAuthLogWriter(db, cfg.AuthLog)
+	otpReplayCache := services.NewOTPReplayCache(redisClient, cfg.Yubikey.ReplayCacheTTL)
+	securityIncidentService := services.NewSecurityIncidentService(db, eventBus)
+	pushChallenges := services.NewPushChallenges(redisClient, cfg.Push.ChallengeTTL)
+	authService := services.NewAuthService(db, cfg, authLogWriter, otpReplayCache, securityIncidentService, pushChallenges)
+	passwordService := services.NewPasswordService(db, cfg)
+	userService := services.NewUserService(db, permissionEvents, passwordService, services.NewUserAttributeSchema(cfg.Users.Attributes))
+	roleService := services.NewRoleService(db, permissionEvents)
+	resourceService := services.NewResourceService(db, permissionEvents)
+	permissionService := services.NewPermissionService(db, permissionEvents)
+	deviceService := services.NewDeviceService(db, cfg, eventBus)
+	deviceRegService := services.NewDeviceRegistrationService(db, cfg)
+	sessionService := services.NewSessionService(cfg, sessionStore)
+	jobQueue := jobs.NewQueue(redisClient, cfg.Jobs)
+	locationService := services.NewLocationService(db, cfg.Activity)
 	userStatusService := services.NewUserStatusService(db)
-	userActivityService := services.NewUserActivityService(db)
+	userActivityService := services.NewUserActivityService(db, cfg, eventBus)
+	reportService := services.NewReportService(db, cfg, jobQueue)
+	authLogService := services.NewAuthLogService(db)
+	legalHoldService := services.NewLegalHoldService(db)
+	notificationService := services.NewNotificationService(cfg)
+	actionService := services.NewActionService(db, userActivityService, notificationService, eventBus)
+	actionService.RegisterSideEffectHandler("queue", services.NewQueueSideEffectHandler(redisClient))
+	attendanceService := services.NewAttendanceService(db, cfg, notificationService, translator)
+	alertService := services.NewAlertService(db, cfg, notificationService, translator)
+	deviceAnalyticsService := services.NewDeviceAnalyticsService(db, cfg, notificationService, translator)
+	permissionUsageService := services.NewPermissionUsageService(db, cfg.PermissionUsage)
+	accessReviewService := services.NewAccessReviewService(db, cfg.AccessReviews, permissionEvents)
+	webhookService := services.NewWebhookService(db, eventBus, notificationService, jobQueue)
+	doorService := services.NewDoorService(db, cfg)
+	leaveService := services.NewLeaveService(db, cfg)
+	holidayService := services.NewHolidayService(db, cfg)
+	actionExecutionService := services.NewActionExecutionService(db, actionService, doorService, leaveService, cfg.Activity.ClockSkew)
+	machineAuthService := services.NewMachineAuthService(db, cfg, authService, eventBus)
+	kioskService := services.NewKioskService(db)
+	retentionService := services.NewRetentionService(db, cfg)
+	privacyService := services.NewPrivacyService(db, permissionEvents, legalHoldService)
+	lifecycleService := services.NewUserLifecycleService(db, permissionEvents, sessionService)
+	resetService := services.NewPasswordResetService(db, cfg, passwordService, notificationService, translator, sessionService, redisClient)
+	loginNotificationService := services.NewLoginNotificationService(db, cfg.LoginNotifications, notificationService, translator)
+	impersonationService := services.NewImpersonationService(db, sessionService, authService)
+	recoveryService := services.NewRecoveryService(db, cfg, passwordService, sessionService, securityIncidentService)
+	breakGlassService := services.NewBreakGlassService(db, cfg.BreakGlass, authService, sessionService, securityIncidentService, alertService, notificationService, translator)
+	pushService, err := services.NewPushService(db, cfg.Push, pushChallenges, authService)
+	if err != nil {
+		log.Fatalf("Failed to initialize push approval: %v", err)
+	}
+	qrLoginService := services.NewQRLoginService(redisClient, cfg, sessionService, authService)
+	anomalyService := services.NewAnomalyService(db, cfg.Anomalies)
+	hrNotificationService := services.NewHRNotificationService(db, cfg, eventBus, notificationService, translator)
+	calendarService := services.NewCalendarService(db, cfg)
+	chatService := services.NewChatIntegrationService(db, cfg, eventBus)
+	schedulerService := services.NewActionSchedulerService(db, cfg, actionService)
+	searchService := services.NewSearchService(db)
+	visitorService := services.NewVisitorService(db, notificationService, translator, eventBus)
+	shiftService := services.NewShiftService(db, cfg, notificationService, translator)
+	background := &backgroundTasks{
+		attendance: attendanceService,
+		alerts:     alertService,
+		anomalies:  anomalyService,
+		analytics:  deviceAnalyticsService,
+		usage:      permissionUsageService,
+		reviews:    accessReviewService,
+		hr:         hrNotificationService,
+		retention:  retentionService,
+		partitions: services.NewPartitionService(db, cfg.Partitions),
+		rollups:    userActivityService,
+		lifecycle:  lifecycleService,
+		actions:    schedulerService,
+		reports:    reportService,
+		shifts:     shiftService,
+		sessions:   postgresSessions,
+	}
+	jobWorker := jobs.NewWorker(jobQueue)
+	registerJobHandlers(jobWorker, webhookService, reportService)
+	healthService := services.NewHealthService(db, replicaDB, redisClient, cfg)
+
+	var responseSigner *services.ResponseSigner
+	if cfg.ResponseSigning.Enabled {
+		if responseSigner, err = services.NewResponseSigner(cfg); err != nil {
+			log.Fatalf("Failed to load response signing key: %v", err)
+		}
+	}
+
+	// Optional RADIUS front-end for VPN concentrators and Wi-Fi
+	var radiusServer *radius.Server
+	if cfg.Radius.Enabled {
+		radiusServer = radius.NewServer(cfg.Radius, authService)
+	}
 
 	// Set Gin mode
 	if !cfg.Server.Debug {
@@ -60,7 +199,70 @@ func New(cfg *config.Config) *Server {
 	}
 
 	// Setup router
-	router := setupRouter(authService, userService, roleService, resourceService, permissionService, deviceService, actionService, deviceRegService, sessionService, locationService, userStatusService, userActivityService)
+	router := setupRouter(routerDeps{
+		authService:              authService,
+		userService:              userService,
+		roleService:              roleService,
+		resourceService:          resourceService,
+		permissionService:        permissionService,
+		deviceService:            deviceService,
+		actionService:            actionService,
+		deviceRegService:         deviceRegService,
+		sessionService:           sessionService,
+		locationService:          locationService,
+		userStatusService:        userStatusService,
+		userActivityService:      userActivityService,
+		reportService:            reportService,
+		authLogService:           authLogService,
+		alertService:             alertService,
+		legalHoldService:         legalHoldService,
+		attendanceService:        attendanceService,
+		webhookService:           webhookService,
+		doorService:              doorService,
+		actionExecutionService:   actionExecutionService,
+		machineAuthService:       machineAuthService,
+		kioskService:             kioskService,
+		privacyService:           privacyService,
+		lifecycleService:         lifecycleService,
+		passwordService:          passwordService,
+		resetService:             resetService,
+		loginNotificationService: loginNotificationService,
+		impersonationService:     impersonationService,
+		deviceAnalyticsService:   deviceAnalyticsService,
+		otpReplayCache:           otpReplayCache,
+		permissionUsageService:   permissionUsageService,
+		accessReviewService:      accessReviewService,
+		recoveryService:          recoveryService,
+		breakGlassService:        breakGlassService,
+		pushService:              pushService,
+		qrLoginService:           qrLoginService,
+		securityIncidentService:  securityIncidentService,
+		anomalyService:           anomalyService,
+		hrNotificationService:    hrNotificationService,
+		templateService:          templateService,
+		calendarService:          calendarService,
+		chatService:              chatService,
+		schedulerService:         schedulerService,
+		searchService:            searchService,
+		visitorService:           visitorService,
+		shiftService:             shiftService,
+		leaveService:             leaveService,
+		holidayService:           holidayService,
+		jobQueue:                 jobQueue,
+		healthService:            healthService,
+		responseSigner:           responseSigner,
+		translator:               translator,
+		authorization:            cfg.Authorization,
+		tracingConfig:            cfg.Tracing,
+		serverConfig:             cfg.Server,
+	})
+
+	// Single-binary deployments serve the frontend too
+	if cfg.Web.ServeFrontend {
+		if err := serveFrontend(router, yubiapp.Frontend, cfg.Web.ContentSecurityPolicy); err != nil {
+			log.Fatalf("Failed to serve the frontend: %v", err)
+		}
+	}
 
 	// Create HTTP server
 	httpServer := &http.Server{
@@ -70,11 +272,32 @@ func New(cfg *config.Config) *Server {
 		WriteTimeout: cfg.Server.Timeout,
 		IdleTimeout:  cfg.Server.Timeout * 2,
 	}
+	if cfg.Server.TLS.Enabled {
+		if httpServer.TLSConfig, err = serverTLSConfig(cfg.Server.TLS); err != nil {
+			log.Fatalf("Failed to initialize TLS: %v", err)
+		}
+	}
+
+	// Optional gRPC API for internal services, with the same TLS and client
+	// certificates as HTTP
+	var grpcServer *grpc.Server
+	if cfg.GRPC.Enabled {
+		grpcServer = newGRPCServer(&grpcAPI{
+			authService: authService,
+			userService: userService,
+			authz:       newRouteAuthorizer(authService, sessionService, services.NewServiceIdentities(cfg.Server.TLS.ClientIdentities), cfg.Authorization),
+			router:      router,
+		}, httpServer.TLSConfig)
+	}
 
 	return &Server{
 		config:                cfg,
 		db:                    db,
+		replicaDB:             replicaDB,
+		redisClient:           redisClient,
+		eventBus:              eventBus,
 		authService:           authService,
+		authLogWriter:         authLogWriter,
 		userService:           userService,
 		roleService:           roleService,
 		resourceService:       resourceService,
@@ -86,54 +309,214 @@ func New(cfg *config.Config) *Server {
 		locationService:       locationService,
 		userStatusService:     userStatusService,
 		userActivityService:   userActivityService,
+		reportService:         reportService,
+		legalHoldService:      legalHoldService,
+		webhookService:        webhookService,
+		doorService:           doorService,
+		machineAuthService:    machineAuthService,
+		kioskService:          kioskService,
+		privacyService:        privacyService,
+		background:            background,
+		jobWorker:             jobWorker,
+		passwordService:       passwordService,
+		resetService:          resetService,
+		impersonationService:  impersonationService,
+		healthService:         healthService,
+		radiusServer:          radiusServer,
+		grpcServer:            grpcServer,
 		httpServer:            httpServer,
+		shutdownTracing:       shutdownTracing,
 	}
 }
 
+// Handler returns the router serving the API, for running it without Start
+// behind another listener such as an httptest server
+func (s *Server) Handler() http.Handler {
+	return s.httpServer.Handler
+}
+
 // Start starts the HTTP server
 func (s *Server) Start() error {
-	log.Printf("Starting server on %s", s.httpServer.Addr)
-	return s.httpServer.ListenAndServe()
+	if s.httpServer.TLSConfig != nil {
+		log.Printf("Starting server on %s (TLS)", s.httpServer.Addr)
+	} else {
+		log.Printf("Starting server on %s", s.httpServer.Addr)
+	}
+	s.authLogWriter.Start()
+	if s.config.Worker.SchedulersInAPI {
+		s.background.start(s.config)
+	}
+	s.jobWorker.Start(s.config.Jobs.Workers)
+	if s.radiusServer != nil {
+		if err := s.radiusServer.Start(); err != nil {
+			return err
+		}
+	}
+	if s.grpcServer != nil {
+		if err := serveGRPC(s.grpcServer, s.config.GRPC.Listen); err != nil {
+			return err
+		}
+	}
+	// Shutdown makes ListenAndServe return ErrServerClosed straight away
+	var err error
+	if s.httpServer.TLSConfig != nil {
+		// The certificate comes from TLSConfig.GetCertificate
+		err = s.httpServer.ListenAndServeTLS("", "")
+	} else {
+		err = s.httpServer.ListenAndServe()
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Reload re-reads the configuration and applies the settings that can change
+// without a restart (log level and rate limits); see config.Reload
+func (s *Server) Reload() error {
+	changed, restartNeeded, err := config.Reload(s.config)
+	if err != nil {
+		return err
+	}
+	logging.SetLevel(s.config.Logging.Level)
+
+	if len(changed) == 0 {
+		log.Printf("Configuration reloaded; no runtime settings changed")
+	} else {
+		log.Printf("Configuration reloaded; applied %s", strings.Join(changed, ", "))
+	}
+	if restartNeeded {
+		log.Printf("Configuration has other changes that take effect after a restart")
+	}
+	return nil
 }
 
-// Shutdown gracefully shuts down the server
+// Shutdown gracefully shuts down the server: it stops accepting connections,
+// waits for in-flight requests, event handlers, running jobs and audit writes,
+// then closes the Redis and database pools. Work still running when ctx is done
+// is abandoned.
 func (s *Server) Shutdown(ctx context.Context) error {
-	// Close session service (Redis connection)
-	if s.sessionService != nil {
-		if err := s.sessionService.Close(); err != nil {
-			log.Printf("Error closing session service: %v", err)
+	s.background.stop()
+	if s.radiusServer != nil {
+		s.radiusServer.Shutdown()
+	}
+
+	err := s.httpServer.Shutdown(ctx)
+	if err != nil {
+		log.Printf("Error draining HTTP requests: %v", err)
+	}
+	if s.grpcServer != nil {
+		stopGRPC(ctx, s.grpcServer)
+	}
+
+	// Requests may have queued webhook deliveries and audit writes
+	if waitErr := s.eventBus.Wait(ctx); waitErr != nil {
+		log.Printf("Gave up waiting for event handlers: %v", waitErr)
+	}
+	if waitErr := s.jobWorker.Stop(ctx); waitErr != nil {
+		log.Printf("Gave up waiting for running jobs: %v", waitErr)
+	}
+	if waitErr := s.machineAuthService.WaitForAudits(ctx); waitErr != nil {
+		log.Printf("Gave up waiting for machine authentication logs: %v", waitErr)
+	}
+	if closeErr := s.authLogWriter.Close(ctx); closeErr != nil {
+		log.Printf("Gave up flushing authentication logs: %v", closeErr)
+	}
+
+	if closeErr := s.redisClient.Close(); closeErr != nil {
+		log.Printf("Error closing Redis: %v", closeErr)
+	}
+	if sqlDB, dbErr := s.db.DB(); dbErr == nil {
+		if closeErr := sqlDB.Close(); closeErr != nil {
+			log.Printf("Error closing database: %v", closeErr)
 		}
 	}
-	return s.httpServer.Shutdown(ctx)
+	if s.replicaDB != nil {
+		if closeErr := s.replicaDB.Close(); closeErr != nil {
+			log.Printf("Error closing read replica: %v", closeErr)
+		}
+	}
+
+	// Flush spans still buffered by the exporter
+	if tracingErr := s.shutdownTracing(ctx); tracingErr != nil {
+		log.Printf("Error shutting down tracing: %v", tracingErr)
+	}
+	return err
+}
+
+// newSessionStore returns the store auth.session_store selects: Redis by
+// default, or postgres or memory
+func newSessionStore(cfg *config.Config, postgresSessions *services.PostgresSessionStore, redisClient redis.UniversalClient) services.SessionStore {
+	switch cfg.Auth.SessionStore {
+	case "memory":
+		log.Printf("Keeping sessions in memory; they are lost on restart and not shared between instances")
+		return services.NewMemorySessionStore()
+	case "postgres":
+		return postgresSessions
+	default:
+		return services.NewRedisSessionStore(redisClient)
+	}
 }
 
-// initDatabase initializes the database connection
-func initDatabase(cfg config.DatabaseConfig) (*gorm.DB, error) {
+// initDatabase initializes the database connection, tracing queries when traced
+// is set. When database.replica_dsn is set it also connects to the read replica,
+// returned so its pool can be checked and closed, and registers it with the
+// resolver that database.ReadReplica queries opt into.
+func initDatabase(cfg config.DatabaseConfig, traced bool) (*gorm.DB, *sql.DB, error) {
 	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
 		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Name, cfg.SSLMode)
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	// TranslateError turns unique violations into gorm.ErrDuplicatedKey, which
+	// services report as conflicts
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	if traced {
+		if err := db.Use(gormtracing.NewPlugin(gormtracing.WithoutMetrics())); err != nil {
+			return nil, nil, fmt.Errorf("failed to enable database tracing: %w", err)
+		}
+	}
+
+	// The schema is managed by `yubiapp-cli migrate`; refuse to serve against
+	// a database that is behind (or ahead of) this build
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	configurePool(sqlDB, cfg)
+	migrator, err := migrate.New(sqlDB, yubiapp.Migrations, yubiapp.MigrationsDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := migrator.Check(context.Background()); err != nil {
+		return nil, nil, err
+	}
+
+	if cfg.ReplicaDSN == "" {
+		return db, nil, nil
+	}
+	replicaDB, err := sql.Open("pgx", cfg.ReplicaDSN)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to database: %w", err)
-	}
-
-	// Auto migrate database models
-	if err := db.AutoMigrate(
-		&database.User{},
-		&database.Role{},
-		&database.Resource{},
-		&database.Permission{},
-		&database.Action{},
-		&database.Device{},
-		&database.Session{},
-		&database.AuthenticationLog{},
-		&database.DeviceRegistration{},
-		&database.Location{},
-		&database.UserStatus{},
-		&database.UserActivityHistory{},
-	); err != nil {
-		return nil, fmt.Errorf("failed to migrate database: %w", err)
-	}
-
-	return db, nil
+		return nil, nil, fmt.Errorf("failed to open read replica: %w", err)
+	}
+	configurePool(replicaDB, cfg)
+	resolver := dbresolver.Register(dbresolver.Config{
+		Replicas: []gorm.Dialector{postgres.New(postgres.Config{Conn: replicaDB})},
+	}, database.ReplicaResolver)
+	if err := db.Use(resolver); err != nil {
+		replicaDB.Close()
+		return nil, nil, fmt.Errorf("failed to register read replica: %w", err)
+	}
+
+	return db, replicaDB, nil
+}
+
+// configurePool applies the database.* pool settings to a connection pool
+func configurePool(db *sql.DB, cfg config.DatabaseConfig) {
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
 } 
\ No newline at end of file
@@ -1,7 +1,20 @@
 package server
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/services"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
 )
 
 // extractNonceFromRequest extracts nonce from request (JSON body for POST/PUT, URL param for GET)
@@ -33,58 +46,316 @@ func setRequestNonce(c *gin.Context, nonce string) {
 	}
 }
 
-// responseWithNonce wraps a response with the nonce from the request
-func responseWithNonce(c *gin.Context, statusCode int, data gin.H) {
+// responseWithNonce wraps a response with the nonce from the request. data is
+// a declared response type; with a nonce its fields are written alongside it.
+func responseWithNonce(c *gin.Context, statusCode int, data interface{}) {
 	if data == nil {
 		data = gin.H{}
 	}
 	
 	// Extract nonce from request and include it in response
 	nonce := extractNonceFromRequest(c)
-	if nonce != "" {
-		data["nonce"] = nonce
+	if nonce == "" {
+		c.JSON(statusCode, data)
+		return
 	}
-	
-	c.JSON(statusCode, data)
+
+	fields, err := responseFields(data)
+	if err != nil {
+		log.Printf("Failed to add nonce to response: %v", err)
+		c.JSON(statusCode, data)
+		return
+	}
+	fields["nonce"] = nonce
+
+	// A nonce asks for a signed response when signing is enabled
+	if signer, ok := c.Get("response_signer"); ok && statusCode != http.StatusNoContent {
+		signedResponse(c, statusCode, fields, signer.(*services.ResponseSigner))
+		return
+	}
+
+	c.JSON(statusCode, fields)
+}
+
+// responseFields returns the top-level JSON fields of a response body, keeping
+// numbers exactly as they are encoded
+func responseFields(data interface{}) (gin.H, error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var fields gin.H
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// signedResponse adds a server timestamp to data and writes it with an X-Signature
+// header over the exact body bytes. json.Marshal sorts map keys, so the body is in
+// canonical form.
+func signedResponse(c *gin.Context, statusCode int, data gin.H, signer *services.ResponseSigner) {
+	data["timestamp"] = time.Now().UTC().Format(time.RFC3339)
+
+	body, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Failed to sign response: %v", err)
+		c.JSON(statusCode, data)
+		return
+	}
+
+	c.Header("X-Signature", signer.Sign(body))
+	c.Header("X-Signature-Key-Id", signer.KeyID())
+	c.Data(statusCode, "application/json; charset=utf-8", body)
 }
 
 // successResponse creates a success response with nonce from request
-func successResponse(c *gin.Context, data gin.H) {
+func successResponse(c *gin.Context, data interface{}) {
 	responseWithNonce(c, 200, data)
 }
 
-// errorResponse creates an error response with nonce from request
+// errorStatuses maps service error codes to the HTTP status they are reported with
+var errorStatuses = map[services.ErrorCode]int{
+	services.CodeAuthFailed:             http.StatusUnauthorized,
+	services.CodeAuthReplayedOTP:        http.StatusUnauthorized,
+	services.CodeDeviceCloneSuspected:   http.StatusUnauthorized,
+	services.CodeSessionInvalid:         http.StatusUnauthorized,
+	services.CodeSessionBindingMismatch: http.StatusUnauthorized,
+	services.CodeCSRFFailed:             http.StatusForbidden,
+	services.CodeAccountInactive:        http.StatusForbidden,
+	services.CodeAccountLocked:          http.StatusLocked,
+	services.CodePasswordExpired:        http.StatusForbidden,
+	services.CodePermissionDenied:       http.StatusForbidden,
+	services.CodeValidationFailed:       http.StatusBadRequest,
+	services.CodeNotFound:               http.StatusNotFound,
+	services.CodeConflict:               http.StatusConflict,
+	services.CodeRateLimited:            http.StatusTooManyRequests,
+	services.CodeUpstreamFailed:         http.StatusBadGateway,
+	services.CodeValidationUnavailable:  http.StatusServiceUnavailable,
+	services.CodePushPending:            http.StatusConflict,
+	services.CodePushDenied:             http.StatusUnauthorized,
+	services.CodeInternal:               http.StatusInternalServerError,
+}
+
+// defaultErrorCode is the code for errors reported with a status but no code
+func defaultErrorCode(statusCode int) services.ErrorCode {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return services.CodeValidationFailed
+	case http.StatusUnauthorized:
+		return services.CodeAuthFailed
+	case http.StatusForbidden:
+		return services.CodePermissionDenied
+	case http.StatusNotFound:
+		return services.CodeNotFound
+	case http.StatusConflict:
+		return services.CodeConflict
+	case http.StatusLocked:
+		return services.CodeAccountLocked
+	case http.StatusTooManyRequests:
+		return services.CodeRateLimited
+	case http.StatusBadGateway:
+		return services.CodeUpstreamFailed
+	}
+	return services.CodeInternal
+}
+
+// errorResponse creates an error response with nonce from request. The code is
+// derived from the status.
 func errorResponse(c *gin.Context, statusCode int, message string) {
-	responseWithNonce(c, statusCode, gin.H{
-		"error": message,
+	writeError(c, statusCode, defaultErrorCode(statusCode), message, nil)
+}
+
+// serviceErrorResponse reports a service error with the status its code maps to.
+// Errors without a code are reported with fallbackStatus.
+func serviceErrorResponse(c *gin.Context, fallbackStatus int, err error) {
+	code := services.ErrorCodeOf(err)
+	statusCode, ok := errorStatuses[code]
+	if !ok {
+		statusCode = fallbackStatus
+		code = defaultErrorCode(fallbackStatus)
+	}
+	writeError(c, statusCode, code, err.Error(), nil)
+}
+
+// bindErrorResponse reports a request body that failed to bind, with the fields
+// that failed validation. The details are in the request's locale.
+func bindErrorResponse(c *gin.Context, err error) {
+	translator, locale := requestLocale(c)
+	message := "Invalid request body: " + err.Error()
+	var localized string
+	var details []errorDetailBody
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		messages := make([]string, len(validationErrors))
+		localizedMessages := make([]string, len(validationErrors))
+		for i, fieldErr := range validationErrors {
+			messages[i] = validationMessage(fieldErr)
+			localizedMessages[i] = localizedValidationMessage(translator, locale, fieldErr)
+			details = append(details, errorDetailBody{
+				Field:   fieldErr.Field(),
+				Rule:    fieldErr.Tag(),
+				Message: localizedMessages[i],
+			})
+		}
+		message = "Invalid request body: " + strings.Join(messages, "; ")
+		localized = strings.Join(localizedMessages, "; ")
+	}
+	writeLocalizedError(c, http.StatusBadRequest, services.CodeValidationFailed, message, localized, details)
+}
+
+// validationMessage describes a failed validation rule for clients
+func validationMessage(fieldErr validator.FieldError) string {
+	switch fieldErr.Tag() {
+	case "required":
+		return fieldErr.Field() + " is required"
+	case "email":
+		return fieldErr.Field() + " must be a valid email address"
+	case "min":
+		return fieldErr.Field() + " must be at least " + fieldErr.Param()
+	case "max":
+		return fieldErr.Field() + " must be at most " + fieldErr.Param()
+	case "oneof":
+		return fieldErr.Field() + " must be one of: " + fieldErr.Param()
+	}
+	return fieldErr.Field() + " failed the " + fieldErr.Tag() + " rule"
+}
+
+// localizedValidationMessage is validationMessage in locale, from the
+// validation.<rule> messages
+func localizedValidationMessage(translator *services.Translator, locale string, fieldErr validator.FieldError) string {
+	if translator == nil {
+		return validationMessage(fieldErr)
+	}
+	key := "validation." + fieldErr.Tag()
+	if translator.Message(locale, key) == nil {
+		key = "validation.other"
+	}
+	return translator.Translate(locale, key, map[string]string{
+		"Field": fieldErr.Field(),
+		"Param": fieldErr.Param(),
+		"Rule":  fieldErr.Tag(),
 	})
 }
 
+// writeError writes the error envelope: the message, a stable code, the request
+// ID and any field-level details
+func writeError(c *gin.Context, statusCode int, code services.ErrorCode, message string, details []errorDetailBody) {
+	writeLocalizedError(c, statusCode, code, message, "", details)
+}
+
+// writeLocalizedError is writeError with the message for users in the
+// request's locale; an empty localized message uses the code's. The error
+// message stays in English for logs and existing clients.
+func writeLocalizedError(c *gin.Context, statusCode int, code services.ErrorCode, message, localized string, details []errorDetailBody) {
+	if translator, locale := requestLocale(c); translator != nil {
+		if localized == "" {
+			localized = translator.Translate(locale, "error."+string(code), nil)
+		}
+		c.Header("Content-Language", locale)
+	}
+	responseWithNonce(c, statusCode, errorBody{
+		Error:     message,
+		Message:   localized,
+		Code:      code,
+		RequestID: c.GetString("request_id"),
+		Details:   details,
+		Nonce:     extractNonceFromRequest(c),
+	})
+}
+
+// errorBody is the envelope of every error response
+type errorBody struct {
+	Error     string             `json:"error" doc:"Human-readable message in English"`
+	Message   string             `json:"message,omitempty" doc:"Message for users in the negotiated language"`
+	Code      services.ErrorCode `json:"code" doc:"Stable machine-readable code"`
+	RequestID string             `json:"request_id" doc:"Also returned in the X-Request-ID header"`
+	Details   []errorDetailBody  `json:"details,omitempty" doc:"Field-level validation failures (VALIDATION_FAILED only)"`
+	Nonce     string             `json:"nonce,omitempty" doc:"The request's nonce, if it sent one"`
+}
+
+func (errorBody) schemaDescription() string {
+	return "Returned with every 4xx/5xx response. message is in the user's locale setting, else the best match for Accept-Language (see /locales), and the Content-Language header names the language used."
+}
+
+// errorDetailBody is a field that failed validation
+type errorDetailBody struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message" doc:"In the negotiated language"`
+}
+
+// requestLocale returns the router's translator and the locale to answer the
+// request in: the authenticated user's locale setting, else the best match for
+// Accept-Language. The translator is nil when the router has none.
+func requestLocale(c *gin.Context) (*services.Translator, string) {
+	value, ok := c.Get("translator")
+	if !ok {
+		return nil, ""
+	}
+	translator := value.(*services.Translator)
+
+	preferred := ""
+	if user, ok := c.Get("user"); ok {
+		if user, ok := user.(*database.User); ok {
+			preferred = user.Locale
+		}
+	}
+	return translator, translator.Negotiate(preferred, c.GetHeader("Accept-Language"))
+}
+
+// registerValidationFieldNames makes validation errors name fields by their JSON
+// keys rather than Go field names
+func registerValidationFieldNames() {
+	validate, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "" || name == "-" {
+			return field.Name
+		}
+		return name
+	})
+}
+
+// messageBody is the response of operations that return nothing but a
+// confirmation
+type messageBody struct {
+	Message string `json:"message"`
+}
+
+// listBody is the envelope of list responses: a page of items and the total
+// number of matches
+type listBody struct {
+	Items interface{} `json:"items"`
+	Total int64       `json:"total"`
+}
+
+// itemBody is the envelope of single item responses
+type itemBody struct {
+	Item interface{} `json:"item"`
+}
+
 // listResponse creates a list response with nonce from request
 func listResponse(c *gin.Context, items interface{}, total int64) {
-	responseWithNonce(c, 200, gin.H{
-		"items": items,
-		"total": total,
-	})
+	responseWithNonce(c, 200, listBody{Items: items, Total: total})
 }
 
 // itemResponse creates a single item response with nonce from request
 func itemResponse(c *gin.Context, item interface{}) {
-	responseWithNonce(c, 200, gin.H{
-		"item": item,
-	})
+	responseWithNonce(c, 200, itemBody{Item: item})
 }
 
 // createdResponse creates a 201 response with nonce from request
 func createdResponse(c *gin.Context, item interface{}) {
-	responseWithNonce(c, 201, gin.H{
-		"item": item,
-	})
+	responseWithNonce(c, 201, itemBody{Item: item})
 }
 
 // deletedResponse creates a 204 response with nonce from request
 func deletedResponse(c *gin.Context) {
-	responseWithNonce(c, 204, gin.H{
-		"message": "deleted",
-	})
+	responseWithNonce(c, 204, nil)
 } 
\ No newline at end of file
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/jobs"
+	"github.com/YubiApp/internal/logging"
+	"github.com/YubiApp/internal/services"
+	"github.com/YubiApp/internal/tracing"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// Worker runs the schedulers and queued jobs without serving the API, so
+// heavy background work does not compete with authentication (cmd/worker).
+// It shares the services layer with the API server.
+type Worker struct {
+	config          *config.Config
+	db              *gorm.DB
+	replicaDB       *sql.DB
+	redisClient     redis.UniversalClient
+	eventBus        *services.EventBus
+	background      *backgroundTasks
+	jobWorker       *jobs.Worker
+	healthServer    *http.Server
+	shutdownTracing func(context.Context) error
+}
+
+// NewWorker creates a worker process with the services that run in the background
+func NewWorker(cfg *config.Config) *Worker {
+	logging.Setup(cfg.Logging)
+
+	shutdownTracing, err := tracing.Setup(cfg.Tracing)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+
+	db, replicaDB, err := initDatabase(cfg.Database, cfg.Tracing.Enabled)
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	redisClient, err := services.NewRedisClient(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize Redis: %v", err)
+	}
+
+	// Alerts, reports and HR notifications without their own templates use the
+	// default locale's messages, as edited through /templates
+	translator, err := services.NewTranslator(cfg.I18n)
+	if err != nil {
+		log.Fatalf("Failed to load message catalogs: %v", err)
+	}
+	services.NewMessageTemplateService(db, translator, cfg.I18n)
+
+	// Events published by background work are delivered to webhooks and HR
+	// notification rules from here
+	eventBus := services.NewEventBus()
+	permissionEvents := services.NewPermissionEvents(db, eventBus)
+	jobQueue := jobs.NewQueue(redisClient, cfg.Jobs)
+
+	notificationService := services.NewNotificationService(cfg)
+	userActivityService := services.NewUserActivityService(db, cfg, eventBus)
+	actionService := services.NewActionService(db, userActivityService, notificationService, eventBus)
+	actionService.RegisterSideEffectHandler("queue", services.NewQueueSideEffectHandler(redisClient))
+	webhookService := services.NewWebhookService(db, eventBus, notificationService, jobQueue)
+	reportService := services.NewReportService(db, cfg, jobQueue)
+	postgresSessions := services.NewPostgresSessionStore(db, cfg)
+	// Users suspended or offboarded by due transitions lose their sessions
+	sessionService := services.NewSessionService(cfg, newSessionStore(cfg, postgresSessions, redisClient))
+	background := &backgroundTasks{
+		attendance: services.NewAttendanceService(db, cfg, notificationService, translator),
+		alerts:     services.NewAlertService(db, cfg, notificationService, translator),
+		anomalies:  services.NewAnomalyService(db, cfg.Anomalies),
+		analytics:  services.NewDeviceAnalyticsService(db, cfg, notificationService, translator),
+		usage:      services.NewPermissionUsageService(db, cfg.PermissionUsage),
+		reviews:    services.NewAccessReviewService(db, cfg.AccessReviews, permissionEvents),
+		hr:         services.NewHRNotificationService(db, cfg, eventBus, notificationService, translator),
+		retention:  services.NewRetentionService(db, cfg),
+		partitions: services.NewPartitionService(db, cfg.Partitions),
+		rollups:    userActivityService,
+		lifecycle:  services.NewUserLifecycleService(db, permissionEvents, sessionService),
+		actions:    services.NewActionSchedulerService(db, cfg, actionService),
+		reports:    reportService,
+		shifts:     services.NewShiftService(db, cfg, notificationService, translator),
+		sessions:   postgresSessions,
+	}
+
+	jobWorker := jobs.NewWorker(jobQueue)
+	registerJobHandlers(jobWorker, webhookService, reportService)
+
+	// Liveness and readiness for the orchestrator, as on the API server
+	var healthServer *http.Server
+	if cfg.Worker.HealthListen != "" {
+		healthService := services.NewHealthService(db, replicaDB, redisClient, cfg)
+		router := gin.New()
+		router.Use(gin.Recovery())
+		router.GET("/healthz", handleLiveness())
+		router.GET("/readyz", handleReadiness(healthService))
+		healthServer = &http.Server{
+			Addr:    cfg.Worker.HealthListen,
+			Handler: router,
+		}
+	}
+
+	return &Worker{
+		config:          cfg,
+		db:              db,
+		replicaDB:       replicaDB,
+		redisClient:     redisClient,
+		eventBus:        eventBus,
+		background:      background,
+		jobWorker:       jobWorker,
+		healthServer:    healthServer,
+		shutdownTracing: shutdownTracing,
+	}
+}
+
+// Start starts the schedulers, runs jobs.worker_concurrency jobs at a time and
+// serves the health endpoints until Shutdown
+func (w *Worker) Start() error {
+	log.Printf("Starting worker with %d concurrent jobs", w.config.Jobs.WorkerConcurrency)
+	w.background.start(w.config)
+	w.jobWorker.Start(w.config.Jobs.WorkerConcurrency)
+
+	if w.healthServer == nil {
+		return nil
+	}
+	log.Printf("Serving worker health checks on %s", w.healthServer.Addr)
+	if err := w.healthServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops the schedulers and taking jobs, waits for running jobs and
+// event handlers, then closes the Redis and database pools. Jobs still running
+// when ctx is done are retried elsewhere once their lease expires.
+func (w *Worker) Shutdown(ctx context.Context) error {
+	w.background.stop()
+	err := w.jobWorker.Stop(ctx)
+	if err != nil {
+		log.Printf("Gave up waiting for running jobs: %v", err)
+	}
+	if waitErr := w.eventBus.Wait(ctx); waitErr != nil {
+		log.Printf("Gave up waiting for event handlers: %v", waitErr)
+	}
+	if w.healthServer != nil {
+		if closeErr := w.healthServer.Shutdown(ctx); closeErr != nil {
+			log.Printf("Error stopping health server: %v", closeErr)
+		}
+	}
+
+	if closeErr := w.redisClient.Close(); closeErr != nil {
+		log.Printf("Error closing Redis: %v", closeErr)
+	}
+	if sqlDB, dbErr := w.db.DB(); dbErr == nil {
+		if closeErr := sqlDB.Close(); closeErr != nil {
+			log.Printf("Error closing database: %v", closeErr)
+		}
+	}
+	if w.replicaDB != nil {
+		if closeErr := w.replicaDB.Close(); closeErr != nil {
+			log.Printf("Error closing read replica: %v", closeErr)
+		}
+	}
+
+	if tracingErr := w.shutdownTracing(ctx); tracingErr != nil {
+		log.Printf("Error shutting down tracing: %v", tracingErr)
+	}
+	return err
+}
@@ -0,0 +1,523 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Access review campaign statuses
+const (
+	AccessReviewOpen      = "open"
+	AccessReviewCompleted = "completed" // Every assignment was decided
+	AccessReviewExpired   = "expired"   // Due with assignments undecided
+)
+
+// Access review decisions
+const (
+	AccessReviewPending  = "pending"
+	AccessReviewApproved = "approved"
+	AccessReviewRevoked  = "revoked"
+)
+
+// Access review reviewer types
+const (
+	AccessReviewByManager   = "manager"    // The user's manager reviews each of their roles
+	AccessReviewByRoleOwner = "role_owner" // The role's owner reviews everyone holding it
+)
+
+// accessReviewLockID keys the advisory lock that keeps the API process and
+// cmd/worker from opening the same scheduled campaign twice
+const accessReviewLockID = 7279158434
+
+// AccessReviewCounts counts a campaign's assignments by decision
+type AccessReviewCounts struct {
+	Total    int64 `json:"total"`
+	Pending  int64 `json:"pending"`
+	Approved int64 `json:"approved"`
+	Revoked  int64 `json:"revoked"`
+}
+
+// add counts n assignments with decision
+func (c *AccessReviewCounts) add(decision string, n int64) {
+	c.Total += n
+	switch decision {
+	case AccessReviewPending:
+		c.Pending += n
+	case AccessReviewApproved:
+		c.Approved += n
+	case AccessReviewRevoked:
+		c.Revoked += n
+	}
+}
+
+// AccessReviewCampaignFilter selects campaigns to list; zero values match everything
+type AccessReviewCampaignFilter struct {
+	Status string
+	Limit  int
+	Offset int
+}
+
+// AccessReviewItemFilter selects assignments under review to list; zero
+// values match everything
+type AccessReviewItemFilter struct {
+	CampaignID *uuid.UUID
+	ReviewerID *uuid.UUID
+	UserID     *uuid.UUID
+	Decision   string
+	Limit      int
+	Offset     int
+}
+
+// AccessReviewerProgress is how far one reviewer is through a campaign
+type AccessReviewerProgress struct {
+	ReviewerID *uuid.UUID `json:"reviewer_id"` // nil for assignments left to admins
+	Username   string     `json:"username"`
+	AccessReviewCounts
+}
+
+// AccessReviewReport is a campaign's completion, overall and by reviewer, for auditors
+type AccessReviewReport struct {
+	Campaign        database.AccessReviewCampaign `json:"campaign"`
+	GeneratedAt     time.Time                     `json:"generated_at"`
+	Overdue         bool                          `json:"overdue"` // Still open past its due date
+	PercentComplete float64                       `json:"percent_complete"`
+	AccessReviewCounts
+	Reviewers []AccessReviewerProgress `json:"reviewers"` // Most pending first
+}
+
+// AccessReviewService runs access review campaigns over users' role
+// assignments: reviewers approve or revoke each assignment, and revoked ones
+// are removed. A scheduler opens campaigns every access_reviews.interval and
+// expires them when due.
+type AccessReviewService struct {
+	db     *gorm.DB
+	config config.AccessReviewsConfig
+	events *PermissionEvents
+	stop   chan struct{}
+}
+
+func NewAccessReviewService(db *gorm.DB, cfg config.AccessReviewsConfig, events *PermissionEvents) *AccessReviewService {
+	return &AccessReviewService{
+		db:     db,
+		config: cfg,
+		events: events,
+	}
+}
+
+// CreateCampaign opens a campaign over every user's assignment to roleID, or
+// to any role when nil, due at dueAt or access_reviews.duration from now. Each
+// assignment is reviewed by the user's manager or the role's owner, as
+// reviewerType says; assignments without one, or whose reviewer would be the
+// user themselves, are left to admins. A campaign without assignments is
+// completed right away.
+func (s *AccessReviewService) CreateCampaign(name, reviewerType string, roleID *uuid.UUID, dueAt *time.Time, createdByID *uuid.UUID, now time.Time) (*database.AccessReviewCampaign, error) {
+	var campaign *database.AccessReviewCampaign
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		campaign, err = s.createCampaign(tx, name, reviewerType, roleID, dueAt, createdByID, now)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetCampaign(campaign.ID)
+}
+
+func (s *AccessReviewService) createCampaign(tx *gorm.DB, name, reviewerType string, roleID *uuid.UUID, dueAt *time.Time, createdByID *uuid.UUID, now time.Time) (*database.AccessReviewCampaign, error) {
+	if reviewerType != AccessReviewByManager && reviewerType != AccessReviewByRoleOwner {
+		return nil, NewError(CodeValidationFailed, "reviewer_type must be %s or %s", AccessReviewByManager, AccessReviewByRoleOwner)
+	}
+	if name == "" {
+		name = "Access review " + now.UTC().Format("2006-01-02")
+	}
+	due := now.Add(s.config.Duration)
+	if dueAt != nil {
+		due = *dueAt
+	}
+	if !due.After(now) {
+		return nil, NewError(CodeValidationFailed, "due_at must be in the future")
+	}
+	if roleID != nil {
+		var role database.Role
+		if err := tx.Select("id").Where("id = ?", *roleID).First(&role).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, NewError(CodeNotFound, "role not found")
+			}
+			return nil, fmt.Errorf("failed to get role: %w", err)
+		}
+	}
+
+	campaign := database.AccessReviewCampaign{
+		ID:           uuid.New(),
+		Name:         name,
+		ReviewerType: reviewerType,
+		RoleID:       roleID,
+		DueAt:        due,
+		Status:       AccessReviewOpen,
+		CreatedByID:  createdByID,
+	}
+	if err := tx.Create(&campaign).Error; err != nil {
+		return nil, fmt.Errorf("failed to create access review campaign: %w", err)
+	}
+
+	reviewer := "u.manager_id"
+	if reviewerType == AccessReviewByRoleOwner {
+		reviewer = "r.owner_id"
+	}
+	query := `
+		INSERT INTO access_review_items (id, created_at, updated_at, campaign_id, user_id, role_id, reviewer_id, decision)
+		SELECT uuid_generate_v4(), ?, ?, ?, ur.user_id, ur.role_id, NULLIF(` + reviewer + `, ur.user_id), ?
+		FROM user_roles ur
+		JOIN users u ON u.id = ur.user_id AND u.deleted_at IS NULL
+		JOIN roles r ON r.id = ur.role_id
+	`
+	args := []interface{}{now, now, campaign.ID, AccessReviewPending}
+	if roleID != nil {
+		query += " WHERE ur.role_id = ?"
+		args = append(args, *roleID)
+	}
+	result := tx.Exec(query, args...)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to snapshot role assignments: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		if err := tx.Model(&campaign).Updates(map[string]interface{}{"status": AccessReviewCompleted, "completed_at": now}).Error; err != nil {
+			return nil, fmt.Errorf("failed to complete access review campaign: %w", err)
+		}
+	}
+	return &campaign, nil
+}
+
+// GetCampaign retrieves a campaign by ID
+func (s *AccessReviewService) GetCampaign(id uuid.UUID) (*database.AccessReviewCampaign, error) {
+	var campaign database.AccessReviewCampaign
+	if err := s.db.Preload("Role").Where("id = ?", id).First(&campaign).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "access review campaign not found")
+		}
+		return nil, fmt.Errorf("failed to get access review campaign: %w", err)
+	}
+	return &campaign, nil
+}
+
+// ListCampaigns returns a page of matching campaigns, newest first, and the total number of matches
+func (s *AccessReviewService) ListCampaigns(filter AccessReviewCampaignFilter) ([]database.AccessReviewCampaign, int64, error) {
+	query := database.ReadReplica(s.db).Model(&database.AccessReviewCampaign{})
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count access review campaigns: %w", err)
+	}
+
+	var campaigns []database.AccessReviewCampaign
+	if err := query.Preload("Role").Order("created_at DESC").
+		Limit(filter.Limit).Offset(filter.Offset).Find(&campaigns).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch access review campaigns: %w", err)
+	}
+	return campaigns, total, nil
+}
+
+// CampaignCounts counts the assignments of each campaign by decision
+func (s *AccessReviewService) CampaignCounts(campaignIDs ...uuid.UUID) (map[uuid.UUID]AccessReviewCounts, error) {
+	counts := make(map[uuid.UUID]AccessReviewCounts, len(campaignIDs))
+	if len(campaignIDs) == 0 {
+		return counts, nil
+	}
+
+	var rows []struct {
+		CampaignID uuid.UUID
+		Decision   string
+		Count      int64
+	}
+	if err := database.ReadReplica(s.db).Model(&database.AccessReviewItem{}).
+		Select("campaign_id, decision, COUNT(*) AS count").
+		Where("campaign_id IN ?", campaignIDs).
+		Group("campaign_id, decision").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to count access review decisions: %w", err)
+	}
+	for _, row := range rows {
+		campaignCounts := counts[row.CampaignID]
+		campaignCounts.add(row.Decision, row.Count)
+		counts[row.CampaignID] = campaignCounts
+	}
+	return counts, nil
+}
+
+// ListItems returns a page of matching assignments under review, by user and
+// role, and the total number of matches
+func (s *AccessReviewService) ListItems(filter AccessReviewItemFilter) ([]database.AccessReviewItem, int64, error) {
+	query := database.ReadReplica(s.db).Model(&database.AccessReviewItem{})
+	if filter.CampaignID != nil {
+		query = query.Where("campaign_id = ?", *filter.CampaignID)
+	}
+	if filter.ReviewerID != nil {
+		query = query.Where("reviewer_id = ?", *filter.ReviewerID)
+	}
+	if filter.UserID != nil {
+		query = query.Where("user_id = ?", *filter.UserID)
+	}
+	if filter.Decision != "" {
+		query = query.Where("decision = ?", filter.Decision)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count access review items: %w", err)
+	}
+
+	var items []database.AccessReviewItem
+	if err := query.Preload("User").Preload("Role").Preload("Reviewer").Order("created_at, user_id, role_id").
+		Limit(filter.Limit).Offset(filter.Offset).Find(&items).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch access review items: %w", err)
+	}
+	return items, total, nil
+}
+
+// GetItem retrieves an assignment under review by ID
+func (s *AccessReviewService) GetItem(id uuid.UUID) (*database.AccessReviewItem, error) {
+	var item database.AccessReviewItem
+	if err := s.db.Preload("User").Preload("Role").Preload("Reviewer").Where("id = ?", id).First(&item).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "access review item not found")
+		}
+		return nil, fmt.Errorf("failed to get access review item: %w", err)
+	}
+	return &item, nil
+}
+
+// Decide records deciderID's approval or revocation of an assignment under
+// review; revoking removes the user from the role. Only the assignment's
+// reviewer may decide it, or an admin, and never the user it is about. The
+// campaign completes with its last decision.
+func (s *AccessReviewService) Decide(itemID, deciderID uuid.UUID, admin, approve bool, note string, now time.Time) (*database.AccessReviewItem, error) {
+	var item database.AccessReviewItem
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", itemID).First(&item).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return NewError(CodeNotFound, "access review item not found")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to fetch access review item: %w", err)
+		}
+
+		var campaign database.AccessReviewCampaign
+		if err := tx.Where("id = ?", item.CampaignID).First(&campaign).Error; err != nil {
+			return fmt.Errorf("failed to fetch access review campaign: %w", err)
+		}
+		if campaign.Status != AccessReviewOpen {
+			return NewError(CodeConflict, "access review campaign is %s", campaign.Status)
+		}
+		if item.Decision != AccessReviewPending {
+			return NewError(CodeConflict, "assignment is already %s", item.Decision)
+		}
+		if item.UserID == deciderID {
+			return NewError(CodePermissionDenied, "users cannot review their own access")
+		}
+		if !admin && (item.ReviewerID == nil || *item.ReviewerID != deciderID) {
+			return NewError(CodePermissionDenied, "only the assignment's reviewer may decide it")
+		}
+
+		item.Decision = AccessReviewApproved
+		if !approve {
+			item.Decision = AccessReviewRevoked
+		}
+		if err := tx.Model(&item).Updates(map[string]interface{}{
+			"decision":      item.Decision,
+			"decided_at":    now,
+			"decided_by_id": deciderID,
+			"note":          note,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to record access review decision: %w", err)
+		}
+		if !approve {
+			if err := tx.Exec("DELETE FROM user_roles WHERE user_id = ? AND role_id = ?", item.UserID, item.RoleID).Error; err != nil {
+				return fmt.Errorf("failed to revoke role assignment: %w", err)
+			}
+		}
+
+		var pending int64
+		if err := tx.Model(&database.AccessReviewItem{}).
+			Where("campaign_id = ? AND decision = ?", item.CampaignID, AccessReviewPending).
+			Count(&pending).Error; err != nil {
+			return fmt.Errorf("failed to count pending access reviews: %w", err)
+		}
+		if pending == 0 {
+			if err := tx.Model(&campaign).Updates(map[string]interface{}{"status": AccessReviewCompleted, "completed_at": now}).Error; err != nil {
+				return fmt.Errorf("failed to complete access review campaign: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !approve {
+		s.events.Publish(PermissionInvalidation{
+			Reason:  "access_review_revoked",
+			UserIDs: []uuid.UUID{item.UserID},
+			RoleIDs: []uuid.UUID{item.RoleID},
+		})
+	}
+	return s.GetItem(item.ID)
+}
+
+// GetReport reports a campaign's completion as of now, overall and by reviewer
+func (s *AccessReviewService) GetReport(id uuid.UUID, now time.Time) (*AccessReviewReport, error) {
+	campaign, err := s.GetCampaign(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		ReviewerID *uuid.UUID
+		Username   *string
+		Decision   string
+		Count      int64
+	}
+	if err := database.ReadReplica(s.db).Table("access_review_items ari").
+		Select("ari.reviewer_id, u.username, ari.decision, COUNT(*) AS count").
+		Joins("LEFT JOIN users u ON u.id = ari.reviewer_id").
+		Where("ari.campaign_id = ?", id).
+		Group("ari.reviewer_id, u.username, ari.decision").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to count access review decisions: %w", err)
+	}
+
+	report := &AccessReviewReport{
+		Campaign:    *campaign,
+		GeneratedAt: now,
+		Overdue:     campaign.Status == AccessReviewOpen && !now.Before(campaign.DueAt),
+		Reviewers:   []AccessReviewerProgress{},
+	}
+	reviewers := map[uuid.UUID]int{}
+	unassigned := -1
+	for _, row := range rows {
+		report.AccessReviewCounts.add(row.Decision, row.Count)
+
+		var i int
+		var ok bool
+		if row.ReviewerID == nil {
+			i, ok = unassigned, unassigned >= 0
+		} else {
+			i, ok = reviewers[*row.ReviewerID]
+		}
+		if !ok {
+			progress := AccessReviewerProgress{ReviewerID: row.ReviewerID}
+			if row.Username != nil {
+				progress.Username = *row.Username
+			}
+			report.Reviewers = append(report.Reviewers, progress)
+			i = len(report.Reviewers) - 1
+			if row.ReviewerID == nil {
+				unassigned = i
+			} else {
+				reviewers[*row.ReviewerID] = i
+			}
+		}
+		report.Reviewers[i].add(row.Decision, row.Count)
+	}
+	if report.Total > 0 {
+		report.PercentComplete = math.Round(float64(report.Total-report.Pending)/float64(report.Total)*1000) / 10
+	} else {
+		report.PercentComplete = 100
+	}
+
+	sort.SliceStable(report.Reviewers, func(i, j int) bool {
+		a, b := report.Reviewers[i], report.Reviewers[j]
+		if a.Pending != b.Pending {
+			return a.Pending > b.Pending
+		}
+		return a.Username < b.Username
+	})
+	return report, nil
+}
+
+// StartScheduler opens scheduled campaigns and expires due ones right away
+// and then periodically. It does nothing when access_reviews.check_interval
+// is zero.
+func (s *AccessReviewService) StartScheduler() {
+	interval := s.config.CheckInterval
+	if interval <= 0 || s.stop != nil {
+		return
+	}
+
+	s.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := s.RunSchedule(context.Background(), time.Now()); err != nil {
+				log.Printf("Access review scheduler failed: %v", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopScheduler stops the background access review scheduler
+func (s *AccessReviewService) StopScheduler() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// RunSchedule expires the open campaigns that are due, and opens a campaign
+// over every role when access_reviews.interval has passed since the last
+// scheduled one
+func (s *AccessReviewService) RunSchedule(ctx context.Context, now time.Time) error {
+	result := s.db.WithContext(ctx).Model(&database.AccessReviewCampaign{}).
+		Where("status = ? AND due_at <= ?", AccessReviewOpen, now).
+		Update("status", AccessReviewExpired)
+	if result.Error != nil {
+		return fmt.Errorf("failed to expire access review campaigns: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Access reviews: expired %d campaigns with undecided assignments", result.RowsAffected)
+	}
+
+	if s.config.Interval <= 0 {
+		return nil
+	}
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", accessReviewLockID).Error; err != nil {
+			return fmt.Errorf("failed to lock access reviews: %w", err)
+		}
+		var last *time.Time
+		if err := tx.Model(&database.AccessReviewCampaign{}).Where("created_by_id IS NULL").
+			Select("MAX(created_at)").Scan(&last).Error; err != nil {
+			return fmt.Errorf("failed to find the last scheduled access review: %w", err)
+		}
+		if last != nil && now.Sub(*last) < s.config.Interval {
+			return nil
+		}
+
+		name := "Scheduled access review " + now.UTC().Format("2006-01-02")
+		campaign, err := s.createCampaign(tx, name, s.config.Reviewer, nil, nil, nil, now)
+		if err != nil {
+			return err
+		}
+		log.Printf("Access reviews: opened %s (%s)", campaign.Name, campaign.ID)
+		return nil
+	})
+}
@@ -0,0 +1,269 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+	"gorm.io/gorm"
+)
+
+// Action approval statuses
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+	ApprovalExpired  = "expired"
+)
+
+// defaultCoSignWindow is how long a co-signer has when the action sets no window
+const defaultCoSignWindow = 10 * time.Minute
+
+// ActionCoSign makes performing an action wait for a second user. It is read
+// from the "co_sign" key of Action.Details, e.g.
+//
+//	"co_sign": {"permission": "production:approve", "window": "15m"}
+//
+// Performing the action creates a pending ActionApproval instead of running
+// it; a user other than the performer who holds permission approves it with
+// their own device within the window, and only then is the action logged and
+// its door, pipeline and side effects run.
+type ActionCoSign struct {
+	Permission string `json:"permission"`
+	Window     string `json:"window,omitempty"`
+}
+
+// WindowDuration returns how long approvals of the action stay pending
+func (c *ActionCoSign) WindowDuration() time.Duration {
+	if window, err := time.ParseDuration(c.Window); err == nil && window > 0 {
+		return window
+	}
+	return defaultCoSignWindow
+}
+
+// ActionApprovalRequested is published when a co-signed action is performed and
+// waits for approval, e.g. for webhooks that page the approvers
+type ActionApprovalRequested struct {
+	ApprovalID uuid.UUID `json:"approval_id"`
+	Action     string    `json:"action"`
+	UserID     uuid.UUID `json:"user_id"`
+	Username   string    `json:"username"`
+	Permission string    `json:"permission"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// ActionApprovalFilter narrows the approvals returned by ListApprovals
+type ActionApprovalFilter struct {
+	Status   string
+	ActionID *uuid.UUID
+	UserID   *uuid.UUID
+	Limit    int
+	Offset   int
+}
+
+// ParseActionCoSign reads and validates the co-sign settings in an action's
+// details. Returns nil if the action needs no co-signer.
+func ParseActionCoSign(action *database.Action) (*ActionCoSign, error) {
+	if action.Details.Status != pgtype.Present {
+		return nil, nil
+	}
+	var details map[string]json.RawMessage
+	if err := json.Unmarshal(action.Details.Bytes, &details); err != nil {
+		return nil, fmt.Errorf("failed to read action details: %w", err)
+	}
+	return parseActionCoSign(details["co_sign"])
+}
+
+// validateActionDetailsCoSign validates the co-sign settings in a details map before it is saved
+func validateActionDetailsCoSign(details map[string]interface{}) error {
+	raw, ok := details["co_sign"]
+	if !ok {
+		return nil
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("invalid co_sign: %w", err)
+	}
+	_, err = parseActionCoSign(data)
+	return err
+}
+
+func parseActionCoSign(data json.RawMessage) (*ActionCoSign, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+	var coSign ActionCoSign
+	if err := decoder.Decode(&coSign); err != nil {
+		return nil, fmt.Errorf("invalid co_sign: %w", err)
+	}
+	if err := validateSessionPermission(coSign.Permission); err != nil || coSign.Permission == "" {
+		return nil, fmt.Errorf("invalid co_sign: permission must be in 'resource:action' format")
+	}
+	if coSign.Window != "" {
+		window, err := time.ParseDuration(coSign.Window)
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf("invalid co_sign: window must be a positive duration such as 15m")
+		}
+	}
+	return &coSign, nil
+}
+
+// RequestApproval holds a checked performance of a co-signed action until it is
+// approved. details are the action log details worked out for the request.
+func (s *ActionService) RequestApproval(action *database.Action, coSign *ActionCoSign, user *database.User, deviceID uuid.UUID, requestBody, details map[string]interface{}, ipAddress, userAgent, requestID string, now time.Time) (*database.ActionApproval, error) {
+	if requestBody == nil {
+		requestBody = map[string]interface{}{}
+	}
+	var bodyJSONB, detailsJSONB pgtype.JSONB
+	if err := bodyJSONB.Set(requestBody); err != nil {
+		return nil, fmt.Errorf("failed to convert request body to JSONB: %w", err)
+	}
+	if err := detailsJSONB.Set(details); err != nil {
+		return nil, fmt.Errorf("failed to convert details to JSONB: %w", err)
+	}
+
+	approval := &database.ActionApproval{
+		ID:          uuid.New(),
+		ActionID:    action.ID,
+		UserID:      user.ID,
+		DeviceID:    deviceID,
+		RequestBody: bodyJSONB,
+		Details:     detailsJSONB,
+		IPAddress:   ipAddress,
+		UserAgent:   userAgent,
+		RequestID:   requestID,
+		Status:      ApprovalPending,
+		ExpiresAt:   now.Add(coSign.WindowDuration()),
+	}
+	if err := s.db.Create(approval).Error; err != nil {
+		return nil, fmt.Errorf("failed to create action approval: %w", err)
+	}
+
+	s.events.Publish(EventActionApprovalRequested, ActionApprovalRequested{
+		ApprovalID: approval.ID,
+		Action:     action.Name,
+		UserID:     user.ID,
+		Username:   user.Username,
+		Permission: coSign.Permission,
+		ExpiresAt:  approval.ExpiresAt,
+	})
+
+	return s.GetApprovalByID(approval.ID, now)
+}
+
+// GetApprovalByID retrieves an action approval by ID
+func (s *ActionService) GetApprovalByID(id uuid.UUID, now time.Time) (*database.ActionApproval, error) {
+	if err := s.expireApprovals(now); err != nil {
+		return nil, err
+	}
+	var approval database.ActionApproval
+	if err := s.db.Preload("Action").Preload("User").Preload("Approver").Where("id = ?", id).First(&approval).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "action approval not found")
+		}
+		return nil, fmt.Errorf("failed to get action approval: %w", err)
+	}
+	return &approval, nil
+}
+
+// ListApprovals retrieves action approvals, newest first, with the total matching the filter
+func (s *ActionService) ListApprovals(filter ActionApprovalFilter, now time.Time) ([]database.ActionApproval, int64, error) {
+	if err := s.expireApprovals(now); err != nil {
+		return nil, 0, err
+	}
+
+	query := s.db.Model(&database.ActionApproval{})
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.ActionID != nil {
+		query = query.Where("action_id = ?", *filter.ActionID)
+	}
+	if filter.UserID != nil {
+		query = query.Where("user_id = ?", *filter.UserID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count action approvals: %w", err)
+	}
+
+	var approvals []database.ActionApproval
+	if err := query.Preload("Action").Preload("User").Preload("Approver").
+		Order("created_at DESC").Limit(filter.Limit).Offset(filter.Offset).
+		Find(&approvals).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch action approvals: %w", err)
+	}
+	return approvals, total, nil
+}
+
+// DecideApproval approves or rejects a pending approval on behalf of a
+// co-signer. The caller checks the co-signer holds the action's co-sign
+// permission; performers cannot decide their own approvals.
+func (s *ActionService) DecideApproval(id uuid.UUID, approver *database.User, approverDeviceID uuid.UUID, approve bool, note string, now time.Time) (*database.ActionApproval, error) {
+	approval, err := s.GetApprovalByID(id, now)
+	if err != nil {
+		return nil, err
+	}
+	if approval.UserID == approver.ID {
+		return nil, NewError(CodePermissionDenied, "an action cannot be co-signed by the user who performed it")
+	}
+	if approval.Status != ApprovalPending {
+		return nil, NewError(CodeConflict, "action approval is already %s", approval.Status)
+	}
+
+	status := ApprovalRejected
+	if approve {
+		status = ApprovalApproved
+	}
+
+	// Only one co-signer can decide, however many try at once
+	result := s.db.Model(&database.ActionApproval{}).
+		Where("id = ? AND status = ? AND expires_at > ?", id, ApprovalPending, now).
+		Updates(map[string]interface{}{
+			"status":             status,
+			"approver_id":        approver.ID,
+			"approver_device_id": approverDeviceID,
+			"decided_at":         now,
+			"note":               note,
+		})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to update action approval: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, NewError(CodeConflict, "action approval is no longer pending")
+	}
+
+	return s.GetApprovalByID(id, now)
+}
+
+// ApprovalRequest returns the request body and log details an approval was created with
+func ApprovalRequest(approval *database.ActionApproval) (map[string]interface{}, map[string]interface{}) {
+	requestBody := map[string]interface{}{}
+	details := map[string]interface{}{}
+	if approval.RequestBody.Status == pgtype.Present {
+		_ = json.Unmarshal(approval.RequestBody.Bytes, &requestBody)
+	}
+	if approval.Details.Status == pgtype.Present {
+		_ = json.Unmarshal(approval.Details.Bytes, &details)
+	}
+	return requestBody, details
+}
+
+// expireApprovals marks pending approvals whose window has passed as expired
+func (s *ActionService) expireApprovals(now time.Time) error {
+	if err := s.db.Model(&database.ActionApproval{}).
+		Where("status = ? AND expires_at <= ?", ApprovalPending, now).
+		Update("status", ApprovalExpired).Error; err != nil {
+		return fmt.Errorf("failed to expire action approvals: %w", err)
+	}
+	return nil
+}
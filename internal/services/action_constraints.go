@@ -0,0 +1,273 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+	"gorm.io/gorm"
+)
+
+// ActionConstraints restricts when and how often an action may be performed.
+// It is read from the "constraints" key of Action.Details, e.g.
+//
+//	"constraints": {
+//	  "allowed_days": ["mon", "tue", "wed", "thu", "fri"],
+//	  "allowed_hours": {"from": "06:00", "to": "22:00"},
+//	  "timezone": "Europe/London",
+//	  "max_per_day": 1,
+//	  "requires_preceding_action": "user-signin",
+//	  "preceding_action_cleared_by": ["user-signout"]
+//	}
+type ActionConstraints struct {
+	AllowedDays              []string            `json:"allowed_days,omitempty"`
+	AllowedHours             *ActionAllowedHours `json:"allowed_hours,omitempty"`
+	Timezone                 string              `json:"timezone,omitempty"`
+	MaxPerDay                int                 `json:"max_per_day,omitempty"`
+	RequiresPrecedingAction  string              `json:"requires_preceding_action,omitempty"`
+	PrecedingActionClearedBy []string            `json:"preceding_action_cleared_by,omitempty"`
+}
+
+// ActionAllowedHours is a daily HH:MM window. A window whose end is before its start spans midnight.
+type ActionAllowedHours struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// ActionConstraintError is returned when an action is performed outside its constraints
+type ActionConstraintError struct {
+	Message string
+}
+
+func (e *ActionConstraintError) Error() string {
+	return e.Message
+}
+
+// ParseActionConstraints reads and validates the constraints in an action's details.
+// Returns nil if the action declares none.
+func ParseActionConstraints(action *database.Action) (*ActionConstraints, error) {
+	if action.Details.Status != pgtype.Present {
+		return nil, nil
+	}
+	var details map[string]json.RawMessage
+	if err := json.Unmarshal(action.Details.Bytes, &details); err != nil {
+		return nil, fmt.Errorf("failed to read action details: %w", err)
+	}
+	return parseActionConstraints(details["constraints"])
+}
+
+// validateActionDetailsConstraints validates the constraints in a details map before it is saved
+func validateActionDetailsConstraints(details map[string]interface{}) error {
+	raw, ok := details["constraints"]
+	if !ok {
+		return nil
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("invalid constraints: %w", err)
+	}
+	_, err = parseActionConstraints(data)
+	return err
+}
+
+func parseActionConstraints(data json.RawMessage) (*ActionConstraints, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+	var constraints ActionConstraints
+	if err := decoder.Decode(&constraints); err != nil {
+		return nil, fmt.Errorf("invalid constraints: %w", err)
+	}
+	if err := constraints.validate(); err != nil {
+		return nil, err
+	}
+	return &constraints, nil
+}
+
+func (c *ActionConstraints) validate() error {
+	if len(c.AllowedDays) > 0 {
+		if _, err := parseWorkDays(strings.Join(c.AllowedDays, ",")); err != nil {
+			return fmt.Errorf("invalid constraints: allowed_days: %w", err)
+		}
+	}
+	if c.AllowedHours != nil {
+		if _, err := parseClockMinutes(c.AllowedHours.From); err != nil {
+			return fmt.Errorf("invalid constraints: allowed_hours.from: %w", err)
+		}
+		if _, err := parseClockMinutes(c.AllowedHours.To); err != nil {
+			return fmt.Errorf("invalid constraints: allowed_hours.to: %w", err)
+		}
+		if c.AllowedHours.From == c.AllowedHours.To {
+			return fmt.Errorf("invalid constraints: allowed_hours.from and allowed_hours.to must differ")
+		}
+	}
+	if c.Timezone != "" {
+		if _, err := time.LoadLocation(c.Timezone); err != nil {
+			return fmt.Errorf("invalid constraints: unknown timezone '%s'", c.Timezone)
+		}
+	}
+	if c.MaxPerDay < 0 {
+		return fmt.Errorf("invalid constraints: max_per_day must not be negative")
+	}
+	if len(c.PrecedingActionClearedBy) > 0 && c.RequiresPrecedingAction == "" {
+		return fmt.Errorf("invalid constraints: preceding_action_cleared_by requires requires_preceding_action")
+	}
+	return nil
+}
+
+// location returns the timezone constraints are evaluated in
+func (c *ActionConstraints) location() *time.Location {
+	if c.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// CheckSchedule checks the allowed days and hours against now
+func (c *ActionConstraints) CheckSchedule(now time.Time) error {
+	local := now.In(c.location())
+
+	if len(c.AllowedDays) > 0 {
+		days, _ := parseWorkDays(strings.Join(c.AllowedDays, ","))
+		if !days[local.Weekday()] {
+			return &ActionConstraintError{Message: fmt.Sprintf("action is only allowed on %s", strings.Join(c.AllowedDays, ", "))}
+		}
+	}
+
+	if c.AllowedHours != nil {
+		from, _ := parseClockMinutes(c.AllowedHours.From)
+		to, _ := parseClockMinutes(c.AllowedHours.To)
+		minute := local.Hour()*60 + local.Minute()
+		var allowed bool
+		if from < to {
+			allowed = minute >= from && minute < to
+		} else {
+			allowed = minute >= from || minute < to
+		}
+		if !allowed {
+			return &ActionConstraintError{Message: fmt.Sprintf("action is only allowed between %s and %s (%s)", c.AllowedHours.From, c.AllowedHours.To, c.location())}
+		}
+	}
+
+	return nil
+}
+
+// CheckActionConstraints enforces an action's constraints for a user at now.
+// Violations are returned as *ActionConstraintError.
+func (s *ActionService) CheckActionConstraints(userID uuid.UUID, action *database.Action, now time.Time) error {
+	constraints, err := ParseActionConstraints(action)
+	if err != nil {
+		return err
+	}
+	if constraints == nil {
+		return nil
+	}
+
+	if err := constraints.CheckSchedule(now); err != nil {
+		return err
+	}
+
+	dayStart := constraints.dayStart(now)
+
+	if constraints.MaxPerDay > 0 {
+		var count int64
+		if err := s.actionLogs(userID, dayStart).Where("action_id = ?", action.ID).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to count action executions: %w", err)
+		}
+		if err := constraints.checkFrequency(action.Name, count); err != nil {
+			return err
+		}
+	}
+
+	if constraints.RequiresPrecedingAction != "" {
+		preceding, err := s.lastActionAt(userID, dayStart, []string{constraints.RequiresPrecedingAction})
+		if err != nil {
+			return err
+		}
+		var cleared *time.Time
+		if preceding != nil && len(constraints.PrecedingActionClearedBy) > 0 {
+			if cleared, err = s.lastActionAt(userID, dayStart, constraints.PrecedingActionClearedBy); err != nil {
+				return err
+			}
+		}
+		if err := constraints.checkPreceding(action.Name, preceding, cleared); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dayStart returns the start of now's day in the constraints' timezone, which
+// executions are counted from
+func (c *ActionConstraints) dayStart(now time.Time) time.Time {
+	local := now.In(c.location())
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+}
+
+// checkFrequency checks the executions of the action so far today against max_per_day
+func (c *ActionConstraints) checkFrequency(actionName string, count int64) error {
+	if c.MaxPerDay > 0 && count >= int64(c.MaxPerDay) {
+		return &ActionConstraintError{Message: fmt.Sprintf("action '%s' may only be performed %d time(s) per day", actionName, c.MaxPerDay)}
+	}
+	return nil
+}
+
+// checkPreceding checks when the required preceding action was last performed
+// today, and when an action clearing it last was, against the constraints
+func (c *ActionConstraints) checkPreceding(actionName string, preceding, cleared *time.Time) error {
+	if c.RequiresPrecedingAction == "" {
+		return nil
+	}
+	if preceding == nil {
+		return &ActionConstraintError{Message: fmt.Sprintf("action '%s' requires '%s' to be performed first", actionName, c.RequiresPrecedingAction)}
+	}
+	if cleared != nil && cleared.After(*preceding) {
+		return &ActionConstraintError{Message: fmt.Sprintf("action '%s' requires '%s' to be performed again first", actionName, c.RequiresPrecedingAction)}
+	}
+	return nil
+}
+
+// actionLogs scopes successful action log entries for a user since a point in time
+func (s *ActionService) actionLogs(userID uuid.UUID, since time.Time) *gorm.DB {
+	return s.db.Model(&database.AuthenticationLog{}).
+		Where("user_id = ? AND type = ? AND success = ? AND created_at >= ?", userID, "action", true, since)
+}
+
+// lastActionAt returns when the user last performed any of the named actions since a point in time
+func (s *ActionService) lastActionAt(userID uuid.UUID, since time.Time, actionNames []string) (*time.Time, error) {
+	var entry database.AuthenticationLog
+	err := s.actionLogs(userID, since).
+		Joins("JOIN actions ON actions.id = authentication_logs.action_id").
+		Where("actions.name IN ?", actionNames).
+		Order("authentication_logs.created_at DESC").
+		Limit(1).
+		Find(&entry).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up preceding actions: %w", err)
+	}
+	if entry.ID == uuid.Nil {
+		return nil, nil
+	}
+	return &entry.CreatedAt, nil
+}
+
+// parseClockMinutes parses an HH:MM time of day into minutes after midnight
+func parseClockMinutes(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("must be in HH:MM format")
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
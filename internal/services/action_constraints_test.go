@@ -0,0 +1,160 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseActionConstraints(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		wantErr string
+	}{
+		{name: "none", json: ``},
+		{name: "null", json: `null`},
+		{name: "valid", json: `{"allowed_days":["mon","fri"],"allowed_hours":{"from":"06:00","to":"22:00"},"timezone":"Europe/London","max_per_day":1,"requires_preceding_action":"user-signin","preceding_action_cleared_by":["user-signout"]}`},
+		{name: "overnight window", json: `{"allowed_hours":{"from":"22:00","to":"06:00"}}`},
+		{name: "unknown field", json: `{"max_per_week":1}`, wantErr: "unknown field"},
+		{name: "unknown day", json: `{"allowed_days":["monday"]}`, wantErr: "allowed_days"},
+		{name: "bad from", json: `{"allowed_hours":{"from":"6am","to":"22:00"}}`, wantErr: "allowed_hours.from"},
+		{name: "bad to", json: `{"allowed_hours":{"from":"06:00","to":"24:00"}}`, wantErr: "allowed_hours.to"},
+		{name: "empty window", json: `{"allowed_hours":{"from":"06:00","to":"06:00"}}`, wantErr: "must differ"},
+		{name: "unknown timezone", json: `{"timezone":"Mars/Olympus"}`, wantErr: "unknown timezone"},
+		{name: "negative max", json: `{"max_per_day":-1}`, wantErr: "must not be negative"},
+		{name: "cleared without preceding", json: `{"preceding_action_cleared_by":["user-signout"]}`, wantErr: "requires requires_preceding_action"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseActionConstraints([]byte(tt.json))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestActionConstraintsCheckSchedule(t *testing.T) {
+	weekdays := []string{"mon", "tue", "wed", "thu", "fri"}
+	daytime := &ActionAllowedHours{From: "06:00", To: "22:00"}
+	overnight := &ActionAllowedHours{From: "22:00", To: "06:00"}
+
+	tests := []struct {
+		name        string
+		constraints ActionConstraints
+		now         time.Time
+		allowed     bool
+	}{
+		{name: "no constraints", now: time.Date(2024, 3, 9, 3, 0, 0, 0, time.UTC), allowed: true},
+		{name: "weekday", constraints: ActionConstraints{AllowedDays: weekdays}, now: time.Date(2024, 3, 8, 12, 0, 0, 0, time.UTC), allowed: true},
+		{name: "weekend", constraints: ActionConstraints{AllowedDays: weekdays}, now: time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC), allowed: false},
+		{name: "at window start", constraints: ActionConstraints{AllowedHours: daytime}, now: time.Date(2024, 3, 8, 6, 0, 0, 0, time.UTC), allowed: true},
+		{name: "before window", constraints: ActionConstraints{AllowedHours: daytime}, now: time.Date(2024, 3, 8, 5, 59, 0, 0, time.UTC), allowed: false},
+		{name: "last minute of window", constraints: ActionConstraints{AllowedHours: daytime}, now: time.Date(2024, 3, 8, 21, 59, 59, 0, time.UTC), allowed: true},
+		{name: "at window end", constraints: ActionConstraints{AllowedHours: daytime}, now: time.Date(2024, 3, 8, 22, 0, 0, 0, time.UTC), allowed: false},
+		{name: "overnight at 22:00", constraints: ActionConstraints{AllowedHours: overnight}, now: time.Date(2024, 3, 8, 22, 0, 0, 0, time.UTC), allowed: true},
+		{name: "overnight after midnight", constraints: ActionConstraints{AllowedHours: overnight}, now: time.Date(2024, 3, 9, 5, 59, 0, 0, time.UTC), allowed: true},
+		{name: "overnight at 06:00", constraints: ActionConstraints{AllowedHours: overnight}, now: time.Date(2024, 3, 9, 6, 0, 0, 0, time.UTC), allowed: false},
+		{name: "overnight midday", constraints: ActionConstraints{AllowedHours: overnight}, now: time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC), allowed: false},
+		// 21:30 UTC is 22:30 in London in summer, and 21:30 in winter
+		{name: "timezone summer", constraints: ActionConstraints{AllowedHours: daytime, Timezone: "Europe/London"}, now: time.Date(2024, 7, 1, 21, 30, 0, 0, time.UTC), allowed: false},
+		{name: "timezone winter", constraints: ActionConstraints{AllowedHours: daytime, Timezone: "Europe/London"}, now: time.Date(2024, 1, 8, 21, 30, 0, 0, time.UTC), allowed: true},
+		// Friday 23:00 UTC is Saturday in Tokyo
+		{name: "day in timezone", constraints: ActionConstraints{AllowedDays: weekdays, Timezone: "Asia/Tokyo"}, now: time.Date(2024, 3, 8, 23, 0, 0, 0, time.UTC), allowed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.constraints.CheckSchedule(tt.now)
+			if tt.allowed {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var constraintErr *ActionConstraintError
+			if !errors.As(err, &constraintErr) {
+				t.Fatalf("got %v, want an ActionConstraintError", err)
+			}
+		})
+	}
+}
+
+func TestActionConstraintsDayStart(t *testing.T) {
+	constraints := ActionConstraints{Timezone: "America/New_York"}
+	// 02:00 UTC on 9 March is still 8 March in New York
+	got := constraints.dayStart(time.Date(2024, 3, 9, 2, 0, 0, 0, time.UTC))
+	want := time.Date(2024, 3, 8, 5, 0, 0, 0, time.UTC)
+	if !got.Equal(want) {
+		t.Fatalf("got %v, want %v", got.UTC(), want)
+	}
+}
+
+func TestActionConstraintsCheckFrequency(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxPerDay int
+		count     int64
+		allowed   bool
+	}{
+		{name: "unlimited", maxPerDay: 0, count: 100, allowed: true},
+		{name: "first", maxPerDay: 1, count: 0, allowed: true},
+		{name: "limit reached", maxPerDay: 1, count: 1, allowed: false},
+		{name: "below limit", maxPerDay: 3, count: 2, allowed: true},
+		{name: "over limit", maxPerDay: 3, count: 4, allowed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			constraints := ActionConstraints{MaxPerDay: tt.maxPerDay}
+			err := constraints.checkFrequency("lunch-break", tt.count)
+			if (err == nil) != tt.allowed {
+				t.Fatalf("got %v, want allowed=%v", err, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestActionConstraintsCheckPreceding(t *testing.T) {
+	signIn := time.Date(2024, 3, 8, 9, 0, 0, 0, time.UTC)
+	before := signIn.Add(-time.Hour)
+	after := signIn.Add(time.Hour)
+
+	tests := []struct {
+		name        string
+		constraints ActionConstraints
+		preceding   *time.Time
+		cleared     *time.Time
+		wantErr     string
+	}{
+		{name: "not required", constraints: ActionConstraints{}},
+		{name: "missing", constraints: ActionConstraints{RequiresPrecedingAction: "user-signin"}, wantErr: "to be performed first"},
+		{name: "performed", constraints: ActionConstraints{RequiresPrecedingAction: "user-signin"}, preceding: &signIn},
+		{name: "cleared before", constraints: ActionConstraints{RequiresPrecedingAction: "user-signin", PrecedingActionClearedBy: []string{"user-signout"}}, preceding: &signIn, cleared: &before},
+		{name: "cleared after", constraints: ActionConstraints{RequiresPrecedingAction: "user-signin", PrecedingActionClearedBy: []string{"user-signout"}}, preceding: &signIn, cleared: &after, wantErr: "to be performed again first"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.constraints.checkPreceding("lunch-break", tt.preceding, tt.cleared)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+	"gorm.io/gorm"
+)
+
+// ActionExecution is a checked action ready to run, straight away or once co-signed
+type ActionExecution struct {
+	User        *database.User
+	DeviceID    uuid.UUID
+	Action      *database.Action
+	RequestBody map[string]interface{}
+	Details     map[string]interface{} // Log details worked out when the action was performed; Execute adds its results
+	IPAddress   string
+	UserAgent   string
+	RequestID   string
+}
+
+// ActionExecutionResult is what running an action did
+type ActionExecutionResult struct {
+	LogID       uuid.UUID   // The action's authentication log entry
+	Door        *DoorUnlock // The unlock, for door actions
+	Pipeline    *PipelineResult
+	SideEffects []SideEffectResult
+}
+
+// DoorUnlock is the door a door action unlocked and how it went
+type DoorUnlock struct {
+	Door          string    `json:"door"`
+	DoorEventID   uuid.UUID `json:"door_event_id"`
+	Result        string    `json:"result" enum:"unlocked,failed"`
+	ControllerRef string    `json:"controller_ref"`
+}
+
+// ActionExecutionService runs checked actions. Door unlocks and side effects
+// reach outside the database, so they run first; the action log entry and
+// everything the pipeline writes then commit in one transaction. When that
+// transaction fails, the side effects that ran are compensated and the action
+// is logged as failed, so the door event and side effects stay accounted for.
+// Leave actions take their days off the user's balance in the same transaction.
+type ActionExecutionService struct {
+	db        *gorm.DB
+	actions   *ActionService
+	doors     *DoorService
+	leave     *LeaveService
+	clockSkew time.Duration
+}
+
+// NewActionExecutionService creates the service. clockSkew is how far client
+// reported times may be from the server clock (see CheckClientTimes).
+func NewActionExecutionService(db *gorm.DB, actions *ActionService, doors *DoorService, leave *LeaveService, clockSkew time.Duration) *ActionExecutionService {
+	return &ActionExecutionService{db: db, actions: actions, doors: doors, leave: leave, clockSkew: clockSkew}
+}
+
+// ClockSkew returns how far client reported times may be from the server clock
+func (s *ActionExecutionService) ClockSkew() time.Duration {
+	return s.clockSkew
+}
+
+// ClientTimes checks the times a client reported in an action request against
+// the server clock
+func (s *ActionExecutionService) ClientTimes(body map[string]interface{}) (map[string]ClientTime, error) {
+	return CheckClientTimes(body, time.Now(), s.clockSkew)
+}
+
+// CheckLeave checks the user's balance covers the leave an action takes (see
+// LeaveService.CheckLeave)
+func (s *ActionExecutionService) CheckLeave(user *database.User, action *database.Action, body map[string]interface{}) (*LeaveCheck, error) {
+	return s.leave.CheckLeave(user, action, body, time.Now())
+}
+
+// Execute unlocks the action's door, runs its side effects and pipeline, logs
+// it and announces it as performed. A failed door unlock is logged as a failed
+// action and returned as an UPSTREAM_FAILED error with the result's Door set.
+func (s *ActionExecutionService) Execute(exec ActionExecution) (*ActionExecutionResult, error) {
+	user, action, details := exec.User, exec.Action, exec.Details
+	result := &ActionExecutionResult{LogID: uuid.New()}
+
+	// A pipeline that cannot be read would fail only after the door and side
+	// effects ran, so check it first
+	if _, err := ParseActionPipeline(action); err != nil {
+		return nil, WrapError(CodeInternal, "error running action pipeline", err)
+	}
+
+	// Door actions unlock their door before anything else runs; a failed unlock
+	// stops the action
+	if action.ActivityType == "door" {
+		door, err := s.doors.GetDoorByName(DoorForAction(action))
+		if err != nil {
+			return nil, WrapError(CodeInternal, fmt.Sprintf("action '%s' is misconfigured", action.Name), err)
+		}
+		event, unlockErr := s.doors.UnlockDoor(door, &user.ID, &action.ID, &result.LogID)
+		if event == nil {
+			return nil, WrapError(CodeInternal, "error unlocking door", unlockErr)
+		}
+		result.Door = &DoorUnlock{
+			Door:          door.Name,
+			DoorEventID:   event.ID,
+			Result:        event.Result,
+			ControllerRef: event.ControllerRef,
+		}
+		if unlockErr != nil {
+			failedDetails := map[string]interface{}{"action": action.Name, "door": result.Door}
+			if approval, ok := details["approval"]; ok {
+				failedDetails["approval"] = approval
+			}
+			s.logFailure(exec, result.LogID, failedDetails)
+			return result, WrapError(CodeUpstreamFailed, fmt.Sprintf("failed to unlock door '%s'", door.Name), unlockErr)
+		}
+		details["door"] = result.Door
+	}
+
+	performed := SideEffectEvent{
+		Action:     action.Name,
+		UserID:     user.ID,
+		Username:   user.Username,
+		DeviceID:   exec.DeviceID,
+		OccurredAt: time.Now(),
+		Details:    exec.RequestBody,
+	}
+	sideEffects, err := s.actions.RunSideEffects(action, performed)
+	if err != nil {
+		return nil, WrapError(CodeInternal, "error running action side effects", err)
+	}
+	result.SideEffects = sideEffects
+	if len(sideEffects) > 0 {
+		details["side_effects"] = sideEffects
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		pipeline, err := s.actions.ExecutePipeline(tx, user, action, PipelineContext{
+			DeviceID:  exec.DeviceID,
+			IPAddress: exec.IPAddress,
+			UserAgent: exec.UserAgent,
+		})
+		if err != nil {
+			return WrapError(CodeInternal, "error running action pipeline", err)
+		}
+		result.Pipeline = pipeline
+		if pipeline != nil {
+			details["pipeline"] = pipeline
+		}
+
+		if err := s.leave.recordTaken(tx, exec, result.LogID, time.Now()); err != nil {
+			return err
+		}
+
+		entry, err := actionLogEntry(exec, result.LogID, true, details)
+		if err != nil {
+			return err
+		}
+		return tx.Create(entry).Error
+	})
+	if err != nil {
+		s.actions.CompensateSideEffects(action, performed, sideEffects)
+		failedDetails := map[string]interface{}{"action": action.Name, "error": err.Error()}
+		for _, key := range []string{"door", "side_effects", "approval"} {
+			if value, ok := details[key]; ok {
+				failedDetails[key] = value
+			}
+		}
+		s.logFailure(exec, result.LogID, failedDetails)
+		// Leave the balance no longer covers keeps its CONFLICT code
+		return nil, WithCode(CodeInternal, fmt.Errorf("failed to record action: %w", err))
+	}
+
+	// Announce only what committed
+	if result.Pipeline != nil {
+		for _, event := range result.Pipeline.performed {
+			s.actions.PublishActionPerformed(event)
+		}
+	}
+	s.actions.PublishActionPerformed(performed)
+	return result, nil
+}
+
+// logFailure records the action as failed under logID, which door events link to.
+// It is best effort: the failure being reported matters more.
+func (s *ActionExecutionService) logFailure(exec ActionExecution, logID uuid.UUID, details map[string]interface{}) {
+	entry, err := actionLogEntry(exec, logID, false, details)
+	if err == nil {
+		s.db.Create(entry)
+	}
+}
+
+// actionLogEntry builds the authentication log entry of an action
+func actionLogEntry(exec ActionExecution, logID uuid.UUID, success bool, details map[string]interface{}) (*database.AuthenticationLog, error) {
+	var detailsJSONB pgtype.JSONB
+	if err := detailsJSONB.Set(details); err != nil {
+		return nil, fmt.Errorf("failed to convert details to JSONB: %w", err)
+	}
+	return &database.AuthenticationLog{
+		ID:        logID,
+		UserID:    &exec.User.ID,
+		DeviceID:  exec.DeviceID,
+		ActionID:  &exec.Action.ID,
+		Type:      "action",
+		Success:   success,
+		IPAddress: exec.IPAddress,
+		UserAgent: exec.UserAgent,
+		Timestamp: time.Now(),
+		Details:   detailsJSONB,
+		RequestID: exec.RequestID,
+	}, nil
+}
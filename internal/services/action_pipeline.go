@@ -0,0 +1,261 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+	"gorm.io/gorm"
+)
+
+// Pipeline step types
+const (
+	PipelineStepCloseActivity = "close_activity"
+	PipelineStepAction        = "action"
+	PipelineStepWebhook       = "webhook"
+)
+
+// Pipeline result statuses
+const (
+	PipelineCompleted = "completed"
+	PipelinePartial   = "partial"
+	PipelineFailed    = "failed"
+)
+
+// PipelineSteps lists the supported pipeline step types
+var PipelineSteps = []string{PipelineStepCloseActivity, PipelineStepAction, PipelineStepWebhook}
+
+// PipelineStep is one step of a composite action, read from the "pipeline" key of Action.Details, e.g.
+//
+//	"pipeline": [
+//	  {"type": "close_activity"},
+//	  {"type": "action", "action": "user-signout"},
+//	  {"type": "webhook", "url": "https://hooks.example.com/eod", "continue_on_error": true}
+//	]
+//
+// Steps run in order. A failing step stops the pipeline unless it sets
+// continue_on_error; steps that already ran are not rolled back, though the
+// whole pipeline's writes roll back with the action if it cannot be recorded.
+type PipelineStep struct {
+	Type            string `json:"type"`
+	Action          string `json:"action,omitempty"`
+	URL             string `json:"url,omitempty"`
+	Secret          string `json:"secret,omitempty"`
+	ContinueOnError bool   `json:"continue_on_error,omitempty"`
+}
+
+// PipelineStepResult records the outcome of a single pipeline step
+type PipelineStepResult struct {
+	Step       int    `json:"step"`
+	Type       string `json:"type"`
+	Success    bool   `json:"success"`
+	Skipped    bool   `json:"skipped,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// PipelineResult records the outcome of a pipeline run. Status is "completed" when
+// every step succeeded, "failed" when none did, and "partial" otherwise.
+type PipelineResult struct {
+	Status string               `json:"status"`
+	Steps  []PipelineStepResult `json:"steps"`
+
+	// performed are the sub-actions the pipeline logged, announced once the
+	// caller's transaction commits
+	performed []SideEffectEvent
+}
+
+// PipelineContext carries request details recorded on logs written by pipeline steps
+type PipelineContext struct {
+	DeviceID  uuid.UUID
+	IPAddress string
+	UserAgent string
+}
+
+// ParseActionPipeline reads and validates the pipeline in an action's details.
+// Returns nil if the action declares none.
+func ParseActionPipeline(action *database.Action) ([]PipelineStep, error) {
+	if action.Details.Status != pgtype.Present {
+		return nil, nil
+	}
+	var details map[string]json.RawMessage
+	if err := json.Unmarshal(action.Details.Bytes, &details); err != nil {
+		return nil, fmt.Errorf("failed to read action details: %w", err)
+	}
+	return parseActionPipeline(action.Name, details["pipeline"])
+}
+
+// validateActionDetailsPipeline validates the pipeline in a details map before it is saved
+func validateActionDetailsPipeline(name string, details map[string]interface{}) error {
+	raw, ok := details["pipeline"]
+	if !ok {
+		return nil
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("invalid pipeline: %w", err)
+	}
+	_, err = parseActionPipeline(name, data)
+	return err
+}
+
+func parseActionPipeline(actionName string, data json.RawMessage) ([]PipelineStep, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+	var steps []PipelineStep
+	if err := decoder.Decode(&steps); err != nil {
+		return nil, fmt.Errorf("invalid pipeline: %w", err)
+	}
+
+	for i, step := range steps {
+		switch step.Type {
+		case PipelineStepCloseActivity:
+		case PipelineStepAction:
+			if step.Action == "" {
+				return nil, fmt.Errorf("invalid pipeline: step %d: action is required", i+1)
+			}
+			if step.Action == actionName {
+				return nil, fmt.Errorf("invalid pipeline: step %d: an action cannot trigger itself", i+1)
+			}
+		case PipelineStepWebhook:
+			if err := validateWebhookURL(step.URL); err != nil {
+				return nil, fmt.Errorf("invalid pipeline: step %d: %w", i+1, err)
+			}
+		default:
+			return nil, fmt.Errorf("invalid pipeline: step %d: unknown type '%s'. Must be one of: %v", i+1, step.Type, PipelineSteps)
+		}
+	}
+	return steps, nil
+}
+
+// ExecutePipeline runs the steps of a composite action for a user. Steps write
+// through tx, each in its own savepoint so a failed step does not abort the
+// transaction. It only returns an error if the pipeline definition cannot be
+// read; step failures are reported in the result.
+func (s *ActionService) ExecutePipeline(tx *gorm.DB, user *database.User, action *database.Action, ctx PipelineContext) (*PipelineResult, error) {
+	steps, err := ParseActionPipeline(action)
+	if err != nil {
+		return nil, err
+	}
+	if len(steps) == 0 {
+		return nil, nil
+	}
+
+	result := &PipelineResult{Steps: make([]PipelineStepResult, 0, len(steps))}
+	succeeded, failed, stopped := 0, 0, false
+	for i, step := range steps {
+		stepResult := PipelineStepResult{Step: i + 1, Type: step.Type}
+		if stopped {
+			stepResult.Skipped = true
+			result.Steps = append(result.Steps, stepResult)
+			continue
+		}
+
+		started := time.Now()
+		err := tx.Transaction(func(stepTx *gorm.DB) error {
+			return s.executePipelineStep(stepTx, user, action, step, ctx, result)
+		})
+		stepResult.DurationMs = time.Since(started).Milliseconds()
+		if err != nil {
+			stepResult.Error = err.Error()
+			failed++
+			stopped = !step.ContinueOnError
+		} else {
+			stepResult.Success = true
+			succeeded++
+		}
+		result.Steps = append(result.Steps, stepResult)
+	}
+
+	switch {
+	case failed == 0:
+		result.Status = PipelineCompleted
+	case succeeded == 0:
+		result.Status = PipelineFailed
+	default:
+		result.Status = PipelinePartial
+	}
+	return result, nil
+}
+
+func (s *ActionService) executePipelineStep(tx *gorm.DB, user *database.User, action *database.Action, step PipelineStep, ctx PipelineContext, result *PipelineResult) error {
+	switch step.Type {
+	case PipelineStepCloseActivity:
+		return closeOpenActivity(tx, user.ID, time.Now())
+	case PipelineStepAction:
+		return s.performSubAction(tx, user, action, step.Action, ctx, result)
+	case PipelineStepWebhook:
+		return s.notifications.SendSignedWebhook(step.URL, step.Secret, map[string]interface{}{
+			"action":      action.Name,
+			"user_id":     user.ID,
+			"username":    user.Username,
+			"occurred_at": time.Now(),
+		}, map[string]string{"X-YubiApp-Event": "action.pipeline"})
+	default:
+		return fmt.Errorf("unknown step type '%s'", step.Type)
+	}
+}
+
+// performSubAction checks the user may perform a sub-action and records it in the
+// authentication log as triggered by the parent action
+func (s *ActionService) performSubAction(tx *gorm.DB, user *database.User, parent *database.Action, name string, ctx PipelineContext, result *PipelineResult) error {
+	subAction, err := s.GetActionByName(name)
+	if err != nil {
+		return err
+	}
+	if !subAction.Active {
+		return fmt.Errorf("action '%s' is inactive", name)
+	}
+	hasPermission, err := s.CheckUserPermissionsForAction(user.ID, name)
+	if err != nil {
+		return fmt.Errorf("error checking permissions: %w", err)
+	}
+	if !hasPermission {
+		return fmt.Errorf("user does not have required permissions for action '%s'", name)
+	}
+	if err := s.CheckActionConstraints(user.ID, subAction, time.Now()); err != nil {
+		return err
+	}
+
+	var details pgtype.JSONB
+	if err := details.Set(map[string]interface{}{
+		"action":       name,
+		"triggered_by": parent.Name,
+	}); err != nil {
+		return fmt.Errorf("failed to convert details to JSONB: %w", err)
+	}
+
+	entry := database.AuthenticationLog{
+		ID:        uuid.New(),
+		UserID:    &user.ID,
+		DeviceID:  ctx.DeviceID,
+		ActionID:  &subAction.ID,
+		Type:      "action",
+		Success:   true,
+		IPAddress: ctx.IPAddress,
+		UserAgent: ctx.UserAgent,
+		Timestamp: time.Now(),
+		Details:   details,
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return fmt.Errorf("failed to log action '%s': %w", name, err)
+	}
+
+	result.performed = append(result.performed, SideEffectEvent{
+		Action:     name,
+		UserID:     user.ID,
+		Username:   user.Username,
+		DeviceID:   ctx.DeviceID,
+		OccurredAt: entry.Timestamp,
+		Details:    map[string]interface{}{"triggered_by": parent.Name},
+	})
+	return nil
+}
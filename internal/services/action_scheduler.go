@@ -0,0 +1,440 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+	"gorm.io/gorm"
+)
+
+// Action run triggers and statuses
+const (
+	RunTriggerSchedule = "schedule"
+	RunTriggerManual   = "manual"
+
+	RunRunning   = "running"
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+	RunSkipped   = "skipped"
+)
+
+// ActionSchedule runs an automated action on a cron schedule. It is read from
+// the "schedule" key of Action.Details, e.g.
+//
+//	"schedule": {"cron": "0 0 * * *", "timezone": "Europe/London",
+//	             "task": "close_open_activities", "config": {"status_types": ["working"]}}
+//
+// Each run performs the named system task, if any, then the action's side
+// effects. Only actions with activity type "automated" are scheduled.
+type ActionSchedule struct {
+	Cron     string                 `json:"cron"`
+	Timezone string                 `json:"timezone,omitempty"`
+	Task     string                 `json:"task,omitempty"`
+	Config   map[string]interface{} `json:"config,omitempty"`
+}
+
+// CronSchedule parses the schedule's cron expression in its timezone
+func (a *ActionSchedule) CronSchedule() (*CronSchedule, error) {
+	location := time.UTC
+	if a.Timezone != "" {
+		var err error
+		if location, err = time.LoadLocation(a.Timezone); err != nil {
+			return nil, fmt.Errorf("unknown timezone '%s'", a.Timezone)
+		}
+	}
+	return ParseCron(a.Cron, location)
+}
+
+// ScheduledAction is an automated action with its schedule and next due run
+type ScheduledAction struct {
+	Action   database.Action
+	Schedule ActionSchedule
+	NextRun  time.Time
+	LastRun  *database.ActionRun
+}
+
+// ActionRunFilter narrows the runs returned by ListRuns
+type ActionRunFilter struct {
+	ActionID *uuid.UUID
+	Status   string
+	Trigger  string
+	Limit    int
+	Offset   int
+}
+
+// ParseActionSchedule reads the schedule in an action's details. Returns nil
+// if the action has no schedule.
+func ParseActionSchedule(action *database.Action) (*ActionSchedule, error) {
+	if action.Details.Status != pgtype.Present {
+		return nil, nil
+	}
+	var details map[string]json.RawMessage
+	if err := json.Unmarshal(action.Details.Bytes, &details); err != nil {
+		return nil, fmt.Errorf("failed to read action details: %w", err)
+	}
+	return parseActionSchedule(details["schedule"])
+}
+
+func parseActionSchedule(data json.RawMessage) (*ActionSchedule, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var schedule ActionSchedule
+	if err := decoder.Decode(&schedule); err != nil {
+		return nil, fmt.Errorf("invalid schedule: %w", err)
+	}
+	if _, err := schedule.CronSchedule(); err != nil {
+		return nil, fmt.Errorf("invalid schedule: %w", err)
+	}
+	return &schedule, nil
+}
+
+// validateActionDetailsSchedule validates the schedule in a details map before it is saved
+func (s *ActionService) validateActionDetailsSchedule(activityType string, details map[string]interface{}) error {
+	raw, ok := details["schedule"]
+	if !ok {
+		return nil
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("invalid schedule: %w", err)
+	}
+	schedule, err := parseActionSchedule(data)
+	if err != nil || schedule == nil {
+		return err
+	}
+
+	if activityType != "automated" {
+		return fmt.Errorf("invalid schedule: only actions with activity type \"automated\" can be scheduled")
+	}
+	if schedule.Task == "" {
+		if _, hasSideEffects := details["side_effects"]; !hasSideEffects {
+			return fmt.Errorf("invalid schedule: a scheduled action needs a task or side_effects to run")
+		}
+		return nil
+	}
+	task, ok := s.systemTasks[schedule.Task]
+	if !ok {
+		return fmt.Errorf("invalid schedule: unknown task '%s'. Must be one of: %v", schedule.Task, s.SystemTasks())
+	}
+	if err := task.Validate(schedule.Config); err != nil {
+		return fmt.Errorf("invalid schedule: %w", err)
+	}
+	return nil
+}
+
+// ActionSchedulerService runs automated actions on their cron schedules and
+// keeps their run history. Runs of one action never overlap, and a scheduled
+// time is run once however many servers check the schedules.
+type ActionSchedulerService struct {
+	db      *gorm.DB
+	config  *config.Config
+	actions *ActionService
+
+	stop      chan struct{}
+	mu        sync.Mutex
+	lastCheck time.Time
+	runs      sync.WaitGroup
+}
+
+// NewActionSchedulerService creates a new ActionSchedulerService
+func NewActionSchedulerService(db *gorm.DB, cfg *config.Config, actions *ActionService) *ActionSchedulerService {
+	return &ActionSchedulerService{db: db, config: cfg, actions: actions}
+}
+
+// StartScheduler checks the schedules every scheduler.check_interval. It does
+// nothing when the interval is zero.
+func (s *ActionSchedulerService) StartScheduler() {
+	interval := s.config.Scheduler.CheckInterval
+	if interval <= 0 || s.stop != nil {
+		return
+	}
+
+	s.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		s.RunDue(time.Now())
+		for {
+			select {
+			case <-ticker.C:
+				s.RunDue(time.Now())
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopScheduler stops checking the schedules and waits for runs in progress
+func (s *ActionSchedulerService) StopScheduler() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+	s.runs.Wait()
+}
+
+// RunDue starts the runs that fell due since the previous check. Schedule
+// times missed while no server was checking are not caught up; the first
+// check only records the time.
+func (s *ActionSchedulerService) RunDue(now time.Time) {
+	s.mu.Lock()
+	since := s.lastCheck
+	s.lastCheck = now
+	s.mu.Unlock()
+	if since.IsZero() {
+		return
+	}
+
+	scheduled, err := s.scheduledActions(since)
+	if err != nil {
+		log.Printf("Checking action schedules failed: %v", err)
+		return
+	}
+	for i := range scheduled {
+		if scheduled[i].NextRun.IsZero() || scheduled[i].NextRun.After(now) {
+			continue
+		}
+		action, schedule, scheduledFor := scheduled[i].Action, scheduled[i].Schedule, scheduled[i].NextRun
+		s.runs.Add(1)
+		go func() {
+			defer s.runs.Done()
+			if _, err := s.run(&action, &schedule, RunTriggerSchedule, nil, &scheduledFor, time.Now()); err != nil {
+				log.Printf("Scheduled run of action '%s' failed: %v", action.Name, err)
+			}
+		}()
+	}
+}
+
+// TriggerRun runs a scheduled action now on behalf of userID, waiting for it to finish
+func (s *ActionSchedulerService) TriggerRun(actionID uuid.UUID, userID uuid.UUID, now time.Time) (*database.ActionRun, error) {
+	var action database.Action
+	if err := s.db.Where("id = ?", actionID).First(&action).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "action not found")
+		}
+		return nil, fmt.Errorf("failed to get action: %w", err)
+	}
+	schedule, err := ParseActionSchedule(&action)
+	if err != nil {
+		return nil, err
+	}
+	if schedule == nil || action.ActivityType != "automated" {
+		return nil, NewError(CodeValidationFailed, "action '%s' is not a scheduled automated action", action.Name)
+	}
+	if !action.Active {
+		return nil, NewError(CodeValidationFailed, "action '%s' is inactive and cannot be run", action.Name)
+	}
+	return s.run(&action, schedule, RunTriggerManual, &userID, nil, now)
+}
+
+// ScheduledActions returns the active scheduled actions with their next run
+// time after now and their most recent run
+func (s *ActionSchedulerService) ScheduledActions(now time.Time) ([]ScheduledAction, error) {
+	scheduled, err := s.scheduledActions(now)
+	if err != nil {
+		return nil, err
+	}
+	for i := range scheduled {
+		var run database.ActionRun
+		err := database.ReadReplica(s.db).Where("action_id = ?", scheduled[i].Action.ID).
+			Order("started_at DESC").Limit(1).Find(&run).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch last action run: %w", err)
+		}
+		if run.ID != uuid.Nil {
+			scheduled[i].LastRun = &run
+		}
+	}
+	return scheduled, nil
+}
+
+// ListRuns retrieves action runs, newest first, with the total matching the filter
+func (s *ActionSchedulerService) ListRuns(filter ActionRunFilter) ([]database.ActionRun, int64, error) {
+	query := database.ReadReplica(s.db).Model(&database.ActionRun{})
+	if filter.ActionID != nil {
+		query = query.Where("action_id = ?", *filter.ActionID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Trigger != "" {
+		query = query.Where("trigger = ?", filter.Trigger)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count action runs: %w", err)
+	}
+
+	var runs []database.ActionRun
+	if err := query.Preload("Action").Order("started_at DESC").
+		Limit(filter.Limit).Offset(filter.Offset).Find(&runs).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch action runs: %w", err)
+	}
+	return runs, total, nil
+}
+
+// scheduledActions loads the active automated actions that have a schedule,
+// with the first schedule time after since
+func (s *ActionSchedulerService) scheduledActions(since time.Time) ([]ScheduledAction, error) {
+	var actions []database.Action
+	if err := database.ReadReplica(s.db).Where("activity_type = ? AND active = ?", "automated", true).
+		Order("name").Find(&actions).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch automated actions: %w", err)
+	}
+
+	scheduled := make([]ScheduledAction, 0, len(actions))
+	for i := range actions {
+		schedule, err := ParseActionSchedule(&actions[i])
+		if err != nil {
+			log.Printf("Skipping schedule of action '%s': %v", actions[i].Name, err)
+			continue
+		}
+		if schedule == nil {
+			continue
+		}
+		cron, _ := schedule.CronSchedule()
+		scheduled = append(scheduled, ScheduledAction{
+			Action:   actions[i],
+			Schedule: *schedule,
+			NextRun:  cron.Next(since),
+		})
+	}
+	return scheduled, nil
+}
+
+// run performs one run of an action and records it. A scheduled run already
+// taken by another server returns nil; a run due while the previous one is
+// still going is recorded as skipped.
+func (s *ActionSchedulerService) run(action *database.Action, schedule *ActionSchedule, trigger string, triggeredBy *uuid.UUID, scheduledFor *time.Time, now time.Time) (*database.ActionRun, error) {
+	timeout := s.config.Scheduler.RunTimeout
+
+	// A run that outlived the timeout died with its server
+	if err := s.db.Model(&database.ActionRun{}).
+		Where("action_id = ? AND status = ? AND started_at < ?", action.ID, RunRunning, now.Add(-timeout)).
+		Updates(map[string]interface{}{"status": RunFailed, "finished_at": now, "error": "run did not finish within the run timeout"}).Error; err != nil {
+		return nil, fmt.Errorf("failed to expire stale action runs: %w", err)
+	}
+
+	run := &database.ActionRun{
+		ID:            uuid.New(),
+		ActionID:      action.ID,
+		Trigger:       trigger,
+		TriggeredByID: triggeredBy,
+		ScheduledFor:  scheduledFor,
+		Status:        RunRunning,
+		StartedAt:     now,
+	}
+
+	var running int64
+	if err := s.db.Model(&database.ActionRun{}).Where("action_id = ? AND status = ?", action.ID, RunRunning).Count(&running).Error; err != nil {
+		return nil, fmt.Errorf("failed to check running action runs: %w", err)
+	}
+	if running > 0 {
+		if trigger == RunTriggerManual {
+			return nil, NewError(CodeConflict, "action '%s' is already running", action.Name)
+		}
+		run.Status = RunSkipped
+		run.FinishedAt = &now
+		run.Error = "previous run was still running"
+	}
+
+	if err := s.db.Create(run).Error; err != nil {
+		if scheduledFor != nil {
+			var taken int64
+			s.db.Model(&database.ActionRun{}).Where("action_id = ? AND scheduled_for = ?", action.ID, *scheduledFor).Count(&taken)
+			if taken > 0 {
+				return nil, nil
+			}
+		}
+		if trigger == RunTriggerManual {
+			return nil, NewError(CodeConflict, "action '%s' is already running", action.Name)
+		}
+		return nil, fmt.Errorf("failed to record action run: %w", err)
+	}
+	if run.Status == RunSkipped {
+		return run, nil
+	}
+
+	var errs []string
+	if schedule.Task != "" {
+		if task, ok := s.actions.systemTasks[schedule.Task]; !ok {
+			errs = append(errs, fmt.Sprintf("unknown task '%s'", schedule.Task))
+		} else {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			result, err := task.Run(ctx, schedule.Config, now)
+			cancel()
+			run.Result = result
+			if err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+	}
+
+	event := SideEffectEvent{
+		Action:     action.Name,
+		OccurredAt: now,
+		Details: map[string]interface{}{
+			"run_id":  run.ID,
+			"trigger": trigger,
+			"task":    schedule.Task,
+			"result":  run.Result,
+		},
+	}
+	if triggeredBy != nil {
+		event.UserID = *triggeredBy
+	}
+	results, err := s.actions.RunSideEffects(action, event)
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+	for _, result := range results {
+		if !result.Success {
+			errs = append(errs, fmt.Sprintf("side effect '%s': %s", result.Handler, result.Error))
+		}
+	}
+
+	var sideEffects pgtype.JSONB
+	if results == nil {
+		results = []SideEffectResult{}
+	}
+	if err := sideEffects.Set(results); err != nil {
+		return nil, fmt.Errorf("failed to convert side effect results to JSONB: %w", err)
+	}
+
+	finishedAt := time.Now()
+	run.Status = RunSucceeded
+	if len(errs) > 0 {
+		run.Status = RunFailed
+		run.Error = strings.Join(errs, "; ")
+	}
+	run.FinishedAt = &finishedAt
+	run.SideEffects = sideEffects
+	if err := s.db.Model(run).Updates(map[string]interface{}{
+		"status":       run.Status,
+		"finished_at":  finishedAt,
+		"result":       run.Result,
+		"error":        run.Error,
+		"side_effects": sideEffects,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to record action run: %w", err)
+	}
+	run.Action = *action
+	return run, nil
+}
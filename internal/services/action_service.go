@@ -3,6 +3,7 @@ package services
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/YubiApp/internal/database"
 	"github.com/google/uuid"
@@ -11,11 +12,36 @@ import (
 )
 
 type ActionService struct {
-	db *gorm.DB
+	db                 *gorm.DB
+	userActivities     *UserActivityService
+	notifications      *NotificationService
+	events             *EventBus
+	sideEffectHandlers map[string]SideEffectHandler
+	systemTasks        map[string]SystemTask
 }
 
-func NewActionService(db *gorm.DB) *ActionService {
-	return &ActionService{db: db}
+// NewActionService creates the service with the built-in "http" side effect
+// handler and system tasks registered. events receives action.performed and
+// may be nil.
+func NewActionService(db *gorm.DB, userActivities *UserActivityService, notifications *NotificationService, events *EventBus) *ActionService {
+	s := &ActionService{
+		db:                 db,
+		userActivities:     userActivities,
+		notifications:      notifications,
+		events:             events,
+		sideEffectHandlers: make(map[string]SideEffectHandler),
+		systemTasks:        make(map[string]SystemTask),
+	}
+	s.RegisterSideEffectHandler("http", NewHTTPSideEffectHandler())
+	s.RegisterSystemTask(SystemTaskCloseOpenActivities, &closeOpenActivitiesTask{db: db})
+	s.RegisterSystemTask(SystemTaskActivityRollup, &activityRollupTask{db: db, activities: userActivities})
+	return s
+}
+
+// PublishActionPerformed announces a performed action as an action.performed
+// event, e.g. for HR notifications and webhooks
+func (s *ActionService) PublishActionPerformed(event SideEffectEvent) {
+	s.events.Publish(EventActionPerformed, event)
 }
 
 // GetActionByName retrieves an action by its name
@@ -23,7 +49,7 @@ func (s *ActionService) GetActionByName(name string) (*database.Action, error) {
 	var action database.Action
 	if err := s.db.Where("name = ?", name).First(&action).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, fmt.Errorf("action '%s' not found", name)
+			return nil, NewError(CodeNotFound, "action '%s' not found", name)
 		}
 		return nil, err
 	}
@@ -35,7 +61,7 @@ func (s *ActionService) GetActionByID(id uuid.UUID) (*database.Action, error) {
 	var action database.Action
 	if err := s.db.Where("id = ?", id).First(&action).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, fmt.Errorf("action with ID '%s' not found", id)
+			return nil, NewError(CodeNotFound, "action with ID '%s' not found", id)
 		}
 		return nil, err
 	}
@@ -45,16 +71,16 @@ func (s *ActionService) GetActionByID(id uuid.UUID) (*database.Action, error) {
 // ListActions retrieves all actions
 func (s *ActionService) ListActions() ([]database.Action, error) {
 	var actions []database.Action
-	if err := s.db.Find(&actions).Error; err != nil {
+	if err := database.ReadReplica(s.db).Find(&actions).Error; err != nil {
 		return nil, err
 	}
 	return actions, nil
 }
 
 // CreateAction creates a new action
-func (s *ActionService) CreateAction(name string, activityType string, requiredPermissions []string, details map[string]interface{}, active bool) (*database.Action, error) {
+func (s *ActionService) CreateAction(name string, activityType string, requiredPermissions []string, details map[string]interface{}, active bool, allowSessionAuth bool, sessionPermission string) (*database.Action, error) {
 	// Validate activity type
-	validTypes := []string{"user", "system", "automated", "other"}
+	validTypes := []string{"user", "system", "automated", "door", "other"}
 	validType := false
 	for _, t := range validTypes {
 		if activityType == t {
@@ -63,7 +89,7 @@ func (s *ActionService) CreateAction(name string, activityType string, requiredP
 		}
 	}
 	if !validType {
-		return nil, fmt.Errorf("invalid activity type. Must be one of: %v", validTypes)
+		return nil, NewError(CodeValidationFailed, "invalid activity type. Must be one of: %v", validTypes)
 	}
 
 	// Convert []string to pgtype.JSONB for required permissions
@@ -77,16 +103,46 @@ func (s *ActionService) CreateAction(name string, activityType string, requiredP
 	if details == nil {
 		details = make(map[string]interface{})
 	}
+	if err := validateActionDetailsConstraints(details); err != nil {
+		return nil, WithCode(CodeValidationFailed, err)
+	}
+	if err := validateActionDetailsPipeline(name, details); err != nil {
+		return nil, WithCode(CodeValidationFailed, err)
+	}
+	if err := validateActionDetailsCoSign(details); err != nil {
+		return nil, WithCode(CodeValidationFailed, err)
+	}
+	if err := validateActionDetailsLeave(details); err != nil {
+		return nil, WithCode(CodeValidationFailed, err)
+	}
+	if err := s.validateActionDetailsSideEffects(details); err != nil {
+		return nil, WithCode(CodeValidationFailed, err)
+	}
+	if err := s.validateActionDetailsSchedule(activityType, details); err != nil {
+		return nil, WithCode(CodeValidationFailed, err)
+	}
 	if err := detailsJSONB.Set(details); err != nil {
 		return nil, fmt.Errorf("failed to convert details to JSONB: %w", err)
 	}
 
+	if activityType == "door" {
+		if door, _ := details["door"].(string); door == "" {
+			return nil, NewError(CodeValidationFailed, "door actions require a \"door\" in details naming the door resource to unlock")
+		}
+	}
+
+	if err := validateSessionPermission(sessionPermission); err != nil {
+		return nil, err
+	}
+
 	action := &database.Action{
 		Name:                name,
 		ActivityType:        activityType,
 		RequiredPermissions: permissionsJSONB,
 		Details:             detailsJSONB,
 		Active:              active,
+		AllowSessionAuth:    allowSessionAuth,
+		SessionPermission:   sessionPermission,
 	}
 
 	if err := s.db.Create(action).Error; err != nil {
@@ -96,10 +152,17 @@ func (s *ActionService) CreateAction(name string, activityType string, requiredP
 	return action, nil
 }
 
-// UpdateAction updates an existing action
-func (s *ActionService) UpdateAction(id uuid.UUID, name string, activityType string, requiredPermissions []string, details map[string]interface{}, active *bool) (*database.Action, error) {
+// UpdateAction updates an existing action. A non-nil version must match the
+// action's current version.
+func (s *ActionService) UpdateAction(id uuid.UUID, version *int, name string, activityType string, requiredPermissions []string, details map[string]interface{}, active *bool, allowSessionAuth *bool, sessionPermission *string) (*database.Action, error) {
 	action := &database.Action{}
 	if err := s.db.Where("id = ?", id).First(action).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "action with ID '%s' not found", id)
+		}
+		return nil, err
+	}
+	if err := checkVersion("action", action.Version, version); err != nil {
 		return nil, err
 	}
 
@@ -107,7 +170,7 @@ func (s *ActionService) UpdateAction(id uuid.UUID, name string, activityType str
 	
 	// Validate activity type if provided
 	if activityType != "" {
-		validTypes := []string{"user", "system", "automated", "other"}
+		validTypes := []string{"user", "system", "automated", "door", "other"}
 		validType := false
 		for _, t := range validTypes {
 			if activityType == t {
@@ -116,7 +179,7 @@ func (s *ActionService) UpdateAction(id uuid.UUID, name string, activityType str
 			}
 		}
 		if !validType {
-			return nil, fmt.Errorf("invalid activity type. Must be one of: %v", validTypes)
+			return nil, NewError(CodeValidationFailed, "invalid activity type. Must be one of: %v", validTypes)
 		}
 		action.ActivityType = activityType
 	}
@@ -130,6 +193,24 @@ func (s *ActionService) UpdateAction(id uuid.UUID, name string, activityType str
 
 	// Convert details map to pgtype.JSONB
 	if details != nil {
+		if err := validateActionDetailsConstraints(details); err != nil {
+			return nil, WithCode(CodeValidationFailed, err)
+		}
+		if err := validateActionDetailsPipeline(name, details); err != nil {
+			return nil, WithCode(CodeValidationFailed, err)
+		}
+		if err := validateActionDetailsCoSign(details); err != nil {
+			return nil, WithCode(CodeValidationFailed, err)
+		}
+		if err := validateActionDetailsLeave(details); err != nil {
+			return nil, WithCode(CodeValidationFailed, err)
+		}
+		if err := s.validateActionDetailsSideEffects(details); err != nil {
+			return nil, WithCode(CodeValidationFailed, err)
+		}
+		if err := s.validateActionDetailsSchedule(action.ActivityType, details); err != nil {
+			return nil, WithCode(CodeValidationFailed, err)
+		}
 		var detailsJSONB pgtype.JSONB
 		if err := detailsJSONB.Set(details); err != nil {
 			return nil, fmt.Errorf("failed to convert details to JSONB: %w", err)
@@ -142,18 +223,56 @@ func (s *ActionService) UpdateAction(id uuid.UUID, name string, activityType str
 		action.Active = *active
 	}
 
-	if err := s.db.Save(action).Error; err != nil {
+	// Update session access settings if provided
+	if allowSessionAuth != nil {
+		action.AllowSessionAuth = *allowSessionAuth
+	}
+	if sessionPermission != nil {
+		if err := validateSessionPermission(*sessionPermission); err != nil {
+			return nil, err
+		}
+		action.SessionPermission = *sessionPermission
+	}
+
+	if action.ActivityType == "door" && DoorForAction(action) == "" {
+		return nil, NewError(CodeValidationFailed, "door actions require a \"door\" in details naming the door resource to unlock")
+	}
+
+	if err := saveVersioned(s.db, "action", action, &action.Version); err != nil {
 		return nil, err
 	}
 
 	return action, nil
 }
 
+// validateSessionPermission checks an action's session permission is empty or in "resource:action" format
+func validateSessionPermission(permission string) error {
+	if permission == "" {
+		return nil
+	}
+	parts := strings.Split(permission, ":")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return NewError(CodeValidationFailed, "invalid session_permission '%s' (expected 'resource:action')", permission)
+	}
+	return nil
+}
+
 // DeleteAction deletes an action
 func (s *ActionService) DeleteAction(id uuid.UUID) error {
 	return s.db.Delete(&database.Action{}, id).Error
 }
 
+// ActionRequiredPermissions returns the "resource:action" permissions an action requires
+func ActionRequiredPermissions(action *database.Action) ([]string, error) {
+	var requiredPermissions []string
+	if action.RequiredPermissions.Status == pgtype.Present {
+		if err := action.RequiredPermissions.AssignTo(&requiredPermissions); err != nil {
+			return nil, fmt.Errorf("failed to read action permissions: %w", err)
+		}
+	}
+	return requiredPermissions, nil
+}
+
 // CheckUserPermissionsForAction checks if a user has the required permissions for an action
 func (s *ActionService) CheckUserPermissionsForAction(userID uuid.UUID, actionName string) (bool, error) {
 	// Get the action
@@ -162,12 +281,9 @@ func (s *ActionService) CheckUserPermissionsForAction(userID uuid.UUID, actionNa
 		return false, err
 	}
 
-	// Extract required permissions from JSONB
-	var requiredPermissions []string
-	if action.RequiredPermissions.Status == pgtype.Present {
-		if err := action.RequiredPermissions.AssignTo(&requiredPermissions); err != nil {
-			return false, fmt.Errorf("failed to read action permissions: %w", err)
-		}
+	requiredPermissions, err := ActionRequiredPermissions(action)
+	if err != nil {
+		return false, err
 	}
 
 	// If no permissions required, allow
@@ -208,7 +324,7 @@ func (s *ActionService) CheckUserPermissionsForAction(userID uuid.UUID, actionNa
 // ListActionsWithFilter retrieves actions with optional active filter
 func (s *ActionService) ListActionsWithFilter(activeOnly *bool) ([]database.Action, error) {
 	var actions []database.Action
-	query := s.db
+	query := database.ReadReplica(s.db)
 
 	if activeOnly != nil && *activeOnly {
 		query = query.Where("active = ?", true)
@@ -0,0 +1,378 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultSideEffectTimeout = 5 * time.Second
+	maxSideEffectTimeout     = 30 * time.Second
+	maxSideEffectRetries     = 5
+	sideEffectRetryBackoff   = 500 * time.Millisecond
+)
+
+// SideEffectHandler performs an outbound side effect (HTTP call, queued message, ...)
+// when an action is performed. Handlers are registered on the ActionService by name
+// and configured per action in the "side_effects" key of Action.Details, e.g.
+//
+//	"side_effects": [
+//	  {"handler": "http", "timeout": "3s", "retries": 2,
+//	   "config": {"url": "https://doors.example.com/unlock", "headers": {"X-Door": "front"}}},
+//	  {"handler": "queue", "config": {"queue": "slack:outbound"}}
+//	]
+type SideEffectHandler interface {
+	// Validate checks a side effect's config when the action is saved
+	Validate(config map[string]interface{}) error
+	// Execute performs the side effect, returning a short description of the outcome
+	Execute(ctx context.Context, config map[string]interface{}, event SideEffectEvent) (string, error)
+}
+
+// SideEffectCompensator is implemented by handlers that can undo a side effect,
+// or tell its receiver to, when the action it ran for could not be recorded.
+// The event passed has Compensation set.
+type SideEffectCompensator interface {
+	Compensate(ctx context.Context, config map[string]interface{}, event SideEffectEvent) (string, error)
+}
+
+// SideEffectEvent describes the performed action passed to side effect handlers
+// and published as an action.performed event
+type SideEffectEvent struct {
+	Action     string                 `json:"action"`
+	UserID     uuid.UUID              `json:"user_id"`
+	Username   string                 `json:"username"`
+	DeviceID   uuid.UUID              `json:"device_id"`
+	OccurredAt time.Time              `json:"occurred_at"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+	// Compensation marks an event that reverses an earlier one for the same
+	// action, which was rolled back
+	Compensation bool `json:"compensation,omitempty"`
+}
+
+// SideEffect is one configured side effect of an action
+type SideEffect struct {
+	Handler string                 `json:"handler"`
+	Timeout string                 `json:"timeout,omitempty"`
+	Retries int                    `json:"retries,omitempty"`
+	Config  map[string]interface{} `json:"config"`
+}
+
+// SideEffectResult records the outcome of running a side effect
+type SideEffectResult struct {
+	Handler    string `json:"handler"`
+	Success    bool   `json:"success"`
+	Attempts   int    `json:"attempts"`
+	Output     string `json:"output,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+	// Set when the action was rolled back after the side effect ran
+	Compensated       bool   `json:"compensated,omitempty"`
+	CompensationError string `json:"compensation_error,omitempty"`
+}
+
+// RegisterSideEffectHandler makes a side effect handler available to actions under name
+func (s *ActionService) RegisterSideEffectHandler(name string, handler SideEffectHandler) {
+	s.sideEffectHandlers[name] = handler
+}
+
+// SideEffectHandlers returns the names of the registered side effect handlers
+func (s *ActionService) SideEffectHandlers() []string {
+	names := make([]string, 0, len(s.sideEffectHandlers))
+	for name := range s.sideEffectHandlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseActionSideEffects reads the side effects in an action's details
+func ParseActionSideEffects(action *database.Action) ([]SideEffect, error) {
+	if action.Details.Status != pgtype.Present {
+		return nil, nil
+	}
+	var details map[string]json.RawMessage
+	if err := json.Unmarshal(action.Details.Bytes, &details); err != nil {
+		return nil, fmt.Errorf("failed to read action details: %w", err)
+	}
+	return parseSideEffects(details["side_effects"])
+}
+
+func parseSideEffects(raw json.RawMessage) ([]SideEffect, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	var effects []SideEffect
+	if err := decoder.Decode(&effects); err != nil {
+		return nil, fmt.Errorf("invalid side_effects: %w", err)
+	}
+	return effects, nil
+}
+
+// validateActionDetailsSideEffects validates the side effects in a details map before it is saved
+func (s *ActionService) validateActionDetailsSideEffects(details map[string]interface{}) error {
+	raw, ok := details["side_effects"]
+	if !ok {
+		return nil
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("invalid side_effects: %w", err)
+	}
+	effects, err := parseSideEffects(data)
+	if err != nil {
+		return err
+	}
+
+	for i, effect := range effects {
+		handler, ok := s.sideEffectHandlers[effect.Handler]
+		if !ok {
+			return fmt.Errorf("invalid side_effects: effect %d: unknown handler '%s'. Must be one of: %v", i+1, effect.Handler, s.SideEffectHandlers())
+		}
+		if _, err := sideEffectTimeout(effect); err != nil {
+			return fmt.Errorf("invalid side_effects: effect %d: %w", i+1, err)
+		}
+		if effect.Retries < 0 || effect.Retries > maxSideEffectRetries {
+			return fmt.Errorf("invalid side_effects: effect %d: retries must be between 0 and %d", i+1, maxSideEffectRetries)
+		}
+		if err := handler.Validate(effect.Config); err != nil {
+			return fmt.Errorf("invalid side_effects: effect %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// RunSideEffects runs an action's side effects in order. Each side effect is retried
+// on failure up to its retry count; a failing side effect does not stop the others.
+func (s *ActionService) RunSideEffects(action *database.Action, event SideEffectEvent) ([]SideEffectResult, error) {
+	effects, err := ParseActionSideEffects(action)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]SideEffectResult, 0, len(effects))
+	for _, effect := range effects {
+		results = append(results, s.runSideEffect(effect, event))
+	}
+	return results, nil
+}
+
+// CompensateSideEffects reverses, newest first, the side effects that succeeded
+// in results, as returned by RunSideEffects for the same action and event.
+// Handlers that cannot compensate are skipped; the outcome is recorded in results.
+func (s *ActionService) CompensateSideEffects(action *database.Action, event SideEffectEvent, results []SideEffectResult) {
+	effects, err := ParseActionSideEffects(action)
+	if err != nil || len(effects) != len(results) {
+		return
+	}
+	event.Compensation = true
+	for i := len(results) - 1; i >= 0; i-- {
+		if !results[i].Success {
+			continue
+		}
+		compensator, ok := s.sideEffectHandlers[effects[i].Handler].(SideEffectCompensator)
+		if !ok {
+			continue
+		}
+		timeout, _ := sideEffectTimeout(effects[i])
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		_, err := compensator.Compensate(ctx, effects[i].Config, event)
+		cancel()
+		if err != nil {
+			results[i].CompensationError = err.Error()
+		} else {
+			results[i].Compensated = true
+		}
+	}
+}
+
+func (s *ActionService) runSideEffect(effect SideEffect, event SideEffectEvent) SideEffectResult {
+	result := SideEffectResult{Handler: effect.Handler}
+	started := time.Now()
+	defer func() { result.DurationMs = time.Since(started).Milliseconds() }()
+
+	handler, ok := s.sideEffectHandlers[effect.Handler]
+	if !ok {
+		result.Error = fmt.Sprintf("unknown handler '%s'", effect.Handler)
+		return result
+	}
+	timeout, err := sideEffectTimeout(effect)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	for attempt := 0; attempt <= effect.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * sideEffectRetryBackoff)
+		}
+		result.Attempts++
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		output, err := handler.Execute(ctx, effect.Config, event)
+		cancel()
+		if err == nil {
+			result.Success = true
+			result.Output = output
+			result.Error = ""
+			return result
+		}
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// sideEffectTimeout returns a side effect's timeout, defaulting to 5s and capped at 30s
+func sideEffectTimeout(effect SideEffect) (time.Duration, error) {
+	if effect.Timeout == "" {
+		return defaultSideEffectTimeout, nil
+	}
+	timeout, err := time.ParseDuration(effect.Timeout)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("timeout must be a positive duration like 5s")
+	}
+	if timeout > maxSideEffectTimeout {
+		return 0, fmt.Errorf("timeout must not exceed %s", maxSideEffectTimeout)
+	}
+	return timeout, nil
+}
+
+// HTTPSideEffectHandler calls an outbound HTTP endpoint with the action event as JSON.
+// Config: url (required), method (default POST), headers, and secret to sign the body.
+// With compensate_url set, a rolled-back action is POSTed there as an
+// action.compensated event.
+type HTTPSideEffectHandler struct {
+	client *http.Client
+}
+
+func NewHTTPSideEffectHandler() *HTTPSideEffectHandler {
+	return &HTTPSideEffectHandler{client: &http.Client{}}
+}
+
+func (h *HTTPSideEffectHandler) Validate(config map[string]interface{}) error {
+	url, _ := config["url"].(string)
+	if err := validateWebhookURL(url); err != nil {
+		return err
+	}
+	if compensateURL, ok := config["compensate_url"]; ok {
+		url, _ := compensateURL.(string)
+		if err := validateWebhookURL(url); err != nil {
+			return fmt.Errorf("compensate_url: %w", err)
+		}
+	}
+	if method, ok := config["method"]; ok {
+		switch strings.ToUpper(fmt.Sprint(method)) {
+		case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			return fmt.Errorf("method must be one of GET, POST, PUT, PATCH or DELETE")
+		}
+	}
+	if headers, ok := config["headers"]; ok {
+		if _, ok := headers.(map[string]interface{}); !ok {
+			return fmt.Errorf("headers must be an object")
+		}
+	}
+	return nil
+}
+
+func (h *HTTPSideEffectHandler) Execute(ctx context.Context, config map[string]interface{}, event SideEffectEvent) (string, error) {
+	url, _ := config["url"].(string)
+	method := http.MethodPost
+	if m, ok := config["method"].(string); ok && m != "" {
+		method = strings.ToUpper(m)
+	}
+	return h.send(ctx, config, method, url, "action.performed", event)
+}
+
+// Compensate POSTs the event to compensate_url; without one there is nothing to do
+func (h *HTTPSideEffectHandler) Compensate(ctx context.Context, config map[string]interface{}, event SideEffectEvent) (string, error) {
+	url, _ := config["compensate_url"].(string)
+	if url == "" {
+		return "no compensate_url", nil
+	}
+	return h.send(ctx, config, http.MethodPost, url, "action.compensated", event)
+}
+
+// send makes one side effect request with the configured headers and signature
+func (h *HTTPSideEffectHandler) send(ctx context.Context, config map[string]interface{}, method, url, eventType string, event SideEffectEvent) (string, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "YubiApp-Action/1.0")
+	req.Header.Set("X-YubiApp-Event", eventType)
+	if headers, ok := config["headers"].(map[string]interface{}); ok {
+		for name, value := range headers {
+			req.Header.Set(name, fmt.Sprint(value))
+		}
+	}
+	if secret, ok := config["secret"].(string); ok && secret != "" {
+		req.Header.Set("X-YubiApp-Signature", signPayload(secret, body))
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("endpoint returned status %d", resp.StatusCode)
+	}
+	return fmt.Sprintf("HTTP %d", resp.StatusCode), nil
+}
+
+// QueueSideEffectHandler pushes the action event as JSON onto a Redis list for
+// out-of-process consumers. Config: queue (required), the list key. A rolled-back
+// action is pushed again with "compensation": true.
+type QueueSideEffectHandler struct {
+	client redis.UniversalClient
+}
+
+func NewQueueSideEffectHandler(client redis.UniversalClient) *QueueSideEffectHandler {
+	return &QueueSideEffectHandler{client: client}
+}
+
+func (h *QueueSideEffectHandler) Validate(config map[string]interface{}) error {
+	if queue, _ := config["queue"].(string); queue == "" {
+		return fmt.Errorf("queue is required")
+	}
+	return nil
+}
+
+func (h *QueueSideEffectHandler) Execute(ctx context.Context, config map[string]interface{}, event SideEffectEvent) (string, error) {
+	queue, _ := config["queue"].(string)
+	body, err := json.Marshal(event)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode event: %w", err)
+	}
+	length, err := h.client.RPush(ctx, queue, body).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to enqueue message: %w", err)
+	}
+	return fmt.Sprintf("queued on %s (length %d)", queue, length), nil
+}
+
+// Compensate pushes the compensation event onto the same queue
+func (h *QueueSideEffectHandler) Compensate(ctx context.Context, config map[string]interface{}, event SideEffectEvent) (string, error) {
+	return h.Execute(ctx, config, event)
+}
@@ -0,0 +1,66 @@
+package services
+
+import "sort"
+
+// DefaultActivityCategories maps each user status type to a category of the same name
+var DefaultActivityCategories = map[string][]string{
+	"working": {"working"},
+	"break":   {"break"},
+	"leave":   {"leave"},
+	"travel":  {"travel"},
+	"other":   {"other"},
+}
+
+// ActivityCategorizer resolves the summary category of an activity from its user status
+type ActivityCategorizer struct {
+	byName map[string]string
+	byType map[string]string
+	names  []string
+}
+
+// NewActivityCategorizer builds a categorizer from a category -> status types/names mapping.
+// Each entry may be a status type (working, break, leave, travel, other) or a status name.
+func NewActivityCategorizer(categories map[string][]string) *ActivityCategorizer {
+	if len(categories) == 0 {
+		categories = DefaultActivityCategories
+	}
+
+	validTypes := map[string]bool{"working": true, "break": true, "leave": true, "travel": true, "other": true}
+
+	c := &ActivityCategorizer{
+		byName: make(map[string]string),
+		byType: make(map[string]string),
+	}
+	for category, entries := range categories {
+		c.names = append(c.names, category)
+		for _, entry := range entries {
+			if validTypes[entry] {
+				c.byType[entry] = category
+			} else {
+				c.byName[entry] = category
+			}
+		}
+	}
+	if _, ok := categories["other"]; !ok {
+		c.names = append(c.names, "other") // Fallback for unmatched statuses
+	}
+	sort.Strings(c.names)
+
+	return c
+}
+
+// Category returns the category for a status, preferring a status name match over a type match
+func (c *ActivityCategorizer) Category(statusName, statusType string) string {
+	if category, ok := c.byName[statusName]; ok {
+		return category
+	}
+	if category, ok := c.byType[statusType]; ok {
+		return category
+	}
+	return "other"
+}
+
+// Names returns the configured category names in sorted order
+func (c *ActivityCategorizer) Names() []string {
+	return c.names
+}
@@ -0,0 +1,550 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+	"gorm.io/gorm"
+)
+
+// rollupLockID keys the advisory lock that keeps the API process and
+// cmd/worker from refreshing rollups at once
+const rollupLockID = 7279158433
+
+// rollupQueueBatch is how many queued changes a refresh takes per transaction
+const rollupQueueBatch = 500
+
+// rollupUserChunk is how many users summaries and timesheets read at a time
+const rollupUserChunk = 100
+
+// rollupEdge bounds how far into a period a user's first whole local day
+// starts, and how far before its end their last one ends: a day, an hour for
+// DST and one to spare
+const rollupEdge = 26 * time.Hour
+
+// queuedRollup is a change to a user's activities in activity_rollup_queue:
+// the period of the activity before or after it
+type queuedRollup struct {
+	UserID       uuid.UUID
+	FromDateTime time.Time  `gorm:"column:from_datetime"`
+	ToDateTime   *time.Time `gorm:"column:to_datetime"`
+}
+
+// rollupSpan is a run of local days, from the start of the first to the end of the last
+type rollupSpan struct {
+	start, end time.Time
+}
+
+// rollupActivity is an activity as read to roll up its days
+type rollupActivity struct {
+	FromDateTime time.Time  `gorm:"column:from_datetime"`
+	ToDateTime   *time.Time `gorm:"column:to_datetime"`
+	StatusID     *uuid.UUID
+	LocationID   *uuid.UUID
+	ActionName   string
+	StatusName   string
+	StatusType   string
+}
+
+// dayRollup accumulates one local day of a user's rollup
+type dayRollup struct {
+	day         time.Time
+	statusHours map[string]float64
+	hours       map[string]float64
+	totalHours  float64
+	signIns     int
+	signOuts    int
+	locations   map[uuid.UUID]bool
+}
+
+// StartRollups periodically refreshes the rollups of days with queued
+// activity changes. It does nothing when activity.rollup_interval is zero.
+func (s *UserActivityService) StartRollups() {
+	if s.rollupInterval <= 0 || s.rollupStop != nil {
+		return
+	}
+
+	s.rollupStop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(s.rollupInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := s.RefreshActivityRollups(context.Background(), time.Now()); err != nil {
+					log.Printf("Activity rollup refresh failed: %v", err)
+				}
+			case <-s.rollupStop:
+				return
+			}
+		}
+	}()
+}
+
+// StopRollups stops the background rollup refresh
+func (s *UserActivityService) StopRollups() {
+	if s.rollupStop != nil {
+		close(s.rollupStop)
+		s.rollupStop = nil
+	}
+}
+
+// RefreshActivityRollups recomputes the rollups of the days touched by the
+// changes in activity_rollup_queue until it is empty, returning the number of
+// user-days written. Each batch of changes is taken off the queue in the
+// transaction that rewrites its days, so a failed refresh leaves them queued.
+func (s *UserActivityService) RefreshActivityRollups(ctx context.Context, now time.Time) (int, error) {
+	written := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+
+		var queued []queuedRollup
+		batchWritten := 0
+		err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", rollupLockID).Error; err != nil {
+				return fmt.Errorf("failed to lock activity rollups: %w", err)
+			}
+			if err := tx.Raw(`DELETE FROM activity_rollup_queue WHERE id IN (
+				SELECT id FROM activity_rollup_queue ORDER BY id LIMIT ?
+			) RETURNING user_id, from_datetime, to_datetime`, rollupQueueBatch).Scan(&queued).Error; err != nil {
+				return fmt.Errorf("failed to read queued activity changes: %w", err)
+			}
+
+			byUser := make(map[uuid.UUID][]queuedRollup)
+			for _, change := range queued {
+				byUser[change.UserID] = append(byUser[change.UserID], change)
+			}
+			for userID, changes := range byUser {
+				n, err := s.refreshUserRollups(tx, userID, changes, now)
+				if err != nil {
+					return err
+				}
+				batchWritten += n
+			}
+			return nil
+		})
+		if err != nil {
+			return written, err
+		}
+		written += batchWritten
+
+		if len(queued) < rollupQueueBatch {
+			return written, nil
+		}
+	}
+}
+
+// refreshUserRollups rewrites the user's rollups of the days changes touch
+func (s *UserActivityService) refreshUserRollups(tx *gorm.DB, userID uuid.UUID, changes []queuedRollup, now time.Time) (int, error) {
+	var users []struct{ Timezone string }
+	if err := tx.Raw("SELECT timezone FROM users WHERE id = ?", userID).Scan(&users).Error; err != nil {
+		return 0, fmt.Errorf("failed to read user %s: %w", userID, err)
+	}
+	if len(users) == 0 {
+		return 0, nil // Purged, and its rollups with it
+	}
+	loc := loadTimezone(users[0].Timezone)
+
+	written := 0
+	for _, span := range rollupSpans(changes, loc) {
+		var activities []rollupActivity
+		if err := tx.Raw(`
+			SELECT uah.from_datetime, uah.to_datetime, uah.status_id, uah.location_id, a.name AS action_name,
+				COALESCE(us.name, '') AS status_name, COALESCE(us.type, 'other') AS status_type
+			FROM user_activity_history uah
+			JOIN actions a ON a.id = uah.action_id
+			LEFT JOIN user_statuses us ON us.id = uah.status_id
+			WHERE uah.user_id = ? AND uah.from_datetime < ? AND (uah.to_datetime IS NULL OR uah.to_datetime > ?)
+		`, userID, span.end, span.start).Scan(&activities).Error; err != nil {
+			return written, fmt.Errorf("failed to read activities of user %s: %w", userID, err)
+		}
+
+		days := make(map[string]*dayRollup)
+		for _, activity := range activities {
+			// Sign-ins, sign-outs and locations count on the day the activity started
+			if !activity.FromDateTime.Before(span.start) {
+				day := rollupDayOf(days, localDay(activity.FromDateTime, loc))
+				switch activity.ActionName {
+				case "user-signin":
+					day.signIns++
+				case "user-signout":
+					day.signOuts++
+				}
+				if activity.LocationID != nil {
+					day.locations[*activity.LocationID] = true
+				}
+			}
+
+			// Open activities have no hours until they close
+			if activity.ToDateTime == nil {
+				continue
+			}
+			statusKey := ""
+			if activity.StatusID != nil {
+				statusKey = activity.StatusID.String()
+			}
+			category := s.categorizer.Category(activity.StatusName, activity.StatusType)
+			splitByDay(maxTime(activity.FromDateTime, span.start), minTime(*activity.ToDateTime, span.end), loc, func(dayStart time.Time, hours float64) {
+				day := rollupDayOf(days, dayStart)
+				day.statusHours[statusKey] += hours
+				day.hours[category] += hours
+				day.totalHours += hours
+				if activity.LocationID != nil {
+					day.locations[*activity.LocationID] = true
+				}
+			})
+		}
+
+		if err := tx.Where("user_id = ? AND day >= ? AND day < ?", userID, calendarDate(span.start), calendarDate(span.end)).
+			Delete(&database.ActivityRollup{}).Error; err != nil {
+			return written, fmt.Errorf("failed to clear activity rollups: %w", err)
+		}
+		if len(days) == 0 {
+			continue
+		}
+
+		rollups := make([]database.ActivityRollup, 0, len(days))
+		for _, day := range days {
+			rollup, err := day.rollup(userID, loc, now)
+			if err != nil {
+				return written, err
+			}
+			rollups = append(rollups, rollup)
+		}
+		if err := tx.CreateInBatches(rollups, 500).Error; err != nil {
+			return written, fmt.Errorf("failed to save activity rollups: %w", err)
+		}
+		written += len(rollups)
+	}
+	return written, nil
+}
+
+// rollupDayOf returns the rollup of the local day starting at dayStart, adding it to days
+func rollupDayOf(days map[string]*dayRollup, dayStart time.Time) *dayRollup {
+	key := dayStart.Format("2006-01-02")
+	day, ok := days[key]
+	if !ok {
+		day = &dayRollup{
+			day:         dayStart,
+			statusHours: make(map[string]float64),
+			hours:       make(map[string]float64),
+			locations:   make(map[uuid.UUID]bool),
+		}
+		days[key] = day
+	}
+	return day
+}
+
+// rollup converts the day to its activity_rollups row
+func (d *dayRollup) rollup(userID uuid.UUID, loc *time.Location, now time.Time) (database.ActivityRollup, error) {
+	locationIDs := make([]string, 0, len(d.locations))
+	for id := range d.locations {
+		locationIDs = append(locationIDs, id.String())
+	}
+	sort.Strings(locationIDs)
+
+	// Category hours are for display; sums are taken from unrounded status hours
+	hours := make(map[string]float64, len(d.hours))
+	for category, h := range d.hours {
+		hours[category] = roundHours(h)
+	}
+
+	rollup := database.ActivityRollup{
+		Day:        calendarDate(d.day),
+		UserID:     userID,
+		UpdatedAt:  now,
+		Timezone:   loc.String(),
+		TotalHours: roundHours(d.totalHours),
+		SignIns:    d.signIns,
+		SignOuts:   d.signOuts,
+	}
+	for _, field := range []struct {
+		dst   *pgtype.JSONB
+		value interface{}
+	}{
+		{&rollup.Hours, hours},
+		{&rollup.StatusHours, d.statusHours},
+		{&rollup.LocationIDs, locationIDs},
+	} {
+		if err := field.dst.Set(field.value); err != nil {
+			return rollup, fmt.Errorf("failed to convert rollup to JSONB: %w", err)
+		}
+	}
+	return rollup, nil
+}
+
+// rollupSpans returns the local days in loc that changes touch, merged into
+// runs. A day either side is included, as rollups written in an earlier
+// timezone of the user can be a day off.
+func rollupSpans(changes []queuedRollup, loc *time.Location) []rollupSpan {
+	spans := make([]rollupSpan, 0, len(changes))
+	for _, change := range changes {
+		last := change.FromDateTime
+		if change.ToDateTime != nil && change.ToDateTime.After(last) {
+			last = *change.ToDateTime
+		}
+		spans = append(spans, rollupSpan{
+			start: localDay(change.FromDateTime, loc).AddDate(0, 0, -1),
+			end:   localDay(last, loc).AddDate(0, 0, 2),
+		})
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start.Before(spans[j].start) })
+
+	merged := spans[:0]
+	for _, span := range spans {
+		if n := len(merged); n > 0 && !span.start.After(merged[n-1].end) {
+			merged[n-1].end = maxTime(merged[n-1].end, span.end)
+			continue
+		}
+		merged = append(merged, span)
+	}
+	return merged
+}
+
+// localDay is midnight in loc of the day t falls on there
+func localDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// calendarDate is the date of t's day as a UTC midnight, the form date
+// columns are compared with
+func calendarDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// periodStatus is a user status as summaries and timesheets categorise hours by
+type periodStatus struct {
+	Name string
+	Type string
+}
+
+// periodRollup is a rolled-up local day of a user's activity
+type periodRollup struct {
+	Day         time.Time // Midnight in the user's timezone
+	Hours       map[periodStatus]float64
+	SignIns     int
+	SignOuts    int
+	LocationIDs []uuid.UUID // Locations of the day's activities
+}
+
+// periodInterval is an activity as read for summaries and timesheets
+type periodInterval struct {
+	UserID       uuid.UUID
+	ActionName   string
+	FromDateTime time.Time  `gorm:"column:from_datetime"`
+	ToDateTime   *time.Time `gorm:"column:to_datetime"`
+	StatusName   string
+	StatusType   string
+	LocationID   *uuid.UUID
+}
+
+// activityPeriod is a user's activity in [from, to) as summaries and
+// timesheets read it: the rollups of the whole local days within it that have
+// no queued changes, and the activities for the rest. Intervals may overlap
+// rolled-up days, whose closed hours and sign-ins they must leave out.
+type activityPeriod struct {
+	UserID    uuid.UUID
+	UserName  string
+	Loc       *time.Location
+	Rollups   []periodRollup
+	Intervals []periodInterval
+
+	from, to  time.Time
+	useRollup bool
+	stale     []rollupSpan // Days with queued changes
+}
+
+// RolledUp reports whether the local day starting at day is read from Rollups
+func (p *activityPeriod) RolledUp(day time.Time) bool {
+	if !p.useRollup {
+		return false
+	}
+	end := day.AddDate(0, 0, 1)
+	if day.Before(p.from) || end.After(p.to) {
+		return false
+	}
+	for _, span := range p.stale {
+		if day.Before(span.end) && end.After(span.start) {
+			return false
+		}
+	}
+	return true
+}
+
+// readActivityPeriods calls fn with the activity of each user in [from, to),
+// for the given users or all, in the user order orderBy gives; users without
+// activity are skipped. With useRollup, whole days are read from
+// activity_rollups and only the days at either end, days with queued changes
+// and open activities from the history; otherwise everything is.
+func readActivityPeriods(db *gorm.DB, useRollup bool, userIDs []uuid.UUID, from, to time.Time, orderBy string, fn func(*activityPeriod) error) error {
+	var users []struct {
+		ID       uuid.UUID
+		UserName string
+		Timezone string
+	}
+	query := "SELECT id, CONCAT(first_name, ' ', last_name) AS user_name, timezone FROM users"
+	var args []interface{}
+	if len(userIDs) > 0 {
+		query += " WHERE id IN ?"
+		args = append(args, userIDs)
+	}
+	if err := db.Raw(query+" ORDER BY "+orderBy, args...).Scan(&users).Error; err != nil {
+		return fmt.Errorf("failed to read users: %w", err)
+	}
+
+	statuses := make(map[string]periodStatus)
+	if useRollup {
+		var rows []struct {
+			ID   uuid.UUID
+			Name string
+			Type string
+		}
+		if err := db.Raw("SELECT id, name, type FROM user_statuses").Scan(&rows).Error; err != nil {
+			return fmt.Errorf("failed to read user statuses: %w", err)
+		}
+		for _, row := range rows {
+			statuses[row.ID.String()] = periodStatus{Name: row.Name, Type: row.Type}
+		}
+	}
+
+	for start := 0; start < len(users); start += rollupUserChunk {
+		chunk := users[start:min(start+rollupUserChunk, len(users))]
+		ids := make([]uuid.UUID, len(chunk))
+		periods := make(map[uuid.UUID]*activityPeriod, len(chunk))
+		for i, user := range chunk {
+			ids[i] = user.ID
+			periods[user.ID] = &activityPeriod{
+				UserID:    user.ID,
+				UserName:  user.UserName,
+				Loc:       loadTimezone(user.Timezone),
+				from:      from,
+				to:        to,
+				useRollup: useRollup,
+			}
+		}
+
+		var staleUsers []uuid.UUID
+		if useRollup {
+			var err error
+			if staleUsers, err = readPeriodRollups(db, ids, periods, statuses); err != nil {
+				return err
+			}
+		}
+
+		query := `
+			SELECT uah.user_id, a.name AS action_name, uah.from_datetime, uah.to_datetime,
+				COALESCE(us.name, '') AS status_name, COALESCE(us.type, 'other') AS status_type, uah.location_id
+			FROM user_activity_history uah
+			JOIN actions a ON a.id = uah.action_id
+			LEFT JOIN user_statuses us ON us.id = uah.status_id
+			WHERE uah.user_id IN ? AND uah.from_datetime < ? AND (uah.to_datetime IS NULL OR uah.to_datetime > ?)
+		`
+		args := []interface{}{ids, to, from}
+		if useRollup {
+			query += " AND (uah.to_datetime IS NULL OR uah.from_datetime < ? OR uah.to_datetime > ?"
+			args = append(args, from.Add(rollupEdge), to.Add(-rollupEdge))
+			if len(staleUsers) > 0 {
+				query += " OR uah.user_id IN ?"
+				args = append(args, staleUsers)
+			}
+			query += ")"
+		}
+		var intervals []periodInterval
+		if err := db.Raw(query+" ORDER BY uah.user_id, uah.from_datetime", args...).Scan(&intervals).Error; err != nil {
+			return fmt.Errorf("failed to read activity intervals: %w", err)
+		}
+		for _, interval := range intervals {
+			period := periods[interval.UserID]
+			period.Intervals = append(period.Intervals, interval)
+		}
+
+		for _, id := range ids {
+			period := periods[id]
+			if len(period.Rollups) == 0 && len(period.Intervals) == 0 {
+				continue
+			}
+			if err := fn(period); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readPeriodRollups adds the rollups of the users' whole days to their
+// periods, returning the users with queued changes
+func readPeriodRollups(db *gorm.DB, ids []uuid.UUID, periods map[uuid.UUID]*activityPeriod, statuses map[string]periodStatus) ([]uuid.UUID, error) {
+	var queued []queuedRollup
+	if err := db.Raw("SELECT user_id, from_datetime, to_datetime FROM activity_rollup_queue WHERE user_id IN ?", ids).
+		Scan(&queued).Error; err != nil {
+		return nil, fmt.Errorf("failed to read queued activity changes: %w", err)
+	}
+	byUser := make(map[uuid.UUID][]queuedRollup)
+	for _, change := range queued {
+		byUser[change.UserID] = append(byUser[change.UserID], change)
+	}
+	staleUsers := make([]uuid.UUID, 0, len(byUser))
+	for userID, changes := range byUser {
+		periods[userID].stale = rollupSpans(changes, periods[userID].Loc)
+		staleUsers = append(staleUsers, userID)
+	}
+
+	// Local days are within a day of UTC ones
+	anyPeriod := periods[ids[0]]
+	var rows []struct {
+		UserID      uuid.UUID
+		Day         time.Time
+		StatusHours pgtype.JSONB
+		SignIns     int
+		SignOuts    int
+		LocationIDs pgtype.JSONB
+	}
+	if err := db.Raw("SELECT user_id, day, status_hours, sign_ins, sign_outs, location_ids FROM activity_rollups WHERE user_id IN ? AND day >= ? AND day <= ?",
+		ids, calendarDate(anyPeriod.from.UTC()).AddDate(0, 0, -1), calendarDate(anyPeriod.to.UTC()).AddDate(0, 0, 1)).
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to read activity rollups: %w", err)
+	}
+
+	for _, row := range rows {
+		period := periods[row.UserID]
+		day := time.Date(row.Day.Year(), row.Day.Month(), row.Day.Day(), 0, 0, 0, 0, period.Loc)
+		if !period.RolledUp(day) {
+			continue
+		}
+		statusHours := map[string]float64{}
+		if row.StatusHours.Status == pgtype.Present {
+			if err := json.Unmarshal(row.StatusHours.Bytes, &statusHours); err != nil {
+				return nil, fmt.Errorf("invalid activity rollup of user %s: %w", row.UserID, err)
+			}
+		}
+		hours := make(map[periodStatus]float64, len(statusHours))
+		for statusID, h := range statusHours {
+			status, ok := statuses[statusID]
+			if !ok {
+				status = periodStatus{Type: "other"}
+			}
+			hours[status] += h
+		}
+		var locationIDs []uuid.UUID
+		if row.LocationIDs.Status == pgtype.Present {
+			if err := json.Unmarshal(row.LocationIDs.Bytes, &locationIDs); err != nil {
+				return nil, fmt.Errorf("invalid activity rollup of user %s: %w", row.UserID, err)
+			}
+		}
+		period.Rollups = append(period.Rollups, periodRollup{Day: day, Hours: hours, SignIns: row.SignIns, SignOuts: row.SignOuts, LocationIDs: locationIDs})
+	}
+	for _, period := range periods {
+		sort.Slice(period.Rollups, func(i, j int) bool { return period.Rollups[i].Day.Before(period.Rollups[j].Day) })
+	}
+	return staleUsers, nil
+}
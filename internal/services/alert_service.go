@@ -0,0 +1,744 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Alert rule conditions: which failed authentication log entries count towards a rule
+const (
+	AlertConditionFailedAuth  = "failed_auth"  // Every failed authentication
+	AlertConditionReplayedOTP = "replayed_otp" // OTPs rejected as replayed
+)
+
+// Alert statuses
+const (
+	AlertStatusOpen         = "open"
+	AlertStatusAcknowledged = "acknowledged"
+	AlertStatusResolved     = "resolved"
+)
+
+// alertGroupKeys maps a rule's group_by to the authentication_logs expression it groups on
+var alertGroupKeys = map[string]string{
+	"user":       "CAST(user_id AS text)",
+	"device":     "CAST(device_id AS text)",
+	"ip_address": "ip_address",
+}
+
+var alertConditionLabels = map[string]string{
+	AlertConditionFailedAuth:  "failed authentications",
+	AlertConditionReplayedOTP: "replayed OTPs",
+}
+
+var alertSeverities = []string{"info", "warning", "critical"}
+
+var alertLogTypes = []string{"login", "logout", "refresh", "mfa", "action"}
+
+// AlertService manages alert rules and channels, evaluates the rules over the
+// authentication log and delivers the alerts they raise
+type AlertService struct {
+	db            *gorm.DB
+	config        *config.Config
+	notifications *NotificationService
+	translator    *Translator
+	stop          chan struct{}
+}
+
+// NewAlertService creates the service; alerts are written in the default
+// locale's notification.alert.* messages
+func NewAlertService(db *gorm.DB, config *config.Config, notifications *NotificationService, translator *Translator) *AlertService {
+	return &AlertService{
+		db:            db,
+		config:        config,
+		notifications: notifications,
+		translator:    translator,
+	}
+}
+
+// AlertFilter selects alerts; zero fields match everything
+type AlertFilter struct {
+	Status   string
+	Severity string
+	RuleID   *uuid.UUID
+	Limit    int
+	Offset   int
+}
+
+// AlertNotification is the alert as delivered to channels
+type AlertNotification struct {
+	ID            uuid.UUID  `json:"id"`
+	Rule          string     `json:"rule"`
+	Condition     string     `json:"condition"`
+	Severity      string     `json:"severity"`
+	GroupBy       string     `json:"group_by"`
+	Subject       string     `json:"subject"`
+	Username      string     `json:"username,omitempty"`
+	UserID        *uuid.UUID `json:"user_id,omitempty"`
+	Count         int        `json:"count"`
+	WindowMinutes int        `json:"window_minutes"`
+	FirstSeenAt   time.Time  `json:"first_seen_at"`
+	LastSeenAt    time.Time  `json:"last_seen_at"`
+}
+
+// alertMatch is one group of log entries matching a rule
+type alertMatch struct {
+	Subject   string
+	Count     int
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// CreateChannel creates a new alert delivery channel
+func (s *AlertService) CreateChannel(channel *database.AlertChannel) (*database.AlertChannel, error) {
+	if channel.Name == "" {
+		return nil, NewError(CodeValidationFailed, "channel name is required")
+	}
+	if err := validateAlertChannel(channel.Type, channel.Target); err != nil {
+		return nil, err
+	}
+
+	active := channel.Active
+	channel.ID = uuid.New()
+	if err := s.db.Create(channel).Error; err != nil {
+		return nil, fmt.Errorf("failed to create alert channel: %w", err)
+	}
+
+	// Create skips zero values for columns with defaults, so an inactive channel needs an explicit update
+	if !active {
+		if err := s.db.Model(channel).Update("active", false).Error; err != nil {
+			return nil, fmt.Errorf("failed to create alert channel: %w", err)
+		}
+	}
+
+	return s.GetChannelByID(channel.ID)
+}
+
+// GetChannelByID retrieves an alert channel by ID
+func (s *AlertService) GetChannelByID(id uuid.UUID) (*database.AlertChannel, error) {
+	var channel database.AlertChannel
+	if err := s.db.Where("id = ?", id).First(&channel).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "alert channel not found")
+		}
+		return nil, fmt.Errorf("failed to get alert channel: %w", err)
+	}
+	return &channel, nil
+}
+
+// ListChannels retrieves all alert channels
+func (s *AlertService) ListChannels() ([]database.AlertChannel, error) {
+	var channels []database.AlertChannel
+	if err := s.db.Order("name").Find(&channels).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch alert channels: %w", err)
+	}
+	return channels, nil
+}
+
+// UpdateChannel updates an alert channel
+func (s *AlertService) UpdateChannel(id uuid.UUID, updates map[string]interface{}) (*database.AlertChannel, error) {
+	channel, err := s.GetChannelByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate the channel as it will be after the update
+	channelType, target := channel.Type, channel.Target
+	if v, ok := updates["type"].(string); ok {
+		channelType = v
+	}
+	if v, ok := updates["target"].(string); ok {
+		target = v
+	}
+	if err := validateAlertChannel(channelType, target); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Model(&database.AlertChannel{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to update alert channel: %w", err)
+	}
+
+	return s.GetChannelByID(id)
+}
+
+// DeleteChannel permanently deletes an alert channel, removing it from every rule
+func (s *AlertService) DeleteChannel(id uuid.UUID) error {
+	result := s.db.Where("id = ?", id).Delete(&database.AlertChannel{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete alert channel: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return NewError(CodeNotFound, "alert channel not found")
+	}
+	return nil
+}
+
+// validateAlertChannel checks a channel's type and that its target suits it
+func validateAlertChannel(channelType, target string) error {
+	switch channelType {
+	case "email":
+		if len(splitRecipients(target)) == 0 {
+			return NewError(CodeValidationFailed, "target must list at least one email recipient")
+		}
+	case "webhook", "slack":
+		if validateWebhookURL(target) != nil {
+			return NewError(CodeValidationFailed, "target must be an absolute http or https URL")
+		}
+	default:
+		return NewError(CodeValidationFailed, "invalid channel type '%s'; use email, webhook or slack", channelType)
+	}
+	return nil
+}
+
+// CreateRule creates a new alert rule delivering to the given channels
+func (s *AlertService) CreateRule(rule *database.AlertRule, channelIDs []uuid.UUID) (*database.AlertRule, error) {
+	if rule.Name == "" {
+		return nil, NewError(CodeValidationFailed, "rule name is required")
+	}
+	if rule.GroupBy == "" {
+		rule.GroupBy = "user"
+	}
+	if rule.Severity == "" {
+		rule.Severity = "warning"
+	}
+	if rule.WindowMinutes == 0 {
+		rule.WindowMinutes = 10
+	}
+	if err := validateAlertRule(rule); err != nil {
+		return nil, err
+	}
+
+	channels, err := s.channelsByID(channelIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	active := rule.Active
+	rule.ID = uuid.New()
+	rule.Channels = nil
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(rule).Error; err != nil {
+			return err
+		}
+		// Create skips zero values for columns with defaults, so an inactive rule needs an explicit update
+		if !active {
+			if err := tx.Model(rule).Update("active", false).Error; err != nil {
+				return err
+			}
+		}
+		if len(channels) > 0 {
+			return tx.Model(rule).Association("Channels").Replace(channels)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create alert rule: %w", err)
+	}
+
+	return s.GetRuleByID(rule.ID)
+}
+
+// GetRuleByID retrieves an alert rule by ID, with its channels
+func (s *AlertService) GetRuleByID(id uuid.UUID) (*database.AlertRule, error) {
+	var rule database.AlertRule
+	if err := s.db.Preload("Channels").Where("id = ?", id).First(&rule).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "alert rule not found")
+		}
+		return nil, fmt.Errorf("failed to get alert rule: %w", err)
+	}
+	return &rule, nil
+}
+
+// ListRules retrieves alert rules with their channels, optionally only active ones
+func (s *AlertService) ListRules(activeOnly bool) ([]database.AlertRule, error) {
+	var rules []database.AlertRule
+	query := s.db.Preload("Channels")
+	if activeOnly {
+		query = query.Where("active = ?", true)
+	}
+	if err := query.Order("name").Find(&rules).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch alert rules: %w", err)
+	}
+	return rules, nil
+}
+
+// UpdateRule updates an alert rule. A non-nil channelIDs replaces its channels.
+func (s *AlertService) UpdateRule(id uuid.UUID, updates map[string]interface{}, channelIDs []uuid.UUID) (*database.AlertRule, error) {
+	rule, err := s.GetRuleByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate the rule as it will be after the update
+	merged := *rule
+	if v, ok := updates["condition"].(string); ok {
+		merged.Condition = v
+	}
+	if v, ok := updates["log_type"].(string); ok {
+		merged.LogType = v
+	}
+	if v, ok := updates["group_by"].(string); ok {
+		merged.GroupBy = v
+	}
+	if v, ok := updates["threshold"].(int); ok {
+		merged.Threshold = v
+	}
+	if v, ok := updates["window_minutes"].(int); ok {
+		merged.WindowMinutes = v
+	}
+	if v, ok := updates["severity"].(string); ok {
+		merged.Severity = v
+	}
+	if err := validateAlertRule(&merged); err != nil {
+		return nil, err
+	}
+
+	var channels []database.AlertChannel
+	if channelIDs != nil {
+		if channels, err = s.channelsByID(channelIDs); err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if len(updates) > 0 {
+			if err := tx.Model(&database.AlertRule{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		if channelIDs != nil {
+			return tx.Model(rule).Association("Channels").Replace(channels)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update alert rule: %w", err)
+	}
+
+	return s.GetRuleByID(id)
+}
+
+// DeleteRule permanently deletes an alert rule and the alerts it raised
+func (s *AlertService) DeleteRule(id uuid.UUID) error {
+	result := s.db.Where("id = ?", id).Delete(&database.AlertRule{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete alert rule: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return NewError(CodeNotFound, "alert rule not found")
+	}
+	return nil
+}
+
+// validateAlertRule checks the condition, grouping and limits of a rule
+func validateAlertRule(rule *database.AlertRule) error {
+	if _, ok := alertConditionLabels[rule.Condition]; !ok {
+		return NewError(CodeValidationFailed, "invalid condition '%s'; use %s or %s", rule.Condition, AlertConditionFailedAuth, AlertConditionReplayedOTP)
+	}
+	if _, ok := alertGroupKeys[rule.GroupBy]; !ok {
+		return NewError(CodeValidationFailed, "invalid group_by '%s'; use user, device or ip_address", rule.GroupBy)
+	}
+	if rule.LogType != "" && !slices.Contains(alertLogTypes, rule.LogType) {
+		return NewError(CodeValidationFailed, "invalid log_type '%s'; use %s", rule.LogType, strings.Join(alertLogTypes, ", "))
+	}
+	if !slices.Contains(alertSeverities, rule.Severity) {
+		return NewError(CodeValidationFailed, "invalid severity '%s'; use %s", rule.Severity, strings.Join(alertSeverities, ", "))
+	}
+	if rule.Threshold < 0 {
+		return NewError(CodeValidationFailed, "threshold must not be negative")
+	}
+	if rule.WindowMinutes < 1 {
+		return NewError(CodeValidationFailed, "window_minutes must be at least 1")
+	}
+	return nil
+}
+
+// channelsByID loads the given channels, failing if any does not exist
+func (s *AlertService) channelsByID(ids []uuid.UUID) ([]database.AlertChannel, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var channels []database.AlertChannel
+	if err := s.db.Where("id IN ?", ids).Find(&channels).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch alert channels: %w", err)
+	}
+	found := make(map[uuid.UUID]bool, len(channels))
+	for _, channel := range channels {
+		found[channel.ID] = true
+	}
+	for _, id := range ids {
+		if !found[id] {
+			return nil, NewError(CodeValidationFailed, "alert channel %s not found", id)
+		}
+	}
+	return channels, nil
+}
+
+// ListAlerts returns a page of matching alerts, newest first, and the total number of matches
+func (s *AlertService) ListAlerts(filter AlertFilter) ([]database.Alert, int64, error) {
+	query := s.db.Model(&database.Alert{})
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Severity != "" {
+		query = query.Where("severity = ?", filter.Severity)
+	}
+	if filter.RuleID != nil {
+		query = query.Where("rule_id = ?", *filter.RuleID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count alerts: %w", err)
+	}
+
+	var alerts []database.Alert
+	if err := query.Preload("Rule").Preload("User").Order("created_at DESC").
+		Limit(filter.Limit).Offset(filter.Offset).Find(&alerts).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch alerts: %w", err)
+	}
+	return alerts, total, nil
+}
+
+// GetAlertByID retrieves an alert by ID
+func (s *AlertService) GetAlertByID(id uuid.UUID) (*database.Alert, error) {
+	var alert database.Alert
+	if err := s.db.Preload("Rule").Preload("User").Where("id = ?", id).First(&alert).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "alert not found")
+		}
+		return nil, fmt.Errorf("failed to get alert: %w", err)
+	}
+	return &alert, nil
+}
+
+// AcknowledgeAlert marks an open alert as being looked at. It stays
+// acknowledged, absorbing further matches, until it is resolved.
+func (s *AlertService) AcknowledgeAlert(id, acknowledgedByID uuid.UUID) (*database.Alert, error) {
+	alert, err := s.GetAlertByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if alert.Status != AlertStatusOpen {
+		return nil, NewError(CodeConflict, "alert is already %s", alert.Status)
+	}
+
+	updates := map[string]interface{}{
+		"status":             AlertStatusAcknowledged,
+		"acknowledged_at":    time.Now(),
+		"acknowledged_by_id": acknowledgedByID,
+	}
+	if err := s.db.Model(&database.Alert{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to acknowledge alert: %w", err)
+	}
+
+	return s.GetAlertByID(id)
+}
+
+// ResolveAlert closes an open or acknowledged alert. Matches after its last
+// seen entry raise a new alert.
+func (s *AlertService) ResolveAlert(id, resolvedByID uuid.UUID, note string) (*database.Alert, error) {
+	alert, err := s.GetAlertByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if alert.Status == AlertStatusResolved {
+		return nil, NewError(CodeConflict, "alert is already resolved")
+	}
+
+	updates := map[string]interface{}{
+		"status":          AlertStatusResolved,
+		"resolved_at":     time.Now(),
+		"resolved_by_id":  resolvedByID,
+		"resolution_note": note,
+	}
+	if err := s.db.Model(&database.Alert{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to resolve alert: %w", err)
+	}
+
+	return s.GetAlertByID(id)
+}
+
+// StartEvaluator periodically evaluates the active alert rules.
+// It does nothing when alerting.evaluate_interval is zero.
+func (s *AlertService) StartEvaluator() {
+	interval := s.config.Alerting.EvaluateInterval
+	if interval <= 0 || s.stop != nil {
+		return
+	}
+
+	s.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.EvaluateRules(time.Now()); err != nil {
+					log.Printf("Alert rule evaluation failed: %v", err)
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopEvaluator stops the background rule evaluator
+func (s *AlertService) StopEvaluator() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// EvaluateRules checks every active rule against the failed authentications
+// in its window, raising and delivering an alert for each group over the
+// threshold that has no open or acknowledged alert, and updating the ones that do
+func (s *AlertService) EvaluateRules(now time.Time) error {
+	rules, err := s.ListRules(true)
+	if err != nil {
+		return err
+	}
+
+	for i := range rules {
+		rule := &rules[i]
+		windowStart := now.Add(-time.Duration(rule.WindowMinutes) * time.Minute)
+
+		var matches []alertMatch
+		if err := s.groupMatches(rule, windowStart, "", &matches); err != nil {
+			log.Printf("Failed to evaluate alert rule '%s': %v", rule.Name, err)
+			continue
+		}
+		for _, match := range matches {
+			if err := s.applyMatch(rule, match); err != nil {
+				log.Printf("Failed to raise alert '%s' for %s: %v", rule.Name, match.Subject, err)
+			}
+		}
+	}
+	return nil
+}
+
+// applyMatch raises a new alert for a group over a rule's threshold, or adds
+// the group's new entries to its open or acknowledged alert
+func (s *AlertService) applyMatch(rule *database.AlertRule, match alertMatch) error {
+	var latest database.Alert
+	err := s.db.Where("rule_id = ? AND subject = ?", rule.ID, match.Subject).Order("created_at DESC").First(&latest).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("failed to fetch previous alert: %w", err)
+	}
+	found := err == nil
+
+	if found && latest.Status != AlertStatusResolved {
+		if !match.LastSeen.After(latest.LastSeenAt) {
+			return nil
+		}
+		var newEntries int64
+		err := s.matchQuery(rule, latest.LastSeenAt, match.Subject).
+			Where("created_at <= ?", match.LastSeen).Count(&newEntries).Error
+		if err != nil {
+			return fmt.Errorf("failed to count new entries: %w", err)
+		}
+		return s.db.Model(&latest).Updates(map[string]interface{}{
+			"count":        latest.Count + int(newEntries),
+			"last_seen_at": match.LastSeen,
+		}).Error
+	}
+
+	// Entries up to a resolved alert's last one were dealt with; only later ones count
+	if found && !match.FirstSeen.After(latest.LastSeenAt) {
+		var recent []alertMatch
+		if err := s.groupMatches(rule, latest.LastSeenAt, match.Subject, &recent); err != nil {
+			return err
+		}
+		if len(recent) == 0 {
+			return nil
+		}
+		match = recent[0]
+	}
+
+	return s.raiseAlert(rule, match)
+}
+
+// matchQuery selects the failed authentications counting towards a rule
+// logged after the given time, optionally for one subject
+func (s *AlertService) matchQuery(rule *database.AlertRule, after time.Time, subject string) *gorm.DB {
+	key := alertGroupKeys[rule.GroupBy]
+	query := s.db.Model(&database.AuthenticationLog{}).
+		Where("success = ?", false).
+		Where("created_at > ?", after)
+	if rule.LogType != "" {
+		query = query.Where("type = ?", rule.LogType)
+	}
+	if rule.Condition == AlertConditionReplayedOTP {
+		query = query.Where("details->>'error_code' = ?", string(CodeAuthReplayedOTP))
+	}
+	switch rule.GroupBy {
+	case "user":
+		query = query.Where("user_id IS NOT NULL")
+	case "device":
+		query = query.Where("device_id <> ?", uuid.Nil)
+	case "ip_address":
+		query = query.Where("ip_address <> ''")
+	}
+	if subject != "" {
+		query = query.Where(key+" = ?", subject)
+	}
+	return query
+}
+
+// groupMatches finds the groups with more than the rule's threshold of matching entries
+func (s *AlertService) groupMatches(rule *database.AlertRule, after time.Time, subject string, matches *[]alertMatch) error {
+	key := alertGroupKeys[rule.GroupBy]
+	err := s.matchQuery(rule, after, subject).
+		Select(key+" AS subject, COUNT(*) AS count, MIN(created_at) AS first_seen, MAX(created_at) AS last_seen").
+		Group(key).
+		Having("COUNT(*) > ?", rule.Threshold).
+		Scan(matches).Error
+	if err != nil {
+		return fmt.Errorf("failed to query authentication logs: %w", err)
+	}
+	return nil
+}
+
+// raiseAlert records a new alert and delivers it to the rule's channels
+func (s *AlertService) raiseAlert(rule *database.AlertRule, match alertMatch) error {
+	alert := database.Alert{
+		ID:          uuid.New(),
+		RuleID:      rule.ID,
+		Subject:     match.Subject,
+		Severity:    rule.Severity,
+		Count:       match.Count,
+		FirstSeenAt: match.FirstSeen,
+		LastSeenAt:  match.LastSeen,
+		Status:      AlertStatusOpen,
+	}
+	switch rule.GroupBy {
+	case "user":
+		if id, err := uuid.Parse(match.Subject); err == nil {
+			alert.UserID = &id
+		}
+	case "device":
+		if id, err := uuid.Parse(match.Subject); err == nil {
+			alert.DeviceID = &id
+		}
+	case "ip_address":
+		alert.IPAddress = match.Subject
+	}
+	if err := s.db.Create(&alert).Error; err != nil {
+		return fmt.Errorf("failed to record alert: %w", err)
+	}
+
+	if err := s.deliver(rule, &alert); err != nil {
+		s.db.Model(&alert).Update("delivery_error", err.Error())
+		return err
+	}
+	return nil
+}
+
+// deliver sends an alert to each of the rule's active channels
+func (s *AlertService) deliver(rule *database.AlertRule, alert *database.Alert) error {
+	notification := AlertNotification{
+		ID:            alert.ID,
+		Rule:          rule.Name,
+		Condition:     rule.Condition,
+		Severity:      alert.Severity,
+		GroupBy:       rule.GroupBy,
+		Subject:       alert.Subject,
+		UserID:        alert.UserID,
+		Count:         alert.Count,
+		WindowMinutes: rule.WindowMinutes,
+		FirstSeenAt:   alert.FirstSeenAt,
+		LastSeenAt:    alert.LastSeenAt,
+	}
+	if alert.UserID != nil {
+		s.db.Unscoped().Model(&database.User{}).Select("username").Where("id = ?", *alert.UserID).Scan(&notification.Username)
+	}
+	locale := s.translator.DefaultLocale()
+	data := alertMessageData(notification)
+	summary := s.translator.Translate(locale, "notification.alert.summary", data)
+	body := s.translator.Translate(locale, "notification.alert.body", data)
+
+	payload := map[string]interface{}{
+		"event": "alert.raised",
+		"alert": notification,
+	}
+	return s.send(rule.Channels, summary, body, payload)
+}
+
+// NotifyChannels sends a notice other than an alert to the active channels
+// named, or to every active channel when names is empty: summary as the email
+// subject and Slack message, body as the email text, and payload to webhooks
+func (s *AlertService) NotifyChannels(names []string, summary, body string, payload map[string]interface{}) error {
+	query := s.db.Where("active = ?", true)
+	if len(names) > 0 {
+		query = query.Where("name IN ?", names)
+	}
+	var channels []database.AlertChannel
+	if err := query.Order("name").Find(&channels).Error; err != nil {
+		return fmt.Errorf("failed to fetch alert channels: %w", err)
+	}
+	return s.send(channels, summary, body, payload)
+}
+
+// send delivers a notice to each active channel, recording the outcome on the
+// channel
+func (s *AlertService) send(channels []database.AlertChannel, summary, body string, payload map[string]interface{}) error {
+	var errs []string
+	for i := range channels {
+		channel := &channels[i]
+		if !channel.Active {
+			continue
+		}
+
+		var err error
+		switch channel.Type {
+		case "email":
+			err = s.notifications.SendEmail(splitRecipients(channel.Target), summary, body)
+		case "webhook":
+			err = s.notifications.SendSignedWebhook(channel.Target, channel.Secret, payload, nil)
+		case "slack":
+			err = s.notifications.SendWebhook(channel.Target, map[string]string{"text": summary})
+		}
+
+		updates := map[string]interface{}{"last_delivery_at": time.Now(), "last_error": ""}
+		if err != nil {
+			updates["last_error"] = err.Error()
+			errs = append(errs, fmt.Sprintf("%s: %v", channel.Name, err))
+		}
+		s.db.Model(channel).Updates(updates)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// alertMessageData is what the notification.alert.* messages are rendered
+// with: the summary is the email subject and Slack message, the body the email
+// text
+func alertMessageData(n AlertNotification) map[string]interface{} {
+	return map[string]interface{}{
+		"AlertID":       n.ID,
+		"Rule":          n.Rule,
+		"Severity":      n.Severity,
+		"Condition":     alertConditionLabels[n.Condition],
+		"GroupBy":       strings.ReplaceAll(n.GroupBy, "_", " "),
+		"Subject":       n.Subject,
+		"Username":      n.Username,
+		"Count":         n.Count,
+		"WindowMinutes": n.WindowMinutes,
+		"FirstSeenAt":   n.FirstSeenAt,
+		"LastSeenAt":    n.LastSeenAt,
+	}
+}
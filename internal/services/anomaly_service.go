@@ -0,0 +1,343 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Anomaly types
+const (
+	AnomalyUnusualHour  = "unusual_hour"  // A login at an unusual hour of the user's day
+	AnomalyOpenActivity = "open_activity" // An activity left open past anomalies.open_activity_max
+	AnomalyDistantIPs   = "distant_ips"   // Logins from several networks within anomalies.ip_window
+)
+
+// AnomalyTypes are the anomaly types the analyzer flags
+var AnomalyTypes = []string{AnomalyUnusualHour, AnomalyOpenActivity, AnomalyDistantIPs}
+
+// Anomaly statuses
+const (
+	AnomalyStatusOpen         = "open"
+	AnomalyStatusAcknowledged = "acknowledged"
+	AnomalyStatusResolved     = "resolved"
+)
+
+// AnomalyFilter selects anomalies to list; zero values match everything
+type AnomalyFilter struct {
+	Status string
+	Type   string
+	UserID *uuid.UUID
+	Limit  int
+	Offset int
+}
+
+// AnomalyService runs the analyzer that flags unusual sign-ins and activity
+// as anomaly events, and the review of those events
+type AnomalyService struct {
+	db     *gorm.DB
+	config config.AnomaliesConfig
+	stop   chan struct{}
+}
+
+func NewAnomalyService(db *gorm.DB, cfg config.AnomaliesConfig) *AnomalyService {
+	return &AnomalyService{
+		db:     db,
+		config: cfg,
+	}
+}
+
+// anomalyLogin is a successful login the analyzer looks at
+type anomalyLogin struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	IPAddress string
+	CreatedAt time.Time
+	Timezone  string // The user's
+}
+
+// ListAnomalies returns a page of matching anomalies, newest first, and the total number of matches
+func (s *AnomalyService) ListAnomalies(filter AnomalyFilter) ([]database.AnomalyEvent, int64, error) {
+	query := s.db.Model(&database.AnomalyEvent{})
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.UserID != nil {
+		query = query.Where("user_id = ?", *filter.UserID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count anomalies: %w", err)
+	}
+
+	var anomalies []database.AnomalyEvent
+	if err := query.Preload("User").Order("occurred_at DESC").
+		Limit(filter.Limit).Offset(filter.Offset).Find(&anomalies).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch anomalies: %w", err)
+	}
+	return anomalies, total, nil
+}
+
+// GetAnomalyByID retrieves an anomaly by ID
+func (s *AnomalyService) GetAnomalyByID(id uuid.UUID) (*database.AnomalyEvent, error) {
+	var anomaly database.AnomalyEvent
+	if err := s.db.Preload("User").Where("id = ?", id).First(&anomaly).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "anomaly not found")
+		}
+		return nil, fmt.Errorf("failed to get anomaly: %w", err)
+	}
+	return &anomaly, nil
+}
+
+// AcknowledgeAnomaly marks an open anomaly as under review
+func (s *AnomalyService) AcknowledgeAnomaly(id, acknowledgedByID uuid.UUID) (*database.AnomalyEvent, error) {
+	anomaly, err := s.GetAnomalyByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if anomaly.Status != AnomalyStatusOpen {
+		return nil, NewError(CodeConflict, "anomaly is already %s", anomaly.Status)
+	}
+
+	updates := map[string]interface{}{
+		"status":             AnomalyStatusAcknowledged,
+		"acknowledged_at":    time.Now(),
+		"acknowledged_by_id": acknowledgedByID,
+	}
+	if err := s.db.Model(&database.AnomalyEvent{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to acknowledge anomaly: %w", err)
+	}
+
+	return s.GetAnomalyByID(id)
+}
+
+// ResolveAnomaly closes an open or acknowledged anomaly once reviewed
+func (s *AnomalyService) ResolveAnomaly(id, resolvedByID uuid.UUID, note string) (*database.AnomalyEvent, error) {
+	anomaly, err := s.GetAnomalyByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if anomaly.Status == AnomalyStatusResolved {
+		return nil, NewError(CodeConflict, "anomaly is already resolved")
+	}
+
+	updates := map[string]interface{}{
+		"status":          AnomalyStatusResolved,
+		"resolved_at":     time.Now(),
+		"resolved_by_id":  resolvedByID,
+		"resolution_note": note,
+	}
+	if err := s.db.Model(&database.AnomalyEvent{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to resolve anomaly: %w", err)
+	}
+
+	return s.GetAnomalyByID(id)
+}
+
+// StartAnalyzer periodically flags anomalies.
+// It does nothing when anomalies.analyze_interval is zero.
+func (s *AnomalyService) StartAnalyzer() {
+	interval := s.config.AnalyzeInterval
+	if interval <= 0 || s.stop != nil {
+		return
+	}
+
+	s.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.Analyze(time.Now()); err != nil {
+					log.Printf("Anomaly analysis failed: %v", err)
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopAnalyzer stops the background analyzer
+func (s *AnomalyService) StopAnalyzer() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// Analyze flags the anomalies up to now that have not been flagged yet: logins
+// within anomalies.lookback at unusual hours or from distant networks, and
+// activities open longer than anomalies.open_activity_max
+func (s *AnomalyService) Analyze(now time.Time) error {
+	since := now.Add(-maxDuration(s.config.Lookback, s.config.IPWindow))
+	var logins []anomalyLogin
+	if err := s.db.Table("authentication_logs l").
+		Select("l.id, l.user_id, l.ip_address, l.created_at, u.timezone").
+		Joins("JOIN users u ON u.id = l.user_id").
+		Where("l.success AND l.type = ? AND l.created_at >= ? AND l.created_at <= ?", "login", since, now).
+		Order("l.created_at").Scan(&logins).Error; err != nil {
+		return fmt.Errorf("failed to fetch logins: %w", err)
+	}
+
+	s.flagUnusualHours(logins, now.Add(-s.config.Lookback))
+	s.flagDistantIPs(logins, now)
+	return s.flagOpenActivities(now)
+}
+
+// flagUnusualHours flags logins since start made at unusual hours in the user's timezone
+func (s *AnomalyService) flagUnusualHours(logins []anomalyLogin, start time.Time) {
+	from, to := s.config.UnusualHoursStart, s.config.UnusualHoursEnd
+	if from == to {
+		return
+	}
+	for _, login := range logins {
+		if login.CreatedAt.Before(start) {
+			continue
+		}
+		local := login.CreatedAt.In(loadTimezone(login.Timezone))
+		hour := local.Hour()
+		unusual := hour >= from && hour < to
+		if from > to {
+			unusual = hour >= from || hour < to
+		}
+		if !unusual {
+			continue
+		}
+		authLogID := login.ID
+		s.flag(&database.AnomalyEvent{
+			Type:       AnomalyUnusualHour,
+			UserID:     login.UserID,
+			IPAddress:  login.IPAddress,
+			Details:    fmt.Sprintf("login at %s %s, outside %02d:00-%02d:00", local.Format("15:04"), local.Location(), to, from),
+			AuthLogID:  &authLogID,
+			OccurredAt: login.CreatedAt,
+			DedupeKey:  AnomalyUnusualHour + ":" + login.ID.String(),
+		})
+	}
+}
+
+// flagDistantIPs flags users whose logins within anomalies.ip_window of now
+// came from at least anomalies.ip_networks networks, once per window
+func (s *AnomalyService) flagDistantIPs(logins []anomalyLogin, now time.Time) {
+	windowStart := now.Add(-s.config.IPWindow)
+	networks := map[uuid.UUID]map[string]bool{}
+	latest := map[uuid.UUID]anomalyLogin{}
+	for _, login := range logins {
+		if login.CreatedAt.Before(windowStart) || login.IPAddress == "" {
+			continue
+		}
+		if networks[login.UserID] == nil {
+			networks[login.UserID] = map[string]bool{}
+		}
+		networks[login.UserID][ipNetwork(login.IPAddress)] = true
+		latest[login.UserID] = login
+	}
+
+	for userID, seen := range networks {
+		if len(seen) < s.config.IPNetworks {
+			continue
+		}
+		var recent int64
+		if err := s.db.Model(&database.AnomalyEvent{}).
+			Where("user_id = ? AND type = ? AND occurred_at >= ?", userID, AnomalyDistantIPs, windowStart).
+			Count(&recent).Error; err != nil {
+			log.Printf("Failed to check distant IP anomalies of user %s: %v", userID, err)
+			continue
+		}
+		if recent > 0 {
+			continue
+		}
+
+		names := make([]string, 0, len(seen))
+		for network := range seen {
+			names = append(names, network)
+		}
+		sort.Strings(names)
+		login := latest[userID]
+		authLogID := login.ID
+		s.flag(&database.AnomalyEvent{
+			Type:       AnomalyDistantIPs,
+			UserID:     userID,
+			IPAddress:  login.IPAddress,
+			Details:    fmt.Sprintf("logins from %d networks within %s: %s", len(names), s.config.IPWindow, strings.Join(names, ", ")),
+			AuthLogID:  &authLogID,
+			OccurredAt: login.CreatedAt,
+			DedupeKey:  AnomalyDistantIPs + ":" + login.ID.String(),
+		})
+	}
+}
+
+// flagOpenActivities flags activities open longer than anomalies.open_activity_max
+func (s *AnomalyService) flagOpenActivities(now time.Time) error {
+	var activities []database.UserActivityHistory
+	if err := s.db.Where("to_datetime IS NULL AND from_datetime < ?", now.Add(-s.config.OpenActivityMax)).
+		Find(&activities).Error; err != nil {
+		return fmt.Errorf("failed to fetch open activities: %w", err)
+	}
+
+	for _, activity := range activities {
+		activityID := activity.ID
+		s.flag(&database.AnomalyEvent{
+			Type:       AnomalyOpenActivity,
+			UserID:     activity.UserID,
+			Details:    fmt.Sprintf("activity open since %s, over %s", activity.FromDateTime.UTC().Format(time.RFC3339), s.config.OpenActivityMax),
+			ActivityID: &activityID,
+			OccurredAt: activity.FromDateTime,
+			DedupeKey:  AnomalyOpenActivity + ":" + activity.ID.String(),
+		})
+	}
+	return nil
+}
+
+// flag records an anomaly unless one with its dedupe key already exists
+func (s *AnomalyService) flag(anomaly *database.AnomalyEvent) {
+	anomaly.ID = uuid.New()
+	anomaly.Status = AnomalyStatusOpen
+	if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(anomaly).Error; err != nil {
+		log.Printf("Failed to record %s anomaly for user %s: %v", anomaly.Type, anomaly.UserID, err)
+	}
+}
+
+// ipNetwork is the network an address is counted in for distant_ips: its
+// IPv4 /16 or IPv6 /32, or the address itself if it does not parse
+func ipNetwork(address string) string {
+	ip, err := netip.ParseAddr(address)
+	if err != nil {
+		return address
+	}
+	ip = ip.Unmap()
+	bits := 32
+	if ip.Is4() {
+		bits = 16
+	}
+	prefix, err := ip.Prefix(bits)
+	if err != nil {
+		return address
+	}
+	return prefix.String()
+}
+
+// maxDuration returns the longer of two durations
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,311 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+)
+
+// ArchiveStore keeps the files retention archival writes. Keys are
+// slash-separated paths such as authentication_logs/<range>.ndjson.gz.
+type ArchiveStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	// List returns the keys under prefix, sorted
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// NewArchiveStore returns the S3 store when retention.archive.s3.bucket is
+// set, else the directory store on retention.archive.dir
+func NewArchiveStore(cfg config.ArchiveConfig) (ArchiveStore, error) {
+	if cfg.S3.Bucket != "" {
+		return &s3ArchiveStore{config: cfg.S3, client: &http.Client{Timeout: 5 * time.Minute}}, nil
+	}
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("no archive storage configured: set retention.archive.dir or retention.archive.s3.bucket")
+	}
+	return &dirArchiveStore{dir: cfg.Dir}, nil
+}
+
+// dirArchiveStore keeps archives in a local directory
+type dirArchiveStore struct {
+	dir string
+}
+
+func (s *dirArchiveStore) Put(ctx context.Context, key string, data []byte) error {
+	path := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	// Written aside and renamed, so a crash never leaves a partial archive
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o640); err != nil {
+		return fmt.Errorf("failed to write archive %s: %w", key, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write archive %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *dirArchiveStore) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, filepath.FromSlash(key)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive %s: %w", key, err)
+	}
+	return data, nil
+}
+
+func (s *dirArchiveStore) List(ctx context.Context, prefix string) ([]string, error) {
+	root := filepath.Join(s.dir, filepath.FromSlash(prefix))
+	var keys []string
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || strings.HasSuffix(path, ".tmp") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, filepath.ToSlash(rel))
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list archives: %w", err)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// s3ArchiveStore keeps archives in an S3 bucket, or an S3-compatible store
+// such as MinIO when an endpoint is set, signing requests with AWS Signature
+// Version 4
+type s3ArchiveStore struct {
+	config config.S3Config
+	client *http.Client
+}
+
+func (s *s3ArchiveStore) Put(ctx context.Context, key string, data []byte) error {
+	resp, err := s.do(ctx, http.MethodPut, s.objectKey(key), nil, data)
+	if err != nil {
+		return fmt.Errorf("failed to upload archive %s: %w", key, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *s3ArchiveStore) Get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := s.do(ctx, http.MethodGet, s.objectKey(key), nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download archive %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download archive %s: %w", key, err)
+	}
+	return data, nil
+}
+
+func (s *s3ArchiveStore) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	query := url.Values{"list-type": {"2"}, "prefix": {s.objectKey(prefix)}}
+	for {
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list archives: %w", err)
+		}
+		var result struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list archives: %w", err)
+		}
+		for _, object := range result.Contents {
+			keys = append(keys, strings.TrimPrefix(object.Key, s.keyPrefix()))
+		}
+		if !result.IsTruncated {
+			break
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// keyPrefix is retention.archive.s3.prefix as a directory, or empty
+func (s *s3ArchiveStore) keyPrefix() string {
+	prefix := strings.Trim(s.config.Prefix, "/")
+	if prefix == "" {
+		return ""
+	}
+	return prefix + "/"
+}
+
+// objectKey is the bucket key of an archive key
+func (s *s3ArchiveStore) objectKey(key string) string {
+	return s.keyPrefix() + key
+}
+
+// do sends a signed request for an object, or for the bucket when key is
+// empty, failing on non-2xx responses
+func (s *s3ArchiveStore) do(ctx context.Context, method, key string, query url.Values, body []byte) (*http.Response, error) {
+	// Virtual-hosted style on AWS; path style on custom endpoints, which
+	// rarely have per-bucket host names
+	var endpoint *url.URL
+	var err error
+	path := "/"
+	if s.config.Endpoint != "" {
+		endpoint, err = url.Parse(strings.TrimSuffix(s.config.Endpoint, "/"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid retention.archive.s3.endpoint: %w", err)
+		}
+		path = endpoint.Path + "/" + s.config.Bucket
+		if key != "" {
+			path += "/" + key
+		}
+	} else {
+		endpoint = &url.URL{Scheme: "https", Host: fmt.Sprintf("%s.s3.%s.amazonaws.com", s.config.Bucket, s.config.Region)}
+		path = "/" + key
+	}
+
+	requestURL := *endpoint
+	requestURL.Path = path
+	requestURL.RawPath = awsEscape(path, false)
+	requestURL.RawQuery = awsCanonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, requestURL.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, requestURL.RawPath, body, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("S3 returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return resp, nil
+}
+
+// sign adds the AWS Signature Version 4 headers to req
+func (s *s3ArchiveStore) sign(req *http.Request, canonicalPath string, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.config.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.config.SessionToken)
+	}
+
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	if s.config.SessionToken != "" {
+		headers["x-amz-security-token"] = s.config.SessionToken
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method, canonicalPath, req.URL.RawQuery, canonicalHeaders.String(), signedHeaders, payloadHash,
+	}, "\n")
+	scope := date + "/" + s.config.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.config.SecretAccessKey), date)
+	for _, part := range []string{s.config.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.config.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// awsCanonicalQuery encodes query parameters sorted by name, as signing needs
+func awsCanonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		for _, value := range query[name] {
+			parts = append(parts, awsEscape(name, true)+"="+awsEscape(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsEscape percent-encodes everything but RFC 3986 unreserved characters,
+// and slashes unless encodeSlash is set
+func awsEscape(value string, encodeSlash bool) string {
+	var escaped strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case b >= 'A' && b <= 'Z', b >= 'a' && b <= 'z', b >= '0' && b <= '9',
+			b == '-', b == '_', b == '.', b == '~', b == '/' && !encodeSlash:
+			escaped.WriteByte(b)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
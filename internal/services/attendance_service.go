@@ -0,0 +1,641 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type AttendanceService struct {
+	db            *gorm.DB
+	config        *config.Config
+	notifications *NotificationService
+	translator    *Translator
+	stop          chan struct{}
+}
+
+func NewAttendanceService(db *gorm.DB, config *config.Config, notifications *NotificationService, translator *Translator) *AttendanceService {
+	return &AttendanceService{
+		db:            db,
+		config:        config,
+		notifications: notifications,
+		translator:    translator,
+	}
+}
+
+// AttendanceFilter selects the users and period covered by an attendance report
+type AttendanceFilter struct {
+	UserIDs []uuid.UUID `json:"user_ids"`
+	From    time.Time   `json:"from"`
+	To      time.Time   `json:"to"`
+}
+
+// AttendanceDay compares a user's worked hours on a single day with their policy
+type AttendanceDay struct {
+	UserID         uuid.UUID  `json:"user_id"`
+	UserName       string     `json:"user_name"`
+	Date           string     `json:"date" format:"date"`
+	PolicyID       uuid.UUID  `json:"policy_id"`
+	PolicyName     string     `json:"policy_name"`
+	Holiday        string     `json:"holiday,omitempty" doc:"Public holiday on the day, when no hours are expected"`
+	ExpectedHours  float64    `json:"expected_hours"`
+	WorkedHours    float64    `json:"worked_hours"`
+	OvertimeHours  float64    `json:"overtime_hours"`
+	UndertimeHours float64    `json:"undertime_hours"`
+	FirstSignIn    *time.Time `json:"first_sign_in"`
+	Late           bool       `json:"late"`
+	LateMinutes    float64    `json:"late_minutes"`
+}
+
+// AttendanceTotals sums a user's attendance over the report period
+type AttendanceTotals struct {
+	UserID         uuid.UUID `json:"user_id"`
+	UserName       string    `json:"user_name"`
+	ExpectedHours  float64   `json:"expected_hours"`
+	WorkedHours    float64   `json:"worked_hours"`
+	OvertimeHours  float64   `json:"overtime_hours"`
+	UndertimeHours float64   `json:"undertime_hours"`
+	LateSignIns    int       `json:"late_sign_ins"`
+}
+
+// AttendanceReport holds the per-day rows and per-user totals of an attendance report
+type AttendanceReport struct {
+	Days   []AttendanceDay    `json:"days"`
+	Totals []AttendanceTotals `json:"totals"`
+}
+
+// attendanceInterval is a single working interval as read for attendance evaluation
+type attendanceInterval struct {
+	UserID       uuid.UUID
+	FromDateTime time.Time  `gorm:"column:from_datetime"`
+	ToDateTime   *time.Time `gorm:"column:to_datetime"`
+	LocationID   *uuid.UUID
+}
+
+// attendanceDayState accumulates a user's working time on one day
+type attendanceDayState struct {
+	worked      float64
+	firstSignIn *time.Time
+	locationID  *uuid.UUID
+}
+
+var weekdayAbbreviations = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// CreatePolicy creates a new attendance policy
+func (s *AttendanceService) CreatePolicy(policy *database.AttendancePolicy) (*database.AttendancePolicy, error) {
+	if policy.Name == "" {
+		return nil, NewError(CodeValidationFailed, "policy name is required")
+	}
+	if policy.WorkDays == "" {
+		policy.WorkDays = "mon,tue,wed,thu,fri"
+	}
+	if policy.Timezone == "" {
+		policy.Timezone = "UTC"
+	}
+	if err := validateAttendancePolicy(policy); err != nil {
+		return nil, err
+	}
+
+	active := policy.Active
+	policy.ID = uuid.New()
+	if err := s.db.Create(policy).Error; err != nil {
+		return nil, fmt.Errorf("failed to create attendance policy: %w", err)
+	}
+
+	// Create skips zero values for columns with defaults, so an inactive policy needs an explicit update
+	if !active {
+		if err := s.db.Model(policy).Update("active", false).Error; err != nil {
+			return nil, fmt.Errorf("failed to create attendance policy: %w", err)
+		}
+	}
+
+	return s.GetPolicyByID(policy.ID)
+}
+
+// GetPolicyByID retrieves an attendance policy by ID
+func (s *AttendanceService) GetPolicyByID(id uuid.UUID) (*database.AttendancePolicy, error) {
+	var policy database.AttendancePolicy
+	if err := s.db.Preload("Role").Preload("Location").Where("id = ?", id).First(&policy).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "attendance policy not found")
+		}
+		return nil, fmt.Errorf("failed to get attendance policy: %w", err)
+	}
+	return &policy, nil
+}
+
+// ListPolicies retrieves attendance policies, optionally only active ones
+func (s *AttendanceService) ListPolicies(activeOnly bool) ([]database.AttendancePolicy, error) {
+	var policies []database.AttendancePolicy
+	query := s.db.Preload("Role").Preload("Location")
+	if activeOnly {
+		query = query.Where("active = ?", true)
+	}
+	if err := query.Order("name").Find(&policies).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch attendance policies: %w", err)
+	}
+	return policies, nil
+}
+
+// UpdatePolicy updates an attendance policy
+func (s *AttendanceService) UpdatePolicy(id uuid.UUID, updates map[string]interface{}) (*database.AttendancePolicy, error) {
+	policy, err := s.GetPolicyByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate the policy as it will be after the update
+	merged := *policy
+	if v, ok := updates["expected_daily_hours"].(float64); ok {
+		merged.ExpectedDailyHours = v
+	}
+	if v, ok := updates["work_days"].(string); ok {
+		merged.WorkDays = v
+	}
+	if v, ok := updates["start_time"].(string); ok {
+		merged.StartTime = v
+	}
+	if v, ok := updates["grace_minutes"].(int); ok {
+		merged.GraceMinutes = v
+	}
+	if v, ok := updates["timezone"].(string); ok {
+		merged.Timezone = v
+	}
+	if err := validateAttendancePolicy(&merged); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Model(&database.AttendancePolicy{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to update attendance policy: %w", err)
+	}
+
+	return s.GetPolicyByID(id)
+}
+
+// DeletePolicy permanently deletes an attendance policy
+func (s *AttendanceService) DeletePolicy(id uuid.UUID) error {
+	result := s.db.Where("id = ?", id).Delete(&database.AttendancePolicy{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete attendance policy: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return NewError(CodeNotFound, "attendance policy not found")
+	}
+	return nil
+}
+
+// validateAttendancePolicy checks the schedule fields of a policy
+func validateAttendancePolicy(policy *database.AttendancePolicy) error {
+	if policy.ExpectedDailyHours < 0 || policy.ExpectedDailyHours > 24 {
+		return NewError(CodeValidationFailed, "expected_daily_hours must be between 0 and 24")
+	}
+	if policy.GraceMinutes < 0 {
+		return NewError(CodeValidationFailed, "grace_minutes must not be negative")
+	}
+	if policy.OvertimeThresholdHours < 0 || policy.UndertimeThresholdHours < 0 {
+		return NewError(CodeValidationFailed, "notification thresholds must not be negative")
+	}
+	if _, err := parseWorkDays(policy.WorkDays); err != nil {
+		return err
+	}
+	if policy.StartTime != "" {
+		if _, err := time.Parse("15:04", policy.StartTime); err != nil {
+			return NewError(CodeValidationFailed, "start_time must be in HH:MM format")
+		}
+	}
+	if _, err := time.LoadLocation(policy.Timezone); err != nil {
+		return NewError(CodeValidationFailed, "invalid timezone: %s", policy.Timezone)
+	}
+	return nil
+}
+
+// parseWorkDays parses a comma-separated list of weekday abbreviations
+func parseWorkDays(value string) (map[time.Weekday]bool, error) {
+	days := make(map[time.Weekday]bool)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		day, ok := weekdayAbbreviations[name]
+		if !ok {
+			return nil, NewError(CodeValidationFailed, "invalid work day '%s'; use mon, tue, wed, thu, fri, sat or sun", name)
+		}
+		days[day] = true
+	}
+	return days, nil
+}
+
+// GenerateAttendance evaluates every user covered by an active policy against
+// their working time, one row per user per day. Days are the calendar dates
+// from 'from' to 'to', each bounded by midnight in the timezone of the policy
+// that applies, which its start time is also interpreted in. Undertime is
+// only reported for days that have ended. No hours are expected on public
+// holidays at the day's location, or the policy's when the user did not sign
+// in, so all hours worked on them are overtime.
+func (s *AttendanceService) GenerateAttendance(filter AttendanceFilter) (*AttendanceReport, error) {
+	if !filter.To.After(filter.From) {
+		return nil, NewError(CodeValidationFailed, "'to' must be after 'from'")
+	}
+
+	report := &AttendanceReport{Days: []AttendanceDay{}, Totals: []AttendanceTotals{}}
+
+	policies, err := s.ListPolicies(true)
+	if err != nil {
+		return nil, err
+	}
+	if len(policies) == 0 {
+		return report, nil
+	}
+
+	var users []database.User
+	userQuery := s.db.Select("id", "first_name", "last_name").Where("active = ?", true)
+	if len(filter.UserIDs) > 0 {
+		userQuery = userQuery.Where("id IN ?", filter.UserIDs)
+	}
+	if err := userQuery.Order("first_name, last_name").Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch users: %w", err)
+	}
+	if len(users) == 0 {
+		return report, nil
+	}
+
+	userIDs := make([]uuid.UUID, len(users))
+	for i, user := range users {
+		userIDs[i] = user.ID
+	}
+
+	var userRoles []database.UserRole
+	if err := s.db.Select("user_id", "role_id").Where("user_id IN ?", userIDs).Find(&userRoles).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch user roles: %w", err)
+	}
+	rolesByUser := make(map[uuid.UUID]map[uuid.UUID]bool)
+	for _, ur := range userRoles {
+		if rolesByUser[ur.UserID] == nil {
+			rolesByUser[ur.UserID] = make(map[uuid.UUID]bool)
+		}
+		rolesByUser[ur.UserID][ur.RoleID] = true
+	}
+
+	// Rows are for the calendar dates of the range, each taken in the timezone
+	// of the policy that applies. Working time is fetched a day either side so
+	// those dates are complete in every zone.
+	firstDay := time.Date(filter.From.UTC().Year(), filter.From.UTC().Month(), filter.From.UTC().Day(), 0, 0, 0, 0, time.UTC)
+	var dates []string
+	for day := firstDay; day.Before(filter.To); day = day.AddDate(0, 0, 1) {
+		dates = append(dates, day.Format("2006-01-02"))
+	}
+	windowFrom, windowTo := firstDay.AddDate(0, 0, -1), filter.To.AddDate(0, 0, 1)
+
+	var intervals []attendanceInterval
+	if err := s.db.Raw(`
+		SELECT uah.user_id, uah.from_datetime, uah.to_datetime, uah.location_id
+		FROM user_activity_history uah
+		JOIN user_statuses us ON us.id = uah.status_id
+		WHERE us.type = 'working'
+		AND uah.user_id IN ?
+		AND uah.from_datetime < ? AND (uah.to_datetime IS NULL OR uah.to_datetime > ?)
+		ORDER BY uah.user_id, uah.from_datetime
+	`, userIDs, windowTo, windowFrom).Scan(&intervals).Error; err != nil {
+		return nil, fmt.Errorf("failed to query working intervals: %w", err)
+	}
+
+	now := time.Now()
+	zones := attendancePolicyZones(policies)
+	zoneNames := make([]string, 0, len(zones))
+	states := make(map[string]map[uuid.UUID]map[string]*attendanceDayState, len(zones))
+	for name, loc := range zones {
+		zoneNames = append(zoneNames, name)
+		states[name] = bucketAttendanceDays(intervals, loc, windowFrom, windowTo, now)
+	}
+	sort.Strings(zoneNames)
+
+	holidays, err := loadHolidayCalendar(s.db, s.config.Holidays.DefaultCountry, dates[0], dates[len(dates)-1])
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		userName := strings.TrimSpace(user.FirstName + " " + user.LastName)
+		totals := AttendanceTotals{UserID: user.ID, UserName: userName}
+		covered := false
+
+		for _, date := range dates {
+			for _, zone := range zoneNames {
+				state := states[zone][user.ID][date]
+				if state == nil {
+					state = &attendanceDayState{}
+				}
+
+				// The day is evaluated in the zone of the policy it resolves to
+				policy := resolveAttendancePolicy(policies, rolesByUser[user.ID], state.locationID)
+				if policy == nil || policy.Timezone != zone {
+					continue
+				}
+				covered = true
+
+				locationID := state.locationID
+				if locationID == nil {
+					locationID = policy.LocationID
+				}
+				holiday := holidays.Holiday(date, locationID)
+
+				day, _ := time.ParseInLocation("2006-01-02", date, zones[zone])
+				row := evaluateAttendanceDay(policy, state, day, holiday, now)
+				row.UserID = user.ID
+				row.UserName = userName
+				report.Days = append(report.Days, row)
+
+				totals.ExpectedHours += row.ExpectedHours
+				totals.WorkedHours += row.WorkedHours
+				totals.OvertimeHours += row.OvertimeHours
+				totals.UndertimeHours += row.UndertimeHours
+				if row.Late {
+					totals.LateSignIns++
+				}
+				break
+			}
+		}
+
+		if covered {
+			totals.ExpectedHours = roundHours(totals.ExpectedHours)
+			totals.WorkedHours = roundHours(totals.WorkedHours)
+			totals.OvertimeHours = roundHours(totals.OvertimeHours)
+			totals.UndertimeHours = roundHours(totals.UndertimeHours)
+			report.Totals = append(report.Totals, totals)
+		}
+	}
+
+	return report, nil
+}
+
+// attendancePolicyZones returns the locations of the policies' timezones, by
+// name. Policies are validated on save, so a zone that fails to load is only
+// possible for rows edited in the database; it is treated as UTC.
+func attendancePolicyZones(policies []database.AttendancePolicy) map[string]*time.Location {
+	zones := make(map[string]*time.Location)
+	for _, policy := range policies {
+		if _, ok := zones[policy.Timezone]; ok {
+			continue
+		}
+		loc, err := time.LoadLocation(policy.Timezone)
+		if err != nil {
+			loc = time.UTC
+		}
+		zones[policy.Timezone] = loc
+	}
+	return zones
+}
+
+// bucketAttendanceDays totals each user's working time between from and to
+// by calendar day in loc, noting the first sign-in of each day. Open
+// intervals run until now.
+func bucketAttendanceDays(intervals []attendanceInterval, loc *time.Location, from, to, now time.Time) map[uuid.UUID]map[string]*attendanceDayState {
+	states := make(map[uuid.UUID]map[string]*attendanceDayState)
+	for _, interval := range intervals {
+		end := now
+		if interval.ToDateTime != nil {
+			end = *interval.ToDateTime
+		}
+		userDays := states[interval.UserID]
+		if userDays == nil {
+			userDays = make(map[string]*attendanceDayState)
+			states[interval.UserID] = userDays
+		}
+		signInDate := interval.FromDateTime.In(loc).Format("2006-01-02")
+		splitByDay(maxTime(interval.FromDateTime, from), minTime(end, to), loc, func(dayStart time.Time, hours float64) {
+			date := dayStart.Format("2006-01-02")
+			state, ok := userDays[date]
+			if !ok {
+				state = &attendanceDayState{}
+				userDays[date] = state
+			}
+			state.worked += hours
+
+			// The first interval starting on this day is the day's sign-in
+			if signInDate == date && state.firstSignIn == nil {
+				signIn := interval.FromDateTime
+				state.firstSignIn = &signIn
+				state.locationID = interval.LocationID
+			}
+		})
+	}
+	return states
+}
+
+// resolveAttendancePolicy picks the most specific active policy matching the
+// user's roles and the day's location. A role match outranks a location match;
+// policies are ordered by name, so ties go to the first name alphabetically.
+func resolveAttendancePolicy(policies []database.AttendancePolicy, roles map[uuid.UUID]bool, locationID *uuid.UUID) *database.AttendancePolicy {
+	var best *database.AttendancePolicy
+	bestScore := -1
+	for i := range policies {
+		policy := &policies[i]
+		score := 0
+		if policy.RoleID != nil {
+			if !roles[*policy.RoleID] {
+				continue
+			}
+			score += 2
+		}
+		if policy.LocationID != nil {
+			if locationID == nil || *locationID != *policy.LocationID {
+				continue
+			}
+			score++
+		}
+		if score > bestScore {
+			best = policy
+			bestScore = score
+		}
+	}
+	return best
+}
+
+// evaluateAttendanceDay computes overtime, undertime and lateness for one
+// day, which is the named holiday unless holiday is empty
+func evaluateAttendanceDay(policy *database.AttendancePolicy, state *attendanceDayState, day time.Time, holiday string, now time.Time) AttendanceDay {
+	row := AttendanceDay{
+		Date:        day.Format("2006-01-02"),
+		PolicyID:    policy.ID,
+		PolicyName:  policy.Name,
+		Holiday:     holiday,
+		WorkedHours: roundHours(state.worked),
+		FirstSignIn: state.firstSignIn,
+	}
+
+	// Policies are validated on save, so parse errors only occur for rows edited directly in the database
+	workDays, _ := parseWorkDays(policy.WorkDays)
+	if workDays[day.Weekday()] && holiday == "" {
+		row.ExpectedHours = policy.ExpectedDailyHours
+	}
+
+	dayEnded := !day.AddDate(0, 0, 1).After(now)
+	if row.WorkedHours > row.ExpectedHours {
+		row.OvertimeHours = roundHours(row.WorkedHours - row.ExpectedHours)
+	} else if dayEnded {
+		row.UndertimeHours = roundHours(row.ExpectedHours - row.WorkedHours)
+	}
+
+	if policy.StartTime != "" && row.ExpectedHours > 0 && state.firstSignIn != nil {
+		start, err := time.Parse("15:04", policy.StartTime)
+		loc, locErr := time.LoadLocation(policy.Timezone)
+		if err == nil && locErr == nil {
+			deadline := time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), 0, 0, loc).
+				Add(time.Duration(policy.GraceMinutes) * time.Minute)
+			if state.firstSignIn.After(deadline) {
+				row.Late = true
+				row.LateMinutes = roundHours(state.firstSignIn.Sub(deadline).Minutes())
+			}
+		}
+	}
+
+	return row
+}
+
+// StartNotifier periodically checks for policy breaches and sends notifications.
+// It does nothing when attendance.notify_interval is zero.
+func (s *AttendanceService) StartNotifier() {
+	interval := s.config.Attendance.NotifyInterval
+	if interval <= 0 || s.stop != nil {
+		return
+	}
+
+	s.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.NotifyBreaches(time.Now()); err != nil {
+					log.Printf("Attendance notification check failed: %v", err)
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopNotifier stops the background breach checker
+func (s *AttendanceService) StopNotifier() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// NotifyBreaches evaluates yesterday and today (UTC) and notifies each new
+// overtime, undertime or late sign-in breach once via the policy's webhook
+// and/or email recipients.
+func (s *AttendanceService) NotifyBreaches(now time.Time) error {
+	today := time.Date(now.UTC().Year(), now.UTC().Month(), now.UTC().Day(), 0, 0, 0, 0, time.UTC)
+	report, err := s.GenerateAttendance(AttendanceFilter{From: today.AddDate(0, 0, -1), To: now})
+	if err != nil {
+		return err
+	}
+
+	policies, err := s.ListPolicies(true)
+	if err != nil {
+		return err
+	}
+	policyByID := make(map[uuid.UUID]*database.AttendancePolicy)
+	for i := range policies {
+		policyByID[policies[i].ID] = &policies[i]
+	}
+
+	for _, day := range report.Days {
+		policy := policyByID[day.PolicyID]
+		if policy == nil || (policy.NotifyWebhookURL == "" && policy.NotifyEmails == "") {
+			continue
+		}
+
+		var breaches []string
+		if day.OvertimeHours > 0 && day.OvertimeHours > policy.OvertimeThresholdHours {
+			breaches = append(breaches, "overtime")
+		}
+		if day.UndertimeHours > 0 && day.UndertimeHours > policy.UndertimeThresholdHours {
+			breaches = append(breaches, "undertime")
+		}
+		if day.Late {
+			breaches = append(breaches, "late")
+		}
+
+		for _, breach := range breaches {
+			if err := s.notifyBreach(policy, day, breach); err != nil {
+				log.Printf("Failed to notify %s breach for user %s on %s: %v", breach, day.UserID, day.Date, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// notifyBreach records a breach and sends its notifications, unless it was already recorded
+func (s *AttendanceService) notifyBreach(policy *database.AttendancePolicy, day AttendanceDay, breach string) error {
+	notification := database.AttendanceNotification{
+		ID:       uuid.New(),
+		PolicyID: policy.ID,
+		UserID:   day.UserID,
+		Date:     day.Date,
+		Type:     breach,
+	}
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&notification)
+	if result.Error != nil {
+		return fmt.Errorf("failed to record notification: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	var errs []string
+	if policy.NotifyWebhookURL != "" {
+		payload := map[string]interface{}{
+			"event":      "attendance.breach",
+			"type":       breach,
+			"attendance": day,
+		}
+		if err := s.notifications.SendWebhook(policy.NotifyWebhookURL, payload); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if recipients := splitRecipients(policy.NotifyEmails); len(recipients) > 0 {
+		data := attendanceBreachData{AttendanceDay: day, Breach: breach}
+		locale := s.translator.DefaultLocale()
+		subject := s.translator.Translate(locale, "email.attendance_breach.subject", data)
+		if err := s.notifications.SendEmail(recipients, subject, s.translator.Translate(locale, "email.attendance_breach.body", data)); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		message := strings.Join(errs, "; ")
+		s.db.Model(&notification).Update("error", message)
+		return fmt.Errorf("%s", message)
+	}
+	return nil
+}
+
+// attendanceBreachData is what the email.attendance_breach.* messages are
+// rendered with: the day and its breach, overtime, undertime or late
+type attendanceBreachData struct {
+	AttendanceDay
+	Breach string
+}
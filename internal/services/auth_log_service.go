@@ -0,0 +1,233 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AuthLogService queries the authentication log
+type AuthLogService struct {
+	db *gorm.DB
+}
+
+func NewAuthLogService(db *gorm.DB) *AuthLogService {
+	return &AuthLogService{db: db}
+}
+
+// AuthLogFilter selects authentication log entries; zero fields match everything
+type AuthLogFilter struct {
+	UserID    *uuid.UUID
+	DeviceID  *uuid.UUID
+	ActionID  *uuid.UUID
+	Success   *bool
+	Type      string // "login", "logout", "refresh", "mfa", "action", "break_glass"
+	IPAddress string
+	Degraded  bool       // Only entries decided by yubikey.degraded_mode
+	From      *time.Time // Inclusive
+	To        *time.Time // Exclusive
+	Limit     int
+	Offset    int
+}
+
+// AuthLogCounts counts entries by outcome
+type AuthLogCounts struct {
+	Total     int64 `json:"total"`
+	Succeeded int64 `json:"succeeded"`
+	Failed    int64 `json:"failed"`
+}
+
+// AuthLogDaySummary counts one day's entries by outcome, overall and per device type
+type AuthLogDaySummary struct {
+	Date string `json:"date" format:"date" doc:"UTC day"`
+	AuthLogCounts
+	DeviceTypes map[string]AuthLogCounts `json:"device_types"`
+}
+
+// apply restricts a query on authentication_logs to the filter
+func (f AuthLogFilter) apply(query *gorm.DB) *gorm.DB {
+	if f.UserID != nil {
+		query = query.Where("authentication_logs.user_id = ?", *f.UserID)
+	}
+	if f.DeviceID != nil {
+		query = query.Where("authentication_logs.device_id = ?", *f.DeviceID)
+	}
+	if f.ActionID != nil {
+		query = query.Where("authentication_logs.action_id = ?", *f.ActionID)
+	}
+	if f.Success != nil {
+		query = query.Where("authentication_logs.success = ?", *f.Success)
+	}
+	if f.Type != "" {
+		query = query.Where("authentication_logs.type = ?", f.Type)
+	}
+	if f.IPAddress != "" {
+		query = query.Where("authentication_logs.ip_address = ?", f.IPAddress)
+	}
+	if f.Degraded {
+		query = query.Where("authentication_logs.details->>'degraded_mode' IS NOT NULL")
+	}
+	if f.From != nil {
+		query = query.Where("authentication_logs.created_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		query = query.Where("authentication_logs.created_at < ?", *f.To)
+	}
+	return query
+}
+
+// ListAuthLogs returns a page of matching entries, newest first, with their
+// user and device (including deleted ones), and the total number of matches
+func (s *AuthLogService) ListAuthLogs(filter AuthLogFilter) ([]database.AuthenticationLog, int64, error) {
+	query := filter.apply(database.ReadReplica(s.db).Model(&database.AuthenticationLog{}))
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count authentication logs: %w", err)
+	}
+
+	var logs []database.AuthenticationLog
+	unscoped := func(db *gorm.DB) *gorm.DB { return db.Unscoped() }
+	if err := query.Preload("User", unscoped).Preload("Device", unscoped).
+		Order("authentication_logs.created_at DESC").Limit(filter.Limit).Offset(filter.Offset).
+		Find(&logs).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch authentication logs: %w", err)
+	}
+	return logs, total, nil
+}
+
+// authLogSummaryRow is one day, device type and outcome's count
+type authLogSummaryRow struct {
+	Day        time.Time
+	DeviceType string
+	Success    bool
+	Count      int64
+}
+
+// SummarizeAuthLogs counts matching entries per UTC day by outcome and device
+// type, in date order. Days without entries are omitted.
+func (s *AuthLogService) SummarizeAuthLogs(filter AuthLogFilter) ([]AuthLogDaySummary, error) {
+	query := database.ReadReplica(s.db).Model(&database.AuthenticationLog{}).
+		Select("date_trunc('day', authentication_logs.created_at AT TIME ZONE 'UTC') AS day, " +
+			"COALESCE(devices.type, 'unknown') AS device_type, authentication_logs.success, COUNT(*) AS count").
+		Joins("LEFT JOIN devices ON devices.id = authentication_logs.device_id").
+		Group("day, device_type, authentication_logs.success")
+
+	var rows []authLogSummaryRow
+	if err := filter.apply(query).Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to summarize authentication logs: %w", err)
+	}
+
+	days := map[string]*AuthLogDaySummary{}
+	for _, row := range rows {
+		date := row.Day.Format("2006-01-02")
+		day, ok := days[date]
+		if !ok {
+			day = &AuthLogDaySummary{Date: date, DeviceTypes: map[string]AuthLogCounts{}}
+			days[date] = day
+		}
+		deviceCounts := day.DeviceTypes[row.DeviceType]
+		deviceCounts.add(row.Success, row.Count)
+		day.DeviceTypes[row.DeviceType] = deviceCounts
+		day.add(row.Success, row.Count)
+	}
+
+	summaries := make([]AuthLogDaySummary, 0, len(days))
+	for _, day := range days {
+		summaries = append(summaries, *day)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Date < summaries[j].Date })
+	return summaries, nil
+}
+
+// DegradedModeUser is one user's degraded mode authentications in a report
+type DegradedModeUser struct {
+	UserID   *uuid.UUID `json:"user_id"`
+	Username string     `json:"username"`
+	AuthLogCounts
+	FirstAt time.Time `json:"first_at"`
+	LastAt  time.Time `json:"last_at"`
+}
+
+// DegradedModeReport accounts for the authentications yubikey.degraded_mode
+// decided while YubiCloud was unavailable, for review once it is back
+type DegradedModeReport struct {
+	AuthLogCounts
+	Policies map[string]AuthLogCounts `json:"policies" doc:"By policy applied: allow, totp or deny"`
+	Users    []DegradedModeUser       `json:"users" doc:"Most authentications first"`
+}
+
+// degradedModeRow is one user, policy and outcome's degraded mode entries
+type degradedModeRow struct {
+	UserID   *uuid.UUID
+	Username string
+	Policy   string
+	Success  bool
+	Count    int64
+	FirstAt  time.Time
+	LastAt   time.Time
+}
+
+// DegradedModeReport reports the matching entries decided by the degraded
+// mode policy, by policy and by user
+func (s *AuthLogService) DegradedModeReport(filter AuthLogFilter) (*DegradedModeReport, error) {
+	filter.Degraded = true
+	query := database.ReadReplica(s.db).Model(&database.AuthenticationLog{}).
+		Select("authentication_logs.user_id, COALESCE(users.username, '') AS username, " +
+			"authentication_logs.details->>'degraded_mode' AS policy, authentication_logs.success, COUNT(*) AS count, " +
+			"MIN(authentication_logs.created_at) AS first_at, MAX(authentication_logs.created_at) AS last_at").
+		Joins("LEFT JOIN users ON users.id = authentication_logs.user_id").
+		Group("authentication_logs.user_id, users.username, policy, authentication_logs.success")
+
+	var rows []degradedModeRow
+	if err := filter.apply(query).Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to report degraded mode authentications: %w", err)
+	}
+
+	report := &DegradedModeReport{Policies: map[string]AuthLogCounts{}, Users: []DegradedModeUser{}}
+	users := map[string]*DegradedModeUser{}
+	var order []string
+	for _, row := range rows {
+		report.add(row.Success, row.Count)
+		policyCounts := report.Policies[row.Policy]
+		policyCounts.add(row.Success, row.Count)
+		report.Policies[row.Policy] = policyCounts
+
+		key := ""
+		if row.UserID != nil {
+			key = row.UserID.String()
+		}
+		user, ok := users[key]
+		if !ok {
+			user = &DegradedModeUser{UserID: row.UserID, Username: row.Username, FirstAt: row.FirstAt, LastAt: row.LastAt}
+			users[key] = user
+			order = append(order, key)
+		}
+		user.add(row.Success, row.Count)
+		if row.FirstAt.Before(user.FirstAt) {
+			user.FirstAt = row.FirstAt
+		}
+		if row.LastAt.After(user.LastAt) {
+			user.LastAt = row.LastAt
+		}
+	}
+	for _, key := range order {
+		report.Users = append(report.Users, *users[key])
+	}
+	sort.SliceStable(report.Users, func(i, j int) bool { return report.Users[i].Total > report.Users[j].Total })
+	return report, nil
+}
+
+// add counts n entries with the given outcome
+func (c *AuthLogCounts) add(success bool, n int64) {
+	c.Total += n
+	if success {
+		c.Succeeded += n
+	} else {
+		c.Failed += n
+	}
+}
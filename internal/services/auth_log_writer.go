@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"gorm.io/gorm"
+)
+
+// AuthLogWriter takes authentication log inserts off the request path: entries
+// are queued on a buffered channel and inserted in batches by a background
+// goroutine, every auth_log.flush_interval or as soon as auth_log.batch_size
+// entries are waiting. Entries are never dropped: when the buffer is full, or
+// the writer is not running, they are inserted inline instead, which slows
+// callers down to the database's pace.
+type AuthLogWriter struct {
+	db     *gorm.DB
+	config config.AuthLogConfig
+
+	mu       sync.RWMutex
+	running  bool
+	entries  chan database.AuthenticationLog
+	done     chan struct{}
+	overflow atomic.Int64 // Entries written inline since the last flush because the buffer was full
+}
+
+func NewAuthLogWriter(db *gorm.DB, config config.AuthLogConfig) *AuthLogWriter {
+	return &AuthLogWriter{db: db, config: config}
+}
+
+// Write queues an entry, or inserts it inline when it cannot be queued. Queued
+// entries keep the time they were logged, not the time they were inserted.
+func (w *AuthLogWriter) Write(entry database.AuthenticationLog) error {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+
+	w.mu.RLock()
+	if w.running {
+		select {
+		case w.entries <- entry:
+			w.mu.RUnlock()
+			return nil
+		default:
+			w.overflow.Add(1)
+		}
+	}
+	w.mu.RUnlock()
+
+	return w.db.Create(&entry).Error
+}
+
+// Start starts the background inserter. It does nothing when
+// auth_log.buffer_size is zero, leaving every write inline.
+func (w *AuthLogWriter) Start() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.running || w.config.BufferSize <= 0 {
+		return
+	}
+
+	w.entries = make(chan database.AuthenticationLog, w.config.BufferSize)
+	w.done = make(chan struct{})
+	w.running = true
+	go w.run(w.entries, w.done)
+}
+
+// Close stops queueing, then waits until every queued entry has been inserted
+// or ctx is done. Later writes are inserted inline.
+func (w *AuthLogWriter) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.running {
+		w.mu.Unlock()
+		return nil
+	}
+	w.running = false
+	close(w.entries)
+	entries, done := w.entries, w.done
+	w.mu.Unlock()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d authentication log entries not written: %w", len(entries), ctx.Err())
+	}
+}
+
+// run batches entries until the channel is closed and drained
+func (w *AuthLogWriter) run(entries <-chan database.AuthenticationLog, done chan<- struct{}) {
+	defer close(done)
+
+	batchSize := w.config.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+	interval := w.config.FlushInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	batch := make([]database.AuthenticationLog, 0, batchSize)
+	for {
+		select {
+		case entry, ok := <-entries:
+			if !ok {
+				w.flush(batch)
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) >= batchSize {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			w.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// flush inserts a batch in one statement. If that fails the entries are
+// inserted one by one, so a single bad entry does not lose the others.
+func (w *AuthLogWriter) flush(batch []database.AuthenticationLog) {
+	if overflow := w.overflow.Swap(0); overflow > 0 {
+		log.Printf("Authentication log buffer was full; %d entries were written inline (consider raising auth_log.buffer_size)", overflow)
+	}
+	if len(batch) == 0 {
+		return
+	}
+
+	err := w.db.CreateInBatches(batch, len(batch)).Error
+	if err == nil {
+		return
+	}
+	log.Printf("Failed to insert %d authentication log entries as a batch, retrying one by one: %v", len(batch), err)
+	for i := range batch {
+		if err := w.db.Create(&batch[i]).Error; err != nil {
+			log.Printf("Failed to insert authentication log entry %s: %v", batch[i].ID, err)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/YubiApp/internal/config"
+)
+
+// rolePolicy returns the auth.role_policies entry for a role. Config keys are
+// case-insensitive.
+func rolePolicy(cfg *config.Config, role string) (config.AuthPolicyConfig, bool) {
+	policy, ok := cfg.Auth.RolePolicies[strings.ToLower(role)]
+	return policy, ok
+}
+
+// deviceTypeRefusedBy returns the first of roles whose policy does not accept
+// authenticating with deviceType, or ""
+func deviceTypeRefusedBy(cfg *config.Config, roles []string, deviceType string) string {
+	for _, role := range roles {
+		policy, ok := rolePolicy(cfg, role)
+		if ok && len(policy.DeviceTypes) > 0 && !slices.Contains(policy.DeviceTypes, deviceType) {
+			return role
+		}
+	}
+	return ""
+}
+
+// sessionsRefusedBy returns the first of roles whose policy refuses session
+// authentication, or ""
+func sessionsRefusedBy(cfg *config.Config, roles []string) string {
+	for _, role := range roles {
+		if policy, ok := rolePolicy(cfg, role); ok && policy.NoSessions {
+			return role
+		}
+	}
+	return ""
+}
@@ -1,31 +1,46 @@
 package services
 
 import (
-	"crypto/rand"
-	"encoding/hex"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
-	"net/url"
+	"log"
 	"strings"
+	"time"
 
 	"github.com/YubiApp/internal/config"
 	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/logging"
+	"github.com/YubiApp/internal/tracing"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 	"github.com/jackc/pgtype"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type AuthService struct {
 	db            *gorm.DB
+	stmtDB        *gorm.DB // db with prepared statements, for the queries every authentication makes
 	deviceService *DeviceService
+	logWriter     *AuthLogWriter
+	replayCache   *OTPReplayCache
+	incidents     *SecurityIncidentService
+	yubicloud     *yubicloudClient
+	pushChallenges *PushChallenges
 	config        *config.Config
 }
 
-func NewAuthService(db *gorm.DB, config *config.Config) *AuthService {
+func NewAuthService(db *gorm.DB, config *config.Config, logWriter *AuthLogWriter, replayCache *OTPReplayCache, incidents *SecurityIncidentService, pushChallenges *PushChallenges) *AuthService {
 	return &AuthService{
 		db:            db,
-		deviceService: NewDeviceService(db),
+		stmtDB:        db.Session(&gorm.Session{PrepareStmt: true}),
+		deviceService: NewDeviceService(db, config, nil),
+		logWriter:     logWriter,
+		replayCache:   replayCache,
+		incidents:     incidents,
+		yubicloud:     newYubicloudClient(config.Yubikey),
+		pushChallenges: pushChallenges,
 		config:        config,
 	}
 }
@@ -33,31 +48,53 @@ func NewAuthService(db *gorm.DB, config *config.Config) *AuthService {
 // AuthenticateDevice authenticates a user using a device and checks permissions
 // Returns both user and device information
 func (s *AuthService) AuthenticateDevice(deviceType, authCode, requiredPermission string) (*database.User, *database.Device, error) {
+	return s.AuthenticateDeviceContext(context.Background(), deviceType, authCode, requiredPermission)
+}
+
+// AuthenticateDeviceContext is AuthenticateDevice for a request; its request ID
+// is recorded on the authentication log
+func (s *AuthService) AuthenticateDeviceContext(ctx context.Context, deviceType, authCode, requiredPermission string) (*database.User, *database.Device, error) {
 	var device *database.Device
 	var err error
 
+	// Set when yubikey.degraded_mode decided the sign-in, as YubiCloud is unavailable
+	var degraded string
+
 	switch deviceType {
 	case "yubikey":
-		device, err = s.authenticateYubikey(authCode)
+		device, err = s.authenticateYubikey(ctx, authCode)
+		degraded, err = s.degradedYubikey(ctx, device, authCode, requiredPermission, err)
 	case "totp":
-		device, err = s.authenticateTOTP(authCode)
+		device, err = s.authenticateTOTP(ctx, authCode)
+		degraded = s.degradedTOTP(ctx, requiredPermission)
 	case "sms":
 		device, err = s.authenticateSMS(authCode)
 	case "email":
 		device, err = s.authenticateEmail(authCode)
+	case "push":
+		device, err = s.authenticatePush(ctx, authCode, requiredPermission)
 	default:
-		return nil, nil, fmt.Errorf("unsupported device type: %s", deviceType)
+		return nil, nil, NewError(CodeValidationFailed, "unsupported device type: %s", deviceType)
 	}
 
 	if err != nil {
-		return nil, nil, err
+		// A known device failing verification (e.g. a replayed OTP) is logged for alerting
+		if device != nil {
+			s.logFailedVerification(ctx, device, err, degraded)
+		}
+		return nil, nil, WithCode(CodeAuthFailed, err)
 	}
 
-	// Get user associated with the device
-	var user database.User
-	if err := s.db.Preload("Roles.Permissions.Resource").Where("id = ?", device.UserID).First(&user).Error; err != nil {
-		return nil, nil, fmt.Errorf("failed to find user: %w", err)
+	// Get the user associated with the device, with their roles and permissions, in one query
+	if device.UserID == nil {
+		return nil, nil, NewError(CodeAuthFailed, "device is not registered to a user")
+	}
+	grantee, err := loadUserGrants(ctx, s.stmtDB, *device.UserID)
+	if err != nil {
+		return nil, nil, WrapError(CodeAuthFailed, "failed to find user", err)
 	}
+	user := *grantee
+	device.User = user
 
 	details := map[string]interface{}{
 		"user": user.Username,
@@ -67,19 +104,32 @@ func (s *AuthService) AuthenticateDevice(deviceType, authCode, requiredPermissio
 		"type": "mfa",
 		"permission_checked": requiredPermission,
 	}
+	if degraded != "" {
+		details["degraded_mode"] = degraded
+	}
 
 	// Check if user and device are active
-	if !user.Active {
-		return nil, nil, fmt.Errorf("user is not active")
+	if err := UserCanAuthenticate(&user); err != nil {
+		return nil, nil, err
 	}
 	if !device.Active {
-		return nil, nil, fmt.Errorf("device is not active")
+		return nil, nil, NewError(CodeAuthFailed, "device is not active")
+	}
+
+	// The user's roles may require stronger device types
+	roleNames := make([]string, len(user.Roles))
+	for i, role := range user.Roles {
+		roleNames[i] = role.Name
+	}
+	if role := deviceTypeRefusedBy(s.config, roleNames, device.Type); role != "" && degraded != DegradedModeTOTP {
+		s.logAuthentication(ctx, device, &user, false, requiredPermission, "device type refused by role policy", details)
+		return nil, nil, NewError(CodePermissionDenied, "role %s does not allow authenticating with %s devices", role, device.Type)
 	}
 
 	// If no permission required, just return the user and device
 	if requiredPermission == "" {
-		s.deviceService.UpdateDeviceLastUsed(device.ID)
-		s.logAuthentication(device, &user, true, requiredPermission, "", details)
+		s.touchDevice(ctx, device.ID)
+		s.logAuthentication(ctx, device, &user, true, requiredPermission, "", details)
 		return &user, device, nil
 	}
 
@@ -94,26 +144,44 @@ func (s *AuthService) AuthenticateDevice(deviceType, authCode, requiredPermissio
 		// It's not a UUID, try to parse as resource:action format
 		parts := strings.Split(requiredPermission, ":")
 		if len(parts) != 2 {
-			return nil, nil, fmt.Errorf("invalid permission format: %s (expected 'resource:action' or permission UUID)", requiredPermission)
+			return nil, nil, NewError(CodeValidationFailed, "invalid permission format: %s (expected 'resource:action' or permission UUID)", requiredPermission)
 		}
 		resourceName, action := parts[0], parts[1]
 		hasPermission = s.checkUserHasPermissionByResourceAction(&user, resourceName, action)
 	}
 
 	if !hasPermission {
-		s.logAuthentication(device, &user, false, requiredPermission, "permission denied", details)
-		return nil, nil, fmt.Errorf("permission denied: %s", requiredPermission)
+		s.logAuthentication(ctx, device, &user, false, requiredPermission, "permission denied", details)
+		return nil, nil, NewError(CodePermissionDenied, "permission denied: %s", requiredPermission)
+	}
+
+	// The permission's resource may only be usable from some networks
+	if err := s.CheckResourceNetwork(ctx, &user, requiredPermission); err != nil {
+		return nil, nil, err
 	}
 
 	// Update device last used timestamp
-	s.deviceService.UpdateDeviceLastUsed(device.ID)
+	s.touchDevice(ctx, device.ID)
 
 	// Log successful authentication
-	s.logAuthentication(device, &user, true, requiredPermission, "", details)
+	s.logAuthentication(ctx, device, &user, true, requiredPermission, "", details)
 
 	return &user, device, nil
 }
 
+// UserHasPermission checks a user loaded with Roles.Permissions.Resource against a
+// permission given as a UUID or in "resource:action" format
+func (s *AuthService) UserHasPermission(user *database.User, permission string) bool {
+	if permissionID, err := uuid.Parse(permission); err == nil {
+		return s.checkUserHasPermissionByID(user, permissionID)
+	}
+	parts := strings.Split(permission, ":")
+	if len(parts) != 2 {
+		return false
+	}
+	return s.checkUserHasPermissionByResourceAction(user, parts[0], parts[1])
+}
+
 // checkUserHasPermissionByID checks if a user has a specific permission by UUID
 func (s *AuthService) checkUserHasPermissionByID(user *database.User, permissionID uuid.UUID) bool {
 	for _, role := range user.Roles {
@@ -140,29 +208,86 @@ func (s *AuthService) checkUserHasPermissionByResourceAction(user *database.User
 	return false
 }
 
-// authenticateYubikey authenticates using YubiKey OTP
-func (s *AuthService) authenticateYubikey(otp string) (*database.Device, error) {
+// authenticateYubikey authenticates using YubiKey OTP. When the device is
+// found but the OTP fails verification, the device is returned with the error.
+func (s *AuthService) authenticateYubikey(ctx context.Context, otp string) (*database.Device, error) {
 	// Extract device ID from OTP (first 12 characters)
 	if len(otp) < 12 {
 		return nil, fmt.Errorf("invalid YubiKey OTP format")
 	}
 	deviceID := otp[:12]
 
-	// Verify OTP with Yubico servers
-	if err := s.verifyYubikeyOTP(otp); err != nil {
-		return nil, fmt.Errorf("OTP verification failed: %w", err)
+	// Find the device in our database; its user is loaded with their grants afterwards
+	var device database.Device
+	if err := s.stmtDB.WithContext(ctx).Where("type = ? AND identifier = ?", "yubikey", deviceID).First(&device).Error; err != nil {
+		return nil, fmt.Errorf("device not found: %w", err)
+	}
+
+	// Refuse OTPs seen recently before spending a verification on them. The
+	// cache being unavailable leaves replay detection to the verification.
+	seen, err := s.replayCache.Seen(ctx, device.ID, otp)
+	if err != nil {
+		log.Printf("OTP replay cache: %v", err)
+	}
+	if seen {
+		return &device, fmt.Errorf("OTP verification failed: %w", NewError(CodeAuthReplayedOTP, "replayed OTP detected by the replay cache"))
+	}
+
+	// Verify locally when enabled and the device holds its AES key, otherwise with Yubico servers
+	if key, privateID, ok := yubikeyLocalKey(device.Secret); ok && s.config.Yubikey.LocalValidation {
+		err = verifyYubikeyOTPLocal(s.stmtDB.WithContext(ctx), &device, otp, key, privateID)
+	} else {
+		var token *yubikeyToken
+		token, err = s.verifyYubikeyOTP(ctx, otp)
+		switch {
+		case ErrorCodeOf(err) == CodeValidationUnavailable:
+			// The OTP was never checked, so it may be tried again
+			s.replayCache.Forget(ctx, otp)
+		case err == nil && token != nil:
+			err = recordYubikeyCounters(s.stmtDB.WithContext(ctx), &device, token)
+		}
+	}
+	if ErrorCodeOf(err) == CodeDeviceCloneSuspected {
+		s.flagClonedDevice(ctx, &device, err)
+	}
+	if err != nil {
+		return &device, fmt.Errorf("OTP verification failed: %w", err)
+	}
+	return &device, nil
+}
+
+// flagClonedDevice deactivates a device whose OTP counters went backwards until
+// an admin re-activates it, and opens a device_clone_suspected security incident
+func (s *AuthService) flagClonedDevice(ctx context.Context, device *database.Device, cause error) {
+	now := time.Now()
+	err := s.db.WithContext(ctx).Model(&database.Device{}).Where("id = ?", device.ID).Updates(map[string]interface{}{
+		"active":             false,
+		"clone_suspected_at": now,
+		"version":            gorm.Expr("version + 1"),
+	}).Error
+	if err != nil {
+		log.Printf("Failed to deactivate possibly cloned device %s: %v", device.ID, err)
 	}
+	device.Active = false
+	device.CloneSuspectedAt = &now
 
-	// Find the device in our database
-	return s.deviceService.GetDeviceByIdentifier("yubikey", deviceID)
+	if device.UserID == nil {
+		return
+	}
+	incident := &database.SecurityIncident{
+		UserID:    *device.UserID,
+		Type:      IncidentDeviceCloneSuspected,
+		Details:   fmt.Sprintf("YubiKey %s may be cloned and was deactivated: %v", device.Identifier, cause),
+		IPAddress: ClientIP(ctx),
+	}
+	if err := s.incidents.OpenIncident(incident); err != nil {
+		log.Printf("Failed to open clone incident for device %s: %v", device.ID, err)
+	}
 }
 
-// authenticateTOTP authenticates using TOTP
-func (s *AuthService) authenticateTOTP(code string) (*database.Device, error) {
-	// For now, we'll need the device ID to be provided separately
-	// In a real implementation, you might encode the device ID in the code
-	// or require it to be provided explicitly
-	return nil, fmt.Errorf("TOTP authentication not yet implemented")
+// touchDevice records that a device was just used
+func (s *AuthService) touchDevice(ctx context.Context, deviceID uuid.UUID) {
+	s.stmtDB.WithContext(ctx).Model(&database.Device{}).Where("id = ?", deviceID).Update("last_used_at", time.Now())
 }
 
 // authenticateSMS authenticates using SMS
@@ -177,63 +302,30 @@ func (s *AuthService) authenticateEmail(code string) (*database.Device, error) {
 	return nil, fmt.Errorf("Email authentication not yet implemented")
 }
 
-// verifyYubikeyOTP verifies the OTP with Yubico servers
-func (s *AuthService) verifyYubikeyOTP(otp string) error {
-	params := url.Values{}
-	params.Add("id", s.config.Yubikey.ClientID)
-	params.Add("otp", otp)
-	
-	// Generate alphanumeric nonce (16-40 characters, no hyphens)
-	nonceBytes := make([]byte, 20)
-	rand.Read(nonceBytes)
-	nonce := hex.EncodeToString(nonceBytes)
-	params.Add("nonce", nonce)
-
-	resp, err := http.Get(fmt.Sprintf("%s?%s", s.config.Yubikey.APIURL, params.Encode()))
-	if err != nil {
-		return fmt.Errorf("failed to verify OTP with Yubico: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// Read the response as plain text
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read Yubico response: %w", err)
-	}
-
-	// Parse key-value pairs
-	lines := strings.Split(string(body), "\n")
-	status := ""
-	for _, line := range lines {
-		if strings.HasPrefix(line, "status=") {
-			status = strings.TrimSpace(strings.TrimPrefix(line, "status="))
-			break
+// verifyYubikeyOTP verifies the OTP with Yubico servers, recording the call as
+// a client span. It returns the OTP's counters when the response carries them.
+func (s *AuthService) verifyYubikeyOTP(ctx context.Context, otp string) (token *yubikeyToken, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "yubicloud.verify", trace.WithSpanKind(trace.SpanKindClient))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
 		}
-	}
+		span.End()
+	}()
 
-	switch strings.ToLower(status) {
-	case "ok":
-		return nil
-	case "replayed_otp":
-		return fmt.Errorf("replayed OTP detected")
-	case "bad_otp":
-		return fmt.Errorf("invalid OTP format")
-	case "missing_parameter":
-		return fmt.Errorf("missing parameter in OTP verification")
-	case "no_such_client":
-		return fmt.Errorf("invalid client ID")
-	case "operation_not_allowed":
-		return fmt.Errorf("operation not allowed")
-	case "backend_error":
-		return fmt.Errorf("Yubico backend error")
-	default:
-		return fmt.Errorf("Yubico verification failed with status: %s", status)
+	token, attempts, status, err := s.yubicloud.verifyOTP(ctx, otp)
+	span.SetAttributes(attribute.Int("yubico.attempts", attempts))
+	if status != "" {
+		span.SetAttributes(attribute.String("yubico.status", status))
 	}
+	return token, err
 }
 
 // logAuthentication logs the authentication attempt
-func (s *AuthService) logAuthentication(device *database.Device, user *database.User, success bool, permissionChecked, errorMsg string, details map[string]interface{}) {
+func (s *AuthService) logAuthentication(ctx context.Context, device *database.Device, user *database.User, success bool, permissionChecked, errorMsg string, details map[string]interface{}) {
 	s.LogAuthentication(map[string]interface{}{
+		"request_id": logging.RequestID(ctx),
 		"user_id": user.ID,
 		"device_id": device.ID,
 		"type": "mfa",
@@ -244,6 +336,32 @@ func (s *AuthService) logAuthentication(device *database.Device, user *database.
 	})
 }
 
+// logFailedVerification logs a device whose OTP or code failed verification,
+// with the error code (e.g. AUTH_REPLAYED_OTP) that alert rules match on and
+// the degraded mode policy applied, if any
+func (s *AuthService) logFailedVerification(ctx context.Context, device *database.Device, err error, degraded string) {
+	code := ErrorCodeOf(err)
+	if code == "" {
+		code = CodeAuthFailed
+	}
+	details := map[string]interface{}{
+		"device_type": device.Type,
+		"error_code":  string(code),
+		"error":       err.Error(),
+	}
+	if degraded != "" {
+		details["degraded_mode"] = degraded
+	}
+	s.LogAuthentication(map[string]interface{}{
+		"request_id": logging.RequestID(ctx),
+		"user_id":    device.UserID,
+		"device_id":  device.ID,
+		"type":       "mfa",
+		"success":    false,
+		"details":    details,
+	})
+}
+
 // LogAuthentication logs an authentication event with custom data
 func (s *AuthService) LogAuthentication(logData map[string]interface{}) error {
 	authLog := database.AuthenticationLog{
@@ -255,8 +373,11 @@ func (s *AuthService) LogAuthentication(logData map[string]interface{}) error {
 	}
 
 	// Extract fields from logData
+	if id, ok := logData["id"].(uuid.UUID); ok {
+		authLog.ID = id
+	}
 	if userID, ok := logData["user_id"].(uuid.UUID); ok {
-		authLog.UserID = userID
+		authLog.UserID = &userID
 	}
 	if deviceID, ok := logData["device_id"].(uuid.UUID); ok {
 		authLog.DeviceID = deviceID
@@ -273,6 +394,9 @@ func (s *AuthService) LogAuthentication(logData map[string]interface{}) error {
 	if userAgent, ok := logData["user_agent"].(string); ok {
 		authLog.UserAgent = userAgent
 	}
+	if requestID, ok := logData["request_id"].(string); ok {
+		authLog.RequestID = requestID
+	}
 	var detailsJSONB pgtype.JSONB
 	// Set Details as JSONB only if we have data
 	if details, ok := logData["details"].(map[string]interface{}); ok && len(details) > 0 {
@@ -290,17 +414,57 @@ func (s *AuthService) LogAuthentication(logData map[string]interface{}) error {
 	// Set type to "action" for action events
 	authLog.Type = logData["type"].(string)
 
-	return s.db.Create(&authLog).Error
+	// Action constraints (cooldowns, daily limits, required preceding actions)
+	// are checked against action entries, so those must be visible immediately
+	if authLog.Type == "action" {
+		return s.db.Create(&authLog).Error
+	}
+	return s.logWriter.Write(authLog)
 }
 
 // CheckUserPermissionByResourceAction checks if a user has a specific permission by resource name and action
 func (s *AuthService) CheckUserPermissionByResourceAction(userID uuid.UUID, resourceName, action string) (bool, error) {
-	var user database.User
-	if err := s.db.Preload("Roles.Permissions.Resource").Where("id = ?", userID).First(&user).Error; err != nil {
+	user, err := loadUserGrants(context.Background(), s.stmtDB, userID)
+	if err != nil {
 		return false, err
 	}
 
-	return s.checkUserHasPermissionByResourceAction(&user, resourceName, action), nil
+	return s.checkUserHasPermissionByResourceAction(user, resourceName, action), nil
+}
+
+// CheckUserPermission checks a user's roles for a permission given as a UUID or
+// in "resource:action" format
+func (s *AuthService) CheckUserPermission(ctx context.Context, userID uuid.UUID, permission string) (bool, error) {
+	if _, err := uuid.Parse(permission); err != nil && len(strings.Split(permission, ":")) != 2 {
+		return false, NewError(CodeValidationFailed, "invalid permission format: %s (expected 'resource:action' or permission UUID)", permission)
+	}
+	user, err := loadUserGrants(ctx, s.stmtDB, userID)
+	if err != nil {
+		return false, err
+	}
+	return s.UserHasPermission(user, permission), nil
+}
+
+// CheckUserCanAuthenticate returns an error unless the user exists, is active
+// and is in a lifecycle state that allows authentication, for sessions that
+// outlive the device authentication that created them
+func (s *AuthService) CheckUserCanAuthenticate(ctx context.Context, userID uuid.UUID) error {
+	var user database.User
+	if err := s.db.WithContext(ctx).Select("id", "active", "state").Where("id = ?", userID).First(&user).Error; err != nil {
+		return NewError(CodeAuthFailed, "user not found")
+	}
+	return UserCanAuthenticate(&user)
+}
+
+// UserCanAuthenticate reports why a loaded user may not authenticate, if they may not
+func UserCanAuthenticate(user *database.User) error {
+	if !user.Active {
+		return NewError(CodeAccountInactive, "user is not active")
+	}
+	if !UserStateAllowsAuthentication(user.State) {
+		return NewError(CodeAccountInactive, "user account is %s", user.State)
+	}
+	return nil
 }
 
 // GetDB returns the database instance (for use in handlers)
@@ -0,0 +1,329 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BreakGlassResult is a successful sign-in with a break-glass credential
+type BreakGlassResult struct {
+	User       *database.User
+	Session    *database.Session
+	Incident   *database.SecurityIncident
+	Credential *database.BreakGlassCredential
+}
+
+// BreakGlassService seals emergency credentials for pre-provisioned admin
+// accounts and redeems them at /auth/break-glass when devices cannot be used.
+// Each use opens a time-limited session, alerts the other admins and opens a
+// break_glass_used incident; the credential stays locked until someone else
+// resolves that incident with their post-incident review.
+type BreakGlassService struct {
+	db          *gorm.DB
+	config      config.BreakGlassConfig
+	authService *AuthService
+	sessions    *SessionService
+	incidents   *SecurityIncidentService
+	alerts      *AlertService
+	notifier    *NotificationService
+	translator  *Translator
+}
+
+func NewBreakGlassService(db *gorm.DB, cfg config.BreakGlassConfig, authService *AuthService, sessions *SessionService, incidents *SecurityIncidentService, alerts *AlertService, notifier *NotificationService, translator *Translator) *BreakGlassService {
+	return &BreakGlassService{
+		db:          db,
+		config:      cfg,
+		authService: authService,
+		sessions:    sessions,
+		incidents:   incidents,
+		alerts:      alerts,
+		notifier:    notifier,
+		translator:  translator,
+	}
+}
+
+// BreakGlassUnderReview reports whether a credential's last use is still
+// awaiting its post-incident review, which locks the credential
+func BreakGlassUnderReview(credential *database.BreakGlassCredential) bool {
+	return credential.Incident != nil && credential.Incident.Status == IncidentStatusOpen
+}
+
+// CreateCredential seals a new credential for userID and returns its secret,
+// which is only ever returned here and on resealing
+func (s *BreakGlassService) CreateCredential(name, description string, userID, sealedByID uuid.UUID) (*database.BreakGlassCredential, string, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, "", NewError(CodeValidationFailed, "name is required")
+	}
+	var user database.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", NewError(CodeValidationFailed, "user %s not found", userID)
+		}
+		return nil, "", fmt.Errorf("failed to get user: %w", err)
+	}
+
+	secret, err := generateBreakGlassSecret()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate break-glass secret: %w", err)
+	}
+	credential := &database.BreakGlassCredential{
+		ID:          uuid.New(),
+		Name:        name,
+		Description: description,
+		UserID:      userID,
+		SecretHash:  hashRecoveryCode(secret),
+		SealedAt:    time.Now(),
+		SealedByID:  &sealedByID,
+	}
+	if err := s.db.Create(credential).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, "", NewError(CodeConflict, "a break-glass credential named %s already exists", name)
+		}
+		return nil, "", fmt.Errorf("failed to create break-glass credential: %w", err)
+	}
+
+	credential, err = s.GetCredential(credential.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	return credential, secret, nil
+}
+
+// ListCredentials returns every break-glass credential by name
+func (s *BreakGlassService) ListCredentials() ([]database.BreakGlassCredential, error) {
+	var credentials []database.BreakGlassCredential
+	if err := s.db.Preload("User").Preload("Incident").Order("name").Find(&credentials).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch break-glass credentials: %w", err)
+	}
+	return credentials, nil
+}
+
+// GetCredential retrieves a break-glass credential by ID
+func (s *BreakGlassService) GetCredential(id uuid.UUID) (*database.BreakGlassCredential, error) {
+	var credential database.BreakGlassCredential
+	if err := s.db.Preload("User").Preload("Incident").Where("id = ?", id).First(&credential).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "break-glass credential not found")
+		}
+		return nil, fmt.Errorf("failed to get break-glass credential: %w", err)
+	}
+	return &credential, nil
+}
+
+// ResealCredential replaces a credential's secret, e.g. once its envelope has
+// been opened, and returns the new one. A credential under review cannot be
+// resealed until the review is closed.
+func (s *BreakGlassService) ResealCredential(id, sealedByID uuid.UUID) (*database.BreakGlassCredential, string, error) {
+	credential, err := s.GetCredential(id)
+	if err != nil {
+		return nil, "", err
+	}
+	if BreakGlassUnderReview(credential) {
+		return nil, "", NewError(CodeConflict, "break-glass credential %s is awaiting the review of its last use", credential.Name)
+	}
+
+	secret, err := generateBreakGlassSecret()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate break-glass secret: %w", err)
+	}
+	if err := s.db.Model(credential).Updates(map[string]interface{}{
+		"secret_hash":  hashRecoveryCode(secret),
+		"sealed_at":    time.Now(),
+		"sealed_by_id": sealedByID,
+	}).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to reseal break-glass credential: %w", err)
+	}
+
+	credential, err = s.GetCredential(id)
+	if err != nil {
+		return nil, "", err
+	}
+	return credential, secret, nil
+}
+
+// DeleteCredential removes a break-glass credential; its incidents are kept
+func (s *BreakGlassService) DeleteCredential(id uuid.UUID) error {
+	res := s.db.Where("id = ?", id).Delete(&database.BreakGlassCredential{})
+	if res.Error != nil {
+		return fmt.Errorf("failed to delete break-glass credential: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return NewError(CodeNotFound, "break-glass credential not found")
+	}
+	return nil
+}
+
+// Use signs in with a break-glass secret. The session lasts
+// break_glass.session_expiry; a break_glass_used incident is opened for it and
+// every admin is alerted. A credential whose last use is still under review is
+// refused, as are unknown secrets; both are logged as failed logins.
+func (s *BreakGlassService) Use(secret string, client SessionClient, requestID string) (*BreakGlassResult, error) {
+	var credential database.BreakGlassCredential
+	if err := s.db.Preload("User").Where("secret_hash = ?", hashRecoveryCode(secret)).First(&credential).Error; err != nil {
+		s.logUse(nil, nil, client, requestID, CodeAuthFailed)
+		return nil, NewError(CodeAuthFailed, "invalid break-glass credential")
+	}
+	user := &credential.User
+	if !user.Active || !UserStateAllowsAuthentication(user.State) {
+		s.logUse(&credential, nil, client, requestID, CodeAccountInactive)
+		return nil, NewError(CodeAccountInactive, "break-glass account %s is not active", user.Username)
+	}
+
+	session, err := s.sessions.CreateBreakGlassSession(user.ID, client)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	incident := &database.SecurityIncident{
+		UserID:    user.ID,
+		Type:      IncidentBreakGlassUsed,
+		Details:   fmt.Sprintf("%s signed in with break-glass credential %s; its requests are in the authentication log under this session", user.Username, credential.Name),
+		SessionID: session.ID,
+		IPAddress: client.IPAddress,
+		UserAgent: client.UserAgent,
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var locked database.BreakGlassCredential
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Incident").Where("id = ?", credential.ID).First(&locked).Error; err != nil {
+			return NewError(CodeAuthFailed, "invalid break-glass credential")
+		}
+		if BreakGlassUnderReview(&locked) {
+			return NewError(CodeConflict, "break-glass credential %s is locked until the review of its last use is closed", locked.Name)
+		}
+
+		if err := s.incidents.RecordIncident(tx, incident); err != nil {
+			return err
+		}
+		if err := tx.Model(&locked).Updates(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": client.IPAddress,
+			"incident_id":  incident.ID,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to record break-glass use: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		s.sessions.InvalidateSession(session.ID)
+		s.logUse(&credential, nil, client, requestID, ErrorCodeOf(err))
+		return nil, err
+	}
+
+	s.incidents.PublishOpened(incident)
+	s.logUse(&credential, session, client, requestID, "")
+	go s.alertAdmins(&credential, session, incident, now)
+
+	return &BreakGlassResult{
+		User:       user,
+		Session:    session,
+		Incident:   incident,
+		Credential: &credential,
+	}, nil
+}
+
+// logUse records a break-glass sign-in, or a refused one with its error code,
+// in the authentication log
+func (s *BreakGlassService) logUse(credential *database.BreakGlassCredential, session *database.Session, client SessionClient, requestID string, code ErrorCode) {
+	entry := map[string]interface{}{
+		"type":       "login",
+		"success":    session != nil,
+		"ip_address": client.IPAddress,
+		"user_agent": client.UserAgent,
+		"request_id": requestID,
+	}
+	details := map[string]interface{}{"method": "break_glass"}
+	if credential != nil {
+		entry["user_id"] = credential.UserID
+		details["credential"] = credential.Name
+	}
+	if session != nil {
+		details["session_id"] = session.ID
+	}
+	if code != "" {
+		details["error_code"] = string(code)
+	}
+	entry["details"] = details
+
+	if err := s.authService.LogAuthentication(entry); err != nil {
+		log.Printf("Failed to log break-glass sign-in: %v", err)
+	}
+}
+
+// alertAdmins announces a break-glass sign-in on break_glass.alert_channels and
+// by email to the other users with break_glass.admin_role, in the default
+// locale's notification.break_glass.* messages
+func (s *BreakGlassService) alertAdmins(credential *database.BreakGlassCredential, session *database.Session, incident *database.SecurityIncident, usedAt time.Time) {
+	data := map[string]interface{}{
+		"Credential":       credential.Name,
+		"Username":         credential.User.Username,
+		"UsedAt":           usedAt,
+		"IPAddress":        incident.IPAddress,
+		"UserAgent":        incident.UserAgent,
+		"SessionExpiresAt": session.ExpiresAt,
+		"IncidentID":       incident.ID,
+	}
+	locale := s.translator.DefaultLocale()
+	summary := s.translator.Translate(locale, "notification.break_glass.summary", data)
+	body := s.translator.Translate(locale, "notification.break_glass.body", data)
+
+	payload := map[string]interface{}{
+		"event": "break_glass.used",
+		"break_glass": map[string]interface{}{
+			"credential_id": credential.ID,
+			"credential":    credential.Name,
+			"user_id":       credential.UserID,
+			"username":      credential.User.Username,
+			"session_id":    session.ID,
+			"expires_at":    session.ExpiresAt,
+			"incident_id":   incident.ID,
+			"ip_address":    incident.IPAddress,
+			"used_at":       usedAt,
+		},
+	}
+	if err := s.alerts.NotifyChannels(s.config.AlertChannels, summary, body, payload); err != nil {
+		log.Printf("Failed to alert channels of break-glass use: %v", err)
+	}
+
+	if s.config.AdminRole == "" {
+		return
+	}
+	var emails []string
+	if err := s.db.Model(&database.User{}).
+		Joins("JOIN user_roles ur ON ur.user_id = users.id").
+		Joins("JOIN roles r ON r.id = ur.role_id").
+		Where("r.name = ? AND users.active AND users.id <> ? AND users.email <> ''", s.config.AdminRole, credential.UserID).
+		Distinct().Pluck("users.email", &emails).Error; err != nil {
+		log.Printf("Failed to find admins to alert of break-glass use: %v", err)
+		return
+	}
+	if len(emails) == 0 {
+		return
+	}
+	if err := s.notifier.SendEmail(emails, summary, body); err != nil {
+		log.Printf("Failed to email admins of break-glass use: %v", err)
+	}
+}
+
+// generateBreakGlassSecret returns a random secret of two recovery codes, such
+// as "k7m2p-x9qrt-4hzw2-ncq8f"
+func generateBreakGlassSecret() (string, error) {
+	codes := make([]string, 2)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return "", err
+		}
+		codes[i] = code
+	}
+	return strings.Join(codes, "-"), nil
+}
@@ -0,0 +1,368 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Calendar feed kinds
+const (
+	CalendarFeedUser = "user" // One user's activity
+	CalendarFeedRole = "role" // The activity of every member of a role, i.e. a team
+)
+
+// ErrInvalidFeedToken is returned for calendar feed tokens that are malformed,
+// signed for another feed or expired
+var ErrInvalidFeedToken = NewError(CodeAuthFailed, "invalid or expired calendar feed token")
+
+const icalTimeFormat = "20060102T150405Z"
+
+// calendarFeedAhead is how far ahead feeds go by default, covering leave
+// entered in advance
+const calendarFeedAhead = 365 * 24 * time.Hour
+
+// CalendarFeedLink is a signed feed URL calendar clients can subscribe to
+// without signing in
+type CalendarFeedLink struct {
+	URL       string     `json:"url"`
+	Token     string     `json:"token"`
+	ExpiresAt *time.Time `json:"expires_at"` // Nil when calendar.feed_ttl is 0
+}
+
+// calendarEvent is one iCal event: an activity, or several contiguous ones of
+// the same kind merged
+type calendarEvent struct {
+	UID      string
+	Category string // leave, travel, office or home
+	Summary  string
+	Location string
+	Start    time.Time
+	End      time.Time
+	Ongoing  bool
+	UserID   uuid.UUID
+}
+
+// CalendarService exports leave, travel and office or home working entries
+// from the user activity history as iCal feeds
+type CalendarService struct {
+	db     *gorm.DB
+	config *config.Config
+}
+
+func NewCalendarService(db *gorm.DB, config *config.Config) *CalendarService {
+	return &CalendarService{
+		db:     db,
+		config: config,
+	}
+}
+
+// FeedLink signs a link to a user's (CalendarFeedUser) or role's
+// (CalendarFeedRole) feed, valid for calendar.feed_ttl
+func (s *CalendarService) FeedLink(kind string, id uuid.UUID, now time.Time) (*CalendarFeedLink, error) {
+	var model interface{}
+	switch kind {
+	case CalendarFeedUser:
+		model = &database.User{}
+	case CalendarFeedRole:
+		model = &database.Role{}
+	default:
+		return nil, NewError(CodeValidationFailed, "invalid calendar feed kind '%s'", kind)
+	}
+	var count int64
+	if err := s.db.Model(model).Where("id = ?", id).Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("failed to look up %s: %w", kind, err)
+	}
+	if count == 0 {
+		return nil, NewError(CodeNotFound, "%s not found", kind)
+	}
+
+	link := &CalendarFeedLink{}
+	var expires int64
+	if ttl := s.config.Calendar.FeedTTL; ttl > 0 {
+		expiresAt := now.Add(ttl).Truncate(time.Second)
+		link.ExpiresAt = &expiresAt
+		expires = expiresAt.Unix()
+	}
+	link.Token = strconv.FormatInt(expires, 10) + "." + s.signFeed(kind, id, expires)
+	link.URL = fmt.Sprintf("%s/api/v1/%ss/%s/activity.ics?token=%s", strings.TrimSuffix(s.config.Calendar.FeedURL, "/"), kind, id, link.Token)
+	return link, nil
+}
+
+// DefaultRange is the range feeds cover when the request gives none:
+// calendar.past_days back to a year ahead
+func (s *CalendarService) DefaultRange(now time.Time) (time.Time, time.Time) {
+	return now.AddDate(0, 0, -s.config.Calendar.PastDays), now.Add(calendarFeedAhead)
+}
+
+// VerifyFeedToken checks that a token was signed for the given feed and has not expired
+func (s *CalendarService) VerifyFeedToken(kind string, id uuid.UUID, token string, now time.Time) error {
+	expiresStr, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrInvalidFeedToken
+	}
+	expires, err := strconv.ParseInt(expiresStr, 10, 64)
+	if err != nil || expires < 0 {
+		return ErrInvalidFeedToken
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.signFeed(kind, id, expires))) {
+		return ErrInvalidFeedToken
+	}
+	if expires > 0 && now.Unix() >= expires {
+		return ErrInvalidFeedToken
+	}
+	return nil
+}
+
+// signFeed returns the HMAC of a feed and its expiry keyed by the JWT secret
+func (s *CalendarService) signFeed(kind string, id uuid.UUID, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(s.config.Auth.JWTSecret))
+	mac.Write([]byte(fmt.Sprintf("calendar-feed:%s:%s:%d", kind, id, expires)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// UserCalendar renders a user's activity overlapping from to to as an iCal feed
+func (s *CalendarService) UserCalendar(userID uuid.UUID, from, to, now time.Time) (string, error) {
+	var user database.User
+	if err := database.ReadReplica(s.db).Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", NewError(CodeNotFound, "user not found")
+		}
+		return "", fmt.Errorf("failed to get user: %w", err)
+	}
+
+	events, err := s.events([]uuid.UUID{user.ID}, from, to, now)
+	if err != nil {
+		return "", err
+	}
+	return renderICal(calendarUserName(&user)+" activity", events, nil, now), nil
+}
+
+// RoleCalendar renders the activity of a role's members overlapping from to
+// to as an iCal feed, each event titled with the member's name
+func (s *CalendarService) RoleCalendar(roleID uuid.UUID, from, to, now time.Time) (string, error) {
+	var role database.Role
+	if err := database.ReadReplica(s.db).Where("id = ?", roleID).First(&role).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", NewError(CodeNotFound, "role not found")
+		}
+		return "", fmt.Errorf("failed to get role: %w", err)
+	}
+
+	var members []database.User
+	err := database.ReadReplica(s.db).
+		Joins("JOIN user_roles ON user_roles.user_id = users.id").
+		Where("user_roles.role_id = ?", roleID).
+		Find(&members).Error
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch role members: %w", err)
+	}
+
+	names := make(map[uuid.UUID]string, len(members))
+	userIDs := make([]uuid.UUID, len(members))
+	for i := range members {
+		names[members[i].ID] = calendarUserName(&members[i])
+		userIDs[i] = members[i].ID
+	}
+
+	var events []calendarEvent
+	if len(userIDs) > 0 {
+		if events, err = s.events(userIDs, from, to, now); err != nil {
+			return "", err
+		}
+	}
+	return renderICal(role.Name+" team activity", events, names, now), nil
+}
+
+// calendarActivity is an activity with the status and location fields
+// calendar events are derived from
+type calendarActivity struct {
+	ID              uuid.UUID
+	UserID          uuid.UUID
+	FromDateTime    time.Time  `gorm:"column:from_datetime"`
+	ToDateTime      *time.Time `gorm:"column:to_datetime"`
+	StatusName      string
+	StatusType      string
+	LocationName    string
+	LocationAddress string
+	LocationType    string
+}
+
+// events derives calendar events from the users' activities overlapping from
+// to to. Contiguous activities of the same kind are merged, and an activity
+// still open ends now.
+func (s *CalendarService) events(userIDs []uuid.UUID, from, to, now time.Time) ([]calendarEvent, error) {
+	query := `
+		SELECT
+			uah.id,
+			uah.user_id,
+			uah.from_datetime,
+			uah.to_datetime,
+			COALESCE(us.name, '') AS status_name,
+			COALESCE(us.type, '') AS status_type,
+			COALESCE(l.name, '') AS location_name,
+			COALESCE(l.address, '') AS location_address,
+			COALESCE(l.type, '') AS location_type
+		FROM user_activity_history uah
+		LEFT JOIN user_statuses us ON us.id = uah.status_id
+		LEFT JOIN locations l ON l.id = uah.location_id
+		WHERE uah.user_id IN ? AND uah.from_datetime < ? AND (uah.to_datetime IS NULL OR uah.to_datetime > ?)
+		ORDER BY uah.user_id, uah.from_datetime
+	`
+	var activities []calendarActivity
+	if err := database.ReadReplica(s.db).Raw(query, userIDs, to, from).Scan(&activities).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch activities: %w", err)
+	}
+
+	var events []calendarEvent
+	for i := range activities {
+		event, ok := activities[i].calendarEvent(now)
+		if !ok {
+			continue
+		}
+		if n := len(events); n > 0 {
+			last := &events[n-1]
+			if last.UserID == event.UserID && last.Summary == event.Summary && last.Location == event.Location && !event.Start.After(last.End) {
+				if event.End.After(last.End) {
+					last.End = event.End
+					last.Ongoing = event.Ongoing
+				}
+				continue
+			}
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// calendarEvent maps an activity to a calendar event. Activities with a leave
+// or travel status are titled with the status; working activities (or ones
+// without a status) at an office or home location become office or home
+// events. It reports false for everything else: breaks, other statuses and
+// working at other locations.
+func (a *calendarActivity) calendarEvent(now time.Time) (calendarEvent, bool) {
+	event := calendarEvent{
+		UID:    a.ID.String() + "@yubiapp",
+		UserID: a.UserID,
+		Start:  a.FromDateTime,
+	}
+	if a.ToDateTime != nil {
+		event.End = *a.ToDateTime
+	} else {
+		event.End = now
+		event.Ongoing = true
+	}
+	if event.End.Before(event.Start) {
+		event.End = event.Start
+	}
+
+	switch a.StatusType {
+	case "leave", "travel":
+		event.Category = a.StatusType
+		event.Summary = a.StatusName
+	case "working", "":
+		switch a.LocationType {
+		case "office":
+			event.Category = "office"
+			event.Summary = "Office"
+			event.Location = a.LocationName
+			if a.LocationAddress != "" {
+				event.Location += ", " + a.LocationAddress
+			}
+		case "home":
+			event.Category = "home"
+			event.Summary = "Working from home"
+		default:
+			return event, false
+		}
+	default:
+		return event, false
+	}
+	return event, true
+}
+
+// calendarUserName is the name events and feeds show for a user
+func calendarUserName(user *database.User) string {
+	if name := strings.TrimSpace(user.FirstName + " " + user.LastName); name != "" {
+		return name
+	}
+	return user.Username
+}
+
+// renderICal renders events as an RFC 5545 calendar. With names, event
+// summaries are prefixed with the user's name.
+func renderICal(name string, events []calendarEvent, names map[uuid.UUID]string, now time.Time) string {
+	var b strings.Builder
+	line := func(property, value string) {
+		writeICalLine(&b, property+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//YubiApp//Activity Calendar//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	line("X-WR-CALNAME", escapeICalText(name))
+	stamp := now.UTC().Format(icalTimeFormat)
+	for _, event := range events {
+		summary := event.Summary
+		if names != nil {
+			summary = names[event.UserID] + ": " + summary
+		}
+
+		line("BEGIN", "VEVENT")
+		line("UID", event.UID)
+		line("DTSTAMP", stamp)
+		line("DTSTART", event.Start.UTC().Format(icalTimeFormat))
+		line("DTEND", event.End.UTC().Format(icalTimeFormat))
+		line("SUMMARY", escapeICalText(summary))
+		line("CATEGORIES", strings.ToUpper(event.Category))
+		if event.Location != "" {
+			line("LOCATION", escapeICalText(event.Location))
+		}
+		if event.Ongoing {
+			line("DESCRIPTION", "Ongoing")
+		}
+		line("TRANSP", "OPAQUE")
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return b.String()
+}
+
+// escapeICalText escapes an iCal TEXT value
+func escapeICalText(value string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(value)
+}
+
+// writeICalLine writes a content line, folded at 75 octets without splitting
+// UTF-8 characters
+func writeICalLine(b *strings.Builder, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !isUTF8Start(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		limit = 74 // Continuation lines start with a space
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
+
+func isUTF8Start(c byte) bool {
+	return c&0xC0 != 0x80
+}
@@ -0,0 +1,822 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Chat providers
+const (
+	ChatProviderSlack = "slack"
+	ChatProviderTeams = "teams"
+)
+
+// ErrInvalidChatRequest is returned for Slack and Teams requests whose
+// signature does not verify
+var ErrInvalidChatRequest = NewError(CodeAuthFailed, "invalid chat request signature")
+
+// slackOAuthStateTTL is how long a Slack authorization link stays usable
+const slackOAuthStateTTL = 30 * time.Minute
+
+// teamsActivities maps the Teams availabilities a status may set to the
+// activity setUserPreferredPresence pairs them with
+var teamsActivities = map[string]string{
+	"Available":    "Available",
+	"Busy":         "Busy",
+	"DoNotDisturb": "DoNotDisturb",
+	"BeRightBack":  "BeRightBack",
+	"Away":         "Away",
+	"Offline":      "OffWork",
+}
+
+// teamsMentionPattern matches the <at>bot</at> mention Teams puts in front of
+// outgoing webhook messages
+var teamsMentionPattern = regexp.MustCompile(`<at>[^<]*</at>`)
+
+// ChatStatus is the status performing an action sets in a chat workspace
+type ChatStatus struct {
+	Text           string `json:"text,omitempty" doc:"e.g. On a break"`
+	Emoji          string `json:"emoji,omitempty" doc:"Slack only, e.g. :coffee:"`
+	Availability   string `json:"availability,omitempty" enum:"Available,Busy,DoNotDisturb,BeRightBack,Away,Offline" doc:"Teams only"`
+	ExpiresMinutes int    `json:"expires_minutes,omitempty" doc:"Clear the status after this many minutes; 0 keeps it"`
+	Clear          bool   `json:"clear,omitempty" doc:"Clear the status instead, e.g. on sign-out"`
+}
+
+// ChatPresence is a user's presence as the /yubiapp status command reports it
+type ChatPresence struct {
+	UserID   uuid.UUID
+	Name     string
+	Present  bool       // Whether the user's latest activity is still open
+	Status   string     // Status of the open activity, e.g. Working or On break
+	Location string     // Location of the open activity
+	Since    *time.Time // When the latest activity started, or ended when not present
+}
+
+type teamsToken struct {
+	value     string
+	expiresAt time.Time
+}
+
+// ChatIntegrationService connects Slack workspaces and Microsoft Teams tenants:
+// performing an action updates the user's chat status according to the
+// workspace's status mappings, and the signed /yubiapp command reports team
+// presence
+type ChatIntegrationService struct {
+	db         *gorm.DB
+	config     *config.Config
+	httpClient *http.Client
+
+	tokensMu    sync.Mutex
+	teamsTokens map[uuid.UUID]teamsToken // App tokens by workspace
+}
+
+// NewChatIntegrationService creates the service and subscribes it to
+// action.performed events on the bus
+func NewChatIntegrationService(db *gorm.DB, config *config.Config, bus *EventBus) *ChatIntegrationService {
+	s := &ChatIntegrationService{
+		db:          db,
+		config:      config,
+		httpClient:  &http.Client{Timeout: 10 * time.Second},
+		teamsTokens: map[uuid.UUID]teamsToken{},
+	}
+	bus.Subscribe(EventActionPerformed, s.handleActionPerformed)
+	return s
+}
+
+// CreateWorkspace registers a Slack workspace or Teams tenant
+func (s *ChatIntegrationService) CreateWorkspace(workspace *database.ChatWorkspace, mappings map[string]ChatStatus) (*database.ChatWorkspace, error) {
+	if strings.TrimSpace(workspace.Name) == "" {
+		return nil, NewError(CodeValidationFailed, "workspace name is required")
+	}
+	if workspace.Provider != ChatProviderSlack && workspace.Provider != ChatProviderTeams {
+		return nil, NewError(CodeValidationFailed, "invalid provider '%s'; use slack or teams", workspace.Provider)
+	}
+	if strings.TrimSpace(workspace.ExternalID) == "" {
+		return nil, NewError(CodeValidationFailed, "external_id is required: the Slack team ID or Teams tenant ID")
+	}
+	mappingsJSONB, err := chatStatusMappingsJSONB(mappings)
+	if err != nil {
+		return nil, err
+	}
+
+	active := workspace.Active
+	workspace.ID = uuid.New()
+	workspace.StatusMappings = mappingsJSONB
+	if err := s.db.Create(workspace).Error; err != nil {
+		return nil, fmt.Errorf("failed to create chat workspace: %w", err)
+	}
+
+	// Create skips zero values for columns with defaults, so an inactive workspace needs an explicit update
+	if !active {
+		if err := s.db.Model(workspace).Update("active", false).Error; err != nil {
+			return nil, fmt.Errorf("failed to create chat workspace: %w", err)
+		}
+	}
+
+	return s.GetWorkspaceByID(workspace.ID)
+}
+
+// GetWorkspaceByID retrieves a chat workspace by ID
+func (s *ChatIntegrationService) GetWorkspaceByID(id uuid.UUID) (*database.ChatWorkspace, error) {
+	var workspace database.ChatWorkspace
+	if err := s.db.Where("id = ?", id).First(&workspace).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "chat workspace not found")
+		}
+		return nil, fmt.Errorf("failed to get chat workspace: %w", err)
+	}
+	return &workspace, nil
+}
+
+// ListWorkspaces retrieves all chat workspaces
+func (s *ChatIntegrationService) ListWorkspaces() ([]database.ChatWorkspace, error) {
+	var workspaces []database.ChatWorkspace
+	if err := s.db.Order("name").Find(&workspaces).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch chat workspaces: %w", err)
+	}
+	return workspaces, nil
+}
+
+// UpdateWorkspace updates a chat workspace; nil mappings leave the status mappings unchanged
+func (s *ChatIntegrationService) UpdateWorkspace(id uuid.UUID, updates map[string]interface{}, mappings map[string]ChatStatus) (*database.ChatWorkspace, error) {
+	if _, err := s.GetWorkspaceByID(id); err != nil {
+		return nil, err
+	}
+	if provider, ok := updates["provider"].(string); ok && provider != ChatProviderSlack && provider != ChatProviderTeams {
+		return nil, NewError(CodeValidationFailed, "invalid provider '%s'; use slack or teams", provider)
+	}
+	if mappings != nil {
+		mappingsJSONB, err := chatStatusMappingsJSONB(mappings)
+		if err != nil {
+			return nil, err
+		}
+		updates["status_mappings"] = mappingsJSONB
+	}
+
+	if err := s.db.Model(&database.ChatWorkspace{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to update chat workspace: %w", err)
+	}
+
+	// Credentials may have changed
+	s.tokensMu.Lock()
+	delete(s.teamsTokens, id)
+	s.tokensMu.Unlock()
+
+	return s.GetWorkspaceByID(id)
+}
+
+// DeleteWorkspace permanently deletes a chat workspace and its user links
+func (s *ChatIntegrationService) DeleteWorkspace(id uuid.UUID) error {
+	result := s.db.Where("id = ?", id).Delete(&database.ChatWorkspace{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete chat workspace: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return NewError(CodeNotFound, "chat workspace not found")
+	}
+	return nil
+}
+
+// ChatStatusMappings returns a workspace's status mappings by action name
+func ChatStatusMappings(workspace *database.ChatWorkspace) map[string]ChatStatus {
+	mappings := map[string]ChatStatus{}
+	if workspace.StatusMappings.Status == pgtype.Present {
+		if err := json.Unmarshal(workspace.StatusMappings.Bytes, &mappings); err != nil {
+			return map[string]ChatStatus{}
+		}
+	}
+	return mappings
+}
+
+// chatStatusMappingsJSONB validates status mappings and encodes them for storage
+func chatStatusMappingsJSONB(mappings map[string]ChatStatus) (pgtype.JSONB, error) {
+	var mappingsJSONB pgtype.JSONB
+	if mappings == nil {
+		mappings = map[string]ChatStatus{}
+	}
+	for action, status := range mappings {
+		if status.Clear {
+			continue
+		}
+		if status.Text == "" && status.Emoji == "" && status.Availability == "" {
+			return mappingsJSONB, NewError(CodeValidationFailed, "status for action '%s' needs text, emoji or availability, or clear", action)
+		}
+		if _, ok := teamsActivities[status.Availability]; status.Availability != "" && !ok {
+			return mappingsJSONB, NewError(CodeValidationFailed, "invalid availability '%s' for action '%s'; use Available, Busy, DoNotDisturb, BeRightBack, Away or Offline", status.Availability, action)
+		}
+		if status.ExpiresMinutes < 0 {
+			return mappingsJSONB, NewError(CodeValidationFailed, "expires_minutes for action '%s' cannot be negative", action)
+		}
+	}
+	if err := mappingsJSONB.Set(mappings); err != nil {
+		return mappingsJSONB, fmt.Errorf("failed to encode status mappings: %w", err)
+	}
+	return mappingsJSONB, nil
+}
+
+// ListLinks returns the users linked in a workspace
+func (s *ChatIntegrationService) ListLinks(workspaceID uuid.UUID) ([]database.ChatUserLink, error) {
+	var links []database.ChatUserLink
+	if err := s.db.Preload("User").Where("workspace_id = ?", workspaceID).Order("created_at").Find(&links).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch chat user links: %w", err)
+	}
+	return links, nil
+}
+
+// LinkUser links a user to their account in a workspace, replacing an earlier link.
+// accessToken is the Slack user token; Teams links need none.
+func (s *ChatIntegrationService) LinkUser(workspaceID, userID uuid.UUID, externalUserID, accessToken string) (*database.ChatUserLink, error) {
+	if _, err := s.GetWorkspaceByID(workspaceID); err != nil {
+		return nil, err
+	}
+	var users int64
+	if err := s.db.Model(&database.User{}).Where("id = ?", userID).Count(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to look up user: %w", err)
+	}
+	if users == 0 {
+		return nil, NewError(CodeNotFound, "user not found")
+	}
+	if strings.TrimSpace(externalUserID) == "" {
+		return nil, NewError(CodeValidationFailed, "external_user_id is required: the Slack user ID or Teams object ID")
+	}
+
+	var taken int64
+	if err := s.db.Model(&database.ChatUserLink{}).
+		Where("workspace_id = ? AND external_user_id = ? AND user_id <> ?", workspaceID, externalUserID, userID).
+		Count(&taken).Error; err != nil {
+		return nil, fmt.Errorf("failed to check chat user links: %w", err)
+	}
+	if taken > 0 {
+		return nil, NewError(CodeConflict, "chat account '%s' is already linked to another user", externalUserID)
+	}
+
+	link := database.ChatUserLink{
+		WorkspaceID:    workspaceID,
+		UserID:         userID,
+		ExternalUserID: externalUserID,
+		AccessToken:    accessToken,
+	}
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "workspace_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"external_user_id", "access_token", "updated_at"}),
+	}).Create(&link).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to link chat user: %w", err)
+	}
+
+	if err := s.db.Preload("User").Where("workspace_id = ? AND user_id = ?", workspaceID, userID).First(&link).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch chat user link: %w", err)
+	}
+	return &link, nil
+}
+
+// UnlinkUser removes a user's link to a workspace
+func (s *ChatIntegrationService) UnlinkUser(workspaceID, userID uuid.UUID) error {
+	result := s.db.Where("workspace_id = ? AND user_id = ?", workspaceID, userID).Delete(&database.ChatUserLink{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to unlink chat user: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return NewError(CodeNotFound, "user is not linked to this workspace")
+	}
+	return nil
+}
+
+// SlackAuthorizeURL returns the Slack OAuth link a user opens to let YubiApp
+// set their status; completing it links their Slack account
+func (s *ChatIntegrationService) SlackAuthorizeURL(workspaceID, userID uuid.UUID, now time.Time) (string, error) {
+	workspace, err := s.GetWorkspaceByID(workspaceID)
+	if err != nil {
+		return "", err
+	}
+	if workspace.Provider != ChatProviderSlack {
+		return "", NewError(CodeValidationFailed, "only Slack workspaces link users through OAuth")
+	}
+	if workspace.ClientID == "" || workspace.ClientSecret == "" {
+		return "", NewError(CodeValidationFailed, "the workspace has no OAuth client_id and client_secret")
+	}
+
+	expires := now.Add(slackOAuthStateTTL).Unix()
+	payload := fmt.Sprintf("%s.%s.%d", workspaceID, userID, expires)
+	query := url.Values{
+		"client_id":  {workspace.ClientID},
+		"user_scope": {"users.profile:write"},
+		"state":      {payload + "." + s.signOAuthState(payload)},
+		"team":       {workspace.ExternalID},
+	}
+	if s.config.Chat.OAuthRedirectURL != "" {
+		query.Set("redirect_uri", s.config.Chat.OAuthRedirectURL)
+	}
+	return strings.TrimSuffix(s.config.Chat.SlackURL, "/") + "/oauth/v2/authorize?" + query.Encode(), nil
+}
+
+// CompleteSlackOAuth exchanges the code Slack redirected back with for the
+// user's token and links their Slack account
+func (s *ChatIntegrationService) CompleteSlackOAuth(code, state string, now time.Time) (*database.ChatUserLink, error) {
+	parts := strings.Split(state, ".")
+	if len(parts) != 4 {
+		return nil, NewError(CodeAuthFailed, "invalid OAuth state")
+	}
+	payload := strings.Join(parts[:3], ".")
+	if !hmac.Equal([]byte(parts[3]), []byte(s.signOAuthState(payload))) {
+		return nil, NewError(CodeAuthFailed, "invalid OAuth state")
+	}
+	workspaceID, err1 := uuid.Parse(parts[0])
+	userID, err2 := uuid.Parse(parts[1])
+	expires, err3 := strconv.ParseInt(parts[2], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil || now.Unix() >= expires {
+		return nil, NewError(CodeAuthFailed, "invalid or expired OAuth state")
+	}
+
+	workspace, err := s.GetWorkspaceByID(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"client_id":     {workspace.ClientID},
+		"client_secret": {workspace.ClientSecret},
+		"code":          {code},
+	}
+	if s.config.Chat.OAuthRedirectURL != "" {
+		form.Set("redirect_uri", s.config.Chat.OAuthRedirectURL)
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(s.config.Chat.SlackURL, "/")+"/api/oauth.v2.access", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Slack OAuth request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var access struct {
+		Team struct {
+			ID string `json:"id"`
+		} `json:"team"`
+		AuthedUser struct {
+			ID          string `json:"id"`
+			AccessToken string `json:"access_token"`
+		} `json:"authed_user"`
+	}
+	if err := s.slackCall(req, &access); err != nil {
+		return nil, NewError(CodeUpstreamFailed, "Slack OAuth failed: %v", err)
+	}
+	if access.Team.ID != workspace.ExternalID {
+		return nil, NewError(CodeValidationFailed, "authorized Slack workspace %s is not %s", access.Team.ID, workspace.ExternalID)
+	}
+	if access.AuthedUser.AccessToken == "" {
+		return nil, NewError(CodeUpstreamFailed, "Slack returned no user token")
+	}
+
+	return s.LinkUser(workspaceID, userID, access.AuthedUser.ID, access.AuthedUser.AccessToken)
+}
+
+// signOAuthState returns the HMAC of an OAuth state payload keyed by the JWT secret
+func (s *ChatIntegrationService) signOAuthState(payload string) string {
+	mac := hmac.New(sha256.New, []byte(s.config.Auth.JWTSecret))
+	mac.Write([]byte("chat-oauth:" + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// handleActionPerformed updates the performing user's chat statuses
+func (s *ChatIntegrationService) handleActionPerformed(event Event) {
+	performed, ok := event.Data.(SideEffectEvent)
+	if !ok {
+		return
+	}
+	s.UpdateStatuses(performed.UserID, performed.Action, performed.OccurredAt)
+}
+
+// UpdateStatuses sets the user's status in every active workspace they are
+// linked to that maps the action to a status. Each link records the outcome.
+func (s *ChatIntegrationService) UpdateStatuses(userID uuid.UUID, action string, now time.Time) {
+	var links []database.ChatUserLink
+	err := s.db.Preload("Workspace").
+		Joins("JOIN chat_workspaces ON chat_workspaces.id = chat_user_links.workspace_id").
+		Where("chat_user_links.user_id = ? AND chat_workspaces.active = ?", userID, true).
+		Find(&links).Error
+	if err != nil {
+		log.Printf("Failed to load chat links of user %s: %v", userID, err)
+		return
+	}
+
+	for i := range links {
+		link := &links[i]
+		status, ok := ChatStatusMappings(&link.Workspace)[action]
+		if !ok {
+			continue
+		}
+
+		var err error
+		if link.Workspace.Provider == ChatProviderTeams {
+			err = s.setTeamsStatus(&link.Workspace, link, status, now)
+		} else {
+			err = s.setSlackStatus(link, status, now)
+		}
+		lastError := ""
+		if err != nil {
+			log.Printf("Failed to update %s status of user %s in %s: %v", link.Workspace.Provider, userID, link.Workspace.Name, err)
+			lastError = err.Error()
+		}
+		s.db.Model(&database.ChatUserLink{}).
+			Where("workspace_id = ? AND user_id = ?", link.WorkspaceID, link.UserID).
+			Updates(map[string]interface{}{"last_status_at": now, "last_error": lastError})
+	}
+}
+
+// setSlackStatus sets a Slack user's status with their own token
+func (s *ChatIntegrationService) setSlackStatus(link *database.ChatUserLink, status ChatStatus, now time.Time) error {
+	if link.AccessToken == "" {
+		return fmt.Errorf("the Slack account has not authorized YubiApp")
+	}
+
+	profile := map[string]interface{}{
+		"status_text":       "",
+		"status_emoji":      "",
+		"status_expiration": 0,
+	}
+	if !status.Clear {
+		profile["status_text"] = status.Text
+		profile["status_emoji"] = status.Emoji
+		if status.ExpiresMinutes > 0 {
+			profile["status_expiration"] = now.Add(time.Duration(status.ExpiresMinutes) * time.Minute).Unix()
+		}
+	}
+	body, err := json.Marshal(map[string]interface{}{"profile": profile})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(s.config.Chat.SlackURL, "/")+"/api/users.profile.set", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create Slack request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+link.AccessToken)
+	return s.slackCall(req, nil)
+}
+
+// slackCall sends a Slack Web API request, decoding the response into out.
+// Slack reports failures with ok false and an error code.
+func (s *ChatIntegrationService) slackCall(req *http.Request, out interface{}) error {
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Slack returned status %d", resp.StatusCode)
+	}
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return fmt.Errorf("invalid Slack response: %w", err)
+	}
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return fmt.Errorf("invalid Slack response: %w", err)
+	}
+	if !result.OK {
+		return fmt.Errorf("Slack error: %s", result.Error)
+	}
+	if out != nil {
+		return json.Unmarshal(raw, out)
+	}
+	return nil
+}
+
+// setTeamsStatus sets a Teams user's status message and, when the status has
+// one, their preferred availability, with the workspace app's token
+func (s *ChatIntegrationService) setTeamsStatus(workspace *database.ChatWorkspace, link *database.ChatUserLink, status ChatStatus, now time.Time) error {
+	token, err := s.teamsAppToken(workspace, now)
+	if err != nil {
+		return err
+	}
+	presenceURL := strings.TrimSuffix(s.config.Chat.GraphURL, "/") + "/users/" + url.PathEscape(link.ExternalUserID) + "/presence/"
+
+	if status.Clear {
+		if err := s.graphPost(token, presenceURL+"clearUserPreferredPresence", map[string]interface{}{}); err != nil {
+			return err
+		}
+		return s.graphPost(token, presenceURL+"setStatusMessage", map[string]interface{}{
+			"statusMessage": map[string]interface{}{
+				"message": map[string]string{"content": "", "contentType": "text"},
+			},
+		})
+	}
+
+	if status.Availability != "" {
+		preferred := map[string]interface{}{
+			"availability": status.Availability,
+			"activity":     teamsActivities[status.Availability],
+		}
+		if status.ExpiresMinutes > 0 {
+			preferred["expirationDuration"] = fmt.Sprintf("PT%dM", status.ExpiresMinutes)
+		}
+		if err := s.graphPost(token, presenceURL+"setUserPreferredPresence", preferred); err != nil {
+			return err
+		}
+	}
+	if status.Text != "" {
+		message := map[string]interface{}{
+			"message": map[string]string{"content": status.Text, "contentType": "text"},
+		}
+		if status.ExpiresMinutes > 0 {
+			message["expiryDateTime"] = map[string]string{
+				"dateTime": now.Add(time.Duration(status.ExpiresMinutes) * time.Minute).UTC().Format("2006-01-02T15:04:05"),
+				"timeZone": "UTC",
+			}
+		}
+		if err := s.graphPost(token, presenceURL+"setStatusMessage", map[string]interface{}{"statusMessage": message}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// graphPost POSTs payload to a Microsoft Graph URL; any non-2xx response is an error
+func (s *ChatIntegrationService) graphPost(token, graphURL string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, graphURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create Graph request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Graph returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// teamsAppToken returns the workspace app's Graph token from the client
+// credentials grant, cached until shortly before it expires
+func (s *ChatIntegrationService) teamsAppToken(workspace *database.ChatWorkspace, now time.Time) (string, error) {
+	s.tokensMu.Lock()
+	cached, ok := s.teamsTokens[workspace.ID]
+	s.tokensMu.Unlock()
+	if ok && now.Before(cached.expiresAt) {
+		return cached.value, nil
+	}
+
+	if workspace.ClientID == "" || workspace.ClientSecret == "" {
+		return "", fmt.Errorf("the workspace has no OAuth client_id and client_secret")
+	}
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {workspace.ClientID},
+		"client_secret": {workspace.ClientSecret},
+		"scope":         {"https://graph.microsoft.com/.default"},
+	}
+	tokenURL := strings.TrimSuffix(s.config.Chat.LoginURL, "/") + "/" + url.PathEscape(workspace.ExternalID) + "/oauth2/v2.0/token"
+	resp, err := s.httpClient.PostForm(tokenURL, form)
+	if err != nil {
+		return "", fmt.Errorf("failed to get Teams app token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Teams app token request returned status %d", resp.StatusCode)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil || token.AccessToken == "" {
+		return "", fmt.Errorf("invalid Teams app token response")
+	}
+
+	s.tokensMu.Lock()
+	s.teamsTokens[workspace.ID] = teamsToken{
+		value:     token.AccessToken,
+		expiresAt: now.Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute),
+	}
+	s.tokensMu.Unlock()
+	return token.AccessToken, nil
+}
+
+// HandleSlackCommand verifies a Slack slash command request signed with the
+// workspace's signing secret and returns the reply text
+func (s *ChatIntegrationService) HandleSlackCommand(body []byte, timestamp, signature string, now time.Time) (string, error) {
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return "", NewError(CodeValidationFailed, "invalid Slack command body")
+	}
+
+	var workspace database.ChatWorkspace
+	if err := s.db.Where("provider = ? AND external_id = ? AND active = ?", ChatProviderSlack, form.Get("team_id"), true).First(&workspace).Error; err != nil {
+		return "", ErrInvalidChatRequest
+	}
+	if workspace.SigningSecret == "" {
+		return "", ErrInvalidChatRequest
+	}
+
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", ErrInvalidChatRequest
+	}
+	if age := now.Sub(time.Unix(sent, 0)); age > s.config.Chat.RequestMaxAge || age < -s.config.Chat.RequestMaxAge {
+		return "", ErrInvalidChatRequest
+	}
+	mac := hmac.New(sha256.New, []byte(workspace.SigningSecret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	if !hmac.Equal([]byte(signature), []byte("v0="+hex.EncodeToString(mac.Sum(nil)))) {
+		return "", ErrInvalidChatRequest
+	}
+
+	return s.command(&workspace, form.Get("user_id"), form.Get("text"), now)
+}
+
+// HandleTeamsCommand verifies a Teams outgoing webhook request signed with the
+// workspace's security token and returns the reply text
+func (s *ChatIntegrationService) HandleTeamsCommand(workspaceID uuid.UUID, body []byte, authorization string, now time.Time) (string, error) {
+	var workspace database.ChatWorkspace
+	if err := s.db.Where("id = ? AND provider = ? AND active = ?", workspaceID, ChatProviderTeams, true).First(&workspace).Error; err != nil {
+		return "", ErrInvalidChatRequest
+	}
+	key, err := base64.StdEncoding.DecodeString(workspace.SigningSecret)
+	if err != nil || len(key) == 0 {
+		return "", ErrInvalidChatRequest
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	if !hmac.Equal([]byte(authorization), []byte("HMAC "+base64.StdEncoding.EncodeToString(mac.Sum(nil)))) {
+		return "", ErrInvalidChatRequest
+	}
+
+	var message struct {
+		Text string `json:"text"`
+		From struct {
+			AADObjectID string `json:"aadObjectId"`
+		} `json:"from"`
+	}
+	if err := json.Unmarshal(body, &message); err != nil {
+		return "", NewError(CodeValidationFailed, "invalid Teams message")
+	}
+	text := teamsMentionPattern.ReplaceAllString(message.Text, "")
+	return s.command(&workspace, message.From.AADObjectID, text, now)
+}
+
+// command runs a /yubiapp command for a workspace account. Only accounts
+// linked to a user may query presence.
+func (s *ChatIntegrationService) command(workspace *database.ChatWorkspace, externalUserID, text string, now time.Time) (string, error) {
+	var requesters int64
+	if err := s.db.Model(&database.ChatUserLink{}).
+		Where("workspace_id = ? AND external_user_id = ?", workspace.ID, externalUserID).
+		Count(&requesters).Error; err != nil {
+		return "", fmt.Errorf("failed to look up chat user: %w", err)
+	}
+	if requesters == 0 {
+		return "Your account is not linked to YubiApp yet; ask an administrator to link it.", nil
+	}
+
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !strings.EqualFold(fields[0], "status") {
+		return "Usage: `/yubiapp status` for everyone linked in this workspace, or `/yubiapp status <role>` for a team.", nil
+	}
+
+	title := "Presence"
+	var userIDs []uuid.UUID
+	if len(fields) > 1 {
+		roleName := strings.Join(fields[1:], " ")
+		var role database.Role
+		if err := s.db.Where("LOWER(name) = LOWER(?)", roleName).First(&role).Error; err != nil {
+			return fmt.Sprintf("There is no team called %s.", roleName), nil
+		}
+		title = "Presence of " + role.Name
+		if err := s.db.Model(&database.UserRole{}).Where("role_id = ?", role.ID).Pluck("user_id", &userIDs).Error; err != nil {
+			return "", fmt.Errorf("failed to fetch role members: %w", err)
+		}
+	} else if err := s.db.Model(&database.ChatUserLink{}).Where("workspace_id = ?", workspace.ID).Pluck("user_id", &userIDs).Error; err != nil {
+		return "", fmt.Errorf("failed to fetch linked users: %w", err)
+	}
+
+	presence, err := s.Presence(userIDs)
+	if err != nil {
+		return "", err
+	}
+	return formatChatPresence(title, presence), nil
+}
+
+type chatPresenceRow struct {
+	UserID       uuid.UUID
+	FirstName    string
+	LastName     string
+	Username     string
+	FromDateTime *time.Time `gorm:"column:from_datetime"`
+	ToDateTime   *time.Time `gorm:"column:to_datetime"`
+	StatusName   string
+	LocationName string
+}
+
+// Presence returns the users' presence from their latest activity, by name
+func (s *ChatIntegrationService) Presence(userIDs []uuid.UUID) ([]ChatPresence, error) {
+	if len(userIDs) == 0 {
+		return []ChatPresence{}, nil
+	}
+
+	query := `
+		SELECT
+			u.id AS user_id,
+			u.first_name,
+			u.last_name,
+			u.username,
+			uah.from_datetime,
+			uah.to_datetime,
+			COALESCE(us.name, '') AS status_name,
+			COALESCE(l.name, '') AS location_name
+		FROM users u
+		LEFT JOIN user_activity_history uah ON uah.user_id = u.id AND uah.from_datetime = (
+			SELECT MAX(latest.from_datetime) FROM user_activity_history latest WHERE latest.user_id = u.id
+		)
+		LEFT JOIN user_statuses us ON us.id = uah.status_id
+		LEFT JOIN locations l ON l.id = uah.location_id
+		WHERE u.id IN ? AND u.deleted_at IS NULL
+	`
+	var rows []chatPresenceRow
+	if err := database.ReadReplica(s.db).Raw(query, userIDs).Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch presence: %w", err)
+	}
+
+	presence := make([]ChatPresence, 0, len(rows))
+	for _, row := range rows {
+		p := ChatPresence{
+			UserID: row.UserID,
+			Name:   calendarUserName(&database.User{FirstName: row.FirstName, LastName: row.LastName, Username: row.Username}),
+		}
+		switch {
+		case row.FromDateTime == nil:
+		case row.ToDateTime == nil:
+			p.Present = true
+			p.Status = row.StatusName
+			if p.Status == "" {
+				p.Status = "Working"
+			}
+			p.Location = row.LocationName
+			p.Since = row.FromDateTime
+		default:
+			p.Since = row.ToDateTime
+		}
+		presence = append(presence, p)
+	}
+	sort.Slice(presence, func(i, j int) bool { return presence[i].Name < presence[j].Name })
+	return presence, nil
+}
+
+// formatChatPresence renders presence as a chat message, one line per user
+func formatChatPresence(title string, presence []ChatPresence) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%s*", title)
+	if len(presence) == 0 {
+		b.WriteString("\nNobody to show.")
+	}
+	for _, p := range presence {
+		fmt.Fprintf(&b, "\n• %s: ", p.Name)
+		switch {
+		case p.Present:
+			b.WriteString(p.Status)
+			if p.Location != "" {
+				b.WriteString(" at " + p.Location)
+			}
+			fmt.Fprintf(&b, " since %s", p.Since.UTC().Format("Jan 2 15:04 MST"))
+		case p.Since != nil:
+			fmt.Fprintf(&b, "Away since %s", p.Since.UTC().Format("Jan 2 15:04 MST"))
+		default:
+			b.WriteString("No activity")
+		}
+	}
+	return b.String()
+}
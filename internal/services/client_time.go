@@ -0,0 +1,53 @@
+package services
+
+import (
+	"time"
+)
+
+// ClientTimeFields are the request fields in which clients report when
+// something happened, in RFC 3339
+var ClientTimeFields = []string{"start_time", "end_time"}
+
+// ClientTime is a time a client reported, checked against the server clock
+type ClientTime struct {
+	Client  time.Time `json:"client"`            // As reported
+	Server  time.Time `json:"server"`            // Server time when the request arrived
+	Time    time.Time `json:"time"`              // Client time clamped to within the skew window of Server
+	Clamped bool      `json:"clamped,omitempty"` // The client time was outside the window
+}
+
+// CheckClientTimes validates the ClientTimeFields in body and clamps each to
+// within skew of now, so a kiosk with a wrong clock cannot record times far
+// from when it spoke to the server. A skew of 0 keeps the times as reported.
+// An unparseable time, or an end_time before start_time, is VALIDATION_FAILED.
+func CheckClientTimes(body map[string]interface{}, now time.Time, skew time.Duration) (map[string]ClientTime, error) {
+	times := map[string]ClientTime{}
+	for _, field := range ClientTimeFields {
+		value, ok := body[field]
+		if !ok || value == nil {
+			continue
+		}
+		text, _ := value.(string)
+		reported, err := time.Parse(time.RFC3339, text)
+		if err != nil {
+			return nil, NewError(CodeValidationFailed, "%s must be an RFC 3339 time, e.g. 2006-01-02T15:04:05Z", field)
+		}
+
+		checked := ClientTime{Client: reported, Server: now, Time: reported}
+		if skew > 0 {
+			if earliest := now.Add(-skew); reported.Before(earliest) {
+				checked.Time, checked.Clamped = earliest, true
+			} else if latest := now.Add(skew); reported.After(latest) {
+				checked.Time, checked.Clamped = latest, true
+			}
+		}
+		times[field] = checked
+	}
+
+	start, hasStart := times["start_time"]
+	end, hasEnd := times["end_time"]
+	if hasStart && hasEnd && end.Client.Before(start.Client) {
+		return nil, NewError(CodeValidationFailed, "end_time must not be before start_time")
+	}
+	return times, nil
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"strings"
+
+	"github.com/YubiApp/internal/database"
+)
+
+// yubikey.degraded_mode policies for YubiKey sign-ins while YubiCloud is unavailable
+const (
+	DegradedModeDeny  = "deny"  // Fail with VALIDATION_SERVICE_UNAVAILABLE
+	DegradedModeAllow = "allow" // Accept the OTP unverified, marked in the log
+	DegradedModeTOTP  = "totp"  // Refuse the YubiKey but accept the user's TOTP device, even where role policies would not
+)
+
+type actionNameKey struct{}
+
+// WithActionName returns a copy of ctx naming the action a device code is
+// authenticated for, whose yubikey.degraded_mode.actions policy then applies
+func WithActionName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, actionNameKey{}, name)
+}
+
+// degradedPolicy returns the yubikey.degraded_mode policy for permission, given
+// as "resource:action", falling back to its resource's; for no permission, that
+// of the action named in ctx; else the default
+func (s *AuthService) degradedPolicy(ctx context.Context, permission string) string {
+	cfg := s.config.Yubikey.DegradedMode
+	if permission != "" {
+		// Config keys are case-insensitive
+		resourceName, _, _ := strings.Cut(permission, ":")
+		for _, key := range []string{permission, resourceName} {
+			if policy, ok := cfg.Permissions[strings.ToLower(key)]; ok {
+				return policy
+			}
+		}
+	} else if action, _ := ctx.Value(actionNameKey{}).(string); action != "" {
+		if policy, ok := cfg.Actions[strings.ToLower(action)]; ok {
+			return policy
+		}
+	}
+	return cfg.Default
+}
+
+// degradedYubikey applies the degraded mode policy for permission to a YubiKey
+// OTP that failed verification with err. When YubiCloud was unavailable it
+// returns the policy applied, and a nil error if it allows the sign-in. Allowing
+// needs the OTP replay cache, which then refuses the unverified OTP if it is
+// presented again; without it, or when it fails, the sign-in is refused.
+func (s *AuthService) degradedYubikey(ctx context.Context, device *database.Device, otp, permission string, err error) (string, error) {
+	if device == nil || ErrorCodeOf(err) != CodeValidationUnavailable {
+		return "", err
+	}
+	policy := s.degradedPolicy(ctx, permission)
+	switch policy {
+	case DegradedModeAllow:
+		if !s.replayCache.Enabled() {
+			return policy, NewError(CodeValidationUnavailable, "validation service unavailable and the OTP replay cache is disabled")
+		}
+		seen, seenErr := s.replayCache.Seen(ctx, device.ID, otp)
+		if seenErr != nil {
+			return policy, WrapError(CodeValidationUnavailable, "validation service unavailable and the OTP replay cache could not be checked", seenErr)
+		}
+		if seen {
+			return policy, NewError(CodeAuthReplayedOTP, "replayed OTP detected by the replay cache")
+		}
+		return policy, nil
+	case DegradedModeTOTP:
+		return policy, NewError(CodeValidationUnavailable, "validation service unavailable; authenticate with a TOTP device instead")
+	}
+	return policy, err
+}
+
+// degradedTOTP returns DegradedModeTOTP when a TOTP sign-in for permission is
+// one the degraded mode policy falls back to, as YubiCloud is unavailable
+func (s *AuthService) degradedTOTP(ctx context.Context, permission string) string {
+	if s.yubicloud.unavailable() && s.degradedPolicy(ctx, permission) == DegradedModeTOTP {
+		return DegradedModeTOTP
+	}
+	return ""
+}
@@ -0,0 +1,303 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// deviceLastUsedBuckets are the last-used distribution buckets, most recent
+// first; a device falls in the first bucket its last use is within
+var deviceLastUsedBuckets = []struct {
+	Label string
+	Days  int
+}{
+	{"7_days", 7},
+	{"30_days", 30},
+	{"90_days", 90},
+	{"365_days", 365},
+}
+
+// deviceReportTopFailures caps the failure rate table of the emailed report
+const deviceReportTopFailures = 10
+
+// DeviceAnalyticsFilter selects the devices and the authentication log range
+// of an analytics report
+type DeviceAnalyticsFilter struct {
+	Type       string // Device type; empty for all
+	From       time.Time
+	To         time.Time
+	UnusedDays int // 0 uses devices.analytics.unused_days
+}
+
+// DeviceUsage is one device's authentications in the report range
+type DeviceUsage struct {
+	DeviceID     uuid.UUID  `json:"device_id"`
+	Type         string     `json:"type"`
+	Identifier   string     `json:"identifier"`
+	SerialNumber string     `json:"serial_number,omitempty"`
+	UserID       *uuid.UUID `json:"user_id"` // nil for unassigned devices
+	Username     string     `json:"username"`
+	Role         string     `json:"role"`
+	State        string     `json:"state"`
+	Active       bool       `json:"active"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+	DaysUnused   int        `json:"days_unused"` // Days since last use, or since registration when never used
+	AuthLogCounts
+	FailureRate float64 `json:"failure_rate"` // Failed / total, 0 when unused
+}
+
+// DeviceLastUsedBucket counts devices by how long ago they were last used
+type DeviceLastUsedBucket struct {
+	Bucket string `json:"bucket"` // Within 7_days, 30_days, 90_days or 365_days, older, or never
+	Count  int    `json:"count"`
+}
+
+// DeviceAnalytics is a device health and usage report
+type DeviceAnalytics struct {
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	UnusedDays int       `json:"unused_days"`
+	AuthLogCounts
+	FailureRate  float64                `json:"failure_rate"`
+	Devices      []DeviceUsage          `json:"devices"` // Most used first
+	LastUsed     []DeviceLastUsedBucket `json:"last_used"`
+	Unused       []DeviceUsage          `json:"unused"` // Active devices unused for unused_days, longest unused first: deregistration candidates
+	HighFailures []DeviceUsage          `json:"high_failures"`
+}
+
+// DeviceAnalyticsService reports on device usage from the authentication log
+// and emails the report to security admins on devices.analytics.report_interval
+type DeviceAnalyticsService struct {
+	db            *gorm.DB
+	config        *config.Config
+	notifications *NotificationService
+	translator    *Translator
+	stop          chan struct{}
+}
+
+func NewDeviceAnalyticsService(db *gorm.DB, config *config.Config, notifications *NotificationService, translator *Translator) *DeviceAnalyticsService {
+	return &DeviceAnalyticsService{
+		db:            db,
+		config:        config,
+		notifications: notifications,
+		translator:    translator,
+	}
+}
+
+type deviceUsageRow struct {
+	DeviceID uuid.UUID
+	Success  bool
+	Count    int64
+}
+
+// GetAnalytics reports per-device authentication counts and failure rates in
+// the filter's range, how recently devices were last used, the active devices
+// unused for UnusedDays and the devices whose authentications fail most often
+func (s *DeviceAnalyticsService) GetAnalytics(filter DeviceAnalyticsFilter, now time.Time) (*DeviceAnalytics, error) {
+	if filter.UnusedDays <= 0 {
+		filter.UnusedDays = s.config.Devices.Analytics.UnusedDays
+	}
+
+	deviceQuery := database.ReadReplica(s.db).Preload("User")
+	if filter.Type != "" {
+		deviceQuery = deviceQuery.Where("type = ?", filter.Type)
+	}
+	var devices []database.Device
+	if err := deviceQuery.Find(&devices).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch devices: %w", err)
+	}
+
+	var rows []deviceUsageRow
+	err := database.ReadReplica(s.db).Model(&database.AuthenticationLog{}).
+		Select("device_id, success, COUNT(*) AS count").
+		Where("created_at >= ? AND created_at < ?", filter.From, filter.To).
+		Group("device_id, success").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count device authentications: %w", err)
+	}
+	counts := make(map[uuid.UUID]*AuthLogCounts)
+	for _, row := range rows {
+		if counts[row.DeviceID] == nil {
+			counts[row.DeviceID] = &AuthLogCounts{}
+		}
+		counts[row.DeviceID].add(row.Success, row.Count)
+	}
+
+	report := &DeviceAnalytics{
+		From:         filter.From,
+		To:           filter.To,
+		UnusedDays:   filter.UnusedDays,
+		Devices:      make([]DeviceUsage, 0, len(devices)),
+		Unused:       []DeviceUsage{},
+		HighFailures: []DeviceUsage{},
+	}
+	buckets := make([]DeviceLastUsedBucket, len(deviceLastUsedBuckets)+2)
+	for i, bucket := range deviceLastUsedBuckets {
+		buckets[i].Bucket = bucket.Label
+	}
+	buckets[len(buckets)-2].Bucket = "older"
+	buckets[len(buckets)-1].Bucket = "never"
+
+	for i := range devices {
+		usage := deviceUsage(&devices[i], counts[devices[i].ID], now)
+		report.Devices = append(report.Devices, usage)
+		report.AuthLogCounts.Total += usage.Total
+		report.AuthLogCounts.Succeeded += usage.Succeeded
+		report.AuthLogCounts.Failed += usage.Failed
+
+		if usage.LastUsedAt == nil {
+			buckets[len(buckets)-1].Count++
+		} else {
+			bucket := len(buckets) - 2
+			for j, b := range deviceLastUsedBuckets {
+				if now.Sub(*usage.LastUsedAt) <= time.Duration(b.Days)*24*time.Hour {
+					bucket = j
+					break
+				}
+			}
+			buckets[bucket].Count++
+		}
+
+		if usage.Active && usage.DaysUnused >= filter.UnusedDays {
+			report.Unused = append(report.Unused, usage)
+		}
+		if usage.Failed > 0 {
+			report.HighFailures = append(report.HighFailures, usage)
+		}
+	}
+	report.LastUsed = buckets
+	report.FailureRate = failureRate(report.AuthLogCounts)
+
+	sort.SliceStable(report.Devices, func(i, j int) bool { return report.Devices[i].Total > report.Devices[j].Total })
+	sort.SliceStable(report.Unused, func(i, j int) bool { return report.Unused[i].DaysUnused > report.Unused[j].DaysUnused })
+	sort.SliceStable(report.HighFailures, func(i, j int) bool {
+		a, b := report.HighFailures[i], report.HighFailures[j]
+		if a.FailureRate != b.FailureRate {
+			return a.FailureRate > b.FailureRate
+		}
+		return a.Failed > b.Failed
+	})
+	return report, nil
+}
+
+// deviceUsage summarizes a device and its authentication counts
+func deviceUsage(device *database.Device, counts *AuthLogCounts, now time.Time) DeviceUsage {
+	usage := DeviceUsage{
+		DeviceID:     device.ID,
+		Type:         device.Type,
+		Identifier:   device.Identifier,
+		SerialNumber: device.SerialNumber,
+		UserID:       device.UserID,
+		Username:     device.User.Username,
+		Role:         device.Role,
+		State:        device.State,
+		Active:       device.Active,
+	}
+	if counts != nil {
+		usage.AuthLogCounts = *counts
+	}
+	usage.FailureRate = failureRate(usage.AuthLogCounts)
+
+	since := device.CreatedAt
+	if !device.LastUsedAt.IsZero() {
+		lastUsed := device.LastUsedAt
+		usage.LastUsedAt = &lastUsed
+		since = lastUsed
+	}
+	usage.DaysUnused = max(int(now.Sub(since)/(24*time.Hour)), 0)
+	return usage
+}
+
+// failureRate is the share of failed authentications, to three places
+func failureRate(counts AuthLogCounts) float64 {
+	if counts.Total == 0 {
+		return 0
+	}
+	return math.Round(float64(counts.Failed)/float64(counts.Total)*1000) / 1000
+}
+
+// StartReporter periodically emails the device report to
+// devices.analytics.report_emails. It does nothing when
+// devices.analytics.report_interval is zero.
+func (s *DeviceAnalyticsService) StartReporter() {
+	interval := s.config.Devices.Analytics.ReportInterval
+	if interval <= 0 || s.stop != nil {
+		return
+	}
+
+	s.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.SendReport(time.Now()); err != nil {
+					log.Printf("Device analytics report failed: %v", err)
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopReporter stops the background report sender
+func (s *DeviceAnalyticsService) StopReporter() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// SendReport emails the report for the report interval up to now
+func (s *DeviceAnalyticsService) SendReport(now time.Time) error {
+	analytics := s.config.Devices.Analytics
+	report, err := s.GetAnalytics(DeviceAnalyticsFilter{From: now.Add(-analytics.ReportInterval), To: now}, now)
+	if err != nil {
+		return err
+	}
+
+	data := newDeviceReportData(report)
+	locale := s.translator.DefaultLocale()
+	subject := s.translator.Translate(locale, "email.device_report.subject", data)
+	return s.notifications.SendEmail(analytics.ReportEmails, subject, s.translator.Translate(locale, "email.device_report.body", data))
+}
+
+// deviceReportData is what the email.device_report.* messages are rendered
+// with: the report, its last-used buckets labelled and its top failure rates
+type deviceReportData struct {
+	*DeviceAnalytics
+	LastUsed    []deviceReportBucket
+	TopFailures []DeviceUsage
+}
+
+type deviceReportBucket struct {
+	Label string // "within 7 days", "older" or "never"
+	Count int
+}
+
+func newDeviceReportData(report *DeviceAnalytics) deviceReportData {
+	data := deviceReportData{
+		DeviceAnalytics: report,
+		TopFailures:     report.HighFailures[:min(len(report.HighFailures), deviceReportTopFailures)],
+	}
+	for _, bucket := range report.LastUsed {
+		label := "within " + strings.ReplaceAll(bucket.Bucket, "_", " ")
+		if bucket.Bucket == "older" || bucket.Bucket == "never" {
+			label = bucket.Bucket
+		}
+		data.LastUsed = append(data.LastUsed, deviceReportBucket{Label: label, Count: bucket.Count})
+	}
+	return data
+}
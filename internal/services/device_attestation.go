@@ -0,0 +1,177 @@
+package services
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+)
+
+// Extensions Yubico adds to PIV attestation certificates
+var (
+	oidYubicoFirmware   = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 41482, 3, 3}
+	oidYubicoSerial     = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 41482, 3, 7}
+	oidYubicoFormFactor = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 41482, 3, 9}
+)
+
+// YubiKeyFormFactors names the form factors an attestation can report, by the
+// low bits of Yubico's form factor extension. These are the names
+// yubikey.attestation.blocked_form_factors takes.
+var YubiKeyFormFactors = map[byte]string{
+	0x01: "usb-a",
+	0x02: "usb-a-nano",
+	0x03: "usb-c",
+	0x04: "usb-c-nano",
+	0x05: "usb-c-lightning",
+	0x06: "usb-a-bio",
+	0x07: "usb-c-bio",
+}
+
+// DeviceAttestation is the evidence a YubiKey gives at registration, both in
+// PEM: the PIV attestation certificate of a key it generated (ykman piv keys
+// attest) and the attestation certificate that signed it, from slot f9 (ykman
+// piv certificates export f9). Either may be followed by further certificates
+// of the chain.
+type DeviceAttestation struct {
+	Certificate  string
+	Intermediate string
+}
+
+// AttestedYubiKey is what a verified attestation says about a YubiKey
+type AttestedYubiKey struct {
+	SerialNumber    string `json:"serial_number"`
+	FirmwareVersion string `json:"firmware_version"`
+	FormFactor      string `json:"form_factor,omitempty"` // Empty when the key does not report one
+	FIPS            bool   `json:"fips"`
+}
+
+// VerifyAttestation checks that an attestation chains to one of the Yubico
+// roots in yubikey.attestation.ca_file, reads the serial number, firmware
+// version and form factor it vouches for, and applies the min_firmware and
+// blocked_form_factors policy to them
+func (s *DeviceRegistrationService) VerifyAttestation(attestation DeviceAttestation) (*AttestedYubiKey, error) {
+	if s.config == nil || s.config.Yubikey.Attestation.CAFile == "" {
+		return nil, NewError(CodeValidationFailed, "YubiKey attestation is not configured (yubikey.attestation.ca_file)")
+	}
+	policy := s.config.Yubikey.Attestation
+
+	certs, err := parseAttestationCertificates(attestation.Certificate, attestation.Intermediate)
+	if err != nil {
+		return nil, err
+	}
+	leaf := certs[0]
+
+	rootsPEM, err := os.ReadFile(policy.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Yubico attestation roots: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(rootsPEM) {
+		return nil, fmt.Errorf("no certificates found in %s", policy.CAFile)
+	}
+
+	var issuer *x509.Certificate
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+		if issuer == nil && bytes.Equal(cert.RawSubject, leaf.RawIssuer) {
+			issuer = cert
+		}
+	}
+	if issuer == nil {
+		return nil, NewError(CodeValidationFailed, "attestation is missing the certificate that signed it (the slot f9 attestation certificate)")
+	}
+
+	// The slot f9 certificate of older keys is not marked as a CA, so its
+	// signature on the attestation is checked directly and only the f9
+	// certificate itself is verified up to the roots
+	if err := issuer.CheckSignature(leaf.SignatureAlgorithm, leaf.RawTBSCertificate, leaf.Signature); err != nil {
+		return nil, NewError(CodeValidationFailed, "attestation certificate is not signed by the attestation key: %v", err)
+	}
+	_, err = issuer.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, NewError(CodeValidationFailed, "attestation does not chain to a Yubico root: %v", err)
+	}
+
+	key, err := attestedYubiKey(leaf)
+	if err != nil {
+		return nil, err
+	}
+
+	if policy.MinFirmware != "" && compareFirmwareVersions(key.FirmwareVersion, policy.MinFirmware) < 0 {
+		return nil, NewError(CodeValidationFailed, "YubiKey firmware %s is older than the minimum allowed, %s", key.FirmwareVersion, policy.MinFirmware)
+	}
+	if key.FormFactor != "" && slices.Contains(policy.BlockedFormFactors, key.FormFactor) {
+		return nil, NewError(CodeValidationFailed, "YubiKeys of form factor %s cannot be registered", key.FormFactor)
+	}
+	return key, nil
+}
+
+// parseAttestationCertificates decodes the PEM certificates of an attestation,
+// attestation certificate first
+func parseAttestationCertificates(pems ...string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for _, data := range pems {
+		rest := []byte(data)
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, NewError(CodeValidationFailed, "invalid attestation certificate: %v", err)
+			}
+			certs = append(certs, cert)
+		}
+	}
+	if len(certs) == 0 {
+		return nil, NewError(CodeValidationFailed, "attestation has no PEM certificates")
+	}
+	return certs, nil
+}
+
+// attestedYubiKey reads Yubico's extensions from an attestation certificate
+func attestedYubiKey(cert *x509.Certificate) (*AttestedYubiKey, error) {
+	key := &AttestedYubiKey{}
+	for _, ext := range cert.Extensions {
+		switch {
+		case ext.Id.Equal(oidYubicoFirmware) && len(ext.Value) == 3:
+			key.FirmwareVersion = fmt.Sprintf("%d.%d.%d", ext.Value[0], ext.Value[1], ext.Value[2])
+		case ext.Id.Equal(oidYubicoSerial):
+			var serial *big.Int
+			if _, err := asn1.Unmarshal(ext.Value, &serial); err != nil {
+				return nil, NewError(CodeValidationFailed, "invalid serial number in attestation: %v", err)
+			}
+			key.SerialNumber = serial.String()
+		case ext.Id.Equal(oidYubicoFormFactor) && len(ext.Value) == 1:
+			key.FormFactor = YubiKeyFormFactors[ext.Value[0]&0x3f]
+			key.FIPS = ext.Value[0]&0x80 != 0
+		}
+	}
+	if key.SerialNumber == "" || key.FirmwareVersion == "" {
+		return nil, NewError(CodeValidationFailed, "attestation certificate does not carry a YubiKey serial number and firmware version")
+	}
+	return key, nil
+}
+
+// compareFirmwareVersions compares dotted versions such as 5.4.3 number by
+// number, returning -1, 0 or 1
+func compareFirmwareVersions(a, b string) int {
+	var av, bv [3]int
+	fmt.Sscanf(a, "%d.%d.%d", &av[0], &av[1], &av[2])
+	fmt.Sscanf(b, "%d.%d.%d", &bv[0], &bv[1], &bv[2])
+	return slices.Compare(av[:], bv[:])
+}
@@ -0,0 +1,327 @@
+package services
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Device import row statuses
+const (
+	DeviceImportCreated   = "created"
+	DeviceImportDuplicate = "duplicate"
+	DeviceImportInvalid   = "invalid"
+)
+
+// deviceImportColumns maps the normalized header names found in inventory files
+// to the field they fill. Yubico's files name the public ID and serial in
+// several ways, so each field accepts the common spellings.
+var deviceImportColumns = map[string]string{
+	"public_id":        "identifier",
+	"publicid":         "identifier",
+	"otp_public_id":    "identifier",
+	"identifier":       "identifier",
+	"serial":           "serial_number",
+	"serial_number":    "serial_number",
+	"serial_no":        "serial_number",
+	"firmware":         "firmware_version",
+	"firmware_version": "firmware_version",
+	"version":          "firmware_version",
+	"form_factor":      "form_factor",
+	"model":            "form_factor",
+	"asset_tag":        "asset_tag",
+	"purchase_order":   "purchase_order",
+	"po":               "purchase_order",
+	"po_number":        "purchase_order",
+}
+
+// DeviceImportRow is one YubiKey from an inventory file
+type DeviceImportRow struct {
+	Line            int
+	Identifier      string // OTP public ID, 12 modhex characters
+	SerialNumber    string
+	FirmwareVersion string
+	FormFactor      string
+	AssetTag        string
+	PurchaseOrder   string
+}
+
+// DeviceImportOptions apply to a whole import. PurchaseOrder fills rows that
+// do not name one.
+type DeviceImportOptions struct {
+	PurchaseOrder string
+	PurchasedAt   *time.Time
+	DryRun        bool
+}
+
+// DeviceImportResult is the outcome of importing one row
+type DeviceImportResult struct {
+	Line         int        `json:"line"`
+	Identifier   string     `json:"identifier"`
+	SerialNumber string     `json:"serial_number,omitempty"`
+	Status       string     `json:"status" enum:"created,duplicate,invalid"`
+	DeviceID     *uuid.UUID `json:"device_id,omitempty"`
+	Message      string     `json:"message,omitempty"`
+}
+
+// DeviceImportReport summarizes an import. In a dry run nothing is created and
+// Created counts the rows that would be.
+type DeviceImportReport struct {
+	DryRun     bool                 `json:"dry_run"`
+	Total      int                  `json:"total"`
+	Created    int                  `json:"created" doc:"Rows created, or that would be in a dry run"`
+	Duplicates int                  `json:"duplicates"`
+	Invalid    int                  `json:"invalid"`
+	Rows       []DeviceImportResult `json:"rows"`
+}
+
+// ParseDeviceInventory reads a YubiKey inventory CSV. The first row must be a
+// header naming at least the public ID column; lines starting with # are
+// ignored.
+func ParseDeviceInventory(r io.Reader) ([]DeviceImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, NewError(CodeValidationFailed, "inventory file is empty")
+	}
+	if err != nil {
+		return nil, NewError(CodeValidationFailed, "invalid inventory file: %v", err)
+	}
+
+	fields := make([]string, len(header))
+	hasIdentifier := false
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		name = strings.NewReplacer(" ", "_", "-", "_", ".", "").Replace(name)
+		fields[i] = deviceImportColumns[name]
+		if fields[i] == "identifier" {
+			hasIdentifier = true
+		}
+	}
+	if !hasIdentifier {
+		return nil, NewError(CodeValidationFailed, "inventory file has no public ID column (expected a header such as public_id or \"Public ID\")")
+	}
+
+	var rows []DeviceImportRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, NewError(CodeValidationFailed, "invalid inventory file: %v", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		row := DeviceImportRow{Line: line}
+		blank := true
+		for i, value := range record {
+			if i >= len(fields) {
+				break
+			}
+			value = strings.TrimSpace(value)
+			if value != "" {
+				blank = false
+			}
+			switch fields[i] {
+			case "identifier":
+				row.Identifier = strings.ToLower(value)
+			case "serial_number":
+				row.SerialNumber = value
+			case "firmware_version":
+				row.FirmwareVersion = value
+			case "form_factor":
+				row.FormFactor = value
+			case "asset_tag":
+				row.AssetTag = value
+			case "purchase_order":
+				row.PurchaseOrder = value
+			}
+		}
+		if !blank {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+// ImportDevices creates an unassigned, inactive YubiKey in stock for each valid
+// row, so keys can be registered to users later. Rows whose public ID, serial
+// number or asset tag is already taken, by an existing device or an earlier
+// row, are reported as duplicates and skipped; the rest are created together.
+func (s *DeviceService) ImportDevices(rows []DeviceImportRow, options DeviceImportOptions) (*DeviceImportReport, error) {
+	if len(rows) == 0 {
+		return nil, NewError(CodeValidationFailed, "inventory file has no devices")
+	}
+
+	existing, err := s.existingImportKeys(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DeviceImportReport{DryRun: options.DryRun, Total: len(rows), Rows: make([]DeviceImportResult, len(rows))}
+	seen := make(map[string]int)
+	var devices []database.Device
+	for i, row := range rows {
+		result := &report.Rows[i]
+		*result = DeviceImportResult{Line: row.Line, Identifier: row.Identifier, SerialNumber: row.SerialNumber}
+
+		if message := validateDeviceImportRow(row); message != "" {
+			result.Status = DeviceImportInvalid
+			result.Message = message
+			report.Invalid++
+			continue
+		}
+
+		keys := deviceImportKeys(row)
+		duplicate := ""
+		for _, key := range keys {
+			if device, ok := existing[key]; ok {
+				duplicate = fmt.Sprintf("%s is already used by device %s", deviceImportKeyLabel(key), device.ID)
+				if device.DeletedAt.Valid {
+					duplicate += ", which is deleted; restore it instead"
+				}
+				break
+			}
+			if line, ok := seen[key]; ok {
+				duplicate = fmt.Sprintf("%s repeats line %d", deviceImportKeyLabel(key), line)
+				break
+			}
+		}
+		if duplicate != "" {
+			result.Status = DeviceImportDuplicate
+			result.Message = duplicate
+			report.Duplicates++
+			continue
+		}
+		for _, key := range keys {
+			seen[key] = row.Line
+		}
+
+		purchaseOrder := row.PurchaseOrder
+		if purchaseOrder == "" {
+			purchaseOrder = options.PurchaseOrder
+		}
+		device := database.Device{
+			ID:              uuid.New(),
+			Type:            "yubikey",
+			Identifier:      row.Identifier,
+			SerialNumber:    row.SerialNumber,
+			Active:          false,
+			FirmwareVersion: row.FirmwareVersion,
+			FormFactor:      row.FormFactor,
+			AssetTag:        row.AssetTag,
+			PurchaseOrder:   purchaseOrder,
+			PurchasedAt:     options.PurchasedAt,
+			State:           DeviceStateInStock,
+		}
+		result.Status = DeviceImportCreated
+		if !options.DryRun {
+			id := device.ID
+			result.DeviceID = &id
+		}
+		devices = append(devices, device)
+	}
+	report.Created = len(devices)
+
+	if options.DryRun || len(devices) == 0 {
+		return report, nil
+	}
+
+	// Imported devices have no owner yet, so user_id is left NULL. A device
+	// created since the duplicate check fails the whole import as a conflict.
+	if err := s.db.CreateInBatches(&devices, 100).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, WrapError(CodeConflict, "a device in the file was created during the import; retry", err)
+		}
+		return nil, fmt.Errorf("failed to import devices: %w", err)
+	}
+	return report, nil
+}
+
+// existingImportKeys finds the devices, deleted or not, that share a public ID,
+// serial number or asset tag with the rows, keyed like deviceImportKeys
+func (s *DeviceService) existingImportKeys(rows []DeviceImportRow) (map[string]database.Device, error) {
+	var identifiers, serials, assetTags []string
+	for _, row := range rows {
+		if row.Identifier != "" {
+			identifiers = append(identifiers, row.Identifier)
+		}
+		if row.SerialNumber != "" {
+			serials = append(serials, row.SerialNumber)
+		}
+		if row.AssetTag != "" {
+			assetTags = append(assetTags, row.AssetTag)
+		}
+	}
+
+	existing := make(map[string]database.Device)
+	add := func(column string, values []string, key func(database.Device) string, query *gorm.DB) error {
+		if len(values) == 0 {
+			return nil
+		}
+		var devices []database.Device
+		if err := query.Where(column+" IN ?", values).Find(&devices).Error; err != nil {
+			return fmt.Errorf("failed to check for duplicate devices: %w", err)
+		}
+		for _, device := range devices {
+			existing[key(device)] = device
+		}
+		return nil
+	}
+
+	yubikeys := func() *gorm.DB { return s.db.Unscoped().Where("type = ?", "yubikey") }
+	err := errors.Join(
+		add("identifier", identifiers, func(d database.Device) string { return "identifier:" + d.Identifier }, yubikeys()),
+		add("serial_number", serials, func(d database.Device) string { return "serial_number:" + d.SerialNumber }, yubikeys()),
+		// Asset tags are unique among devices that are not deleted, whatever their type
+		add("asset_tag", assetTags, func(d database.Device) string { return "asset_tag:" + d.AssetTag }, s.db),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// deviceImportKeys returns the values of a row that must be unique
+func deviceImportKeys(row DeviceImportRow) []string {
+	keys := []string{"identifier:" + row.Identifier}
+	if row.SerialNumber != "" {
+		keys = append(keys, "serial_number:"+row.SerialNumber)
+	}
+	if row.AssetTag != "" {
+		keys = append(keys, "asset_tag:"+row.AssetTag)
+	}
+	return keys
+}
+
+// deviceImportKeyLabel describes a key from deviceImportKeys, e.g. "serial number 1234567"
+func deviceImportKeyLabel(key string) string {
+	field, value, _ := strings.Cut(key, ":")
+	labels := map[string]string{"identifier": "public ID", "serial_number": "serial number", "asset_tag": "asset tag"}
+	return fmt.Sprintf("%s %s", labels[field], value)
+}
+
+// validateDeviceImportRow returns why a row cannot be imported, or "" if it can
+func validateDeviceImportRow(row DeviceImportRow) string {
+	switch {
+	case row.Identifier == "":
+		return "public ID is missing"
+	case len(row.Identifier) != 12 || strings.Trim(row.Identifier, modhexAlphabet) != "":
+		return fmt.Sprintf("public ID %q is not 12 modhex characters", row.Identifier)
+	case row.SerialNumber != "" && strings.Trim(row.SerialNumber, "0123456789") != "":
+		return fmt.Sprintf("serial number %q is not numeric", row.SerialNumber)
+	}
+	return ""
+}
@@ -1,34 +1,62 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/YubiApp/internal/config"
 	"github.com/YubiApp/internal/database"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 type DeviceRegistrationService struct {
-	db *gorm.DB
+	db     *gorm.DB
+	config *config.Config
 }
 
-func NewDeviceRegistrationService(db *gorm.DB) *DeviceRegistrationService {
+func NewDeviceRegistrationService(db *gorm.DB, config *config.Config) *DeviceRegistrationService {
 	return &DeviceRegistrationService{
-		db: db,
+		db:     db,
+		config: config,
 	}
 }
 
-// RegisterDevice registers a device to a target user
+// RegisterDevice registers a device to a target user. An empty role picks
+// primary or backup depending on the user's other devices. A YubiKey's
+// attestation, when given, is verified and its serial number, firmware
+// version and form factor are recorded on the device. Push devices are
+// registered with the app's push platform and token.
 func (s *DeviceRegistrationService) RegisterDevice(
 	registrarUserID uuid.UUID,
 	targetUserID uuid.UUID,
 	deviceIdentifier string,
 	deviceType string,
+	role string,
+	attestation *DeviceAttestation,
+	push *PushRegistration,
 	notes string,
 	ipAddress string,
 	userAgent string,
 ) (*database.DeviceRegistration, error) {
+	var attested *AttestedYubiKey
+	if attestation != nil {
+		if deviceType != "yubikey" {
+			return nil, NewError(CodeValidationFailed, "only YubiKeys can be registered with an attestation")
+		}
+		var err error
+		if attested, err = s.VerifyAttestation(*attestation); err != nil {
+			return nil, err
+		}
+	} else if deviceType == "yubikey" && s.config != nil && s.config.Yubikey.Attestation.Required {
+		return nil, NewError(CodeValidationFailed, "YubiKeys must be registered with an attestation (yubikey.attestation.required)")
+	}
+
+	if err := push.validate(deviceType); err != nil {
+		return nil, err
+	}
+
 	// Start transaction
 	tx := s.db.Begin()
 	defer func() {
@@ -54,7 +82,8 @@ func (s *DeviceRegistrationService) RegisterDevice(
 	err := tx.Where("type = ? AND identifier = ?", deviceType, deviceIdentifier).First(&device).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			// Create new device
+			// Create new device. Devices are unique by type and identifier, so
+			// when the same device is registered concurrently only one insert wins.
 			device = database.Device{
 				ID:         uuid.New(),
 				Type:       deviceType,
@@ -64,6 +93,9 @@ func (s *DeviceRegistrationService) RegisterDevice(
 			}
 			if err := tx.Create(&device).Error; err != nil {
 				tx.Rollback()
+				if errors.Is(err, gorm.ErrDuplicatedKey) {
+					return nil, WrapError(CodeConflict, "device was registered concurrently; retry", err)
+				}
 				return nil, fmt.Errorf("failed to create device: %w", err)
 			}
 		} else {
@@ -72,17 +104,42 @@ func (s *DeviceRegistrationService) RegisterDevice(
 		}
 	} else {
 		// Check if device is already registered to another user
-		if device.UserID != uuid.Nil && device.UserID != targetUserID {
+		if device.UserID != nil && *device.UserID != targetUserID {
 			tx.Rollback()
-			return nil, fmt.Errorf("device is already registered to another user")
+			return nil, NewError(CodeConflict, "device is already registered to another user")
+		}
+		if !DeviceStateAllowsActivation(device.State) {
+			tx.Rollback()
+			return nil, NewError(CodeConflict, "device is %s and cannot be registered", device.State)
+		}
+	}
+
+	if attested != nil {
+		if err := recordAttestation(tx, &device, attested); err != nil {
+			tx.Rollback()
+			return nil, err
 		}
 	}
 
-	// 3. Update device ownership
-	device.UserID = targetUserID
+	// 3. Update device ownership, within the target user's device role limits
+	role, err = resolveDeviceRole(tx, targetUserID, role, device.ID)
+	if err == nil {
+		err = checkDeviceRoleLimit(tx, s.config, targetUserID, role, device.ID)
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if push != nil {
+		device.PushPlatform = push.Platform
+		device.PushToken = push.Token
+	}
+	device.UserID = &targetUserID
 	device.Active = true
+	device.Role = role
+	device.State = DeviceStateAssigned
 	device.VerifiedAt = time.Now()
-	if err := tx.Save(&device).Error; err != nil {
+	if err := saveDeviceOwnership(tx, &device); err != nil {
 		tx.Rollback()
 		return nil, fmt.Errorf("failed to update device: %w", err)
 	}
@@ -109,9 +166,73 @@ func (s *DeviceRegistrationService) RegisterDevice(
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
+	registration.Device = device
 	return &registration, nil
 }
 
+// PushRegistration is the mobile app's registration with its push platform,
+// given when registering a push device
+type PushRegistration struct {
+	Platform string // "fcm" or "apns"
+	Token    string
+}
+
+// validate checks that push devices, and only push devices, come with a
+// registration
+func (p *PushRegistration) validate(deviceType string) error {
+	if p == nil {
+		if deviceType == "push" {
+			return NewError(CodeValidationFailed, "push devices must be registered with a push_platform and push_token")
+		}
+		return nil
+	}
+	if deviceType != "push" {
+		return NewError(CodeValidationFailed, "only push devices can be registered with a push token")
+	}
+	if p.Platform != "fcm" && p.Platform != "apns" {
+		return NewError(CodeValidationFailed, "push_platform must be fcm or apns, got %q", p.Platform)
+	}
+	if p.Token == "" {
+		return NewError(CodeValidationFailed, "push_token is required")
+	}
+	return nil
+}
+
+// recordAttestation copies what an attestation vouches for onto device, after
+// checking that the attested serial number is not already another device's
+func recordAttestation(tx *gorm.DB, device *database.Device, attested *AttestedYubiKey) error {
+	if device.SerialNumber != "" && device.SerialNumber != attested.SerialNumber {
+		return NewError(CodeConflict, "device has serial number %s, but the attestation is for serial number %s", device.SerialNumber, attested.SerialNumber)
+	}
+	var count int64
+	err := tx.Model(&database.Device{}).
+		Where("type = ? AND serial_number = ? AND id <> ?", "yubikey", attested.SerialNumber, device.ID).
+		Count(&count).Error
+	if err != nil {
+		return fmt.Errorf("failed to check serial number: %w", err)
+	}
+	if count > 0 {
+		return NewError(CodeConflict, "another device already has serial number %s", attested.SerialNumber)
+	}
+
+	now := time.Now()
+	device.SerialNumber = attested.SerialNumber
+	device.FirmwareVersion = attested.FirmwareVersion
+	if attested.FormFactor != "" {
+		device.FormFactor = attested.FormFactor
+	}
+	device.AttestedAt = &now
+	return nil
+}
+
+// saveDeviceOwnership saves a device whose owner changed. It fails with a
+// conflict if the device was changed since it was read, so two concurrent
+// registrations cannot both claim it. The loaded owner is not saved with it.
+func saveDeviceOwnership(tx *gorm.DB, device *database.Device) error {
+	device.User = database.User{}
+	return saveVersioned(tx, "device", device, &device.Version)
+}
+
 // DeregisterDevice deregisters a device from its current user
 func (s *DeviceRegistrationService) DeregisterDevice(
 	registrarUserID uuid.UUID,
@@ -137,15 +258,18 @@ func (s *DeviceRegistrationService) DeregisterDevice(
 	}
 
 	// 2. Check if device is currently registered
-	if device.UserID == uuid.Nil {
+	if device.UserID == nil {
 		tx.Rollback()
-		return nil, fmt.Errorf("device is not currently registered to any user")
+		return nil, NewError(CodeConflict, "device is not currently registered to any user")
 	}
 
-	// 3. Deregister device
-	device.UserID = uuid.Nil
+	// 3. Deregister device; it goes back into stock unless it was lost or retired
+	device.UserID = nil
 	device.Active = false
-	if err := tx.Save(&device).Error; err != nil {
+	if DeviceStateAllowsActivation(device.State) {
+		device.State = DeviceStateInStock
+	}
+	if err := saveDeviceOwnership(tx, &device); err != nil {
 		tx.Rollback()
 		return nil, fmt.Errorf("failed to deregister device: %w", err)
 	}
@@ -213,23 +337,37 @@ func (s *DeviceRegistrationService) TransferDevice(
 	}
 
 	// 3. Check if device is currently registered
-	if device.UserID == uuid.Nil {
+	if device.UserID == nil {
 		tx.Rollback()
-		return nil, fmt.Errorf("device is not currently registered to any user")
+		return nil, NewError(CodeConflict, "device is not currently registered to any user")
 	}
 
 	// 4. Check if device is already registered to target user
-	if device.UserID == targetUserID {
+	if *device.UserID == targetUserID {
+		tx.Rollback()
+		return nil, NewError(CodeConflict, "device is already registered to the target user")
+	}
+
+	if !DeviceStateAllowsActivation(device.State) {
 		tx.Rollback()
-		return nil, fmt.Errorf("device is already registered to the target user")
+		return nil, NewError(CodeConflict, "device is %s and cannot be transferred", device.State)
 	}
 
-	// 5. Transfer device
-	previousUserID := device.UserID
-	device.UserID = targetUserID
+	// 5. Transfer device, taking the role the target user's other devices leave for it
+	role, err := resolveDeviceRole(tx, targetUserID, "", device.ID)
+	if err == nil {
+		err = checkDeviceRoleLimit(tx, s.config, targetUserID, role, device.ID)
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	previousUserID := *device.UserID
+	device.UserID = &targetUserID
+	device.Role = role
 	device.Active = true
 	device.VerifiedAt = time.Now()
-	if err := tx.Save(&device).Error; err != nil {
+	if err := saveDeviceOwnership(tx, &device); err != nil {
 		tx.Rollback()
 		return nil, fmt.Errorf("failed to transfer device: %w", err)
 	}
@@ -291,5 +429,21 @@ func (s *DeviceRegistrationService) GetDeviceHistory(deviceID uuid.UUID) ([]data
 		return nil, fmt.Errorf("failed to get device history: %w", err)
 	}
 
+	return registrations, nil
+}
+
+// GetUserDeviceHistory returns the registration history of a user's devices:
+// every record naming the user as target, and every record for deviceIDs,
+// most recent first
+func (s *DeviceRegistrationService) GetUserDeviceHistory(userID uuid.UUID, deviceIDs []uuid.UUID) ([]database.DeviceRegistration, error) {
+	query := s.db.Preload("RegistrarUser").Preload("TargetUser").Where("target_user_id = ?", userID)
+	if len(deviceIDs) > 0 {
+		query = query.Or("device_id IN ?", deviceIDs)
+	}
+
+	var registrations []database.DeviceRegistration
+	if err := query.Order("created_at DESC").Find(&registrations).Error; err != nil {
+		return nil, fmt.Errorf("failed to get device history: %w", err)
+	}
 	return registrations, nil
 } 
\ No newline at end of file
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Device roles
+const (
+	DeviceRolePrimary = "primary"
+	DeviceRoleBackup  = "backup"
+)
+
+// DeviceRoles lists the roles a device can have
+var DeviceRoles = []string{DeviceRolePrimary, DeviceRoleBackup}
+
+func validateDeviceRole(role string) error {
+	for _, r := range DeviceRoles {
+		if role == r {
+			return nil
+		}
+	}
+	return NewError(CodeValidationFailed, "invalid device role '%s'. Must be one of: %v", role, DeviceRoles)
+}
+
+// resolveDeviceRole returns the role a device given to userID gets: the
+// requested one, or else primary when the user has no other active primary
+// device and backup when they do
+func resolveDeviceRole(db *gorm.DB, userID uuid.UUID, requested string, deviceID uuid.UUID) (string, error) {
+	if requested != "" {
+		return requested, validateDeviceRole(requested)
+	}
+	primaries, err := countActiveDevices(db, userID, DeviceRolePrimary, deviceID)
+	if err != nil {
+		return "", err
+	}
+	if primaries > 0 {
+		return DeviceRoleBackup, nil
+	}
+	return DeviceRolePrimary, nil
+}
+
+// checkDeviceRoleLimit refuses to let device become one more active device of
+// userID in role when the user already holds devices.<role>.max of them
+func checkDeviceRoleLimit(db *gorm.DB, cfg *config.Config, userID uuid.UUID, role string, deviceID uuid.UUID) error {
+	if cfg == nil {
+		return nil
+	}
+	limit := cfg.Devices.RoleLimits(role).Max
+	if limit == 0 {
+		return nil
+	}
+	count, err := countActiveDevices(db, userID, role, deviceID)
+	if err != nil {
+		return err
+	}
+	if count >= int64(limit) {
+		return NewError(CodeConflict, "user already has %d active %s device(s), the most allowed; deactivate one or make this device a %s", count, role, otherDeviceRole(role))
+	}
+	return nil
+}
+
+// countActiveDevices counts userID's active devices in role, leaving out deviceID
+func countActiveDevices(db *gorm.DB, userID uuid.UUID, role string, deviceID uuid.UUID) (int64, error) {
+	var count int64
+	err := db.Model(&database.Device{}).
+		Where("user_id = ? AND role = ? AND active = ? AND id <> ?", userID, role, true, deviceID).
+		Count(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to count devices: %w", err)
+	}
+	return count, nil
+}
+
+func otherDeviceRole(role string) string {
+	if role == DeviceRoleBackup {
+		return DeviceRolePrimary
+	}
+	return DeviceRoleBackup
+}
+
+// DeviceWarnings describes how userID's active devices fall short of, or
+// exceed, the devices.<role> limits, e.g. that they have no backup device
+func (s *DeviceService) DeviceWarnings(userID uuid.UUID) ([]string, error) {
+	warnings := []string{}
+	if s.config == nil {
+		return warnings, nil
+	}
+	for _, role := range DeviceRoles {
+		limits := s.config.Devices.RoleLimits(role)
+		count, err := countActiveDevices(s.db, userID, role, uuid.Nil)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case count == 0 && limits.Min > 0:
+			warnings = append(warnings, fmt.Sprintf("no active %s device", role))
+		case count < int64(limits.Min):
+			warnings = append(warnings, fmt.Sprintf("only %d active %s device(s); at least %d expected", count, role, limits.Min))
+		case limits.Max > 0 && count > int64(limits.Max):
+			warnings = append(warnings, fmt.Sprintf("%d active %s devices; at most %d allowed", count, role, limits.Max))
+		}
+	}
+	return warnings, nil
+}
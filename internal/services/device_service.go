@@ -1,26 +1,102 @@
 package services
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"sort"
 	"time"
 
+	"github.com/YubiApp/internal/config"
 	"github.com/YubiApp/internal/database"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// Device lifecycle states
+const (
+	DeviceStateInStock  = "in_stock"
+	DeviceStateAssigned = "assigned"
+	DeviceStateLost     = "lost"
+	DeviceStateRetired  = "retired"
+)
+
+// DeviceStateTransitions lists the states each lifecycle state may move to.
+// Retired devices stay retired.
+var DeviceStateTransitions = map[string][]string{
+	DeviceStateInStock:  {DeviceStateAssigned, DeviceStateLost, DeviceStateRetired},
+	DeviceStateAssigned: {DeviceStateInStock, DeviceStateLost, DeviceStateRetired},
+	DeviceStateLost:     {DeviceStateInStock, DeviceStateAssigned, DeviceStateRetired},
+	DeviceStateRetired:  {},
+}
+
+// DeviceStateAllowsActivation reports whether devices in a state may be active.
+// An empty state predates lifecycle states and counts as assigned.
+func DeviceStateAllowsActivation(state string) bool {
+	return state != DeviceStateLost && state != DeviceStateRetired
+}
+
+// DeviceStates returns the lifecycle states in a stable order
+func DeviceStates() []string {
+	states := make([]string, 0, len(DeviceStateTransitions))
+	for state := range DeviceStateTransitions {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+	return states
+}
+
+// DeviceInventory holds the inventory details of a new device. State may be
+// in_stock or assigned and defaults to assigned. Role defaults to primary when
+// the user has no active primary device and backup otherwise.
+type DeviceInventory struct {
+	Role            string
+	FirmwareVersion string
+	FormFactor      string
+	AssetTag        string
+	PurchaseOrder   string
+	PurchasedAt     *time.Time
+	State           string
+}
+
+// DeviceFilter selects devices; zero fields match every device that is not deleted
+type DeviceFilter struct {
+	UserID         *uuid.UUID
+	Role           string
+	State          string
+	ActiveOnly     bool
+	IncludeDeleted bool
+}
+
+// DeviceLost is the payload of a device.lost event
+type DeviceLost struct {
+	DeviceID     uuid.UUID  `json:"device_id"`
+	Type         string     `json:"type"`
+	Identifier   string     `json:"identifier"`
+	SerialNumber string     `json:"serial_number,omitempty"`
+	AssetTag     string     `json:"asset_tag,omitempty"`
+	UserID       *uuid.UUID `json:"user_id"` // nil for unassigned devices
+	Email        string     `json:"email,omitempty"`
+	Reason       string     `json:"reason"`
+	ReportedByID uuid.UUID  `json:"reported_by_id"`
+}
+
 type DeviceService struct {
-	db *gorm.DB
+	db     *gorm.DB
+	config *config.Config
+	events *EventBus
 }
 
-func NewDeviceService(db *gorm.DB) *DeviceService {
-	return &DeviceService{db: db}
+// NewDeviceService creates the service. events receives device.lost and may be
+// nil when nothing needs to be notified.
+func NewDeviceService(db *gorm.DB, config *config.Config, events *EventBus) *DeviceService {
+	return &DeviceService{db: db, config: config, events: events}
 }
 
 // CreateDevice creates a new device
-func (s *DeviceService) CreateDevice(userID uuid.UUID, deviceType, identifier, secret string, active bool) (*database.Device, error) {
+func (s *DeviceService) CreateDevice(userID uuid.UUID, deviceType, identifier, secret string, active bool, inventory DeviceInventory) (*database.Device, error) {
 	validTypes := []string{"yubikey", "totp", "sms", "email"}
 	validType := false
 	for _, t := range validTypes {
@@ -30,13 +106,36 @@ func (s *DeviceService) CreateDevice(userID uuid.UUID, deviceType, identifier, s
 		}
 	}
 	if !validType {
-		return nil, fmt.Errorf("device type must be one of: %v", validTypes)
+		return nil, NewError(CodeValidationFailed, "device type must be one of: %v", validTypes)
+	}
+
+	if inventory.State == "" {
+		inventory.State = DeviceStateAssigned
+	}
+	if inventory.State != DeviceStateInStock && inventory.State != DeviceStateAssigned {
+		return nil, NewError(CodeValidationFailed, "new devices must be %s or %s", DeviceStateInStock, DeviceStateAssigned)
+	}
+	if err := s.checkAssetTag(inventory.AssetTag, uuid.Nil); err != nil {
+		return nil, err
 	}
 
 	// Check if user exists
 	var user database.User
 	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
-		return nil, fmt.Errorf("user not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "user not found")
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	role, err := resolveDeviceRole(s.db, userID, inventory.Role, uuid.Nil)
+	if err != nil {
+		return nil, err
+	}
+	if active {
+		if err := checkDeviceRoleLimit(s.db, s.config, userID, role, uuid.Nil); err != nil {
+			return nil, err
+		}
 	}
 
 	// Generate secret for TOTP if not provided
@@ -50,17 +149,29 @@ func (s *DeviceService) CreateDevice(userID uuid.UUID, deviceType, identifier, s
 
 	device := database.Device{
 		ID:         uuid.New(),
-		UserID:     userID,
+		UserID:     &userID,
 		Type:       deviceType,
 		Identifier: identifier,
 		Secret:     secret,
 		Active:     active,
 		VerifiedAt: time.Now(),
+
+		FirmwareVersion: inventory.FirmwareVersion,
+		FormFactor:      inventory.FormFactor,
+		AssetTag:        inventory.AssetTag,
+		PurchaseOrder:   inventory.PurchaseOrder,
+		PurchasedAt:     inventory.PurchasedAt,
+		Role:            role,
+		State:           inventory.State,
 	}
 
 	if err := s.db.Create(&device).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, WrapError(CodeConflict, fmt.Sprintf("a %s device with identifier '%s' already exists", deviceType, identifier), err)
+		}
 		return nil, fmt.Errorf("failed to create device: %w", err)
 	}
+	device.User = user
 
 	return &device, nil
 }
@@ -69,61 +180,80 @@ func (s *DeviceService) CreateDevice(userID uuid.UUID, deviceType, identifier, s
 func (s *DeviceService) GetDeviceByID(deviceID uuid.UUID) (*database.Device, error) {
 	var device database.Device
 	if err := s.db.Preload("User").Where("id = ?", deviceID).First(&device).Error; err != nil {
-		return nil, fmt.Errorf("device not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "device not found")
+		}
+		return nil, fmt.Errorf("failed to get device: %w", err)
 	}
 	return &device, nil
 }
 
 // GetDeviceByIdentifier retrieves a device by identifier and type
 func (s *DeviceService) GetDeviceByIdentifier(deviceType, identifier string) (*database.Device, error) {
+	return s.GetDeviceByIdentifierContext(context.Background(), deviceType, identifier)
+}
+
+// GetDeviceByIdentifierContext is GetDeviceByIdentifier for a request, so the
+// query is traced as part of it
+func (s *DeviceService) GetDeviceByIdentifierContext(ctx context.Context, deviceType, identifier string) (*database.Device, error) {
 	var device database.Device
-	if err := s.db.Preload("User").Where("type = ? AND identifier = ?", deviceType, identifier).First(&device).Error; err != nil {
-		return nil, fmt.Errorf("device not found: %w", err)
+	if err := s.db.WithContext(ctx).Preload("User").Where("type = ? AND identifier = ?", deviceType, identifier).First(&device).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "device not found")
+		}
+		return nil, fmt.Errorf("failed to get device: %w", err)
 	}
 	return &device, nil
 }
 
-// ListDevices retrieves all devices or devices for a specific user
-func (s *DeviceService) ListDevices(userID *uuid.UUID) ([]database.Device, error) {
-	var devices []database.Device
-	var err error
-
-	if userID != nil {
-		err = s.db.Preload("User").Where("user_id = ?", userID).Find(&devices).Error
+// ListDevices retrieves the devices matching filter
+func (s *DeviceService) ListDevices(filter DeviceFilter) ([]database.Device, error) {
+	query := database.ReadReplica(s.db)
+	if filter.IncludeDeleted {
+		query = query.Unscoped().Preload("User", func(db *gorm.DB) *gorm.DB { return db.Unscoped() })
 	} else {
-		err = s.db.Preload("User").Find(&devices).Error
+		query = query.Preload("User")
 	}
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch devices: %w", err)
+	if filter.UserID != nil {
+		query = query.Where("user_id = ?", filter.UserID)
 	}
-
-	return devices, nil
-}
-
-// ListActiveDevices retrieves only active devices, optionally filtered by userID
-func (s *DeviceService) ListActiveDevices(userID *uuid.UUID) ([]database.Device, error) {
-	var devices []database.Device
-	var err error
-
-	if userID != nil {
-		err = s.db.Preload("User").Where("user_id = ? AND active = ?", userID, true).Find(&devices).Error
-	} else {
-		err = s.db.Preload("User").Where("active = ?", true).Find(&devices).Error
+	if filter.Role != "" {
+		if err := validateDeviceRole(filter.Role); err != nil {
+			return nil, err
+		}
+		query = query.Where("role = ?", filter.Role)
+	}
+	if filter.State != "" {
+		if _, ok := DeviceStateTransitions[filter.State]; !ok {
+			return nil, NewError(CodeValidationFailed, "invalid state '%s'. Must be one of: %v", filter.State, DeviceStates())
+		}
+		query = query.Where("state = ?", filter.State)
+	}
+	if filter.ActiveOnly {
+		query = query.Where("active = ?", true)
 	}
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch active devices: %w", err)
+	var devices []database.Device
+	if err := query.Find(&devices).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch devices: %w", err)
 	}
 
 	return devices, nil
 }
 
-// UpdateDevice updates a device
-func (s *DeviceService) UpdateDevice(deviceID uuid.UUID, updates map[string]interface{}) (*database.Device, error) {
+// UpdateDevice updates a device. A non-nil version must match the device's
+// current version.
+func (s *DeviceService) UpdateDevice(deviceID uuid.UUID, version *int, updates map[string]interface{}) (*database.Device, error) {
 	var device database.Device
 	if err := s.db.Where("id = ?", deviceID).First(&device).Error; err != nil {
-		return nil, fmt.Errorf("device not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "device not found")
+		}
+		return nil, fmt.Errorf("failed to get device: %w", err)
+	}
+	if err := checkVersion("device", device.Version, version); err != nil {
+		return nil, err
 	}
 
 	// Validate device type if it's being updated
@@ -137,11 +267,43 @@ func (s *DeviceService) UpdateDevice(deviceID uuid.UUID, updates map[string]inte
 			}
 		}
 		if !validType {
-			return nil, fmt.Errorf("device type must be one of: %v", validTypes)
+			return nil, NewError(CodeValidationFailed, "device type must be one of: %v", validTypes)
 		}
 	}
 
-	if err := s.db.Model(&device).Updates(updates).Error; err != nil {
+	if active, ok := updates["active"].(bool); ok && active && !DeviceStateAllowsActivation(device.State) {
+		return nil, NewError(CodeConflict, "device is %s; move it to %s or %s before activating it", device.State, DeviceStateInStock, DeviceStateAssigned)
+	}
+	// Re-activating a device suspected of being cloned clears the suspicion
+	if active, ok := updates["active"].(bool); ok && active && device.CloneSuspectedAt != nil {
+		updates["clone_suspected_at"] = nil
+	}
+	if assetTag, ok := updates["asset_tag"].(string); ok {
+		if err := s.checkAssetTag(assetTag, device.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	// A device that will be active in a role counts against that role's limit
+	role, roleChanged := updates["role"].(string)
+	if roleChanged {
+		if err := validateDeviceRole(role); err != nil {
+			return nil, err
+		}
+	} else {
+		role = device.Role
+	}
+	active, activeChanged := updates["active"].(bool)
+	if !activeChanged {
+		active = device.Active
+	}
+	if active && device.UserID != nil && (roleChanged || activeChanged) {
+		if err := checkDeviceRoleLimit(s.db, s.config, *device.UserID, role, device.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := updateVersioned(s.db, "device", &device, device.Version, updates); err != nil {
 		return nil, fmt.Errorf("failed to update device: %w", err)
 	}
 
@@ -157,7 +319,10 @@ func (s *DeviceService) UpdateDevice(deviceID uuid.UUID, updates map[string]inte
 func (s *DeviceService) DeleteDevice(deviceID uuid.UUID) error {
 	var device database.Device
 	if err := s.db.Preload("User").Where("id = ?", deviceID).First(&device).Error; err != nil {
-		return fmt.Errorf("device not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return NewError(CodeNotFound, "device not found")
+		}
+		return fmt.Errorf("failed to get device: %w", err)
 	}
 
 	if err := s.db.Delete(&device).Error; err != nil {
@@ -167,7 +332,134 @@ func (s *DeviceService) DeleteDevice(deviceID uuid.UUID) error {
 	return nil
 }
 
+// RestoreDevice undoes a soft delete. The owning user, if any, must not be deleted.
+func (s *DeviceService) RestoreDevice(deviceID uuid.UUID) (*database.Device, error) {
+	var device database.Device
+	if err := s.db.Unscoped().Where("id = ?", deviceID).First(&device).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "device not found")
+		}
+		return nil, fmt.Errorf("failed to get device: %w", err)
+	}
+	if !device.DeletedAt.Valid {
+		return nil, NewError(CodeConflict, "device is not deleted")
+	}
+
+	if device.UserID != nil {
+		var user database.User
+		if err := s.db.Where("id = ?", device.UserID).First(&user).Error; err != nil {
+			return nil, NewError(CodeConflict, "device owner is deleted; restore the user first")
+		}
+	}
+
+	if err := s.db.Unscoped().Model(&device).Update("deleted_at", nil).Error; err != nil {
+		return nil, fmt.Errorf("failed to restore device: %w", err)
+	}
+
+	return s.GetDeviceByID(deviceID)
+}
+
 // UpdateDeviceLastUsed updates the last used timestamp for a device
 func (s *DeviceService) UpdateDeviceLastUsed(deviceID uuid.UUID) error {
 	return s.db.Model(&database.Device{}).Where("id = ?", deviceID).Update("last_used_at", time.Now()).Error
+}
+
+// TransitionDevice moves a device to another lifecycle state and records the
+// change in its history. Lost and retired devices are deactivated, and marking
+// a device lost publishes a device.lost event so webhooks can alert on it.
+func (s *DeviceService) TransitionDevice(deviceID uuid.UUID, toState, reason string, requestedByID uuid.UUID, ipAddress, userAgent string) (*database.Device, error) {
+	if _, ok := DeviceStateTransitions[toState]; !ok {
+		return nil, NewError(CodeValidationFailed, "invalid state '%s'. Must be one of: %v", toState, DeviceStates())
+	}
+	if reason == "" {
+		return nil, NewError(CodeValidationFailed, "reason is required")
+	}
+
+	device, err := s.GetDeviceByID(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	fromState := device.State
+	if fromState == "" {
+		fromState = DeviceStateAssigned
+	}
+	if fromState == toState {
+		return nil, NewError(CodeConflict, "device is already %s", toState)
+	}
+	allowed := false
+	for _, state := range DeviceStateTransitions[fromState] {
+		if state == toState {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return nil, NewError(CodeConflict, "a %s device cannot be moved to %s", fromState, toState)
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"state":            toState,
+		"state_changed_at": now,
+	}
+	if !DeviceStateAllowsActivation(toState) {
+		updates["active"] = false
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&database.Device{}).Where("id = ?", deviceID).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to update device state: %w", err)
+		}
+
+		record := database.DeviceRegistration{
+			ID:              uuid.New(),
+			RegistrarUserID: requestedByID,
+			DeviceID:        deviceID,
+			ActionType:      "state_change",
+			State:           toState,
+			Reason:          reason,
+			IPAddress:       ipAddress,
+			UserAgent:       userAgent,
+		}
+		record.TargetUserID = device.UserID
+		if err := tx.Create(&record).Error; err != nil {
+			return fmt.Errorf("failed to record device state change: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if toState == DeviceStateLost {
+		s.events.Publish(EventDeviceLost, DeviceLost{
+			DeviceID:     device.ID,
+			Type:         device.Type,
+			Identifier:   device.Identifier,
+			SerialNumber: device.SerialNumber,
+			AssetTag:     device.AssetTag,
+			UserID:       device.UserID,
+			Email:        device.User.Email,
+			Reason:       reason,
+			ReportedByID: requestedByID,
+		})
+	}
+
+	return s.GetDeviceByID(deviceID)
+}
+
+// checkAssetTag returns a conflict if another device that is not deleted has assetTag
+func (s *DeviceService) checkAssetTag(assetTag string, deviceID uuid.UUID) error {
+	if assetTag == "" {
+		return nil
+	}
+	var count int64
+	if err := s.db.Model(&database.Device{}).Where("asset_tag = ? AND id <> ?", assetTag, deviceID).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check asset tag: %w", err)
+	}
+	if count > 0 {
+		return NewError(CodeConflict, "asset tag '%s' is already in use", assetTag)
+	}
+	return nil
 } 
\ No newline at end of file
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+	"gorm.io/gorm"
+)
+
+// DoorDriver unlocks doors on a physical access controller
+type DoorDriver interface {
+	Name() string
+	// Unlock releases a door for the given number of seconds, returning the controller's reference for the event
+	Unlock(ctx context.Context, door string, seconds int) (string, error)
+}
+
+// DoorService unlocks door resources through the configured controller driver and
+// keeps an access log of unlock attempts
+type DoorService struct {
+	db     *gorm.DB
+	config *config.Config
+	driver DoorDriver
+}
+
+func NewDoorService(db *gorm.DB, config *config.Config) *DoorService {
+	var driver DoorDriver
+	switch config.Doors.Driver {
+	case "http":
+		driver = NewHTTPDoorDriver(config.Doors.ControllerURL, config.Doors.APIKey)
+	case "mock", "":
+		driver = &MockDoorDriver{}
+	default:
+		log.Printf("Unknown door driver %q, falling back to mock", config.Doors.Driver)
+		driver = &MockDoorDriver{}
+	}
+	return &DoorService{db: db, config: config, driver: driver}
+}
+
+// ListDoors retrieves all door resources
+func (s *DoorService) ListDoors() ([]database.Resource, error) {
+	var doors []database.Resource
+	if err := s.db.Where("type = ?", "door").Order("name").Find(&doors).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch doors: %w", err)
+	}
+	return doors, nil
+}
+
+// GetDoorByID retrieves a door resource by ID
+func (s *DoorService) GetDoorByID(id uuid.UUID) (*database.Resource, error) {
+	var door database.Resource
+	if err := s.db.Where("id = ? AND type = ?", id, "door").First(&door).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "door not found")
+		}
+		return nil, fmt.Errorf("failed to get door: %w", err)
+	}
+	return &door, nil
+}
+
+// GetDoorByName retrieves a door resource by name
+func (s *DoorService) GetDoorByName(name string) (*database.Resource, error) {
+	var door database.Resource
+	if err := s.db.Where("name = ? AND type = ?", name, "door").First(&door).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "door '%s' not found", name)
+		}
+		return nil, fmt.Errorf("failed to get door '%s': %w", name, err)
+	}
+	return &door, nil
+}
+
+// DoorForAction returns the door name a door action unlocks, from "door" in its details
+func DoorForAction(action *database.Action) string {
+	if action.Details.Status != pgtype.Present {
+		return ""
+	}
+	var details map[string]interface{}
+	if err := action.Details.AssignTo(&details); err != nil {
+		return ""
+	}
+	door, _ := details["door"].(string)
+	return door
+}
+
+// UnlockDoor asks the controller to unlock a door and records the attempt in the
+// door access log, linked to the authentication log entry that triggered it.
+// The returned event is recorded even when the unlock fails.
+func (s *DoorService) UnlockDoor(door *database.Resource, userID, actionID, authLogID *uuid.UUID) (*database.DoorEvent, error) {
+	event := &database.DoorEvent{
+		ID:                  uuid.New(),
+		ResourceID:          door.ID,
+		UserID:              userID,
+		ActionID:            actionID,
+		AuthenticationLogID: authLogID,
+		Driver:              s.driver.Name(),
+	}
+
+	var unlockErr error
+	if !door.Active {
+		unlockErr = fmt.Errorf("door '%s' is inactive", door.Name)
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), s.config.Doors.Timeout)
+		event.ControllerRef, unlockErr = s.driver.Unlock(ctx, door.Name, s.config.Doors.UnlockSeconds)
+		cancel()
+	}
+
+	event.Result = "unlocked"
+	if unlockErr != nil {
+		event.Result = "failed"
+		event.Error = unlockErr.Error()
+	}
+
+	if err := s.db.Create(event).Error; err != nil {
+		return nil, fmt.Errorf("failed to record door event: %w", err)
+	}
+	return event, unlockErr
+}
+
+// ListDoorEvents retrieves door access log entries, newest first, optionally for one door
+func (s *DoorService) ListDoorEvents(doorID *uuid.UUID, limit, offset int) ([]database.DoorEvent, int64, error) {
+	query := s.db.Model(&database.DoorEvent{})
+	if doorID != nil {
+		query = query.Where("resource_id = ?", *doorID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count door events: %w", err)
+	}
+
+	var events []database.DoorEvent
+	if err := query.Preload("Resource").Preload("User").
+		Order("created_at DESC").Limit(limit).Offset(offset).
+		Find(&events).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch door events: %w", err)
+	}
+	return events, total, nil
+}
+
+// HTTPDoorDriver drives a door controller over a generic JSON HTTP API:
+// POST {base_url}/doors/{door}/unlock with {"duration_seconds": n}, answered
+// with a 2xx and an optional {"event_id": "..."} body.
+type HTTPDoorDriver struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+func NewHTTPDoorDriver(baseURL, apiKey string) *HTTPDoorDriver {
+	return &HTTPDoorDriver{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		client:  &http.Client{},
+	}
+}
+
+func (d *HTTPDoorDriver) Name() string {
+	return "http"
+}
+
+func (d *HTTPDoorDriver) Unlock(ctx context.Context, door string, seconds int) (string, error) {
+	if d.baseURL == "" {
+		return "", fmt.Errorf("door controller URL is not configured")
+	}
+
+	body, err := json.Marshal(map[string]int{"duration_seconds": seconds})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode unlock request: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/doors/%s/unlock", d.baseURL, url.PathEscape(door))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create unlock request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "YubiApp-Doors/1.0")
+	if d.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+d.apiKey)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("door controller request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("door controller returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		EventID string `json:"event_id"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	return result.EventID, nil
+}
+
+// MockDoorDriver logs unlocks instead of talking to a controller, for development and demos
+type MockDoorDriver struct{}
+
+func (d *MockDoorDriver) Name() string {
+	return "mock"
+}
+
+func (d *MockDoorDriver) Unlock(ctx context.Context, door string, seconds int) (string, error) {
+	ref := "mock-" + uuid.New().String()
+	log.Printf("Mock door controller: unlocked %s for %ds (%s) at %s", door, seconds, ref, time.Now().Format(time.RFC3339))
+	return ref, nil
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// ErrorCode is a stable, machine-readable error code reported to API clients.
+// Codes are part of the API: add new ones rather than renaming existing ones.
+type ErrorCode string
+
+const (
+	CodeAuthFailed             ErrorCode = "AUTH_FAILED"
+	CodeAuthReplayedOTP        ErrorCode = "AUTH_REPLAYED_OTP"
+	CodeDeviceCloneSuspected   ErrorCode = "DEVICE_CLONE_SUSPECTED"
+	CodeAccountInactive        ErrorCode = "ACCOUNT_INACTIVE"
+	CodeAccountLocked          ErrorCode = "ACCOUNT_LOCKED"
+	CodePasswordExpired        ErrorCode = "PASSWORD_EXPIRED"
+	CodeSessionInvalid         ErrorCode = "SESSION_INVALID"
+	CodeSessionBindingMismatch ErrorCode = "SESSION_BINDING_MISMATCH"
+	CodeCSRFFailed             ErrorCode = "CSRF_FAILED"
+	CodePermissionDenied       ErrorCode = "PERMISSION_DENIED"
+	CodeValidationFailed       ErrorCode = "VALIDATION_FAILED"
+	CodeNotFound               ErrorCode = "NOT_FOUND"
+	CodeConflict               ErrorCode = "CONFLICT"
+	CodeRateLimited            ErrorCode = "RATE_LIMITED"
+	CodeUpstreamFailed         ErrorCode = "UPSTREAM_FAILED"
+	CodeValidationUnavailable  ErrorCode = "VALIDATION_SERVICE_UNAVAILABLE"
+	CodePushPending            ErrorCode = "PUSH_PENDING"
+	CodePushDenied             ErrorCode = "PUSH_DENIED"
+	CodeInternal               ErrorCode = "INTERNAL_ERROR"
+)
+
+// Error is a service error carrying the code it is reported to clients with
+type Error struct {
+	Code    ErrorCode
+	Message string
+	Err     error // Underlying cause, if any
+}
+
+func (e *Error) Error() string {
+	switch {
+	case e.Err == nil:
+		return e.Message
+	case e.Message == "":
+		return e.Err.Error()
+	}
+	return e.Message + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// NewError creates a coded error with a formatted message
+func NewError(code ErrorCode, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// WrapError creates a coded error with a message and an underlying cause
+func WrapError(code ErrorCode, message string, err error) *Error {
+	return &Error{Code: code, Message: message, Err: err}
+}
+
+// WithCode gives err a code unless it already carries one, keeping its message
+func WithCode(code ErrorCode, err error) error {
+	var coded *Error
+	if err == nil || errors.As(err, &coded) {
+		return err
+	}
+	return &Error{Code: code, Err: err}
+}
+
+// ErrorCodeOf returns the code of the first coded error in err's chain. Missing
+// records are NOT_FOUND and unique constraint violations CONFLICT; anything
+// else uncoded returns "".
+func ErrorCodeOf(err error) ErrorCode {
+	var coded *Error
+	if errors.As(err, &coded) {
+		return coded.Code
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return CodeNotFound
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return CodeConflict
+	}
+	return ""
+}
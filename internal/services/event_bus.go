@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event types published on the event bus
+const (
+	EventPermissionsInvalidated  = "permissions.invalidated"
+	EventDeviceLost              = "device.lost"
+	EventSecurityIncident        = "security_incident.opened"
+	EventActionPerformed         = "action.performed"
+	EventUserActivityRecorded    = "user_activity.recorded"
+	EventActionApprovalRequested = "action.approval_requested"
+	EventVisitorCheckedIn        = "visitor.checked_in"
+)
+
+// EventTypes lists the event types that can be published, e.g. for webhook subscriptions
+var EventTypes = []string{
+	EventPermissionsInvalidated,
+	EventDeviceLost,
+	EventSecurityIncident,
+	EventActionPerformed,
+	EventUserActivityRecorded,
+	EventActionApprovalRequested,
+	EventVisitorCheckedIn,
+}
+
+// Event is a single message published on the event bus
+type Event struct {
+	ID         uuid.UUID   `json:"id"`
+	Type       string      `json:"type"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Data       interface{} `json:"data"`
+}
+
+// EventHandler receives published events
+type EventHandler func(Event)
+
+// EventBus is an in-process publish/subscribe bus. Handlers run on their own
+// goroutine so publishing never blocks the request that caused the event.
+type EventBus struct {
+	mu       sync.RWMutex
+	handlers map[string][]EventHandler
+	running  sync.WaitGroup
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{handlers: make(map[string][]EventHandler)}
+}
+
+// Subscribe registers a handler for an event type; "*" receives every event
+func (b *EventBus) Subscribe(eventType string, handler EventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], handler)
+}
+
+// Publish delivers an event to all handlers subscribed to its type. A nil bus
+// discards events, so services can be used without one (e.g. from the CLI).
+func (b *EventBus) Publish(eventType string, data interface{}) {
+	if b == nil {
+		return
+	}
+
+	event := Event{
+		ID:         uuid.New(),
+		Type:       eventType,
+		OccurredAt: time.Now(),
+		Data:       data,
+	}
+
+	b.mu.RLock()
+	handlers := append(append([]EventHandler{}, b.handlers[eventType]...), b.handlers["*"]...)
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		b.running.Add(1)
+		go func(handler EventHandler) {
+			defer b.running.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("Event handler for %s panicked: %v", event.Type, r)
+				}
+			}()
+			handler(event)
+		}(handler)
+	}
+}
+
+// Wait blocks until every handler started so far has returned, e.g. so webhook
+// deliveries finish before shutdown. It gives up when ctx is done.
+func (b *EventBus) Wait(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+	return waitContext(ctx, &b.running)
+}
+
+// waitContext waits for wg, or returns ctx's error if ctx is done first
+func waitContext(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
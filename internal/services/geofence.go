@@ -0,0 +1,78 @@
+package services
+
+import (
+	"math"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+)
+
+const earthRadiusMeters = 6371000.0
+
+// Coordinates is a client-reported position
+type Coordinates struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// GeofenceResult records the outcome of checking a position against a location's geofence
+type GeofenceResult struct {
+	LocationID     uuid.UUID `json:"location_id"`
+	Checked        bool      `json:"checked"`
+	Within         bool      `json:"within"`
+	DistanceMeters float64   `json:"distance_meters,omitempty"`
+	RadiusMeters   float64   `json:"radius_meters,omitempty"`
+	Reason         string    `json:"reason,omitempty"`
+}
+
+// HasGeofence reports whether a location has a complete geofence configured
+func HasGeofence(location *database.Location) bool {
+	return location.Latitude != nil && location.Longitude != nil && location.RadiusMeters != nil
+}
+
+// VerifyGeofence checks whether coords fall inside the location's geofence.
+// Locations without a geofence are reported as unchecked.
+func VerifyGeofence(location *database.Location, coords *Coordinates) GeofenceResult {
+	result := GeofenceResult{LocationID: location.ID}
+	if !HasGeofence(location) {
+		result.Reason = "location has no geofence"
+		return result
+	}
+	if coords == nil {
+		result.Reason = "no coordinates reported"
+		return result
+	}
+
+	result.Checked = true
+	result.RadiusMeters = *location.RadiusMeters
+	result.DistanceMeters = math.Round(distanceMeters(*location.Latitude, *location.Longitude, coords.Latitude, coords.Longitude))
+	result.Within = result.DistanceMeters <= result.RadiusMeters
+	if !result.Within {
+		result.Reason = "outside geofence"
+	}
+	return result
+}
+
+// ActionEnforcesGeofence reports whether an action's details set "enforce_geofence": true
+func ActionEnforcesGeofence(action *database.Action) bool {
+	if action.Details.Status != pgtype.Present {
+		return false
+	}
+	var details map[string]interface{}
+	if err := action.Details.AssignTo(&details); err != nil {
+		return false
+	}
+	enforce, _ := details["enforce_geofence"].(bool)
+	return enforce
+}
+
+// distanceMeters returns the great-circle distance between two points using the haversine formula
+func distanceMeters(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return earthRadiusMeters * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
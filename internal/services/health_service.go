@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// Dependency check results
+const (
+	HealthStatusOK       = "ok"
+	HealthStatusDegraded = "degraded" // An optional dependency failed
+	HealthStatusFail     = "fail"
+	HealthStatusSkipped  = "skipped"
+)
+
+// DependencyHealth is the result of checking one dependency
+type DependencyHealth struct {
+	Status    string     `json:"status"`
+	Required  bool       `json:"required"` // A failing required dependency makes the server unready
+	LatencyMS int64      `json:"latency_ms"`
+	Error     string     `json:"error,omitempty"`
+	Pool      *PoolStats `json:"pool,omitempty"` // Connection pool usage, for database checks
+}
+
+// PoolStats is a snapshot of a database connection pool
+type PoolStats struct {
+	MaxOpen        int   `json:"max_open"`
+	Open           int   `json:"open"`
+	InUse          int   `json:"in_use"`
+	Idle           int   `json:"idle"`
+	WaitCount      int64 `json:"wait_count"`       // Connections waited for since startup
+	WaitDurationMS int64 `json:"wait_duration_ms"` // Total time spent waiting for them
+}
+
+// poolStats snapshots db's pool
+func poolStats(db *sql.DB) *PoolStats {
+	stats := db.Stats()
+	return &PoolStats{
+		MaxOpen:        stats.MaxOpenConnections,
+		Open:           stats.OpenConnections,
+		InUse:          stats.InUse,
+		Idle:           stats.Idle,
+		WaitCount:      stats.WaitCount,
+		WaitDurationMS: stats.WaitDuration.Milliseconds(),
+	}
+}
+
+// HealthReport is the readiness of the server and each of its dependencies
+type HealthReport struct {
+	Status    string                      `json:"status"`
+	Checks    map[string]DependencyHealth `json:"checks"`
+	CheckedAt time.Time                   `json:"checked_at"`
+}
+
+// Ready reports whether every required dependency is reachable
+func (r *HealthReport) Ready() bool {
+	return r.Status != HealthStatusFail
+}
+
+// HealthService checks the dependencies the server needs to serve requests
+type HealthService struct {
+	db          *gorm.DB
+	replicaDB   *sql.DB // nil without a read replica
+	redisClient redis.UniversalClient
+	config      *config.Config
+	httpClient  *http.Client
+}
+
+func NewHealthService(db *gorm.DB, replicaDB *sql.DB, redisClient redis.UniversalClient, config *config.Config) *HealthService {
+	return &HealthService{
+		db:          db,
+		replicaDB:   replicaDB,
+		redisClient: redisClient,
+		config:      config,
+		httpClient:  &http.Client{Timeout: config.Health.Timeout},
+	}
+}
+
+// Check runs every dependency check concurrently, each bounded by health.timeout.
+// PostgreSQL and Redis are required; YubiCloud is checked only when
+// health.check_yubicloud is set and, since OTPs can still be validated locally,
+// only degrades the report when unreachable. The read replica, when configured,
+// only degrades it too, as authentication never reads from it. Database checks
+// include their pool usage.
+func (s *HealthService) Check(ctx context.Context) *HealthReport {
+	checks := map[string]struct {
+		required bool
+		enabled  bool
+		check    func(context.Context) error
+	}{
+		"database":         {required: true, enabled: true, check: s.checkDatabase},
+		"database_replica": {required: false, enabled: s.replicaDB != nil, check: s.checkReplica},
+		"redis":            {required: true, enabled: true, check: s.checkRedis},
+		"yubicloud":        {required: false, enabled: s.config.Health.CheckYubicloud, check: s.checkYubicloud},
+	}
+
+	report := &HealthReport{Status: HealthStatusOK, Checks: map[string]DependencyHealth{}, CheckedAt: time.Now()}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, dependency := range checks {
+		if !dependency.enabled {
+			report.Checks[name] = DependencyHealth{Status: HealthStatusSkipped, Required: dependency.required}
+			continue
+		}
+
+		wg.Add(1)
+		go func(name string, required bool, check func(context.Context) error) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, s.config.Health.Timeout)
+			defer cancel()
+
+			start := time.Now()
+			result := DependencyHealth{Status: HealthStatusOK, Required: required}
+			if err := check(checkCtx); err != nil {
+				result.Status = HealthStatusFail
+				result.Error = err.Error()
+			}
+			result.LatencyMS = time.Since(start).Milliseconds()
+			result.Pool = s.pool(name)
+
+			mu.Lock()
+			report.Checks[name] = result
+			mu.Unlock()
+		}(name, dependency.required, dependency.check)
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status != HealthStatusFail {
+			continue
+		}
+		if result.Required {
+			report.Status = HealthStatusFail
+		} else if report.Status == HealthStatusOK {
+			report.Status = HealthStatusDegraded
+		}
+	}
+	return report
+}
+
+// checkDatabase pings PostgreSQL
+func (s *HealthService) checkDatabase(ctx context.Context) error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// checkReplica pings the read replica
+func (s *HealthService) checkReplica(ctx context.Context) error {
+	return s.replicaDB.PingContext(ctx)
+}
+
+// pool returns the pool stats of the named database dependency, or nil
+func (s *HealthService) pool(name string) *PoolStats {
+	switch name {
+	case "database":
+		if sqlDB, err := s.db.DB(); err == nil {
+			return poolStats(sqlDB)
+		}
+	case "database_replica":
+		return poolStats(s.replicaDB)
+	}
+	return nil
+}
+
+// checkRedis pings Redis
+func (s *HealthService) checkRedis(ctx context.Context) error {
+	return s.redisClient.Ping(ctx).Err()
+}
+
+// checkYubicloud makes an unauthenticated request to the YubiCloud verify URL.
+// Any response below 500 shows the service is up; it answers such requests with
+// a MISSING_PARAMETER status rather than an HTTP error.
+func (s *HealthService) checkYubicloud(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.config.Yubikey.APIURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("YubiCloud returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,612 @@
+package services
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// HolidayImportFormats lists the formats ImportHolidays reads: CSV rows of
+// date,name[,country], the JSON of the Nager.Date public holiday API
+// (/api/v3/PublicHolidays/{year}/{country}) and iCalendar (.ics) files
+var HolidayImportFormats = []string{"csv", "nager", "ics"}
+
+// maxHolidayImport is the most holidays a single import may hold
+const maxHolidayImport = 10000
+
+// maxHolidayEventDays is the longest iCalendar event imported, in days
+const maxHolidayEventDays = 31
+
+// countryCodePattern is an ISO 3166-1 alpha-2 country code
+var countryCodePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// HolidayService manages public holidays and resolves which apply where
+type HolidayService struct {
+	db             *gorm.DB
+	defaultCountry string
+}
+
+func NewHolidayService(db *gorm.DB, cfg *config.Config) *HolidayService {
+	return &HolidayService{db: db, defaultCountry: cfg.Holidays.DefaultCountry}
+}
+
+// HolidayScope is where holidays apply: a country, or a single location
+type HolidayScope struct {
+	Country    string
+	LocationID *uuid.UUID
+}
+
+// HolidayInput holds the fields of a new holiday
+type HolidayInput struct {
+	HolidayScope
+	Date string // YYYY-MM-DD
+	Name string
+}
+
+// HolidayUpdate holds the changes to a holiday; nil fields are left as they are
+type HolidayUpdate struct {
+	Date *string
+	Name *string
+}
+
+// HolidayFilter narrows the holidays returned by ListHolidays. From and To
+// are inclusive YYYY-MM-DD dates.
+type HolidayFilter struct {
+	From       string
+	To         string
+	Country    string
+	LocationID *uuid.UUID
+	Limit      int
+	Offset     int
+}
+
+// HolidayImport counts what an import did with the holidays it read
+type HolidayImport struct {
+	Created   int `json:"created"`
+	Updated   int `json:"updated" doc:"Renamed holidays already on their date"`
+	Unchanged int `json:"unchanged" doc:"Holidays already recorded as they are"`
+	Skipped   int `json:"skipped" doc:"Regional holidays of Nager.Date data, which apply to part of a country only"`
+}
+
+// importedHoliday is a holiday as read from an import
+type importedHoliday struct {
+	Date    string
+	Name    string
+	Country string
+}
+
+// NormalizeCountry upper-cases an ISO 3166-1 alpha-2 country code, which may be empty
+func NormalizeCountry(country string) (string, error) {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	if country != "" && !countryCodePattern.MatchString(country) {
+		return "", NewError(CodeValidationFailed, "country must be an ISO 3166-1 alpha-2 code like GB, got '%s'", country)
+	}
+	return country, nil
+}
+
+// CreateHoliday adds a holiday to a country or location
+func (s *HolidayService) CreateHoliday(input HolidayInput) (*database.Holiday, error) {
+	scope, err := s.checkScope(input.HolidayScope)
+	if err != nil {
+		return nil, err
+	}
+	holiday := &database.Holiday{
+		ID:         uuid.New(),
+		Date:       input.Date,
+		Name:       strings.TrimSpace(input.Name),
+		Country:    scope.Country,
+		LocationID: scope.LocationID,
+		Source:     "manual",
+	}
+	if err := validateHoliday(holiday); err != nil {
+		return nil, err
+	}
+	if err := s.checkUnique(holiday); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Omit("Location").Create(holiday).Error; err != nil {
+		return nil, fmt.Errorf("failed to create holiday: %w", err)
+	}
+	return s.GetHoliday(holiday.ID)
+}
+
+// GetHoliday retrieves a holiday by ID with its location
+func (s *HolidayService) GetHoliday(id uuid.UUID) (*database.Holiday, error) {
+	var holiday database.Holiday
+	if err := s.db.Preload("Location").Where("id = ?", id).First(&holiday).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, NewError(CodeNotFound, "holiday not found")
+		}
+		return nil, fmt.Errorf("failed to get holiday: %w", err)
+	}
+	return &holiday, nil
+}
+
+// ListHolidays retrieves holidays by date, with the total matching the filter
+func (s *HolidayService) ListHolidays(filter HolidayFilter) ([]database.Holiday, int64, error) {
+	query := database.ReadReplica(s.db).Model(&database.Holiday{})
+	if filter.From != "" {
+		query = query.Where("date >= ?", filter.From)
+	}
+	if filter.To != "" {
+		query = query.Where("date <= ?", filter.To)
+	}
+	if filter.Country != "" {
+		query = query.Where("country = ?", filter.Country)
+	}
+	if filter.LocationID != nil {
+		query = query.Where("location_id = ?", *filter.LocationID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count holidays: %w", err)
+	}
+
+	var holidays []database.Holiday
+	query = query.Preload("Location").Order("date, country")
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit).Offset(filter.Offset)
+	}
+	if err := query.Find(&holidays).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch holidays: %w", err)
+	}
+	return holidays, total, nil
+}
+
+// ListLocationHolidays retrieves the holidays that apply at a location from
+// from to to inclusive: its own and those of its country, or of
+// holidays.default_country when it has none
+func (s *HolidayService) ListLocationHolidays(locationID uuid.UUID, from, to string) ([]database.Holiday, error) {
+	var location database.Location
+	if err := s.db.Select("id", "country").Where("id = ?", locationID).First(&location).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, NewError(CodeNotFound, "location not found")
+		}
+		return nil, fmt.Errorf("failed to get location: %w", err)
+	}
+	country := location.Country
+	if country == "" {
+		country = s.defaultCountry
+	}
+
+	query := database.ReadReplica(s.db).Preload("Location").
+		Where("location_id = ? OR (location_id IS NULL AND country = ? AND country <> '')", locationID, country)
+	if from != "" {
+		query = query.Where("date >= ?", from)
+	}
+	if to != "" {
+		query = query.Where("date <= ?", to)
+	}
+	var holidays []database.Holiday
+	if err := query.Order("date, country").Find(&holidays).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch holidays: %w", err)
+	}
+	return holidays, nil
+}
+
+// UpdateHoliday renames a holiday or moves it to another date
+func (s *HolidayService) UpdateHoliday(id uuid.UUID, update HolidayUpdate) (*database.Holiday, error) {
+	holiday, err := s.GetHoliday(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Date != nil {
+		holiday.Date = *update.Date
+	}
+	if update.Name != nil {
+		holiday.Name = strings.TrimSpace(*update.Name)
+	}
+	if err := validateHoliday(holiday); err != nil {
+		return nil, err
+	}
+	if err := s.checkUnique(holiday); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Model(&database.Holiday{ID: id}).Updates(map[string]interface{}{
+		"date": holiday.Date,
+		"name": holiday.Name,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to update holiday: %w", err)
+	}
+	return s.GetHoliday(id)
+}
+
+// DeleteHoliday deletes a holiday
+func (s *HolidayService) DeleteHoliday(id uuid.UUID) error {
+	result := s.db.Where("id = ?", id).Delete(&database.Holiday{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete holiday: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return NewError(CodeNotFound, "holiday not found")
+	}
+	return nil
+}
+
+// ImportHolidays reads holidays in one of HolidayImportFormats and records
+// them in a single transaction, renaming those already on their date. With a
+// location in scope every holiday is the location's; otherwise a country in
+// scope overrides the one each holiday names, which iCalendar files lack.
+func (s *HolidayService) ImportHolidays(r io.Reader, format string, scope HolidayScope) (*HolidayImport, error) {
+	var err error
+	if scope.Country != "" || scope.LocationID != nil {
+		if scope, err = s.checkScope(scope); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &HolidayImport{}
+	var imported []importedHoliday
+	switch format {
+	case "csv":
+		imported, err = readHolidaysCSV(r)
+	case "nager":
+		imported, result.Skipped, err = readHolidaysNager(r)
+	case "ics":
+		imported, err = readHolidaysICS(r)
+	default:
+		return nil, NewError(CodeValidationFailed, "format must be one of: %v", HolidayImportFormats)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(imported) > maxHolidayImport {
+		return nil, NewError(CodeValidationFailed, "an import may hold at most %d holidays, got %d", maxHolidayImport, len(imported))
+	}
+
+	holidays := make([]database.Holiday, len(imported))
+	for i, entry := range imported {
+		holiday := database.Holiday{
+			Date:       entry.Date,
+			Name:       strings.TrimSpace(entry.Name),
+			Country:    scope.Country,
+			LocationID: scope.LocationID,
+			Source:     format,
+		}
+		if scope.LocationID == nil && holiday.Country == "" {
+			if holiday.Country, err = NormalizeCountry(entry.Country); err != nil {
+				return nil, NewError(CodeValidationFailed, "holiday %d (%s): %s", i+1, entry.Date, err.Error())
+			}
+			if holiday.Country == "" {
+				return nil, NewError(CodeValidationFailed, "holiday %d (%s) names no country; import it for a country or location", i+1, entry.Date)
+			}
+		}
+		if err := validateHoliday(&holiday); err != nil {
+			return nil, NewError(CodeValidationFailed, "holiday %d: %s", i+1, err.Error())
+		}
+		holidays[i] = holiday
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		for i := range holidays {
+			holiday := &holidays[i]
+			var existing database.Holiday
+			err := holidayScopeQuery(tx, holiday).Where("date = ?", holiday.Date).First(&existing).Error
+			switch {
+			case err == gorm.ErrRecordNotFound:
+				holiday.ID = uuid.New()
+				if err := tx.Omit("Location").Create(holiday).Error; err != nil {
+					return fmt.Errorf("failed to create holiday: %w", err)
+				}
+				result.Created++
+			case err != nil:
+				return fmt.Errorf("failed to look up holiday: %w", err)
+			case existing.Name == holiday.Name:
+				result.Unchanged++
+			default:
+				if err := tx.Model(&existing).Updates(map[string]interface{}{"name": holiday.Name, "source": holiday.Source}).Error; err != nil {
+					return fmt.Errorf("failed to update holiday: %w", err)
+				}
+				result.Updated++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// checkScope normalizes a scope's country and checks that it names exactly
+// one of a country and an existing location
+func (s *HolidayService) checkScope(scope HolidayScope) (HolidayScope, error) {
+	country, err := NormalizeCountry(scope.Country)
+	if err != nil {
+		return scope, err
+	}
+	scope.Country = country
+	if (scope.Country == "") == (scope.LocationID == nil) {
+		return scope, NewError(CodeValidationFailed, "a holiday needs either a country or a location_id")
+	}
+	if scope.LocationID != nil {
+		var count int64
+		if err := s.db.Model(&database.Location{}).Where("id = ?", *scope.LocationID).Count(&count).Error; err != nil {
+			return scope, fmt.Errorf("failed to look up location: %w", err)
+		}
+		if count == 0 {
+			return scope, NewError(CodeValidationFailed, "location %s does not exist", *scope.LocationID)
+		}
+	}
+	return scope, nil
+}
+
+// checkUnique rejects a holiday on a date its country or location already has one on
+func (s *HolidayService) checkUnique(holiday *database.Holiday) error {
+	var count int64
+	if err := holidayScopeQuery(s.db.Model(&database.Holiday{}), holiday).
+		Where("date = ? AND id <> ?", holiday.Date, holiday.ID).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check for holidays on %s: %w", holiday.Date, err)
+	}
+	if count > 0 {
+		return NewError(CodeConflict, "there is already a holiday on %s there", holiday.Date)
+	}
+	return nil
+}
+
+// holidayScopeQuery narrows a query to the holidays of the holiday's country or location
+func holidayScopeQuery(query *gorm.DB, holiday *database.Holiday) *gorm.DB {
+	if holiday.LocationID != nil {
+		return query.Where("location_id = ?", *holiday.LocationID)
+	}
+	return query.Where("location_id IS NULL AND country = ?", holiday.Country)
+}
+
+// validateHoliday checks a holiday's date and name
+func validateHoliday(holiday *database.Holiday) error {
+	if _, err := time.Parse("2006-01-02", holiday.Date); err != nil {
+		return NewError(CodeValidationFailed, "date must be YYYY-MM-DD, got '%s'", holiday.Date)
+	}
+	if holiday.Name == "" {
+		return NewError(CodeValidationFailed, "holiday on %s needs a name", holiday.Date)
+	}
+	if len(holiday.Name) > 255 {
+		return NewError(CodeValidationFailed, "holiday name must be at most 255 characters")
+	}
+	return nil
+}
+
+// readHolidaysCSV reads rows of date,name[,country], with an optional header row
+func readHolidaysCSV(r io.Reader) ([]importedHoliday, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var holidays []importedHoliday
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, NewError(CodeValidationFailed, "invalid CSV: %s", err.Error())
+		}
+		if line == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "date") {
+			continue
+		}
+		if len(record) < 2 || len(record) > 3 {
+			return nil, NewError(CodeValidationFailed, "CSV line %d: expected date,name[,country]", line)
+		}
+		holiday := importedHoliday{Date: strings.TrimSpace(record[0]), Name: record[1]}
+		if len(record) == 3 {
+			holiday.Country = record[2]
+		}
+		holidays = append(holidays, holiday)
+	}
+	return holidays, nil
+}
+
+// readHolidaysNager reads Nager.Date public holidays, skipping the regional
+// ones that apply to some of a country's subdivisions only
+func readHolidaysNager(r io.Reader) ([]importedHoliday, int, error) {
+	var entries []struct {
+		Date        string   `json:"date"`
+		Name        string   `json:"name"`
+		LocalName   string   `json:"localName"`
+		CountryCode string   `json:"countryCode"`
+		Global      *bool    `json:"global"`
+		Counties    []string `json:"counties"`
+	}
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return nil, 0, NewError(CodeValidationFailed, "invalid Nager.Date JSON: %s", err.Error())
+	}
+
+	var holidays []importedHoliday
+	skipped := 0
+	for _, entry := range entries {
+		if (entry.Global != nil && !*entry.Global) || len(entry.Counties) > 0 {
+			skipped++
+			continue
+		}
+		name := entry.Name
+		if name == "" {
+			name = entry.LocalName
+		}
+		holidays = append(holidays, importedHoliday{Date: entry.Date, Name: name, Country: entry.CountryCode})
+	}
+	return holidays, skipped, nil
+}
+
+// readHolidaysICS reads the events of an iCalendar file as holidays, one per
+// day an event spans. Repeating events are read once, on their first date.
+func readHolidaysICS(r io.Reader) ([]importedHoliday, error) {
+	// Unfold continuation lines, which start with a space or tab
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, NewError(CodeValidationFailed, "invalid iCalendar file: %s", err.Error())
+	}
+
+	var holidays []importedHoliday
+	var inEvent bool
+	var start, end, summary string
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name, _, _ = strings.Cut(strings.ToUpper(name), ";")
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			inEvent, start, end, summary = true, "", "", ""
+		case !inEvent:
+		case name == "DTSTART":
+			start = value
+		case name == "DTEND":
+			end = value
+		case name == "SUMMARY":
+			summary = strings.NewReplacer(`\,`, ",", `\;`, ";", `\n`, " ", `\N`, " ", `\\`, `\`).Replace(value)
+		case name == "END" && value == "VEVENT":
+			inEvent = false
+			days, err := icsEventDays(start, end)
+			if err != nil {
+				return nil, err
+			}
+			for _, day := range days {
+				holidays = append(holidays, importedHoliday{Date: day, Name: summary})
+			}
+		}
+	}
+	return holidays, nil
+}
+
+// icsEventDays returns the dates an event from start to end (exclusive, and
+// optional) covers, reading only the date of date-times
+func icsEventDays(start, end string) ([]string, error) {
+	parse := func(value string) (time.Time, error) {
+		if len(value) < 8 {
+			return time.Time{}, fmt.Errorf("too short")
+		}
+		return time.Parse("20060102", value[:8])
+	}
+
+	first, err := parse(start)
+	if err != nil {
+		return nil, NewError(CodeValidationFailed, "invalid iCalendar DTSTART '%s'", start)
+	}
+	last := first
+	if end != "" {
+		dayAfter, err := parse(end)
+		if err != nil {
+			return nil, NewError(CodeValidationFailed, "invalid iCalendar DTEND '%s'", end)
+		}
+		if dayAfter.After(first) {
+			last = dayAfter.AddDate(0, 0, -1)
+		}
+	}
+	if last.Sub(first) >= maxHolidayEventDays*24*time.Hour {
+		return nil, NewError(CodeValidationFailed, "iCalendar event from %s spans more than %d days", first.Format("2006-01-02"), maxHolidayEventDays)
+	}
+
+	var days []string
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		days = append(days, day.Format("2006-01-02"))
+	}
+	return days, nil
+}
+
+// holidayCalendar holds the holidays of a span of dates and tells which
+// apply on a day at a location
+type holidayCalendar struct {
+	byCountry       map[string]map[string]string    // Country -> date -> name
+	byLocation      map[uuid.UUID]map[string]string // Location -> date -> name
+	locationCountry map[uuid.UUID]string
+	defaultCountry  string
+}
+
+// loadHolidayCalendar reads the holidays from from to to, inclusive YYYY-MM-DD dates
+func loadHolidayCalendar(db *gorm.DB, defaultCountry, from, to string) (*holidayCalendar, error) {
+	calendar := &holidayCalendar{
+		byCountry:       make(map[string]map[string]string),
+		byLocation:      make(map[uuid.UUID]map[string]string),
+		locationCountry: make(map[uuid.UUID]string),
+		defaultCountry:  defaultCountry,
+	}
+
+	var holidays []database.Holiday
+	if err := db.Where("date >= ? AND date <= ?", from, to).Find(&holidays).Error; err != nil {
+		return nil, fmt.Errorf("failed to read holidays: %w", err)
+	}
+	if len(holidays) == 0 {
+		return calendar, nil
+	}
+	for _, holiday := range holidays {
+		dates := calendar.byCountry[holiday.Country]
+		if holiday.LocationID != nil {
+			dates = calendar.byLocation[*holiday.LocationID]
+		}
+		if dates == nil {
+			dates = make(map[string]string)
+			if holiday.LocationID != nil {
+				calendar.byLocation[*holiday.LocationID] = dates
+			} else {
+				calendar.byCountry[holiday.Country] = dates
+			}
+		}
+		dates[holiday.Date] = holiday.Name
+	}
+
+	var locations []database.Location
+	if err := db.Unscoped().Select("id", "country").Where("country <> ''").Find(&locations).Error; err != nil {
+		return nil, fmt.Errorf("failed to read location countries: %w", err)
+	}
+	for _, location := range locations {
+		calendar.locationCountry[location.ID] = location.Country
+	}
+	return calendar, nil
+}
+
+// Holiday returns the name of the holiday on date at a location, or on a day
+// without one, and "" when it is not a holiday there
+func (c *holidayCalendar) Holiday(date string, locationID *uuid.UUID) string {
+	country := c.defaultCountry
+	if locationID != nil {
+		if name, ok := c.byLocation[*locationID][date]; ok {
+			return name
+		}
+		if locationCountry, ok := c.locationCountry[*locationID]; ok {
+			country = locationCountry
+		}
+	}
+	if country == "" {
+		return ""
+	}
+	return c.byCountry[country][date]
+}
+
+// AnyHoliday reports whether date is a holiday at any of the locations, or
+// on a day without locations when there are none
+func (c *holidayCalendar) AnyHoliday(date string, locationIDs []uuid.UUID) bool {
+	if len(locationIDs) == 0 {
+		return c.Holiday(date, nil) != ""
+	}
+	for i := range locationIDs {
+		if c.Holiday(date, &locationIDs[i]) != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,596 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// HR notification rule triggers
+const (
+	HRTriggerAction = "action" // A user performed the named action
+	HRTriggerStatus = "status" // A user started an activity with the named user status, or a status of the named type
+)
+
+// HR notification statuses
+const (
+	HRNotificationPending  = "pending"   // Not delivered yet; retried at next_attempt_at
+	HRNotificationSent     = "sent"      // Delivered
+	HRNotificationFailed   = "failed"    // Gave up after hr_notifications.max_attempts
+	HRNotificationOptedOut = "opted_out" // Not sent because the user opted out of the rule
+)
+
+// HRNotificationUser is the user a notification is about
+type HRNotificationUser struct {
+	ID        uuid.UUID `json:"id"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Name      string    `json:"name"` // First and last name, or the username when both are empty
+}
+
+// HRNotificationData is what a rule's subject and body templates are rendered with
+type HRNotificationData struct {
+	Rule        string
+	TriggerType string
+	TriggerName string
+	User        HRNotificationUser
+	OccurredAt  time.Time
+	Details     map[string]interface{}
+}
+
+// HRNotificationPayload is the JSON body POSTed to webhook rules
+type HRNotificationPayload struct {
+	NotificationID uuid.UUID              `json:"notification_id"`
+	Rule           string                 `json:"rule"`
+	TriggerType    string                 `json:"trigger_type"`
+	TriggerName    string                 `json:"trigger_name"`
+	User           HRNotificationUser     `json:"user"`
+	OccurredAt     time.Time              `json:"occurred_at"`
+	Subject        string                 `json:"subject"`
+	Message        string                 `json:"message"`
+	Details        map[string]interface{} `json:"details,omitempty"`
+}
+
+// HRNotificationFilter selects notifications; zero fields match everything
+type HRNotificationFilter struct {
+	Status string
+	RuleID *uuid.UUID
+	UserID *uuid.UUID
+	Limit  int
+	Offset int
+}
+
+// HRNotificationService notifies HR systems when users perform actions or take
+// on user statuses (sickness, holiday, travel, ...) that a rule maps to an
+// email or webhook. Every notification is logged, failed deliveries are
+// retried, and users may opt out of rules that allow it.
+type HRNotificationService struct {
+	db            *gorm.DB
+	config        *config.Config
+	notifications *NotificationService
+	translator    *Translator
+	stop          chan struct{}
+}
+
+// NewHRNotificationService creates the service and subscribes it to
+// action.performed and user_activity.recorded events on the bus. Rules without
+// their own templates use the default locale's.
+func NewHRNotificationService(db *gorm.DB, config *config.Config, bus *EventBus, notifications *NotificationService, translator *Translator) *HRNotificationService {
+	s := &HRNotificationService{
+		db:            db,
+		config:        config,
+		notifications: notifications,
+		translator:    translator,
+	}
+	bus.Subscribe(EventActionPerformed, s.handleActionPerformed)
+	bus.Subscribe(EventUserActivityRecorded, s.handleUserActivityRecorded)
+	return s
+}
+
+// CreateRule creates a new HR notification rule
+func (s *HRNotificationService) CreateRule(rule *database.HRNotificationRule) (*database.HRNotificationRule, error) {
+	if err := validateHRNotificationRule(rule, s.translator); err != nil {
+		return nil, err
+	}
+
+	active := rule.Active
+	rule.ID = uuid.New()
+	if err := s.db.Create(rule).Error; err != nil {
+		return nil, fmt.Errorf("failed to create HR notification rule: %w", err)
+	}
+
+	// Create skips zero values for columns with defaults, so an inactive rule needs an explicit update
+	if !active {
+		if err := s.db.Model(rule).Update("active", false).Error; err != nil {
+			return nil, fmt.Errorf("failed to create HR notification rule: %w", err)
+		}
+	}
+
+	return s.GetRuleByID(rule.ID)
+}
+
+// GetRuleByID retrieves an HR notification rule by ID
+func (s *HRNotificationService) GetRuleByID(id uuid.UUID) (*database.HRNotificationRule, error) {
+	var rule database.HRNotificationRule
+	if err := s.db.Where("id = ?", id).First(&rule).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "HR notification rule not found")
+		}
+		return nil, fmt.Errorf("failed to get HR notification rule: %w", err)
+	}
+	return &rule, nil
+}
+
+// ListRules retrieves the HR notification rules, optionally only active ones
+func (s *HRNotificationService) ListRules(activeOnly bool) ([]database.HRNotificationRule, error) {
+	query := s.db.Order("name")
+	if activeOnly {
+		query = query.Where("active = ?", true)
+	}
+	var rules []database.HRNotificationRule
+	if err := query.Find(&rules).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch HR notification rules: %w", err)
+	}
+	return rules, nil
+}
+
+// UpdateRule updates an HR notification rule. Disallowing opt-outs removes the
+// rule's existing opt-outs.
+func (s *HRNotificationService) UpdateRule(id uuid.UUID, updates map[string]interface{}) (*database.HRNotificationRule, error) {
+	rule, err := s.GetRuleByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate the rule as it will be after the update
+	updated := *rule
+	for column, field := range map[string]*string{
+		"name":             &updated.Name,
+		"trigger_type":     &updated.TriggerType,
+		"trigger_name":     &updated.TriggerName,
+		"channel":          &updated.Channel,
+		"target":           &updated.Target,
+		"subject_template": &updated.SubjectTemplate,
+		"body_template":    &updated.BodyTemplate,
+	} {
+		if v, ok := updates[column].(string); ok {
+			*field = v
+		}
+	}
+	if err := validateHRNotificationRule(&updated, s.translator); err != nil {
+		return nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&database.HRNotificationRule{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to update HR notification rule: %w", err)
+		}
+		if allow, ok := updates["allow_opt_out"].(bool); ok && !allow {
+			if err := tx.Where("rule_id = ?", id).Delete(&database.HRNotificationOptOut{}).Error; err != nil {
+				return fmt.Errorf("failed to remove opt-outs: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetRuleByID(id)
+}
+
+// DeleteRule permanently deletes an HR notification rule with its log and opt-outs
+func (s *HRNotificationService) DeleteRule(id uuid.UUID) error {
+	result := s.db.Where("id = ?", id).Delete(&database.HRNotificationRule{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete HR notification rule: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return NewError(CodeNotFound, "HR notification rule not found")
+	}
+	return nil
+}
+
+// validateHRNotificationRule checks a rule's trigger, that its target suits its
+// channel and that its templates parse as translator's messages would
+func validateHRNotificationRule(rule *database.HRNotificationRule, translator *Translator) error {
+	if strings.TrimSpace(rule.Name) == "" {
+		return NewError(CodeValidationFailed, "rule name is required")
+	}
+	if rule.TriggerType != HRTriggerAction && rule.TriggerType != HRTriggerStatus {
+		return NewError(CodeValidationFailed, "invalid trigger_type '%s'; use action or status", rule.TriggerType)
+	}
+	if strings.TrimSpace(rule.TriggerName) == "" {
+		return NewError(CodeValidationFailed, "trigger_name is required: the action name, or the user status name or type")
+	}
+	switch rule.Channel {
+	case "email":
+		if len(splitRecipients(rule.Target)) == 0 {
+			return NewError(CodeValidationFailed, "target must list at least one email recipient")
+		}
+	case "webhook":
+		if validateWebhookURL(rule.Target) != nil {
+			return NewError(CodeValidationFailed, "target must be an absolute http or https URL")
+		}
+	default:
+		return NewError(CodeValidationFailed, "invalid channel '%s'; use email or webhook", rule.Channel)
+	}
+	if _, err := translator.Parse("subject", rule.SubjectTemplate); err != nil {
+		return NewError(CodeValidationFailed, "invalid subject_template: %v", err)
+	}
+	if _, err := translator.Parse("body", rule.BodyTemplate); err != nil {
+		return NewError(CodeValidationFailed, "invalid body_template: %v", err)
+	}
+	return nil
+}
+
+// handleActionPerformed notifies the rules for a performed action
+func (s *HRNotificationService) handleActionPerformed(event Event) {
+	performed, ok := event.Data.(SideEffectEvent)
+	if !ok {
+		return
+	}
+	s.Notify(HRTriggerAction, []string{performed.Action}, performed.Action, performed.UserID, performed.OccurredAt, performed.Details)
+}
+
+// handleUserActivityRecorded notifies the rules for the status of a new activity
+func (s *HRNotificationService) handleUserActivityRecorded(event Event) {
+	recorded, ok := event.Data.(UserActivityRecorded)
+	if !ok {
+		return
+	}
+	s.Notify(HRTriggerStatus, []string{recorded.Status, recorded.StatusType}, recorded.Status, recorded.UserID, recorded.OccurredAt, recorded.Details)
+}
+
+// Notify logs and sends a notification for every active rule of triggerType
+// whose trigger_name is one of names, unless the user opted out of the rule.
+// triggerName is what the notification reports as having happened.
+func (s *HRNotificationService) Notify(triggerType string, names []string, triggerName string, userID uuid.UUID, occurredAt time.Time, details map[string]interface{}) {
+	var rules []database.HRNotificationRule
+	if err := s.db.Where("active = ? AND trigger_type = ? AND trigger_name IN ?", true, triggerType, names).Find(&rules).Error; err != nil {
+		log.Printf("Failed to load HR notification rules for %s %s: %v", triggerType, triggerName, err)
+		return
+	}
+	if len(rules) == 0 {
+		return
+	}
+
+	var user database.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		log.Printf("Failed to load user %s for HR notifications: %v", userID, err)
+		return
+	}
+
+	for i := range rules {
+		notification, err := s.createNotification(&rules[i], &user, triggerName, occurredAt, details)
+		if err != nil {
+			log.Printf("Failed to record HR notification for rule %s: %v", rules[i].Name, err)
+			continue
+		}
+		if notification.Status == HRNotificationPending {
+			s.deliver(notification)
+		}
+	}
+}
+
+// createNotification renders a rule's notification for a user and logs it,
+// as opted_out when the user opted out of the rule
+func (s *HRNotificationService) createNotification(rule *database.HRNotificationRule, user *database.User, triggerName string, occurredAt time.Time, details map[string]interface{}) (*database.HRNotification, error) {
+	notification := &database.HRNotification{
+		ID:          uuid.New(),
+		RuleID:      rule.ID,
+		UserID:      user.ID,
+		TriggerType: rule.TriggerType,
+		TriggerName: triggerName,
+		Channel:     rule.Channel,
+		Target:      rule.Target,
+		Status:      HRNotificationPending,
+	}
+
+	if rule.AllowOptOut {
+		var optOuts int64
+		if err := s.db.Model(&database.HRNotificationOptOut{}).Where("user_id = ? AND rule_id = ?", user.ID, rule.ID).Count(&optOuts).Error; err != nil {
+			return nil, fmt.Errorf("failed to check opt-outs: %w", err)
+		}
+		if optOuts > 0 {
+			notification.Status = HRNotificationOptedOut
+		}
+	}
+
+	data := HRNotificationData{
+		Rule:        rule.Name,
+		TriggerType: rule.TriggerType,
+		TriggerName: triggerName,
+		User:        hrNotificationUser(user),
+		OccurredAt:  occurredAt,
+		Details:     details,
+	}
+	subject, body, err := s.render(rule, data)
+	if err != nil {
+		notification.Status = HRNotificationFailed
+		notification.LastError = err.Error()
+	}
+	notification.Subject = subject
+	notification.Body = body
+	if err == nil && rule.Channel == "webhook" {
+		payload, err := json.Marshal(HRNotificationPayload{
+			NotificationID: notification.ID,
+			Rule:           rule.Name,
+			TriggerType:    rule.TriggerType,
+			TriggerName:    triggerName,
+			User:           data.User,
+			OccurredAt:     occurredAt,
+			Subject:        subject,
+			Message:        body,
+			Details:        details,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode webhook payload: %w", err)
+		}
+		notification.Body = string(payload)
+	}
+
+	if err := s.db.Create(notification).Error; err != nil {
+		return nil, err
+	}
+	return notification, nil
+}
+
+// render renders a rule's subject and body templates, falling back to the
+// default locale's for empty ones
+func (s *HRNotificationService) render(rule *database.HRNotificationRule, data HRNotificationData) (string, string, error) {
+	locale := s.translator.DefaultLocale()
+	templates := [2]*template.Template{
+		s.translator.Message(locale, "email.hr_notification.subject"),
+		s.translator.Message(locale, "email.hr_notification.body"),
+	}
+	for i, text := range []string{rule.SubjectTemplate, rule.BodyTemplate} {
+		if text == "" {
+			continue
+		}
+		tmpl, err := s.translator.Parse(rule.Name, text)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid template: %w", err)
+		}
+		templates[i] = tmpl
+	}
+
+	var rendered [2]strings.Builder
+	for i, tmpl := range templates {
+		if err := tmpl.Execute(&rendered[i], data); err != nil {
+			return "", "", fmt.Errorf("failed to render template: %w", err)
+		}
+	}
+	// Subjects are a single header line
+	subject := strings.Join(strings.Fields(rendered[0].String()), " ")
+	return subject, rendered[1].String(), nil
+}
+
+// hrNotificationUser describes a user for templates and webhook payloads
+func hrNotificationUser(user *database.User) HRNotificationUser {
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if name == "" {
+		name = user.Username
+	}
+	return HRNotificationUser{
+		ID:        user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Name:      name,
+	}
+}
+
+// deliver makes one delivery attempt. A failure schedules a retry after
+// retry_backoff, doubled for each earlier attempt, or marks the notification
+// failed once max_attempts is reached.
+func (s *HRNotificationService) deliver(notification *database.HRNotification) {
+	var err error
+	switch notification.Channel {
+	case "email":
+		err = s.notifications.SendEmail(splitRecipients(notification.Target), notification.Subject, notification.Body)
+	case "webhook":
+		var secret string
+		if rule, ruleErr := s.GetRuleByID(notification.RuleID); ruleErr == nil {
+			secret = rule.Secret
+		}
+		err = s.notifications.SendSignedWebhook(notification.Target, secret, json.RawMessage(notification.Body), map[string]string{
+			"X-YubiApp-Event":    "hr.notification",
+			"X-YubiApp-Delivery": notification.ID.String(),
+		})
+	default:
+		err = fmt.Errorf("unknown channel '%s'", notification.Channel)
+	}
+
+	notification.Attempts++
+	now := time.Now()
+	updates := map[string]interface{}{"attempts": notification.Attempts}
+	if err == nil {
+		notification.Status = HRNotificationSent
+		notification.SentAt = &now
+		notification.NextAttemptAt = nil
+		notification.LastError = ""
+	} else {
+		log.Printf("Failed to deliver HR notification %s (attempt %d): %v", notification.ID, notification.Attempts, err)
+		notification.LastError = err.Error()
+		if notification.Attempts >= s.config.HRNotifications.MaxAttempts {
+			notification.Status = HRNotificationFailed
+			notification.NextAttemptAt = nil
+		} else {
+			backoff := s.config.HRNotifications.RetryBackoff << (notification.Attempts - 1)
+			next := now.Add(backoff)
+			notification.Status = HRNotificationPending
+			notification.NextAttemptAt = &next
+		}
+	}
+	updates["status"] = notification.Status
+	updates["sent_at"] = notification.SentAt
+	updates["next_attempt_at"] = notification.NextAttemptAt
+	updates["last_error"] = notification.LastError
+
+	if err := s.db.Model(&database.HRNotification{}).Where("id = ?", notification.ID).Updates(updates).Error; err != nil {
+		log.Printf("Failed to record delivery of HR notification %s: %v", notification.ID, err)
+	}
+}
+
+// RetryDue delivers the pending notifications whose retry is due
+func (s *HRNotificationService) RetryDue(now time.Time) error {
+	var due []database.HRNotification
+	if err := s.db.Where("status = ? AND next_attempt_at <= ?", HRNotificationPending, now).Order("next_attempt_at").Find(&due).Error; err != nil {
+		return fmt.Errorf("failed to fetch HR notifications to retry: %w", err)
+	}
+	for i := range due {
+		s.deliver(&due[i])
+	}
+	return nil
+}
+
+// RetryNotification makes one more delivery attempt of a pending or failed notification now
+func (s *HRNotificationService) RetryNotification(id uuid.UUID) (*database.HRNotification, error) {
+	notification, err := s.GetNotificationByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if notification.Status != HRNotificationPending && notification.Status != HRNotificationFailed {
+		return nil, NewError(CodeConflict, "HR notification is %s and cannot be retried", notification.Status)
+	}
+	if notification.Subject == "" && notification.Body == "" {
+		return nil, NewError(CodeValidationFailed, "HR notification could not be rendered: %s", notification.LastError)
+	}
+
+	s.deliver(notification)
+	return s.GetNotificationByID(id)
+}
+
+// StartRetrier periodically retries failed deliveries.
+// It does nothing when hr_notifications.retry_interval is zero.
+func (s *HRNotificationService) StartRetrier() {
+	interval := s.config.HRNotifications.RetryInterval
+	if interval <= 0 || s.stop != nil {
+		return
+	}
+
+	s.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.RetryDue(time.Now()); err != nil {
+					log.Printf("HR notification retry failed: %v", err)
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopRetrier stops the background retrier
+func (s *HRNotificationService) StopRetrier() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// ListNotifications returns a page of matching notifications, newest first, and the total number of matches
+func (s *HRNotificationService) ListNotifications(filter HRNotificationFilter) ([]database.HRNotification, int64, error) {
+	query := s.db.Model(&database.HRNotification{})
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.RuleID != nil {
+		query = query.Where("rule_id = ?", *filter.RuleID)
+	}
+	if filter.UserID != nil {
+		query = query.Where("user_id = ?", *filter.UserID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count HR notifications: %w", err)
+	}
+
+	var notifications []database.HRNotification
+	if err := query.Preload("Rule").Preload("User").Order("created_at DESC").
+		Limit(filter.Limit).Offset(filter.Offset).Find(&notifications).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch HR notifications: %w", err)
+	}
+	return notifications, total, nil
+}
+
+// GetNotificationByID retrieves a logged HR notification by ID
+func (s *HRNotificationService) GetNotificationByID(id uuid.UUID) (*database.HRNotification, error) {
+	var notification database.HRNotification
+	if err := s.db.Preload("Rule").Preload("User").Where("id = ?", id).First(&notification).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "HR notification not found")
+		}
+		return nil, fmt.Errorf("failed to get HR notification: %w", err)
+	}
+	return &notification, nil
+}
+
+// ListOptOuts returns the rules a user has opted out of
+func (s *HRNotificationService) ListOptOuts(userID uuid.UUID) ([]database.HRNotificationRule, error) {
+	var rules []database.HRNotificationRule
+	err := s.db.Joins("JOIN hr_notification_opt_outs ON hr_notification_opt_outs.rule_id = hr_notification_rules.id").
+		Where("hr_notification_opt_outs.user_id = ?", userID).
+		Order("hr_notification_rules.name").
+		Find(&rules).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch opt-outs: %w", err)
+	}
+	return rules, nil
+}
+
+// OptOut opts a user out of a rule, which must allow opt-outs
+func (s *HRNotificationService) OptOut(userID, ruleID uuid.UUID) error {
+	rule, err := s.GetRuleByID(ruleID)
+	if err != nil {
+		return err
+	}
+	if !rule.AllowOptOut {
+		return NewError(CodeValidationFailed, "HR notification rule '%s' does not allow opt-outs", rule.Name)
+	}
+	var user database.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return NewError(CodeNotFound, "user not found")
+		}
+		return err
+	}
+
+	optOut := database.HRNotificationOptOut{UserID: userID, RuleID: ruleID}
+	if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&optOut).Error; err != nil {
+		return fmt.Errorf("failed to record opt-out: %w", err)
+	}
+	return nil
+}
+
+// OptIn removes a user's opt-out from a rule
+func (s *HRNotificationService) OptIn(userID, ruleID uuid.UUID) error {
+	result := s.db.Where("user_id = ? AND rule_id = ?", userID, ruleID).Delete(&database.HRNotificationOptOut{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to remove opt-out: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return NewError(CodeNotFound, "user has not opted out of this rule")
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package services
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/YubiApp/internal/config"
+	"golang.org/x/text/language"
+)
+
+// builtinCatalogs are the message catalogs compiled in, one <locale>.json
+// object of message key to text/template message per locale
+//
+//go:embed locales/*.json
+var builtinCatalogs embed.FS
+
+// referenceLocale has the complete built-in catalog, which messages missing
+// from both the requested and default locales' catalogs fall back to
+const referenceLocale = "en"
+
+// Translator writes error messages and emails in the user's language. Each
+// locale's catalog maps message keys, such as error.NOT_FOUND or
+// email.password_reset.subject, to text/template messages; a key missing from
+// a catalog falls back to the default locale's message, then to English.
+// Messages edited through /templates take precedence over the catalog of their
+// locale.
+type Translator struct {
+	defaultLocale string
+	locales       []string // Default locale first, then the rest sorted
+	messages      map[string]map[string]*template.Template
+	sources       map[string]map[string]string // Catalog text of each message
+	matcher       language.Matcher
+	funcs         template.FuncMap
+	overrides     func(locale, key string) *template.Template
+}
+
+// NewTranslator loads the built-in catalogs and then the <locale>.json files in
+// cfg.CatalogDir, which override built-in messages or add locales. A catalog
+// that cannot be read or has a malformed message, or a default locale without
+// a catalog, is an error.
+func NewTranslator(cfg config.I18nConfig) (*Translator, error) {
+	t := &Translator{
+		messages: map[string]map[string]*template.Template{},
+		sources:  map[string]map[string]string{},
+		funcs: template.FuncMap{
+			"brand":   func() config.BrandingConfig { return cfg.Branding },
+			"upper":   strings.ToUpper,
+			"percent": func(rate float64) string { return strconv.FormatFloat(rate*100, 'f', 1, 64) },
+		},
+	}
+
+	builtin, err := builtinCatalogs.ReadDir("locales")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read built-in catalogs: %w", err)
+	}
+	for _, entry := range builtin {
+		data, err := builtinCatalogs.ReadFile("locales/" + entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read built-in catalog %s: %w", entry.Name(), err)
+		}
+		if err := t.addCatalog(entry.Name(), data); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.CatalogDir != "" {
+		paths, err := filepath.Glob(filepath.Join(cfg.CatalogDir, "*.json"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list i18n.catalog_dir: %w", err)
+		}
+		for _, path := range paths {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read catalog %s: %w", path, err)
+			}
+			if err := t.addCatalog(filepath.Base(path), data); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	defaultTag, err := language.Parse(cfg.DefaultLocale)
+	if err != nil {
+		return nil, fmt.Errorf("invalid i18n.default_locale %q: %w", cfg.DefaultLocale, err)
+	}
+	t.defaultLocale = defaultTag.String()
+	if _, ok := t.messages[t.defaultLocale]; !ok {
+		return nil, fmt.Errorf("i18n.default_locale %s has no message catalog", t.defaultLocale)
+	}
+
+	// The matcher falls back to its first tag, so the default goes first
+	t.locales = []string{t.defaultLocale}
+	for locale := range t.messages {
+		if locale != t.defaultLocale {
+			t.locales = append(t.locales, locale)
+		}
+	}
+	sort.Strings(t.locales[1:])
+	tags := make([]language.Tag, len(t.locales))
+	for i, locale := range t.locales {
+		tags[i] = language.MustParse(locale)
+	}
+	t.matcher = language.NewMatcher(tags)
+	return t, nil
+}
+
+// addCatalog merges the catalog in file, named <locale>.json, into the messages
+func (t *Translator) addCatalog(file string, data []byte) error {
+	tag, err := language.Parse(strings.TrimSuffix(file, ".json"))
+	if err != nil {
+		return fmt.Errorf("catalog %s is not named after a locale: %w", file, err)
+	}
+	var catalog map[string]string
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return fmt.Errorf("invalid catalog %s: %w", file, err)
+	}
+
+	locale := tag.String()
+	if t.messages[locale] == nil {
+		t.messages[locale] = map[string]*template.Template{}
+		t.sources[locale] = map[string]string{}
+	}
+	for key, text := range catalog {
+		message, err := t.Parse(key, text)
+		if err != nil {
+			return fmt.Errorf("catalog %s: invalid message %s: %w", file, key, err)
+		}
+		t.messages[locale][key] = message
+		t.sources[locale][key] = text
+	}
+	return nil
+}
+
+// Parse parses a message, giving it the functions every message may use:
+// brand, which returns i18n.branding; upper; and percent, which writes a rate
+// such as 0.125 as 12.5
+func (t *Translator) Parse(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(t.funcs).Parse(text)
+}
+
+// SetOverrides installs the lookup of edited messages, consulted before each
+// locale's catalog. It is set once at startup, before messages are used.
+func (t *Translator) SetOverrides(overrides func(locale, key string) *template.Template) {
+	t.overrides = overrides
+}
+
+// Keys returns the sorted keys of the complete built-in catalog that start
+// with one of prefixes
+func (t *Translator) Keys(prefixes ...string) []string {
+	var keys []string
+	for key := range t.messages[referenceLocale] {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+				break
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Catalog returns the text of key in each locale's catalog, without edits
+func (t *Translator) Catalog(key string) map[string]string {
+	texts := map[string]string{}
+	for locale, sources := range t.sources {
+		if text, ok := sources[key]; ok {
+			texts[locale] = text
+		}
+	}
+	return texts
+}
+
+// DefaultLocale returns the locale used when no other matches
+func (t *Translator) DefaultLocale() string {
+	return t.defaultLocale
+}
+
+// Locales returns the locales with a catalog, the default first
+func (t *Translator) Locales() []string {
+	return t.locales
+}
+
+// Negotiate picks the locale to answer in: the supported locale closest to
+// preferred (a user's locale setting), else to the Accept-Language header,
+// else the default. Either may be empty.
+func (t *Translator) Negotiate(preferred, acceptLanguage string) string {
+	if preferred != "" {
+		if tag, err := language.Parse(preferred); err == nil {
+			if _, index, confidence := t.matcher.Match(tag); confidence != language.No {
+				return t.locales[index]
+			}
+		}
+	}
+	if acceptLanguage != "" {
+		if tags, _, err := language.ParseAcceptLanguage(acceptLanguage); err == nil && len(tags) > 0 {
+			if _, index, confidence := t.matcher.Match(tags...); confidence != language.No {
+				return t.locales[index]
+			}
+		}
+	}
+	return t.defaultLocale
+}
+
+// Message returns the template of key in locale, falling back to the default
+// locale and then English, each edited message before its catalog's; nil for
+// unknown keys
+func (t *Translator) Message(locale, key string) *template.Template {
+	for _, catalog := range []string{locale, t.defaultLocale, referenceLocale} {
+		if t.overrides != nil {
+			if message := t.overrides(catalog, key); message != nil {
+				return message
+			}
+		}
+		if message, ok := t.messages[catalog][key]; ok {
+			return message
+		}
+	}
+	return nil
+}
+
+// Translate renders key's message in locale with data. A message that is
+// missing or fails to render comes back as the key, so it shows up rather
+// than leaving a blank.
+func (t *Translator) Translate(locale, key string, data interface{}) string {
+	message := t.Message(locale, key)
+	if message == nil {
+		return key
+	}
+	var rendered strings.Builder
+	if err := message.Execute(&rendered, data); err != nil {
+		return key
+	}
+	return rendered.String()
+}
+
+// CheckLocale validates a user's locale setting, returning it in canonical
+// form, e.g. "pt-BR" for "pt-br". Empty clears the setting; anything that is
+// not a BCP 47 language tag is VALIDATION_FAILED. Locales without a catalog
+// are accepted, as catalogs may be added later, and match the closest one.
+func CheckLocale(locale string) (string, error) {
+	if locale == "" {
+		return "", nil
+	}
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return "", NewError(CodeValidationFailed, "locale %q is not a language tag such as en or pt-BR", locale)
+	}
+	return tag.String(), nil
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ImpersonatePermission is required to mint sessions that act as another user
+const ImpersonatePermission = "yubiapp:impersonate"
+
+// ImpersonationService lets support staff open sessions scoped to another user.
+// Each session carries both identities and is recorded for audit.
+type ImpersonationService struct {
+	db             *gorm.DB
+	sessionService *SessionService
+	authService    *AuthService
+}
+
+func NewImpersonationService(db *gorm.DB, sessionService *SessionService, authService *AuthService) *ImpersonationService {
+	return &ImpersonationService{
+		db:             db,
+		sessionService: sessionService,
+		authService:    authService,
+	}
+}
+
+// ImpersonationContext describes who is starting an impersonation and from where
+type ImpersonationContext struct {
+	Actor       *database.User
+	Device      *database.Device
+	Reason      string
+	ReadOnly    bool
+	IPAddress   string
+	UserAgent   string
+	Fingerprint string
+	RequestID   string
+}
+
+// StartImpersonation creates a session acting as subjectID for ctx.Actor. The
+// subject must be an active user other than the actor.
+func (s *ImpersonationService) StartImpersonation(subjectID uuid.UUID, ctx ImpersonationContext) (*database.Impersonation, *database.Session, error) {
+	if ctx.Reason == "" {
+		return nil, nil, NewError(CodeValidationFailed, "reason is required")
+	}
+	if subjectID == ctx.Actor.ID {
+		return nil, nil, NewError(CodeValidationFailed, "cannot impersonate yourself")
+	}
+
+	var subject database.User
+	if err := s.db.Preload("Roles").Where("id = ?", subjectID).First(&subject).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, NewError(CodeNotFound, "user not found")
+		}
+		return nil, nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if !subject.Active || !UserStateAllowsAuthentication(subject.State) {
+		return nil, nil, NewError(CodeConflict, "cannot impersonate an inactive user")
+	}
+
+	session, err := s.sessionService.CreateImpersonationSession(subject.ID, ctx.Device.ID, ctx.Actor.ID, ctx.ReadOnly, SessionClient{
+		UserAgent:   ctx.UserAgent,
+		IPAddress:   ctx.IPAddress,
+		Fingerprint: ctx.Fingerprint,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	impersonation := database.Impersonation{
+		ID:            uuid.New(),
+		SessionID:     session.ID,
+		ActorID:       ctx.Actor.ID,
+		ActorDeviceID: ctx.Device.ID,
+		SubjectUserID: subject.ID,
+		Reason:        ctx.Reason,
+		ReadOnly:      ctx.ReadOnly,
+		ExpiresAt:     session.ExpiresAt,
+		IPAddress:     ctx.IPAddress,
+		UserAgent:     ctx.UserAgent,
+	}
+	if err := s.db.Create(&impersonation).Error; err != nil {
+		s.sessionService.InvalidateSession(session.ID)
+		return nil, nil, fmt.Errorf("failed to record impersonation: %w", err)
+	}
+	// Create skips zero values for columns with defaults
+	if !ctx.ReadOnly {
+		if err := s.db.Model(&impersonation).Update("read_only", false).Error; err != nil {
+			s.sessionService.InvalidateSession(session.ID)
+			return nil, nil, fmt.Errorf("failed to record impersonation: %w", err)
+		}
+	}
+
+	s.authService.LogAuthentication(map[string]interface{}{
+		"user_id":    subject.ID,
+		"device_id":  ctx.Device.ID,
+		"type":       "login",
+		"success":    true,
+		"ip_address": ctx.IPAddress,
+		"user_agent": ctx.UserAgent,
+		"request_id": ctx.RequestID,
+		"details": map[string]interface{}{
+			"method":           "impersonation",
+			"impersonator_id":  ctx.Actor.ID,
+			"impersonator":     ctx.Actor.Username,
+			"impersonation_id": impersonation.ID,
+			"session_id":       session.ID,
+			"read_only":        ctx.ReadOnly,
+			"reason":           ctx.Reason,
+		},
+	})
+
+	impersonation.Actor = *ctx.Actor
+	impersonation.SubjectUser = subject
+	return &impersonation, session, nil
+}
+
+// ListActiveImpersonations retrieves impersonations whose sessions have neither
+// expired nor been ended, most recent first
+func (s *ImpersonationService) ListActiveImpersonations() ([]database.Impersonation, error) {
+	var impersonations []database.Impersonation
+	if err := s.db.Preload("Actor").Preload("SubjectUser").
+		Where("ended_at IS NULL AND expires_at > ?", time.Now()).
+		Order("created_at DESC").Find(&impersonations).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch impersonations: %w", err)
+	}
+	return impersonations, nil
+}
+
+// EndImpersonation invalidates an impersonation session before it expires. The
+// impersonation is recorded as ended only once its session is invalid.
+func (s *ImpersonationService) EndImpersonation(sessionID string, endedByID uuid.UUID) (*database.Impersonation, error) {
+	var impersonation database.Impersonation
+	if err := s.db.Where("session_id = ?", sessionID).First(&impersonation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "impersonation not found")
+		}
+		return nil, fmt.Errorf("failed to get impersonation: %w", err)
+	}
+	if impersonation.EndedAt != nil {
+		return nil, NewError(CodeConflict, "impersonation has already ended")
+	}
+
+	// The session may already have expired out of Redis
+	if err := s.sessionService.InvalidateSession(sessionID); err != nil && !errors.Is(err, ErrSessionNotFound) {
+		return nil, fmt.Errorf("failed to invalidate impersonation session: %w", err)
+	}
+
+	now := time.Now()
+	if err := s.db.Model(&impersonation).Updates(map[string]interface{}{
+		"ended_at":    now,
+		"ended_by_id": endedByID,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to end impersonation: %w", err)
+	}
+	impersonation.EndedAt = &now
+	impersonation.EndedByID = &endedByID
+	return &impersonation, nil
+}
@@ -0,0 +1,256 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+	"gorm.io/gorm"
+)
+
+// DefaultKioskActions are the actions a kiosk may perform when none are configured
+var DefaultKioskActions = []string{"user-signin", "user-signout"}
+
+// KioskService manages kiosks and verifies their client credentials
+type KioskService struct {
+	db *gorm.DB
+}
+
+func NewKioskService(db *gorm.DB) *KioskService {
+	return &KioskService{db: db}
+}
+
+// CreateKiosk creates a kiosk bound to a location and returns it with its client
+// secret. The secret is only stored hashed, so this is the only time it is available.
+func (s *KioskService) CreateKiosk(name string, locationID uuid.UUID, allowedActions []string, active bool) (*database.Kiosk, string, error) {
+	var location database.Location
+	if err := s.db.Where("id = ?", locationID).First(&location).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", NewError(CodeNotFound, "location not found")
+		}
+		return nil, "", fmt.Errorf("failed to get location: %w", err)
+	}
+
+	allowedActionsJSONB, err := s.kioskAllowedActionsJSONB(allowedActions)
+	if err != nil {
+		return nil, "", err
+	}
+
+	clientID, err := randomHex(16)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate client id: %w", err)
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate client secret: %w", err)
+	}
+
+	kiosk := database.Kiosk{
+		ID:             uuid.New(),
+		Name:           name,
+		LocationID:     locationID,
+		ClientID:       clientID,
+		SecretHash:     hashKioskSecret(secret),
+		AllowedActions: allowedActionsJSONB,
+		Active:         true,
+	}
+
+	if err := s.db.Create(&kiosk).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to create kiosk: %w", err)
+	}
+
+	// Create skips zero values for columns with defaults, so an inactive kiosk needs an explicit update
+	if !active {
+		if err := s.db.Model(&kiosk).Update("active", false).Error; err != nil {
+			return nil, "", fmt.Errorf("failed to create kiosk: %w", err)
+		}
+		kiosk.Active = false
+	}
+
+	kiosk.Location = location
+	return &kiosk, secret, nil
+}
+
+// GetKioskByID retrieves a kiosk by ID with its location
+func (s *KioskService) GetKioskByID(id uuid.UUID) (*database.Kiosk, error) {
+	var kiosk database.Kiosk
+	if err := s.db.Preload("Location").Where("id = ?", id).First(&kiosk).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "kiosk not found")
+		}
+		return nil, fmt.Errorf("failed to get kiosk: %w", err)
+	}
+	return &kiosk, nil
+}
+
+// ListKiosks retrieves all kiosks with their locations
+func (s *KioskService) ListKiosks() ([]database.Kiosk, error) {
+	var kiosks []database.Kiosk
+	if err := s.db.Preload("Location").Order("name").Find(&kiosks).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch kiosks: %w", err)
+	}
+	return kiosks, nil
+}
+
+// UpdateKiosk updates a kiosk; allowedActions replaces the whitelist when non-nil
+func (s *KioskService) UpdateKiosk(id uuid.UUID, updates map[string]interface{}, allowedActions []string) (*database.Kiosk, error) {
+	if _, err := s.GetKioskByID(id); err != nil {
+		return nil, err
+	}
+
+	if locationID, ok := updates["location_id"].(uuid.UUID); ok {
+		var location database.Location
+		if err := s.db.Where("id = ?", locationID).First(&location).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, NewError(CodeNotFound, "location not found")
+			}
+			return nil, fmt.Errorf("failed to get location: %w", err)
+		}
+	}
+	if allowedActions != nil {
+		allowedActionsJSONB, err := s.kioskAllowedActionsJSONB(allowedActions)
+		if err != nil {
+			return nil, err
+		}
+		updates["allowed_actions"] = allowedActionsJSONB
+	}
+
+	if err := s.db.Model(&database.Kiosk{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to update kiosk: %w", err)
+	}
+
+	return s.GetKioskByID(id)
+}
+
+// RotateKioskSecret issues a new client secret, invalidating the old one
+func (s *KioskService) RotateKioskSecret(id uuid.UUID) (*database.Kiosk, string, error) {
+	if _, err := s.GetKioskByID(id); err != nil {
+		return nil, "", err
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate client secret: %w", err)
+	}
+	if err := s.db.Model(&database.Kiosk{}).Where("id = ?", id).Update("secret_hash", hashKioskSecret(secret)).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to rotate kiosk secret: %w", err)
+	}
+
+	kiosk, err := s.GetKioskByID(id)
+	if err != nil {
+		return nil, "", err
+	}
+	return kiosk, secret, nil
+}
+
+// DeleteKiosk permanently deletes a kiosk
+func (s *KioskService) DeleteKiosk(id uuid.UUID) error {
+	result := s.db.Where("id = ?", id).Delete(&database.Kiosk{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete kiosk: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return NewError(CodeNotFound, "kiosk not found")
+	}
+	return nil
+}
+
+// AuthenticateKiosk verifies kiosk client credentials and returns the active kiosk with its location
+func (s *KioskService) AuthenticateKiosk(clientID, secret string) (*database.Kiosk, error) {
+	var kiosk database.Kiosk
+	if err := s.db.Preload("Location").Where("client_id = ?", clientID).First(&kiosk).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeAuthFailed, "invalid kiosk credentials")
+		}
+		return nil, fmt.Errorf("failed to get kiosk: %w", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(kiosk.SecretHash), []byte(hashKioskSecret(secret))) != 1 {
+		return nil, NewError(CodeAuthFailed, "invalid kiosk credentials")
+	}
+	if !kiosk.Active {
+		return nil, NewError(CodeAuthFailed, "kiosk is inactive")
+	}
+	if !kiosk.Location.Active {
+		return nil, NewError(CodeAuthFailed, "kiosk location '%s' is inactive", kiosk.Location.Name)
+	}
+
+	now := time.Now()
+	if err := s.db.Model(&kiosk).UpdateColumn("last_seen_at", now).Error; err == nil {
+		kiosk.LastSeenAt = &now
+	}
+	return &kiosk, nil
+}
+
+// KioskAllowsAction reports whether actionName is on the kiosk's whitelist
+func KioskAllowsAction(kiosk *database.Kiosk, actionName string) bool {
+	for _, allowed := range KioskAllowedActions(kiosk) {
+		if allowed == actionName {
+			return true
+		}
+	}
+	return false
+}
+
+// KioskAllowedActions returns the actions a kiosk may perform
+func KioskAllowedActions(kiosk *database.Kiosk) []string {
+	var allowedActions []string
+	if kiosk.AllowedActions.Status == pgtype.Present {
+		if err := kiosk.AllowedActions.AssignTo(&allowedActions); err != nil {
+			return nil
+		}
+	}
+	return allowedActions
+}
+
+// ParseKioskCredentials splits a "<client_id>:<client_secret>" credential
+func ParseKioskCredentials(credentials string) (clientID, secret string, ok bool) {
+	clientID, secret, ok = strings.Cut(credentials, ":")
+	if !ok || clientID == "" || secret == "" {
+		return "", "", false
+	}
+	return clientID, secret, true
+}
+
+// kioskAllowedActionsJSONB checks that every whitelisted action exists and converts the list to JSONB
+func (s *KioskService) kioskAllowedActionsJSONB(allowedActions []string) (pgtype.JSONB, error) {
+	var allowedActionsJSONB pgtype.JSONB
+	if len(allowedActions) == 0 {
+		allowedActions = DefaultKioskActions
+	}
+	for _, name := range allowedActions {
+		var count int64
+		if err := s.db.Model(&database.Action{}).Where("name = ?", name).Count(&count).Error; err != nil {
+			return allowedActionsJSONB, fmt.Errorf("failed to check action '%s': %w", name, err)
+		}
+		if count == 0 {
+			return allowedActionsJSONB, NewError(CodeValidationFailed, "action '%s' not found", name)
+		}
+	}
+	if err := allowedActionsJSONB.Set(allowedActions); err != nil {
+		return allowedActionsJSONB, fmt.Errorf("failed to convert allowed actions to JSONB: %w", err)
+	}
+	return allowedActionsJSONB, nil
+}
+
+// hashKioskSecret returns the hex SHA-256 of a kiosk client secret
+func hashKioskSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomHex returns n random bytes, hex encoded
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,440 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+	"gorm.io/gorm"
+)
+
+// Leave entry kinds
+const (
+	LeaveEntryTaken      = "taken"
+	LeaveEntryAdjustment = "adjustment"
+)
+
+// maxLeaveEntryDays is the most days one leave entry can hold (numeric(6,2))
+const maxLeaveEntryDays = 9999.99
+
+// ActionLeave makes an action take leave. It is read from the "leave" key of
+// Action.Details, e.g.
+//
+//	"leave": {"type": "vacation", "days": 1}
+//
+// Each performance takes days (1 when unset) off the user's balance of the
+// type for the current year in their timezone. Only actions with
+// "variable_days": true take the request's "leave_days" instead; others ignore
+// it. A balance that falls short refuses the action or only warns about it, as
+// the type's leave.types.<type>.insufficient setting says.
+type ActionLeave struct {
+	Type         string  `json:"type"`
+	Days         float64 `json:"days,omitempty"`
+	VariableDays bool    `json:"variable_days,omitempty"`
+}
+
+// ParseActionLeave reads and validates the leave an action takes. Returns nil
+// if the action takes none.
+func ParseActionLeave(action *database.Action) (*ActionLeave, error) {
+	if action.Details.Status != pgtype.Present {
+		return nil, nil
+	}
+	var details map[string]json.RawMessage
+	if err := json.Unmarshal(action.Details.Bytes, &details); err != nil {
+		return nil, fmt.Errorf("failed to read action details: %w", err)
+	}
+	return parseActionLeave(details["leave"])
+}
+
+// validateActionDetailsLeave validates the leave in a details map before it is saved
+func validateActionDetailsLeave(details map[string]interface{}) error {
+	raw, ok := details["leave"]
+	if !ok {
+		return nil
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("invalid leave: %w", err)
+	}
+	_, err = parseActionLeave(data)
+	return err
+}
+
+func parseActionLeave(data json.RawMessage) (*ActionLeave, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+	var leave ActionLeave
+	if err := decoder.Decode(&leave); err != nil {
+		return nil, fmt.Errorf("invalid leave: %w", err)
+	}
+	if leave.Type == "" {
+		return nil, fmt.Errorf("invalid leave: type is required")
+	}
+	if leave.Days < 0 || leave.Days > maxLeaveEntryDays {
+		return nil, fmt.Errorf("invalid leave: days must be between 0 and %g", maxLeaveEntryDays)
+	}
+	if leave.Days == 0 {
+		leave.Days = 1
+	}
+	return &leave, nil
+}
+
+// LeaveBalance is a user's leave of one type in a calendar year
+type LeaveBalance struct {
+	Type         string  `json:"type"`
+	Year         int     `json:"year"`
+	Accrual      string  `json:"accrual" enum:"yearly,monthly," doc:"Empty for a type no longer configured"`
+	AnnualDays   float64 `json:"annual_days" doc:"Entitlement for the whole year"`
+	Accrued      float64 `json:"accrued" doc:"Entitlement accrued so far; a twelfth per month begun when accrual is monthly"`
+	Adjusted     float64 `json:"adjusted" doc:"Days added, or removed when negative, by HR"`
+	Taken        float64 `json:"taken"`
+	Remaining    float64 `json:"remaining"`
+	Insufficient string  `json:"insufficient" enum:"block,warn," doc:"Empty for a type no longer configured"`
+}
+
+// LeaveCheck is the leave a leave action is about to take and whether the
+// balance covers it
+type LeaveCheck struct {
+	Type         string  `json:"type"`
+	Year         int     `json:"year"`
+	Days         float64 `json:"days"`
+	Remaining    float64 `json:"remaining" doc:"Balance left once the days are taken; negative when it falls short"`
+	Insufficient bool    `json:"insufficient" doc:"The balance fell short and the leave type's insufficient setting is warn"`
+	Blocked      bool    `json:"blocked"`
+	Message      string  `json:"message,omitempty"`
+}
+
+// LeaveAdjustment adds days to, or removes them from, a user's leave balance
+type LeaveAdjustment struct {
+	Type   string
+	Year   int
+	Days   float64 // Negative removes days
+	Reason string
+}
+
+// LeaveEntryFilter narrows the entries returned by ListEntries
+type LeaveEntryFilter struct {
+	UserID uuid.UUID
+	Type   string // All types when empty
+	Year   int    // All years when 0
+	Limit  int
+	Offset int
+}
+
+// LeaveService tracks users' leave balances per leave type and calendar year:
+// the configured accrual, less the days leave actions take, plus HR
+// adjustments. Every change is a leave entry, which makes the balance
+// auditable.
+type LeaveService struct {
+	db     *gorm.DB
+	config config.LeaveConfig
+}
+
+func NewLeaveService(db *gorm.DB, cfg *config.Config) *LeaveService {
+	return &LeaveService{db: db, config: cfg.Leave}
+}
+
+// GetBalances returns a user's balance of every configured leave type, and of
+// types no longer configured that still have entries, for a year (the current
+// one in the user's timezone when 0)
+func (s *LeaveService) GetBalances(userID uuid.UUID, year int, now time.Time) ([]LeaveBalance, error) {
+	return s.balances(s.db, userID, year, now)
+}
+
+// balances is GetBalances read through db
+func (s *LeaveService) balances(db *gorm.DB, userID uuid.UUID, year int, now time.Time) ([]LeaveBalance, error) {
+	user, err := s.getUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	now = now.In(loadTimezone(user.Timezone))
+	if year == 0 {
+		year = now.Year()
+	}
+
+	var rows []struct {
+		LeaveType string
+		Kind      string
+		Days      float64
+	}
+	if err := db.Model(&database.LeaveEntry{}).
+		Select("leave_type, kind, SUM(days) AS days").
+		Where("user_id = ? AND year = ?", userID, year).
+		Group("leave_type, kind").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to read leave entries: %w", err)
+	}
+
+	balances := map[string]*LeaveBalance{}
+	for name, leaveType := range s.config.Types {
+		balances[name] = &LeaveBalance{
+			Type:         name,
+			Year:         year,
+			Accrual:      leaveAccrual(leaveType),
+			AnnualDays:   leaveType.AnnualDays,
+			Accrued:      accruedLeave(leaveType, year, now),
+			Insufficient: leaveInsufficient(leaveType),
+		}
+	}
+	for _, row := range rows {
+		balance, ok := balances[row.LeaveType]
+		if !ok {
+			balance = &LeaveBalance{Type: row.LeaveType, Year: year}
+			balances[row.LeaveType] = balance
+		}
+		if row.Kind == LeaveEntryTaken {
+			balance.Taken += row.Days
+		} else {
+			balance.Adjusted += row.Days
+		}
+	}
+
+	result := make([]LeaveBalance, 0, len(balances))
+	for _, balance := range balances {
+		balance.Remaining = roundLeaveDays(balance.Accrued + balance.Adjusted - balance.Taken)
+		result = append(result, *balance)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Type < result[j].Type })
+	return result, nil
+}
+
+// CheckLeave works out the leave an action performed by a user takes and
+// whether their balance covers it. It returns nil for actions that take no
+// leave. The balance may change before the leave is recorded, so recordTaken
+// checks it again.
+func (s *LeaveService) CheckLeave(user *database.User, action *database.Action, requestBody map[string]interface{}, now time.Time) (*LeaveCheck, error) {
+	return s.checkLeave(s.db, user, action, requestBody, now)
+}
+
+// checkLeave is CheckLeave reading the balance through db
+func (s *LeaveService) checkLeave(db *gorm.DB, user *database.User, action *database.Action, requestBody map[string]interface{}, now time.Time) (*LeaveCheck, error) {
+	leave, days, err := actionLeaveDays(action, requestBody)
+	if err != nil || leave == nil {
+		return nil, err
+	}
+	leaveType, ok := s.config.Types[leave.Type]
+	if !ok {
+		return nil, fmt.Errorf("action '%s' is misconfigured: leave type '%s' is not in leave.types", action.Name, leave.Type)
+	}
+
+	year := now.In(loadTimezone(user.Timezone)).Year()
+	balances, err := s.balances(db, user.ID, year, now)
+	if err != nil {
+		return nil, err
+	}
+	var remaining float64
+	for _, balance := range balances {
+		if balance.Type == leave.Type {
+			remaining = balance.Remaining
+		}
+	}
+
+	check := &LeaveCheck{
+		Type:      leave.Type,
+		Year:      year,
+		Days:      days,
+		Remaining: roundLeaveDays(remaining - days),
+	}
+	if check.Remaining < 0 {
+		check.Insufficient = true
+		check.Blocked = leaveInsufficient(leaveType) == "block"
+		check.Message = fmt.Sprintf("Insufficient %s balance: %g days requested, %g left for %d", leave.Type, days, remaining, year)
+	}
+	return check, nil
+}
+
+// recordTaken records, through tx, the days a leave action takes under its
+// authentication log entry logID. Actions that take no leave record nothing.
+// The balance is checked again holding a lock on the user's leave of the type
+// until tx ends, so leave actions racing for the last days cannot both get
+// them.
+func (s *LeaveService) recordTaken(tx *gorm.DB, exec ActionExecution, logID uuid.UUID, now time.Time) error {
+	leave, _, err := actionLeaveDays(exec.Action, exec.RequestBody)
+	if err != nil || leave == nil {
+		return err
+	}
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "leave:"+exec.User.ID.String()+":"+leave.Type).Error; err != nil {
+		return fmt.Errorf("failed to lock leave balance: %w", err)
+	}
+	check, err := s.checkLeave(tx, exec.User, exec.Action, exec.RequestBody, now)
+	if err != nil {
+		return err
+	}
+	if check.Blocked {
+		return NewError(CodeConflict, "%s", check.Message)
+	}
+
+	entry := &database.LeaveEntry{
+		ID:        uuid.New(),
+		UserID:    exec.User.ID,
+		LeaveType: leave.Type,
+		Year:      check.Year,
+		Kind:      LeaveEntryTaken,
+		Days:      check.Days,
+		ActionID:  &exec.Action.ID,
+		AuthLogID: &logID,
+	}
+	if err := tx.Omit("User", "AdjustedBy").Create(entry).Error; err != nil {
+		return fmt.Errorf("failed to record leave taken: %w", err)
+	}
+	return nil
+}
+
+// AdjustBalance adds days to, or removes them from, a user's balance of a
+// leave type, recording who made the adjustment and why. adjustedByID is nil
+// for adjustments made from the CLI.
+func (s *LeaveService) AdjustBalance(userID uuid.UUID, adjustment LeaveAdjustment, adjustedByID *uuid.UUID) (*database.LeaveEntry, error) {
+	if _, ok := s.config.Types[adjustment.Type]; !ok {
+		return nil, NewError(CodeValidationFailed, "leave type '%s' is not tracked; configured types: %v", adjustment.Type, s.leaveTypes())
+	}
+	if adjustment.Year < 1000 || adjustment.Year > 9999 {
+		return nil, NewError(CodeValidationFailed, "year must be a four-digit year")
+	}
+	if adjustment.Days == 0 || math.Abs(adjustment.Days) > maxLeaveEntryDays {
+		return nil, NewError(CodeValidationFailed, "days must be non-zero and at most %g either way", maxLeaveEntryDays)
+	}
+	if strings.TrimSpace(adjustment.Reason) == "" {
+		return nil, NewError(CodeValidationFailed, "a reason is required")
+	}
+	if _, err := s.getUser(userID); err != nil {
+		return nil, err
+	}
+
+	entry := &database.LeaveEntry{
+		ID:           uuid.New(),
+		UserID:       userID,
+		LeaveType:    adjustment.Type,
+		Year:         adjustment.Year,
+		Kind:         LeaveEntryAdjustment,
+		Days:         roundLeaveDays(adjustment.Days),
+		Reason:       adjustment.Reason,
+		AdjustedByID: adjustedByID,
+	}
+	if err := s.db.Omit("User", "AdjustedBy").Create(entry).Error; err != nil {
+		return nil, fmt.Errorf("failed to adjust leave balance: %w", err)
+	}
+	if err := s.db.Preload("AdjustedBy").Where("id = ?", entry.ID).First(entry).Error; err != nil {
+		return nil, fmt.Errorf("failed to get leave entry: %w", err)
+	}
+	return entry, nil
+}
+
+// ListEntries retrieves a user's leave entries, newest first, with the total
+// matching the filter
+func (s *LeaveService) ListEntries(filter LeaveEntryFilter) ([]database.LeaveEntry, int64, error) {
+	if _, err := s.getUser(filter.UserID); err != nil {
+		return nil, 0, err
+	}
+
+	query := database.ReadReplica(s.db).Model(&database.LeaveEntry{}).Where("user_id = ?", filter.UserID)
+	if filter.Type != "" {
+		query = query.Where("leave_type = ?", filter.Type)
+	}
+	if filter.Year != 0 {
+		query = query.Where("year = ?", filter.Year)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count leave entries: %w", err)
+	}
+
+	var entries []database.LeaveEntry
+	query = query.Preload("AdjustedBy").Order("created_at DESC")
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit).Offset(filter.Offset)
+	}
+	if err := query.Find(&entries).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch leave entries: %w", err)
+	}
+	return entries, total, nil
+}
+
+func (s *LeaveService) getUser(userID uuid.UUID) (*database.User, error) {
+	var user database.User
+	if err := s.db.Select("id", "timezone").Where("id = ?", userID).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, NewError(CodeNotFound, "user not found")
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return &user, nil
+}
+
+// leaveTypes lists the configured leave types by name
+func (s *LeaveService) leaveTypes() []string {
+	names := make([]string, 0, len(s.config.Types))
+	for name := range s.config.Types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// actionLeaveDays returns the leave an action takes and how many days: the
+// request's "leave_days" when given to an action with variable days, else the
+// action's
+func actionLeaveDays(action *database.Action, requestBody map[string]interface{}) (*ActionLeave, float64, error) {
+	leave, err := ParseActionLeave(action)
+	if err != nil {
+		return nil, 0, fmt.Errorf("action '%s' is misconfigured: %w", action.Name, err)
+	}
+	if leave == nil {
+		return nil, 0, nil
+	}
+	days := leave.Days
+	if value, ok := requestBody["leave_days"]; ok && leave.VariableDays {
+		requested, ok := value.(float64)
+		if !ok || requested <= 0 || requested > maxLeaveEntryDays {
+			return nil, 0, NewError(CodeValidationFailed, "leave_days must be a number of days above 0 and at most %g", maxLeaveEntryDays)
+		}
+		days = roundLeaveDays(requested)
+	}
+	return leave, days, nil
+}
+
+// accruedLeave is the entitlement of a leave type accrued in year by now:
+// all of it for past years, none for future ones, and for the current year
+// all of it or, accrued monthly, a twelfth for each month begun
+func accruedLeave(leaveType config.LeaveTypeConfig, year int, now time.Time) float64 {
+	switch {
+	case year < now.Year():
+		return leaveType.AnnualDays
+	case year > now.Year():
+		return 0
+	case leaveAccrual(leaveType) == "monthly":
+		return roundLeaveDays(leaveType.AnnualDays * float64(now.Month()) / 12)
+	default:
+		return leaveType.AnnualDays
+	}
+}
+
+func leaveAccrual(leaveType config.LeaveTypeConfig) string {
+	if leaveType.Accrual == "" {
+		return "yearly"
+	}
+	return leaveType.Accrual
+}
+
+func leaveInsufficient(leaveType config.LeaveTypeConfig) string {
+	if leaveType.Insufficient == "" {
+		return "block"
+	}
+	return leaveType.Insufficient
+}
+
+// roundLeaveDays rounds to the hundredths of a day leave entries hold
+func roundLeaveDays(days float64) float64 {
+	return math.Round(days*100) / 100
+}
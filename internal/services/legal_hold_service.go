@@ -0,0 +1,195 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type LegalHoldService struct {
+	db *gorm.DB
+}
+
+func NewLegalHoldService(db *gorm.DB) *LegalHoldService {
+	return &LegalHoldService{db: db}
+}
+
+// LegalHoldExport is a read-only snapshot of the records covered by a hold
+type LegalHoldExport struct {
+	Hold                database.LegalHold             `json:"hold"`
+	ExportedAt          time.Time                      `json:"exported_at"`
+	AuthenticationLogs  []database.AuthenticationLog   `json:"authentication_logs"`
+	Activities          []database.UserActivityHistory `json:"activities"`
+	DeviceRegistrations []database.DeviceRegistration  `json:"device_registrations"`
+}
+
+// CreateLegalHold places a hold on a user, a date range, or a user within a date range
+func (s *LegalHoldService) CreateLegalHold(placedByID uuid.UUID, userID *uuid.UUID, from, to *time.Time, reason string) (*database.LegalHold, error) {
+	if reason == "" {
+		return nil, NewError(CodeValidationFailed, "reason is required")
+	}
+	if userID == nil && from == nil && to == nil {
+		return nil, NewError(CodeValidationFailed, "a legal hold must specify a user, a date range, or both")
+	}
+	if from != nil && to != nil && to.Before(*from) {
+		return nil, NewError(CodeValidationFailed, "to_datetime must not be before from_datetime")
+	}
+
+	if userID != nil {
+		var user database.User
+		if err := s.db.Unscoped().Where("id = ?", *userID).First(&user).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, NewError(CodeNotFound, "user not found")
+			}
+			return nil, fmt.Errorf("failed to get user: %w", err)
+		}
+	}
+
+	hold := database.LegalHold{
+		ID:           uuid.New(),
+		UserID:       userID,
+		FromDateTime: from,
+		ToDateTime:   to,
+		Reason:       reason,
+		PlacedByID:   placedByID,
+	}
+
+	if err := s.db.Create(&hold).Error; err != nil {
+		return nil, fmt.Errorf("failed to create legal hold: %w", err)
+	}
+
+	return s.GetLegalHoldByID(hold.ID)
+}
+
+// GetLegalHoldByID retrieves a legal hold by ID
+func (s *LegalHoldService) GetLegalHoldByID(id uuid.UUID) (*database.LegalHold, error) {
+	var hold database.LegalHold
+	if err := s.preload(s.db).Where("id = ?", id).First(&hold).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "legal hold not found")
+		}
+		return nil, fmt.Errorf("failed to fetch legal hold: %w", err)
+	}
+	return &hold, nil
+}
+
+// ListLegalHolds retrieves legal holds, optionally including released ones
+func (s *LegalHoldService) ListLegalHolds(includeReleased bool) ([]database.LegalHold, error) {
+	var holds []database.LegalHold
+	query := s.preload(s.db)
+	if !includeReleased {
+		query = query.Where("released_at IS NULL")
+	}
+	if err := query.Order("created_at DESC").Find(&holds).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch legal holds: %w", err)
+	}
+	return holds, nil
+}
+
+// ReleaseLegalHold releases an active hold, recording who released it and why
+func (s *LegalHoldService) ReleaseLegalHold(id, releasedByID uuid.UUID, reason string) (*database.LegalHold, error) {
+	hold, err := s.GetLegalHoldByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if hold.ReleasedAt != nil {
+		return nil, NewError(CodeConflict, "legal hold is already released")
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"released_at":    now,
+		"released_by_id": releasedByID,
+		"release_reason": reason,
+	}
+	if err := s.db.Model(&database.LegalHold{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to release legal hold: %w", err)
+	}
+
+	return s.GetLegalHoldByID(id)
+}
+
+// IsUserHeld reports whether any active hold names the user directly
+func (s *LegalHoldService) IsUserHeld(userID uuid.UUID) (bool, error) {
+	var count int64
+	if err := s.db.Model(&database.LegalHold{}).
+		Where("released_at IS NULL AND user_id = ?", userID).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check legal holds: %w", err)
+	}
+	return count > 0, nil
+}
+
+// ExcludeHeldRecords restricts a purge or anonymization query to rows that are not
+// under an active hold. userColumn and timeColumn are the (trusted) column names
+// holding the owning user ID and the record timestamp.
+func ExcludeHeldRecords(query *gorm.DB, userColumn, timeColumn string) *gorm.DB {
+	return query.Where(fmt.Sprintf(`NOT EXISTS (
+		SELECT 1 FROM legal_holds lh
+		WHERE lh.released_at IS NULL
+		AND (lh.user_id IS NULL OR lh.user_id = %[1]s)
+		AND (lh.from_datetime IS NULL OR lh.from_datetime <= %[2]s)
+		AND (lh.to_datetime IS NULL OR lh.to_datetime >= %[2]s)
+	)`, userColumn, timeColumn))
+}
+
+// ExportLegalHold returns the authentication logs, activities and device
+// registrations covered by a hold. The export is read-only.
+func (s *LegalHoldService) ExportLegalHold(id uuid.UUID) (*LegalHoldExport, error) {
+	hold, err := s.GetLegalHoldByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &LegalHoldExport{
+		Hold:       *hold,
+		ExportedAt: time.Now(),
+	}
+
+	logQuery := s.db.Order("created_at")
+	logQuery = s.scopeToHold(logQuery, hold, "user_id", "created_at")
+	if err := logQuery.Find(&export.AuthenticationLogs).Error; err != nil {
+		return nil, fmt.Errorf("failed to export authentication logs: %w", err)
+	}
+
+	activityQuery := s.db.Preload("Action").Preload("Location").Preload("Status").Order("from_datetime")
+	activityQuery = s.scopeToHold(activityQuery, hold, "user_id", "from_datetime")
+	if err := activityQuery.Find(&export.Activities).Error; err != nil {
+		return nil, fmt.Errorf("failed to export activities: %w", err)
+	}
+
+	registrationQuery := s.db.Order("created_at")
+	if hold.UserID != nil {
+		registrationQuery = registrationQuery.Where("registrar_user_id = ? OR target_user_id = ?", *hold.UserID, *hold.UserID)
+	}
+	registrationQuery = s.scopeToHold(registrationQuery, hold, "", "created_at")
+	if err := registrationQuery.Find(&export.DeviceRegistrations).Error; err != nil {
+		return nil, fmt.Errorf("failed to export device registrations: %w", err)
+	}
+
+	return export, nil
+}
+
+// scopeToHold limits a query to the user and date range of a hold
+func (s *LegalHoldService) scopeToHold(query *gorm.DB, hold *database.LegalHold, userColumn, timeColumn string) *gorm.DB {
+	if hold.UserID != nil && userColumn != "" {
+		query = query.Where(userColumn+" = ?", *hold.UserID)
+	}
+	if hold.FromDateTime != nil {
+		query = query.Where(timeColumn+" >= ?", *hold.FromDateTime)
+	}
+	if hold.ToDateTime != nil {
+		query = query.Where(timeColumn+" <= ?", *hold.ToDateTime)
+	}
+	return query
+}
+
+func (s *LegalHoldService) preload(query *gorm.DB) *gorm.DB {
+	return query.Preload("User", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Preload("PlacedBy", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Preload("ReleasedBy", func(db *gorm.DB) *gorm.DB { return db.Unscoped() })
+}
@@ -0,0 +1,313 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+)
+
+// Occupancy is computed from open activities: a user is present at the
+// location of their open activity when its status type is one of
+// activity.occupancy_status_types.
+
+// maxOccupancyPeriods caps the rows of an occupancy history per location
+const maxOccupancyPeriods = 24 * 93
+
+// ValidOccupancyIntervals lists the periods an occupancy history can be broken into
+var ValidOccupancyIntervals = []string{"hour", "day"}
+
+// LocationOccupant is a user present at a location
+type LocationOccupant struct {
+	UserID     uuid.UUID `json:"user_id"`
+	UserName   string    `json:"user_name"`
+	StatusName string    `json:"status_name"`
+	Since      time.Time `json:"since"`
+}
+
+// LocationOccupancy is who is at a location now against its capacity
+type LocationOccupancy struct {
+	LocationID   uuid.UUID          `json:"location_id"`
+	LocationName string             `json:"location_name"`
+	Occupancy    int                `json:"occupancy"`
+	Capacity     *int               `json:"capacity"`
+	CapacityMode string             `json:"capacity_mode" enum:"warn,block"`
+	Available    *int               `json:"available" doc:"Places left; null without a capacity"`
+	Full         bool               `json:"full"`
+	Occupants    []LocationOccupant `json:"occupants"`
+}
+
+// CapacityCheck reports a sign-in to a full location
+type CapacityCheck struct {
+	LocationID uuid.UUID `json:"location_id"`
+	Occupancy  int       `json:"occupancy"`
+	Capacity   int       `json:"capacity"`
+	Mode       string    `json:"mode" enum:"warn,block"`
+	Blocked    bool      `json:"blocked"`
+	Message    string    `json:"message"`
+}
+
+// OccupancyPeriod is a location's occupancy over one hour or day in the
+// location's timezone (UTC when unset)
+type OccupancyPeriod struct {
+	LocationID      uuid.UUID `json:"location_id"`
+	LocationName    string    `json:"location_name"`
+	PeriodStart     time.Time `json:"period_start"`
+	Peak            int       `json:"peak"`                       // Most people present at once
+	Average         float64   `json:"average"`                    // People present on average over the period
+	Capacity        *int      `json:"capacity"`                   // The location's capacity now
+	PeakUtilization *float64  `json:"peak_utilization,omitempty"` // Peak as a percentage of capacity
+}
+
+// OccupancyFilter selects the locations and period of an occupancy history
+type OccupancyFilter struct {
+	LocationIDs []uuid.UUID // Active locations when empty
+	From        time.Time
+	To          time.Time
+	Interval    string // "hour" or "day"
+}
+
+// occupancyInterval is an activity counted towards a location's occupancy
+type occupancyInterval struct {
+	LocationID   uuid.UUID
+	FromDatetime time.Time
+	ToDatetime   *time.Time
+}
+
+// GetOccupancy returns who is at a location now against its capacity
+func (s *LocationService) GetOccupancy(locationID uuid.UUID) (*LocationOccupancy, error) {
+	location, err := s.GetLocationByID(locationID)
+	if err != nil {
+		return nil, err // Missing locations are NOT_FOUND through gorm.ErrRecordNotFound
+	}
+	occupants, err := s.occupants(location.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	occupancy := &LocationOccupancy{
+		LocationID:   location.ID,
+		LocationName: location.Name,
+		Occupancy:    len(occupants),
+		Capacity:     location.Capacity,
+		CapacityMode: location.CapacityMode,
+		Occupants:    occupants,
+	}
+	if location.Capacity != nil {
+		available := max(*location.Capacity-len(occupants), 0)
+		occupancy.Available = &available
+		occupancy.Full = available == 0
+	}
+	return occupancy, nil
+}
+
+// CheckCapacity checks whether a user may sign in to a location. It returns
+// nil when the location has room, has no capacity or already counts the
+// user; otherwise the check says whether the sign-in is blocked or only
+// warned about. Sign-ins racing for the last place may both get it.
+func (s *LocationService) CheckCapacity(location *database.Location, userID uuid.UUID) (*CapacityCheck, error) {
+	if location.Capacity == nil {
+		return nil, nil
+	}
+	occupants, err := s.occupants(location.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(occupants) < *location.Capacity {
+		return nil, nil
+	}
+	for _, occupant := range occupants {
+		if occupant.UserID == userID {
+			return nil, nil
+		}
+	}
+
+	return &CapacityCheck{
+		LocationID: location.ID,
+		Occupancy:  len(occupants),
+		Capacity:   *location.Capacity,
+		Mode:       location.CapacityMode,
+		Blocked:    location.CapacityMode == "block",
+		Message:    fmt.Sprintf("Location '%s' is full (%d of %d places taken)", location.Name, len(occupants), *location.Capacity),
+	}, nil
+}
+
+// occupants returns the users present at a location, longest present first.
+// A user with several open activities there is listed once.
+func (s *LocationService) occupants(locationID uuid.UUID) ([]LocationOccupant, error) {
+	var rows []struct {
+		UserID       uuid.UUID
+		UserName     string
+		StatusName   string
+		FromDatetime time.Time
+	}
+	err := s.db.Raw(`
+		SELECT uah.user_id, CONCAT(u.first_name, ' ', u.last_name) AS user_name,
+			COALESCE(us.name, '') AS status_name, uah.from_datetime
+		FROM user_activity_history uah
+		JOIN users u ON u.id = uah.user_id AND u.deleted_at IS NULL
+		LEFT JOIN user_statuses us ON us.id = uah.status_id
+		WHERE uah.location_id = ? AND uah.to_datetime IS NULL AND COALESCE(us.type, 'other') IN ?
+		ORDER BY uah.from_datetime
+	`, locationID, s.occupancyStatusTypes).Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to read location occupants: %w", err)
+	}
+
+	occupants := []LocationOccupant{}
+	seen := make(map[uuid.UUID]bool, len(rows))
+	for _, row := range rows {
+		if seen[row.UserID] {
+			continue
+		}
+		seen[row.UserID] = true
+		occupants = append(occupants, LocationOccupant{
+			UserID:     row.UserID,
+			UserName:   row.UserName,
+			StatusName: row.StatusName,
+			Since:      row.FromDatetime,
+		})
+	}
+	return occupants, nil
+}
+
+// GetOccupancyHistory returns each location's peak and average occupancy in
+// every hour or day of the period, ordered by location name and time. Hours
+// and days are the location's; activities still open count up to now.
+func (s *LocationService) GetOccupancyHistory(filter OccupancyFilter) ([]OccupancyPeriod, error) {
+	if !filter.To.After(filter.From) {
+		return nil, NewError(CodeValidationFailed, "'to' must be after 'from'")
+	}
+	step := time.Hour
+	switch filter.Interval {
+	case "hour":
+	case "day":
+		step = 24 * time.Hour
+	default:
+		return nil, NewError(CodeValidationFailed, "interval must be one of: %v", ValidOccupancyIntervals)
+	}
+	if filter.To.Sub(filter.From) > time.Duration(maxOccupancyPeriods)*step {
+		return nil, NewError(CodeValidationFailed, "period covers more than %d %ss; use a shorter period or a longer interval", maxOccupancyPeriods, filter.Interval)
+	}
+
+	db := database.ReadReplica(s.db)
+	var locations []database.Location
+	query := db.Order("name")
+	if len(filter.LocationIDs) > 0 {
+		query = query.Where("id IN ?", filter.LocationIDs)
+	} else {
+		query = query.Where("active = ?", true)
+	}
+	if err := query.Find(&locations).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch locations: %w", err)
+	}
+	if len(locations) == 0 {
+		return []OccupancyPeriod{}, nil
+	}
+	ids := make([]uuid.UUID, len(locations))
+	for i := range locations {
+		ids[i] = locations[i].ID
+	}
+
+	var intervals []occupancyInterval
+	err := db.Raw(`
+		SELECT uah.location_id, uah.from_datetime, uah.to_datetime
+		FROM user_activity_history uah
+		LEFT JOIN user_statuses us ON us.id = uah.status_id
+		WHERE uah.location_id IN ? AND uah.from_datetime < ? AND (uah.to_datetime IS NULL OR uah.to_datetime > ?)
+			AND COALESCE(us.type, 'other') IN ?
+	`, ids, filter.To, filter.From, s.occupancyStatusTypes).Scan(&intervals).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to read location activity: %w", err)
+	}
+	byLocation := make(map[uuid.UUID][]occupancyInterval, len(locations))
+	for _, interval := range intervals {
+		byLocation[interval.LocationID] = append(byLocation[interval.LocationID], interval)
+	}
+
+	now := time.Now()
+	periods := []OccupancyPeriod{}
+	for i := range locations {
+		periods = append(periods, locationOccupancyHistory(&locations[i], byLocation[locations[i].ID], filter, now)...)
+	}
+	return periods, nil
+}
+
+// occupancyEvent is a change in a location's occupancy
+type occupancyEvent struct {
+	At    time.Time
+	Delta int
+}
+
+// locationOccupancyHistory sweeps a location's arrivals and departures
+// through the hours or days of the filter's period
+func locationOccupancyHistory(location *database.Location, intervals []occupancyInterval, filter OccupancyFilter, now time.Time) []OccupancyPeriod {
+	events := make([]occupancyEvent, 0, 2*len(intervals))
+	for _, interval := range intervals {
+		end := now
+		if interval.ToDatetime != nil {
+			end = *interval.ToDatetime
+		}
+		start, end := maxTime(interval.FromDatetime, filter.From), minTime(end, filter.To)
+		if end.After(start) {
+			events = append(events, occupancyEvent{start, 1}, occupancyEvent{end, -1})
+		}
+	}
+	// Departures go before arrivals at the same time, so a handover is not a peak
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].At.Equal(events[j].At) {
+			return events[i].Delta < events[j].Delta
+		}
+		return events[i].At.Before(events[j].At)
+	})
+
+	loc := loadTimezone(location.Timezone)
+	local := filter.From.In(loc)
+	periodStart := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	if filter.Interval == "hour" {
+		periodStart = time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), 0, 0, 0, loc)
+	}
+
+	periods := []OccupancyPeriod{}
+	count, next := 0, 0
+	for periodStart.Before(filter.To) {
+		periodEnd := periodStart.AddDate(0, 0, 1)
+		if filter.Interval == "hour" {
+			periodEnd = periodStart.Add(time.Hour)
+		}
+		start, end := maxTime(periodStart, filter.From), minTime(periodEnd, filter.To)
+
+		for next < len(events) && !events[next].At.After(start) {
+			count += events[next].Delta
+			next++
+		}
+		peak, cursor, presence := count, start, 0.0
+		for next < len(events) && events[next].At.Before(end) {
+			presence += float64(count) * events[next].At.Sub(cursor).Hours()
+			cursor = events[next].At
+			count += events[next].Delta
+			peak = max(peak, count)
+			next++
+		}
+		presence += float64(count) * end.Sub(cursor).Hours()
+
+		period := OccupancyPeriod{
+			LocationID:   location.ID,
+			LocationName: location.Name,
+			PeriodStart:  periodStart,
+			Peak:         peak,
+			Average:      roundHours(presence / end.Sub(start).Hours()),
+			Capacity:     location.Capacity,
+		}
+		if location.Capacity != nil {
+			utilization := math.Round(float64(peak)*1000/float64(*location.Capacity)) / 10
+			period.PeakUtilization = &utilization
+		}
+		periods = append(periods, period)
+		periodStart = periodEnd
+	}
+	return periods
+}
@@ -1,23 +1,53 @@
 package services
 
 import (
+	"errors"
 	"fmt"
+	"net"
+	"strings"
 
+	"github.com/YubiApp/internal/config"
 	"github.com/YubiApp/internal/database"
 	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
 	"gorm.io/gorm"
 )
 
+// LocationBounds holds the optional geofence and network ranges that place a
+// user at a location, the location's timezone and country and how many
+// people it holds
+type LocationBounds struct {
+	Latitude     *float64
+	Longitude    *float64
+	RadiusMeters *float64
+	Networks     []string
+	Timezone     string // IANA name; empty uses each user's own
+	Country      string // ISO 3166-1 alpha-2 code whose holidays apply; empty uses holidays.default_country
+	Capacity     *int   // Nil for no limit
+	CapacityMode string // "warn" (the default) or "block"
+}
+
+// ValidCapacityModes lists what happens on signing in to a full location
+var ValidCapacityModes = []string{"warn", "block"}
+
 type LocationService struct {
 	db *gorm.DB
+
+	// Status types of open activities that count a user as present
+	occupancyStatusTypes []string
 }
 
-func NewLocationService(db *gorm.DB) *LocationService {
-	return &LocationService{db: db}
+func NewLocationService(db *gorm.DB, cfg config.ActivityConfig) *LocationService {
+	return &LocationService{db: db, occupancyStatusTypes: cfg.OccupancyStatusTypes}
 }
 
 // CreateLocation creates a new location
 func (s *LocationService) CreateLocation(name, description, address, locationType string, active bool) (*database.Location, error) {
+	return s.CreateLocationWithBounds(name, description, address, locationType, active, LocationBounds{})
+}
+
+// CreateLocationWithBounds creates a new location with an optional geofence and network ranges
+func (s *LocationService) CreateLocationWithBounds(name, description, address, locationType string, active bool, bounds LocationBounds) (*database.Location, error) {
 	// Validate location type
 	validTypes := []string{"office", "home", "event", "other"}
 	validType := false
@@ -28,17 +58,47 @@ func (s *LocationService) CreateLocation(name, description, address, locationTyp
 		}
 	}
 	if !validType {
-		return nil, fmt.Errorf("location type must be one of: %v", validTypes)
+		return nil, NewError(CodeValidationFailed, "location type must be one of: %v", validTypes)
 	}
 
 	location := database.Location{
-		ID:          uuid.New(),
-		Name:        name,
-		Description: description,
-		Address:     address,
-		Type:        locationType,
-		Active:      active,
+		ID:           uuid.New(),
+		Name:         name,
+		Description:  description,
+		Address:      address,
+		Type:         locationType,
+		Active:       active,
+		Latitude:     bounds.Latitude,
+		Longitude:    bounds.Longitude,
+		RadiusMeters: bounds.RadiusMeters,
+		Timezone:     bounds.Timezone,
+		Country:      bounds.Country,
+		Capacity:     bounds.Capacity,
+		CapacityMode: bounds.CapacityMode,
+	}
+	if location.CapacityMode == "" {
+		location.CapacityMode = "warn"
+	}
+
+	if err := validateLocationGeofence(&location, nil); err != nil {
+		return nil, err
+	}
+	if err := validateLocationCapacity(location.Capacity, location.CapacityMode); err != nil {
+		return nil, err
 	}
+	if err := CheckTimezone(location.Timezone); err != nil {
+		return nil, err
+	}
+	country, err := NormalizeCountry(location.Country)
+	if err != nil {
+		return nil, err
+	}
+	location.Country = country
+	networks, err := cidrNetworksJSONB(bounds.Networks)
+	if err != nil {
+		return nil, err
+	}
+	location.Networks = networks
 
 	if err := s.db.Create(&location).Error; err != nil {
 		return nil, fmt.Errorf("failed to create location: %w", err)
@@ -51,7 +111,10 @@ func (s *LocationService) CreateLocation(name, description, address, locationTyp
 func (s *LocationService) GetLocationByID(locationID uuid.UUID) (*database.Location, error) {
 	var location database.Location
 	if err := s.db.Where("id = ?", locationID).First(&location).Error; err != nil {
-		return nil, fmt.Errorf("location not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "location not found")
+		}
+		return nil, fmt.Errorf("failed to get location: %w", err)
 	}
 	return &location, nil
 }
@@ -60,7 +123,10 @@ func (s *LocationService) GetLocationByID(locationID uuid.UUID) (*database.Locat
 func (s *LocationService) GetLocationByName(name string) (*database.Location, error) {
 	var location database.Location
 	if err := s.db.Where("name = ?", name).First(&location).Error; err != nil {
-		return nil, fmt.Errorf("location not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "location not found")
+		}
+		return nil, fmt.Errorf("failed to get location: %w", err)
 	}
 	return &location, nil
 }
@@ -68,7 +134,7 @@ func (s *LocationService) GetLocationByName(name string) (*database.Location, er
 // ListLocations retrieves all locations
 func (s *LocationService) ListLocations() ([]database.Location, error) {
 	var locations []database.Location
-	if err := s.db.Find(&locations).Error; err != nil {
+	if err := database.ReadReplica(s.db).Find(&locations).Error; err != nil {
 		return nil, fmt.Errorf("failed to fetch locations: %w", err)
 	}
 	return locations, nil
@@ -77,7 +143,7 @@ func (s *LocationService) ListLocations() ([]database.Location, error) {
 // ListActiveLocations retrieves only active locations
 func (s *LocationService) ListActiveLocations() ([]database.Location, error) {
 	var locations []database.Location
-	if err := s.db.Where("active = ?", true).Find(&locations).Error; err != nil {
+	if err := database.ReadReplica(s.db).Where("active = ?", true).Find(&locations).Error; err != nil {
 		return nil, fmt.Errorf("failed to fetch active locations: %w", err)
 	}
 	return locations, nil
@@ -86,17 +152,24 @@ func (s *LocationService) ListActiveLocations() ([]database.Location, error) {
 // ListLocationsByType retrieves locations by type
 func (s *LocationService) ListLocationsByType(locationType string) ([]database.Location, error) {
 	var locations []database.Location
-	if err := s.db.Where("type = ?", locationType).Find(&locations).Error; err != nil {
+	if err := database.ReadReplica(s.db).Where("type = ?", locationType).Find(&locations).Error; err != nil {
 		return nil, fmt.Errorf("failed to fetch locations by type: %w", err)
 	}
 	return locations, nil
 }
 
-// UpdateLocation updates a location
-func (s *LocationService) UpdateLocation(locationID uuid.UUID, updates map[string]interface{}) (*database.Location, error) {
+// UpdateLocation updates a location. A non-nil version must match the
+// location's current version.
+func (s *LocationService) UpdateLocation(locationID uuid.UUID, version *int, updates map[string]interface{}) (*database.Location, error) {
 	var location database.Location
 	if err := s.db.Where("id = ?", locationID).First(&location).Error; err != nil {
-		return nil, fmt.Errorf("location not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "location not found")
+		}
+		return nil, fmt.Errorf("failed to get location: %w", err)
+	}
+	if err := checkVersion("location", location.Version, version); err != nil {
+		return nil, err
 	}
 
 	// Validate location type if it's being updated
@@ -110,11 +183,45 @@ func (s *LocationService) UpdateLocation(locationID uuid.UUID, updates map[strin
 			}
 		}
 		if !validType {
-			return nil, fmt.Errorf("location type must be one of: %v", validTypes)
+			return nil, NewError(CodeValidationFailed, "location type must be one of: %v", validTypes)
 		}
 	}
 
-	if err := s.db.Model(&location).Updates(updates).Error; err != nil {
+	// Validate the geofence as it will be after the update
+	if err := validateLocationGeofence(&location, updates); err != nil {
+		return nil, err
+	}
+	if networks, ok := updates["networks"].([]string); ok {
+		networksJSONB, err := cidrNetworksJSONB(networks)
+		if err != nil {
+			return nil, err
+		}
+		updates["networks"] = networksJSONB
+	}
+	if tz, ok := updates["timezone"].(string); ok {
+		if err := CheckTimezone(tz); err != nil {
+			return nil, err
+		}
+	}
+	if country, ok := updates["country"].(string); ok {
+		normalized, err := NormalizeCountry(country)
+		if err != nil {
+			return nil, err
+		}
+		updates["country"] = normalized
+	}
+	capacity, capacityMode := location.Capacity, location.CapacityMode
+	if value, ok := updates["capacity"]; ok {
+		capacity, _ = value.(*int)
+	}
+	if mode, ok := updates["capacity_mode"].(string); ok {
+		capacityMode = mode
+	}
+	if err := validateLocationCapacity(capacity, capacityMode); err != nil {
+		return nil, err
+	}
+
+	if err := updateVersioned(s.db, "location", &location, location.Version, updates); err != nil {
 		return nil, fmt.Errorf("failed to update location: %w", err)
 	}
 
@@ -130,7 +237,10 @@ func (s *LocationService) UpdateLocation(locationID uuid.UUID, updates map[strin
 func (s *LocationService) DeleteLocation(locationID uuid.UUID) error {
 	var location database.Location
 	if err := s.db.Where("id = ?", locationID).First(&location).Error; err != nil {
-		return fmt.Errorf("location not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return NewError(CodeNotFound, "location not found")
+		}
+		return fmt.Errorf("failed to get location: %w", err)
 	}
 
 	// Soft delete by setting active to false
@@ -145,7 +255,10 @@ func (s *LocationService) DeleteLocation(locationID uuid.UUID) error {
 func (s *LocationService) HardDeleteLocation(locationID uuid.UUID) error {
 	var location database.Location
 	if err := s.db.Where("id = ?", locationID).First(&location).Error; err != nil {
-		return fmt.Errorf("location not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return NewError(CodeNotFound, "location not found")
+		}
+		return fmt.Errorf("failed to get location: %w", err)
 	}
 
 	if err := s.db.Delete(&location).Error; err != nil {
@@ -153,4 +266,141 @@ func (s *LocationService) HardDeleteLocation(locationID uuid.UUID) error {
 	}
 
 	return nil
-} 
\ No newline at end of file
+}
+
+// validateLocationGeofence checks that latitude, longitude and radius_meters are
+// either all set or all cleared, and within range
+func validateLocationGeofence(location *database.Location, updates map[string]interface{}) error {
+	latitude, longitude, radius := location.Latitude, location.Longitude, location.RadiusMeters
+	for key, target := range map[string]**float64{"latitude": &latitude, "longitude": &longitude, "radius_meters": &radius} {
+		value, ok := updates[key]
+		if !ok {
+			continue
+		}
+		switch v := value.(type) {
+		case *float64:
+			*target = v
+		case float64:
+			*target = &v
+		case nil:
+			*target = nil
+		}
+	}
+
+	if latitude == nil && longitude == nil && radius == nil {
+		return nil
+	}
+	if latitude == nil || longitude == nil || radius == nil {
+		return NewError(CodeValidationFailed, "latitude, longitude and radius_meters must be set together")
+	}
+	if *latitude < -90 || *latitude > 90 {
+		return NewError(CodeValidationFailed, "latitude must be between -90 and 90")
+	}
+	if *longitude < -180 || *longitude > 180 {
+		return NewError(CodeValidationFailed, "longitude must be between -180 and 180")
+	}
+	if *radius <= 0 {
+		return NewError(CodeValidationFailed, "radius_meters must be greater than 0")
+	}
+	return nil
+}
+
+// validateLocationCapacity checks a location's capacity and what happens when it is full
+func validateLocationCapacity(capacity *int, mode string) error {
+	if capacity != nil && *capacity <= 0 {
+		return NewError(CodeValidationFailed, "capacity must be greater than 0")
+	}
+	for _, valid := range ValidCapacityModes {
+		if mode == valid {
+			return nil
+		}
+	}
+	return NewError(CodeValidationFailed, "capacity_mode must be one of: %v", ValidCapacityModes)
+}
+
+// ResolveLocationByIP returns the active location whose network ranges contain ip.
+// When several ranges match, the most specific (longest prefix) wins. Returns nil if none match.
+func (s *LocationService) ResolveLocationByIP(ip string) (*database.Location, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return nil, nil
+	}
+
+	locations, err := s.ListActiveLocations()
+	if err != nil {
+		return nil, err
+	}
+
+	var match *database.Location
+	bestPrefix := -1
+	for i := range locations {
+		for _, network := range LocationNetworks(&locations[i]) {
+			_, ipNet, err := net.ParseCIDR(network)
+			if err != nil || !ipNet.Contains(parsed) {
+				continue
+			}
+			if prefix, _ := ipNet.Mask.Size(); prefix > bestPrefix {
+				bestPrefix = prefix
+				match = &locations[i]
+			}
+		}
+	}
+	return match, nil
+}
+
+// IsOfficeIP reports whether ip falls within the network ranges of any active office location.
+// configured is false when no office declares network ranges, in which case no judgement can be made.
+func (s *LocationService) IsOfficeIP(ip string) (inOffice bool, configured bool, err error) {
+	parsed := net.ParseIP(ip)
+
+	offices, err := s.ListLocationsByType("office")
+	if err != nil {
+		return false, false, err
+	}
+
+	for i := range offices {
+		if !offices[i].Active {
+			continue
+		}
+		for _, network := range LocationNetworks(&offices[i]) {
+			_, ipNet, err := net.ParseCIDR(network)
+			if err != nil {
+				continue
+			}
+			configured = true
+			if parsed != nil && ipNet.Contains(parsed) {
+				return true, true, nil
+			}
+		}
+	}
+	return false, configured, nil
+}
+
+// LocationNetworks returns the CIDR ranges declared for a location
+func LocationNetworks(location *database.Location) []string {
+	var networks []string
+	if location.Networks.Status == pgtype.Present {
+		if err := location.Networks.AssignTo(&networks); err != nil {
+			return nil
+		}
+	}
+	return networks
+}
+
+// cidrNetworksJSONB validates CIDR ranges, of locations or resources, and
+// converts them to JSONB
+func cidrNetworksJSONB(networks []string) (pgtype.JSONB, error) {
+	var networksJSONB pgtype.JSONB
+	normalized := make([]string, 0, len(networks))
+	for _, network := range networks {
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(network))
+		if err != nil {
+			return networksJSONB, NewError(CodeValidationFailed, "invalid network range '%s': must be CIDR notation like 10.0.0.0/24", network)
+		}
+		normalized = append(normalized, ipNet.String())
+	}
+	if err := networksJSONB.Set(normalized); err != nil {
+		return networksJSONB, fmt.Errorf("failed to convert networks to JSONB: %w", err)
+	}
+	return networksJSONB, nil
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// LoginNotificationService remembers the devices and IP addresses each user
+// signs in from and emails the user when a sign-in comes from one not seen
+// before. A user's first sign-in only seeds what is known. Every email, sent
+// or not, is recorded in the login notification log.
+type LoginNotificationService struct {
+	db            *gorm.DB
+	config        config.LoginNotificationsConfig
+	notifications *NotificationService
+	translator    *Translator
+}
+
+func NewLoginNotificationService(db *gorm.DB, cfg config.LoginNotificationsConfig, notifications *NotificationService, translator *Translator) *LoginNotificationService {
+	return &LoginNotificationService{
+		db:            db,
+		config:        cfg,
+		notifications: notifications,
+		translator:    translator,
+	}
+}
+
+// LoginContext describes the client behind a sign-in
+type LoginContext struct {
+	IPAddress      string
+	UserAgent      string
+	RequestID      string
+	AcceptLanguage string // Emails are in this language unless the user has set a locale
+}
+
+// SignedIn records a successful sign-in by user, loaded with their roles, with
+// device. When the device, or with login_notifications.new_ips the IP address,
+// is new for the user, the notification is sent in the background.
+func (s *LoginNotificationService) SignedIn(user *database.User, device *database.Device, ctx LoginContext) {
+	var known bool
+	if err := s.db.Raw("SELECT EXISTS (SELECT 1 FROM login_sources WHERE user_id = ?)", user.ID).Scan(&known).Error; err != nil {
+		log.Printf("Failed to read login sources of user %s: %v", user.ID, err)
+		return
+	}
+
+	now := time.Now()
+	newDevice, err := s.remember(user.ID, "device", device.ID.String(), now)
+	if err != nil {
+		log.Printf("Failed to record login device of user %s: %v", user.ID, err)
+		return
+	}
+	var newIP bool
+	if ctx.IPAddress != "" {
+		if newIP, err = s.remember(user.ID, "ip", ctx.IPAddress, now); err != nil {
+			log.Printf("Failed to record login IP of user %s: %v", user.ID, err)
+			return
+		}
+	}
+
+	if !known || !(newDevice || newIP && s.config.NewIPs) {
+		return
+	}
+	go s.notify(user, device, newDevice, newIP, ctx, now)
+}
+
+// remember marks a device or IP address as seen for the user, reporting
+// whether it had not been before
+func (s *LoginNotificationService) remember(userID uuid.UUID, kind, value string, now time.Time) (bool, error) {
+	var inserted bool
+	err := s.db.Raw(`INSERT INTO login_sources (user_id, kind, value, first_seen_at, last_seen_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (user_id, kind, value) DO UPDATE SET last_seen_at = EXCLUDED.last_seen_at
+		RETURNING (xmax = 0)`, userID, kind, value, now, now).Scan(&inserted).Error
+	return inserted, err
+}
+
+// notify emails the user of a sign-in from a new device or IP address and
+// records the outcome. Deployments with login_notifications off, users with
+// an exempt role and users without an email address are recorded as skipped.
+func (s *LoginNotificationService) notify(user *database.User, device *database.Device, newDevice, newIP bool, ctx LoginContext, signedInAt time.Time) {
+	entry := database.LoginNotification{
+		UserID:    user.ID,
+		DeviceID:  &device.ID,
+		IPAddress: ctx.IPAddress,
+		UserAgent: ctx.UserAgent,
+		NewDevice: newDevice,
+		NewIP:     newIP,
+		Email:     user.Email,
+		Status:    "sent",
+		RequestID: ctx.RequestID,
+	}
+
+	exemptRole := s.exempt(user)
+	switch {
+	case !s.config.Enabled:
+		entry.Status, entry.Reason = "skipped", "login notifications are disabled"
+	case exemptRole != "":
+		entry.Status, entry.Reason = "skipped", "exempt role "+exemptRole
+	case user.Email == "":
+		entry.Status, entry.Reason = "skipped", "user has no email address"
+	default:
+		locale := s.translator.Negotiate(user.Locale, ctx.AcceptLanguage)
+		subject, body := s.loginEmail(user, device, newDevice, newIP, ctx, signedInAt, locale)
+		if err := s.notifications.SendEmail([]string{user.Email}, subject, body); err != nil {
+			log.Printf("Failed to send login notification to user %s: %v", user.ID, err)
+			entry.Status, entry.Reason = "failed", err.Error()
+		}
+	}
+
+	s.record(&entry)
+}
+
+// exempt returns the user's first role in login_notifications.exempt_roles, if any
+func (s *LoginNotificationService) exempt(user *database.User) string {
+	for _, role := range user.Roles {
+		for _, exempt := range s.config.ExemptRoles {
+			if role.Name == exempt {
+				return role.Name
+			}
+		}
+	}
+	return ""
+}
+
+// loginEmail builds the notification's subject and body in locale
+func (s *LoginNotificationService) loginEmail(user *database.User, device *database.Device, newDevice, newIP bool, ctx LoginContext, signedInAt time.Time, locale string) (string, string) {
+	data := map[string]interface{}{
+		"Username":   user.Username,
+		"DeviceName": device.Name,
+		"DeviceType": device.Type,
+		"IPAddress":  ctx.IPAddress,
+		"UserAgent":  ctx.UserAgent,
+		"SignedInAt": signedInAt,
+		"NewDevice":  newDevice,
+		"NewIP":      newIP,
+	}
+	return s.translator.Translate(locale, "email.login_notification.subject", data), s.translator.Translate(locale, "email.login_notification.body", data)
+}
+
+// ListNotifications retrieves login notification log entries, most recent first, optionally for one user
+func (s *LoginNotificationService) ListNotifications(userID *uuid.UUID) ([]database.LoginNotification, error) {
+	var entries []database.LoginNotification
+	query := s.db.Order("created_at DESC")
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	}
+	if err := query.Find(&entries).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch login notification log: %w", err)
+	}
+	return entries, nil
+}
+
+// record writes a login notification log entry; failures are only logged
+func (s *LoginNotificationService) record(entry *database.LoginNotification) {
+	entry.ID = uuid.New()
+	if err := s.db.Create(entry).Error; err != nil {
+		log.Printf("Failed to record login notification: %v", err)
+	}
+}
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/logging"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Machine resources are resources of type "server". Their permissions use a
+// dedicated set of actions: "login" to open a session and "sudo" to escalate
+// privileges. A deny permission on the same resource and action overrides allow.
+const MachineResourceType = "server"
+
+// MachineActions lists the actions that can be validated for machine resources
+var MachineActions = []string{"login", "sudo"}
+
+// MachineAuthDecision is the result of validating a machine login
+type MachineAuthDecision struct {
+	Allow        bool       `json:"allow"`
+	UnixUsername string     `json:"unix_username,omitempty"`
+	UserID       *uuid.UUID `json:"user_id,omitempty"`
+	Reason       string     `json:"reason,omitempty"`
+	Cached       bool       `json:"cached"`
+}
+
+type machineDecision struct {
+	allow   bool
+	expires time.Time
+}
+
+// MachineAuthService answers allow/deny for machine logins (PAM, SSH) with as
+// little latency as possible: OTPs are validated locally when the device holds
+// its AES key, and permission decisions are cached until a permissions.invalidated
+// event names the user or the cache entry expires.
+type MachineAuthService struct {
+	db          *gorm.DB
+	config      *config.Config
+	authService *AuthService
+
+	mu        sync.RWMutex
+	decisions map[string]machineDecision
+	audits    sync.WaitGroup // Authentication log writes still in flight
+}
+
+func NewMachineAuthService(db *gorm.DB, config *config.Config, authService *AuthService, bus *EventBus) *MachineAuthService {
+	s := &MachineAuthService{
+		db:          db,
+		config:      config,
+		authService: authService,
+		decisions:   make(map[string]machineDecision),
+	}
+	bus.Subscribe(EventPermissionsInvalidated, s.invalidate)
+	return s
+}
+
+// Validate authenticates a device code and decides whether its user may perform
+// action on the machine resource. Authentication and authorization failures are
+// returned as a deny decision; an error means the request itself was invalid.
+func (s *MachineAuthService) Validate(ctx context.Context, deviceType, code, resourceName, action, ipAddress string) (*MachineAuthDecision, error) {
+	if !isMachineAction(action) {
+		return nil, fmt.Errorf("action must be one of: %v", MachineActions)
+	}
+
+	var resource database.Resource
+	if err := s.db.Where("name = ? AND type = ?", resourceName, MachineResourceType).First(&resource).Error; err != nil {
+		return nil, fmt.Errorf("machine resource '%s' not found", resourceName)
+	}
+
+	var device *database.Device
+	var degraded string
+	var err error
+	switch deviceType {
+	case "yubikey":
+		device, err = s.authService.authenticateYubikey(ctx, code)
+		degraded, err = s.authService.degradedYubikey(ctx, device, code, resourceName+":"+action, err)
+	default:
+		return nil, fmt.Errorf("unsupported device type: %s", deviceType)
+	}
+	if err != nil {
+		return &MachineAuthDecision{Reason: "authentication failed: " + err.Error()}, nil
+	}
+
+	var user database.User
+	if err := s.db.Where("id = ?", device.UserID).First(&user).Error; err != nil {
+		return &MachineAuthDecision{Reason: "user not found"}, nil
+	}
+
+	decision := &MachineAuthDecision{UserID: &user.ID, UnixUsername: user.UnixUsername}
+	if decision.UnixUsername == "" {
+		decision.UnixUsername = user.Username
+	}
+
+	switch {
+	case !user.Active:
+		decision.Reason = "user is not active"
+	case !UserStateAllowsAuthentication(user.State):
+		decision.Reason = "user account is " + user.State
+	case !device.Active:
+		decision.Reason = "device is not active"
+	case !resource.Active:
+		decision.Reason = "resource is not active"
+	default:
+		decision.Allow, decision.Cached, err = s.decide(user.ID, resource.ID, action)
+		if err != nil {
+			return nil, err
+		}
+		if !decision.Allow {
+			decision.Reason = fmt.Sprintf("no %s:%s permission", resource.Name, action)
+		} else if decision.Allow, decision.Reason, err = s.checkNetwork(ctx, &resource, user.ID, ipAddress); err != nil {
+			return nil, err
+		}
+	}
+
+	details := map[string]interface{}{
+		"machine":       resource.Name,
+		"action":        action,
+		"unix_username": decision.UnixUsername,
+		"reason":        decision.Reason,
+		"cached":        decision.Cached,
+	}
+	if degraded != "" {
+		details["degraded_mode"] = degraded
+	}
+
+	// Audit asynchronously so logging does not add to the response time
+	s.audits.Add(1)
+	go func() {
+		defer s.audits.Done()
+		if err := s.authService.LogAuthentication(map[string]interface{}{
+			"user_id":    user.ID,
+			"device_id":  device.ID,
+			"type":       "login",
+			"success":    decision.Allow,
+			"ip_address": ipAddress,
+			"request_id": logging.RequestID(ctx),
+			"details":    details,
+		}); err != nil {
+			log.Printf("Failed to log machine authentication: %v", err)
+		}
+		s.authService.deviceService.UpdateDeviceLastUsed(device.ID)
+	}()
+
+	return decision, nil
+}
+
+// decide returns whether the user holds an allow (and no deny) permission for the
+// resource and action, consulting the decision cache first
+func (s *MachineAuthService) decide(userID, resourceID uuid.UUID, action string) (allow, cached bool, err error) {
+	key := userID.String() + "|" + resourceID.String() + "|" + action
+	ttl := s.config.MachineAuth.DecisionCacheTTL
+
+	if ttl > 0 {
+		s.mu.RLock()
+		entry, ok := s.decisions[key]
+		s.mu.RUnlock()
+		if ok && time.Now().Before(entry.expires) {
+			return entry.allow, true, nil
+		}
+	}
+
+	var effects []string
+	err = s.db.Table("permissions").
+		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
+		Joins("JOIN user_roles ON user_roles.role_id = role_permissions.role_id").
+		Where("user_roles.user_id = ? AND permissions.resource_id = ? AND permissions.action = ?", userID, resourceID, action).
+		Pluck("permissions.effect", &effects).Error
+	if err != nil {
+		return false, false, fmt.Errorf("failed to check machine permissions: %w", err)
+	}
+
+	for _, effect := range effects {
+		if effect == "deny" {
+			allow = false
+			break
+		}
+		if effect == "allow" {
+			allow = true
+		}
+	}
+
+	if ttl > 0 {
+		s.mu.Lock()
+		s.decisions[key] = machineDecision{allow: allow, expires: time.Now().Add(ttl)}
+		s.mu.Unlock()
+	}
+	return allow, false, nil
+}
+
+// checkNetwork decides a permitted machine login by the client's ipAddress:
+// when the resource declares allowed networks, the address must be in one.
+// Holders of authorization.network_override_permission may log in from
+// anywhere; the reason then records the override for the audit.
+func (s *MachineAuthService) checkNetwork(ctx context.Context, resource *database.Resource, userID uuid.UUID, ipAddress string) (bool, string, error) {
+	networks := ResourceNetworks(resource)
+	if len(networks) == 0 || networksContain(networks, ipAddress) {
+		return true, "", nil
+	}
+	if override := s.config.Authorization.NetworkOverridePermission; override != "" {
+		overridden, err := s.authService.CheckUserPermission(ctx, userID, override)
+		if err != nil {
+			return false, "", err
+		}
+		if overridden {
+			return true, "network allowlist overridden with " + override, nil
+		}
+	}
+	return false, fmt.Sprintf("client IP %q is outside the allowed networks of %s", ipAddress, resource.Name), nil
+}
+
+// WaitForAudits blocks until pending authentication log writes are done, or ctx is
+func (s *MachineAuthService) WaitForAudits(ctx context.Context) error {
+	return waitContext(ctx, &s.audits)
+}
+
+// invalidate drops cached decisions for the users named in a permissions.invalidated event
+func (s *MachineAuthService) invalidate(event Event) {
+	invalidation, ok := event.Data.(PermissionInvalidation)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, userID := range invalidation.UserIDs {
+		prefix := userID.String() + "|"
+		for key := range s.decisions {
+			if strings.HasPrefix(key, prefix) {
+				delete(s.decisions, key)
+			}
+		}
+	}
+}
+
+func isMachineAction(action string) bool {
+	for _, a := range MachineActions {
+		if action == a {
+			return true
+		}
+	}
+	return false
+}
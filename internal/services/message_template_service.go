@@ -0,0 +1,527 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// TemplatesPermission is required to read and edit email and notification messages
+const TemplatesPermission = "yubiapp:templates"
+
+// messageTemplatePrefixes are the catalog keys that can be edited as templates
+var messageTemplatePrefixes = []string{"email.", "notification."}
+
+// MessageTemplateInfo is an editable message: its variables, its text in each
+// built-in catalog and its edited versions, one per locale
+type MessageTemplateInfo struct {
+	Key       string                     `json:"key"`
+	Variables []string                   `json:"variables"`
+	Catalog   map[string]string          `json:"catalog"`
+	Templates []database.MessageTemplate `json:"templates"`
+}
+
+// MessageTemplateService edits the email and notification messages of the
+// i18n catalogs. An edited message replaces the catalog's in its locale, keeps
+// every earlier version of its text, and is checked by rendering it with
+// sample data before it is saved. Edits are loaded into the translator, which
+// this and other processes reload within i18n.template_refresh.
+type MessageTemplateService struct {
+	db         *gorm.DB
+	translator *Translator
+	refresh    time.Duration
+
+	mu        sync.RWMutex
+	overrides map[string]map[string]*template.Template // Locale -> key -> message
+	loadedAt  time.Time
+	loading   bool
+}
+
+// NewMessageTemplateService loads the edited messages and installs them in
+// translator
+func NewMessageTemplateService(db *gorm.DB, translator *Translator, cfg config.I18nConfig) *MessageTemplateService {
+	s := &MessageTemplateService{
+		db:         db,
+		translator: translator,
+		refresh:    cfg.TemplateRefresh,
+	}
+	if err := s.load(); err != nil {
+		log.Printf("Failed to load message templates: %v", err)
+	}
+	translator.SetOverrides(s.lookup)
+	return s
+}
+
+// lookup returns the edited message of key in locale, if any, reloading the
+// edits in the background once they are older than i18n.template_refresh
+func (s *MessageTemplateService) lookup(locale, key string) *template.Template {
+	s.mu.RLock()
+	message := s.overrides[locale][key]
+	stale := !s.loading && time.Since(s.loadedAt) >= s.refresh
+	s.mu.RUnlock()
+
+	if stale {
+		s.mu.Lock()
+		if !s.loading {
+			s.loading = true
+			go func() {
+				if err := s.load(); err != nil {
+					log.Printf("Failed to reload message templates: %v", err)
+				}
+			}()
+		}
+		s.mu.Unlock()
+	}
+	return message
+}
+
+// load reads every edited message. One that no longer parses, e.g. after a
+// template function was removed, is skipped so the catalog's is used.
+func (s *MessageTemplateService) load() error {
+	var templates []database.MessageTemplate
+	err := s.db.Find(&templates).Error
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loading = false
+	s.loadedAt = time.Now()
+	if err != nil {
+		return err
+	}
+
+	overrides := map[string]map[string]*template.Template{}
+	for _, tmpl := range templates {
+		message, err := s.translator.Parse(tmpl.Key, tmpl.Text)
+		if err != nil {
+			log.Printf("Ignoring message template %s (%s): %v", tmpl.Key, tmpl.Locale, err)
+			continue
+		}
+		if overrides[tmpl.Locale] == nil {
+			overrides[tmpl.Locale] = map[string]*template.Template{}
+		}
+		overrides[tmpl.Locale][tmpl.Key] = message
+	}
+	s.overrides = overrides
+	return nil
+}
+
+// ListTemplates returns every editable message
+func (s *MessageTemplateService) ListTemplates() ([]MessageTemplateInfo, error) {
+	var templates []database.MessageTemplate
+	if err := s.db.Order("key, locale").Find(&templates).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch message templates: %w", err)
+	}
+	byKey := map[string][]database.MessageTemplate{}
+	for _, tmpl := range templates {
+		byKey[tmpl.Key] = append(byKey[tmpl.Key], tmpl)
+	}
+
+	keys := s.translator.Keys(messageTemplatePrefixes...)
+	infos := make([]MessageTemplateInfo, len(keys))
+	for i, key := range keys {
+		infos[i] = s.info(key, byKey[key])
+	}
+	return infos, nil
+}
+
+// GetTemplate returns an editable message by key
+func (s *MessageTemplateService) GetTemplate(key string) (*MessageTemplateInfo, error) {
+	if err := s.checkKey(key); err != nil {
+		return nil, err
+	}
+	var templates []database.MessageTemplate
+	if err := s.db.Where("key = ?", key).Order("locale").Find(&templates).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch message templates: %w", err)
+	}
+	info := s.info(key, templates)
+	return &info, nil
+}
+
+func (s *MessageTemplateService) info(key string, templates []database.MessageTemplate) MessageTemplateInfo {
+	if templates == nil {
+		templates = []database.MessageTemplate{}
+	}
+	return MessageTemplateInfo{
+		Key:       key,
+		Variables: templateVariables(messageSample(key)),
+		Catalog:   s.translator.Catalog(key),
+		Templates: templates,
+	}
+}
+
+// SaveTemplate sets the text of key in locale, creating the template or
+// updating it from version expected (nil skips the check). The text must
+// render with the message's sample data.
+func (s *MessageTemplateService) SaveTemplate(key, locale, text string, expected *int, userID uuid.UUID) (*database.MessageTemplate, error) {
+	locale, err := s.checkKeyLocale(key, locale)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil, NewError(CodeValidationFailed, "text is required; delete the template to use the built-in message again")
+	}
+	if _, err := s.render(key, text, nil); err != nil {
+		return nil, err
+	}
+
+	var saved database.MessageTemplate
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("key = ? AND locale = ?", key, locale).First(&saved).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if expected != nil && *expected != 0 {
+				return NewError(CodeConflict, "message template has been deleted; reload it and retry")
+			}
+			saved = database.MessageTemplate{
+				ID:          uuid.New(),
+				Key:         key,
+				Locale:      locale,
+				Text:        text,
+				Version:     1,
+				UpdatedByID: &userID,
+			}
+			if err := tx.Create(&saved).Error; err != nil {
+				return fmt.Errorf("failed to create message template: %w", err)
+			}
+		case err != nil:
+			return fmt.Errorf("failed to fetch message template: %w", err)
+		default:
+			if err := checkVersion("message template", saved.Version, expected); err != nil {
+				return err
+			}
+			if err := updateVersioned(tx, "message template", &saved, saved.Version, map[string]interface{}{
+				"text":          text,
+				"updated_by_id": userID,
+			}); err != nil {
+				return err
+			}
+			saved.Text = text
+			saved.Version++
+			saved.UpdatedByID = &userID
+		}
+
+		return tx.Create(&database.MessageTemplateVersion{
+			ID:          uuid.New(),
+			TemplateID:  saved.ID,
+			Version:     saved.Version,
+			Text:        text,
+			CreatedByID: &userID,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.load(); err != nil {
+		log.Printf("Failed to reload message templates: %v", err)
+	}
+	return &saved, nil
+}
+
+// DeleteTemplate removes the template of key in locale with its versions, so
+// the catalog's message is used again
+func (s *MessageTemplateService) DeleteTemplate(key, locale string) error {
+	locale, err := s.checkKeyLocale(key, locale)
+	if err != nil {
+		return err
+	}
+	result := s.db.Where("key = ? AND locale = ?", key, locale).Delete(&database.MessageTemplate{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete message template: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return NewError(CodeNotFound, "message template not found")
+	}
+
+	if err := s.load(); err != nil {
+		log.Printf("Failed to reload message templates: %v", err)
+	}
+	return nil
+}
+
+// ListVersions returns the versions of the template of key in locale, newest first
+func (s *MessageTemplateService) ListVersions(key, locale string) ([]database.MessageTemplateVersion, error) {
+	tmpl, err := s.getTemplate(key, locale)
+	if err != nil {
+		return nil, err
+	}
+	var versions []database.MessageTemplateVersion
+	if err := s.db.Where("template_id = ?", tmpl.ID).Order("version DESC").Find(&versions).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch message template versions: %w", err)
+	}
+	return versions, nil
+}
+
+// RestoreVersion saves the text the template of key in locale had at version
+// as its new version
+func (s *MessageTemplateService) RestoreVersion(key, locale string, version int, expected *int, userID uuid.UUID) (*database.MessageTemplate, error) {
+	tmpl, err := s.getTemplate(key, locale)
+	if err != nil {
+		return nil, err
+	}
+	var old database.MessageTemplateVersion
+	if err := s.db.Where("template_id = ? AND version = ?", tmpl.ID, version).First(&old).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "message template version %d not found", version)
+		}
+		return nil, fmt.Errorf("failed to get message template version: %w", err)
+	}
+	return s.SaveTemplate(key, tmpl.Locale, old.Text, expected, userID)
+}
+
+// Preview renders text as the message key, or the message as it is now in
+// locale when text is empty, with data or else the message's sample data
+func (s *MessageTemplateService) Preview(key, locale, text string, data map[string]interface{}) (string, error) {
+	if err := s.checkKey(key); err != nil {
+		return "", err
+	}
+	if text == "" {
+		message := s.translator.Message(locale, key)
+		if message == nil {
+			return "", NewError(CodeNotFound, "message %s not found", key)
+		}
+		return s.execute(message, key, data)
+	}
+	return s.render(key, text, data)
+}
+
+// render parses text as the message key and renders it with data, or the
+// message's sample data when data is nil
+func (s *MessageTemplateService) render(key, text string, data map[string]interface{}) (string, error) {
+	message, err := s.translator.Parse(key, text)
+	if err != nil {
+		return "", NewError(CodeValidationFailed, "invalid template: %v", err)
+	}
+	return s.execute(message, key, data)
+}
+
+func (s *MessageTemplateService) execute(message *template.Template, key string, data map[string]interface{}) (string, error) {
+	var sample interface{} = data
+	if data == nil {
+		sample = messageSample(key)
+	}
+	var rendered strings.Builder
+	if err := message.Execute(&rendered, sample); err != nil {
+		return "", NewError(CodeValidationFailed, "template does not render: %v", err)
+	}
+	return rendered.String(), nil
+}
+
+func (s *MessageTemplateService) getTemplate(key, locale string) (*database.MessageTemplate, error) {
+	locale, err := s.checkKeyLocale(key, locale)
+	if err != nil {
+		return nil, err
+	}
+	var tmpl database.MessageTemplate
+	if err := s.db.Where("key = ? AND locale = ?", key, locale).First(&tmpl).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "message template not found")
+		}
+		return nil, fmt.Errorf("failed to get message template: %w", err)
+	}
+	return &tmpl, nil
+}
+
+// checkKey requires key to be an editable message of the built-in catalog
+func (s *MessageTemplateService) checkKey(key string) error {
+	for _, editable := range s.translator.Keys(messageTemplatePrefixes...) {
+		if key == editable {
+			return nil
+		}
+	}
+	return NewError(CodeNotFound, "message %s not found; templates can edit the email.* and notification.* messages", key)
+}
+
+// checkKeyLocale checks key and returns locale in canonical form
+func (s *MessageTemplateService) checkKeyLocale(key, locale string) (string, error) {
+	if err := s.checkKey(key); err != nil {
+		return "", err
+	}
+	if locale == "" {
+		return "", NewError(CodeValidationFailed, "locale is required")
+	}
+	return CheckLocale(locale)
+}
+
+// messageSampleTime is when the events of sample data happened
+var messageSampleTime = time.Date(2026, time.March, 2, 9, 30, 0, 0, time.UTC)
+
+// messageSample returns data like that the message key is rendered with, for
+// previews, for checking edits and for listing its variables; nil when unknown
+func messageSample(key string) interface{} {
+	message := key[:max(strings.LastIndex(key, "."), 0)]
+	userID := uuid.MustParse("8f14e45f-ceea-467f-a8f6-2c3b1b4e0a11")
+	switch message {
+	case "email.password_reset":
+		return map[string]interface{}{
+			"Username": "jdoe",
+			"Link":     "https://id.example.com/reset-password?token=sample",
+			"Expiry":   time.Hour,
+		}
+	case "email.login_notification":
+		return map[string]interface{}{
+			"Username":   "jdoe",
+			"DeviceName": "Office YubiKey",
+			"DeviceType": "yubikey",
+			"IPAddress":  "203.0.113.7",
+			"UserAgent":  "Mozilla/5.0 (X11; Linux x86_64)",
+			"SignedInAt": messageSampleTime,
+			"NewDevice":  false,
+			"NewIP":      true,
+		}
+	case "email.hr_notification":
+		return HRNotificationData{
+			Rule:        "Sickness to HR",
+			TriggerType: HRTriggerStatus,
+			TriggerName: "sick",
+			User: HRNotificationUser{
+				ID:        userID,
+				Username:  "jdoe",
+				Email:     "jdoe@example.com",
+				FirstName: "Jane",
+				LastName:  "Doe",
+				Name:      "Jane Doe",
+			},
+			OccurredAt: messageSampleTime,
+			Details:    map[string]interface{}{"note": "Back on Thursday"},
+		}
+	case "notification.alert":
+		return alertMessageData(AlertNotification{
+			ID:            uuid.MustParse("c9f0f895-fb98-4b91-9f3e-2f1e5a7b6d22"),
+			Rule:          "Brute force",
+			Condition:     AlertConditionFailedAuth,
+			Severity:      "critical",
+			GroupBy:       "ip_address",
+			Subject:       "203.0.113.7",
+			Count:         25,
+			WindowMinutes: 10,
+			FirstSeenAt:   messageSampleTime.Add(-9 * time.Minute),
+			LastSeenAt:    messageSampleTime,
+		})
+	case "notification.break_glass":
+		return map[string]interface{}{
+			"Credential":       "Vault envelope 1",
+			"Username":         "emergency-admin",
+			"UsedAt":           messageSampleTime,
+			"IPAddress":        "203.0.113.7",
+			"UserAgent":        "Mozilla/5.0 (X11; Linux x86_64)",
+			"SessionExpiresAt": messageSampleTime.Add(time.Hour),
+			"IncidentID":       uuid.MustParse("45c48cce-2e2d-4fbd-8e6d-1a2b3c4d5e33"),
+		}
+	case "email.device_report":
+		failing := DeviceUsage{Type: "yubikey", Identifier: "cccjgjgkhcbb", Username: "jdoe", AuthLogCounts: AuthLogCounts{Total: 40, Succeeded: 30, Failed: 10}, FailureRate: 0.25}
+		return newDeviceReportData(&DeviceAnalytics{
+			From:          messageSampleTime.AddDate(0, 0, -7),
+			To:            messageSampleTime,
+			UnusedDays:    90,
+			AuthLogCounts: AuthLogCounts{Total: 1200, Succeeded: 1170, Failed: 30},
+			FailureRate:   0.025,
+			Devices:       []DeviceUsage{failing},
+			LastUsed:      []DeviceLastUsedBucket{{Bucket: "7_days", Count: 42}, {Bucket: "older", Count: 3}, {Bucket: "never", Count: 1}},
+			Unused:        []DeviceUsage{{Type: "totp", Identifier: "phone", Username: "asmith", DaysUnused: 120}},
+			HighFailures:  []DeviceUsage{failing},
+		})
+	case "email.attendance_breach":
+		firstSignIn := messageSampleTime
+		return attendanceBreachData{
+			AttendanceDay: AttendanceDay{
+				UserID:        userID,
+				UserName:      "Jane Doe",
+				Date:          messageSampleTime.Format("2006-01-02"),
+				PolicyName:    "Office hours",
+				ExpectedHours: 8,
+				WorkedHours:   7.5,
+				FirstSignIn:   &firstSignIn,
+				Late:          true,
+				LateMinutes:   30,
+			},
+			Breach: "late",
+		}
+	case "email.shift_exception":
+		locationID := uuid.MustParse("6512bd43-d9ca-4f6e-a4e0-6c8b2b1e7f44")
+		firstSignIn := messageSampleTime.Add(25 * time.Minute)
+		return shiftExceptionData{
+			ShiftComparison: ShiftComparison{
+				ShiftID:      uuid.MustParse("c20ad4d7-6fe9-4759-aa27-a0c99bff6710"),
+				UserID:       userID,
+				UserName:     "Jane Doe",
+				LocationID:   &locationID,
+				LocationName: "Head office",
+				Date:         messageSampleTime.Format("2006-01-02"),
+				PlannedStart: messageSampleTime,
+				PlannedEnd:   messageSampleTime.Add(8 * time.Hour),
+				PlannedHours: 8,
+				FirstSignIn:  &firstSignIn,
+				Status:       "late",
+				LateMinutes:  25,
+			},
+			ManagerName: "John Smith",
+		}
+	case "email.visitor_arrival":
+		return map[string]interface{}{
+			"HostName":     "Jane Doe",
+			"VisitorName":  "Alex Martin",
+			"Company":      "Example Ltd",
+			"LocationName": "Head office",
+			"BadgeNumber":  "V-042",
+			"ArrivedAt":    messageSampleTime,
+		}
+	}
+	return nil
+}
+
+// templateVariables lists the variables sample data offers a template: the
+// keys of a map, or the exported fields of a struct including those promoted
+// from embedded structs
+func templateVariables(sample interface{}) []string {
+	value := reflect.ValueOf(sample)
+	switch value.Kind() {
+	case reflect.Map:
+		variables := make([]string, 0, value.Len())
+		for _, key := range value.MapKeys() {
+			variables = append(variables, key.String())
+		}
+		sort.Strings(variables)
+		return variables
+	case reflect.Struct:
+		seen := map[string]bool{}
+		var variables []string
+		var collect func(reflect.Type)
+		collect = func(t reflect.Type) {
+			var embedded []reflect.Type
+			for i := 0; i < t.NumField(); i++ {
+				field := t.Field(i)
+				if field.Anonymous {
+					embedded = append(embedded, field.Type)
+					continue
+				}
+				if field.IsExported() && !seen[field.Name] {
+					seen[field.Name] = true
+					variables = append(variables, field.Name)
+				}
+			}
+			// Fields of embedded structs are shadowed by the outer ones
+			for _, t := range embedded {
+				if t.Kind() == reflect.Pointer {
+					t = t.Elem()
+				}
+				collect(t)
+			}
+		}
+		collect(value.Type())
+		sort.Strings(variables)
+		return variables
+	}
+	return []string{}
+}
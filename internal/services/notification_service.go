@@ -0,0 +1,116 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+)
+
+// NotificationService delivers webhook and email notifications
+type NotificationService struct {
+	config     *config.Config
+	httpClient *http.Client
+}
+
+func NewNotificationService(config *config.Config) *NotificationService {
+	return &NotificationService{
+		config:     config,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// SendWebhook POSTs payload as JSON to url. Any non-2xx response is an error.
+func (s *NotificationService) SendWebhook(url string, payload interface{}) error {
+	return s.SendSignedWebhook(url, "", payload, nil)
+}
+
+// SendSignedWebhook POSTs payload as JSON to url with extra headers. When secret
+// is set, the body is signed with HMAC-SHA256 in the X-YubiApp-Signature header
+// so receivers can verify it came from YubiApp.
+func (s *NotificationService) SendSignedWebhook(url, secret string, payload interface{}, headers map[string]string) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "YubiApp-Webhook/1.0")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	if secret != "" {
+		req.Header.Set("X-YubiApp-Signature", signPayload(secret, body))
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// signPayload returns the X-YubiApp-Signature value for body: an HMAC-SHA256 keyed by secret
+func signPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// SendEmail sends a plain-text email using the configured SMTP server
+func (s *NotificationService) SendEmail(to []string, subject, body string) error {
+	emailConfig := s.config.Email
+	if emailConfig.SMTPHost == "" {
+		return fmt.Errorf("email is not configured")
+	}
+	if len(to) == 0 {
+		return fmt.Errorf("no email recipients")
+	}
+
+	var msg strings.Builder
+	msg.WriteString("From: " + emailConfig.FromEmail + "\r\n")
+	msg.WriteString("To: " + strings.Join(to, ", ") + "\r\n")
+	msg.WriteString("Subject: " + subject + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(body)
+
+	var auth smtp.Auth
+	if emailConfig.Username != "" {
+		auth = smtp.PlainAuth("", emailConfig.Username, emailConfig.Password, emailConfig.SMTPHost)
+	}
+
+	addr := fmt.Sprintf("%s:%d", emailConfig.SMTPHost, emailConfig.SMTPPort)
+	if err := smtp.SendMail(addr, auth, emailConfig.FromEmail, to, []byte(msg.String())); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+// splitRecipients parses a comma-separated recipient list
+func splitRecipients(value string) []string {
+	var recipients []string
+	for _, r := range strings.Split(value, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			recipients = append(recipients, r)
+		}
+	}
+	return recipients
+}
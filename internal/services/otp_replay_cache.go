@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// otpReplayCountsKey is the Redis hash counting replayed OTPs per device ID
+const otpReplayCountsKey = "otp_replays"
+
+// OTPReplayCache remembers hashes of recently seen YubiKey OTPs in Redis so a
+// replay is refused before it reaches YubiCloud or the local counter check,
+// and counts the replays caught per device
+type OTPReplayCache struct {
+	client redis.UniversalClient
+	ttl    time.Duration
+}
+
+// NewOTPReplayCache creates a replay cache keeping OTPs for ttl; a ttl of 0
+// disables it
+func NewOTPReplayCache(client redis.UniversalClient, ttl time.Duration) *OTPReplayCache {
+	return &OTPReplayCache{client: client, ttl: ttl}
+}
+
+// Enabled reports whether the cache remembers OTPs, i.e. its ttl is not 0
+func (c *OTPReplayCache) Enabled() bool {
+	return c != nil && c.ttl > 0
+}
+
+// otpKey is the Redis key of an OTP; only its hash is stored
+func otpKey(otp string) string {
+	sum := sha256.Sum256([]byte(otp))
+	return "otp_seen:" + hex.EncodeToString(sum[:])
+}
+
+// Seen marks otp as used by deviceID, reporting whether it already was; a
+// replay is counted against the device
+func (c *OTPReplayCache) Seen(ctx context.Context, deviceID uuid.UUID, otp string) (bool, error) {
+	if c == nil || c.ttl <= 0 {
+		return false, nil
+	}
+	fresh, err := c.client.SetNX(ctx, otpKey(otp), deviceID.String(), c.ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check OTP replay cache: %w", err)
+	}
+	if fresh {
+		return false, nil
+	}
+	if err := c.client.HIncrBy(ctx, otpReplayCountsKey, deviceID.String(), 1).Err(); err != nil {
+		return true, fmt.Errorf("failed to count replayed OTP: %w", err)
+	}
+	return true, nil
+}
+
+// Forget removes otp from the cache, so an OTP that could not be verified
+// (e.g. YubiCloud was down) may be retried
+func (c *OTPReplayCache) Forget(ctx context.Context, otp string) {
+	if c == nil || c.ttl <= 0 {
+		return
+	}
+	c.client.Del(ctx, otpKey(otp))
+}
+
+// OTPReplayCount is the number of replayed OTPs caught for a device
+type OTPReplayCount struct {
+	DeviceID uuid.UUID `json:"device_id"`
+	Count    int64     `json:"count"`
+}
+
+// ReplayCounts returns the replayed OTPs caught per device since counting
+// began, most first; none when the cache is disabled
+func (c *OTPReplayCache) ReplayCounts(ctx context.Context) ([]OTPReplayCount, error) {
+	if c == nil || c.ttl <= 0 {
+		return []OTPReplayCount{}, nil
+	}
+	values, err := c.client.HGetAll(ctx, otpReplayCountsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OTP replay counts: %w", err)
+	}
+	counts := make([]OTPReplayCount, 0, len(values))
+	for device, value := range values {
+		deviceID, err := uuid.Parse(device)
+		if err != nil {
+			continue
+		}
+		count, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		counts = append(counts, OTPReplayCount{DeviceID: deviceID, Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i].Count > counts[j].Count })
+	return counts, nil
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"gorm.io/gorm"
+)
+
+// partitionLockID keys the advisory lock that keeps the API process and
+// cmd/worker from creating the same partition at once
+const partitionLockID = 7279158432
+
+// partitionedTable is a table partitioned by month on column
+type partitionedTable struct {
+	name   string
+	column string
+}
+
+// partitionedTables are the tables migration 0023 partitions by month
+var partitionedTables = []partitionedTable{
+	{name: "authentication_logs", column: "created_at"},
+	{name: "user_activity_history", column: "from_datetime"},
+}
+
+// PartitionService creates the monthly partitions of authentication_logs and
+// user_activity_history before rows for those months arrive
+type PartitionService struct {
+	db     *gorm.DB
+	config config.PartitionsConfig
+	stop   chan struct{}
+}
+
+func NewPartitionService(db *gorm.DB, cfg config.PartitionsConfig) *PartitionService {
+	return &PartitionService{
+		db:     db,
+		config: cfg,
+	}
+}
+
+// StartMaintenance creates missing partitions right away and then
+// periodically. It does nothing when partitions.maintenance_interval is zero.
+func (s *PartitionService) StartMaintenance() {
+	interval := s.config.MaintenanceInterval
+	if interval <= 0 || s.stop != nil {
+		return
+	}
+
+	s.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			created, err := s.CreatePartitions(context.Background(), time.Now())
+			if len(created) > 0 {
+				log.Printf("Partition maintenance: created %v", created)
+			}
+			if err != nil {
+				log.Printf("Partition maintenance failed: %v", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopMaintenance stops the background partition maintenance job
+func (s *PartitionService) StopMaintenance() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// CreatePartitions creates the partitions of each partitioned table from the
+// month of now through partitions.premake_months after it, returning the names
+// of those it created. Rows of those months already in the default partition
+// are moved into the new partition.
+func (s *PartitionService) CreatePartitions(ctx context.Context, now time.Time) ([]string, error) {
+	current := time.Date(now.UTC().Year(), now.UTC().Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	var created []string
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", partitionLockID).Error; err != nil {
+			return fmt.Errorf("failed to lock partitions: %w", err)
+		}
+		for _, table := range partitionedTables {
+			var partitioned bool
+			if err := tx.Raw("SELECT EXISTS (SELECT 1 FROM pg_partitioned_table WHERE partrelid = to_regclass(?))", table.name).
+				Scan(&partitioned).Error; err != nil {
+				return fmt.Errorf("failed to inspect %s: %w", table.name, err)
+			}
+			if !partitioned {
+				return fmt.Errorf("%s is not partitioned; apply migration 0023 first", table.name)
+			}
+
+			for i := 0; i <= s.config.PremakeMonths; i++ {
+				name, err := s.createPartition(tx, table, current.AddDate(0, i, 0))
+				if err != nil {
+					return err
+				}
+				if name != "" {
+					created = append(created, name)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// createPartition creates the partition of table for the month starting at
+// from unless it exists, returning its name when created
+func (s *PartitionService) createPartition(tx *gorm.DB, table partitionedTable, from time.Time) (string, error) {
+	name := partitionName(table.name, from)
+	var exists bool
+	if err := tx.Raw("SELECT to_regclass(?) IS NOT NULL", name).Scan(&exists).Error; err != nil {
+		return "", fmt.Errorf("failed to look up partition %s: %w", name, err)
+	}
+	if exists {
+		return "", nil
+	}
+
+	// Built apart and attached, as a partition cannot be created over rows
+	// of its range in the default partition; attaching adds the parent's
+	// indexes, foreign keys and triggers
+	to := from.AddDate(0, 1, 0)
+	bounds := fmt.Sprintf("FROM ('%s') TO ('%s')", from.Format(time.RFC3339), to.Format(time.RFC3339))
+	statements := []string{
+		fmt.Sprintf("CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS INCLUDING CONSTRAINTS)", name, table.name),
+		fmt.Sprintf(`WITH moved AS (DELETE FROM %[1]s_default WHERE %[2]s >= '%[3]s' AND %[2]s < '%[4]s' RETURNING *)
+			INSERT INTO %[5]s SELECT * FROM moved`, table.name, table.column, from.Format(time.RFC3339), to.Format(time.RFC3339), name),
+		fmt.Sprintf("ALTER TABLE %s ATTACH PARTITION %s FOR VALUES %s", table.name, name, bounds),
+	}
+	for _, statement := range statements {
+		if err := tx.Exec(statement).Error; err != nil {
+			return "", fmt.Errorf("failed to create partition %s: %w", name, err)
+		}
+	}
+	return name, nil
+}
+
+// partitionName names the partition of table for the month of t, e.g.
+// authentication_logs_y2024m01
+func partitionName(table string, t time.Time) string {
+	return fmt.Sprintf("%s_y%04dm%02d", table, t.Year(), int(t.Month()))
+}
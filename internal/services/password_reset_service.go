@@ -0,0 +1,283 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrResetRateLimited  = NewError(CodeRateLimited, "too many password reset requests; try again later")
+	ErrInvalidResetToken = NewError(CodeAuthFailed, "invalid or expired password reset token")
+)
+
+// PasswordResetService emails single-use password reset tokens to a user's
+// verified email device and consumes them. Tokens live in Redis; every request
+// and reset is recorded in the password reset log.
+type PasswordResetService struct {
+	db            *gorm.DB
+	config        *config.Config
+	passwords     *PasswordService
+	notifications *NotificationService
+	translator    *Translator
+	sessions      *SessionService
+	redis         redis.UniversalClient
+}
+
+func NewPasswordResetService(db *gorm.DB, config *config.Config, passwords *PasswordService, notifications *NotificationService, translator *Translator, sessions *SessionService, redisClient redis.UniversalClient) *PasswordResetService {
+	return &PasswordResetService{
+		db:            db,
+		config:        config,
+		passwords:     passwords,
+		notifications: notifications,
+		translator:    translator,
+		sessions:      sessions,
+		redis:         redisClient,
+	}
+}
+
+// PasswordResetContext describes the client behind a reset request
+type PasswordResetContext struct {
+	IPAddress      string
+	UserAgent      string
+	RequestID      string
+	AcceptLanguage string // Reset emails are in this language unless the user has set a locale
+}
+
+// RequestReset sends a reset token to the verified email device of the user
+// with the given username or email. To avoid revealing which accounts exist it
+// only fails when the client is rate limited; requests that send nothing are
+// logged with the reason.
+func (s *PasswordResetService) RequestReset(identifier string, ctx PasswordResetContext) error {
+	entry := database.PasswordResetLog{
+		Identifier: identifier,
+		Event:      "requested",
+		IPAddress:  ctx.IPAddress,
+		UserAgent:  ctx.UserAgent,
+		RequestID:  ctx.RequestID,
+	}
+
+	if limited, err := s.rateLimited("ip:" + ctx.IPAddress); err != nil {
+		return err
+	} else if limited {
+		entry.Event = "rate_limited"
+		entry.Reason = "client IP over limit"
+		s.record(&entry)
+		return ErrResetRateLimited
+	}
+
+	var user database.User
+	if err := s.db.Where("username = ? OR email = ?", identifier, identifier).First(&user).Error; err != nil {
+		entry.Reason = "no such user"
+		s.record(&entry)
+		return nil
+	}
+	entry.UserID = &user.ID
+
+	// Per-account limit is silent, so it cannot be used to probe for accounts
+	if limited, err := s.rateLimited("user:" + user.ID.String()); err != nil {
+		return err
+	} else if limited {
+		entry.Event = "rate_limited"
+		entry.Reason = "account over limit"
+		s.record(&entry)
+		return nil
+	}
+
+	if !user.Active || !UserStateAllowsAuthentication(user.State) {
+		entry.Reason = "user is not active"
+		s.record(&entry)
+		return nil
+	}
+
+	var device database.Device
+	if err := s.db.Where("user_id = ? AND type = ? AND active = ? AND verified_at > ?", user.ID, "email", true, time.Time{}).
+		Order("verified_at DESC").First(&device).Error; err != nil {
+		entry.Reason = "no verified email device"
+		s.record(&entry)
+		return nil
+	}
+
+	token, err := s.issueToken(user.ID)
+	if err != nil {
+		return err
+	}
+
+	locale := s.translator.Negotiate(user.Locale, ctx.AcceptLanguage)
+	subject, body := s.resetEmail(&user, token, locale)
+	if err := s.notifications.SendEmail([]string{device.Identifier}, subject, body); err != nil {
+		log.Printf("Failed to send password reset email to user %s: %v", user.ID, err)
+		entry.Reason = "email not sent: " + err.Error()
+		s.record(&entry)
+		return nil
+	}
+
+	entry.Reason = "sent to device " + device.ID.String()
+	s.record(&entry)
+	return nil
+}
+
+// ResetPassword consumes a reset token and sets the new password, which must meet
+// the password policy. A token can only be used once, even if the reset fails.
+// All of the user's sessions are invalidated, as whoever held the old password
+// may have started them.
+func (s *PasswordResetService) ResetPassword(token, newPassword string, ctx PasswordResetContext) error {
+	entry := database.PasswordResetLog{
+		Event:     "completed",
+		IPAddress: ctx.IPAddress,
+		UserAgent: ctx.UserAgent,
+		RequestID: ctx.RequestID,
+	}
+
+	if limited, err := s.rateLimited("reset-ip:" + ctx.IPAddress); err != nil {
+		return err
+	} else if limited {
+		entry.Event = "rate_limited"
+		entry.Reason = "client IP over limit"
+		s.record(&entry)
+		return ErrResetRateLimited
+	}
+
+	userID, err := s.consumeToken(token)
+	if err != nil {
+		entry.Event = "failed"
+		entry.Reason = err.Error()
+		s.record(&entry)
+		return err
+	}
+	entry.UserID = &userID
+
+	if err := s.passwords.SetPassword(userID, newPassword); err != nil {
+		entry.Event = "failed"
+		entry.Reason = err.Error()
+		s.record(&entry)
+		return err
+	}
+
+	s.record(&entry)
+	if _, err := s.sessions.InvalidateUserSessions(context.Background(), userID); err != nil {
+		return WrapError(CodeInternal, "password was reset but sessions could not be invalidated", err)
+	}
+	return nil
+}
+
+// ListResetLogs retrieves password reset log entries, most recent first, optionally for one user
+func (s *PasswordResetService) ListResetLogs(userID *uuid.UUID) ([]database.PasswordResetLog, error) {
+	var entries []database.PasswordResetLog
+	query := s.db.Order("created_at DESC")
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	}
+	if err := query.Find(&entries).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch password reset log: %w", err)
+	}
+	return entries, nil
+}
+
+// issueToken stores a new token for the user, replacing any earlier one. The
+// token is a random ID and its HMAC, so forged tokens are rejected before Redis is touched.
+func (s *PasswordResetService) issueToken(userID uuid.UUID) (string, error) {
+	ctx := context.Background()
+	id, err := randomHex(16)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate password reset token: %w", err)
+	}
+	ttl := s.config.Password.ResetTokenTTL
+
+	userKey := "password_reset_user:" + userID.String()
+	if previous, err := s.redis.Get(ctx, userKey).Result(); err == nil {
+		s.redis.Del(ctx, "password_reset:"+previous)
+	}
+
+	if err := s.redis.Set(ctx, "password_reset:"+id, userID.String(), ttl).Err(); err != nil {
+		return "", fmt.Errorf("failed to store password reset token: %w", err)
+	}
+	if err := s.redis.Set(ctx, userKey, id, ttl).Err(); err != nil {
+		return "", fmt.Errorf("failed to store password reset token: %w", err)
+	}
+	return id + "." + s.sign(id), nil
+}
+
+// consumeToken checks a token's signature and removes it, returning the user it was issued to
+func (s *PasswordResetService) consumeToken(token string) (uuid.UUID, error) {
+	id, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(s.sign(id))) {
+		return uuid.Nil, ErrInvalidResetToken
+	}
+
+	value, err := s.redis.GetDel(context.Background(), "password_reset:"+id).Result()
+	if err == redis.Nil {
+		return uuid.Nil, ErrInvalidResetToken
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to read password reset token: %w", err)
+	}
+
+	userID, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.Nil, ErrInvalidResetToken
+	}
+	s.redis.Del(context.Background(), "password_reset_user:"+userID.String())
+	return userID, nil
+}
+
+// rateLimited counts a request against key and reports whether it is over password.reset_rate_limit
+func (s *PasswordResetService) rateLimited(key string) (bool, error) {
+	limit := s.config.Password.ResetRateLimit
+	if limit <= 0 {
+		return false, nil
+	}
+
+	ctx := context.Background()
+	key = "password_reset_rate:" + key
+	count, err := s.redis.Incr(ctx, key).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check password reset rate limit: %w", err)
+	}
+	if count == 1 {
+		s.redis.Expire(ctx, key, s.config.Password.ResetRateWindow)
+	}
+	return count > int64(limit), nil
+}
+
+// sign returns the HMAC of a token ID keyed by the JWT secret
+func (s *PasswordResetService) sign(id string) string {
+	mac := hmac.New(sha256.New, []byte(s.config.Auth.JWTSecret))
+	mac.Write([]byte("password-reset:" + id))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// resetEmail builds the reset email's subject and body in locale, linking to
+// password.reset_url when set
+func (s *PasswordResetService) resetEmail(user *database.User, token, locale string) (string, string) {
+	link := token
+	if s.config.Password.ResetURL != "" {
+		link = s.config.Password.ResetURL + "?token=" + url.QueryEscape(token)
+	}
+	data := map[string]interface{}{
+		"Username": user.Username,
+		"Link":     link,
+		"Expiry":   s.config.Password.ResetTokenTTL,
+	}
+	return s.translator.Translate(locale, "email.password_reset.subject", data), s.translator.Translate(locale, "email.password_reset.body", data)
+}
+
+// record writes a password reset log entry; failures are only logged
+func (s *PasswordResetService) record(entry *database.PasswordResetLog) {
+	entry.ID = uuid.New()
+	if err := s.db.Create(entry).Error; err != nil {
+		log.Printf("Failed to record password reset log: %v", err)
+	}
+}
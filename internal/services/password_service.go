@@ -0,0 +1,336 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidCredentials = NewError(CodeAuthFailed, "invalid username or password")
+	ErrAccountLocked      = NewError(CodeAccountLocked, "account is locked after too many failed password attempts")
+	ErrPasswordExpired    = NewError(CodePasswordExpired, "password has expired and must be changed")
+)
+
+// PasswordService hashes and verifies user passwords and enforces the password
+// policy: complexity, reuse of recent passwords, expiry and lockout after failures
+type PasswordService struct {
+	db     *gorm.DB
+	config *config.Config
+
+	dummyHashOnce sync.Once
+	dummyHash     []byte // Compared against when there is no password to check; see compareDummy
+}
+
+func NewPasswordService(db *gorm.DB, config *config.Config) *PasswordService {
+	return &PasswordService{
+		db:     db,
+		config: config,
+	}
+}
+
+// ValidatePolicy checks a new password against the configured length and complexity rules
+func (s *PasswordService) ValidatePolicy(password string) error {
+	policy := s.config.Password
+
+	if len([]rune(password)) < policy.MinLength {
+		return NewError(CodeValidationFailed, "password must be at least %d characters", policy.MinLength)
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+
+	var missing []string
+	if policy.RequireUppercase && !hasUpper {
+		missing = append(missing, "an uppercase letter")
+	}
+	if policy.RequireLowercase && !hasLower {
+		missing = append(missing, "a lowercase letter")
+	}
+	if policy.RequireDigit && !hasDigit {
+		missing = append(missing, "a digit")
+	}
+	if policy.RequireSymbol && !hasSymbol {
+		missing = append(missing, "a symbol")
+	}
+	if len(missing) > 0 {
+		return NewError(CodeValidationFailed, "password must contain %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// HashPassword validates a new password against the policy and hashes it with the configured bcrypt cost
+func (s *PasswordService) HashPassword(password string) (string, error) {
+	if err := s.ValidatePolicy(password); err != nil {
+		return "", err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), s.bcryptCost())
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// SetPassword changes a user's password. The new password must meet the policy
+// and differ from the current one and the last password.history passwords.
+// Changing the password also clears any lockout.
+func (s *PasswordService) SetPassword(userID uuid.UUID, password string) error {
+	var user database.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return NewError(CodeNotFound, "user not found")
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	updates, hash, err := s.passwordUpdates(&user, password)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to update password: %w", err)
+		}
+		return s.recordHistory(tx, user.ID, hash)
+	})
+}
+
+// passwordUpdates checks a new password for user like SetPassword and returns
+// the column updates that set it, with its hash. The updates bump the user's
+// version, so edits based on the old version conflict with the change. Whoever
+// applies them records the hash with recordHistory in the same transaction.
+func (s *PasswordService) passwordUpdates(user *database.User, password string) (map[string]interface{}, string, error) {
+	if err := s.checkReuse(user, password); err != nil {
+		return nil, "", err
+	}
+
+	hash, err := s.HashPassword(password)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return map[string]interface{}{
+		"password":                 hash,
+		"password_changed_at":      time.Now(),
+		"failed_password_attempts": 0,
+		"locked_until":             nil,
+		"version":                  gorm.Expr("version + 1"),
+	}, hash, nil
+}
+
+// RecordNewPassword stores the first password hash of a newly created user in
+// their history and starts its expiry clock
+func (s *PasswordService) RecordNewPassword(userID uuid.UUID, hash string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&database.User{}).Where("id = ?", userID).
+			Update("password_changed_at", time.Now()).Error; err != nil {
+			return fmt.Errorf("failed to update password: %w", err)
+		}
+		return s.recordHistory(tx, userID, hash)
+	})
+}
+
+// VerifyPassword checks a username (or email) and password. Failed attempts are
+// counted and lock the account for password.lockout_duration once they reach
+// password.max_failures. Expiry is not checked here; see PasswordExpired.
+func (s *PasswordService) VerifyPassword(username, password string) (*database.User, error) {
+	var user database.User
+	if err := s.db.Preload("Roles").Where("username = ? OR email = ?", username, username).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			s.compareDummy(password)
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("failed to find user: %w", err)
+	}
+
+	now := time.Now()
+	if user.LockedUntil != nil && user.LockedUntil.After(now) {
+		return nil, fmt.Errorf("%w until %s", ErrAccountLocked, user.LockedUntil.Format(time.RFC3339))
+	}
+
+	var mismatch bool
+	if user.Password == "" {
+		s.compareDummy(password)
+		mismatch = true
+	} else {
+		mismatch = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil
+	}
+	if mismatch {
+		if err := s.recordFailure(&user, now); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
+	}
+
+	if user.FailedPasswordAttempts > 0 || user.LockedUntil != nil {
+		if err := s.db.Model(&user).Updates(map[string]interface{}{
+			"failed_password_attempts": 0,
+			"locked_until":             nil,
+		}).Error; err != nil {
+			return nil, fmt.Errorf("failed to reset password failures: %w", err)
+		}
+		user.FailedPasswordAttempts = 0
+		user.LockedUntil = nil
+	}
+	return &user, nil
+}
+
+// PasswordExpiresAt returns when a user's password expires, or nil when expiry
+// is disabled. Passwords set before expiry tracking count from account creation.
+func (s *PasswordService) PasswordExpiresAt(user *database.User) *time.Time {
+	maxAge := s.config.Password.MaxAge
+	if maxAge <= 0 {
+		return nil
+	}
+	changedAt := user.CreatedAt
+	if user.PasswordChangedAt != nil {
+		changedAt = *user.PasswordChangedAt
+	}
+	expiresAt := changedAt.Add(maxAge)
+	return &expiresAt
+}
+
+// PasswordExpired reports whether a user's password is past password.max_age
+func (s *PasswordService) PasswordExpired(user *database.User) bool {
+	expiresAt := s.PasswordExpiresAt(user)
+	return expiresAt != nil && !time.Now().Before(*expiresAt)
+}
+
+// UnlockUser clears a password lockout
+func (s *PasswordService) UnlockUser(userID uuid.UUID) error {
+	res := s.db.Model(&database.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"failed_password_attempts": 0,
+		"locked_until":             nil,
+	})
+	if res.Error != nil {
+		return fmt.Errorf("failed to unlock user: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return NewError(CodeNotFound, "user not found")
+	}
+	return nil
+}
+
+// RecordFailedAttempt counts a failed second factor presented with a correct
+// password, such as a wrong recovery code, toward password.max_failures
+func (s *PasswordService) RecordFailedAttempt(user *database.User) error {
+	return s.recordFailure(user, time.Now())
+}
+
+// recordFailure counts a failed attempt and locks the account once the limit is
+// reached. The count is incremented in the database, so concurrent failures
+// are all counted whatever user was loaded with.
+func (s *PasswordService) recordFailure(user *database.User, now time.Time) error {
+	var attempts int
+	if err := s.db.Raw(`UPDATE users SET failed_password_attempts = failed_password_attempts + 1, updated_at = ?
+		WHERE id = ? RETURNING failed_password_attempts`, now, user.ID).Scan(&attempts).Error; err != nil {
+		return fmt.Errorf("failed to record password failure: %w", err)
+	}
+	user.FailedPasswordAttempts = attempts
+
+	maxFailures := s.config.Password.MaxFailures
+	if maxFailures <= 0 || attempts < maxFailures {
+		return nil
+	}
+	// Only the failures that reached the limit lock the account; one already
+	// reset by a concurrent lock is left alone
+	lockedUntil := now.Add(s.config.Password.LockoutDuration)
+	if err := s.db.Model(&database.User{}).
+		Where("id = ? AND failed_password_attempts >= ?", user.ID, maxFailures).
+		Updates(map[string]interface{}{
+			"failed_password_attempts": 0,
+			"locked_until":             lockedUntil,
+		}).Error; err != nil {
+		return fmt.Errorf("failed to lock user: %w", err)
+	}
+	user.FailedPasswordAttempts = 0
+	user.LockedUntil = &lockedUntil
+	return nil
+}
+
+// bcryptCost returns password.bcrypt_cost, or bcrypt's default when it is out of range
+func (s *PasswordService) bcryptCost() int {
+	cost := s.config.Password.BcryptCost
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return bcrypt.DefaultCost
+	}
+	return cost
+}
+
+// compareDummy checks password against a hash of the same cost as real ones and
+// ignores the result, so an unknown username or an account without a password
+// takes as long to reject as a wrong password and does not reveal itself
+func (s *PasswordService) compareDummy(password string) {
+	s.dummyHashOnce.Do(func() {
+		s.dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password for timing"), s.bcryptCost())
+	})
+	bcrypt.CompareHashAndPassword(s.dummyHash, []byte(password))
+}
+
+// checkReuse rejects the current password and those in the user's recent history
+func (s *PasswordService) checkReuse(user *database.User, password string) error {
+	if user.Password != "" && bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) == nil {
+		return NewError(CodeValidationFailed, "new password must differ from the current password")
+	}
+
+	limit := s.config.Password.History
+	if limit <= 0 {
+		return nil
+	}
+	var history []database.PasswordHistory
+	if err := s.db.Where("user_id = ?", user.ID).Order("created_at DESC").Limit(limit).Find(&history).Error; err != nil {
+		return fmt.Errorf("failed to load password history: %w", err)
+	}
+	for _, entry := range history {
+		if bcrypt.CompareHashAndPassword([]byte(entry.Hash), []byte(password)) == nil {
+			return NewError(CodeValidationFailed, "password was used recently; the last %d passwords cannot be reused", limit)
+		}
+	}
+	return nil
+}
+
+// recordHistory adds a hash to the user's history and drops entries beyond password.history
+func (s *PasswordService) recordHistory(tx *gorm.DB, userID uuid.UUID, hash string) error {
+	limit := s.config.Password.History
+	if limit <= 0 {
+		return nil
+	}
+
+	if err := tx.Create(&database.PasswordHistory{
+		ID:     uuid.New(),
+		UserID: userID,
+		Hash:   hash,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to record password history: %w", err)
+	}
+
+	if err := tx.Where("user_id = ?", userID).
+		Where("id NOT IN (?)", tx.Model(&database.PasswordHistory{}).Select("id").
+			Where("user_id = ?", userID).Order("created_at DESC").Limit(limit)).
+		Delete(&database.PasswordHistory{}).Error; err != nil {
+		return fmt.Errorf("failed to trim password history: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"log"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PermissionInvalidation is the payload of a permissions.invalidated event. It
+// lists the users whose authorization decisions may have changed, so that
+// downstream caches can drop just those entries.
+type PermissionInvalidation struct {
+	Reason        string      `json:"reason"`
+	UserIDs       []uuid.UUID `json:"user_ids"`
+	RoleIDs       []uuid.UUID `json:"role_ids,omitempty"`
+	PermissionIDs []uuid.UUID `json:"permission_ids,omitempty"`
+	ResourceIDs   []uuid.UUID `json:"resource_ids,omitempty"`
+}
+
+// PermissionEvents resolves the users affected by an authorization change and
+// publishes a permissions.invalidated event. Affected users must be resolved
+// before a deletion, while the join rows still exist.
+type PermissionEvents struct {
+	db  *gorm.DB
+	bus *EventBus
+}
+
+func NewPermissionEvents(db *gorm.DB, bus *EventBus) *PermissionEvents {
+	return &PermissionEvents{db: db, bus: bus}
+}
+
+// UsersForRoles returns the users holding any of the roles
+func (p *PermissionEvents) UsersForRoles(roleIDs ...uuid.UUID) []uuid.UUID {
+	var userIDs []uuid.UUID
+	if p == nil || len(roleIDs) == 0 {
+		return userIDs
+	}
+	if err := p.db.Model(&database.UserRole{}).Distinct("user_id").
+		Where("role_id IN ?", roleIDs).Pluck("user_id", &userIDs).Error; err != nil {
+		log.Printf("Failed to resolve users for roles: %v", err)
+	}
+	return userIDs
+}
+
+// RolesForPermissions returns the roles granting any of the permissions
+func (p *PermissionEvents) RolesForPermissions(permissionIDs ...uuid.UUID) []uuid.UUID {
+	var roleIDs []uuid.UUID
+	if p == nil || len(permissionIDs) == 0 {
+		return roleIDs
+	}
+	if err := p.db.Model(&database.RolePermission{}).Distinct("role_id").
+		Where("permission_id IN ?", permissionIDs).Pluck("role_id", &roleIDs).Error; err != nil {
+		log.Printf("Failed to resolve roles for permissions: %v", err)
+	}
+	return roleIDs
+}
+
+// PermissionsForResources returns the permissions defined on any of the resources
+func (p *PermissionEvents) PermissionsForResources(resourceIDs ...uuid.UUID) []uuid.UUID {
+	var permissionIDs []uuid.UUID
+	if p == nil || len(resourceIDs) == 0 {
+		return permissionIDs
+	}
+	if err := p.db.Model(&database.Permission{}).
+		Where("resource_id IN ?", resourceIDs).Pluck("id", &permissionIDs).Error; err != nil {
+		log.Printf("Failed to resolve permissions for resources: %v", err)
+	}
+	return permissionIDs
+}
+
+// Publish sends a permissions.invalidated event. Events that affect no users
+// are not published.
+func (p *PermissionEvents) Publish(invalidation PermissionInvalidation) {
+	if p == nil || len(invalidation.UserIDs) == 0 {
+		return
+	}
+	p.bus.Publish(EventPermissionsInvalidated, invalidation)
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/YubiApp/internal/database"
@@ -9,23 +10,27 @@ import (
 )
 
 type PermissionService struct {
-	db *gorm.DB
+	db     *gorm.DB
+	events *PermissionEvents
 }
 
-func NewPermissionService(db *gorm.DB) *PermissionService {
-	return &PermissionService{db: db}
+func NewPermissionService(db *gorm.DB, events *PermissionEvents) *PermissionService {
+	return &PermissionService{db: db, events: events}
 }
 
 // CreatePermission creates a new permission
 func (s *PermissionService) CreatePermission(resourceID uuid.UUID, action, effect string) (*database.Permission, error) {
 	if effect != "allow" && effect != "deny" {
-		return nil, fmt.Errorf("effect must be 'allow' or 'deny'")
+		return nil, NewError(CodeValidationFailed, "effect must be 'allow' or 'deny'")
 	}
 
 	// Check if resource exists
 	var resource database.Resource
 	if err := s.db.Where("id = ?", resourceID).First(&resource).Error; err != nil {
-		return nil, fmt.Errorf("resource not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "resource not found")
+		}
+		return nil, fmt.Errorf("failed to get resource: %w", err)
 	}
 
 	permission := database.Permission{
@@ -46,7 +51,10 @@ func (s *PermissionService) CreatePermission(resourceID uuid.UUID, action, effec
 func (s *PermissionService) GetPermissionByID(permissionID uuid.UUID) (*database.Permission, error) {
 	var permission database.Permission
 	if err := s.db.Preload("Resource").Where("id = ?", permissionID).First(&permission).Error; err != nil {
-		return nil, fmt.Errorf("permission not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "permission not found")
+		}
+		return nil, fmt.Errorf("failed to get permission: %w", err)
 	}
 	return &permission, nil
 }
@@ -54,7 +62,7 @@ func (s *PermissionService) GetPermissionByID(permissionID uuid.UUID) (*database
 // ListPermissions retrieves all permissions
 func (s *PermissionService) ListPermissions() ([]database.Permission, error) {
 	var permissions []database.Permission
-	if err := s.db.Preload("Resource").Find(&permissions).Error; err != nil {
+	if err := database.ReadReplica(s.db).Preload("Resource").Find(&permissions).Error; err != nil {
 		return nil, fmt.Errorf("failed to fetch permissions: %w", err)
 	}
 	return permissions, nil
@@ -64,13 +72,26 @@ func (s *PermissionService) ListPermissions() ([]database.Permission, error) {
 func (s *PermissionService) DeletePermission(permissionID uuid.UUID) error {
 	var permission database.Permission
 	if err := s.db.Preload("Resource").Where("id = ?", permissionID).First(&permission).Error; err != nil {
-		return fmt.Errorf("permission not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return NewError(CodeNotFound, "permission not found")
+		}
+		return fmt.Errorf("failed to get permission: %w", err)
 	}
 
+	roleIDs := s.events.RolesForPermissions(permission.ID)
+	userIDs := s.events.UsersForRoles(roleIDs...)
+
 	if err := s.db.Delete(&permission).Error; err != nil {
 		return fmt.Errorf("failed to delete permission: %w", err)
 	}
 
+	s.events.Publish(PermissionInvalidation{
+		Reason:        "permission_deleted",
+		UserIDs:       userIDs,
+		RoleIDs:       roleIDs,
+		PermissionIDs: []uuid.UUID{permission.ID},
+	})
+
 	return nil
 }
 
@@ -78,7 +99,10 @@ func (s *PermissionService) DeletePermission(permissionID uuid.UUID) error {
 func (s *PermissionService) CheckUserPermission(userID uuid.UUID, resourceName, action string) (bool, error) {
 	var user database.User
 	if err := s.db.Preload("Roles.Permissions.Resource").Where("id = ?", userID).First(&user).Error; err != nil {
-		return false, fmt.Errorf("user not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, NewError(CodeNotFound, "user not found")
+		}
+		return false, fmt.Errorf("failed to get user: %w", err)
 	}
 
 	for _, role := range user.Roles {
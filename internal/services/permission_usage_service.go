@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// permissionUsageOverlap is how far before the previous run each run looks
+// again, for authentication logs queued by the AuthLogWriter and inserted after
+// it with the time they were logged
+const permissionUsageOverlap = 5 * time.Minute
+
+// PermissionUsageFilter selects the grants of a permission usage report
+type PermissionUsageFilter struct {
+	RoleID     *uuid.UUID
+	UnusedDays int // 0 uses permission_usage.unused_days
+}
+
+// PermissionGrantUsage is when one role's grant of a permission was last used
+type PermissionGrantUsage struct {
+	RoleID       uuid.UUID  `json:"role_id"`
+	Role         string     `json:"role"`
+	PermissionID uuid.UUID  `json:"permission_id"`
+	Resource     string     `json:"resource"`
+	Action       string     `json:"action"`
+	GrantedAt    *time.Time `json:"granted_at"`
+	LastUsedAt   *time.Time `json:"last_used_at"` // nil when never used
+	LastUsedBy   string     `json:"last_used_by,omitempty"`
+	DaysUnused   int        `json:"days_unused"` // Days since last use, or since the grant when never used
+}
+
+// PermissionUsageReport lists when each allow grant was last used and the
+// grants unused for UnusedDays, for least-privilege reviews
+type PermissionUsageReport struct {
+	UnusedDays int                    `json:"unused_days"`
+	Grants     []PermissionGrantUsage `json:"grants"` // By role, resource and action
+	Unused     []PermissionGrantUsage `json:"unused"` // Longest unused first: revocation candidates
+}
+
+// PermissionUsageService tracks which permissions are exercised, from the
+// permission_checked of successful authentications, into permission_usage
+// every permission_usage.track_interval, and reports on it
+type PermissionUsageService struct {
+	db     *gorm.DB
+	config config.PermissionUsageConfig
+	stop   chan struct{}
+
+	trackedThrough time.Time // Zero until this process has tracked usage
+}
+
+func NewPermissionUsageService(db *gorm.DB, cfg config.PermissionUsageConfig) *PermissionUsageService {
+	return &PermissionUsageService{
+		db:     db,
+		config: cfg,
+	}
+}
+
+// StartTracker tracks usage right away and then periodically. It does nothing
+// when permission_usage.track_interval is zero.
+func (s *PermissionUsageService) StartTracker() {
+	interval := s.config.TrackInterval
+	if interval <= 0 || s.stop != nil {
+		return
+	}
+
+	s.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if _, err := s.TrackUsage(context.Background(), time.Now()); err != nil {
+				log.Printf("Permission usage tracking failed: %v", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopTracker stops the background usage tracker
+func (s *PermissionUsageService) StopTracker() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// TrackUsage records the latest use of each role's grants in the
+// authentication logs since the previous run, returning the number of grants
+// whose last use moved. A use counts for every role of the user that grants
+// the checked permission, given as its ID or as resource:action. The first run
+// of a process starts from the latest use recorded, or from the oldest log.
+func (s *PermissionUsageService) TrackUsage(ctx context.Context, now time.Time) (int64, error) {
+	from := s.trackedThrough
+	if from.IsZero() {
+		var latest *time.Time
+		if err := s.db.WithContext(ctx).Model(&database.PermissionUsage{}).Select("MAX(last_used_at)").Scan(&latest).Error; err != nil {
+			return 0, fmt.Errorf("failed to read permission usage: %w", err)
+		}
+		if latest != nil {
+			from = *latest
+		}
+	}
+	if !from.IsZero() {
+		from = from.Add(-permissionUsageOverlap)
+	}
+
+	result := s.db.WithContext(ctx).Exec(`
+		INSERT INTO permission_usage (role_id, permission_id, last_used_at, last_user_id)
+		SELECT DISTINCT ON (rp.role_id, rp.permission_id) rp.role_id, rp.permission_id, al.created_at, al.user_id
+		FROM authentication_logs al
+		JOIN user_roles ur ON ur.user_id = al.user_id
+		JOIN role_permissions rp ON rp.role_id = ur.role_id
+		JOIN permissions p ON p.id = rp.permission_id AND p.effect = 'allow'
+		JOIN resources res ON res.id = p.resource_id
+		WHERE al.created_at >= ? AND al.created_at < ? AND al.success
+			AND al.details->>'permission_checked' IN (p.id::text, res.name || ':' || p.action)
+		ORDER BY rp.role_id, rp.permission_id, al.created_at DESC
+		ON CONFLICT (role_id, permission_id) DO UPDATE
+			SET last_used_at = EXCLUDED.last_used_at, last_user_id = EXCLUDED.last_user_id
+			WHERE permission_usage.last_used_at < EXCLUDED.last_used_at
+	`, from, now)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to track permission usage: %w", result.Error)
+	}
+	s.trackedThrough = now
+	return result.RowsAffected, nil
+}
+
+type permissionGrantRow struct {
+	RoleID       uuid.UUID
+	Role         string
+	PermissionID uuid.UUID
+	Resource     string
+	Action       string
+	GrantedAt    *time.Time
+	LastUsedAt   *time.Time
+	LastUsedBy   *string
+}
+
+// GetUsage reports when each allow grant, of the filter's role or all, was
+// last used, and the grants unused for UnusedDays as of now
+func (s *PermissionUsageService) GetUsage(filter PermissionUsageFilter, now time.Time) (*PermissionUsageReport, error) {
+	if filter.UnusedDays <= 0 {
+		filter.UnusedDays = s.config.UnusedDays
+	}
+
+	query := database.ReadReplica(s.db).Table("role_permissions rp").
+		Select(`rp.role_id, r.name AS role, rp.permission_id, res.name AS resource, p.action,
+			rp.created_at AS granted_at, pu.last_used_at, u.username AS last_used_by`).
+		Joins("JOIN roles r ON r.id = rp.role_id").
+		Joins("JOIN permissions p ON p.id = rp.permission_id AND p.effect = 'allow'").
+		Joins("JOIN resources res ON res.id = p.resource_id").
+		Joins("LEFT JOIN permission_usage pu ON pu.role_id = rp.role_id AND pu.permission_id = rp.permission_id").
+		Joins("LEFT JOIN users u ON u.id = pu.last_user_id")
+	if filter.RoleID != nil {
+		query = query.Where("rp.role_id = ?", *filter.RoleID)
+	}
+	var rows []permissionGrantRow
+	if err := query.Order("r.name, res.name, p.action").Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch permission grants: %w", err)
+	}
+
+	report := &PermissionUsageReport{
+		UnusedDays: filter.UnusedDays,
+		Grants:     make([]PermissionGrantUsage, 0, len(rows)),
+		Unused:     []PermissionGrantUsage{},
+	}
+	for _, row := range rows {
+		usage := PermissionGrantUsage{
+			RoleID:       row.RoleID,
+			Role:         row.Role,
+			PermissionID: row.PermissionID,
+			Resource:     row.Resource,
+			Action:       row.Action,
+			GrantedAt:    row.GrantedAt,
+			LastUsedAt:   row.LastUsedAt,
+		}
+		if row.LastUsedBy != nil {
+			usage.LastUsedBy = *row.LastUsedBy
+		}
+
+		since := now
+		if row.LastUsedAt != nil {
+			since = *row.LastUsedAt
+		} else if row.GrantedAt != nil {
+			since = *row.GrantedAt
+		}
+		usage.DaysUnused = max(int(now.Sub(since)/(24*time.Hour)), 0)
+
+		report.Grants = append(report.Grants, usage)
+		if usage.DaysUnused >= filter.UnusedDays {
+			report.Unused = append(report.Unused, usage)
+		}
+	}
+
+	sort.SliceStable(report.Unused, func(i, j int) bool { return report.Unused[i].DaysUnused > report.Unused[j].DaysUnused })
+	return report, nil
+}
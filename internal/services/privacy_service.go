@@ -0,0 +1,404 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+	"gorm.io/gorm"
+)
+
+// PrivacyPermission is required for GDPR exports, erasures and their audit trail
+const PrivacyPermission = "yubiapp:gdpr"
+
+// PrivacyService implements GDPR data export and erasure for users. Every
+// request, including rejected and failed ones, is recorded as a PrivacyRequest.
+type PrivacyService struct {
+	db         *gorm.DB
+	events     *PermissionEvents
+	legalHolds *LegalHoldService
+}
+
+func NewPrivacyService(db *gorm.DB, events *PermissionEvents, legalHolds *LegalHoldService) *PrivacyService {
+	return &PrivacyService{
+		db:         db,
+		events:     events,
+		legalHolds: legalHolds,
+	}
+}
+
+// PrivacyRequestContext identifies who asked for an export or erasure and why
+type PrivacyRequestContext struct {
+	RequestedByID uuid.UUID
+	Reason        string
+	IPAddress     string
+	UserAgent     string
+}
+
+// PrivacyRejectedError is returned when a request is refused, e.g. because of a legal hold
+type PrivacyRejectedError struct {
+	Message string
+}
+
+func (e *PrivacyRejectedError) Error() string {
+	return e.Message
+}
+
+// UserDataExport is the machine-readable archive of everything held about a user
+type UserDataExport struct {
+	ExportedAt          time.Time                      `json:"exported_at"`
+	RequestID           uuid.UUID                      `json:"request_id"`
+	Profile             UserProfileExport              `json:"profile"`
+	Roles               []string                       `json:"roles"`
+	Devices             []DeviceExport                 `json:"devices"`
+	Activities          []database.UserActivityHistory `json:"activities"`
+	AuthenticationLogs  []database.AuthenticationLog   `json:"authentication_logs"`
+	DeviceRegistrations []database.DeviceRegistration  `json:"device_registrations"`
+	DoorEvents          []database.DoorEvent           `json:"door_events"`
+}
+
+// UserProfileExport is a user's profile without credentials
+type UserProfileExport struct {
+	ID           uuid.UUID  `json:"id"`
+	Email        string     `json:"email"`
+	Username     string     `json:"username"`
+	FirstName    string     `json:"first_name"`
+	LastName     string     `json:"last_name"`
+	UnixUsername string     `json:"unix_username"`
+	Active       bool       `json:"active"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
+}
+
+// DeviceExport is a device without its secret
+type DeviceExport struct {
+	ID           uuid.UUID  `json:"id"`
+	Name         string     `json:"name"`
+	Type         string     `json:"type"`
+	SerialNumber string     `json:"serial_number"`
+	Identifier   string     `json:"identifier"`
+	Active       bool       `json:"active"`
+	VerifiedAt   time.Time  `json:"verified_at"`
+	LastUsedAt   time.Time  `json:"last_used_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
+}
+
+// ExportUserData builds the archive for a user and records the request
+func (s *PrivacyService) ExportUserData(userID uuid.UUID, ctx PrivacyRequestContext) (*UserDataExport, error) {
+	var user database.User
+	if err := s.db.Unscoped().Preload("Roles").Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "user not found")
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	export := &UserDataExport{
+		ExportedAt: time.Now(),
+		Profile: UserProfileExport{
+			ID:           user.ID,
+			Email:        user.Email,
+			Username:     user.Username,
+			FirstName:    user.FirstName,
+			LastName:     user.LastName,
+			UnixUsername: user.UnixUsername,
+			Active:       user.Active,
+			CreatedAt:    user.CreatedAt,
+			UpdatedAt:    user.UpdatedAt,
+		},
+		Roles:   make([]string, 0, len(user.Roles)),
+		Devices: []DeviceExport{},
+	}
+	if user.DeletedAt.Valid {
+		export.Profile.DeletedAt = &user.DeletedAt.Time
+	}
+	for _, role := range user.Roles {
+		export.Roles = append(export.Roles, role.Name)
+	}
+
+	err := s.collectExport(userID, export)
+	if err != nil {
+		s.record("export", &userID, ctx, "failed", err.Error(), nil)
+		return nil, err
+	}
+
+	request, err := s.record("export", &userID, ctx, "completed", "", map[string]interface{}{
+		"devices":              len(export.Devices),
+		"activities":           len(export.Activities),
+		"authentication_logs":  len(export.AuthenticationLogs),
+		"device_registrations": len(export.DeviceRegistrations),
+		"door_events":          len(export.DoorEvents),
+	})
+	if err != nil {
+		return nil, err
+	}
+	export.RequestID = request.ID
+	return export, nil
+}
+
+// collectExport loads the records that belong to a user into the export
+func (s *PrivacyService) collectExport(userID uuid.UUID, export *UserDataExport) error {
+	var devices []database.Device
+	if err := s.db.Unscoped().Where("user_id = ?", userID).Order("created_at").Find(&devices).Error; err != nil {
+		return fmt.Errorf("failed to export devices: %w", err)
+	}
+	for _, device := range devices {
+		d := DeviceExport{
+			ID:           device.ID,
+			Name:         device.Name,
+			Type:         device.Type,
+			SerialNumber: device.SerialNumber,
+			Identifier:   device.Identifier,
+			Active:       device.Active,
+			VerifiedAt:   device.VerifiedAt,
+			LastUsedAt:   device.LastUsedAt,
+			CreatedAt:    device.CreatedAt,
+		}
+		if device.DeletedAt.Valid {
+			d.DeletedAt = &device.DeletedAt.Time
+		}
+		export.Devices = append(export.Devices, d)
+	}
+
+	if err := s.db.Preload("Action").Preload("Location").Preload("Status").
+		Where("user_id = ?", userID).Order("from_datetime").
+		Find(&export.Activities).Error; err != nil {
+		return fmt.Errorf("failed to export activities: %w", err)
+	}
+	if err := s.db.Where("user_id = ?", userID).Order("created_at").Find(&export.AuthenticationLogs).Error; err != nil {
+		return fmt.Errorf("failed to export authentication logs: %w", err)
+	}
+	if err := s.db.Where("registrar_user_id = ? OR target_user_id = ?", userID, userID).Order("created_at").
+		Find(&export.DeviceRegistrations).Error; err != nil {
+		return fmt.Errorf("failed to export device registrations: %w", err)
+	}
+	if err := s.db.Where("user_id = ?", userID).Order("created_at").Find(&export.DoorEvents).Error; err != nil {
+		return fmt.Errorf("failed to export door events: %w", err)
+	}
+	return nil
+}
+
+// EraseUserData anonymizes a user's personal data: the profile is replaced with
+// placeholders, devices are revoked and stripped of identifiers, and client
+// addresses and free-form details are cleared from logs and activity. The rows
+// themselves are kept so aggregate statistics (hours worked, action counts) still
+// add up. Users with records under a legal hold cannot be erased.
+func (s *PrivacyService) EraseUserData(userID uuid.UUID, ctx PrivacyRequestContext) (*database.PrivacyRequest, error) {
+	var user database.User
+	if err := s.db.Unscoped().Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "user not found")
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if ctx.RequestedByID == userID {
+		return nil, s.reject(userID, ctx, "users cannot erase their own account")
+	}
+
+	held, err := s.isUnderLegalHold(userID)
+	if err != nil {
+		return nil, err
+	}
+	if held {
+		return nil, s.reject(userID, ctx, "user or some of their records are under a legal hold")
+	}
+
+	summary := map[string]interface{}{}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		placeholder := "erased-" + user.ID.String()
+		if err := tx.Unscoped().Model(&database.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"email":         placeholder + "@erased.invalid",
+			"username":      placeholder,
+			"password":      "",
+			"first_name":    "",
+			"last_name":     "",
+			"unix_username": "",
+			"active":        false,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to anonymize profile: %w", err)
+		}
+
+		if err := tx.Where("user_id = ?", userID).Delete(&database.PasswordHistory{}).Error; err != nil {
+			return fmt.Errorf("failed to delete password history: %w", err)
+		}
+		if err := tx.Model(&database.PasswordResetLog{}).Where("user_id = ?", userID).Updates(map[string]interface{}{
+			"identifier": "",
+			"ip_address": "",
+			"user_agent": "",
+		}).Error; err != nil {
+			return fmt.Errorf("failed to anonymize password reset log: %w", err)
+		}
+
+		if err := tx.Where("user_id = ?", userID).Delete(&database.RecoveryCode{}).Error; err != nil {
+			return fmt.Errorf("failed to delete recovery codes: %w", err)
+		}
+		if err := tx.Model(&database.SecurityIncident{}).Where("user_id = ?", userID).Updates(map[string]interface{}{
+			"details":    "",
+			"ip_address": "",
+			"user_agent": "",
+		}).Error; err != nil {
+			return fmt.Errorf("failed to anonymize security incidents: %w", err)
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&database.HRNotificationOptOut{}).Error; err != nil {
+			return fmt.Errorf("failed to delete HR notification opt-outs: %w", err)
+		}
+		if err := tx.Model(&database.HRNotification{}).Where("user_id = ?", userID).Updates(map[string]interface{}{
+			"subject": "",
+			"body":    "",
+		}).Error; err != nil {
+			return fmt.Errorf("failed to anonymize HR notifications: %w", err)
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&database.ChatUserLink{}).Error; err != nil {
+			return fmt.Errorf("failed to delete chat account links: %w", err)
+		}
+		if err := tx.Model(&database.ActionApproval{}).Where("user_id = ?", userID).Updates(map[string]interface{}{
+			"ip_address": "",
+			"user_agent": "",
+		}).Error; err != nil {
+			return fmt.Errorf("failed to anonymize action approvals: %w", err)
+		}
+
+		res := tx.Unscoped().Model(&database.Device{}).Where("user_id = ?", userID).Updates(map[string]interface{}{
+			"name":          "",
+			"serial_number": "",
+			"identifier":    gorm.Expr("'erased-' || id::text"),
+			"secret":        "",
+			"active":        false,
+			"properties":    nil,
+		})
+		if res.Error != nil {
+			return fmt.Errorf("failed to anonymize devices: %w", res.Error)
+		}
+		summary["devices"] = res.RowsAffected
+
+		res = tx.Model(&database.AuthenticationLog{}).Where("user_id = ?", userID).Updates(map[string]interface{}{
+			"ip_address": "",
+			"user_agent": "",
+			"otp":        "",
+			"details":    gorm.Expr("'{}'::jsonb"),
+		})
+		if res.Error != nil {
+			return fmt.Errorf("failed to anonymize authentication logs: %w", res.Error)
+		}
+		summary["authentication_logs"] = res.RowsAffected
+
+		res = tx.Model(&database.UserActivityHistory{}).Where("user_id = ?", userID).
+			Update("details", gorm.Expr("'{}'::jsonb"))
+		if res.Error != nil {
+			return fmt.Errorf("failed to anonymize activities: %w", res.Error)
+		}
+		summary["activities"] = res.RowsAffected
+
+		res = tx.Model(&database.DeviceRegistration{}).
+			Where("registrar_user_id = ? OR target_user_id = ?", userID, userID).
+			Updates(map[string]interface{}{
+				"ip_address": "",
+				"user_agent": "",
+				"notes":      "",
+				"reason":     "",
+			})
+		if res.Error != nil {
+			return fmt.Errorf("failed to anonymize device registrations: %w", res.Error)
+		}
+		summary["device_registrations"] = res.RowsAffected
+		return nil
+	})
+	if err != nil {
+		s.record("erase", &userID, ctx, "failed", err.Error(), nil)
+		return nil, err
+	}
+
+	// The erased account loses all access
+	s.events.Publish(PermissionInvalidation{
+		Reason:  "user_erased",
+		UserIDs: []uuid.UUID{userID},
+	})
+
+	return s.record("erase", &userID, ctx, "completed", "", summary)
+}
+
+// ListPrivacyRequests retrieves the audit trail, newest first, optionally for one user
+func (s *PrivacyService) ListPrivacyRequests(userID *uuid.UUID) ([]database.PrivacyRequest, error) {
+	var requests []database.PrivacyRequest
+	query := s.db.Preload("RequestedBy").Order("created_at DESC")
+	if userID != nil {
+		query = query.Where("subject_user_id = ?", userID)
+	}
+	if err := query.Find(&requests).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch privacy requests: %w", err)
+	}
+	return requests, nil
+}
+
+// IsPrivacyRejected reports whether err is a refused privacy request
+func IsPrivacyRejected(err error) bool {
+	var rejected *PrivacyRejectedError
+	return errors.As(err, &rejected)
+}
+
+// isUnderLegalHold reports whether a hold names the user or covers any of their logs or activity
+func (s *PrivacyService) isUnderLegalHold(userID uuid.UUID) (bool, error) {
+	if named, err := s.legalHolds.IsUserHeld(userID); err != nil || named {
+		return named, err
+	}
+
+	for _, source := range []struct {
+		model      interface{}
+		timeColumn string
+	}{
+		{&database.AuthenticationLog{}, "created_at"},
+		{&database.UserActivityHistory{}, "from_datetime"},
+	} {
+		var all, unheld int64
+		if err := s.db.Model(source.model).Where("user_id = ?", userID).Count(&all).Error; err != nil {
+			return false, fmt.Errorf("failed to check legal holds: %w", err)
+		}
+		query := s.db.Model(source.model).Where("user_id = ?", userID)
+		if err := ExcludeHeldRecords(query, "user_id", source.timeColumn).Count(&unheld).Error; err != nil {
+			return false, fmt.Errorf("failed to check legal holds: %w", err)
+		}
+		if all > unheld {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// reject records a refused request and returns the error for the caller
+func (s *PrivacyService) reject(userID uuid.UUID, ctx PrivacyRequestContext, message string) error {
+	s.record("erase", &userID, ctx, "rejected", message, nil)
+	return &PrivacyRejectedError{Message: message}
+}
+
+// record writes the audit entry for a request
+func (s *PrivacyService) record(requestType string, userID *uuid.UUID, ctx PrivacyRequestContext, status, errMessage string, summary map[string]interface{}) (*database.PrivacyRequest, error) {
+	request := database.PrivacyRequest{
+		ID:            uuid.New(),
+		Type:          requestType,
+		SubjectUserID: userID,
+		RequestedByID: ctx.RequestedByID,
+		Reason:        ctx.Reason,
+		Status:        status,
+		Error:         errMessage,
+		IPAddress:     ctx.IPAddress,
+		UserAgent:     ctx.UserAgent,
+	}
+	if summary == nil {
+		summary = map[string]interface{}{}
+	}
+	var summaryJSONB pgtype.JSONB
+	if err := summaryJSONB.Set(summary); err != nil {
+		return nil, fmt.Errorf("failed to convert summary to JSONB: %w", err)
+	}
+	request.Summary = summaryJSONB
+
+	if err := s.db.Create(&request).Error; err != nil {
+		return nil, fmt.Errorf("failed to record privacy request: %w", err)
+	}
+	return &request, nil
+}
@@ -0,0 +1,297 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Push challenge statuses
+const (
+	PushChallengePending  = "pending"
+	PushChallengeApproved = "approved"
+	PushChallengeDenied   = "denied"
+	PushChallengeRedeemed = "redeemed" // Approved and used to authenticate
+)
+
+// Reasons a push challenge was denied
+const (
+	PushDeniedByUser         = "denied"
+	PushDeniedNumberMismatch = "number_mismatch"
+)
+
+// PushChallenge is a sign-in waiting for the user to approve or deny it in the
+// mobile app
+type PushChallenge struct {
+	ID         string     `json:"id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	Status     string     `json:"status"`
+	Number     int        `json:"-"`         // Shown at sign-in and entered in the app; 0 without number matching
+	DeviceID   *uuid.UUID `json:"device_id"` // The device that answered
+	Reason     string     `json:"reason,omitempty"`
+	Permission string     `json:"permission,omitempty"`
+	IPAddress  string     `json:"ip_address"`
+	UserAgent  string     `json:"user_agent"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+}
+
+// PushChallenges keeps push challenges in Redis until push.challenge_ttl, so
+// any API instance can answer, wait on or redeem them. Answers are published
+// on a channel per challenge for the clients long-polling for them.
+type PushChallenges struct {
+	client redis.UniversalClient
+	ttl    time.Duration
+}
+
+func NewPushChallenges(client redis.UniversalClient, ttl time.Duration) *PushChallenges {
+	return &PushChallenges{client: client, ttl: ttl}
+}
+
+func pushChallengeKey(id string) string {
+	return "push_challenge:" + id
+}
+
+func pushChallengeChannel(id string) string {
+	return "push_challenge_answered:" + id
+}
+
+// pushPendingKey holds the user's unanswered challenge, so a sign-in cannot
+// send another push until that one is answered or expires
+func pushPendingKey(userID uuid.UUID) string {
+	return "push_pending:" + userID.String()
+}
+
+// hashChallengeSecret hashes a challenge's response or poll token; only hashes
+// are stored
+func hashChallengeSecret(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// answerPushChallengeScript answers challenge KEYS[1] with status ARGV[1] and
+// reason ARGV[4] from device ARGV[2] holding response token hash ARGV[3], then
+// publishes the status on channel ARGV[5]. It returns 0 when the challenge does
+// not exist, -1 when it was already answered and -2 for a wrong token.
+var answerPushChallengeScript = redis.NewScript(`
+local status = redis.call('HGET', KEYS[1], 'status')
+if not status then
+  return 0
+end
+if status ~= 'pending' then
+  return -1
+end
+if redis.call('HGET', KEYS[1], 'token:' .. ARGV[2]) ~= ARGV[3] then
+  return -2
+end
+redis.call('HSET', KEYS[1], 'status', ARGV[1], 'device_id', ARGV[2], 'reason', ARGV[4])
+redis.call('PUBLISH', ARGV[5], ARGV[1])
+return 1
+`)
+
+// redeemApprovedScript marks the approved challenge at KEYS[1] redeemed,
+// returning its status before; shared by push and QR login challenges
+var redeemApprovedScript = redis.NewScript(`
+local status = redis.call('HGET', KEYS[1], 'status')
+if status == 'approved' then
+  redis.call('HSET', KEYS[1], 'status', 'redeemed')
+end
+return status
+`)
+
+// Create stores a pending challenge for the user, with the response token sent
+// to each of devices. It fails with RATE_LIMITED while the user has another
+// challenge unanswered.
+func (c *PushChallenges) Create(ctx context.Context, challenge *PushChallenge, tokens map[uuid.UUID]string) error {
+	challenge.ID = uuid.New().String()
+	challenge.Status = PushChallengePending
+	challenge.ExpiresAt = time.Now().Add(c.ttl)
+
+	free, err := c.client.SetNX(ctx, pushPendingKey(challenge.UserID), challenge.ID, c.ttl).Result()
+	if err != nil {
+		return fmt.Errorf("failed to store push challenge: %w", err)
+	}
+	if !free {
+		return NewError(CodeRateLimited, "another push challenge is waiting for an answer; answer it or wait for it to expire")
+	}
+
+	fields := map[string]interface{}{
+		"user_id":    challenge.UserID.String(),
+		"status":     challenge.Status,
+		"number":     challenge.Number,
+		"permission": challenge.Permission,
+		"ip_address": challenge.IPAddress,
+		"user_agent": challenge.UserAgent,
+		"expires_at": challenge.ExpiresAt.Unix(),
+	}
+	for deviceID, token := range tokens {
+		fields["token:"+deviceID.String()] = hashChallengeSecret(token)
+	}
+	key := pushChallengeKey(challenge.ID)
+	_, err = c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, fields)
+		pipe.Expire(ctx, key, c.ttl)
+		return nil
+	})
+	if err != nil {
+		c.client.Del(ctx, pushPendingKey(challenge.UserID))
+		return fmt.Errorf("failed to store push challenge: %w", err)
+	}
+	return nil
+}
+
+// Discard deletes a challenge that could not be sent, so the user can start
+// another straight away
+func (c *PushChallenges) Discard(ctx context.Context, challenge *PushChallenge) {
+	c.client.Del(ctx, pushChallengeKey(challenge.ID), pushPendingKey(challenge.UserID))
+}
+
+// Get returns a challenge, failing with NOT_FOUND once it has expired
+func (c *PushChallenges) Get(ctx context.Context, id string) (*PushChallenge, error) {
+	fields, err := c.client.HGetAll(ctx, pushChallengeKey(id)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read push challenge: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, NewError(CodeNotFound, "push challenge not found or expired")
+	}
+
+	challenge := &PushChallenge{
+		ID:         id,
+		Status:     fields["status"],
+		Reason:     fields["reason"],
+		Permission: fields["permission"],
+		IPAddress:  fields["ip_address"],
+		UserAgent:  fields["user_agent"],
+	}
+	challenge.UserID, _ = uuid.Parse(fields["user_id"])
+	challenge.Number, _ = strconv.Atoi(fields["number"])
+	if deviceID, err := uuid.Parse(fields["device_id"]); err == nil {
+		challenge.DeviceID = &deviceID
+	}
+	if expiresAt, err := strconv.ParseInt(fields["expires_at"], 10, 64); err == nil {
+		challenge.ExpiresAt = time.Unix(expiresAt, 0)
+	}
+	return challenge, nil
+}
+
+// Answer records the answer from deviceID, which must present the response
+// token it was sent. Only a pending challenge can be answered.
+func (c *PushChallenges) Answer(ctx context.Context, challenge *PushChallenge, deviceID uuid.UUID, token, status, reason string) error {
+	result, err := answerPushChallengeScript.Run(ctx, c.client, []string{pushChallengeKey(challenge.ID)},
+		status, deviceID.String(), hashChallengeSecret(token), reason, pushChallengeChannel(challenge.ID)).Int()
+	if err != nil {
+		return fmt.Errorf("failed to answer push challenge: %w", err)
+	}
+	switch result {
+	case 0:
+		return NewError(CodeNotFound, "push challenge not found or expired")
+	case -1:
+		return NewError(CodeConflict, "push challenge was already answered")
+	case -2:
+		return NewError(CodeAuthFailed, "invalid response token for push challenge")
+	}
+	c.client.Del(ctx, pushPendingKey(challenge.UserID))
+	challenge.Status = status
+	challenge.Reason = reason
+	challenge.DeviceID = &deviceID
+	return nil
+}
+
+// Wait returns the challenge once it is answered, or as it is after timeout
+// or when ctx is done
+func (c *PushChallenges) Wait(ctx context.Context, id string, timeout time.Duration) (*PushChallenge, error) {
+	var challenge *PushChallenge
+	err := awaitPublish(ctx, c.client, pushChallengeChannel(id), timeout, func() (bool, error) {
+		var err error
+		challenge, err = c.Get(ctx, id)
+		return err == nil && challenge.Status != PushChallengePending, err
+	})
+	if err != nil || challenge.Status != PushChallengePending || timeout <= 0 || ctx.Err() != nil {
+		return challenge, err
+	}
+	return c.Get(ctx, id)
+}
+
+// Redeem marks an approved challenge used, so it authenticates one request
+func (c *PushChallenges) Redeem(ctx context.Context, id string) (*PushChallenge, error) {
+	challenge, err := c.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	status, err := redeemApprovedScript.Run(ctx, c.client, []string{pushChallengeKey(id)}).Text()
+	if err == redis.Nil {
+		return nil, NewError(CodeNotFound, "push challenge not found or expired")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to redeem push challenge: %w", err)
+	}
+
+	switch status {
+	case PushChallengeApproved:
+		return challenge, nil
+	case PushChallengePending:
+		return nil, NewError(CodePushPending, "push challenge has not been answered yet")
+	case PushChallengeDenied:
+		if challenge.Reason == PushDeniedNumberMismatch {
+			return nil, NewError(CodePushDenied, "push challenge was denied: the number entered did not match")
+		}
+		return nil, NewError(CodePushDenied, "push challenge was denied")
+	}
+	return nil, NewError(CodeAuthFailed, "push challenge was already used")
+}
+
+// newPushChallengeNumber picks the two-digit number for number matching
+func newPushChallengeNumber() (int, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(90))
+	if err != nil {
+		return 0, err
+	}
+	return int(n.Int64()) + 10, nil
+}
+
+// newChallengeSecret generates a secret that proves its holder was given it:
+// the token a device answers a push with, or the one a terminal polls with
+func newChallengeSecret() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// pushNumberMatches compares the number entered in the app in constant time
+func pushNumberMatches(challenge *PushChallenge, number int) bool {
+	return subtle.ConstantTimeEq(int32(challenge.Number), int32(number)) == 1
+}
+
+// authenticatePush redeems an approved push challenge, given by its ID, for
+// the device that approved it. The challenge only authenticates a request for
+// the permission it was started for, which the app showed the user.
+func (s *AuthService) authenticatePush(ctx context.Context, challengeID, requiredPermission string) (*database.Device, error) {
+	if s.pushChallenges == nil {
+		return nil, NewError(CodeValidationFailed, "push authentication is not available")
+	}
+	challenge, err := s.pushChallenges.Redeem(ctx, challengeID)
+	if err != nil {
+		return nil, err
+	}
+	if challenge.Permission != requiredPermission {
+		return nil, NewError(CodePermissionDenied, "push challenge was approved for permission %q, not %q", challenge.Permission, requiredPermission)
+	}
+
+	var device database.Device
+	if err := s.stmtDB.WithContext(ctx).Where("id = ? AND type = ?", challenge.DeviceID, "push").First(&device).Error; err != nil {
+		return nil, fmt.Errorf("device not found: %w", err)
+	}
+	return &device, nil
+}
@@ -0,0 +1,295 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	fcmScope         = "https://www.googleapis.com/auth/firebase.messaging"
+	fcmTokenURI      = "https://oauth2.googleapis.com/token"
+	apnsHost         = "https://api.push.apple.com"
+	apnsSandboxHost  = "https://api.sandbox.push.apple.com"
+	apnsTokenRefresh = 50 * time.Minute // APNs refuses provider tokens older than an hour
+)
+
+// pushNotification is a notification shown on the device, with the data the
+// app reads from it
+type pushNotification struct {
+	Title     string
+	Body      string
+	Data      map[string]string
+	ExpiresAt time.Time // Not delivered after this
+}
+
+// fcmServiceAccount is the part of a Firebase service account key used to get
+// access tokens
+type fcmServiceAccount struct {
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// pushSender delivers notifications to FCM (Android) and APNs (iOS) devices.
+// Access tokens for FCM and provider tokens for APNs are cached until shortly
+// before they expire.
+type pushSender struct {
+	httpClient *http.Client
+	config     config.PushConfig
+
+	fcmAccount *fcmServiceAccount
+	fcmKey     *rsa.PrivateKey
+	apnsKey    *ecdsa.PrivateKey
+
+	mu              sync.Mutex
+	fcmToken        string
+	fcmTokenExpiry  time.Time
+	apnsToken       string
+	apnsTokenIssued time.Time
+}
+
+// newPushSender loads the credentials in push.fcm and push.apns; a platform
+// without credentials cannot be sent to
+func newPushSender(cfg config.PushConfig) (*pushSender, error) {
+	sender := &pushSender{
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		config:     cfg,
+	}
+
+	if cfg.FCM.CredentialsFile != "" {
+		data, err := os.ReadFile(cfg.FCM.CredentialsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read push.fcm.credentials_file: %w", err)
+		}
+		var account fcmServiceAccount
+		if err := json.Unmarshal(data, &account); err != nil {
+			return nil, fmt.Errorf("push.fcm.credentials_file is not a service account key: %w", err)
+		}
+		if sender.fcmKey, err = jwt.ParseRSAPrivateKeyFromPEM([]byte(account.PrivateKey)); err != nil {
+			return nil, fmt.Errorf("push.fcm.credentials_file has no usable private key: %w", err)
+		}
+		if cfg.FCM.ProjectID != "" {
+			account.ProjectID = cfg.FCM.ProjectID
+		}
+		if account.TokenURI == "" {
+			account.TokenURI = fcmTokenURI
+		}
+		sender.fcmAccount = &account
+	}
+
+	if cfg.APNs.KeyFile != "" {
+		data, err := os.ReadFile(cfg.APNs.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read push.apns.key_file: %w", err)
+		}
+		if sender.apnsKey, err = jwt.ParseECPrivateKeyFromPEM(data); err != nil {
+			return nil, fmt.Errorf("push.apns.key_file is not an APNs signing key: %w", err)
+		}
+	}
+	return sender, nil
+}
+
+// send delivers a notification to a push device through its platform
+func (s *pushSender) send(ctx context.Context, device *database.Device, notification pushNotification) error {
+	if device.PushToken == "" {
+		return fmt.Errorf("device %s has no push token", device.ID)
+	}
+	switch device.PushPlatform {
+	case "fcm":
+		return s.sendFCM(ctx, device.PushToken, notification)
+	case "apns":
+		return s.sendAPNs(ctx, device.PushToken, notification)
+	}
+	return fmt.Errorf("device %s has unknown push platform %q", device.ID, device.PushPlatform)
+}
+
+// sendFCM sends a high priority message through the FCM HTTP v1 API
+func (s *pushSender) sendFCM(ctx context.Context, token string, notification pushNotification) error {
+	if s.fcmAccount == nil {
+		return fmt.Errorf("FCM is not configured (push.fcm.credentials_file)")
+	}
+	accessToken, err := s.fcmAccessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	ttl := time.Until(notification.ExpiresAt).Round(time.Second)
+	if ttl < 0 {
+		ttl = 0
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"message": map[string]interface{}{
+			"token": token,
+			"data":  notification.Data,
+			"notification": map[string]string{
+				"title": notification.Title,
+				"body":  notification.Body,
+			},
+			"android": map[string]string{
+				"priority": "high",
+				"ttl":      fmt.Sprintf("%ds", int(ttl.Seconds())),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	endpoint := fmt.Sprintf("https://fcm.googleapis.com/v1/projects/%s/messages:send", url.PathEscape(s.fcmAccount.ProjectID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+	return s.do(req, "FCM")
+}
+
+// fcmAccessToken exchanges a JWT signed with the service account key for an
+// OAuth access token
+func (s *pushSender) fcmAccessToken(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fcmToken != "" && time.Now().Before(s.fcmTokenExpiry) {
+		return s.fcmToken, nil
+	}
+
+	now := time.Now()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   s.fcmAccount.ClientEmail,
+		"scope": fcmScope,
+		"aud":   s.fcmAccount.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(s.fcmKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign FCM token request: %w", err)
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.fcmAccount.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get FCM access token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("failed to get FCM access token: %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to read FCM access token: %w", err)
+	}
+	s.fcmToken = token.AccessToken
+	s.fcmTokenExpiry = now.Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return s.fcmToken, nil
+}
+
+// sendAPNs sends an alert through APNs, with the data alongside aps
+func (s *pushSender) sendAPNs(ctx context.Context, token string, notification pushNotification) error {
+	if s.apnsKey == nil {
+		return fmt.Errorf("APNs is not configured (push.apns.key_file)")
+	}
+	providerToken, err := s.apnsProviderToken()
+	if err != nil {
+		return err
+	}
+
+	payload := map[string]interface{}{
+		"aps": map[string]interface{}{
+			"alert": map[string]string{
+				"title": notification.Title,
+				"body":  notification.Body,
+			},
+			"sound":    "default",
+			"category": "PUSH_CHALLENGE",
+		},
+	}
+	for key, value := range notification.Data {
+		payload[key] = value
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	host := apnsHost
+	if s.config.APNs.Sandbox {
+		host = apnsSandboxHost
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, host+"/3/device/"+url.PathEscape(token), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "bearer "+providerToken)
+	req.Header.Set("apns-topic", s.config.APNs.Topic)
+	req.Header.Set("apns-push-type", "alert")
+	req.Header.Set("apns-priority", "10")
+	req.Header.Set("apns-expiration", fmt.Sprint(notification.ExpiresAt.Unix()))
+	return s.do(req, "APNs")
+}
+
+// apnsProviderToken returns the JWT APNs authenticates the sender with
+func (s *pushSender) apnsProviderToken() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.apnsToken != "" && time.Since(s.apnsTokenIssued) < apnsTokenRefresh {
+		return s.apnsToken, nil
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss": s.config.APNs.TeamID,
+		"iat": now.Unix(),
+	})
+	token.Header["kid"] = s.config.APNs.KeyID
+	signed, err := token.SignedString(s.apnsKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign APNs provider token: %w", err)
+	}
+	s.apnsToken = signed
+	s.apnsTokenIssued = now
+	return signed, nil
+}
+
+// do sends a request to a push service, failing unless it answers 200
+func (s *pushSender) do(req *http.Request, service string) error {
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach %s: %w", service, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s refused the notification: %s: %s", service, resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
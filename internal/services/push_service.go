@@ -0,0 +1,203 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PushService runs push approval. A sign-in starts a challenge, which is sent
+// to the user's push devices; the mobile app approves or denies it, entering
+// the number shown at sign-in when push.number_matching is on. The client
+// long-polls for the answer, then redeems the challenge ID as the auth code of
+// a "push" device.
+type PushService struct {
+	db          *gorm.DB
+	config      config.PushConfig
+	challenges  *PushChallenges
+	sender      *pushSender
+	authService *AuthService
+}
+
+func NewPushService(db *gorm.DB, cfg config.PushConfig, challenges *PushChallenges, authService *AuthService) (*PushService, error) {
+	sender, err := newPushSender(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &PushService{
+		db:          db,
+		config:      cfg,
+		challenges:  challenges,
+		sender:      sender,
+		authService: authService,
+	}, nil
+}
+
+// PushChallengeRequest is a sign-in asking for push approval
+type PushChallengeRequest struct {
+	Login      string // Username or email
+	Permission string // Permission the challenge will be redeemed for, shown in the app
+	IPAddress  string
+	UserAgent  string
+}
+
+// PushAnswer is the mobile app's answer to a challenge
+type PushAnswer struct {
+	DeviceID  uuid.UUID
+	Token     string // The response token the push carried
+	Approve   bool
+	Number    int    // The number entered, with number matching
+	PushToken string // The app's current FCM or APNs token, when it has changed
+}
+
+// Challenge starts a challenge for the user and sends it to each of their
+// active push devices. It fails unless at least one push was sent.
+func (s *PushService) Challenge(ctx context.Context, req PushChallengeRequest) (*PushChallenge, error) {
+	// Unknown users get the same answer as users without push devices
+	noDevices := NewError(CodeAuthFailed, "no push device is registered for this user")
+	var user database.User
+	if err := s.db.WithContext(ctx).Where("username = ? OR email = ?", req.Login, req.Login).First(&user).Error; err != nil {
+		return nil, noDevices
+	}
+	if !user.Active || !UserStateAllowsAuthentication(user.State) {
+		return nil, NewError(CodeAccountInactive, "user is not active")
+	}
+
+	var devices []database.Device
+	if err := s.db.WithContext(ctx).
+		Where("user_id = ? AND type = ? AND active = ? AND push_token <> ''", user.ID, "push", true).
+		Find(&devices).Error; err != nil {
+		return nil, fmt.Errorf("failed to find push devices: %w", err)
+	}
+	if len(devices) == 0 {
+		return nil, noDevices
+	}
+
+	challenge := &PushChallenge{
+		UserID:     user.ID,
+		Permission: req.Permission,
+		IPAddress:  req.IPAddress,
+		UserAgent:  req.UserAgent,
+	}
+	if s.config.NumberMatching {
+		number, err := newPushChallengeNumber()
+		if err != nil {
+			return nil, fmt.Errorf("failed to pick challenge number: %w", err)
+		}
+		challenge.Number = number
+	}
+	tokens := make(map[uuid.UUID]string, len(devices))
+	for _, device := range devices {
+		token, err := newChallengeSecret()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate response token: %w", err)
+		}
+		tokens[device.ID] = token
+	}
+	if err := s.challenges.Create(ctx, challenge, tokens); err != nil {
+		return nil, err
+	}
+
+	sent := 0
+	var lastErr error
+	for i := range devices {
+		device := &devices[i]
+		if err := s.sender.send(ctx, device, s.notification(challenge, device, tokens[device.ID])); err != nil {
+			log.Printf("Failed to send push challenge %s to device %s: %v", challenge.ID, device.ID, err)
+			lastErr = err
+			continue
+		}
+		sent++
+	}
+	if sent == 0 {
+		s.challenges.Discard(ctx, challenge)
+		return nil, WrapError(CodeUpstreamFailed, "failed to send push notification", lastErr)
+	}
+	return challenge, nil
+}
+
+// notification is the push for a challenge to one device. It carries what the
+// app shows the user about the sign-in, but never the number to enter.
+func (s *PushService) notification(challenge *PushChallenge, device *database.Device, token string) pushNotification {
+	body := fmt.Sprintf("Sign-in request from %s", challenge.IPAddress)
+	if challenge.Permission != "" {
+		body += fmt.Sprintf(" for %s", challenge.Permission)
+	}
+	return pushNotification{
+		Title: "Approve sign-in?",
+		Body:  body,
+		Data: map[string]string{
+			"type":            "push_challenge",
+			"challenge_id":    challenge.ID,
+			"device_id":       device.ID.String(),
+			"response_token":  token,
+			"permission":      challenge.Permission,
+			"ip_address":      challenge.IPAddress,
+			"user_agent":      challenge.UserAgent,
+			"number_matching": strconv.FormatBool(challenge.Number != 0),
+			"expires_at":      challenge.ExpiresAt.UTC().Format(time.RFC3339),
+		},
+		ExpiresAt: challenge.ExpiresAt,
+	}
+}
+
+// Wait long-polls for the answer to a challenge, for at most push.max_wait
+func (s *PushService) Wait(ctx context.Context, id string, wait time.Duration) (*PushChallenge, error) {
+	if wait > s.config.MaxWait {
+		wait = s.config.MaxWait
+	}
+	return s.challenges.Wait(ctx, id, wait)
+}
+
+// Answer records the app's answer to a challenge. A wrong number denies the
+// challenge, so a user pushed by repeated sign-ins they did not start cannot
+// approve one by accident. Denials are logged as failed verifications of the
+// device, for alert rules to catch push fatigue attacks.
+func (s *PushService) Answer(ctx context.Context, id string, answer PushAnswer) (*PushChallenge, error) {
+	challenge, err := s.challenges.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var device database.Device
+	if err := s.db.WithContext(ctx).Where("id = ? AND type = ?", answer.DeviceID, "push").First(&device).Error; err != nil {
+		return nil, NewError(CodeAuthFailed, "push device not found")
+	}
+	if device.UserID == nil || *device.UserID != challenge.UserID || !device.Active {
+		return nil, NewError(CodeAuthFailed, "push device cannot answer this challenge")
+	}
+
+	status, reason := PushChallengeApproved, ""
+	switch {
+	case !answer.Approve:
+		status, reason = PushChallengeDenied, PushDeniedByUser
+	case challenge.Number != 0 && !pushNumberMatches(challenge, answer.Number):
+		status, reason = PushChallengeDenied, PushDeniedNumberMismatch
+	}
+	if err := s.challenges.Answer(ctx, challenge, device.ID, answer.Token, status, reason); err != nil {
+		return nil, err
+	}
+
+	if answer.PushToken != "" && answer.PushToken != device.PushToken {
+		if err := s.db.WithContext(ctx).Model(&database.Device{}).Where("id = ?", device.ID).
+			Update("push_token", answer.PushToken).Error; err != nil {
+			log.Printf("Failed to update push token of device %s: %v", device.ID, err)
+		}
+	}
+
+	if status == PushChallengeDenied {
+		denial := NewError(CodePushDenied, "push challenge was denied by the user")
+		if reason == PushDeniedNumberMismatch {
+			denial = NewError(CodePushDenied, "push challenge was denied: the number entered did not match")
+		}
+		s.authService.logFailedVerification(ctx, &device, denial, "")
+	}
+	return challenge, nil
+}
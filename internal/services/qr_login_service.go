@@ -0,0 +1,307 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/logging"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// QR login challenge statuses
+const (
+	QRLoginPending  = "pending"
+	QRLoginApproved = "approved"
+	QRLoginRejected = "rejected"
+	QRLoginRedeemed = "redeemed" // The terminal has its session
+)
+
+// QRLoginChallenge is a shared terminal's QR code, waiting to be approved from
+// a signed-in phone
+type QRLoginChallenge struct {
+	ID                string     `json:"id"`
+	Status            string     `json:"status"`
+	Terminal          string     `json:"terminal"` // Name the terminal gave itself, shown when approving
+	IPAddress         string     `json:"ip_address"`
+	UserAgent         string     `json:"user_agent"`
+	UserID            *uuid.UUID `json:"user_id"`   // Who approved or rejected it
+	DeviceID          *uuid.UUID `json:"device_id"` // The approving session's device
+	ApprovedBySession string     `json:"approved_by_session,omitempty"`
+	ExpiresAt         time.Time  `json:"expires_at"`
+
+	pollTokenHash string
+}
+
+// QRLoginStart is a new challenge with what only the terminal is given: the
+// token it polls with and the payload to show as a QR code
+type QRLoginStart struct {
+	Challenge *QRLoginChallenge
+	PollToken string
+	QRPayload string
+}
+
+// QRLoginService runs cross-device login for shared terminals. The terminal
+// starts a challenge and shows it as a QR code; a user signed in on their
+// phone scans it and approves; the terminal, long-polling with the token only
+// it holds, then gets a session for that user lasting qr_login.session_expiry.
+// Challenges are kept in Redis until qr_login.challenge_ttl, and each can be
+// redeemed for one session.
+type QRLoginService struct {
+	client      redis.UniversalClient
+	config      *config.Config
+	sessions    *SessionService
+	authService *AuthService
+}
+
+func NewQRLoginService(client redis.UniversalClient, cfg *config.Config, sessions *SessionService, authService *AuthService) *QRLoginService {
+	return &QRLoginService{
+		client:      client,
+		config:      cfg,
+		sessions:    sessions,
+		authService: authService,
+	}
+}
+
+func qrLoginKey(id string) string {
+	return "qr_login:" + id
+}
+
+func qrLoginChannel(id string) string {
+	return "qr_login_decided:" + id
+}
+
+// decideQRLoginScript records decision ARGV[1] on challenge KEYS[1] by user
+// ARGV[2] with device ARGV[3] from session ARGV[4], then publishes it on channel
+// ARGV[5]. It returns 0 when the challenge does not exist and -1 when it was
+// already decided.
+var decideQRLoginScript = redis.NewScript(`
+local status = redis.call('HGET', KEYS[1], 'status')
+if not status then
+  return 0
+end
+if status ~= 'pending' then
+  return -1
+end
+redis.call('HSET', KEYS[1], 'status', ARGV[1], 'user_id', ARGV[2], 'device_id', ARGV[3], 'approved_by_session', ARGV[4])
+redis.call('PUBLISH', ARGV[5], ARGV[1])
+return 1
+`)
+
+// Start creates a challenge for the terminal making the request
+func (s *QRLoginService) Start(ctx context.Context, terminal string, client SessionClient) (*QRLoginStart, error) {
+	pollToken, err := newChallengeSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate poll token: %w", err)
+	}
+	ttl := s.config.QRLogin.ChallengeTTL
+	challenge := &QRLoginChallenge{
+		ID:        uuid.New().String(),
+		Status:    QRLoginPending,
+		Terminal:  terminal,
+		IPAddress: client.IPAddress,
+		UserAgent: client.UserAgent,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+
+	key := qrLoginKey(challenge.ID)
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, map[string]interface{}{
+			"status":     challenge.Status,
+			"terminal":   challenge.Terminal,
+			"ip_address": challenge.IPAddress,
+			"user_agent": challenge.UserAgent,
+			"expires_at": challenge.ExpiresAt.Unix(),
+			"poll_token": hashChallengeSecret(pollToken),
+		})
+		pipe.Expire(ctx, key, ttl)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store QR login challenge: %w", err)
+	}
+
+	return &QRLoginStart{
+		Challenge: challenge,
+		PollToken: pollToken,
+		QRPayload: s.qrPayload(challenge.ID),
+	}, nil
+}
+
+// qrPayload is what the QR code holds: a link to qr_login.approval_url when
+// set, else yubiapp-qr:<id> for the app to recognize
+func (s *QRLoginService) qrPayload(id string) string {
+	approvalURL, err := url.Parse(s.config.QRLogin.ApprovalURL)
+	if err != nil || s.config.QRLogin.ApprovalURL == "" {
+		return "yubiapp-qr:" + id
+	}
+	query := approvalURL.Query()
+	query.Set("challenge", id)
+	approvalURL.RawQuery = query.Encode()
+	return approvalURL.String()
+}
+
+// Get returns a challenge, failing with NOT_FOUND once it has expired
+func (s *QRLoginService) Get(ctx context.Context, id string) (*QRLoginChallenge, error) {
+	fields, err := s.client.HGetAll(ctx, qrLoginKey(id)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read QR login challenge: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, NewError(CodeNotFound, "QR login challenge not found or expired")
+	}
+
+	challenge := &QRLoginChallenge{
+		ID:                id,
+		Status:            fields["status"],
+		Terminal:          fields["terminal"],
+		IPAddress:         fields["ip_address"],
+		UserAgent:         fields["user_agent"],
+		ApprovedBySession: fields["approved_by_session"],
+		pollTokenHash:     fields["poll_token"],
+	}
+	if userID, err := uuid.Parse(fields["user_id"]); err == nil {
+		challenge.UserID = &userID
+	}
+	if deviceID, err := uuid.Parse(fields["device_id"]); err == nil {
+		challenge.DeviceID = &deviceID
+	}
+	if expiresAt, err := strconv.ParseInt(fields["expires_at"], 10, 64); err == nil {
+		challenge.ExpiresAt = time.Unix(expiresAt, 0)
+	}
+	return challenge, nil
+}
+
+// Decide approves or rejects a challenge as user, signed in with deviceID
+// through session, or with the device itself when session is nil. Sessions
+// that are themselves limited (recovery, break-glass, impersonation or
+// cross-device) cannot approve, and neither can users whose roles refuse
+// session authentication.
+func (s *QRLoginService) Decide(ctx context.Context, id string, user *database.User, deviceID uuid.UUID, session *database.Session, approve bool) (*QRLoginChallenge, error) {
+	challenge, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	status, approvedBy := QRLoginRejected, ""
+	if approve {
+		if session != nil {
+			if session.Recovery || session.BreakGlass || session.CrossDevice || session.ImpersonatorID != nil {
+				return nil, NewError(CodePermissionDenied, "this session cannot approve QR logins")
+			}
+			approvedBy = session.ID
+		}
+		roleNames := make([]string, len(user.Roles))
+		for i, role := range user.Roles {
+			roleNames[i] = role.Name
+		}
+		if role := sessionsRefusedBy(s.config, roleNames); role != "" {
+			return nil, NewError(CodePermissionDenied, "role %s does not allow session authentication", role)
+		}
+		status = QRLoginApproved
+	}
+
+	result, err := decideQRLoginScript.Run(ctx, s.client, []string{qrLoginKey(id)},
+		status, user.ID.String(), deviceID.String(), approvedBy, qrLoginChannel(id)).Int()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decide QR login challenge: %w", err)
+	}
+	switch result {
+	case 0:
+		return nil, NewError(CodeNotFound, "QR login challenge not found or expired")
+	case -1:
+		return nil, NewError(CodeConflict, "QR login challenge was already decided")
+	}
+	challenge.Status = status
+	challenge.UserID = &user.ID
+	challenge.DeviceID = &deviceID
+	challenge.ApprovedBySession = approvedBy
+	return challenge, nil
+}
+
+// Poll is the terminal waiting, for at most qr_login.max_wait, for its
+// challenge to be decided. An approved challenge is redeemed for a session
+// bound to client, returned with the user it is for; it can be redeemed once.
+func (s *QRLoginService) Poll(ctx context.Context, id, pollToken string, wait time.Duration, client SessionClient) (*QRLoginChallenge, *database.Session, *database.User, error) {
+	if wait > s.config.QRLogin.MaxWait {
+		wait = s.config.QRLogin.MaxWait
+	}
+
+	var challenge *QRLoginChallenge
+	err := awaitPublish(ctx, s.client, qrLoginChannel(id), wait, func() (bool, error) {
+		var err error
+		if challenge, err = s.Get(ctx, id); err != nil {
+			return false, err
+		}
+		if subtle.ConstantTimeCompare([]byte(challenge.pollTokenHash), []byte(hashChallengeSecret(pollToken))) != 1 {
+			return false, NewError(CodeAuthFailed, "invalid poll token for QR login challenge")
+		}
+		return challenge.Status != QRLoginPending, nil
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if challenge.Status == QRLoginPending && wait > 0 && ctx.Err() == nil {
+		if challenge, err = s.Get(ctx, id); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if challenge.Status != QRLoginApproved {
+		return challenge, nil, nil, nil
+	}
+	return s.redeem(ctx, challenge, client)
+}
+
+// redeem opens the terminal's session for an approved challenge
+func (s *QRLoginService) redeem(ctx context.Context, challenge *QRLoginChallenge, client SessionClient) (*QRLoginChallenge, *database.Session, *database.User, error) {
+	status, err := redeemApprovedScript.Run(ctx, s.client, []string{qrLoginKey(challenge.ID)}).Text()
+	if err == redis.Nil {
+		return nil, nil, nil, NewError(CodeNotFound, "QR login challenge not found or expired")
+	}
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to redeem QR login challenge: %w", err)
+	}
+	if status != QRLoginApproved {
+		return nil, nil, nil, NewError(CodeConflict, "QR login challenge was already redeemed")
+	}
+	challenge.Status = QRLoginRedeemed
+
+	var user database.User
+	if err := s.authService.GetDB().WithContext(ctx).Where("id = ?", challenge.UserID).First(&user).Error; err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to find user: %w", err)
+	}
+	if !user.Active || !UserStateAllowsAuthentication(user.State) {
+		return nil, nil, nil, NewError(CodeAccountInactive, "user is not active")
+	}
+
+	session, err := s.sessions.CreateCrossDeviceSession(user.ID, *challenge.DeviceID, challenge.ApprovedBySession, client)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if err := s.authService.LogAuthentication(map[string]interface{}{
+		"user_id":    user.ID,
+		"device_id":  *challenge.DeviceID,
+		"type":       "login",
+		"success":    true,
+		"ip_address": client.IPAddress,
+		"user_agent": client.UserAgent,
+		"request_id": logging.RequestID(ctx),
+		"details": map[string]interface{}{
+			"method":              "qr_login",
+			"challenge_id":        challenge.ID,
+			"terminal":            challenge.Terminal,
+			"session_id":          session.ID,
+			"approved_by_session": challenge.ApprovedBySession,
+		},
+	}); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to log QR login: %w", err)
+	}
+	return challenge, session, &user, nil
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// recoveryCodeAlphabet leaves out characters that are easy to misread on paper
+const recoveryCodeAlphabet = "23456789abcdefghjkmnpqrstuvwxyz"
+
+// RecoveryResult is a successful sign-in with a recovery code
+type RecoveryResult struct {
+	User           *database.User
+	Session        *database.Session
+	Incident       *database.SecurityIncident
+	CodesRemaining int64
+}
+
+// RecoveryService issues recovery codes and redeems them at /auth/recovery for
+// users whose device is lost. A redeemed code opens a read-only session and a
+// security incident that stays open until an admin issues a replacement device.
+type RecoveryService struct {
+	db              *gorm.DB
+	config          *config.Config
+	passwordService *PasswordService
+	sessionService  *SessionService
+	incidents       *SecurityIncidentService
+}
+
+func NewRecoveryService(db *gorm.DB, config *config.Config, passwordService *PasswordService, sessionService *SessionService, incidents *SecurityIncidentService) *RecoveryService {
+	return &RecoveryService{
+		db:              db,
+		config:          config,
+		passwordService: passwordService,
+		sessionService:  sessionService,
+		incidents:       incidents,
+	}
+}
+
+// GenerateRecoveryCodes replaces a user's unused recovery codes with a new set
+// of recovery.code_count codes. The codes are only ever returned here.
+func (s *RecoveryService) GenerateRecoveryCodes(userID uuid.UUID) ([]string, error) {
+	var user database.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "user not found")
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	codes := make([]string, s.config.Recovery.CodeCount)
+	records := make([]database.RecoveryCode, len(codes))
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		codes[i] = code
+		records[i] = database.RecoveryCode{ID: uuid.New(), UserID: userID, CodeHash: hashRecoveryCode(code)}
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND used_at IS NULL", userID).Delete(&database.RecoveryCode{}).Error; err != nil {
+			return fmt.Errorf("failed to remove old recovery codes: %w", err)
+		}
+		if err := tx.Create(&records).Error; err != nil {
+			return fmt.Errorf("failed to store recovery codes: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// RecoveryCodesRemaining counts a user's unused recovery codes
+func (s *RecoveryService) RecoveryCodesRemaining(userID uuid.UUID) (int64, error) {
+	var count int64
+	if err := s.db.Model(&database.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+	return count, nil
+}
+
+// Recover signs a user in with their password and a recovery code in place of
+// a device. The code is used up, a wrong one counts as a failed password
+// attempt, and a recovery_code_used incident is opened for the session.
+func (s *RecoveryService) Recover(username, password, code string, client SessionClient) (*RecoveryResult, error) {
+	user, err := s.passwordService.VerifyPassword(username, password)
+	if err != nil {
+		return nil, err
+	}
+	if !user.Active {
+		return nil, NewError(CodeAccountInactive, "user is not active")
+	}
+	if !UserStateAllowsAuthentication(user.State) {
+		return nil, NewError(CodeAccountInactive, "user account is %s", user.State)
+	}
+
+	res := s.db.Model(&database.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashRecoveryCode(code)).
+		Updates(map[string]interface{}{"used_at": time.Now(), "used_ip": client.IPAddress})
+	if res.Error != nil {
+		return nil, fmt.Errorf("failed to redeem recovery code: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		if err := s.passwordService.RecordFailedAttempt(user); err != nil {
+			return nil, err
+		}
+		return nil, NewError(CodeAuthFailed, "invalid or already used recovery code")
+	}
+
+	remaining, err := s.RecoveryCodesRemaining(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.sessionService.CreateRecoverySession(user.ID, client)
+	if err != nil {
+		return nil, err
+	}
+
+	incident := &database.SecurityIncident{
+		UserID:    user.ID,
+		Type:      IncidentRecoveryCodeUsed,
+		Details:   fmt.Sprintf("%s signed in with a recovery code (%d left) and needs a replacement device", user.Username, remaining),
+		SessionID: session.ID,
+		IPAddress: client.IPAddress,
+		UserAgent: client.UserAgent,
+	}
+	if err := s.incidents.OpenIncident(incident); err != nil {
+		s.sessionService.InvalidateSession(session.ID)
+		return nil, err
+	}
+
+	return &RecoveryResult{
+		User:           user,
+		Session:        session,
+		Incident:       incident,
+		CodesRemaining: remaining,
+	}, nil
+}
+
+// generateRecoveryCode returns a random code such as "k7m2p-x9qrt"
+func generateRecoveryCode() (string, error) {
+	alphabetSize := big.NewInt(int64(len(recoveryCodeAlphabet)))
+	var code strings.Builder
+	for i := 0; i < 10; i++ {
+		if i == 5 {
+			code.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, alphabetSize)
+		if err != nil {
+			return "", err
+		}
+		code.WriteByte(recoveryCodeAlphabet[n.Int64()])
+	}
+	return code.String(), nil
+}
+
+// hashRecoveryCode hashes a code as typed, ignoring case, spaces and dashes
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
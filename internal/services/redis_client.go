@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/redis/go-redis/extra/redisotel/v9"
+	"github.com/redis/go-redis/v9"
+)
+
+// NewRedisClient connects to the configured Redis: a single node, a Sentinel
+// managed master or a cluster, per redis.mode. Commands are traced when
+// tracing is enabled.
+func NewRedisClient(config *config.Config) (redis.UniversalClient, error) {
+	cfg := config.Redis
+	tlsConfig, err := redisTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	var rdb redis.UniversalClient
+	switch cfg.Mode {
+	case "sentinel":
+		rdb = redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       cfg.MasterName,
+			SentinelAddrs:    cfg.Addrs,
+			SentinelUsername: cfg.SentinelUsername,
+			SentinelPassword: cfg.SentinelPassword,
+			Username:         cfg.Username,
+			Password:         cfg.Password,
+			DB:               cfg.DB,
+			PoolSize:         cfg.PoolSize,
+			TLSConfig:        tlsConfig,
+		})
+	case "cluster":
+		rdb = redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:     cfg.Addrs,
+			Username:  cfg.Username,
+			Password:  cfg.Password,
+			PoolSize:  cfg.PoolSize,
+			TLSConfig: tlsConfig,
+		})
+	default:
+		rdb = redis.NewClient(&redis.Options{
+			Addr:      fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+			Username:  cfg.Username,
+			Password:  cfg.Password,
+			DB:        cfg.DB,
+			PoolSize:  cfg.PoolSize,
+			TLSConfig: tlsConfig,
+		})
+	}
+
+	if config.Tracing.Enabled {
+		if err := redisotel.InstrumentTracing(rdb); err != nil {
+			log.Printf("Failed to enable Redis tracing: %v", err)
+		}
+	}
+	return rdb, nil
+}
+
+// redisTLSConfig builds the TLS settings for redis.tls, or nil when TLS is off
+func redisTLSConfig(cfg config.RedisTLSConfig) (*tls.Config, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read redis.tls.ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("redis.tls.ca_file %s contains no PEM certificates", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load redis.tls client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// awaitPublish subscribes to channel, then calls ready; unless ready reports
+// done, it waits for a message on the channel, timeout or ctx, whichever comes
+// first. Subscribing before ready looks means a message sent in between is not
+// missed.
+func awaitPublish(ctx context.Context, client redis.UniversalClient, channel string, timeout time.Duration, ready func() (bool, error)) error {
+	sub := client.Subscribe(ctx, channel)
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", channel, err)
+	}
+
+	if done, err := ready(); err != nil || done || timeout <= 0 {
+		return err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-sub.Channel():
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	return nil
+}
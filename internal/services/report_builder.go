@@ -0,0 +1,534 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/jobs"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+)
+
+// JobCustomReport is the job type that generates a custom activity report
+const JobCustomReport = "report.custom"
+
+// ValidReportDimensions lists what custom report rows can be grouped by
+var ValidReportDimensions = []string{"user", "location", "status", "day"}
+
+// ValidReportMeasures lists what custom report rows can total: the hours of
+// activity, and the number of activities, counted once on each day they cover
+// when grouped by day
+var ValidReportMeasures = []string{"hours", "count"}
+
+// validUserStatusTypes lists the types a user status can have
+var validUserStatusTypes = []string{"working", "break", "leave", "travel", "other"}
+
+// ValidCustomReportFormats lists the output formats supported by custom reports
+var ValidCustomReportFormats = []string{"json", "csv"}
+
+// CustomReport defines a report built from activity history: the activities
+// matching Filters, grouped by Dimensions, with the Measures of each group
+type CustomReport struct {
+	Dimensions []string            `json:"dimensions" doc:"What rows are grouped by (user, location, status or day); none gives a single total row. Days are in each user's timezone."`
+	Measures   []string            `json:"measures" doc:"Hours of activity (hours), and the number of activities (count, counted on each day they cover when grouped by day)"`
+	Filters    CustomReportFilters `json:"filters" doc:"The period, as from and to or as last_days, and optionally the activities covered"`
+	Format     string              `json:"format" enum:"json,csv" doc:"json when empty"`
+	// Timezone gives the days of filters.last_days and of the definition's
+	// schedule; UTC when empty. The day dimension uses each user's timezone.
+	Timezone string `json:"timezone,omitempty" doc:"Timezone of last_days and of a saved definition's schedule, e.g. Europe/London; UTC when empty"`
+}
+
+// CustomReportFilters selects the period and activities a custom report covers.
+// The period is either from/to or the last_days whole days before the run.
+type CustomReportFilters struct {
+	From        *time.Time  `json:"from,omitempty"`
+	To          *time.Time  `json:"to,omitempty"`
+	LastDays    int         `json:"last_days,omitempty" doc:"The whole days before the day the report runs, e.g. 7 for the past week"`
+	UserIDs     []uuid.UUID `json:"user_ids,omitempty"`
+	LocationIDs []uuid.UUID `json:"location_ids,omitempty"`
+	StatusIDs   []uuid.UUID `json:"status_ids,omitempty"`
+	StatusTypes []string    `json:"status_types,omitempty" doc:"working, break, leave, travel or other"`
+}
+
+// CustomReportRow is one group of a custom report. Only the fields of the
+// report's dimensions and measures are set.
+type CustomReportRow struct {
+	UserID       *uuid.UUID `json:"user_id,omitempty"`
+	UserName     string     `json:"user_name,omitempty"`
+	LocationID   *uuid.UUID `json:"location_id,omitempty"`
+	LocationName string     `json:"location_name,omitempty"`
+	StatusID     *uuid.UUID `json:"status_id,omitempty"`
+	StatusName   string     `json:"status_name,omitempty"`
+	StatusType   string     `json:"status_type,omitempty"`
+	Day          string     `json:"day,omitempty"` // In the user's timezone
+	Hours        *float64   `json:"hours,omitempty"`
+	Count        *int       `json:"count,omitempty"`
+}
+
+// customReportJob is the payload of a report.custom job
+type customReportJob struct {
+	ReportJobID uuid.UUID    `json:"report_job_id"`
+	Report      CustomReport `json:"report"`
+	From        time.Time    `json:"from"`
+	To          time.Time    `json:"to"`
+}
+
+// customReportActivity is an activity history row read for a custom report
+type customReportActivity struct {
+	UserID       uuid.UUID
+	UserName     string
+	UserTimezone string
+	LocationID   *uuid.UUID
+	LocationName string
+	StatusID     *uuid.UUID
+	StatusName   string
+	StatusType   string
+	FromDatetime time.Time
+	ToDatetime   *time.Time
+}
+
+// customReportGroup is the key of a custom report row; dimensions the report
+// does not group by are left zero
+type customReportGroup struct {
+	UserID     uuid.UUID
+	LocationID uuid.UUID
+	StatusID   uuid.UUID
+	Day        string
+}
+
+// Validate checks the report's dimensions, measures, filters and format,
+// filling in the json format when none is given
+func (r *CustomReport) Validate() error {
+	if err := validateReportNames("dimension", r.Dimensions, ValidReportDimensions); err != nil {
+		return err
+	}
+	if len(r.Measures) == 0 {
+		return NewError(CodeValidationFailed, "at least one measure is required. Valid measures are: %v", ValidReportMeasures)
+	}
+	if err := validateReportNames("measure", r.Measures, ValidReportMeasures); err != nil {
+		return err
+	}
+
+	if r.Format == "" {
+		r.Format = "json"
+	}
+	if !containsString(ValidCustomReportFormats, r.Format) {
+		return NewError(CodeValidationFailed, "unsupported format: %s. Valid formats are: %v", r.Format, ValidCustomReportFormats)
+	}
+	if r.Timezone != "" {
+		if _, err := time.LoadLocation(r.Timezone); err != nil {
+			return NewError(CodeValidationFailed, "invalid timezone '%s'", r.Timezone)
+		}
+	}
+
+	f := r.Filters
+	switch {
+	case f.LastDays < 0:
+		return NewError(CodeValidationFailed, "filters.last_days cannot be negative")
+	case f.LastDays > 0 && (f.From != nil || f.To != nil):
+		return NewError(CodeValidationFailed, "filters.last_days cannot be combined with filters.from and filters.to")
+	case f.LastDays == 0 && (f.From == nil || f.To == nil):
+		return NewError(CodeValidationFailed, "filters.from and filters.to, or filters.last_days, are required")
+	case f.LastDays == 0 && !f.To.After(*f.From):
+		return NewError(CodeValidationFailed, "filters.to must be after filters.from")
+	}
+	for _, statusType := range f.StatusTypes {
+		if !containsString(validUserStatusTypes, statusType) {
+			return NewError(CodeValidationFailed, "invalid status type '%s'. Valid types are: %v", statusType, validUserStatusTypes)
+		}
+	}
+	return nil
+}
+
+// Period returns the period the report covers when run at now: from/to, or
+// the last_days whole days before now's day in the report's timezone
+func (r *CustomReport) Period(now time.Time) (time.Time, time.Time) {
+	if r.Filters.LastDays == 0 {
+		return *r.Filters.From, *r.Filters.To
+	}
+	local := now.In(loadTimezone(r.Timezone))
+	to := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+	return to.AddDate(0, 0, -r.Filters.LastDays), to
+}
+
+// has reports whether the report totals the measure
+func (r *CustomReport) has(measure string) bool {
+	return containsString(r.Measures, measure)
+}
+
+// validateReportNames rejects unknown and repeated dimensions or measures
+func validateReportNames(kind string, names, valid []string) error {
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if !containsString(valid, name) {
+			return NewError(CodeValidationFailed, "unknown %s '%s'. Valid %ss are: %v", kind, name, kind, valid)
+		}
+		if seen[name] {
+			return NewError(CodeValidationFailed, "%s '%s' is listed twice", kind, name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateCustomReportJob validates a report, records a pending job for it and
+// queues its generation. requestedByID is nil for scheduled runs, and
+// definitionID names the saved definition being run, if any.
+func (s *ReportService) CreateCustomReportJob(requestedByID *uuid.UUID, report CustomReport, definitionID *uuid.UUID) (*database.ReportJob, error) {
+	if err := report.Validate(); err != nil {
+		return nil, err
+	}
+	from, to := report.Period(time.Now())
+
+	payload := customReportJob{Report: report, From: from, To: to}
+	var parameters pgtype.JSONB
+	if err := parameters.Set(payload); err != nil {
+		return nil, fmt.Errorf("failed to convert parameters to JSONB: %w", err)
+	}
+
+	job := &database.ReportJob{
+		ID:            uuid.New(),
+		RequestedByID: requestedByID,
+		ReportType:    "custom",
+		Format:        report.Format,
+		DefinitionID:  definitionID,
+		Parameters:    parameters,
+		Status:        "pending",
+	}
+	if err := s.db.Create(job).Error; err != nil {
+		return nil, fmt.Errorf("failed to create report job: %w", err)
+	}
+
+	payload.ReportJobID = job.ID
+	if _, err := s.queue.Enqueue(context.Background(), JobCustomReport, payload); err != nil {
+		s.db.Model(job).Updates(map[string]interface{}{"status": "failed", "error": err.Error()})
+		return nil, err
+	}
+	return job, nil
+}
+
+// runCustomReport runs a queued report.custom job. A report that fails to
+// render is recorded as failed rather than retried.
+func (s *ReportService) runCustomReport(ctx context.Context, job *jobs.Job) error {
+	var report customReportJob
+	if err := job.Decode(&report); err != nil {
+		return err
+	}
+
+	if err := s.db.Model(&database.ReportJob{}).Where("id = ?", report.ReportJobID).Update("status", "running").Error; err != nil {
+		log.Printf("Failed to mark report job %s as running: %v", report.ReportJobID, err)
+	}
+
+	var buf bytes.Buffer
+	err := s.WriteCustomReport(&buf, report.Report, report.From, report.To)
+
+	updates := map[string]interface{}{"completed_at": time.Now()}
+	if err != nil {
+		updates["status"] = "failed"
+		updates["error"] = err.Error()
+	} else {
+		updates["status"] = "completed"
+		updates["result"] = buf.Bytes()
+	}
+	if err := s.db.Model(&database.ReportJob{}).Where("id = ?", report.ReportJobID).Updates(updates).Error; err != nil {
+		log.Printf("Failed to store result for report job %s: %v", report.ReportJobID, err)
+	}
+	return nil
+}
+
+// WriteCustomReport renders the report over [from, to) in its format to w
+func (s *ReportService) WriteCustomReport(w io.Writer, report CustomReport, from, to time.Time) error {
+	rows, err := s.GenerateCustomReport(report, from, to)
+	if err != nil {
+		return err
+	}
+
+	if report.Format != "csv" {
+		return json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": rows,
+			"meta": map[string]interface{}{
+				"from":       from,
+				"to":         to,
+				"dimensions": report.Dimensions,
+				"measures":   report.Measures,
+				"filters":    report.Filters,
+			},
+		})
+	}
+
+	var header []string
+	for _, dimension := range report.Dimensions {
+		switch dimension {
+		case "user":
+			header = append(header, "user_id", "user_name")
+		case "location":
+			header = append(header, "location_id", "location_name")
+		case "status":
+			header = append(header, "status_id", "status_name", "status_type")
+		case "day":
+			header = append(header, "day")
+		}
+	}
+	header = append(header, report.Measures...)
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return fmt.Errorf("failed to write CSV header: %w", err)
+	}
+	for _, row := range rows {
+		record := make([]string, 0, len(header))
+		for _, column := range header {
+			record = append(record, row.column(column))
+		}
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("failed to write CSV row: %w", err)
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// column returns the CSV value of one of the row's columns
+func (r *CustomReportRow) column(name string) string {
+	uuidString := func(id *uuid.UUID) string {
+		if id == nil {
+			return ""
+		}
+		return id.String()
+	}
+	switch name {
+	case "user_id":
+		return uuidString(r.UserID)
+	case "user_name":
+		return r.UserName
+	case "location_id":
+		return uuidString(r.LocationID)
+	case "location_name":
+		return r.LocationName
+	case "status_id":
+		return uuidString(r.StatusID)
+	case "status_name":
+		return r.StatusName
+	case "status_type":
+		return r.StatusType
+	case "day":
+		return r.Day
+	case "hours":
+		return formatHours(*r.Hours)
+	case "count":
+		return fmt.Sprintf("%d", *r.Count)
+	}
+	return ""
+}
+
+// GenerateCustomReport aggregates the activities matching the report's filters
+// over [from, to) into its rows, ordered by their dimensions. Activities are
+// clipped to the period, and those still open are counted up to the current
+// time. Activities without a location or status are grouped together.
+func (s *ReportService) GenerateCustomReport(report CustomReport, from, to time.Time) ([]CustomReportRow, error) {
+	query := `
+		SELECT uah.user_id, CONCAT(u.first_name, ' ', u.last_name) AS user_name, u.timezone AS user_timezone,
+			uah.location_id, COALESCE(l.name, '') AS location_name,
+			uah.status_id, COALESCE(us.name, '') AS status_name, COALESCE(us.type, 'other') AS status_type,
+			uah.from_datetime, uah.to_datetime
+		FROM user_activity_history uah
+		JOIN users u ON u.id = uah.user_id
+		LEFT JOIN locations l ON l.id = uah.location_id
+		LEFT JOIN user_statuses us ON us.id = uah.status_id
+		WHERE uah.from_datetime < ? AND (uah.to_datetime IS NULL OR uah.to_datetime > ?)
+	`
+	args := []interface{}{to, from}
+	f := report.Filters
+	if len(f.UserIDs) > 0 {
+		query += " AND uah.user_id IN ?"
+		args = append(args, f.UserIDs)
+	}
+	if len(f.LocationIDs) > 0 {
+		query += " AND uah.location_id IN ?"
+		args = append(args, f.LocationIDs)
+	}
+	if len(f.StatusIDs) > 0 {
+		query += " AND uah.status_id IN ?"
+		args = append(args, f.StatusIDs)
+	}
+	if len(f.StatusTypes) > 0 {
+		query += " AND COALESCE(us.type, 'other') IN ?"
+		args = append(args, f.StatusTypes)
+	}
+
+	db := database.ReadReplica(s.db)
+	cursor, err := db.Raw(query, args...).Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read activity history: %w", err)
+	}
+	defer cursor.Close()
+
+	byDay := containsString(report.Dimensions, "day")
+	now := time.Now()
+	groups := make(map[customReportGroup]*CustomReportRow)
+	for cursor.Next() {
+		var activity customReportActivity
+		if err := db.ScanRows(cursor, &activity); err != nil {
+			return nil, fmt.Errorf("failed to read activity history: %w", err)
+		}
+
+		end := now
+		if activity.ToDatetime != nil {
+			end = *activity.ToDatetime
+		}
+		start, end := maxTime(activity.FromDatetime, from), minTime(end, to)
+		if !byDay {
+			row := report.groupRow(groups, &activity, "")
+			row.add(end.Sub(start).Hours())
+			continue
+		}
+
+		loc := loadTimezone(activity.UserTimezone)
+		counted := false
+		splitByDay(start, end, loc, func(day time.Time, hours float64) {
+			report.groupRow(groups, &activity, day.Format("2006-01-02")).add(hours)
+			counted = true
+		})
+		if !counted {
+			// An activity without duration still counts on its day
+			report.groupRow(groups, &activity, start.In(loc).Format("2006-01-02")).add(0)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read activity history: %w", err)
+	}
+
+	rows := make([]CustomReportRow, 0, len(groups))
+	for _, row := range groups {
+		if row.Hours != nil {
+			*row.Hours = roundHours(*row.Hours)
+		}
+		rows = append(rows, *row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].sortKey(report.Dimensions) < rows[j].sortKey(report.Dimensions)
+	})
+	return rows, nil
+}
+
+// groupRow returns the row of the group the activity falls in on day, adding
+// it to groups
+func (r *CustomReport) groupRow(groups map[customReportGroup]*CustomReportRow, activity *customReportActivity, day string) *CustomReportRow {
+	var key customReportGroup
+	row := &CustomReportRow{}
+	for _, dimension := range r.Dimensions {
+		switch dimension {
+		case "user":
+			key.UserID = activity.UserID
+			row.UserID, row.UserName = &activity.UserID, activity.UserName
+		case "location":
+			if activity.LocationID != nil {
+				key.LocationID = *activity.LocationID
+			}
+			row.LocationID, row.LocationName = activity.LocationID, activity.LocationName
+		case "status":
+			if activity.StatusID != nil {
+				key.StatusID = *activity.StatusID
+			}
+			row.StatusID, row.StatusName, row.StatusType = activity.StatusID, activity.StatusName, activity.StatusType
+		case "day":
+			key.Day = day
+			row.Day = day
+		}
+	}
+
+	if existing, ok := groups[key]; ok {
+		return existing
+	}
+	if r.has("hours") {
+		row.Hours = new(float64)
+	}
+	if r.has("count") {
+		row.Count = new(int)
+	}
+	groups[key] = row
+	return row
+}
+
+// add counts one activity of the given hours in the row
+func (r *CustomReportRow) add(hours float64) {
+	if r.Hours != nil {
+		*r.Hours += hours
+	}
+	if r.Count != nil {
+		*r.Count++
+	}
+}
+
+// sortKey orders rows by their dimensions in the report's order, by name
+// before ID so rows read alphabetically
+func (r *CustomReportRow) sortKey(dimensions []string) string {
+	parts := make([]string, 0, len(dimensions))
+	for _, dimension := range dimensions {
+		switch dimension {
+		case "user":
+			parts = append(parts, r.UserName, r.column("user_id"))
+		case "location":
+			parts = append(parts, r.LocationName, r.column("location_id"))
+		case "status":
+			parts = append(parts, r.StatusName, r.column("status_id"))
+		case "day":
+			parts = append(parts, r.Day)
+		}
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// ReportJobFilter narrows the report jobs returned by ListReportJobs
+type ReportJobFilter struct {
+	ReportType   string
+	DefinitionID *uuid.UUID
+	Status       string
+	Limit        int
+	Offset       int
+}
+
+// ListReportJobs retrieves report jobs without their results, newest first,
+// with the total matching the filter
+func (s *ReportService) ListReportJobs(filter ReportJobFilter) ([]database.ReportJob, int64, error) {
+	query := database.ReadReplica(s.db).Model(&database.ReportJob{})
+	if filter.ReportType != "" {
+		query = query.Where("report_type = ?", filter.ReportType)
+	}
+	if filter.DefinitionID != nil {
+		query = query.Where("definition_id = ?", *filter.DefinitionID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count report jobs: %w", err)
+	}
+
+	var reportJobs []database.ReportJob
+	if err := query.Omit("result").Order("created_at DESC").
+		Limit(filter.Limit).Offset(filter.Offset).Find(&reportJobs).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch report jobs: %w", err)
+	}
+	return reportJobs, total, nil
+}
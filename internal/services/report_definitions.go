@@ -0,0 +1,269 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+	"gorm.io/gorm"
+)
+
+// ReportDefinitionUpdate holds the changes to a saved report definition; nil
+// fields are left as they are
+type ReportDefinitionUpdate struct {
+	Name        *string
+	Description *string
+	Report      *CustomReport
+	Schedule    *string
+	Active      *bool
+}
+
+// CreateReportDefinition saves a custom report to be run again, by hand or on
+// its cron schedule when one is given
+func (s *ReportService) CreateReportDefinition(name, description string, report CustomReport, schedule string, active bool, createdByID uuid.UUID) (*database.ReportDefinition, error) {
+	if name == "" {
+		return nil, NewError(CodeValidationFailed, "report definition name is required")
+	}
+	definition := &database.ReportDefinition{
+		ID:          uuid.New(),
+		Name:        name,
+		Description: description,
+		Schedule:    schedule,
+		Active:      active,
+		CreatedByID: &createdByID,
+	}
+	if err := s.setReportDefinition(definition, report, time.Now()); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(definition).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, NewError(CodeConflict, "report definition '%s' already exists", name)
+		}
+		return nil, fmt.Errorf("failed to create report definition: %w", err)
+	}
+
+	// Create skips zero values for columns with defaults, so an inactive definition needs an explicit update
+	if !active {
+		if err := s.db.Model(definition).Update("active", false).Error; err != nil {
+			return nil, fmt.Errorf("failed to create report definition: %w", err)
+		}
+	}
+	return s.GetReportDefinition(definition.ID)
+}
+
+// GetReportDefinition retrieves a saved report definition by ID
+func (s *ReportService) GetReportDefinition(id uuid.UUID) (*database.ReportDefinition, error) {
+	var definition database.ReportDefinition
+	if err := s.db.Where("id = ?", id).First(&definition).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, NewError(CodeNotFound, "report definition not found")
+		}
+		return nil, fmt.Errorf("failed to get report definition: %w", err)
+	}
+	return &definition, nil
+}
+
+// ListReportDefinitions retrieves saved report definitions by name, with the total
+func (s *ReportService) ListReportDefinitions(limit, offset int) ([]database.ReportDefinition, int64, error) {
+	query := database.ReadReplica(s.db).Model(&database.ReportDefinition{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count report definitions: %w", err)
+	}
+
+	var definitions []database.ReportDefinition
+	if err := query.Order("name").Limit(limit).Offset(offset).Find(&definitions).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch report definitions: %w", err)
+	}
+	return definitions, total, nil
+}
+
+// UpdateReportDefinition applies changes to a saved report definition,
+// rejecting them when expected names a version other than the current one.
+// Its next scheduled run is worked out again from now.
+func (s *ReportService) UpdateReportDefinition(id uuid.UUID, update ReportDefinitionUpdate, expected *int) (*database.ReportDefinition, error) {
+	definition, err := s.GetReportDefinition(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion("report definition", definition.Version, expected); err != nil {
+		return nil, err
+	}
+
+	if update.Name != nil {
+		if *update.Name == "" {
+			return nil, NewError(CodeValidationFailed, "report definition name cannot be empty")
+		}
+		definition.Name = *update.Name
+	}
+	if update.Description != nil {
+		definition.Description = *update.Description
+	}
+	if update.Schedule != nil {
+		definition.Schedule = *update.Schedule
+	}
+	if update.Active != nil {
+		definition.Active = *update.Active
+	}
+	report, err := ParseReportDefinition(definition)
+	if err != nil {
+		return nil, err
+	}
+	if update.Report != nil {
+		report = update.Report
+	}
+	if err := s.setReportDefinition(definition, *report, time.Now()); err != nil {
+		return nil, err
+	}
+
+	if err := saveVersioned(s.db, "report definition", definition, &definition.Version); err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, NewError(CodeConflict, "report definition '%s' already exists", definition.Name)
+		}
+		return nil, err
+	}
+	return s.GetReportDefinition(id)
+}
+
+// DeleteReportDefinition deletes a saved report definition. Its report jobs
+// are kept.
+func (s *ReportService) DeleteReportDefinition(id uuid.UUID) error {
+	result := s.db.Where("id = ?", id).Delete(&database.ReportDefinition{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete report definition: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return NewError(CodeNotFound, "report definition not found")
+	}
+	return nil
+}
+
+// RunReportDefinition queues a run of a saved report definition now on
+// behalf of userID, whether or not it is scheduled or active
+func (s *ReportService) RunReportDefinition(id uuid.UUID, userID uuid.UUID) (*database.ReportJob, error) {
+	definition, err := s.GetReportDefinition(id)
+	if err != nil {
+		return nil, err
+	}
+	report, err := ParseReportDefinition(definition)
+	if err != nil {
+		return nil, err
+	}
+	return s.CreateCustomReportJob(&userID, *report, &definition.ID)
+}
+
+// ParseReportDefinition reads the custom report a definition saves
+func ParseReportDefinition(definition *database.ReportDefinition) (*CustomReport, error) {
+	var report CustomReport
+	if err := json.Unmarshal(definition.Definition.Bytes, &report); err != nil {
+		return nil, fmt.Errorf("invalid report definition '%s': %w", definition.Name, err)
+	}
+	return &report, nil
+}
+
+// setReportDefinition validates report and the definition's schedule, stores
+// the report on the definition and sets its next scheduled run after now
+func (s *ReportService) setReportDefinition(definition *database.ReportDefinition, report CustomReport, now time.Time) error {
+	if err := report.Validate(); err != nil {
+		return err
+	}
+	var data pgtype.JSONB
+	if err := data.Set(report); err != nil {
+		return fmt.Errorf("failed to convert report definition to JSONB: %w", err)
+	}
+	definition.Definition = data
+
+	definition.NextRunAt = nil
+	if definition.Schedule == "" {
+		return nil
+	}
+	cron, err := ParseCron(definition.Schedule, loadTimezone(report.Timezone))
+	if err != nil {
+		return NewError(CodeValidationFailed, "invalid schedule: %v", err)
+	}
+	if next := cron.Next(now); definition.Active && !next.IsZero() {
+		definition.NextRunAt = &next
+	}
+	return nil
+}
+
+// StartScheduler runs the saved report definitions that fall due, checking
+// every scheduler.check_interval. It does nothing when the interval is zero.
+func (s *ReportService) StartScheduler() {
+	interval := s.config.Scheduler.CheckInterval
+	if interval <= 0 || s.stop != nil {
+		return
+	}
+
+	s.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		s.RunDueDefinitions(time.Now())
+		for {
+			select {
+			case <-ticker.C:
+				s.RunDueDefinitions(time.Now())
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopScheduler stops running saved report definitions on their schedules
+func (s *ReportService) StopScheduler() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// RunDueDefinitions queues a run of each active definition whose next run is
+// due and moves its next run on. A run is claimed by moving next_run_at, so a
+// due run is queued once however many servers check. Runs missed while no
+// server was checking are made up by a single run.
+func (s *ReportService) RunDueDefinitions(now time.Time) {
+	var due []database.ReportDefinition
+	if err := s.db.Where("active = ? AND next_run_at <= ?", true, now).Find(&due).Error; err != nil {
+		log.Printf("Checking report schedules failed: %v", err)
+		return
+	}
+
+	for i := range due {
+		definition := &due[i]
+		report, err := ParseReportDefinition(definition)
+		if err != nil {
+			log.Printf("Skipping schedule of report definition '%s': %v", definition.Name, err)
+			continue
+		}
+		var next *time.Time
+		if cron, err := ParseCron(definition.Schedule, loadTimezone(report.Timezone)); err == nil {
+			if t := cron.Next(now); !t.IsZero() {
+				next = &t
+			}
+		}
+
+		claim := s.db.Model(&database.ReportDefinition{}).
+			Where("id = ? AND next_run_at = ?", definition.ID, *definition.NextRunAt).
+			Updates(map[string]interface{}{"next_run_at": next, "last_run_at": now})
+		if claim.Error != nil {
+			log.Printf("Claiming scheduled run of report definition '%s' failed: %v", definition.Name, claim.Error)
+			continue
+		}
+		if claim.RowsAffected == 0 {
+			continue
+		}
+
+		if _, err := s.CreateCustomReportJob(nil, *report, &definition.ID); err != nil {
+			log.Printf("Scheduled run of report definition '%s' failed: %v", definition.Name, err)
+		}
+	}
+}
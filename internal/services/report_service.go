@@ -0,0 +1,403 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/jobs"
+	"github.com/go-pdf/fpdf"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+	"gorm.io/gorm"
+)
+
+// JobTimesheetReport is the job type that generates a queued timesheet report
+const JobTimesheetReport = "report.timesheet"
+
+type ReportService struct {
+	db     *gorm.DB
+	config *config.Config
+	queue  *jobs.Queue
+
+	stop chan struct{}
+}
+
+// timesheetReport is the payload of a report.timesheet job
+type timesheetReport struct {
+	ReportJobID uuid.UUID       `json:"report_job_id"`
+	Filter      TimesheetFilter `json:"filter"`
+	Format      string          `json:"format"`
+}
+
+func NewReportService(db *gorm.DB, config *config.Config, queue *jobs.Queue) *ReportService {
+	return &ReportService{
+		db:     db,
+		config: config,
+		queue:  queue,
+	}
+}
+
+// RegisterJobs registers the report generation handlers on a job worker
+func (s *ReportService) RegisterJobs(worker *jobs.Worker) {
+	worker.Handle(JobTimesheetReport, s.runTimesheetReport)
+	worker.Handle(JobCustomReport, s.runCustomReport)
+}
+
+// TimesheetFilter selects the users and period covered by a timesheet
+type TimesheetFilter struct {
+	UserIDs []uuid.UUID `json:"user_ids"`
+	From    time.Time   `json:"from"`
+	To      time.Time   `json:"to"`
+}
+
+// TimesheetDay represents the hours a user spent in each status category on a single day
+type TimesheetDay struct {
+	UserID      uuid.UUID `json:"user_id"`
+	UserName    string    `json:"user_name"`
+	Date        string    `json:"date"`     // In Timezone
+	Timezone    string    `json:"timezone"` // The user's, or UTC
+	WorkedHours float64   `json:"worked_hours"`
+	BreakHours  float64   `json:"break_hours"`
+	LeaveHours  float64   `json:"leave_hours"`
+	TravelHours float64   `json:"travel_hours"`
+	OtherHours  float64   `json:"other_hours"`
+}
+
+var timesheetCSVHeader = []string{"user_id", "user_name", "date", "worked_hours", "break_hours", "leave_hours", "travel_hours", "other_hours", "timezone"}
+
+// ValidTimesheetFormats lists the output formats supported by timesheet reports
+var ValidTimesheetFormats = []string{"json", "csv", "pdf"}
+
+// IsLargeTimesheetRange reports whether a period exceeds the configured synchronous limit
+func (s *ReportService) IsLargeTimesheetRange(filter TimesheetFilter) bool {
+	maxDays := s.config.Reports.MaxSyncDays
+	if maxDays <= 0 {
+		return false
+	}
+	return filter.To.Sub(filter.From) > time.Duration(maxDays)*24*time.Hour
+}
+
+// GenerateTimesheet returns the per-day timesheet rows for the filter
+func (s *ReportService) GenerateTimesheet(filter TimesheetFilter) ([]TimesheetDay, error) {
+	days := []TimesheetDay{}
+	err := s.StreamTimesheet(filter, func(day TimesheetDay) error {
+		days = append(days, day)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return days, nil
+}
+
+// StreamTimesheet aggregates activity intervals into per-user, per-day rows.
+// Activities are read in user order and each user's days are emitted as soon as
+// that user is complete, so memory use does not grow with the number of users.
+// Intervals are clipped to the requested period and split at midnight in the
+// user's timezone (UTC when unset); activities that are still open are counted
+// up to the current time. The closed hours of whole days are read from
+// activity_rollups unless they have changes still queued for the rollup refresh.
+func (s *ReportService) StreamTimesheet(filter TimesheetFilter, emit func(TimesheetDay) error) error {
+	if !filter.To.After(filter.From) {
+		return NewError(CodeValidationFailed, "'to' must be after 'from'")
+	}
+
+	now := time.Now()
+	return readActivityPeriods(database.ReadReplica(s.db), s.config.Activity.RollupInterval > 0, filter.UserIDs, filter.From, filter.To, "id", func(period *activityPeriod) error {
+		days := make(map[string]*TimesheetDay)
+		for _, rollup := range period.Rollups {
+			day := timesheetDayOf(days, period, rollup.Day)
+			for status, hours := range rollup.Hours {
+				day.addHours(status.Type, hours)
+			}
+		}
+
+		for _, interval := range period.Intervals {
+			// Rollups leave out open activities, which count on every day
+			end := now
+			if interval.ToDateTime != nil {
+				end = *interval.ToDateTime
+			}
+			open := interval.ToDateTime == nil
+			splitByDay(maxTime(interval.FromDateTime, filter.From), minTime(end, filter.To), period.Loc, func(dayStart time.Time, hours float64) {
+				if open || !period.RolledUp(dayStart) {
+					timesheetDayOf(days, period, dayStart).addHours(interval.StatusType, hours)
+				}
+			})
+		}
+		return emitTimesheetDays(days, emit)
+	})
+}
+
+// timesheetDayOf returns the user's timesheet row of the local day starting at
+// dayStart, adding it to days
+func timesheetDayOf(days map[string]*TimesheetDay, period *activityPeriod, dayStart time.Time) *TimesheetDay {
+	date := dayStart.Format("2006-01-02")
+	day, ok := days[date]
+	if !ok {
+		day = &TimesheetDay{UserID: period.UserID, UserName: period.UserName, Date: date, Timezone: period.Loc.String()}
+		days[date] = day
+	}
+	return day
+}
+
+// addHours adds hours to the bucket matching a UserStatus type
+func (d *TimesheetDay) addHours(statusType string, hours float64) {
+	switch statusType {
+	case "working":
+		d.WorkedHours += hours
+	case "break":
+		d.BreakHours += hours
+	case "leave":
+		d.LeaveHours += hours
+	case "travel":
+		d.TravelHours += hours
+	default:
+		d.OtherHours += hours
+	}
+}
+
+// emitTimesheetDays emits a single user's days in date order with hours rounded to two decimals
+func emitTimesheetDays(days map[string]*TimesheetDay, emit func(TimesheetDay) error) error {
+	dates := make([]string, 0, len(days))
+	for date := range days {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+
+	for _, date := range dates {
+		day := *days[date]
+		day.WorkedHours = roundHours(day.WorkedHours)
+		day.BreakHours = roundHours(day.BreakHours)
+		day.LeaveHours = roundHours(day.LeaveHours)
+		day.TravelHours = roundHours(day.TravelHours)
+		day.OtherHours = roundHours(day.OtherHours)
+		if err := emit(day); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteTimesheet renders the timesheet in the requested format to w
+func (s *ReportService) WriteTimesheet(w io.Writer, filter TimesheetFilter, format string) error {
+	switch format {
+	case "csv":
+		return s.WriteTimesheetCSV(w, filter)
+	case "pdf":
+		return s.WriteTimesheetPDF(w, filter)
+	case "json":
+		days, err := s.GenerateTimesheet(filter)
+		if err != nil {
+			return err
+		}
+		return json.NewEncoder(w).Encode(map[string]interface{}{"data": days})
+	default:
+		return NewError(CodeValidationFailed, "unsupported format: %s. Valid formats are: %v", format, ValidTimesheetFormats)
+	}
+}
+
+// WriteTimesheetCSV streams the timesheet as CSV, flushing after each row
+func (s *ReportService) WriteTimesheetCSV(w io.Writer, filter TimesheetFilter) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(timesheetCSVHeader); err != nil {
+		return fmt.Errorf("failed to write CSV header: %w", err)
+	}
+
+	err := s.StreamTimesheet(filter, func(day TimesheetDay) error {
+		record := []string{
+			day.UserID.String(),
+			day.UserName,
+			day.Date,
+			formatHours(day.WorkedHours),
+			formatHours(day.BreakHours),
+			formatHours(day.LeaveHours),
+			formatHours(day.TravelHours),
+			formatHours(day.OtherHours),
+			day.Timezone,
+		}
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("failed to write CSV row: %w", err)
+		}
+		writer.Flush()
+		return writer.Error()
+	})
+	if err != nil {
+		return err
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteTimesheetPDF renders the timesheet as a PDF table
+func (s *ReportService) WriteTimesheetPDF(w io.Writer, filter TimesheetFilter) error {
+	pdf := fpdf.New("L", "mm", "A4", "")
+	pdf.SetTitle("Timesheet", false)
+	pdf.AddPage()
+
+	pdf.SetFont("Helvetica", "B", 14)
+	pdf.Cell(0, 10, "Timesheet")
+	pdf.Ln(8)
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.Cell(0, 8, fmt.Sprintf("Period: %s - %s", filter.From.UTC().Format(time.RFC3339), filter.To.UTC().Format(time.RFC3339)))
+	pdf.Ln(10)
+
+	headers := []string{"User", "Date", "Worked", "Break", "Leave", "Travel", "Other"}
+	widths := []float64{80, 35, 30, 30, 30, 30, 30}
+
+	pdf.SetFont("Helvetica", "B", 10)
+	for i, header := range headers {
+		pdf.CellFormat(widths[i], 7, header, "1", 0, "C", false, 0, "")
+	}
+	pdf.Ln(-1)
+
+	pdf.SetFont("Helvetica", "", 10)
+	err := s.StreamTimesheet(filter, func(day TimesheetDay) error {
+		values := []string{
+			day.UserName,
+			day.Date,
+			formatHours(day.WorkedHours),
+			formatHours(day.BreakHours),
+			formatHours(day.LeaveHours),
+			formatHours(day.TravelHours),
+			formatHours(day.OtherHours),
+		}
+		for i, value := range values {
+			align := "R"
+			if i < 2 {
+				align = "L"
+			}
+			pdf.CellFormat(widths[i], 6, value, "1", 0, align, false, 0, "")
+		}
+		pdf.Ln(-1)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return pdf.Output(w)
+}
+
+// CreateTimesheetJob records a pending timesheet job and queues its generation
+func (s *ReportService) CreateTimesheetJob(requestedByID uuid.UUID, filter TimesheetFilter, format string) (*database.ReportJob, error) {
+	var parameters pgtype.JSONB
+	if err := parameters.Set(filter); err != nil {
+		return nil, fmt.Errorf("failed to convert parameters to JSONB: %w", err)
+	}
+
+	job := &database.ReportJob{
+		ID:            uuid.New(),
+		RequestedByID: &requestedByID,
+		ReportType:    "timesheet",
+		Format:        format,
+		Parameters:    parameters,
+		Status:        "pending",
+	}
+
+	if err := s.db.Create(job).Error; err != nil {
+		return nil, fmt.Errorf("failed to create report job: %w", err)
+	}
+
+	payload := timesheetReport{ReportJobID: job.ID, Filter: filter, Format: format}
+	if _, err := s.queue.Enqueue(context.Background(), JobTimesheetReport, payload); err != nil {
+		s.db.Model(job).Updates(map[string]interface{}{"status": "failed", "error": err.Error()})
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// runTimesheetReport runs a queued report.timesheet job. A report that fails
+// to render is recorded as failed rather than retried.
+func (s *ReportService) runTimesheetReport(ctx context.Context, job *jobs.Job) error {
+	var report timesheetReport
+	if err := job.Decode(&report); err != nil {
+		return err
+	}
+	s.runTimesheetJob(report.ReportJobID, report.Filter, report.Format)
+	return nil
+}
+
+// runTimesheetJob renders a timesheet into memory and stores it on the job
+func (s *ReportService) runTimesheetJob(jobID uuid.UUID, filter TimesheetFilter, format string) {
+	if err := s.db.Model(&database.ReportJob{}).Where("id = ?", jobID).Update("status", "running").Error; err != nil {
+		log.Printf("Failed to mark report job %s as running: %v", jobID, err)
+	}
+
+	var buf bytes.Buffer
+	err := s.WriteTimesheet(&buf, filter, format)
+	now := time.Now()
+
+	updates := map[string]interface{}{"completed_at": now}
+	if err != nil {
+		updates["status"] = "failed"
+		updates["error"] = err.Error()
+	} else {
+		updates["status"] = "completed"
+		updates["result"] = buf.Bytes()
+	}
+
+	if err := s.db.Model(&database.ReportJob{}).Where("id = ?", jobID).Updates(updates).Error; err != nil {
+		log.Printf("Failed to store result for report job %s: %v", jobID, err)
+	}
+}
+
+// GetReportJob retrieves a report job by ID
+func (s *ReportService) GetReportJob(id uuid.UUID) (*database.ReportJob, error) {
+	var job database.ReportJob
+	if err := s.db.Where("id = ?", id).First(&job).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "report job not found")
+		}
+		return nil, fmt.Errorf("failed to get report job: %w", err)
+	}
+	return &job, nil
+}
+
+// TimesheetContentType returns the HTTP content type for a report format
+func TimesheetContentType(format string) string {
+	switch format {
+	case "csv":
+		return "text/csv"
+	case "pdf":
+		return "application/pdf"
+	default:
+		return "application/json"
+	}
+}
+
+func roundHours(hours float64) float64 {
+	return math.Round(hours*100) / 100
+}
+
+func formatHours(hours float64) string {
+	return strconv.FormatFloat(hours, 'f', 2, 64)
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
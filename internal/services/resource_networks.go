@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/logging"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+	"gorm.io/gorm"
+)
+
+type clientIPKey struct{}
+
+// WithClientIP returns a copy of ctx carrying the IP address of the client
+// behind a request, which resource network allowlists are checked against
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIP returns the client IP address carried by ctx, or "" if there is none
+func ClientIP(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+// ResourceNetworks returns the CIDR ranges a resource's permissions may be used from
+func ResourceNetworks(resource *database.Resource) []string {
+	var networks []string
+	if resource.AllowedNetworks.Status == pgtype.Present {
+		if err := resource.AllowedNetworks.AssignTo(&networks); err != nil {
+			return nil
+		}
+	}
+	return networks
+}
+
+// networksContain reports whether ip falls within one of networks
+func networksContain(networks []string, ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range networks {
+		if _, ipNet, err := net.ParseCIDR(network); err == nil && ipNet.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckResourceNetwork checks that the client of ctx may use permissions, held
+// by user or stood in for by a read grant, from its IP address: a permission
+// whose resource declares allowed networks requires the IP to be in one. A user
+// loaded without their roles has their grants loaded. Holders of authorization.network_override_permission pass anyway, which
+// is logged. Denials are PERMISSION_DENIED and logged with the reason. Without
+// a client IP, as outside requests, nothing is checked.
+func (s *AuthService) CheckResourceNetwork(ctx context.Context, user *database.User, permissions ...string) error {
+	ip := ClientIP(ctx)
+	if ip == "" {
+		return nil
+	}
+	if user.Roles == nil {
+		grantee, err := loadUserGrants(ctx, s.stmtDB, user.ID)
+		if err != nil {
+			return fmt.Errorf("failed to load grants of user %s: %w", user.ID, err)
+		}
+		user = grantee
+	}
+	for _, permission := range permissions {
+		if permission == "" {
+			continue
+		}
+		resource := grantedResource(user, permission)
+		if resource == nil {
+			var err error
+			if resource, err = s.permissionResource(ctx, permission); err != nil {
+				return err
+			}
+			if resource == nil {
+				continue
+			}
+		}
+		networks := ResourceNetworks(resource)
+		if len(networks) == 0 || networksContain(networks, ip) {
+			continue
+		}
+
+		details := map[string]interface{}{
+			"permission_checked": permission,
+			"resource":           resource.Name,
+			"allowed_networks":   networks,
+		}
+		override := s.config.Authorization.NetworkOverridePermission
+		if override != "" && s.UserHasPermission(user, override) {
+			details["reason"] = "network allowlist overridden with " + override
+			s.logNetworkCheck(ctx, user, ip, true, details)
+			continue
+		}
+
+		details["reason"] = "client IP is outside the allowed networks"
+		details["error_code"] = string(CodePermissionDenied)
+		s.logNetworkCheck(ctx, user, ip, false, details)
+		return NewError(CodePermissionDenied, "permission denied: %s cannot be used from %s, which is outside the allowed networks of resource %s", permission, ip, resource.Name)
+	}
+	return nil
+}
+
+// grantedResource returns the resource of a permission, given as a UUID or in
+// "resource:action" format, among the user's grants
+func grantedResource(user *database.User, permission string) *database.Resource {
+	permissionID, idErr := uuid.Parse(permission)
+	resourceName, _, _ := strings.Cut(permission, ":")
+	for i := range user.Roles {
+		for j := range user.Roles[i].Permissions {
+			granted := &user.Roles[i].Permissions[j]
+			if idErr == nil && granted.ID == permissionID || idErr != nil && granted.Resource.Name == resourceName {
+				return &granted.Resource
+			}
+		}
+	}
+	return nil
+}
+
+// permissionResource loads the resource of a permission the user is not
+// granted, given as a UUID or in "resource:action" format, or returns nil when
+// there is none
+func (s *AuthService) permissionResource(ctx context.Context, permission string) (*database.Resource, error) {
+	query := s.stmtDB.WithContext(ctx)
+	if permissionID, err := uuid.Parse(permission); err == nil {
+		query = query.Where("id = (?)", s.stmtDB.Model(&database.Permission{}).Select("resource_id").Where("id = ?", permissionID))
+	} else {
+		resourceName, _, _ := strings.Cut(permission, ":")
+		query = query.Where("name = ?", resourceName)
+	}
+	var resource database.Resource
+	if err := query.Take(&resource).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get resource of %s: %w", permission, err)
+	}
+	return &resource, nil
+}
+
+// logNetworkCheck records a resource network allowlist denial, or its
+// override, in the authentication log
+func (s *AuthService) logNetworkCheck(ctx context.Context, user *database.User, ip string, success bool, details map[string]interface{}) {
+	if err := s.LogAuthentication(map[string]interface{}{
+		"request_id": logging.RequestID(ctx),
+		"user_id":    user.ID,
+		"type":       "mfa",
+		"success":    success,
+		"ip_address": ip,
+		"details":    details,
+	}); err != nil {
+		log.Printf("Failed to log resource network check: %v", err)
+	}
+}
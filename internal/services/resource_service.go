@@ -1,6 +1,7 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
@@ -10,22 +11,24 @@ import (
 )
 
 type ResourceService struct {
-	db *gorm.DB
+	db     *gorm.DB
+	events *PermissionEvents
 }
 
-func NewResourceService(db *gorm.DB) *ResourceService {
-	return &ResourceService{db: db}
+func NewResourceService(db *gorm.DB, events *PermissionEvents) *ResourceService {
+	return &ResourceService{db: db, events: events}
 }
 
-// CreateResource creates a new resource
-func (s *ResourceService) CreateResource(name, resourceType, location, department string, active bool) (*database.Resource, error) {
+// CreateResource creates a new resource. allowedNetworks are the CIDR ranges
+// its permissions may be used from; empty allows any network.
+func (s *ResourceService) CreateResource(name, resourceType, location, department string, active bool, allowedNetworks []string) (*database.Resource, error) {
 	// Validate resource name - no colons allowed to avoid ambiguity in permission format
 	if strings.Contains(name, ":") {
-		return nil, fmt.Errorf("resource name cannot contain colons (':') to avoid ambiguity in permission format")
+		return nil, NewError(CodeValidationFailed, "resource name cannot contain colons (':') to avoid ambiguity in permission format")
 	}
 
 	// Validate resource type
-	validTypes := []string{"server", "service", "database", "application"}
+	validTypes := []string{"server", "service", "database", "application", "door"}
 	validType := false
 	for _, t := range validTypes {
 		if resourceType == t {
@@ -34,16 +37,21 @@ func (s *ResourceService) CreateResource(name, resourceType, location, departmen
 		}
 	}
 	if !validType {
-		return nil, fmt.Errorf("resource type must be one of: %v", validTypes)
+		return nil, NewError(CodeValidationFailed, "resource type must be one of: %v", validTypes)
+	}
+	networks, err := cidrNetworksJSONB(allowedNetworks)
+	if err != nil {
+		return nil, err
 	}
 
 	resource := database.Resource{
-		ID:         uuid.New(),
-		Name:       name,
-		Type:       resourceType,
-		Location:   location,
-		Department: department,
-		Active:     active,
+		ID:              uuid.New(),
+		Name:            name,
+		Type:            resourceType,
+		Location:        location,
+		Department:      department,
+		Active:          active,
+		AllowedNetworks: networks,
 	}
 
 	if err := s.db.Create(&resource).Error; err != nil {
@@ -57,7 +65,10 @@ func (s *ResourceService) CreateResource(name, resourceType, location, departmen
 func (s *ResourceService) GetResourceByID(resourceID uuid.UUID) (*database.Resource, error) {
 	var resource database.Resource
 	if err := s.db.Where("id = ?", resourceID).First(&resource).Error; err != nil {
-		return nil, fmt.Errorf("resource not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "resource not found")
+		}
+		return nil, fmt.Errorf("failed to get resource: %w", err)
 	}
 	return &resource, nil
 }
@@ -66,7 +77,10 @@ func (s *ResourceService) GetResourceByID(resourceID uuid.UUID) (*database.Resou
 func (s *ResourceService) GetResourceByName(name string) (*database.Resource, error) {
 	var resource database.Resource
 	if err := s.db.Where("name = ?", name).First(&resource).Error; err != nil {
-		return nil, fmt.Errorf("resource not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "resource not found")
+		}
+		return nil, fmt.Errorf("failed to get resource: %w", err)
 	}
 	return &resource, nil
 }
@@ -74,7 +88,7 @@ func (s *ResourceService) GetResourceByName(name string) (*database.Resource, er
 // ListResources retrieves all resources
 func (s *ResourceService) ListResources() ([]database.Resource, error) {
 	var resources []database.Resource
-	if err := s.db.Find(&resources).Error; err != nil {
+	if err := database.ReadReplica(s.db).Find(&resources).Error; err != nil {
 		return nil, fmt.Errorf("failed to fetch resources: %w", err)
 	}
 	return resources, nil
@@ -83,7 +97,7 @@ func (s *ResourceService) ListResources() ([]database.Resource, error) {
 // ListActiveResources retrieves only active resources
 func (s *ResourceService) ListActiveResources() ([]database.Resource, error) {
 	var resources []database.Resource
-	if err := s.db.Where("active = ?", true).Find(&resources).Error; err != nil {
+	if err := database.ReadReplica(s.db).Where("active = ?", true).Find(&resources).Error; err != nil {
 		return nil, fmt.Errorf("failed to fetch active resources: %w", err)
 	}
 	return resources, nil
@@ -93,19 +107,22 @@ func (s *ResourceService) ListActiveResources() ([]database.Resource, error) {
 func (s *ResourceService) UpdateResource(resourceID uuid.UUID, updates map[string]interface{}) (*database.Resource, error) {
 	var resource database.Resource
 	if err := s.db.Where("id = ?", resourceID).First(&resource).Error; err != nil {
-		return nil, fmt.Errorf("resource not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "resource not found")
+		}
+		return nil, fmt.Errorf("failed to get resource: %w", err)
 	}
 
 	// Validate resource name if it's being updated - no colons allowed
 	if name, ok := updates["name"].(string); ok {
 		if strings.Contains(name, ":") {
-			return nil, fmt.Errorf("resource name cannot contain colons (':') to avoid ambiguity in permission format")
+			return nil, NewError(CodeValidationFailed, "resource name cannot contain colons (':') to avoid ambiguity in permission format")
 		}
 	}
 
 	// Validate resource type if it's being updated
 	if resourceType, ok := updates["type"].(string); ok {
-		validTypes := []string{"server", "service", "database", "application"}
+		validTypes := []string{"server", "service", "database", "application", "door"}
 		validType := false
 		for _, t := range validTypes {
 			if resourceType == t {
@@ -114,14 +131,29 @@ func (s *ResourceService) UpdateResource(resourceID uuid.UUID, updates map[strin
 			}
 		}
 		if !validType {
-			return nil, fmt.Errorf("resource type must be one of: %v", validTypes)
+			return nil, NewError(CodeValidationFailed, "resource type must be one of: %v", validTypes)
 		}
 	}
+	if networks, ok := updates["allowed_networks"].([]string); ok {
+		networksJSONB, err := cidrNetworksJSONB(networks)
+		if err != nil {
+			return nil, err
+		}
+		updates["allowed_networks"] = networksJSONB
+	}
 
 	if err := s.db.Model(&resource).Updates(updates).Error; err != nil {
 		return nil, fmt.Errorf("failed to update resource: %w", err)
 	}
 
+	// Renaming, (de)activating or restricting a resource changes the decisions for its permissions
+	_, renamed := updates["name"]
+	_, toggled := updates["active"]
+	_, restricted := updates["allowed_networks"]
+	if renamed || toggled || restricted {
+		s.publishResourceInvalidation("resource_updated", resource.ID)
+	}
+
 	// Reload resource
 	if err := s.db.Where("id = ?", resourceID).First(&resource).Error; err != nil {
 		return nil, fmt.Errorf("failed to reload resource: %w", err)
@@ -134,12 +166,40 @@ func (s *ResourceService) UpdateResource(resourceID uuid.UUID, updates map[strin
 func (s *ResourceService) DeleteResource(resourceID uuid.UUID) error {
 	var resource database.Resource
 	if err := s.db.Where("id = ?", resourceID).First(&resource).Error; err != nil {
-		return fmt.Errorf("resource not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return NewError(CodeNotFound, "resource not found")
+		}
+		return fmt.Errorf("failed to get resource: %w", err)
 	}
 
+	permissionIDs := s.events.PermissionsForResources(resource.ID)
+	roleIDs := s.events.RolesForPermissions(permissionIDs...)
+	userIDs := s.events.UsersForRoles(roleIDs...)
+
 	if err := s.db.Delete(&resource).Error; err != nil {
 		return fmt.Errorf("failed to delete resource: %w", err)
 	}
 
+	s.events.Publish(PermissionInvalidation{
+		Reason:        "resource_deleted",
+		UserIDs:       userIDs,
+		RoleIDs:       roleIDs,
+		PermissionIDs: permissionIDs,
+		ResourceIDs:   []uuid.UUID{resource.ID},
+	})
+
 	return nil
+}
+
+// publishResourceInvalidation publishes an invalidation for every user granted a permission on the resource
+func (s *ResourceService) publishResourceInvalidation(reason string, resourceID uuid.UUID) {
+	permissionIDs := s.events.PermissionsForResources(resourceID)
+	roleIDs := s.events.RolesForPermissions(permissionIDs...)
+	s.events.Publish(PermissionInvalidation{
+		Reason:        reason,
+		UserIDs:       s.events.UsersForRoles(roleIDs...),
+		RoleIDs:       roleIDs,
+		PermissionIDs: permissionIDs,
+		ResourceIDs:   []uuid.UUID{resourceID},
+	})
 } 
\ No newline at end of file
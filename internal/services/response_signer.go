@@ -0,0 +1,71 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+
+	"github.com/YubiApp/internal/config"
+)
+
+// ResponseSigner signs API response bodies with an Ed25519 key so integrators can
+// check a response came from this server and answers their nonce
+type ResponseSigner struct {
+	privateKey ed25519.PrivateKey
+	keyID      string
+}
+
+// NewResponseSigner loads the signing key from response_signing.private_key. When
+// none is configured the key is derived from auth.jwt_secret, so it stays stable
+// across restarts.
+func NewResponseSigner(cfg *config.Config) (*ResponseSigner, error) {
+	var seed []byte
+	if cfg.ResponseSigning.PrivateKey != "" {
+		decoded, err := base64.StdEncoding.DecodeString(cfg.ResponseSigning.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("response_signing.private_key is not valid base64: %w", err)
+		}
+		if len(decoded) != ed25519.SeedSize {
+			return nil, fmt.Errorf("response_signing.private_key must be a %d-byte Ed25519 seed", ed25519.SeedSize)
+		}
+		seed = decoded
+	} else {
+		log.Printf("response_signing.private_key not set; deriving the signing key from auth.jwt_secret")
+		sum := sha256.Sum256([]byte("yubiapp-response-signing:" + cfg.Auth.JWTSecret))
+		seed = sum[:]
+	}
+
+	privateKey := ed25519.NewKeyFromSeed(seed)
+	publicKey := privateKey.Public().(ed25519.PublicKey)
+	keyHash := sha256.Sum256(publicKey)
+
+	return &ResponseSigner{
+		privateKey: privateKey,
+		keyID:      hex.EncodeToString(keyHash[:8]),
+	}, nil
+}
+
+// Sign returns the base64 Ed25519 signature of body
+func (s *ResponseSigner) Sign(body []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(s.privateKey, body))
+}
+
+// KeyID identifies the signing key; it changes whenever the key does
+func (s *ResponseSigner) KeyID() string {
+	return s.keyID
+}
+
+// PublicJWK returns the verification key as a JSON Web Key
+func (s *ResponseSigner) PublicJWK() map[string]interface{} {
+	return map[string]interface{}{
+		"kty": "OKP",
+		"crv": "Ed25519",
+		"alg": "EdDSA",
+		"use": "sig",
+		"kid": s.keyID,
+		"x":   base64.RawURLEncoding.EncodeToString(s.privateKey.Public().(ed25519.PublicKey)),
+	}
+}
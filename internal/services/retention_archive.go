@@ -0,0 +1,322 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// archiveTable is a table retention.tables can set a policy for
+type archiveTable struct {
+	ageColumn       string // Rows are archived once this is older than the policy
+	holdColumn      string // The time legal holds are matched against
+	partitionColumn string // The table is partitioned by month on this
+}
+
+// archiveTables are the tables archival can export and delete. Open
+// activities have no to_datetime, so they are never archived.
+var archiveTables = map[string]archiveTable{
+	"authentication_logs":   {ageColumn: "created_at", holdColumn: "created_at", partitionColumn: "created_at"},
+	"user_activity_history": {ageColumn: "to_datetime", holdColumn: "from_datetime", partitionColumn: "from_datetime"},
+}
+
+// ArchiveTables are the names of the tables retention.tables can set a policy for
+var ArchiveTables = []string{"authentication_logs", "user_activity_history"}
+
+// archiveKeyTime formats the range in archive file names
+const archiveKeyTime = "20060102T150405Z"
+
+// maxRestoreErrors caps the row errors a restore reports
+const maxRestoreErrors = 10
+
+// ArchiveResult summarises the archival of one table
+type ArchiveResult struct {
+	Table    string    `json:"table"`
+	Cutoff   time.Time `json:"cutoff"`
+	Files    int       `json:"files"`
+	Archived int64     `json:"archived"`
+}
+
+// ArchiveFile is an archive of rows of a table whose age column falls in [From, To]
+type ArchiveFile struct {
+	Table string    `json:"table"`
+	Key   string    `json:"key"`
+	From  time.Time `json:"from"`
+	To    time.Time `json:"to"`
+}
+
+// RestoreResult summarises a restore of archived rows
+type RestoreResult struct {
+	Table    string   `json:"table"`
+	Files    int      `json:"files"`
+	Restored int64    `json:"restored"`
+	Failed   int      `json:"failed"`
+	Errors   []string `json:"errors,omitempty"` // The first few failures
+}
+
+// archiveRow is a row being archived, as JSON
+type archiveRow struct {
+	ID         uuid.UUID
+	ArchivedAt time.Time
+	Data       string
+}
+
+// StartArchiver periodically archives expired rows. It does nothing when
+// retention.archive_interval is zero or no table has a policy.
+func (s *RetentionService) StartArchiver() {
+	interval := s.config.Retention.ArchiveInterval
+	if interval <= 0 || !s.archiving() || s.archiveStop != nil {
+		return
+	}
+
+	s.archiveStop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				results, err := s.Archive(context.Background(), time.Now())
+				for _, result := range results {
+					if result.Archived > 0 {
+						log.Printf("Retention archival: %d %s rows archived to %d files", result.Archived, result.Table, result.Files)
+					}
+				}
+				if err != nil {
+					log.Printf("Retention archival failed: %v", err)
+				}
+			case <-s.archiveStop:
+				return
+			}
+		}
+	}()
+}
+
+// StopArchiver stops the background archival job
+func (s *RetentionService) StopArchiver() {
+	if s.archiveStop != nil {
+		close(s.archiveStop)
+		s.archiveStop = nil
+	}
+}
+
+// archiving reports whether any table has a retention policy
+func (s *RetentionService) archiving() bool {
+	for _, days := range s.config.Retention.Tables {
+		if days > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Archive exports the rows of each table older than its retention.tables
+// policy to gzip-compressed NDJSON files in the archive store, deleting each
+// batch once its file is written. Rows under a legal hold are kept.
+func (s *RetentionService) Archive(ctx context.Context, now time.Time) ([]ArchiveResult, error) {
+	if !s.archiving() {
+		return nil, nil
+	}
+	store, err := NewArchiveStore(s.config.Retention.Archive)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []ArchiveResult
+	for _, table := range ArchiveTables {
+		days := s.config.Retention.Tables[table]
+		if days <= 0 {
+			continue
+		}
+		result, err := s.archiveTable(ctx, store, table, now.AddDate(0, 0, -days))
+		results = append(results, *result)
+		if err != nil {
+			return results, fmt.Errorf("failed to archive %s: %w", table, err)
+		}
+	}
+	return results, nil
+}
+
+// archiveTable archives the rows of table older than cutoff, a batch per file
+func (s *RetentionService) archiveTable(ctx context.Context, store ArchiveStore, table string, cutoff time.Time) (*ArchiveResult, error) {
+	spec := archiveTables[table]
+	result := &ArchiveResult{Table: table, Cutoff: cutoff}
+	batch := s.config.Retention.ArchiveBatch
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		var rows []archiveRow
+		query := s.db.WithContext(ctx).Table(table).
+			Select(fmt.Sprintf("id, %[1]s.%[2]s AS archived_at, row_to_json(%[1]s)::text AS data", table, spec.ageColumn)).
+			Where(fmt.Sprintf("%[1]s.%[2]s < ? AND %[1]s.%[3]s < ?", table, spec.ageColumn, spec.partitionColumn), cutoff, cutoff)
+		query = ExcludeHeldRecords(query, table+".user_id", table+"."+spec.holdColumn)
+		if err := query.Order(spec.ageColumn + ", id").Limit(batch).Scan(&rows).Error; err != nil {
+			return result, fmt.Errorf("failed to read expired rows: %w", err)
+		}
+		if len(rows) == 0 {
+			return result, nil
+		}
+
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		ids := make([]uuid.UUID, len(rows))
+		for i, row := range rows {
+			ids[i] = row.ID
+			writer.Write([]byte(row.Data))
+			writer.Write([]byte("\n"))
+		}
+		if err := writer.Close(); err != nil {
+			return result, fmt.Errorf("failed to compress archive: %w", err)
+		}
+
+		// The file is written before the rows go, so a failure at worst
+		// archives them twice; restores skip rows already present
+		key := archiveKey(table, rows[0].ArchivedAt, rows[len(rows)-1].ArchivedAt, rows[0].ID)
+		if err := store.Put(ctx, key, buf.Bytes()); err != nil {
+			return result, err
+		}
+		// Bounding the partition column keeps the delete out of current partitions
+		deleted := s.db.WithContext(ctx).Exec(fmt.Sprintf("DELETE FROM %s WHERE id IN ? AND %s < ?", table, spec.partitionColumn), ids, cutoff)
+		if deleted.Error != nil {
+			return result, fmt.Errorf("failed to delete archived rows: %w", deleted.Error)
+		}
+		result.Files++
+		result.Archived += deleted.RowsAffected
+
+		if len(rows) < batch {
+			return result, nil
+		}
+	}
+}
+
+// ListArchives returns the archive files of table with rows in [from, to),
+// oldest first. Zero times leave that end open.
+func (s *RetentionService) ListArchives(ctx context.Context, table string, from, to time.Time) ([]ArchiveFile, error) {
+	if _, ok := archiveTables[table]; !ok {
+		return nil, NewError(CodeValidationFailed, "unknown archive table '%s' (expected one of %s)", table, strings.Join(ArchiveTables, ", "))
+	}
+	store, err := NewArchiveStore(s.config.Retention.Archive)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := store.List(ctx, table+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	var files []ArchiveFile
+	for _, key := range keys {
+		file, ok := parseArchiveKey(table, key)
+		if !ok {
+			continue
+		}
+		// Names are to the second, so a file may hold rows up to a second past its To
+		if (!from.IsZero() && file.To.Add(time.Second).Before(from)) || (!to.IsZero() && !file.From.Before(to)) {
+			continue
+		}
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].From.Before(files[j].From) })
+	return files, nil
+}
+
+// RestoreArchive inserts the archived rows of table in [from, to) back into
+// it, for investigations. Rows already present are left alone, so a range can
+// be restored again; place a legal hold over it to keep archival from
+// removing the rows again.
+func (s *RetentionService) RestoreArchive(ctx context.Context, table string, from, to time.Time) (*RestoreResult, error) {
+	files, err := s.ListArchives(ctx, table, from, to)
+	if err != nil {
+		return nil, err
+	}
+	store, err := NewArchiveStore(s.config.Retention.Archive)
+	if err != nil {
+		return nil, err
+	}
+
+	spec := archiveTables[table]
+	insert := fmt.Sprintf(`INSERT INTO %[1]s SELECT * FROM json_populate_record(NULL::%[1]s, ?::json) r
+		WHERE (?::timestamptz IS NULL OR r.%[2]s >= ?) AND (?::timestamptz IS NULL OR r.%[2]s < ?)
+		ON CONFLICT DO NOTHING`, table, spec.ageColumn)
+	fromArg, toArg := optionalTime(from), optionalTime(to)
+
+	result := &RestoreResult{Table: table}
+	for _, file := range files {
+		data, err := store.Get(ctx, file.Key)
+		if err != nil {
+			return result, err
+		}
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return result, fmt.Errorf("archive %s is not gzip-compressed: %w", file.Key, err)
+		}
+
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if line == "" {
+				continue
+			}
+			res := s.db.WithContext(ctx).Exec(insert, line, fromArg, fromArg, toArg, toArg)
+			if res.Error != nil {
+				result.Failed++
+				if len(result.Errors) < maxRestoreErrors {
+					result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", file.Key, res.Error))
+				}
+				continue
+			}
+			result.Restored += res.RowsAffected
+		}
+		if err := scanner.Err(); err != nil {
+			return result, fmt.Errorf("failed to read archive %s: %w", file.Key, err)
+		}
+		result.Files++
+	}
+	return result, nil
+}
+
+// archiveKey names the archive of table rows from first to last, e.g.
+// authentication_logs/2024/20240101T000000Z_20240103T120000Z_1f2e3d4c.ndjson.gz
+func archiveKey(table string, first, last time.Time, firstID uuid.UUID) string {
+	return fmt.Sprintf("%s/%d/%s_%s_%s.ndjson.gz", table, first.UTC().Year(),
+		first.UTC().Format(archiveKeyTime), last.UTC().Format(archiveKeyTime), firstID.String()[:8])
+}
+
+// parseArchiveKey reads the range back from an archive key
+func parseArchiveKey(table, key string) (ArchiveFile, bool) {
+	name := strings.TrimSuffix(path.Base(key), ".ndjson.gz")
+	parts := strings.Split(name, "_")
+	if len(parts) != 3 || name == path.Base(key) {
+		return ArchiveFile{}, false
+	}
+	from, err := time.Parse(archiveKeyTime, parts[0])
+	if err != nil {
+		return ArchiveFile{}, false
+	}
+	to, err := time.Parse(archiveKeyTime, parts[1])
+	if err != nil {
+		return ArchiveFile{}, false
+	}
+	return ArchiveFile{Table: table, Key: key, From: from, To: to}, true
+}
+
+// optionalTime is t as a query argument, NULL when zero
+func optionalTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
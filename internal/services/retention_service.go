@@ -0,0 +1,214 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RetentionService hard-deletes soft-deleted users and devices once they are past
+// the retention period, anonymizing their authentication logs, and archives
+// expired log and activity rows. Records under an active legal hold are left
+// in place.
+type RetentionService struct {
+	db          *gorm.DB
+	config      *config.Config
+	stop        chan struct{}
+	archiveStop chan struct{}
+}
+
+func NewRetentionService(db *gorm.DB, config *config.Config) *RetentionService {
+	return &RetentionService{
+		db:     db,
+		config: config,
+	}
+}
+
+// PurgeResult summarises a purge run
+type PurgeResult struct {
+	Cutoff         time.Time   `json:"cutoff"`
+	UsersPurged    int         `json:"users_purged"`
+	DevicesPurged  int         `json:"devices_purged"`
+	LogsAnonymized int64       `json:"logs_anonymized"`
+	Skipped        []PurgeSkip `json:"skipped,omitempty"`
+}
+
+// PurgeSkip is a record that was due for purging but was kept
+type PurgeSkip struct {
+	Type   string    `json:"type"` // "user" or "device"
+	ID     uuid.UUID `json:"id"`
+	Reason string    `json:"reason"`
+}
+
+// StartPurger periodically purges expired records. It does nothing when
+// retention.purge_after or retention.purge_interval is zero.
+func (s *RetentionService) StartPurger() {
+	interval := s.config.Retention.PurgeInterval
+	if s.config.Retention.PurgeAfter <= 0 || interval <= 0 || s.stop != nil {
+		return
+	}
+
+	s.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				result, err := s.Purge(time.Now())
+				if err != nil {
+					log.Printf("Retention purge failed: %v", err)
+					continue
+				}
+				if result.UsersPurged > 0 || result.DevicesPurged > 0 || len(result.Skipped) > 0 {
+					log.Printf("Retention purge: %d users, %d devices purged, %d logs anonymized, %d skipped",
+						result.UsersPurged, result.DevicesPurged, result.LogsAnonymized, len(result.Skipped))
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopPurger stops the background purge job
+func (s *RetentionService) StopPurger() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// Purge hard-deletes users and devices soft-deleted before now minus
+// retention.purge_after. Their authentication logs are anonymized first; logs
+// under a legal hold keep their owner, which keeps the owner from being deleted.
+func (s *RetentionService) Purge(now time.Time) (*PurgeResult, error) {
+	if s.config.Retention.PurgeAfter <= 0 {
+		return nil, fmt.Errorf("retention purging is disabled (retention.purge_after is 0)")
+	}
+	result := &PurgeResult{Cutoff: now.Add(-s.config.Retention.PurgeAfter)}
+
+	// Devices first, so users whose devices are purged can go in the same run
+	var devices []database.Device
+	if err := s.db.Unscoped().
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", result.Cutoff).
+		Find(&devices).Error; err != nil {
+		return nil, fmt.Errorf("failed to find expired devices: %w", err)
+	}
+	for i := range devices {
+		if err := s.purgeDevice(&devices[i], result); err != nil {
+			result.Skipped = append(result.Skipped, PurgeSkip{Type: "device", ID: devices[i].ID, Reason: err.Error()})
+			continue
+		}
+		result.DevicesPurged++
+	}
+
+	// Users named by a hold are kept outright
+	var users []database.User
+	if err := s.db.Unscoped().
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", result.Cutoff).
+		Where("NOT EXISTS (SELECT 1 FROM legal_holds lh WHERE lh.released_at IS NULL AND lh.user_id = users.id)").
+		Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to find expired users: %w", err)
+	}
+	for i := range users {
+		if err := s.purgeUser(&users[i], result); err != nil {
+			result.Skipped = append(result.Skipped, PurgeSkip{Type: "user", ID: users[i].ID, Reason: err.Error()})
+			continue
+		}
+		result.UsersPurged++
+	}
+
+	return result, nil
+}
+
+// purgeDevice anonymizes a device's unheld logs and deletes it along with its
+// registration history
+func (s *RetentionService) purgeDevice(device *database.Device, result *PurgeResult) error {
+	anonymized, err := s.anonymizeLogs("device_id", device.ID)
+	result.LogsAnonymized += anonymized
+	if err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Where("device_id = ?", device.ID)
+		query = ExcludeHeldRecords(query, "COALESCE(target_user_id, registrar_user_id)", "created_at")
+		if err := query.Delete(&database.DeviceRegistration{}).Error; err != nil {
+			return fmt.Errorf("failed to delete device registrations: %w", err)
+		}
+		// Held logs or registrations still reference the device and make this fail
+		if err := tx.Unscoped().Delete(&database.Device{}, "id = ?", device.ID).Error; err != nil {
+			return fmt.Errorf("device is still referenced by held records: %w", err)
+		}
+		return nil
+	})
+}
+
+// purgeUser anonymizes a user's unheld logs and deletes the user. Activity
+// history is removed by cascade, so a user with held activity is kept.
+func (s *RetentionService) purgeUser(user *database.User, result *PurgeResult) error {
+	var devices []database.Device
+	if err := s.db.Unscoped().Where("user_id = ?", user.ID).Find(&devices).Error; err != nil {
+		return fmt.Errorf("failed to load devices: %w", err)
+	}
+	for i := range devices {
+		if err := s.purgeDevice(&devices[i], result); err != nil {
+			return fmt.Errorf("device %s: %w", devices[i].ID, err)
+		}
+		result.DevicesPurged++
+	}
+
+	anonymized, err := s.anonymizeLogs("user_id", user.ID)
+	result.LogsAnonymized += anonymized
+	if err != nil {
+		return err
+	}
+
+	var heldActivities int64
+	if err := s.db.Model(&database.UserActivityHistory{}).
+		Where("user_id = ?", user.ID).
+		Where(`EXISTS (
+			SELECT 1 FROM legal_holds lh
+			WHERE lh.released_at IS NULL
+			AND (lh.from_datetime IS NULL OR lh.from_datetime <= user_activity_history.from_datetime)
+			AND (lh.to_datetime IS NULL OR lh.to_datetime >= user_activity_history.from_datetime)
+		)`).
+		Count(&heldActivities).Error; err != nil {
+		return fmt.Errorf("failed to check held activity: %w", err)
+	}
+	if heldActivities > 0 {
+		return fmt.Errorf("user has %d activity records under a legal hold", heldActivities)
+	}
+
+	if err := s.db.Unscoped().Delete(&database.User{}, "id = ?", user.ID).Error; err != nil {
+		return fmt.Errorf("user is still referenced by held records: %w", err)
+	}
+	return nil
+}
+
+// anonymizeLogs detaches authentication logs from a user or device, skipping logs
+// under a legal hold. Detaching a user also clears the client address and agent.
+func (s *RetentionService) anonymizeLogs(column string, id uuid.UUID) (int64, error) {
+	updates := map[string]interface{}{
+		column: nil,
+		"otp":  "",
+	}
+	if column == "user_id" {
+		updates["ip_address"] = ""
+		updates["user_agent"] = ""
+	}
+
+	query := s.db.Model(&database.AuthenticationLog{}).Where(column+" = ?", id)
+	query = ExcludeHeldRecords(query, "user_id", "created_at")
+	res := query.Updates(updates)
+	if res.Error != nil {
+		return 0, fmt.Errorf("failed to anonymize authentication logs: %w", res.Error)
+	}
+	return res.RowsAffected, nil
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/YubiApp/internal/database"
@@ -9,11 +10,12 @@ import (
 )
 
 type RoleService struct {
-	db *gorm.DB
+	db     *gorm.DB
+	events *PermissionEvents
 }
 
-func NewRoleService(db *gorm.DB) *RoleService {
-	return &RoleService{db: db}
+func NewRoleService(db *gorm.DB, events *PermissionEvents) *RoleService {
+	return &RoleService{db: db, events: events}
 }
 
 // CreateRole creates a new role
@@ -35,7 +37,10 @@ func (s *RoleService) CreateRole(name, description string) (*database.Role, erro
 func (s *RoleService) GetRoleByID(roleID uuid.UUID) (*database.Role, error) {
 	var role database.Role
 	if err := s.db.Preload("Permissions.Resource").Where("id = ?", roleID).First(&role).Error; err != nil {
-		return nil, fmt.Errorf("role not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "role not found")
+		}
+		return nil, fmt.Errorf("failed to get role: %w", err)
 	}
 	return &role, nil
 }
@@ -44,7 +49,10 @@ func (s *RoleService) GetRoleByID(roleID uuid.UUID) (*database.Role, error) {
 func (s *RoleService) GetRoleByName(name string) (*database.Role, error) {
 	var role database.Role
 	if err := s.db.Preload("Permissions.Resource").Where("name = ?", name).First(&role).Error; err != nil {
-		return nil, fmt.Errorf("role not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "role not found")
+		}
+		return nil, fmt.Errorf("failed to get role: %w", err)
 	}
 	return &role, nil
 }
@@ -52,20 +60,33 @@ func (s *RoleService) GetRoleByName(name string) (*database.Role, error) {
 // ListRoles retrieves all roles
 func (s *RoleService) ListRoles() ([]database.Role, error) {
 	var roles []database.Role
-	if err := s.db.Preload("Permissions.Resource").Find(&roles).Error; err != nil {
+	if err := database.ReadReplica(s.db).Preload("Permissions.Resource").Find(&roles).Error; err != nil {
 		return nil, fmt.Errorf("failed to fetch roles: %w", err)
 	}
 	return roles, nil
 }
 
-// UpdateRole updates a role
-func (s *RoleService) UpdateRole(roleID uuid.UUID, updates map[string]interface{}) (*database.Role, error) {
+// UpdateRole updates a role. A non-nil version must match the role's current
+// version.
+func (s *RoleService) UpdateRole(roleID uuid.UUID, version *int, updates map[string]interface{}) (*database.Role, error) {
 	var role database.Role
 	if err := s.db.Where("id = ?", roleID).First(&role).Error; err != nil {
-		return nil, fmt.Errorf("role not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "role not found")
+		}
+		return nil, fmt.Errorf("failed to get role: %w", err)
+	}
+	if err := checkVersion("role", role.Version, version); err != nil {
+		return nil, err
+	}
+	if ownerID, ok := updates["owner_id"].(*uuid.UUID); ok && ownerID != nil {
+		var owner database.User
+		if err := s.db.Select("id").Where("id = ?", *ownerID).First(&owner).Error; err != nil {
+			return nil, NewError(CodeValidationFailed, "owner %s not found", *ownerID)
+		}
 	}
 
-	if err := s.db.Model(&role).Updates(updates).Error; err != nil {
+	if err := updateVersioned(s.db, "role", &role, role.Version, updates); err != nil {
 		return nil, fmt.Errorf("failed to update role: %w", err)
 	}
 
@@ -81,13 +102,24 @@ func (s *RoleService) UpdateRole(roleID uuid.UUID, updates map[string]interface{
 func (s *RoleService) DeleteRole(roleID uuid.UUID) error {
 	var role database.Role
 	if err := s.db.Where("id = ?", roleID).First(&role).Error; err != nil {
-		return fmt.Errorf("role not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return NewError(CodeNotFound, "role not found")
+		}
+		return fmt.Errorf("failed to get role: %w", err)
 	}
 
+	userIDs := s.events.UsersForRoles(role.ID)
+
 	if err := s.db.Delete(&role).Error; err != nil {
 		return fmt.Errorf("failed to delete role: %w", err)
 	}
 
+	s.events.Publish(PermissionInvalidation{
+		Reason:  "role_deleted",
+		UserIDs: userIDs,
+		RoleIDs: []uuid.UUID{role.ID},
+	})
+
 	return nil
 }
 
@@ -95,12 +127,18 @@ func (s *RoleService) DeleteRole(roleID uuid.UUID) error {
 func (s *RoleService) AssignPermissionToRole(roleID, permissionID uuid.UUID) error {
 	var role database.Role
 	if err := s.db.Where("id = ?", roleID).First(&role).Error; err != nil {
-		return fmt.Errorf("role not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return NewError(CodeNotFound, "role not found")
+		}
+		return fmt.Errorf("failed to get role: %w", err)
 	}
 
 	var permission database.Permission
 	if err := s.db.Preload("Resource").Where("id = ?", permissionID).First(&permission).Error; err != nil {
-		return fmt.Errorf("permission not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return NewError(CodeNotFound, "permission not found")
+		}
+		return fmt.Errorf("failed to get permission: %w", err)
 	}
 
 	// Check if assignment already exists
@@ -109,7 +147,7 @@ func (s *RoleService) AssignPermissionToRole(roleID, permissionID uuid.UUID) err
 		Where("roles.id = ? AND role_permissions.permission_id = ?", role.ID, permission.ID).Count(&count)
 	
 	if count > 0 {
-		return fmt.Errorf("permission %s:%s is already assigned to role %s", 
+		return NewError(CodeConflict, "permission %s:%s is already assigned to role %s",
 			permission.Resource.Name, permission.Action, role.Name)
 	}
 
@@ -117,6 +155,13 @@ func (s *RoleService) AssignPermissionToRole(roleID, permissionID uuid.UUID) err
 		return fmt.Errorf("failed to assign permission to role: %w", err)
 	}
 
+	s.events.Publish(PermissionInvalidation{
+		Reason:        "role_permission_assigned",
+		UserIDs:       s.events.UsersForRoles(role.ID),
+		RoleIDs:       []uuid.UUID{role.ID},
+		PermissionIDs: []uuid.UUID{permission.ID},
+	})
+
 	return nil
 }
 
@@ -124,17 +169,30 @@ func (s *RoleService) AssignPermissionToRole(roleID, permissionID uuid.UUID) err
 func (s *RoleService) RemovePermissionFromRole(roleID, permissionID uuid.UUID) error {
 	var role database.Role
 	if err := s.db.Where("id = ?", roleID).First(&role).Error; err != nil {
-		return fmt.Errorf("role not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return NewError(CodeNotFound, "role not found")
+		}
+		return fmt.Errorf("failed to get role: %w", err)
 	}
 
 	var permission database.Permission
 	if err := s.db.Preload("Resource").Where("id = ?", permissionID).First(&permission).Error; err != nil {
-		return fmt.Errorf("permission not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return NewError(CodeNotFound, "permission not found")
+		}
+		return fmt.Errorf("failed to get permission: %w", err)
 	}
 
 	if err := s.db.Model(&role).Association("Permissions").Delete(&permission); err != nil {
 		return fmt.Errorf("failed to remove permission from role: %w", err)
 	}
 
+	s.events.Publish(PermissionInvalidation{
+		Reason:        "role_permission_removed",
+		UserIDs:       s.events.UsersForRoles(role.ID),
+		RoleIDs:       []uuid.UUID{role.ID},
+		PermissionIDs: []uuid.UUID{permission.ID},
+	})
+
 	return nil
 } 
\ No newline at end of file
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Search result types, one per kind of record GET /search looks through
+const (
+	SearchUser   = "user"
+	SearchDevice = "device"
+	SearchRole   = "role"
+	SearchAction = "action"
+)
+
+// SearchTypes are the result types, in the order results are returned
+var SearchTypes = []string{SearchUser, SearchDevice, SearchRole, SearchAction}
+
+const (
+	minSearchLength    = 2
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+)
+
+// searchQueries select each type's matches for @query, with @pattern its
+// ILIKE substring pattern. The conditions match the trigram and tsvector
+// indexes of migration 0019, and score is the best trigram similarity.
+var searchQueries = map[string]string{
+	SearchUser: `SELECT 'user' AS type, id,
+		COALESCE(NULLIF(TRIM(first_name || ' ' || last_name), ''), username) AS title,
+		email AS subtitle, active,
+		GREATEST(similarity(username, @query), similarity(email, @query), similarity(first_name || ' ' || last_name, @query)) AS score
+	FROM users
+	WHERE deleted_at IS NULL AND (username ILIKE @pattern OR email ILIKE @pattern
+		OR (first_name || ' ' || last_name) ILIKE @pattern
+		OR to_tsvector('simple', first_name || ' ' || last_name) @@ plainto_tsquery('simple', @query))
+	ORDER BY score DESC, username LIMIT @limit`,
+
+	SearchDevice: `SELECT 'device' AS type, id,
+		COALESCE(NULLIF(name, ''), identifier) AS title,
+		type || ' ' || identifier AS subtitle, active,
+		GREATEST(similarity(identifier, @query), similarity(serial_number, @query)) AS score
+	FROM devices
+	WHERE deleted_at IS NULL AND (identifier ILIKE @pattern OR serial_number ILIKE @pattern)
+	ORDER BY score DESC, identifier LIMIT @limit`,
+
+	SearchRole: `SELECT 'role' AS type, id, name AS title, description AS subtitle, active,
+		similarity(name, @query) AS score
+	FROM roles
+	WHERE name ILIKE @pattern
+	ORDER BY score DESC, name LIMIT @limit`,
+
+	SearchAction: `SELECT 'action' AS type, id, name AS title, activity_type AS subtitle, active,
+		similarity(name, @query) AS score
+	FROM actions
+	WHERE name ILIKE @pattern
+	ORDER BY score DESC, name LIMIT @limit`,
+}
+
+// SearchResult is a record matching a search
+type SearchResult struct {
+	Type     string    `json:"type"` // One of SearchTypes
+	ID       uuid.UUID `json:"id"`
+	Title    string    `json:"title"`    // User's full name, device, role or action name
+	Subtitle string    `json:"subtitle"` // User's email, device type and identifier, role description or action activity type
+	Active   bool      `json:"active"`
+	Score    float64   `json:"score"` // Trigram similarity to the query, from 0 to 1
+}
+
+// SearchService looks through users, devices, roles and actions for the global search
+type SearchService struct {
+	db *gorm.DB
+}
+
+// NewSearchService creates a new search service
+func NewSearchService(db *gorm.DB) *SearchService {
+	return &SearchService{db: db}
+}
+
+// Search returns the records of the given types matching query, up to limit
+// of each type, grouped by type in SearchTypes order and best match first.
+// Limits outside 1 to 50 use the default of 10. A query shorter than two
+// characters, or an unknown type, is VALIDATION_FAILED.
+func (s *SearchService) Search(query string, types []string, limit int) ([]SearchResult, error) {
+	query = strings.TrimSpace(query)
+	if utf8.RuneCountInString(query) < minSearchLength {
+		return nil, NewError(CodeValidationFailed, "search query must be at least %d characters", minSearchLength)
+	}
+	for _, kind := range types {
+		if _, ok := searchQueries[kind]; !ok {
+			return nil, NewError(CodeValidationFailed, "unknown search type %s (expected one of %s)", kind, strings.Join(SearchTypes, ", "))
+		}
+	}
+	if limit < 1 || limit > maxSearchLimit {
+		limit = defaultSearchLimit
+	}
+
+	args := map[string]interface{}{"query": query, "pattern": "%" + escapeLike(query) + "%", "limit": limit}
+	results := []SearchResult{}
+	for _, kind := range SearchTypes {
+		if !slices.Contains(types, kind) {
+			continue
+		}
+		var matches []SearchResult
+		if err := database.ReadReplica(s.db).Raw(searchQueries[kind], args).Scan(&matches).Error; err != nil {
+			return nil, fmt.Errorf("failed to search %ss: %w", kind, err)
+		}
+		results = append(results, matches...)
+	}
+	return results, nil
+}
+
+// escapeLike escapes the LIKE wildcards in text so it matches literally
+func escapeLike(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(text)
+}
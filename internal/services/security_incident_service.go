@@ -0,0 +1,190 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Security incident statuses
+const (
+	IncidentStatusOpen     = "open"
+	IncidentStatusResolved = "resolved"
+)
+
+// Security incident types
+const (
+	// A user signed in with a recovery code; resolved by issuing a replacement device
+	IncidentRecoveryCodeUsed = "recovery_code_used"
+	// A break-glass credential was used; resolved by someone else's post-incident review
+	IncidentBreakGlassUsed = "break_glass_used"
+	// A YubiKey's OTP counters went backwards; its device stays inactive until re-activated
+	IncidentDeviceCloneSuspected = "device_clone_suspected"
+)
+
+// SecurityIncidentOpened is the payload of a security_incident.opened event
+type SecurityIncidentOpened struct {
+	IncidentID uuid.UUID `json:"incident_id"`
+	Type       string    `json:"type"`
+	UserID     uuid.UUID `json:"user_id"`
+	Username   string    `json:"username,omitempty"`
+	Email      string    `json:"email,omitempty"`
+	Details    string    `json:"details"`
+	IPAddress  string    `json:"ip_address,omitempty"`
+}
+
+// SecurityIncidentFilter selects incidents to list; zero values match everything
+type SecurityIncidentFilter struct {
+	Status string
+	Type   string
+	UserID *uuid.UUID
+	Limit  int
+	Offset int
+}
+
+// SecurityIncidentService records security incidents and their resolution
+type SecurityIncidentService struct {
+	db     *gorm.DB
+	events *EventBus
+}
+
+func NewSecurityIncidentService(db *gorm.DB, events *EventBus) *SecurityIncidentService {
+	return &SecurityIncidentService{
+		db:     db,
+		events: events,
+	}
+}
+
+// OpenIncident records a new open incident and publishes a
+// security_incident.opened event for it
+func (s *SecurityIncidentService) OpenIncident(incident *database.SecurityIncident) error {
+	if err := s.RecordIncident(s.db, incident); err != nil {
+		return err
+	}
+	s.PublishOpened(incident)
+	return nil
+}
+
+// RecordIncident records a new open incident in tx without announcing it; call
+// PublishOpened once tx has committed
+func (s *SecurityIncidentService) RecordIncident(tx *gorm.DB, incident *database.SecurityIncident) error {
+	incident.ID = uuid.New()
+	incident.Status = IncidentStatusOpen
+	if err := tx.Create(incident).Error; err != nil {
+		return fmt.Errorf("failed to record security incident: %w", err)
+	}
+	return nil
+}
+
+// PublishOpened publishes the security_incident.opened event of a recorded incident
+func (s *SecurityIncidentService) PublishOpened(incident *database.SecurityIncident) {
+	var user database.User
+	s.db.Select("id", "username", "email").Where("id = ?", incident.UserID).First(&user)
+	s.events.Publish(EventSecurityIncident, SecurityIncidentOpened{
+		IncidentID: incident.ID,
+		Type:       incident.Type,
+		UserID:     incident.UserID,
+		Username:   user.Username,
+		Email:      user.Email,
+		Details:    incident.Details,
+		IPAddress:  incident.IPAddress,
+	})
+}
+
+// ListIncidents returns a page of matching incidents, newest first, and the total number of matches
+func (s *SecurityIncidentService) ListIncidents(filter SecurityIncidentFilter) ([]database.SecurityIncident, int64, error) {
+	query := s.db.Model(&database.SecurityIncident{})
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.UserID != nil {
+		query = query.Where("user_id = ?", *filter.UserID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count security incidents: %w", err)
+	}
+
+	var incidents []database.SecurityIncident
+	if err := query.Preload("User").Order("created_at DESC").
+		Limit(filter.Limit).Offset(filter.Offset).Find(&incidents).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch security incidents: %w", err)
+	}
+	return incidents, total, nil
+}
+
+// GetIncidentByID retrieves a security incident by ID
+func (s *SecurityIncidentService) GetIncidentByID(id uuid.UUID) (*database.SecurityIncident, error) {
+	var incident database.SecurityIncident
+	if err := s.db.Preload("User").Where("id = ?", id).First(&incident).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "security incident not found")
+		}
+		return nil, fmt.Errorf("failed to get security incident: %w", err)
+	}
+	return &incident, nil
+}
+
+// ResolveIncident closes an open incident. A recovery_code_used incident can
+// only be resolved by naming the replacement device issued to the user: an
+// active device of theirs registered after the incident was opened. A
+// break_glass_used incident is the post-incident review of the break-glass
+// session: it needs a note, and someone other than the account that used it.
+func (s *SecurityIncidentService) ResolveIncident(id, resolvedByID uuid.UUID, replacementDeviceID *uuid.UUID, note string) (*database.SecurityIncident, error) {
+	incident, err := s.GetIncidentByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if incident.Status == IncidentStatusResolved {
+		return nil, NewError(CodeConflict, "security incident is already resolved")
+	}
+
+	if incident.Type == IncidentBreakGlassUsed {
+		if resolvedByID == incident.UserID {
+			return nil, NewError(CodePermissionDenied, "the break-glass account cannot review its own use")
+		}
+		if strings.TrimSpace(note) == "" {
+			return nil, NewError(CodeValidationFailed, "record the post-incident review in note to resolve this incident")
+		}
+	}
+	if replacementDeviceID == nil && incident.Type == IncidentRecoveryCodeUsed {
+		return nil, NewError(CodeValidationFailed, "issue the user a replacement device and give its replacement_device_id to resolve this incident")
+	}
+	if replacementDeviceID != nil {
+		var device database.Device
+		if err := s.db.Where("id = ?", *replacementDeviceID).First(&device).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, NewError(CodeNotFound, "replacement device not found")
+			}
+			return nil, fmt.Errorf("failed to get replacement device: %w", err)
+		}
+		if device.UserID == nil || *device.UserID != incident.UserID || !device.Active {
+			return nil, NewError(CodeValidationFailed, "replacement device must be an active device of the incident's user")
+		}
+		if !device.CreatedAt.After(incident.CreatedAt) && !device.VerifiedAt.After(incident.CreatedAt) {
+			return nil, NewError(CodeValidationFailed, "replacement device must be registered after the incident was opened")
+		}
+	}
+
+	updates := map[string]interface{}{
+		"status":                IncidentStatusResolved,
+		"resolved_at":           time.Now(),
+		"resolved_by_id":        resolvedByID,
+		"replacement_device_id": replacementDeviceID,
+		"resolution_note":       note,
+	}
+	if err := s.db.Model(&database.SecurityIncident{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to resolve security incident: %w", err)
+	}
+
+	return s.GetIncidentByID(id)
+}
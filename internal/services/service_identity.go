@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+)
+
+// ServiceIdentity is a service that authenticates with a TLS client
+// certificate (server.tls.client_identities). It has its own permissions and
+// acts as a user only so its changes are attributed to someone.
+type ServiceIdentity struct {
+	Name string
+	config.ClientIdentityConfig
+}
+
+// Matches reports whether cert matches every matcher the identity sets
+func (i *ServiceIdentity) Matches(cert *x509.Certificate) bool {
+	if i.CommonName != "" && cert.Subject.CommonName != i.CommonName {
+		return false
+	}
+	if i.DNSName != "" && !containsFold(cert.DNSNames, i.DNSName) {
+		return false
+	}
+	if i.URI != "" {
+		found := false
+		for _, uri := range cert.URIs {
+			if uri.String() == i.URI {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if i.Fingerprint != "" {
+		sum := sha256.Sum256(cert.Raw)
+		fingerprint := strings.ToLower(strings.ReplaceAll(i.Fingerprint, ":", ""))
+		if hex.EncodeToString(sum[:]) != fingerprint {
+			return false
+		}
+	}
+	return true
+}
+
+// Allows reports whether the identity holds permission, given as
+// "resource:action". "resource:*" grants every action on a resource and "*"
+// grants everything.
+func (i *ServiceIdentity) Allows(permission string) bool {
+	resource, _, _ := strings.Cut(permission, ":")
+	for _, granted := range i.Permissions {
+		if granted == "*" || granted == permission || granted == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+// ServiceIdentities finds the service identity of a client certificate
+type ServiceIdentities struct {
+	identities []ServiceIdentity
+}
+
+// NewServiceIdentities creates the identities of server.tls.client_identities
+func NewServiceIdentities(identities map[string]config.ClientIdentityConfig) *ServiceIdentities {
+	s := &ServiceIdentities{}
+	for name, identity := range identities {
+		s.identities = append(s.identities, ServiceIdentity{Name: name, ClientIdentityConfig: identity})
+	}
+	// Deterministic when a certificate matches more than one
+	sort.Slice(s.identities, func(a, b int) bool { return s.identities[a].Name < s.identities[b].Name })
+	return s
+}
+
+// Match returns the identity cert authenticates as, or nil
+func (s *ServiceIdentities) Match(cert *x509.Certificate) *ServiceIdentity {
+	for i := range s.identities {
+		if s.identities[i].Matches(cert) {
+			return &s.identities[i]
+		}
+	}
+	return nil
+}
+
+// AuthenticateServiceIdentity checks identity holds requiredPermission and
+// loads the user it acts as
+func (s *AuthService) AuthenticateServiceIdentity(ctx context.Context, identity *ServiceIdentity, requiredPermission string) (*database.User, error) {
+	if requiredPermission != "" && !identity.Allows(requiredPermission) {
+		return nil, NewError(CodePermissionDenied, "permission denied: %s is not granted to service identity %s", requiredPermission, identity.Name)
+	}
+
+	var user database.User
+	if err := s.stmtDB.WithContext(ctx).Where("username = ?", identity.User).First(&user).Error; err != nil {
+		return nil, WrapError(CodeAuthFailed, fmt.Sprintf("failed to find user %s of service identity %s", identity.User, identity.Name), err)
+	}
+	if !user.Active || !UserStateAllowsAuthentication(user.State) {
+		return nil, NewError(CodeAccountInactive, "user %s of service identity %s is not active", user.Username, identity.Name)
+	}
+	return &user, nil
+}
+
+// containsFold reports whether values contains value, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,41 +2,73 @@ package services
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"slices"
 	"time"
 
 	"github.com/YubiApp/internal/config"
 	"github.com/YubiApp/internal/database"
 	"github.com/google/uuid"
-	"github.com/redis/go-redis/v9"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Session binding modes for auth.session_binding
+const (
+	SessionBindingOff     = "off"
+	SessionBindingLenient = "lenient"
+	SessionBindingStrict  = "strict"
+)
+
+// ErrSessionBindingMismatch is returned when a session is presented by a client
+// that does not match the one it was created for
+var ErrSessionBindingMismatch = NewError(CodeSessionBindingMismatch, "session was created for a different client")
+
+// SessionClient describes the client creating or presenting a session
+type SessionClient struct {
+	UserAgent   string
+	IPAddress   string
+	Fingerprint string // Optional, client-generated
+}
+
 type SessionService struct {
-	redisClient *redis.Client
-	config      *config.Config
+	store  SessionStore
+	config *config.Config
 }
 
-func NewSessionService(config *config.Config) *SessionService {
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%d", config.Redis.Host, config.Redis.Port),
-		Password: config.Redis.Password,
-		DB:       config.Redis.DB,
-		PoolSize: config.Redis.PoolSize,
-	})
+// NewSessionService creates a session service keeping sessions in store
+func NewSessionService(config *config.Config, store SessionStore) *SessionService {
+	switch config.Auth.SessionBinding {
+	case SessionBindingOff, SessionBindingLenient, SessionBindingStrict:
+	default:
+		log.Printf("auth.session_binding: unknown mode %q, using %q", config.Auth.SessionBinding, SessionBindingLenient)
+		config.Auth.SessionBinding = SessionBindingLenient
+	}
 
 	return &SessionService{
-		redisClient: rdb,
-		config:      config,
+		store:  store,
+		config: config,
 	}
 }
 
-// CreateSession creates a new session for a user and device
-func (s *SessionService) CreateSession(userID, deviceID uuid.UUID) (*database.Session, error) {
+// CreateSession creates a new session for a user and device, bound to client.
+// Its idle timeout and lifetime follow the policies of the user's roles, and
+// it is refused when one of them does not allow sessions.
+func (s *SessionService) CreateSession(userID, deviceID uuid.UUID, roles []string, client SessionClient) (*database.Session, error) {
+	if role := sessionsRefusedBy(s.config, roles); role != "" {
+		return nil, NewError(CodePermissionDenied, "role %s does not allow session authentication", role)
+	}
+
 	sessionID := uuid.New().String()
 	now := time.Now()
-	expiresAt := now.Add(s.config.Auth.SessionExpiry)
+	idleTimeout, maxLifetime := s.SessionPolicy(roles)
+	expiresAt := now.Add(maxLifetime)
 
 	session := &database.Session{
 		ID:           sessionID,
@@ -47,85 +79,445 @@ func (s *SessionService) CreateSession(userID, deviceID uuid.UUID) (*database.Se
 		CreatedAt:    now,
 		ExpiresAt:    expiresAt,
 		IsValid:      true,
+		LastUsedAt:   now,
+		IdleTimeout:  idleTimeout,
+	}
+	bindSession(session, client)
+
+	if err := s.storeSession(session, maxLifetime); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// CreateImpersonationSession creates a session acting as subjectID on behalf of
+// impersonatorID, who authenticated with deviceID. It lasts auth.impersonation_expiry.
+func (s *SessionService) CreateImpersonationSession(subjectID, deviceID, impersonatorID uuid.UUID, readOnly bool, client SessionClient) (*database.Session, error) {
+	now := time.Now()
+	expiry := s.config.Auth.ImpersonationExpiry
+
+	session := &database.Session{
+		ID:             uuid.New().String(),
+		UserID:         subjectID,
+		DeviceID:       deviceID,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(expiry),
+		IsValid:        true,
+		LastUsedAt:     now,
+		IdleTimeout:    s.config.Auth.SessionIdleTimeout,
+		ImpersonatorID: &impersonatorID,
+		ReadOnly:       readOnly,
+	}
+	bindSession(session, client)
+
+	if err := s.storeSession(session, expiry); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// CreateRecoverySession creates the read-only session a recovery code opens for
+// userID, who has no device to sign in with. It lasts recovery.session_expiry.
+func (s *SessionService) CreateRecoverySession(userID uuid.UUID, client SessionClient) (*database.Session, error) {
+	now := time.Now()
+	expiry := s.config.Recovery.SessionExpiry
+
+	session := &database.Session{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(expiry),
+		IsValid:     true,
+		LastUsedAt:  now,
+		IdleTimeout: s.config.Auth.SessionIdleTimeout,
+		ReadOnly:    true,
+		Recovery:    true,
 	}
+	bindSession(session, client)
+
+	if err := s.storeSession(session, expiry); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// CreateBreakGlassSession creates the session a break-glass credential opens
+// as userID. It lasts break_glass.session_expiry and may write without a device.
+func (s *SessionService) CreateBreakGlassSession(userID uuid.UUID, client SessionClient) (*database.Session, error) {
+	now := time.Now()
+	expiry := s.config.BreakGlass.SessionExpiry
+
+	session := &database.Session{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(expiry),
+		IsValid:     true,
+		LastUsedAt:  now,
+		IdleTimeout: s.config.Auth.SessionIdleTimeout,
+		BreakGlass:  true,
+	}
+	bindSession(session, client)
+
+	if err := s.storeSession(session, expiry); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// CreateCrossDeviceSession creates the session a shared terminal gets when
+// userID approves its QR code, from session approvedBy or, signed in with a
+// device, none. It lasts qr_login.session_expiry and is read-only unless
+// qr_login.read_only is off.
+func (s *SessionService) CreateCrossDeviceSession(userID, deviceID uuid.UUID, approvedBy string, client SessionClient) (*database.Session, error) {
+	now := time.Now()
+	expiry := s.config.QRLogin.SessionExpiry
 
-	// Store session in Redis
-	sessionKey := fmt.Sprintf("session:%s", sessionID)
+	session := &database.Session{
+		ID:                uuid.New().String(),
+		UserID:            userID,
+		DeviceID:          deviceID,
+		CreatedAt:         now,
+		ExpiresAt:         now.Add(expiry),
+		IsValid:           true,
+		LastUsedAt:        now,
+		IdleTimeout:       s.config.Auth.SessionIdleTimeout,
+		ReadOnly:          s.config.QRLogin.ReadOnly,
+		CrossDevice:       true,
+		ApprovedBySession: approvedBy,
+	}
+	bindSession(session, client)
+
+	if err := s.storeSession(session, expiry); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// RecoveryAllows reports whether a recovery session may use permission, one
+// of recovery.permissions
+func (s *SessionService) RecoveryAllows(permission string) bool {
+	return slices.Contains(s.config.Recovery.Permissions, permission)
+}
+
+// storeSession writes a new session to the session store
+func (s *SessionService) storeSession(session *database.Session, ttl time.Duration) error {
 	sessionData, err := json.Marshal(session)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal session: %w", err)
+		return fmt.Errorf("failed to marshal session: %w", err)
 	}
 
 	ctx := context.Background()
-	err = s.redisClient.Set(ctx, sessionKey, sessionData, s.config.Auth.SessionExpiry).Err()
+	err = s.store.Save(ctx, session.ID, session.UserID.String(), sessionData, ttl)
 	if err != nil {
-		return nil, fmt.Errorf("failed to store session in Redis: %w", err)
+		return fmt.Errorf("failed to store session: %w", err)
 	}
 
-	return session, nil
+	return nil
 }
 
-// GetSession retrieves a session from Redis
+// GetSession retrieves a session from the session store
 func (s *SessionService) GetSession(sessionID string) (*database.Session, error) {
-	sessionKey := fmt.Sprintf("session:%s", sessionID)
-	
-	ctx := context.Background()
-	sessionData, err := s.redisClient.Get(ctx, sessionKey).Result()
+	return s.GetSessionContext(context.Background(), sessionID)
+}
+
+// GetSessionContext is GetSession for a request, so the store lookup is traced
+// as part of it
+func (s *SessionService) GetSessionContext(ctx context.Context, sessionID string) (*database.Session, error) {
+	session, err := s.loadSession(ctx, sessionID)
 	if err != nil {
-		if err == redis.Nil {
-			return nil, fmt.Errorf("session not found")
+		return nil, err
+	}
+
+	if err := checkSessionActive(session, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// loadSession reads a stored session, whether or not it can still be used
+func (s *SessionService) loadSession(ctx context.Context, sessionID string) (*database.Session, error) {
+	sessionData, err := s.store.Load(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			return nil, err
 		}
-		return nil, fmt.Errorf("failed to get session from Redis: %w", err)
+		return nil, fmt.Errorf("failed to get session: %w", err)
 	}
 
 	var session database.Session
-	err = json.Unmarshal([]byte(sessionData), &session)
+	err = json.Unmarshal(sessionData, &session)
 	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal session: %w", err)
 	}
 
+	return &session, nil
+}
+
+// checkSessionActive reports why a stored session can no longer be used, if it cannot
+func checkSessionActive(session *database.Session, now time.Time) error {
 	if !session.IsValid {
-		return nil, fmt.Errorf("session is invalid")
+		return fmt.Errorf("session is invalid")
 	}
 
-	if time.Now().After(session.ExpiresAt) {
-		return nil, fmt.Errorf("session has expired")
+	if now.After(session.ExpiresAt) {
+		return fmt.Errorf("session has expired")
 	}
 
-	return &session, nil
+	if idleExpiresAt := SessionIdleExpiresAt(session); idleExpiresAt != nil && now.After(*idleExpiresAt) {
+		return fmt.Errorf("session has expired after %s idle", session.IdleTimeout)
+	}
+
+	return nil
 }
 
-// UpdateSession updates a session in Redis
-func (s *SessionService) UpdateSession(session *database.Session) error {
-	sessionKey := fmt.Sprintf("session:%s", session.ID)
-	sessionData, err := json.Marshal(session)
+// ListUserSessions returns a user's active sessions, most recently used first
+func (s *SessionService) ListUserSessions(ctx context.Context, userID uuid.UUID) ([]database.Session, error) {
+	records, err := s.store.LoadUser(ctx, userID.String())
 	if err != nil {
-		return fmt.Errorf("failed to marshal session: %w", err)
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
 	}
 
-	ctx := context.Background()
-	ttl := time.Until(session.ExpiresAt)
-	if ttl <= 0 {
-		return fmt.Errorf("session has expired")
+	now := time.Now()
+	sessions := make([]database.Session, 0, len(records))
+	for _, data := range records {
+		var session database.Session
+		if err := json.Unmarshal(data, &session); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal session: %w", err)
+		}
+		if session.UserID != userID || checkSessionActive(&session, now) != nil {
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+
+	slices.SortFunc(sessions, func(a, b database.Session) int { return b.LastUsedAt.Compare(a.LastUsedAt) })
+	return sessions, nil
+}
+
+// RevokeUserSession invalidates one of userID's sessions, for users ending
+// sessions they do not recognise. Sessions of other users are not found.
+func (s *SessionService) RevokeUserSession(ctx context.Context, userID uuid.UUID, sessionID string) error {
+	session, err := s.loadSession(ctx, sessionID)
+	if err != nil && !errors.Is(err, ErrSessionNotFound) {
+		return err
+	}
+	// Other users' sessions and ended ones are not the caller's to see
+	if err != nil || session.UserID != userID || checkSessionActive(session, time.Now()) != nil {
+		return NewError(CodeNotFound, "session not found")
 	}
+	return s.InvalidateSession(sessionID)
+}
+
+// InvalidateUserSessions invalidates all of a user's sessions, returning how
+// many there were
+func (s *SessionService) InvalidateUserSessions(ctx context.Context, userID uuid.UUID) (int, error) {
+	return s.InvalidateOtherUserSessions(ctx, userID, "")
+}
 
-	err = s.redisClient.Set(ctx, sessionKey, sessionData, ttl).Err()
+// InvalidateOtherUserSessions invalidates all of a user's sessions except
+// keepSessionID, e.g. the one a user changed their password from, returning
+// how many it invalidated
+func (s *SessionService) InvalidateOtherUserSessions(ctx context.Context, userID uuid.UUID, keepSessionID string) (int, error) {
+	sessions, err := s.ListUserSessions(ctx, userID)
 	if err != nil {
-		return fmt.Errorf("failed to update session in Redis: %w", err)
+		return 0, err
+	}
+	invalidated := 0
+	for _, session := range sessions {
+		if session.ID == keepSessionID {
+			continue
+		}
+		if err := s.InvalidateSession(session.ID); err != nil && !errors.Is(err, ErrSessionNotFound) {
+			return 0, fmt.Errorf("failed to invalidate session %s: %w", session.ID, err)
+		}
+		invalidated++
 	}
+	return invalidated, nil
+}
+
+// sessionTouchInterval is how often uses of sessions without an idle timeout
+// are recorded, so users listing their sessions see roughly when each was last used
+const sessionTouchInterval = time.Minute
 
+// TouchSession records a use of a session from ipAddress, pushing back its
+// idle expiry. Only the use is written, so a concurrent invalidation or
+// refresh of the session is kept.
+func (s *SessionService) TouchSession(session *database.Session, ipAddress string) error {
+	now := time.Now()
+	if session.IdleTimeout <= 0 && now.Sub(session.LastUsedAt) < sessionTouchInterval && session.LastIPAddress == ipAddress {
+		return nil
+	}
+	_, err := s.modifySession(session.ID, func(current *database.Session) error {
+		if !current.IsValid {
+			return fmt.Errorf("session is invalid")
+		}
+		current.LastUsedAt = now
+		current.LastIPAddress = ipAddress
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	session.LastUsedAt = now
+	session.LastIPAddress = ipAddress
 	return nil
 }
 
-// InvalidateSession marks a session as invalid
-func (s *SessionService) InvalidateSession(sessionID string) error {
-	session, err := s.GetSession(sessionID)
+// SessionPolicy returns the idle timeout and absolute lifetime for a session of a
+// user with the given roles. Role overrides replace the global values, taking
+// the shortest when several roles set one.
+func (s *SessionService) SessionPolicy(roles []string) (idleTimeout, maxLifetime time.Duration) {
+	var roleIdle, roleLifetime time.Duration
+	for _, role := range roles {
+		policy, ok := rolePolicy(s.config, role)
+		if !ok {
+			continue
+		}
+		if policy.IdleTimeout > 0 && (roleIdle == 0 || policy.IdleTimeout < roleIdle) {
+			roleIdle = policy.IdleTimeout
+		}
+		if policy.MaxLifetime > 0 && (roleLifetime == 0 || policy.MaxLifetime < roleLifetime) {
+			roleLifetime = policy.MaxLifetime
+		}
+	}
+
+	idleTimeout, maxLifetime = s.config.Auth.SessionIdleTimeout, s.config.Auth.SessionExpiry
+	if roleIdle > 0 {
+		idleTimeout = roleIdle
+	}
+	if roleLifetime > 0 {
+		maxLifetime = roleLifetime
+	}
+	return idleTimeout, maxLifetime
+}
+
+// SessionIdleExpiresAt returns when a session lapses if left unused, or nil when
+// it has no idle timeout
+func SessionIdleExpiresAt(session *database.Session) *time.Time {
+	if session.IdleTimeout <= 0 || session.LastUsedAt.IsZero() {
+		return nil
+	}
+	idleExpiresAt := session.LastUsedAt.Add(session.IdleTimeout)
+	return &idleExpiresAt
+}
+
+// CheckBinding verifies client matches the client session was created for, as
+// strictly as auth.session_binding requires. Sessions created before binding was
+// recorded only have the attributes they stored checked.
+func (s *SessionService) CheckBinding(session *database.Session, client SessionClient) error {
+	mode := s.config.Auth.SessionBinding
+	if mode == SessionBindingOff {
+		return nil
+	}
+
+	if session.Fingerprint != "" && hashFingerprint(client.Fingerprint) != session.Fingerprint {
+		return fmt.Errorf("%w: fingerprint does not match", ErrSessionBindingMismatch)
+	}
+
+	if session.UserAgent != "" {
+		match := client.UserAgent == session.UserAgent
+		if mode == SessionBindingLenient {
+			match = normalizeUserAgent(client.UserAgent) == normalizeUserAgent(session.UserAgent)
+		}
+		if !match {
+			return fmt.Errorf("%w: user agent does not match", ErrSessionBindingMismatch)
+		}
+	}
+
+	if session.IPAddress != "" {
+		match := client.IPAddress == session.IPAddress
+		if mode == SessionBindingLenient {
+			match = ipNetworkPrefix(client.IPAddress) == ipNetworkPrefix(session.IPAddress)
+		}
+		if !match {
+			return fmt.Errorf("%w: IP address does not match", ErrSessionBindingMismatch)
+		}
+	}
+
+	return nil
+}
+
+// SessionBindingMode returns the configured auth.session_binding mode
+func (s *SessionService) SessionBindingMode() string {
+	return s.config.Auth.SessionBinding
+}
+
+// bindSession records the client a session is created for
+func bindSession(session *database.Session, client SessionClient) {
+	session.UserAgent = client.UserAgent
+	session.IPAddress = client.IPAddress
+	if client.Fingerprint != "" {
+		session.Fingerprint = hashFingerprint(client.Fingerprint)
+	}
+}
+
+// hashFingerprint hashes a client fingerprint so the raw value is never stored
+func hashFingerprint(fingerprint string) string {
+	if fingerprint == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(fingerprint))
+	return hex.EncodeToString(sum[:])
+}
+
+var userAgentVersion = regexp.MustCompile(`[0-9][0-9._]*`)
+
+// normalizeUserAgent strips version numbers so browser updates keep a session
+func normalizeUserAgent(userAgent string) string {
+	return userAgentVersion.ReplaceAllString(userAgent, "")
+}
+
+// ipNetworkPrefix returns the /16 of an IPv4 or the /48 of an IPv6 address, so
+// DHCP renewals and NAT pools within one network keep a session
+func ipNetworkPrefix(address string) string {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return address
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(16, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// modifySession applies change to the stored session and returns the result.
+// change is given the session as it is in the store, so concurrent requests
+// cannot undo each other's changes; an error from it leaves the session as it was.
+func (s *SessionService) modifySession(sessionID string, change func(current *database.Session) error) (*database.Session, error) {
+	var session database.Session
+	err := s.store.Update(context.Background(), sessionID, func(data []byte) ([]byte, error) {
+		session = database.Session{}
+		if err := json.Unmarshal(data, &session); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal session: %w", err)
+		}
+		if err := change(&session); err != nil {
+			return nil, err
+		}
+		return json.Marshal(&session)
+	})
 	if err != nil {
-		return err
+		if errors.Is(err, ErrSessionNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to update session: %w", err)
 	}
+	return &session, nil
+}
 
-	session.IsValid = false
-	return s.UpdateSession(session)
+// InvalidateSession marks a session as invalid
+func (s *SessionService) InvalidateSession(sessionID string) error {
+	_, err := s.modifySession(sessionID, func(current *database.Session) error {
+		current.IsValid = false
+		return nil
+	})
+	return err
 }
 
 // GenerateAccessToken generates a JWT access token for a session
@@ -139,6 +531,7 @@ func (s *SessionService) GenerateAccessToken(session *database.Session) (string,
 		DeviceID:     session.DeviceID.String(),
 		AccessCount:  session.AccessCount,
 		RefreshCount: session.RefreshCount,
+		ReadOnly:     session.ReadOnly,
 		RegisteredClaims: jwt.RegisteredClaims{
 			IssuedAt:  jwt.NewNumericDate(now),
 			ExpiresAt: jwt.NewNumericDate(expiresAt),
@@ -147,6 +540,10 @@ func (s *SessionService) GenerateAccessToken(session *database.Session) (string,
 		},
 	}
 
+	if session.ImpersonatorID != nil {
+		claims.ImpersonatorID = session.ImpersonatorID.String()
+	}
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(s.config.Auth.JWTSecret))
 }
@@ -154,7 +551,7 @@ func (s *SessionService) GenerateAccessToken(session *database.Session) (string,
 // GenerateRefreshToken generates a JWT refresh token for a session
 func (s *SessionService) GenerateRefreshToken(session *database.Session) (string, error) {
 	now := time.Now()
-	expiresAt := now.Add(s.config.Auth.SessionExpiry)
+	expiresAt := session.ExpiresAt
 
 	claims := database.RefreshToken{
 		SessionID:    session.ID,
@@ -169,6 +566,10 @@ func (s *SessionService) GenerateRefreshToken(session *database.Session) (string
 		},
 	}
 
+	if session.ImpersonatorID != nil {
+		claims.ImpersonatorID = session.ImpersonatorID.String()
+	}
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(s.config.Auth.JWTSecret))
 }
@@ -214,29 +615,40 @@ func (s *SessionService) ValidateRefreshToken(tokenString string) (*database.Ref
 }
 
 // RefreshSession creates new access and refresh tokens for an existing session
-func (s *SessionService) RefreshSession(refreshTokenString string) (*database.Session, string, string, error) {
+// presented by client
+func (s *SessionService) RefreshSession(refreshTokenString string, client SessionClient) (*database.Session, string, string, error) {
 	// Validate refresh token
 	refreshClaims, err := s.ValidateRefreshToken(refreshTokenString)
 	if err != nil {
 		return nil, "", "", fmt.Errorf("invalid refresh token: %w", err)
 	}
 
-	// Get session from Redis
+	// Get session from the session store
 	session, err := s.GetSession(refreshClaims.SessionID)
 	if err != nil {
 		return nil, "", "", fmt.Errorf("session not found: %w", err)
 	}
 
-	// Verify refresh count matches
-	if session.RefreshCount != refreshClaims.RefreshCount {
-		return nil, "", "", fmt.Errorf("refresh token is invalid (count mismatch)")
+	if err := s.CheckBinding(session, client); err != nil {
+		return nil, "", "", err
 	}
 
-	// Increment refresh count and update session
-	session.RefreshCount++
-	err = s.UpdateSession(session)
+	// Increment the refresh count if it still matches the token, so only one
+	// of several concurrent refreshes with the same token succeeds; refreshing
+	// counts as a use
+	session, err = s.modifySession(refreshClaims.SessionID, func(current *database.Session) error {
+		if err := checkSessionActive(current, time.Now()); err != nil {
+			return err
+		}
+		if current.RefreshCount != refreshClaims.RefreshCount {
+			return fmt.Errorf("refresh token is invalid (count mismatch)")
+		}
+		current.RefreshCount++
+		current.LastUsedAt = time.Now()
+		return nil
+	})
 	if err != nil {
-		return nil, "", "", fmt.Errorf("failed to update session: %w", err)
+		return nil, "", "", err
 	}
 
 	// Generate new tokens
@@ -253,7 +665,24 @@ func (s *SessionService) RefreshSession(refreshTokenString string) (*database.Se
 	return session, accessToken, newRefreshToken, nil
 }
 
-// Close closes the Redis connection
-func (s *SessionService) Close() error {
-	return s.redisClient.Close()
-} 
\ No newline at end of file
+// RevokeSession invalidates the session with sessionID for a client that
+// presents its current refresh token, so users can log their own sessions out
+func (s *SessionService) RevokeSession(sessionID, refreshTokenString string) error {
+	refreshClaims, err := s.ValidateRefreshToken(refreshTokenString)
+	if err != nil {
+		return NewError(CodeSessionInvalid, "invalid refresh token: %v", err)
+	}
+	if refreshClaims.SessionID != sessionID {
+		return NewError(CodeValidationFailed, "session ID mismatch")
+	}
+
+	session, err := s.GetSession(sessionID)
+	if err != nil {
+		return NewError(CodeSessionInvalid, "%v", err)
+	}
+	if session.RefreshCount != refreshClaims.RefreshCount {
+		return NewError(CodeSessionInvalid, "refresh token is invalid (count mismatch)")
+	}
+
+	return s.InvalidateSession(sessionID)
+}
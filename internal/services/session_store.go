@@ -0,0 +1,344 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/jackc/pgtype"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrSessionNotFound is returned by a SessionStore for sessions that do not
+// exist or have expired
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionStore keeps serialized sessions until their TTL passes, indexed by
+// the user they belong to
+type SessionStore interface {
+	Save(ctx context.Context, sessionID, userID string, data []byte, ttl time.Duration) error
+	Load(ctx context.Context, sessionID string) ([]byte, error)
+	LoadUser(ctx context.Context, userID string) ([][]byte, error) // The user's unexpired sessions
+	// Update replaces a session with what fn returns for its current data,
+	// keeping its TTL. It is atomic: concurrent updates of the session are
+	// applied one after the other, never to stale data. An error from fn
+	// leaves the session unchanged and is returned.
+	Update(ctx context.Context, sessionID string, fn func(data []byte) ([]byte, error)) error
+}
+
+// NewRedisSessionStore keeps sessions in Redis, shared by every API instance
+func NewRedisSessionStore(client redis.UniversalClient) SessionStore {
+	return &redisSessionStore{client: client}
+}
+
+type redisSessionStore struct {
+	client redis.UniversalClient
+}
+
+// indexUserSessionScript adds session ARGV[1], expiring at ARGV[2], to the
+// user's index of session IDs by expiry, drops those expired by ARGV[3] and
+// keeps the index as long as its longest-lived session
+var indexUserSessionScript = redis.NewScript(`
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[3])
+local last = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+if last[2] then
+  redis.call('EXPIREAT', KEYS[1], last[2])
+end
+return 1
+`)
+
+func (s *redisSessionStore) Save(ctx context.Context, sessionID, userID string, data []byte, ttl time.Duration) error {
+	if err := s.client.Set(ctx, "session:"+sessionID, data, ttl).Err(); err != nil {
+		return err
+	}
+	now := time.Now()
+	return indexUserSessionScript.Run(ctx, s.client, []string{"user_sessions:" + userID},
+		sessionID, now.Add(ttl).Unix()+1, now.Unix()).Err()
+}
+
+func (s *redisSessionStore) Load(ctx context.Context, sessionID string) ([]byte, error) {
+	data, err := s.client.Get(ctx, "session:"+sessionID).Bytes()
+	if err == redis.Nil {
+		return nil, ErrSessionNotFound
+	}
+	return data, err
+}
+
+// sessionUpdateRetries bounds how often a Redis session update is retried
+// when the session changes while it is being updated
+const sessionUpdateRetries = 10
+
+func (s *redisSessionStore) Update(ctx context.Context, sessionID string, fn func(data []byte) ([]byte, error)) error {
+	key := "session:" + sessionID
+	update := func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, key).Bytes()
+		if err == redis.Nil {
+			return ErrSessionNotFound
+		}
+		if err != nil {
+			return err
+		}
+		updated, err := fn(data)
+		if err != nil {
+			return err
+		}
+		// The transaction fails, and is retried, if the session changed since WATCH
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.SetArgs(ctx, key, updated, redis.SetArgs{KeepTTL: true, Mode: "XX"})
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < sessionUpdateRetries; i++ {
+		err := s.client.Watch(ctx, update, key)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return fmt.Errorf("session %s kept changing during update", sessionID)
+}
+
+func (s *redisSessionStore) LoadUser(ctx context.Context, userID string) ([][]byte, error) {
+	sessionIDs, err := s.client.ZRangeByScore(ctx, "user_sessions:"+userID, &redis.ZRangeBy{
+		Min: fmt.Sprint(time.Now().Unix()),
+		Max: "+inf",
+	}).Result()
+	if err != nil || len(sessionIDs) == 0 {
+		return nil, err
+	}
+
+	keys := make([]string, len(sessionIDs))
+	for i, id := range sessionIDs {
+		keys[i] = "session:" + id
+	}
+	values, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([][]byte, 0, len(values))
+	for _, value := range values {
+		if data, ok := value.(string); ok {
+			sessions = append(sessions, []byte(data))
+		}
+	}
+	return sessions, nil
+}
+
+// memorySweepInterval is how often the memory store drops expired sessions
+// that were never loaded again
+const memorySweepInterval = time.Minute
+
+// NewMemorySessionStore keeps sessions in this process, for development, tests
+// and single-instance deployments. Sessions are lost on restart.
+func NewMemorySessionStore() SessionStore {
+	return &memorySessionStore{sessions: make(map[string]memorySession)}
+}
+
+type memorySessionStore struct {
+	mu        sync.Mutex
+	sessions  map[string]memorySession
+	lastSweep time.Time
+}
+
+type memorySession struct {
+	userID    string
+	data      []byte
+	expiresAt time.Time
+}
+
+func (s *memorySessionStore) Save(ctx context.Context, sessionID, userID string, data []byte, ttl time.Duration) error {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) >= memorySweepInterval {
+		for id, session := range s.sessions {
+			if !now.Before(session.expiresAt) {
+				delete(s.sessions, id)
+			}
+		}
+		s.lastSweep = now
+	}
+	s.sessions[sessionID] = memorySession{userID: userID, data: append([]byte(nil), data...), expiresAt: now.Add(ttl)}
+	return nil
+}
+
+func (s *memorySessionStore) Load(ctx context.Context, sessionID string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[sessionID]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	if !time.Now().Before(session.expiresAt) {
+		delete(s.sessions, sessionID)
+		return nil, ErrSessionNotFound
+	}
+	return session.data, nil
+}
+
+func (s *memorySessionStore) Update(ctx context.Context, sessionID string, fn func(data []byte) ([]byte, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[sessionID]
+	if !ok || !time.Now().Before(session.expiresAt) {
+		return ErrSessionNotFound
+	}
+	updated, err := fn(session.data)
+	if err != nil {
+		return err
+	}
+	session.data = append([]byte(nil), updated...)
+	s.sessions[sessionID] = session
+	return nil
+}
+
+func (s *memorySessionStore) LoadUser(ctx context.Context, userID string) ([][]byte, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var sessions [][]byte
+	for _, session := range s.sessions {
+		if session.userID == userID && now.Before(session.expiresAt) {
+			sessions = append(sessions, session.data)
+		}
+	}
+	return sessions, nil
+}
+
+// PostgresSessionStore keeps sessions in the session_records table, for
+// deployments without Redis. Expired rows are ignored when loaded and deleted
+// by the cleanup job every auth.session_cleanup_interval.
+type PostgresSessionStore struct {
+	db     *gorm.DB
+	config *config.Config
+	stop   chan struct{}
+}
+
+// NewPostgresSessionStore creates a session store backed by db
+func NewPostgresSessionStore(db *gorm.DB, config *config.Config) *PostgresSessionStore {
+	return &PostgresSessionStore{db: db, config: config}
+}
+
+func (s *PostgresSessionStore) Save(ctx context.Context, sessionID, userID string, data []byte, ttl time.Duration) error {
+	record := database.SessionRecord{
+		ID:        sessionID,
+		UserID:    userID,
+		Data:      pgtype.JSONB{Bytes: data, Status: pgtype.Present},
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"data", "expires_at", "updated_at"}),
+	}).Create(&record).Error
+}
+
+func (s *PostgresSessionStore) Load(ctx context.Context, sessionID string) ([]byte, error) {
+	var record database.SessionRecord
+	err := s.db.WithContext(ctx).
+		Where("id = ? AND expires_at > ?", sessionID, time.Now()).
+		Take(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return record.Data.Bytes, nil
+}
+
+func (s *PostgresSessionStore) Update(ctx context.Context, sessionID string, fn func(data []byte) ([]byte, error)) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var record database.SessionRecord
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND expires_at > ?", sessionID, time.Now()).
+			Take(&record).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionNotFound
+		}
+		if err != nil {
+			return err
+		}
+		updated, err := fn(record.Data.Bytes)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&record).Updates(map[string]interface{}{
+			"data":       pgtype.JSONB{Bytes: updated, Status: pgtype.Present},
+			"updated_at": time.Now(),
+		}).Error
+	})
+}
+
+func (s *PostgresSessionStore) LoadUser(ctx context.Context, userID string) ([][]byte, error) {
+	var records []database.SessionRecord
+	if err := s.db.WithContext(ctx).
+		Where("user_id = ? AND expires_at > ?", userID, time.Now()).
+		Find(&records).Error; err != nil {
+		return nil, err
+	}
+	sessions := make([][]byte, len(records))
+	for i := range records {
+		sessions[i] = records[i].Data.Bytes
+	}
+	return sessions, nil
+}
+
+// DeleteExpired deletes sessions that expired before now, returning how many
+func (s *PostgresSessionStore) DeleteExpired(now time.Time) (int64, error) {
+	result := s.db.Where("expires_at <= ?", now).Delete(&database.SessionRecord{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete expired sessions: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// StartCleanup starts the background job deleting expired sessions. It does
+// nothing unless auth.session_store is postgres.
+func (s *PostgresSessionStore) StartCleanup() {
+	interval := s.config.Auth.SessionCleanupInterval
+	if s.config.Auth.SessionStore != "postgres" || interval <= 0 || s.stop != nil {
+		return
+	}
+
+	s.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				deleted, err := s.DeleteExpired(time.Now())
+				if err != nil {
+					log.Printf("Session cleanup failed: %v", err)
+					continue
+				}
+				if deleted > 0 {
+					log.Printf("Session cleanup: deleted %d expired sessions", deleted)
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopCleanup stops the background cleanup job
+func (s *PostgresSessionStore) StopCleanup() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
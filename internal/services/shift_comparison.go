@@ -0,0 +1,372 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm/clause"
+)
+
+// A shift is compared with the user's working activities: the first one
+// started from shifts.early_window before the shift until its end is the
+// sign-in, and the last one to end is the sign-out. A shift that started with
+// the user on leave is not late or missed.
+
+// maxShiftReportDays caps the period of a shift report
+const maxShiftReportDays = 93
+
+// ShiftReportFilter selects the users, locations and period of a shift report
+type ShiftReportFilter struct {
+	UserIDs     []uuid.UUID
+	LocationIDs []uuid.UUID
+	From        time.Time
+	To          time.Time
+}
+
+// ShiftComparison is one planned shift against what the user did. Status is
+// "upcoming" before the shift starts, "pending" until a sign-in or
+// shifts.absent_after, then "on_time", "late", "missed" or "on_leave".
+type ShiftComparison struct {
+	ShiftID          uuid.UUID  `json:"shift_id"`
+	UserID           uuid.UUID  `json:"user_id"`
+	UserName         string     `json:"user_name"`
+	LocationID       *uuid.UUID `json:"location_id"`
+	LocationName     string     `json:"location_name"`
+	Date             string     `json:"date" format:"date" doc:"Day the shift starts, in its timezone"`
+	PlannedStart     time.Time  `json:"planned_start"`
+	PlannedEnd       time.Time  `json:"planned_end"`
+	PlannedHours     float64    `json:"planned_hours"`
+	FirstSignIn      *time.Time `json:"first_sign_in"`
+	LastSignOut      *time.Time `json:"last_sign_out" doc:"Null while the user is still signed in"`
+	WorkedHours      float64    `json:"worked_hours" doc:"Working time within the planned shift"`
+	Status           string     `json:"status" enum:"upcoming,pending,on_time,late,missed,on_leave"`
+	LateMinutes      float64    `json:"late_minutes"`
+	LeftEarly        bool       `json:"left_early"`
+	LeftEarlyMinutes float64    `json:"left_early_minutes"`
+}
+
+// ShiftTotals sums a user's shifts over the report period
+type ShiftTotals struct {
+	UserID       uuid.UUID `json:"user_id"`
+	UserName     string    `json:"user_name"`
+	Shifts       int       `json:"shifts"`
+	OnTime       int       `json:"on_time"`
+	Late         int       `json:"late"`
+	Missed       int       `json:"missed"`
+	OnLeave      int       `json:"on_leave"`
+	LeftEarly    int       `json:"left_early"`
+	PlannedHours float64   `json:"planned_hours"`
+	WorkedHours  float64   `json:"worked_hours"`
+}
+
+// ShiftReport holds the per-shift rows and per-user totals of a shift report
+type ShiftReport struct {
+	Shifts []ShiftComparison `json:"shifts"`
+	Totals []ShiftTotals     `json:"totals"`
+}
+
+// shiftActivity is a working or leave activity read for shift comparison
+type shiftActivity struct {
+	UserID       uuid.UUID
+	FromDatetime time.Time
+	ToDatetime   *time.Time
+	StatusType   string
+}
+
+// CompareShifts compares every occurrence of the selected shifts starting in
+// the period with the users' working activities, ordered by user and start
+func (s *ShiftService) CompareShifts(filter ShiftReportFilter) (*ShiftReport, error) {
+	if !filter.To.After(filter.From) {
+		return nil, NewError(CodeValidationFailed, "'to' must be after 'from'")
+	}
+	if filter.To.Sub(filter.From) > maxShiftReportDays*24*time.Hour {
+		return nil, NewError(CodeValidationFailed, "period cannot be longer than %d days", maxShiftReportDays)
+	}
+
+	report := &ShiftReport{Shifts: []ShiftComparison{}, Totals: []ShiftTotals{}}
+	shifts, _, err := s.ListShifts(ShiftFilter{UserIDs: filter.UserIDs, LocationIDs: filter.LocationIDs})
+	if err != nil {
+		return nil, err
+	}
+
+	type planned struct {
+		shift *database.Shift
+		shiftOccurrence
+		loc *time.Location
+	}
+	var occurrences []planned
+	userIDs := []uuid.UUID{}
+	seen := map[uuid.UUID]bool{}
+	for i := range shifts {
+		shift := &shifts[i]
+		loc := shiftTimezone(shift)
+		for _, occurrence := range expandShift(shift, loc, filter.From, filter.To) {
+			// Only shifts starting in the period, so a shift is reported once
+			if occurrence.Start.Before(filter.From) {
+				continue
+			}
+			occurrences = append(occurrences, planned{shift, occurrence, loc})
+			if !seen[shift.UserID] {
+				seen[shift.UserID] = true
+				userIDs = append(userIDs, shift.UserID)
+			}
+		}
+	}
+	if len(occurrences) == 0 {
+		return report, nil
+	}
+
+	var activities []shiftActivity
+	err = database.ReadReplica(s.db).Raw(`
+		SELECT uah.user_id, uah.from_datetime, uah.to_datetime, us.type AS status_type
+		FROM user_activity_history uah
+		JOIN user_statuses us ON us.id = uah.status_id
+		WHERE us.type IN ('working', 'leave') AND uah.user_id IN ?
+		AND uah.from_datetime < ? AND (uah.to_datetime IS NULL OR uah.to_datetime > ?)
+		ORDER BY uah.from_datetime
+	`, userIDs, filter.To.Add(maxShiftLength), filter.From.Add(-s.config.EarlyWindow)).Scan(&activities).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to query activities: %w", err)
+	}
+	byUser := make(map[uuid.UUID][]shiftActivity, len(userIDs))
+	for _, activity := range activities {
+		byUser[activity.UserID] = append(byUser[activity.UserID], activity)
+	}
+
+	now := time.Now()
+	for _, occurrence := range occurrences {
+		row := s.compareShift(occurrence.shift, occurrence.shiftOccurrence, occurrence.loc, byUser[occurrence.shift.UserID], now)
+		report.Shifts = append(report.Shifts, row)
+	}
+	sort.SliceStable(report.Shifts, func(i, j int) bool {
+		a, b := report.Shifts[i], report.Shifts[j]
+		if a.UserName != b.UserName {
+			return a.UserName < b.UserName
+		}
+		if a.UserID != b.UserID {
+			return a.UserID.String() < b.UserID.String()
+		}
+		return a.PlannedStart.Before(b.PlannedStart)
+	})
+
+	var totals *ShiftTotals
+	for _, row := range report.Shifts {
+		if totals == nil || totals.UserID != row.UserID {
+			report.Totals = append(report.Totals, ShiftTotals{UserID: row.UserID, UserName: row.UserName})
+			totals = &report.Totals[len(report.Totals)-1]
+		}
+		totals.Shifts++
+		totals.PlannedHours += row.PlannedHours
+		totals.WorkedHours += row.WorkedHours
+		switch row.Status {
+		case "on_time":
+			totals.OnTime++
+		case "late":
+			totals.Late++
+		case "missed":
+			totals.Missed++
+		case "on_leave":
+			totals.OnLeave++
+		}
+		if row.LeftEarly {
+			totals.LeftEarly++
+		}
+	}
+	for i := range report.Totals {
+		report.Totals[i].PlannedHours = roundHours(report.Totals[i].PlannedHours)
+		report.Totals[i].WorkedHours = roundHours(report.Totals[i].WorkedHours)
+	}
+	return report, nil
+}
+
+// compareShift compares one occurrence of a shift with the user's working
+// and leave activities, ordered by start
+func (s *ShiftService) compareShift(shift *database.Shift, occurrence shiftOccurrence, loc *time.Location, activities []shiftActivity, now time.Time) ShiftComparison {
+	row := ShiftComparison{
+		ShiftID:      shift.ID,
+		UserID:       shift.UserID,
+		UserName:     strings.TrimSpace(shift.User.FirstName + " " + shift.User.LastName),
+		LocationID:   shift.LocationID,
+		Date:         occurrence.Start.In(loc).Format("2006-01-02"),
+		PlannedStart: occurrence.Start.In(loc),
+		PlannedEnd:   occurrence.End.In(loc),
+		PlannedHours: roundHours(occurrence.End.Sub(occurrence.Start).Hours()),
+	}
+	if shift.Location != nil {
+		row.LocationName = shift.Location.Name
+	}
+
+	windowStart := occurrence.Start.Add(-s.config.EarlyWindow)
+	onLeave, signedIn := false, false
+	var worked float64
+	for _, activity := range activities {
+		end := now
+		if activity.ToDatetime != nil {
+			end = *activity.ToDatetime
+		}
+		if activity.StatusType == "leave" {
+			if !activity.FromDatetime.After(occurrence.Start) && end.After(occurrence.Start) {
+				onLeave = true
+			}
+			continue
+		}
+		if !activity.FromDatetime.Before(occurrence.End) || !end.After(windowStart) {
+			continue
+		}
+
+		if row.FirstSignIn == nil {
+			signIn := activity.FromDatetime.In(loc)
+			row.FirstSignIn = &signIn
+		}
+		if activity.ToDatetime == nil {
+			signedIn = true
+		} else if row.LastSignOut == nil || activity.ToDatetime.After(*row.LastSignOut) {
+			signOut := activity.ToDatetime.In(loc)
+			row.LastSignOut = &signOut
+		}
+		if overlapEnd, overlapStart := minTime(end, occurrence.End), maxTime(activity.FromDatetime, occurrence.Start); overlapEnd.After(overlapStart) {
+			worked += overlapEnd.Sub(overlapStart).Hours()
+		}
+	}
+	if signedIn {
+		row.LastSignOut = nil
+	}
+	row.WorkedHours = roundHours(worked)
+
+	grace := time.Duration(s.config.GraceMinutes) * time.Minute
+	switch {
+	case row.FirstSignIn != nil && row.FirstSignIn.After(occurrence.Start.Add(grace)):
+		row.Status = "late"
+		row.LateMinutes = roundHours(row.FirstSignIn.Sub(occurrence.Start).Minutes())
+	case row.FirstSignIn != nil:
+		row.Status = "on_time"
+	case onLeave:
+		row.Status = "on_leave"
+	case now.Before(occurrence.Start):
+		row.Status = "upcoming"
+	case now.Before(occurrence.Start.Add(s.config.AbsentAfter)) && now.Before(occurrence.End):
+		row.Status = "pending"
+	default:
+		row.Status = "missed"
+	}
+
+	if row.LastSignOut != nil && !now.Before(occurrence.End) && row.LastSignOut.Before(occurrence.End.Add(-grace)) {
+		row.LeftEarly = true
+		row.LeftEarlyMinutes = roundHours(occurrence.End.Sub(*row.LastSignOut).Minutes())
+	}
+	return row
+}
+
+// StartNotifier periodically notifies managers of late and missed shifts.
+// It does nothing when shifts.notify_interval is zero.
+func (s *ShiftService) StartNotifier() {
+	interval := s.config.NotifyInterval
+	if interval <= 0 || s.stop != nil {
+		return
+	}
+
+	s.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.NotifyExceptions(time.Now()); err != nil {
+					log.Printf("Shift notification check failed: %v", err)
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopNotifier stops the background shift checker
+func (s *ShiftService) StopNotifier() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// NotifyExceptions compares the shifts started in the last two days and
+// emails each late or missed one once to the user's manager
+func (s *ShiftService) NotifyExceptions(now time.Time) error {
+	report, err := s.CompareShifts(ShiftReportFilter{From: now.AddDate(0, 0, -2), To: now})
+	if err != nil {
+		return err
+	}
+
+	for _, row := range report.Shifts {
+		if row.Status != "late" && row.Status != "missed" {
+			continue
+		}
+		if err := s.notifyException(row); err != nil {
+			log.Printf("Failed to notify %s shift of user %s on %s: %v", row.Status, row.UserID, row.Date, err)
+		}
+	}
+	return nil
+}
+
+// notifyException records a late or missed shift and emails the user's
+// manager, unless it was already recorded. Users without a manager with an
+// email address are recorded with the reason.
+func (s *ShiftService) notifyException(row ShiftComparison) error {
+	notification := database.ShiftNotification{
+		ID:      uuid.New(),
+		ShiftID: row.ShiftID,
+		UserID:  row.UserID,
+		Date:    row.Date,
+		Type:    row.Status,
+	}
+
+	var user database.User
+	if err := s.db.Select("id", "manager_id").Where("id = ?", row.UserID).Take(&user).Error; err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	var manager database.User
+	if user.ManagerID != nil {
+		if err := s.db.Where("id = ?", *user.ManagerID).Take(&manager).Error; err == nil {
+			notification.ManagerID = &manager.ID
+		}
+	}
+	switch {
+	case notification.ManagerID == nil:
+		notification.Error = "user has no manager"
+	case manager.Email == "":
+		notification.Error = "manager has no email address"
+	}
+
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&notification)
+	if result.Error != nil {
+		return fmt.Errorf("failed to record notification: %w", result.Error)
+	}
+	if result.RowsAffected == 0 || notification.Error != "" {
+		return nil
+	}
+
+	data := shiftExceptionData{
+		ShiftComparison: row,
+		ManagerName:     strings.TrimSpace(manager.FirstName + " " + manager.LastName),
+	}
+	locale := s.translator.Negotiate(manager.Locale, "")
+	subject := s.translator.Translate(locale, "email.shift_exception.subject", data)
+	if err := s.notifications.SendEmail([]string{manager.Email}, subject, s.translator.Translate(locale, "email.shift_exception.body", data)); err != nil {
+		s.db.Model(&notification).Update("error", err.Error())
+		return err
+	}
+	return nil
+}
+
+// shiftExceptionData is what the email.shift_exception.* messages are
+// rendered with: the late or missed shift and the manager notified
+type shiftExceptionData struct {
+	ShiftComparison
+	ManagerName string
+}
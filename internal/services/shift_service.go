@@ -0,0 +1,299 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ValidShiftRecurrences lists how a shift can repeat; empty is a one-off shift
+var ValidShiftRecurrences = []string{"", "daily", "weekdays", "weekly"}
+
+// maxShiftLength caps how long a single shift can be
+const maxShiftLength = 24 * time.Hour
+
+// ShiftService manages planned shifts and compares them with the sign-ins
+// and sign-outs actually recorded, notifying managers of late and missed
+// shifts
+type ShiftService struct {
+	db            *gorm.DB
+	config        config.ShiftsConfig
+	notifications *NotificationService
+	translator    *Translator
+	stop          chan struct{}
+}
+
+func NewShiftService(db *gorm.DB, cfg *config.Config, notifications *NotificationService, translator *Translator) *ShiftService {
+	return &ShiftService{
+		db:            db,
+		config:        cfg.Shifts,
+		notifications: notifications,
+		translator:    translator,
+	}
+}
+
+// ShiftInput describes a shift to plan
+type ShiftInput struct {
+	UserID     uuid.UUID
+	LocationID *uuid.UUID
+	StartsAt   time.Time
+	EndsAt     time.Time
+	Recurrence string
+	RecurUntil string
+	Notes      string
+}
+
+// ShiftUpdate holds the changes to a shift; nil fields are left as they are
+type ShiftUpdate struct {
+	LocationID    *uuid.UUID
+	ClearLocation bool
+	StartsAt      *time.Time
+	EndsAt        *time.Time
+	Recurrence    *string
+	RecurUntil    *string // Empty repeats indefinitely
+	Notes         *string
+}
+
+// ShiftFilter narrows the shifts returned by ListShifts
+type ShiftFilter struct {
+	UserIDs     []uuid.UUID
+	LocationIDs []uuid.UUID
+	Limit       int
+	Offset      int
+}
+
+// CreateShift plans a shift for a user
+func (s *ShiftService) CreateShift(input ShiftInput) (*database.Shift, error) {
+	shift := &database.Shift{
+		ID:         uuid.New(),
+		UserID:     input.UserID,
+		LocationID: input.LocationID,
+		StartsAt:   input.StartsAt,
+		EndsAt:     input.EndsAt,
+		Recurrence: input.Recurrence,
+		RecurUntil: input.RecurUntil,
+		Notes:      input.Notes,
+	}
+	if err := s.validateShift(shift); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Omit("User", "Location").Create(shift).Error; err != nil {
+		return nil, fmt.Errorf("failed to create shift: %w", err)
+	}
+	return s.GetShift(shift.ID)
+}
+
+// GetShift retrieves a shift by ID with its user and location
+func (s *ShiftService) GetShift(id uuid.UUID) (*database.Shift, error) {
+	var shift database.Shift
+	if err := s.db.Preload("User").Preload("Location").Where("id = ?", id).First(&shift).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, NewError(CodeNotFound, "shift not found")
+		}
+		return nil, fmt.Errorf("failed to get shift: %w", err)
+	}
+	return &shift, nil
+}
+
+// ListShifts retrieves shifts by start of the first shift, with the total matching the filter
+func (s *ShiftService) ListShifts(filter ShiftFilter) ([]database.Shift, int64, error) {
+	query := database.ReadReplica(s.db).Model(&database.Shift{})
+	if len(filter.UserIDs) > 0 {
+		query = query.Where("user_id IN ?", filter.UserIDs)
+	}
+	if len(filter.LocationIDs) > 0 {
+		query = query.Where("location_id IN ?", filter.LocationIDs)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count shifts: %w", err)
+	}
+
+	var shifts []database.Shift
+	query = query.Preload("User").Preload("Location").Order("starts_at")
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit).Offset(filter.Offset)
+	}
+	if err := query.Find(&shifts).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch shifts: %w", err)
+	}
+	return shifts, total, nil
+}
+
+// UpdateShift applies changes to a shift, rejecting them when expected names
+// a version other than the current one. Past occurrences of a repeating
+// shift are compared with the shift as it is now.
+func (s *ShiftService) UpdateShift(id uuid.UUID, update ShiftUpdate, expected *int) (*database.Shift, error) {
+	shift, err := s.GetShift(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion("shift", shift.Version, expected); err != nil {
+		return nil, err
+	}
+
+	if update.ClearLocation {
+		shift.LocationID = nil
+	} else if update.LocationID != nil {
+		shift.LocationID = update.LocationID
+	}
+	if update.StartsAt != nil {
+		shift.StartsAt = *update.StartsAt
+	}
+	if update.EndsAt != nil {
+		shift.EndsAt = *update.EndsAt
+	}
+	if update.Recurrence != nil {
+		shift.Recurrence = *update.Recurrence
+	}
+	if update.RecurUntil != nil {
+		shift.RecurUntil = *update.RecurUntil
+	}
+	if update.Notes != nil {
+		shift.Notes = *update.Notes
+	}
+	if err := s.validateShift(shift); err != nil {
+		return nil, err
+	}
+
+	err = updateVersioned(s.db, "shift", &database.Shift{ID: id}, shift.Version, map[string]interface{}{
+		"location_id": shift.LocationID,
+		"starts_at":   shift.StartsAt,
+		"ends_at":     shift.EndsAt,
+		"recurrence":  shift.Recurrence,
+		"recur_until": shift.RecurUntil,
+		"notes":       shift.Notes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetShift(id)
+}
+
+// DeleteShift deletes a shift, with its occurrences past and future
+func (s *ShiftService) DeleteShift(id uuid.UUID) error {
+	result := s.db.Where("id = ?", id).Delete(&database.Shift{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete shift: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return NewError(CodeNotFound, "shift not found")
+	}
+	return nil
+}
+
+// validateShift checks a shift's times and repeats, and that its user and
+// location exist
+func (s *ShiftService) validateShift(shift *database.Shift) error {
+	if shift.StartsAt.IsZero() || shift.EndsAt.IsZero() {
+		return NewError(CodeValidationFailed, "starts_at and ends_at are required")
+	}
+	if !shift.EndsAt.After(shift.StartsAt) {
+		return NewError(CodeValidationFailed, "ends_at must be after starts_at")
+	}
+	if shift.EndsAt.Sub(shift.StartsAt) > maxShiftLength {
+		return NewError(CodeValidationFailed, "a shift cannot be longer than %s", maxShiftLength)
+	}
+	if !containsString(ValidShiftRecurrences, shift.Recurrence) {
+		return NewError(CodeValidationFailed, "recurrence must be one of: daily, weekdays, weekly, or empty for a one-off shift")
+	}
+	if shift.RecurUntil != "" {
+		if shift.Recurrence == "" {
+			return NewError(CodeValidationFailed, "recur_until needs a recurrence")
+		}
+		if _, err := time.Parse("2006-01-02", shift.RecurUntil); err != nil {
+			return NewError(CodeValidationFailed, "recur_until must be YYYY-MM-DD")
+		}
+	}
+
+	var user database.User
+	if err := s.db.Select("id").Where("id = ?", shift.UserID).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return NewError(CodeValidationFailed, "user not found")
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if shift.LocationID != nil {
+		var location database.Location
+		if err := s.db.Select("id").Where("id = ?", *shift.LocationID).First(&location).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return NewError(CodeValidationFailed, "location not found")
+			}
+			return fmt.Errorf("failed to get location: %w", err)
+		}
+	}
+	return nil
+}
+
+// shiftTimezone is the timezone a shift repeats in: its location's, else its
+// user's, else UTC. The shift must be loaded with both.
+func shiftTimezone(shift *database.Shift) *time.Location {
+	if shift.Location != nil && shift.Location.Timezone != "" {
+		return loadTimezone(shift.Location.Timezone)
+	}
+	return loadTimezone(shift.User.Timezone)
+}
+
+// shiftOccurrence is one planned occurrence of a shift
+type shiftOccurrence struct {
+	Start time.Time
+	End   time.Time
+}
+
+// expandShift returns the occurrences of a shift that overlap [from, to), in
+// order. Repeats keep the first shift's wall-clock start in loc, so they
+// follow daylight saving changes.
+func expandShift(shift *database.Shift, loc *time.Location, from, to time.Time) []shiftOccurrence {
+	length := shift.EndsAt.Sub(shift.StartsAt)
+	first := shift.StartsAt.In(loc)
+	overlaps := func(start time.Time) bool {
+		return start.Before(to) && start.Add(length).After(from)
+	}
+
+	if shift.Recurrence == "" {
+		if overlaps(shift.StartsAt) {
+			return []shiftOccurrence{{Start: shift.StartsAt, End: shift.EndsAt}}
+		}
+		return nil
+	}
+
+	// Start a day early so an occurrence running over midnight into the period is included
+	day := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, loc)
+	if periodStart := from.In(loc).AddDate(0, 0, -1); periodStart.After(day) {
+		day = time.Date(periodStart.Year(), periodStart.Month(), periodStart.Day(), 0, 0, 0, 0, loc)
+	}
+	last := to.In(loc)
+	if shift.RecurUntil != "" {
+		if until, err := time.ParseInLocation("2006-01-02", shift.RecurUntil, loc); err == nil && until.Before(last) {
+			last = until.AddDate(0, 0, 1)
+		}
+	}
+
+	var occurrences []shiftOccurrence
+	for ; day.Before(last); day = day.AddDate(0, 0, 1) {
+		switch shift.Recurrence {
+		case "weekdays":
+			if day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+				continue
+			}
+		case "weekly":
+			if day.Weekday() != first.Weekday() {
+				continue
+			}
+		}
+		start := time.Date(day.Year(), day.Month(), day.Day(), first.Hour(), first.Minute(), first.Second(), 0, loc)
+		if start.Before(shift.StartsAt) || !start.Before(last) {
+			continue
+		}
+		if overlaps(start) {
+			occurrences = append(occurrences, shiftOccurrence{Start: start, End: start.Add(length)})
+		}
+	}
+	return occurrences
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Built-in system tasks
+const (
+	SystemTaskCloseOpenActivities = "close_open_activities"
+	SystemTaskActivityRollup      = "activity_rollup"
+)
+
+// SystemTask is the work a scheduled automated action does. Tasks are
+// registered on the ActionService by name and named, with their config, in
+// the action's "schedule" details.
+type SystemTask interface {
+	// Validate checks a task's config when the action is saved
+	Validate(config map[string]interface{}) error
+	// Run performs the task, returning a short description of the outcome
+	Run(ctx context.Context, config map[string]interface{}, now time.Time) (string, error)
+}
+
+// RegisterSystemTask makes a system task available to scheduled actions under name
+func (s *ActionService) RegisterSystemTask(name string, task SystemTask) {
+	s.systemTasks[name] = task
+}
+
+// SystemTasks returns the names of the registered system tasks
+func (s *ActionService) SystemTasks() []string {
+	names := make([]string, 0, len(s.systemTasks))
+	for name := range s.systemTasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// closeOpenActivitiesTask closes open activities, e.g. work left open at
+// midnight by users who never signed out. Config:
+//
+//	"status_types": ["working"]  only activities whose user status has one of these types
+//	"older_than": "12h"          only activities started at least this long ago
+type closeOpenActivitiesTask struct {
+	db *gorm.DB
+}
+
+func (t *closeOpenActivitiesTask) Validate(config map[string]interface{}) error {
+	if _, err := configStrings(config, "status_types"); err != nil {
+		return err
+	}
+	if olderThan, ok := config["older_than"]; ok {
+		value, _ := olderThan.(string)
+		if d, err := time.ParseDuration(value); err != nil || d < 0 {
+			return fmt.Errorf("older_than must be a duration such as 12h")
+		}
+	}
+	return nil
+}
+
+// Run closes each user's matching activities under the user's activity lock
+// (see lockUserActivities), so it cannot race a user signing in or out
+func (t *closeOpenActivitiesTask) Run(ctx context.Context, config map[string]interface{}, now time.Time) (string, error) {
+	matching := func(db *gorm.DB) *gorm.DB {
+		query := db.Model(&database.UserActivityHistory{}).Where("to_datetime IS NULL")
+		if olderThan, ok := config["older_than"].(string); ok {
+			d, _ := time.ParseDuration(olderThan)
+			query = query.Where("from_datetime <= ?", now.Add(-d))
+		}
+		if statusTypes, _ := configStrings(config, "status_types"); len(statusTypes) > 0 {
+			query = query.Where("status_id IN (?)", db.Model(&database.UserStatus{}).Select("id").Where("type IN ?", statusTypes))
+		}
+		return query
+	}
+
+	var userIDs []uuid.UUID
+	if err := matching(t.db.WithContext(ctx)).Distinct("user_id").Pluck("user_id", &userIDs).Error; err != nil {
+		return "", fmt.Errorf("failed to find open activities: %w", err)
+	}
+
+	var closed int64
+	for _, userID := range userIDs {
+		err := t.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := lockUserActivities(tx, userID); err != nil {
+				return err
+			}
+			// Activities the user closed while waiting for the lock no longer match
+			result := matching(tx).Where("user_id = ?", userID).Updates(map[string]interface{}{"to_datetime": now, "updated_at": now})
+			if result.Error != nil {
+				return result.Error
+			}
+			closed += result.RowsAffected
+			return nil
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to close open activities of user %s after closing %d: %w", userID, closed, err)
+		}
+	}
+	return fmt.Sprintf("closed %d open activities", closed), nil
+}
+
+// activityRollupTask rebuilds the daily rollups of recent days, for a backfill
+// or to recover from a refresh that was disabled, by queueing the activities
+// of users active in them and refreshing. Config:
+//
+//	"days": 1  how many days before today (UTC) to rebuild
+type activityRollupTask struct {
+	db         *gorm.DB
+	activities *UserActivityService
+}
+
+func (t *activityRollupTask) Validate(config map[string]interface{}) error {
+	if days, ok := config["days"]; ok {
+		if n, isNumber := days.(float64); !isNumber || n < 1 || n != float64(int(n)) {
+			return fmt.Errorf("days must be a whole number of at least 1")
+		}
+	}
+	return nil
+}
+
+func (t *activityRollupTask) Run(ctx context.Context, config map[string]interface{}, now time.Time) (string, error) {
+	days := 1
+	if n, ok := config["days"].(float64); ok {
+		days = int(n)
+	}
+
+	today := now.UTC().Truncate(24 * time.Hour)
+	from := today.AddDate(0, 0, -days)
+	if err := t.db.WithContext(ctx).Exec(`
+		INSERT INTO activity_rollup_queue (user_id, from_datetime, to_datetime)
+		SELECT DISTINCT user_id, ?::timestamptz, ?::timestamptz FROM user_activity_history
+		WHERE from_datetime < ? AND (to_datetime IS NULL OR to_datetime > ?)
+	`, from, today, today, from).Error; err != nil {
+		return "", fmt.Errorf("failed to queue activity rollups: %w", err)
+	}
+
+	rows, err := t.activities.RefreshActivityRollups(ctx, now)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("rolled up %d user-days over %d day(s)", rows, days), nil
+}
+
+// configStrings reads an optional list of strings from a task config
+func configStrings(config map[string]interface{}, key string) ([]string, error) {
+	raw, ok := config[key]
+	if !ok {
+		return nil, nil
+	}
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must be a list of strings", key)
+	}
+	values := make([]string, len(list))
+	for i, item := range list {
+		value, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s must be a list of strings", key)
+		}
+		values[i] = value
+	}
+	return values, nil
+}
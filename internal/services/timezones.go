@@ -0,0 +1,80 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+)
+
+// timezones caches loaded zones by IANA name, as time.LoadLocation reads the
+// zone database on every call
+var timezones sync.Map
+
+// CheckTimezone validates a user's or location's timezone, an IANA name such
+// as Europe/Paris. Empty clears the setting; unknown zones are
+// VALIDATION_FAILED.
+func CheckTimezone(name string) error {
+	if name == "" {
+		return nil
+	}
+	if _, err := time.LoadLocation(name); err != nil {
+		return NewError(CodeValidationFailed, "unknown timezone '%s'", name)
+	}
+	return nil
+}
+
+// loadTimezone returns the zone named name, or UTC for empty or unknown names
+func loadTimezone(name string) *time.Location {
+	if name == "" {
+		return time.UTC
+	}
+	if loc, ok := timezones.Load(name); ok {
+		return loc.(*time.Location)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	timezones.Store(name, loc)
+	return loc
+}
+
+// activityTimezone is the zone an activity happened in: its location's, else
+// its user's, else UTC. User and Location must be loaded.
+func activityTimezone(activity *database.UserActivityHistory) string {
+	if activity.Location != nil && activity.Location.Timezone != "" {
+		return activity.Location.Timezone
+	}
+	if activity.User.Timezone != "" {
+		return activity.User.Timezone
+	}
+	return "UTC"
+}
+
+// localizeActivity sets an activity's Timezone and expresses its times in that
+// zone, so they serialize with the local offset
+func localizeActivity(activity *database.UserActivityHistory) {
+	activity.Timezone = activityTimezone(activity)
+	loc := loadTimezone(activity.Timezone)
+	activity.FromDateTime = activity.FromDateTime.In(loc)
+	if activity.ToDateTime != nil {
+		to := activity.ToDateTime.In(loc)
+		activity.ToDateTime = &to
+	}
+}
+
+// splitByDay splits [start, end) at midnight in loc and calls fn with the
+// start of each local day and the hours of the interval that fall within it.
+// Days are calendar days, so across a DST change they have 23 or 25 hours.
+func splitByDay(start, end time.Time, loc *time.Location, fn func(day time.Time, hours float64)) {
+	start = start.In(loc)
+	end = end.In(loc)
+	for start.Before(end) {
+		day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, loc)
+		next := time.Date(start.Year(), start.Month(), start.Day()+1, 0, 0, 0, 0, loc)
+		segmentEnd := minTime(next, end)
+		fn(day, segmentEnd.Sub(start).Hours())
+		start = segmentEnd
+	}
+}
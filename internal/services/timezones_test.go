@@ -0,0 +1,179 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("timezone %s is not available: %v", name, err)
+	}
+	return loc
+}
+
+type daySegment struct {
+	day   time.Time
+	hours float64
+}
+
+func collectDays(start, end time.Time, loc *time.Location) []daySegment {
+	var segments []daySegment
+	splitByDay(start, end, loc, func(day time.Time, hours float64) {
+		segments = append(segments, daySegment{day: day, hours: hours})
+	})
+	return segments
+}
+
+func TestSplitByDay(t *testing.T) {
+	newYork := mustLoadLocation(t, "America/New_York")
+	paris := mustLoadLocation(t, "Europe/Paris")
+
+	tests := []struct {
+		name       string
+		loc        *time.Location
+		start, end time.Time
+		want       []daySegment
+	}{
+		{
+			// Clocks go forward at 02:00 on 10 March 2024, so that day has 23 hours
+			name:  "New York spring forward",
+			loc:   newYork,
+			start: time.Date(2024, 3, 9, 12, 0, 0, 0, newYork),
+			end:   time.Date(2024, 3, 11, 12, 0, 0, 0, newYork),
+			want: []daySegment{
+				{day: time.Date(2024, 3, 9, 0, 0, 0, 0, newYork), hours: 12},
+				{day: time.Date(2024, 3, 10, 0, 0, 0, 0, newYork), hours: 23},
+				{day: time.Date(2024, 3, 11, 0, 0, 0, 0, newYork), hours: 12},
+			},
+		},
+		{
+			// Clocks go back at 03:00 on 27 October 2024, so that day has 25 hours
+			name:  "Paris fall back",
+			loc:   paris,
+			start: time.Date(2024, 10, 26, 0, 0, 0, 0, paris),
+			end:   time.Date(2024, 10, 28, 0, 0, 0, 0, paris),
+			want: []daySegment{
+				{day: time.Date(2024, 10, 26, 0, 0, 0, 0, paris), hours: 24},
+				{day: time.Date(2024, 10, 27, 0, 0, 0, 0, paris), hours: 25},
+			},
+		},
+		{
+			// 22:00 to 02:00 in New York is 03:00 to 07:00 UTC, one UTC day
+			name:  "splits at local midnight",
+			loc:   newYork,
+			start: time.Date(2024, 1, 16, 3, 0, 0, 0, time.UTC),
+			end:   time.Date(2024, 1, 16, 7, 0, 0, 0, time.UTC),
+			want: []daySegment{
+				{day: time.Date(2024, 1, 15, 0, 0, 0, 0, newYork), hours: 2},
+				{day: time.Date(2024, 1, 16, 0, 0, 0, 0, newYork), hours: 2},
+			},
+		},
+		{
+			name:  "within a day",
+			loc:   paris,
+			start: time.Date(2024, 10, 27, 1, 0, 0, 0, paris),
+			end:   time.Date(2024, 10, 27, 4, 0, 0, 0, paris),
+			want: []daySegment{
+				{day: time.Date(2024, 10, 27, 0, 0, 0, 0, paris), hours: 4},
+			},
+		},
+		{
+			name:  "empty",
+			loc:   paris,
+			start: time.Date(2024, 10, 27, 1, 0, 0, 0, paris),
+			end:   time.Date(2024, 10, 27, 1, 0, 0, 0, paris),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := collectDays(tt.start, tt.end, tt.loc)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d days %v, want %d", len(got), got, len(tt.want))
+			}
+			for i := range got {
+				if !got[i].day.Equal(tt.want[i].day) || got[i].day.Location() != tt.loc {
+					t.Errorf("day %d starts %v, want %v", i, got[i].day, tt.want[i].day)
+				}
+				if got[i].hours != tt.want[i].hours {
+					t.Errorf("day %d has %v hours, want %v", i, got[i].hours, tt.want[i].hours)
+				}
+			}
+		})
+	}
+}
+
+func TestActivitySummaryAcrossDST(t *testing.T) {
+	newYork := mustLoadLocation(t, "America/New_York")
+
+	builder := newActivitySummaryBuilder(uuid.New(), "Ada Lovelace", newYork)
+	splitByDay(time.Date(2024, 3, 9, 0, 0, 0, 0, newYork), time.Date(2024, 3, 12, 0, 0, 0, 0, newYork), newYork, func(day time.Time, hours float64) {
+		builder.add(day, "working", hours)
+	})
+	summary := builder.build()
+
+	if summary.Timezone != "America/New_York" {
+		t.Errorf("timezone is %q", summary.Timezone)
+	}
+	if summary.TotalHours != 71 {
+		t.Errorf("total is %v hours, want 71", summary.TotalHours)
+	}
+
+	want := map[string]float64{"2024-03-09": 24, "2024-03-10": 23, "2024-03-11": 24}
+	if len(summary.Daily) != len(want) {
+		t.Fatalf("got %d days, want %d", len(summary.Daily), len(want))
+	}
+	for _, day := range summary.Daily {
+		if day.TotalHours != want[day.Period] || day.Hours["working"] != want[day.Period] {
+			t.Errorf("%s has %v hours, want %v", day.Period, day.TotalHours, want[day.Period])
+		}
+	}
+
+	// Saturday the 9th is in the week of 4 March; the rest in the week of the 11th
+	weeks := map[string]float64{"2024-03-04": 47, "2024-03-11": 24}
+	for _, week := range summary.Weekly {
+		if week.TotalHours != weeks[week.Start] {
+			t.Errorf("week from %s has %v hours, want %v", week.Start, week.TotalHours, weeks[week.Start])
+		}
+	}
+}
+
+func TestTimesheetDaysAcrossDST(t *testing.T) {
+	paris := mustLoadLocation(t, "Europe/Paris")
+	period := &activityPeriod{UserID: uuid.New(), UserName: "Ada Lovelace", Loc: paris}
+
+	days := map[string]*TimesheetDay{}
+	// Working from 22:00 on the 26th to 02:00 on the 28th, through the 25-hour day
+	splitByDay(time.Date(2024, 10, 26, 22, 0, 0, 0, paris), time.Date(2024, 10, 28, 2, 0, 0, 0, paris), paris, func(dayStart time.Time, hours float64) {
+		timesheetDayOf(days, period, dayStart).addHours("working", hours)
+	})
+
+	var got []TimesheetDay
+	if err := emitTimesheetDays(days, func(day TimesheetDay) error {
+		got = append(got, day)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		date  string
+		hours float64
+	}{{"2024-10-26", 2}, {"2024-10-27", 25}, {"2024-10-28", 2}}
+	if len(got) != len(want) {
+		t.Fatalf("got %d rows, want %d", len(got), len(want))
+	}
+	for i, day := range got {
+		if day.Date != want[i].date || day.WorkedHours != want[i].hours {
+			t.Errorf("row %d is %s with %v hours, want %s with %v", i, day.Date, day.WorkedHours, want[i].date, want[i].hours)
+		}
+		if day.Timezone != "Europe/Paris" {
+			t.Errorf("row %d has timezone %q", i, day.Timezone)
+		}
+	}
+}
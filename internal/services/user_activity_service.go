@@ -1,22 +1,62 @@
 package services
 
 import (
+	"context"
+	"encoding/base64"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/YubiApp/internal/config"
 	"github.com/YubiApp/internal/database"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"github.com/jackc/pgtype"
 )
 
 type UserActivityService struct {
-	db *gorm.DB
+	db          *gorm.DB
+	categorizer *ActivityCategorizer
+	events      *EventBus
+	maxOffset   int
+
+	rollupInterval time.Duration
+	rollupStop     chan struct{}
+
+	holidayCountry  string // holidays.default_country
+	holidayCategory string // Category of working hours on holidays; empty keeps their usual one
+}
+
+// NewUserActivityService creates the service. events receives
+// user_activity.recorded and may be nil.
+func NewUserActivityService(db *gorm.DB, config *config.Config, events *EventBus) *UserActivityService {
+	return &UserActivityService{
+		db:          db,
+		categorizer: NewActivityCategorizer(config.Activity.Categories),
+		events:      events,
+		maxOffset:   config.Activity.MaxOffset,
+
+		rollupInterval: config.Activity.RollupInterval,
+
+		holidayCountry:  config.Holidays.DefaultCountry,
+		holidayCategory: config.Holidays.Category,
+	}
 }
 
-func NewUserActivityService(db *gorm.DB) *UserActivityService {
-	return &UserActivityService{db: db}
+// UserActivityRecorded is the payload of a user_activity.recorded event: a user
+// started an activity with a status
+type UserActivityRecorded struct {
+	ActivityID uuid.UUID              `json:"activity_id"`
+	UserID     uuid.UUID              `json:"user_id"`
+	Username   string                 `json:"username"`
+	Action     string                 `json:"action"`
+	Status     string                 `json:"status"`
+	StatusType string                 `json:"status_type"`
+	LocationID *uuid.UUID             `json:"location_id,omitempty"`
+	OccurredAt time.Time              `json:"occurred_at"`
+	Details    map[string]interface{} `json:"details,omitempty"`
 }
 
 // ActivityFilter represents the filters for querying user activity
@@ -29,26 +69,90 @@ type ActivityFilter struct {
 	ActionIDs    []uuid.UUID
 	Limit        int
 	Offset       int
+	Cursor       *ActivityCursor // Only activities after this one
+}
+
+// activityOrder is the order activities are listed in, which cursors follow
+const activityOrder = "from_datetime DESC, id DESC"
+
+// activityStreamBatch is how many activities StreamUserActivity reads at a time
+const activityStreamBatch = 1000
+
+// ActivityCursor is a position in an activity listing. A page after it starts
+// past this activity however many rows come before, unlike an offset.
+type ActivityCursor struct {
+	FromDateTime time.Time
+	ID           uuid.UUID
+}
+
+// String encodes the cursor as the opaque token clients send back
+func (c ActivityCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.FromDateTime.UTC().Format(time.RFC3339Nano) + "," + c.ID.String()))
 }
 
-// ActivitySummary represents a summary of user activity
+// ParseActivityCursor decodes a cursor encoded by ActivityCursor.String
+func ParseActivityCursor(token string) (*ActivityCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, NewError(CodeValidationFailed, "invalid cursor")
+	}
+	fromStr, idStr, ok := strings.Cut(string(raw), ",")
+	if !ok {
+		return nil, NewError(CodeValidationFailed, "invalid cursor")
+	}
+	from, err := time.Parse(time.RFC3339Nano, fromStr)
+	if err != nil {
+		return nil, NewError(CodeValidationFailed, "invalid cursor")
+	}
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return nil, NewError(CodeValidationFailed, "invalid cursor")
+	}
+	return &ActivityCursor{FromDateTime: from, ID: id}, nil
+}
+
+// NextActivityCursor returns the cursor of the page after activities, a page
+// of limit activities, or nil when it was the last
+func NextActivityCursor(activities []database.UserActivityHistory, limit int) *ActivityCursor {
+	if limit <= 0 || len(activities) < limit {
+		return nil
+	}
+	last := activities[len(activities)-1]
+	return &ActivityCursor{FromDateTime: last.FromDateTime, ID: last.ID}
+}
+
+// ActivitySummary represents a summary of user activity.
+// Hours are keyed by category name (see ActivityCategorizer).
 type ActivitySummary struct {
-	UserID       uuid.UUID `json:"user_id"`
-	UserName     string    `json:"user_name"`
-	TotalHours   float64   `json:"total_hours"`
-	BreakHours   float64   `json:"break_hours"`
-	WorkHours    float64   `json:"work_hours"`
-	MeetingHours float64   `json:"meeting_hours"`
-	SignIns      int       `json:"sign_ins"`
-	SignOuts     int       `json:"sign_outs"`
+	UserID     uuid.UUID               `json:"user_id"`
+	UserName   string                  `json:"user_name"`
+	Timezone   string                  `json:"timezone" doc:"The user's timezone (UTC when unset); days and weeks are local to it, so a day across a DST change has 23 or 25 hours"`
+	TotalHours float64                 `json:"total_hours"`
+	Hours      map[string]float64      `json:"hours" doc:"Hours per configured category (closed activities only); working hours on public holidays are under holidays.category"`
+	SignIns    int                     `json:"sign_ins"`
+	SignOuts   int                     `json:"sign_outs"`
+	Daily      []ActivityPeriodSummary `json:"daily"`
+	Weekly     []ActivityPeriodSummary `json:"weekly"`
+}
+
+// ActivityPeriodSummary represents the hours per category within a day or ISO week
+type ActivityPeriodSummary struct {
+	Period     string             `json:"period" doc:"Day (YYYY-MM-DD) or ISO week (YYYY-Www)"`
+	Start      string             `json:"start" format:"date" doc:"First day of the period"`
+	TotalHours float64            `json:"total_hours"`
+	Hours      map[string]float64 `json:"hours"`
 }
 
 // GetUserActivity retrieves user activity history with filters
 func (s *UserActivityService) GetUserActivity(filter ActivityFilter) ([]database.UserActivityHistory, int64, error) {
+	if s.maxOffset > 0 && filter.Offset > s.maxOffset {
+		return nil, 0, NewError(CodeValidationFailed, "offset cannot exceed %d; page with the cursor instead", s.maxOffset)
+	}
+
 	var activities []database.UserActivityHistory
 	var total int64
 
-	query := s.db.Model(&database.UserActivityHistory{}).
+	query := database.ReadReplica(s.db).Model(&database.UserActivityHistory{}).
 		Preload("User").
 		Preload("Action").
 		Preload("Location").
@@ -63,6 +167,7 @@ func (s *UserActivityService) GetUserActivity(filter ActivityFilter) ([]database
 	}
 
 	// Apply pagination
+	query = applyActivityCursor(query, filter.Cursor)
 	if filter.Limit > 0 {
 		query = query.Limit(filter.Limit)
 	}
@@ -70,17 +175,72 @@ func (s *UserActivityService) GetUserActivity(filter ActivityFilter) ([]database
 		query = query.Offset(filter.Offset)
 	}
 
-	// Order by from_datetime descending
-	query = query.Order("from_datetime DESC")
+	// Order by from_datetime descending, then id for a stable cursor
+	query = query.Order(activityOrder)
 
 	// Execute query
 	if err := query.Find(&activities).Error; err != nil {
 		return nil, 0, fmt.Errorf("failed to get activities: %w", err)
 	}
+	for i := range activities {
+		localizeActivity(&activities[i])
+	}
 
 	return activities, total, nil
 }
 
+// StreamUserActivity calls fn with each matching activity in listing order,
+// reading them in batches past a cursor so an export of any size holds one
+// batch in memory. filter.Limit caps the activities streamed, 0 streams all;
+// filter.Offset is ignored.
+func (s *UserActivityService) StreamUserActivity(ctx context.Context, filter ActivityFilter, fn func(*database.UserActivityHistory) error) error {
+	cursor := filter.Cursor
+	streamed := 0
+	for {
+		batch := activityStreamBatch
+		if filter.Limit > 0 && filter.Limit-streamed < batch {
+			batch = filter.Limit - streamed
+		}
+		if batch <= 0 {
+			return nil
+		}
+
+		query := database.ReadReplica(s.db).WithContext(ctx).Model(&database.UserActivityHistory{}).
+			Preload("User").
+			Preload("Action").
+			Preload("Location").
+			Preload("Status")
+		query = applyActivityCursor(s.applyFilters(query, filter), cursor)
+
+		var activities []database.UserActivityHistory
+		if err := query.Order(activityOrder).Limit(batch).Find(&activities).Error; err != nil {
+			return fmt.Errorf("failed to get activities: %w", err)
+		}
+		for i := range activities {
+			localizeActivity(&activities[i])
+			if err := fn(&activities[i]); err != nil {
+				return err
+			}
+		}
+		streamed += len(activities)
+
+		cursor = NextActivityCursor(activities, batch)
+		if cursor == nil {
+			return nil
+		}
+	}
+}
+
+// applyActivityCursor limits the query to activities after cursor, if any.
+// The plain from_datetime bound lets PostgreSQL skip later partitions, which
+// it cannot do from the row comparison.
+func applyActivityCursor(query *gorm.DB, cursor *ActivityCursor) *gorm.DB {
+	if cursor == nil {
+		return query
+	}
+	return query.Where("from_datetime <= ? AND (from_datetime, id) < (?, ?)", cursor.FromDateTime, cursor.FromDateTime, cursor.ID)
+}
+
 // GetActivityByUser retrieves activity for a specific user
 func (s *UserActivityService) GetActivityByUser(userID uuid.UUID, filter ActivityFilter) ([]database.UserActivityHistory, int64, error) {
 	filter.UserIDs = []uuid.UUID{userID}
@@ -105,93 +265,190 @@ func (s *UserActivityService) GetActivityByAction(actionIDs []uuid.UUID, filter
 	return s.GetUserActivity(filter)
 }
 
-// GetActivitySummary retrieves activity summary for users
+// GetActivitySummary retrieves activity summary for users.
+// Hours are computed from closed activity intervals only, clipped to the
+// requested period and grouped into categories by the activity's user status.
+// Days and weeks are counted in each user's timezone, UTC when unset.
+// Sign-ins and sign-outs count activities started within the period.
+// Whole days are read from activity_rollups unless they have changes still
+// queued for the rollup refresh. Working hours on a public holiday at the
+// activity's location are reported under holidays.category.
 func (s *UserActivityService) GetActivitySummary(userIDs []uuid.UUID, fromTime, toTime time.Time) ([]ActivitySummary, error) {
-	var summaries []ActivitySummary
-
-	// Build the base query
-	query := `
-		SELECT 
-			u.id as user_id,
-			CONCAT(u.first_name, ' ', u.last_name) as user_name,
-			COALESCE(SUM(
-				CASE 
-					WHEN a.name IN ('work-start', 'work-end', 'meeting-start', 'meeting-end') 
-					THEN EXTRACT(EPOCH FROM (COALESCE(uah.to_datetime, NOW()) - uah.from_datetime)) / 3600
-					ELSE 0 
-				END
-			), 0) as total_hours,
-			COALESCE(SUM(
-				CASE 
-					WHEN a.name IN ('break-start', 'break-end') 
-					THEN EXTRACT(EPOCH FROM (COALESCE(uah.to_datetime, NOW()) - uah.from_datetime)) / 3600
-					ELSE 0 
-				END
-			), 0) as break_hours,
-			COALESCE(SUM(
-				CASE 
-					WHEN a.name IN ('work-start', 'work-end') 
-					THEN EXTRACT(EPOCH FROM (COALESCE(uah.to_datetime, NOW()) - uah.from_datetime)) / 3600
-					ELSE 0 
-				END
-			), 0) as work_hours,
-			COALESCE(SUM(
-				CASE 
-					WHEN a.name IN ('meeting-start', 'meeting-end') 
-					THEN EXTRACT(EPOCH FROM (COALESCE(uah.to_datetime, NOW()) - uah.from_datetime)) / 3600
-					ELSE 0 
-				END
-			), 0) as meeting_hours,
-			COUNT(CASE WHEN a.name = 'user-signin' THEN 1 END) as sign_ins,
-			COUNT(CASE WHEN a.name = 'user-signout' THEN 1 END) as sign_outs
-		FROM users u
-		LEFT JOIN user_activity_history uah ON u.id = uah.user_id
-		LEFT JOIN actions a ON uah.action_id = a.id
-		WHERE uah.from_datetime >= ? AND uah.from_datetime <= ?
-	`
-
-	var args []interface{}
-	args = append(args, fromTime, toTime)
-
-	if len(userIDs) > 0 {
-		placeholders := make([]string, len(userIDs))
-		for i := range userIDs {
-			placeholders[i] = "?"
-			args = append(args, userIDs[i])
+	var holidays *holidayCalendar
+	if s.holidayCategory != "" {
+		// Local days are within a day of UTC ones
+		var err error
+		holidays, err = loadHolidayCalendar(database.ReadReplica(s.db), s.holidayCountry,
+			calendarDate(fromTime.UTC()).AddDate(0, 0, -1).Format("2006-01-02"), calendarDate(toTime.UTC()).AddDate(0, 0, 1).Format("2006-01-02"))
+		if err != nil {
+			return nil, err
 		}
-		query += fmt.Sprintf(" AND u.id IN (%s)", strings.Join(placeholders, ","))
 	}
 
-	query += `
-		GROUP BY u.id, u.first_name, u.last_name
-		ORDER BY u.first_name, u.last_name
-	`
+	summaries := []ActivitySummary{}
+	err := readActivityPeriods(database.ReadReplica(s.db), s.rollupInterval > 0, userIDs, fromTime, toTime, "first_name, last_name, id", func(period *activityPeriod) error {
+		current := newActivitySummaryBuilder(period.UserID, period.UserName, period.Loc)
+		for _, rollup := range period.Rollups {
+			current.summary.SignIns += rollup.SignIns
+			current.summary.SignOuts += rollup.SignOuts
+			for status, hours := range rollup.Hours {
+				current.add(rollup.Day, s.summaryCategory(holidays, rollup.Day, rollup.LocationIDs, status.Name, status.Type), hours)
+			}
+		}
+
+		for _, interval := range period.Intervals {
+			// Sign-ins and sign-outs are counted where the activity started
+			if !interval.FromDateTime.Before(fromTime) && !period.RolledUp(localDay(interval.FromDateTime, period.Loc)) {
+				switch interval.ActionName {
+				case "user-signin":
+					current.summary.SignIns++
+				case "user-signout":
+					current.summary.SignOuts++
+				}
+			}
+
+			// Open activities have no duration yet and are excluded from hours
+			if interval.ToDateTime == nil {
+				continue
+			}
+
+			var locationIDs []uuid.UUID
+			if interval.LocationID != nil {
+				locationIDs = []uuid.UUID{*interval.LocationID}
+			}
+			splitByDay(maxTime(interval.FromDateTime, fromTime), minTime(*interval.ToDateTime, toTime), period.Loc, func(day time.Time, hours float64) {
+				if !period.RolledUp(day) {
+					current.add(day, s.summaryCategory(holidays, day, locationIDs, interval.StatusName, interval.StatusType), hours)
+				}
+			})
+		}
 
-	rows, err := s.db.Raw(query, args...).Rows()
+		summaries = append(summaries, current.build())
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute summary query: %w", err)
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var summary ActivitySummary
-		err := rows.Scan(
-			&summary.UserID,
-			&summary.UserName,
-			&summary.TotalHours,
-			&summary.BreakHours,
-			&summary.WorkHours,
-			&summary.MeetingHours,
-			&summary.SignIns,
-			&summary.SignOuts,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan summary row: %w", err)
+		return nil, fmt.Errorf("failed to read activity summary: %w", err)
+	}
+	return summaries, nil
+}
+
+// summaryCategory returns the summary category of a status's hours on a
+// local day at the given locations: holidays.category for working hours on a
+// holiday at any of them, or on a day without them
+func (s *UserActivityService) summaryCategory(holidays *holidayCalendar, day time.Time, locationIDs []uuid.UUID, statusName, statusType string) string {
+	if holidays != nil && statusType == "working" && holidays.AnyHoliday(day.Format("2006-01-02"), locationIDs) {
+		return s.holidayCategory
+	}
+	return s.categorizer.Category(statusName, statusType)
+}
+
+// Categories returns the configured summary category names, with
+// holidays.category when set
+func (s *UserActivityService) Categories() []string {
+	names := s.categorizer.Names()
+	if s.holidayCategory == "" {
+		return names
+	}
+	for _, name := range names {
+		if name == s.holidayCategory {
+			return names
 		}
-		summaries = append(summaries, summary)
 	}
+	names = append(append([]string{}, names...), s.holidayCategory)
+	sort.Strings(names)
+	return names
+}
 
-	return summaries, nil
+// ListActivityRollups retrieves the daily rollups for days from fromDay to
+// toDay inclusive, optionally for one user
+func (s *UserActivityService) ListActivityRollups(userID *uuid.UUID, fromDay, toDay time.Time) ([]database.ActivityRollup, error) {
+	query := database.ReadReplica(s.db).Preload("User").Where("day >= ? AND day <= ?", fromDay, toDay)
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	}
+
+	var rollups []database.ActivityRollup
+	if err := query.Order("day, user_id").Find(&rollups).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch activity rollups: %w", err)
+	}
+	return rollups, nil
+}
+
+// activitySummaryBuilder accumulates a single user's hours by day and week
+type activitySummaryBuilder struct {
+	summary ActivitySummary
+	loc     *time.Location
+	daily   map[string]*ActivityPeriodSummary
+	weekly  map[string]*ActivityPeriodSummary
+}
+
+func newActivitySummaryBuilder(userID uuid.UUID, userName string, loc *time.Location) *activitySummaryBuilder {
+	return &activitySummaryBuilder{
+		summary: ActivitySummary{
+			UserID:   userID,
+			UserName: userName,
+			Timezone: loc.String(),
+			Hours:    make(map[string]float64),
+		},
+		loc:    loc,
+		daily:  make(map[string]*ActivityPeriodSummary),
+		weekly: make(map[string]*ActivityPeriodSummary),
+	}
+}
+
+// add records hours in a category for the given local day
+func (b *activitySummaryBuilder) add(day time.Time, category string, hours float64) {
+	b.summary.Hours[category] += hours
+	b.summary.TotalHours += hours
+
+	dayKey := day.Format("2006-01-02")
+	daily, ok := b.daily[dayKey]
+	if !ok {
+		daily = &ActivityPeriodSummary{Period: dayKey, Start: dayKey, Hours: make(map[string]float64)}
+		b.daily[dayKey] = daily
+	}
+	daily.Hours[category] += hours
+	daily.TotalHours += hours
+
+	year, week := day.ISOWeek()
+	weekKey := fmt.Sprintf("%d-W%02d", year, week)
+	weekly, ok := b.weekly[weekKey]
+	if !ok {
+		// ISO weeks start on Monday
+		offset := (int(day.Weekday()) + 6) % 7
+		weekStart := day.AddDate(0, 0, -offset).Format("2006-01-02")
+		weekly = &ActivityPeriodSummary{Period: weekKey, Start: weekStart, Hours: make(map[string]float64)}
+		b.weekly[weekKey] = weekly
+	}
+	weekly.Hours[category] += hours
+	weekly.TotalHours += hours
+}
+
+// build returns the summary with sorted, rounded breakdowns
+func (b *activitySummaryBuilder) build() ActivitySummary {
+	summary := b.summary
+	summary.TotalHours = roundHours(summary.TotalHours)
+	for category, hours := range summary.Hours {
+		summary.Hours[category] = roundHours(hours)
+	}
+	summary.Daily = sortedPeriodSummaries(b.daily)
+	summary.Weekly = sortedPeriodSummaries(b.weekly)
+	return summary
+}
+
+func sortedPeriodSummaries(periods map[string]*ActivityPeriodSummary) []ActivityPeriodSummary {
+	result := make([]ActivityPeriodSummary, 0, len(periods))
+	for _, period := range periods {
+		period.TotalHours = roundHours(period.TotalHours)
+		for category, hours := range period.Hours {
+			period.Hours[category] = roundHours(hours)
+		}
+		result = append(result, *period)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Start < result[j].Start
+	})
+	return result
 }
 
 // applyFilters applies the given filters to the query
@@ -260,14 +517,6 @@ func (s *UserActivityService) CreateUserActivity(
 	// Get current time for FromDateTime
 	now := time.Now()
 
-	// If closePreviousActivity is true, close the user's most recent open activity
-	if closePreviousActivity {
-		err := s.closeUserPreviousActivity(user.ID, now)
-		if err != nil {
-			return nil, fmt.Errorf("failed to close previous activity: %w", err)
-		}
-	}
-
 	// Create the new activity record
 	activity := &database.UserActivityHistory{
 		ID:           uuid.New(),
@@ -299,40 +548,190 @@ func (s *UserActivityService) CreateUserActivity(
 		}
 	}
 
-	// Save to database
-	if err := s.db.Create(activity).Error; err != nil {
-		return nil, fmt.Errorf("failed to create user activity: %w", err)
+	// Close the previous activity and open the new one under the user's lock,
+	// so that two taps at once cannot both close the same activity and leave
+	// two open
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockUserActivities(tx, user.ID); err != nil {
+			return err
+		}
+		// If closePreviousActivity is true, close the user's most recent open activity
+		if closePreviousActivity {
+			if err := closeOpenActivity(tx, user.ID, now); err != nil {
+				return fmt.Errorf("failed to close previous activity: %w", err)
+			}
+		}
+		if err := tx.Create(activity).Error; err != nil {
+			return fmt.Errorf("failed to create user activity: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
+	s.events.Publish(EventUserActivityRecorded, UserActivityRecorded{
+		ActivityID: activity.ID,
+		UserID:     user.ID,
+		Username:   user.Username,
+		Action:     action.Name,
+		Status:     status.Name,
+		StatusType: status.Type,
+		LocationID: activity.LocationID,
+		OccurredAt: now,
+		Details:    details,
+	})
 	return activity, nil
 }
 
+// CloseOpenActivity closes the user's most recent open activity, if any
+func (s *UserActivityService) CloseOpenActivity(userID uuid.UUID, closeTime time.Time) error {
+	return closeOpenActivity(s.db, userID, closeTime)
+}
+
 // closeUserPreviousActivity closes the user's most recent open activity
 // by setting its ToDateTime to the provided closeTime
 func (s *UserActivityService) closeUserPreviousActivity(userID uuid.UUID, closeTime time.Time) error {
-	// Find the most recent open activity for this user
-	var previousActivity database.UserActivityHistory
-	err := s.db.Where("user_id = ? AND to_datetime IS NULL", userID).
-		Order("from_datetime DESC").
-		First(&previousActivity).Error
+	return closeOpenActivity(s.db, userID, closeTime)
+}
+
+// closeOpenActivity closes the user's most recent open activity through db,
+// which may be a transaction. It holds the user's activity lock while doing so.
+func closeOpenActivity(db *gorm.DB, userID uuid.UUID, closeTime time.Time) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := lockUserActivities(tx, userID); err != nil {
+			return err
+		}
+
+		// Find the most recent open activity for this user
+		var previousActivity database.UserActivityHistory
+		err := tx.Where("user_id = ? AND to_datetime IS NULL", userID).
+			Order("from_datetime DESC").
+			First(&previousActivity).Error
 
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				// No open activity found, which is fine
+				return nil
+			}
+			return fmt.Errorf("failed to find previous activity: %w", err)
+		}
+
+		// Close the previous activity; from_datetime keeps the update to its partition
+		err = tx.Model(&database.UserActivityHistory{}).
+			Where("id = ? AND from_datetime = ?", previousActivity.ID, previousActivity.FromDateTime).
+			Updates(map[string]interface{}{"to_datetime": closeTime, "updated_at": closeTime}).Error
+		if err != nil {
+			return fmt.Errorf("failed to close previous activity: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// lockUserActivities locks the user's row (SELECT ... FOR UPDATE) until tx
+// ends. Everything that closes or opens a user's activities takes this lock
+// first, which serializes them per user: locking the open activities alone
+// would not, as there may be none to lock.
+func lockUserActivities(tx *gorm.DB, userID uuid.UUID) error {
+	var user database.User
+	err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id").Where("id = ?", userID).Take(&user).Error
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			// No open activity found, which is fine
+		return fmt.Errorf("failed to lock user activities: %w", err)
+	}
+	return nil
+}
+
+// OpenActivityRepair is what RepairOpenActivities did, or would do, for a user
+// with more than one open activity
+type OpenActivityRepair struct {
+	UserID    uuid.UUID   `json:"user_id"`
+	KeptID    uuid.UUID   `json:"kept_id" doc:"The activity left open"`
+	ClosedIDs []uuid.UUID `json:"closed_ids" doc:"Activities closed when the next open activity started"`
+	MergedIDs []uuid.UUID `json:"merged_ids" doc:"Repeats of the open activity before them, deleted"`
+}
+
+// RepairOpenActivities finds users left with more than one open activity and
+// leaves each with only its latest. Going through a user's open activities
+// oldest first, one that repeats the activity before it (same action, status
+// and location, e.g. a double tap) is merged into it by deleting the repeat;
+// any other is closed when the next one started, as it would have been had
+// the two not raced. With dryRun nothing is changed.
+func (s *UserActivityService) RepairOpenActivities(dryRun bool) ([]OpenActivityRepair, error) {
+	var userIDs []uuid.UUID
+	err := s.db.Model(&database.UserActivityHistory{}).
+		Where("to_datetime IS NULL").
+		Group("user_id").
+		Having("COUNT(*) > 1").
+		Pluck("user_id", &userIDs).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find duplicate open activities: %w", err)
+	}
+
+	repairs := []OpenActivityRepair{}
+	for _, userID := range userIDs {
+		var repair *OpenActivityRepair
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			if err := lockUserActivities(tx, userID); err != nil {
+				return err
+			}
+			var open []database.UserActivityHistory
+			err := tx.Where("user_id = ? AND to_datetime IS NULL", userID).
+				Order("from_datetime, created_at, id").
+				Find(&open).Error
+			if err != nil {
+				return fmt.Errorf("failed to load open activities: %w", err)
+			}
+			if len(open) < 2 {
+				return nil // Repaired since it was found
+			}
+
+			repair = &OpenActivityRepair{UserID: userID, ClosedIDs: []uuid.UUID{}, MergedIDs: []uuid.UUID{}}
+			kept := open[0]
+			for _, next := range open[1:] {
+				if sameOpenActivity(kept, next) {
+					repair.MergedIDs = append(repair.MergedIDs, next.ID)
+					if !dryRun {
+						if err := tx.Delete(&database.UserActivityHistory{}, "id = ? AND from_datetime = ?", next.ID, next.FromDateTime).Error; err != nil {
+							return fmt.Errorf("failed to merge activity %s: %w", next.ID, err)
+						}
+					}
+					continue
+				}
+				repair.ClosedIDs = append(repair.ClosedIDs, kept.ID)
+				if !dryRun {
+					err := tx.Model(&database.UserActivityHistory{}).Where("id = ? AND from_datetime = ?", kept.ID, kept.FromDateTime).
+						Updates(map[string]interface{}{"to_datetime": next.FromDateTime, "updated_at": time.Now()}).Error
+					if err != nil {
+						return fmt.Errorf("failed to close activity %s: %w", kept.ID, err)
+					}
+				}
+				kept = next
+			}
+			repair.KeptID = kept.ID
 			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if repair != nil {
+			repairs = append(repairs, *repair)
 		}
-		return fmt.Errorf("failed to find previous activity: %w", err)
 	}
+	return repairs, nil
+}
 
-	// Close the previous activity
-	previousActivity.ToDateTime = &closeTime
-	previousActivity.UpdatedAt = closeTime
+// sameOpenActivity reports whether b repeats the activity a
+func sameOpenActivity(a, b database.UserActivityHistory) bool {
+	return a.ActionID == b.ActionID && equalUUIDPtr(a.StatusID, b.StatusID) && equalUUIDPtr(a.LocationID, b.LocationID)
+}
 
-	if err := s.db.Save(&previousActivity).Error; err != nil {
-		return fmt.Errorf("failed to close previous activity: %w", err)
+func equalUUIDPtr(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
 	}
-
-	return nil
+	return *a == *b
 }
 
 // CloseUserActivity closes a specific user activity by setting its ToDateTime
@@ -352,10 +751,10 @@ func (s *UserActivityService) CloseUserActivity(activityID uuid.UUID, closeTime
 	}
 
 	// Close the activity
-	activity.ToDateTime = &closeTime
-	activity.UpdatedAt = closeTime
-
-	if err := s.db.Save(&activity).Error; err != nil {
+	err = s.db.Model(&database.UserActivityHistory{}).
+		Where("id = ? AND from_datetime = ?", activity.ID, activity.FromDateTime).
+		Updates(map[string]interface{}{"to_datetime": closeTime, "updated_at": closeTime}).Error
+	if err != nil {
 		return fmt.Errorf("failed to close activity: %w", err)
 	}
 
@@ -383,6 +782,7 @@ func (s *UserActivityService) GetActivityByID(id uuid.UUID) (*database.UserActiv
 		}
 		return nil, fmt.Errorf("failed to get activity: %w", err)
 	}
+	localizeActivity(&activity)
 
 	return &activity, nil
 } 
\ No newline at end of file
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+	"gorm.io/gorm"
+)
+
+// Custom user attribute types
+const (
+	UserAttributeString  = "string"
+	UserAttributeNumber  = "number"
+	UserAttributeBoolean = "boolean"
+	UserAttributeDate    = "date" // Stored as "2006-01-02"
+	UserAttributeUser    = "user" // Stored as the user's ID
+)
+
+// UserAttributeSchema checks users' custom attributes against the ones
+// declared in users.attributes
+type UserAttributeSchema struct {
+	attributes []config.UserAttributeConfig
+	byName     map[string]config.UserAttributeConfig
+}
+
+// NewUserAttributeSchema creates the schema of the declared attributes
+func NewUserAttributeSchema(attributes []config.UserAttributeConfig) *UserAttributeSchema {
+	schema := &UserAttributeSchema{attributes: attributes, byName: map[string]config.UserAttributeConfig{}}
+	for _, attribute := range attributes {
+		schema.byName[attribute.Name] = attribute
+	}
+	return schema
+}
+
+// Attributes returns the declared attributes in the order they are configured
+func (s *UserAttributeSchema) Attributes() []config.UserAttributeConfig {
+	return s.attributes
+}
+
+// Apply merges changes into a user's current attributes and checks the result:
+// a nil value removes an attribute, any other replaces it. Values are stored in
+// their attribute's type; numbers and booleans may also be given as text, as
+// CLI flags are. Undeclared attributes, values of the wrong type or not in the
+// attribute's enum, unknown users and missing required attributes are
+// VALIDATION_FAILED.
+func (s *UserAttributeSchema) Apply(db *gorm.DB, current pgtype.JSONB, changes map[string]interface{}) (pgtype.JSONB, error) {
+	attributes := UserAttributes(current)
+	for name, value := range changes {
+		if value == nil {
+			delete(attributes, name)
+			continue
+		}
+		normalized, err := s.normalize(name, value)
+		if err != nil {
+			return pgtype.JSONB{}, err
+		}
+		attributes[name] = normalized
+	}
+
+	for _, attribute := range s.attributes {
+		value, ok := attributes[attribute.Name]
+		if !ok {
+			if attribute.Required {
+				return pgtype.JSONB{}, NewError(CodeValidationFailed, "attribute %s is required", attribute.Name)
+			}
+			continue
+		}
+		if _, changed := changes[attribute.Name]; changed && attribute.Type == UserAttributeUser {
+			var count int64
+			if err := db.Model(&database.User{}).Where("id = ?", value).Count(&count).Error; err != nil {
+				return pgtype.JSONB{}, fmt.Errorf("failed to check attribute %s: %w", attribute.Name, err)
+			}
+			if count == 0 {
+				return pgtype.JSONB{}, NewError(CodeValidationFailed, "attribute %s: user %s not found", attribute.Name, value)
+			}
+		}
+	}
+
+	var stored pgtype.JSONB
+	if err := stored.Set(attributes); err != nil {
+		return pgtype.JSONB{}, fmt.Errorf("failed to convert attributes to JSONB: %w", err)
+	}
+	return stored, nil
+}
+
+// normalize checks a value of the named attribute, returning it as stored
+func (s *UserAttributeSchema) normalize(name string, value interface{}) (interface{}, error) {
+	attribute, ok := s.byName[name]
+	if !ok {
+		return nil, NewError(CodeValidationFailed, "unknown attribute %s", name)
+	}
+	text, isText := value.(string)
+
+	switch attribute.Type {
+	case UserAttributeNumber:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case string:
+			if n, err := strconv.ParseFloat(v, 64); err == nil {
+				return n, nil
+			}
+		}
+		return nil, NewError(CodeValidationFailed, "attribute %s must be a number", name)
+	case UserAttributeBoolean:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b, nil
+			}
+		}
+		return nil, NewError(CodeValidationFailed, "attribute %s must be true or false", name)
+	case UserAttributeDate:
+		if _, err := time.Parse("2006-01-02", text); !isText || err != nil {
+			return nil, NewError(CodeValidationFailed, "attribute %s must be a date in YYYY-MM-DD format", name)
+		}
+		return text, nil
+	case UserAttributeUser:
+		id, err := uuid.Parse(text)
+		if !isText || err != nil {
+			return nil, NewError(CodeValidationFailed, "attribute %s must be a user ID", name)
+		}
+		return id.String(), nil
+	}
+
+	if !isText {
+		return nil, NewError(CodeValidationFailed, "attribute %s must be a string", name)
+	}
+	if len(attribute.Enum) > 0 && !slices.Contains(attribute.Enum, text) {
+		return nil, NewError(CodeValidationFailed, "attribute %s must be one of %v", name, attribute.Enum)
+	}
+	return text, nil
+}
+
+// Filter turns ?attr.<name>=<value> list filters into the JSON object that
+// matching users' attributes contain (attributes @> filter)
+func (s *UserAttributeSchema) Filter(values map[string]string) (string, error) {
+	filter := map[string]interface{}{}
+	for name, text := range values {
+		value, err := s.normalize(name, text)
+		if err != nil {
+			return "", err
+		}
+		filter[name] = value
+	}
+	data, err := json.Marshal(filter)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode attribute filter: %w", err)
+	}
+	return string(data), nil
+}
+
+// UserAttributes returns a user's custom attributes, empty when there are none
+func UserAttributes(attributes pgtype.JSONB) map[string]interface{} {
+	values := map[string]interface{}{}
+	if attributes.Status == pgtype.Present {
+		if err := json.Unmarshal(attributes.Bytes, &values); err != nil || values == nil {
+			return map[string]interface{}{}
+		}
+	}
+	return values
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// userGrantsQuery loads a user with every role, permission and permission
+// resource they hold in one round trip, instead of the four queries
+// Preload("Roles.Permissions.Resource") issues. Each row is one role and
+// permission pair; roles without permissions, and users without roles, come
+// back with NULLs from the outer joins.
+const userGrantsQuery = `
+	SELECT
+		u.id, u.created_at, u.updated_at, u.email, u.username, u.password,
+		COALESCE(u.first_name, ''), COALESCE(u.last_name, ''), COALESCE(u.active, false),
+		u.state, u.state_changed_at, COALESCE(u.unix_username, ''), u.locale, u.timezone,
+		u.password_changed_at, u.failed_password_attempts, u.locked_until,
+		r.id, r.created_at, r.updated_at, COALESCE(r.name, ''), COALESCE(r.description, ''), COALESCE(r.active, false),
+		p.id, p.created_at, p.updated_at, COALESCE(p.action, ''), COALESCE(p.effect, ''),
+		res.id, res.created_at, res.updated_at, COALESCE(res.name, ''), COALESCE(res.type, ''),
+		COALESCE(res.location, ''), COALESCE(res.department, ''), COALESCE(res.active, false),
+		COALESCE(res.allowed_networks, '[]'::jsonb)
+	FROM users u
+	LEFT JOIN user_roles ur ON ur.user_id = u.id
+	LEFT JOIN roles r ON r.id = ur.role_id
+	LEFT JOIN role_permissions rp ON rp.role_id = r.id
+	LEFT JOIN permissions p ON p.id = rp.permission_id
+	LEFT JOIN resources res ON res.id = p.resource_id
+	WHERE u.id = ? AND u.deleted_at IS NULL
+	ORDER BY r.name, r.id`
+
+// loadUserGrants returns the user with Roles.Permissions.Resource populated,
+// like Preload("Roles.Permissions.Resource") would, or gorm.ErrRecordNotFound
+func loadUserGrants(ctx context.Context, db *gorm.DB, userID uuid.UUID) (*database.User, error) {
+	rows, err := db.WithContext(ctx).Raw(userGrantsQuery, userID).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var user *database.User
+	roleIndex := map[uuid.UUID]int{}
+	for rows.Next() {
+		var u database.User
+		var role database.Role
+		var permission database.Permission
+		var resource database.Resource
+		var roleID, permissionID, resourceID uuid.NullUUID
+		var roleCreated, roleUpdated, permissionCreated, permissionUpdated, resourceCreated, resourceUpdated *time.Time
+
+		if err := rows.Scan(
+			&u.ID, &u.CreatedAt, &u.UpdatedAt, &u.Email, &u.Username, &u.Password,
+			&u.FirstName, &u.LastName, &u.Active,
+			&u.State, &u.StateChangedAt, &u.UnixUsername, &u.Locale, &u.Timezone,
+			&u.PasswordChangedAt, &u.FailedPasswordAttempts, &u.LockedUntil,
+			&roleID, &roleCreated, &roleUpdated, &role.Name, &role.Description, &role.Active,
+			&permissionID, &permissionCreated, &permissionUpdated, &permission.Action, &permission.Effect,
+			&resourceID, &resourceCreated, &resourceUpdated, &resource.Name, &resource.Type,
+			&resource.Location, &resource.Department, &resource.Active,
+			&resource.AllowedNetworks,
+		); err != nil {
+			return nil, err
+		}
+
+		if user == nil {
+			u.Roles = []database.Role{}
+			user = &u
+		}
+		if !roleID.Valid {
+			continue
+		}
+
+		i, ok := roleIndex[roleID.UUID]
+		if !ok {
+			role.ID = roleID.UUID
+			role.CreatedAt, role.UpdatedAt = derefTime(roleCreated), derefTime(roleUpdated)
+			role.Permissions = []database.Permission{}
+			user.Roles = append(user.Roles, role)
+			i = len(user.Roles) - 1
+			roleIndex[roleID.UUID] = i
+		}
+		if !permissionID.Valid {
+			continue
+		}
+
+		permission.ID = permissionID.UUID
+		permission.CreatedAt, permission.UpdatedAt = derefTime(permissionCreated), derefTime(permissionUpdated)
+		if resourceID.Valid {
+			resource.ID = resourceID.UUID
+			resource.CreatedAt, resource.UpdatedAt = derefTime(resourceCreated), derefTime(resourceUpdated)
+			permission.ResourceID = resource.ID
+			permission.Resource = resource
+		}
+		user.Roles[i].Permissions = append(user.Roles[i].Permissions, permission)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return user, nil
+}
+
+// derefTime returns *t, or the zero time for a NULL column
+func derefTime(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
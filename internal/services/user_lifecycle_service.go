@@ -0,0 +1,297 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// User lifecycle states
+const (
+	UserStateInvited    = "invited"
+	UserStateActive     = "active"
+	UserStateSuspended  = "suspended"
+	UserStateLeave      = "leave"
+	UserStateOffboarded = "offboarded"
+)
+
+// UserStateTransitions lists the states each lifecycle state may move to
+var UserStateTransitions = map[string][]string{
+	UserStateInvited:    {UserStateActive, UserStateOffboarded},
+	UserStateActive:     {UserStateSuspended, UserStateLeave, UserStateOffboarded},
+	UserStateSuspended:  {UserStateActive, UserStateOffboarded},
+	UserStateLeave:      {UserStateActive, UserStateSuspended, UserStateOffboarded},
+	UserStateOffboarded: {UserStateInvited},
+}
+
+// UserStateAllowsAuthentication reports whether users in a state may authenticate.
+// An empty state predates lifecycle states and counts as active.
+func UserStateAllowsAuthentication(state string) bool {
+	return state == UserStateActive || state == ""
+}
+
+// UserLifecycleService moves users between lifecycle states, immediately or on an effective date
+type UserLifecycleService struct {
+	db       *gorm.DB
+	events   *PermissionEvents
+	sessions *SessionService // Invalidates the sessions of users who may no longer authenticate
+	stop     chan struct{}
+}
+
+func NewUserLifecycleService(db *gorm.DB, events *PermissionEvents, sessions *SessionService) *UserLifecycleService {
+	return &UserLifecycleService{
+		db:       db,
+		events:   events,
+		sessions: sessions,
+	}
+}
+
+// TransitionUser requests a state change for a user. Without an effective date, or
+// with one that has passed, it is applied at once; otherwise it stays pending until
+// ApplyDueTransitions runs after that date. The change must be allowed from the state
+// the user will be in at the effective date, taking earlier pending transitions into account.
+func (s *UserLifecycleService) TransitionUser(userID uuid.UUID, toState, reason string, effectiveAt *time.Time, requestedByID *uuid.UUID) (*database.UserStateTransition, error) {
+	if _, ok := UserStateTransitions[toState]; !ok {
+		return nil, fmt.Errorf("invalid state '%s'. Must be one of: %v", toState, UserStates())
+	}
+	if reason == "" {
+		return nil, fmt.Errorf("reason is required")
+	}
+
+	var user database.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+
+	now := time.Now()
+	effective := now
+	if effectiveAt != nil && effectiveAt.After(now) {
+		effective = *effectiveAt
+	}
+
+	fromState, err := s.projectedState(&user, effective)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateUserStateTransition(fromState, toState); err != nil {
+		return nil, err
+	}
+
+	transition := database.UserStateTransition{
+		ID:            uuid.New(),
+		UserID:        userID,
+		FromState:     fromState,
+		ToState:       toState,
+		Reason:        reason,
+		EffectiveAt:   effective,
+		Status:        "pending",
+		RequestedByID: requestedByID,
+	}
+	if err := s.db.Create(&transition).Error; err != nil {
+		return nil, fmt.Errorf("failed to create state transition: %w", err)
+	}
+
+	if !effective.After(now) {
+		if err := s.apply(&transition, now); err != nil {
+			return nil, err
+		}
+	}
+	return &transition, nil
+}
+
+// CancelTransition cancels a pending transition
+func (s *UserLifecycleService) CancelTransition(transitionID uuid.UUID, note string) (*database.UserStateTransition, error) {
+	var transition database.UserStateTransition
+	if err := s.db.Where("id = ?", transitionID).First(&transition).Error; err != nil {
+		return nil, fmt.Errorf("state transition not found: %w", err)
+	}
+	if transition.Status != "pending" {
+		return nil, fmt.Errorf("state transition is already %s", transition.Status)
+	}
+
+	if err := s.db.Model(&transition).Updates(map[string]interface{}{
+		"status": "cancelled",
+		"note":   note,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to cancel state transition: %w", err)
+	}
+	transition.Status = "cancelled"
+	transition.Note = note
+	return &transition, nil
+}
+
+// ListTransitions retrieves a user's state transitions, most recent effective date first
+func (s *UserLifecycleService) ListTransitions(userID uuid.UUID) ([]database.UserStateTransition, error) {
+	var transitions []database.UserStateTransition
+	if err := s.db.Preload("RequestedBy").Where("user_id = ?", userID).
+		Order("effective_at DESC, created_at DESC").Find(&transitions).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch state transitions: %w", err)
+	}
+	return transitions, nil
+}
+
+// ApplyDueTransitions applies pending transitions whose effective date has passed,
+// oldest first. A transition no longer allowed from the user's current state is
+// cancelled with a note instead.
+func (s *UserLifecycleService) ApplyDueTransitions(now time.Time) (int, error) {
+	var transitions []database.UserStateTransition
+	if err := s.db.Where("status = ? AND effective_at <= ?", "pending", now).
+		Order("effective_at, created_at").Find(&transitions).Error; err != nil {
+		return 0, fmt.Errorf("failed to fetch due state transitions: %w", err)
+	}
+
+	applied := 0
+	for i := range transitions {
+		if err := s.apply(&transitions[i], now); err != nil {
+			log.Printf("Failed to apply state transition %s: %v", transitions[i].ID, err)
+			continue
+		}
+		if transitions[i].Status == "applied" {
+			applied++
+		}
+	}
+	return applied, nil
+}
+
+// StartScheduler periodically applies due transitions. It does nothing when interval is zero.
+func (s *UserLifecycleService) StartScheduler(interval time.Duration) {
+	if interval <= 0 || s.stop != nil {
+		return
+	}
+
+	s.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := s.ApplyDueTransitions(time.Now()); err != nil {
+					log.Printf("Applying user state transitions failed: %v", err)
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopScheduler stops the background transition scheduler
+func (s *UserLifecycleService) StopScheduler() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// UserStates returns the lifecycle states in a stable order
+func UserStates() []string {
+	states := make([]string, 0, len(UserStateTransitions))
+	for state := range UserStateTransitions {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+	return states
+}
+
+// apply moves the user into the transition's state and marks it applied. The
+// active flag follows the state so existing active checks keep working.
+func (s *UserLifecycleService) apply(transition *database.UserStateTransition, now time.Time) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var user database.User
+		if err := tx.Where("id = ?", transition.UserID).First(&user).Error; err != nil {
+			return fmt.Errorf("user not found: %w", err)
+		}
+
+		current := userState(&user)
+		if err := validateUserStateTransition(current, transition.ToState); err != nil {
+			transition.Status = "cancelled"
+			transition.Note = err.Error()
+			return tx.Model(transition).Updates(map[string]interface{}{
+				"status": transition.Status,
+				"note":   transition.Note,
+			}).Error
+		}
+
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"state":            transition.ToState,
+			"state_changed_at": now,
+			"active":           transition.ToState == UserStateActive,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to update user state: %w", err)
+		}
+
+		transition.FromState = current
+		transition.Status = "applied"
+		transition.AppliedAt = &now
+		if err := tx.Model(transition).Updates(map[string]interface{}{
+			"from_state": transition.FromState,
+			"status":     transition.Status,
+			"applied_at": transition.AppliedAt,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to update state transition: %w", err)
+		}
+		return nil
+	})
+	if err != nil || transition.Status != "applied" {
+		return err
+	}
+
+	s.events.Publish(PermissionInvalidation{
+		Reason:  "user_state_changed",
+		UserIDs: []uuid.UUID{transition.UserID},
+	})
+
+	if s.sessions != nil && !UserStateAllowsAuthentication(transition.ToState) {
+		revoked, err := s.sessions.InvalidateUserSessions(context.Background(), transition.UserID)
+		if err != nil {
+			log.Printf("Failed to invalidate sessions of user %s on becoming %s: %v", transition.UserID, transition.ToState, err)
+		} else if revoked > 0 {
+			log.Printf("Invalidated %d sessions of user %s on becoming %s", revoked, transition.UserID, transition.ToState)
+		}
+	}
+	return nil
+}
+
+// projectedState returns the state a user will be in at the given time once the
+// pending transitions due by then have been applied
+func (s *UserLifecycleService) projectedState(user *database.User, at time.Time) (string, error) {
+	var pending []database.UserStateTransition
+	if err := s.db.Where("user_id = ? AND status = ? AND effective_at <= ?", user.ID, "pending", at).
+		Order("effective_at, created_at").Find(&pending).Error; err != nil {
+		return "", fmt.Errorf("failed to fetch pending state transitions: %w", err)
+	}
+
+	state := userState(user)
+	for _, transition := range pending {
+		state = transition.ToState
+	}
+	return state, nil
+}
+
+// userState returns a user's lifecycle state, treating rows from before lifecycle states as active
+func userState(user *database.User) string {
+	if user.State == "" {
+		return UserStateActive
+	}
+	return user.State
+}
+
+// validateUserStateTransition checks that from may move to to
+func validateUserStateTransition(from, to string) error {
+	if from == to {
+		return fmt.Errorf("user is already %s", to)
+	}
+	for _, allowed := range UserStateTransitions[from] {
+		if allowed == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot move a user from %s to %s; allowed: %v", from, to, UserStateTransitions[from])
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CheckManager checks managerID may become userID's manager: it must be
+// another existing user, and not one of userID's own reports, direct or
+// indirect, as that would make the chain a loop. Either is VALIDATION_FAILED.
+func CheckManager(db *gorm.DB, userID, managerID uuid.UUID) error {
+	if managerID == userID {
+		return NewError(CodeValidationFailed, "a user cannot be their own manager")
+	}
+
+	// Walk up from the new manager; deleted users keep their place in the chain
+	next := &managerID
+	seen := map[uuid.UUID]bool{}
+	for next != nil && !seen[*next] {
+		seen[*next] = true
+		var manager database.User
+		err := db.Unscoped().Select("id", "manager_id").Where("id = ?", *next).Take(&manager).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) && *next == managerID {
+			return NewError(CodeValidationFailed, "manager %s not found", managerID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to check manager: %w", err)
+		}
+		if manager.ManagerID != nil && *manager.ManagerID == userID {
+			return NewError(CodeValidationFailed, "user %s reports to user %s, so cannot be their manager", managerID, userID)
+		}
+		next = manager.ManagerID
+	}
+	return nil
+}
+
+// DirectReports returns the users whose manager is userID
+func (s *UserService) DirectReports(userID uuid.UUID) ([]database.User, error) {
+	if _, err := s.GetUserByID(userID); err != nil {
+		return nil, err
+	}
+
+	var reports []database.User
+	if err := database.ReadReplica(s.db).Where("manager_id = ?", userID).Order("username").Find(&reports).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch reports: %w", err)
+	}
+	return reports, nil
+}
+
+// ManagersChain returns userID's manager, their manager and so on up to a user
+// with no manager. A deleted manager ends the chain.
+func (s *UserService) ManagersChain(userID uuid.UUID) ([]database.User, error) {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var chain []database.User
+	seen := map[uuid.UUID]bool{user.ID: true}
+	for next := user.ManagerID; next != nil && !seen[*next]; {
+		seen[*next] = true
+		var manager database.User
+		err := database.ReadReplica(s.db).Where("id = ?", *next).Take(&manager).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch managers: %w", err)
+		}
+		chain = append(chain, manager)
+		next = manager.ManagerID
+	}
+	return chain, nil
+}
+
+// DirectReport returns userID if managerID is their manager, for managers
+// reading their reports' activity and performing actions on their behalf.
+// Anyone else is PERMISSION_DENIED.
+func (s *AuthService) DirectReport(managerID, userID uuid.UUID) (*database.User, error) {
+	var user database.User
+	err := s.db.Where("id = ? AND manager_id = ?", userID, managerID).Take(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, NewError(CodePermissionDenied, "user %s is not a direct report", userID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to check manager: %w", err)
+	}
+	return &user, nil
+}
@@ -1,43 +1,98 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/YubiApp/internal/database"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/jackc/pgtype"
 	"gorm.io/gorm"
 )
 
 type UserService struct {
-	db *gorm.DB
+	db         *gorm.DB
+	events     *PermissionEvents
+	passwords  *PasswordService
+	attributes *UserAttributeSchema
 }
 
-func NewUserService(db *gorm.DB) *UserService {
-	return &UserService{db: db}
+func NewUserService(db *gorm.DB, events *PermissionEvents, passwords *PasswordService, attributes *UserAttributeSchema) *UserService {
+	return &UserService{db: db, events: events, passwords: passwords, attributes: attributes}
 }
 
-// CreateUser creates a new user
-func (s *UserService) CreateUser(email, username, password, firstName, lastName string, active bool) (*database.User, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// UserListFilter selects the users ListUsersFiltered returns
+type UserListFilter struct {
+	ActiveOnly     bool
+	IncludeDeleted bool              // Includes soft-deleted users
+	Attributes     map[string]string // Custom attribute values users must have, e.g. department: Engineering
+}
+
+// AttributeSchema returns the custom user attributes users are checked against
+func (s *UserService) AttributeSchema() *UserAttributeSchema {
+	return s.attributes
+}
+
+// CreateUser creates a new user with its custom attributes (see
+// UserAttributeSchema.Apply), their manager when managerID is set and their
+// preferred locale and timezone, which may be empty
+func (s *UserService) CreateUser(email, username, password, firstName, lastName string, active bool, attributes map[string]interface{}, managerID *uuid.UUID, locale, timezone string) (*database.User, error) {
+	locale, err := CheckLocale(locale)
 	if err != nil {
-		return nil, fmt.Errorf("failed to hash password: %w", err)
+		return nil, err
+	}
+	if err := CheckTimezone(timezone); err != nil {
+		return nil, err
+	}
+	storedAttributes, err := s.attributes.Apply(s.db, pgtype.JSONB{}, attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := s.passwords.HashPassword(password)
+	if err != nil {
+		return nil, err
 	}
 
 	user := database.User{
-		ID:        uuid.New(),
-		Email:     email,
-		Username:  username,
-		Password:  string(hashedPassword),
-		FirstName: firstName,
-		LastName:  lastName,
-		Active:    active,
+		ID:         uuid.New(),
+		Email:      email,
+		Username:   username,
+		Password:   hashedPassword,
+		FirstName:  firstName,
+		LastName:   lastName,
+		Active:     active,
+		State:      UserStateActive,
+		Attributes: storedAttributes,
+		ManagerID:  managerID,
+		Locale:     locale,
+		Timezone:   timezone,
+	}
+	// Users created inactive have not been activated yet
+	if !active {
+		user.State = UserStateInvited
+	}
+	if managerID != nil {
+		if err := CheckManager(s.db, user.ID, *managerID); err != nil {
+			return nil, err
+		}
 	}
 
 	if err := s.db.Create(&user).Error; err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
+	// Create skips zero values for columns with defaults, so an inactive user needs an explicit update
+	if !active {
+		if err := s.db.Model(&user).Update("active", false).Error; err != nil {
+			return nil, fmt.Errorf("failed to create user: %w", err)
+		}
+	}
+
+	if err := s.passwords.RecordNewPassword(user.ID, hashedPassword); err != nil {
+		return nil, err
+	}
+
 	return &user, nil
 }
 
@@ -45,7 +100,22 @@ func (s *UserService) CreateUser(email, username, password, firstName, lastName
 func (s *UserService) GetUserByID(userID uuid.UUID) (*database.User, error) {
 	var user database.User
 	if err := s.db.Preload("Roles").Where("id = ?", userID).First(&user).Error; err != nil {
-		return nil, fmt.Errorf("user not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "user not found")
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return &user, nil
+}
+
+// GetUserByUsername retrieves a user by username
+func (s *UserService) GetUserByUsername(username string) (*database.User, error) {
+	var user database.User
+	if err := s.db.Preload("Roles").Where("username = ?", username).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "user not found")
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 	return &user, nil
 }
@@ -54,7 +124,10 @@ func (s *UserService) GetUserByID(userID uuid.UUID) (*database.User, error) {
 func (s *UserService) GetUserByEmail(email string) (*database.User, error) {
 	var user database.User
 	if err := s.db.Preload("Roles").Where("email = ?", email).First(&user).Error; err != nil {
-		return nil, fmt.Errorf("user not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "user not found")
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 	return &user, nil
 }
@@ -62,73 +135,188 @@ func (s *UserService) GetUserByEmail(email string) (*database.User, error) {
 // ListUsers retrieves all users
 func (s *UserService) ListUsers() ([]database.User, error) {
 	var users []database.User
-	if err := s.db.Preload("Roles").Find(&users).Error; err != nil {
+	if err := database.ReadReplica(s.db).Preload("Roles").Find(&users).Error; err != nil {
 		return nil, fmt.Errorf("failed to fetch users: %w", err)
 	}
 	return users, nil
 }
 
-// ListActiveUsers retrieves only active users
-func (s *UserService) ListActiveUsers() ([]database.User, error) {
+// ListUsersFiltered retrieves the users matching filter. Filtering on an
+// undeclared attribute, or with a value its type cannot hold, is VALIDATION_FAILED.
+func (s *UserService) ListUsersFiltered(filter UserListFilter) ([]database.User, error) {
+	query := database.ReadReplica(s.db).Preload("Roles")
+	if filter.IncludeDeleted {
+		query = query.Unscoped()
+	} else if filter.ActiveOnly {
+		query = query.Where("active = ?", true)
+	}
+	if len(filter.Attributes) > 0 {
+		contains, err := s.attributes.Filter(filter.Attributes)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("attributes @> ?::jsonb", contains)
+	}
+
 	var users []database.User
-	if err := s.db.Preload("Roles").Where("active = ?", true).Find(&users).Error; err != nil {
-		return nil, fmt.Errorf("failed to fetch active users: %w", err)
+	if err := query.Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch users: %w", err)
 	}
 	return users, nil
 }
 
-// UpdateUser updates a user
-func (s *UserService) UpdateUser(userID uuid.UUID, updates map[string]interface{}) (*database.User, error) {
+// UpdateUser updates a user. A non-nil version must match the user's current
+// version (see checkVersion). An "attributes" update is a map of custom
+// attribute changes, merged into the user's attributes by UserAttributeSchema.Apply.
+// A "manager_id" update is a *uuid.UUID, nil to remove the user's manager, and
+// "locale" and "timezone" updates a language tag and an IANA zone name, empty
+// to clear them.
+func (s *UserService) UpdateUser(userID uuid.UUID, version *int, updates map[string]interface{}) (*database.User, error) {
 	var user database.User
 	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
-		return nil, fmt.Errorf("user not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "user not found")
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if err := checkVersion("user", user.Version, version); err != nil {
+		return nil, err
 	}
 
-	// Hash password if it's being updated
-	if password, ok := updates["password"].(string); ok && password != "" {
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if changes, ok := updates["attributes"].(map[string]interface{}); ok {
+		attributes, err := s.attributes.Apply(s.db, user.Attributes, changes)
 		if err != nil {
-			return nil, fmt.Errorf("failed to hash password: %w", err)
+			return nil, err
+		}
+		updates["attributes"] = attributes
+	}
+	if managerID, ok := updates["manager_id"].(*uuid.UUID); ok && managerID != nil {
+		if err := CheckManager(s.db, userID, *managerID); err != nil {
+			return nil, err
+		}
+	}
+	if locale, ok := updates["locale"].(string); ok {
+		canonical, err := CheckLocale(locale)
+		if err != nil {
+			return nil, err
+		}
+		updates["locale"] = canonical
+	}
+	if timezone, ok := updates["timezone"].(string); ok {
+		if err := CheckTimezone(timezone); err != nil {
+			return nil, err
 		}
-		updates["password"] = string(hashedPassword)
 	}
 
-	if err := s.db.Model(&user).Updates(updates).Error; err != nil {
+	// Password changes go through the password policy and history, and are
+	// written with the other updates so a version conflict rejects them too
+	var passwordHash string
+	if password, ok := updates["password"].(string); ok {
+		delete(updates, "password")
+		if password != "" {
+			passwordUpdates, hash, err := s.passwords.passwordUpdates(&user, password)
+			if err != nil {
+				return nil, err
+			}
+			for column, value := range passwordUpdates {
+				updates[column] = value
+			}
+			passwordHash = hash
+		}
+	}
+
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := updateVersioned(tx, "user", &user, user.Version, updates); err != nil {
+			return err
+		}
+		if passwordHash != "" {
+			return s.passwords.recordHistory(tx, user.ID, passwordHash)
+		}
+		return nil
+	}); err != nil {
 		return nil, fmt.Errorf("failed to update user: %w", err)
 	}
 
-	// Reload user with roles
-	if err := s.db.Preload("Roles").Where("id = ?", userID).First(&user).Error; err != nil {
+	// Deactivated users lose all access, reactivated users regain it
+	if _, ok := updates["active"]; ok {
+		s.events.Publish(PermissionInvalidation{
+			Reason:  "user_status_changed",
+			UserIDs: []uuid.UUID{user.ID},
+		})
+	}
+
+	// Reload user with roles, into a fresh user as NULLs would not clear fields already set
+	var updated database.User
+	if err := s.db.Preload("Roles").Where("id = ?", userID).First(&updated).Error; err != nil {
 		return nil, fmt.Errorf("failed to reload user: %w", err)
 	}
 
-	return &user, nil
+	return &updated, nil
 }
 
 // DeleteUser deletes a user
 func (s *UserService) DeleteUser(userID uuid.UUID) error {
 	var user database.User
 	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
-		return fmt.Errorf("user not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return NewError(CodeNotFound, "user not found")
+		}
+		return fmt.Errorf("failed to get user: %w", err)
 	}
 
 	if err := s.db.Delete(&user).Error; err != nil {
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
 
+	s.events.Publish(PermissionInvalidation{
+		Reason:  "user_deleted",
+		UserIDs: []uuid.UUID{user.ID},
+	})
+
 	return nil
 }
 
+// RestoreUser undoes a soft delete. The user's devices stay deleted and are restored separately.
+func (s *UserService) RestoreUser(userID uuid.UUID) (*database.User, error) {
+	var user database.User
+	if err := s.db.Unscoped().Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "user not found")
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if !user.DeletedAt.Valid {
+		return nil, NewError(CodeConflict, "user is not deleted")
+	}
+
+	if err := s.db.Unscoped().Model(&user).Update("deleted_at", nil).Error; err != nil {
+		return nil, fmt.Errorf("failed to restore user: %w", err)
+	}
+
+	s.events.Publish(PermissionInvalidation{
+		Reason:  "user_restored",
+		UserIDs: []uuid.UUID{user.ID},
+	})
+
+	return s.GetUserByID(userID)
+}
+
 // AssignUserToRole assigns a user to a role
 func (s *UserService) AssignUserToRole(userID, roleID uuid.UUID) error {
 	var user database.User
 	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
-		return fmt.Errorf("user not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return NewError(CodeNotFound, "user not found")
+		}
+		return fmt.Errorf("failed to get user: %w", err)
 	}
 
 	var role database.Role
 	if err := s.db.Where("id = ?", roleID).First(&role).Error; err != nil {
-		return fmt.Errorf("role not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return NewError(CodeNotFound, "role not found")
+		}
+		return fmt.Errorf("failed to get role: %w", err)
 	}
 
 	// Check if assignment already exists
@@ -137,13 +325,19 @@ func (s *UserService) AssignUserToRole(userID, roleID uuid.UUID) error {
 		Where("users.id = ? AND user_roles.role_id = ?", user.ID, role.ID).Count(&count)
 	
 	if count > 0 {
-		return fmt.Errorf("user is already assigned to role %s", role.Name)
+		return NewError(CodeConflict, "user is already assigned to role %s", role.Name)
 	}
 
 	if err := s.db.Model(&user).Association("Roles").Append(&role); err != nil {
 		return fmt.Errorf("failed to assign user to role: %w", err)
 	}
 
+	s.events.Publish(PermissionInvalidation{
+		Reason:  "user_role_assigned",
+		UserIDs: []uuid.UUID{user.ID},
+		RoleIDs: []uuid.UUID{role.ID},
+	})
+
 	return nil
 }
 
@@ -151,17 +345,29 @@ func (s *UserService) AssignUserToRole(userID, roleID uuid.UUID) error {
 func (s *UserService) RemoveUserFromRole(userID, roleID uuid.UUID) error {
 	var user database.User
 	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
-		return fmt.Errorf("user not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return NewError(CodeNotFound, "user not found")
+		}
+		return fmt.Errorf("failed to get user: %w", err)
 	}
 
 	var role database.Role
 	if err := s.db.Where("id = ?", roleID).First(&role).Error; err != nil {
-		return fmt.Errorf("role not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return NewError(CodeNotFound, "role not found")
+		}
+		return fmt.Errorf("failed to get role: %w", err)
 	}
 
 	if err := s.db.Model(&user).Association("Roles").Delete(&role); err != nil {
 		return fmt.Errorf("failed to remove user from role: %w", err)
 	}
 
+	s.events.Publish(PermissionInvalidation{
+		Reason:  "user_role_removed",
+		UserIDs: []uuid.UUID{user.ID},
+		RoleIDs: []uuid.UUID{role.ID},
+	})
+
 	return nil
 } 
\ No newline at end of file
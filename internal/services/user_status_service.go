@@ -30,13 +30,13 @@ func (s *UserStatusService) CreateUserStatus(name, description, statusType strin
 		}
 	}
 	if !isValidType {
-		return nil, fmt.Errorf("invalid status type: %s. Valid types are: %s", statusType, strings.Join(validTypes, ", "))
+		return nil, NewError(CodeValidationFailed, "invalid status type: %s. Valid types are: %s", statusType, strings.Join(validTypes, ", "))
 	}
 
 	// Check if name already exists
 	var existing database.UserStatus
 	if err := s.db.Where("name = ?", name).First(&existing).Error; err == nil {
-		return nil, fmt.Errorf("user status with name '%s' already exists", name)
+		return nil, NewError(CodeConflict, "user status with name '%s' already exists", name)
 	}
 
 	userStatus := &database.UserStatus{
@@ -59,7 +59,7 @@ func (s *UserStatusService) GetUserStatusByID(id uuid.UUID) (*database.UserStatu
 	var userStatus database.UserStatus
 	if err := s.db.Where("id = ?", id).First(&userStatus).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("user status not found")
+			return nil, NewError(CodeNotFound, "user status not found")
 		}
 		return nil, fmt.Errorf("failed to fetch user status: %w", err)
 	}
@@ -71,7 +71,7 @@ func (s *UserStatusService) GetUserStatusByName(name string) (*database.UserStat
 	var userStatus database.UserStatus
 	if err := s.db.Where("name = ?", name).First(&userStatus).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("user status not found")
+			return nil, NewError(CodeNotFound, "user status not found")
 		}
 		return nil, fmt.Errorf("failed to fetch user status: %w", err)
 	}
@@ -81,7 +81,7 @@ func (s *UserStatusService) GetUserStatusByName(name string) (*database.UserStat
 // ListUserStatuses retrieves all user statuses
 func (s *UserStatusService) ListUserStatuses() ([]database.UserStatus, error) {
 	var userStatuses []database.UserStatus
-	if err := s.db.Find(&userStatuses).Error; err != nil {
+	if err := database.ReadReplica(s.db).Find(&userStatuses).Error; err != nil {
 		return nil, fmt.Errorf("failed to fetch user statuses: %w", err)
 	}
 	return userStatuses, nil
@@ -90,18 +90,22 @@ func (s *UserStatusService) ListUserStatuses() ([]database.UserStatus, error) {
 // ListActiveUserStatuses retrieves only active user statuses
 func (s *UserStatusService) ListActiveUserStatuses() ([]database.UserStatus, error) {
 	var userStatuses []database.UserStatus
-	if err := s.db.Where("active = ?", true).Find(&userStatuses).Error; err != nil {
+	if err := database.ReadReplica(s.db).Where("active = ?", true).Find(&userStatuses).Error; err != nil {
 		return nil, fmt.Errorf("failed to fetch active user statuses: %w", err)
 	}
 	return userStatuses, nil
 }
 
-// UpdateUserStatus updates a user status
-func (s *UserStatusService) UpdateUserStatus(id uuid.UUID, name, description, statusType *string, active *bool) (*database.UserStatus, error) {
+// UpdateUserStatus updates a user status. A non-nil version must match the
+// status's current version.
+func (s *UserStatusService) UpdateUserStatus(id uuid.UUID, version *int, name, description, statusType *string, active *bool) (*database.UserStatus, error) {
 	userStatus, err := s.GetUserStatusByID(id)
 	if err != nil {
 		return nil, err
 	}
+	if err := checkVersion("user status", userStatus.Version, version); err != nil {
+		return nil, err
+	}
 
 	// Validate status type if provided
 	if statusType != nil {
@@ -114,7 +118,7 @@ func (s *UserStatusService) UpdateUserStatus(id uuid.UUID, name, description, st
 			}
 		}
 		if !isValidType {
-			return nil, fmt.Errorf("invalid status type: %s. Valid types are: %s", *statusType, strings.Join(validTypes, ", "))
+			return nil, NewError(CodeValidationFailed, "invalid status type: %s. Valid types are: %s", *statusType, strings.Join(validTypes, ", "))
 		}
 		userStatus.Type = *statusType
 	}
@@ -123,7 +127,7 @@ func (s *UserStatusService) UpdateUserStatus(id uuid.UUID, name, description, st
 	if name != nil && *name != userStatus.Name {
 		var existing database.UserStatus
 		if err := s.db.Where("name = ? AND id != ?", *name, id).First(&existing).Error; err == nil {
-			return nil, fmt.Errorf("user status with name '%s' already exists", *name)
+			return nil, NewError(CodeConflict, "user status with name '%s' already exists", *name)
 		}
 		userStatus.Name = *name
 	}
@@ -136,7 +140,7 @@ func (s *UserStatusService) UpdateUserStatus(id uuid.UUID, name, description, st
 		userStatus.Active = *active
 	}
 
-	if err := s.db.Save(userStatus).Error; err != nil {
+	if err := saveVersioned(s.db, "user status", userStatus, &userStatus.Version); err != nil {
 		return nil, fmt.Errorf("failed to update user status: %w", err)
 	}
 
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"gorm.io/gorm"
+)
+
+// Users, roles, actions, devices, locations and user statuses carry a version
+// that every update bumps. An update may name the version it was based on; a
+// different current version means someone else changed the record since, and
+// the update is rejected rather than silently overwriting their change.
+
+// checkVersion rejects an update based on a version other than current. A nil
+// expected version skips the check.
+func checkVersion(kind string, current int, expected *int) error {
+	if expected != nil && *expected != current {
+		return NewError(CodeConflict, "%s has been modified (version %d, update is based on version %d); reload it and retry", kind, current, *expected)
+	}
+	return nil
+}
+
+// updateVersioned applies updates to record, which was loaded at version, and
+// bumps its version. It fails with a conflict when another update got there
+// first.
+func updateVersioned(db *gorm.DB, kind string, record interface{}, version int, updates map[string]interface{}) error {
+	updates["version"] = gorm.Expr("version + 1")
+	result := db.Model(record).Where("version = ?", version).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return NewError(CodeConflict, "%s has been modified concurrently; reload it and retry", kind)
+	}
+	return nil
+}
+
+// saveVersioned writes all fields of record, which was loaded at *version, and
+// bumps its version, like updateVersioned
+func saveVersioned(db *gorm.DB, kind string, record interface{}, version *int) error {
+	loaded := *version
+	*version = loaded + 1
+	result := db.Select("*").Where("version = ?", loaded).Updates(record)
+	if result.Error == nil && result.RowsAffected == 0 {
+		result.Error = NewError(CodeConflict, "%s has been modified concurrently; reload it and retry", kind)
+	}
+	if result.Error != nil {
+		*version = loaded
+		return result.Error
+	}
+	return nil
+}
@@ -0,0 +1,451 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ValidVisitorStatuses lists the states of a visit, in the order they are reached
+var ValidVisitorStatuses = []string{"expected", "checked_in", "checked_out", "cancelled"}
+
+// VisitorService manages visitors expected at locations, their check-in and
+// check-out by reception and the daily visitor log. Hosts are emailed when
+// their visitor checks in, and each check-in is published as visitor.checked_in.
+type VisitorService struct {
+	db            *gorm.DB
+	notifications *NotificationService
+	translator    *Translator
+	events        *EventBus
+}
+
+func NewVisitorService(db *gorm.DB, notifications *NotificationService, translator *Translator, events *EventBus) *VisitorService {
+	return &VisitorService{
+		db:            db,
+		notifications: notifications,
+		translator:    translator,
+		events:        events,
+	}
+}
+
+// VisitorInput describes a visit to schedule
+type VisitorInput struct {
+	Name        string
+	Company     string
+	Email       string
+	Notes       string
+	HostUserID  uuid.UUID
+	LocationID  uuid.UUID
+	ScheduledAt time.Time
+}
+
+// VisitorUpdate holds the changes to a visit; nil fields are left as they
+// are. Status only cancels an expected visit or reinstates a cancelled one.
+type VisitorUpdate struct {
+	Name        *string
+	Company     *string
+	Email       *string
+	Notes       *string
+	HostUserID  *uuid.UUID
+	LocationID  *uuid.UUID
+	ScheduledAt *time.Time
+	Status      *string
+}
+
+// VisitorFilter narrows the visitors returned by ListVisitors
+type VisitorFilter struct {
+	LocationID *uuid.UUID
+	HostUserID *uuid.UUID
+	Status     string
+	From       *time.Time // Scheduled at or after
+	To         *time.Time // Scheduled before
+	Limit      int
+	Offset     int
+}
+
+// VisitorDesk is the receptionist and device checking a visitor in or out
+type VisitorDesk struct {
+	UserID   uuid.UUID
+	DeviceID uuid.UUID
+}
+
+// VisitorCheckedIn is the data of a visitor.checked_in event
+type VisitorCheckedIn struct {
+	VisitorID   uuid.UUID `json:"visitor_id"`
+	Name        string    `json:"name"`
+	Company     string    `json:"company"`
+	HostUserID  uuid.UUID `json:"host_user_id"`
+	LocationID  uuid.UUID `json:"location_id"`
+	BadgeNumber string    `json:"badge_number"`
+	CheckedInAt time.Time `json:"checked_in_at"`
+}
+
+// VisitorLogEntry is one visit in a location's daily visitor log
+type VisitorLogEntry struct {
+	VisitorID    uuid.UUID  `json:"visitor_id"`
+	LocationID   uuid.UUID  `json:"location_id"`
+	LocationName string     `json:"location_name"`
+	Date         string     `json:"date"` // Day in the location's timezone
+	Name         string     `json:"name"`
+	Company      string     `json:"company"`
+	HostUserID   uuid.UUID  `json:"host_user_id"`
+	HostName     string     `json:"host_name"`
+	ScheduledAt  time.Time  `json:"scheduled_at"`
+	Status       string     `json:"status"`
+	BadgeNumber  string     `json:"badge_number"`
+	CheckedInAt  *time.Time `json:"checked_in_at"`
+	CheckedOutAt *time.Time `json:"checked_out_at"`
+}
+
+// CreateVisitor schedules a visit by a visitor to their host at a location
+func (s *VisitorService) CreateVisitor(input VisitorInput) (*database.Visitor, error) {
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		return nil, NewError(CodeValidationFailed, "visitor name is required")
+	}
+	if input.ScheduledAt.IsZero() {
+		return nil, NewError(CodeValidationFailed, "scheduled_at is required")
+	}
+	if err := s.checkHostAndLocation(input.HostUserID, input.LocationID); err != nil {
+		return nil, err
+	}
+
+	visitor := &database.Visitor{
+		ID:          uuid.New(),
+		Name:        input.Name,
+		Company:     input.Company,
+		Email:       input.Email,
+		Notes:       input.Notes,
+		HostUserID:  input.HostUserID,
+		LocationID:  input.LocationID,
+		ScheduledAt: input.ScheduledAt,
+		Status:      "expected",
+	}
+	if err := s.db.Omit("HostUser", "Location").Create(visitor).Error; err != nil {
+		return nil, fmt.Errorf("failed to create visitor: %w", err)
+	}
+	return s.GetVisitor(visitor.ID)
+}
+
+// GetVisitor retrieves a visitor by ID with their host and location
+func (s *VisitorService) GetVisitor(id uuid.UUID) (*database.Visitor, error) {
+	var visitor database.Visitor
+	if err := s.db.Preload("HostUser").Preload("Location").Where("id = ?", id).First(&visitor).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, NewError(CodeNotFound, "visitor not found")
+		}
+		return nil, fmt.Errorf("failed to get visitor: %w", err)
+	}
+	return &visitor, nil
+}
+
+// ListVisitors retrieves visitors by scheduled time, with the total matching the filter
+func (s *VisitorService) ListVisitors(filter VisitorFilter) ([]database.Visitor, int64, error) {
+	query := database.ReadReplica(s.db).Model(&database.Visitor{})
+	if filter.LocationID != nil {
+		query = query.Where("location_id = ?", *filter.LocationID)
+	}
+	if filter.HostUserID != nil {
+		query = query.Where("host_user_id = ?", *filter.HostUserID)
+	}
+	if filter.Status != "" {
+		if !containsString(ValidVisitorStatuses, filter.Status) {
+			return nil, 0, NewError(CodeValidationFailed, "status must be one of: %v", ValidVisitorStatuses)
+		}
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.From != nil {
+		query = query.Where("scheduled_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("scheduled_at < ?", *filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count visitors: %w", err)
+	}
+
+	var visitors []database.Visitor
+	err := query.Preload("HostUser").Preload("Location").Order("scheduled_at").Limit(filter.Limit).Offset(filter.Offset).Find(&visitors).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch visitors: %w", err)
+	}
+	return visitors, total, nil
+}
+
+// UpdateVisitor applies changes to a visit that has not started, rejecting
+// them when expected names a version other than the current one. Notes can
+// be changed at any time.
+func (s *VisitorService) UpdateVisitor(id uuid.UUID, update VisitorUpdate, expected *int) (*database.Visitor, error) {
+	visitor, err := s.GetVisitor(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion("visitor", visitor.Version, expected); err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if update.Notes != nil {
+		updates["notes"] = *update.Notes
+	}
+	visitChanged := update.Name != nil || update.Company != nil || update.Email != nil ||
+		update.HostUserID != nil || update.LocationID != nil || update.ScheduledAt != nil || update.Status != nil
+	if visitChanged && visitor.Status != "expected" && visitor.Status != "cancelled" {
+		return nil, NewError(CodeConflict, "visitor is %s; only notes can be changed", visitor.Status)
+	}
+
+	if update.Name != nil {
+		name := strings.TrimSpace(*update.Name)
+		if name == "" {
+			return nil, NewError(CodeValidationFailed, "visitor name cannot be empty")
+		}
+		updates["name"] = name
+	}
+	if update.Company != nil {
+		updates["company"] = *update.Company
+	}
+	if update.Email != nil {
+		updates["email"] = *update.Email
+	}
+	if update.ScheduledAt != nil {
+		if update.ScheduledAt.IsZero() {
+			return nil, NewError(CodeValidationFailed, "scheduled_at cannot be empty")
+		}
+		updates["scheduled_at"] = *update.ScheduledAt
+	}
+	if update.HostUserID != nil || update.LocationID != nil {
+		hostUserID, locationID := visitor.HostUserID, visitor.LocationID
+		if update.HostUserID != nil {
+			hostUserID = *update.HostUserID
+		}
+		if update.LocationID != nil {
+			locationID = *update.LocationID
+		}
+		if err := s.checkHostAndLocation(hostUserID, locationID); err != nil {
+			return nil, err
+		}
+		updates["host_user_id"] = hostUserID
+		updates["location_id"] = locationID
+	}
+	if update.Status != nil {
+		if *update.Status != "expected" && *update.Status != "cancelled" {
+			return nil, NewError(CodeValidationFailed, "status can only be set to expected or cancelled; use check-in and check-out")
+		}
+		updates["status"] = *update.Status
+	}
+	if len(updates) == 0 {
+		return visitor, nil
+	}
+
+	if err := updateVersioned(s.db, "visitor", &database.Visitor{ID: id}, visitor.Version, updates); err != nil {
+		return nil, err
+	}
+	return s.GetVisitor(id)
+}
+
+// DeleteVisitor deletes a visitor and their visit from the visitor log
+func (s *VisitorService) DeleteVisitor(id uuid.UUID) error {
+	result := s.db.Where("id = ?", id).Delete(&database.Visitor{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete visitor: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return NewError(CodeNotFound, "visitor not found")
+	}
+	return nil
+}
+
+// CheckIn records an expected visitor's arrival at reception and the badge
+// they were given, which no other checked-in visitor may hold. The host is
+// emailed in the background.
+func (s *VisitorService) CheckIn(id uuid.UUID, badgeNumber string, desk VisitorDesk) (*database.Visitor, error) {
+	visitor, err := s.GetVisitor(id)
+	if err != nil {
+		return nil, err
+	}
+	if visitor.Status != "expected" {
+		return nil, NewError(CodeConflict, "visitor is %s, not expected", visitor.Status)
+	}
+
+	now := time.Now()
+	err = updateVersioned(s.db, "visitor", &database.Visitor{ID: id}, visitor.Version, map[string]interface{}{
+		"status":               "checked_in",
+		"badge_number":         strings.TrimSpace(badgeNumber),
+		"checked_in_at":        now,
+		"checked_in_by_id":     desk.UserID,
+		"checked_in_device_id": desk.DeviceID,
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, NewError(CodeConflict, "badge '%s' is held by another checked-in visitor", badgeNumber)
+		}
+		return nil, fmt.Errorf("failed to check in visitor: %w", err)
+	}
+
+	if visitor, err = s.GetVisitor(id); err != nil {
+		return nil, err
+	}
+	s.events.Publish(EventVisitorCheckedIn, VisitorCheckedIn{
+		VisitorID:   visitor.ID,
+		Name:        visitor.Name,
+		Company:     visitor.Company,
+		HostUserID:  visitor.HostUserID,
+		LocationID:  visitor.LocationID,
+		BadgeNumber: visitor.BadgeNumber,
+		CheckedInAt: now,
+	})
+	go s.notifyHost(visitor)
+	return visitor, nil
+}
+
+// CheckOut records a checked-in visitor leaving, which frees their badge
+func (s *VisitorService) CheckOut(id uuid.UUID, desk VisitorDesk) (*database.Visitor, error) {
+	visitor, err := s.GetVisitor(id)
+	if err != nil {
+		return nil, err
+	}
+	if visitor.Status != "checked_in" {
+		return nil, NewError(CodeConflict, "visitor is %s, not checked in", visitor.Status)
+	}
+
+	err = updateVersioned(s.db, "visitor", &database.Visitor{ID: id}, visitor.Version, map[string]interface{}{
+		"status":                "checked_out",
+		"checked_out_at":        time.Now(),
+		"checked_out_by_id":     desk.UserID,
+		"checked_out_device_id": desk.DeviceID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to check out visitor: %w", err)
+	}
+	return s.GetVisitor(id)
+}
+
+// DailyLog returns the visits of a day, YYYY-MM-DD, at a location or at every
+// active location, ordered by location name and scheduled time. A visit
+// belongs to the day it was scheduled for or checked in on, in the
+// location's timezone (UTC when unset).
+func (s *VisitorService) DailyLog(date string, locationID *uuid.UUID) ([]VisitorLogEntry, error) {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return nil, NewError(CodeValidationFailed, "date must be YYYY-MM-DD")
+	}
+
+	db := database.ReadReplica(s.db)
+	var locations []database.Location
+	query := db.Order("name")
+	if locationID != nil {
+		query = query.Where("id = ?", *locationID)
+	} else {
+		query = query.Where("active = ?", true)
+	}
+	if err := query.Find(&locations).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch locations: %w", err)
+	}
+	if locationID != nil && len(locations) == 0 {
+		return nil, NewError(CodeNotFound, "location not found")
+	}
+
+	entries := []VisitorLogEntry{}
+	for _, location := range locations {
+		loc := loadTimezone(location.Timezone)
+		start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, loc)
+		end := start.AddDate(0, 0, 1)
+
+		var visitors []database.Visitor
+		err := db.Preload("HostUser").
+			Where("location_id = ?", location.ID).
+			Where("(scheduled_at >= ? AND scheduled_at < ?) OR (checked_in_at >= ? AND checked_in_at < ?)", start, end, start, end).
+			Order("scheduled_at").Find(&visitors).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch visitors: %w", err)
+		}
+
+		for _, visitor := range visitors {
+			entries = append(entries, VisitorLogEntry{
+				VisitorID:    visitor.ID,
+				LocationID:   location.ID,
+				LocationName: location.Name,
+				Date:         date,
+				Name:         visitor.Name,
+				Company:      visitor.Company,
+				HostUserID:   visitor.HostUserID,
+				HostName:     strings.TrimSpace(visitor.HostUser.FirstName + " " + visitor.HostUser.LastName),
+				ScheduledAt:  visitor.ScheduledAt.In(loc),
+				Status:       visitor.Status,
+				BadgeNumber:  visitor.BadgeNumber,
+				CheckedInAt:  inLocation(visitor.CheckedInAt, loc),
+				CheckedOutAt: inLocation(visitor.CheckedOutAt, loc),
+			})
+		}
+	}
+	return entries, nil
+}
+
+// inLocation converts an optional time to a location's timezone
+func inLocation(t *time.Time, loc *time.Location) *time.Time {
+	if t == nil {
+		return nil
+	}
+	local := t.In(loc)
+	return &local
+}
+
+// checkHostAndLocation checks a visit's host is an active user and its location exists
+func (s *VisitorService) checkHostAndLocation(hostUserID, locationID uuid.UUID) error {
+	var host database.User
+	if err := s.db.Where("id = ?", hostUserID).First(&host).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return NewError(CodeValidationFailed, "host user not found")
+		}
+		return fmt.Errorf("failed to get host user: %w", err)
+	}
+	if !host.Active {
+		return NewError(CodeValidationFailed, "host user '%s' is not active", host.Username)
+	}
+	var location database.Location
+	if err := s.db.Where("id = ?", locationID).First(&location).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return NewError(CodeValidationFailed, "location not found")
+		}
+		return fmt.Errorf("failed to get location: %w", err)
+	}
+	return nil
+}
+
+// notifyHost emails the host that their visitor has arrived, in the host's
+// locale, and records when it was sent. Hosts without an email address are
+// skipped; failures are only logged.
+func (s *VisitorService) notifyHost(visitor *database.Visitor) {
+	host := &visitor.HostUser
+	if host.Email == "" {
+		log.Printf("Not notifying host of visitor %s: user %s has no email address", visitor.ID, host.ID)
+		return
+	}
+
+	loc := loadTimezone(visitor.Location.Timezone)
+	data := map[string]interface{}{
+		"HostName":     strings.TrimSpace(host.FirstName + " " + host.LastName),
+		"VisitorName":  visitor.Name,
+		"Company":      visitor.Company,
+		"LocationName": visitor.Location.Name,
+		"BadgeNumber":  visitor.BadgeNumber,
+		"ArrivedAt":    visitor.CheckedInAt.In(loc),
+	}
+	locale := s.translator.Negotiate(host.Locale, "")
+	subject := s.translator.Translate(locale, "email.visitor_arrival.subject", data)
+	if err := s.notifications.SendEmail([]string{host.Email}, subject, s.translator.Translate(locale, "email.visitor_arrival.body", data)); err != nil {
+		log.Printf("Failed to notify host of visitor %s: %v", visitor.ID, err)
+		return
+	}
+	if err := s.db.Model(&database.Visitor{}).Where("id = ?", visitor.ID).UpdateColumn("host_notified_at", time.Now()).Error; err != nil {
+		log.Printf("Failed to record host notification of visitor %s: %v", visitor.ID, err)
+	}
+}
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/jobs"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+	"gorm.io/gorm"
+)
+
+// JobWebhookDelivery is the job type that delivers one event to one webhook
+const JobWebhookDelivery = "webhook.deliver"
+
+// WebhookService manages webhook subscriptions and delivers event bus events to them
+type WebhookService struct {
+	db            *gorm.DB
+	notifications *NotificationService
+	queue         *jobs.Queue
+}
+
+// webhookDelivery is the payload of a webhook.deliver job
+type webhookDelivery struct {
+	WebhookID uuid.UUID `json:"webhook_id"`
+	Event     Event     `json:"event"`
+}
+
+// NewWebhookService creates the service and subscribes it to every event on the
+// bus. Deliveries are queued on queue and retried there when they fail.
+func NewWebhookService(db *gorm.DB, bus *EventBus, notifications *NotificationService, queue *jobs.Queue) *WebhookService {
+	s := &WebhookService{
+		db:            db,
+		notifications: notifications,
+		queue:         queue,
+	}
+	bus.Subscribe("*", s.deliver)
+	return s
+}
+
+// RegisterJobs registers the webhook delivery handler on a job worker
+func (s *WebhookService) RegisterJobs(worker *jobs.Worker) {
+	worker.Handle(JobWebhookDelivery, s.runDelivery)
+}
+
+// CreateWebhook creates a new webhook subscription
+func (s *WebhookService) CreateWebhook(name, webhookURL string, eventTypes []string, secret string, active bool) (*database.Webhook, error) {
+	if err := validateWebhookURL(webhookURL); err != nil {
+		return nil, err
+	}
+	eventTypesJSONB, err := webhookEventTypesJSONB(eventTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook := database.Webhook{
+		ID:         uuid.New(),
+		Name:       name,
+		URL:        webhookURL,
+		EventTypes: eventTypesJSONB,
+		Secret:     secret,
+		Active:     true,
+	}
+
+	if err := s.db.Create(&webhook).Error; err != nil {
+		return nil, fmt.Errorf("failed to create webhook: %w", err)
+	}
+
+	// Create skips zero values for columns with defaults, so an inactive webhook needs an explicit update
+	if !active {
+		if err := s.db.Model(&webhook).Update("active", false).Error; err != nil {
+			return nil, fmt.Errorf("failed to create webhook: %w", err)
+		}
+		webhook.Active = false
+	}
+
+	return &webhook, nil
+}
+
+// GetWebhookByID retrieves a webhook by ID
+func (s *WebhookService) GetWebhookByID(id uuid.UUID) (*database.Webhook, error) {
+	var webhook database.Webhook
+	if err := s.db.Where("id = ?", id).First(&webhook).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewError(CodeNotFound, "webhook not found")
+		}
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+	return &webhook, nil
+}
+
+// ListWebhooks retrieves all webhooks
+func (s *WebhookService) ListWebhooks() ([]database.Webhook, error) {
+	var webhooks []database.Webhook
+	if err := s.db.Order("name").Find(&webhooks).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+// UpdateWebhook updates a webhook
+func (s *WebhookService) UpdateWebhook(id uuid.UUID, updates map[string]interface{}, eventTypes []string) (*database.Webhook, error) {
+	if _, err := s.GetWebhookByID(id); err != nil {
+		return nil, err
+	}
+
+	if webhookURL, ok := updates["url"].(string); ok {
+		if err := validateWebhookURL(webhookURL); err != nil {
+			return nil, err
+		}
+	}
+	if eventTypes != nil {
+		eventTypesJSONB, err := webhookEventTypesJSONB(eventTypes)
+		if err != nil {
+			return nil, err
+		}
+		updates["event_types"] = eventTypesJSONB
+	}
+
+	if err := s.db.Model(&database.Webhook{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to update webhook: %w", err)
+	}
+
+	return s.GetWebhookByID(id)
+}
+
+// DeleteWebhook permanently deletes a webhook
+func (s *WebhookService) DeleteWebhook(id uuid.UUID) error {
+	result := s.db.Where("id = ?", id).Delete(&database.Webhook{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete webhook: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return NewError(CodeNotFound, "webhook not found")
+	}
+	return nil
+}
+
+// WebhookEventTypes returns the event types a webhook is subscribed to
+func WebhookEventTypes(webhook *database.Webhook) []string {
+	var eventTypes []string
+	if webhook.EventTypes.Status == pgtype.Present {
+		if err := webhook.EventTypes.AssignTo(&eventTypes); err != nil {
+			return nil
+		}
+	}
+	return eventTypes
+}
+
+// deliver queues a delivery of an event to every active webhook subscribed to its type
+func (s *WebhookService) deliver(event Event) {
+	var webhooks []database.Webhook
+	if err := s.db.Where("active = ?", true).Find(&webhooks).Error; err != nil {
+		log.Printf("Failed to load webhooks for %s event: %v", event.Type, err)
+		return
+	}
+
+	for i := range webhooks {
+		webhook := &webhooks[i]
+		if !webhookSubscribed(WebhookEventTypes(webhook), event.Type) {
+			continue
+		}
+		if _, err := s.queue.Enqueue(context.Background(), JobWebhookDelivery, webhookDelivery{WebhookID: webhook.ID, Event: event}); err != nil {
+			log.Printf("Failed to queue %s event for webhook %s: %v", event.Type, webhook.Name, err)
+		}
+	}
+}
+
+// runDelivery sends one queued event to its webhook. A failed delivery is
+// recorded on the webhook and retried by the job queue.
+func (s *WebhookService) runDelivery(ctx context.Context, job *jobs.Job) error {
+	var delivery webhookDelivery
+	if err := job.Decode(&delivery); err != nil {
+		return err
+	}
+
+	var webhook database.Webhook
+	if err := s.db.WithContext(ctx).Where("id = ? AND active = ?", delivery.WebhookID, true).First(&webhook).Error; err != nil {
+		return nil // Deleted or deactivated since the event was queued
+	}
+
+	headers := map[string]string{
+		"X-YubiApp-Event":    delivery.Event.Type,
+		"X-YubiApp-Delivery": delivery.Event.ID.String(),
+	}
+	deliveryErr := s.notifications.SendSignedWebhook(webhook.URL, webhook.Secret, delivery.Event, headers)
+	lastError := ""
+	if deliveryErr != nil {
+		lastError = deliveryErr.Error()
+	}
+
+	s.db.Model(&database.Webhook{}).Where("id = ?", webhook.ID).Updates(map[string]interface{}{
+		"last_delivery_at": time.Now(),
+		"last_error":       lastError,
+	})
+	if deliveryErr != nil {
+		return fmt.Errorf("webhook %s: %w", webhook.Name, deliveryErr)
+	}
+	return nil
+}
+
+// webhookSubscribed reports whether a subscription list includes an event type
+func webhookSubscribed(eventTypes []string, eventType string) bool {
+	for _, t := range eventTypes {
+		if t == "*" || t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// webhookEventTypesJSONB validates event types and converts them to JSONB
+func webhookEventTypesJSONB(eventTypes []string) (pgtype.JSONB, error) {
+	var eventTypesJSONB pgtype.JSONB
+	if len(eventTypes) == 0 {
+		return eventTypesJSONB, NewError(CodeValidationFailed, "at least one event type is required")
+	}
+	for _, eventType := range eventTypes {
+		if eventType == "*" {
+			continue
+		}
+		valid := false
+		for _, t := range EventTypes {
+			if eventType == t {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return eventTypesJSONB, NewError(CodeValidationFailed, "invalid event type '%s'. Must be one of: %v or \"*\"", eventType, EventTypes)
+		}
+	}
+	if err := eventTypesJSONB.Set(eventTypes); err != nil {
+		return eventTypesJSONB, fmt.Errorf("failed to convert event types to JSONB: %w", err)
+	}
+	return eventTypesJSONB, nil
+}
+
+// validateWebhookURL checks that a webhook URL is an absolute http(s) URL
+func validateWebhookURL(webhookURL string) error {
+	parsed, err := url.ParseRequestURI(webhookURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return NewError(CodeValidationFailed, "url must be an absolute http or https URL")
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+)
+
+// ErrValidationUnavailable is returned when no YubiCloud validation host could
+// verify an OTP, or the circuit breaker is open after repeated failures
+var ErrValidationUnavailable = NewError(CodeValidationUnavailable, "validation service unavailable")
+
+// yubicloudClient sends OTP verification requests to the YubiCloud validation
+// hosts: yubikey.api_url, then yubikey.fallback_urls. Attempts that fail for
+// want of an answer are retried on the next host after a jittered backoff, and
+// after yubikey.circuit_breaker.failures verifications fail in a row no
+// requests are sent for yubikey.circuit_breaker.cooldown. Responses must be
+// signed with yubikey.secret_key when it is set.
+type yubicloudClient struct {
+	httpClient *http.Client
+	hosts      []string
+	config     config.YubikeyConfig
+	key        []byte // Decoded yubikey.secret_key; responses are not checked without one
+
+	mu        sync.Mutex
+	failures  int       // Consecutive verifications that found no host answering
+	openUntil time.Time // Requests fail fast until then
+}
+
+// newYubicloudClient creates a client with yubikey.timeout per attempt, going
+// through yubikey.proxy_url or else the proxy of the environment
+func newYubicloudClient(cfg config.YubikeyConfig) *yubicloudClient {
+	proxy := http.ProxyFromEnvironment
+	if proxyURL, err := url.Parse(cfg.ProxyURL); err == nil && cfg.ProxyURL != "" {
+		proxy = http.ProxyURL(proxyURL)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+	// Validated to be base64 by config.Validate
+	key, _ := base64.StdEncoding.DecodeString(cfg.SecretKey)
+
+	return &yubicloudClient{
+		httpClient: &http.Client{Timeout: cfg.Timeout, Transport: transport},
+		hosts:      append([]string{cfg.APIURL}, cfg.FallbackURLs...),
+		config:     cfg,
+		key:        key,
+	}
+}
+
+// verifyOTP verifies otp with yubikey.client_id, returning the OTP's counters
+// when the response carries them, the attempts made and the status answered
+func (c *yubicloudClient) verifyOTP(ctx context.Context, otp string) (*yubikeyToken, int, string, error) {
+	params := url.Values{}
+	params.Add("id", c.config.ClientID)
+	params.Add("otp", otp)
+
+	// Generate alphanumeric nonce (16-40 characters, no hyphens)
+	nonceBytes := make([]byte, 20)
+	rand.Read(nonceBytes)
+	params.Add("nonce", hex.EncodeToString(nonceBytes))
+	params.Add("timestamp", "1") // Include the OTP's counters in the response
+
+	values, attempts, err := c.verify(ctx, params)
+	if err != nil {
+		return nil, attempts, "", err
+	}
+	status := values["status"]
+
+	switch strings.ToLower(status) {
+	case "ok":
+		// sessioncounter is the OTP's use counter, sessionuse its session counter
+		useCounter, useErr := strconv.ParseUint(values["sessioncounter"], 10, 16)
+		sessionCounter, sessionErr := strconv.ParseUint(values["sessionuse"], 10, 8)
+		if useErr != nil || sessionErr != nil {
+			return nil, attempts, status, nil
+		}
+		return &yubikeyToken{UseCounter: uint16(useCounter), SessionCounter: uint8(sessionCounter)}, attempts, status, nil
+	case "replayed_otp":
+		return nil, attempts, status, NewError(CodeAuthReplayedOTP, "replayed OTP detected")
+	case "bad_otp":
+		return nil, attempts, status, fmt.Errorf("invalid OTP format")
+	case "missing_parameter":
+		return nil, attempts, status, fmt.Errorf("missing parameter in OTP verification")
+	case "no_such_client":
+		return nil, attempts, status, fmt.Errorf("invalid client ID")
+	case "operation_not_allowed":
+		return nil, attempts, status, fmt.Errorf("operation not allowed")
+	default:
+		return nil, attempts, status, fmt.Errorf("Yubico verification failed with status: %s", status)
+	}
+}
+
+// YubicloudVerifier verifies YubiKey OTPs with YubiCloud outside the API
+// server, such as from the CLI, with the same hosts, timeouts, retries,
+// proxy, circuit breaker and response checks
+type YubicloudVerifier struct {
+	client *yubicloudClient
+}
+
+// NewYubicloudVerifier creates a verifier for the yubikey settings
+func NewYubicloudVerifier(cfg config.YubikeyConfig) *YubicloudVerifier {
+	return &YubicloudVerifier{client: newYubicloudClient(cfg)}
+}
+
+// Verify verifies an OTP, failing unless YubiCloud answers OK
+func (v *YubicloudVerifier) Verify(ctx context.Context, otp string) error {
+	_, _, _, err := v.client.verifyOTP(ctx, otp)
+	return err
+}
+
+// verify sends a verification request with params, returning the response's
+// key-value pairs and the number of attempts made
+func (c *yubicloudClient) verify(ctx context.Context, params url.Values) (map[string]string, int, error) {
+	if !c.allow() {
+		return nil, 0, ErrValidationUnavailable
+	}
+
+	var lastErr error
+	attempts := c.config.Retries + 1
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if err := c.wait(ctx, attempt); err != nil {
+				lastErr = err
+				break
+			}
+		}
+		host := c.hosts[attempt%len(c.hosts)]
+		values, err := c.send(ctx, host, params)
+		if err == nil {
+			status := strings.ToLower(values["status"])
+			if status == "replayed_request" && attempt > 0 {
+				// An earlier attempt reached a server, but its answer was lost
+				err = fmt.Errorf("%s: the outcome of an earlier attempt is unknown", host)
+			} else if status != "backend_error" {
+				c.record(true)
+				return values, attempt + 1, nil
+			} else {
+				err = fmt.Errorf("%s: backend error", host)
+			}
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	// A request that gave up is no sign of the hosts' health
+	if ctx.Err() == nil {
+		c.record(false)
+	}
+	return nil, attempts, WrapError(CodeValidationUnavailable, ErrValidationUnavailable.Message, lastErr)
+}
+
+// send makes one verification request to host and parses the response
+func (c *yubicloudClient) send(ctx context.Context, host string, params url.Values) (map[string]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s?%s", host, params.Encode()), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request to %s: %w", host, err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil, fmt.Errorf("%s answered %s", host, resp.Status)
+	}
+
+	// The response is plain text key=value lines
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response from %s: %w", host, err)
+	}
+	values := make(map[string]string)
+	for _, line := range strings.Split(string(body), "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok {
+			values[key] = strings.TrimSpace(value)
+		}
+	}
+
+	// An answer that is not signed with our key, or that is about another
+	// request, may have been forged or replayed on the way
+	if len(c.key) > 0 && !c.signed(values) {
+		return nil, fmt.Errorf("%s: response signature is missing or invalid", host)
+	}
+	if strings.EqualFold(values["status"], "ok") &&
+		(values["otp"] != params.Get("otp") || values["nonce"] != params.Get("nonce")) {
+		return nil, fmt.Errorf("%s: response is for a different OTP or nonce", host)
+	}
+	return values, nil
+}
+
+// signed reports whether values carry a valid h: the base64 HMAC-SHA1, under
+// the secret key, of the other pairs sorted by key and joined as key=value&...
+func (c *yubicloudClient) signed(values map[string]string) bool {
+	signature, err := base64.StdEncoding.DecodeString(values["h"])
+	if err != nil || len(signature) == 0 {
+		return false
+	}
+	return hmac.Equal(signature, signYubicloud(c.key, values))
+}
+
+// signYubicloud returns the HMAC-SHA1 under key of values other than h, as
+// YubiCloud's validation protocol signs requests and responses
+func signYubicloud(key []byte, values map[string]string) []byte {
+	keys := make([]string, 0, len(values))
+	for name := range values {
+		if name != "h" {
+			keys = append(keys, name)
+		}
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, name := range keys {
+		pairs[i] = name + "=" + values[name]
+	}
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write([]byte(strings.Join(pairs, "&")))
+	return mac.Sum(nil)
+}
+
+// wait sleeps before a retry for yubikey.retry_backoff, doubled for each
+// earlier retry, with jitter
+func (c *yubicloudClient) wait(ctx context.Context, attempt int) error {
+	backoff := c.config.RetryBackoff << (attempt - 1)
+	backoff = backoff/2 + time.Duration(mathrand.Int63n(int64(backoff/2)+1))
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// allow reports whether requests may be sent; once the cooldown of an open
+// breaker has passed, they are until the next failure reopens it
+func (c *yubicloudClient) allow() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !time.Now().Before(c.openUntil)
+}
+
+// unavailable reports whether the last verification found no host answering
+func (c *yubicloudClient) unavailable() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.failures > 0
+}
+
+// record counts a verification's outcome towards the circuit breaker
+func (c *yubicloudClient) record(answered bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if answered {
+		c.failures = 0
+		return
+	}
+	c.failures++
+	threshold := c.config.CircuitBreaker.Failures
+	if threshold > 0 && c.failures >= threshold {
+		c.openUntil = time.Now().Add(c.config.CircuitBreaker.Cooldown)
+	}
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/YubiApp/internal/config"
+)
+
+const testOTP = "cccccckdvvulgjvtkjdhtlrbjjctggdihuevikehtlil"
+
+// yubicloudServer answers verification requests with the pairs respond
+// returns, signed with key unless it is nil
+func yubicloudServer(t *testing.T, key []byte, respond func(query map[string]string) map[string]string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := map[string]string{}
+		for name := range r.URL.Query() {
+			query[name] = r.URL.Query().Get(name)
+		}
+		values := respond(query)
+		if key != nil {
+			values["h"] = base64.StdEncoding.EncodeToString(signYubicloud(key, values))
+		}
+		names := make([]string, 0, len(values))
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(w, "%s=%s\r\n", name, values[name])
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func echoOK(query map[string]string) map[string]string {
+	return map[string]string{
+		"status":         "OK",
+		"otp":            query["otp"],
+		"nonce":          query["nonce"],
+		"t":              "2024-03-08T12:00:00Z0123",
+		"sessioncounter": "12",
+		"sessionuse":     "3",
+	}
+}
+
+func TestYubicloudClientResponseChecks(t *testing.T) {
+	key := []byte("0123456789abcdefghij")
+	otherKey := []byte("jihgfedcba9876543210")
+
+	tests := []struct {
+		name       string
+		serverKey  []byte
+		respond    func(map[string]string) map[string]string
+		wantErr    bool
+		wantTokens bool
+	}{
+		{name: "signed", serverKey: key, respond: echoOK, wantTokens: true},
+		{name: "unsigned", serverKey: nil, respond: echoOK, wantErr: true},
+		{name: "signed with another key", serverKey: otherKey, respond: echoOK, wantErr: true},
+		{
+			name:      "another OTP",
+			serverKey: key,
+			respond: func(query map[string]string) map[string]string {
+				values := echoOK(query)
+				values["otp"] = "ccccccbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+				return values
+			},
+			wantErr: true,
+		},
+		{
+			name:      "another nonce",
+			serverKey: key,
+			respond: func(query map[string]string) map[string]string {
+				values := echoOK(query)
+				values["nonce"] = "0000000000000000"
+				return values
+			},
+			wantErr: true,
+		},
+		{
+			name:      "signed failure",
+			serverKey: key,
+			respond: func(query map[string]string) map[string]string {
+				return map[string]string{"status": "BAD_OTP", "otp": query["otp"], "nonce": query["nonce"], "t": "2024-03-08T12:00:00Z0123"}
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := yubicloudServer(t, tt.serverKey, tt.respond)
+			client := newYubicloudClient(config.YubikeyConfig{
+				ClientID:  "1",
+				SecretKey: base64.StdEncoding.EncodeToString(key),
+				APIURL:    server.URL,
+				Timeout:   time.Second,
+			})
+
+			token, _, _, err := client.verifyOTP(context.Background(), testOTP)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantTokens && (token == nil || token.UseCounter != 12 || token.SessionCounter != 3) {
+				t.Fatalf("got counters %+v", token)
+			}
+		})
+	}
+}
+
+func TestYubicloudClientWithoutSecretKey(t *testing.T) {
+	server := yubicloudServer(t, nil, echoOK)
+	client := newYubicloudClient(config.YubikeyConfig{ClientID: "1", APIURL: server.URL, Timeout: time.Second})
+
+	if _, _, _, err := client.verifyOTP(context.Background(), testOTP); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestYubicloudClientFallsBackOnForgedResponse(t *testing.T) {
+	key := []byte("0123456789abcdefghij")
+	forged := yubicloudServer(t, nil, echoOK)
+	genuine := yubicloudServer(t, key, echoOK)
+	client := newYubicloudClient(config.YubikeyConfig{
+		ClientID:     "1",
+		SecretKey:    base64.StdEncoding.EncodeToString(key),
+		APIURL:       forged.URL,
+		FallbackURLs: []string{genuine.URL},
+		Timeout:      time.Second,
+		Retries:      1,
+		RetryBackoff: time.Millisecond,
+	})
+
+	_, attempts, status, err := client.verifyOTP(context.Background(), testOTP)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if attempts != 2 || !strings.EqualFold(status, "ok") {
+		t.Fatalf("got %d attempts and status %q", attempts, status)
+	}
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/YubiApp/internal/database"
+	"gorm.io/gorm"
+)
+
+const modhexAlphabet = "cbdefghijklnrtuv"
+
+// yubikeyToken is a decrypted Yubico OTP token
+type yubikeyToken struct {
+	PrivateID      []byte
+	UseCounter     uint16 // Non-volatile counter, incremented on power-up
+	SessionCounter uint8  // Incremented for each OTP within a power-up
+}
+
+// Counter combines the use and session counters into a value that increases with every OTP
+func (t yubikeyToken) Counter() int64 {
+	return int64(t.UseCounter)<<8 | int64(t.SessionCounter)
+}
+
+// yubikeyLocalKey parses a device secret holding the YubiKey's AES key for local
+// OTP validation: 32 hex characters, optionally followed by ":" and the 12 hex
+// character private ID. ok is false if the secret is not in this format.
+func yubikeyLocalKey(secret string) (key, privateID []byte, ok bool) {
+	keyHex, privateIDHex, _ := strings.Cut(strings.TrimSpace(secret), ":")
+	key, err := hex.DecodeString(keyHex)
+	if err != nil || len(key) != 16 {
+		return nil, nil, false
+	}
+	if privateIDHex != "" {
+		privateID, err = hex.DecodeString(privateIDHex)
+		if err != nil || len(privateID) != 6 {
+			return nil, nil, false
+		}
+	}
+	return key, privateID, true
+}
+
+// decodeYubikeyOTP decrypts the token part of a 44 character Yubico OTP with the
+// key's AES secret and checks its CRC
+func decodeYubikeyOTP(otp string, key []byte) (*yubikeyToken, error) {
+	if len(otp) != 44 {
+		return nil, fmt.Errorf("invalid YubiKey OTP format")
+	}
+	ciphertext, err := modhexDecode(strings.ToLower(otp[12:]))
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid YubiKey AES key: %w", err)
+	}
+	plaintext := make([]byte, aes.BlockSize)
+	block.Decrypt(plaintext, ciphertext)
+
+	if yubikeyCRC(plaintext) != 0xf0b8 {
+		return nil, fmt.Errorf("invalid OTP")
+	}
+
+	return &yubikeyToken{
+		PrivateID:      plaintext[0:6],
+		UseCounter:     binary.LittleEndian.Uint16(plaintext[6:8]),
+		SessionCounter: plaintext[11],
+	}, nil
+}
+
+// verifyYubikeyOTPLocal validates an OTP against the device's AES key and
+// records its counters, rejecting replayed or out-of-order OTPs
+func verifyYubikeyOTPLocal(db *gorm.DB, device *database.Device, otp string, key, privateID []byte) error {
+	token, err := decodeYubikeyOTP(otp, key)
+	if err != nil {
+		return err
+	}
+	if privateID != nil && !bytes.Equal(token.PrivateID, privateID) {
+		return fmt.Errorf("invalid OTP")
+	}
+	return recordYubikeyCounters(db, device, token)
+}
+
+// recordYubikeyCounters advances the device's stored counters to those of an
+// accepted OTP. An OTP at the stored high-water mark is a replay; one below it
+// was generated by a key that has not seen the device's later OTPs, which
+// suggests a clone.
+func recordYubikeyCounters(db *gorm.DB, device *database.Device, token *yubikeyToken) error {
+	// Only one request can advance the counter past a given value
+	result := db.Model(&database.Device{}).
+		Where("id = ? AND last_otp_counter < ?", device.ID, token.Counter()).
+		Updates(map[string]interface{}{
+			"last_otp_counter":    token.Counter(),
+			"otp_use_counter":     token.UseCounter,
+			"otp_session_counter": token.SessionCounter,
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update OTP counter: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	var highWater int64
+	if err := db.Model(&database.Device{}).Where("id = ?", device.ID).Select("last_otp_counter").Scan(&highWater).Error; err != nil {
+		return fmt.Errorf("failed to read OTP counter: %w", err)
+	}
+	if token.Counter() < highWater {
+		return NewError(CodeDeviceCloneSuspected, "OTP counter (use %d, session %d) is below the device's high-water mark (use %d, session %d)",
+			token.UseCounter, token.SessionCounter, highWater>>8, highWater&0xff)
+	}
+	return NewError(CodeAuthReplayedOTP, "replayed OTP detected")
+}
+
+// modhexDecode converts a modhex string to bytes
+func modhexDecode(value string) ([]byte, error) {
+	if len(value)%2 != 0 {
+		return nil, fmt.Errorf("invalid modhex length")
+	}
+	out := make([]byte, len(value)/2)
+	for i := 0; i < len(value); i += 2 {
+		hi := strings.IndexByte(modhexAlphabet, value[i])
+		lo := strings.IndexByte(modhexAlphabet, value[i+1])
+		if hi < 0 || lo < 0 {
+			return nil, fmt.Errorf("invalid modhex character")
+		}
+		out[i/2] = byte(hi<<4 | lo)
+	}
+	return out, nil
+}
+
+// yubikeyCRC computes the ISO13239 CRC used by Yubico OTP tokens; a valid token yields 0xf0b8
+func yubikeyCRC(data []byte) uint16 {
+	crc := uint16(0xffff)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			lsb := crc & 1
+			crc >>= 1
+			if lsb != 0 {
+				crc ^= 0x8408
+			}
+		}
+	}
+	return crc
+}
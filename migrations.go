@@ -0,0 +1,12 @@
+package yubiapp
+
+import "embed"
+
+// Migrations holds the versioned SQL migrations applied by `yubiapp-cli migrate`
+// and checked by the API server on startup.
+//
+//go:embed database/migrations/*.sql
+var Migrations embed.FS
+
+// MigrationsDir is the directory of Migrations that holds the migration files
+const MigrationsDir = "database/migrations"
@@ -0,0 +1,10 @@
+// Package yubiapp holds assets that live at the repository root.
+package yubiapp
+
+import _ "embed"
+
+// OpenAPISpec is the API description served at /api/v1/openapi.json. It is
+// checked against the router with `make openapi-check`.
+//
+//go:embed openapi.yaml
+var OpenAPISpec []byte
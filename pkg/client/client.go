@@ -0,0 +1,185 @@
+// Package client is a Go client for the YubiApp gRPC API, for internal services
+// that authenticate users or check permissions without going through HTTP.
+//
+// Calls to GetUser and CheckPermission authenticate the calling service, either
+// with a TLS client certificate mapped in server.tls.client_identities or with
+// a device code passed via WithDeviceAuth.
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/YubiApp/pkg/yubiapppb"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// errorDomain is the ErrorInfo domain of YubiApp error codes
+const errorDomain = "yubiapp"
+
+// Client calls the YubiApp gRPC API
+type Client struct {
+	conn *grpc.ClientConn
+	api  yubiapppb.YubiAppClient
+}
+
+// TLSOptions configures the connection's TLS. CertFile and KeyFile are the
+// client certificate that identifies the calling service.
+type TLSOptions struct {
+	CAFile     string
+	CertFile   string
+	KeyFile    string
+	ServerName string
+}
+
+// Dial connects to the gRPC API at addr (host:port). A nil tlsOptions connects
+// without TLS, for local development only.
+func Dial(addr string, tlsOptions *TLSOptions, opts ...grpc.DialOption) (*Client, error) {
+	creds := insecure.NewCredentials()
+	if tlsOptions != nil {
+		tlsConfig, err := tlsOptions.config()
+		if err != nil {
+			return nil, err
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	conn, err := grpc.Dial(addr, append([]grpc.DialOption{grpc.WithTransportCredentials(creds)}, opts...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	return &Client{conn: conn, api: yubiapppb.NewYubiAppClient(conn)}, nil
+}
+
+// New creates a client on an existing connection, which the caller closes
+func New(conn grpc.ClientConnInterface) *Client {
+	return &Client{api: yubiapppb.NewYubiAppClient(conn)}
+}
+
+// Close closes the connection opened by Dial
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+// WithDeviceAuth returns a context whose calls authenticate with a device code
+// instead of the client certificate
+func WithDeviceAuth(ctx context.Context, deviceType, authCode string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", deviceType+":"+authCode)
+}
+
+// WithRequestID returns a context whose calls carry requestID, which the server
+// logs and returns in the x-request-id header
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "x-request-id", requestID)
+}
+
+// AuthenticateDevice verifies a user's device code and, when permission is not
+// empty, that the user holds it
+func (c *Client) AuthenticateDevice(ctx context.Context, deviceType, authCode, permission string) (*yubiapppb.User, *yubiapppb.Device, error) {
+	resp, err := c.api.AuthenticateDevice(ctx, &yubiapppb.AuthenticateDeviceRequest{
+		DeviceType: deviceType,
+		AuthCode:   authCode,
+		Permission: permission,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp.User, resp.Device, nil
+}
+
+// CheckPermission reports whether a user holds a permission ("resource:action"
+// or a permission UUID)
+func (c *Client) CheckPermission(ctx context.Context, userID, permission string) (bool, error) {
+	resp, err := c.api.CheckPermission(ctx, &yubiapppb.CheckPermissionRequest{UserId: userID, Permission: permission})
+	if err != nil {
+		return false, err
+	}
+	return resp.Allowed, nil
+}
+
+// GetUser looks a user up by ID
+func (c *Client) GetUser(ctx context.Context, id string) (*yubiapppb.User, error) {
+	return c.getUser(ctx, &yubiapppb.GetUserRequest{Lookup: &yubiapppb.GetUserRequest_Id{Id: id}})
+}
+
+// GetUserByUsername looks a user up by username
+func (c *Client) GetUserByUsername(ctx context.Context, username string) (*yubiapppb.User, error) {
+	return c.getUser(ctx, &yubiapppb.GetUserRequest{Lookup: &yubiapppb.GetUserRequest_Username{Username: username}})
+}
+
+// GetUserByEmail looks a user up by email
+func (c *Client) GetUserByEmail(ctx context.Context, email string) (*yubiapppb.User, error) {
+	return c.getUser(ctx, &yubiapppb.GetUserRequest{Lookup: &yubiapppb.GetUserRequest_Email{Email: email}})
+}
+
+func (c *Client) getUser(ctx context.Context, req *yubiapppb.GetUserRequest) (*yubiapppb.User, error) {
+	resp, err := c.api.GetUser(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.User, nil
+}
+
+// PerformAction performs an action for the user the authorization
+// ("device_type:auth_code") belongs to, as POST /api/v1/auth/action/{action}
+// does. Actions that need a co-signer return with PendingApproval set.
+func (c *Client) PerformAction(ctx context.Context, action, authorization string, parameters map[string]interface{}) (*yubiapppb.PerformActionResponse, error) {
+	req := &yubiapppb.PerformActionRequest{Action: action, Authorization: authorization}
+	if parameters != nil {
+		var err error
+		if req.Parameters, err = structpb.NewStruct(parameters); err != nil {
+			return nil, fmt.Errorf("invalid parameters: %w", err)
+		}
+	}
+	return c.api.PerformAction(ctx, req)
+}
+
+// ErrorCode returns the YubiApp error code (e.g. "AUTH_FAILED") of an error
+// returned by the client, or "" if it has none
+func ErrorCode(err error) string {
+	st, ok := status.FromError(err)
+	if !ok {
+		return ""
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.Domain == errorDomain {
+			return info.Reason
+		}
+	}
+	return ""
+}
+
+// config builds the TLS configuration
+func (o *TLSOptions) config() (*tls.Config, error) {
+	tlsConfig := &tls.Config{ServerName: o.ServerName, MinVersion: tls.VersionTLS12}
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("CA file contains no certificates")
+		}
+	}
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
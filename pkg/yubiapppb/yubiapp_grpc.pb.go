@@ -0,0 +1,232 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v4.25.1
+// source: yubiapp/v1/yubiapp.proto
+
+package yubiapppb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	YubiApp_AuthenticateDevice_FullMethodName = "/yubiapp.v1.YubiApp/AuthenticateDevice"
+	YubiApp_CheckPermission_FullMethodName    = "/yubiapp.v1.YubiApp/CheckPermission"
+	YubiApp_GetUser_FullMethodName            = "/yubiapp.v1.YubiApp/GetUser"
+	YubiApp_PerformAction_FullMethodName      = "/yubiapp.v1.YubiApp/PerformAction"
+)
+
+// YubiAppClient is the client API for YubiApp service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type YubiAppClient interface {
+	// AuthenticateDevice verifies a user's device code, optionally checking a
+	// permission, like POST /api/v1/auth/device
+	AuthenticateDevice(ctx context.Context, in *AuthenticateDeviceRequest, opts ...grpc.CallOption) (*AuthenticateDeviceResponse, error)
+	// CheckPermission reports whether a user holds a permission
+	CheckPermission(ctx context.Context, in *CheckPermissionRequest, opts ...grpc.CallOption) (*CheckPermissionResponse, error)
+	// GetUser looks a user up by ID, username or email
+	GetUser(ctx context.Context, in *GetUserRequest, opts ...grpc.CallOption) (*GetUserResponse, error)
+	// PerformAction performs an action as the user the authorization belongs
+	// to, like POST /api/v1/auth/action/{action}
+	PerformAction(ctx context.Context, in *PerformActionRequest, opts ...grpc.CallOption) (*PerformActionResponse, error)
+}
+
+type yubiAppClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewYubiAppClient(cc grpc.ClientConnInterface) YubiAppClient {
+	return &yubiAppClient{cc}
+}
+
+func (c *yubiAppClient) AuthenticateDevice(ctx context.Context, in *AuthenticateDeviceRequest, opts ...grpc.CallOption) (*AuthenticateDeviceResponse, error) {
+	out := new(AuthenticateDeviceResponse)
+	err := c.cc.Invoke(ctx, YubiApp_AuthenticateDevice_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *yubiAppClient) CheckPermission(ctx context.Context, in *CheckPermissionRequest, opts ...grpc.CallOption) (*CheckPermissionResponse, error) {
+	out := new(CheckPermissionResponse)
+	err := c.cc.Invoke(ctx, YubiApp_CheckPermission_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *yubiAppClient) GetUser(ctx context.Context, in *GetUserRequest, opts ...grpc.CallOption) (*GetUserResponse, error) {
+	out := new(GetUserResponse)
+	err := c.cc.Invoke(ctx, YubiApp_GetUser_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *yubiAppClient) PerformAction(ctx context.Context, in *PerformActionRequest, opts ...grpc.CallOption) (*PerformActionResponse, error) {
+	out := new(PerformActionResponse)
+	err := c.cc.Invoke(ctx, YubiApp_PerformAction_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// YubiAppServer is the server API for YubiApp service.
+// All implementations must embed UnimplementedYubiAppServer
+// for forward compatibility
+type YubiAppServer interface {
+	// AuthenticateDevice verifies a user's device code, optionally checking a
+	// permission, like POST /api/v1/auth/device
+	AuthenticateDevice(context.Context, *AuthenticateDeviceRequest) (*AuthenticateDeviceResponse, error)
+	// CheckPermission reports whether a user holds a permission
+	CheckPermission(context.Context, *CheckPermissionRequest) (*CheckPermissionResponse, error)
+	// GetUser looks a user up by ID, username or email
+	GetUser(context.Context, *GetUserRequest) (*GetUserResponse, error)
+	// PerformAction performs an action as the user the authorization belongs
+	// to, like POST /api/v1/auth/action/{action}
+	PerformAction(context.Context, *PerformActionRequest) (*PerformActionResponse, error)
+	mustEmbedUnimplementedYubiAppServer()
+}
+
+// UnimplementedYubiAppServer must be embedded to have forward compatible implementations.
+type UnimplementedYubiAppServer struct {
+}
+
+func (UnimplementedYubiAppServer) AuthenticateDevice(context.Context, *AuthenticateDeviceRequest) (*AuthenticateDeviceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AuthenticateDevice not implemented")
+}
+func (UnimplementedYubiAppServer) CheckPermission(context.Context, *CheckPermissionRequest) (*CheckPermissionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CheckPermission not implemented")
+}
+func (UnimplementedYubiAppServer) GetUser(context.Context, *GetUserRequest) (*GetUserResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUser not implemented")
+}
+func (UnimplementedYubiAppServer) PerformAction(context.Context, *PerformActionRequest) (*PerformActionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PerformAction not implemented")
+}
+func (UnimplementedYubiAppServer) mustEmbedUnimplementedYubiAppServer() {}
+
+// UnsafeYubiAppServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to YubiAppServer will
+// result in compilation errors.
+type UnsafeYubiAppServer interface {
+	mustEmbedUnimplementedYubiAppServer()
+}
+
+func RegisterYubiAppServer(s grpc.ServiceRegistrar, srv YubiAppServer) {
+	s.RegisterService(&YubiApp_ServiceDesc, srv)
+}
+
+func _YubiApp_AuthenticateDevice_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AuthenticateDeviceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(YubiAppServer).AuthenticateDevice(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: YubiApp_AuthenticateDevice_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(YubiAppServer).AuthenticateDevice(ctx, req.(*AuthenticateDeviceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _YubiApp_CheckPermission_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CheckPermissionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(YubiAppServer).CheckPermission(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: YubiApp_CheckPermission_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(YubiAppServer).CheckPermission(ctx, req.(*CheckPermissionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _YubiApp_GetUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(YubiAppServer).GetUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: YubiApp_GetUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(YubiAppServer).GetUser(ctx, req.(*GetUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _YubiApp_PerformAction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PerformActionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(YubiAppServer).PerformAction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: YubiApp_PerformAction_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(YubiAppServer).PerformAction(ctx, req.(*PerformActionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// YubiApp_ServiceDesc is the grpc.ServiceDesc for YubiApp service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var YubiApp_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "yubiapp.v1.YubiApp",
+	HandlerType: (*YubiAppServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "AuthenticateDevice",
+			Handler:    _YubiApp_AuthenticateDevice_Handler,
+		},
+		{
+			MethodName: "CheckPermission",
+			Handler:    _YubiApp_CheckPermission_Handler,
+		},
+		{
+			MethodName: "GetUser",
+			Handler:    _YubiApp_GetUser_Handler,
+		},
+		{
+			MethodName: "PerformAction",
+			Handler:    _YubiApp_PerformAction_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "yubiapp/v1/yubiapp.proto",
+}
@@ -0,0 +1,42 @@
+package yubiclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// PerformAction performs an action (e.g. "user-signin") as the user of the
+// device code in ctx (WithDeviceAuth), or of the session for actions that
+// allow session auth. Actions that need a co-signer come back with
+// PendingApproval set. Actions are never retried. A manager performs an
+// action for a direct report by setting "on_behalf_of" to the report's ID.
+func (c *Client) PerformAction(ctx context.Context, action string, parameters map[string]interface{}) (*ActionResult, error) {
+	if parameters == nil {
+		parameters = map[string]interface{}{}
+	}
+	var raw map[string]interface{}
+	status, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/auth/action/" + url.PathEscape(action),
+		body:   parameters,
+	}, &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode the typed fields from the same response
+	encoded, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	result := &ActionResult{}
+	if err := json.Unmarshal(encoded, result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	result.PendingApproval = status == http.StatusAccepted
+	result.Raw = raw
+	return result, nil
+}
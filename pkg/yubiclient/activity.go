@@ -0,0 +1,110 @@
+package yubiclient
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ActivityQuery filters activity history. Zero values are not filtered on;
+// Limit defaults to 50 on the server.
+type ActivityQuery struct {
+	From        time.Time
+	To          time.Time
+	UserIDs     []uuid.UUID // Ignored by UserActivity
+	LocationIDs []uuid.UUID
+	StatusIDs   []uuid.UUID
+	ActionIDs   []uuid.UUID
+	Limit       int
+	Offset      int
+}
+
+// activityResponse is the {"data": [...], "meta": {...}} response of the
+// activity endpoints
+type activityResponse struct {
+	Data []Activity `json:"data"`
+	Meta struct {
+		Total  int `json:"total"`
+		Limit  int `json:"limit"`
+		Offset int `json:"offset"`
+	} `json:"meta"`
+}
+
+// ListActivity lists activity history, newest first
+func (c *Client) ListActivity(ctx context.Context, q ActivityQuery) (*ActivityPage, error) {
+	query := q.values()
+	if len(q.UserIDs) > 0 {
+		query.Set("user_ids", joinIDs(q.UserIDs))
+	}
+	return c.activity(ctx, "/user-activity", query)
+}
+
+// UserActivity lists one user's activity history, newest first
+func (c *Client) UserActivity(ctx context.Context, userID uuid.UUID, q ActivityQuery) (*ActivityPage, error) {
+	return c.activity(ctx, "/user-activity/"+pathID(userID), q.values())
+}
+
+// GetActivity gets one activity entry
+func (c *Client) GetActivity(ctx context.Context, id uuid.UUID) (*Activity, error) {
+	var resp struct {
+		Data Activity `json:"data"`
+	}
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/user-activity/activity/" + pathID(id)}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Data, nil
+}
+
+func (c *Client) activity(ctx context.Context, path string, query url.Values) (*ActivityPage, error) {
+	var resp activityResponse
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: path, query: query}, &resp); err != nil {
+		return nil, err
+	}
+	return &ActivityPage{
+		Activities: resp.Data,
+		Total:      resp.Meta.Total,
+		Limit:      resp.Meta.Limit,
+		Offset:     resp.Meta.Offset,
+	}, nil
+}
+
+// values encodes the query parameters shared by the activity endpoints
+func (q ActivityQuery) values() url.Values {
+	query := url.Values{}
+	if !q.From.IsZero() {
+		query.Set("from_datetime", q.From.Format(time.RFC3339))
+	}
+	if !q.To.IsZero() {
+		query.Set("to_datetime", q.To.Format(time.RFC3339))
+	}
+	if len(q.LocationIDs) > 0 {
+		query.Set("location_ids", joinIDs(q.LocationIDs))
+	}
+	if len(q.StatusIDs) > 0 {
+		query.Set("status_ids", joinIDs(q.StatusIDs))
+	}
+	if len(q.ActionIDs) > 0 {
+		query.Set("action_ids", joinIDs(q.ActionIDs))
+	}
+	if q.Limit > 0 {
+		query.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Offset > 0 {
+		query.Set("offset", strconv.Itoa(q.Offset))
+	}
+	return query
+}
+
+// joinIDs formats IDs as the comma-separated list the API takes
+func joinIDs(ids []uuid.UUID) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = id.String()
+	}
+	return strings.Join(parts, ",")
+}
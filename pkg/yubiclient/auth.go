@@ -0,0 +1,129 @@
+package yubiclient
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Session is an API session. Its access token authenticates reads and is
+// renewed with the refresh token.
+type Session struct {
+	ID            string    `json:"session_id"`
+	AccessToken   string    `json:"access_token"`
+	RefreshToken  string    `json:"refresh_token"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	IdleTimeout   int       `json:"idle_timeout"` // Seconds; 0 when sessions do not idle out
+	IdleExpiresAt time.Time `json:"idle_expires_at"`
+	User          *User     `json:"user,omitempty"`
+}
+
+// AuthenticateDevice verifies a device code and, when permission is not empty,
+// that its user holds the permission
+func (c *Client) AuthenticateDevice(ctx context.Context, deviceType, authCode, permission string) (*AuthResult, error) {
+	var result AuthResult
+	_, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/auth/device",
+		body:   deviceAuthRequest{DeviceType: deviceType, AuthCode: authCode, Permission: permission},
+		public: true,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Login creates a session from a device code; the client uses it for the
+// requests that follow and refreshes it as needed
+func (c *Client) Login(ctx context.Context, deviceType, authCode, permission string) (*Session, error) {
+	var session Session
+	_, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/auth/session",
+		body:   deviceAuthRequest{DeviceType: deviceType, AuthCode: authCode, Permission: permission},
+		public: true,
+	}, &session)
+	if err != nil {
+		return nil, err
+	}
+	c.SetSession(&session)
+	return &session, nil
+}
+
+// SetSession makes the client use a session, e.g. one saved from an earlier
+// Login. Nil clears it.
+func (c *Client) SetSession(session *Session) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.session = session
+}
+
+// Session returns the client's current session, or nil
+func (c *Client) Session() *Session {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.session
+}
+
+// RefreshSession exchanges the session's refresh token for new tokens. Requests
+// call it on their own when the access token is rejected.
+func (c *Client) RefreshSession(ctx context.Context) (*Session, error) {
+	current := c.Session()
+	if current == nil {
+		return nil, &Error{StatusCode: http.StatusUnauthorized, Code: "SESSION_INVALID", Message: "no session"}
+	}
+	var refreshed Session
+	_, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/auth/session/refresh/" + url.PathEscape(current.ID),
+		body:   refreshRequest{RefreshToken: current.RefreshToken},
+		public: true,
+	}, &refreshed)
+	if err != nil {
+		return nil, err
+	}
+	refreshed.User = current.User
+
+	// Another request may have refreshed or replaced the session meanwhile
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.session == current {
+		c.session = &refreshed
+	}
+	return c.session, nil
+}
+
+// Logout revokes the client's session and stops using it
+func (c *Client) Logout(ctx context.Context) error {
+	current := c.Session()
+	if current == nil {
+		return nil
+	}
+	_, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/auth/session/logout/" + url.PathEscape(current.ID),
+		body:   refreshRequest{RefreshToken: current.RefreshToken},
+		public: true,
+	}, nil)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.session == current {
+		c.session = nil
+	}
+	return nil
+}
+
+type deviceAuthRequest struct {
+	DeviceType string `json:"device_type"`
+	AuthCode   string `json:"auth_code"`
+	Permission string `json:"permission,omitempty"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
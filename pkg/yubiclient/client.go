@@ -0,0 +1,341 @@
+// Package yubiclient is a Go client for the YubiApp REST API (/api/v1).
+//
+// Reads authenticate with a session (Login), whose access token is refreshed
+// automatically when it expires. Writes and actions that need a fresh device
+// code take it from the call's context (WithDeviceAuth):
+//
+//	c, err := yubiclient.New("https://yubiapp.example.com")
+//	_, err = c.Login(ctx, "yubikey", otp, "")
+//	users, err := c.ListUsers(ctx, yubiclient.ListUsersOptions{ActiveOnly: true})
+//	user, err := c.CreateUser(yubiclient.WithDeviceAuth(ctx, "yubikey", otp), yubiclient.CreateUserRequest{...})
+package yubiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client calls the YubiApp REST API. It is safe for concurrent use.
+type Client struct {
+	baseURL     string
+	httpClient  *http.Client
+	userAgent   string
+	fingerprint string
+	language    string
+	maxRetries  int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+
+	mu        sync.Mutex
+	session   *Session
+	refreshMu sync.Mutex
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client, e.g. for TLS client certificates
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// WithUserAgent sets the User-Agent sent with every request
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) { c.userAgent = userAgent }
+}
+
+// WithClientFingerprint sets the X-Client-Fingerprint that sessions created by
+// the client are bound to
+func WithClientFingerprint(fingerprint string) Option {
+	return func(c *Client) { c.fingerprint = fingerprint }
+}
+
+// WithLanguage sets the Accept-Language sent with every request, e.g. "fr" or
+// "de-CH, de;q=0.9", for Error.LocalizedMessage and emails the server sends.
+// A user's locale setting takes precedence.
+func WithLanguage(language string) Option {
+	return func(c *Client) { c.language = language }
+}
+
+// WithRetry sets how often failed requests are retried and the backoff between
+// attempts, which doubles from min up to max (with jitter). Zero disables retries.
+func WithRetry(maxRetries int, minBackoff, maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries, c.minBackoff, c.maxBackoff = maxRetries, minBackoff, maxBackoff
+	}
+}
+
+// New creates a client for the server at baseURL (e.g. https://yubiapp.example.com)
+func New(baseURL string, opts ...Option) (*Client, error) {
+	parsed, err := url.Parse(baseURL)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid base URL %q", baseURL)
+	}
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/") + "/api/v1",
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		userAgent:  "yubiclient-go",
+		maxRetries: 3,
+		minBackoff: 200 * time.Millisecond,
+		maxBackoff: 5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Error is an error response from the API
+type Error struct {
+	StatusCode int
+	Code       string // e.g. "AUTH_FAILED"; see the ErrorCode enum in openapi.yaml
+	Message    string
+	RequestID  string
+	// LocalizedMessage is the message for users in the user's locale or the
+	// language set with WithLanguage
+	LocalizedMessage string
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("yubiapp: HTTP %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("yubiapp: %s (HTTP %d): %s", e.Code, e.StatusCode, e.Message)
+}
+
+// ErrorCode returns the API error code of err, or "" if it is not an API error
+func ErrorCode(err error) string {
+	if apiErr, ok := err.(*Error); ok {
+		return apiErr.Code
+	}
+	return ""
+}
+
+type deviceAuthKey struct{}
+
+// WithDeviceAuth returns a context whose requests authenticate with a device
+// code instead of the session. Writes need one; device codes are single use,
+// so requests carrying one are never retried.
+func WithDeviceAuth(ctx context.Context, deviceType, authCode string) context.Context {
+	return context.WithValue(ctx, deviceAuthKey{}, deviceType+":"+authCode)
+}
+
+// request is one API call
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	body   interface{}
+	// public requests send no credentials
+	public bool
+}
+
+// do sends req, retrying transient failures, and decodes a successful response
+// into out. A session whose access token was rejected is refreshed once.
+func (c *Client) do(ctx context.Context, req request, out interface{}) (int, error) {
+	var body []byte
+	if req.body != nil {
+		var err error
+		if body, err = json.Marshal(req.body); err != nil {
+			return 0, fmt.Errorf("failed to encode request: %w", err)
+		}
+	}
+
+	deviceAuth, _ := ctx.Value(deviceAuthKey{}).(string)
+	refreshed := false
+	for attempt := 0; ; attempt++ {
+		authorization := ""
+		session := c.Session()
+		if !req.public {
+			if deviceAuth != "" {
+				authorization = deviceAuth
+			} else if session != nil {
+				authorization = "Bearer " + session.AccessToken
+			}
+		}
+
+		status, respBody, header, err := c.send(ctx, req, body, authorization)
+		retryable := deviceAuth == "" && attempt < c.maxRetries && idempotent(req.method)
+		if err != nil {
+			if retryable && ctx.Err() == nil {
+				if waitErr := c.wait(ctx, attempt, 0); waitErr != nil {
+					return 0, waitErr
+				}
+				continue
+			}
+			return 0, err
+		}
+
+		if status < 300 {
+			if out != nil && status != http.StatusNoContent && len(respBody) > 0 {
+				if err := json.Unmarshal(respBody, out); err != nil {
+					return status, fmt.Errorf("failed to decode response: %w", err)
+				}
+			}
+			return status, nil
+		}
+
+		apiErr := decodeError(status, respBody, header)
+		if apiErr.Code == "SESSION_INVALID" && !req.public && deviceAuth == "" && session != nil && !refreshed {
+			refreshed = true
+			if c.refreshAfter(ctx, session) == nil {
+				continue
+			}
+			return status, apiErr
+		}
+		if retryable && retryableStatus(status) {
+			if waitErr := c.wait(ctx, attempt, retryAfter(header)); waitErr != nil {
+				return 0, waitErr
+			}
+			continue
+		}
+		return status, apiErr
+	}
+}
+
+// refreshAfter refreshes the session whose access token was rejected, unless a
+// concurrent request has refreshed it already. Refresh tokens are single use, so
+// only one refresh may run at a time.
+func (c *Client) refreshAfter(ctx context.Context, rejected *Session) error {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	if c.Session() != rejected {
+		return nil
+	}
+	_, err := c.RefreshSession(ctx)
+	return err
+}
+
+// send makes one HTTP request and reads the response
+func (c *Client) send(ctx context.Context, req request, body []byte, authorization string) (int, []byte, http.Header, error) {
+	target := c.baseURL + req.path
+	if len(req.query) > 0 {
+		target += "?" + req.query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, target, reader)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	httpReq.Header.Set("User-Agent", c.userAgent)
+	if c.language != "" {
+		httpReq.Header.Set("Accept-Language", c.language)
+	}
+	if c.fingerprint != "" {
+		httpReq.Header.Set("X-Client-Fingerprint", c.fingerprint)
+	}
+	if authorization != "" {
+		httpReq.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return resp.StatusCode, respBody, resp.Header, nil
+}
+
+// wait sleeps before the next attempt, for at least minimum
+func (c *Client) wait(ctx context.Context, attempt int, minimum time.Duration) error {
+	backoff := c.minBackoff << attempt
+	if backoff > c.maxBackoff || backoff <= 0 {
+		backoff = c.maxBackoff
+	}
+	backoff = backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+	if backoff < minimum {
+		backoff = minimum
+	}
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// decodeError builds an Error from an error response
+func decodeError(status int, body []byte, header http.Header) *Error {
+	apiErr := &Error{StatusCode: status, RequestID: header.Get("X-Request-ID")}
+	var payload struct {
+		Error     string `json:"error"`
+		Code      string `json:"code"`
+		Message   string `json:"message"`
+		RequestID string `json:"request_id"`
+	}
+	if json.Unmarshal(body, &payload) == nil && payload.Error != "" {
+		apiErr.Message, apiErr.Code, apiErr.LocalizedMessage = payload.Error, payload.Code, payload.Message
+		if payload.RequestID != "" {
+			apiErr.RequestID = payload.RequestID
+		}
+	} else {
+		apiErr.Message = http.StatusText(status)
+	}
+	return apiErr
+}
+
+// idempotent reports whether a request can be sent again safely
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// retryableStatus reports whether a status is worth retrying
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter returns the delay a Retry-After header asks for, in seconds form
+func retryAfter(header http.Header) time.Duration {
+	seconds, err := strconv.Atoi(header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// pathID escapes an ID for use in a path
+func pathID(id fmt.Stringer) string {
+	return url.PathEscape(id.String())
+}
+
+// itemEnvelope is the {"item": ...} response of single-resource endpoints
+type itemEnvelope[T any] struct {
+	Item T `json:"item"`
+}
+
+// listEnvelope is the {"items": [...], "total": n} response of list endpoints
+type listEnvelope[T any] struct {
+	Items []T `json:"items"`
+	Total int `json:"total"`
+}
@@ -0,0 +1,410 @@
+package yubiclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// fakeAPI is an httptest server speaking the API's envelopes: {"item": ...},
+// {"items": [...], "total": n} and the error envelope. The unit tests here use
+// it to script failures the real server cannot be made to produce on demand;
+// integration_test.go runs the client against the server itself.
+type fakeAPI struct {
+	t      *testing.T
+	server *httptest.Server
+	mux    *http.ServeMux
+}
+
+func newFakeAPI(t *testing.T) *fakeAPI {
+	t.Helper()
+	api := &fakeAPI{t: t, mux: http.NewServeMux()}
+	api.server = httptest.NewServer(api.mux)
+	t.Cleanup(api.server.Close)
+	return api
+}
+
+// handle routes path under /api/v1 to fn
+func (a *fakeAPI) handle(path string, fn http.HandlerFunc) {
+	a.mux.HandleFunc("/api/v1"+path, fn)
+}
+
+// client returns a client for the server with fast retries
+func (a *fakeAPI) client(opts ...Option) *Client {
+	a.t.Helper()
+	c, err := New(a.server.URL, append([]Option{WithRetry(3, time.Millisecond, 5*time.Millisecond)}, opts...)...)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return c
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("X-Request-ID", "req-1")
+	writeJSON(w, status, map[string]string{"error": message, "code": code, "request_id": "req-1"})
+}
+
+func decodeBody(t *testing.T, r *http.Request, out interface{}) {
+	t.Helper()
+	if err := json.NewDecoder(r.Body).Decode(out); err != nil {
+		t.Errorf("failed to decode request body: %v", err)
+	}
+}
+
+func TestAuthenticateDevice(t *testing.T) {
+	api := newFakeAPI(t)
+	userID := uuid.New()
+	api.handle("/auth/device", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("method is %s", r.Method)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			t.Errorf("sent credentials %q", auth)
+		}
+		var req deviceAuthRequest
+		decodeBody(t, r, &req)
+		if req.DeviceType != "yubikey" || req.AuthCode != "otp-1" || req.Permission != "users:read" {
+			t.Errorf("got request %+v", req)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"authenticated": true,
+			"user":          map[string]interface{}{"id": userID, "username": "ada"},
+			"device":        map[string]interface{}{"type": "yubikey", "identifier": "cccccckdvvul"},
+		})
+	})
+
+	result, err := api.client().AuthenticateDevice(context.Background(), "yubikey", "otp-1", "users:read")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Authenticated || result.User.ID != userID || result.Device.Identifier != "cccccckdvvul" {
+		t.Fatalf("got %+v", result)
+	}
+}
+
+func TestAuthenticateDeviceFailure(t *testing.T) {
+	api := newFakeAPI(t)
+	var calls int32
+	api.handle("/auth/device", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		writeAPIError(w, http.StatusUnauthorized, "AUTH_FAILED", "Authentication failed")
+	})
+
+	_, err := api.client().AuthenticateDevice(context.Background(), "yubikey", "otp-1", "")
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("got %v, want an *Error", err)
+	}
+	if apiErr.StatusCode != http.StatusUnauthorized || apiErr.Code != "AUTH_FAILED" || apiErr.RequestID != "req-1" {
+		t.Fatalf("got %+v", apiErr)
+	}
+	if calls != 1 {
+		t.Fatalf("sent %d requests, want 1", calls)
+	}
+}
+
+func TestDeviceAuthWrites(t *testing.T) {
+	api := newFakeAPI(t)
+	api.handle("/users", func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "yubikey:otp-2" {
+			t.Errorf("Authorization is %q", auth)
+		}
+		var req CreateUserRequest
+		decodeBody(t, r, &req)
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"item": map[string]interface{}{"id": uuid.New(), "username": req.Username, "email": req.Email},
+		})
+	})
+
+	c := api.client()
+	c.SetSession(&Session{ID: "s1", AccessToken: "a1", RefreshToken: "r1"})
+	user, err := c.CreateUser(WithDeviceAuth(context.Background(), "yubikey", "otp-2"), CreateUserRequest{Email: "ada@example.com", Username: "ada"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if user.Username != "ada" || user.Email != "ada@example.com" {
+		t.Fatalf("got %+v", user)
+	}
+}
+
+// sessionAPI serves sessions whose access tokens expire after one use of the
+// token they replace, counting refreshes
+type sessionAPI struct {
+	mu        sync.Mutex
+	access    string
+	refresh   string
+	refreshes int
+}
+
+func (s *sessionAPI) routes(t *testing.T, api *fakeAPI) {
+	api.handle("/auth/session", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.access, s.refresh = "a1", "r1"
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"session_id": "s1", "access_token": s.access, "refresh_token": s.refresh,
+			"user": map[string]interface{}{"username": "ada"},
+		})
+	})
+	api.handle("/auth/session/refresh/s1", func(w http.ResponseWriter, r *http.Request) {
+		var req refreshRequest
+		decodeBody(t, r, &req)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if req.RefreshToken != s.refresh {
+			// Refresh tokens are single use
+			writeAPIError(w, http.StatusUnauthorized, "SESSION_INVALID", "Invalid refresh token")
+			return
+		}
+		s.refreshes++
+		s.access, s.refresh = "a2", "r2"
+		writeJSON(w, http.StatusOK, map[string]interface{}{"session_id": "s1", "access_token": s.access, "refresh_token": s.refresh})
+	})
+	api.handle("/users", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		current := s.access
+		s.mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer "+current {
+			writeAPIError(w, http.StatusUnauthorized, "SESSION_INVALID", "Access token expired")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"items": []map[string]interface{}{{"username": "ada"}, {"username": "grace"}},
+			"total": 2,
+		})
+	})
+}
+
+func TestSessionRefreshAfterUnauthorized(t *testing.T) {
+	api := newFakeAPI(t)
+	sessions := &sessionAPI{}
+	sessions.routes(t, api)
+	c := api.client()
+
+	session, err := c.Login(context.Background(), "yubikey", "otp-1", "")
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if session.AccessToken != "a1" || c.Session() != session {
+		t.Fatalf("got session %+v", session)
+	}
+
+	// The server moves on to a2, as if a1 had expired
+	sessions.mu.Lock()
+	sessions.access = "expired"
+	sessions.mu.Unlock()
+
+	users, err := c.ListUsers(context.Background(), ListUsersOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(users) != 2 {
+		t.Fatalf("got %d users", len(users))
+	}
+	if got := c.Session(); got.AccessToken != "a2" || got.RefreshToken != "r2" || got.User == nil || got.User.Username != "ada" {
+		t.Fatalf("session after refresh is %+v", got)
+	}
+	if sessions.refreshes != 1 {
+		t.Fatalf("refreshed %d times, want 1", sessions.refreshes)
+	}
+}
+
+func TestConcurrentRequestsRefreshOnce(t *testing.T) {
+	api := newFakeAPI(t)
+	sessions := &sessionAPI{access: "a2", refresh: "r1"}
+	sessions.routes(t, api)
+	c := api.client()
+	c.SetSession(&Session{ID: "s1", AccessToken: "a1", RefreshToken: "r1"})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.ListUsers(context.Background(), ListUsersOptions{})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if sessions.refreshes != 1 {
+		t.Fatalf("refreshed %d times, want 1", sessions.refreshes)
+	}
+}
+
+func TestFailedRefreshReportsUnauthorized(t *testing.T) {
+	api := newFakeAPI(t)
+	sessions := &sessionAPI{access: "a2", refresh: "other"}
+	sessions.routes(t, api)
+	c := api.client()
+	c.SetSession(&Session{ID: "s1", AccessToken: "a1", RefreshToken: "r1"})
+
+	_, err := c.ListUsers(context.Background(), ListUsersOptions{})
+	if ErrorCode(err) != "SESSION_INVALID" {
+		t.Fatalf("got %v, want SESSION_INVALID", err)
+	}
+}
+
+func TestRetryOnServerErrors(t *testing.T) {
+	api := newFakeAPI(t)
+	var calls int32
+	api.handle("/users", func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			writeAPIError(w, http.StatusServiceUnavailable, "VALIDATION_SERVICE_UNAVAILABLE", "validation service unavailable")
+		case 2:
+			writeAPIError(w, http.StatusBadGateway, "UPSTREAM_FAILED", "bad gateway")
+		default:
+			writeJSON(w, http.StatusOK, map[string]interface{}{"items": []map[string]interface{}{{"username": "ada"}}, "total": 1})
+		}
+	})
+
+	users, err := api.client().ListUsers(context.Background(), ListUsersOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(users) != 1 || calls != 3 {
+		t.Fatalf("got %d users after %d requests, want 1 after 3", len(users), calls)
+	}
+}
+
+func TestRetriesGiveUp(t *testing.T) {
+	api := newFakeAPI(t)
+	var calls int32
+	api.handle("/users", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		writeAPIError(w, http.StatusServiceUnavailable, "INTERNAL_ERROR", "unavailable")
+	})
+
+	_, err := api.client().ListUsers(context.Background(), ListUsersOptions{})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("got %v, want the 503", err)
+	}
+	// One attempt and three retries
+	if calls != 4 {
+		t.Fatalf("sent %d requests, want 4", calls)
+	}
+}
+
+func TestNoRetryWithDeviceAuthOrInternalError(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		ctx    context.Context
+	}{
+		{name: "device auth", status: http.StatusServiceUnavailable, ctx: WithDeviceAuth(context.Background(), "yubikey", "otp-1")},
+		{name: "internal error", status: http.StatusInternalServerError, ctx: context.Background()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newFakeAPI(t)
+			var calls int32
+			api.handle("/users/"+uuid.Nil.String(), func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				writeAPIError(w, tt.status, "INTERNAL_ERROR", "failed")
+			})
+
+			if _, err := api.client().GetUser(tt.ctx, uuid.Nil); err == nil {
+				t.Fatal("expected an error")
+			}
+			if calls != 1 {
+				t.Fatalf("sent %d requests, want 1", calls)
+			}
+		})
+	}
+}
+
+func TestContextCancellation(t *testing.T) {
+	t.Run("during request", func(t *testing.T) {
+		api := newFakeAPI(t)
+		release := make(chan struct{})
+		defer close(release)
+		api.handle("/users", func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+		start := time.Now()
+		_, err := api.client().ListUsers(ctx, ListUsersOptions{})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("got %v, want context.Canceled", err)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Fatalf("returned after %s", elapsed)
+		}
+	})
+
+	t.Run("during backoff", func(t *testing.T) {
+		api := newFakeAPI(t)
+		var calls int32
+		api.handle("/users", func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			writeAPIError(w, http.StatusServiceUnavailable, "INTERNAL_ERROR", "unavailable")
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		c := api.client(WithRetry(5, time.Hour, time.Hour))
+		_, err := c.ListUsers(ctx, ListUsersOptions{})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("got %v, want context.DeadlineExceeded", err)
+		}
+		if calls != 1 {
+			t.Fatalf("sent %d requests, want 1", calls)
+		}
+	})
+}
+
+func TestRequestHeaders(t *testing.T) {
+	api := newFakeAPI(t)
+	api.handle("/users/attributes", func(w http.ResponseWriter, r *http.Request) {
+		for header, want := range map[string]string{
+			"User-Agent":           "test-agent",
+			"Accept-Language":      "fr",
+			"X-Client-Fingerprint": "fp-1",
+			"Accept":               "application/json",
+		} {
+			if got := r.Header.Get(header); got != want {
+				t.Errorf("%s is %q, want %q", header, got, want)
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"items": []map[string]interface{}{{"name": "department", "type": "string"}}, "total": 1})
+	})
+
+	c := api.client(WithUserAgent("test-agent"), WithLanguage("fr"), WithClientFingerprint("fp-1"))
+	attributes, err := c.ListUserAttributes(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(attributes) != 1 || !strings.EqualFold(attributes[0].Name, "department") {
+		t.Fatalf("got %+v", attributes)
+	}
+}
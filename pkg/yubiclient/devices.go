@@ -0,0 +1,112 @@
+package yubiclient
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/google/uuid"
+)
+
+// ListDevicesOptions filters ListDevices
+type ListDevicesOptions struct {
+	UserID         *uuid.UUID
+	Role           string // primary or backup
+	State          string // e.g. in_stock, assigned, lost, retired
+	ActiveOnly     bool
+	IncludeDeleted bool
+}
+
+// CreateDeviceRequest is a new device
+type CreateDeviceRequest struct {
+	UserID     uuid.UUID `json:"user_id"`
+	Type       string    `json:"type"`
+	Identifier string    `json:"identifier"`
+	Secret     string    `json:"secret,omitempty"`
+	Active     bool      `json:"active"`
+
+	FirmwareVersion string `json:"firmware_version,omitempty"`
+	FormFactor      string `json:"form_factor,omitempty"`
+	AssetTag        string `json:"asset_tag,omitempty"`
+	PurchaseOrder   string `json:"purchase_order,omitempty"`
+	PurchasedAt     string `json:"purchased_at,omitempty"` // YYYY-MM-DD
+	State           string `json:"state,omitempty"`        // in_stock or assigned (default)
+	Role            string `json:"role,omitempty"`         // primary or backup
+}
+
+// UpdateDeviceRequest changes the fields that are not nil
+type UpdateDeviceRequest struct {
+	Type       *string `json:"type,omitempty"`
+	Identifier *string `json:"identifier,omitempty"`
+	Secret     *string `json:"secret,omitempty"`
+	Active     *bool   `json:"active,omitempty"`
+
+	FirmwareVersion *string `json:"firmware_version,omitempty"`
+	FormFactor      *string `json:"form_factor,omitempty"`
+	AssetTag        *string `json:"asset_tag,omitempty"`
+	PurchaseOrder   *string `json:"purchase_order,omitempty"`
+	PurchasedAt     *string `json:"purchased_at,omitempty"` // YYYY-MM-DD; empty clears it
+	Role            *string `json:"role,omitempty"`
+
+	// Version, when set, makes the update fail with a CONFLICT error if the
+	// device has changed since it was read
+	Version *int `json:"version,omitempty"`
+}
+
+// ListDevices lists devices
+func (c *Client) ListDevices(ctx context.Context, opts ListDevicesOptions) ([]Device, error) {
+	query := url.Values{}
+	if opts.UserID != nil {
+		query.Set("user_id", opts.UserID.String())
+	}
+	if opts.Role != "" {
+		query.Set("role", opts.Role)
+	}
+	if opts.State != "" {
+		query.Set("state", opts.State)
+	}
+	if opts.ActiveOnly {
+		query.Set("active", "true")
+	}
+	if opts.IncludeDeleted {
+		query.Set("include_deleted", "true")
+	}
+	var resp listEnvelope[Device]
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/devices", query: query}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Items, nil
+}
+
+// GetDevice gets a device with its owner
+func (c *Client) GetDevice(ctx context.Context, id uuid.UUID) (*Device, error) {
+	var resp itemEnvelope[Device]
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/devices/" + pathID(id)}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Item, nil
+}
+
+// CreateDevice creates a device. Needs device auth (WithDeviceAuth).
+func (c *Client) CreateDevice(ctx context.Context, req CreateDeviceRequest) (*Device, error) {
+	var resp itemEnvelope[Device]
+	if _, err := c.do(ctx, request{method: http.MethodPost, path: "/devices", body: req}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Item, nil
+}
+
+// UpdateDevice updates a device. Needs device auth (WithDeviceAuth).
+func (c *Client) UpdateDevice(ctx context.Context, id uuid.UUID, req UpdateDeviceRequest) (*Device, error) {
+	var resp itemEnvelope[Device]
+	if _, err := c.do(ctx, request{method: http.MethodPut, path: "/devices/" + pathID(id), body: req}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Item, nil
+}
+
+// DeleteDevice soft-deletes a device. Needs device auth (WithDeviceAuth).
+func (c *Client) DeleteDevice(ctx context.Context, id uuid.UUID) error {
+	_, err := c.do(ctx, request{method: http.MethodDelete, path: "/devices/" + pathID(id)}, nil)
+	return err
+}
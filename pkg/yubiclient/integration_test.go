@@ -0,0 +1,387 @@
+//go:build integration
+
+package yubiclient
+
+// The integration tests run the client against the API server itself, backed
+// by the Postgres database named by YUBIAPP_TEST_DATABASE_NAME:
+//
+//	YUBIAPP_TEST_DATABASE_NAME=yubiapp_test go test -tags integration ./pkg/yubiclient
+//
+// The other database settings come from the usual configuration
+// (YUBIAPP_DATABASE_HOST, YUBIAPP_DATABASE_USER, ...). The database is
+// migrated up and each test seeds its own admin with TOTP devices; sessions
+// are kept in memory, so Redis is not needed.
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	yubiapp "github.com/YubiApp"
+	"github.com/YubiApp/internal/config"
+	"github.com/YubiApp/internal/database"
+	"github.com/YubiApp/internal/migrate"
+	"github.com/YubiApp/internal/server"
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+var (
+	integrationOnce   sync.Once
+	integrationURL    string
+	integrationDB     *gorm.DB
+	integrationErr    error
+	integrationServer *httptest.Server
+)
+
+// startServer migrates the test database and serves the API router on an
+// httptest server shared by the tests
+func startServer(t *testing.T) (string, *gorm.DB) {
+	t.Helper()
+	name := os.Getenv("YUBIAPP_TEST_DATABASE_NAME")
+	if name == "" {
+		t.Skip("YUBIAPP_TEST_DATABASE_NAME is not set")
+	}
+
+	integrationOnce.Do(func() {
+		cfg, err := config.LoadUnvalidated()
+		if err != nil {
+			integrationErr = err
+			return
+		}
+		cfg.Database.Name = name
+		cfg.Auth.SessionStore = "memory"
+		if cfg.Auth.JWTSecret == "" {
+			cfg.Auth.JWTSecret = "integration-test-secret"
+		}
+		cfg.Server.TLS.Enabled = false
+		cfg.Radius.Enabled = false
+		cfg.GRPC.Enabled = false
+		cfg.Web.ServeFrontend = false
+		cfg.Tracing.Enabled = false
+
+		dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+			cfg.Database.Host, cfg.Database.Port, cfg.Database.User, cfg.Database.Password, cfg.Database.Name, cfg.Database.SSLMode)
+		db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+		if err != nil {
+			integrationErr = fmt.Errorf("failed to connect to the test database: %w", err)
+			return
+		}
+		sqlDB, err := db.DB()
+		if err != nil {
+			integrationErr = err
+			return
+		}
+		migrator, err := migrate.New(sqlDB, yubiapp.Migrations, yubiapp.MigrationsDir)
+		if err != nil {
+			integrationErr = err
+			return
+		}
+		if _, err := migrator.Up(context.Background()); err != nil {
+			integrationErr = fmt.Errorf("failed to migrate the test database: %w", err)
+			return
+		}
+
+		integrationServer = httptest.NewServer(server.New(cfg).Handler())
+		integrationURL = integrationServer.URL
+		integrationDB = db
+	})
+	if integrationErr != nil {
+		t.Fatal(integrationErr)
+	}
+	return integrationURL, integrationDB
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if integrationServer != nil {
+		integrationServer.Close()
+	}
+	os.Exit(code)
+}
+
+// totpDevice is a seeded TOTP device. The server accepts a time step once, and
+// only the steps next to now, so code hands out the next unused one.
+type totpDevice struct {
+	identifier string
+	secret     []byte
+	lastStep   int64
+}
+
+// next returns the device's next code, or "" when it has used all steps
+// accepted now
+func (d *totpDevice) next() string {
+	now := time.Now().Unix() / 30
+	step := d.lastStep + 1
+	if step < now-1 {
+		step = now - 1
+	}
+	if step > now+1 {
+		return ""
+	}
+	d.lastStep = step
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, d.secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%s:%06d", d.identifier, value%1000000)
+}
+
+// testAdmin is a user with yubiapp:read and yubiapp:write and two TOTP devices,
+// for up to six device codes per test
+type testAdmin struct {
+	user    database.User
+	devices []*totpDevice
+}
+
+// code returns an unused TOTP code of one of the admin's devices
+func (a *testAdmin) code(t *testing.T) string {
+	t.Helper()
+	for _, device := range a.devices {
+		if code := device.next(); code != "" {
+			return code
+		}
+	}
+	t.Fatal("the admin's TOTP devices have no unused codes left")
+	return ""
+}
+
+// seedAdmin creates a testAdmin, removed when the test ends
+func seedAdmin(t *testing.T, db *gorm.DB) *testAdmin {
+	t.Helper()
+	suffix := uuid.NewString()[:8]
+
+	resource := database.Resource{}
+	if err := db.Where(database.Resource{Name: "yubiapp"}).
+		Attrs(database.Resource{ID: uuid.New(), Type: "application", Active: true}).
+		FirstOrCreate(&resource).Error; err != nil {
+		t.Fatal(err)
+	}
+	var permissions []database.Permission
+	for _, action := range []string{"read", "write"} {
+		permission := database.Permission{}
+		if err := db.Where(database.Permission{ResourceID: resource.ID, Action: action}).
+			Attrs(database.Permission{ID: uuid.New(), Effect: "allow"}).
+			FirstOrCreate(&permission).Error; err != nil {
+			t.Fatal(err)
+		}
+		permissions = append(permissions, permission)
+	}
+
+	role := database.Role{ID: uuid.New(), Name: "integration-" + suffix, Active: true, Permissions: permissions}
+	if err := db.Create(&role).Error; err != nil {
+		t.Fatal(err)
+	}
+	admin := &testAdmin{user: database.User{
+		ID:       uuid.New(),
+		Email:    "admin-" + suffix + "@example.com",
+		Username: "admin-" + suffix,
+		Active:   true,
+		State:    "active",
+		Roles:    []database.Role{role},
+	}}
+	if err := db.Create(&admin.user).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		secret := make([]byte, 20)
+		rand.Read(secret)
+		device := database.Device{
+			ID:         uuid.New(),
+			UserID:     &admin.user.ID,
+			Name:       "Authenticator",
+			Type:       "totp",
+			Identifier: fmt.Sprintf("totp-%s-%d", suffix, i),
+			Secret:     hex.EncodeToString(secret),
+			Active:     true,
+			VerifiedAt: time.Now(),
+		}
+		if err := db.Create(&device).Error; err != nil {
+			t.Fatal(err)
+		}
+		admin.devices = append(admin.devices, &totpDevice{identifier: device.Identifier, secret: secret})
+	}
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("user_id = ?", admin.user.ID).Delete(&database.Device{})
+		db.Unscoped().Select("Roles").Delete(&admin.user)
+		db.Select("Permissions").Delete(&role)
+	})
+	return admin
+}
+
+func newIntegrationClient(t *testing.T, url string) *Client {
+	t.Helper()
+	c, err := New(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestIntegrationDeviceAuthentication(t *testing.T) {
+	url, db := startServer(t)
+	admin := seedAdmin(t, db)
+	c := newIntegrationClient(t, url)
+	ctx := context.Background()
+
+	code := admin.code(t)
+	result, err := c.AuthenticateDevice(ctx, "totp", code, "yubiapp:write")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Authenticated || result.User.ID != admin.user.ID {
+		t.Fatalf("got %+v", result)
+	}
+
+	// The code's time step has been used
+	_, err = c.AuthenticateDevice(ctx, "totp", code, "")
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized || apiErr.Code != "AUTH_REPLAYED_OTP" {
+		t.Fatalf("replayed code: got %v, want a 401 AUTH_REPLAYED_OTP", err)
+	}
+	if apiErr.RequestID == "" {
+		t.Fatal("error has no request ID")
+	}
+
+	_, err = c.AuthenticateDevice(ctx, "totp", admin.devices[1].identifier+":000000", "")
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("wrong code: got %v, want a 401", err)
+	}
+}
+
+func TestIntegrationSession(t *testing.T) {
+	url, db := startServer(t)
+	admin := seedAdmin(t, db)
+	c := newIntegrationClient(t, url)
+	ctx := context.Background()
+
+	session, err := c.Login(ctx, "totp", admin.code(t), "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if session.User == nil || session.User.ID != admin.user.ID {
+		t.Fatalf("got session %+v", session)
+	}
+
+	user, err := c.GetUser(ctx, admin.user.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if user.Username != admin.user.Username || len(user.Roles) != 1 {
+		t.Fatalf("got %+v", user)
+	}
+
+	refreshed, err := c.RefreshSession(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if refreshed.AccessToken == session.AccessToken || refreshed.RefreshToken == session.RefreshToken {
+		t.Fatal("refresh kept the session's tokens")
+	}
+	if _, err := c.GetUser(ctx, admin.user.ID); err != nil {
+		t.Fatalf("after refresh: %v", err)
+	}
+
+	if err := c.Logout(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.Session() != nil {
+		t.Fatal("the client kept the session")
+	}
+
+	// The logged out session can neither be used nor refreshed
+	c.SetSession(refreshed)
+	_, err = c.GetUser(ctx, admin.user.ID)
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("after logout: got %v, want a 401", err)
+	}
+}
+
+func TestIntegrationUserWrites(t *testing.T) {
+	url, db := startServer(t)
+	admin := seedAdmin(t, db)
+	c := newIntegrationClient(t, url)
+	ctx := context.Background()
+
+	if _, err := c.Login(ctx, "totp", admin.code(t), ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	username := "ada-" + uuid.NewString()[:8]
+	created, err := c.CreateUser(WithDeviceAuth(ctx, "totp", admin.code(t)), CreateUserRequest{
+		Email:    username + "@example.com",
+		Username: username,
+		Password: "Correct-horse-battery-9",
+		Active:   true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { db.Unscoped().Delete(&database.User{}, "id = ?", created.ID) })
+
+	// Writes need a device code; the session is only good for reads
+	lastName := "Lovelace"
+	_, err = c.UpdateUser(ctx, created.ID, UpdateUserRequest{LastName: &lastName})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden {
+		t.Fatalf("update with the session: got %v, want a 403", err)
+	}
+
+	updated, err := c.UpdateUser(WithDeviceAuth(ctx, "totp", admin.code(t)), created.ID, UpdateUserRequest{
+		LastName: &lastName,
+		Version:  &created.Version,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if updated.LastName != lastName || updated.Version <= created.Version {
+		t.Fatalf("got %+v", updated)
+	}
+
+	// An update based on the old version conflicts
+	firstName := "Augusta"
+	_, err = c.UpdateUser(WithDeviceAuth(ctx, "totp", admin.code(t)), created.ID, UpdateUserRequest{
+		FirstName: &firstName,
+		Version:   &created.Version,
+	})
+	if ErrorCode(err) != "CONFLICT" {
+		t.Fatalf("stale update: got %v, want CONFLICT", err)
+	}
+
+	users, err := c.ListUsers(ctx, ListUsersOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	found := false
+	for _, user := range users {
+		found = found || user.ID == created.ID
+	}
+	if !found {
+		t.Fatalf("%s is not listed", username)
+	}
+
+	if err := c.DeleteUser(WithDeviceAuth(ctx, "totp", admin.code(t)), created.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := c.GetUser(ctx, created.ID); ErrorCode(err) != "NOT_FOUND" {
+		t.Fatalf("deleted user: got %v, want NOT_FOUND", err)
+	}
+}
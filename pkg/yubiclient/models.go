@@ -0,0 +1,136 @@
+package yubiclient
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Role is a role a user holds
+type Role struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+}
+
+// User is a user account
+type User struct {
+	ID           uuid.UUID              `json:"id"`
+	Email        string                 `json:"email"`
+	Username     string                 `json:"username"`
+	FirstName    string                 `json:"first_name"`
+	LastName     string                 `json:"last_name"`
+	UnixUsername string                 `json:"unix_username"`
+	Active       bool                   `json:"active"`
+	State        string                 `json:"state"`   // invited, active, suspended, leave or offboarded
+	Version      int                    `json:"version"` // Pass to UpdateUser to reject the update if the user changed since
+	Roles        []Role                 `json:"roles"`
+	Attributes   map[string]interface{} `json:"attributes"` // Custom attributes, see ListUserAttributes
+	ManagerID    *uuid.UUID             `json:"manager_id"` // The user this user reports to, if any
+	Locale       string                 `json:"locale"`     // Preferred language, e.g. fr; empty follows Accept-Language
+	Timezone     string                 `json:"timezone"`   // IANA timezone the user's days are counted in; empty is UTC
+	CreatedAt    time.Time              `json:"created_at"`
+	UpdatedAt    time.Time              `json:"updated_at"`
+	DeletedAt    *time.Time             `json:"deleted_at,omitempty"`
+}
+
+// DeviceOwner is the user a device is registered to
+type DeviceOwner struct {
+	ID       uuid.UUID `json:"id"`
+	Email    string    `json:"email"`
+	Username string    `json:"username"`
+}
+
+// Device is an authentication device (YubiKey, TOTP, ...)
+type Device struct {
+	ID              uuid.UUID    `json:"id"`
+	User            *DeviceOwner `json:"user"`    // nil for devices in stock
+	UserID          uuid.UUID    `json:"user_id"` // Set in create responses
+	Type            string       `json:"type"`
+	Identifier      string       `json:"identifier"`
+	Active          bool         `json:"active"`
+	Role            string       `json:"role"`  // primary or backup
+	State           string       `json:"state"` // e.g. in_stock, assigned, lost, retired
+	Version         int          `json:"version"`
+	FirmwareVersion string       `json:"firmware_version"`
+	FormFactor      string       `json:"form_factor"`
+	AssetTag        string       `json:"asset_tag"`
+	PurchaseOrder   string       `json:"purchase_order"`
+	PurchasedAt     *string      `json:"purchased_at"` // YYYY-MM-DD
+	AttestedAt      *time.Time   `json:"attested_at"`
+	VerifiedAt      time.Time    `json:"verified_at"`
+	LastUsedAt      time.Time    `json:"last_used_at"`
+	StateChangedAt  *time.Time   `json:"state_changed_at"`
+	CreatedAt       time.Time    `json:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at"`
+	DeletedAt       *time.Time   `json:"deleted_at,omitempty"`
+}
+
+// AuthResult is a successful device authentication
+type AuthResult struct {
+	Authenticated bool   `json:"authenticated"`
+	User          User   `json:"user"`
+	Device        Device `json:"device"`
+}
+
+// ActionResult is the outcome of performing an action. Actions that need a
+// co-signer are held with PendingApproval set and Approval describing the request.
+type ActionResult struct {
+	Action          string                 `json:"action"`
+	UserID          uuid.UUID              `json:"user_id"`
+	Success         bool                   `json:"success"`
+	Message         string                 `json:"message"`
+	PendingApproval bool                   `json:"-"`
+	Approval        map[string]interface{} `json:"approval,omitempty"`
+	ProxiedBy       *uuid.UUID             `json:"proxied_by,omitempty"` // The manager who performed the action for UserID
+	// Raw is the whole response, including action-specific details such as
+	// geofence, side_effects, door and pipeline
+	Raw map[string]interface{} `json:"-"`
+}
+
+// ActivityAction is the action an activity entry was recorded by
+type ActivityAction struct {
+	ID           uuid.UUID
+	Name         string
+	ActivityType string
+}
+
+// ActivityLocation is where an activity took place
+type ActivityLocation struct {
+	ID   uuid.UUID
+	Name string
+}
+
+// ActivityStatus is the user status an activity put the user in
+type ActivityStatus struct {
+	ID   uuid.UUID
+	Name string
+	Type string
+}
+
+// Activity is an entry of a user's activity history. The API encodes these with
+// Go field names, hence the missing JSON tags.
+type Activity struct {
+	ID           uuid.UUID
+	UserID       uuid.UUID
+	ActionID     uuid.UUID
+	Action       ActivityAction
+	FromDateTime time.Time
+	ToDateTime   *time.Time // nil while the activity is ongoing
+	LocationID   *uuid.UUID
+	Location     *ActivityLocation
+	StatusID     *uuid.UUID
+	Status       *ActivityStatus
+	Details      json.RawMessage
+	Timezone     string // Zone the times are expressed in: the location's, else the user's
+	CreatedAt    time.Time
+}
+
+// ActivityPage is one page of activity entries
+type ActivityPage struct {
+	Activities []Activity
+	Total      int
+	Limit      int
+	Offset     int
+}
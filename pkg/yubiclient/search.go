@@ -0,0 +1,46 @@
+package yubiclient
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// SearchOptions narrows Search
+type SearchOptions struct {
+	Types []string // user, device, role and/or action; all when empty
+	Limit int      // Maximum results of each type; the server default (10) when 0
+}
+
+// SearchResult is a user, device, role or action matching a search
+type SearchResult struct {
+	Type     string    `json:"type"` // user, device, role or action
+	ID       uuid.UUID `json:"id"`
+	Title    string    `json:"title"`
+	Subtitle string    `json:"subtitle"`
+	Active   bool      `json:"active"`
+	Score    float64   `json:"score"` // Similarity to the query, from 0 to 1
+}
+
+// Search searches users, devices, roles and actions for query (at least two
+// characters), grouped by type and best match first. Types the caller cannot
+// read are left out.
+func (c *Client) Search(ctx context.Context, query string, opts SearchOptions) ([]SearchResult, error) {
+	values := url.Values{}
+	values.Set("q", query)
+	if len(opts.Types) > 0 {
+		values.Set("types", strings.Join(opts.Types, ","))
+	}
+	if opts.Limit > 0 {
+		values.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	var resp listEnvelope[SearchResult]
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/search", query: values}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Items, nil
+}
@@ -0,0 +1,157 @@
+package yubiclient
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/google/uuid"
+)
+
+// ListUsersOptions filters ListUsers
+type ListUsersOptions struct {
+	ActiveOnly     bool
+	IncludeDeleted bool              // Includes soft-deleted users, with DeletedAt set
+	Attributes     map[string]string // Custom attribute values users must have, e.g. department: Engineering
+}
+
+// UserAttribute is a custom attribute users carry, as configured on the server
+type UserAttribute struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"` // string, number, boolean, date or user
+	Required bool     `json:"required"`
+	Enum     []string `json:"enum"` // Allowed values of a string attribute; empty allows any
+}
+
+// CreateUserRequest is a new user
+type CreateUserRequest struct {
+	Email     string `json:"email"`
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	FirstName string `json:"first_name,omitempty"`
+	LastName  string `json:"last_name,omitempty"`
+	Active    bool   `json:"active"`
+	// Attributes are the user's custom attributes; required ones must be given
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	ManagerID  *uuid.UUID             `json:"manager_id,omitempty"`
+	// Locale is the language error messages and emails are written in for
+	// the user, e.g. fr or pt-BR
+	Locale string `json:"locale,omitempty"`
+	// Timezone is the IANA zone summaries and timesheets count the user's
+	// days in, e.g. Europe/Paris
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// UpdateUserRequest changes the fields that are not nil
+type UpdateUserRequest struct {
+	Email        *string `json:"email,omitempty"`
+	Username     *string `json:"username,omitempty"`
+	Password     *string `json:"password,omitempty"`
+	FirstName    *string `json:"first_name,omitempty"`
+	LastName     *string `json:"last_name,omitempty"`
+	UnixUsername *string `json:"unix_username,omitempty"`
+	Active       *bool   `json:"active,omitempty"`
+	// Attributes are merged into the user's custom attributes; a nil value
+	// removes an attribute
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	// ManagerID is the ID of the user's new manager, or "" to remove it
+	ManagerID *string `json:"manager_id,omitempty"`
+	// Locale is the user's new preferred language, or "" to follow
+	// Accept-Language
+	Locale *string `json:"locale,omitempty"`
+	// Timezone is the user's new IANA timezone, or "" for UTC
+	Timezone *string `json:"timezone,omitempty"`
+	// Version, when set, makes the update fail with a CONFLICT error if the
+	// user has changed since it was read
+	Version *int `json:"version,omitempty"`
+}
+
+// ListUsers lists users with their roles
+func (c *Client) ListUsers(ctx context.Context, opts ListUsersOptions) ([]User, error) {
+	query := url.Values{}
+	if opts.ActiveOnly {
+		query.Set("active", "true")
+	}
+	if opts.IncludeDeleted {
+		query.Set("include_deleted", "true")
+	}
+	for name, value := range opts.Attributes {
+		query.Set("attr."+name, value)
+	}
+	var resp listEnvelope[User]
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/users", query: query}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Items, nil
+}
+
+// ListUserAttributes lists the custom attributes users carry
+func (c *Client) ListUserAttributes(ctx context.Context) ([]UserAttribute, error) {
+	var resp listEnvelope[UserAttribute]
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/users/attributes"}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Items, nil
+}
+
+// GetUser gets a user with their roles
+func (c *Client) GetUser(ctx context.Context, id uuid.UUID) (*User, error) {
+	var resp itemEnvelope[User]
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/users/" + pathID(id)}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Item, nil
+}
+
+// CreateUser creates a user. Needs device auth (WithDeviceAuth).
+func (c *Client) CreateUser(ctx context.Context, req CreateUserRequest) (*User, error) {
+	var resp itemEnvelope[User]
+	if _, err := c.do(ctx, request{method: http.MethodPost, path: "/users", body: req}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Item, nil
+}
+
+// UpdateUser updates a user. Needs device auth (WithDeviceAuth).
+func (c *Client) UpdateUser(ctx context.Context, id uuid.UUID, req UpdateUserRequest) (*User, error) {
+	var resp itemEnvelope[User]
+	if _, err := c.do(ctx, request{method: http.MethodPut, path: "/users/" + pathID(id), body: req}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Item, nil
+}
+
+// DeleteUser soft-deletes a user. Needs device auth (WithDeviceAuth).
+func (c *Client) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	_, err := c.do(ctx, request{method: http.MethodDelete, path: "/users/" + pathID(id)}, nil)
+	return err
+}
+
+// ListUserReports lists the users who report directly to a user. Only the
+// users' profile, state and ManagerID are set.
+func (c *Client) ListUserReports(ctx context.Context, id uuid.UUID) ([]User, error) {
+	var resp listEnvelope[User]
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/users/" + pathID(id) + "/reports"}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Items, nil
+}
+
+// ManagersChain lists a user's manager, their manager and so on, nearest
+// first. Only the users' profile, state and ManagerID are set.
+func (c *Client) ManagersChain(ctx context.Context, id uuid.UUID) ([]User, error) {
+	var resp listEnvelope[User]
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/users/" + pathID(id) + "/managers-chain"}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Items, nil
+}
+
+// ListUserDevices lists a user's devices
+func (c *Client) ListUserDevices(ctx context.Context, id uuid.UUID) ([]Device, error) {
+	var resp listEnvelope[Device]
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/users/" + pathID(id) + "/devices"}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Items, nil
+}
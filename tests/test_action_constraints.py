@@ -0,0 +1,198 @@
+#!/usr/bin/env python3
+"""
+Test script for YubiApp action constraints
+Checks that invalid constraints in Action.Details are rejected and that
+schedule, frequency and preceding-action constraints are enforced when
+actions are performed. Uses YubiKey authentication for all operations.
+"""
+
+import requests
+import getpass
+import sys
+from datetime import datetime, timedelta, timezone
+from typing import Dict, Any
+
+PREFIX = "constraint-test"
+
+
+class YubiAppActionConstraintTester:
+    def __init__(self, base_url: str = "http://localhost:8080/api/v1"):
+        self.base_url = base_url
+        self.created_actions = []
+        self.passed = 0
+        self.failed = 0
+
+    def get_yubikey_otp(self, operation: str) -> str:
+        """Prompt user for YubiKey OTP"""
+        print(f"\n🔑 Please provide YubiKey OTP for {operation}:")
+        print("   (Insert your YubiKey and tap the button)")
+        otp = getpass.getpass("OTP: ").strip()
+        if not otp:
+            print("❌ No OTP provided")
+            sys.exit(1)
+        return otp
+
+    def get_auth_headers(self, otp: str) -> Dict[str, str]:
+        """Get device authentication headers"""
+        return {"Authorization": f"yubikey:{otp}"}
+
+    def check(self, name: str, condition: bool, detail: str = ""):
+        """Record a test result"""
+        if condition:
+            self.passed += 1
+            print(f"✅ {name}")
+        else:
+            self.failed += 1
+            print(f"❌ {name}")
+            if detail:
+                print(f"   {detail}")
+
+    def create_action(self, name: str, details: Dict[str, Any]) -> requests.Response:
+        """Create an action with the given details"""
+        otp = self.get_yubikey_otp(f"creating action '{name}'")
+        data = {
+            "name": name,
+            "activity_type": "user",
+            "required_permissions": [],
+            "details": details,
+            "active": True,
+        }
+        response = requests.post(f"{self.base_url}/actions", json=data, headers=self.get_auth_headers(otp))
+        if response.status_code == 200:
+            self.created_actions.append(response.json()["id"])
+        return response
+
+    def perform_action(self, name: str) -> requests.Response:
+        """Perform an action"""
+        otp = self.get_yubikey_otp(f"performing action '{name}'")
+        return requests.post(f"{self.base_url}/auth/action/{name}", json={}, headers={"Authorization": f"yubikey:{otp}"})
+
+    def delete_action(self, action_id: str):
+        """Delete an action"""
+        otp = self.get_yubikey_otp("deleting a test action")
+        response = requests.delete(f"{self.base_url}/actions/{action_id}", headers=self.get_auth_headers(otp))
+        if response.status_code != 200:
+            print(f"⚠️  Failed to delete action {action_id}: {response.status_code}")
+
+    def test_validation(self):
+        """Invalid constraints are rejected when the action is saved"""
+        print("\n1️⃣  Constraint Validation")
+        invalid = {
+            "unknown day": {"allowed_days": ["mon", "funday"]},
+            "bad hours": {"allowed_hours": {"from": "6am", "to": "22:00"}},
+            "empty hours window": {"allowed_hours": {"from": "09:00", "to": "09:00"}},
+            "unknown timezone": {"timezone": "Mars/Olympus"},
+            "negative max_per_day": {"max_per_day": -1},
+            "cleared_by without preceding": {"preceding_action_cleared_by": ["user-signout"]},
+            "unknown field": {"max_per_week": 3},
+        }
+        for case, constraints in invalid.items():
+            response = self.create_action(f"{PREFIX}-invalid", {"constraints": constraints})
+            self.check(f"rejects {case}",
+                       response.status_code >= 400 and "invalid constraints" in response.text,
+                       f"{response.status_code}: {response.text}")
+
+    def test_enforcement(self):
+        """Constraints are enforced when actions are performed"""
+        print("\n2️⃣  Constraint Enforcement")
+        start = f"{PREFIX}-start"
+        end = f"{PREFIX}-end"
+        brk = f"{PREFIX}-break"
+        closed = f"{PREFIX}-closed"
+
+        for name in (start, end):
+            response = self.create_action(name, {})
+            self.check(f"creates {name}", response.status_code == 200, response.text)
+
+        response = self.create_action(brk, {"constraints": {
+            "requires_preceding_action": start,
+            "preceding_action_cleared_by": [end],
+            "max_per_day": 1,
+        }})
+        self.check(f"creates {brk}", response.status_code == 200, response.text)
+
+        # A one-minute window that closed an hour ago
+        now = datetime.now(timezone.utc)
+        window_start = now - timedelta(hours=1)
+        response = self.create_action(closed, {"constraints": {
+            "allowed_hours": {
+                "from": window_start.strftime("%H:%M"),
+                "to": (window_start + timedelta(minutes=1)).strftime("%H:%M"),
+            },
+            "timezone": "UTC",
+        }})
+        self.check(f"creates {closed}", response.status_code == 200, response.text)
+
+        response = self.perform_action(closed)
+        self.check("blocks action outside allowed hours",
+                   response.status_code == 403 and "only allowed between" in response.text, response.text)
+
+        response = self.perform_action(brk)
+        self.check("blocks action before its preceding action",
+                   response.status_code == 403 and "performed first" in response.text, response.text)
+
+        response = self.perform_action(start)
+        self.check("performs preceding action", response.status_code == 200, response.text)
+
+        response = self.perform_action(brk)
+        self.check("allows action after its preceding action", response.status_code == 200, response.text)
+
+        response = self.perform_action(brk)
+        self.check("blocks action beyond max_per_day",
+                   response.status_code == 403 and "per day" in response.text, response.text)
+
+    def cleanup(self):
+        """Delete the actions created by the tests"""
+        print("\n3️⃣  Cleanup")
+        for action_id in self.created_actions:
+            self.delete_action(action_id)
+        print(f"✅ Deleted {len(self.created_actions)} test action(s)")
+
+    def run_tests(self):
+        """Run all tests"""
+        print("🚀 YubiApp Action Constraints Test Suite")
+        print("=" * 50)
+        print("Note: run against a user with no prior constraint-test actions today")
+
+        try:
+            self.test_validation()
+            self.test_enforcement()
+        finally:
+            self.cleanup()
+
+        print("\n" + "=" * 50)
+        print(f"Passed: {self.passed}, Failed: {self.failed}")
+        if self.failed:
+            sys.exit(1)
+        print("🎉 All tests completed successfully!")
+
+
+def main():
+    """Main function"""
+    if len(sys.argv) > 1 and sys.argv[1] in ['--help', '-h', 'help']:
+        print("YubiApp Action Constraints Test Script")
+        print("=" * 40)
+        print("Usage:")
+        print("  python3 test_action_constraints.py [base_url]")
+        print("")
+        print("Arguments:")
+        print("  base_url    API base URL (default: http://localhost:8080/api/v1)")
+        print("")
+        print("Prerequisites:")
+        print("  - YubiApp API server running")
+        print("  - YubiKey registered to a user with yubiapp:write")
+        print("  - Python requests library installed")
+        return
+
+    base_url = sys.argv[1] if len(sys.argv) > 1 else "http://localhost:8080/api/v1"
+    tester = YubiAppActionConstraintTester(base_url)
+
+    try:
+        tester.run_tests()
+    except KeyboardInterrupt:
+        print("\n\n❌ Test interrupted by user")
+        sys.exit(1)
+
+
+if __name__ == "__main__":
+    main()